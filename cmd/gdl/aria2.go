@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// aria2OptionLine matches the option lines of an aria2 input file: an
+// indented name=value pair under the URL it applies to.
+var aria2OptionLine = regexp.MustCompile(`^[ \t]+([a-z0-9-]+)=(.*)$`)
+
+// batchItem is a download of a batch file being read, with the aria2
+// options given under its URL.
+type batchItem struct {
+	line        int
+	url         string
+	destination string
+	dir         string
+	options     *gdl.Options
+}
+
+// parseAria2Option returns the name and value of an aria2 option line, and
+// false for any other line, such as an indented URL.
+func parseAria2Option(line string) (name, value string, ok bool) {
+	match := aria2OptionLine.FindStringSubmatch(line)
+	if match == nil {
+		return "", "", false
+	}
+
+	return match[1], strings.TrimSpace(match[2]), true
+}
+
+// applyAria2Option applies an aria2 option to item, and returns false for
+// the options gdl does not support, which are ignored.
+func applyAria2Option(item *batchItem, name, value string) (bool, error) {
+	switch name {
+	case "out":
+		item.destination = value
+		return true, nil
+	case "dir":
+		item.dir = value
+		return true, nil
+	case "checksum", "header", "user-agent", "referer", "max-download-limit", "split", "allow-overwrite", "continue":
+	default:
+		return false, nil
+	}
+
+	// The other options are download settings
+	if item.options == nil {
+		item.options = &gdl.Options{}
+	}
+	opts := item.options
+
+	switch name {
+	case "checksum":
+		algorithm, digest, found := strings.Cut(value, "=")
+		if !found || algorithm == "" || digest == "" {
+			return true, fmt.Errorf("invalid checksum %q: expected TYPE=DIGEST", value)
+		}
+		normalized, err := checksum.Normalize(algorithm)
+		if err != nil {
+			return true, err
+		}
+		opts.ChecksumAlgorithm, opts.Checksum = normalized, strings.ToLower(digest)
+	case "header":
+		key, headerValue, found := strings.Cut(value, ":")
+		if !found || strings.TrimSpace(key) == "" {
+			return true, fmt.Errorf("invalid header %q: expected Name: value", value)
+		}
+		if opts.Headers == nil {
+			opts.Headers = make(map[string]string)
+		}
+		opts.Headers[strings.TrimSpace(key)] = strings.TrimSpace(headerValue)
+	case "user-agent":
+		opts.UserAgent = value
+	case "referer":
+		// "*" makes aria2 send each URL as its own referer
+		if value == "*" {
+			value = item.url
+		}
+		if opts.Headers == nil {
+			opts.Headers = make(map[string]string)
+		}
+		opts.Headers["Referer"] = value
+	case "max-download-limit":
+		rate, err := ratelimit.ParseRate(value)
+		if err != nil {
+			return true, err
+		}
+		opts.MaxRate = rate
+	case "split":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 32 {
+			return true, fmt.Errorf("invalid split %q: expected 1 to 32 connections", value)
+		}
+		opts.MaxConcurrency = n
+	case "allow-overwrite":
+		if value == "true" {
+			opts.CollisionPolicy = types.CollisionOverwrite
+		}
+	case "continue":
+		if value == "true" {
+			opts.CollisionPolicy = types.CollisionResume
+		}
+	}
+
+	return true, nil
+}
+
+// mergeItemOptions applies the settings aria2 options gave a batch job over
+// the options of the batch.
+func mergeItemOptions(opts, item *gdl.Options) {
+	if item == nil {
+		return
+	}
+
+	if item.Checksum != "" {
+		opts.Checksum, opts.ChecksumAlgorithm = item.Checksum, item.ChecksumAlgorithm
+	}
+	if len(item.Headers) > 0 {
+		opts.Headers = item.Headers
+	}
+	if item.UserAgent != "" {
+		opts.UserAgent = item.UserAgent
+	}
+	if item.MaxRate > 0 {
+		opts.MaxRate = item.MaxRate
+	}
+	if item.MaxConcurrency > 0 {
+		opts.MaxConcurrency = item.MaxConcurrency
+	}
+	if item.CollisionPolicy != "" {
+		opts.CollisionPolicy = item.CollisionPolicy
+	}
+	if len(item.Mirrors) > 0 {
+		opts.Mirrors = item.Mirrors
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/internal/manifest"
+	"github.com/forest6511/gdl/pkg/middleware"
+	"github.com/forest6511/gdl/pkg/pathtemplate"
+	"github.com/forest6511/gdl/pkg/progress"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/scheduler"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// batchConfig configures "gdl batch".
+type batchConfig struct {
+	input    string
+	output   string
+	template string
+	ifExists string
+	maxRate  string
+	small    string
+	sums     string
+	har      string
+	format   string
+	jobs     int
+	perHost  int
+	prefetch int
+	delay    time.Duration
+	warm     bool
+	dryRun   bool
+	quiet    bool
+}
+
+// runBatchCommand handles "gdl batch <file>".
+func runBatchCommand(args []string) int {
+	bcfg, err := parseBatchArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showBatchUsage()
+		return 1
+	}
+
+	input := io.Reader(os.Stdin)
+	if bcfg.input != "-" {
+		file, err := os.Open(bcfg.input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer func() { _ = file.Close() }()
+
+		input = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs, err := readBatchJobs(ctx, input, bcfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", bcfg.input, err)
+		return 1
+	}
+
+	if bcfg.dryRun {
+		return dryRun(ctx, os.Stdout, gdl.NewDownloader(), dryRunFilesFromJobs(jobs), parseBatchRate(bcfg.maxRate), bcfg.parallel())
+	}
+
+	downloader := gdl.NewDownloader()
+
+	if bcfg.har != "" {
+		recorder := middleware.NewHARRecorder(&middleware.HAROptions{Version: version})
+		if err := recorder.Save(bcfg.har); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		downloader.UseRequestMiddleware(recorder.Middleware())
+
+		defer func() {
+			if err := recorder.Save(bcfg.har); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to write the HAR file: %v\n", err)
+			}
+		}()
+	}
+
+	return batch(ctx, downloader, jobs, bcfg, os.Stdout)
+}
+
+// parseBatchArgs parses the arguments of "gdl batch", which may put flags
+// before or after the file.
+func parseBatchArgs(args []string) (*batchConfig, error) {
+	bcfg := &batchConfig{}
+
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineBatchFlags(fs, bcfg)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		return nil, fmt.Errorf("batch requires exactly one file of URLs (- for stdin)")
+	}
+	bcfg.input = positional[0]
+
+	if bcfg.jobs < 0 || bcfg.perHost < 0 || bcfg.prefetch < 0 || bcfg.delay < 0 {
+		return nil, fmt.Errorf("--jobs, --per-host, --prefetch and --host-delay cannot be negative")
+	}
+
+	if bcfg.template != "" {
+		if _, err := pathtemplate.Parse(bcfg.template); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := core.ValidateCollisionPolicy(bcfg.ifExists); err != nil {
+		return nil, err
+	}
+
+	if bcfg.maxRate != "" {
+		if err := ratelimit.ValidateRate(bcfg.maxRate); err != nil {
+			return nil, err
+		}
+	}
+
+	if size, err := parseSize(bcfg.small); err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid --small-files size: %s", bcfg.small)
+	}
+
+	if bcfg.sums != "" {
+		if _, err := manifest.ParseAlgorithms(bcfg.sums); err != nil {
+			return nil, err
+		}
+	}
+
+	if bcfg.format != "text" && bcfg.format != outputFormatNDJSON {
+		return nil, fmt.Errorf("invalid --output-format %q: must be text or ndjson", bcfg.format)
+	}
+
+	return bcfg, nil
+}
+
+// defineBatchFlags registers the flags of "gdl batch" on fs.
+func defineBatchFlags(fs *flag.FlagSet, bcfg *batchConfig) {
+	fs.StringVar(&bcfg.output, "o", ".", "Destination directory")
+	fs.StringVar(&bcfg.output, "output", ".", "Destination directory")
+	fs.StringVar(&bcfg.template, "output-template", "", "Name files without a destination from a template such as {host}/{filename}")
+	fs.StringVar(&bcfg.ifExists, "if-exists", types.CollisionFail, "What to do with existing files: fail, overwrite, skip, rename or resume")
+	fs.StringVar(&bcfg.maxRate, "max-rate", "", "Maximum download rate of each file (e.g., 1MB/s)")
+	fs.StringVar(&bcfg.small, "small-files", "1MB", "Fetch files smaller than this with a single GET, without a HEAD request (0 = never)")
+	fs.IntVar(&bcfg.jobs, "jobs", 0, "Files downloaded at once")
+	fs.IntVar(&bcfg.perHost, "per-host", 0, "Connections per host")
+	fs.DurationVar(&bcfg.delay, "host-delay", 0, "Minimum delay between requests to the same host")
+	fs.StringVar(&bcfg.har, "har", "", "Record the HTTP requests and responses of the batch to FILE in HAR format")
+	fs.StringVar(&bcfg.sums, "checksums", "", "Write checksum manifests of the files to the output directory: sha256, blake3 or both")
+	fs.IntVar(&bcfg.prefetch, "prefetch", 8, "Upcoming files whose host names are resolved ahead of time (0 = none)")
+	fs.BoolVar(&bcfg.warm, "warm-connections", false, "Also open connections to the hosts of upcoming files ahead of time")
+	fs.StringVar(&bcfg.format, "output-format", "text", "Output format: text, or ndjson for batch_progress events")
+	fs.BoolVar(&bcfg.dryRun, "dry-run", false, "Report each file's final URL, size, range support and time without downloading")
+	fs.BoolVar(&bcfg.quiet, "q", false, "Only report failures")
+	fs.BoolVar(&bcfg.quiet, "quiet", false, "Only report failures")
+}
+
+// readBatchJobs reads one download per line: a URL, optionally followed by
+// its destination. Blank lines and lines starting with # are skipped.
+// Destinations are relative to bcfg.output; a URL without one is named by
+// --output-template or after the URL.
+//
+// aria2 input files are read as well: tab-separated URLs on one line are
+// mirrors of the same file, and the indented name=value lines under a URL
+// set its options (see applyAria2Option). Options gdl does not support are
+// reported once each and ignored.
+func readBatchJobs(ctx context.Context, r io.Reader, bcfg *batchConfig) ([]gdl.BatchJob, error) {
+	var jobs []gdl.BatchJob
+	var item *batchItem
+	ignored := make(map[string]bool)
+
+	finish := func() error {
+		if item == nil {
+			return nil
+		}
+		job, err := batchJob(ctx, item, bcfg)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, job)
+		item = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if name, value, ok := parseAria2Option(scanner.Text()); ok {
+			if item == nil {
+				return nil, fmt.Errorf("line %d: option %s comes before any URL", line, name)
+			}
+			supported, err := applyAria2Option(item, name, value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", line, name, err)
+			}
+			if !supported && !ignored[name] {
+				ignored[name] = true
+				fmt.Fprintf(os.Stderr, "Warning: ignoring the aria2 option %s, which gdl does not support\n", name)
+			}
+			continue
+		}
+
+		if err := finish(); err != nil {
+			return nil, err
+		}
+
+		uris, destination, _ := strings.Cut(text, " ")
+		urls := strings.Split(uris, "\t")
+		item = &batchItem{line: line, url: urls[0], destination: strings.TrimSpace(destination)}
+		if len(urls) > 1 {
+			item.options = &gdl.Options{Mirrors: urls[1:]}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no URLs found")
+	}
+
+	return jobs, nil
+}
+
+// batchJob returns the job of a download read from a batch file. The aria2
+// option dir replaces bcfg.output, as it replaces aria2's --dir.
+func batchJob(ctx context.Context, item *batchItem, bcfg *batchConfig) (gdl.BatchJob, error) {
+	destination := item.destination
+
+	if destination == "" && bcfg.template != "" {
+		var err error
+		if destination, err = gdl.ExpandOutputTemplate(ctx, bcfg.template, item.url); err != nil {
+			return gdl.BatchJob{}, fmt.Errorf("line %d: %w", item.line, err)
+		}
+	} else if destination == "" {
+		destination = extractFilenameFromURL(item.url)
+	}
+
+	dir := bcfg.output
+	if item.dir != "" {
+		dir = item.dir
+	}
+
+	destination = filepath.Join(dir, destination)
+
+	return gdl.BatchJob{ID: destination, URL: item.url, Destination: destination, Options: item.options}, nil
+}
+
+// batch downloads jobs and reports each file.
+func batch(ctx context.Context, downloader *gdl.Downloader, jobs []gdl.BatchJob, bcfg *batchConfig, out io.Writer) int {
+	smallFiles, _ := parseSize(bcfg.small)
+
+	for i := range jobs {
+		opts := &gdl.Options{
+			CreateDirs:         true,
+			CollisionPolicy:    bcfg.ifExists,
+			MaxRate:            parseBatchRate(bcfg.maxRate),
+			SmallFileThreshold: smallFiles,
+			AtomicWrite:        true,
+			Quiet:              true,
+			HostCache:          hostCacheFile(),
+		}
+		mergeItemOptions(opts, jobs[i].Options)
+		jobs[i].Options = opts
+	}
+
+	batchOpts := &gdl.BatchOptions{
+		MaxParallelJobs:       bcfg.jobs,
+		MaxConnectionsPerHost: bcfg.perHost,
+		HostDelay:             bcfg.delay,
+		Prefetch:              bcfg.prefetch,
+		WarmConnections:       bcfg.warm,
+	}
+
+	// ndjson output carries the events, and the report goes to stderr
+	var display *batchProgress
+	if bcfg.format == outputFormatNDJSON {
+		display = &batchProgress{events: json.NewEncoder(out), interval: ndjsonProgressInterval, now: time.Now}
+		out = os.Stderr
+	} else if !bcfg.quiet && out == os.Stdout && isTerminal() {
+		display = &batchProgress{out: out, interval: batchProgressInterval, now: time.Now}
+	}
+
+	if display != nil {
+		batchOpts.Progress = progress.NewAggregator(display.update)
+	}
+
+	results, err := downloader.DownloadBatch(ctx, jobs, batchOpts)
+	if display != nil {
+		display.clear()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	return finishBatch(out, results, bcfg.output, bcfg.sums, bcfg.quiet)
+}
+
+// batchProgressInterval is the minimum time between two redraws of the
+// progress line of a batch.
+const batchProgressInterval = 200 * time.Millisecond
+
+// batchProgress shows the combined progress of a batch, either redrawn on
+// one line of a terminal or as ndjson batch_progress events. The aggregate
+// calls update one snapshot at a time, in order.
+type batchProgress struct {
+	out      io.Writer     // Terminal the progress line is drawn on
+	events   *json.Encoder // ndjson event stream, instead of out
+	interval time.Duration
+	now      func() time.Time
+	last     time.Time
+	drawn    bool
+}
+
+// update shows snapshot unless the last one was shown less than an interval
+// ago. Snapshots where the last job finished are always shown.
+func (p *batchProgress) update(snapshot types.AggregateSnapshot) {
+	now := p.now()
+	done := snapshot.CompletedJobs+snapshot.FailedJobs == snapshot.TotalJobs
+
+	if !done && !p.last.IsZero() && now.Sub(p.last) < p.interval {
+		return
+	}
+
+	p.last = now
+
+	if p.events != nil {
+		// Encoding errors are ignored: a broken output stream must not abort the batch.
+		_ = p.events.Encode(ndjsonBatchProgressEvent{
+			SchemaVersion:     ndjsonSchemaVersion,
+			Event:             ndjsonEventBatchProgress,
+			Timestamp:         now.UTC(),
+			AggregateSnapshot: snapshot,
+		})
+
+		return
+	}
+
+	_, _ = fmt.Fprintf(p.out, "\r\033[K%s", progress.FormatAggregate(snapshot))
+	p.drawn = true
+}
+
+// clear erases the progress line, once the batch is over.
+func (p *batchProgress) clear() {
+	if p.drawn {
+		_, _ = fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+// finishBatch reports the results of a batch or mirror downloaded to dir and
+// writes the checksum manifests asked for with --checksums.
+func finishBatch(out io.Writer, results []gdl.BatchResult, dir, sums string, quiet bool) int {
+	status := reportBatchResults(out, results, quiet, dir)
+
+	if sums != "" {
+		algorithms, _ := manifest.ParseAlgorithms(sums)
+		if err := writeManifests(out, results, dir, algorithms, quiet); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing checksums: %v\n", err)
+			return 1
+		}
+	}
+
+	return status
+}
+
+// parallel returns the number of files downloaded at once.
+func (bcfg *batchConfig) parallel() int {
+	if bcfg.jobs == 0 {
+		return scheduler.DefaultMaxParallel
+	}
+
+	return bcfg.jobs
+}
+
+// parseBatchRate converts a validated --max-rate of batch or mirror to bytes
+// per second, 0 for unlimited.
+func parseBatchRate(rate string) int64 {
+	if rate == "" {
+		return 0
+	}
+
+	bytesPerSecond, _ := ratelimit.ParseRate(rate)
+
+	return bytesPerSecond
+}
+
+// reportBatchResults prints the outcome of each file of a batch or mirror
+// downloaded to dir, records the files in the history and the bandwidth used
+// for "gdl stats", and returns the exit status: 1 if any file failed.
+func reportBatchResults(out io.Writer, results []gdl.BatchResult, quiet bool, dir string) int {
+	failed := 0
+	for _, result := range results {
+		if result.State != scheduler.StateSucceeded {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %s: %v\n", result.ID, result.State, result.Error)
+			continue
+		}
+
+		if !result.Stats.Deduplicated {
+			recordUsage(result.Stats.URL, result.Stats.BytesDownloaded, result.Stats.Duration)
+		}
+
+		if !result.Stats.Skipped && !result.Stats.NotModified && historyFile() != "" {
+			recordHistory(result.Stats.URL, batchResultPath(result, dir),
+				max(result.Stats.TotalSize, result.Stats.BytesDownloaded), "")
+		}
+
+		if quiet {
+			continue
+		}
+
+		if result.Stats.Skipped {
+			_, _ = fmt.Fprintf(out, "%s (exists, skipped)\n", result.ID)
+		} else {
+			_, _ = fmt.Fprintf(out, "%s (%s)\n", result.ID, formatBytes(result.Stats.BytesDownloaded))
+		}
+	}
+
+	if !quiet || failed > 0 {
+		_, _ = fmt.Fprintf(out, "%d of %d files downloaded to %s\n", len(results)-failed, len(results), dir)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// batchResultPath returns where the file of a batch or mirror downloaded to
+// dir was stored.
+func batchResultPath(result gdl.BatchResult, dir string) string {
+	if result.Stats != nil && result.Stats.Filename != "" {
+		return result.Stats.Filename
+	}
+
+	return filepath.Join(dir, result.ID)
+}
+
+func showBatchUsage() {
+	fmt.Printf(`Batch Command:
+
+Usage: %s batch <file> [options]
+
+Downloads the URLs listed in file (- for stdin), several at a time. Each
+line holds a URL, optionally followed by a space and its destination relative
+to the output directory; blank lines and lines starting with # are skipped.
+
+aria2 input files work unchanged: tab-separated URLs on a line are mirrors of
+one file, and indented option lines under a URL set out, dir, checksum,
+header, user-agent, referer, max-download-limit, split, allow-overwrite and
+continue for it. Other aria2 options are ignored with a warning.
+
+Options:
+  -o, --output DIR      Destination directory (default: .)
+      --output-template T  Name files without a destination from a template,
+                        e.g. "{host}/{path}/{filename}"
+      --if-exists POLICY  What to do with existing files: fail (default),
+                        overwrite, skip, rename or resume
+      --jobs N          Files downloaded at once (default: 4)
+      --per-host N      Connections per host across all files (default: unlimited)
+      --host-delay D    Minimum delay between requests to the same host (e.g., 1s)
+      --max-rate RATE   Maximum download rate of each file (e.g., 1MB/s)
+      --small-files SIZE  Fetch files smaller than SIZE with a single GET,
+                        skipping the HEAD request (default: 1MB, 0 = never)
+      --checksums ALGOS  Write SHA256SUMS and/or BLAKE3SUMS for the files to
+                        the output directory (sha256, blake3 or sha256,blake3)
+      --har FILE        Record every request and response of the batch to FILE
+                        in HAR format, for browser devtools and HAR viewers
+      --prefetch N      Resolve the host names of the next N files while
+                        earlier ones download (default: 8, 0 = off)
+      --warm-connections  Also open a connection, TLS handshake included, to
+                        each upcoming host so its first file starts at once
+      --dry-run         Show each file's final URL, destination, size, range
+                        support and time at --max-rate without downloading
+      --output-format FMT  text (default), or ndjson to write batch_progress
+                        events with the combined progress to stdout; the
+                        per-file report then goes to stderr
+  -q, --quiet           Only report failures
+
+Examples:
+  %s batch urls.txt -o ./downloads --jobs 8
+  grep -h '^https://' notes/*.md | %s batch - --if-exists skip
+  %s batch aria2-jobs.txt --jobs 5
+
+`, appName, appName, appName, appName)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestParseBatchArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		input   string
+		output  string
+	}{
+		{"defaults", []string{"urls.txt"}, false, "urls.txt", "."},
+		{"flags after file", []string{"urls.txt", "-o", "out", "--jobs", "8"}, false, "urls.txt", "out"},
+		{"stdin", []string{"--output=out", "-"}, false, "-", "out"},
+		{"no file", []string{"-o", "out"}, true, "", ""},
+		{"two files", []string{"a.txt", "b.txt"}, true, "", ""},
+		{"negative per-host", []string{"urls.txt", "--per-host", "-1"}, true, "", ""},
+		{"negative host delay", []string{"urls.txt", "--host-delay", "-1s"}, true, "", ""},
+		{"small files disabled", []string{"urls.txt", "--small-files", "0"}, false, "urls.txt", "."},
+		{"invalid small files", []string{"urls.txt", "--small-files", "tiny"}, true, "", ""},
+		{"warm connections", []string{"urls.txt", "--prefetch", "16", "--warm-connections"}, false, "urls.txt", "."},
+		{"negative prefetch", []string{"urls.txt", "--prefetch", "-1"}, true, "", ""},
+		{"invalid collision policy", []string{"urls.txt", "--if-exists", "clobber"}, true, "", ""},
+		{"invalid output template", []string{"urls.txt", "--output-template", "{bogus}"}, true, "", ""},
+		{"har file", []string{"urls.txt", "--har", "session.har"}, false, "urls.txt", "."},
+		{"ndjson output", []string{"urls.txt", "--output-format", "ndjson"}, false, "urls.txt", "."},
+		{"invalid output format", []string{"urls.txt", "--output-format", "yaml"}, true, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bcfg, err := parseBatchArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseBatchArgs() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBatchArgs() error = %v", err)
+			}
+
+			if bcfg.input != tt.input || bcfg.output != tt.output {
+				t.Errorf("parseBatchArgs() = %+v", bcfg)
+			}
+		})
+	}
+}
+
+func TestReadBatchJobs(t *testing.T) {
+	input := `# release files
+https://example.com/dist/app.tar.gz
+
+https://example.com/dist/app.tar.gz.sig  sigs/app.sig
+`
+
+	jobs, err := readBatchJobs(context.Background(), strings.NewReader(input), &batchConfig{output: "out"})
+	if err != nil {
+		t.Fatalf("readBatchJobs() error = %v", err)
+	}
+
+	want := []string{filepath.Join("out", "app.tar.gz"), filepath.Join("out", "sigs", "app.sig")}
+	if len(jobs) != len(want) {
+		t.Fatalf("readBatchJobs() = %+v", jobs)
+	}
+
+	for i, job := range jobs {
+		if job.Destination != want[i] || job.ID != want[i] {
+			t.Errorf("job %d = %+v, want destination %s", i, job, want[i])
+		}
+	}
+
+	if _, err := readBatchJobs(context.Background(), strings.NewReader("# nothing\n"), &batchConfig{}); err == nil {
+		t.Error("readBatchJobs() without URLs should fail")
+	}
+}
+
+func TestReadBatchJobsAria2(t *testing.T) {
+	input := "https://example.com/a.iso\thttps://mirror.example.org/a.iso\n" +
+		"  dir=/srv/isos\n" +
+		"  out=distro.iso\n" +
+		"  checksum=sha-256=ABCDEF\n" +
+		"  header=X-Token: secret\n" +
+		"  referer=*\n" +
+		"  max-download-limit=500K\n" +
+		"  split=4\n" +
+		"  continue=true\n" +
+		"  gid=2089b05ecca3d829\n" +
+		"https://example.com/b.zip\n" +
+		"\tout=sub/b.zip\n"
+
+	jobs, err := readBatchJobs(context.Background(), strings.NewReader(input), &batchConfig{output: "out"})
+	if err != nil {
+		t.Fatalf("readBatchJobs() error = %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("readBatchJobs() = %+v", jobs)
+	}
+
+	first := jobs[0]
+	if first.URL != "https://example.com/a.iso" || first.Destination != filepath.Join("/srv/isos", "distro.iso") {
+		t.Errorf("first job = %+v", first)
+	}
+	opts := first.Options
+	if opts == nil || fmt.Sprint(opts.Mirrors) != "[https://mirror.example.org/a.iso]" ||
+		opts.Checksum != "abcdef" || opts.ChecksumAlgorithm != "sha256" ||
+		opts.Headers["X-Token"] != "secret" || opts.Headers["Referer"] != first.URL ||
+		opts.MaxRate != 500*1024 || opts.MaxConcurrency != 4 || opts.CollisionPolicy != types.CollisionResume {
+		t.Errorf("first job options = %+v", opts)
+	}
+
+	if jobs[1].Destination != filepath.Join("out", "sub", "b.zip") || jobs[1].Options != nil {
+		t.Errorf("second job = %+v", jobs[1])
+	}
+
+	// Batch options apply where an item sets none
+	merged := &gdl.Options{CollisionPolicy: types.CollisionFail, MaxRate: 1, UserAgent: "gdl"}
+	mergeItemOptions(merged, opts)
+	if merged.CollisionPolicy != types.CollisionResume || merged.MaxRate != 500*1024 || merged.UserAgent != "gdl" {
+		t.Errorf("mergeItemOptions() = %+v", merged)
+	}
+
+	for name, input := range map[string]string{
+		"option before URL": "  out=a.iso\nhttps://example.com/a.iso\n",
+		"invalid checksum":  "https://example.com/a.iso\n  checksum=abcdef\n",
+		"unknown algorithm": "https://example.com/a.iso\n  checksum=crc32=abcdef\n",
+		"invalid split":     "https://example.com/a.iso\n  split=0\n",
+		"invalid header":    "https://example.com/a.iso\n  header=nocolon\n",
+	} {
+		if _, err := readBatchJobs(context.Background(), strings.NewReader(input), &batchConfig{}); err == nil {
+			t.Errorf("readBatchJobs() with %s should fail", name)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprint(w, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	bcfg := &batchConfig{output: dir, ifExists: types.CollisionFail}
+
+	jobs, err := readBatchJobs(context.Background(),
+		strings.NewReader(server.URL+"/a.txt\n"+server.URL+"/b.txt sub/b.txt\n"), bcfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if code := batch(context.Background(), gdl.NewDownloader(), jobs, bcfg, &out); code != 0 {
+		t.Fatalf("batch() = %d, output:\n%s", code, out.String())
+	}
+
+	for rel, want := range map[string]string{"a.txt": "a.txt", "sub/b.txt": "b.txt"} {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel))) // #nosec G304 -- test file
+		if err != nil || string(content) != want {
+			t.Errorf("%s = %q, %v", rel, content, err)
+		}
+	}
+
+	if !strings.Contains(out.String(), "2 of 2 files downloaded") {
+		t.Errorf("batch() output = %q", out.String())
+	}
+
+	// A failed file makes the batch fail without stopping the others
+	jobs, err = readBatchJobs(context.Background(),
+		strings.NewReader(server.URL+"/missing.txt\n"+server.URL+"/c.txt\n"), bcfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if code := batch(context.Background(), gdl.NewDownloader(), jobs, bcfg, &out); code != 1 ||
+		!strings.Contains(out.String(), "1 of 2 files downloaded") {
+		t.Errorf("batch() with a missing file = %d, output:\n%s", code, out.String())
+	}
+}
+
+func TestBatchNDJSONProgress(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer server.Close()
+
+	bcfg := &batchConfig{output: t.TempDir(), ifExists: types.CollisionFail, format: outputFormatNDJSON}
+
+	jobs, err := readBatchJobs(context.Background(),
+		strings.NewReader(server.URL+"/a.txt\n"+server.URL+"/bb.txt\n"), bcfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if code := batch(context.Background(), gdl.NewDownloader(), jobs, bcfg, &out); code != 0 {
+		t.Fatalf("batch() = %d, output:\n%s", code, out.String())
+	}
+
+	// Every line is an event; the report goes to stderr
+	var last ndjsonBatchProgressEvent
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for _, line := range lines {
+		if err := json.Unmarshal([]byte(line), &last); err != nil || last.Event != ndjsonEventBatchProgress {
+			t.Fatalf("line %q is not a batch_progress event: %v", line, err)
+		}
+	}
+
+	if last.TotalJobs != 2 || last.CompletedJobs != 2 || last.DownloadedBytes != int64(len("a.txt")+len("bb.txt")) {
+		t.Errorf("last event = %+v, want both files downloaded", last.AggregateSnapshot)
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/pkg/cluster"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// defaultPieceSize is the size of the pieces "gdl cluster" splits one file
+// into.
+const defaultPieceSize = "64MB"
+
+// clusterProgressInterval is how often "gdl cluster" reports the progress of
+// the whole run.
+const clusterProgressInterval = 5 * time.Second
+
+// agentConfig configures "gdl agent".
+type agentConfig struct {
+	listen  string
+	root    string
+	token   string
+	maxRate string
+	jobs    int
+}
+
+// clusterConfig configures "gdl cluster".
+type clusterConfig struct {
+	source    string
+	agents    string
+	token     string
+	output    string
+	ifExists  string
+	pieceSize string
+	perAgent  int
+	quiet     bool
+}
+
+// runAgentCommand handles "gdl agent", which downloads the jobs coordinators
+// send it into the shared directory until interrupted.
+func runAgentCommand(args []string) int {
+	acfg, err := parseAgentArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showAgentUsage()
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", acfg.listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	agent := cluster.NewAgent(ctx, acfg.root, acfg.token, acfg.jobs, agentFetch(parseBatchRate(acfg.maxRate)))
+	server := &http.Server{Handler: agent, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Agent listening on %s, downloading into %s (Ctrl+C to stop)\n", listener.Addr(), acfg.root)
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// parseAgentArgs parses the arguments of "gdl agent".
+func parseAgentArgs(args []string) (*agentConfig, error) {
+	acfg := &agentConfig{}
+
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineAgentFlags(fs, acfg)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+
+	if acfg.token == "" {
+		acfg.token = os.Getenv(cluster.TokenEnv)
+	}
+	if acfg.token == "" {
+		return nil, fmt.Errorf("agent requires a token (--token or $%s)", cluster.TokenEnv)
+	}
+
+	if acfg.jobs < 0 {
+		return nil, fmt.Errorf("--jobs cannot be negative")
+	}
+
+	if acfg.maxRate != "" {
+		if err := ratelimit.ValidateRate(acfg.maxRate); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := filepath.Abs(acfg.root)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("--root %s is not a directory", acfg.root)
+	}
+	acfg.root = root
+
+	return acfg, nil
+}
+
+// defineAgentFlags registers the flags of "gdl agent" on fs.
+func defineAgentFlags(fs *flag.FlagSet, acfg *agentConfig) {
+	fs.StringVar(&acfg.listen, "listen", ":7070", "Address to serve coordinators on")
+	fs.StringVar(&acfg.root, "root", ".", "Shared directory the files are downloaded into")
+	fs.StringVar(&acfg.token, "token", "", "Token coordinators must send (default: $"+cluster.TokenEnv+")")
+	fs.StringVar(&acfg.maxRate, "max-rate", "", "Maximum download rate of each file (e.g., 1MB/s)")
+	fs.IntVar(&acfg.jobs, "jobs", cluster.DefaultAgentJobs, "Jobs downloaded at once")
+}
+
+// agentFetch returns how an agent downloads a job: the whole file, or its
+// piece of a file split by "gdl cluster", at most maxRate bytes per second.
+func agentFetch(maxRate int64) cluster.FetchFunc {
+	return func(ctx context.Context, job *cluster.Job, dest string, progress func(bytes, total int64)) error {
+		ifExists := job.IfExists
+		if ifExists == "" {
+			ifExists = types.CollisionFail
+		}
+
+		opts := &gdl.Options{
+			CreateDirs:      true,
+			AtomicWrite:     true,
+			Quiet:           true,
+			CollisionPolicy: ifExists,
+			MaxRate:         maxRate,
+			HostCache:       hostCacheFile(),
+			ProgressCallback: func(p gdl.Progress) {
+				progress(p.BytesDownloaded, p.TotalSize)
+			},
+		}
+		if job.Length > 0 {
+			opts.ByteRange = &types.ByteRange{Start: job.Offset, End: job.Offset + job.Length - 1}
+		}
+
+		stats, err := gdl.DownloadWithOptions(ctx, job.URL, dest, opts)
+
+		now := time.Now().Format(time.RFC3339)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s job %s: %s failed: %v\n", now, job.ID, job.URL, err)
+			return err
+		}
+
+		fmt.Printf("%s job %s: downloaded %s to %s (%s)\n", now, job.ID, job.URL, job.Path, formatBytes(stats.BytesDownloaded))
+		return nil
+	}
+}
+
+// runClusterCommand handles "gdl cluster", which spreads the downloads of a
+// batch file, or the pieces of one large file, across agents.
+func runClusterCommand(args []string) int {
+	ccfg, err := parseClusterArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showClusterUsage()
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var agents []*cluster.Client
+	for _, agentURL := range strings.Split(ccfg.agents, ",") {
+		agents = append(agents, cluster.NewClient(strings.TrimSpace(agentURL), ccfg.token))
+	}
+
+	co := cluster.NewCoordinator(agents)
+	co.JobsPerAgent = ccfg.perAgent
+	if !ccfg.quiet {
+		co.Progress = clusterProgress(os.Stderr, clusterProgressInterval)
+	}
+
+	if isClusterURL(ccfg.source) {
+		return clusterSplit(ctx, co, ccfg, os.Stdout)
+	}
+
+	return clusterBatch(ctx, co, ccfg, os.Stdout)
+}
+
+// parseClusterArgs parses the arguments of "gdl cluster", which may put flags
+// before or after the file or URL.
+func parseClusterArgs(args []string) (*clusterConfig, error) {
+	ccfg := &clusterConfig{}
+
+	fs := flag.NewFlagSet("cluster", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineClusterFlags(fs, ccfg)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		return nil, fmt.Errorf("cluster requires a file of URLs (- for stdin) or one URL")
+	}
+	ccfg.source = positional[0]
+
+	if ccfg.agents == "" {
+		return nil, fmt.Errorf("cluster requires --agents")
+	}
+	for _, agentURL := range strings.Split(ccfg.agents, ",") {
+		if u, err := url.Parse(strings.TrimSpace(agentURL)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid agent URL: %s", agentURL)
+		}
+	}
+
+	if ccfg.token == "" {
+		ccfg.token = os.Getenv(cluster.TokenEnv)
+	}
+	if ccfg.token == "" {
+		return nil, fmt.Errorf("cluster requires the agents' token (--token or $%s)", cluster.TokenEnv)
+	}
+
+	if ccfg.perAgent < 1 {
+		return nil, fmt.Errorf("--jobs-per-agent must be at least 1")
+	}
+
+	if err := core.ValidateCollisionPolicy(ccfg.ifExists); err != nil {
+		return nil, err
+	}
+
+	if size, err := parseSize(ccfg.pieceSize); err != nil || size <= 0 {
+		return nil, fmt.Errorf("invalid --piece-size: %s", ccfg.pieceSize)
+	}
+
+	return ccfg, nil
+}
+
+// defineClusterFlags registers the flags of "gdl cluster" on fs.
+func defineClusterFlags(fs *flag.FlagSet, ccfg *clusterConfig) {
+	fs.StringVar(&ccfg.agents, "agents", "", "Comma-separated URLs of the agents, such as http://host1:7070")
+	fs.StringVar(&ccfg.token, "token", "", "Token of the agents (default: $"+cluster.TokenEnv+")")
+	fs.StringVar(&ccfg.output, "o", ".", "Shared directory, as mounted on this machine")
+	fs.StringVar(&ccfg.output, "output", ".", "Shared directory, as mounted on this machine")
+	fs.StringVar(&ccfg.ifExists, "if-exists", types.CollisionFail, "What to do with existing files: fail, overwrite, skip, rename or resume")
+	fs.StringVar(&ccfg.pieceSize, "piece-size", defaultPieceSize, "Size of the pieces one file is split into")
+	fs.IntVar(&ccfg.perAgent, "jobs-per-agent", cluster.DefaultJobsPerAgent, "Jobs given to each agent at once")
+	fs.BoolVar(&ccfg.quiet, "q", false, "Only report failures")
+	fs.BoolVar(&ccfg.quiet, "quiet", false, "Only report failures")
+}
+
+// isClusterURL reports whether the source of "gdl cluster" is a URL rather
+// than a batch file.
+func isClusterURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// clusterBatch spreads the downloads of a batch file across the agents.
+// Destinations are relative to the shared directory.
+func clusterBatch(ctx context.Context, co *cluster.Coordinator, ccfg *clusterConfig, out io.Writer) int {
+	input := io.Reader(os.Stdin)
+	if ccfg.source != "-" {
+		file, err := os.Open(ccfg.source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer func() { _ = file.Close() }()
+
+		input = file
+	}
+
+	batchJobs, err := readBatchJobs(ctx, input, &batchConfig{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", ccfg.source, err)
+		return 1
+	}
+
+	jobs := make([]*cluster.Job, len(batchJobs))
+	for i, job := range batchJobs {
+		jobs[i] = &cluster.Job{URL: job.URL, Path: filepath.ToSlash(job.Destination), IfExists: ccfg.ifExists}
+	}
+
+	statuses := co.Run(ctx, jobs)
+
+	failed := 0
+	for i, status := range statuses {
+		if status.State != cluster.StateSucceeded {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: failed: %s\n", jobs[i].Path, status.Error)
+			continue
+		}
+
+		if !ccfg.quiet {
+			_, _ = fmt.Fprintf(out, "%s (%s, by %s)\n", jobs[i].Path, formatBytes(status.Bytes), status.Agent)
+		}
+	}
+
+	if !ccfg.quiet || failed > 0 {
+		_, _ = fmt.Fprintf(out, "%d of %d files downloaded to %s\n", len(jobs)-failed, len(jobs), ccfg.output)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// clusterSplit downloads one file in pieces spread across the agents, then
+// joins the pieces in the shared directory.
+func clusterSplit(ctx context.Context, co *cluster.Coordinator, ccfg *clusterConfig, out io.Writer) int {
+	info, err := gdl.GetFileInfo(ctx, ccfg.source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if !info.SupportsRanges || info.Size <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s cannot be split: the server does not report its size or accept ranges\n", ccfg.source)
+		return 1
+	}
+
+	name := info.Filename
+	if name == "" || !filepath.IsLocal(name) {
+		name = extractFilenameFromURL(ccfg.source)
+	}
+	dest := filepath.Join(ccfg.output, name)
+
+	if _, err := os.Stat(dest); err == nil {
+		switch ccfg.ifExists {
+		case types.CollisionSkip:
+			_, _ = fmt.Fprintf(out, "%s (exists, skipped)\n", dest)
+			return 0
+		case types.CollisionOverwrite:
+		default:
+			fmt.Fprintf(os.Stderr, "Error: %s already exists (use --if-exists overwrite or skip)\n", dest)
+			return 1
+		}
+	}
+
+	pieceSize, _ := parseSize(ccfg.pieceSize)
+	pieces := cluster.SplitJobs(ccfg.source, filepath.ToSlash(name), info.Size, pieceSize)
+
+	for _, status := range co.Run(ctx, pieces) {
+		if status.State != cluster.StateSucceeded {
+			fmt.Fprintf(os.Stderr, "Error: piece %s failed: %s\n", status.ID, status.Error)
+			return 1
+		}
+	}
+
+	if err := cluster.JoinPieces(ccfg.output, filepath.ToSlash(name), pieces); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if !ccfg.quiet {
+		_, _ = fmt.Fprintf(out, "Downloaded %s to %s (%s in %d pieces)\n", ccfg.source, dest, formatBytes(info.Size), len(pieces))
+	}
+
+	return 0
+}
+
+// clusterProgress returns a Progress callback printing the progress of the
+// whole run to w every interval.
+func clusterProgress(w io.Writer, interval time.Duration) func(statuses []cluster.Status) {
+	last := time.Now()
+
+	return func(statuses []cluster.Status) {
+		if time.Since(last) < interval {
+			return
+		}
+		last = time.Now()
+
+		done, running := 0, 0
+		var bytes int64
+		for _, status := range statuses {
+			bytes += status.Bytes
+			switch {
+			case status.Done():
+				done++
+			case status.State == cluster.StateRunning:
+				running++
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, "%d of %d jobs done, %d running, %s downloaded\n", done, len(statuses), running, formatBytes(bytes))
+	}
+}
+
+func showAgentUsage() {
+	fmt.Printf(`Agent Command:
+
+Usage: %s agent --root DIR [options]
+
+Downloads the jobs sent by "%s cluster" coordinators into DIR, a directory
+shared with them (such as an NFS mount), until interrupted. Coordinators
+must send the agent's token; job paths cannot leave DIR.
+
+Options:
+      --listen ADDR     Address to serve coordinators on (default: :7070)
+      --root DIR        Shared directory the files are downloaded into (default: .)
+      --token TOKEN     Token coordinators must send (default: $%s)
+      --jobs N          Jobs downloaded at once (default: %d)
+      --max-rate RATE   Maximum download rate of each file (e.g., 1MB/s)
+
+Examples:
+  %s=s3cret %s agent --root /mnt/shared --listen :7070
+
+`, appName, appName, cluster.TokenEnv, cluster.DefaultAgentJobs, cluster.TokenEnv, appName)
+}
+
+func showClusterUsage() {
+	fmt.Printf(`Cluster Command:
+
+Usage: %s cluster <file|url> --agents URL[,URL...] [options]
+
+Spreads downloads across machines running "%s agent", which write into a
+shared directory, and reports their progress. Given a file of URLs (- for
+stdin, in the format of "%s batch"), each agent downloads some of the files;
+given one URL, the file is split into pieces the agents download and this
+machine joins. Destinations are relative to the shared directory.
+
+Options:
+      --agents URLS     Comma-separated agent URLs, e.g. http://host1:7070
+      --token TOKEN     Token of the agents (default: $%s)
+  -o, --output DIR      Shared directory as mounted on this machine (default: .)
+      --if-exists POLICY  What to do with existing files: fail (default),
+                        overwrite, skip, rename or resume (one URL: fail,
+                        overwrite or skip)
+      --piece-size SIZE Size of the pieces one URL is split into (default: %s)
+      --jobs-per-agent N  Jobs given to each agent at once (default: %d)
+  -q, --quiet           Only report failures
+
+An agent that cannot be reached 3 times in a row is dropped and its jobs are
+given to the others.
+
+Examples:
+  %s cluster urls.txt --agents http://node1:7070,http://node2:7070 -o /mnt/shared
+  %s cluster https://example.com/huge.iso --agents http://node1:7070,http://node2:7070 -o /mnt/shared
+
+`, appName, appName, appName, cluster.TokenEnv, defaultPieceSize, cluster.DefaultJobsPerAgent, appName, appName)
+}
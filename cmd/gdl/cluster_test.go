@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/cluster"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestParseClusterArgs(t *testing.T) {
+	t.Setenv(cluster.TokenEnv, "")
+
+	for _, args := range [][]string{
+		{},
+		{"urls.txt"},
+		{"urls.txt", "--agents", "http://node1:7070"},
+		{"urls.txt", "--agents", "node1:7070", "--token", "t"},
+		{"urls.txt", "--agents", "http://node1:7070", "--token", "t", "--piece-size", "0"},
+		{"urls.txt", "--agents", "http://node1:7070", "--token", "t", "--jobs-per-agent", "0"},
+		{"urls.txt", "--agents", "http://node1:7070", "--token", "t", "--if-exists", "maybe"},
+	} {
+		if _, err := parseClusterArgs(args); err == nil {
+			t.Errorf("parseClusterArgs(%q) succeeded", args)
+		}
+	}
+
+	t.Setenv(cluster.TokenEnv, "s3cret")
+	ccfg, err := parseClusterArgs([]string{"--agents", "http://node1:7070,http://node2:7070", "urls.txt", "-o", "/mnt/shared"})
+	if err != nil || ccfg.token != "s3cret" || ccfg.source != "urls.txt" || ccfg.output != "/mnt/shared" {
+		t.Errorf("parseClusterArgs() = %+v, %v", ccfg, err)
+	}
+
+	if _, err := parseAgentArgs([]string{"--root", t.TempDir()}); err != nil {
+		t.Errorf("parseAgentArgs() with the token in the environment: %v", err)
+	}
+
+	t.Setenv(cluster.TokenEnv, "")
+	for _, args := range [][]string{
+		{"--root", t.TempDir()},
+		{"--root", filepath.Join(t.TempDir(), "missing"), "--token", "t"},
+		{"--token", "t", "extra"},
+	} {
+		if _, err := parseAgentArgs(args); err == nil {
+			t.Errorf("parseAgentArgs(%q) succeeded", args)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, filepath.Base(r.URL.Path), time.Time{}, bytes.NewReader(data))
+	}))
+	defer origin.Close()
+
+	shared := t.TempDir()
+
+	var agentURLs []string
+	for range 2 {
+		agent := httptest.NewServer(cluster.NewAgent(t.Context(), shared, "s3cret", 2, agentFetch(0)))
+		defer agent.Close()
+		agentURLs = append(agentURLs, agent.URL)
+	}
+
+	newCoordinator := func() *cluster.Coordinator {
+		var agents []*cluster.Client
+		for _, agentURL := range agentURLs {
+			agents = append(agents, cluster.NewClient(agentURL, "s3cret"))
+		}
+
+		co := cluster.NewCoordinator(agents)
+		co.Poll = 10 * time.Millisecond
+		return co
+	}
+
+	t.Run("batch", func(t *testing.T) {
+		list := filepath.Join(t.TempDir(), "urls.txt")
+		lines := origin.URL + "/a.bin\n" + origin.URL + "/b.bin sub/b.bin\n" + origin.URL + "/c.bin\n"
+		if err := os.WriteFile(list, []byte(lines), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		var out strings.Builder
+		ccfg := &clusterConfig{source: list, output: shared, ifExists: "fail"}
+		if code := clusterBatch(t.Context(), newCoordinator(), ccfg, &out); code != 0 {
+			t.Fatalf("clusterBatch() = %d, output:\n%s", code, out.String())
+		}
+
+		for _, name := range []string{"a.bin", "sub/b.bin", "c.bin"} {
+			if content, _ := os.ReadFile(filepath.Join(shared, name)); !bytes.Equal(content, data) {
+				t.Errorf("%s was not downloaded to the shared directory", name)
+			}
+		}
+		if !strings.Contains(out.String(), "3 of 3 files downloaded") {
+			t.Errorf("output = %q, want a summary", out.String())
+		}
+
+		// Existing files fail by default
+		out.Reset()
+		if code := clusterBatch(t.Context(), newCoordinator(), ccfg, &out); code != 1 {
+			t.Errorf("second clusterBatch() = %d, want 1", code)
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		var out strings.Builder
+		ccfg := &clusterConfig{source: origin.URL + "/huge.iso", output: shared, ifExists: "fail", pieceSize: "10000"}
+		if code := clusterSplit(t.Context(), newCoordinator(), ccfg, &out); code != 0 {
+			t.Fatalf("clusterSplit() = %d, output:\n%s", code, out.String())
+		}
+
+		if content, _ := os.ReadFile(filepath.Join(shared, "huge.iso")); !bytes.Equal(content, data) {
+			t.Error("the joined file differs from the served data")
+		}
+		if !strings.Contains(out.String(), "in 7 pieces") {
+			t.Errorf("output = %q, want 7 pieces", out.String())
+		}
+
+		pieces, _ := filepath.Glob(filepath.Join(shared, "huge.iso.*"))
+		if len(pieces) != 0 {
+			t.Errorf("pieces left behind: %v", pieces)
+		}
+
+		out.Reset()
+		ccfg.ifExists = "skip"
+		if code := clusterSplit(t.Context(), newCoordinator(), ccfg, &out); code != 0 || !strings.Contains(out.String(), "skipped") {
+			t.Errorf("clusterSplit() of an existing file = %d, %q, want it skipped", code, out.String())
+		}
+	})
+}
+
+func TestClusterProgress(t *testing.T) {
+	statuses := []cluster.Status{
+		{State: cluster.StateSucceeded, Bytes: 1024},
+		{State: cluster.StateRunning, Bytes: 512},
+		{State: cluster.StateQueued},
+	}
+
+	var out strings.Builder
+	clusterProgress(&out, time.Hour)(statuses)
+	if out.Len() != 0 {
+		t.Errorf("progress reported before the interval: %q", out.String())
+	}
+
+	clusterProgress(&out, 0)(statuses)
+	if want := "1 of 3 jobs done, 1 running, 1.5 KB downloaded\n"; out.String() != want {
+		t.Errorf("progress = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+// command is a gdl subcommand. Each parses its own flags from args, the
+// arguments after its name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+	usage   func()
+}
+
+// commandTable returns the subcommands in the order "gdl help" lists them.
+// It is a function rather than a variable because "get" and "resume" call
+// back into run.
+func commandTable() []command {
+	return []command{
+		{"get", "Download a URL (the default command)", runGetCommand, showUsage},
+		{"batch", "Download the URLs listed in a file", runBatchCommand, showBatchUsage},
+		{"mirror", "Download every file under an index page or S3 prefix", runMirrorCommand, showMirrorUsage},
+		{"stream", "Download an HLS or DASH stream", runStreamCommand, showStreamUsage},
+		{"import", "Turn browser download lists, HAR files or bookmarks into a batch file", runImportCommand, showImportUsage},
+		{"resume", "Resume or list interrupted downloads", runResumeCommand, showResumeUsage},
+		{"verify", "Check a local file against its URL without downloading it", runVerifyCommand, showVerifyUsage},
+		{"verify-manifest", "Check files against a SHA256SUMS or BLAKE3SUMS manifest", runVerifyManifestCommand, showVerifyManifestUsage},
+		{"watch", "Download a URL whenever it changes", runWatchCommand, showWatchUsage},
+		{"schedule", "Manage scheduled downloads", runScheduleCommand, showScheduleUsage},
+		{"daemon", "Run scheduled downloads in the foreground", runDaemonCommand, showDaemonUsage},
+		{"agent", "Download jobs sent by cluster coordinators", runAgentCommand, showAgentUsage},
+		{"cluster", "Spread a batch or one large file across agents", runClusterCommand, showClusterUsage},
+		{"stats", "Show the bandwidth used per day and host", runStatsCommand, showStatsUsage},
+		{"history", "List or search completed downloads", runHistoryCommand, showHistoryUsage},
+		{"redo", "Download a URL from the history again", runRedoCommand, showRedoUsage},
+		{"plugin", "Manage plugins", runPluginCommand, showPluginUsage},
+		{"secret", "Keep credentials in the OS keychain", runSecretCommand, showSecretUsage},
+		{"config", "Show and edit the configuration file", runConfigCommand, showConfigUsage},
+		{"interactive", "Build a download step by step", runInteractiveCommand, showInteractiveUsage},
+		{"completion", "Generate a shell completion script", runCompletionCommand, showCompletionUsage},
+		{"help", "Show help for a command", runHelpCommand, showUsage},
+	}
+}
+
+// findCommand returns the subcommand called name.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commandTable() {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+// splitGlobalFlags separates the flags every command accepts (--no-color
+// and --language) from the front of args, so that "gdl --no-color plugin
+// list" finds the plugin command.
+func splitGlobalFlags(args []string) (globals, rest []string) {
+	for len(args) > 0 {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+		if !strings.HasPrefix(args[0], "-") {
+			break
+		}
+
+		switch {
+		case name == "no-color":
+			globals = append(globals, args[0])
+			args = args[1:]
+		case name == "language" && hasValue:
+			globals = append(globals, "--language="+value)
+			args = args[1:]
+		case name == "language" && len(args) > 1:
+			globals = append(globals, "--language="+args[1])
+			args = args[2:]
+		default:
+			return globals, args
+		}
+	}
+
+	return globals, args
+}
+
+// applyGlobalFlags sets up colors and the formatter for a subcommand from
+// the global flags.
+func applyGlobalFlags(globals []string) {
+	cfg := &config{language: autoValue, interactive: ui.IsTerminalInteractive()}
+
+	for _, arg := range globals {
+		if strings.TrimLeft(arg, "-") == "no-color" {
+			cfg.noColor = true
+			ui.SetColorEnabled(false)
+		} else if _, language, ok := strings.Cut(arg, "="); ok {
+			cfg.language = language
+		}
+	}
+
+	initializeFormatter(cfg)
+}
+
+// runGetCommand handles "gdl get [options] URL", which is also what gdl
+// runs when no command is given.
+func runGetCommand(args []string) int {
+	os.Args = append([]string{os.Args[0]}, args...)
+
+	return runDownload()
+}
+
+// runHelpCommand handles "gdl help [command]".
+func runHelpCommand(args []string) int {
+	if len(args) == 0 {
+		showUsage()
+		return 0
+	}
+
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown command: %s\n", args[0])
+		showCommands()
+		return 1
+	}
+
+	cmd.usage()
+
+	return 0
+}
+
+// showCommands lists the subcommands.
+func showCommands() {
+	fmt.Printf("Commands:\n")
+
+	for _, cmd := range commandTable() {
+		fmt.Printf("  %-12s  %s\n", cmd.name, cmd.summary)
+	}
+
+	fmt.Printf("\nRun '%s help <command>' for details. Without a command, %s URL runs %s get URL.\n",
+		appName, appName, appName)
+}
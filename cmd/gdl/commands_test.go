@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forest6511/gdl/internal/resume"
+)
+
+func TestSplitGlobalFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		globals []string
+		rest    []string
+	}{
+		{"none", []string{"plugin", "list"}, nil, []string{"plugin", "list"}},
+		{"no color", []string{"--no-color", "plugin", "list"}, []string{"--no-color"}, []string{"plugin", "list"}},
+		{"language value", []string{"--language", "ja", "mirror", "URL"}, []string{"--language=ja"}, []string{"mirror", "URL"}},
+		{"language equals", []string{"-language=fr", "--no-color", "help"}, []string{"--language=fr", "--no-color"}, []string{"help"}},
+		{"download flag stops", []string{"--no-color", "-o", "file", "URL"}, []string{"--no-color"}, []string{"-o", "file", "URL"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			globals, rest := splitGlobalFlags(tt.args)
+			if !reflect.DeepEqual(globals, tt.globals) || !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("splitGlobalFlags() = %q, %q, want %q, %q", globals, rest, tt.globals, tt.rest)
+			}
+		})
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	for _, name := range []string{"get", "batch", "mirror", "plugin", "config", "daemon", "resume"} {
+		if cmd, ok := findCommand(name); !ok || cmd.run == nil || cmd.usage == nil {
+			t.Errorf("findCommand(%q) = %+v, %v", name, cmd, ok)
+		}
+	}
+
+	if _, ok := findCommand("https://example.com/file.zip"); ok {
+		t.Error("findCommand() should not match a URL")
+	}
+}
+
+func TestRunHelpCommand(t *testing.T) {
+	if code := run([]string{"gdl", "help", "batch"}); code != 0 {
+		t.Errorf("run(help batch) = %d, want 0", code)
+	}
+
+	if code := run([]string{"gdl", "--no-color", "help", "bogus"}); code != 1 {
+		t.Errorf("run(help bogus) = %d, want 1", code)
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	var out bytes.Buffer
+	if err := configCommand(&out, path, []string{"init"}); err != nil {
+		t.Fatalf("config init error = %v", err)
+	}
+
+	if err := configCommand(&out, path, []string{"init"}); err == nil {
+		t.Error("config init should not overwrite an existing file")
+	}
+
+	for _, args := range [][]string{
+		{"set", "network.max_redirects", "3"},
+		{"set", "timeouts.connect_timeout", "5s"},
+		{"set", "network.user_agent", "mirror-bot/2.0"},
+	} {
+		if err := configCommand(&out, path, args); err != nil {
+			t.Fatalf("config %v error = %v", args, err)
+		}
+	}
+
+	for key, want := range map[string]string{
+		"network.max_redirects":    "3",
+		"timeouts.connect_timeout": "5000000000",
+		"network.user_agent":       "mirror-bot/2.0",
+	} {
+		out.Reset()
+		if err := configCommand(&out, path, []string{"get", key}); err != nil || strings.TrimSpace(out.String()) != want {
+			t.Errorf("config get %s = %q, %v, want %s", key, out.String(), err, want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"set", "network.max_redirects", "-1"},
+		{"set", "network.max_redirects", "many"},
+		{"set", "network.bogus", "1"},
+		{"get", "bogus.key"},
+		{"frobnicate"},
+	} {
+		if err := configCommand(&out, path, args); err == nil {
+			t.Errorf("config %v should fail", args)
+		}
+	}
+
+	out.Reset()
+	if err := configCommand(&out, path, []string{"validate"}); err != nil || !strings.Contains(out.String(), "is valid") {
+		t.Errorf("config validate = %q, %v", out.String(), err)
+	}
+}
+
+func TestResumeArgs(t *testing.T) {
+	dir := t.TempDir()
+	manager := resume.NewManager(dir)
+
+	if _, err := resumeArgs(manager, "missing.iso", nil); err == nil {
+		t.Error("resumeArgs() without a resume file should fail")
+	}
+
+	file := filepath.Join(dir, "ubuntu.iso")
+	if err := manager.Save(&resume.ResumeInfo{
+		URL:             "https://example.com/ubuntu.iso",
+		FilePath:        file,
+		DownloadedBytes: 1024,
+		TotalBytes:      4096,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := resumeArgs(manager, file, []string{"--max-rate", "5MB/s"})
+	want := []string{"--resume", "-o", file, "--max-rate", "5MB/s", "https://example.com/ubuntu.iso"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("resumeArgs() = %q, %v, want %q", got, err, want)
+	}
+
+	var out bytes.Buffer
+	if err := listResumable(&out, manager); err != nil || !strings.Contains(out.String(), "1.0 KB of 4.0 KB") {
+		t.Errorf("listResumable() = %q, %v", out.String(), err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := listResumable(&out, resume.NewManager(dir)); err != nil || !strings.Contains(out.String(), "No interrupted") {
+		t.Errorf("listResumable() with no downloads = %q, %v", out.String(), err)
+	}
+}
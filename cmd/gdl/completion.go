@@ -0,0 +1,631 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/forest6511/gdl/internal/importer"
+	"github.com/forest6511/gdl/pkg/cli"
+	"github.com/forest6511/gdl/pkg/plugin"
+	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+// pluginsFlag makes "gdl completion" print the installed plugin names, one
+// per line. The generated scripts call it to complete plugin names.
+const pluginsFlag = "--plugins"
+
+// completionShells lists the shells "gdl completion" writes scripts for.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionValue tells a completion script what a flag's value is.
+type completionValue int
+
+const (
+	valueNone completionValue = iota // boolean flag
+	valueAny                         // free-form value
+	valueFile
+	valueDir
+	valuePlugin
+	valueChoice // one of completionFlag.choices
+)
+
+// completionFlag is a flag as completion scripts see it.
+type completionFlag struct {
+	name    string // without dashes
+	usage   string
+	value   completionValue
+	choices []string
+}
+
+// option returns the flag as typed on the command line: "-o" for
+// single-letter flags and "--output" otherwise.
+func (f completionFlag) option() string {
+	if len(f.name) == 1 {
+		return "-" + f.name
+	}
+	return "--" + f.name
+}
+
+// completionCommand is a subcommand with its own subcommands or flags.
+type completionCommand struct {
+	name        string
+	description string
+	subcommands []string
+	// pluginArgs lists the subcommands whose argument is a plugin name.
+	pluginArgs []string
+	flags      []completionFlag
+}
+
+// completionSpec describes the command line the scripts complete.
+type completionSpec struct {
+	flags    []completionFlag
+	commands []completionCommand
+}
+
+// runCompletionCommand handles "gdl completion <shell>".
+func runCompletionCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Error: completion requires a shell (%s)\n", strings.Join(completionShells, ", "))
+		showCompletionUsage()
+		return 1
+	}
+
+	switch args[0] {
+	case "-h", "--help", "help":
+		showCompletionUsage()
+		return 0
+	case pluginsFlag:
+		return printPluginNames(os.Stdout)
+	}
+
+	if err := writeCompletion(os.Stdout, args[0], newCompletionSpec()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// printPluginNames prints the names of the installed plugins.
+func printPluginNames(w io.Writer) int {
+	registry := cli.NewPluginRegistry(cli.GetDefaultPluginDir(), cli.GetDefaultConfigFile())
+
+	plugins, err := registry.List(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	names := make([]string, 0, len(plugins))
+	for _, info := range plugins {
+		names = append(names, info.Name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, _ = fmt.Fprintln(w, name)
+	}
+
+	return 0
+}
+
+// writeCompletion writes the completion script for shell.
+func writeCompletion(w io.Writer, shell string, spec *completionSpec) error {
+	var script string
+
+	switch shell {
+	case "bash":
+		script = bashCompletion(spec)
+	case "zsh":
+		script = zshCompletion(spec)
+	case "fish":
+		script = fishCompletion(spec)
+	case "powershell", "pwsh":
+		script = powerShellCompletion(spec)
+	default:
+		return fmt.Errorf("unsupported shell %q (supported: %s)", shell, strings.Join(completionShells, ", "))
+	}
+
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// newCompletionSpec collects the flags and subcommands from the same
+// definitions the parsers use, so the scripts follow them.
+func newCompletionSpec() *completionSpec {
+	downloadFlags := completionFlags(func(fs *flag.FlagSet) { defineFlags(fs, &config{}, &cliFlags{}) })
+
+	details := map[string]completionCommand{
+		"get":   {flags: downloadFlags},
+		"batch": {flags: completionFlags(func(fs *flag.FlagSet) { defineBatchFlags(fs, &batchConfig{}) })},
+		"mirror": {
+			flags: completionFlags(func(fs *flag.FlagSet) { defineMirrorFlags(fs, &mirrorConfig{}) }),
+		},
+		"stream": {flags: completionFlags(func(fs *flag.FlagSet) { defineStreamFlags(fs, &streamConfig{}) })},
+		"import": {flags: completionFlags(func(fs *flag.FlagSet) { defineImportFlags(fs, &importConfig{}) })},
+		"verify": {flags: completionFlags(func(fs *flag.FlagSet) { defineVerifyFlags(fs, &verifyConfig{}) })},
+		"verify-manifest": {
+			flags: completionFlags(func(fs *flag.FlagSet) { defineVerifyManifestFlags(fs, &verifyManifestConfig{}) }),
+		},
+		"watch":    {flags: completionFlags(func(fs *flag.FlagSet) { defineWatchFlags(fs, &watchConfig{}) })},
+		"stats":    {flags: completionFlags(func(fs *flag.FlagSet) { defineStatsFlags(fs, &statsConfig{}) })},
+		"agent":    {flags: completionFlags(func(fs *flag.FlagSet) { defineAgentFlags(fs, &agentConfig{}) })},
+		"cluster":  {flags: completionFlags(func(fs *flag.FlagSet) { defineClusterFlags(fs, &clusterConfig{}) })},
+		"history":  {subcommands: []string{"list", "search"}},
+		"schedule": {subcommands: []string{"add", "list", "remove", "run"}},
+		"secret":   {subcommands: []string{"set", "get", "delete"}},
+		"plugin": {
+			subcommands: []string{"list", "install", "update", "search", "info", "remove", "enable", "disable", "config"},
+			pluginArgs:  []string{"info", "remove", "enable", "disable", "config", "update"},
+		},
+		"config":     {subcommands: []string{"path", "show", "init", "validate", "get", "set"}},
+		"completion": {subcommands: completionShells},
+	}
+
+	spec := &completionSpec{flags: downloadFlags}
+	for _, cmd := range commandTable() {
+		completion := details[cmd.name]
+		completion.name = cmd.name
+		completion.description = cmd.summary
+
+		if cmd.name == "help" {
+			for _, other := range commandTable() {
+				completion.subcommands = append(completion.subcommands, other.name)
+			}
+		}
+
+		spec.commands = append(spec.commands, completion)
+	}
+
+	return spec
+}
+
+// completionFlags returns the flags define registers, sorted by name.
+func completionFlags(define func(*flag.FlagSet)) []completionFlag {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	define(fs)
+
+	fileFlags := map[string]completionValue{
+		"o": valueFile, "output": valueFile, "events-file": valueFile, "cacert": valueFile,
+		"cert": valueFile, "key": valueFile, "keyring": valueFile, "signature": valueFile,
+		"plugin-config": valueFile, "temp-dir": valueDir, "cache-dir": valueDir,
+		"content-store": valueDir, "quota-dir": valueDir, "quarantine": valueDir, "plugin-dir": valueDir,
+		"root": valueDir, "tee": valueFile, "trace-ascii": valueFile, "har": valueFile,
+	}
+
+	languages := []string{autoValue}
+	for _, lang := range ui.DefaultCatalog().Languages() {
+		languages = append(languages, string(lang))
+	}
+
+	choices := map[string][]string{
+		"progress-bar":  {"simple", "detailed", "json"},
+		"output-format": {autoValue, "json", "yaml", outputFormatNDJSON},
+		"retry-backoff": {retryBackoffExponential, retryBackoffConstant},
+		"quota-policy":  {types.QuotaPolicyRefuse, types.QuotaPolicyOldest, types.QuotaPolicyLRU},
+		"recompress":    {plugin.CodecZstd, plugin.CodecGzip, plugin.CodecNone},
+		"if-exists": {
+			types.CollisionFail, types.CollisionOverwrite, types.CollisionSkip,
+			types.CollisionRename, types.CollisionResume,
+		},
+		"mirror-strategy":   {types.MirrorOrdered, types.MirrorFastest, types.MirrorRandom},
+		"resume-validation": {types.ResumeRestart, types.ResumeStrict, types.ResumeIgnore},
+		"language":          languages,
+		"format":            importer.Formats,
+	}
+
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := completionFlag{name: f.Name, usage: f.Usage, value: valueAny}
+
+		if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && boolFlag.IsBoolFlag() {
+			cf.value = valueNone
+		} else if value, ok := fileFlags[f.Name]; ok {
+			cf.value = value
+		} else if f.Name == "plugin" {
+			cf.value = valuePlugin
+		} else if values, ok := choices[f.Name]; ok {
+			cf.value = valueChoice
+			cf.choices = values
+		}
+
+		flags = append(flags, cf)
+	})
+
+	return flags
+}
+
+// options returns the options of flags, separated by spaces.
+func options(flags []completionFlag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = f.option()
+	}
+	return strings.Join(names, " ")
+}
+
+// allFlags returns the flags of gdl and its subcommands, the first
+// definition of each option winning.
+func (s *completionSpec) allFlags() []completionFlag {
+	seen := make(map[string]bool)
+
+	var flags []completionFlag
+	add := func(list []completionFlag) {
+		for _, f := range list {
+			if !seen[f.name] {
+				seen[f.name] = true
+				flags = append(flags, f)
+			}
+		}
+	}
+
+	add(s.flags)
+	for _, cmd := range s.commands {
+		add(cmd.flags)
+	}
+
+	return flags
+}
+
+// commandNames returns the subcommand names, separated by spaces.
+func (s *completionSpec) commandNames() string {
+	names := make([]string, len(s.commands))
+	for i, cmd := range s.commands {
+		names[i] = cmd.name
+	}
+	return strings.Join(names, " ")
+}
+
+func bashCompletion(spec *completionSpec) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `# bash completion for %[1]s
+# Load it with:  source <(%[1]s completion bash)
+
+_%[1]s_plugins() {
+    %[1]s completion %[2]s 2>/dev/null
+}
+
+_%[1]s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local cmd="" flags=%[3]q
+    [[ $COMP_CWORD -gt 1 ]] && cmd="${COMP_WORDS[1]}"
+
+    case "$cmd" in
+`, appName, pluginsFlag, options(spec.flags))
+
+	for _, cmd := range spec.commands {
+		fmt.Fprintf(&b, "    %s)\n", cmd.name)
+
+		if cmd.flags != nil {
+			fmt.Fprintf(&b, "        flags=%q\n        ;;\n", options(cmd.flags))
+			continue
+		}
+
+		if len(cmd.subcommands) > 0 {
+			fmt.Fprintf(&b, "        if [[ $COMP_CWORD -eq 2 ]]; then\n")
+			fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(cmd.subcommands, " "))
+			if len(cmd.pluginArgs) > 0 {
+				fmt.Fprintf(&b, "        elif [[ $COMP_CWORD -eq 3 && \" %s \" == *\" ${COMP_WORDS[2]} \"* ]]; then\n",
+					strings.Join(cmd.pluginArgs, " "))
+				fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W \"$(_%s_plugins)\" -- \"$cur\"))\n", appName)
+			}
+			fmt.Fprintf(&b, "        fi\n")
+		}
+
+		fmt.Fprintf(&b, "        return\n        ;;\n")
+	}
+
+	b.WriteString("    esac\n\n    case \"$prev\" in\n")
+
+	for _, f := range spec.allFlags() {
+		switch f.value {
+		case valueNone:
+			continue
+		case valueFile:
+			fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", f.option())
+		case valueDir:
+			fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -d -- \"$cur\")); return ;;\n", f.option())
+		case valuePlugin:
+			fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -W \"$(_%s_plugins)\" -- \"$cur\")); return ;;\n", f.option(), appName)
+		case valueChoice:
+			fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", f.option(), strings.Join(f.choices, " "))
+		default:
+			fmt.Fprintf(&b, "    %s) return ;;\n", f.option())
+		}
+	}
+
+	fmt.Fprintf(&b, `    esac
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    elif [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W %[2]q -- "$cur"))
+    fi
+}
+
+complete -o default -F _%[1]s %[1]s
+`, appName, spec.commandNames())
+
+	return b.String()
+}
+
+func zshCompletion(spec *completionSpec) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `#compdef %[1]s
+# zsh completion for %[1]s
+# Load it with:  source <(%[1]s completion zsh)
+# or save it as _%[1]s in a directory of $fpath.
+
+_%[1]s_plugins() {
+    local -a plugins
+    plugins=(${(f)"$(%[1]s completion %[2]s 2>/dev/null)"})
+    _describe -t plugins 'plugin' plugins
+}
+
+_%[1]s_commands() {
+    local -a commands
+    commands=(
+`, appName, pluginsFlag)
+
+	for _, cmd := range spec.commands {
+		fmt.Fprintf(&b, "        %s\n", zshQuote(cmd.name+":"+cmd.description))
+	}
+
+	fmt.Fprintf(&b, `    )
+    _alternative 'commands:command:_describe -t commands command commands' 'urls:URL:_urls'
+}
+
+_%[1]s() {
+    case $words[2] in
+`, appName)
+
+	for _, cmd := range spec.commands {
+		fmt.Fprintf(&b, "    %s)\n", cmd.name)
+
+		switch {
+		case cmd.flags != nil:
+			b.WriteString("        words=(${words[1]} ${words[3,-1]})\n        (( CURRENT-- ))\n")
+			fmt.Fprintf(&b, "        _arguments -S \\\n%s            '*:URL:_urls'\n", zshFlagSpecs(cmd.flags))
+		case len(cmd.subcommands) > 0:
+			fmt.Fprintf(&b, "        if (( CURRENT == 3 )); then\n            compadd -- %s\n", strings.Join(cmd.subcommands, " "))
+			if len(cmd.pluginArgs) > 0 {
+				fmt.Fprintf(&b, "        elif (( CURRENT == 4 )) && [[ $words[3] == (%s) ]]; then\n            _%s_plugins\n",
+					strings.Join(cmd.pluginArgs, "|"), appName)
+			}
+			b.WriteString("        fi\n")
+		}
+
+		b.WriteString("        return\n        ;;\n")
+	}
+
+	fmt.Fprintf(&b, `    esac
+
+    _arguments -S \
+%s        '1: :_%[2]s_commands' \
+        '*:URL:_urls'
+}
+
+if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+    _%[2]s "$@"
+else
+    compdef _%[2]s %[2]s
+fi
+`, zshFlagSpecs(spec.flags), appName)
+
+	return b.String()
+}
+
+// zshFlagSpecs returns _arguments specs for flags, one per line.
+func zshFlagSpecs(flags []completionFlag) string {
+	var b strings.Builder
+
+	for _, f := range flags {
+		description := strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`).Replace(f.usage)
+		spec := f.option() + "[" + description + "]"
+
+		if f.value != valueNone {
+			if len(f.name) > 1 {
+				spec = f.option() + "=[" + description + "]"
+			}
+
+			switch f.value {
+			case valueFile:
+				spec += ":file:_files"
+			case valueDir:
+				spec += ":directory:_files -/"
+			case valuePlugin:
+				spec += ":plugin:_" + appName + "_plugins"
+			case valueChoice:
+				spec += ":value:(" + strings.Join(f.choices, " ") + ")"
+			default:
+				spec += ":value: "
+			}
+		}
+
+		fmt.Fprintf(&b, "            %s \\\n", zshQuote(spec))
+	}
+
+	return b.String()
+}
+
+// zshQuote single-quotes s for zsh and fish.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishCompletion(spec *completionSpec) string {
+	var b strings.Builder
+
+	commands := spec.commandNames()
+
+	fmt.Fprintf(&b, `# fish completion for %[1]s
+# Load it with:  %[1]s completion fish | source
+
+function __%[1]s_plugins
+    %[1]s completion %[2]s 2>/dev/null
+end
+
+`, appName, pluginsFlag)
+
+	for _, cmd := range spec.commands {
+		fmt.Fprintf(&b, "complete -c %s -n __fish_use_subcommand -f -a %s -d %s\n",
+			appName, cmd.name, zshQuote(cmd.description))
+	}
+
+	for _, cmd := range spec.commands {
+		if len(cmd.subcommands) > 0 {
+			fmt.Fprintf(&b, "complete -c %s -n %s -f -a %s\n", appName,
+				zshQuote(fmt.Sprintf("__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s",
+					cmd.name, strings.Join(cmd.subcommands, " "))),
+				zshQuote(strings.Join(cmd.subcommands, " ")))
+		}
+
+		if len(cmd.pluginArgs) > 0 {
+			fmt.Fprintf(&b, "complete -c %s -n %s -f -a '(__%s_plugins)'\n", appName,
+				zshQuote(fmt.Sprintf("__fish_seen_subcommand_from %s; and __fish_seen_subcommand_from %s",
+					cmd.name, strings.Join(cmd.pluginArgs, " "))), appName)
+		}
+	}
+
+	b.WriteString("\n")
+	writeFishFlags(&b, spec.flags, "not __fish_seen_subcommand_from "+commands)
+
+	for _, cmd := range spec.commands {
+		writeFishFlags(&b, cmd.flags, "__fish_seen_subcommand_from "+cmd.name)
+	}
+
+	return b.String()
+}
+
+// writeFishFlags writes a complete command for each flag, active when
+// condition holds.
+func writeFishFlags(b *strings.Builder, flags []completionFlag, condition string) {
+	for _, f := range flags {
+		option := "-l " + f.name
+		if len(f.name) == 1 {
+			option = "-s " + f.name
+		}
+
+		var value string
+		switch f.value {
+		case valueNone:
+		case valueFile:
+			value = " -r -F"
+		case valueDir:
+			value = " -x -a '(__fish_complete_directories)'"
+		case valuePlugin:
+			value = " -x -a '(__" + appName + "_plugins)'"
+		case valueChoice:
+			value = " -x -a " + zshQuote(strings.Join(f.choices, " "))
+		default:
+			value = " -x"
+		}
+
+		fmt.Fprintf(b, "complete -c %s -n %s %s%s -d %s\n", appName, zshQuote(condition), option, value, zshQuote(f.usage))
+	}
+}
+
+func powerShellCompletion(spec *completionSpec) string {
+	var b strings.Builder
+
+	quoteList := func(items []string) string {
+		quoted := make([]string, len(items))
+		for i, item := range items {
+			quoted[i] = "'" + strings.ReplaceAll(item, "'", "''") + "'"
+		}
+		return "@(" + strings.Join(quoted, ", ") + ")"
+	}
+
+	optionList := func(flags []completionFlag) string {
+		return quoteList(strings.Fields(options(flags)))
+	}
+
+	fmt.Fprintf(&b, `# PowerShell completion for %[1]s
+# Load it with:  %[1]s completion powershell | Out-String | Invoke-Expression
+
+Register-ArgumentCompleter -Native -CommandName %[1]s -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $subcommands = [ordered]@{
+`, appName)
+
+	for _, cmd := range spec.commands {
+		fmt.Fprintf(&b, "        '%s' = %s\n", cmd.name, quoteList(cmd.subcommands))
+	}
+
+	fmt.Fprintf(&b, "    }\n    $flags = @{\n        '' = %s\n", optionList(spec.flags))
+	for _, cmd := range spec.commands {
+		if cmd.flags != nil {
+			fmt.Fprintf(&b, "        '%s' = %s\n", cmd.name, optionList(cmd.flags))
+		}
+	}
+
+	b.WriteString("    }\n    $values = @{\n")
+	for _, f := range spec.allFlags() {
+		if f.value == valueChoice {
+			fmt.Fprintf(&b, "        '%s' = %s\n", f.option(), quoteList(f.choices))
+		}
+	}
+
+	var pluginArgs []string
+	for _, cmd := range spec.commands {
+		pluginArgs = append(pluginArgs, cmd.pluginArgs...)
+	}
+
+	fmt.Fprintf(&b, `    }
+    $pluginCommands = %[2]s
+
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+        Where-Object { $_.Extent.EndOffset -lt $cursorPosition } | ForEach-Object { $_.ToString() })
+    $command = ''
+    if ($words.Count -gt 0 -and $subcommands.Contains($words[0])) { $command = $words[0] }
+    $prev = if ($words.Count -gt 0) { $words[-1] } else { '' }
+
+    $candidates = @()
+    if ($values.ContainsKey($prev)) {
+        $candidates = $values[$prev]
+    } elseif ($prev -eq '--plugin' -or
+        ($command -eq 'plugin' -and $words.Count -eq 2 -and $pluginCommands -contains $words[1])) {
+        $candidates = @(%[1]s completion %[3]s 2>$null)
+    } elseif ($wordToComplete.StartsWith('-')) {
+        if ($flags.ContainsKey($command)) { $candidates = $flags[$command] }
+    } elseif ($command -ne '' -and $words.Count -eq 1) {
+        $candidates = $subcommands[$command]
+    } elseif ($words.Count -eq 0) {
+        $candidates = $subcommands.Keys
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`, appName, quoteList(pluginArgs), pluginsFlag)
+
+	return b.String()
+}
+
+func showCompletionUsage() {
+	fmt.Printf(`Completion Command:
+
+Usage: %[1]s completion <bash|zsh|fish|powershell>
+
+Writes a completion script for flags, subcommands and installed plugin names
+to stdout.
+
+Examples:
+  source <(%[1]s completion bash)                        # bash, current shell
+  %[1]s completion bash > /etc/bash_completion.d/%[1]s
+  %[1]s completion zsh > "${fpath[1]}/_%[1]s"             # zsh
+  %[1]s completion fish > ~/.config/fish/completions/%[1]s.fish
+  %[1]s completion powershell | Out-String | Invoke-Expression
+
+`, appName)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompletionFlags(t *testing.T) {
+	spec := newCompletionSpec()
+
+	want := map[string]completionValue{
+		"resume":       valueNone,
+		"output":       valueFile,
+		"cache-dir":    valueDir,
+		"plugin":       valuePlugin,
+		"progress-bar": valueChoice,
+		"max-rate":     valueAny,
+	}
+
+	for _, f := range spec.flags {
+		if value, ok := want[f.name]; ok {
+			if f.value != value {
+				t.Errorf("flag %s value = %d, want %d", f.name, f.value, value)
+			}
+			delete(want, f.name)
+		}
+	}
+
+	for name := range want {
+		t.Errorf("flag %s is missing", name)
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	spec := newCompletionSpec()
+
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			var script strings.Builder
+			if err := writeCompletion(&script, shell, spec); err != nil {
+				t.Fatalf("writeCompletion() error = %v", err)
+			}
+
+			for _, want := range []string{"max-rate", "mirror", "interactive", "detailed", pluginsFlag} {
+				if !strings.Contains(script.String(), want) {
+					t.Errorf("%s script does not mention %q", shell, want)
+				}
+			}
+
+			// Check the syntax where the shell is installed
+			interpreter := map[string][]string{
+				"bash": {"bash", "-n"},
+				"zsh":  {"zsh", "-n"},
+				"fish": {"fish", "--no-execute"},
+			}[shell]
+			if interpreter == nil {
+				return
+			}
+
+			if _, err := exec.LookPath(interpreter[0]); err != nil {
+				return
+			}
+
+			path := filepath.Join(t.TempDir(), "completion")
+			if err := os.WriteFile(path, []byte(script.String()), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			// #nosec G204 -- the interpreter is one of the fixed names above
+			if output, err := exec.Command(interpreter[0], append(interpreter[1:], path)...).CombinedOutput(); err != nil {
+				t.Errorf("%s rejected the script: %v\n%s", shell, err, output)
+			}
+		})
+	}
+
+	if err := writeCompletion(&strings.Builder{}, "tcsh", spec); err == nil {
+		t.Error("writeCompletion() for an unsupported shell should fail")
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	gdlconfig "github.com/forest6511/gdl/pkg/config"
+)
+
+// configPathEnv overrides the configuration file used by "gdl config".
+const configPathEnv = "GDL_CONFIG"
+
+// runConfigCommand handles "gdl config <subcommand>".
+func runConfigCommand(args []string) int {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("file", "", "Configuration file (default: $GDL_CONFIG or ~/.config/gdl/config.json)")
+
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		showConfigUsage()
+		return 1
+	}
+
+	if *path == "" {
+		var err error
+		if *path, err = configPath(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	if err := configCommand(os.Stdout, *path, fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// configPath returns the configuration file named by $GDL_CONFIG, or the
+// default one.
+func configPath() (string, error) {
+	if path := os.Getenv(configPathEnv); path != "" {
+		return path, nil
+	}
+
+	return gdlconfig.DefaultConfigPath()
+}
+
+// configCommand runs a "gdl config" subcommand against the file at path.
+func configCommand(w io.Writer, path string, args []string) error {
+	loader := gdlconfig.NewConfigLoader(path)
+
+	switch sub, rest := args[0], args[1:]; sub {
+	case "path":
+		_, _ = fmt.Fprintln(w, path)
+		return nil
+
+	case "init":
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+		if err := loader.Save(gdlconfig.DefaultConfig()); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "Wrote %s\n", path)
+		return nil
+
+	case "show", "validate", "get", "set":
+		cfg, err := loader.Load()
+		if err != nil {
+			return err
+		}
+
+		switch sub {
+		case "show":
+			data, err := json.MarshalIndent(cfg, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintln(w, string(data))
+			return nil
+
+		case "validate":
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(w, "%s is valid\n", path)
+			return nil
+
+		case "get":
+			if len(rest) != 1 {
+				return errors.New("config get requires a KEY")
+			}
+			value, err := getConfigValue(cfg, rest[0])
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintln(w, value)
+			return nil
+
+		default:
+			if len(rest) != 2 {
+				return errors.New("config set requires a KEY and a VALUE")
+			}
+			if cfg, err = setConfigValue(cfg, rest[0], rest[1]); err != nil {
+				return err
+			}
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+			return loader.Save(cfg)
+		}
+
+	default:
+		return fmt.Errorf("unknown config command: %s", sub)
+	}
+}
+
+// configMap returns cfg as nested maps keyed by the JSON field names.
+func configMap(cfg *gdlconfig.Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// lookupConfigKey returns the map holding the last part of a dotted key such
+// as "network.max_redirects", and that last part.
+func lookupConfigKey(m map[string]interface{}, key string) (map[string]interface{}, string, error) {
+	parts := strings.Split(key, ".")
+
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("unknown config key: %s", key)
+		}
+		m = next
+	}
+
+	return m, parts[len(parts)-1], nil
+}
+
+// getConfigValue returns the value of a dotted key as JSON, or as plain text
+// for strings.
+func getConfigValue(cfg *gdlconfig.Config, key string) (string, error) {
+	m, err := configMap(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	parent, name, err := lookupConfigKey(m, key)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := parent[name]
+	if !ok {
+		return "", fmt.Errorf("unknown config key: %s", key)
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// setConfigValue returns a copy of cfg with a dotted key set. The value is
+// read as JSON when it parses as JSON and as a string otherwise; durations
+// such as "30s" are accepted for numeric keys.
+func setConfigValue(cfg *gdlconfig.Config, key, raw string) (*gdlconfig.Config, error) {
+	m, err := configMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, name, err := lookupConfigKey(m, key)
+	if err != nil {
+		return nil, err
+	}
+
+	current, ok := parent[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown config key: %s", key)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+
+	if _, isNumber := current.(float64); isNumber {
+		if d, err := time.ParseDuration(raw); err == nil {
+			value = d.Nanoseconds()
+		}
+	}
+
+	parent[name] = value
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated gdlconfig.Config
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	return &updated, nil
+}
+
+func showConfigUsage() {
+	fmt.Printf(`Config Command:
+
+Usage: %s config [--file PATH] <command> [args]
+
+Commands:
+  path                  Print the configuration file path
+  show                  Print the configuration, with defaults filled in
+  init                  Write a configuration file with the defaults
+  validate              Check the configuration file
+  get KEY               Print one setting, e.g. network.max_redirects
+  set KEY VALUE         Change one setting; durations such as 30s are accepted
+
+The file is $%s if set, or ~/.config/gdl/config.json.
+
+Examples:
+  %s config init
+  %s config set timeouts.connect_timeout 5s
+  %s config get retry_policy.max_retries
+
+`, appName, configPathEnv, appName, appName, appName)
+}
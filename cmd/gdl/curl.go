@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	stdErrors "errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/middleware"
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+// maxErrorBody is how much of an HTTP error response --fail-with-body keeps.
+const maxErrorBody = 16 << 20
+
+// errorBodyRecorder keeps the body of the last HTTP error response, so that
+// --fail-with-body can save it when the download fails.
+type errorBodyRecorder struct {
+	mu   sync.Mutex
+	body []byte
+	ok   bool
+}
+
+// middleware returns request middleware reading the body of each error
+// response to a GET request ahead of the downloader, which gets the same
+// bytes.
+func (r *errorBodyRecorder) middleware() middleware.RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return middleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if err != nil || resp.StatusCode < http.StatusBadRequest || req.Method == http.MethodHead || resp.Body == nil {
+				return resp, err
+			}
+
+			body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+			r.mu.Lock()
+			r.body, r.ok = body, true
+			r.mu.Unlock()
+
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), errReader{readErr}, resp.Body), resp.Body}
+
+			return resp, nil
+		})
+	}
+}
+
+// errReader returns err, or io.EOF when it is nil.
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	return 0, io.EOF
+}
+
+// take returns the body of the last error response and forgets it.
+func (r *errorBodyRecorder) take() ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	body, ok := r.body, r.ok
+	r.body, r.ok = nil, false
+
+	return body, ok
+}
+
+// saveErrorBody writes the body of the error response that failed a
+// download to outputFile, as curl --fail-with-body does. A partial file
+// kept for resuming is not replaced.
+func saveErrorBody(cfg *config, outputFile string, err error) {
+	if cfg.errorBodies == nil {
+		return
+	}
+
+	body, ok := cfg.errorBodies.take()
+
+	var downloadErr *gdlerrors.DownloadError
+	if !ok || !stdErrors.As(err, &downloadErr) || downloadErr.HTTPStatusCode < http.StatusBadRequest {
+		return
+	}
+
+	if outputFile == stdoutOutput {
+		_, _ = os.Stdout.Write(body)
+		return
+	}
+
+	if cfg.resume || cfg.continuePartial {
+		return
+	}
+
+	// #nosec G304 -- outputFile is the output path chosen by the user
+	file, createErr := os.Create(outputFile)
+	if createErr == nil {
+		_, createErr = file.Write(body)
+		if closeErr := file.Close(); createErr == nil {
+			createErr = closeErr
+		}
+	}
+	if createErr != nil {
+		formatter.PrintMessage(ui.MessageWarning, "Failed to save the error response: %v", createErr)
+		return
+	}
+
+	if cfg.verbose {
+		formatter.PrintMessage(ui.MessageInfo, "Saved the %d-byte error response to %s", len(body), outputFile)
+	}
+}
+
+// hasHeader reports whether headers set key, in any case.
+func hasHeader(headers map[string]string, key string) bool {
+	for name := range headers {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+
+	return false
+}
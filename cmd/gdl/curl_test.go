@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/middleware"
+)
+
+func TestParseArgsCurlFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantErr     bool
+		wantReferer string
+	}{
+		{"referer", []string{"--referer", "https://example.com/page"}, false, "https://example.com/page"},
+		{"referer shorthand auto", []string{"-e", "https://example.com/page;auto"}, false, "https://example.com/page"},
+		{"auto only", []string{"-e", ";auto"}, false, ""},
+		{"header wins", []string{"-e", "https://a.example", "-H", "referer: https://b.example"}, false, ""},
+		{"location", []string{"-L", "--location", "--compressed", "--fail-with-body"}, false, ""},
+		{"max-redirs", []string{"--max-redirs", "3"}, false, ""},
+		{"negative max-redirects", []string{"--max-redirects", "-1"}, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = append(append([]string{"gdl"}, tt.args...), "https://example.com/file.txt")
+
+			cfg, _, err := parseArgs()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseArgs() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := cfg.headers["Referer"]; got != tt.wantReferer {
+				t.Errorf("Referer = %q, want %q", got, tt.wantReferer)
+			}
+		})
+	}
+}
+
+func TestSaveErrorBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"token expired"}`))
+	}))
+	defer server.Close()
+
+	recorder := &errorBodyRecorder{}
+	client := &http.Client{Transport: middleware.ChainRequestMiddleware(nil, recorder.middleware())}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	downloadErr := gdlerrors.FromHTTPResponse(resp, server.URL)
+	_ = resp.Body.Close()
+
+	// The downloader still reads the body
+	if downloadErr.ResponseBody != `{"message":"token expired"}` {
+		t.Errorf("ResponseBody = %q", downloadErr.ResponseBody)
+	}
+
+	output := filepath.Join(t.TempDir(), "out.json")
+	saveErrorBody(&config{errorBodies: recorder}, output, downloadErr)
+
+	data, err := os.ReadFile(output)
+	if err != nil || string(data) != `{"message":"token expired"}` {
+		t.Errorf("output = %q, %v", data, err)
+	}
+
+	// Taken once; other failures write nothing
+	if _, ok := recorder.take(); ok {
+		t.Error("the body was not forgotten")
+	}
+
+	other := filepath.Join(t.TempDir(), "other")
+	saveErrorBody(&config{errorBodies: recorder}, other, io.ErrUnexpectedEOF)
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Errorf("a failure without an error response wrote %s", other)
+	}
+}
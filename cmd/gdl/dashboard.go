@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/cli"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// dashboardHeader must be set on the dashboard's POST requests. Browsers only
+// send custom headers cross-origin after a preflight the dashboard does not
+// answer, so other sites cannot press its buttons.
+const dashboardHeader = "X-Gdl-Dashboard"
+
+// dashboardCookie holds the dashboard token in the browser once the page has
+// been opened with ?token=.
+const dashboardCookie = "gdl_dashboard_token"
+
+// dashboardTokenEnv is the environment variable the dashboard token is read
+// from when --ui-token is not given.
+const dashboardTokenEnv = "GDL_DASHBOARD_TOKEN"
+
+// dashboardHistoryLimit is how many recent downloads the dashboard lists.
+const dashboardHistoryLimit = 50
+
+// Why the dashboard stops a run, recorded as the run's error.
+var (
+	errRunCancelled = stdErrors.New("cancelled from the dashboard")
+	errRunPaused    = stdErrors.New("paused from the dashboard")
+)
+
+// dashboard serves a web page showing the scheduled downloads, the progress of
+// the ones running and the download history, with buttons to pause, resume,
+// cancel and retry them.
+type dashboard struct {
+	store   *cli.ScheduleStore
+	history string
+	token   string
+	users   *cli.UserStore
+
+	mu   sync.Mutex
+	runs map[string]*dashboardRun
+}
+
+// dashboardRun is the progress of a scheduled run in progress.
+type dashboardRun struct {
+	Started time.Time `json:"started"`
+	Bytes   int64     `json:"bytes"`
+	Total   int64     `json:"total"`
+	Speed   int64     `json:"speed"`
+	Percent float64   `json:"percent"`
+
+	stop context.CancelCauseFunc
+}
+
+// dashboardJob is a scheduled download as the dashboard shows it.
+type dashboardJob struct {
+	*cli.ScheduledDownload
+
+	NextRun time.Time     `json:"next_run,omitzero"`
+	Running *dashboardRun `json:"running,omitempty"`
+}
+
+// newDashboard returns a dashboard of the schedules in store and the history
+// in the history file ("" when the history is off).
+func newDashboard(store *cli.ScheduleStore, history string) *dashboard {
+	return &dashboard{store: store, history: history, runs: make(map[string]*dashboardRun)}
+}
+
+// withToken makes the dashboard require token on every request, as a bearer
+// token or in the cookie set by opening the page with ?token=.
+func (d *dashboard) withToken(token string) *dashboard {
+	d.token = token
+	return d
+}
+
+// withUsers lets the users in users sign in with their own tokens. A user
+// only sees and controls the user's own scheduled downloads and history.
+func (d *dashboard) withUsers(users *cli.UserStore) *dashboard {
+	d.users = users
+	return d
+}
+
+// dashboardUserKey is the context key of the user a request is made by.
+type dashboardUserKey struct{}
+
+// dashboardUser returns the user a request signed in as, or nil for the
+// dashboard token, which controls every schedule.
+func dashboardUser(r *http.Request) *cli.DaemonUser {
+	user, _ := r.Context().Value(dashboardUserKey{}).(*cli.DaemonUser)
+	return user
+}
+
+// authenticated reports whether the dashboard requires a token.
+func (d *dashboard) authenticated() bool {
+	return d.token != "" || d.users != nil
+}
+
+// serve starts serving the dashboard on addr until ctx is cancelled, and
+// returns the address it listens on. Without tokens, addr must be a loopback
+// address.
+func (d *dashboard) serve(ctx context.Context, addr string) (string, error) {
+	if !d.authenticated() && !isLoopback(addr) {
+		return "", fmt.Errorf("the dashboard only listens on a loopback address such as 127.0.0.1:8080 without --ui-token, not %s", addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	server := &http.Server{Handler: d.handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() { _ = server.Serve(listener) }()
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	return listener.Addr().String(), nil
+}
+
+// handler returns the dashboard's page and the JSON API it polls.
+func (d *dashboard) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(dashboardPage)
+	})
+	mux.HandleFunc("GET /api/jobs", d.handleJobs)
+	mux.HandleFunc("POST /api/jobs", d.handleAdd)
+	mux.HandleFunc("DELETE /api/jobs/{id}", d.handleRemove)
+	mux.HandleFunc("GET /api/history", d.handleHistory)
+	mux.HandleFunc("POST /api/jobs/{id}/{action}", d.handleAction)
+
+	if !d.authenticated() {
+		return loopbackHostOnly(mux)
+	}
+
+	return d.authenticate(mux)
+}
+
+// loopbackHostOnly rejects requests whose Host header is not a loopback name
+// or address. Without a token this keeps DNS rebinding pages, which are
+// same-origin with the dashboard and may set any header, from reaching it.
+func loopbackHostOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			writeDashboardError(w, http.StatusForbidden,
+				fmt.Errorf("host %q is not a loopback address: open the dashboard at 127.0.0.1 or localhost, or set --ui-token", r.Host))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate lets requests carrying the dashboard token or a user's token
+// through to next, with the user in their context. Opening the page with
+// ?token= stores the token in a cookie and redirects to the page, so the
+// browser sends it with the API requests that follow.
+func (d *dashboard) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" && r.Method == http.MethodGet && r.URL.Path == "/" {
+			if _, ok := d.identify(r, token); !ok {
+				writeDashboardError(w, http.StatusUnauthorized, stdErrors.New("wrong dashboard token"))
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     dashboardCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		user, ok := d.identify(r, requestToken(r))
+		if !ok {
+			writeDashboardError(w, http.StatusUnauthorized, stdErrors.New("missing or wrong dashboard token: open the dashboard with ?token="))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), dashboardUserKey{}, user)))
+	})
+}
+
+// requestToken returns the token r carries in its Authorization header or
+// its cookie.
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	if cookie, err := r.Cookie(dashboardCookie); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// identify returns the user whose token is token, or nil for the dashboard
+// token, and reports whether it is either.
+func (d *dashboard) identify(r *http.Request, token string) (*cli.DaemonUser, bool) {
+	if token == "" {
+		return nil, false
+	}
+
+	if d.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) == 1 {
+		return nil, true
+	}
+
+	if d.users != nil {
+		if user, err := d.users.Authenticate(r.Context(), token); err == nil && user != nil {
+			return user, true
+		}
+	}
+
+	return nil, false
+}
+
+// visible returns the scheduled downloads the user of r may see and control.
+func (d *dashboard) visible(r *http.Request) ([]*cli.ScheduledDownload, error) {
+	schedules, err := d.store.List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	user := dashboardUser(r)
+	if user == nil {
+		return schedules, nil
+	}
+
+	return slices.DeleteFunc(schedules, func(sd *cli.ScheduledDownload) bool { return sd.Owner != user.Name }), nil
+}
+
+// lookup returns the scheduled download with the given ID if the user of r
+// may control it.
+func (d *dashboard) lookup(r *http.Request, id string) (*cli.ScheduledDownload, error) {
+	schedules, err := d.visible(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sd := range schedules {
+		if sd.ID == id {
+			return sd, nil
+		}
+	}
+
+	return nil, stdErrors.New("no scheduled download " + strconv.Quote(id))
+}
+
+// handleJobs lists the scheduled downloads with the progress of those running.
+func (d *dashboard) handleJobs(w http.ResponseWriter, r *http.Request) {
+	schedules, err := d.visible(r)
+	if err != nil {
+		writeDashboardError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	jobs := make([]dashboardJob, 0, len(schedules))
+	for _, sd := range schedules {
+		job := dashboardJob{ScheduledDownload: sd}
+		if next, err := sd.NextRun(); err == nil {
+			job.NextRun = next
+		}
+		if run := d.runs[sd.ID]; run != nil {
+			snapshot := *run
+			job.Running = &snapshot
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	writeDashboardJSON(w, jobs)
+}
+
+// handleHistory lists the most recent downloads, newest first.
+func (d *dashboard) handleHistory(w http.ResponseWriter, r *http.Request) {
+	entries := []*cli.HistoryEntry{}
+
+	if d.history != "" {
+		all, err := cli.NewHistoryStore(d.history).List(r.Context())
+		if err != nil {
+			writeDashboardError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if user := dashboardUser(r); user != nil {
+			all = slices.DeleteFunc(all, func(entry *cli.HistoryEntry) bool { return !user.Owns(entry.Destination) })
+		}
+
+		entries = all[max(len(all)-dashboardHistoryLimit, 0):]
+		slices.Reverse(entries)
+	}
+
+	writeDashboardJSON(w, entries)
+}
+
+// handleAction pauses, resumes, cancels or retries a scheduled download.
+// Pausing and cancelling stop its run in progress, keeping the part file;
+// resuming makes it run again at once, continuing that file.
+func (d *dashboard) handleAction(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(dashboardHeader) == "" {
+		writeDashboardError(w, http.StatusForbidden, stdErrors.New("missing "+dashboardHeader+" header"))
+		return
+	}
+
+	ctx, id := r.Context(), r.PathValue("id")
+
+	if _, err := d.lookup(r, id); err != nil {
+		writeDashboardError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var err error
+	switch r.PathValue("action") {
+	case "pause":
+		if err = d.store.SetPaused(ctx, id, true); err == nil {
+			d.stop(id, errRunPaused)
+		}
+	case "resume":
+		if err = d.store.SetPaused(ctx, id, false); err == nil {
+			err = d.store.RequestRun(ctx, id)
+		}
+	case "cancel":
+		if !d.stop(id, errRunCancelled) {
+			writeDashboardError(w, http.StatusConflict, stdErrors.New("scheduled download "+strconv.Quote(id)+" is not running"))
+			return
+		}
+	case "retry":
+		err = d.store.RequestRun(ctx, id)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		writeDashboardError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dashboardAddRequest is the body of a POST to /api/jobs.
+type dashboardAddRequest struct {
+	Cron   string `json:"cron"`
+	URL    string `json:"url"`
+	Output string `json:"output"`
+}
+
+// handleAdd schedules a download for the user of the request. A user's output
+// is a path relative to the user's directory.
+func (d *dashboard) handleAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(dashboardHeader) == "" {
+		writeDashboardError(w, http.StatusForbidden, stdErrors.New("missing "+dashboardHeader+" header"))
+		return
+	}
+
+	var req dashboardAddRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeDashboardError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Output == "" {
+		req.Output = extractFilenameFromURL(req.URL)
+	}
+
+	owner, output := "", req.Output
+	if user := dashboardUser(r); user != nil {
+		path, err := user.Output(req.Output)
+		if err != nil {
+			writeDashboardError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		owner, output = user.Name, path
+	} else if !filepath.IsAbs(output) {
+		writeDashboardError(w, http.StatusBadRequest, stdErrors.New("output must be an absolute path"))
+		return
+	}
+
+	sd, err := d.store.AddFor(r.Context(), owner, req.Cron, req.URL, output)
+	if err != nil {
+		writeDashboardError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(sd)
+}
+
+// handleRemove removes a scheduled download, stopping its run in progress.
+func (d *dashboard) handleRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(dashboardHeader) == "" {
+		writeDashboardError(w, http.StatusForbidden, stdErrors.New("missing "+dashboardHeader+" header"))
+		return
+	}
+
+	id := r.PathValue("id")
+	if _, err := d.lookup(r, id); err != nil {
+		writeDashboardError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err := d.store.Remove(r.Context(), id); err != nil {
+		writeDashboardError(w, http.StatusNotFound, err)
+		return
+	}
+	d.stop(id, errRunCancelled)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// run runs fetch for sd, showing its progress on the dashboard and letting
+// the dashboard stop it.
+func (d *dashboard) run(ctx context.Context, sd *cli.ScheduledDownload,
+	fetch func(ctx context.Context, progress gdl.ProgressCallback) (string, error),
+) (string, error) {
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	run := &dashboardRun{Started: time.Now(), stop: stop}
+
+	d.mu.Lock()
+	d.runs[sd.ID] = run
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.runs, sd.ID)
+		d.mu.Unlock()
+	}()
+
+	return fetch(ctx, func(p gdl.Progress) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		run.Bytes, run.Total, run.Percent = p.BytesDownloaded, p.TotalSize, p.Percentage
+		run.Speed = p.SmoothedSpeed
+		if run.Speed == 0 {
+			run.Speed = p.Speed
+		}
+	})
+}
+
+// stop stops the run in progress of the scheduled download with the given ID
+// with cause, and reports whether there was one.
+func (d *dashboard) stop(id string, cause error) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	run := d.runs[id]
+	if run == nil {
+		return false
+	}
+
+	run.stop(cause)
+	return true
+}
+
+// isLoopback reports whether the address addr listens on is only reachable
+// from this host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	return isLoopbackName(host)
+}
+
+// isLoopbackHost reports whether the Host header of a request, with or
+// without a port, names this host.
+func isLoopbackHost(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+
+	return isLoopbackName(strings.Trim(host, "[]"))
+}
+
+// isLoopbackName reports whether host is "localhost" or a loopback IP.
+func isLoopbackName(host string) bool {
+	ip := net.ParseIP(host)
+	return strings.EqualFold(strings.TrimSuffix(host, "."), "localhost") || (ip != nil && ip.IsLoopback())
+}
+
+func writeDashboardJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeDashboardError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/cli"
+)
+
+func TestDashboard(t *testing.T) {
+	dir := t.TempDir()
+	store := cli.NewScheduleStore(filepath.Join(dir, "schedules.json"))
+
+	sd, err := store.Add(t.Context(), "@daily", "https://example.com/big.iso", filepath.Join(dir, "big.iso"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := filepath.Join(dir, "history.jsonl")
+	if _, err := cli.NewHistoryStore(history).Add(t.Context(), cli.HistoryEntry{URL: "https://example.com/a", Destination: "a", Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	board := newDashboard(store, history)
+	server := httptest.NewServer(board.handler())
+	defer server.Close()
+
+	get := func(path string, v any) string {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s status = %d", path, resp.StatusCode)
+		}
+		if v != nil {
+			if err := json.Unmarshal(body, v); err != nil {
+				t.Fatalf("GET %s: %v", path, err)
+			}
+		}
+		return string(body)
+	}
+
+	post := func(path string, header bool) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, nil)
+		if header {
+			req.Header.Set(dashboardHeader, "1")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if page := get("/", nil); !strings.Contains(page, "gdl dashboard") {
+		t.Error("GET / did not serve the dashboard page")
+	}
+
+	var entries []cli.HistoryEntry
+	get("/api/history", &entries)
+	if len(entries) != 1 || entries[0].URL != "https://example.com/a" {
+		t.Errorf("history = %+v, want the recorded download", entries)
+	}
+
+	// A run in progress shows its progress and can be cancelled
+	progressed := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		_, err := board.run(t.Context(), sd, func(ctx context.Context, progress gdl.ProgressCallback) (string, error) {
+			progress(gdl.Progress{BytesDownloaded: 512, TotalSize: 1024, Percentage: 50, Speed: 100})
+			close(progressed)
+			<-ctx.Done()
+			return "", context.Cause(ctx)
+		})
+		result <- err
+	}()
+	<-progressed
+
+	var jobs []struct {
+		ID      string `json:"id"`
+		Paused  bool   `json:"paused"`
+		Running *struct {
+			Bytes   int64   `json:"bytes"`
+			Percent float64 `json:"percent"`
+		} `json:"running"`
+	}
+	get("/api/jobs", &jobs)
+	if len(jobs) != 1 || jobs[0].Running == nil || jobs[0].Running.Bytes != 512 || jobs[0].Running.Percent != 50 {
+		t.Fatalf("jobs = %+v, want schedule 1 half done", jobs)
+	}
+
+	if code := post("/api/jobs/1/cancel", false); code != http.StatusForbidden {
+		t.Errorf("POST without %s status = %d, want 403", dashboardHeader, code)
+	}
+	if code := post("/api/jobs/1/cancel", true); code != http.StatusNoContent {
+		t.Fatalf("cancel status = %d, want 204", code)
+	}
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, errRunCancelled) {
+			t.Errorf("cancelled run error = %v, want %v", err, errRunCancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancel did not stop the run")
+	}
+
+	if code := post("/api/jobs/1/cancel", true); code != http.StatusConflict {
+		t.Errorf("cancel without a run status = %d, want 409", code)
+	}
+
+	// Pausing and resuming are stored in the schedule file
+	if code := post("/api/jobs/1/pause", true); code != http.StatusNoContent {
+		t.Fatalf("pause status = %d, want 204", code)
+	}
+	if schedules, _ := store.List(t.Context()); !schedules[0].Paused {
+		t.Error("schedule not paused")
+	}
+
+	if code := post("/api/jobs/1/resume", true); code != http.StatusNoContent {
+		t.Fatalf("resume status = %d, want 204", code)
+	}
+	if schedules, _ := store.List(t.Context()); schedules[0].Paused || !schedules[0].RunRequested {
+		t.Errorf("resumed schedule = %+v, want it unpaused and run at once", schedules[0])
+	}
+
+	for path, want := range map[string]int{
+		"/api/jobs/42/retry": http.StatusNotFound,
+		"/api/jobs/1/delete": http.StatusNotFound,
+	} {
+		if code := post(path, true); code != want {
+			t.Errorf("POST %s status = %d, want %d", path, code, want)
+		}
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		"localhost:8080": true,
+		"0.0.0.0:8080":   false,
+		"[::]:8080":      false,
+		"10.0.0.5:8080":  false,
+		"not an address": false,
+	} {
+		if got := isLoopback(addr); got != want {
+			t.Errorf("isLoopback(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestIsLoopbackHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"127.0.0.1:8080":      true,
+		"127.0.0.1":           true,
+		"[::1]:8080":          true,
+		"[::1]":               true,
+		"localhost:8080":      true,
+		"LOCALHOST":           true,
+		"rebind.example:8080": false,
+		"10.0.0.5":            false,
+		"":                    false,
+	} {
+		if got := isLoopbackHost(host); got != want {
+			t.Errorf("isLoopbackHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestDashboardRejectsForeignHost(t *testing.T) {
+	board := newDashboard(cli.NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json")), "")
+	server := httptest.NewServer(board.handler())
+	defer server.Close()
+
+	// A DNS rebinding page reaches the loopback server under its own name
+	for _, path := range []string{"/api/history", "/api/jobs"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Host = "rebind.example:8080"
+		req.Header.Set(dashboardHeader, "1")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("GET %s with a foreign Host status = %d, want %d", path, resp.StatusCode, http.StatusForbidden)
+		}
+	}
+}
+
+func TestDashboardServe(t *testing.T) {
+	board := newDashboard(cli.NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json")), "")
+
+	for _, addr := range []string{"0.0.0.0:0", ":0", "[::]:0"} {
+		if _, err := board.serve(t.Context(), addr); err == nil {
+			t.Errorf("serve(%q) should refuse a non-loopback address", addr)
+		}
+	}
+
+	addr, err := board.serve(t.Context(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("serve() error = %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr + "/api/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /api/jobs status = %d", resp.StatusCode)
+	}
+}
+
+func TestDashboardToken(t *testing.T) {
+	board := newDashboard(cli.NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json")), "").withToken("s3cret")
+
+	addr, err := board.serve(t.Context(), "0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("serve() with a token on a non-loopback address error = %v", err)
+	}
+	_, port, _ := net.SplitHostPort(addr)
+	base := "http://127.0.0.1:" + port
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	do := func(method, path string, header map[string]string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, base+path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		header       map[string]string
+		want         int
+	}{
+		{"GET", "/", nil, http.StatusUnauthorized},
+		{"GET", "/api/jobs", nil, http.StatusUnauthorized},
+		{"GET", "/api/history", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		{"POST", "/api/jobs/1/retry", map[string]string{dashboardHeader: "1"}, http.StatusUnauthorized},
+		{"GET", "/?token=wrong", nil, http.StatusUnauthorized},
+		{"GET", "/api/jobs", map[string]string{"Authorization": "Bearer s3cret"}, http.StatusOK},
+		{"GET", "/api/history", map[string]string{"Cookie": dashboardCookie + "=s3cret"}, http.StatusOK},
+		{"GET", "/", map[string]string{"Cookie": dashboardCookie + "=s3cret"}, http.StatusOK},
+	} {
+		if resp := do(tt.method, tt.path, tt.header); resp.StatusCode != tt.want {
+			t.Errorf("%s %s with %v status = %d, want %d", tt.method, tt.path, tt.header, resp.StatusCode, tt.want)
+		}
+	}
+
+	// Opening the page with the token signs the browser in
+	resp := do("GET", "/?token=s3cret", nil)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/" {
+		t.Fatalf("GET /?token= status = %d, Location = %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != dashboardCookie || cookies[0].Value != "s3cret" || !cookies[0].HttpOnly {
+		t.Errorf("GET /?token= cookies = %v", cookies)
+	}
+}
+
+func TestDashboardUsers(t *testing.T) {
+	dir := t.TempDir()
+	store := cli.NewScheduleStore(filepath.Join(dir, "schedules.json"))
+	users := cli.NewUserStore(filepath.Join(dir, "users.json"))
+
+	alice, aliceToken, err := users.Add(t.Context(), "alice", filepath.Join(dir, "alice"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, bobToken, err := users.Add(t.Context(), "bob", filepath.Join(dir, "bob"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.AddFor(t.Context(), bob.Name, "@daily", "https://example.com/bob.iso", filepath.Join(bob.Dir, "bob.iso")); err != nil {
+		t.Fatal(err)
+	}
+
+	history := filepath.Join(dir, "history.jsonl")
+	for _, dest := range []string{filepath.Join(alice.Dir, "a"), filepath.Join(bob.Dir, "b")} {
+		if _, err := cli.NewHistoryStore(history).Add(t.Context(), cli.HistoryEntry{URL: "https://example.com/x", Destination: dest}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	board := newDashboard(store, history).withUsers(users)
+	server := httptest.NewServer(board.handler())
+	defer server.Close()
+
+	do := func(token, method, path, body string, v any) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(dashboardHeader, "1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if v != nil {
+			_ = json.NewDecoder(resp.Body).Decode(v)
+		}
+		return resp.StatusCode
+	}
+
+	if code := do("wrong", "GET", "/api/jobs", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("GET /api/jobs with a wrong token status = %d, want 401", code)
+	}
+
+	// A user adds schedules below the user's directory only
+	var added cli.ScheduledDownload
+	if code := do(aliceToken, "POST", "/api/jobs", `{"cron":"@daily","url":"https://example.com/a.iso","output":"isos/a.iso"}`, &added); code != http.StatusCreated {
+		t.Fatalf("POST /api/jobs status = %d, want 201", code)
+	}
+	if added.Owner != "alice" || added.Output != filepath.Join(alice.Dir, "isos", "a.iso") {
+		t.Errorf("added schedule = %+v, want alice's below her directory", added)
+	}
+	for _, body := range []string{
+		`{"cron":"@daily","url":"https://example.com/a.iso","output":"../bob/a.iso"}`,
+		`{"cron":"@daily","url":"https://example.com/a.iso","output":"/etc/a.iso"}`,
+	} {
+		if code := do(aliceToken, "POST", "/api/jobs", body, nil); code != http.StatusBadRequest {
+			t.Errorf("POST /api/jobs %s status = %d, want 400", body, code)
+		}
+	}
+
+	// Each user sees and controls only the user's own schedules and history
+	var jobs []cli.ScheduledDownload
+	do(aliceToken, "GET", "/api/jobs", "", &jobs)
+	if len(jobs) != 1 || jobs[0].ID != added.ID {
+		t.Errorf("alice's jobs = %+v, want only %s", jobs, added.ID)
+	}
+
+	var entries []cli.HistoryEntry
+	do(bobToken, "GET", "/api/history", "", &entries)
+	if len(entries) != 1 || entries[0].Destination != filepath.Join(bob.Dir, "b") {
+		t.Errorf("bob's history = %+v, want only his download", entries)
+	}
+
+	for _, req := range []struct{ method, path string }{
+		{"POST", "/api/jobs/" + added.ID + "/pause"},
+		{"POST", "/api/jobs/" + added.ID + "/retry"},
+		{"DELETE", "/api/jobs/" + added.ID},
+	} {
+		if code := do(bobToken, req.method, req.path, "", nil); code != http.StatusNotFound {
+			t.Errorf("bob's %s %s status = %d, want 404", req.method, req.path, code)
+		}
+	}
+	if schedules, _ := store.List(t.Context()); len(schedules) != 2 || schedules[1].Paused || schedules[1].RunRequested {
+		t.Errorf("schedules = %+v, want alice's untouched", schedules)
+	}
+
+	if code := do(aliceToken, "DELETE", "/api/jobs/"+added.ID, "", nil); code != http.StatusNoContent {
+		t.Errorf("alice's DELETE status = %d, want 204", code)
+	}
+	if schedules, _ := store.List(t.Context()); len(schedules) != 1 || schedules[0].Owner != "bob" {
+		t.Errorf("schedules = %+v, want only bob's", schedules)
+	}
+
+	// The dashboard token sees every schedule
+	board.withToken("admin")
+	do("admin", "GET", "/api/jobs", "", &jobs)
+	if len(jobs) != 1 || jobs[0].Owner != "bob" {
+		t.Errorf("admin jobs = %+v, want bob's", jobs)
+	}
+
+	// Users make the dashboard require a token on any address
+	if _, err := newDashboard(store, "").withUsers(users).serve(t.Context(), "0.0.0.0:0"); err != nil {
+		t.Errorf("serve() with users on a non-loopback address error = %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+)
+
+// dryRunFile is a download reported on by --dry-run.
+type dryRunFile struct {
+	url         string
+	destination string
+
+	// size is the size a directory listing gave, or -1 if unknown. It is
+	// used when the URL cannot be queried directly, such as s3:// objects.
+	size int64
+}
+
+// runDryRun reports on the files of "gdl get --dry-run", which are
+// downloaded one at a time.
+func runDryRun(cfg *config, files []dryRunFile) int {
+	var maxRate int64
+	if cfg.maxRate != "" {
+		maxRate, _ = ratelimit.ParseRate(cfg.maxRate)
+	}
+
+	return dryRun(context.Background(), os.Stdout, gdl.NewDownloader(), files, maxRate, 1)
+}
+
+// dryRunFilesFromJobs returns the files of batch jobs, whose sizes are
+// unknown until queried.
+func dryRunFilesFromJobs(jobs []gdl.BatchJob) []dryRunFile {
+	files := make([]dryRunFile, len(jobs))
+	for i, job := range jobs {
+		files[i] = dryRunFile{url: job.URL, destination: job.Destination, size: -1}
+	}
+
+	return files
+}
+
+// dryRun queries files without downloading them and prints, for each, the
+// URL it ends at after redirects, where it would be saved, its size, whether
+// the server accepts range requests and how long it would take at maxRate
+// bytes per second. parallel is the number of files downloaded at once, used
+// for the estimate of the whole batch. It returns 1 if any file cannot be
+// queried.
+func dryRun(ctx context.Context, w io.Writer, downloader *gdl.Downloader, files []dryRunFile, maxRate int64, parallel int) int {
+	var urls []string
+	for _, file := range files {
+		if isHTTPURL(file.url) {
+			urls = append(urls, file.url)
+		}
+	}
+
+	infos := make(map[string]gdl.FileInfoResult, len(urls))
+	for _, result := range downloader.GetFileInfoBatch(ctx, urls) {
+		infos[result.URL] = result
+	}
+
+	failed := 0
+	total, known := int64(0), 0
+	for _, file := range files {
+		finalURL, size, ranges := file.url, file.size, "unknown"
+
+		if result, ok := infos[file.url]; ok {
+			if result.Error != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "%s: %v\n", file.url, result.Error)
+				continue
+			}
+
+			finalURL, ranges = result.Info.FinalURL, "not supported"
+			if result.Info.Size > 0 {
+				size = result.Info.Size
+			}
+			if result.Info.SupportsRanges {
+				ranges = "supported"
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\n", file.url)
+		if finalURL != file.url {
+			_, _ = fmt.Fprintf(w, "  Final URL:  %s\n", finalURL)
+		}
+		_, _ = fmt.Fprintf(w, "  Save as:    %s\n", file.destination)
+		_, _ = fmt.Fprintf(w, "  Size:       %s\n", dryRunSize(size))
+		_, _ = fmt.Fprintf(w, "  Ranges:     %s\n", ranges)
+		_, _ = fmt.Fprintf(w, "  Time:       %s\n", estimateTime(size, maxRate))
+
+		if size >= 0 {
+			total += size
+			known++
+		}
+	}
+
+	if reported := len(files) - failed; reported > 1 {
+		summary := fmt.Sprintf("%d files, %s", reported, formatBytes(total))
+		if known < reported {
+			summary += fmt.Sprintf(" (%d of unknown size)", reported-known)
+		}
+		if atOnce := max(1, min(parallel, reported)); maxRate > 0 && known > 0 {
+			summary += fmt.Sprintf(", about %s with %d at once", formatEstimate(total/(maxRate*int64(atOnce))), atOnce)
+		}
+		_, _ = fmt.Fprintln(w, summary)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// dryRunSize formats a size that may be unknown (negative).
+func dryRunSize(size int64) string {
+	if size < 0 {
+		return "unknown"
+	}
+
+	return formatBytes(size)
+}
+
+// estimateTime describes how long size bytes take at rate bytes per second.
+func estimateTime(size, rate int64) string {
+	switch {
+	case rate <= 0:
+		return "unknown (no --max-rate)"
+	case size < 0:
+		return "unknown (size unknown)"
+	default:
+		return fmt.Sprintf("about %s at %s/s", formatEstimate(size/rate), formatBytes(rate))
+	}
+}
+
+// formatEstimate formats a number of seconds, rounding up to a second.
+func formatEstimate(seconds int64) string {
+	return (time.Duration(max(seconds, 1)) * time.Second).String()
+}
+
+// isHTTPURL reports whether rawURL is an http or https URL, which a dry run
+// can query.
+func isHTTPURL(rawURL string) bool {
+	lower := strings.ToLower(rawURL)
+
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
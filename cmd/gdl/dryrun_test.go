@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestDryRun(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			http.Redirect(w, r, "/v2/app.tar.gz", http.StatusFound)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", "3145728")
+		}
+	}))
+	defer server.Close()
+
+	files := []dryRunFile{
+		{url: server.URL + "/latest", destination: "app.tar.gz", size: -1},
+		{url: server.URL + "/data.bin", destination: "data.bin", size: -1},
+		{url: "s3://bucket/logs/a.log", destination: "a.log", size: 1048576},
+	}
+
+	var out bytes.Buffer
+	if code := dryRun(context.Background(), &out, gdl.NewDownloader(), files, 1<<20, 2); code != 0 {
+		t.Fatalf("dryRun() = %d, output:\n%s", code, out.String())
+	}
+
+	for _, want := range []string{
+		"Final URL:  " + server.URL + "/v2/app.tar.gz",
+		"Save as:    app.tar.gz",
+		"Size:       3.0 MB",
+		"Ranges:     supported",
+		"Time:       about 3s at 1.0 MB/s",
+		"Ranges:     unknown",
+		"3 files, 7.0 MB, about 3s with 2 at once",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("dryRun() output does not contain %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	missing := []dryRunFile{{url: server.URL + "/missing", destination: "missing", size: -1}}
+	if code := dryRun(context.Background(), &out, gdl.NewDownloader(), missing, 0, 1); code != 1 {
+		t.Errorf("dryRun() for a missing file = %d, want 1", code)
+	}
+}
+
+func TestEstimateTime(t *testing.T) {
+	tests := []struct {
+		size, rate int64
+		want       string
+	}{
+		{10 << 20, 1 << 20, "about 10s at 1.0 MB/s"},
+		{100, 1 << 20, "about 1s at 1.0 MB/s"},
+		{10 << 20, 0, "unknown (no --max-rate)"},
+		{-1, 1 << 20, "unknown (size unknown)"},
+	}
+
+	for _, tt := range tests {
+		if got := estimateTime(tt.size, tt.rate); got != tt.want {
+			t.Errorf("estimateTime(%d, %d) = %q, want %q", tt.size, tt.rate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/pathtemplate"
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+// runExpandedDownload downloads every URL a curl-style pattern such as
+// "https://example.com/img[001-100].jpg" or "https://{a,b}.example.com/f.zip"
+// expands to, one after another with the same options. -o is a template in
+// which "#1" to "#9" are replaced with the value each set or range took, and
+// output template variables such as {index} are filled in.
+func runExpandedDownload(cfg *config, pattern string) int {
+	jobs, err := expandURLPattern(cfg, pattern)
+	if err != nil {
+		formatter.PrintMessage(ui.MessageError, "Invalid URL pattern: %v (use --globoff to take [] and {} literally)", err)
+		return 1
+	}
+
+	if cfg.expandDryRun {
+		printExpandedURLs(os.Stdout, jobs, cfg.verbose)
+		return 0
+	}
+
+	if cfg.dryRun {
+		return runDryRun(cfg, dryRunFilesFromJobs(jobs))
+	}
+
+	// Create context for cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handleInterruption(ctx, cancel, cfg)
+	handleStatusRequests(ctx, os.Stderr)
+
+	downloader, coreDownloader, err := setupDownloaders(ctx, cfg)
+	if err != nil {
+		formatter.PrintMessage(ui.MessageError, "Downloader setup failed: %v", err)
+		return 1
+	}
+	defer saveHAR(cfg)
+
+	// Take file extensions from the Content-Type where the template needs them
+	if !cfg.globOff && pathtemplate.Has(cfg.output) {
+		if jobs, err = downloader.ResolveGlob(ctx, pattern, &gdl.GlobOptions{Output: cfg.output}); err != nil {
+			formatter.PrintMessage(ui.MessageError, "Invalid output template: %v", err)
+			return 1
+		}
+	}
+
+	var eventsWriter io.Writer
+	if wantsEventsWriter(cfg) {
+		writer, closeEvents, err := openEventsWriter(cfg.eventsFile)
+		if err != nil {
+			formatter.PrintMessage(ui.MessageError, "Failed to open events file: %v", err)
+			return 1
+		}
+		defer closeEvents()
+
+		eventsWriter = writer
+	}
+
+	succeeded := 0
+	for i, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if !cfg.quiet {
+			formatter.PrintMessage(ui.MessageInfo, "[%d/%d] %s", i+1, len(jobs), job.URL)
+		}
+
+		if err := downloadAndReport(ctx, downloader, coreDownloader, cfg, job.URL, job.Destination, eventsWriter); err == nil {
+			succeeded++
+		}
+	}
+
+	if !cfg.quiet || succeeded < len(jobs) {
+		formatter.PrintMessage(ui.MessageInfo, "%d of %d downloads succeeded", succeeded, len(jobs))
+	}
+
+	if code := interruptedExitCode(ctx); code != 0 {
+		return code
+	}
+
+	if succeeded < len(jobs) {
+		return 1
+	}
+
+	return 0
+}
+
+// expandURLPattern returns the downloads a URL pattern expands to, or the URL
+// itself with --globoff.
+func expandURLPattern(cfg *config, pattern string) ([]gdl.BatchJob, error) {
+	if cfg.globOff {
+		output := cfg.output
+		if output == "" {
+			output = extractFilenameFromURL(pattern)
+		} else if pathtemplate.Has(output) {
+			var err error
+			if output, err = gdl.ExpandOutputTemplate(context.Background(), output, pattern); err != nil {
+				return nil, err
+			}
+		}
+
+		return []gdl.BatchJob{{ID: pattern, URL: pattern, Destination: output}}, nil
+	}
+
+	return gdl.ExpandGlob(pattern, cfg.output, 0)
+}
+
+// printExpandedURLs prints the expanded URLs one per line, with their
+// destinations in verbose mode.
+func printExpandedURLs(w io.Writer, jobs []gdl.BatchJob, verbose bool) {
+	for _, job := range jobs {
+		if verbose {
+			_, _ = fmt.Fprintf(w, "%s -> %s\n", job.URL, job.Destination)
+		} else {
+			_, _ = fmt.Fprintln(w, job.URL)
+		}
+	}
+}
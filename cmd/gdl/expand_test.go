@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestExpandURLPattern(t *testing.T) {
+	jobs, err := expandURLPattern(&config{output: "out/#1.jpg"}, "https://example.com/[1-3].jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 3 || jobs[2].URL != "https://example.com/3.jpg" || jobs[2].Destination != "out/3.jpg" {
+		t.Errorf("expandURLPattern() = %+v", jobs)
+	}
+
+	// --globoff keeps brackets as they are
+	jobs, err = expandURLPattern(&config{globOff: true}, "https://example.com/a[1].txt")
+	if err != nil || len(jobs) != 1 || jobs[0].URL != "https://example.com/a[1].txt" || jobs[0].Destination != "a[1].txt" {
+		t.Errorf("expandURLPattern(globoff) = %+v, %v", jobs, err)
+	}
+
+	if _, err := expandURLPattern(&config{output: "same.jpg"}, "https://example.com/[1-2].jpg"); err == nil {
+		t.Error("expandURLPattern() should reject URLs saved to the same file")
+	}
+}
+
+func TestPrintExpandedURLs(t *testing.T) {
+	jobs := []gdl.BatchJob{
+		{URL: "https://example.com/1.jpg", Destination: "1.jpg"},
+		{URL: "https://example.com/2.jpg", Destination: "2.jpg"},
+	}
+
+	var out bytes.Buffer
+	printExpandedURLs(&out, jobs, false)
+	if want := "https://example.com/1.jpg\nhttps://example.com/2.jpg\n"; out.String() != want {
+		t.Errorf("printExpandedURLs() = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	printExpandedURLs(&out, jobs, true)
+	if want := "https://example.com/1.jpg -> 1.jpg\nhttps://example.com/2.jpg -> 2.jpg\n"; out.String() != want {
+		t.Errorf("printExpandedURLs(verbose) = %q, want %q", out.String(), want)
+	}
+}
+
+func TestRunExpandedDownload(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file3.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "#1.txt")
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	if code := run([]string{"gdl", "-q", "-o", output, server.URL + "/file{1,2}.txt"}); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	for _, n := range []string{"1", "2"} {
+		content, err := os.ReadFile(filepath.Join(dir, n+".txt")) // #nosec G304 -- test file
+		if err != nil || string(content) != "content of /file"+n+".txt" {
+			t.Errorf("%s.txt = %q, %v", n, content, err)
+		}
+	}
+
+	// A failed download fails the command but not the rest of the batch
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	if code := run([]string{"gdl", "-q", "-f", "-o", output, server.URL + "/file[3-4].txt"}); code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "4.txt")); err != nil {
+		t.Errorf("4.txt was not downloaded after a failure: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/cli"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// historyFileEnv overrides the file completed downloads are recorded in;
+// "off" turns the history off.
+const historyFileEnv = "GDL_HISTORY_FILE"
+
+// defaultHistoryLimit is how many downloads "gdl history list" shows.
+const defaultHistoryLimit = 20
+
+// historyFile returns the file completed downloads are recorded in, or "" if
+// the history is off.
+func historyFile() string {
+	switch path := os.Getenv(historyFileEnv); path {
+	case "":
+		return cli.GetDefaultHistoryFile()
+	case "off":
+		return ""
+	default:
+		return path
+	}
+}
+
+// wantsHistory reports whether a download that ended with stats is recorded
+// in the history. Skipped and unmodified files were not downloaded again.
+func wantsHistory(stats *types.DownloadStats) bool {
+	return historyFile() != "" && stats != nil && !stats.Skipped && !stats.NotModified
+}
+
+// recordHistory adds a completed download of size bytes from url to
+// destination to the history. A history that cannot be written never fails
+// the download.
+func recordHistory(url, destination string, size int64, checksum string) {
+	file := historyFile()
+	if file == "" {
+		return
+	}
+
+	_, _ = cli.NewHistoryStore(file).Add(context.Background(), cli.HistoryEntry{
+		URL:         url,
+		Destination: destination,
+		Size:        size,
+		SHA256:      checksum,
+	})
+}
+
+// runHistoryCommand handles "gdl history [list|search]".
+func runHistoryCommand(args []string) int {
+	file := historyFile()
+	if file == "" {
+		fmt.Fprintf(os.Stderr, "Error: the download history is off ($%s=off)\n", historyFileEnv)
+		return 1
+	}
+
+	if err := historyCommand(context.Background(), os.Stdout, cli.NewHistoryStore(file), args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showHistoryUsage()
+		return 1
+	}
+
+	return 0
+}
+
+// historyCommand runs a "gdl history" subcommand against store.
+func historyCommand(ctx context.Context, w io.Writer, store *cli.HistoryStore, args []string) error {
+	sub := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	limit := fs.Int("limit", defaultHistoryLimit, "Most recent downloads to show (0 for all)")
+
+	// Flags may follow the search query
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	var entries []*cli.HistoryEntry
+	var err error
+
+	switch sub {
+	case "list":
+		if len(positional) > 0 {
+			return fmt.Errorf("unexpected argument %q", positional[0])
+		}
+		entries, err = store.List(ctx)
+	case "search":
+		if len(positional) != 1 {
+			return fmt.Errorf("history search requires a QUERY")
+		}
+		entries, err = store.Search(ctx, positional[0])
+	default:
+		return fmt.Errorf("unknown history command %q", sub)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		_, _ = fmt.Fprintln(w, "No downloads found")
+		return nil
+	}
+
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+
+	printHistory(w, entries)
+
+	return nil
+}
+
+// printHistory prints one line per download: its ID, when it finished, its
+// size, its URL and where it was saved. The SHA-256 follows when known.
+func printHistory(w io.Writer, entries []*cli.HistoryEntry) {
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(w, "%-5d %s  %9s  %s -> %s\n", entry.ID,
+			entry.Time.Local().Format(time.DateTime), formatBytes(entry.Size), entry.URL, entry.Destination)
+		if entry.SHA256 != "" {
+			_, _ = fmt.Fprintf(w, "      sha256:%s\n", entry.SHA256)
+		}
+	}
+}
+
+// runRedoCommand handles "gdl redo <id> [get options]", which downloads a
+// URL from the history again to the same destination.
+func runRedoCommand(args []string) int {
+	if len(args) == 0 {
+		showRedoUsage()
+		return 1
+	}
+
+	file := historyFile()
+	if file == "" {
+		fmt.Fprintf(os.Stderr, "Error: the download history is off ($%s=off)\n", historyFileEnv)
+		return 1
+	}
+
+	getArgs, err := redoArgs(context.Background(), cli.NewHistoryStore(file), args[0], args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showRedoUsage()
+		return 1
+	}
+
+	return runGetCommand(getArgs)
+}
+
+// redoArgs returns the "gdl get" arguments that repeat the download with the
+// given history ID, with options placed before the URL.
+func redoArgs(ctx context.Context, store *cli.HistoryStore, id string, options []string) ([]string, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download ID %q; run '%s history' to list them", id, appName)
+	}
+
+	entry, err := store.Get(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"-o", entry.Destination}, options...)
+
+	return append(args, entry.URL), nil
+}
+
+func showHistoryUsage() {
+	fmt.Printf(`History Command:
+
+Usage: %s history [list] [--limit N]      List the most recent downloads
+       %s history search QUERY [--limit N]  List downloads whose URL or path contains QUERY
+
+Completed downloads are recorded with their size, SHA-256 and time in
+~/.gdl/history.jsonl, or in $%s if set; set it to "off" to record
+nothing. --limit shows the N most recent matches (default: %d, 0 for all).
+Repeat a download with '%s redo ID'.
+
+Examples:
+  %s history
+  %s history search example.com --limit 0
+
+`, appName, appName, historyFileEnv, defaultHistoryLimit, appName, appName, appName)
+}
+
+func showRedoUsage() {
+	fmt.Printf(`Redo Command:
+
+Usage: %s redo <id> [options]
+
+Downloads the URL of a download from the history again, to the same file.
+Options are passed on to '%s get', for example --force to replace the file
+or --if-exists rename to keep it.
+
+Examples:
+  %s redo 42
+  %s redo 42 --force --max-rate 5MB/s
+
+`, appName, appName, appName, appName)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/cli"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestRecordHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	t.Setenv(historyFileEnv, file)
+
+	if !wantsHistory(&types.DownloadStats{BytesDownloaded: 10}) {
+		t.Error("wantsHistory() = false for a completed download")
+	}
+	if wantsHistory(&types.DownloadStats{Skipped: true}) || wantsHistory(&types.DownloadStats{NotModified: true}) {
+		t.Error("wantsHistory() = true for a file that was not downloaded")
+	}
+
+	recordHistory("https://example.com/a.zip", "/data/a.zip", 10, helloSHA256)
+
+	entries, err := cli.NewHistoryStore(file).List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].URL != "https://example.com/a.zip" || entries[0].SHA256 != helloSHA256 {
+		t.Errorf("history = %+v, want the recorded download", entries)
+	}
+
+	t.Setenv(historyFileEnv, "off")
+	if wantsHistory(&types.DownloadStats{BytesDownloaded: 10}) {
+		t.Error("wantsHistory() = true with the history off")
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	ctx := context.Background()
+	store := cli.NewHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"))
+
+	var out bytes.Buffer
+	if err := historyCommand(ctx, &out, store, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No downloads found") {
+		t.Errorf("empty history = %q", out.String())
+	}
+
+	for _, url := range []string{"https://example.com/a.zip", "https://cdn.example.org/b.iso", "https://example.com/c.iso"} {
+		if _, err := store.Add(ctx, cli.HistoryEntry{URL: url, Destination: "/data/" + filepath.Base(url), Size: 2048}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant []string
+	}{
+		{"list", nil, []string{"1 ", "a.zip", "b.iso", "c.iso", "2.0 KB"}, nil},
+		{"limit", []string{"--limit", "1"}, []string{"c.iso"}, []string{"a.zip", "b.iso"}},
+		{"search", []string{"search", "example.com"}, []string{"a.zip", "c.iso"}, []string{"b.iso"}},
+		{"search then limit", []string{"search", "ISO", "--limit", "1"}, []string{"c.iso"}, []string{"a.zip", "b.iso"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			if err := historyCommand(ctx, &out, store, tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output %q does not contain %q", out.String(), want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("output %q contains %q", out.String(), notWant)
+				}
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"search"}, {"list", "extra"}, {"clear"}} {
+		if err := historyCommand(ctx, &out, store, args); err == nil {
+			t.Errorf("historyCommand(%v) should fail", args)
+		}
+	}
+}
+
+func TestRedoArgs(t *testing.T) {
+	ctx := context.Background()
+	store := cli.NewHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"))
+
+	if _, err := store.Add(ctx, cli.HistoryEntry{URL: "https://example.com/a.zip", Destination: "/data/a.zip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := redoArgs(ctx, store, "1", []string{"--force"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-o", "/data/a.zip", "--force", "https://example.com/a.zip"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("redoArgs() = %v, want %v", args, want)
+	}
+
+	for _, id := range []string{"2", "first"} {
+		if _, err := redoArgs(ctx, store, id, nil); err == nil {
+			t.Errorf("redoArgs(%q) should fail", id)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+
+	"github.com/forest6511/gdl/internal/hostcache"
+)
+
+// hostCacheEnv overrides the file what was learned about each host is kept
+// in; "off" turns the cache off.
+const hostCacheEnv = "GDL_HOST_CACHE"
+
+// hostCacheFile returns the host cache file, or "" if the cache is off.
+func hostCacheFile() string {
+	switch path := os.Getenv(hostCacheEnv); path {
+	case "":
+		return hostcache.DefaultFile()
+	case "off":
+		return ""
+	default:
+		return path
+	}
+}
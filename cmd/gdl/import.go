@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forest6511/gdl/internal/importer"
+)
+
+// importConfig configures "gdl import".
+type importConfig struct {
+	inputs   []string
+	output   string
+	format   string
+	since    string
+	include  StringSlice
+	exclude  StringSlice
+	hosts    StringSlice
+	mimes    StringSlice
+	complete bool
+	failed   bool
+	noNames  bool
+	verbose  bool
+
+	// Derived from since, complete and failed
+	sinceAt time.Time
+	state   string
+}
+
+// runImportCommand handles "gdl import <file>...".
+func runImportCommand(args []string) int {
+	icfg, err := parseImportArgs(args, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showImportUsage()
+		return 1
+	}
+
+	return importLists(icfg, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// parseImportArgs parses the arguments of "gdl import", which may put flags
+// before or after the files. now is the time --since durations count back
+// from.
+func parseImportArgs(args []string, now time.Time) (*importConfig, error) {
+	icfg := &importConfig{}
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineImportFlags(fs, icfg)
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		icfg.inputs = append(icfg.inputs, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(icfg.inputs) == 0 {
+		return nil, fmt.Errorf("import requires at least one file (- for stdin)")
+	}
+
+	switch icfg.format {
+	case importer.FormatAuto, importer.FormatDownloads, importer.FormatHAR, importer.FormatBookmarks:
+	default:
+		return nil, fmt.Errorf("unknown --format %q (supported: %s)", icfg.format, strings.Join(importer.Formats, ", "))
+	}
+
+	if icfg.complete && icfg.failed {
+		return nil, fmt.Errorf("--complete-only and --failed-only cannot be used together")
+	}
+	switch {
+	case icfg.complete:
+		icfg.state = importer.StateComplete
+	case icfg.failed:
+		icfg.state = importer.StateFailed
+	}
+
+	if icfg.since != "" {
+		since, err := parseSince(icfg.since, now)
+		if err != nil {
+			return nil, err
+		}
+		icfg.sinceAt = since
+	}
+
+	if err := icfg.filter().Validate(); err != nil {
+		return nil, err
+	}
+
+	return icfg, nil
+}
+
+// defineImportFlags registers the flags of "gdl import" on fs.
+func defineImportFlags(fs *flag.FlagSet, icfg *importConfig) {
+	fs.StringVar(&icfg.output, "o", "-", "Write the batch file to FILE instead of stdout")
+	fs.StringVar(&icfg.output, "output", "-", "Write the batch file to FILE instead of stdout")
+	fs.StringVar(&icfg.format, "format", importer.FormatAuto, "Format of the files: auto, downloads, har or bookmarks")
+	fs.Var(&icfg.include, "include", "Only import files matching this pattern")
+	fs.Var(&icfg.exclude, "exclude", "Skip files matching this pattern")
+	fs.Var(&icfg.hosts, "host", "Only import URLs whose host matches this pattern")
+	fs.Var(&icfg.mimes, "mime", "Only import files of this media type, or of any type under a prefix such as video/")
+	fs.StringVar(&icfg.since, "since", "", "Only import entries made since a date (2025-01-31) or for a duration (7d, 12h)")
+	fs.BoolVar(&icfg.complete, "complete-only", false, "Only import finished downloads and successful responses")
+	fs.BoolVar(&icfg.failed, "failed-only", false, "Only import interrupted downloads and failed responses")
+	fs.BoolVar(&icfg.noNames, "no-names", false, "Leave out the names the browser saved downloads as")
+	fs.BoolVar(&icfg.verbose, "v", false, "Report how many URLs each file held")
+	fs.BoolVar(&icfg.verbose, "verbose", false, "Report how many URLs each file held")
+}
+
+// filter returns the importer filter of the flags.
+func (icfg *importConfig) filter() *importer.Filter {
+	return &importer.Filter{
+		Include:   icfg.include,
+		Exclude:   icfg.exclude,
+		Hosts:     icfg.hosts,
+		MimeTypes: icfg.mimes,
+		Since:     icfg.sinceAt,
+		State:     icfg.state,
+	}
+}
+
+// parseSince parses --since: a date, an RFC 3339 time, or a duration before
+// now such as "12h" or "7d".
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid --since %q: expected a date (2025-01-31), a time or a duration (7d, 12h)", value)
+}
+
+// importLists converts the input files to a batch file, written to
+// icfg.output or to stdout.
+func importLists(icfg *importConfig, stdin io.Reader, stdout, stderr io.Writer) int {
+	var entries []importer.Entry
+
+	for _, input := range icfg.inputs {
+		parsed, err := parseImportFile(input, icfg.format, stdin)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "Error reading %s: %v\n", input, err)
+			return 1
+		}
+		if icfg.verbose {
+			_, _ = fmt.Fprintf(stderr, "%s: %d URLs\n", input, len(parsed))
+		}
+		entries = append(entries, parsed...)
+	}
+
+	entries = icfg.filter().Apply(entries)
+
+	var buf bytes.Buffer
+	if err := importer.WriteBatch(&buf, entries, !icfg.noNames); err != nil {
+		_, _ = fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if icfg.output == "-" {
+		_, _ = stdout.Write(buf.Bytes())
+	} else if err := os.WriteFile(icfg.output, buf.Bytes(), 0o644); err != nil {
+		_, _ = fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch {
+	case len(entries) == 0:
+		_, _ = fmt.Fprintln(stderr, "Warning: no URLs left to import")
+	case icfg.output != "-":
+		_, _ = fmt.Fprintf(stderr, "Wrote %s (%d URLs)\n", icfg.output, len(entries))
+	case icfg.verbose:
+		_, _ = fmt.Fprintf(stderr, "%d URLs imported\n", len(entries))
+	}
+
+	return 0
+}
+
+// parseImportFile reads the entries of one input file, "-" being stdin.
+func parseImportFile(input, format string, stdin io.Reader) ([]importer.Entry, error) {
+	if input == "-" {
+		return importer.Parse(stdin, format)
+	}
+
+	file, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	return importer.Parse(file, format)
+}
+
+func showImportUsage() {
+	fmt.Printf(`Import Command:
+
+Usage: %s import <file>... [options]
+
+Converts lists of URLs kept by other tools into a batch file for
+"%s batch": one URL per line, followed by the name the browser saved it as.
+URLs found in several files are imported once.
+
+Formats:
+  downloads   The JSON downloads list of Chrome or Firefox, as returned by the
+              downloads.search extension API and exported by downloads
+              extensions: an array of items, or an object holding one under
+              "downloads"
+  har         A HAR file saved from the network panel of the developer tools;
+              GET requests are imported, redirects are skipped
+  bookmarks   An HTML page of links, such as an exported bookmarks file
+
+Options:
+  -o, --output FILE     Write the batch file to FILE (default: stdout)
+      --format FORMAT   auto (default), downloads, har or bookmarks
+      --include GLOB    Only import matching files (repeatable)
+      --exclude GLOB    Skip matching files (repeatable)
+      --host GLOB       Only import URLs whose host matches, e.g. "*.example.com"
+                        (repeatable)
+      --mime TYPE       Only import files of a media type, or of any type
+                        under a prefix such as "video/" (repeatable)
+      --since WHEN      Only import entries made since a date (2025-01-31),
+                        a time (RFC 3339) or a duration ago (7d, 12h)
+      --complete-only   Only import finished downloads and successful responses
+      --failed-only     Only import interrupted downloads and failed responses
+      --no-names        Leave out the names downloads were saved as
+  -v, --verbose         Report how many URLs each file held
+
+A pattern without a slash matches file names ("*.iso"); one with a slash
+matches URL paths ("releases/*/*.tar.gz"). Bookmarks have no media type, and
+HAR files no file names.
+
+Examples:
+  %s import downloads.json -o retry.txt --failed-only
+  %s import session.har --mime video/ --host "*.example.com" | %s batch - -o videos
+  %s import bookmarks.html --include "*.pdf" --since 30d -o papers.txt
+
+`, appName, appName, appName, appName, appName, appName)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/importer"
+)
+
+func TestParseImportArgs(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		inputs  []string
+		state   string
+		since   time.Time
+	}{
+		{"defaults", []string{"downloads.json"}, false, []string{"downloads.json"}, "", time.Time{}},
+		{"flags after files", []string{"a.har", "b.html", "--host", "*.example.com", "-o", "out.txt"}, false, []string{"a.har", "b.html"}, "", time.Time{}},
+		{"failed only", []string{"--failed-only", "-"}, false, []string{"-"}, importer.StateFailed, time.Time{}},
+		{"since days", []string{"a.har", "--since", "7d"}, false, []string{"a.har"}, "", now.AddDate(0, 0, -7)},
+		{"since duration", []string{"a.har", "--since", "12h"}, false, []string{"a.har"}, "", now.Add(-12 * time.Hour)},
+		{"since time", []string{"a.har", "--since", "2025-01-31T10:00:00Z"}, false, []string{"a.har"}, "", time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC)},
+		{"no file", []string{"--mime", "video/"}, true, nil, "", time.Time{}},
+		{"unknown format", []string{"a.csv", "--format", "csv"}, true, nil, "", time.Time{}},
+		{"both states", []string{"a.har", "--complete-only", "--failed-only"}, true, nil, "", time.Time{}},
+		{"invalid since", []string{"a.har", "--since", "last week"}, true, nil, "", time.Time{}},
+		{"invalid pattern", []string{"a.har", "--include", "["}, true, nil, "", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			icfg, err := parseImportArgs(tt.args, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseImportArgs() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseImportArgs() error = %v", err)
+			}
+
+			if fmt.Sprint(icfg.inputs) != fmt.Sprint(tt.inputs) || icfg.state != tt.state || !icfg.sinceAt.Equal(tt.since) {
+				t.Errorf("parseImportArgs() = %+v", icfg)
+			}
+		})
+	}
+}
+
+func TestImportLists(t *testing.T) {
+	dir := t.TempDir()
+
+	downloads := filepath.Join(dir, "downloads.json")
+	if err := os.WriteFile(downloads, []byte(`{"downloads": [
+  {"url": "https://example.com/a.iso", "filename": "/home/me/Downloads/a.iso", "state": "complete"},
+  {"url": "https://example.com/b.zip", "filename": "/home/me/Downloads/b.zip", "state": "interrupted"}
+]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks := `<DL><DT><A HREF="https://example.com/a.iso">again</A><DT><A HREF="https://example.com/c.pdf">paper</A></DL>`
+
+	t.Run("stdout", func(t *testing.T) {
+		icfg, err := parseImportArgs([]string{downloads, "-"}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		if code := importLists(icfg, strings.NewReader(bookmarks), &stdout, &stderr); code != 0 {
+			t.Fatalf("importLists() = %d, stderr %q", code, stderr.String())
+		}
+
+		want := "https://example.com/a.iso a.iso\nhttps://example.com/b.zip b.zip\nhttps://example.com/c.pdf\n"
+		if stdout.String() != want {
+			t.Errorf("batch file = %q, want %q", stdout.String(), want)
+		}
+	})
+
+	t.Run("output file", func(t *testing.T) {
+		output := filepath.Join(dir, "retry.txt")
+		icfg, err := parseImportArgs([]string{downloads, "--failed-only", "--no-names", "-o", output}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		if code := importLists(icfg, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("importLists() = %d, stderr %q", code, stderr.String())
+		}
+
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "https://example.com/b.zip\n" || stdout.Len() != 0 {
+			t.Errorf("batch file = %q, stdout %q", data, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), "(1 URLs)") {
+			t.Errorf("stderr = %q", stderr.String())
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		icfg, err := parseImportArgs([]string{filepath.Join(dir, "missing.har")}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		if code := importLists(icfg, nil, &stdout, &stderr); code != 1 {
+			t.Errorf("importLists() = %d, want 1", code)
+		}
+	})
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/ui"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+// defaultWizardConcurrency matches the default of --concurrent, so the
+// wizard only adds the flag when the answer differs.
+const defaultWizardConcurrency = 4
+
+// shellSafeArg matches arguments that need no quoting in a POSIX shell.
+var shellSafeArg = regexp.MustCompile(`^[A-Za-z0-9@%_+=:,./-]+$`)
+
+// downloadWizard asks for the settings of a download and turns the answers
+// into gdl command-line arguments.
+type downloadWizard struct {
+	formatter *ui.Formatter
+}
+
+// runInteractiveCommand handles "gdl interactive".
+func runInteractiveCommand(args []string) int {
+	if len(args) > 0 {
+		if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+			showInteractiveUsage()
+			return 0
+		}
+
+		fmt.Fprintf(os.Stderr, "Error: interactive takes no arguments\n")
+		showInteractiveUsage()
+		return 1
+	}
+
+	wizardFormatter := ui.NewFormatter().
+		WithInteractive(true).
+		WithReader(os.Stdin).
+		WithWriter(os.Stdout)
+	wizard := &downloadWizard{formatter: wizardFormatter}
+
+	cmdArgs, err := wizard.run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("\nEquivalent command:\n  %s\n\n", formatCommandLine(append([]string{appName}, cmdArgs...)))
+
+	start, err := wizardFormatter.ConfirmPrompt("Start the download now?", true)
+	if err != nil || !start {
+		return 0
+	}
+
+	return run(append([]string{os.Args[0]}, cmdArgs...))
+}
+
+// run walks through the URL, destination, authentication, rate limits and
+// storage backend, and returns the arguments of the equivalent command,
+// ending with the URL.
+func (w *downloadWizard) run() ([]string, error) {
+	var args []string
+
+	rawURL, err := w.ask("Download URL", "", validateWizardURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultOutput := extractFilenameFromURL(rawURL)
+	output, err := w.ask("Save as", defaultOutput, validation.ValidateDestination)
+	if err != nil {
+		return nil, err
+	}
+	if output != defaultOutput {
+		args = append(args, "-o", output)
+	}
+
+	resume, err := w.formatter.ConfirmPrompt("Resume a partial download of this file if there is one?", false)
+	if err != nil {
+		return nil, err
+	}
+	if resume {
+		args = append(args, "--resume")
+	}
+
+	authArgs, err := w.askAuth()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, authArgs...)
+
+	limitArgs, err := w.askLimits()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, limitArgs...)
+
+	storageArgs, err := w.askStorage()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, storageArgs...)
+
+	return append(args, rawURL), nil
+}
+
+// askAuth asks how to authenticate and returns the matching -H arguments.
+func (w *downloadWizard) askAuth() ([]string, error) {
+	choice, err := w.choose("Authentication", []string{
+		"None",
+		"Bearer token",
+		"Basic (user name and password)",
+		"Custom header",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch choice {
+	case 1:
+		token, err := w.ask("Token", "", requireAnswer("token"))
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{"-H", "Authorization: Bearer " + token}, nil
+	case 2:
+		user, err := w.ask("User name", "", requireAnswer("user name"))
+		if err != nil {
+			return nil, err
+		}
+
+		password, err := w.ask("Password", "", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		credentials := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+
+		return []string{"-H", "Authorization: Basic " + credentials}, nil
+	case 3:
+		header, err := w.ask("Header (Name: value)", "", validateWizardHeader)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{"-H", header}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// askLimits asks for the maximum rate and number of connections.
+func (w *downloadWizard) askLimits() ([]string, error) {
+	var args []string
+
+	rate, err := w.ask("Maximum download rate, e.g. 2MB/s (empty for unlimited)", "", func(s string) error {
+		if s == "" {
+			return nil
+		}
+		return ratelimit.ValidateRate(s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rate != "" {
+		args = append(args, "--max-rate", rate)
+	}
+
+	defaultConcurrent := strconv.Itoa(defaultWizardConcurrency)
+	concurrent, err := w.ask("Concurrent connections (1-32)", defaultConcurrent, validateWizardConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	if concurrent != defaultConcurrent {
+		args = append(args, "--concurrent", concurrent)
+	}
+
+	return args, nil
+}
+
+// askStorage asks where to store the download and returns the --storage
+// arguments for a storage backend.
+func (w *downloadWizard) askStorage() ([]string, error) {
+	schemes := []string{"", "s3", "gcs", "file"}
+
+	choice, err := w.choose("Store the download", []string{
+		"Local file",
+		"Amazon S3 (s3://bucket/path/)",
+		"Google Cloud Storage (gcs://bucket/path/)",
+		"Local directory (file:///path/)",
+	})
+	if err != nil || choice == 0 {
+		return nil, err
+	}
+
+	scheme := schemes[choice]
+	storageURL, err := w.ask(fmt.Sprintf("Storage URL (%s://...)", scheme), "", func(s string) error {
+		parsed, err := url.Parse(s)
+		if err != nil || parsed.Scheme != scheme || (parsed.Host == "" && parsed.Path == "") {
+			return gdlerrors.NewValidationError("storage", fmt.Sprintf("expected a %s:// URL", scheme))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"--storage", storageURL}, nil
+}
+
+// ask prompts until the answer passes validate, using defaultValue for an
+// empty answer. It only fails if the input cannot be read.
+func (w *downloadWizard) ask(question, defaultValue string, validate func(string) error) (string, error) {
+	if defaultValue != "" {
+		question = fmt.Sprintf("%s [%s]", question, defaultValue)
+	}
+
+	for {
+		answer, err := w.formatter.Prompt(question)
+		if err != nil {
+			return "", err
+		}
+
+		if answer == "" {
+			answer = defaultValue
+		}
+
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				w.formatter.PrintMessage(ui.MessageError, "%v", err)
+				continue
+			}
+		}
+
+		return answer, nil
+	}
+}
+
+// choose asks to pick one of options until a valid choice is made, with
+// the first option as the default.
+func (w *downloadWizard) choose(question string, options []string) (int, error) {
+	for {
+		choice, err := w.formatter.SelectPrompt(question, options, 0)
+		if err == nil {
+			return choice, nil
+		}
+
+		if gdlerrors.GetErrorCode(err) != gdlerrors.CodeValidationError {
+			return 0, err
+		}
+
+		w.formatter.PrintMessage(ui.MessageError, "%v", err)
+	}
+}
+
+// requireAnswer returns a validator rejecting empty answers.
+func requireAnswer(name string) func(string) error {
+	return func(s string) error {
+		if s == "" {
+			return gdlerrors.NewValidationError(name, name+" is required")
+		}
+		return nil
+	}
+}
+
+// validateWizardURL accepts absolute http and https URLs.
+func validateWizardURL(s string) error {
+	parsed, err := url.Parse(s)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return gdlerrors.NewValidationError("url", "enter an http:// or https:// URL")
+	}
+
+	return nil
+}
+
+// validateWizardHeader accepts headers in the "Name: value" form of -H.
+func validateWizardHeader(s string) error {
+	name, _, found := strings.Cut(s, ":")
+	if !found || strings.TrimSpace(name) == "" {
+		return gdlerrors.NewValidationError("header", `expected "Name: value"`)
+	}
+
+	return nil
+}
+
+// validateWizardConcurrency accepts the connection counts --concurrent does.
+func validateWizardConcurrency(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 32 {
+		return gdlerrors.NewValidationError("concurrent", "enter a number from 1 to 32")
+	}
+
+	return nil
+}
+
+// formatCommandLine joins args into a command line for a POSIX shell,
+// single-quoting arguments that contain spaces or special characters.
+func formatCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafeArg.MatchString(arg) {
+			quoted[i] = arg
+			continue
+		}
+
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func showInteractiveUsage() {
+	fmt.Printf(`Interactive Command:
+
+Usage: %s interactive
+
+Asks for the URL, destination, authentication, rate limits and storage
+backend of a download, prints the equivalent command line for reuse in
+scripts, and optionally starts the download.
+
+`, appName)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+func TestDownloadWizard(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []string
+		want    []string
+	}{
+		{
+			name:    "defaults",
+			answers: []string{"https://example.com/files/data.tar.gz", "", "", "", "", "", ""},
+			want:    []string{"https://example.com/files/data.tar.gz"},
+		},
+		{
+			name: "invalid answers are asked again",
+			answers: []string{
+				"ftp://example.com/data", "https://example.com/files/data.tar.gz",
+				"", "y",
+				"5", "2", "", "s3cr3t",
+				"fast", "2MB/s", "64", "8",
+				"",
+			},
+			want: []string{
+				"--resume", "-H", "Authorization: Bearer s3cr3t",
+				"--max-rate", "2MB/s", "--concurrent", "8",
+				"https://example.com/files/data.tar.gz",
+			},
+		},
+		{
+			name: "basic auth and S3",
+			answers: []string{
+				"https://example.com/report.pdf", "reports/q3.pdf", "n",
+				"3", "alice", "secret",
+				"", "",
+				"2", "gcs://bucket", "s3://bucket/reports/",
+			},
+			want: []string{
+				"-o", "reports/q3.pdf", "-H", "Authorization: Basic YWxpY2U6c2VjcmV0",
+				"--storage", "s3://bucket/reports/",
+				"https://example.com/report.pdf",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			wizard := &downloadWizard{formatter: ui.NewFormatter().
+				WithColor(false).
+				WithInteractive(true).
+				WithReader(strings.NewReader(strings.Join(tt.answers, "\n") + "\n")).
+				WithWriter(&output)}
+
+			got, err := wizard.run()
+			if err != nil {
+				t.Fatalf("run() error = %v\noutput:\n%s", err, output.String())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadWizardEOF(t *testing.T) {
+	wizard := &downloadWizard{formatter: ui.NewFormatter().
+		WithInteractive(true).
+		WithReader(strings.NewReader("https://example.com/file.zip\n")).
+		WithWriter(io.Discard)}
+
+	if _, err := wizard.run(); err == nil {
+		t.Error("run() should fail when the input ends early")
+	}
+}
+
+func TestFormatCommandLine(t *testing.T) {
+	got := formatCommandLine([]string{
+		"gdl", "-H", "Authorization: Bearer it's", "--max-rate", "2MB/s", "https://example.com/a.zip?x=1&y=2",
+	})
+	want := `gdl -H 'Authorization: Bearer it'\''s' --max-rate 2MB/s 'https://example.com/a.zip?x=1&y=2'`
+
+	if got != want {
+		t.Errorf("formatCommandLine() = %s, want %s", got, want)
+	}
+}
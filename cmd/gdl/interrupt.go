@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+// interruptExitCode is the exit code of a run stopped by a signal, or 0 while
+// no signal has been received.
+var interruptExitCode atomic.Int32
+
+// recordInterruption records that the run is being stopped by sig. The exit
+// code is 128 plus the signal's number, as shells report it: 130 for SIGINT
+// and 143 for SIGTERM.
+func recordInterruption(sig os.Signal) int {
+	code := 130
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+
+	interruptExitCode.Store(int32(code))
+
+	return code
+}
+
+// interruptedExitCode returns the exit code of a run whose context ctx was
+// cancelled by a signal, or 0 when it was not.
+func interruptedExitCode(ctx context.Context) int {
+	if ctx.Err() == nil {
+		return 0
+	}
+
+	return int(interruptExitCode.Load())
+}
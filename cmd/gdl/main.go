@@ -6,24 +6,35 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/cas"
+	"github.com/forest6511/gdl/internal/checksum"
 	"github.com/forest6511/gdl/internal/core"
 	"github.com/forest6511/gdl/internal/network"
 	"github.com/forest6511/gdl/internal/retry"
 	"github.com/forest6511/gdl/internal/storage"
 	"github.com/forest6511/gdl/pkg/cli"
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/middleware"
+	"github.com/forest6511/gdl/pkg/pathtemplate"
 	"github.com/forest6511/gdl/pkg/plugin"
 	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/rules"
+	"github.com/forest6511/gdl/pkg/secrets"
 	"github.com/forest6511/gdl/pkg/types"
 	"github.com/forest6511/gdl/pkg/ui"
+	"github.com/forest6511/gdl/pkg/urlglob"
+	"github.com/forest6511/gdl/pkg/validation"
 )
 
 // Version information.
@@ -34,35 +45,112 @@ const (
 
 // CLI configuration.
 type config struct {
-	output            string
-	userAgent         string
-	timeout           time.Duration
-	overwrite         bool
-	createDirs        bool
-	resume            bool
-	showVersion       bool
-	showHelp          bool
-	quiet             bool
-	verbose           bool
-	concurrent        int
-	chunkSize         string
-	noConcurrent      bool
-	noColor           bool
-	interactive       bool
-	checkConnectivity bool
-	checkSpace        bool
-	language          string
-	progressBar       string
-	noResume          bool
-	retry             int
-	retryDelay        time.Duration
-	headers           map[string]string
-	maxRedirects      int
-	insecure          bool
-	proxy             string
-	output_format     string
-	continuePartial   bool
-	maxRate           string // Maximum download rate (e.g., "1MB/s", "500k")
+	output             string
+	userAgent          string
+	userAgentSet       bool // --user-agent was given
+	timeout            time.Duration
+	overwrite          bool
+	createDirs         bool
+	resume             bool
+	resumeValidation   string // What to do when the file changed before resuming
+	showVersion        bool
+	showHelp           bool
+	quiet              bool
+	verbose            bool
+	concurrent         int
+	concurrentSet      bool // --concurrent or -c was given
+	chunkSize          string
+	noConcurrent       bool
+	noColor            bool
+	interactive        bool
+	checkConnectivity  bool
+	checkSpace         bool
+	language           string
+	progressBar        string
+	noResume           bool
+	retry              int
+	retryDelay         time.Duration
+	retryBackoff       string
+	retryMaxTime       time.Duration
+	headers            map[string]string
+	credentialHelper   string // Command credentials are asked from, git-credential style
+	rules              *rules.Engine
+	maxRedirects       int
+	referer            string // Referer header, unless -H sets one
+	compressed         bool   // Ask for a compressed response and decode it
+	failWithBody       bool   // Save the body of an HTTP error response to the output
+	errorBodies        *errorBodyRecorder
+	insecure           bool
+	caCert             string
+	clientCert         string
+	clientKey          string
+	pinnedPubKey       string
+	proxy              string
+	httpProxy          string
+	httpsProxy         string
+	noProxy            string
+	proxyUser          string
+	dnsServers         string
+	dohURL             string
+	ipv4               bool
+	ipv6               bool
+	resolve            map[string]string
+	output_format      string
+	eventsFile         string
+	traceFile          string // Where --trace and --trace-ascii write, "-" for stderr
+	harFile            string // Where the HAR log of the session is saved
+	har                *middleware.HARRecorder
+	traceBodies        bool // Show the start of bodies in the trace
+	continuePartial    bool
+	timestamping       bool
+	byteRange          string // Byte range to download (e.g., "bytes=0-1048575")
+	method             string // HTTP method of the download request
+	outputTemplate     string // Output path template such as "{host}/{path}/{filename}"
+	data               string // Request body, or @FILE to send a file
+	ifExists           string // Collision policy for an existing output file
+	globOff            bool   // Do not expand [] and {} in the URL
+	expandDryRun       bool   // Print the expanded URLs instead of downloading
+	dryRun             bool   // Report what would be downloaded instead of downloading
+	noAtomic           bool
+	tempDir            string
+	noRemoteTime       bool     // Keep the download time as the file's mtime
+	chmod              string   // Permission bits of the completed file, in octal
+	xattr              bool     // Record the source URL and SHA-256 in xattrs
+	mirrors            []string // Other URLs serving the same file
+	tee                []string // Other destinations written in the same pass
+	mirrorStrategy     string   // Which mirrors to use: ordered, fastest or random
+	maxMirrors         int      // Mirrors used at most (0 = all)
+	streamOrder        bool     // Fetch pieces from the beginning of the file first
+	perHost            int      // Requests in flight to one host (0 = unlimited)
+	hostDelay          time.Duration
+	circuitBreaker     int           // Consecutive failures that stop requests to a host (0 = off)
+	circuitCooldown    time.Duration // How long a host is skipped before it is tried again
+	circuitBreakerSet  bool
+	circuitCooldownSet bool
+	directIO           bool
+	writeBuffer        string
+	cacheDir           string
+	noCache            bool
+	contentStore       string
+	contentSHA256      string
+	contentStoreLink   bool
+	quota              string // Maximum total size of the quota directory
+	quotaDir           string
+	quotaPolicy        string
+	checksum           string // Expected digest of the download
+	checksumAlgo       string
+	signature          string // Detached OpenPGP signature (path or URL)
+	keyring            string
+	clamd              string // ClamAV daemon address for scanning downloads
+	scanCmd            string // Scanner command run on completed downloads
+	quarantineDir      string // Quarantine flagged files here instead of deleting them
+	recompress         string // Store the download in this compression codec
+	zsync              string // zsync control file (path, URL or "auto")
+	zsyncSeed          string // Local file blocks are reused from
+	maxRate            string // Maximum download rate (e.g., "1MB/s", "500k")
+	minRate            string // Minimum transfer rate before a download is aborted
+	minRateTime        time.Duration
+	minFreeSpace       string // Free space to keep on the destination filesystem
 	// Plugin-related configurations
 	plugins      []string
 	storageURL   string
@@ -92,22 +180,43 @@ type progressDisplay struct {
 	filename  string
 	totalSize int64
 	lastLine  string
+
+	// expectedSize is the size queried before the download, shown while
+	// the server has not sent one.
+	expectedSize int64
+
 	formatter *ui.Formatter
 	startTime time.Time
 	cfg       *config
+	segments  []types.Segment // Latest segment map of a chunked download
+
+	// lines writes progress as whole lines when stdout is not a terminal
+	lines func(bytesDownloaded, totalBytes int64, speed int64)
 }
 
 func newProgressDisplay(cfg *config, fmt *ui.Formatter) *progressDisplay {
-	return &progressDisplay{
+	p := &progressDisplay{
 		quiet:     cfg.quiet,
 		verbose:   cfg.verbose,
 		formatter: fmt,
 		startTime: time.Now(),
 		cfg:       cfg,
 	}
+
+	if !isTerminal() {
+		p.lines = lineProgress(os.Stdout)
+	}
+
+	return p
 }
 
 func (p *progressDisplay) Start(filename string, totalSize int64) {
+	if totalSize <= 0 {
+		totalSize = p.expectedSize
+	}
+
+	currentStatus.start(filename, totalSize)
+
 	if p.quiet {
 		return
 	}
@@ -129,10 +238,21 @@ func (p *progressDisplay) Start(filename string, totalSize int64) {
 }
 
 func (p *progressDisplay) Update(bytesDownloaded, totalSize int64, speed int64) {
+	if totalSize <= 0 {
+		totalSize = p.expectedSize
+	}
+
+	currentStatus.update(bytesDownloaded, totalSize, speed)
+
 	if p.quiet {
 		return
 	}
 
+	if p.lines != nil && p.cfg.progressBar != "json" {
+		p.lines(bytesDownloaded, totalSize, speed)
+		return
+	}
+
 	switch p.cfg.progressBar {
 	case "simple":
 		p.displaySimpleProgress(bytesDownloaded, totalSize, speed)
@@ -143,6 +263,7 @@ func (p *progressDisplay) Update(bytesDownloaded, totalSize int64, speed int64)
 			ShowSpeed:      speed > 0,
 			ShowETA:        speed > 0 && totalSize > 0,
 			ShowSize:       true,
+			Segments:       p.segments,
 		}
 
 		p.formatter.ClearLine()
@@ -158,6 +279,13 @@ func (p *progressDisplay) Update(bytesDownloaded, totalSize int64, speed int64)
 	}
 }
 
+// UpdateSegments keeps the segment map of a chunked download, which the
+// detailed progress bar shows in place of the plain bar.
+func (p *progressDisplay) UpdateSegments(segments []types.Segment) {
+	p.segments = segments
+	currentStatus.updateSegments(segments)
+}
+
 func (p *progressDisplay) displayProgressBar(bytesDownloaded, totalSize int64, speed int64) {
 	percentage := float64(bytesDownloaded) / float64(totalSize) * 100
 
@@ -244,6 +372,8 @@ func (p *progressDisplay) displaySimpleProgress(bytesDownloaded, totalSize int64
 }
 
 func (p *progressDisplay) Finish(filename string, stats *types.DownloadStats) {
+	currentStatus.stop()
+
 	if p.quiet {
 		return
 	}
@@ -266,12 +396,22 @@ func (p *progressDisplay) Finish(filename string, stats *types.DownloadStats) {
 			table.AddRow([]string{"Retries", fmt.Sprintf("%d", stats.Retries)})
 		}
 
+		if stats.RangeViolations > 0 {
+			violations := fmt.Sprintf("%d", stats.RangeViolations)
+			if stats.RangeFallback {
+				violations += " (fell back to a single stream)"
+			}
+			table.AddRow([]string{"Range Violations", violations})
+		}
+
 		p.formatter.PrintMessage(ui.MessageInfo, "Download Statistics:")
 		fmt.Println(table.Format())
 	}
 }
 
 func (p *progressDisplay) Error(filename string, err error) {
+	currentStatus.stop()
+
 	if p.quiet {
 		return
 	}
@@ -286,6 +426,7 @@ func (p *progressDisplay) Error(filename string, err error) {
 		ShowSuggestions: true,
 		ShowTimestamp:   p.verbose,
 		MultiLine:       true,
+		ShowResponse:    p.verbose,
 	}
 
 	formattedError := p.formatter.FormatError(err, errorOptions)
@@ -302,12 +443,15 @@ func createProgressCallback(quiet bool) func(bytesDownloaded, totalBytes int64,
 		return nil
 	}
 
-	useAnsiBar := isTerminal()
+	// Redirected output gets whole lines rather than a redrawn bar
+	if !isTerminal() {
+		return lineProgress(os.Stdout)
+	}
 
 	var lastLine string
 
 	return func(bytesDownloaded, totalBytes int64, speed int64) {
-		if useAnsiBar && totalBytes > 0 {
+		if totalBytes > 0 {
 			displayEnhancedProgressBar(bytesDownloaded, totalBytes, speed, &lastLine)
 		} else {
 			displaySimpleProgressCallback(bytesDownloaded, totalBytes, speed)
@@ -315,8 +459,7 @@ func createProgressCallback(quiet bool) func(bytesDownloaded, totalBytes int64,
 	}
 }
 
-func buildProgressBar(percentage float64) string {
-	barWidth := 30
+func buildProgressBar(percentage float64, barWidth int) string {
 	filled := int(percentage / 100.0 * float64(barWidth))
 	bar := "["
 
@@ -394,14 +537,16 @@ func displayEnhancedProgressBar(bytesDownloaded, totalBytes int64, speed int64,
 		fmt.Print("\r\033[K")
 	}
 
-	// Build progress bar
-	bar := buildProgressBar(percentage)
-
 	// Calculate ETA
 	eta := calculateETA(speed, totalBytes, bytesDownloaded)
 
-	// Format the complete progress line
-	progress := buildProgressLine(bar, percentage, bytesDownloaded, totalBytes, speed, eta)
+	// Format the complete progress line, with a bar sized to fit the
+	// terminal so that redrawing it doesn't wrap
+	progress := strings.TrimPrefix(buildProgressLine("", percentage, bytesDownloaded, totalBytes, speed, eta), " ")
+	if barWidth := progressBarWidth(len(progress)); barWidth > 0 {
+		bar := buildProgressBar(percentage, barWidth)
+		progress = buildProgressLine(bar, percentage, bytesDownloaded, totalBytes, speed, eta)
+	}
 
 	// Add color coding
 	progress = addProgressColor(progress, percentage)
@@ -428,23 +573,18 @@ func displaySimpleProgressCallback(bytesDownloaded, totalBytes int64, speed int6
 	fmt.Printf("\r%s", progress)
 }
 
-// isTerminal checks if stdout is connected to a terminal.
-func isTerminal() bool {
-	// Simple check for terminal - in a real implementation, you might want to use
-	// a library like "golang.org/x/term" or check for specific environment variables
-	return os.Getenv("TERM") != "" && os.Getenv("CI") == ""
-}
-
 // initializeFormatter sets up the global formatter with configuration.
 func initializeFormatter(cfg *config) {
-	language := ui.LanguageEnglish
-	switch cfg.language {
-	case "ja":
-		language = ui.LanguageJapanese
-	case "es":
-		language = ui.LanguageSpanish
-	case "fr":
-		language = ui.LanguageFrench
+	catalog := ui.DefaultCatalog()
+	if err := catalog.LoadDir(ui.DefaultLocaleDir()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	language := ui.ParseLanguage(cfg.language)
+	if cfg.language == "" || cfg.language == "auto" {
+		language = catalog.Detect()
+	} else if !catalog.Supports(language) {
+		language = ui.LanguageEnglish
 	}
 
 	formatter = ui.NewFormatter().
@@ -515,7 +655,7 @@ func performDiskSpaceCheck(outputFile string, estimatedSize uint64, cfg *config)
 			} else {
 				return gdlerrors.NewDownloadError(gdlerrors.CodeInsufficientSpace, "insufficient disk space")
 			}
-		} else {
+		} else if cfg.verbose {
 			formatter.PrintMessage(ui.MessageSuccess, "Sufficient disk space available")
 		}
 	}
@@ -629,10 +769,20 @@ func validateAndPrepareDownload(cfg *config, url string) (string, error) {
 	outputFile := cfg.output
 	if outputFile == "" {
 		outputFile = extractFilenameFromURL(url)
+		if cfg.recompress != "" {
+			outputFile = plugin.RecompressedName(outputFile, cfg.recompress)
+		}
+	} else if pathtemplate.Has(outputFile) {
+		var err error
+		if outputFile, err = gdl.ExpandOutputTemplate(context.Background(), outputFile, url); err != nil {
+			formatter.PrintMessage(ui.MessageError, "Invalid output template: %v", err)
+			return "", err
+		}
 	}
 
 	// Interactive confirmation for output file if needed
-	if cfg.interactive && !cfg.overwrite {
+	if cfg.interactive && !cfg.dryRun && !cfg.overwrite && !cfg.resume && !cfg.timestamping && cfg.ifExists == "" &&
+		cfg.zsync == "" && outputFile != stdoutOutput {
 		if _, err := os.Stat(outputFile); err == nil {
 			proceed, err := formatter.ConfirmPrompt(
 				fmt.Sprintf("File '%s' already exists. Overwrite?", outputFile),
@@ -665,9 +815,80 @@ func setupDownloaders(ctx context.Context, cfg *config) (*gdl.Downloader, *core.
 		}
 	}
 
+	// Serve unchanged files from the response cache
+	if cacheEnabled(cfg) {
+		cache, err := middleware.NewDiskCache(cfg.cacheDir, 0)
+		if err != nil {
+			return nil, nil, gdlerrors.WrapError(err, gdlerrors.CodeConfigError, "cache setup failed")
+		}
+		downloader.UseMiddleware(middleware.CacheMiddleware(cache, 0))
+	}
+
+	// Transcode the compression of downloads as they stream in
+	if cfg.recompress != "" {
+		recompressor, err := plugin.NewRecompressor(cfg.recompress)
+		if err != nil {
+			return nil, nil, gdlerrors.WrapError(err, gdlerrors.CodeConfigError, "recompression setup failed")
+		}
+		downloader.UseTransform(recompressor)
+	}
+
 	// Create core downloader for backwards compatibility
 	coreDownloader := core.NewDownloader()
 
+	// Add the headers of the config file's rules to each request
+	if cfg.rules != nil {
+		coreDownloader.Use(cfg.rules.Middleware())
+		downloader.UseRequestMiddleware(cfg.rules.Middleware())
+	}
+
+	// Ask the credential helper once per host for the whole session
+	if cfg.credentialHelper != "" {
+		helper := secrets.NewHelper(cfg.credentialHelper)
+		coreDownloader.Use(helper.Middleware())
+		downloader.UseRequestMiddleware(helper.Middleware())
+	}
+
+	// Keep the body of error responses for --fail-with-body, decoded
+	if cfg.failWithBody {
+		cfg.errorBodies = &errorBodyRecorder{}
+		coreDownloader.Use(cfg.errorBodies.middleware())
+		downloader.UseRequestMiddleware(cfg.errorBodies.middleware())
+	}
+
+	if cfg.compressed {
+		coreDownloader.Use(middleware.RequestCompressionMiddleware())
+		downloader.UseRequestMiddleware(middleware.RequestCompressionMiddleware())
+	}
+
+	// http.Client stops after 10 redirects by itself
+	if cfg.maxRedirects < 10 {
+		coreDownloader.Use(middleware.RequestRedirectLimitMiddleware(cfg.maxRedirects))
+		downloader.UseRequestMiddleware(middleware.RequestRedirectLimitMiddleware(cfg.maxRedirects))
+	}
+
+	// Record the session for --har, writing an empty log first so that an
+	// unwritable path fails before downloading
+	if cfg.harFile != "" {
+		cfg.har = middleware.NewHARRecorder(&middleware.HAROptions{Version: version})
+		if err := cfg.har.Save(cfg.harFile); err != nil {
+			return nil, nil, gdlerrors.NewConfigError("cannot write the HAR file", err, cfg.harFile)
+		}
+		coreDownloader.Use(cfg.har.Middleware())
+		downloader.UseRequestMiddleware(cfg.har.Middleware())
+	}
+
+	// Trace last, so the trace shows the requests as they are sent
+	if cfg.traceFile != "" {
+		w, err := openTraceWriter(cfg.traceFile)
+		if err != nil {
+			return nil, nil, gdlerrors.NewConfigError("cannot open the trace file", err, cfg.traceFile)
+		}
+		trace := middleware.RequestTraceMiddleware(w, &middleware.TraceOptions{Bodies: cfg.traceBodies})
+		coreDownloader.Use(trace)
+		downloader.UseRequestMiddleware(trace)
+	}
+
 	// Configure retry strategy
 	coreDownloader.WithRetryStrategy(
 		retry.NewRetryManager().
@@ -678,21 +899,106 @@ func setupDownloaders(ctx context.Context, cfg *config) (*gdl.Downloader, *core.
 	return downloader, coreDownloader, nil
 }
 
+// saveHAR writes the HAR log of the session, if --har asked for one.
+func saveHAR(cfg *config) {
+	if cfg.har == nil {
+		return
+	}
+
+	if err := cfg.har.Save(cfg.harFile); err != nil {
+		formatter.PrintMessage(ui.MessageWarning, "Failed to write the HAR file: %v", err)
+		return
+	}
+
+	if cfg.verbose {
+		formatter.PrintMessage(ui.MessageInfo, "Recorded %d requests to %s", cfg.har.Len(), cfg.harFile)
+	}
+}
+
 func createDownloadOptions(cfg *config) *types.DownloadOptions {
 	options := &types.DownloadOptions{
 		UserAgent:          cfg.userAgent,
 		Timeout:            cfg.timeout,
 		OverwriteExisting:  cfg.overwrite,
+		CollisionPolicy:    cfg.ifExists,
 		CreateDirs:         cfg.createDirs,
+		OnlyIfNewer:        cfg.timestamping,
+		AtomicWrite:        !cfg.noAtomic,
+		TempDir:            cfg.tempDir,
+		KeepDownloadTime:   cfg.noRemoteTime,
+		Xattrs:             cfg.xattr,
+		Mirrors:            cfg.mirrors,
+		MirrorStrategy:     cfg.mirrorStrategy,
+		MaxMirrors:         cfg.maxMirrors,
+		StreamOrder:        cfg.streamOrder,
+		DirectIO:           cfg.directIO,
 		Resume:             cfg.resume && !cfg.noResume,
+		ResumeValidation:   cfg.resumeValidation,
 		Progress:           newProgressDisplay(cfg, formatter),
 		ProgressCallback:   createProgressCallback(cfg.quiet),
 		Headers:            cfg.headers,
 		MaxRedirects:       cfg.maxRedirects,
 		InsecureSkipVerify: cfg.insecure,
-		ProxyURL:           cfg.proxy,
+		HostCache:          hostCacheFile(),
+	}
+
+	if cfg.perHost > 0 || cfg.hostDelay > 0 {
+		options.HostLimits = &types.HostLimitPolicy{MaxConnections: cfg.perHost, Delay: cfg.hostDelay}
+	}
+
+	if cfg.circuitBreaker > 0 {
+		options.CircuitBreaker = &types.CircuitBreakerPolicy{
+			FailureThreshold: cfg.circuitBreaker,
+			Cooldown:         cfg.circuitCooldown,
+		}
+	}
+
+	// Already validated by parseArgs
+	if cfg.byteRange != "" {
+		options.ByteRange, _ = types.ParseByteRange(cfg.byteRange)
+	}
+
+	// Send the request body, as a POST unless another method is given
+	options.Method = cfg.method
+	if cfg.data != "" {
+		if bodyFile, ok := strings.CutPrefix(cfg.data, "@"); ok {
+			options.BodyFile = bodyFile
+		} else {
+			options.Body = []byte(cfg.data)
+		}
+
+		if options.Method == "" {
+			options.Method = http.MethodPost
+		}
+	}
+
+	// Configure proxies
+	options.Proxy = createProxyConfig(cfg)
+
+	// Configure TLS verification and client certificates
+	options.TLS = createTLSOptions(cfg)
+
+	// Configure download deduplication
+	options.ContentStore = createContentStoreOptions(cfg)
+	options.Quota = createQuotaOptions(cfg)
+
+	// Configure checksum verification
+	options.Checksum = cfg.checksum
+	options.ChecksumAlgorithm = cfg.checksumAlgo
+
+	// Configure signature verification
+	if cfg.signature != "" {
+		options.Signature = &types.SignatureOptions{Signature: cfg.signature, Keyring: cfg.keyring}
 	}
 
+	// Configure delta updates
+	if cfg.zsync != "" {
+		options.Delta = &types.DeltaOptions{Control: cfg.zsync, Seed: cfg.zsyncSeed}
+	}
+
+	// Configure malware scanning
+	options.Scan = createScanOptions(cfg)
+
 	// Configure concurrent download options
 	if cfg.noConcurrent {
 		options.MaxConcurrency = 1
@@ -700,6 +1006,12 @@ func createDownloadOptions(cfg *config) *types.DownloadOptions {
 		options.MaxConcurrency = cfg.concurrent
 	}
 
+	// Configure retry backoff
+	options.Backoff = createBackoffPolicy(cfg)
+
+	// Configure name resolution
+	options.DNS = createDNSOptions(cfg)
+
 	// Configure chunk size if specified
 	if cfg.chunkSize != autoValue {
 		if chunkSizeBytes, err := parseSize(cfg.chunkSize); err == nil {
@@ -707,6 +1019,13 @@ func createDownloadOptions(cfg *config) *types.DownloadOptions {
 		}
 	}
 
+	// Configure the write buffer if specified
+	if cfg.writeBuffer != "" {
+		if writeBufferBytes, err := parseSize(cfg.writeBuffer); err == nil {
+			options.WriteBufferSize = int(writeBufferBytes)
+		}
+	}
+
 	// Configure max rate if specified
 	if cfg.maxRate != "" {
 		if maxRateBytes, err := ratelimit.ParseRate(cfg.maxRate); err == nil {
@@ -717,29 +1036,225 @@ func createDownloadOptions(cfg *config) *types.DownloadOptions {
 		}
 	}
 
+	// Configure slow transfer detection if specified
+	if cfg.minRate != "" {
+		if minRateBytes, err := ratelimit.ParseRate(cfg.minRate); err == nil {
+			options.MinSpeed = minRateBytes
+		}
+	}
+
+	options.StallTimeout = cfg.minRateTime
+
+	// Configure the free space to keep while downloading
+	if cfg.minFreeSpace != "" {
+		if minFreeBytes, err := parseSize(cfg.minFreeSpace); err == nil {
+			options.MinFreeSpace = minFreeBytes
+		}
+	}
+
+	// Configure the permission bits of the completed file
+	if cfg.chmod != "" {
+		if mode, err := parseFileMode(cfg.chmod); err == nil {
+			options.FileMode = mode
+		}
+	}
+
+	return options
+}
+
+// createDNSOptions builds the name resolution options from the CLI flags.
+// It returns nil when the system resolver should be used.
+func createDNSOptions(cfg *config) *types.DNSOptions {
+	dns := &types.DNSOptions{
+		DoHURL:  cfg.dohURL,
+		Resolve: cfg.resolve,
+	}
+
+	for _, server := range strings.Split(cfg.dnsServers, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			dns.Servers = append(dns.Servers, server)
+		}
+	}
+
+	switch {
+	case cfg.ipv4:
+		dns.IPVersion = 4
+	case cfg.ipv6:
+		dns.IPVersion = 6
+	}
+
+	if len(dns.Servers) == 0 && dns.DoHURL == "" && dns.IPVersion == 0 && len(dns.Resolve) == 0 {
+		return nil
+	}
+
+	return dns
+}
+
+// createTLSOptions builds the TLS options from the CLI flags, returning nil when none is set.
+func createTLSOptions(cfg *config) *types.TLSOptions {
+	if cfg.caCert == "" && cfg.clientCert == "" && cfg.clientKey == "" && cfg.pinnedPubKey == "" {
+		return nil
+	}
+
+	return &types.TLSOptions{
+		CAFile:           cfg.caCert,
+		CertFile:         cfg.clientCert,
+		KeyFile:          cfg.clientKey,
+		PinnedPublicKeys: network.ParsePinnedPublicKeys(cfg.pinnedPubKey),
+	}
+}
+
+// createContentStoreOptions builds the deduplication options from the CLI flags,
+// returning nil when no content store is configured.
+func createContentStoreOptions(cfg *config) *types.ContentStoreOptions {
+	if cfg.contentStore == "" {
+		return nil
+	}
+
+	return &types.ContentStoreOptions{
+		Dir:      cfg.contentStore,
+		SHA256:   cfg.contentSHA256,
+		HardLink: cfg.contentStoreLink,
+	}
+}
+
+// createQuotaOptions builds the directory quota from the CLI flags, returning
+// nil when no quota is set.
+func createQuotaOptions(cfg *config) *types.QuotaOptions {
+	if cfg.quota == "" {
+		return nil
+	}
+
+	maxSize, err := parseSize(cfg.quota)
+	if err != nil {
+		return nil
+	}
+
+	return &types.QuotaOptions{
+		Dir:     cfg.quotaDir,
+		MaxSize: maxSize,
+		Policy:  cfg.quotaPolicy,
+	}
+}
+
+// createScanOptions builds the malware scan options from the CLI flags,
+// returning nil when no scanner is set.
+func createScanOptions(cfg *config) *types.ScanOptions {
+	if cfg.clamd == "" && cfg.scanCmd == "" {
+		return nil
+	}
+
+	options := &types.ScanOptions{
+		Clamd:   cfg.clamd,
+		Command: cfg.scanCmd,
+		Action:  types.ScanActionDelete,
+	}
+
+	if cfg.quarantineDir != "" {
+		options.Action = types.ScanActionQuarantine
+		options.QuarantineDir = cfg.quarantineDir
+	}
+
 	return options
 }
 
-func performAppropriateDownload(ctx context.Context, downloader *gdl.Downloader, coreDownloader *core.Downloader, url, outputFile string, options *types.DownloadOptions, cfg *config) error {
+// createProxyConfig builds the proxy configuration from the CLI flags. It returns
+// nil when no proxy flag is set, so the proxy environment variables apply.
+func createProxyConfig(cfg *config) *types.ProxyConfig {
+	proxy := &types.ProxyConfig{
+		URL:      cfg.proxy,
+		HTTPURL:  cfg.httpProxy,
+		HTTPSURL: cfg.httpsProxy,
+	}
+
+	for _, host := range strings.Split(cfg.noProxy, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			proxy.NoProxy = append(proxy.NoProxy, host)
+		}
+	}
+
+	if cfg.proxyUser != "" {
+		user, password, _ := strings.Cut(cfg.proxyUser, ":")
+		proxy.Username = user
+		proxy.Password = password
+	}
+
+	if proxy.URL == "" && proxy.HTTPURL == "" && proxy.HTTPSURL == "" &&
+		len(proxy.NoProxy) == 0 && proxy.Username == "" {
+		return nil
+	}
+
+	return proxy
+}
+
+// createBackoffPolicy builds the retry backoff policy from the CLI flags.
+func createBackoffPolicy(cfg *config) *types.BackoffPolicy {
+	policy := &types.BackoffPolicy{
+		InitialDelay:   cfg.retryDelay,
+		MaxDelay:       defaultRetryMaxDelay,
+		Multiplier:     2.0,
+		Jitter:         true,
+		MaxElapsedTime: cfg.retryMaxTime,
+	}
+
+	if cfg.retryBackoff == retryBackoffConstant {
+		policy.MaxDelay = cfg.retryDelay
+		policy.Multiplier = 1.0
+		policy.Jitter = false
+	}
+
+	return policy
+}
+
+func performAppropriateDownload(ctx context.Context, downloader *gdl.Downloader, coreDownloader *core.Downloader, url, outputFile string, options *types.DownloadOptions, cfg *config) (*types.DownloadStats, error) {
+	// Stream to stdout without touching the filesystem
+	if outputFile == stdoutOutput {
+		return performStdoutDownload(ctx, coreDownloader, url, options, cfg)
+	}
+
+	if len(cfg.tee) > 0 {
+		return performTeeDownload(ctx, coreDownloader, url, outputFile, options, cfg)
+	}
+
 	// Use enhanced downloader for plugin-aware downloads
-	if len(cfg.plugins) > 0 || cfg.storageURL != "" {
+	if len(cfg.plugins) > 0 || cfg.storageURL != "" || cacheEnabled(cfg) || cfg.recompress != "" {
 		return performEnhancedDownload(ctx, downloader, url, outputFile, options, cfg)
 	} else {
 		return performDownload(ctx, coreDownloader, url, outputFile, options, cfg)
 	}
 }
 
+// cacheEnabled reports whether downloads go through the response cache.
+func cacheEnabled(cfg *config) bool {
+	return cfg.cacheDir != "" && !cfg.noCache
+}
+
 func run(args []string) int {
 	// Save and restore original args for testing
 	origArgs := os.Args
 	defer func() { os.Args = origArgs }()
 	os.Args = args
 
-	// Check for plugin subcommands first
-	if len(args) > 1 && args[1] == "plugin" {
-		return runPluginCommand(args[2:])
+	globals, rest := splitGlobalFlags(args[1:])
+	if len(rest) > 0 {
+		if cmd, ok := findCommand(rest[0]); ok {
+			if cmd.name == "get" {
+				return runGetCommand(append(globals, rest[1:]...))
+			}
+
+			applyGlobalFlags(globals)
+
+			return cmd.run(rest[1:])
+		}
 	}
 
+	// Without a command, "gdl [options] URL" is "gdl get [options] URL"
+	return runGetCommand(args[1:])
+}
+
+// runDownload parses the download flags from os.Args and downloads the URL,
+// or the URLs a pattern expands to.
+func runDownload() int {
 	// Parse command line arguments
 	cfg, url, err := parseArgs()
 	if err != nil {
@@ -755,18 +1270,28 @@ func run(args []string) int {
 		return exitCode
 	}
 
+	// Expand URL sequences and sets into a batch of downloads
+	if cfg.expandDryRun || (!cfg.globOff && urlglob.HasGlob(url)) {
+		return runExpandedDownload(cfg, url)
+	}
+
 	// Validate and prepare download
 	outputFile, err := validateAndPrepareDownload(cfg, url)
 	if err != nil {
 		return 1
 	}
 
+	if cfg.dryRun {
+		return runDryRun(cfg, []dryRunFile{{url: url, destination: outputFile, size: -1}})
+	}
+
 	// Create context for cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Set up enhanced signal handling
 	handleInterruption(ctx, cancel, cfg)
+	handleStatusRequests(ctx, os.Stderr)
 
 	// Set up downloaders
 	downloader, coreDownloader, err := setupDownloaders(ctx, cfg)
@@ -774,21 +1299,132 @@ func run(args []string) int {
 		formatter.PrintMessage(ui.MessageError, "Downloader setup failed: %v", err)
 		return 1
 	}
+	defer saveHAR(cfg)
+
+	// Switch to a machine-readable event stream or result if requested
+	var eventsWriter io.Writer
+	if wantsEventsWriter(cfg) {
+		writer, closeEvents, err := openEventsWriter(cfg.eventsFile)
+		if err != nil {
+			formatter.PrintMessage(ui.MessageError, "Failed to open events file: %v", err)
+			return 1
+		}
+		defer closeEvents()
+
+		eventsWriter = writer
+	}
+
+	if err := downloadAndReport(ctx, downloader, coreDownloader, cfg, url, outputFile, eventsWriter); err != nil {
+		if code := interruptedExitCode(ctx); code != 0 {
+			if !cfg.quiet && outputFile != stdoutOutput {
+				formatter.PrintMessage(ui.MessageInfo, "Partial download kept; run the command again with --resume to continue it")
+			}
+
+			return code
+		}
+
+		return 1
+	}
+
+	return 0
+}
+
+// downloadAndReport downloads url to outputFile and reports the outcome. If
+// eventsWriter is not nil, it also receives the NDJSON event stream or, with
+// --output-format json, the result document.
+func downloadAndReport(
+	ctx context.Context,
+	downloader *gdl.Downloader,
+	coreDownloader *core.Downloader,
+	cfg *config,
+	url, outputFile string,
+	eventsWriter io.Writer,
+) error {
+	cfg = applyRules(cfg, url)
+
+	// An error response of an earlier URL is not this one's
+	if cfg.errorBodies != nil {
+		cfg.errorBodies.take()
+	}
 
 	// Set up download options
 	options := createDownloadOptions(cfg)
 
+	var events *ndjsonEmitter
+	if eventsWriter != nil && cfg.output_format == outputFormatNDJSON {
+		events = newNDJSONEmitter(eventsWriter, url, outputFile)
+		options.Progress = events
+		options.ProgressCallback = events.emitProgress
+		options.RetryCallback = events.emitRetry
+		events.emitStart()
+	}
+
+	// Query the file's size for the checks, connection count and progress
+	if err := preflight(ctx, coreDownloader, cfg, url, outputFile, options); err != nil {
+		if events != nil {
+			events.emitError(err, nil)
+		}
+		writeResult(eventsWriter, cfg, url, outputFile, nil, "", err)
+
+		handleError(err, cfg)
+		return err
+	}
+
 	// Perform download
-	if err := performAppropriateDownload(ctx, downloader, coreDownloader, url, outputFile, options, cfg); err != nil {
+	stats, err := performAppropriateDownload(ctx, downloader, coreDownloader, url, outputFile, options, cfg)
+	if err != nil {
+		if events != nil {
+			events.emitError(err, stats)
+		}
+		writeResult(eventsWriter, cfg, url, outputFile, stats, "", err)
+		saveErrorBody(cfg, outputFile, err)
+
 		handleError(err, cfg)
-		return 1
+		return err
+	}
+
+	// --if-exists=rename may have chosen another name
+	if stats != nil && stats.Filename != "" && cfg.ifExists == types.CollisionRename {
+		outputFile = stats.Filename
+	}
+
+	checksum := downloadChecksum(cfg, outputFile, stats)
+
+	if events != nil {
+		events.emitComplete(stats)
+	}
+	writeResult(eventsWriter, cfg, url, outputFile, stats, checksum, nil)
+
+	// Content reused from the content store was not downloaded
+	if stats != nil && !stats.Deduplicated {
+		recordUsage(url, stats.BytesDownloaded, stats.Duration)
+	}
+
+	if outputFile != stdoutOutput && wantsHistory(stats) {
+		recordHistory(url, outputFile, max(stats.TotalSize, stats.BytesDownloaded), checksum)
 	}
 
 	if !cfg.quiet {
-		formatter.PrintMessage(ui.MessageSuccess, "Successfully downloaded to: %s", outputFile)
+		if stats != nil && stats.NotModified {
+			formatter.PrintMessage(ui.MessageInfo, "Server file not newer than %s, not downloading", outputFile)
+		} else if stats != nil && stats.Skipped {
+			formatter.PrintMessage(ui.MessageInfo, "File %s already exists, skipped", outputFile)
+		} else if stats != nil && stats.Deduplicated {
+			formatter.PrintMessage(ui.MessageSuccess, "Reused identical content from the content store: %s", outputFile)
+		} else if stats != nil && stats.DeltaReused > 0 {
+			formatter.PrintMessage(ui.MessageSuccess, "Updated %s: reused %s, downloaded %s", outputFile,
+				formatBytes(stats.DeltaReused), formatBytes(stats.BytesDownloaded))
+		} else {
+			formatter.PrintMessage(ui.MessageSuccess, "Successfully downloaded to: %s", outputFile)
+		}
+
+		if cfg.verbose && stats != nil {
+			printTransferPlan(stats.Plan, stats.BytesDownloaded)
+			printConnectionStats(stats.Connections)
+		}
 	}
 
-	return 0
+	return nil
 }
 
 func main() {
@@ -796,98 +1432,225 @@ func main() {
 	os.Exit(exitCode)
 }
 
-// parseArgs parses command line arguments and returns configuration and URL.
-func parseArgs() (*config, string, error) {
-	cfg := &config{}
+// cliFlags holds flag values that parseArgs processes before storing them
+// in config.
+type cliFlags struct {
+	concurrentShort int
+	resolve         StringSlice
+	plugins         StringSlice
+	headers         StringSlice
+	mirrors         StringSlice
+	tee             StringSlice
+}
 
-	flag.StringVar(&cfg.output, "o", "", "Output filename (default: extract from URL)")
-	flag.StringVar(&cfg.output, "output", "", "Output filename (default: extract from URL)")
-	flag.StringVar(&cfg.userAgent, "user-agent", "gdl/"+version, "User-Agent string to use")
-	flag.DurationVar(&cfg.timeout, "timeout", 30*time.Minute, "Download timeout")
-	flag.BoolVar(&cfg.overwrite, "f", false, "Overwrite existing files")
-	flag.BoolVar(&cfg.overwrite, "force", false, "Overwrite existing files")
-	flag.BoolVar(
+// defineFlags registers the download flags on fs. It is shared by parseArgs
+// and "gdl completion", which lists the flags.
+func defineFlags(fs *flag.FlagSet, cfg *config, flags *cliFlags) {
+	fs.StringVar(&cfg.output, "o", "", "Output filename (default: extract from URL, - for stdout)")
+	fs.StringVar(&cfg.output, "output", "", "Output filename (default: extract from URL, - for stdout)")
+	fs.StringVar(&cfg.outputTemplate, "output-template", "", "Name the output from a template such as {host}/{path}/{filename}")
+	fs.StringVar(&cfg.userAgent, "user-agent", "gdl/"+version, "User-Agent string to use")
+	fs.DurationVar(&cfg.timeout, "timeout", 30*time.Minute, "Download timeout")
+	fs.BoolVar(&cfg.overwrite, "f", false, "Overwrite existing files")
+	fs.BoolVar(&cfg.overwrite, "force", false, "Overwrite existing files")
+	fs.BoolVar(
 		&cfg.createDirs,
 		"create-dirs",
 		false,
 		"Create parent directories if they don't exist",
 	)
-	flag.BoolVar(&cfg.resume, "resume", false, "Resume partial downloads if supported")
-	flag.BoolVar(&cfg.showVersion, "version", false, "Show version information")
-	flag.BoolVar(&cfg.showHelp, "help", false, "Show help information")
-	flag.BoolVar(&cfg.showHelp, "h", false, "Show help information")
-	flag.BoolVar(&cfg.quiet, "q", false, "Quiet mode (no progress output)")
-	flag.BoolVar(&cfg.quiet, "quiet", false, "Quiet mode (no progress output)")
-	flag.BoolVar(&cfg.verbose, "v", false, "Verbose output")
-	flag.BoolVar(&cfg.verbose, "verbose", false, "Verbose output")
-	flag.IntVar(&cfg.concurrent, "concurrent", 4, "Number of concurrent connections (default: 4)")
-
-	var c int
-	flag.IntVar(&c, "c", 4, "Number of concurrent connections (shorthand for --concurrent)")
-	flag.StringVar(
+	fs.BoolVar(&cfg.resume, "resume", false, "Resume partial downloads if supported")
+	fs.StringVar(&cfg.resumeValidation, "resume-validation", "", "What to do when the file changed on the server before resuming: restart, strict or ignore (default: restart)")
+	fs.BoolVar(&cfg.showVersion, "version", false, "Show version information")
+	fs.BoolVar(&cfg.showHelp, "help", false, "Show help information")
+	fs.BoolVar(&cfg.showHelp, "h", false, "Show help information")
+	fs.BoolVar(&cfg.quiet, "q", false, "Quiet mode (no progress output)")
+	fs.BoolVar(&cfg.quiet, "quiet", false, "Quiet mode (no progress output)")
+	fs.BoolVar(&cfg.verbose, "v", false, "Verbose output")
+	fs.BoolVar(&cfg.verbose, "verbose", false, "Verbose output")
+	fs.IntVar(&cfg.concurrent, "concurrent", 4, "Number of concurrent connections (default: 4)")
+
+	fs.IntVar(&flags.concurrentShort, "c", 4, "Number of concurrent connections (shorthand for --concurrent)")
+	fs.StringVar(
 		&cfg.chunkSize,
 		"chunk-size",
 		autoValue,
 		"Chunk size for concurrent downloads (default: auto)",
 	)
-	flag.BoolVar(&cfg.noConcurrent, "no-concurrent", false, "Force single-threaded download")
-	flag.BoolVar(&cfg.noColor, "no-color", false, "Disable colored output")
-	flag.BoolVar(
+	fs.BoolVar(&cfg.noConcurrent, "no-concurrent", false, "Force single-threaded download")
+	fs.BoolVar(&cfg.noColor, "no-color", false, "Disable colored output")
+	fs.BoolVar(
 		&cfg.interactive,
 		"interactive",
 		ui.IsTerminalInteractive(),
 		"Enable interactive prompts",
 	)
-	flag.BoolVar(
+	fs.BoolVar(
 		&cfg.checkConnectivity,
 		"check-connectivity",
 		false,
 		"Check network connectivity before download",
 	)
-	flag.BoolVar(&cfg.checkSpace, "check-space", true, "Check available disk space before download")
-	flag.StringVar(&cfg.language, "language", "en", "Language for messages (en, ja, es, fr)")
-	flag.StringVar(
+	fs.BoolVar(&cfg.checkSpace, "check-space", true, "Check available disk space before download")
+	fs.StringVar(
+		&cfg.language,
+		"language",
+		"auto",
+		"Language for messages (auto, en, ja, es, fr or a language in ~/.gdl/locales)",
+	)
+	fs.StringVar(
 		&cfg.progressBar,
 		"progress-bar",
 		"detailed",
 		"Progress bar type (simple|detailed|json)",
 	)
-	flag.BoolVar(&cfg.noResume, "no-resume", false, "Disable resume functionality")
-	flag.IntVar(&cfg.retry, "retry", 3, "Number of retry attempts (default: 3)")
-	flag.DurationVar(
+	fs.BoolVar(&cfg.noResume, "no-resume", false, "Disable resume functionality")
+	fs.IntVar(&cfg.retry, "retry", 3, "Number of retry attempts (default: 3)")
+	fs.DurationVar(
 		&cfg.retryDelay,
 		"retry-delay",
 		1*time.Second,
 		"Delay between retries (default: 1s)",
 	)
-	flag.IntVar(&cfg.maxRedirects, "max-redirects", 10, "Maximum number of redirects to follow")
-	flag.BoolVar(&cfg.insecure, "insecure", false, "Skip SSL certificate verification")
-	flag.BoolVar(&cfg.insecure, "k", false, "Skip SSL certificate verification")
-	flag.StringVar(&cfg.proxy, "proxy", "", "HTTP proxy URL (http://host:port)")
-	flag.StringVar(&cfg.output_format, "output-format", autoValue, "Output format (auto|json|yaml)")
-	flag.BoolVar(&cfg.continuePartial, "continue-partial", false, "Continue partial downloads")
+	fs.StringVar(
+		&cfg.retryBackoff,
+		"retry-backoff",
+		retryBackoffExponential,
+		"Retry backoff strategy (exponential|constant)",
+	)
+	fs.DurationVar(
+		&cfg.retryMaxTime,
+		"retry-max-time",
+		0,
+		"Maximum total time to keep retrying (default: unlimited)",
+	)
+	fs.IntVar(&cfg.maxRedirects, "max-redirects", 10, "Maximum number of redirects to follow (at most 10)")
+	fs.IntVar(&cfg.maxRedirects, "max-redirs", 10, "Maximum number of redirects to follow (curl spelling)")
+	fs.BoolFunc("location", "Follow redirects; always on, accepted for curl compatibility", func(string) error { return nil })
+	fs.BoolFunc("L", "Follow redirects (shorthand; always on)", func(string) error { return nil })
+	fs.StringVar(&cfg.referer, "referer", "", "Send URL as the Referer header")
+	fs.StringVar(&cfg.referer, "e", "", "Send URL as the Referer header (shorthand)")
+	fs.BoolVar(&cfg.compressed, "compressed", false, "Ask for a compressed response (gzip, deflate, zstd) and save it decompressed")
+	fs.BoolVar(&cfg.failWithBody, "fail-with-body", false, "On an HTTP error, save the server's response body to the output and still fail")
+	fs.BoolVar(&cfg.insecure, "insecure", false, "Skip SSL certificate verification")
+	fs.BoolVar(&cfg.insecure, "k", false, "Skip SSL certificate verification")
+	fs.StringVar(&cfg.caCert, "cacert", "", "PEM bundle of additional CA certificates to trust")
+	fs.StringVar(&cfg.clientCert, "cert", "", "PEM client certificate for mutual TLS")
+	fs.StringVar(&cfg.clientKey, "key", "", "PEM private key for --cert")
+	fs.StringVar(&cfg.pinnedPubKey, "pinnedpubkey", "", "Accepted server public key hashes (sha256//BASE64, separated by ';')")
+	fs.StringVar(&cfg.proxy, "proxy", "", "Proxy URL for all requests (http://, https://, socks5:// or socks5h://)")
+	fs.StringVar(&cfg.httpProxy, "http-proxy", "", "Proxy URL for http:// requests (overrides --proxy)")
+	fs.StringVar(&cfg.httpsProxy, "https-proxy", "", "Proxy URL for https:// requests (overrides --proxy)")
+	fs.StringVar(&cfg.noProxy, "no-proxy", "", "Comma-separated hosts, domains and CIDRs to connect to directly")
+	fs.StringVar(&cfg.proxyUser, "proxy-user", "", "Proxy credentials (user:password)")
+	fs.StringVar(&cfg.dnsServers, "dns-servers", "", "Comma-separated DNS servers to use instead of the system resolver")
+	fs.StringVar(&cfg.dohURL, "doh-url", "", "Resolve host names via this DNS-over-HTTPS endpoint")
+	fs.BoolVar(&cfg.ipv4, "ipv4", false, "Connect over IPv4 only")
+	fs.BoolVar(&cfg.ipv4, "4", false, "Connect over IPv4 only (shorthand)")
+	fs.BoolVar(&cfg.ipv6, "ipv6", false, "Connect over IPv6 only")
+	fs.BoolVar(&cfg.ipv6, "6", false, "Connect over IPv6 only (shorthand)")
+
+	fs.Var(&flags.resolve, "resolve", "Resolve host:port to a fixed address (host:port:addr, can be used multiple times)")
+	fs.StringVar(&cfg.output_format, "output-format", autoValue, "Output format (auto|json|yaml|ndjson)")
+	fs.StringVar(&cfg.eventsFile, "events-file", "", "Write the ndjson event stream or json result to FILE instead of stdout")
+	fs.BoolFunc("trace", "Trace requests, TLS handshakes, redirects and responses to stderr", func(string) error {
+		cfg.traceFile = "-"
+		return nil
+	})
+	fs.StringVar(&cfg.traceFile, "trace-ascii", "", "Write the trace of --trace to FILE (- for stderr)")
+	fs.BoolVar(&cfg.traceBodies, "trace-bodies", false, "Show the start of request and response bodies in the trace")
+	fs.StringVar(&cfg.harFile, "har", "", "Record the session's HTTP requests and responses to FILE in HAR format")
+	fs.BoolVar(&cfg.continuePartial, "continue-partial", false, "Continue partial downloads")
+	fs.BoolVar(&cfg.timestamping, "timestamping", false, "Only download if the server file is newer than the local file")
+	fs.BoolVar(&cfg.timestamping, "N", false, "Only download if the server file is newer (shorthand)")
+	fs.StringVar(&cfg.byteRange, "range", "", "Download only this byte range (e.g., bytes=0-1048575, 500-, -500)")
+	fs.StringVar(&cfg.ifExists, "if-exists", "", "What to do with an existing output file: fail, overwrite, skip, rename or resume")
+	fs.BoolVar(&cfg.globOff, "globoff", false, "Do not expand {a,b} sets and [1-10] ranges in the URL")
+	fs.BoolVar(&cfg.globOff, "g", false, "Do not expand URL sets and ranges (shorthand)")
+	fs.BoolVar(&cfg.expandDryRun, "expand-dry-run", false, "Print the URLs a pattern expands to and exit")
+	fs.BoolVar(&cfg.dryRun, "dry-run", false, "Report the final URL, file name, size, range support and time of the download and exit")
+	fs.BoolVar(&cfg.noAtomic, "no-atomic", false, "Write directly to the destination instead of a .gdl-part file renamed on success")
+	fs.StringVar(&cfg.tempDir, "temp-dir", "", "Directory for .gdl-part files (default: next to the destination)")
+	fs.BoolVar(&cfg.noRemoteTime, "no-remote-time", false, "Keep the download time as the file's modification time instead of Last-Modified")
+	fs.StringVar(&cfg.chmod, "chmod", "", "Set the permission bits of the downloaded file, in octal (e.g. 755)")
+	fs.BoolVar(&cfg.xattr, "xattr", false, "Record the source URL and SHA-256 in the file's extended attributes")
+	fs.BoolVar(&cfg.directIO, "direct-io", false, "Write large files with direct I/O, bypassing the page cache")
+	fs.StringVar(&cfg.writeBuffer, "write-buffer", "", "Write buffer size for large files (e.g., 8MB)")
+	fs.StringVar(&cfg.minFreeSpace, "min-free-space", "", "Stop, keeping the partial file, when free disk space falls below SIZE (e.g., 2GB)")
+	fs.StringVar(&cfg.cacheDir, "cache-dir", "", "Cache downloaded files in DIR and reuse them while the server reports them unchanged")
+	fs.BoolVar(&cfg.noCache, "no-cache", false, "Bypass the download cache even if --cache-dir is set")
+	fs.StringVar(&cfg.contentStore, "content-store", "", "Deduplicate downloads through a content-addressable store in DIR")
+	fs.StringVar(&cfg.contentSHA256, "content-sha256", "", "Expected SHA-256 of the content; reused from the content store without a request")
+	fs.BoolVar(&cfg.contentStoreLink, "content-store-link", false, "Hard-link files from the content store instead of copying them")
+	fs.StringVar(&cfg.quota, "quota", "", "Maximum total size of the quota directory (e.g., 50GB)")
+	fs.StringVar(&cfg.quotaDir, "quota-dir", "", "Directory the quota applies to (default: the output directory)")
+	fs.StringVar(&cfg.quotaPolicy, "quota-policy", types.QuotaPolicyRefuse,
+		"What to do when the quota would be exceeded: refuse, oldest (evict oldest files) or lru")
+	fs.StringVar(&cfg.checksum, "checksum", "", "Expected hex digest of the download; a file that does not match is deleted")
+	fs.StringVar(&cfg.checksumAlgo, "checksum-algo", "",
+		"Algorithm of --checksum: md5, sha1, sha256 (default), sha512, blake3 or xxh3")
+	fs.StringVar(&cfg.signature, "signature", "", "Verify the download against a detached OpenPGP signature (path or URL)")
+	fs.StringVar(&cfg.keyring, "keyring", "", "Public keys trusted to sign the download, for --signature")
+	fs.StringVar(&cfg.clamd, "clamd", "", "Scan downloads with the ClamAV daemon at this address (host:port or socket path)")
+	fs.StringVar(&cfg.scanCmd, "scan-cmd", "", "Scan downloads with this command; exit status 1 means infected")
+	fs.StringVar(&cfg.quarantineDir, "quarantine", "", "Move files failing the scan to this directory instead of deleting them")
+	fs.StringVar(&cfg.zsync, "zsync", "", "Update the existing file from a zsync control file (path, URL or auto for URL.zsync)")
+	fs.StringVar(&cfg.zsyncSeed, "zsync-seed", "", "Reuse blocks from FILE instead of the output file, for --zsync")
+	fs.StringVar(&cfg.recompress, "recompress", "", "Store the download compressed with CODEC (zstd, gzip) or decompressed (none)")
+	fs.Var(&flags.tee, "tee", "Also write the download to this file, directory, s3:// or gs:// location in the same pass (can be used multiple times)")
 
 	// Plugin-related flags
-	var pluginFlags StringSlice
-	flag.Var(&pluginFlags, "plugin", "Enable plugin (can be used multiple times)")
-	flag.StringVar(&cfg.storageURL, "storage", "", "Storage URL (e.g., s3://bucket/path/, gcs://bucket/path/)")
-	flag.StringVar(&cfg.pluginDir, "plugin-dir", cli.GetDefaultPluginDir(), "Plugin directory")
-	flag.StringVar(&cfg.pluginConfig, "plugin-config", cli.GetDefaultConfigFile(), "Plugin configuration file")
+	fs.Var(&flags.plugins, "plugin", "Enable plugin (can be used multiple times)")
+	fs.StringVar(&cfg.storageURL, "storage", "", "Storage URL (e.g., s3://bucket/path/, gcs://bucket/path/)")
+	fs.StringVar(&cfg.pluginDir, "plugin-dir", cli.GetDefaultPluginDir(), "Plugin directory")
+	fs.StringVar(&cfg.pluginConfig, "plugin-config", cli.GetDefaultConfigFile(), "Plugin configuration file")
 
 	// Custom header flag handler
-	var headerFlags StringSlice
-	flag.Var(
-		&headerFlags,
+	fs.Var(
+		&flags.headers,
 		"header",
 		"Add custom header (can be used multiple times): -header 'Key: Value'",
 	)
-	flag.Var(&headerFlags, "H", "Add custom header (shorthand)")
-	flag.StringVar(
+	fs.Var(&flags.headers, "H", "Add custom header (shorthand)")
+	fs.StringVar(&cfg.credentialHelper, "credential-helper", os.Getenv(credentialHelperEnv),
+		"Ask this git-style credential helper for the credentials of each host (default: $"+credentialHelperEnv+")")
+	fs.Var(&flags.mirrors, "mirror", "Also fetch pieces of the file from this mirror URL (can be used multiple times)")
+	fs.StringVar(&cfg.mirrorStrategy, "mirror-strategy", "", "Which mirrors to use after probing them: ordered, fastest or random (default: ordered)")
+	fs.IntVar(&cfg.maxMirrors, "max-mirrors", 0, "Maximum number of mirrors to use (default: all)")
+	fs.BoolVar(&cfg.streamOrder, "stream-order", false, "Fetch pieces from the beginning of the file first, so it can be played while downloading")
+	fs.IntVar(&cfg.perHost, "per-host", 0, "Maximum connections to one host (default: unlimited)")
+	fs.DurationVar(&cfg.hostDelay, "host-delay", 0, "Minimum delay between two requests to the same host (e.g., 500ms)")
+	fs.IntVar(&cfg.circuitBreaker, "circuit-breaker", 0, "Stop requesting a host after this many consecutive failures (default: off)")
+	fs.DurationVar(&cfg.circuitCooldown, "circuit-cooldown", 0, "How long a failing host is skipped before it is tried again (default: 30s)")
+	fs.StringVar(&cfg.method, "method", "", "HTTP method of the request (default: GET, or POST with --data)")
+	fs.StringVar(&cfg.method, "X", "", "HTTP method of the request (shorthand)")
+	fs.StringVar(&cfg.data, "data", "", "Send DATA as the request body, or the content of FILE with @FILE")
+	fs.StringVar(&cfg.data, "d", "", "Send DATA or @FILE as the request body (shorthand)")
+	fs.StringVar(
 		&cfg.maxRate,
 		"max-rate",
 		"",
 		"Maximum download rate (e.g., 1MB/s, 500k, 2048)",
 	)
+	fs.StringVar(
+		&cfg.minRate,
+		"min-rate",
+		"",
+		"Abort and retry when the rate stays below this for --min-rate-time (e.g., 50k)",
+	)
+	fs.DurationVar(
+		&cfg.minRateTime,
+		"min-rate-time",
+		0,
+		"Window for --min-rate (default: 30s); alone, aborts after this long without data",
+	)
+}
+
+// parseArgs parses command line arguments and returns configuration and URL.
+func parseArgs() (*config, string, error) {
+	cfg := &config{}
+	flags := &cliFlags{}
+	defineFlags(flag.CommandLine, cfg, flags)
 
 	// Initialize headers map and plugins slice
 	cfg.headers = make(map[string]string)
@@ -896,7 +1659,7 @@ func parseArgs() (*config, string, error) {
 	flag.Parse()
 
 	// Process custom headers
-	for _, header := range headerFlags {
+	for _, header := range flags.headers {
 		parts := strings.SplitN(header, ":", 2)
 		if len(parts) == 2 {
 			key := strings.TrimSpace(parts[0])
@@ -905,18 +1668,344 @@ func parseArgs() (*config, string, error) {
 		}
 	}
 
-	// Process plugin flags
-	for _, pluginName := range pluginFlags {
-		cfg.plugins = append(cfg.plugins, strings.TrimSpace(pluginName))
+	// --referer, or curl's "URL;auto", unless -H sets the header
+	if referer := strings.TrimSuffix(cfg.referer, ";auto"); referer != "" && !hasHeader(cfg.headers, "Referer") {
+		cfg.headers["Referer"] = referer
 	}
 
-	// Validate max-rate if specified
+	// Read the credentials kept in the keychain
+	if err := resolveSecrets(cfg); err != nil {
+		return nil, "", err
+	}
+
+	// Process static host resolution entries
+	for _, entry := range flags.resolve {
+		hostPort, address, err := network.ParseResolveEntry(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, "", err
+		}
+
+		if cfg.resolve == nil {
+			cfg.resolve = make(map[string]string)
+		}
+
+		cfg.resolve[hostPort] = address
+	}
+
+	if cfg.ipv4 && cfg.ipv6 {
+		return nil, "", gdlerrors.NewValidationError("ipv4", "--ipv4 and --ipv6 cannot be used together")
+	}
+
+	if cfg.noAtomic && cfg.tempDir != "" {
+		return nil, "", gdlerrors.NewValidationError("temp_dir", "--temp-dir cannot be used with --no-atomic")
+	}
+
+	if cfg.chmod != "" {
+		if _, err := parseFileMode(cfg.chmod); err != nil {
+			return nil, "", gdlerrors.NewValidationError("chmod", err.Error())
+		}
+	}
+
+	if cfg.writeBuffer != "" {
+		if size, err := parseSize(cfg.writeBuffer); err != nil || size <= 0 || size > maxWriteBufferSize {
+			return nil, "", gdlerrors.NewValidationError("write_buffer",
+				fmt.Sprintf("invalid --write-buffer %q: expected a size between 1B and 1GB", cfg.writeBuffer))
+		}
+	}
+
+	if cfg.minFreeSpace != "" {
+		if size, err := parseSize(cfg.minFreeSpace); err != nil || size <= 0 {
+			return nil, "", gdlerrors.NewValidationError("min_free_space",
+				fmt.Sprintf("invalid --min-free-space %q: expected a size such as 500MB or 2GB", cfg.minFreeSpace))
+		}
+	}
+
+	// Validate the quota flags
+	if cfg.quota != "" {
+		if size, err := parseSize(cfg.quota); err != nil || size <= 0 {
+			return nil, "", gdlerrors.NewValidationError("quota",
+				fmt.Sprintf("invalid --quota %q: expected a size such as 50GB", cfg.quota))
+		}
+	} else if cfg.quotaDir != "" {
+		return nil, "", gdlerrors.NewValidationError("quota_dir", "--quota-dir requires --quota")
+	}
+
+	if err := storage.ValidateQuotaPolicy(cfg.quotaPolicy); err != nil {
+		return nil, "", err
+	}
+
+	// Validate the checksum flags
+	if cfg.checksum != "" {
+		if _, err := checksum.NormalizeDigest(cfg.checksumAlgo, cfg.checksum); err != nil {
+			return nil, "", err
+		}
+	} else if _, err := checksum.Normalize(cfg.checksumAlgo); err != nil {
+		return nil, "", err
+	}
+
+	// Validate the signature flags
+	if (cfg.signature == "") != (cfg.keyring == "") {
+		return nil, "", gdlerrors.NewValidationError("signature",
+			"--signature and --keyring must be used together")
+	}
+
+	// Validate the scan flags
+	if cfg.quarantineDir != "" && cfg.clamd == "" && cfg.scanCmd == "" {
+		return nil, "", gdlerrors.NewValidationError("quarantine",
+			"--quarantine requires --clamd or --scan-cmd")
+	}
+
+	// Validate the recompression codec
+	if cfg.recompress != "" {
+		if err := plugin.ValidateCodec(cfg.recompress); err != nil {
+			return nil, "", gdlerrors.NewValidationError("recompress", err.Error())
+		}
+		if cfg.resume {
+			return nil, "", gdlerrors.NewValidationError("recompress",
+				"--recompress cannot resume a download; the file is rewritten as it streams")
+		}
+	}
+
+	// Validate the delta update flags
+	if cfg.zsyncSeed != "" && cfg.zsync == "" {
+		return nil, "", gdlerrors.NewValidationError("zsync-seed", "--zsync-seed requires --zsync")
+	}
+	if cfg.zsync != "" &&
+		(cfg.resume || cfg.timestamping || cfg.byteRange != "" || cfg.recompress != "" || cfg.output == stdoutOutput) {
+		return nil, "", gdlerrors.NewValidationError("zsync",
+			"--zsync cannot be combined with --resume, --timestamping, --range, --recompress or -o -")
+	}
+
+	// Validate the content store flags
+	if cfg.contentStore == "" && (cfg.contentSHA256 != "" || cfg.contentStoreLink) {
+		return nil, "", gdlerrors.NewValidationError("content_store",
+			"--content-sha256 and --content-store-link require --content-store")
+	}
+
+	if cfg.contentSHA256 != "" {
+		if _, err := cas.NormalizeHash(cfg.contentSHA256); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Validate the request method and body
+	if strings.IndexFunc(cfg.method, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+	}) >= 0 {
+		return nil, "", gdlerrors.NewValidationError("method", fmt.Sprintf("invalid HTTP method %q", cfg.method))
+	}
+
+	if bodyFile, ok := strings.CutPrefix(cfg.data, "@"); ok {
+		if _, err := os.Stat(bodyFile); err != nil {
+			return nil, "", gdlerrors.NewValidationError("data", fmt.Sprintf("cannot read request body: %v", err))
+		}
+	}
+
+	if (cfg.data != "" || (cfg.method != "" && !strings.EqualFold(cfg.method, http.MethodGet))) &&
+		(cfg.timestamping || cfg.contentStore != "") {
+		return nil, "", gdlerrors.NewValidationError("method",
+			"--method and --data cannot be combined with --timestamping or --content-store")
+	}
+
+	if cfg.overwrite && cfg.resume {
+		return nil, "", gdlerrors.NewValidationError("force",
+			"--force cannot be combined with --resume; use --if-exists to choose")
+	}
+
+	if err := core.ValidateResumeValidation(cfg.resumeValidation); err != nil {
+		return nil, "", gdlerrors.NewValidationError("resume-validation", err.Error())
+	}
+
+	// Validate the collision policy and the flags that decide it too
+	if cfg.ifExists != "" {
+		if err := core.ValidateCollisionPolicy(cfg.ifExists); err != nil {
+			return nil, "", gdlerrors.NewValidationError("if-exists", err.Error())
+		}
+
+		switch {
+		case cfg.overwrite && cfg.ifExists != types.CollisionOverwrite:
+			return nil, "", gdlerrors.NewValidationError("if-exists",
+				"--force cannot be combined with --if-exists="+cfg.ifExists)
+		case cfg.resume && cfg.ifExists != types.CollisionResume:
+			return nil, "", gdlerrors.NewValidationError("if-exists",
+				"--resume cannot be combined with --if-exists="+cfg.ifExists)
+		case cfg.timestamping:
+			return nil, "", gdlerrors.NewValidationError("if-exists",
+				"--if-exists cannot be combined with --timestamping")
+		case cfg.byteRange != "" && cfg.ifExists == types.CollisionResume:
+			return nil, "", gdlerrors.NewValidationError("if-exists",
+				"--if-exists=resume cannot be combined with --range")
+		}
+	}
+
+	// Validate the byte range
+	if cfg.byteRange != "" {
+		if _, err := types.ParseByteRange(cfg.byteRange); err != nil {
+			return nil, "", gdlerrors.NewValidationError("range", err.Error())
+		}
+
+		if cfg.resume || cfg.timestamping || cfg.contentStore != "" || cfg.signature != "" || cfg.checksum != "" {
+			return nil, "", gdlerrors.NewValidationError("range",
+				"--range cannot be combined with --resume, --timestamping, --content-store, --signature or --checksum")
+		}
+	}
+
+	// Validate TLS files and pinned keys
+	if tlsOptions := createTLSOptions(cfg); tlsOptions != nil {
+		tlsConfig := network.TLSConfig{
+			CAFile:           tlsOptions.CAFile,
+			CertFile:         tlsOptions.CertFile,
+			KeyFile:          tlsOptions.KeyFile,
+			PinnedPublicKeys: tlsOptions.PinnedPublicKeys,
+		}
+
+		if err := tlsConfig.Validate(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Validate proxy URLs
+	for _, proxyURL := range []string{cfg.proxy, cfg.httpProxy, cfg.httpsProxy} {
+		if proxyURL == "" {
+			continue
+		}
+
+		if _, err := network.ParseProxyURL(proxyURL); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Process plugin flags
+	for _, pluginName := range flags.plugins {
+		cfg.plugins = append(cfg.plugins, strings.TrimSpace(pluginName))
+	}
+
+	// Mirrors serve the same file over HTTP
+	for _, mirror := range flags.mirrors {
+		mirror = strings.TrimSpace(mirror)
+
+		parsed, err := url.Parse(mirror)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, "", gdlerrors.NewValidationError("mirror", fmt.Sprintf("invalid mirror URL %q: expected an http or https URL", mirror))
+		}
+
+		cfg.mirrors = append(cfg.mirrors, mirror)
+	}
+
+	if err := core.ValidateMirrorStrategy(cfg.mirrorStrategy); err != nil {
+		return nil, "", gdlerrors.NewValidationError("mirror-strategy", err.Error())
+	}
+
+	if cfg.maxMirrors < 0 {
+		return nil, "", gdlerrors.NewValidationError("max-mirrors", "mirror limit cannot be negative")
+	}
+
+	// Validate max-rate if specified
 	if cfg.maxRate != "" {
 		if err := ratelimit.ValidateRate(cfg.maxRate); err != nil {
 			return nil, "", gdlerrors.WrapError(err, gdlerrors.CodeValidationError, "invalid --max-rate")
 		}
 	}
 
+	// Validate slow transfer detection settings
+	if cfg.minRate != "" {
+		if err := ratelimit.ValidateRate(cfg.minRate); err != nil {
+			return nil, "", gdlerrors.WrapError(err, gdlerrors.CodeValidationError, "invalid --min-rate")
+		}
+	}
+
+	if cfg.minRateTime < 0 {
+		return nil, "", gdlerrors.NewValidationError("min-rate-time", "duration cannot be negative")
+	}
+
+	// Validate per-host politeness limits
+	if cfg.perHost < 0 {
+		return nil, "", gdlerrors.NewValidationError("per-host", "connection limit cannot be negative")
+	}
+
+	if cfg.hostDelay < 0 {
+		return nil, "", gdlerrors.NewValidationError("host-delay", "delay cannot be negative")
+	}
+
+	if cfg.circuitBreaker < 0 {
+		return nil, "", gdlerrors.NewValidationError("circuit-breaker", "failure threshold cannot be negative")
+	}
+
+	if cfg.circuitCooldown < 0 {
+		return nil, "", gdlerrors.NewValidationError("circuit-cooldown", "cool-down cannot be negative")
+	}
+
+	// Validate retry settings
+	if cfg.retryBackoff != retryBackoffExponential && cfg.retryBackoff != retryBackoffConstant {
+		return nil, "", gdlerrors.NewValidationError("retry-backoff",
+			fmt.Sprintf("unsupported retry backoff: %s", cfg.retryBackoff))
+	}
+
+	if cfg.retryMaxTime < 0 {
+		return nil, "", gdlerrors.NewValidationError("retry-max-time", "retry budget cannot be negative")
+	}
+
+	// Validate output format
+	switch cfg.output_format {
+	case autoValue, outputFormatJSON, "yaml", outputFormatNDJSON:
+	default:
+		return nil, "", gdlerrors.NewValidationError("output-format",
+			fmt.Sprintf("unsupported output format: %s", cfg.output_format))
+	}
+
+	// The result document is all a json run writes to stdout
+	if cfg.output_format == outputFormatJSON {
+		cfg.quiet = true
+	}
+
+	// An output template names the file from its URL, in directories it creates
+	if cfg.outputTemplate != "" {
+		if cfg.output != "" {
+			return nil, "", gdlerrors.NewValidationError("output-template", "-o and --output-template cannot be combined")
+		}
+		cfg.output = cfg.outputTemplate
+	}
+
+	if pathtemplate.Has(cfg.output) {
+		if _, err := pathtemplate.Parse(cfg.output); err != nil {
+			return nil, "", gdlerrors.NewValidationError("output-template", err.Error())
+		}
+		cfg.createDirs = true
+	}
+
+	// Writing to stdout leaves no room for the progress bar or an event stream
+	if cfg.output == stdoutOutput {
+		if wantsEventsWriter(cfg) && cfg.eventsFile == "" {
+			return nil, "", gdlerrors.NewValidationError("events-file",
+				fmt.Sprintf("--output-format %s with -o - requires --events-file", cfg.output_format))
+		}
+
+		cfg.quiet = true
+	}
+
+	// Tee downloads go through a destination, which covers the plain cases
+	for _, target := range flags.tee {
+		target = strings.TrimSpace(target)
+		if err := validateTeeTarget(target); err != nil {
+			return nil, "", err
+		}
+		cfg.tee = append(cfg.tee, target)
+	}
+
+	if len(cfg.tee) > 0 {
+		switch {
+		case cfg.output == stdoutOutput:
+			return nil, "", gdlerrors.NewValidationError("tee", "--tee cannot be used with -o -")
+		case cfg.resume || (cfg.ifExists != "" && cfg.ifExists != types.CollisionFail && cfg.ifExists != types.CollisionOverwrite):
+			return nil, "", gdlerrors.NewValidationError("tee",
+				"--tee cannot resume; it only supports --if-exists=fail or overwrite")
+		case cfg.timestamping || cfg.contentStore != "" || cfg.byteRange != "" || cfg.checksum != "" ||
+			cfg.signature != "" || cfg.recompress != "" || cfg.zsync != "" || len(cfg.plugins) > 0 || cacheEnabled(cfg):
+			return nil, "", gdlerrors.NewValidationError("tee",
+				"--tee cannot be combined with --timestamping, --content-store, --range, --checksum, --signature, --recompress, --zsync, --plugin or --cache-dir")
+		}
+	}
+
 	// Handle -c as an alias for --concurrent
 	cWasSet := false
 
@@ -924,10 +2013,26 @@ func parseArgs() (*config, string, error) {
 		if f.Name == "c" {
 			cWasSet = true
 		}
+		if f.Name == "c" || f.Name == "concurrent" {
+			cfg.concurrentSet = true
+		}
+		if f.Name == "user-agent" {
+			cfg.userAgentSet = true
+		}
+		if f.Name == "circuit-breaker" {
+			cfg.circuitBreakerSet = true
+		}
+		if f.Name == "circuit-cooldown" {
+			cfg.circuitCooldownSet = true
+		}
 	})
 
 	if cWasSet {
-		cfg.concurrent = c
+		cfg.concurrent = flags.concurrentShort
+	}
+
+	if cfg.maxRedirects < 0 {
+		return nil, "", gdlerrors.NewValidationError("max-redirects", "the redirect limit cannot be negative")
 	}
 
 	// Validate concurrent settings
@@ -954,6 +2059,25 @@ func parseArgs() (*config, string, error) {
 		url = args[0]
 	}
 
+	// The control file is usually published next to the file
+	if cfg.zsync == autoValue && url != "" {
+		cfg.zsync = url + ".zsync"
+	}
+
+	fileConfig, err := loadFileConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Settings by URL pattern from the config file
+	engine, err := loadRules(fileConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg.rules = engine
+
+	applyCircuitBreaker(cfg, fileConfig)
+
 	return cfg, url, nil
 }
 
@@ -969,6 +2093,16 @@ func validateChunkSize(chunkSize string) error {
 	return err
 }
 
+// parseFileMode parses octal permission bits such as "755" or "0644".
+func parseFileMode(mode string) (os.FileMode, error) {
+	bits, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || bits == 0 || bits > 0o777 {
+		return 0, fmt.Errorf("invalid --chmod %q: expected octal permission bits such as 755", mode)
+	}
+
+	return os.FileMode(bits), nil
+}
+
 // parseSize parses a size string with units into bytes.
 func parseSize(sizeStr string) (int64, error) {
 	if sizeStr == "" {
@@ -1015,20 +2149,54 @@ func runPluginCommand(args []string) int {
 		return 1
 	}
 
+	args, index, keyring, err := parsePluginIndexOptions(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: plugin command required\n")
+		showPluginUsage()
+		return 1
+	}
+
 	ctx := context.Background()
-	pluginRegistry := cli.NewPluginRegistry(cli.GetDefaultPluginDir(), cli.GetDefaultConfigFile())
+	pluginRegistry := cli.NewPluginRegistry(cli.GetDefaultPluginDir(), cli.GetDefaultConfigFile()).
+		WithIndex(index).
+		WithKeyRing(keyring).
+		WithKeychain(keychain())
 
 	command := args[0]
 	switch command {
 	case "list":
 		return handlePluginList(ctx, pluginRegistry)
 	case "install":
+		if len(args) == 2 {
+			return handlePluginInstallFromIndex(ctx, pluginRegistry, args[1])
+		}
 		if len(args) < 3 {
-			fmt.Fprintf(os.Stderr, "Error: plugin install requires source and name\n")
+			fmt.Fprintf(os.Stderr, "Error: plugin install requires source and name, or name[@constraint]\n")
 			fmt.Fprintf(os.Stderr, "Usage: gdl plugin install <source> <name>\n")
+			fmt.Fprintf(os.Stderr, "       gdl plugin install <name>[@<constraint>]\n")
 			return 1
 		}
 		return handlePluginInstall(ctx, pluginRegistry, args[1], args[2])
+	case "update":
+		return handlePluginUpdate(ctx, pluginRegistry, args[1:])
+	case "search":
+		query := ""
+		if len(args) > 1 {
+			query = args[1]
+		}
+		return handlePluginSearch(ctx, pluginRegistry, query)
+	case "info":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "Error: plugin info requires name\n")
+			fmt.Fprintf(os.Stderr, "Usage: gdl plugin info <name>\n")
+			return 1
+		}
+		return handlePluginInfo(ctx, pluginRegistry, args[1])
 	case "remove":
 		if len(args) < 2 {
 			fmt.Fprintf(os.Stderr, "Error: plugin remove requires name\n")
@@ -1051,11 +2219,15 @@ func runPluginCommand(args []string) int {
 		}
 		return handlePluginDisable(ctx, pluginRegistry, args[1])
 	case "config":
-		if len(args) < 4 || args[2] != "--set" {
+		if len(args) < 4 || (args[2] != "--set" && args[2] != "--set-secret") {
 			fmt.Fprintf(os.Stderr, "Error: plugin config requires name and --set key=value\n")
 			fmt.Fprintf(os.Stderr, "Usage: gdl plugin config <name> --set <key>=<value>\n")
+			fmt.Fprintf(os.Stderr, "       gdl plugin config <name> --set-secret <key>[=<value>]\n")
 			return 1
 		}
+		if args[2] == "--set-secret" {
+			return handlePluginSecret(ctx, pluginRegistry, args[1], args[3])
+		}
 		return handlePluginConfig(ctx, pluginRegistry, args[1], args[3])
 	default:
 		fmt.Fprintf(os.Stderr, "Error: unknown plugin command: %s\n", command)
@@ -1109,6 +2281,160 @@ func handlePluginInstall(ctx context.Context, registry *cli.PluginRegistry, sour
 	return 0
 }
 
+// parsePluginIndexOptions removes the --index and --keyring options from the
+// plugin command arguments. The index defaults to $GDL_PLUGIN_INDEX and the
+// keyring to $GDL_PLUGIN_KEYRING.
+func parsePluginIndexOptions(args []string) (rest []string, index, keyring string, err error) {
+	index = os.Getenv("GDL_PLUGIN_INDEX")
+	keyring = os.Getenv("GDL_PLUGIN_KEYRING")
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--index", "--keyring":
+			if i+1 >= len(args) {
+				return nil, "", "", fmt.Errorf("%s requires a value", args[i])
+			}
+			if args[i] == "--index" {
+				index = args[i+1]
+			} else {
+				keyring = args[i+1]
+			}
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	return rest, index, keyring, nil
+}
+
+// handlePluginInstallFromIndex installs a plugin resolved from the plugin index
+func handlePluginInstallFromIndex(ctx context.Context, registry *cli.PluginRegistry, spec string) int {
+	name, constraint := cli.ParsePluginSpec(spec)
+	fmt.Printf("Installing plugin %s from the plugin index...\n", spec)
+
+	if err := registry.InstallFromIndex(ctx, name, constraint); err != nil {
+		fmt.Fprintf(os.Stderr, "Error installing plugin: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Successfully installed plugin: %s\n", name)
+	return 0
+}
+
+// handlePluginUpdate updates the named plugins, or every plugin installed from
+// the plugin index when none are named
+func handlePluginUpdate(ctx context.Context, registry *cli.PluginRegistry, names []string) int {
+	if len(names) == 0 {
+		plugins, err := registry.List(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing plugins: %v\n", err)
+			return 1
+		}
+
+		for _, plugin := range plugins {
+			if plugin.FromIndex() {
+				names = append(names, plugin.Name)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	status := 0
+	for _, name := range names {
+		version, err := registry.Update(ctx, name)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error updating plugin %s: %v\n", name, err)
+			status = 1
+		case version == "":
+			fmt.Printf("Plugin %s is up to date\n", name)
+		default:
+			fmt.Printf("Successfully updated plugin %s to %s\n", name, version)
+		}
+	}
+
+	return status
+}
+
+// handlePluginSearch lists the plugin index entries matching query
+func handlePluginSearch(ctx context.Context, registry *cli.PluginRegistry, query string) int {
+	results, err := registry.Search(ctx, query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error searching plugins: %v\n", err)
+		return 1
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No plugins found")
+		return 0
+	}
+
+	fmt.Printf("%-20s %-10s %-15s %s\n", "NAME", "LATEST", "TYPE", "DESCRIPTION")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, result := range results {
+		latest := "-"
+		if _, release, err := registry.Resolve(ctx, result.Name, ""); err == nil {
+			latest = release.Version
+		}
+		fmt.Printf("%-20s %-10s %-15s %s\n", result.Name, latest, result.Type, result.Description)
+	}
+
+	return 0
+}
+
+// handlePluginInfo shows an installed plugin and the capabilities its
+// manifest declares
+func handlePluginInfo(ctx context.Context, registry *cli.PluginRegistry, name string) int {
+	info, err := registry.Get(ctx, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	manifest, err := registry.Manifest(ctx, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading plugin manifest: %v\n", err)
+		return 1
+	}
+
+	source := info.Source
+	if source == "" {
+		source = "local"
+	}
+
+	fmt.Printf("Name:        %s\n", info.Name)
+	fmt.Printf("Version:     %s\n", info.Version)
+	fmt.Printf("Type:        %s\n", info.Type)
+	fmt.Printf("Enabled:     %t\n", info.Enabled)
+	fmt.Printf("Source:      %s\n", source)
+	fmt.Printf("Path:        %s\n", info.Path)
+	if manifest.Description != "" {
+		fmt.Printf("Description: %s\n", manifest.Description)
+	}
+
+	caps := manifest.Capabilities
+	fmt.Println("Capabilities:")
+	for _, c := range []struct {
+		label   string
+		entries []string
+	}{
+		{"Network", caps.Network},
+		{"Read", caps.Read},
+		{"Write", caps.Write},
+		{"Env", caps.Env},
+	} {
+		value := "none"
+		if len(c.entries) > 0 {
+			value = strings.Join(c.entries, ", ")
+		}
+		fmt.Printf("  %-8s %s\n", c.label+":", value)
+	}
+
+	return 0
+}
+
 // handlePluginRemove removes a plugin
 func handlePluginRemove(ctx context.Context, registry *cli.PluginRegistry, name string) int {
 	if err := registry.Remove(ctx, name); err != nil {
@@ -1162,13 +2488,37 @@ func handlePluginConfig(ctx context.Context, registry *cli.PluginRegistry, name,
 	return 0
 }
 
+// handlePluginSecret handles "gdl plugin config <name> --set-secret key",
+// which stores the value in the keychain rather than the plugin config
+// file. Without "=value" the value is read from stdin.
+func handlePluginSecret(ctx context.Context, registry *cli.PluginRegistry, name, keyValue string) int {
+	key, value, hasValue := strings.Cut(keyValue, "=")
+	key = strings.TrimSpace(key)
+
+	if !hasValue {
+		var err error
+		if value, err = readSecret(os.Stdin, fmt.Sprintf("Value of %s: ", key)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the value: %v\n", err)
+			return 1
+		}
+	}
+
+	if err := registry.ConfigureSecret(ctx, name, key, value); err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring plugin: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Successfully configured plugin %s: %s stored in the keychain\n", name, key)
+	return 0
+}
+
 // setupPlugins initializes and loads plugins
 func setupPlugins(ctx context.Context, downloader *gdl.Downloader, cfg *config) error {
 	if len(cfg.plugins) == 0 {
 		return nil
 	}
 
-	pluginRegistry := cli.NewPluginRegistry(cfg.pluginDir, cfg.pluginConfig)
+	pluginRegistry := cli.NewPluginRegistry(cfg.pluginDir, cfg.pluginConfig).WithKeychain(keychain())
 	pluginManager := plugin.NewPluginManager()
 
 	// Load all enabled plugins first
@@ -1243,7 +2593,7 @@ func performEnhancedDownload(
 	url, outputFile string,
 	options *types.DownloadOptions,
 	cfg *config,
-) error {
+) (*types.DownloadStats, error) {
 	// Add timeout to context if specified
 	if cfg.timeout > 0 {
 		var cancel context.CancelFunc
@@ -1256,26 +2606,99 @@ func performEnhancedDownload(
 		MaxConcurrency:    options.MaxConcurrency,
 		ChunkSize:         options.ChunkSize,
 		EnableResume:      options.Resume,
+		ResumeValidation:  options.ResumeValidation,
 		RetryAttempts:     cfg.retry,
 		Timeout:           cfg.timeout,
 		UserAgent:         cfg.userAgent,
 		Headers:           cfg.headers,
 		CreateDirs:        cfg.createDirs,
 		OverwriteExisting: cfg.overwrite,
+		CollisionPolicy:   options.CollisionPolicy,
+		OnlyIfNewer:       cfg.timestamping,
+		ByteRange:         options.ByteRange,
+		Method:            options.Method,
+		Body:              options.Body,
+		BodyFile:          options.BodyFile,
+		AtomicWrite:       options.AtomicWrite,
+		TempDir:           options.TempDir,
+		KeepDownloadTime:  options.KeepDownloadTime,
+		FileMode:          options.FileMode,
+		Xattrs:            options.Xattrs,
+		Mirrors:           options.Mirrors,
+		DirectIO:          options.DirectIO,
+		WriteBufferSize:   options.WriteBufferSize,
 		Quiet:             cfg.quiet,
 		Verbose:           cfg.verbose,
 	}
 
+	if options.DNS != nil {
+		gdlOptions.DNSServers = options.DNS.Servers
+		gdlOptions.DoHURL = options.DNS.DoHURL
+		gdlOptions.IPVersion = options.DNS.IPVersion
+		gdlOptions.Resolve = options.DNS.Resolve
+	}
+
+	if options.HostLimits != nil {
+		gdlOptions.MaxConnectionsPerHost = options.HostLimits.MaxConnections
+		gdlOptions.HostDelay = options.HostLimits.Delay
+	}
+
+	if options.CircuitBreaker != nil {
+		gdlOptions.CircuitBreakerThreshold = options.CircuitBreaker.FailureThreshold
+		gdlOptions.CircuitBreakerCooldown = options.CircuitBreaker.Cooldown
+	}
+
+	gdlOptions.Proxy = options.Proxy
+	gdlOptions.TLS = options.TLS
+	gdlOptions.InsecureSkipVerify = options.InsecureSkipVerify
+	gdlOptions.ContentStore = options.ContentStore
+
 	// Set up progress callback if needed
 	if !cfg.quiet && options.ProgressCallback != nil {
 		gdlOptions.ProgressCallback = func(p gdl.Progress) {
-			options.ProgressCallback(p.BytesDownloaded, p.TotalSize, p.Speed)
+			// The smoothed speed keeps the displayed rate and ETA steady
+			speed := p.SmoothedSpeed
+			if speed == 0 {
+				speed = p.Speed
+			}
+			options.ProgressCallback(p.BytesDownloaded, p.TotalSize, speed)
 		}
 	}
 
 	// Perform the download using enhanced downloader
-	_, err := downloader.Download(ctx, url, outputFile, gdlOptions)
-	return err
+	stats, err := downloader.Download(ctx, url, outputFile, gdlOptions)
+	return convertPublicStats(stats), err
+}
+
+// convertPublicStats converts public gdl.DownloadStats to internal types.DownloadStats.
+func convertPublicStats(stats *gdl.DownloadStats) *types.DownloadStats {
+	if stats == nil {
+		return nil
+	}
+
+	return &types.DownloadStats{
+		URL:             stats.URL,
+		Filename:        stats.Filename,
+		TotalSize:       stats.TotalSize,
+		BytesDownloaded: stats.BytesDownloaded,
+		StartTime:       stats.StartTime,
+		EndTime:         stats.EndTime,
+		Duration:        stats.Duration,
+		AverageSpeed:    stats.AverageSpeed,
+		Retries:         stats.Retries,
+		Success:         stats.Success,
+		Error:           stats.Error,
+		Resumed:         stats.Resumed,
+		NotModified:     stats.NotModified,
+		Deduplicated:    stats.Deduplicated,
+		DeltaReused:     stats.DeltaReused,
+		Skipped:         stats.Skipped,
+		ChunksUsed:      stats.ChunksUsed,
+		Connections:     stats.Connections,
+		RangeViolations: stats.RangeViolations,
+		RangeFallback:   stats.RangeFallback,
+		Plan:            stats.Plan,
+	}
 }
 
 // showPluginUsage shows plugin command usage
@@ -1287,14 +2710,26 @@ Usage: %s plugin <command> [args]
 Commands:
   list                     List all installed plugins
   install <source> <name>  Install a plugin from source
+  install <name>[@<constraint>]  Install a plugin from the plugin index
+  update [name...]        Update plugins installed from the plugin index
+  search [query]          Search the plugin index
+  info <name>             Show a plugin and its declared capabilities
   remove <name>           Remove an installed plugin
   enable <name>           Enable a plugin
   disable <name>          Disable a plugin
   config <name> --set <key>=<value>  Configure a plugin
+  config <name> --set-secret <key>[=<value>]  Configure a plugin, keeping the value in the keychain
+
+Index Options:
+  --index URL|FILE        Plugin index (default: $GDL_PLUGIN_INDEX)
+  --keyring FILE          Require plugins signed by these OpenPGP keys (default: $GDL_PLUGIN_KEYRING)
 
 Examples:
   %s plugin list
   %s plugin install github.com/user/gdl-plugin-s3 s3
+  %s plugin install --index https://plugins.example.com/index.json s3@^1.2.0
+  %s plugin search storage
+  %s plugin info s3
   %s plugin remove s3
   %s plugin enable oauth2
   %s plugin config oauth2 --set client_id=xxx
@@ -1304,7 +2739,7 @@ Plugin Download Examples:
   %s --storage s3://mybucket/downloads/ https://example.com/file.zip
   %s --storage gcs://bucket/path/ https://example.com/file.zip
 
-`, appName, appName, appName, appName, appName, appName, appName, appName, appName)
+`, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName)
 }
 
 // performDownload executes the download operation.
@@ -1314,7 +2749,7 @@ func performDownload(
 	url, outputFile string,
 	options *types.DownloadOptions,
 	cfg *config,
-) error {
+) (*types.DownloadStats, error) {
 	// Add timeout to context if specified
 	if cfg.timeout > 0 {
 		var cancel context.CancelFunc
@@ -1335,12 +2770,114 @@ func performDownload(
 			if stats.Retries > 0 {
 				fmt.Fprintf(os.Stderr, "  Retries: %d\n", stats.Retries)
 			}
+
+			printTransferPlan(stats.Plan, stats.BytesDownloaded)
+			printConnectionStats(stats.Connections)
 		}
 
-		return err
+		return stats, err
 	}
 
-	return nil
+	return stats, nil
+}
+
+// performStdoutDownload writes the content of url to stdout.
+func performStdoutDownload(
+	ctx context.Context,
+	downloader *core.Downloader,
+	url string,
+	options *types.DownloadOptions,
+	cfg *config,
+) (*types.DownloadStats, error) {
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	if cfg.recompress == "" {
+		return downloader.DownloadToWriter(ctx, url, os.Stdout, options)
+	}
+
+	recompressor, err := plugin.NewRecompressor(cfg.recompress)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pipeline := plugin.NewTransformPipeline(recompressor).Writer(ctx, os.Stdout)
+
+	stats, err := downloader.DownloadToWriter(ctx, url, pipeline, options)
+	if err != nil {
+		// Stop the transform rather than flushing a partial download
+		cancel()
+	}
+
+	if closeErr := pipeline.Close(); err == nil {
+		err = closeErr
+	}
+
+	return stats, err
+}
+
+// printTransferPlan prints how a download split into pieces was fetched to
+// stderr: its pieces and the range requests they were coalesced into, out of
+// the bytes it downloaded.
+func printTransferPlan(plan *types.TransferPlan, bytes int64) {
+	if plan == nil || plan.Requests == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Plan: %d pieces of %s from %d source(s), fetched in %d requests (%s avg)\n",
+		plan.Pieces, formatBytes(plan.PieceSize), plan.Sources, plan.Requests, formatBytes(bytes/int64(plan.Requests)))
+}
+
+// printConnectionStats prints the per-connection breakdown of a download to
+// stderr, to spot a slow mirror or CDN node serving part of the file.
+func printConnectionStats(connections []types.ConnectionStats) {
+	if len(connections) == 0 {
+		return
+	}
+
+	table := formatter.NewTableFormatter([]string{"Conn", "Range", "Server", "Bytes", "Requests", "Duration", "Speed", "Retries"})
+
+	for _, conn := range connections {
+		byteRange := fmt.Sprintf("%d-", conn.RangeStart)
+		if conn.RangeEnd >= 0 {
+			byteRange += fmt.Sprintf("%d", conn.RangeEnd)
+		}
+
+		server := conn.ServerIP
+		if parsed, err := url.Parse(conn.URL); err == nil && parsed.Host != "" {
+			server = parsed.Host
+		}
+		if server == "" {
+			server = "-"
+		}
+
+		// Multi-source entries show how large their requests were on average
+		requests := "1"
+		if conn.Requests > 0 {
+			requests = fmt.Sprintf("%d (%s avg)", conn.Requests, formatBytes(conn.BytesDownloaded/int64(conn.Requests)))
+		}
+
+		table.AddRow([]string{
+			fmt.Sprintf("%d", conn.Index),
+			byteRange,
+			server,
+			formatBytes(conn.BytesDownloaded),
+			requests,
+			conn.Duration.Round(time.Millisecond).String(),
+			formatBytes(conn.Speed) + "/s",
+			fmt.Sprintf("%d", conn.Retries),
+		})
+	}
+
+	fmt.Fprintln(os.Stderr, "Connections:")
+	fmt.Fprintln(os.Stderr, table.Format())
 }
 
 // handleError processes and displays errors in a user-friendly way.
@@ -1359,6 +2896,7 @@ func handleError(err error, cfg *config) {
 		ShowSuggestions: true,
 		ShowTimestamp:   cfg.verbose,
 		MultiLine:       true,
+		ShowResponse:    cfg.verbose,
 	}
 
 	formattedError := formatter.FormatError(err, errorOptions)
@@ -1371,8 +2909,17 @@ func handleError(err error, cfg *config) {
 
 // extractFilenameFromURL extracts a filename from a URL.
 const (
-	defaultFilename = "download"
-	autoValue       = "auto"
+	defaultFilename    = "download"
+	autoValue          = "auto"
+	outputFormatNDJSON = "ndjson"
+	outputFormatJSON   = "json"
+	stdoutOutput       = "-"
+
+	retryBackoffExponential = "exponential"
+	retryBackoffConstant    = "constant"
+	defaultRetryMaxDelay    = 30 * time.Second
+
+	maxWriteBufferSize = 1024 * 1024 * 1024
 )
 
 func extractFilenameFromURL(rawURL string) string {
@@ -1398,7 +2945,8 @@ func extractFilenameFromURL(rawURL string) string {
 		return defaultFilename
 	}
 
-	return filename
+	// The unescaped path may hold characters or names Windows doesn't allow
+	return validation.SanitizeFilename(filename)
 }
 
 // formatBytes formats byte counts in human-readable format.
@@ -1425,15 +2973,87 @@ func showUsage() {
 	fmt.Printf(`%s - A simple and efficient download tool
 
 Usage: %s [OPTIONS] URL
-       %s plugin <command> [args]
+       %s [--no-color] [--language LANG] <command> [args]
+
+Commands:
+  get [OPTIONS] URL       Download a URL; "%s URL" is short for "%s get URL"
+  batch <file>            Download the URLs listed in a file (- for stdin)
+  mirror <url>            Download every file under an index page or S3 prefix
+  resume [file]           List interrupted downloads, or resume one
+  watch <url>             Download a URL whenever it changes
+  schedule <command>      Manage scheduled downloads
+  daemon [--once]         Run scheduled downloads in the foreground
+  agent --root DIR        Download jobs sent by cluster coordinators
+  cluster <file|url>      Spread a batch or one large file across agents
+  stats                   Show the bandwidth used per day and host
+  history [list|search]   List or search completed downloads
+  redo <id>               Download a URL from the history again
+  plugin <command>        Manage plugins
+  config <command>        Show and edit the configuration file
+  interactive             Build a download step by step
+  completion <shell>      Generate a shell completion script
+  help [command]          Show help for a command
 
 Download Options:
-  -o, --output FILE        Output filename (default: extract from URL)
+  -o, --output FILE        Output filename (default: extract from URL, - for stdout)
+      --output-template T  Name the output from a template, e.g. {host}/{path}/{filename}
+                          (also {path:N}, {name}, {ext}, {date}, {time}, {index:W})
       --user-agent STRING  User-Agent string to use (default: gdl/%s)
       --timeout DURATION   Download timeout (default: 30m)
   -f, --force             Overwrite existing files
+      --if-exists POLICY  What to do with an existing file: fail, overwrite, skip,
+                          rename (save as NAME-1.EXT) or resume
       --create-dirs       Create parent directories if they don't exist
       --resume            Resume partial downloads if supported
+      --resume-validation P  When the file changed on the server since the partial
+                          download started: restart (default), strict or ignore
+  -N, --timestamping      Only download if the server file is newer than the local one
+      --range RANGE       Download only a byte range (e.g., bytes=0-1048575, 500-, -500)
+  -X, --method METHOD     HTTP method of the request (default: GET, or POST with --data)
+  -d, --data DATA         Send DATA as the request body; @FILE sends the content of FILE
+  -e, --referer URL       Send URL as the Referer header
+      --compressed        Ask for a gzip, deflate or zstd response and save it decompressed
+      --fail-with-body    On an HTTP error, save the response body to the output and
+                          still exit with an error
+  -L, --location          Follow redirects (always on; accepted for curl compatibility)
+      --max-redirects N   Follow at most N redirects (default and maximum: 10;
+                          also --max-redirs)
+  -g, --globoff           Do not expand {a,b} sets and [1-100] ranges in the URL
+      --expand-dry-run    Print the URLs a pattern expands to and exit
+      --dry-run           Show the final URL, file name, size, range support and
+                          time at --max-rate without downloading
+      --no-atomic         Write directly to the destination (no .gdl-part file)
+      --temp-dir DIR      Directory for .gdl-part files (default: destination dir)
+      --no-remote-time    Keep the download time as the file's mtime (default: Last-Modified)
+      --chmod MODE        Set the downloaded file's permission bits (octal, e.g. 755)
+      --xattr             Record the source URL and SHA-256 in extended attributes
+      --direct-io         Write large files with direct I/O, bypassing the page cache
+      --write-buffer SIZE Write buffer size for large files (e.g., 8MB)
+      --min-free-space SIZE  Stop when free disk space falls below SIZE, keeping
+                          the partial file for --resume (e.g., 2GB)
+      --cache-dir DIR     Cache downloads in DIR, revalidated with ETag/Last-Modified
+      --no-cache          Bypass the download cache
+      --content-store DIR Reuse identical downloads from a content-addressable store
+      --content-sha256 HASH  Expected SHA-256, placed from the store without a request
+      --content-store-link   Hard-link files from the content store instead of copying
+      --quota SIZE        Cap the total size of the output (or --quota-dir) directory
+      --quota-dir DIR     Directory the quota applies to, e.g. the --cache-dir
+      --quota-policy POLICY  refuse (default), oldest or lru: evict files to make room
+      --checksum HASH     Verify the download against a hex digest
+      --checksum-algo ALGO  Algorithm of --checksum: md5, sha1, sha256 (default),
+                          sha512, blake3 or xxh3 (fast for very large files)
+      --signature FILE    Verify against a detached OpenPGP signature (.asc/.sig, path or URL)
+      --keyring FILE      Public keys trusted to sign the download (armored or binary)
+      --clamd ADDR        Scan downloads with a ClamAV daemon (host:port or socket path)
+      --scan-cmd CMD      Scan downloads with a command; {} is the file, exit 1 = infected
+      --quarantine DIR    Move files failing the scan here instead of deleting them
+      --zsync FILE        Update the existing file from a zsync control file (path or
+                          URL; auto = URL.zsync), downloading only changed blocks
+      --zsync-seed FILE   Reuse blocks from FILE instead of the output file
+      --recompress CODEC  Store the file as zstd or gzip, or decompressed (none),
+                          transcoding gzip/zstd/bzip2 downloads as they stream in
+      --tee TARGET        Also write the download to a file, directory, s3:// or
+                          gs:// location in the same pass (repeatable)
   -q, --quiet             Quiet mode (no progress output)
   -v, --verbose           Verbose output
       --concurrent N      Number of concurrent connections (default: 4, max: 32)
@@ -1441,12 +3061,58 @@ Download Options:
                           Examples: 1MB, 512KB, 2GB
       --max-rate RATE     Maximum download rate (0 = unlimited)
                           Examples: 1MB/s, 500k, 2048
+      --min-rate RATE     Abort and retry when slower than RATE for --min-rate-time
+      --min-rate-time DURATION  Window for --min-rate (default: 30s); alone,
+                          abort after this long without receiving data
       --no-concurrent     Force single-threaded download
+      --mirror URL        Fetch pieces of the file from this mirror at the same time
+                          (can be used multiple times)
+      --mirror-strategy S Which mirrors to use after probing them all at once:
+                          ordered (default), fastest or random
+      --max-mirrors N     Use at most N mirrors (default: all)
+      --stream-order      Fetch pieces in order from the beginning of the file, so a
+                          player can start reading it while the rest downloads
+      --per-host N        Maximum connections to one host (default: unlimited)
+      --host-delay D      Minimum delay between requests to the same host (e.g., 500ms)
+      --circuit-breaker N Stop requesting a host after N consecutive failures (default: off)
+      --circuit-cooldown D
+                          How long a failing host is skipped before a retry (default: 30s)
       --no-color          Disable colored output
       --interactive       Enable interactive prompts (default: auto-detect)
       --check-connectivity Check network connectivity before download
       --check-space       Check available disk space before download (default: true)
-      --language LANG     Language for messages (en, ja, es, fr, default: en)
+      --retry N           Number of retry attempts (default: 3)
+      --retry-delay DURATION  Initial delay between retries (default: 1s)
+      --retry-backoff TYPE    Retry backoff: exponential (jittered) or constant
+      --retry-max-time DURATION  Stop retrying after this much total time
+  -k, --insecure          Skip SSL certificate verification (prefer --cacert)
+      --cacert FILE       Trust the CA certificates in this PEM bundle
+      --cert FILE         Client certificate for mutual TLS (PEM)
+      --key FILE          Private key for --cert (PEM)
+      --pinnedpubkey HASHES  Require a server key matching sha256//BASE64 (';'-separated)
+      --proxy URL         Proxy for all requests (http, https, socks5 or socks5h)
+      --http-proxy URL    Proxy for http:// requests
+      --https-proxy URL   Proxy for https:// requests
+      --no-proxy LIST     Comma-separated hosts, domains and CIDRs to reach directly
+      --proxy-user USER:PASS  Proxy credentials
+      --credential-helper CMD  Ask this git-style credential helper for each host's credentials
+      --dns-servers LIST  Comma-separated DNS servers (e.g. 1.1.1.1,8.8.8.8:53)
+      --doh-url URL       Resolve host names via DNS-over-HTTPS
+  -4, --ipv4              Connect over IPv4 only
+  -6, --ipv6              Connect over IPv6 only
+      --resolve HOST:PORT:ADDR  Use ADDR for HOST:PORT (can be used multiple times)
+      --language LANG     Language for messages (en, ja, es, fr, or a file in
+                          ~/.gdl/locales; default: auto, from LC_ALL/LC_MESSAGES/LANG)
+      --output-format FMT Output format (auto|json|yaml|ndjson)
+                          json writes a result document when the download ends,
+                          ndjson writes start/progress/retry/error/complete events
+      --events-file FILE  Write the json result or ndjson events to FILE (default: stdout)
+      --trace             Trace requests, TLS handshakes, redirects and responses
+                          to stderr, with credentials redacted and bodies elided
+      --trace-ascii FILE  Write the trace to FILE instead (- for stderr)
+      --trace-bodies      Show the start of request and response bodies in the trace
+      --har FILE          Record every request and response of the session to FILE
+                          in HAR format, for browser devtools and HAR viewers
       --version           Show version information
   -h, --help              Show this help message
 
@@ -1459,10 +3125,68 @@ Plugin Options:
 Plugin Commands:
   plugin list             List all installed plugins
   plugin install <source> <name>  Install a plugin
+  plugin install <name>[@<constraint>]  Install a plugin from the plugin index
+  plugin update [name...] Update plugins installed from the plugin index
+  plugin search [query]   Search the plugin index
   plugin remove <name>    Remove a plugin
   plugin enable <name>    Enable a plugin
   plugin disable <name>   Disable a plugin
   plugin config <name> --set <key>=<value>  Configure a plugin
+  plugin config <name> --set-secret <key>[=<value>]  Configure a plugin, keeping the value in the keychain
+
+Schedule Commands:
+  schedule add "<cron>" <url> [-o <path>]  Download url on a cron schedule
+  schedule list           List scheduled downloads
+  schedule remove <id>    Remove a scheduled download
+  schedule run [--once]   Run scheduled downloads as they become due
+
+Batch Command:
+  batch <file> [-o DIR] [--jobs N] [--per-host N] [--if-exists POLICY]
+                          Download one URL (and optional destination) per line
+
+Resume Command:
+  resume                  List interrupted downloads
+  resume <file> [OPTIONS] Continue the download of file
+
+Daemon Command:
+  daemon [--once] [--webhook URL] [--ui ADDR]
+                          Run scheduled downloads as they become due
+  daemon users <add|list|remove>
+                          Manage the users of a shared daemon and their quotas
+
+Cluster Commands:
+  agent --root DIR [--listen ADDR] [--token TOKEN]
+                          Download the jobs coordinators send into DIR
+  cluster <file|url> --agents URL[,URL...] [-o DIR]
+                          Spread the files of a batch, or pieces of one file,
+                          across agents writing into a shared directory
+
+Stats Command:
+  stats [--days N] [--top N] [--json]  Show bytes downloaded, top hosts and average speeds
+  stats --reset           Delete the recorded usage
+
+History Commands:
+  history [--limit N]     List the most recent downloads with their IDs
+  history search QUERY    List downloads whose URL or path contains QUERY
+  redo <id> [OPTIONS]     Download the URL of history entry id to the same file
+
+Config Commands:
+  config path|show|init|validate  Locate, print, create or check the config file
+  config get KEY          Print one setting, e.g. network.max_redirects
+  config set KEY VALUE    Change one setting
+
+Watch Command:
+  watch <url> [--interval 5m] [-o FILE] [--exec CMD]  Download url whenever it changes
+
+Mirror Command:
+  mirror <url> [-o DIR] [--include GLOB] [--exclude GLOB] [--depth N] [--dry-run]
+                          Download every file under an index page or S3 prefix
+
+Interactive Command:
+  interactive             Build a download step by step and print the equivalent command
+
+Completion Command:
+  completion SHELL        Print a completion script for bash, zsh, fish or powershell
 
 Download Examples:
   %s https://example.com/file.zip                              # Basic download
@@ -1471,6 +3195,10 @@ Download Examples:
   %s --max-rate 1MB/s https://example.com/large-file.zip      # Limit to 1MB/s
   %s --plugin oauth2 https://api.example.com/secure/file.zip  # Use OAuth2 plugin
   %s --storage s3://mybucket/downloads/ https://example.com/file.zip  # Save to S3
+  %s -o "img_#1.jpg" "https://example.com/photos/[001-100].jpg"  # Download a numbered sequence
+  %s --range bytes=0-1048575 -o - https://example.com/data.bin | xxd | head  # Inspect the first 1MB
+  %s -d @query.json -o report.csv https://api.example.com/export  # POST a JSON body
+  %s --output-template "{host}/{date}/{filename}" https://example.com/data.csv  # Organize by host and date
 
 Plugin Management Examples:
   %s plugin list                                              # List installed plugins
@@ -1478,5 +3206,5 @@ Plugin Management Examples:
   %s plugin enable oauth2                                     # Enable OAuth2 plugin
   %s plugin config oauth2 --set client_id=xxx                # Configure plugin
 
-`, appName, appName, appName, appName, version, appName, appName, appName, appName, appName, appName, appName, appName, appName)
+`, appName, appName, appName, appName, appName, version, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName)
 }
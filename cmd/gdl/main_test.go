@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -22,8 +24,18 @@ import (
 	"github.com/forest6511/gdl/pkg/ratelimit"
 	"github.com/forest6511/gdl/pkg/types"
 	"github.com/forest6511/gdl/pkg/ui"
+	"github.com/forest6511/gdl/pkg/validation"
 )
 
+// TestMain keeps the downloads of the tests out of the user's usage file and
+// history.
+func TestMain(m *testing.M) {
+	_ = os.Setenv(usageFileEnv, "off")
+	_ = os.Setenv(historyFileEnv, "off")
+	_ = os.Setenv(hostCacheEnv, "off")
+	os.Exit(m.Run())
+}
+
 func TestParseArgs(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -888,7 +900,7 @@ func TestPerformDownloadFunction(t *testing.T) {
 			outputFile := fmt.Sprintf("test_%s.txt", strings.ReplaceAll(tt.name, " ", "_"))
 			defer func() { _ = os.Remove(outputFile) }()
 
-			err := performDownload(ctx, downloader, server.URL, outputFile, options, cfg)
+			_, err := performDownload(ctx, downloader, server.URL, outputFile, options, cfg)
 
 			if tt.expectError {
 				if err == nil {
@@ -1589,7 +1601,7 @@ func TestMainErrorPaths(t *testing.T) {
 		}
 
 		// Test with invalid URL to trigger error
-		err := performDownload(ctx, downloader, "invalid://url", "test.txt", options, cfg)
+		_, err := performDownload(ctx, downloader, "invalid://url", "test.txt", options, cfg)
 		if err == nil {
 			t.Error("Expected error for invalid URL")
 		}
@@ -1781,7 +1793,7 @@ func TestSignalHandlingPaths(t *testing.T) {
 		}
 
 		// This should hit the cancelled context path
-		err := performDownload(ctx, downloader, "http://example.com", "test.txt", options, cfg)
+		_, err := performDownload(ctx, downloader, "http://example.com", "test.txt", options, cfg)
 		if err == nil {
 			t.Log("Expected some error due to cancelled context")
 		}
@@ -2455,6 +2467,10 @@ func TestInitializeFormatter(t *testing.T) {
 				t.Error("Expected formatted message to be non-empty")
 			}
 
+			if got := string(formatter.Language()); got != tt.expectLang {
+				t.Errorf("formatter language = %q, want %q", got, tt.expectLang)
+			}
+
 			// Test language-specific functionality by checking localized content
 			errorMessage := formatter.FormatMessage(ui.MessageError, "test error")
 			if errorMessage == "" {
@@ -2663,7 +2679,7 @@ func TestPerformDownloadEdgeCases(t *testing.T) {
 		}
 
 		// This should timeout quickly or fail due to invalid URL
-		err := performDownload(ctx, downloader, "http://192.0.2.0:1", "/tmp/test", options, cfg)
+		_, err := performDownload(ctx, downloader, "http://192.0.2.0:1", "/tmp/test", options, cfg)
 		if err == nil {
 			// It's ok if it doesn't timeout in test environment
 			t.Log("Download completed faster than expected timeout")
@@ -2702,7 +2718,7 @@ func TestPerformDownloadEdgeCases(t *testing.T) {
 		go func() {
 			defer func() { done <- true }()
 			// Use an invalid URL to force an error
-			performErr = performDownload(
+			_, performErr = performDownload(
 				context.Background(),
 				downloader,
 				"http://192.0.2.0:1/nonexistent",
@@ -3295,6 +3311,77 @@ func TestRunPluginCommand(t *testing.T) {
 	}
 }
 
+func TestParsePluginIndexOptions(t *testing.T) {
+	t.Setenv("GDL_PLUGIN_INDEX", "https://env.example.com/index.json")
+	t.Setenv("GDL_PLUGIN_KEYRING", "")
+
+	rest, index, keyring, err := parsePluginIndexOptions([]string{"install", "--keyring", "keys.gpg", "s3@^1.0.0"})
+	if err != nil {
+		t.Fatalf("parsePluginIndexOptions() error = %v", err)
+	}
+	if strings.Join(rest, " ") != "install s3@^1.0.0" {
+		t.Errorf("rest = %v, want [install s3@^1.0.0]", rest)
+	}
+	if index != "https://env.example.com/index.json" || keyring != "keys.gpg" {
+		t.Errorf("index, keyring = %q, %q", index, keyring)
+	}
+
+	_, index, _, err = parsePluginIndexOptions([]string{"search", "--index", "index.json"})
+	if err != nil || index != "index.json" {
+		t.Errorf("parsePluginIndexOptions() = %q, %v, want --index to override the environment", index, err)
+	}
+
+	if _, _, _, err := parsePluginIndexOptions([]string{"search", "--index"}); err == nil {
+		t.Error("Expected error for --index without a value")
+	}
+}
+
+func TestRunPluginCommandSearch(t *testing.T) {
+	index := filepath.Join(t.TempDir(), "index.json")
+	data := `{"plugins":[{"name":"s3","description":"S3 storage","releases":[{"version":"1.0.0"}]}]}`
+	if err := os.WriteFile(index, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runPluginCommand([]string{"search", "--index", index, "storage"}); code != 0 {
+		t.Errorf("plugin search exit code = %d, want 0", code)
+	}
+
+	if code := runPluginCommand([]string{"search", "--index", filepath.Join(t.TempDir(), "missing.json")}); code == 0 {
+		t.Error("Expected non-zero exit code for a missing index")
+	}
+}
+
+func TestRunPluginCommandInfo(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	pluginPath := filepath.Join(home, ".gdl", "plugins", "s3.so")
+	config := `{"plugins":{"s3":{"name":"s3","version":"1.0.0","type":"storage","path":"` + pluginPath + `","enabled":true}}}`
+	if err := os.MkdirAll(filepath.Dir(pluginPath), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".gdl", "plugins.json"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"name":"s3","capabilities":{"network":["*.amazonaws.com"],"env":["AWS_*"]}}`
+	if err := os.WriteFile(filepath.Join(home, ".gdl", "plugins", "s3.manifest.json"), []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runPluginCommand([]string{"info", "s3"}); code != 0 {
+		t.Errorf("plugin info exit code = %d, want 0", code)
+	}
+
+	if code := runPluginCommand([]string{"info", "missing"}); code == 0 {
+		t.Error("Expected non-zero exit code for a missing plugin")
+	}
+
+	if code := runPluginCommand([]string{"info"}); code == 0 {
+		t.Error("Expected non-zero exit code without a plugin name")
+	}
+}
+
 // Test simpler functions for coverage
 
 func TestStringSlice(t *testing.T) {
@@ -3320,6 +3407,29 @@ func TestValidateChunkSizeAdditional(t *testing.T) {
 	}
 }
 
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{"755", 0o755, false},
+		{"0644", 0o644, false},
+		{"600", 0o600, false},
+		{"0", 0, true},
+		{"1777", 0, true},
+		{"rwx", 0, true},
+		{"888", 0, true},
+	}
+
+	for _, tt := range tests {
+		mode, err := parseFileMode(tt.input)
+		if (err != nil) != tt.wantErr || mode != tt.want {
+			t.Errorf("parseFileMode(%q) = %v, %v, want %v (error %v)", tt.input, mode, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
 func TestParseSizeAdditional(t *testing.T) {
 	// Test additional size parsing
 	size, err := parseSize("2GB")
@@ -3414,7 +3524,7 @@ func TestProgressDisplayAdvanced(t *testing.T) {
 
 func TestBuildProgressBarAdvanced(t *testing.T) {
 	// Test progress bar building
-	bar := buildProgressBar(50.0)
+	bar := buildProgressBar(50.0, 30)
 	if len(bar) == 0 {
 		t.Error("Expected non-empty progress bar")
 	}
@@ -3437,3 +3547,1231 @@ func TestIsTerminal(t *testing.T) {
 	// Just check it doesn't panic
 	_ = result
 }
+
+func TestParseArgsDNSOptions(t *testing.T) {
+	t.Run("resolve_and_ipv4", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+
+		defer func() { os.Args = origArgs }()
+
+		os.Args = []string{
+			"gdl", "-4", "--dns-servers", "1.1.1.1, 8.8.8.8:53",
+			"--resolve", "example.com:443:127.0.0.1",
+			"https://example.com/file.txt",
+		}
+
+		cfg, _, err := parseArgs()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		dns := createDNSOptions(cfg)
+		if dns == nil {
+			t.Fatal("Expected DNS options, got nil")
+		}
+
+		if dns.IPVersion != 4 {
+			t.Errorf("Expected IPVersion 4, got %d", dns.IPVersion)
+		}
+
+		if len(dns.Servers) != 2 || dns.Servers[1] != "8.8.8.8:53" {
+			t.Errorf("Unexpected DNS servers: %v", dns.Servers)
+		}
+
+		if dns.Resolve["example.com:443"] != "127.0.0.1" {
+			t.Errorf("Unexpected resolve entries: %v", dns.Resolve)
+		}
+	})
+
+	t.Run("ipv4_and_ipv6_conflict", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+
+		defer func() { os.Args = origArgs }()
+
+		os.Args = []string{"gdl", "--ipv4", "--ipv6", "https://example.com/file.txt"}
+
+		if _, _, err := parseArgs(); err == nil {
+			t.Error("Expected error for --ipv4 with --ipv6, got nil")
+		}
+	})
+
+	t.Run("invalid_resolve", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+
+		defer func() { os.Args = origArgs }()
+
+		os.Args = []string{"gdl", "--resolve", "example.com:443", "https://example.com/file.txt"}
+
+		if _, _, err := parseArgs(); err == nil {
+			t.Error("Expected error for malformed --resolve, got nil")
+		}
+	})
+
+	t.Run("no_dns_flags", func(t *testing.T) {
+		if dns := createDNSOptions(&config{}); dns != nil {
+			t.Errorf("Expected nil DNS options, got %+v", dns)
+		}
+	})
+}
+
+func TestParseArgsProxyOptions(t *testing.T) {
+	t.Run("socks5_with_no_proxy", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+
+		defer func() { os.Args = origArgs }()
+
+		os.Args = []string{
+			"gdl", "--proxy", "socks5h://127.0.0.1:1080", "--https-proxy", "http://proxy:8080",
+			"--no-proxy", "localhost, .internal", "--proxy-user", "user:p:ss",
+			"https://example.com/file.txt",
+		}
+
+		cfg, _, err := parseArgs()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		proxy := createProxyConfig(cfg)
+		if proxy == nil {
+			t.Fatal("Expected proxy config, got nil")
+		}
+
+		if proxy.URL != "socks5h://127.0.0.1:1080" || proxy.HTTPSURL != "http://proxy:8080" {
+			t.Errorf("Unexpected proxy URLs: %+v", proxy)
+		}
+
+		if len(proxy.NoProxy) != 2 || proxy.NoProxy[1] != ".internal" {
+			t.Errorf("Unexpected no-proxy list: %v", proxy.NoProxy)
+		}
+
+		if proxy.Username != "user" || proxy.Password != "p:ss" {
+			t.Errorf("Unexpected proxy credentials: %q/%q", proxy.Username, proxy.Password)
+		}
+	})
+
+	t.Run("unsupported_scheme", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+
+		defer func() { os.Args = origArgs }()
+
+		os.Args = []string{"gdl", "--proxy", "ftp://proxy:21", "https://example.com/file.txt"}
+
+		if _, _, err := parseArgs(); err == nil {
+			t.Error("Expected error for unsupported proxy scheme, got nil")
+		}
+	})
+
+	t.Run("no_proxy_flags", func(t *testing.T) {
+		if proxy := createProxyConfig(&config{}); proxy != nil {
+			t.Errorf("Expected nil proxy config, got %+v", proxy)
+		}
+	})
+}
+
+func TestParseArgsTLSOptions(t *testing.T) {
+	t.Run("pinned_keys", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+
+		defer func() { os.Args = origArgs }()
+
+		pin := "sha256//" + strings.Repeat("A", 43) + "="
+		os.Args = []string{"gdl", "--pinnedpubkey", pin + ";" + pin, "https://example.com/file.txt"}
+
+		cfg, _, err := parseArgs()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		tlsOptions := createTLSOptions(cfg)
+		if tlsOptions == nil || len(tlsOptions.PinnedPublicKeys) != 2 {
+			t.Errorf("Unexpected TLS options: %+v", tlsOptions)
+		}
+	})
+
+	t.Run("missing_ca_file", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+
+		defer func() { os.Args = origArgs }()
+
+		os.Args = []string{
+			"gdl", "--cacert", t.TempDir() + "/missing.pem", "https://example.com/file.txt",
+		}
+
+		if _, _, err := parseArgs(); err == nil {
+			t.Error("Expected error for missing --cacert file, got nil")
+		}
+	})
+
+	t.Run("cert_without_key", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+
+		defer func() { os.Args = origArgs }()
+
+		os.Args = []string{"gdl", "--cert", "client.pem", "https://example.com/file.txt"}
+
+		if _, _, err := parseArgs(); err == nil {
+			t.Error("Expected error for --cert without --key, got nil")
+		}
+	})
+}
+
+func TestParseArgsTimestamping(t *testing.T) {
+	for _, flagName := range []string{"-N", "--timestamping"} {
+		t.Run(flagName, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = []string{"gdl", flagName, "https://example.com/file.txt"}
+
+			cfg, _, err := parseArgs()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if options := createDownloadOptions(cfg); !options.OnlyIfNewer {
+				t.Error("Expected OnlyIfNewer to be set")
+			}
+		})
+	}
+}
+
+func TestParseArgsTrace(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantFile   string
+		wantBodies bool
+	}{
+		{"off", []string{}, "", false},
+		{"stderr", []string{"--trace"}, "-", false},
+		{"file", []string{"--trace-ascii", "trace.txt", "--trace-bodies"}, "trace.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = append(append([]string{"gdl"}, tt.args...), "https://example.com/file.txt")
+
+			cfg, _, err := parseArgs()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if cfg.traceFile != tt.wantFile || cfg.traceBodies != tt.wantBodies {
+				t.Errorf("trace = %q, bodies %v; want %q, bodies %v", cfg.traceFile, cfg.traceBodies, tt.wantFile, tt.wantBodies)
+			}
+		})
+	}
+}
+
+func TestParseArgsCacheOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		enabled bool
+	}{
+		{"no cache dir", []string{"gdl", "https://example.com/file.txt"}, false},
+		{"cache dir", []string{"gdl", "--cache-dir", "/tmp/gdl-cache", "https://example.com/file.txt"}, true},
+		{"no-cache wins", []string{"gdl", "--cache-dir", "/tmp/gdl-cache", "--no-cache", "https://example.com/file.txt"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := cacheEnabled(cfg); got != tt.enabled {
+				t.Errorf("cacheEnabled() = %v, want %v", got, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestParseArgsContentStore(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    *types.ContentStoreOptions
+		wantErr bool
+	}{
+		{"disabled", []string{"gdl", "https://example.com/file.txt"}, nil, false},
+		{
+			"store with digest and hard links",
+			[]string{"gdl", "--content-store", "/tmp/cas", "--content-sha256", hash, "--content-store-link", "https://example.com/file.txt"},
+			&types.ContentStoreOptions{Dir: "/tmp/cas", SHA256: hash, HardLink: true},
+			false,
+		},
+		{"digest without store", []string{"gdl", "--content-sha256", hash, "https://example.com/file.txt"}, nil, true},
+		{"invalid digest", []string{"gdl", "--content-store", "/tmp/cas", "--content-sha256", "xyz", "https://example.com/file.txt"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			got := createDownloadOptions(cfg).ContentStore
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("ContentStore = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsByteRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    *types.ByteRange
+		wantErr bool
+	}{
+		{"disabled", []string{"gdl", "https://example.com/file.bin"}, nil, false},
+		{"first MiB", []string{"gdl", "--range", "bytes=0-1048575", "https://example.com/file.bin"}, &types.ByteRange{Start: 0, End: 1048575}, false},
+		{"suffix", []string{"gdl", "--range", "-500", "https://example.com/file.bin"}, &types.ByteRange{Start: -500, End: -1}, false},
+		{"invalid", []string{"gdl", "--range", "bytes=10-5", "https://example.com/file.bin"}, nil, true},
+		{"with resume", []string{"gdl", "--range", "0-99", "--resume", "https://example.com/file.bin"}, nil, true},
+		{"with timestamping", []string{"gdl", "--range", "0-99", "-N", "https://example.com/file.bin"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			got := createDownloadOptions(cfg).ByteRange
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("ByteRange = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsRequestBody(t *testing.T) {
+	bodyFile := filepath.Join(t.TempDir(), "query.json")
+	if err := os.WriteFile(bodyFile, []byte(`{"q":1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		method   string
+		body     string
+		bodyFile string
+		wantErr  bool
+	}{
+		{"plain GET", []string{"gdl", "https://example.com/export"}, "", "", "", false},
+		{"data implies POST", []string{"gdl", "-d", "q=1", "https://example.com/export"}, "POST", "q=1", "", false},
+		{"data from file", []string{"gdl", "--data", "@" + bodyFile, "https://example.com/export"}, "POST", "", bodyFile, false},
+		{"explicit method", []string{"gdl", "-X", "PUT", "-d", "x", "https://example.com/export"}, "PUT", "x", "", false},
+		{"missing body file", []string{"gdl", "-d", "@" + bodyFile + ".missing", "https://example.com/export"}, "", "", "", true},
+		{"invalid method", []string{"gdl", "-X", "GET ME", "https://example.com/export"}, "", "", "", true},
+		{"with timestamping", []string{"gdl", "-d", "x", "-N", "https://example.com/export"}, "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			options := createDownloadOptions(cfg)
+			if options.Method != tt.method || string(options.Body) != tt.body || options.BodyFile != tt.bodyFile {
+				t.Errorf("Method = %q, Body = %q, BodyFile = %q, want %q, %q, %q",
+					options.Method, options.Body, options.BodyFile, tt.method, tt.body, tt.bodyFile)
+			}
+		})
+	}
+}
+
+func TestRunOutputTemplate(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	code := run([]string{"gdl", "-q", "--output-template", dir + "/{path}/{filename}", server.URL + "/api/v2/status"})
+	if code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	// Parent directories are created, and the extension comes from the Content-Type
+	if _, err := os.Stat(filepath.Join(dir, "api", "v2", "status.json")); err != nil {
+		t.Errorf("templated output not written: %v", err)
+	}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	if code := run([]string{"gdl", "-o", "x", "--output-template", "{filename}", server.URL}); code != 1 {
+		t.Errorf("run() with -o and --output-template = %d, want 1", code)
+	}
+}
+
+func TestRunRangeToStdout(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	content := []byte("0123456789abcdefghij")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	code := run([]string{"gdl", "--range", "bytes=5-9", "-o", "-", server.URL + "/file.bin"})
+
+	_ = w.Close()
+	os.Stdout = oldStdout
+
+	output, _ := io.ReadAll(r)
+	if code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	if string(output) != "56789" {
+		t.Errorf("stdout = %q, want %q", output, "56789")
+	}
+}
+
+func TestParseArgsAtomicWrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantAtomic  bool
+		wantTempDir string
+		wantErr     bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.txt"}, true, "", false},
+		{"temp dir", []string{"gdl", "--temp-dir", "/tmp/parts", "https://example.com/file.txt"}, true, "/tmp/parts", false},
+		{"no atomic", []string{"gdl", "--no-atomic", "https://example.com/file.txt"}, false, "", false},
+		{"conflict", []string{"gdl", "--no-atomic", "--temp-dir", "/tmp/parts", "https://example.com/file.txt"}, false, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			options := createDownloadOptions(cfg)
+			if options.AtomicWrite != tt.wantAtomic || options.TempDir != tt.wantTempDir {
+				t.Errorf("AtomicWrite, TempDir = %v, %q, want %v, %q",
+					options.AtomicWrite, options.TempDir, tt.wantAtomic, tt.wantTempDir)
+			}
+		})
+	}
+}
+
+func TestParseArgsMirrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantMirrors []string
+		wantErr     bool
+	}{
+		{"none", []string{"gdl", "https://example.com/file.iso"}, nil, false},
+		{"two mirrors", []string{"gdl", "--mirror", "https://a.example.org/file.iso", "--mirror", " http://b.example.net/file.iso ",
+			"https://example.com/file.iso"}, []string{"https://a.example.org/file.iso", "http://b.example.net/file.iso"}, false},
+		{"not http", []string{"gdl", "--mirror", "ftp://a.example.org/file.iso", "https://example.com/file.iso"}, nil, true},
+		{"no host", []string{"gdl", "--mirror", "https:///file.iso", "https://example.com/file.iso"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if options := createDownloadOptions(cfg); !reflect.DeepEqual(options.Mirrors, tt.wantMirrors) {
+				t.Errorf("Mirrors = %q, want %q", options.Mirrors, tt.wantMirrors)
+			}
+		})
+	}
+}
+
+func TestParseArgsResumeValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{"default", []string{"gdl", "--resume", "https://example.com/file.iso"}, "", false},
+		{"strict", []string{"gdl", "--resume", "--resume-validation", "strict", "https://example.com/file.iso"},
+			types.ResumeStrict, false},
+		{"unknown", []string{"gdl", "--resume-validation", "lenient", "https://example.com/file.iso"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if options := createDownloadOptions(cfg); options.ResumeValidation != tt.want {
+				t.Errorf("ResumeValidation = %q, want %q", options.ResumeValidation, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsMirrorStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		strategy string
+		limit    int
+		wantErr  bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.iso"}, "", 0, false},
+		{"fastest two", []string{"gdl", "--mirror-strategy", "fastest", "--max-mirrors", "2", "https://example.com/file.iso"},
+			types.MirrorFastest, 2, false},
+		{"unknown strategy", []string{"gdl", "--mirror-strategy", "nearest", "https://example.com/file.iso"}, "", 0, true},
+		{"negative limit", []string{"gdl", "--max-mirrors", "-1", "https://example.com/file.iso"}, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			options := createDownloadOptions(cfg)
+			if options.MirrorStrategy != tt.strategy || options.MaxMirrors != tt.limit {
+				t.Errorf("MirrorStrategy = %q, MaxMirrors = %d, want %q, %d",
+					options.MirrorStrategy, options.MaxMirrors, tt.strategy, tt.limit)
+			}
+		})
+	}
+}
+
+func TestParseArgsStreamOrder(t *testing.T) {
+	for _, streamOrder := range []bool{false, true} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+		os.Args = []string{"gdl", "https://example.com/movie.mkv"}
+		if streamOrder {
+			os.Args = []string{"gdl", "--stream-order", "https://example.com/movie.mkv"}
+		}
+
+		cfg, _, err := parseArgs()
+		os.Args = origArgs
+
+		if err != nil {
+			t.Fatalf("parseArgs() error = %v", err)
+		}
+
+		if options := createDownloadOptions(cfg); options.StreamOrder != streamOrder {
+			t.Errorf("StreamOrder = %v, want %v", options.StreamOrder, streamOrder)
+		}
+	}
+}
+
+func TestParseArgsHostLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantLimits *types.HostLimitPolicy
+		wantErr    bool
+	}{
+		{"none", []string{"gdl", "https://example.com/file.iso"}, nil, false},
+		{"both", []string{"gdl", "--per-host", "2", "--host-delay", "500ms", "https://example.com/file.iso"},
+			&types.HostLimitPolicy{MaxConnections: 2, Delay: 500 * time.Millisecond}, false},
+		{"delay only", []string{"gdl", "--host-delay", "1s", "https://example.com/file.iso"},
+			&types.HostLimitPolicy{Delay: time.Second}, false},
+		{"negative limit", []string{"gdl", "--per-host", "-1", "https://example.com/file.iso"}, nil, true},
+		{"negative delay", []string{"gdl", "--host-delay", "-1s", "https://example.com/file.iso"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if options := createDownloadOptions(cfg); !reflect.DeepEqual(options.HostLimits, tt.wantLimits) {
+				t.Errorf("HostLimits = %+v, want %+v", options.HostLimits, tt.wantLimits)
+			}
+		})
+	}
+}
+
+func TestParseArgsCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantBreaker *types.CircuitBreakerPolicy
+		wantErr     bool
+	}{
+		{"none", []string{"gdl", "https://example.com/file.iso"}, nil, false},
+		{"threshold", []string{"gdl", "--circuit-breaker", "3", "https://example.com/file.iso"},
+			&types.CircuitBreakerPolicy{FailureThreshold: 3}, false},
+		{"cool-down", []string{"gdl", "--circuit-breaker", "3", "--circuit-cooldown", "1m", "https://example.com/file.iso"},
+			&types.CircuitBreakerPolicy{FailureThreshold: 3, Cooldown: time.Minute}, false},
+		{"cool-down only", []string{"gdl", "--circuit-cooldown", "1m", "https://example.com/file.iso"}, nil, false},
+		{"negative threshold", []string{"gdl", "--circuit-breaker", "-1", "https://example.com/file.iso"}, nil, true},
+		{"negative cool-down", []string{"gdl", "--circuit-cooldown", "-1s", "https://example.com/file.iso"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if options := createDownloadOptions(cfg); !reflect.DeepEqual(options.CircuitBreaker, tt.wantBreaker) {
+				t.Errorf("CircuitBreaker = %+v, want %+v", options.CircuitBreaker, tt.wantBreaker)
+			}
+		})
+	}
+}
+
+func TestParseArgsWritePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantDirect bool
+		wantBuffer int
+		wantErr    bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.txt"}, false, 0, false},
+		{"direct io", []string{"gdl", "--direct-io", "https://example.com/file.txt"}, true, 0, false},
+		{"write buffer", []string{"gdl", "--write-buffer", "8MB", "https://example.com/file.txt"}, false, 8 * 1024 * 1024, false},
+		{"invalid buffer", []string{"gdl", "--write-buffer", "lots", "https://example.com/file.txt"}, false, 0, true},
+		{"buffer too large", []string{"gdl", "--write-buffer", "2GB", "https://example.com/file.txt"}, false, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			options := createDownloadOptions(cfg)
+			if options.DirectIO != tt.wantDirect || options.WriteBufferSize != tt.wantBuffer {
+				t.Errorf("DirectIO, WriteBufferSize = %v, %d, want %v, %d",
+					options.DirectIO, options.WriteBufferSize, tt.wantDirect, tt.wantBuffer)
+			}
+		})
+	}
+}
+
+func TestParseArgsMinRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantSpeed int64
+		wantTime  time.Duration
+		wantErr   bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.txt"}, 0, 0, false},
+		{"min rate", []string{"gdl", "--min-rate", "50k", "--min-rate-time", "30s", "https://example.com/file.txt"}, 50 * 1024, 30 * time.Second, false},
+		{"stall timeout only", []string{"gdl", "--min-rate-time", "1m", "https://example.com/file.txt"}, 0, time.Minute, false},
+		{"invalid rate", []string{"gdl", "--min-rate", "fast", "https://example.com/file.txt"}, 0, 0, true},
+		{"negative time", []string{"gdl", "--min-rate-time", "-5s", "https://example.com/file.txt"}, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			options := createDownloadOptions(cfg)
+			if options.MinSpeed != tt.wantSpeed || options.StallTimeout != tt.wantTime {
+				t.Errorf("MinSpeed, StallTimeout = %d, %v, want %d, %v",
+					options.MinSpeed, options.StallTimeout, tt.wantSpeed, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestParseArgsQuota(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    *types.QuotaOptions
+		wantErr bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.txt"}, nil, false},
+		{
+			"quota",
+			[]string{"gdl", "--quota", "1GB", "--quota-dir", "/data", "--quota-policy", "lru", "https://example.com/file.txt"},
+			&types.QuotaOptions{Dir: "/data", MaxSize: 1024 * 1024 * 1024, Policy: types.QuotaPolicyLRU},
+			false,
+		},
+		{"invalid size", []string{"gdl", "--quota", "big", "https://example.com/file.txt"}, nil, true},
+		{"unknown policy", []string{"gdl", "--quota", "1GB", "--quota-policy", "fifo", "https://example.com/file.txt"}, nil, true},
+		{"dir without quota", []string{"gdl", "--quota-dir", "/data", "https://example.com/file.txt"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := createDownloadOptions(cfg).Quota; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Quota = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    *types.SignatureOptions
+		wantErr bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.iso"}, nil, false},
+		{
+			"signature",
+			[]string{"gdl", "--signature", "file.iso.asc", "--keyring", "key.gpg", "https://example.com/file.iso"},
+			&types.SignatureOptions{Signature: "file.iso.asc", Keyring: "key.gpg"},
+			false,
+		},
+		{"missing keyring", []string{"gdl", "--signature", "file.iso.asc", "https://example.com/file.iso"}, nil, true},
+		{"keyring only", []string{"gdl", "--keyring", "key.gpg", "https://example.com/file.iso"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := createDownloadOptions(cfg).Signature; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Signature = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsChecksum(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantChecksum  string
+		wantAlgorithm string
+		wantErr       bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.iso"}, "", "", false},
+		{"sha256", []string{"gdl", "--checksum", digest, "https://example.com/file.iso"}, digest, "", false},
+		{
+			"xxh3",
+			[]string{"gdl", "--checksum", "0123456789abcdef", "--checksum-algo", "xxh3", "https://example.com/file.iso"},
+			"0123456789abcdef", "xxh3", false,
+		},
+		{"algorithm only", []string{"gdl", "--checksum-algo", "blake3", "https://example.com/file.iso"}, "", "blake3", false},
+		{"wrong length", []string{"gdl", "--checksum", digest, "--checksum-algo", "md5", "https://example.com/file.iso"}, "", "", true},
+		{"unknown algorithm", []string{"gdl", "--checksum-algo", "crc32", "https://example.com/file.iso"}, "", "", true},
+		{"with range", []string{"gdl", "--checksum", digest, "--range", "0-99", "https://example.com/file.iso"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			options := createDownloadOptions(cfg)
+			if options.Checksum != tt.wantChecksum || options.ChecksumAlgorithm != tt.wantAlgorithm {
+				t.Errorf("Checksum = %q (%q), want %q (%q)",
+					options.Checksum, options.ChecksumAlgorithm, tt.wantChecksum, tt.wantAlgorithm)
+			}
+		})
+	}
+}
+
+func TestParseArgsScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    *types.ScanOptions
+		wantErr bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.iso"}, nil, false},
+		{
+			"clamd",
+			[]string{"gdl", "--clamd", "localhost:3310", "https://example.com/file.iso"},
+			&types.ScanOptions{Clamd: "localhost:3310", Action: types.ScanActionDelete},
+			false,
+		},
+		{
+			"command quarantined",
+			[]string{"gdl", "--scan-cmd", "clamscan --no-summary", "--quarantine", "/var/quarantine", "https://example.com/file.iso"},
+			&types.ScanOptions{Command: "clamscan --no-summary", Action: types.ScanActionQuarantine, QuarantineDir: "/var/quarantine"},
+			false,
+		},
+		{"quarantine without scanner", []string{"gdl", "--quarantine", "/var/quarantine", "https://example.com/file.iso"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := createDownloadOptions(cfg).Scan; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsRecompress(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantOutput string
+		wantErr    bool
+	}{
+		{"default", []string{"gdl", "https://example.com/data.json.gz"}, "data.json.gz", false},
+		{"zstd", []string{"gdl", "--recompress", "zstd", "https://example.com/data.json.gz"}, "data.json.zst", false},
+		{"decompressed", []string{"gdl", "--recompress", "none", "https://example.com/data.json.gz"}, "data.json", false},
+		{"explicit output", []string{"gdl", "--recompress", "zstd", "-o", "out.gz", "https://example.com/data.json.gz"}, "out.gz", false},
+		{"unknown codec", []string{"gdl", "--recompress", "brotli", "https://example.com/data.json.gz"}, "", true},
+		{"with resume", []string{"gdl", "--recompress", "zstd", "--resume", "https://example.com/data.json.gz"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, url, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			output, err := validateAndPrepareDownload(cfg, url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tt.wantOutput {
+				t.Errorf("output file = %q, want %q", output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestParseArgsZsync(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantControl string
+		wantSeed    string
+		wantErr     bool
+	}{
+		{"none", []string{"gdl", "https://example.com/image.iso"}, "", "", false},
+		{"auto", []string{"gdl", "--zsync", "auto", "https://example.com/image.iso"}, "https://example.com/image.iso.zsync", "", false},
+		{"path and seed", []string{"gdl", "--zsync", "image.zsync", "--zsync-seed", "old.iso", "https://example.com/image.iso"}, "image.zsync", "old.iso", false},
+		{"seed without control file", []string{"gdl", "--zsync-seed", "old.iso", "https://example.com/image.iso"}, "", "", true},
+		{"with resume", []string{"gdl", "--zsync", "auto", "--resume", "https://example.com/image.iso"}, "", "", true},
+		{"to stdout", []string{"gdl", "--zsync", "auto", "-o", "-", "https://example.com/image.iso"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			options := createDownloadOptions(cfg)
+			switch {
+			case tt.wantControl == "" && options.Delta != nil:
+				t.Errorf("Delta = %+v, want nil", options.Delta)
+			case tt.wantControl != "" && (options.Delta == nil ||
+				options.Delta.Control != tt.wantControl || options.Delta.Seed != tt.wantSeed):
+				t.Errorf("Delta = %+v, want control %q and seed %q", options.Delta, tt.wantControl, tt.wantSeed)
+			}
+		})
+	}
+}
+
+func TestParseArgsMinFreeSpace(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    int64
+		wantErr bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.txt"}, 0, false},
+		{"size", []string{"gdl", "--min-free-space", "2GB", "https://example.com/file.txt"}, 2 * 1024 * 1024 * 1024, false},
+		{"invalid", []string{"gdl", "--min-free-space", "lots", "https://example.com/file.txt"}, 0, true},
+		{"zero", []string{"gdl", "--min-free-space", "0MB", "https://example.com/file.txt"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if options := createDownloadOptions(cfg); options.MinFreeSpace != tt.want {
+				t.Errorf("MinFreeSpace = %d, want %d", options.MinFreeSpace, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsIfExists(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		policy  string
+		wantErr bool
+	}{
+		{"default", []string{"gdl", "https://example.com/file.zip"}, "", false},
+		{"skip", []string{"gdl", "--if-exists", "skip", "https://example.com/file.zip"}, types.CollisionSkip, false},
+		{"force and overwrite", []string{"gdl", "-f", "--if-exists=overwrite", "https://example.com/file.zip"}, types.CollisionOverwrite, false},
+		{"resume and resume", []string{"gdl", "--resume", "--if-exists=resume", "https://example.com/file.zip"}, types.CollisionResume, false},
+		{"unknown policy", []string{"gdl", "--if-exists", "clobber", "https://example.com/file.zip"}, "", true},
+		{"force and rename", []string{"gdl", "--force", "--if-exists=rename", "https://example.com/file.zip"}, "", true},
+		{"resume and skip", []string{"gdl", "--resume", "--if-exists=skip", "https://example.com/file.zip"}, "", true},
+		{"force and resume", []string{"gdl", "--force", "--resume", "https://example.com/file.zip"}, "", true},
+		{"with timestamping", []string{"gdl", "-N", "--if-exists=skip", "https://example.com/file.zip"}, "", true},
+		{"resume with range", []string{"gdl", "--range", "0-9", "--if-exists=resume", "https://example.com/file.zip"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+			origArgs := os.Args
+
+			defer func() { os.Args = origArgs }()
+
+			os.Args = tt.args
+
+			cfg, _, err := parseArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := createDownloadOptions(cfg).CollisionPolicy; got != tt.policy {
+				t.Errorf("CollisionPolicy = %q, want %q", got, tt.policy)
+			}
+		})
+	}
+}
+
+func TestRunIfExistsRename(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("new"))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(dest, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []string{types.CollisionSkip, types.CollisionRename} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		if code := run([]string{"gdl", "-q", "--if-exists", policy, "-o", dest, server.URL + "/report.pdf"}); code != 0 {
+			t.Fatalf("run() with --if-exists=%s = %d, want 0", policy, code)
+		}
+	}
+
+	if got, _ := os.ReadFile(dest); string(got) != "old" { // #nosec G304 -- test file
+		t.Errorf("existing file = %q, want it kept", got)
+	}
+
+	if got, _ := os.ReadFile(strings.TrimSuffix(dest, ".pdf") + "-1.pdf"); string(got) != "new" { // #nosec G304 -- test file
+		t.Errorf("renamed download = %q, want %q", got, "new")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/manifest"
+	"github.com/forest6511/gdl/pkg/scheduler"
+)
+
+// verifyManifestConfig holds the options of "gdl verify-manifest".
+type verifyManifestConfig struct {
+	manifest  string
+	algorithm string
+	quiet     bool
+}
+
+// runVerifyManifestCommand handles "gdl verify-manifest <manifest>". It exits
+// with status 0 when every listed file matches, and 1 otherwise.
+func runVerifyManifestCommand(args []string) int {
+	mcfg, err := parseVerifyManifestArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showVerifyManifestUsage()
+		return 1
+	}
+
+	return verifyManifest(os.Stdout, mcfg)
+}
+
+// parseVerifyManifestArgs parses the arguments of "gdl verify-manifest",
+// which may put flags before or after the manifest.
+func parseVerifyManifestArgs(args []string) (*verifyManifestConfig, error) {
+	mcfg := &verifyManifestConfig{}
+
+	fs := flag.NewFlagSet("verify-manifest", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineVerifyManifestFlags(fs, mcfg)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		return nil, fmt.Errorf("verify-manifest requires exactly one manifest file")
+	}
+	mcfg.manifest = positional[0]
+
+	if mcfg.algorithm == "" {
+		mcfg.algorithm = manifest.DetectAlgorithm(mcfg.manifest)
+	} else if algorithms, err := manifest.ParseAlgorithms(mcfg.algorithm); err != nil || len(algorithms) != 1 {
+		return nil, fmt.Errorf("--algo must be one of %s", strings.Join(manifest.Algorithms, ", "))
+	} else {
+		mcfg.algorithm = algorithms[0]
+	}
+
+	return mcfg, nil
+}
+
+// defineVerifyManifestFlags registers the flags of "gdl verify-manifest" on fs.
+func defineVerifyManifestFlags(fs *flag.FlagSet, mcfg *verifyManifestConfig) {
+	fs.StringVar(&mcfg.algorithm, "algo", "", "Checksum algorithm: sha256 or blake3 (default: from the manifest's name)")
+	fs.BoolVar(&mcfg.quiet, "q", false, "Only report files that fail")
+	fs.BoolVar(&mcfg.quiet, "quiet", false, "Only report files that fail")
+}
+
+// verifyManifest checks the files listed in the manifest, relative to its
+// directory, printing a line per file as sha256sum --check does.
+func verifyManifest(out io.Writer, mcfg *verifyManifestConfig) int {
+	file, err := os.Open(mcfg.manifest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer func() { _ = file.Close() }()
+
+	entries, err := manifest.Parse(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", mcfg.manifest, err)
+		return 1
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s lists no files\n", mcfg.manifest)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range manifest.Verify(filepath.Dir(mcfg.manifest), entries, mcfg.algorithm) {
+		switch {
+		case result.OK:
+			if !mcfg.quiet {
+				_, _ = fmt.Fprintf(out, "%s: OK\n", result.Path)
+			}
+		case os.IsNotExist(result.Err):
+			failed++
+			_, _ = fmt.Fprintf(out, "%s: MISSING\n", result.Path)
+		case result.Err != nil:
+			failed++
+			_, _ = fmt.Fprintf(out, "%s: FAILED (%v)\n", result.Path, result.Err)
+		default:
+			failed++
+			_, _ = fmt.Fprintf(out, "%s: FAILED\n", result.Path)
+		}
+	}
+
+	if !mcfg.quiet || failed > 0 {
+		_, _ = fmt.Fprintf(out, "%d of %d files verified\n", len(entries)-failed, len(entries))
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// writeManifests writes a checksum manifest of each algorithm to dir for the
+// files of a batch or mirror that are in place, downloaded or skipped as
+// already there. A file downloaded under the manifest's own name is kept and
+// no manifest of that algorithm is written.
+func writeManifests(out io.Writer, results []gdl.BatchResult, dir string, algorithms []string, quiet bool) error {
+	var files []string
+
+	for _, result := range results {
+		if result.State != scheduler.StateSucceeded {
+			continue
+		}
+
+		path := batchResultPath(result, dir)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			path = rel
+		}
+
+		files = append(files, filepath.ToSlash(path))
+	}
+
+	for _, algorithm := range algorithms {
+		name := manifest.Filename(algorithm)
+		if slices.Contains(files, name) {
+			fmt.Fprintf(os.Stderr, "Warning: %s was downloaded; not replacing it with a manifest\n", name)
+			continue
+		}
+
+		path, err := manifest.Create(dir, files, algorithm)
+		if err != nil {
+			return err
+		}
+
+		if !quiet {
+			_, _ = fmt.Fprintf(out, "Wrote %s (%d files)\n", path, len(files))
+		}
+	}
+
+	return nil
+}
+
+func showVerifyManifestUsage() {
+	fmt.Printf(`Verify-Manifest Command:
+
+Usage: %s verify-manifest <manifest> [options]
+
+Checks the files listed in a checksum manifest, such as the SHA256SUMS or
+BLAKE3SUMS written by "batch --checksums" and "mirror --checksums", or one
+published next to a download. Paths are relative to the manifest's directory.
+Each file is reported as OK, FAILED or MISSING, and the command exits with
+status 1 if any file is not OK.
+
+Options:
+      --algo ALGO       Checksum algorithm: sha256 or blake3 (default:
+                        blake3 for names containing "blake3" or starting
+                        with "b3", otherwise sha256)
+  -q, --quiet           Only report files that fail
+
+Examples:
+  %s verify-manifest ./releases/SHA256SUMS
+  %s verify-manifest ./mirror/BLAKE3SUMS --quiet
+
+`, appName, appName, appName)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/manifest"
+	"github.com/forest6511/gdl/pkg/scheduler"
+)
+
+func TestParseVerifyManifestArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantErr   bool
+		algorithm string
+		quiet     bool
+	}{
+		{"sha256 by name", []string{"dir/SHA256SUMS"}, false, manifest.SHA256, false},
+		{"blake3 by name", []string{"dir/BLAKE3SUMS", "-q"}, false, manifest.BLAKE3, true},
+		{"explicit algorithm", []string{"--algo", "blake3", "dir/SHA256SUMS"}, false, manifest.BLAKE3, false},
+		{"unknown algorithm", []string{"dir/SHA256SUMS", "--algo", "md5"}, true, "", false},
+		{"two algorithms", []string{"dir/SHA256SUMS", "--algo", "sha256,blake3"}, true, "", false},
+		{"no manifest", []string{"--quiet"}, true, "", false},
+		{"two manifests", []string{"a/SHA256SUMS", "b/SHA256SUMS"}, true, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mcfg, err := parseVerifyManifestArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseVerifyManifestArgs() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVerifyManifestArgs() error = %v", err)
+			}
+
+			if mcfg.algorithm != tt.algorithm || mcfg.quiet != tt.quiet {
+				t.Errorf("parseVerifyManifestArgs() = %+v", mcfg)
+			}
+		})
+	}
+}
+
+func TestWriteAndVerifyManifests(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "bravo",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := []gdl.BatchResult{
+		{ID: "a.txt", State: scheduler.StateSucceeded, Stats: &gdl.DownloadStats{}},
+		{ID: "b", State: scheduler.StateSucceeded, Stats: &gdl.DownloadStats{Filename: filepath.Join(dir, "sub", "b.txt")}},
+		{ID: "c.txt", State: scheduler.StateFailed},
+	}
+
+	var out bytes.Buffer
+	if err := writeManifests(&out, results, dir, manifest.Algorithms, false); err != nil {
+		t.Fatalf("writeManifests() error = %v", err)
+	}
+
+	written := out.String()
+
+	for _, name := range []string{"SHA256SUMS", "BLAKE3SUMS"} {
+		if !strings.Contains(written, filepath.Join(dir, name)+" (2 files)") {
+			t.Errorf("output %q does not report %s", written, name)
+		}
+
+		out.Reset()
+		if code := verifyManifest(&out, &verifyManifestConfig{
+			manifest:  filepath.Join(dir, name),
+			algorithm: manifest.DetectAlgorithm(name),
+		}); code != 0 {
+			t.Errorf("verifyManifest(%s) = %d, want 0: %s", name, code, out.String())
+		}
+		if !strings.Contains(out.String(), "sub/b.txt: OK") || !strings.Contains(out.String(), "2 of 2 files verified") {
+			t.Errorf("verifyManifest(%s) output = %q", name, out.String())
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "sub", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	code := verifyManifest(&out, &verifyManifestConfig{
+		manifest:  filepath.Join(dir, "SHA256SUMS"),
+		algorithm: manifest.SHA256,
+		quiet:     true,
+	})
+	if code != 1 {
+		t.Errorf("verifyManifest() = %d after changes, want 1", code)
+	}
+
+	want := "a.txt: FAILED\nsub/b.txt: MISSING\n0 of 2 files verified\n"
+	if out.String() != want {
+		t.Errorf("verifyManifest() output = %q, want %q", out.String(), want)
+	}
+}
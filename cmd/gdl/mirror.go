@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/internal/listing"
+	"github.com/forest6511/gdl/internal/manifest"
+	"github.com/forest6511/gdl/internal/robots"
+	"github.com/forest6511/gdl/pkg/pathtemplate"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/scheduler"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// mirrorConfig configures "gdl mirror".
+type mirrorConfig struct {
+	url      string
+	output   string
+	template string
+	ifExists string
+	maxRate  string
+	sums     string
+	include  StringSlice
+	exclude  StringSlice
+	depth    int
+	jobs     int
+	perHost  int
+	delay    time.Duration
+	noRobots bool
+	dryRun   bool
+	quiet    bool
+}
+
+// runMirrorCommand handles "gdl mirror <url>".
+func runMirrorCommand(args []string) int {
+	mcfg, err := parseMirrorArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showMirrorUsage()
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if mcfg.dryRun {
+		return listMirror(ctx, gdl.NewDownloader(), mcfg, os.Stdout)
+	}
+
+	return mirror(ctx, gdl.NewDownloader(), mcfg, os.Stdout)
+}
+
+// parseMirrorArgs parses the arguments of "gdl mirror", which may put flags
+// before or after the URL.
+func parseMirrorArgs(args []string) (*mirrorConfig, error) {
+	mcfg := &mirrorConfig{}
+
+	fs := flag.NewFlagSet("mirror", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineMirrorFlags(fs, mcfg)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		return nil, fmt.Errorf("mirror requires exactly one URL")
+	}
+	mcfg.url = positional[0]
+
+	if mcfg.depth < 0 || mcfg.jobs < 0 || mcfg.perHost < 0 || mcfg.delay < 0 {
+		return nil, fmt.Errorf("--depth, --jobs, --per-host and --host-delay cannot be negative")
+	}
+
+	if mcfg.template != "" {
+		if _, err := pathtemplate.Parse(mcfg.template); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := core.ValidateCollisionPolicy(mcfg.ifExists); err != nil {
+		return nil, err
+	}
+
+	if mcfg.maxRate != "" {
+		if err := ratelimit.ValidateRate(mcfg.maxRate); err != nil {
+			return nil, err
+		}
+	}
+
+	if mcfg.sums != "" {
+		if _, err := manifest.ParseAlgorithms(mcfg.sums); err != nil {
+			return nil, err
+		}
+	}
+
+	return mcfg, nil
+}
+
+// defineMirrorFlags registers the flags of "gdl mirror" on fs.
+func defineMirrorFlags(fs *flag.FlagSet, mcfg *mirrorConfig) {
+	fs.StringVar(&mcfg.output, "o", ".", "Destination directory")
+	fs.StringVar(&mcfg.output, "output", ".", "Destination directory")
+	fs.StringVar(&mcfg.template, "output-template", "", "Name files from a template such as {path:-1}/{filename}")
+	fs.StringVar(&mcfg.ifExists, "if-exists", types.CollisionOverwrite, "What to do with existing files: fail, overwrite, skip, rename or resume")
+	fs.Var(&mcfg.include, "include", "Only download files matching this pattern")
+	fs.Var(&mcfg.exclude, "exclude", "Skip files matching this pattern")
+	fs.IntVar(&mcfg.depth, "depth", listing.DefaultMaxDepth, "Subdirectory levels to follow")
+	fs.StringVar(&mcfg.maxRate, "max-rate", "", "Maximum download rate of each file (e.g., 1MB/s)")
+	fs.IntVar(&mcfg.jobs, "jobs", 0, "Files downloaded at once")
+	fs.IntVar(&mcfg.perHost, "per-host", 0, "Connections per host")
+	fs.DurationVar(&mcfg.delay, "host-delay", 0, "Minimum delay between requests to the same host")
+	fs.StringVar(&mcfg.sums, "checksums", "", "Write checksum manifests of the files to the output directory: sha256, blake3 or both")
+	fs.BoolVar(&mcfg.noRobots, "no-robots", false, "Ignore the site's robots.txt and Crawl-delay")
+	fs.BoolVar(&mcfg.dryRun, "dry-run", false, "Report each file's final URL, size, range support and time without downloading")
+	fs.BoolVar(&mcfg.quiet, "q", false, "Only report failures")
+	fs.BoolVar(&mcfg.quiet, "quiet", false, "Only report failures")
+}
+
+// maxDepth converts --depth, where 0 means the root page only, to
+// listing.Options.MaxDepth, where 0 means the default.
+func (mcfg *mirrorConfig) maxDepth() int {
+	if mcfg.depth == 0 {
+		return -1
+	}
+
+	return mcfg.depth
+}
+
+// parallel returns the number of files downloaded at once.
+func (mcfg *mirrorConfig) parallel() int {
+	if mcfg.jobs == 0 {
+		return scheduler.DefaultMaxParallel
+	}
+
+	return mcfg.jobs
+}
+
+// listMirror reports on the files a mirror would download, as "gdl get
+// --dry-run" does.
+func listMirror(ctx context.Context, downloader *gdl.Downloader, mcfg *mirrorConfig, out io.Writer) int {
+	var rules *robots.Rules
+	if parsed, err := url.Parse(mcfg.url); err == nil && !mcfg.noRobots &&
+		(parsed.Scheme == "http" || parsed.Scheme == "https") {
+		if rules, err = robots.Fetch(ctx, nil, parsed, nil, core.DefaultUserAgent); err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing %s: %v\n", mcfg.url, err)
+			return 1
+		}
+	}
+
+	entries, err := listing.List(ctx, mcfg.url, &listing.Options{
+		MaxDepth: mcfg.maxDepth(),
+		Include:  mcfg.include,
+		Exclude:  mcfg.exclude,
+		Robots:   rules,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing %s: %v\n", mcfg.url, err)
+		return 1
+	}
+
+	files := make([]dryRunFile, len(entries))
+	for i, entry := range entries {
+		files[i] = dryRunFile{
+			url:         entry.URL,
+			destination: filepath.Join(mcfg.output, filepath.FromSlash(entry.Path)),
+			size:        entry.Size,
+		}
+	}
+
+	return dryRun(ctx, out, downloader, files, parseBatchRate(mcfg.maxRate), mcfg.parallel())
+}
+
+// mirror downloads everything under mcfg.url and reports each file.
+func mirror(ctx context.Context, downloader *gdl.Downloader, mcfg *mirrorConfig, out io.Writer) int {
+	results, err := downloader.DownloadTree(ctx, mcfg.url, mcfg.output, &gdl.TreeOptions{
+		Include:        mcfg.include,
+		Exclude:        mcfg.exclude,
+		MaxDepth:       mcfg.maxDepth(),
+		OutputTemplate: mcfg.template,
+		IgnoreRobots:   mcfg.noRobots,
+		Options: &gdl.Options{
+			OverwriteExisting: true,
+			CollisionPolicy:   mcfg.ifExists,
+			MaxRate:           parseBatchRate(mcfg.maxRate),
+			AtomicWrite:       true,
+			Quiet:             true,
+			HostCache:         hostCacheFile(),
+		},
+		Batch: &gdl.BatchOptions{
+			MaxParallelJobs:       mcfg.jobs,
+			MaxConnectionsPerHost: mcfg.perHost,
+			HostDelay:             mcfg.delay,
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error mirroring %s: %v\n", mcfg.url, err)
+		return 1
+	}
+
+	return finishBatch(out, results, mcfg.output, mcfg.sums, mcfg.quiet)
+}
+
+func showMirrorUsage() {
+	fmt.Printf(`Mirror Command:
+
+Usage: %s mirror <url> [options]
+
+Downloads every file under url, keeping their relative paths: the links of an
+HTML directory index page (nginx, Apache) and its subdirectory pages, or the
+objects under an s3://bucket/prefix. Pages and files disallowed by the site's
+robots.txt are skipped, and its Crawl-delay is kept between requests.
+
+Options:
+  -o, --output DIR      Destination directory (default: .)
+      --output-template T  Name files under DIR from a template instead of
+                        their relative paths, e.g. "{path:-1}/{date}-{filename}"
+      --include GLOB    Only download matching files (repeatable)
+      --exclude GLOB    Skip matching files (repeatable)
+      --if-exists POLICY  What to do with existing files: overwrite (default),
+                        skip, rename, resume or fail
+      --depth N         Subdirectory levels to follow (default: 10; 0 = none)
+      --jobs N          Files downloaded at once (default: 4)
+      --per-host N      Connections per host across all files (default: unlimited)
+      --host-delay D    Minimum delay between requests to the same host (e.g., 1s)
+      --no-robots       Ignore the site's robots.txt and its Crawl-delay
+      --checksums ALGOS  Write SHA256SUMS and/or BLAKE3SUMS for the files to
+                        the output directory (sha256, blake3 or sha256,blake3)
+      --max-rate RATE   Maximum download rate of each file (e.g., 1MB/s)
+      --dry-run         Show each file's final URL, destination, size, range
+                        support and time at --max-rate without downloading
+  -q, --quiet           Only report failures
+
+A pattern without a slash matches file names ("*.iso"); one with a slash
+matches paths relative to url ("images/*/*.png").
+
+Examples:
+  %s mirror https://example.com/pub/releases/ -o ./releases --include "*.tar.gz"
+  %s mirror s3://my-bucket/logs/2025/ -o ./logs --exclude "*.tmp"
+  %s mirror https://example.com/pub/ --dry-run
+
+`, appName, appName, appName, appName)
+}
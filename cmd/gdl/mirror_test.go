@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/listing"
+	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestParseMirrorArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantErr  bool
+		output   string
+		include  []string
+		maxDepth int
+	}{
+		{"defaults", []string{"https://example.com/pub/"}, false, ".", nil, listing.DefaultMaxDepth},
+		{"flags after URL", []string{"https://example.com/pub/", "-o", "out", "--include", "*.iso", "--include", "*.sig"}, false, "out", []string{"*.iso", "*.sig"}, listing.DefaultMaxDepth},
+		{"flags before URL", []string{"--depth", "2", "--output=out", "s3://bucket/prefix/"}, false, "out", nil, 2},
+		{"root page only", []string{"https://example.com/pub/", "--depth", "0"}, false, ".", nil, -1},
+		{"no URL", []string{"-o", "out"}, true, ".", nil, 0},
+		{"two URLs", []string{"https://a.example.com/", "https://b.example.com/"}, true, ".", nil, 0},
+		{"negative jobs", []string{"https://example.com/pub/", "--jobs", "-1"}, true, ".", nil, 0},
+		{"unknown flag", []string{"https://example.com/pub/", "--bogus"}, true, ".", nil, 0},
+		{"output template", []string{"https://example.com/pub/", "--output-template", "{path:-1}/{filename}"}, false, ".", nil, listing.DefaultMaxDepth},
+		{"invalid collision policy", []string{"https://example.com/pub/", "--if-exists", "clobber"}, true, ".", nil, 0},
+		{"invalid output template", []string{"https://example.com/pub/", "--output-template", "{bogus}"}, true, ".", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mcfg, err := parseMirrorArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseMirrorArgs() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMirrorArgs() error = %v", err)
+			}
+
+			if mcfg.output != tt.output || fmt.Sprint([]string(mcfg.include)) != fmt.Sprint(tt.include) ||
+				mcfg.maxDepth() != tt.maxDepth {
+				t.Errorf("parseMirrorArgs() = %+v", mcfg)
+			}
+		})
+	}
+}
+
+func TestMirror(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	files := map[string]string{
+		"/pub/a.txt":        "alpha",
+		"/pub/b.log":        "bravo",
+		"/pub/sub/c.txt":    "charlie",
+		"/pub/sub/deep.txt": "delta",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pub/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprint(w, `<a href="../">../</a><a href="a.txt">a.txt</a><a href="b.log">b.log</a><a href="sub/">sub/</a>`)
+		case "/pub/sub/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprint(w, `<a href="c.txt">c.txt</a><a href="deep.txt">deep.txt</a>`)
+		default:
+			content, ok := files[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = fmt.Fprint(w, content)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	mcfg := &mirrorConfig{
+		url:     server.URL + "/pub/",
+		output:  dir,
+		include: StringSlice{"*.txt"},
+		depth:   listing.DefaultMaxDepth,
+	}
+
+	var out bytes.Buffer
+	if code := mirror(context.Background(), gdl.NewDownloader(), mcfg, &out); code != 0 {
+		t.Fatalf("mirror() = %d, output:\n%s", code, out.String())
+	}
+
+	for _, rel := range []string{"a.txt", "sub/c.txt", "sub/deep.txt"} {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel))) // #nosec G304 -- test file
+		if err != nil || string(content) != files["/pub/"+rel] {
+			t.Errorf("%s = %q, %v", rel, content, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "b.log")); !os.IsNotExist(err) {
+		t.Errorf("excluded b.log was downloaded: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "3 of 3 files downloaded") {
+		t.Errorf("mirror() output = %q", out.String())
+	}
+
+	// A second run keeps the files it already has
+	out.Reset()
+	mcfg.ifExists = types.CollisionSkip
+	if code := mirror(context.Background(), gdl.NewDownloader(), mcfg, &out); code != 0 ||
+		strings.Count(out.String(), "(exists, skipped)") != 3 {
+		t.Errorf("mirror() with --if-exists=skip = %d, output:\n%s", code, out.String())
+	}
+
+	out.Reset()
+	mcfg.depth = 0
+	if code := listMirror(context.Background(), gdl.NewDownloader(), mcfg, &out); code != 0 ||
+		!strings.Contains(out.String(), "Save as:    "+filepath.Join(dir, "a.txt")) {
+		t.Errorf("listMirror() = %d, output:\n%s", code, out.String())
+	}
+}
+
+func TestMirrorRobots(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = fmt.Fprint(w, "User-agent: *\nDisallow: /pub/sub/\n")
+		case "/pub/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprint(w, `<a href="a.txt">a.txt</a><a href="sub/">sub/</a>`)
+		case "/pub/sub/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprint(w, `<a href="c.txt">c.txt</a>`)
+		default:
+			_, _ = fmt.Fprint(w, "content")
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	mcfg := &mirrorConfig{url: server.URL + "/pub/", output: dir, depth: listing.DefaultMaxDepth}
+
+	var out bytes.Buffer
+	if code := listMirror(context.Background(), gdl.NewDownloader(), mcfg, &out); code != 0 ||
+		strings.Contains(out.String(), "c.txt") || !strings.Contains(out.String(), "a.txt") {
+		t.Errorf("listMirror() = %d, want c.txt skipped, output:\n%s", code, out.String())
+	}
+
+	out.Reset()
+	mcfg.noRobots = true
+	if code := listMirror(context.Background(), gdl.NewDownloader(), mcfg, &out); code != 0 ||
+		!strings.Contains(out.String(), "c.txt") {
+		t.Errorf("listMirror() with --no-robots = %d, output:\n%s", code, out.String())
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// ndjsonSchemaVersion is bumped whenever a field is removed or changes meaning.
+// Adding new fields does not change the version.
+const ndjsonSchemaVersion = 1
+
+// ndjsonProgressInterval is the minimum time between two progress events.
+const ndjsonProgressInterval = 500 * time.Millisecond
+
+// NDJSON event names.
+const (
+	ndjsonEventStart    = "start"
+	ndjsonEventProgress = "progress"
+	ndjsonEventRetry    = "retry"
+	ndjsonEventError    = "error"
+	ndjsonEventComplete = "complete"
+
+	ndjsonEventBatchProgress = "batch_progress"
+)
+
+// ndjsonHeader contains the fields shared by every event.
+type ndjsonHeader struct {
+	SchemaVersion int       `json:"schema_version"`
+	Event         string    `json:"event"`
+	Timestamp     time.Time `json:"timestamp"`
+	URL           string    `json:"url"`
+	Filename      string    `json:"filename"`
+}
+
+type ndjsonStartEvent struct {
+	ndjsonHeader
+}
+
+type ndjsonProgressEvent struct {
+	ndjsonHeader
+	TotalSize       int64   `json:"total_size"`
+	BytesDownloaded int64   `json:"bytes_downloaded"`
+	Speed           int64   `json:"speed"`
+	Percentage      float64 `json:"percentage"`
+}
+
+type ndjsonRetryEvent struct {
+	ndjsonHeader
+	Attempt int    `json:"attempt"`
+	DelayMs int64  `json:"delay_ms"`
+	Error   string `json:"error"`
+}
+
+type ndjsonErrorEvent struct {
+	ndjsonHeader
+	Error           string `json:"error"`
+	Code            string `json:"code"`
+	HTTPStatusCode  int    `json:"http_status_code"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+}
+
+type ndjsonCompleteEvent struct {
+	ndjsonHeader
+	TotalSize       int64 `json:"total_size"`
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	DurationMs      int64 `json:"duration_ms"`
+	AverageSpeed    int64 `json:"average_speed"`
+	Retries         int   `json:"retries"`
+	Resumed         bool  `json:"resumed"`
+	NotModified     bool  `json:"not_modified"`
+	Deduplicated    bool  `json:"deduplicated"`
+	Skipped         bool  `json:"skipped"`
+}
+
+// ndjsonBatchProgressEvent is the combined progress of the files of
+// "gdl batch", which has no URL or filename of its own.
+type ndjsonBatchProgressEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	Event         string    `json:"event"`
+	Timestamp     time.Time `json:"timestamp"`
+	types.AggregateSnapshot
+}
+
+// ndjsonEmitter writes download lifecycle events as newline-delimited JSON.
+// It implements types.Progress so it can be plugged into the core downloader.
+type ndjsonEmitter struct {
+	mu           sync.Mutex
+	encoder      *json.Encoder
+	url          string
+	filename     string
+	totalSize    int64
+	lastProgress time.Time
+	interval     time.Duration
+	now          func() time.Time
+}
+
+func newNDJSONEmitter(w io.Writer, url, filename string) *ndjsonEmitter {
+	return &ndjsonEmitter{
+		encoder:  json.NewEncoder(w),
+		url:      url,
+		filename: filename,
+		interval: ndjsonProgressInterval,
+		now:      time.Now,
+	}
+}
+
+// openEventsWriter returns the destination for the event stream: the given
+// file, or stdout when path is empty. The returned function closes the file.
+func openEventsWriter(path string) (io.Writer, func(), error) {
+	if path == "" {
+		return os.Stdout, func() {}, nil
+	}
+
+	// #nosec G304 -- path is provided explicitly by the user via --events-file
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, func() { _ = file.Close() }, nil
+}
+
+// header builds the common event header (must be called with lock held).
+func (e *ndjsonEmitter) header(event string) ndjsonHeader {
+	return ndjsonHeader{
+		SchemaVersion: ndjsonSchemaVersion,
+		Event:         event,
+		Timestamp:     e.now().UTC(),
+		URL:           e.url,
+		Filename:      e.filename,
+	}
+}
+
+// write encodes a single event (must be called with lock held).
+func (e *ndjsonEmitter) write(event interface{}) {
+	// Encoding errors are ignored: a broken output stream must not abort the download.
+	_ = e.encoder.Encode(event)
+}
+
+// emitStart writes the start event.
+func (e *ndjsonEmitter) emitStart() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.write(ndjsonStartEvent{ndjsonHeader: e.header(ndjsonEventStart)})
+}
+
+// emitRetry writes a retry event. It matches types.DownloadOptions.RetryCallback.
+func (e *ndjsonEmitter) emitRetry(attempt int, err error, delay time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	event := ndjsonRetryEvent{
+		ndjsonHeader: e.header(ndjsonEventRetry),
+		Attempt:      attempt,
+		DelayMs:      delay.Milliseconds(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	e.write(event)
+}
+
+// emitProgress writes a progress event unless one was written less than
+// the throttle interval ago. It matches types.DownloadOptions.ProgressCallback.
+func (e *ndjsonEmitter) emitProgress(bytesDownloaded, totalSize int64, speed int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if !e.lastProgress.IsZero() && now.Sub(e.lastProgress) < e.interval {
+		return
+	}
+
+	e.lastProgress = now
+
+	if totalSize > 0 {
+		e.totalSize = totalSize
+	}
+
+	event := ndjsonProgressEvent{
+		ndjsonHeader:    e.header(ndjsonEventProgress),
+		TotalSize:       e.totalSize,
+		BytesDownloaded: bytesDownloaded,
+		Speed:           speed,
+		Percentage:      -1,
+	}
+	if e.totalSize > 0 {
+		event.Percentage = float64(bytesDownloaded) / float64(e.totalSize) * 100
+	}
+
+	e.write(event)
+}
+
+// emitComplete writes the completion event from the final statistics.
+func (e *ndjsonEmitter) emitComplete(stats *types.DownloadStats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	event := ndjsonCompleteEvent{ndjsonHeader: e.header(ndjsonEventComplete)}
+	if stats != nil {
+		event.TotalSize = stats.TotalSize
+		event.BytesDownloaded = stats.BytesDownloaded
+		event.DurationMs = stats.Duration.Milliseconds()
+		event.AverageSpeed = stats.AverageSpeed
+		event.Retries = stats.Retries
+		event.Resumed = stats.Resumed
+		event.NotModified = stats.NotModified
+		event.Deduplicated = stats.Deduplicated
+		event.Skipped = stats.Skipped
+	}
+
+	e.write(event)
+}
+
+// emitError writes the error event.
+func (e *ndjsonEmitter) emitError(err error, stats *types.DownloadStats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	event := ndjsonErrorEvent{
+		ndjsonHeader: e.header(ndjsonEventError),
+		Code:         gdlerrors.CodeUnknown.String(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	var downloadErr *gdlerrors.DownloadError
+	if stdErrors.As(err, &downloadErr) {
+		event.Code = downloadErr.Code.String()
+		event.HTTPStatusCode = downloadErr.HTTPStatusCode
+	}
+
+	if stats != nil {
+		event.BytesDownloaded = stats.BytesDownloaded
+	}
+
+	e.write(event)
+}
+
+// Start records the total size reported by the downloader. The start event
+// itself is written by the caller so it is emitted for every download mode.
+func (e *ndjsonEmitter) Start(filename string, totalSize int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if totalSize > 0 {
+		e.totalSize = totalSize
+	}
+}
+
+// Update forwards downloader progress to the throttled progress event.
+func (e *ndjsonEmitter) Update(bytesDownloaded, totalSize int64, speed int64) {
+	e.emitProgress(bytesDownloaded, totalSize, speed)
+}
+
+// Finish is a no-op; the completion event is written by the caller.
+func (e *ndjsonEmitter) Finish(filename string, stats *types.DownloadStats) {}
+
+// Error is a no-op; the error event is written by the caller.
+func (e *ndjsonEmitter) Error(filename string, err error) {}
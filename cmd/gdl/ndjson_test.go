@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func decodeNDJSON(t *testing.T, data []byte) []map[string]interface{} {
+	t.Helper()
+
+	var events []map[string]interface{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid ndjson line %q: %v", scanner.Text(), err)
+		}
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestNDJSONEmitterLifecycle(t *testing.T) {
+	var buf bytes.Buffer
+
+	emitter := newNDJSONEmitter(&buf, "https://example.com/file.zip", "file.zip")
+
+	emitter.emitStart()
+	emitter.Start("file.zip", 1000)
+	emitter.Update(250, 0, 100)
+	emitter.emitRetry(1, errors.New("connection reset"), 2*time.Second)
+	emitter.emitComplete(&types.DownloadStats{
+		TotalSize:       1000,
+		BytesDownloaded: 1000,
+		Duration:        1500 * time.Millisecond,
+		AverageSpeed:    666,
+		Retries:         1,
+	})
+
+	events := decodeNDJSON(t, buf.Bytes())
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4", len(events))
+	}
+
+	wantTypes := []string{"start", "progress", "retry", "complete"}
+	for i, want := range wantTypes {
+		if events[i]["event"] != want {
+			t.Errorf("event %d = %v, want %s", i, events[i]["event"], want)
+		}
+
+		if events[i]["schema_version"] != float64(ndjsonSchemaVersion) {
+			t.Errorf("event %d schema_version = %v", i, events[i]["schema_version"])
+		}
+
+		if events[i]["url"] != "https://example.com/file.zip" {
+			t.Errorf("event %d url = %v", i, events[i]["url"])
+		}
+	}
+
+	if events[1]["percentage"] != float64(25) {
+		t.Errorf("progress percentage = %v, want 25", events[1]["percentage"])
+	}
+
+	if events[2]["delay_ms"] != float64(2000) {
+		t.Errorf("retry delay_ms = %v, want 2000", events[2]["delay_ms"])
+	}
+
+	if events[3]["duration_ms"] != float64(1500) {
+		t.Errorf("complete duration_ms = %v, want 1500", events[3]["duration_ms"])
+	}
+}
+
+func TestNDJSONEmitterThrottlesProgress(t *testing.T) {
+	var buf bytes.Buffer
+
+	now := time.Unix(0, 0)
+	emitter := newNDJSONEmitter(&buf, "https://example.com/f", "f")
+	emitter.now = func() time.Time { return now }
+
+	emitter.emitProgress(1, 10, 1)
+	emitter.emitProgress(2, 10, 1)
+
+	now = now.Add(ndjsonProgressInterval)
+	emitter.emitProgress(3, 10, 1)
+
+	events := decodeNDJSON(t, buf.Bytes())
+	if len(events) != 2 {
+		t.Fatalf("got %d progress events, want 2", len(events))
+	}
+
+	if events[1]["bytes_downloaded"] != float64(3) {
+		t.Errorf("second progress bytes_downloaded = %v, want 3", events[1]["bytes_downloaded"])
+	}
+}
+
+func TestNDJSONEmitterError(t *testing.T) {
+	var buf bytes.Buffer
+
+	emitter := newNDJSONEmitter(&buf, "https://example.com/f", "f")
+	emitter.emitError(gdlerrors.FromHTTPStatus(404, "https://example.com/f"), nil)
+
+	events := decodeNDJSON(t, buf.Bytes())
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+
+	if events[0]["code"] != "file_not_found" {
+		t.Errorf("code = %v, want file_not_found", events[0]["code"])
+	}
+
+	if events[0]["http_status_code"] != float64(404) {
+		t.Errorf("http_status_code = %v, want 404", events[0]["http_status_code"])
+	}
+}
+
+func TestOpenEventsWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	w, closeFn, err := openEventsWriter(path)
+	if err != nil {
+		t.Fatalf("openEventsWriter() error = %v", err)
+	}
+
+	if _, err := w.Write([]byte("{}\n")); err != nil {
+		t.Errorf("Write() error = %v", err)
+	}
+
+	closeFn()
+
+	if _, _, err := openEventsWriter(filepath.Join(t.TempDir(), "missing", "events.ndjson")); err == nil {
+		t.Error("openEventsWriter() should fail for a missing directory")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+// preflight queries url before it is downloaded, so that the disk space
+// check, the number of connections and the progress total use the file's
+// real size, and then runs the pre-download checks. A file that cannot be
+// queried is downloaded all the same: the download reports the error if there
+// is one.
+func preflight(
+	ctx context.Context,
+	coreDownloader *core.Downloader,
+	cfg *config,
+	url, outputFile string,
+	options *types.DownloadOptions,
+) error {
+	var size int64
+
+	if wantsPreflight(url, outputFile, options) {
+		info, err := coreDownloader.GetFileInfoWithOptions(ctx, url, options)
+		if err != nil {
+			if cfg.verbose {
+				formatter.PrintMessage(ui.MessageWarning, "Could not query %s before downloading: %v", url, err)
+			}
+		} else if info.Size > 0 {
+			size = info.Size
+			applyFileSize(cfg, options, size, info.SupportsRanges)
+		}
+	}
+
+	needed := size
+	if options.Resume {
+		// Only the rest of a partial file still has to fit
+		if partial, err := os.Stat(outputFile); err == nil {
+			needed = max(0, size-partial.Size())
+		}
+	}
+
+	// #nosec G115 -- needed is a non-negative Content-Length
+	return performPreDownloadChecks(ctx, cfg, outputFile, uint64(needed))
+}
+
+// wantsPreflight reports whether a download's size is worth querying first.
+// Byte ranges, requests with a method or body of their own and downloads to
+// stdout gain nothing from it, and only http(s) URLs can be queried.
+func wantsPreflight(url, outputFile string, options *types.DownloadOptions) bool {
+	return isHTTPURL(url) &&
+		outputFile != stdoutOutput &&
+		options.ByteRange == nil &&
+		options.Method == "" &&
+		options.Body == nil &&
+		options.BodyFile == ""
+}
+
+// applyFileSize tunes options for a file of size bytes: the number of
+// connections, unless --concurrent or --no-concurrent chose one, and the
+// total the progress display shows while the server has not sent one.
+func applyFileSize(cfg *config, options *types.DownloadOptions, size int64, supportsRanges bool) {
+	if !cfg.concurrentSet && !cfg.noConcurrent {
+		options.MaxConcurrency = 1
+		if supportsRanges {
+			options.MaxConcurrency = core.OptimalConcurrency(size)
+		}
+	}
+
+	if display, ok := options.Progress.(*progressDisplay); ok {
+		display.expectedSize = size
+	}
+
+	if callback := options.ProgressCallback; callback != nil {
+		options.ProgressCallback = func(bytesDownloaded, totalBytes int64, speed int64) {
+			if totalBytes <= 0 {
+				totalBytes = size
+			}
+			callback(bytesDownloaded, totalBytes, speed)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+func TestPreflight(t *testing.T) {
+	originalFormatter := formatter
+	formatter = ui.NewFormatter().WithColor(false).WithWriter(io.Discard)
+	defer func() { formatter = originalFormatter }()
+
+	var size int64
+	ranges := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ranges {
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}))
+	defer server.Close()
+
+	output := filepath.Join(t.TempDir(), "file.bin")
+	newOptions := func() *types.DownloadOptions {
+		return &types.DownloadOptions{
+			MaxConcurrency: 4,
+			Progress:       &progressDisplay{quiet: true},
+			ProgressCallback: func(bytesDownloaded, totalBytes int64, speed int64) {
+				if totalBytes != size {
+					t.Errorf("progress total = %d, want %d", totalBytes, size)
+				}
+			},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		size           int64
+		ranges         bool
+		cfg            *config
+		wantConcurrent int
+	}{
+		{"small file", 50 * 1024, true, &config{checkSpace: true}, 1},
+		{"large file", 200 << 20, true, &config{checkSpace: true}, 8},
+		{"no ranges", 200 << 20, false, &config{checkSpace: true}, 1},
+		{"--concurrent given", 200 << 20, true, &config{checkSpace: true, concurrentSet: true}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, ranges = tt.size, tt.ranges
+			options := newOptions()
+
+			if err := preflight(context.Background(), core.NewDownloader(), tt.cfg, server.URL+"/file.bin", output, options); err != nil {
+				t.Fatalf("preflight() error = %v", err)
+			}
+
+			if options.MaxConcurrency != tt.wantConcurrent {
+				t.Errorf("MaxConcurrency = %d, want %d", options.MaxConcurrency, tt.wantConcurrent)
+			}
+
+			if display := options.Progress.(*progressDisplay); display.expectedSize != tt.size {
+				t.Errorf("expectedSize = %d, want %d", display.expectedSize, tt.size)
+			}
+
+			options.ProgressCallback(0, 0, 0)
+		})
+	}
+
+	// A file larger than any disk fails the space check before downloading
+	size = 1 << 60
+	if err := preflight(context.Background(), core.NewDownloader(), &config{checkSpace: true},
+		server.URL+"/huge.bin", output, newOptions()); err == nil {
+		t.Error("preflight() should fail when the file does not fit on the disk")
+	}
+}
+
+func TestWantsPreflight(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		output  string
+		options *types.DownloadOptions
+		want    bool
+	}{
+		{"plain download", "https://example.com/a.iso", "a.iso", &types.DownloadOptions{}, true},
+		{"stdout", "https://example.com/a.iso", stdoutOutput, &types.DownloadOptions{}, false},
+		{"byte range", "https://example.com/a.iso", "a.iso", &types.DownloadOptions{ByteRange: &types.ByteRange{}}, false},
+		{"POST", "https://example.com/export", "a.csv", &types.DownloadOptions{Method: http.MethodPost}, false},
+		{"S3", "s3://bucket/a.iso", "a.iso", &types.DownloadOptions{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wantsPreflight(tt.url, tt.output, tt.options); got != tt.want {
+				t.Errorf("wantsPreflight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"io"
+
+	"github.com/forest6511/gdl/internal/checksum"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// downloadResult is the document "--output-format json" prints when a
+// download ends. It shares ndjsonSchemaVersion with the event stream.
+type downloadResult struct {
+	SchemaVersion   int    `json:"schema_version"`
+	Success         bool   `json:"success"`
+	URL             string `json:"url"`
+	Destination     string `json:"destination"`
+	TotalSize       int64  `json:"total_size"`
+	Bytes           int64  `json:"bytes"`
+	DurationMs      int64  `json:"duration_ms"`
+	AverageSpeed    int64  `json:"average_speed"`
+	Retries         int    `json:"retries"`
+	Resumed         bool   `json:"resumed"`
+	NotModified     bool   `json:"not_modified"`
+	Deduplicated    bool   `json:"deduplicated"`
+	DeltaReused     int64  `json:"delta_reused,omitempty"`
+	Skipped         bool   `json:"skipped"`
+	RangeViolations int    `json:"range_violations,omitempty"`
+	RangeFallback   bool   `json:"range_fallback,omitempty"`
+	SHA256          string `json:"sha256,omitempty"`
+	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
+	HTTPStatusCode  int    `json:"http_status_code,omitempty"`
+
+	Plan *transferPlan `json:"plan,omitempty"`
+}
+
+// transferPlan is the "plan" of a download result that was split into
+// pieces (see types.TransferPlan).
+type transferPlan struct {
+	Sources   int   `json:"sources"`
+	Pieces    int   `json:"pieces"`
+	PieceSize int64 `json:"piece_size"`
+	Requests  int   `json:"requests"`
+}
+
+// newDownloadResult describes the download of url to destination that ended
+// with stats, which may be nil, and err. checksum is the SHA-256 of the
+// saved file, if known.
+func newDownloadResult(url, destination string, stats *types.DownloadStats, checksum string, err error) downloadResult {
+	result := downloadResult{
+		SchemaVersion: ndjsonSchemaVersion,
+		Success:       err == nil,
+		URL:           url,
+		Destination:   destination,
+		SHA256:        checksum,
+	}
+
+	if stats != nil {
+		result.TotalSize = stats.TotalSize
+		result.Bytes = stats.BytesDownloaded
+		result.DurationMs = stats.Duration.Milliseconds()
+		result.AverageSpeed = stats.AverageSpeed
+		result.Retries = stats.Retries
+		result.Resumed = stats.Resumed
+		result.NotModified = stats.NotModified
+		result.Deduplicated = stats.Deduplicated
+		result.DeltaReused = stats.DeltaReused
+		result.Skipped = stats.Skipped
+		result.RangeViolations = stats.RangeViolations
+		result.RangeFallback = stats.RangeFallback
+
+		if plan := stats.Plan; plan != nil {
+			result.Plan = &transferPlan{Sources: plan.Sources, Pieces: plan.Pieces, PieceSize: plan.PieceSize, Requests: plan.Requests}
+		}
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorCode = gdlerrors.CodeUnknown.String()
+
+		var downloadErr *gdlerrors.DownloadError
+		if stdErrors.As(err, &downloadErr) {
+			result.ErrorCode = downloadErr.Code.String()
+			result.HTTPStatusCode = downloadErr.HTTPStatusCode
+		}
+
+	}
+
+	return result
+}
+
+// wantsEventsWriter reports whether the output format writes machine-readable
+// output to stdout or --events-file.
+func wantsEventsWriter(cfg *config) bool {
+	return cfg.output_format == outputFormatNDJSON || cfg.output_format == outputFormatJSON
+}
+
+// writeResult writes the result document of a download to w with
+// --output-format json.
+func writeResult(w io.Writer, cfg *config, url, destination string, stats *types.DownloadStats, checksum string, err error) {
+	if w == nil || cfg.output_format != outputFormatJSON {
+		return
+	}
+
+	writeDownloadResult(w, newDownloadResult(url, destination, stats, checksum, err))
+}
+
+// downloadChecksum returns the SHA-256 of the file a download saved, for the
+// json result and the history. A SHA-256 computed while the file was written,
+// as --checksum-algo sha256 asks for, is used as it is. Otherwise only the
+// json result, which promises it, has the file read again to compute it; the
+// history goes without, so recording a download costs no extra pass over
+// the file. It is "" when the file is not local, as with downloads to stdout
+// or a storage backend.
+func downloadChecksum(cfg *config, destination string, stats *types.DownloadStats) string {
+	if destination == stdoutOutput || (cfg.output_format != outputFormatJSON && !wantsHistory(stats)) {
+		return ""
+	}
+
+	if algorithm, _ := checksum.Normalize(cfg.checksumAlgo); algorithm == checksum.SHA256 && stats != nil && stats.Checksum != "" {
+		return stats.Checksum
+	}
+
+	if cfg.output_format != outputFormatJSON {
+		return ""
+	}
+
+	digest, _ := checksum.File(destination, checksum.SHA256)
+
+	return digest
+}
+
+// writeDownloadResult writes result to w as indented JSON.
+func writeDownloadResult(w io.Writer, result downloadResult) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	// Encoding errors are ignored, as for the event stream
+	_ = encoder.Encode(result)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// helloSHA256 is the SHA-256 of "hello\n".
+const helloSHA256 = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+func TestNewDownloadResult(t *testing.T) {
+	result := newDownloadResult("https://example.com/file.txt", "file.txt", &types.DownloadStats{
+		TotalSize:       6,
+		BytesDownloaded: 6,
+		Duration:        1500 * time.Millisecond,
+		AverageSpeed:    4,
+		Retries:         2,
+		Resumed:         true,
+	}, helloSHA256, nil)
+
+	if !result.Success || result.Bytes != 6 || result.DurationMs != 1500 || result.Retries != 2 ||
+		!result.Resumed || result.SHA256 != helloSHA256 {
+		t.Errorf("result = %+v, want the download's statistics and checksum", result)
+	}
+	if result.Error != "" || result.ErrorCode != "" {
+		t.Errorf("successful result has error %q (%s)", result.Error, result.ErrorCode)
+	}
+
+	// Failures carry the error code
+	result = newDownloadResult("https://example.com/missing", "missing", nil, "",
+		gdlerrors.FromHTTPStatus(http.StatusNotFound, "https://example.com/missing"))
+
+	if result.Success || result.HTTPStatusCode != http.StatusNotFound ||
+		result.ErrorCode != gdlerrors.CodeFileNotFound.String() {
+		t.Errorf("failed result = %+v, want a 404 FILE_NOT_FOUND error", result)
+	}
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	t.Setenv(historyFileEnv, "off")
+
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte("hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &types.DownloadStats{BytesDownloaded: 6}
+	jsonConfig := &config{output_format: outputFormatJSON}
+
+	if got := downloadChecksum(jsonConfig, file, stats); got != helloSHA256 {
+		t.Errorf("downloadChecksum() = %q, want the file's SHA-256", got)
+	}
+
+	// Nothing is hashed for downloads to stdout, or when nothing wants it
+	if got := downloadChecksum(jsonConfig, stdoutOutput, stats); got != "" {
+		t.Errorf("downloadChecksum(stdout) = %q, want none", got)
+	}
+	if got := downloadChecksum(&config{output_format: autoValue}, file, stats); got != "" {
+		t.Errorf("downloadChecksum() without json or history = %q, want none", got)
+	}
+
+	// The history only records a SHA-256 computed during the download
+	t.Setenv(historyFileEnv, filepath.Join(t.TempDir(), "history.jsonl"))
+	if got := downloadChecksum(&config{output_format: autoValue}, file, stats); got != "" {
+		t.Errorf("downloadChecksum() for the history = %q, want the file not read again", got)
+	}
+	streamed := &types.DownloadStats{BytesDownloaded: 6, Checksum: "streamed"}
+	if got := downloadChecksum(&config{output_format: autoValue, checksumAlgo: "sha256"}, file, streamed); got != "streamed" {
+		t.Errorf("downloadChecksum() with --checksum-algo sha256 = %q, want the digest computed during the download", got)
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	var buf bytes.Buffer
+
+	writeResult(&buf, &config{output_format: outputFormatNDJSON}, "https://example.com/a", "a", nil, "", nil)
+	if buf.Len() != 0 {
+		t.Errorf("ndjson output wrote a result document: %s", buf.String())
+	}
+
+	writeResult(&buf, &config{output_format: outputFormatJSON}, "https://example.com/a", stdoutOutput,
+		&types.DownloadStats{BytesDownloaded: 42}, "", nil)
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("invalid result document %q: %v", buf.String(), err)
+	}
+
+	if result["success"] != true || result["bytes"] != float64(42) || result["url"] != "https://example.com/a" {
+		t.Errorf("result document = %v", result)
+	}
+	if _, ok := result["error"]; ok {
+		t.Errorf("successful result document has an error: %v", result)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/forest6511/gdl/internal/resume"
+)
+
+// runResumeCommand handles "gdl resume [file [get options]]". Without a file
+// it lists the interrupted downloads; with one it continues that download.
+func runResumeCommand(args []string) int {
+	manager := resume.NewManager(resume.DefaultDir())
+
+	if len(args) == 0 {
+		if err := listResumable(os.Stdout, manager); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+
+		return 0
+	}
+
+	getArgs, err := resumeArgs(manager, args[0], args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showResumeUsage()
+		return 1
+	}
+
+	return runGetCommand(getArgs)
+}
+
+// resumeArgs returns the "gdl get" arguments that continue the interrupted
+// download of file, with options placed before the saved URL.
+func resumeArgs(manager *resume.Manager, file string, options []string) ([]string, error) {
+	info, err := manager.Load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if info == nil {
+		return nil, fmt.Errorf("no interrupted download of %s; run '%s resume' to list them", file, appName)
+	}
+
+	args := append([]string{"--resume", "-o", info.FilePath}, options...)
+
+	return append(args, info.URL), nil
+}
+
+// listResumable prints one line per interrupted download: its file, how much
+// of it is on disk and its URL.
+func listResumable(w io.Writer, manager *resume.Manager) error {
+	files, err := manager.ListResumeFiles()
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		_, _ = fmt.Fprintln(w, "No interrupted downloads")
+		return nil
+	}
+
+	for _, file := range files {
+		info, err := manager.Load(file)
+		if err != nil || info == nil {
+			continue
+		}
+
+		progress := formatBytes(info.DownloadedBytes)
+		if info.TotalBytes > 0 {
+			progress = fmt.Sprintf("%s of %s", progress, formatBytes(info.TotalBytes))
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", info.FilePath, progress, info.URL)
+	}
+
+	return nil
+}
+
+func showResumeUsage() {
+	fmt.Printf(`Resume Command:
+
+Usage: %s resume                      List interrupted downloads
+       %s resume <file> [options]     Continue the download of file
+
+Interrupted downloads are recorded in %s. Options are passed
+on to '%s get', for example to change the connection count or rate limit.
+
+Examples:
+  %s resume
+  %s resume ubuntu.iso --max-rate 5MB/s
+
+`, appName, appName, filepath.Join("~", ".gdl", "resume"), appName, appName, appName)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	gdlconfig "github.com/forest6511/gdl/pkg/config"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/rules"
+	"github.com/forest6511/gdl/pkg/secrets"
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+// loadFileConfig returns the configuration file, nil if it does not exist.
+func loadFileConfig() (*gdlconfig.Config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return gdlconfig.NewConfigLoader(path).Load()
+}
+
+// loadRules returns the rules of the configuration file, nil if it has none.
+// Header values written as keychain:NAME are read from the keychain by the
+// requests that send them.
+func loadRules(fileConfig *gdlconfig.Config) (*rules.Engine, error) {
+	if fileConfig == nil || len(fileConfig.Rules) == 0 {
+		return nil, nil
+	}
+
+	engine, err := rules.New(fileConfig.Rules)
+	if err != nil {
+		path, _ := configPath()
+		return nil, gdlerrors.NewConfigError("invalid rule in the config file", err, path)
+	}
+
+	return engine.WithResolver(func(value string) (string, error) {
+		return secrets.Resolve(keychain(), value)
+	}), nil
+}
+
+// applyCircuitBreaker sets the circuit breaker of cfg from the configuration
+// file's network.circuit_breaker, unless the command line set it.
+func applyCircuitBreaker(cfg *config, fileConfig *gdlconfig.Config) {
+	if fileConfig == nil || !fileConfig.Network.CircuitBreaker.Enabled {
+		return
+	}
+
+	breaker := fileConfig.Network.CircuitBreaker
+	if !cfg.circuitBreakerSet {
+		cfg.circuitBreaker = breaker.FailureThreshold
+	}
+	if !cfg.circuitCooldownSet {
+		cfg.circuitCooldown = time.Duration(breaker.Cooldown)
+	}
+}
+
+// applyRules returns the configuration of the download of url: cfg with the
+// User-Agent, connections and rate limit of the rules matching url, unless
+// the command line set them. Headers are added to each request by the rules'
+// middleware instead, so that redirects get those of their own host.
+func applyRules(cfg *config, url string) *config {
+	if cfg.rules == nil {
+		return cfg
+	}
+
+	rule := cfg.rules.MatchString(url)
+	if rule.Match == "" {
+		return cfg
+	}
+
+	if cfg.verbose {
+		formatter.PrintMessage(ui.MessageInfo, "Applying rules %s to %s", rule.Match, url)
+	}
+
+	ruled := *cfg
+
+	if rule.UserAgent != "" && !cfg.userAgentSet {
+		ruled.userAgent = rule.UserAgent
+	}
+
+	if rule.Concurrency > 0 && !cfg.concurrentSet && !cfg.noConcurrent {
+		ruled.concurrent = rule.Concurrency
+		ruled.concurrentSet = true
+	}
+
+	if rule.MaxRate != "" && cfg.maxRate == "" {
+		ruled.maxRate = rule.MaxRate
+	}
+
+	return &ruled
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplyRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{
+  "rules": [
+    {"match": "*.internal.corp", "headers": {"Authorization": "Bearer corp"}},
+    {"match": "example-cdn.com", "concurrency": 1, "max_rate": "1MB/s"},
+    {"match": "api.github.com", "user_agent": "my-tool/2.0"}
+  ]
+}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configPathEnv, path)
+
+	parse := func(args ...string) (*config, string, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+		defer func() { os.Args = origArgs }()
+
+		os.Args = append([]string{"gdl"}, args...)
+
+		return parseArgs()
+	}
+
+	cfg, url, err := parse("https://example-cdn.com/big.iso")
+	if err != nil || cfg.rules == nil || cfg.rules.Len() != 3 {
+		t.Fatalf("parseArgs() = %+v, %v", cfg, err)
+	}
+
+	ruled := applyRules(cfg, url)
+	if ruled == cfg || ruled.concurrent != 1 || !ruled.concurrentSet || ruled.maxRate != "1MB/s" {
+		t.Errorf("rules not applied: %+v", ruled)
+	}
+	if cfg.concurrentSet {
+		t.Error("applyRules should not change the configuration it was given")
+	}
+
+	if applyRules(cfg, "https://example.com/file") != cfg {
+		t.Error("a URL matching no rule should keep the configuration")
+	}
+
+	// The command line wins
+	cfg, url, err = parse("--user-agent", "cli/1.0", "-c", "8", "https://api.github.com/repos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ruled := applyRules(cfg, url); ruled.userAgent != "cli/1.0" {
+		t.Errorf("user agent = %q, want the one of --user-agent", ruled.userAgent)
+	}
+
+	cfg, url, _ = parse("https://api.github.com/repos")
+	if ruled := applyRules(cfg, url); ruled.userAgent != "my-tool/2.0" {
+		t.Errorf("user agent = %q, want the one of the rule", ruled.userAgent)
+	}
+
+	cfg, url, _ = parse("-c", "8", "https://example-cdn.com/big.iso")
+	if ruled := applyRules(cfg, url); ruled.concurrent != 8 {
+		t.Errorf("concurrent = %d, want the one of -c", ruled.concurrent)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rules": [{"match": "", "concurrency": 1}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parse("https://example.com/file"); err == nil {
+		t.Error("parseArgs() should fail for an invalid rule")
+	}
+}
+
+func TestApplyCircuitBreaker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{
+  "network": {"circuit_breaker": {"enabled": true, "failure_threshold": 4, "cooldown": "2m"}}
+}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configPathEnv, path)
+
+	parse := func(args ...string) *config {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+		defer func() { os.Args = origArgs }()
+
+		os.Args = append([]string{"gdl"}, args...)
+
+		cfg, _, err := parseArgs()
+		if err != nil {
+			t.Fatalf("parseArgs(%v) error = %v", args, err)
+		}
+
+		return cfg
+	}
+
+	cfg := parse("https://example.com/file")
+	if cfg.circuitBreaker != 4 || cfg.circuitCooldown != 2*time.Minute {
+		t.Errorf("circuit breaker = %d, %v, want the config file's 4, 2m", cfg.circuitBreaker, cfg.circuitCooldown)
+	}
+
+	// The command line wins, and 0 turns the breaker off
+	cfg = parse("--circuit-breaker", "0", "--circuit-cooldown", "5s", "https://example.com/file")
+	if cfg.circuitBreaker != 0 || cfg.circuitCooldown != 5*time.Second {
+		t.Errorf("circuit breaker = %d, %v, want the command line's 0, 5s", cfg.circuitBreaker, cfg.circuitCooldown)
+	}
+
+	// A disabled breaker in the config file is ignored
+	if err := os.WriteFile(path, []byte(`{"network": {"circuit_breaker": {"enabled": false, "failure_threshold": 4}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := parse("https://example.com/file"); cfg.circuitBreaker != 0 {
+		t.Errorf("circuit breaker = %d, want off", cfg.circuitBreaker)
+	}
+}
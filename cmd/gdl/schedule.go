@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/cli"
+	"github.com/forest6511/gdl/pkg/webhook"
+)
+
+// runScheduleCommand handles the "gdl schedule" subcommands.
+func runScheduleCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: schedule command required\n")
+		showScheduleUsage()
+		return 1
+	}
+
+	ctx := context.Background()
+	store := cli.NewScheduleStore(cli.GetDefaultScheduleFile())
+
+	command := args[0]
+	switch command {
+	case "add":
+		return handleScheduleAdd(ctx, store, args[1:])
+	case "list":
+		return handleScheduleList(ctx, store)
+	case "remove":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "Error: schedule remove requires an ID\n")
+			fmt.Fprintf(os.Stderr, "Usage: gdl schedule remove <id>\n")
+			return 1
+		}
+		return handleScheduleRemove(ctx, store, args[1])
+	case "run":
+		return handleScheduleRun(ctx, store, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown schedule command: %s\n", command)
+		showScheduleUsage()
+		return 1
+	}
+}
+
+// runDaemonCommand handles "gdl daemon", which runs the scheduler in the
+// foreground like "gdl schedule run", for use as a service, and "gdl daemon
+// users", which manages the users of a shared daemon.
+func runDaemonCommand(args []string) int {
+	if len(args) > 0 && args[0] == "users" {
+		return runDaemonUsersCommand(args[1:])
+	}
+
+	return handleScheduleRun(context.Background(), cli.NewScheduleStore(cli.GetDefaultScheduleFile()), args)
+}
+
+// handleScheduleAdd adds a recurring download: add <cron> <url> -o <path>,
+// with --user for a download of a daemon user, written below the user's
+// directory.
+func handleScheduleAdd(ctx context.Context, store *cli.ScheduleStore, args []string) int {
+	var positional []string
+	output, owner := "", ""
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-o" || arg == "--output":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a path\n", arg)
+				return 1
+			}
+			i++
+			output = args[i]
+		case strings.HasPrefix(arg, "--output="):
+			output = strings.TrimPrefix(arg, "--output=")
+		case arg == "--user":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a name\n", arg)
+				return 1
+			}
+			i++
+			owner = args[i]
+		case strings.HasPrefix(arg, "--user="):
+			owner = strings.TrimPrefix(arg, "--user=")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) != 2 {
+		fmt.Fprintf(os.Stderr, "Error: schedule add requires a cron expression and a URL\n")
+		fmt.Fprintf(os.Stderr, "Usage: gdl schedule add \"<cron>\" <url> [-o <path>] [--user <name>]\n")
+		return 1
+	}
+
+	expr, url := positional[0], positional[1]
+	if output == "" {
+		output = extractFilenameFromURL(url)
+	}
+
+	if owner != "" {
+		var err error
+		if output, err = ownerOutput(ctx, owner, output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding schedule: %v\n", err)
+			return 1
+		}
+	}
+
+	sd, err := store.AddFor(ctx, owner, expr, url, output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding schedule: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Scheduled download %s: %s -> %s (%s)\n", sd.ID, sd.URL, sd.Output, sd.Cron)
+	if next, err := sd.NextRun(); err == nil && !next.IsZero() {
+		fmt.Printf("Next run: %s\n", next.Format(time.RFC3339))
+	}
+	fmt.Printf("Scheduled downloads run while '%s schedule run' is active\n", appName)
+
+	return 0
+}
+
+// ownerOutput returns where a download of the daemon user owner to output is
+// written: output if it is an absolute path below the user's directory, or
+// output below that directory.
+func ownerOutput(ctx context.Context, owner, output string) (string, error) {
+	user, err := cli.NewUserStore(cli.GetDefaultUsersFile()).Get(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+
+	if filepath.IsAbs(output) {
+		if !user.Owns(output) {
+			return "", fmt.Errorf("output %s is outside the directory of user %s, %s", output, user.Name, user.Dir)
+		}
+		return output, nil
+	}
+
+	return user.Output(output)
+}
+
+// handleScheduleList lists the scheduled downloads.
+func handleScheduleList(ctx context.Context, store *cli.ScheduleStore) int {
+	schedules, err := store.List(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing schedules: %v\n", err)
+		return 1
+	}
+
+	if len(schedules) == 0 {
+		fmt.Println("No scheduled downloads")
+		return 0
+	}
+
+	fmt.Printf("%-4s %-16s %-25s %-14s %s\n", "ID", "SCHEDULE", "NEXT RUN", "LAST STATUS", "URL -> OUTPUT")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, sd := range schedules {
+		nextRun := "never"
+		if next, err := sd.NextRun(); err == nil && !next.IsZero() {
+			nextRun = next.Format("2006-01-02 15:04 MST")
+		}
+		switch {
+		case sd.Paused:
+			nextRun = "paused"
+		case sd.RunRequested:
+			nextRun = "now"
+		}
+
+		status := sd.LastStatus
+		if status == "" {
+			status = "-"
+		}
+
+		fmt.Printf("%-4s %-16s %-25s %-14s %s -> %s\n", sd.ID, sd.Cron, nextRun, status, sd.URL, sd.Output)
+		if sd.Owner != "" {
+			fmt.Printf("     user: %s\n", sd.Owner)
+		}
+		if sd.LastError != "" {
+			fmt.Printf("     last error: %s\n", sd.LastError)
+		}
+	}
+
+	return 0
+}
+
+// handleScheduleRemove removes a scheduled download.
+func handleScheduleRemove(ctx context.Context, store *cli.ScheduleStore, id string) int {
+	if err := store.Remove(ctx, id); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing schedule: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Removed scheduled download %s\n", id)
+	return 0
+}
+
+// handleScheduleRun runs scheduled downloads as they become due until
+// interrupted, or once with --once. --webhook posts the runs' events to a URL
+// and --ui serves a dashboard of them, which --ui-token protects.
+func handleScheduleRun(ctx context.Context, store *cli.ScheduleStore, args []string) int {
+	once := false
+	hookURL := ""
+	uiAddr := ""
+	uiToken := os.Getenv(dashboardTokenEnv)
+	hookSecret := os.Getenv("GDL_WEBHOOK_SECRET")
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--once":
+			once = true
+		case arg == "--webhook" || arg == "--webhook-secret" || arg == "--ui" || arg == "--ui-token":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", arg)
+				return 1
+			}
+			i++
+			switch arg {
+			case "--webhook":
+				hookURL = args[i]
+			case "--webhook-secret":
+				hookSecret = args[i]
+			case "--ui-token":
+				uiToken = args[i]
+			default:
+				uiAddr = args[i]
+			}
+		case strings.HasPrefix(arg, "--webhook="):
+			hookURL = strings.TrimPrefix(arg, "--webhook=")
+		case strings.HasPrefix(arg, "--webhook-secret="):
+			hookSecret = strings.TrimPrefix(arg, "--webhook-secret=")
+		case strings.HasPrefix(arg, "--ui="):
+			uiAddr = strings.TrimPrefix(arg, "--ui=")
+		case strings.HasPrefix(arg, "--ui-token="):
+			uiToken = strings.TrimPrefix(arg, "--ui-token=")
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown schedule run option: %s\n", arg)
+			return 1
+		}
+	}
+
+	if once && uiAddr != "" {
+		fmt.Fprintf(os.Stderr, "Error: --ui cannot be used with --once\n")
+		return 1
+	}
+
+	var hooks *webhook.Queue
+	if hookURL != "" {
+		if u, err := url.Parse(hookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: --webhook requires an http or https URL: %s\n", hookURL)
+			return 1
+		}
+
+		hooks = webhook.NewQueue(webhook.NewSender(hookURL, hookSecret), func(p *webhook.Payload, err error) {
+			fmt.Fprintf(os.Stderr, "%s schedule %s: %s webhook not delivered: %v\n",
+				time.Now().Format(time.RFC3339), p.Job, p.Event, err)
+		})
+		defer hooks.Close()
+
+		store.WithEvents(scheduleWebhook(hooks))
+	}
+
+	var board *dashboard
+	users := cli.NewUserStore(cli.GetDefaultUsersFile())
+
+	fetch := func(ctx context.Context, sd *cli.ScheduledDownload) (string, error) {
+		quota, err := quotaFor(ctx, users, sd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s schedule %s: %s failed: %v\n", time.Now().Format(time.RFC3339), sd.ID, sd.URL, err)
+			return "", err
+		}
+
+		var observers []gdl.ProgressCallback
+		if hooks != nil {
+			observers = append(observers, webhookProgress(hooks, sd))
+		}
+
+		if board == nil {
+			return fetchScheduled(ctx, sd, quota, observers...)
+		}
+
+		return board.run(ctx, sd, func(ctx context.Context, progress gdl.ProgressCallback) (string, error) {
+			return fetchScheduled(ctx, sd, quota, append(observers, progress)...)
+		})
+	}
+
+	if err := recoverScheduled(ctx, store); err != nil {
+		fmt.Fprintf(os.Stderr, "Error recovering scheduled downloads: %v\n", err)
+		return 1
+	}
+
+	if once {
+		if err := store.RunDue(ctx, time.Now(), fetch); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running scheduled downloads: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if uiAddr != "" {
+		board = newDashboard(store, historyFile()).withToken(uiToken)
+
+		if list, err := users.List(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading daemon users: %v\n", err)
+			return 1
+		} else if len(list) > 0 {
+			board.withUsers(users)
+		}
+
+		addr, err := board.serve(ctx, uiAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting the dashboard: %v\n", err)
+			return 1
+		}
+
+		if !board.authenticated() {
+			fmt.Printf("Dashboard at http://%s/\n", addr)
+		} else {
+			fmt.Printf("Dashboard at http://%s/ (open http://%s/?token=<token> once to sign in)\n", addr, addr)
+		}
+	}
+
+	fmt.Printf("Running scheduled downloads from %s (Ctrl+C to stop)\n", cli.GetDefaultScheduleFile())
+
+	if err := store.Run(ctx, cli.DefaultSchedulePollInterval, fetch); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "Error running scheduled downloads: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// recoverScheduled reports the runs the previous runner left in progress when
+// it crashed or the host went down: they are made again, resuming their part
+// files, unless they kept being cut short.
+func recoverScheduled(ctx context.Context, store *cli.ScheduleStore) error {
+	recovered, err := store.Recover(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	for _, sd := range recovered {
+		if sd.LastStatus == cli.ScheduleStatusFailed && sd.Interrupted == 0 {
+			fmt.Fprintf(os.Stderr, "%s schedule %s: %s failed: %s\n", now, sd.ID, sd.URL, sd.LastError)
+			continue
+		}
+
+		fmt.Printf("%s schedule %s: resuming %s, cut short by a crash or restart\n", now, sd.ID, sd.URL)
+	}
+
+	return nil
+}
+
+// scheduleWebhook turns the events of scheduled runs into webhook payloads.
+func scheduleWebhook(hooks *webhook.Queue) cli.ScheduleEventFunc {
+	return func(event string, sd *cli.ScheduledDownload, status string, err error) {
+		p := &webhook.Payload{Event: event, Job: sd.ID, URL: sd.URL, Output: sd.Output, Status: status}
+		if err != nil {
+			p.Error = err.Error()
+		}
+
+		hooks.Notify(p)
+	}
+}
+
+// webhookMilestones are the percentages at which a scheduled download posts
+// a progress webhook.
+var webhookMilestones = []int{25, 50, 75}
+
+// webhookProgress returns a progress callback posting a progress webhook as
+// the download of sd passes each of webhookMilestones.
+func webhookProgress(hooks *webhook.Queue, sd *cli.ScheduledDownload) gdl.ProgressCallback {
+	next := 0
+
+	return func(p gdl.Progress) {
+		for next < len(webhookMilestones) && p.TotalSize > 0 && p.Percentage >= float64(webhookMilestones[next]) {
+			hooks.Notify(&webhook.Payload{
+				Event:     webhook.EventProgress,
+				Job:       sd.ID,
+				URL:       sd.URL,
+				Output:    sd.Output,
+				Percent:   webhookMilestones[next],
+				Bytes:     p.BytesDownloaded,
+				TotalSize: p.TotalSize,
+			})
+			next++
+		}
+	}
+}
+
+// fetchScheduled downloads a scheduled file in timestamping mode, so that only
+// files changed on the server are fetched again, under quota (nil for none),
+// telling observers about its progress. A download stopped by cancelling ctx
+// fails with its cause.
+func fetchScheduled(ctx context.Context, sd *cli.ScheduledDownload, quota *scheduleQuota, observers ...gdl.ProgressCallback) (string, error) {
+	opts := &gdl.Options{
+		OnlyIfNewer: true,
+		CreateDirs:  true,
+		AtomicWrite: true,
+		Quiet:       true,
+	}
+
+	if quota != nil {
+		quotaCtx, progress, done, err := quota.start(ctx, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s schedule %s: %s failed: %v\n", time.Now().Format(time.RFC3339), sd.ID, sd.URL, err)
+			return "", err
+		}
+		defer done()
+
+		ctx = quotaCtx
+		observers = append(observers, progress)
+	}
+
+	if len(observers) > 0 {
+		opts.ProgressCallback = func(p gdl.Progress) {
+			for _, observe := range observers {
+				observe(p)
+			}
+		}
+	}
+
+	stats, err := gdl.DownloadWithOptions(ctx, sd.URL, sd.Output, opts)
+	if err != nil && ctx.Err() != nil {
+		err = context.Cause(ctx)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s schedule %s: %s failed: %v\n", now, sd.ID, sd.URL, err)
+		return "", err
+	}
+
+	if stats.NotModified {
+		fmt.Printf("%s schedule %s: %s not modified\n", now, sd.ID, sd.URL)
+		return cli.ScheduleStatusNotModified, nil
+	}
+
+	recordHistory(sd.URL, sd.Output, max(stats.TotalSize, stats.BytesDownloaded), "")
+
+	fmt.Printf("%s schedule %s: downloaded %s to %s\n", now, sd.ID, sd.URL, sd.Output)
+	return cli.ScheduleStatusDownloaded, nil
+}
+
+func showScheduleUsage() {
+	fmt.Printf(`Scheduled Download Commands:
+
+Usage: %s schedule <command> [args]
+
+Commands:
+  add "<cron>" <url> [-o <path>] [--user <name>]
+                           Download url to path on a cron schedule
+  list                     List scheduled downloads with their next run
+  remove <id>              Remove a scheduled download
+  run [--once] [--webhook URL [--webhook-secret SECRET]] [--ui ADDR [--ui-token TOKEN]]
+                           Run scheduled downloads as they become due
+                           (--once runs the due downloads and exits;
+                           --ui serves a web dashboard on ADDR)
+
+Schedules use five cron fields (minute hour day-of-month month day-of-week)
+or @hourly, @daily, @weekly, @monthly and @yearly, in local time. Scheduled
+downloads are conditional requests: unchanged files are not fetched again.
+Schedules are stored in ~/.gdl/schedules.json.
+
+Examples:
+  %s schedule add "0 3 * * *" https://example.com/data.csv -o /data/data.csv
+  %s schedule add @hourly https://example.com/feed.xml
+  %s schedule list
+  %s schedule remove 2
+  %s schedule run
+
+`, appName, appName, appName, appName, appName, appName)
+}
+
+func showDaemonUsage() {
+	fmt.Printf(`Daemon Command:
+
+Usage: %s daemon [--once] [--webhook URL [--webhook-secret SECRET]] [--ui ADDR [--ui-token TOKEN]]
+
+Runs the downloads added with "%s schedule add" as they become due, until
+interrupted; the same as "%s schedule run". Use it as the command of a
+systemd service, launchd agent or Windows service. --once runs the due
+downloads and exits, for cron or timers.
+
+A run cut short by stopping the daemon, a crash or a reboot is made again
+when the daemon next starts, continuing its part file; one cut short more
+than 3 times in a row is recorded as failed.
+
+--webhook posts a JSON event to URL when a run is queued, started, passes
+25, 50 and 75%%, completed or failed; failed deliveries are retried 3 times.
+--webhook-secret (or GDL_WEBHOOK_SECRET) signs each body with HMAC-SHA256
+in the X-Gdl-Signature-256 header, as "sha256=<hex digest>".
+
+--ui serves a web dashboard on ADDR (such as 127.0.0.1:8080) showing the
+scheduled downloads, the progress and speed of those running and the
+download history, with buttons to pause, resume, cancel and run them.
+Without a token ADDR must be a loopback address. --ui-token (or
+GDL_DASHBOARD_TOKEN) makes the page and its API require TOKEN, so ADDR may
+be any address: open http://ADDR/?token=TOKEN once in the browser, or send
+"Authorization: Bearer TOKEN" from scripts. The token travels in clear
+text, so put the dashboard behind HTTPS on an untrusted network.
+
+`, appName, appName, appName)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/cli"
+	"github.com/forest6511/gdl/pkg/validation"
+	"github.com/forest6511/gdl/pkg/webhook"
+)
+
+func TestRunScheduleCommand(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	var fullRequests atomic.Int32
+	lastModified := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fullRequests.Add(1)
+		}
+		http.ServeContent(w, r, "file.txt", lastModified, strings.NewReader("scheduled content"))
+	}))
+	defer server.Close()
+
+	output := filepath.Join(t.TempDir(), "data", "file.txt")
+
+	if code := runScheduleCommand([]string{"add", "* * * * *", server.URL + "/file.txt", "-o", output}); code != 0 {
+		t.Fatalf("schedule add exit code = %d, want 0", code)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"add", "* * * * *"},
+		{"add", "not a cron", server.URL, "-o", output},
+		{"add", "* * * * *", server.URL, "-o"},
+		{"remove"},
+		{"remove", "42"},
+		{"run", "--forever"},
+		{"run", "--webhook"},
+		{"run", "--once", "--webhook", "ftp://example.com/hook"},
+		{"unknown"},
+	} {
+		if code := runScheduleCommand(args); code == 0 {
+			t.Errorf("schedule %v exit code = 0, want an error", args)
+		}
+	}
+
+	if code := runScheduleCommand([]string{"list"}); code != 0 {
+		t.Errorf("schedule list exit code = %d, want 0", code)
+	}
+
+	// Backdate the schedule so that a run is due
+	file := cli.GetDefaultScheduleFile()
+	data, err := os.ReadFile(file) // #nosec G304 -- test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config cli.ScheduleConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	config.Schedules[0].Created = time.Now().Add(-time.Hour)
+	data, _ = json.Marshal(config)
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The run's events are posted, signed, to the webhook
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(webhook.SignatureHeader) != webhook.Sign([]byte("secret"), body) {
+			t.Errorf("%s webhook has a bad signature", r.Header.Get(webhook.EventHeader))
+		}
+		if event := r.Header.Get(webhook.EventHeader); event != webhook.EventProgress {
+			mu.Lock()
+			events = append(events, event)
+			mu.Unlock()
+		}
+	}))
+	defer hook.Close()
+
+	if code := runScheduleCommand([]string{"run", "--once", "--webhook", hook.URL, "--webhook-secret", "secret"}); code != 0 {
+		t.Fatalf("schedule run --once exit code = %d, want 0", code)
+	}
+
+	mu.Lock()
+	if want := []string{webhook.EventQueued, webhook.EventStarted, webhook.EventCompleted}; !slices.Equal(events, want) {
+		t.Errorf("webhook events = %v, want %v", events, want)
+	}
+	mu.Unlock()
+
+	content, err := os.ReadFile(output) // #nosec G304 -- test file
+	if err != nil || string(content) != "scheduled content" {
+		t.Fatalf("downloaded content = %q, %v", content, err)
+	}
+
+	schedules, err := cli.NewScheduleStore(file).List(t.Context())
+	if err != nil || len(schedules) != 1 || schedules[0].LastStatus != cli.ScheduleStatusDownloaded {
+		t.Fatalf("schedules after a run = %+v, %v, want a downloaded run", schedules, err)
+	}
+
+	// Nothing is due again within the same minute
+	if code := runScheduleCommand([]string{"run", "--once"}); code != 0 || fullRequests.Load() != 1 {
+		t.Errorf("second run: exit code %d, full downloads %d, want 0 and 1", code, fullRequests.Load())
+	}
+
+	if code := runScheduleCommand([]string{"remove", schedules[0].ID}); code != 0 {
+		t.Errorf("schedule remove exit code = %d, want 0", code)
+	}
+	if schedules, _ := cli.NewScheduleStore(file).List(t.Context()); len(schedules) != 0 {
+		t.Errorf("schedules after remove = %+v, want none", schedules)
+	}
+}
+
+func TestFetchScheduledNotModified(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	lastModified := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.txt", lastModified, strings.NewReader("unchanged"))
+	}))
+	defer server.Close()
+
+	sd := &cli.ScheduledDownload{ID: "1", URL: server.URL + "/file.txt", Output: filepath.Join(t.TempDir(), "file.txt")}
+
+	status, err := fetchScheduled(t.Context(), sd, nil)
+	if err != nil || status != cli.ScheduleStatusDownloaded {
+		t.Fatalf("first fetch = %q, %v, want downloaded", status, err)
+	}
+
+	status, err = fetchScheduled(t.Context(), sd, nil)
+	if err != nil || status != cli.ScheduleStatusNotModified {
+		t.Errorf("second fetch = %q, %v, want not modified", status, err)
+	}
+}
+
+func TestFetchScheduledQuota(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	content := strings.Repeat("x", 256*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file.bin" {
+			http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(content))
+			return
+		}
+
+		// Half the body, then nothing until the download is stopped
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, _ = io.WriteString(w, content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	users := cli.NewUserStore(filepath.Join(dir, "users.json"))
+	user, _, err := users.Add(t.Context(), "alice", filepath.Join(dir, "alice"), 0, int64(len(content))+1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd := &cli.ScheduledDownload{ID: "1", URL: server.URL + "/file.bin", Output: filepath.Join(user.Dir, "file.bin"), Owner: "alice"}
+
+	quota, err := quotaFor(t.Context(), users, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := fetchScheduled(t.Context(), sd, quota); err != nil || status != cli.ScheduleStatusDownloaded {
+		t.Fatalf("first fetch = %q, %v, want downloaded", status, err)
+	}
+
+	if user, _ = users.Get(t.Context(), "alice"); user.Used(time.Now()) != int64(len(content)) {
+		t.Errorf("used = %d, want %d", user.Used(time.Now()), len(content))
+	}
+
+	// The second download would pass the quota and is stopped
+	sd.URL, sd.Output = server.URL+"/stalled.bin", filepath.Join(user.Dir, "stalled.bin")
+	quota, _ = quotaFor(t.Context(), users, sd)
+	if _, err := fetchScheduled(t.Context(), sd, quota); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("fetch past the quota error = %v, want %v", err, errQuotaExceeded)
+	}
+
+	// With the quota used up, runs fail at once
+	quota, _ = quotaFor(t.Context(), users, sd)
+	if _, err := fetchScheduled(t.Context(), sd, quota); !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("fetch with the quota used up error = %v, want %v", err, errQuotaExceeded)
+	}
+
+	// Downloads of removed users and outside the user's directory do not run
+	if _, err := quotaFor(t.Context(), users, &cli.ScheduledDownload{Owner: "alice", Output: filepath.Join(dir, "x")}); err == nil {
+		t.Error("quotaFor() of a download outside the user's directory should fail")
+	}
+	if _, err := quotaFor(t.Context(), users, &cli.ScheduledDownload{Owner: "bob", Output: filepath.Join(dir, "x")}); err == nil {
+		t.Error("quotaFor() of an unknown user should fail")
+	}
+}
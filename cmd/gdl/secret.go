@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/secrets"
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+// credentialHelperEnv sets the default of --credential-helper.
+const credentialHelperEnv = "GDL_CREDENTIAL_HELPER"
+
+// keychain returns the keychain credentials are kept in; tests replace it.
+var keychain = secrets.System
+
+// resolveSecrets replaces the -H header values and the --proxy-user password
+// written as "keychain:NAME" with the secrets stored under NAME.
+func resolveSecrets(cfg *config) error {
+	for key, value := range cfg.headers {
+		if !secrets.IsRef(value) {
+			continue
+		}
+
+		secret, err := secrets.Resolve(keychain(), value)
+		if err != nil {
+			return gdlerrors.NewConfigError(fmt.Sprintf("failed to read header %s from the keychain", key), err, "")
+		}
+
+		cfg.headers[key] = secret
+	}
+
+	if user, password, ok := strings.Cut(cfg.proxyUser, ":"); ok && secrets.IsRef(password) {
+		secret, err := secrets.Resolve(keychain(), password)
+		if err != nil {
+			return gdlerrors.NewConfigError("failed to read the proxy password from the keychain", err, "")
+		}
+
+		cfg.proxyUser = user + ":" + secret
+	}
+
+	return nil
+}
+
+// readSecret reads a secret from in: without echo after prompt when in is a
+// terminal, or else its first line.
+func readSecret(in io.Reader, prompt string) (string, error) {
+	if f, ok := in.(*os.File); ok && ui.IsTerminal(f) {
+		fmt.Fprint(os.Stderr, prompt)
+		secret, err := term.ReadPassword(int(f.Fd())) // #nosec G115 -- file descriptors fit in an int
+		fmt.Fprintln(os.Stderr)
+
+		return string(secret), err
+	}
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// runSecretCommand handles "gdl secret set|get|delete NAME".
+func runSecretCommand(args []string) int {
+	if err := secretCommand(os.Stdin, os.Stdout, keychain(), args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if !errors.Is(err, secrets.ErrNotFound) && !errors.Is(err, secrets.ErrUnavailable) {
+			showSecretUsage()
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// secretCommand runs a "gdl secret" subcommand against store, reading
+// secrets from in.
+func secretCommand(in io.Reader, w io.Writer, store secrets.Keychain, args []string) error {
+	if len(args) == 0 {
+		return errors.New("secret command required")
+	}
+	sub := args[0]
+
+	fs := flag.NewFlagSet("secret", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	bearer := fs.Bool("bearer", false, "Store the value as a bearer token")
+	basic := fs.String("basic", "", "Store the value as the password of USER")
+
+	// Flags may follow the name
+	var positional []string
+	rest := args[1:]
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		return fmt.Errorf("secret %s requires a NAME", sub)
+	}
+	name := positional[0]
+
+	if sub != "set" && (*bearer || *basic != "") {
+		return fmt.Errorf("--bearer and --basic only apply to secret set")
+	}
+
+	switch sub {
+	case "set":
+		if *bearer && *basic != "" {
+			return errors.New("--bearer and --basic cannot be combined")
+		}
+
+		value, err := readSecret(in, fmt.Sprintf("Secret for %s: ", name))
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return errors.New("empty secret")
+		}
+
+		switch {
+		case *bearer:
+			value = "Bearer " + value
+		case *basic != "":
+			value = "Basic " + base64.StdEncoding.EncodeToString([]byte(*basic+":"+value))
+		}
+
+		if err := store.Set(name, value); err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(w, "Stored %s; refer to it as %s\n", name, secrets.Ref(name))
+	case "get":
+		value, err := store.Get(name)
+		if err != nil {
+			return fmt.Errorf("secret %q: %w", name, err)
+		}
+
+		_, _ = fmt.Fprintln(w, value)
+	case "delete":
+		if err := store.Delete(name); err != nil {
+			return fmt.Errorf("secret %q: %w", name, err)
+		}
+
+		_, _ = fmt.Fprintf(w, "Deleted %s\n", name)
+	default:
+		return fmt.Errorf("unknown secret command %q", sub)
+	}
+
+	return nil
+}
+
+func showSecretUsage() {
+	fmt.Printf(`Secret Command:
+
+Usage: %s secret set NAME [--bearer | --basic USER]  Store a secret read from stdin
+       %s secret get NAME                           Print a stored secret
+       %s secret delete NAME                        Delete a stored secret
+
+Secrets are kept in the keychain of the platform: the macOS Keychain, the
+Windows Credential Manager, or the Secret Service (GNOME Keyring, KWallet)
+through secret-tool on Linux. Wherever a header value or the password of
+--proxy-user is written as keychain:NAME, gdl reads it from the keychain, so
+that tokens stay out of shell history, scripts and config files.
+
+The secret is read without echo when stdin is a terminal, or as the first
+line of stdin. --bearer stores it as "Bearer SECRET" and --basic USER as the
+"Basic" credentials of USER, ready for an Authorization header.
+
+Examples:
+  %s secret set github --bearer
+  %s -H "Authorization: keychain:github" https://api.github.com/repos/o/r/tarball
+  %s --proxy https://proxy:3128 --proxy-user alice:keychain:proxy URL
+  %s plugin config s3 --set-secret secret_key
+  %s secret delete github
+
+`, appName, appName, appName, appName, appName, appName, appName, appName)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/secrets"
+)
+
+func TestSecretCommand(t *testing.T) {
+	store := secrets.NewMemory()
+
+	run := func(input string, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := secretCommand(strings.NewReader(input), &out, store, args)
+
+		return out.String(), err
+	}
+
+	if _, err := run("ghp_abc\n", "set", "github", "--bearer"); err != nil {
+		t.Fatalf("secret set failed: %v", err)
+	}
+	if got, _ := store.Get("github"); got != "Bearer ghp_abc" {
+		t.Errorf("stored %q, want a bearer token", got)
+	}
+
+	if _, err := run("hunter2", "set", "--basic", "alice", "registry"); err != nil {
+		t.Fatalf("secret set --basic failed: %v", err)
+	}
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:hunter2"))
+	if got, _ := store.Get("registry"); got != want {
+		t.Errorf("stored %q, want %q", got, want)
+	}
+
+	if out, err := run("", "get", "registry"); err != nil || out != want+"\n" {
+		t.Errorf("secret get = %q, %v", out, err)
+	}
+
+	if _, err := run("", "delete", "registry"); err != nil {
+		t.Fatalf("secret delete failed: %v", err)
+	}
+	if _, err := run("", "get", "registry"); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("secret get of a deleted secret = %v, want ErrNotFound", err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"set"},
+		{"set", "empty"},
+		{"set", "both", "--bearer", "--basic", "alice"},
+		{"get", "github", "--bearer"},
+		{"list"},
+	} {
+		if _, err := run("", args...); err == nil {
+			t.Errorf("secret %v should fail", args)
+		}
+	}
+}
+
+func TestResolveSecretArgs(t *testing.T) {
+	store := secrets.NewMemory()
+	_ = store.Set("github", "Bearer ghp_abc")
+	_ = store.Set("proxy", "p:ss")
+
+	saved := keychain
+	keychain = func() secrets.Keychain { return store }
+	t.Cleanup(func() { keychain = saved })
+
+	parse := func(args ...string) (*config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+		defer func() { os.Args = origArgs }()
+
+		os.Args = append([]string{"gdl"}, args...)
+		cfg, _, err := parseArgs()
+
+		return cfg, err
+	}
+
+	cfg, err := parse("-H", "Authorization: keychain:github", "-H", "X-Plain: value",
+		"--proxy-user", "alice:keychain:proxy", "https://example.com/file")
+	if err != nil {
+		t.Fatalf("parseArgs() failed: %v", err)
+	}
+	if cfg.headers["Authorization"] != "Bearer ghp_abc" || cfg.headers["X-Plain"] != "value" {
+		t.Errorf("headers = %v", cfg.headers)
+	}
+	if cfg.proxyUser != "alice:p:ss" {
+		t.Errorf("proxy user = %q", cfg.proxyUser)
+	}
+
+	if _, err := parse("-H", "Authorization: keychain:missing", "https://example.com/file"); err == nil {
+		t.Error("parseArgs() should fail for a missing secret")
+	}
+}
+
+func TestParseCredentialHelper(t *testing.T) {
+	parse := func(args ...string) (*config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+		defer func() { os.Args = origArgs }()
+
+		os.Args = append([]string{"gdl"}, args...)
+		cfg, _, err := parseArgs()
+
+		return cfg, err
+	}
+
+	t.Setenv(credentialHelperEnv, "manager")
+
+	cfg, err := parse("https://example.com/file")
+	if err != nil || cfg.credentialHelper != "manager" {
+		t.Fatalf("parseArgs() = %+v, %v, want the helper of $%s", cfg, err, credentialHelperEnv)
+	}
+
+	cfg, err = parse("--credential-helper", "/opt/bin/creds --role ci", "https://example.com/file")
+	if err != nil || cfg.credentialHelper != "/opt/bin/creds --role ci" {
+		t.Fatalf("parseArgs() = %+v, %v", cfg, err)
+	}
+}
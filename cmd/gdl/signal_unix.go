@@ -5,6 +5,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,12 +14,16 @@ import (
 )
 
 // handleInterruption sets up graceful interruption handling for Unix systems.
+// SIGINT and SIGTERM cancel ctx, which stops the download once what it has
+// written is flushed and recorded for resuming, and set the exit code the run
+// returns.
 func handleInterruption(ctx context.Context, cancel context.CancelFunc, cfg *config) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
 		sig := <-sigChan
+		code := recordInterruption(sig)
 
 		if !cfg.quiet {
 			fmt.Println() // New line after progress bar
@@ -32,11 +37,33 @@ func handleInterruption(ctx context.Context, cancel context.CancelFunc, cfg *con
 				proceed, err := formatter.ConfirmPrompt("Force immediate termination?", false)
 				if err == nil && proceed {
 					formatter.PrintMessage(ui.MessageError, "Forcing immediate termination")
-					os.Exit(130) // Standard exit code for SIGINT
+					os.Exit(code)
 				}
 			}
 		}
 
+		// Stopping the download keeps what it has written for resuming
 		cancel()
 	}()
 }
+
+// handleStatusRequests prints a snapshot of the running download's progress
+// to w each time the process receives SIGUSR1 (kill -USR1 PID), until ctx is
+// done. The transfer goes on undisturbed.
+func handleStatusRequests(ctx context.Context, w io.Writer) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(sigChan)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigChan:
+				currentStatus.write(w)
+			}
+		}
+	}()
+}
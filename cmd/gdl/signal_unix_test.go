@@ -5,6 +5,7 @@ package main
 import (
 	"context"
 	"os"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -208,3 +209,73 @@ func TestHandleInterruptionWithDifferentConfigs(t *testing.T) {
 		})
 	}
 }
+
+// lineWriter passes each write to a channel.
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestStatusRequestsUnix(t *testing.T) {
+	if raceEnabled {
+		t.Skip("Skipping signal handler tests with race detector enabled")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(lineWriter, 1)
+	handleStatusRequests(ctx, out)
+
+	// Give the goroutine time to start
+	time.Sleep(50 * time.Millisecond)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("Failed to send signal: %v", err)
+	}
+
+	select {
+	case line := <-out:
+		if !strings.HasPrefix(line, "Status: ") {
+			t.Errorf("status line = %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No status was printed on SIGUSR1")
+	}
+}
+
+func TestInterruptExitCodeUnix(t *testing.T) {
+	if raceEnabled {
+		t.Skip("Skipping signal handler tests with race detector enabled")
+	}
+
+	defer interruptExitCode.Store(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if code := interruptedExitCode(ctx); code != 0 {
+		t.Fatalf("interruptedExitCode() = %d before any signal", code)
+	}
+
+	handleInterruption(ctx, cancel, &config{quiet: true})
+
+	// Give the goroutine time to start
+	time.Sleep(50 * time.Millisecond)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to send signal: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Context was not cancelled on SIGTERM")
+	}
+
+	if code := interruptedExitCode(ctx); code != 143 {
+		t.Errorf("interruptedExitCode() = %d, want 143", code)
+	}
+}
@@ -5,21 +5,29 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/forest6511/gdl/pkg/ui"
 )
 
 // handleInterruption sets up graceful interruption handling for Windows systems.
+// SIGINT and SIGTERM cancel ctx, which stops the download once what it has
+// written is flushed and recorded for resuming, and set the exit code the run
+// returns.
 func handleInterruption(ctx context.Context, cancel context.CancelFunc, cfg *config) {
 	sigChan := make(chan os.Signal, 1)
-	// Windows only supports SIGINT (Ctrl+C)
-	signal.Notify(sigChan, syscall.SIGINT)
+	// Ctrl+C arrives as SIGINT; closing the console, logging off and shutting
+	// down arrive as SIGTERM
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
 		sig := <-sigChan
+		code := recordInterruption(sig)
 
 		if !cfg.quiet {
 			fmt.Println() // New line after progress bar
@@ -33,11 +41,46 @@ func handleInterruption(ctx context.Context, cancel context.CancelFunc, cfg *con
 				proceed, err := formatter.ConfirmPrompt("Force immediate termination?", false)
 				if err == nil && proceed {
 					formatter.PrintMessage(ui.MessageError, "Forcing immediate termination")
-					os.Exit(1) // Windows exit code for interruption
+					os.Exit(code)
 				}
 			}
 		}
 
+		// Stopping the download keeps what it has written for resuming
 		cancel()
 	}()
 }
+
+// statusRequestInterval is how often handleStatusRequests looks for the
+// status request file.
+const statusRequestInterval = time.Second
+
+// statusRequestFile returns the file whose creation asks the process for a
+// status snapshot, as Windows has no SIGUSR1: %TEMP%\gdl-status-PID.
+func statusRequestFile() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gdl-status-%d", os.Getpid()))
+}
+
+// handleStatusRequests prints a snapshot of the running download's progress
+// to w each time the status request file is created, deleting it, until ctx
+// is done. The transfer goes on undisturbed.
+func handleStatusRequests(ctx context.Context, w io.Writer) {
+	path := statusRequestFile()
+
+	go func() {
+		ticker := time.NewTicker(statusRequestInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := os.Stat(path); err == nil {
+					_ = os.Remove(path)
+					currentStatus.write(w)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/cli"
+)
+
+// usageFileEnv overrides the file bandwidth usage is recorded in; "off"
+// turns recording off.
+const usageFileEnv = "GDL_USAGE_FILE"
+
+// usageFile returns the file bandwidth usage is recorded in, or "" if
+// recording is off.
+func usageFile() string {
+	switch path := os.Getenv(usageFileEnv); path {
+	case "":
+		return cli.GetDefaultUsageFile()
+	case "off":
+		return ""
+	default:
+		return path
+	}
+}
+
+// recordUsage adds a download of bytes from url that took duration to the
+// usage file for "gdl stats". A usage file that cannot be written never fails
+// the download.
+func recordUsage(url string, bytes int64, duration time.Duration) {
+	file := usageFile()
+	if file == "" || bytes <= 0 || !isHTTPURL(url) {
+		return
+	}
+
+	_ = cli.NewUsageStore(file).Record(context.Background(), url, bytes, duration, time.Now())
+}
+
+// statsConfig holds the options of "gdl stats".
+type statsConfig struct {
+	days  int
+	top   int
+	json  bool
+	reset bool
+}
+
+// runStatsCommand handles "gdl stats".
+func runStatsCommand(args []string) int {
+	scfg := &statsConfig{}
+
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineStatsFlags(fs, scfg)
+
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || scfg.days < 0 || scfg.top < 0 {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		showStatsUsage()
+		return 1
+	}
+
+	file := usageFile()
+	if file == "" {
+		fmt.Fprintf(os.Stderr, "Error: usage recording is off ($%s=off)\n", usageFileEnv)
+		return 1
+	}
+
+	if err := usageReport(context.Background(), os.Stdout, cli.NewUsageStore(file), scfg, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// defineStatsFlags registers the flags of "gdl stats" on fs. It is shared by
+// runStatsCommand and "gdl completion".
+func defineStatsFlags(fs *flag.FlagSet, scfg *statsConfig) {
+	fs.IntVar(&scfg.days, "days", 30, "Days to report, including today (0 for all)")
+	fs.IntVar(&scfg.top, "top", 10, "Hosts to list (0 for all)")
+	fs.BoolVar(&scfg.json, "json", false, "Print the report as JSON")
+	fs.BoolVar(&scfg.reset, "reset", false, "Delete the recorded usage")
+}
+
+// usageReport prints the usage recorded in store over the days up to now.
+func usageReport(ctx context.Context, w io.Writer, store *cli.UsageStore, scfg *statsConfig, now time.Time) error {
+	if scfg.reset {
+		if err := store.Reset(ctx); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(w, "Usage statistics deleted")
+		return nil
+	}
+
+	var since time.Time
+	if scfg.days > 0 {
+		since = now.AddDate(0, 0, 1-scfg.days)
+	}
+
+	summary, err := store.Summary(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	if scfg.top > 0 && len(summary.Hosts) > scfg.top {
+		summary.Hosts = summary.Hosts[:scfg.top]
+	}
+
+	if scfg.json {
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(w, string(data))
+		return nil
+	}
+
+	period := "all time"
+	if scfg.days > 0 {
+		period = fmt.Sprintf("the last %d days", scfg.days)
+	}
+
+	if summary.Total.Downloads == 0 {
+		_, _ = fmt.Fprintf(w, "No downloads recorded in %s\n", period)
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(w, "Downloaded %s in %d downloads over %s, %s\n\n",
+		formatBytes(summary.Total.Bytes), summary.Total.Downloads, period, usageSpeed(summary.Total))
+
+	_, _ = fmt.Fprintln(w, "Top hosts:")
+	for _, host := range summary.Hosts {
+		_, _ = fmt.Fprintf(w, "  %-30s %10s %6d downloads  %s\n",
+			host.Name, formatBytes(host.Bytes), host.Downloads, usageSpeed(host))
+	}
+
+	_, _ = fmt.Fprintln(w, "\nBy day:")
+	for _, day := range summary.Days {
+		_, _ = fmt.Fprintf(w, "  %-30s %10s %6d downloads  %s\n",
+			day.Name, formatBytes(day.Bytes), day.Downloads, usageSpeed(day))
+	}
+
+	return nil
+}
+
+// usageSpeed formats the average speed of total.
+func usageSpeed(total cli.UsageTotal) string {
+	speed := total.AverageSpeed()
+	if speed <= 0 {
+		return "speed unknown"
+	}
+
+	return "avg " + formatBytes(speed) + "/s"
+}
+
+func showStatsUsage() {
+	fmt.Printf(`Stats Command:
+
+Usage: %s stats [options]
+
+Shows the bandwidth gdl used: the bytes downloaded, the hosts they came from
+and the average speeds, per day. Every download that transfers data is
+recorded in ~/.gdl/usage.json, or in $%s if set; set it to "off" to
+record nothing.
+
+Options:
+  --days N        Days to report, including today (default: 30, 0 for all)
+  --top N         Hosts to list (default: 10, 0 for all)
+  --json          Print the report as JSON
+  --reset         Delete the recorded usage
+
+Examples:
+  %s stats
+  %s stats --days 7 --top 5
+  %s stats --days 0 --json
+
+`, appName, usageFileEnv, appName, appName, appName)
+}
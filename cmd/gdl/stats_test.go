@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/cli"
+)
+
+func TestRecordUsage(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "usage.json")
+	t.Setenv(usageFileEnv, file)
+
+	recordUsage("https://example.com/a.zip", 2048, time.Second)
+	recordUsage("https://example.com/b.zip", 0, time.Second)
+	recordUsage("s3://bucket/c.zip", 1024, time.Second)
+
+	summary, err := cli.NewUsageStore(file).Summary(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total.Bytes != 2048 || summary.Total.Downloads != 1 {
+		t.Errorf("Total = %+v, want only the http download of 2048 bytes", summary.Total)
+	}
+
+	t.Setenv(usageFileEnv, "off")
+	if usageFile() != "" {
+		t.Errorf("usageFile() = %q with recording off", usageFile())
+	}
+}
+
+func TestUsageReport(t *testing.T) {
+	ctx := context.Background()
+	store := cli.NewUsageStore(filepath.Join(t.TempDir(), "usage.json"))
+	now := time.Now()
+
+	var out bytes.Buffer
+	if err := usageReport(ctx, &out, store, &statsConfig{days: 7}, now); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No downloads recorded in the last 7 days") {
+		t.Errorf("empty report = %q", out.String())
+	}
+
+	for _, r := range []struct {
+		url   string
+		bytes int64
+		at    time.Time
+	}{
+		{"https://example.com/a", 4096, now},
+		{"https://cdn.example.org/b", 1024, now},
+		{"https://old.example.net/c", 8192, now.AddDate(0, 0, -10)},
+	} {
+		if err := store.Record(ctx, r.url, r.bytes, time.Second, r.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out.Reset()
+	if err := usageReport(ctx, &out, store, &statsConfig{days: 7, top: 1}, now); err != nil {
+		t.Fatal(err)
+	}
+	report := out.String()
+	if !strings.Contains(report, "Downloaded 5.0 KB in 2 downloads over the last 7 days") ||
+		!strings.Contains(report, "example.com") || strings.Contains(report, "cdn.example.org") ||
+		strings.Contains(report, "old.example.net") {
+		t.Errorf("report = %q, want 2 downloads and only the top host", report)
+	}
+
+	out.Reset()
+	if err := usageReport(ctx, &out, store, &statsConfig{json: true}, now); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"bytes": 13312`) {
+		t.Errorf("JSON report = %s, want all 13312 bytes", out.String())
+	}
+
+	out.Reset()
+	if err := usageReport(ctx, &out, store, &statsConfig{reset: true}, now); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := store.Summary(ctx, time.Time{})
+	if err != nil || summary.Total.Downloads != 0 {
+		t.Errorf("Summary() after --reset = %+v, %v", summary, err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// statusReport keeps the latest progress of the running download, so that a
+// snapshot of it can be printed on request, such as on SIGUSR1, in quiet runs
+// and runs whose output goes to a log.
+type statusReport struct {
+	mu         sync.Mutex
+	filename   string
+	started    time.Time
+	downloaded int64
+	total      int64
+	speed      int64
+	segments   []types.Segment
+	running    bool
+}
+
+// currentStatus is the status of the download the get command is running.
+var currentStatus = &statusReport{}
+
+// start records that the download of filename, of total bytes (0 when
+// unknown), began.
+func (s *statusReport) start(filename string, total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.filename, s.started, s.running = filename, time.Now(), true
+	s.downloaded, s.total, s.speed, s.segments = 0, total, 0, nil
+}
+
+// update records the progress of the download. Downloads reported without
+// start are timed from their first update.
+func (s *statusReport) update(downloaded, total, speed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		s.started, s.running = time.Now(), true
+	}
+
+	s.downloaded, s.speed = downloaded, speed
+	if total > 0 {
+		s.total = total
+	}
+}
+
+// updateSegments records the segments of a chunked download.
+func (s *statusReport) updateSegments(segments []types.Segment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.segments = segments
+}
+
+// stop records that the download ended.
+func (s *statusReport) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = false
+}
+
+// write prints a one-line snapshot of the download to w: its bytes and
+// percentage, speed, time left and connections in use.
+func (s *statusReport) write(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		_, _ = fmt.Fprintln(w, "Status: no download in progress")
+		return
+	}
+
+	parts := []string{formatBytes(s.downloaded)}
+	if s.total > 0 {
+		parts[0] = fmt.Sprintf("%s of %s (%.1f%%)", formatBytes(s.downloaded), formatBytes(s.total),
+			float64(s.downloaded)/float64(s.total)*100)
+	}
+
+	if s.speed > 0 {
+		parts = append(parts, formatBytes(s.speed)+"/s")
+	}
+
+	if eta := calculateETA(s.speed, s.total, s.downloaded); eta != "" {
+		parts = append(parts, strings.TrimSpace(eta))
+	}
+
+	connections := 1
+	if len(s.segments) > 0 {
+		connections = 0
+
+		for _, segment := range s.segments {
+			if segment.State == types.SegmentActive {
+				connections++
+			}
+		}
+	}
+
+	if connections == 1 {
+		parts = append(parts, "1 connection")
+	} else {
+		parts = append(parts, fmt.Sprintf("%d connections", connections))
+	}
+
+	parts = append(parts, "elapsed "+time.Since(s.started).Round(time.Second).String())
+
+	if s.filename != "" {
+		parts[0] = s.filename + ": " + parts[0]
+	}
+
+	_, _ = fmt.Fprintf(w, "Status: %s\n", strings.Join(parts, ", "))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestStatusReportWrite(t *testing.T) {
+	var buf bytes.Buffer
+
+	status := &statusReport{}
+	status.write(&buf)
+	if got := buf.String(); got != "Status: no download in progress\n" {
+		t.Errorf("idle status = %q", got)
+	}
+
+	status.start("file.bin", 4096)
+	status.update(1024, 0, 512)
+	status.updateSegments([]types.Segment{
+		{State: types.SegmentActive},
+		{State: types.SegmentActive},
+		{State: types.SegmentComplete},
+	})
+
+	buf.Reset()
+	status.write(&buf)
+	got := buf.String()
+
+	for _, want := range []string{"Status: file.bin: ", "(25.0%)", "/s, ", "ETA", "2 connections", "elapsed "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("status = %q, want it to contain %q", got, want)
+		}
+	}
+
+	status.stop()
+	buf.Reset()
+	status.write(&buf)
+	if !strings.Contains(buf.String(), "no download in progress") {
+		t.Errorf("stopped status = %q", buf.String())
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/stream"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+)
+
+// streamConfig configures "gdl stream".
+type streamConfig struct {
+	url          string
+	output       string
+	headers      StringSlice
+	userAgent    string
+	maxRate      string
+	maxBandwidth int64
+	maxHeight    int
+	jobs         int
+	retries      int
+	noAudio      bool
+	keepSegments bool
+	force        bool
+	quiet        bool
+}
+
+// runStreamCommand handles "gdl stream <manifest-url>".
+func runStreamCommand(args []string) int {
+	scfg, err := parseStreamArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showStreamUsage()
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return downloadStream(ctx, gdl.NewDownloader(), scfg, os.Stdout, isTerminal())
+}
+
+// parseStreamArgs parses the arguments of "gdl stream", which may put flags
+// before or after the URL.
+func parseStreamArgs(args []string) (*streamConfig, error) {
+	scfg := &streamConfig{}
+
+	fs := flag.NewFlagSet("stream", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineStreamFlags(fs, scfg)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		return nil, fmt.Errorf("stream requires exactly one playlist or manifest URL")
+	}
+	scfg.url = positional[0]
+
+	if scfg.maxBandwidth < 0 || scfg.maxHeight < 0 || scfg.jobs < 0 || scfg.retries < 0 {
+		return nil, fmt.Errorf("--max-bandwidth, --max-height, --jobs and --retry cannot be negative")
+	}
+
+	for _, header := range scfg.headers {
+		if name, _, found := strings.Cut(header, ":"); !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q: expected Name: value", header)
+		}
+	}
+
+	if scfg.maxRate != "" {
+		if err := ratelimit.ValidateRate(scfg.maxRate); err != nil {
+			return nil, err
+		}
+	}
+
+	if scfg.output == "" {
+		scfg.output = streamOutputName(scfg.url, scfg.keepSegments)
+	}
+
+	return scfg, nil
+}
+
+// defineStreamFlags registers the flags of "gdl stream" on fs.
+func defineStreamFlags(fs *flag.FlagSet, scfg *streamConfig) {
+	fs.StringVar(&scfg.output, "o", "", "Output file, or directory with --keep-segments")
+	fs.StringVar(&scfg.output, "output", "", "Output file, or directory with --keep-segments")
+	fs.Var(&scfg.headers, "H", "Add a header to every request")
+	fs.Var(&scfg.headers, "header", "Add a header to every request")
+	fs.StringVar(&scfg.userAgent, "user-agent", "gdl/"+version, "User-Agent string to use")
+	fs.Int64Var(&scfg.maxBandwidth, "max-bandwidth", 0, "Highest variant bandwidth in bits per second")
+	fs.IntVar(&scfg.maxHeight, "max-height", 0, "Highest variant resolution height, e.g. 720")
+	fs.IntVar(&scfg.jobs, "jobs", stream.DefaultConcurrency, "Segments downloaded at once")
+	fs.IntVar(&scfg.retries, "retry", 0, "Retries of each segment")
+	fs.StringVar(&scfg.maxRate, "max-rate", "", "Maximum download rate of each segment (e.g., 1MB/s)")
+	fs.BoolVar(&scfg.noAudio, "no-audio", false, "Skip the separate audio track")
+	fs.BoolVar(&scfg.keepSegments, "keep-segments", false, "Keep the segments as separate files with a local playlist")
+	fs.BoolVar(&scfg.force, "f", false, "Overwrite an existing output file")
+	fs.BoolVar(&scfg.force, "force", false, "Overwrite an existing output file")
+	fs.BoolVar(&scfg.quiet, "q", false, "Only report failures")
+	fs.BoolVar(&scfg.quiet, "quiet", false, "Only report failures")
+}
+
+// streamOutputName returns the default output of a manifest URL: its file
+// name with .mp4 for a DASH manifest and .ts for an HLS playlist, or without
+// extension for a directory of segments.
+func streamOutputName(rawURL string, keepSegments bool) string {
+	name := "stream"
+	ext := ".ts"
+
+	if u, err := url.Parse(rawURL); err == nil {
+		base := path.Base(u.Path)
+		if strings.EqualFold(path.Ext(base), ".mpd") {
+			ext = ".mp4"
+		}
+		if trimmed := strings.TrimSuffix(base, path.Ext(base)); trimmed != "" && trimmed != "." && trimmed != "/" {
+			name = trimmed
+		}
+	}
+
+	if keepSegments {
+		return name
+	}
+
+	return name + ext
+}
+
+// downloadStream downloads scfg.url and reports the files written to out.
+func downloadStream(ctx context.Context, downloader *gdl.Downloader, scfg *streamConfig, out io.Writer, terminal bool) int {
+	headers := make(map[string]string)
+	for _, header := range scfg.headers {
+		name, value, _ := strings.Cut(header, ":")
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	opts := &gdl.StreamOptions{
+		MaxBandwidth: scfg.maxBandwidth,
+		MaxHeight:    scfg.maxHeight,
+		Concurrency:  scfg.jobs,
+		NoAudio:      scfg.noAudio,
+		KeepSegments: scfg.keepSegments,
+		Options: &gdl.Options{
+			Headers:           headers,
+			UserAgent:         scfg.userAgent,
+			MaxRate:           parseBatchRate(scfg.maxRate),
+			RetryAttempts:     scfg.retries,
+			OverwriteExisting: scfg.force,
+		},
+	}
+	if !scfg.quiet {
+		opts.Progress = streamProgress(out, terminal)
+	}
+
+	start := time.Now()
+	result, err := downloader.DownloadStream(ctx, scfg.url, scfg.output, opts)
+	if terminal && !scfg.quiet && result != nil && result.Segments > 0 {
+		_, _ = fmt.Fprintln(out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error downloading %s: %v\n", scfg.url, err)
+		return 1
+	}
+
+	recordUsage(scfg.url, result.Bytes, time.Since(start))
+	for _, file := range result.Files {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			recordHistory(scfg.url, file, info.Size(), "")
+		}
+	}
+
+	if !scfg.quiet {
+		_, _ = fmt.Fprintf(out, "Downloaded %s stream to %s (%d segments, %s, %s)\n", strings.ToUpper(result.Format),
+			result.Files[0], result.Segments, formatBytes(result.Bytes), result.Duration.Round(time.Second))
+		for _, file := range result.Files[1:] {
+			_, _ = fmt.Fprintf(out, "Separate track: %s\n", file)
+		}
+	}
+
+	return 0
+}
+
+// streamProgress reports the segments written: on one line redrawn in place
+// on a terminal, or one line per tenth of the segments otherwise.
+func streamProgress(out io.Writer, terminal bool) func(done, total int) {
+	next := 0
+
+	return func(done, total int) {
+		if terminal {
+			_, _ = fmt.Fprintf(out, "\rSegment %d/%d", done, total)
+			return
+		}
+
+		if percent := done * 100 / total; percent >= next {
+			_, _ = fmt.Fprintf(out, "%d%% (%d/%d segments)\n", percent, done, total)
+			next = (percent/lineProgressStep + 1) * lineProgressStep
+		}
+	}
+}
+
+func showStreamUsage() {
+	fmt.Printf(`Stream Command:
+
+Usage: %s stream <manifest-url> [options]
+
+Downloads an HLS playlist (.m3u8) or DASH manifest (.mpd): picks the best
+variant within --max-bandwidth and --max-height, fetches its segments several
+at a time, decrypts AES-128 segments with the keys the playlist names, and
+concatenates them in order into one MPEG-TS or fragmented MP4 file. A
+separate audio track is written next to it, as NAME.audio.EXT. Live streams
+and DRM-protected streams are not supported.
+
+Options:
+  -o, --output FILE     Output file (default: the manifest's name with .ts for
+                        HLS or .mp4 for DASH), or directory with --keep-segments
+  -H, --header H        Add a header to every request (repeatable)
+      --user-agent UA   User-Agent string to use
+      --max-bandwidth N  Highest variant bandwidth in bits per second
+      --max-height N    Highest variant resolution height (e.g., 720)
+      --no-audio        Skip the separate audio track
+      --jobs N          Segments downloaded at once (default: 4)
+      --retry N         Retries of each segment (default: 3)
+      --max-rate RATE   Maximum download rate of each segment (e.g., 1MB/s)
+      --keep-segments   Write the segments as separate files in the output
+                        directory, with a local index.m3u8 playlist
+  -f, --force           Overwrite an existing output file
+  -q, --quiet           Only report failures
+
+Examples:
+  %s stream https://example.com/vod/master.m3u8 -o talk.ts
+  %s stream https://example.com/dash/manifest.mpd --max-height 720
+  %s stream https://example.com/vod/master.m3u8 -H "Cookie: session=abc" --keep-segments
+
+`, appName, appName, appName, appName)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestParseStreamArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		output  string
+		headers []string
+	}{
+		{"default HLS output", []string{"https://example.com/vod/master.m3u8"}, false, "master.ts", nil},
+		{"default DASH output", []string{"https://example.com/dash/talk.mpd?token=1"}, false, "talk.mp4", nil},
+		{"default directory", []string{"https://example.com/vod/master.m3u8", "--keep-segments"}, false, "master", nil},
+		{"flags after URL", []string{"https://example.com/a.m3u8", "-o", "out.ts", "-H", "Cookie: a=b"}, false, "out.ts", []string{"Cookie: a=b"}},
+		{"no URL", []string{"-o", "out.ts"}, true, "", nil},
+		{"two URLs", []string{"https://example.com/a.m3u8", "https://example.com/b.m3u8"}, true, "", nil},
+		{"negative jobs", []string{"https://example.com/a.m3u8", "--jobs", "-1"}, true, "", nil},
+		{"invalid header", []string{"https://example.com/a.m3u8", "-H", "Cookie"}, true, "", nil},
+		{"invalid rate", []string{"https://example.com/a.m3u8", "--max-rate", "fast"}, true, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scfg, err := parseStreamArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseStreamArgs() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStreamArgs() error = %v", err)
+			}
+
+			if scfg.output != tt.output || fmt.Sprint([]string(scfg.headers)) != fmt.Sprint(tt.headers) {
+				t.Errorf("parseStreamArgs() = %+v", scfg)
+			}
+		})
+	}
+}
+
+func TestDownloadStream(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	files := map[string]string{
+		"/vod/master.m3u8": "#EXTM3U\n" +
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"en\",DEFAULT=YES,URI=\"audio.m3u8\"\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=900000,RESOLUTION=854x480,AUDIO=\"aud\"\nvideo.m3u8\n",
+		"/vod/video.m3u8": "#EXTM3U\n#EXTINF:10,\nv1.ts\n#EXTINF:10,\nv2.ts\n#EXT-X-ENDLIST\n",
+		"/vod/audio.m3u8": "#EXTM3U\n#EXTINF:20,\na1.aac\n#EXT-X-ENDLIST\n",
+		"/vod/v1.ts":      "video-1 ",
+		"/vod/v2.ts":      "video-2",
+		"/vod/a1.aac":     "audio",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok || r.Header.Get("Cookie") != "session=abc" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "talk.ts")
+	scfg := &streamConfig{
+		url:     server.URL + "/vod/master.m3u8",
+		output:  dest,
+		headers: StringSlice{"Cookie: session=abc"},
+		jobs:    2,
+	}
+
+	var out bytes.Buffer
+	if code := downloadStream(context.Background(), gdl.NewDownloader(), scfg, &out, false); code != 0 {
+		t.Fatalf("downloadStream() = %d, output:\n%s", code, out.String())
+	}
+
+	for file, want := range map[string]string{dest: "video-1 video-2", filepath.Join(filepath.Dir(dest), "talk.audio.ts"): "audio"} {
+		if got, err := os.ReadFile(file); err != nil || string(got) != want { // #nosec G304 -- test file
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(file), got, err, want)
+		}
+	}
+
+	for _, want := range []string{"100% (3/3 segments)", "Downloaded HLS stream to " + dest + " (3 segments", "Separate track: "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("downloadStream() output does not contain %q:\n%s", want, out.String())
+		}
+	}
+
+	// An existing output is kept without --force
+	out.Reset()
+	if code := downloadStream(context.Background(), gdl.NewDownloader(), scfg, &out, false); code != 1 {
+		t.Errorf("downloadStream() over an existing file = %d, want 1", code)
+	}
+	scfg.force, scfg.quiet = true, true
+	if code := downloadStream(context.Background(), gdl.NewDownloader(), scfg, &out, false); code != 0 || out.Len() != 0 {
+		t.Errorf("downloadStream() --force --quiet = %d, output:\n%s", code, out.String())
+	}
+}
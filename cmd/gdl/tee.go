@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/pkg/destination"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+// splitBucketTarget splits an s3:// or gs:// (also gcs://) --tee target into
+// its scheme, bucket and key. ok is false for local paths.
+func splitBucketTarget(target string) (scheme, bucket, key string, ok bool) {
+	scheme, rest, found := strings.Cut(target, "://")
+	if !found {
+		return "", "", "", false
+	}
+
+	bucket, key, _ = strings.Cut(rest, "/")
+
+	return scheme, bucket, key, true
+}
+
+// validateTeeTarget checks a --tee target before anything is downloaded.
+func validateTeeTarget(target string) error {
+	if target == "" || target == stdoutOutput {
+		return gdlerrors.NewValidationError("tee", "--tee needs a file, directory, s3:// or gs:// location")
+	}
+
+	scheme, bucket, _, ok := splitBucketTarget(target)
+	if !ok {
+		return nil
+	}
+
+	switch scheme {
+	case "s3", "gs", "gcs":
+	default:
+		return gdlerrors.NewValidationError("tee", fmt.Sprintf("unsupported --tee location %q: expected s3:// or gs://", target))
+	}
+
+	if bucket == "" {
+		return gdlerrors.NewValidationError("tee", fmt.Sprintf("--tee location %q has no bucket", target))
+	}
+
+	return nil
+}
+
+// teeDestination returns the destination of a --tee target for the download
+// saved as outputFile, its location for messages, and a function releasing
+// the client it uses. A target that is a directory, or a bucket location
+// ending in a slash, gets the name of outputFile. Objects are streamed with
+// multipart uploads, so copies of any size skip the local disk.
+func teeDestination(ctx context.Context, target, outputFile string) (types.Destination, string, func(), error) {
+	name := filepath.Base(outputFile)
+
+	scheme, bucket, key, ok := splitBucketTarget(target)
+	if !ok {
+		if strings.HasSuffix(target, "/") || strings.HasSuffix(target, string(filepath.Separator)) {
+			target = filepath.Join(target, name)
+		} else if info, err := os.Stat(target); err == nil && info.IsDir() {
+			target = filepath.Join(target, name)
+		}
+
+		return destination.NewFile(target), target, func() {}, nil
+	}
+
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += name
+	}
+
+	if scheme == "s3" {
+		awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, "", nil, gdlerrors.WrapError(err, gdlerrors.CodeConfigError, "failed to load the AWS configuration")
+		}
+
+		return destination.NewS3Multipart(s3.NewFromConfig(awsConfig), bucket, key, nil),
+			"s3://" + bucket + "/" + key, func() {}, nil
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, "", nil, gdlerrors.WrapError(err, gdlerrors.CodeConfigError, "failed to create the Cloud Storage client")
+	}
+
+	return destination.NewGCSMultipart(client.Bucket(bucket), key, nil),
+		"gs://" + bucket + "/" + key, func() { _ = client.Close() }, nil
+}
+
+// performTeeDownload downloads url to outputFile and to the --tee targets in
+// one pass. A target that fails is reported and dropped while the others go
+// on; the download fails if any of them did not get the file.
+func performTeeDownload(
+	ctx context.Context,
+	downloader *core.Downloader,
+	url, outputFile string,
+	options *types.DownloadOptions,
+	cfg *config,
+) (*types.DownloadStats, error) {
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	if cfg.createDirs {
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0o750); err != nil {
+			return nil, gdlerrors.NewStorageError("create directory", err, filepath.Dir(outputFile))
+		}
+	}
+
+	dests := []types.Destination{destination.NewFile(outputFile)}
+	locations := []string{outputFile}
+
+	for _, target := range cfg.tee {
+		dest, location, release, err := teeDestination(ctx, target, outputFile)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		dests = append(dests, dest)
+		locations = append(locations, location)
+	}
+
+	tee := destination.NewTee(dests...)
+
+	// Existing copies, local or not, are only replaced when asked to
+	options.OverwriteExisting = options.OverwriteExisting || cfg.ifExists == types.CollisionOverwrite
+
+	stats, err := downloader.DownloadToDestination(ctx, url, tee, options)
+	if err != nil {
+		return stats, err
+	}
+
+	var failed []string
+
+	for i, result := range tee.Results() {
+		switch {
+		case result != nil:
+			formatter.PrintMessage(ui.MessageWarning, "Failed to write %s: %v", locations[i], result)
+			failed = append(failed, locations[i])
+		case i > 0 && !cfg.quiet:
+			formatter.PrintMessage(ui.MessageInfo, "Also written to %s", locations[i])
+		}
+	}
+
+	if len(failed) > 0 {
+		err := gdlerrors.NewStorageError("tee", fmt.Errorf("download not written to %s", strings.Join(failed, ", ")), failed[0])
+
+		stats.Success = false
+		stats.Error = err
+
+		return stats, err
+	}
+
+	return stats, nil
+}
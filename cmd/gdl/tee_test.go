@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestParseTeeArgs(t *testing.T) {
+	parse := func(args ...string) (*config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+		origArgs := os.Args
+		defer func() { os.Args = origArgs }()
+
+		os.Args = append([]string{"gdl"}, args...)
+		cfg, _, err := parseArgs()
+
+		return cfg, err
+	}
+
+	cfg, err := parse("--tee", "/mnt/backup/", "--tee", "s3://bucket/images/", "https://example.com/disk.img")
+	if err != nil || len(cfg.tee) != 2 || cfg.tee[1] != "s3://bucket/images/" {
+		t.Fatalf("parseArgs() = %+v, %v", cfg, err)
+	}
+
+	for _, args := range [][]string{
+		{"--tee", "ftp://host/file"},
+		{"--tee", "s3:///key"},
+		{"--tee", "-"},
+		{"--tee", "copy.img", "-o", "-"},
+		{"--tee", "copy.img", "--resume"},
+		{"--tee", "copy.img", "--if-exists", "rename"},
+		{"--tee", "copy.img", "--checksum", "sha256:abc"},
+	} {
+		if _, err := parse(append(args, "https://example.com/disk.img")...); err == nil {
+			t.Errorf("parseArgs(%q) succeeded", args)
+		}
+	}
+}
+
+func TestPerformTeeDownload(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	originalFormatter := formatter
+	initializeFormatter(&config{quiet: true})
+	defer func() { formatter = originalFormatter }()
+
+	data := bytes.Repeat([]byte("tee "), 1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "disk.img", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	backup := t.TempDir()
+	output := filepath.Join(dir, "disk.img")
+	broken := filepath.Join(dir, "missing", "disk.img")
+
+	cfg := &config{quiet: true, tee: []string{backup, filepath.Join(dir, "copy.img"), broken}}
+
+	stats, err := performTeeDownload(context.Background(), core.NewDownloader(), server.URL+"/disk.img", output,
+		&types.DownloadOptions{}, cfg)
+	if err == nil {
+		t.Fatal("performTeeDownload() with a broken target succeeded")
+	}
+	if stats == nil || stats.BytesDownloaded != int64(len(data)) {
+		t.Errorf("stats = %+v, want the file downloaded once", stats)
+	}
+
+	// The other copies are written all the same
+	for _, path := range []string{output, filepath.Join(backup, "disk.img"), filepath.Join(dir, "copy.img")} {
+		if content, _ := os.ReadFile(path); !bytes.Equal(content, data) { // #nosec G304 -- test file
+			t.Errorf("%s was not written", path)
+		}
+	}
+
+	// Existing copies are kept unless asked to replace them
+	cfg.tee = cfg.tee[:2]
+	if _, err := performTeeDownload(context.Background(), core.NewDownloader(), server.URL+"/disk.img", output,
+		&types.DownloadOptions{}, cfg); err == nil {
+		t.Error("performTeeDownload() over existing files succeeded")
+	}
+
+	cfg.ifExists = types.CollisionOverwrite
+	if _, err := performTeeDownload(context.Background(), core.NewDownloader(), server.URL+"/disk.img", output,
+		&types.DownloadOptions{}, cfg); err != nil {
+		t.Errorf("performTeeDownload() with --if-exists=overwrite = %v", err)
+	}
+}
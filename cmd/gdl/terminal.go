@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/ui"
+)
+
+const (
+	// maxProgressBarWidth and minProgressBarWidth bound the bar of the
+	// terminal progress line; below the minimum the bar is left out.
+	maxProgressBarWidth = 30
+	minProgressBarWidth = 10
+
+	// lineProgressStep is the percentage between progress lines written to
+	// redirected output, and lineProgressInterval the time between them when
+	// the size is unknown.
+	lineProgressStep     = 10
+	lineProgressInterval = 5 * time.Second
+)
+
+// isTerminal reports whether stdout is a terminal that can show a progress
+// bar redrawn in place: not redirected to a file or a pipe, not a CI log or
+// a dumb terminal, and accepting ANSI escapes.
+func isTerminal() bool {
+	return ui.IsTerminal(os.Stdout) && os.Getenv("CI") == "" && os.Getenv("TERM") != "dumb" &&
+		ui.EnableVirtualTerminal(os.Stdout)
+}
+
+// progressBarWidth returns the width of a progress bar that fits in the
+// terminal next to the rest of the line, or 0 if it doesn't fit.
+func progressBarWidth(restWidth int) int {
+	// The brackets, the space after them and a spare last column, since
+	// writing to it wraps the line on some terminals
+	width := min(ui.TerminalWidth(os.Stdout)-restWidth-4, maxProgressBarWidth)
+	if width < minProgressBarWidth {
+		return 0
+	}
+
+	return width
+}
+
+// lineProgress returns a progress callback for output that is not a
+// terminal, such as a log file or a pipe. It writes whole lines, one per
+// lineProgressStep percent, or one per lineProgressInterval when the size is
+// unknown, instead of redrawing a line with carriage returns.
+func lineProgress(w io.Writer) func(bytesDownloaded, totalBytes int64, speed int64) {
+	nextPercent := 0
+	var lastLine time.Time
+
+	return func(bytesDownloaded, totalBytes int64, speed int64) {
+		var line string
+
+		if totalBytes > 0 {
+			percent := int(bytesDownloaded * 100 / totalBytes)
+			if percent < nextPercent {
+				return
+			}
+			nextPercent = (percent/lineProgressStep + 1) * lineProgressStep
+
+			line = fmt.Sprintf("%d%% (%s/%s)", percent, formatBytes(bytesDownloaded), formatBytes(totalBytes))
+		} else {
+			if time.Since(lastLine) < lineProgressInterval {
+				return
+			}
+			lastLine = time.Now()
+
+			line = fmt.Sprintf("%s downloaded", formatBytes(bytesDownloaded))
+		}
+
+		if speed > 0 {
+			line += fmt.Sprintf(" at %s/s", formatBytes(speed))
+		}
+
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLineProgress(t *testing.T) {
+	var out bytes.Buffer
+	update := lineProgress(&out)
+
+	for downloaded := int64(0); downloaded <= 1000; downloaded += 50 {
+		update(downloaded, 1000, 100)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 11 {
+		t.Fatalf("wrote %d lines, want one per 10%%:\n%s", len(lines), out.String())
+	}
+
+	if strings.Contains(out.String(), "\r") {
+		t.Error("line progress should not use carriage returns")
+	}
+
+	if !strings.HasPrefix(lines[5], "50% ") || !strings.HasPrefix(lines[10], "100% ") {
+		t.Errorf("lines = %q", lines)
+	}
+
+	// Without a size, the first update is written and the next ones wait
+	out.Reset()
+	update = lineProgress(&out)
+	update(100, -1, 0)
+	update(200, -1, 0)
+
+	if got := strings.Count(out.String(), "\n"); got != 1 {
+		t.Errorf("wrote %d lines for an unknown size, want 1", got)
+	}
+}
+
+func TestProgressBarWidth(t *testing.T) {
+	t.Setenv("COLUMNS", "120")
+	if got := progressBarWidth(40); got != maxProgressBarWidth {
+		t.Errorf("progressBarWidth(40) with 120 columns = %d, want %d", got, maxProgressBarWidth)
+	}
+
+	t.Setenv("COLUMNS", "60")
+	if got := progressBarWidth(40); got != 16 {
+		t.Errorf("progressBarWidth(40) with 60 columns = %d, want 16", got)
+	}
+
+	t.Setenv("COLUMNS", "50")
+	if got := progressBarWidth(40); got != 0 {
+		t.Errorf("progressBarWidth(40) with 50 columns = %d, want 0", got)
+	}
+}
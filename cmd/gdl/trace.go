@@ -0,0 +1,18 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// openTraceWriter returns the destination of --trace: stderr for "-", else
+// the given file, truncated. The file is left open for the rest of the run,
+// since requests are traced until the process exits.
+func openTraceWriter(path string) (io.Writer, error) {
+	if path == "-" {
+		return os.Stderr, nil
+	}
+
+	// #nosec G304 -- path is provided explicitly by the user via --trace-ascii
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+}
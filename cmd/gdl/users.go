@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/cli"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+)
+
+// errQuotaExceeded stops a run whose owner has used up the daily quota.
+var errQuotaExceeded = stdErrors.New("daily download quota exceeded")
+
+// scheduleQuota holds the runs of a scheduled download to the limits of its
+// owner and counts the bytes they download toward the owner's daily quota.
+type scheduleQuota struct {
+	users *cli.UserStore
+	user  *cli.DaemonUser
+}
+
+// quotaFor returns the quota of the owner of sd, or nil when sd has no
+// owner. A download whose owner was removed, or that writes outside the
+// owner's directory, does not run.
+func quotaFor(ctx context.Context, users *cli.UserStore, sd *cli.ScheduledDownload) (*scheduleQuota, error) {
+	if sd.Owner == "" {
+		return nil, nil
+	}
+
+	user, err := users.Get(ctx, sd.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Owns(sd.Output) {
+		return nil, fmt.Errorf("output %s is outside the directory of user %s", sd.Output, user.Name)
+	}
+
+	return &scheduleQuota{users: users, user: user}, nil
+}
+
+// start applies the owner's rate to opts and returns a context that is
+// cancelled with errQuotaExceeded once the run has downloaded the rest of the
+// day's quota, a progress callback counting the run's bytes, and a function
+// that records them; call it when the run ends.
+func (q *scheduleQuota) start(ctx context.Context, opts *gdl.Options) (context.Context, gdl.ProgressCallback, func(), error) {
+	now := time.Now()
+
+	remaining, limited := q.user.Remaining(now)
+	if limited && remaining == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: user %s downloaded %d of %d bytes today",
+			errQuotaExceeded, q.user.Name, q.user.Used(now), q.user.MaxDailyBytes)
+	}
+
+	opts.MaxRate = q.user.MaxRate
+
+	ctx, stop := context.WithCancelCause(ctx)
+
+	var downloaded atomic.Int64
+	progress := func(p gdl.Progress) {
+		downloaded.Store(p.BytesDownloaded)
+		if limited && p.BytesDownloaded > remaining {
+			stop(fmt.Errorf("%w: user %s may download %d bytes a day", errQuotaExceeded, q.user.Name, q.user.MaxDailyBytes))
+		}
+	}
+
+	done := func() {
+		stop(nil)
+		if err := q.users.AddUsage(context.Background(), q.user.Name, downloaded.Load(), time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error recording the usage of user %s: %v\n", q.user.Name, err)
+		}
+	}
+
+	return ctx, progress, done, nil
+}
+
+// runDaemonUsersCommand handles "gdl daemon users", which manages the users
+// of a shared daemon.
+func runDaemonUsersCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: daemon users command required\n")
+		showDaemonUsersUsage()
+		return 1
+	}
+
+	ctx := context.Background()
+	users := cli.NewUserStore(cli.GetDefaultUsersFile())
+
+	switch args[0] {
+	case "add":
+		return handleDaemonUserAdd(ctx, users, args[1:])
+	case "list":
+		return handleDaemonUserList(ctx, users)
+	case "remove":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "Error: daemon users remove requires a name\n")
+			fmt.Fprintf(os.Stderr, "Usage: gdl daemon users remove <name>\n")
+			return 1
+		}
+
+		if err := users.Remove(ctx, args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing user: %v\n", err)
+			return 1
+		}
+
+		fmt.Printf("Removed user %s; their scheduled downloads no longer run\n", args[1])
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown daemon users command: %s\n", args[0])
+		showDaemonUsersUsage()
+		return 1
+	}
+}
+
+// handleDaemonUserAdd adds a user: add <name> --dir <dir> [--max-rate RATE]
+// [--max-daily SIZE], and prints the user's token.
+func handleDaemonUserAdd(ctx context.Context, users *cli.UserStore, args []string) int {
+	name, dir := "", ""
+	var maxRate, maxDaily int64
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flag, value, inline := strings.Cut(arg, "=")
+
+		switch flag {
+		case "--dir", "--max-rate", "--max-daily":
+			if !inline {
+				if i+1 >= len(args) {
+					fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", flag)
+					return 1
+				}
+				i++
+				value = args[i]
+			}
+
+			var err error
+			switch flag {
+			case "--dir":
+				dir = value
+			case "--max-rate":
+				maxRate, err = ratelimit.ParseRate(value)
+			default:
+				maxDaily, err = parseSize(value)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid %s %q: %v\n", flag, value, err)
+				return 1
+			}
+		default:
+			if strings.HasPrefix(arg, "-") || name != "" {
+				fmt.Fprintf(os.Stderr, "Error: unexpected daemon users add argument: %s\n", arg)
+				return 1
+			}
+			name = arg
+		}
+	}
+
+	if name == "" || dir == "" {
+		fmt.Fprintf(os.Stderr, "Error: daemon users add requires a name and --dir\n")
+		fmt.Fprintf(os.Stderr, "Usage: gdl daemon users add <name> --dir <dir> [--max-rate RATE] [--max-daily SIZE]\n")
+		return 1
+	}
+
+	user, token, err := users.Add(ctx, name, dir, maxRate, maxDaily)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding user: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Added user %s, downloading below %s\n", user.Name, user.Dir)
+	fmt.Printf("Token (shown only once): %s\n", token)
+
+	return 0
+}
+
+// handleDaemonUserList lists the users with their quotas and today's usage.
+func handleDaemonUserList(ctx context.Context, users *cli.UserStore) int {
+	list, err := users.List(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing users: %v\n", err)
+		return 1
+	}
+
+	if len(list) == 0 {
+		fmt.Println("No daemon users")
+		return 0
+	}
+
+	fmt.Printf("%-16s %-12s %-24s %s\n", "NAME", "MAX RATE", "USED TODAY", "DIRECTORY")
+	fmt.Println(strings.Repeat("-", 80))
+
+	now := time.Now()
+	for _, u := range list {
+		rate := "unlimited"
+		if u.MaxRate > 0 {
+			rate = formatBytes(u.MaxRate) + "/s"
+		}
+
+		used := formatBytes(u.Used(now))
+		if u.MaxDailyBytes > 0 {
+			used += " of " + formatBytes(u.MaxDailyBytes)
+		}
+
+		fmt.Printf("%-16s %-12s %-24s %s\n", u.Name, rate, used, u.Dir)
+	}
+
+	return 0
+}
+
+func showDaemonUsersUsage() {
+	fmt.Printf(`Daemon User Commands:
+
+Usage: %s daemon users <command> [args]
+
+Commands:
+  add <name> --dir <dir> [--max-rate RATE] [--max-daily SIZE]
+                           Add a user and print their dashboard token
+  list                     List users with their quotas and today's usage
+  remove <name>            Remove a user; their schedules no longer run
+
+A user's token signs in to the dashboard of 'gdl daemon --ui', which then
+shows and controls only the user's scheduled downloads. They are written
+below the user's directory, at most RATE per second (e.g. 2MB) and SIZE a
+day (e.g. 10GB). Users are stored in ~/.gdl/users.json.
+`, appName)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // #nosec G501 -- only compared with S3-style ETags, which are MD5
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// Outcomes of a verifyCheck.
+const (
+	verifyMatch   = "match"
+	verifyDiffers = "differs"
+	verifySkipped = "skipped"
+)
+
+// md5ETag matches an ETag that is the MD5 of the content, as S3 and many
+// static file servers send for files uploaded in one part.
+var md5ETag = regexp.MustCompile(`^(?:W/)?"?([0-9a-fA-F]{32})"?$`)
+
+// verifyConfig holds the options of "gdl verify".
+type verifyConfig struct {
+	url        string
+	file       string
+	full       bool
+	samples    int
+	sampleSize string
+	json       bool
+}
+
+// verifyCheck is one comparison of the local file with the remote one.
+type verifyCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Local  string `json:"local,omitempty"`
+	Remote string `json:"remote,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// verifyReport is the outcome of "gdl verify". Match is false when any check
+// found a difference.
+type verifyReport struct {
+	URL    string        `json:"url"`
+	File   string        `json:"file"`
+	Match  bool          `json:"match"`
+	Checks []verifyCheck `json:"checks"`
+}
+
+// runVerifyCommand handles "gdl verify <url> <file>". It exits with status
+// 0 when the file matches, and 1 when it differs or cannot be checked.
+func runVerifyCommand(args []string) int {
+	vcfg, err := parseVerifyArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		showVerifyUsage()
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := verifyFile(ctx, gdl.NewDownloader(), vcfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	printVerifyReport(os.Stdout, report, vcfg.json)
+
+	if !report.Match {
+		return 1
+	}
+
+	return 0
+}
+
+// parseVerifyArgs parses the arguments of "gdl verify", which may put flags
+// before, between or after the URL and the file.
+func parseVerifyArgs(args []string) (*verifyConfig, error) {
+	vcfg := &verifyConfig{}
+
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineVerifyFlags(fs, vcfg)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 2 {
+		return nil, fmt.Errorf("verify requires a URL and a file")
+	}
+	vcfg.url, vcfg.file = positional[0], positional[1]
+
+	if vcfg.samples < 1 {
+		return nil, fmt.Errorf("--samples must be at least 1")
+	}
+
+	if size, err := parseSize(vcfg.sampleSize); err != nil || size <= 0 {
+		return nil, fmt.Errorf("invalid --sample-size: %s", vcfg.sampleSize)
+	}
+
+	return vcfg, nil
+}
+
+// defineVerifyFlags registers the flags of "gdl verify" on fs.
+func defineVerifyFlags(fs *flag.FlagSet, vcfg *verifyConfig) {
+	fs.BoolVar(&vcfg.full, "full", false, "Download the whole file and compare SHA-256 hashes")
+	fs.IntVar(&vcfg.samples, "samples", 8, "Ranges to compare without --full")
+	fs.StringVar(&vcfg.sampleSize, "sample-size", "64KB", "Size of each compared range")
+	fs.BoolVar(&vcfg.json, "json", false, "Print the report as JSON")
+}
+
+// verifyFile compares vcfg.file with vcfg.url: its size, its MD5 with the
+// ETag when the ETag is one, and its content, either sampled with range
+// requests or, with --full, hashed in full.
+func verifyFile(ctx context.Context, dl *gdl.Downloader, vcfg *verifyConfig) (*verifyReport, error) {
+	stat, err := os.Stat(vcfg.file)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", vcfg.file)
+	}
+
+	info, err := dl.GetFileInfo(ctx, vcfg.url)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &verifyReport{URL: vcfg.url, File: vcfg.file}
+
+	size := verifyCheck{Name: "size", Status: verifySkipped, Local: formatBytes(stat.Size())}
+	if info.Size > 0 {
+		size.Status, size.Remote = compareStatus(stat.Size() == info.Size), formatBytes(info.Size)
+	} else {
+		size.Detail = "the server sent no size"
+	}
+
+	etag, err := verifyETag(vcfg.file, info.ETag)
+	if err != nil {
+		return nil, err
+	}
+
+	var content verifyCheck
+	switch {
+	case vcfg.full:
+		content, err = verifyFullContent(ctx, dl, vcfg)
+	case size.Status == verifyDiffers:
+		content = verifyCheck{Name: "content", Status: verifySkipped, Detail: "the sizes differ"}
+	case !info.SupportsRanges || info.Size <= 0:
+		content = verifyCheck{Name: "content", Status: verifySkipped,
+			Detail: "the server does not support range requests; use --full"}
+	default:
+		content, err = verifySampledContent(ctx, dl, vcfg, info.Size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report.Checks = []verifyCheck{size, etag, content}
+	report.Match = true
+	for _, check := range report.Checks {
+		if check.Status == verifyDiffers {
+			report.Match = false
+		}
+	}
+
+	return report, nil
+}
+
+// verifyETag compares the MD5 of the file with an ETag that holds one.
+func verifyETag(path, etag string) (verifyCheck, error) {
+	check := verifyCheck{Name: "etag", Status: verifySkipped, Remote: etag}
+
+	match := md5ETag.FindStringSubmatch(etag)
+	switch {
+	case etag == "":
+		check.Detail = "the server sent no ETag"
+		return check, nil
+	case match == nil:
+		check.Detail = "the ETag is not an MD5 digest"
+		return check, nil
+	}
+
+	// #nosec G304 -- path is the file the user asked to verify
+	file, err := os.Open(path)
+	if err != nil {
+		return check, err
+	}
+	defer func() { _ = file.Close() }()
+
+	// #nosec G401 -- MD5 is what the server put in the ETag
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return check, err
+	}
+
+	check.Local, check.Remote = hex.EncodeToString(hash.Sum(nil)), strings.ToLower(match[1])
+	check.Status = compareStatus(check.Local == check.Remote)
+
+	return check, nil
+}
+
+// verifyFullContent downloads the whole remote file and compares its SHA-256
+// with that of the local file.
+func verifyFullContent(ctx context.Context, dl *gdl.Downloader, vcfg *verifyConfig) (verifyCheck, error) {
+	local, err := checksum.File(vcfg.file, checksum.SHA256)
+	if err != nil {
+		return verifyCheck{}, err
+	}
+
+	hash := sha256.New()
+	if _, err := dl.DownloadToWriter(ctx, vcfg.url, hash, &gdl.Options{Quiet: true}); err != nil {
+		return verifyCheck{}, err
+	}
+	remote := hex.EncodeToString(hash.Sum(nil))
+
+	return verifyCheck{
+		Name:   "content",
+		Status: compareStatus(local == remote),
+		Local:  "sha256:" + local,
+		Remote: "sha256:" + remote,
+	}, nil
+}
+
+// verifySampledContent compares vcfg.samples ranges of the file, spread
+// evenly from its first to its last byte, with the same ranges of the remote
+// file. A file no larger than the samples together is compared in full.
+func verifySampledContent(ctx context.Context, dl *gdl.Downloader, vcfg *verifyConfig, size int64) (verifyCheck, error) {
+	sampleSize, _ := parseSize(vcfg.sampleSize)
+
+	// #nosec G304 -- the file is the one the user asked to verify
+	file, err := os.Open(vcfg.file)
+	if err != nil {
+		return verifyCheck{}, err
+	}
+	defer func() { _ = file.Close() }()
+
+	check := verifyCheck{Name: "content", Status: verifyMatch}
+
+	ranges := sampleRanges(size, int64(vcfg.samples), sampleSize)
+	if len(ranges) == 1 {
+		check.Detail = "compared in full"
+	} else {
+		check.Detail = fmt.Sprintf("%d samples of %s", len(ranges), formatBytes(sampleSize))
+	}
+
+	for _, r := range ranges {
+		local := make([]byte, r.End-r.Start+1)
+		if _, err := file.ReadAt(local, r.Start); err != nil {
+			return verifyCheck{}, err
+		}
+
+		var remote bytes.Buffer
+		if _, err := dl.DownloadToWriter(ctx, vcfg.url, &remote, &gdl.Options{ByteRange: r, Quiet: true}); err != nil {
+			return verifyCheck{}, err
+		}
+
+		if !bytes.Equal(local, remote.Bytes()) {
+			check.Status = verifyDiffers
+			check.Detail = fmt.Sprintf("bytes %d-%d differ", r.Start, r.End)
+			break
+		}
+	}
+
+	return check, nil
+}
+
+// sampleRanges returns count ranges of sampleSize bytes spread evenly over a
+// file of size bytes, the first at its start and the last at its end, or a
+// single range of the whole file if it is no larger than the ranges.
+func sampleRanges(size, count, sampleSize int64) []*types.ByteRange {
+	if size <= count*sampleSize {
+		return []*types.ByteRange{{Start: 0, End: size - 1}}
+	}
+
+	ranges := make([]*types.ByteRange, 0, count)
+	for i := int64(0); i < count; i++ {
+		var start int64
+		if count > 1 {
+			start = i * (size - sampleSize) / (count - 1)
+		}
+		ranges = append(ranges, &types.ByteRange{Start: start, End: start + sampleSize - 1})
+	}
+
+	return ranges
+}
+
+// compareStatus returns verifyMatch if equal, verifyDiffers otherwise.
+func compareStatus(equal bool) string {
+	if equal {
+		return verifyMatch
+	}
+
+	return verifyDiffers
+}
+
+// printVerifyReport writes report to w as a table or as JSON.
+func printVerifyReport(w io.Writer, report *verifyReport, asJSON bool) {
+	if asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		_, _ = fmt.Fprintln(w, string(data))
+		return
+	}
+
+	for _, check := range report.Checks {
+		detail := check.Detail
+		switch {
+		case check.Local != "" && check.Remote != "" && check.Local == check.Remote:
+			detail = check.Local
+		case check.Local != "" && check.Remote != "":
+			detail = fmt.Sprintf("local %s, remote %s", check.Local, check.Remote)
+		}
+		_, _ = fmt.Fprintf(w, "  %-8s %-8s %s\n", check.Name, check.Status, detail)
+	}
+
+	if report.Match {
+		_, _ = fmt.Fprintf(w, "%s matches %s\n", report.File, report.URL)
+	} else {
+		_, _ = fmt.Fprintf(w, "%s differs from %s\n", report.File, report.URL)
+	}
+}
+
+// showVerifyUsage prints the usage of "gdl verify".
+func showVerifyUsage() {
+	fmt.Printf(`Verify Command:
+
+Usage: %s verify <url> <file> [options]
+
+Checks whether a local file matches the remote one without downloading it
+again: the sizes, the file's MD5 against an ETag that holds one, and sampled
+ranges of the content. Exits with status 1 if anything differs.
+
+Options:
+      --full              Download the whole file and compare SHA-256 hashes
+      --samples N         Ranges to compare without --full (default: 8)
+      --sample-size SIZE  Size of each range (default: 64KB)
+      --json              Print the report as JSON
+
+Examples:
+  %s verify https://mirror.example.com/image.iso image.iso
+  %s verify https://example.com/data.tar.gz data.tar.gz --full --json
+
+`, appName, appName, appName)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // #nosec G501 -- the test server sends an MD5 ETag
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gdl "github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestParseVerifyArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		full    bool
+		samples int
+	}{
+		{"defaults", []string{"https://example.com/a.iso", "a.iso"}, false, false, 8},
+		{"flags between", []string{"https://example.com/a.iso", "--samples", "3", "a.iso", "--full"}, false, true, 3},
+		{"one argument", []string{"https://example.com/a.iso"}, true, false, 0},
+		{"three arguments", []string{"https://example.com/a.iso", "a.iso", "b.iso"}, true, false, 0},
+		{"zero samples", []string{"https://example.com/a.iso", "a.iso", "--samples", "0"}, true, false, 0},
+		{"bad sample size", []string{"https://example.com/a.iso", "a.iso", "--sample-size", "big"}, true, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vcfg, err := parseVerifyArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseVerifyArgs() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVerifyArgs() error = %v", err)
+			}
+
+			if vcfg.full != tt.full || vcfg.samples != tt.samples || vcfg.file != "a.iso" {
+				t.Errorf("parseVerifyArgs() = %+v", vcfg)
+			}
+		})
+	}
+}
+
+func TestSampleRanges(t *testing.T) {
+	ranges := sampleRanges(1000, 3, 100)
+	want := [][2]int64{{0, 99}, {450, 549}, {900, 999}}
+	if len(ranges) != len(want) {
+		t.Fatalf("sampleRanges() = %d ranges, want %d", len(ranges), len(want))
+	}
+	for i, r := range ranges {
+		if r.Start != want[i][0] || r.End != want[i][1] {
+			t.Errorf("range %d = %d-%d, want %d-%d", i, r.Start, r.End, want[i][0], want[i][1])
+		}
+	}
+
+	if ranges := sampleRanges(250, 3, 100); len(ranges) != 1 || ranges[0].Start != 0 || ranges[0].End != 249 {
+		t.Errorf("sampleRanges() of a small file = %+v, want the whole file", ranges)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := md5.Sum(content) // #nosec G401 -- S3-style ETag
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	changed := bytes.Clone(content)
+	changed[len(changed)-1] = 'x'
+
+	tests := []struct {
+		name      string
+		data      []byte
+		full      bool
+		wantMatch bool
+		statuses  []string
+	}{
+		{"same file", content, false, true, []string{verifyMatch, verifyMatch, verifyMatch}},
+		{"same file, full", content, true, true, []string{verifyMatch, verifyMatch, verifyMatch}},
+		{"last byte changed", changed, false, false, []string{verifyMatch, verifyDiffers, verifyDiffers}},
+		{"last byte changed, full", changed, true, false, []string{verifyMatch, verifyDiffers, verifyDiffers}},
+		{"truncated", content[:1000], false, false, []string{verifyDiffers, verifyDiffers, verifySkipped}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vcfg := &verifyConfig{
+				url:        server.URL + "/file.bin",
+				file:       write("local.bin", tt.data),
+				full:       tt.full,
+				samples:    4,
+				sampleSize: "1KB",
+			}
+
+			report, err := verifyFile(context.Background(), gdl.NewDownloader(), vcfg)
+			if err != nil {
+				t.Fatalf("verifyFile() error = %v", err)
+			}
+
+			if report.Match != tt.wantMatch {
+				t.Errorf("Match = %v, want %v", report.Match, tt.wantMatch)
+			}
+			for i, check := range report.Checks {
+				if check.Status != tt.statuses[i] {
+					t.Errorf("%s = %s (%s), want %s", check.Name, check.Status, check.Detail, tt.statuses[i])
+				}
+			}
+		})
+	}
+
+	if _, err := verifyFile(context.Background(), gdl.NewDownloader(), &verifyConfig{
+		url: server.URL + "/file.bin", file: filepath.Join(dir, "missing"), samples: 1, sampleSize: "1KB",
+	}); err == nil {
+		t.Error("verifyFile() of a missing file should fail")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+func TestParseWatchArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantErr  bool
+		output   string
+		interval time.Duration
+		exec     string
+	}{
+		{"defaults", []string{"https://example.com/a.tar"}, false, "a.tar", defaultWatchInterval, ""},
+		{"flags after URL", []string{"https://example.com/a", "--interval", "30s", "-o", "out", "--exec", "echo {}"}, false, "out", 30 * time.Second, "echo {}"},
+		{"flags before URL", []string{"--interval=1h", "https://example.com/a", "--output", "x"}, false, "x", time.Hour, ""},
+		{"no URL", []string{"--interval", "1m"}, true, "", 0, ""},
+		{"two URLs", []string{"https://a.example.com", "https://b.example.com"}, true, "", 0, ""},
+		{"bad interval", []string{"https://example.com/a", "--interval", "soon"}, true, "", 0, ""},
+		{"zero interval", []string{"https://example.com/a", "--interval", "0s"}, true, "", 0, ""},
+		{"unknown flag", []string{"https://example.com/a", "--bogus"}, true, "", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wcfg, err := parseWatchArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseWatchArgs() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWatchArgs() error = %v", err)
+			}
+
+			if wcfg.output != tt.output || wcfg.interval != tt.interval || wcfg.exec != tt.exec {
+				t.Errorf("parseWatchArgs() = %+v", wcfg)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook script needs a POSIX shell")
+	}
+
+	original := validation.GetConfig()
+	validation.SetConfig(validation.TestConfig())
+	defer validation.SetConfig(original)
+
+	// The file changes once, after a few checks
+	var mu sync.Mutex
+	version, checks := 1, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		checks++
+		if checks == 4 {
+			version = 2
+		}
+		current := version
+		mu.Unlock()
+
+		content := strings.Repeat("v", current)
+		w.Header().Set("ETag", `"v`+content+`"`)
+		modified := time.Date(2025, 1, current, 0, 0, 0, 0, time.UTC)
+		http.ServeContent(w, r, "file.txt", modified, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	hookLog := filepath.Join(dir, "hook.log")
+	hook := filepath.Join(dir, "hook.sh")
+	// #nosec G306 -- the test script must be executable
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\necho \"$1 $GDL_WATCH_URL\" >> "+hookLog+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "out", "file.txt")
+	wcfg := &watchConfig{
+		url:      server.URL + "/file.txt",
+		output:   output,
+		interval: 20 * time.Millisecond,
+		exec:     hook + " {}",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	var log bytes.Buffer
+	if err := watch(ctx, wcfg, &log); err != context.DeadlineExceeded {
+		t.Errorf("watch() error = %v, want the context error", err)
+	}
+
+	content, err := os.ReadFile(output) // #nosec G304 -- test file
+	if err != nil || string(content) != "vv" {
+		t.Errorf("watched file = %q, %v, want the changed content", content, err)
+	}
+
+	hookRuns, err := os.ReadFile(hookLog) // #nosec G304 -- test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(hookRuns)), "\n")
+	if len(lines) != 2 || lines[0] != output+" "+wcfg.url {
+		t.Errorf("hook runs = %q, want one per download (2)", lines)
+	}
+
+	if downloads := strings.Count(log.String(), "downloaded"); downloads != 2 {
+		t.Errorf("log reports %d downloads, want 2:\n%s", downloads, log.String())
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 func main() {
@@ -238,12 +239,12 @@ func main() {
 		start := time.Now()
 
 		opts := &gdl.Options{
-			MaxConcurrency:    maxConns,
-			ChunkSize:         chunkSize,
-			OverwriteExisting: true,
-			EnableResume:      true, // Enable resume for robustness
-			RetryAttempts:     3,    // Retry on failures
-			UserAgent:         "gdl-adaptive-example/1.0",
+			MaxConcurrency:  maxConns,
+			ChunkSize:       chunkSize,
+			CollisionPolicy: types.CollisionOverwrite,
+			EnableResume:    true, // Enable resume for robustness
+			RetryAttempts:   3,    // Retry on failures
+			UserAgent:       "gdl-adaptive-example/1.0",
 		}
 
 		destPath := filepath.Join(examplesDir, "adaptive_"+testFile.name)
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 func main() {
@@ -123,10 +124,10 @@ func main() {
 	var interrupted bool
 
 	opts = &gdl.Options{
-		MaxConcurrency:    6,
-		ChunkSize:         128 * 1024,
-		EnableResume:      true,
-		OverwriteExisting: true,
+		MaxConcurrency:  6,
+		ChunkSize:       128 * 1024,
+		EnableResume:    true,
+		CollisionPolicy: types.CollisionOverwrite,
 		ProgressCallback: func(p gdl.Progress) {
 			fmt.Printf("\r🔄 Partial download: %.1f%% (%s/%s) Speed: %s/s",
 				p.Percentage,
@@ -257,10 +258,10 @@ func main() {
 		var configInterrupted bool
 
 		opts = &gdl.Options{
-			MaxConcurrency:    config.maxConns,
-			ChunkSize:         config.chunkSize,
-			EnableResume:      true,
-			OverwriteExisting: true,
+			MaxConcurrency:  config.maxConns,
+			ChunkSize:       config.chunkSize,
+			EnableResume:    true,
+			CollisionPolicy: types.CollisionOverwrite,
 			ProgressCallback: func(p gdl.Progress) {
 				if p.Percentage >= 25.0 && !configInterrupted {
 					configInterrupted = true
@@ -286,7 +287,7 @@ func main() {
 		}
 
 		// Resume with same configuration
-		opts.OverwriteExisting = false
+		opts.CollisionPolicy = types.CollisionResume
 
 		fmt.Printf("   🔄 Resuming with same configuration...\n")
 
@@ -358,9 +359,9 @@ func main() {
 	var partialInterrupted bool
 
 	opts = &gdl.Options{
-		MaxConcurrency:    4,
-		EnableResume:      true,
-		OverwriteExisting: true,
+		MaxConcurrency:  4,
+		EnableResume:    true,
+		CollisionPolicy: types.CollisionOverwrite,
 		ProgressCallback: func(p gdl.Progress) {
 			if p.Percentage >= 50.0 && !partialInterrupted {
 				partialInterrupted = true
@@ -386,7 +387,7 @@ func main() {
 
 	fmt.Printf("🔄 Step 3: Resuming download to completion\n")
 
-	opts.OverwriteExisting = false
+	opts.CollisionPolicy = types.CollisionResume
 	opts.ProgressCallback = nil
 	opts.Quiet = true
 
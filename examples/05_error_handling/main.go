@@ -11,14 +11,19 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/forest6511/gdl"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 )
 
 func main() {
@@ -432,18 +437,22 @@ func analyzeError(err error) {
 		return
 	}
 
-	errorStr := err.Error()
+	var (
+		dnsErr  *net.DNSError
+		certErr *tls.CertificateVerificationError
+		netErr  net.Error
+	)
 
 	fmt.Printf("   🔍 Error Analysis:\n")
 
 	switch {
-	case strings.Contains(errorStr, "no such host"):
+	case errors.As(err, &dnsErr):
 		fmt.Printf("      • DNS resolution failed - domain may not exist\n")
-	case strings.Contains(errorStr, "connection refused"):
+	case errors.Is(err, syscall.ECONNREFUSED):
 		fmt.Printf("      • Connection refused - service may be down or port closed\n")
-	case strings.Contains(errorStr, "timeout"):
+	case errors.Is(err, gdlerrors.ErrTimeout), errors.As(err, &netErr) && netErr.Timeout():
 		fmt.Printf("      • Network timeout - slow connection or unresponsive server\n")
-	case strings.Contains(errorStr, "certificate"):
+	case errors.As(err, &certErr):
 		fmt.Printf("      • SSL/TLS certificate issue - may need --insecure flag\n")
 	default:
 		fmt.Printf("      • Generic network or protocol error\n")
@@ -451,7 +460,12 @@ func analyzeError(err error) {
 }
 
 // provideSuggestions offers user-friendly suggestions based on HTTP status codes.
+// The status code of the failed response is preferred when the error carries one.
 func provideSuggestions(statusCode int, err error) {
+	if code := gdlerrors.StatusCode(err); code != 0 {
+		statusCode = code
+	}
+
 	fmt.Printf("   💡 Suggestions:\n")
 
 	switch statusCode {
@@ -481,22 +495,29 @@ func categorizeError(err error) string {
 		return "No Error"
 	}
 
-	errorStr := strings.ToLower(err.Error())
+	var (
+		dnsErr  *net.DNSError
+		certErr *tls.CertificateVerificationError
+	)
 
 	switch {
-	case strings.Contains(errorStr, "no such host") || strings.Contains(errorStr, "dns"):
+	case errors.As(err, &dnsErr):
 		return "DNS/Network Resolution"
-	case strings.Contains(errorStr, "connection refused") || strings.Contains(errorStr, "connect"):
-		return "Connection Error"
-	case strings.Contains(errorStr, "timeout"):
-		return "Timeout Error"
-	case strings.Contains(errorStr, "certificate") || strings.Contains(errorStr, "tls"):
+	case errors.As(err, &certErr):
 		return "SSL/TLS Error"
-	case strings.Contains(errorStr, "permission") || strings.Contains(errorStr, "access"):
+	case errors.Is(err, gdlerrors.ErrTimeout):
+		return "Timeout Error"
+	case gdlerrors.IsNetworkError(err):
+		return "Connection Error"
+	case gdlerrors.IsAuthError(err), errors.Is(err, os.ErrPermission):
 		return "Permission Error"
-	case strings.Contains(errorStr, "protocol"):
+	case gdlerrors.IsDiskFull(err):
+		return "Disk Full"
+	case gdlerrors.IsChecksumMismatch(err):
+		return "Corrupted Download"
+	case gdlerrors.StatusCode(err) != 0:
 		return "Protocol Error"
-	case strings.Contains(errorStr, "invalid") || strings.Contains(errorStr, "malformed"):
+	case errors.Is(err, gdlerrors.ErrInvalidURL):
 		return "Invalid Input"
 	default:
 		return "Unknown Error"
@@ -516,6 +537,10 @@ func getErrorGuidance(category string) string {
 		return "Verify SSL certificate or use --insecure flag if safe"
 	case "Permission Error":
 		return "Check file permissions or authentication credentials"
+	case "Disk Full":
+		return "Free up space on the destination disk and resume the download"
+	case "Corrupted Download":
+		return "Delete the partial file and download it again"
 	case "Protocol Error":
 		return "Ensure you're using the correct protocol (http/https)"
 	case "Invalid Input":
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -15,6 +16,8 @@ import (
 	"time"
 
 	"github.com/forest6511/gdl"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 // DownloadManager manages multiple concurrent downloads with monitoring
@@ -158,46 +161,41 @@ func (dm *DownloadManager) StartDownload(ctx context.Context, id string) error {
 	return err
 }
 
-// downloadWithRetry implements exponential backoff retry logic
+// downloadWithRetry downloads a job, letting gdl retry the failed attempts
+// that retryDecision accepts
 func (dm *DownloadManager) downloadWithRetry(ctx context.Context, job *DownloadJob, options *gdl.Options) error {
-	var lastErr error
-
-	for attempt := 0; attempt <= job.MaxRetries; attempt++ {
-		if attempt > 0 {
-			// Exponential backoff
-			backoffDuration := time.Duration(attempt*attempt) * time.Second
-			log.Printf("Download %s failed, retrying in %v (attempt %d/%d)",
-				job.ID, backoffDuration, attempt, job.MaxRetries)
-
-			select {
-			case <-time.After(backoffDuration):
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-dm.shutdownChan:
-				return fmt.Errorf("download manager shutting down")
-			}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Stop waiting between attempts once the manager shuts down
+	go func() {
+		select {
+		case <-dm.shutdownChan:
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
 
+	options.RetryClassifier = func(err error, attempt int) types.RetryDecision {
 		job.Retries = attempt
-		stats, err := gdl.DownloadWithOptions(ctx, job.URL, job.Destination, options)
+		log.Printf("Download %s attempt %d failed: %v", job.ID, attempt, err)
 
-		if err == nil {
-			log.Printf("Download %s completed successfully in %v",
-				job.ID, stats.Duration)
-			return nil
+		decision := retryDecision(err, attempt)
+		if !decision.Retry {
+			log.Printf("Download %s failed with non-retryable error: %v", job.ID, err)
 		}
 
-		lastErr = err
-		log.Printf("Download %s attempt %d failed: %v", job.ID, attempt+1, err)
+		return decision
+	}
 
-		// Check if error is retryable
-		if !isRetryableError(err) {
-			log.Printf("Download %s failed with non-retryable error: %v", job.ID, err)
-			break
-		}
+	stats, err := gdl.DownloadWithOptions(ctx, job.URL, job.Destination, options)
+	if err != nil {
+		return fmt.Errorf("download failed after %d attempts: %w", job.Retries+1, err)
 	}
 
-	return fmt.Errorf("download failed after %d attempts: %w", job.MaxRetries+1, lastErr)
+	log.Printf("Download %s completed successfully in %v", job.ID, stats.Duration)
+
+	return nil
 }
 
 // updateProgress updates the progress information for a download
@@ -294,38 +292,27 @@ func (dm *DownloadManager) Shutdown() {
 	log.Println("Download manager shutdown initiated")
 }
 
-// isRetryableError determines if an error should trigger a retry
-func isRetryableError(err error) bool {
-	// In a real implementation, you would check for specific error types
-	// such as network timeouts, temporary server errors, etc.
-	errStr := err.Error()
-
-	// Retry on network-related errors
-	retryableErrors := []string{
-		"timeout",
-		"connection refused",
-		"temporary failure",
-		"server error",
-		"503",
-		"502",
-		"504",
+// retryDecision retries network failures, rate limiting, server errors and
+// corrupted transfers with quadratic backoff, trying the next mirror after a
+// server error. Authentication failures, full disks and other client errors
+// are not retried.
+func retryDecision(err error, attempt int) types.RetryDecision {
+	backoff := time.Duration(attempt*attempt) * time.Second
+	status := gdlerrors.StatusCode(err)
+
+	switch {
+	case gdlerrors.IsAuthError(err), gdlerrors.IsDiskFull(err):
+		return types.RetryDecision{}
+	case status == http.StatusTooManyRequests:
+		// Keep the server's Retry-After delay
+		return types.RetryDecision{Retry: true}
+	case status >= http.StatusInternalServerError:
+		return types.RetryDecision{Retry: true, Delay: backoff, SwitchMirror: true}
+	case gdlerrors.IsNetworkError(err), gdlerrors.IsChecksumMismatch(err):
+		return types.RetryDecision{Retry: true, Delay: backoff}
 	}
 
-	for _, retryable := range retryableErrors {
-		if contains(errStr, retryable) {
-			return true
-		}
-	}
-
-	return false
-}
-
-// contains checks if a string contains a substring (case-insensitive)
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) &&
-		(s == substr || len(s) > len(substr) &&
-			(s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
-				(len(s) > len(substr) && s[1:len(substr)+1] == substr)))
+	return types.RetryDecision{}
 }
 
 // ProductionExample demonstrates production usage patterns
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 func main() {
@@ -149,9 +150,9 @@ func runLibraryDemos(baseURL string) {
 		Headers: map[string]string{
 			"X-Demo": "LibraryAPI",
 		},
-		EnableResume:      true,
-		OverwriteExisting: true,
-		CreateDirs:        true,
+		EnableResume:    true,
+		CollisionPolicy: types.CollisionOverwrite,
+		CreateDirs:      true,
 		ProgressCallback: func(p gdl.Progress) {
 			if p.TotalSize > 0 && p.Percentage > 0 {
 				fmt.Printf("    Progress: %.1f%% (%d/%d bytes)\n",
@@ -317,13 +318,13 @@ func runIntegrationTests(baseURL string) {
 
 	// Library with all features
 	opts := &gdl.Options{
-		MaxConcurrency:    2,
-		ChunkSize:         1024,
-		UserAgent:         "Integration/1.0",
-		Headers:           map[string]string{"X-Test": "Integration"},
-		EnableResume:      true,
-		OverwriteExisting: true,
-		CreateDirs:        true,
+		MaxConcurrency:  2,
+		ChunkSize:       1024,
+		UserAgent:       "Integration/1.0",
+		Headers:         map[string]string{"X-Test": "Integration"},
+		EnableResume:    true,
+		CollisionPolicy: types.CollisionOverwrite,
+		CreateDirs:      true,
 	}
 
 	_ = os.MkdirAll("integration_test", 0o750)
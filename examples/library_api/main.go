@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/forest6511/gdl"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 func main() {
@@ -100,10 +101,10 @@ func example3DownloadWithOptions() {
 	filename := "options_download.bin"
 
 	options := &gdl.Options{
-		MaxConcurrency:    4,
-		ChunkSize:         12800, // 12.5KB chunks
-		EnableResume:      true,
-		OverwriteExisting: true,
+		MaxConcurrency:  4,
+		ChunkSize:       12800, // 12.5KB chunks
+		EnableResume:    true,
+		CollisionPolicy: types.CollisionOverwrite,
 		Headers: map[string]string{
 			"User-Agent": "gdl-examples/1.0",
 		},
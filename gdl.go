@@ -5,16 +5,34 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/internal/listing"
+	"github.com/forest6511/gdl/internal/network"
+	"github.com/forest6511/gdl/internal/retry"
+	"github.com/forest6511/gdl/internal/robots"
+	"github.com/forest6511/gdl/internal/stream"
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 	"github.com/forest6511/gdl/pkg/events"
 	"github.com/forest6511/gdl/pkg/middleware"
+	"github.com/forest6511/gdl/pkg/pathtemplate"
 	"github.com/forest6511/gdl/pkg/plugin"
+	"github.com/forest6511/gdl/pkg/progress"
 	"github.com/forest6511/gdl/pkg/protocols"
+	"github.com/forest6511/gdl/pkg/scheduler"
 	"github.com/forest6511/gdl/pkg/storage"
 	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/urlglob"
 	"github.com/forest6511/gdl/pkg/validation"
 )
 
@@ -22,15 +40,124 @@ import (
 type Progress struct {
 	TotalSize       int64
 	BytesDownloaded int64
-	Speed           int64
+	Speed           int64 // Average speed since the download started
 	Percentage      float64
 	TimeElapsed     time.Duration
-	TimeRemaining   time.Duration
+	TimeRemaining   time.Duration // Estimated from SmoothedSpeed (0 = unknown)
+
+	// InstantSpeed is the speed over the last sample (at least 100ms), and
+	// SmoothedSpeed its exponential moving average over Options.SpeedWindow,
+	// steady enough to show to users. Both are 0 until a sample is measured.
+	InstantSpeed  int64
+	SmoothedSpeed int64
 }
 
 // ProgressCallback is a function that receives progress updates.
 type ProgressCallback func(Progress)
 
+// defaultProgressInterval is the minimum time between progress callbacks
+// when Options.ProgressInterval is 0.
+const defaultProgressInterval = 100 * time.Millisecond
+
+// progressReporter turns the core downloader's progress updates into Progress
+// values with smoothed speed and time remaining, calling back at most once
+// per interval.
+type progressReporter struct {
+	callback  ProgressCallback
+	estimator *progress.SpeedEstimator
+	interval  time.Duration
+	start     time.Time
+
+	mu       sync.Mutex
+	lastCall time.Time
+	latest   Progress // the most recent update, reported or not
+	reported bool     // whether latest has been passed to callback
+}
+
+func newProgressReporter(opts *Options) *progressReporter {
+	interval := opts.ProgressInterval
+	if interval == 0 {
+		interval = defaultProgressInterval
+	}
+
+	return &progressReporter{
+		callback:  opts.ProgressCallback,
+		estimator: progress.NewSpeedEstimator(opts.SpeedWindow),
+		interval:  interval,
+		start:     time.Now(),
+	}
+}
+
+// update records a progress update from the core downloader and reports it
+// unless the last callback was less than an interval ago. Reaching the total
+// size is always reported.
+func (r *progressReporter) update(downloaded, total, speed int64) {
+	instant, smoothed := r.estimator.Update(downloaded)
+
+	p := Progress{
+		TotalSize:       total,
+		BytesDownloaded: downloaded,
+		Speed:           speed,
+		TimeElapsed:     time.Since(r.start),
+		InstantSpeed:    instant,
+		SmoothedSpeed:   smoothed,
+	}
+	if total > 0 {
+		p.Percentage = float64(downloaded) / float64(total) * 100
+		p.TimeRemaining = r.estimator.ETA(total - downloaded)
+	}
+
+	r.mu.Lock()
+	complete := total > 0 && downloaded >= total
+	duplicate := r.reported && r.latest.BytesDownloaded == downloaded && r.latest.TotalSize == total
+	due := r.interval < 0 || r.lastCall.IsZero() || time.Since(r.lastCall) >= r.interval
+
+	r.latest = p
+	if duplicate || (!due && !complete) {
+		r.reported = duplicate
+		r.mu.Unlock()
+		return
+	}
+
+	r.lastCall, r.reported = time.Now(), true
+	r.mu.Unlock()
+
+	r.callback(p)
+}
+
+// finish reports the final progress of a completed download, unless the
+// last callback already did.
+func (r *progressReporter) finish(stats *types.DownloadStats) {
+	if stats == nil {
+		return
+	}
+
+	total := stats.TotalSize
+	if total <= 0 {
+		total = stats.BytesDownloaded
+	}
+
+	r.mu.Lock()
+	if r.reported && r.latest.BytesDownloaded == total && r.latest.TotalSize == total {
+		r.mu.Unlock()
+		return
+	}
+
+	p := Progress{
+		TotalSize:       total,
+		BytesDownloaded: total,
+		Speed:           stats.AverageSpeed,
+		Percentage:      100,
+		TimeElapsed:     time.Since(r.start),
+		InstantSpeed:    r.latest.InstantSpeed,
+		SmoothedSpeed:   r.latest.SmoothedSpeed,
+	}
+	r.latest, r.reported = p, true
+	r.mu.Unlock()
+
+	r.callback(p)
+}
+
 // Options defines download options.
 type Options struct {
 	ProgressCallback  ProgressCallback
@@ -46,6 +173,229 @@ type Options struct {
 	Quiet             bool
 	Verbose           bool
 	MaxRate           int64 // Maximum download rate in bytes per second (0 = unlimited)
+	MaxRateBurst      int64 // Bytes the rate limiter lets through at once (0 = about 50ms of data)
+
+	// ProgressInterval is the minimum time between ProgressCallback calls
+	// (0 = 100ms, negative = every update). A successful download always ends
+	// with a call reporting it complete.
+	ProgressInterval time.Duration
+
+	// SpeedWindow is the window Progress.SmoothedSpeed and TimeRemaining are
+	// averaged over (0 = 5 seconds). Longer windows give steadier estimates.
+	SpeedWindow time.Duration
+
+	// MinSpeed aborts and retries a transfer that stays below this many bytes
+	// per second for StallTimeout (30 seconds if unset). 0 disables it.
+	MinSpeed int64
+
+	// StallTimeout is the window MinSpeed is measured over. On its own, it
+	// aborts and retries a transfer that receives no data for this long.
+	StallTimeout time.Duration
+
+	// URLRefresher is called with the current URL when the server rejects it
+	// (HTTP 400, 401 or 403), e.g. because a presigned link expired during a
+	// long download. The download continues from the URL it returns.
+	URLRefresher func(ctx context.Context, oldURL string) (string, error)
+
+	// RetryClassifier overrides which failed attempts are retried, how long to
+	// wait before the next one and whether it switches to the next of Mirrors.
+	// It is called with the error and the number of the attempt that failed;
+	// RetryAttempts still caps the retries. nil retries the errors
+	// errors.IsRetryable accepts.
+	RetryClassifier func(err error, attempt int) types.RetryDecision
+
+	// MinFreeSpace stops a download with a CodeInsufficientSpace error, keeping
+	// the partial file for resuming, once free space on the destination's
+	// filesystem falls below this many bytes. 0 disables the check.
+	MinFreeSpace int64
+
+	// MaxInMemorySize caps the response body DownloadToMemory holds: a larger
+	// response fails with a CodeValidationError wrapping
+	// errors.ErrResponseTooLarge, without being read when its Content-Length
+	// announces the size. 0 means no limit.
+	MaxInMemorySize int64
+
+	// CollisionPolicy decides what happens when dest already exists:
+	// types.CollisionFail, CollisionOverwrite, CollisionSkip (the download is
+	// reported with DownloadStats.Skipped), CollisionRename (the file is saved
+	// as "name-1.ext", "name-2.ext"... and DownloadStats.Filename names it) or
+	// CollisionResume (a partial file is continued, a complete one kept).
+	// Empty leaves it to OverwriteExisting and EnableResume. Batch jobs can
+	// set it per job. It cannot be combined with OnlyIfNewer.
+	CollisionPolicy string
+
+	// ResumeValidation decides what a resumed download does when the file
+	// on the server changed since the partial file was started, as told by
+	// its ETag, Last-Modified time or size: types.ResumeRestart (or empty)
+	// downloads it again from the start, ResumeStrict fails with
+	// CodeCorruptedData wrapping errors.ErrRemoteChanged and ResumeIgnore
+	// continues the partial file anyway.
+	ResumeValidation string
+
+	// OnlyIfNewer skips the download when the server file is not newer than the
+	// existing local file (If-Modified-Since/If-None-Match) and sets the local
+	// modification time from Last-Modified, like wget --timestamping.
+	OnlyIfNewer bool
+
+	// ByteRange downloads only a slice of the file with an HTTP Range request,
+	// such as the first MiB for inspection ({Start: 0, End: 1<<20 - 1}) or the
+	// last 64 KiB ({Start: -65536}). It cannot be combined with EnableResume,
+	// OnlyIfNewer, ContentStore or Signature.
+	ByteRange *types.ByteRange
+
+	// Method is the HTTP method of the download request (default GET), and
+	// Body or BodyFile the request body, for APIs that return a file in
+	// response to a POST. A body without a Content-Type header is sent as
+	// application/json when it is valid JSON; a body file gets the type of its
+	// extension. The body is sent again on every retry, and EnableResume
+	// continues a partial file with a Range request when the server honours
+	// it. Such downloads use a single connection and cannot be combined with
+	// OnlyIfNewer or ContentStore.
+	Method   string
+	Body     []byte
+	BodyFile string
+
+	// AtomicWrite downloads to "<dest>.gdl-part" (or a file in TempDir) and renames
+	// it into place on success, so readers never see a truncated file. Existing
+	// part files are resumed automatically.
+	AtomicWrite bool
+	TempDir     string
+
+	// KeepDownloadTime leaves the file's modification time at the time of the
+	// download instead of the server's Last-Modified time. FileMode sets the
+	// file's permission bits (0 keeps them). Xattrs records the source URL and
+	// SHA-256 in the extended attributes user.xdg.origin.url and
+	// user.checksum.sha256 where the file system supports them.
+	KeepDownloadTime bool
+	FileMode         os.FileMode
+	Xattrs           bool
+
+	// DirectIO writes large downloads with direct I/O, bypassing the page cache,
+	// and WriteBufferSize tunes their write buffer in bytes (0 = default).
+	DirectIO        bool
+	WriteBufferSize int
+
+	// IOEngine selects how chunked downloads write to disk: "auto" (default),
+	// "standard", "uring" (experimental io_uring on Linux) or "mmap" (memory
+	// mapped destination), falling back to standard writes where unavailable.
+	IOEngine string
+
+	// SmallFileThreshold skips the HEAD request for files smaller than this
+	// many bytes, which suits batches of many small API responses: the GET
+	// response is written straight to dest when its Content-Length is below
+	// the threshold, and larger files are downloaded as usual (0 = disabled).
+	SmallFileThreshold int64
+
+	// Mirrors are other URLs serving the same file. Mirrors of the same size
+	// that support ranges share the download: each fetches pieces of the file
+	// at the same time, and faster mirrors take over the rest of slow ones.
+	Mirrors []string
+
+	// MirrorStrategy picks the mirrors used after probing all of them at once:
+	// "ordered" (or empty) keeps the listed order, "fastest" prefers those
+	// with the shortest round trip and "random" shuffles them.
+	MirrorStrategy string
+
+	// MaxMirrors limits how many mirrors are used (0 = all).
+	MaxMirrors int
+
+	// SparseFile writes chunked downloads in place into a sparse file, so disk
+	// usage reflects the data received; with EnableResume, an interrupted
+	// download continues with the ranges it is missing.
+	SparseFile bool
+
+	// StreamOrder downloads chunked and multi-source downloads from the
+	// beginning of the file to its end, a few small pieces at a time, so a
+	// media player can start playing the file before it is complete.
+	StreamOrder bool
+
+	// CircuitBreakerThreshold enables the per-host circuit breaker: after this many
+	// consecutive failures, further requests to the host fail fast with a
+	// CodeCircuitOpen error until the cool-down has passed (0 = disabled).
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is how long a host's circuit stays open before a probe
+	// request is allowed (0 = 30 seconds).
+	CircuitBreakerCooldown time.Duration
+
+	// MaxConnectionsPerHost caps the requests in flight to one host across all
+	// downloads made through the Downloader, batch jobs and chunk connections
+	// included (0 = unlimited). HostDelay is the minimum time between the
+	// starts of two requests to the same host (0 = none).
+	MaxConnectionsPerHost int
+	HostDelay             time.Duration
+
+	// HostCache is the path of a JSON file remembering what was learned about
+	// each host, such as whether it rejects HEAD requests and how fast it
+	// serves, so later downloads from it skip failing probes and size their
+	// pieces from the start ("" = disabled).
+	HostCache string
+
+	// Connection pooling overrides (0/false = shared defaults). Downloads with the
+	// same settings share one transport, reusing connections and TLS sessions.
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	DisableKeepAlives   bool
+	TLSSessionCacheSize int
+
+	// DNS controls: custom DNS servers, a DNS-over-HTTPS endpoint, the IP version
+	// to connect over (4 or 6, 0 = both) and curl-style static "host:port" → IP entries.
+	DNSServers []string
+	DoHURL     string
+	IPVersion  int
+	Resolve    map[string]string
+
+	// Proxy configures per-scheme HTTP(S)/SOCKS5 proxies, proxy authentication and
+	// NO_PROXY exclusions (nil = HTTP_PROXY/HTTPS_PROXY/NO_PROXY from the environment).
+	Proxy *types.ProxyConfig
+
+	// TLS adds trusted CA bundles, a client certificate for mutual TLS and pinned
+	// server public keys (nil = system trust store).
+	TLS *types.TLSOptions
+	// InsecureSkipVerify disables certificate verification; prefer TLS.CAFile or
+	// TLS.PinnedPublicKeys for self-signed services.
+	InsecureSkipVerify bool
+
+	// ContentStore deduplicates downloads: completed files are indexed by SHA-256
+	// and identical content (same URL and ETag, or a known digest) is placed from
+	// the store instead of being downloaded again (nil = disabled).
+	ContentStore *types.ContentStoreOptions
+
+	// Delta updates an outdated local copy from a zsync control file (path or
+	// URL): blocks the copy already holds are reused, only the changed ones are
+	// downloaded, and dest is replaced once the result matches the control
+	// file's SHA-1 (nil = disabled). Without a control file or local copy the
+	// whole file is downloaded.
+	Delta *types.DeltaOptions
+
+	// Quota caps the total size of a directory (the destination's by default):
+	// a download that would exceed it is refused or makes room by deleting the
+	// oldest or least recently used files, per Quota.Policy (nil = disabled).
+	Quota *types.QuotaOptions
+
+	// Checksum is the expected hex encoded digest of the file, computed with
+	// ChecksumAlgorithm: "md5", "sha1", "sha256" (default), "sha512",
+	// "blake3" or "xxh3". A file that does not match is deleted and the
+	// download fails with errors.ErrChecksumMismatch. BLAKE3 and xxh3 suit
+	// very large files, where SHA-256 is slower than the network; chunked
+	// downloads hash the file while its pieces arrive. ChecksumAlgorithm
+	// without Checksum only reports the digest in DownloadStats.Checksum.
+	Checksum          string
+	ChecksumAlgorithm string
+
+	// Signature verifies the downloaded file against a detached OpenPGP
+	// signature (path or URL) and a keyring; a file that fails verification
+	// is deleted and the download fails with errors.ErrSignatureMismatch (nil = disabled).
+	Signature *types.SignatureOptions
+
+	// Scan checks completed downloads with a ClamAV daemon, a scanner command
+	// or a custom types.FileScanner; a flagged file is deleted or quarantined
+	// and the download fails with errors.ErrScanFailed (nil = disabled).
+	Scan *types.ScanOptions
+
+	// overridden names the fields set through Override or OptionsBuilder,
+	// which replace the Downloader's defaults even when zero.
+	overridden map[string]bool
 }
 
 // DownloadStats contains statistics about a download operation.
@@ -86,8 +436,43 @@ type DownloadStats struct {
 	// Resumed indicates whether this download was resumed from a partial file.
 	Resumed bool
 
+	// NotModified indicates that the download was skipped because the local file is up to date.
+	NotModified bool
+
+	// Deduplicated indicates that the content was placed from the content store instead of downloaded.
+	Deduplicated bool
+
+	// DeltaReused is the number of bytes a delta update took from the local copy (see Options.Delta).
+	DeltaReused int64
+
+	// Skipped indicates that dest already existed and was kept (see Options.CollisionPolicy).
+	Skipped bool
+
+	// LastModified is the server's Last-Modified time of the file, or zero if unknown.
+	LastModified time.Time
+
 	// ChunksUsed indicates the number of concurrent chunks used for download.
 	ChunksUsed int
+
+	// Connections breaks the transfer down by connection (bytes, duration,
+	// retries, speed and server IP), one entry per chunk for chunked downloads.
+	Connections []types.ConnectionStats
+
+	// RangeViolations counts responses to range requests for other bytes than
+	// requested, such as a CDN node sending the whole file.
+	RangeViolations int
+
+	// RangeFallback indicates that the file was downloaded as a single stream
+	// because range requests kept being violated.
+	RangeFallback bool
+
+	// Plan describes how a download split into pieces was fetched: its pieces
+	// and the range requests they were coalesced into. Nil otherwise.
+	Plan *types.TransferPlan
+
+	// Checksum is the hex encoded digest of the file with
+	// Options.ChecksumAlgorithm, when Checksum or ChecksumAlgorithm was set.
+	Checksum string
 }
 
 // Download downloads a file from URL to destination path.
@@ -118,6 +503,182 @@ func Download(ctx context.Context, url, dest string) (*DownloadStats, error) {
 	return convertStats(stats), nil
 }
 
+// circuitBreakerPolicy converts the circuit breaker options, returning nil when disabled.
+func circuitBreakerPolicy(opts *Options) *types.CircuitBreakerPolicy {
+	if opts.CircuitBreakerThreshold <= 0 {
+		return nil
+	}
+
+	return &types.CircuitBreakerPolicy{
+		FailureThreshold: opts.CircuitBreakerThreshold,
+		Cooldown:         opts.CircuitBreakerCooldown,
+	}
+}
+
+// hostLimitPolicy converts the per-host limits, returning nil when none are set.
+func hostLimitPolicy(opts *Options) *types.HostLimitPolicy {
+	if opts.MaxConnectionsPerHost <= 0 && opts.HostDelay <= 0 {
+		return nil
+	}
+
+	return &types.HostLimitPolicy{
+		MaxConnections: opts.MaxConnectionsPerHost,
+		Delay:          opts.HostDelay,
+	}
+}
+
+// transportOptions converts the connection pooling options, returning nil when none are set.
+func transportOptions(opts *Options) *types.TransportOptions {
+	if opts.MaxIdleConnsPerHost <= 0 && opts.IdleConnTimeout <= 0 && opts.KeepAlive <= 0 &&
+		!opts.DisableKeepAlives && opts.TLSSessionCacheSize <= 0 {
+		return nil
+	}
+
+	return &types.TransportOptions{
+		MaxIdleConnsPerHost: opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:     opts.IdleConnTimeout,
+		KeepAlive:           opts.KeepAlive,
+		DisableKeepAlives:   opts.DisableKeepAlives,
+		TLSSessionCacheSize: opts.TLSSessionCacheSize,
+	}
+}
+
+// dnsOptions converts the DNS options, returning nil when the system resolver should be used.
+func dnsOptions(opts *Options) *types.DNSOptions {
+	if len(opts.DNSServers) == 0 && opts.DoHURL == "" && opts.IPVersion == 0 && len(opts.Resolve) == 0 {
+		return nil
+	}
+
+	return &types.DNSOptions{
+		Servers:   opts.DNSServers,
+		DoHURL:    opts.DoHURL,
+		IPVersion: opts.IPVersion,
+		Resolve:   opts.Resolve,
+	}
+}
+
+// validateProxy checks the proxy URLs of the proxy configuration.
+func validateProxy(proxy *types.ProxyConfig) error {
+	if proxy == nil {
+		return nil
+	}
+
+	return network.ProxyConfig{
+		URL:      proxy.URL,
+		HTTPURL:  proxy.HTTPURL,
+		HTTPSURL: proxy.HTTPSURL,
+	}.Validate()
+}
+
+// validateTLS loads the certificate files and parses the pins of the TLS options.
+func validateTLS(options *types.TLSOptions) error {
+	if options == nil {
+		return nil
+	}
+
+	return network.TLSConfig{
+		CAFile:           options.CAFile,
+		CertFile:         options.CertFile,
+		KeyFile:          options.KeyFile,
+		PinnedPublicKeys: options.PinnedPublicKeys,
+	}.Validate()
+}
+
+// validateByteRange checks the byte range and the options it cannot be
+// combined with, since a slice of a file can be neither resumed, compared
+// with the server copy, deduplicated nor verified against a signature or
+// checksum.
+func validateByteRange(opts *Options) error {
+	if opts.ByteRange == nil {
+		return nil
+	}
+
+	if err := opts.ByteRange.Validate(); err != nil {
+		return gdlerrors.NewValidationError("byte_range", err.Error())
+	}
+
+	switch {
+	case opts.EnableResume:
+		return gdlerrors.NewValidationError("byte_range", "cannot be combined with resume")
+	case opts.OnlyIfNewer:
+		return gdlerrors.NewValidationError("byte_range", "cannot be combined with timestamping")
+	case opts.ContentStore != nil:
+		return gdlerrors.NewValidationError("byte_range", "cannot be combined with a content store")
+	case opts.Signature != nil:
+		return gdlerrors.NewValidationError("byte_range", "cannot be combined with signature verification")
+	case opts.Checksum != "":
+		return gdlerrors.NewValidationError("byte_range", "cannot be combined with checksum verification")
+	case opts.Delta != nil:
+		return gdlerrors.NewValidationError("byte_range", "cannot be combined with a delta update")
+	}
+
+	return nil
+}
+
+// validateRequest checks the request method and body, and the options that
+// rely on a HEAD request for the file and so cannot be combined with them.
+func validateRequest(opts *Options) error {
+	if strings.IndexFunc(opts.Method, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+	}) >= 0 {
+		return gdlerrors.NewValidationError("method", fmt.Sprintf("invalid HTTP method %q", opts.Method))
+	}
+
+	if opts.Body != nil && opts.BodyFile != "" {
+		return gdlerrors.NewValidationError("body", "Body and BodyFile cannot be combined")
+	}
+
+	custom := (opts.Method != "" && !strings.EqualFold(opts.Method, http.MethodGet)) ||
+		opts.Body != nil || opts.BodyFile != ""
+
+	switch {
+	case custom && opts.OnlyIfNewer:
+		return gdlerrors.NewValidationError("method", "a custom request cannot be combined with timestamping")
+	case custom && opts.ContentStore != nil:
+		return gdlerrors.NewValidationError("method", "a custom request cannot be combined with a content store")
+	}
+
+	return nil
+}
+
+// validateCollisionPolicy checks the collision policy. Timestamping decides
+// on its own whether an existing file is replaced.
+func validateCollisionPolicy(opts *Options) error {
+	if err := core.ValidateCollisionPolicy(opts.CollisionPolicy); err != nil {
+		return err
+	}
+
+	switch {
+	case opts.CollisionPolicy != "" && opts.OnlyIfNewer:
+		return gdlerrors.NewValidationError("collision_policy", "cannot be combined with timestamping")
+	case opts.CollisionPolicy == types.CollisionResume && opts.ByteRange != nil:
+		return gdlerrors.NewValidationError("collision_policy", "resume cannot be combined with a byte range")
+	}
+
+	return nil
+}
+
+// validateScanOptions checks that the scan options name a scanner, a known
+// action and, to quarantine files, a quarantine directory.
+func validateScanOptions(options *types.ScanOptions) error {
+	if options.Clamd == "" && strings.TrimSpace(options.Command) == "" && options.Scanner == nil {
+		return gdlerrors.NewValidationError("scan", "requires a clamd address, a scan command or a scanner")
+	}
+
+	switch options.Action {
+	case "", types.ScanActionDelete:
+	case types.ScanActionQuarantine:
+		if options.QuarantineDir == "" {
+			return gdlerrors.NewValidationError("quarantine_dir", "required to quarantine files")
+		}
+	default:
+		return gdlerrors.NewValidationError("scan_action",
+			fmt.Sprintf("unknown action %q (want %q or %q)", options.Action, types.ScanActionDelete, types.ScanActionQuarantine))
+	}
+
+	return nil
+}
+
 // convertStats converts internal types.DownloadStats to public DownloadStats
 func convertStats(stats *types.DownloadStats) *DownloadStats {
 	if stats == nil {
@@ -136,7 +697,17 @@ func convertStats(stats *types.DownloadStats) *DownloadStats {
 		Success:         stats.Success,
 		Error:           stats.Error,
 		Resumed:         stats.Resumed,
+		NotModified:     stats.NotModified,
+		Deduplicated:    stats.Deduplicated,
+		DeltaReused:     stats.DeltaReused,
+		Skipped:         stats.Skipped,
+		LastModified:    stats.LastModified,
 		ChunksUsed:      stats.ChunksUsed,
+		Connections:     stats.Connections,
+		RangeViolations: stats.RangeViolations,
+		RangeFallback:   stats.RangeFallback,
+		Checksum:        stats.Checksum,
+		Plan:            stats.Plan,
 	}
 }
 
@@ -164,50 +735,77 @@ func DownloadWithOptions(ctx context.Context, url, dest string, opts *Options) (
 
 	// Validate options if provided
 	if opts != nil {
-		if opts.ChunkSize > 0 {
-			if err := validation.ValidateChunkSize(opts.ChunkSize); err != nil {
-				return nil, gdlerrors.NewValidationError("chunk_size", err.Error())
-			}
-		}
-		if opts.Timeout > 0 {
-			timeoutSeconds := int(opts.Timeout.Seconds())
-			if err := validation.ValidateTimeout(timeoutSeconds); err != nil {
-				return nil, gdlerrors.NewValidationError("timeout", err.Error())
-			}
+		if err := opts.Validate(); err != nil {
+			return nil, err
 		}
 	}
 
 	dl := core.NewDownloader()
 
 	// Convert our Options to internal DownloadOptions
-	var downloadOptions *types.DownloadOptions
+	var (
+		downloadOptions *types.DownloadOptions
+		reporter        *progressReporter
+	)
 	if opts != nil {
 		downloadOptions = &types.DownloadOptions{
-			MaxConcurrency:    opts.MaxConcurrency,
-			ChunkSize:         opts.ChunkSize,
-			Resume:            opts.EnableResume,
-			Timeout:           opts.Timeout,
-			UserAgent:         opts.UserAgent,
-			Headers:           opts.Headers,
-			CreateDirs:        opts.CreateDirs,
-			OverwriteExisting: opts.OverwriteExisting,
-			MaxRate:           opts.MaxRate,
+			MaxConcurrency:     opts.MaxConcurrency,
+			ChunkSize:          opts.ChunkSize,
+			Resume:             opts.EnableResume,
+			Timeout:            opts.Timeout,
+			UserAgent:          opts.UserAgent,
+			Headers:            opts.Headers,
+			CreateDirs:         opts.CreateDirs,
+			OverwriteExisting:  opts.OverwriteExisting,
+			CollisionPolicy:    opts.CollisionPolicy,
+			ResumeValidation:   opts.ResumeValidation,
+			OnlyIfNewer:        opts.OnlyIfNewer,
+			ByteRange:          opts.ByteRange,
+			Method:             opts.Method,
+			Body:               opts.Body,
+			BodyFile:           opts.BodyFile,
+			AtomicWrite:        opts.AtomicWrite,
+			TempDir:            opts.TempDir,
+			KeepDownloadTime:   opts.KeepDownloadTime,
+			FileMode:           opts.FileMode,
+			Xattrs:             opts.Xattrs,
+			DirectIO:           opts.DirectIO,
+			WriteBufferSize:    opts.WriteBufferSize,
+			IOEngine:           opts.IOEngine,
+			SparseFile:         opts.SparseFile,
+			StreamOrder:        opts.StreamOrder,
+			Mirrors:            opts.Mirrors,
+			MirrorStrategy:     opts.MirrorStrategy,
+			MaxMirrors:         opts.MaxMirrors,
+			SmallFileThreshold: opts.SmallFileThreshold,
+			MaxRate:            opts.MaxRate,
+			MaxRateBurst:       opts.MaxRateBurst,
+			MinSpeed:           opts.MinSpeed,
+			StallTimeout:       opts.StallTimeout,
+			MinFreeSpace:       opts.MinFreeSpace,
+			CircuitBreaker:     circuitBreakerPolicy(opts),
+			HostLimits:         hostLimitPolicy(opts),
+			HostCache:          opts.HostCache,
+			Transport:          transportOptions(opts),
+			DNS:                dnsOptions(opts),
+			Proxy:              opts.Proxy,
+			TLS:                opts.TLS,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+			ContentStore:       opts.ContentStore,
+			Delta:              opts.Delta,
+			Quota:              opts.Quota,
+			Checksum:           opts.Checksum,
+			ChecksumAlgorithm:  opts.ChecksumAlgorithm,
+			Signature:          opts.Signature,
+			Scan:               opts.Scan,
+			URLRefresher:       opts.URLRefresher,
+			RetryClassifier:    opts.RetryClassifier,
 		}
 
 		// Handle progress callback if provided
 		if opts.ProgressCallback != nil {
-			downloadOptions.ProgressCallback = func(downloaded, total int64, speed int64) {
-				progress := Progress{
-					TotalSize:       total,
-					BytesDownloaded: downloaded,
-					Speed:           speed,
-				}
-				if total > 0 {
-					progress.Percentage = float64(downloaded) / float64(total) * 100
-				}
-
-				opts.ProgressCallback(progress)
-			}
+			reporter = newProgressReporter(opts)
+			downloadOptions.ProgressCallback = reporter.update
 		}
 	}
 
@@ -216,6 +814,10 @@ func DownloadWithOptions(ctx context.Context, url, dest string, opts *Options) (
 		return convertStats(stats), err
 	}
 
+	if reporter != nil {
+		reporter.finish(stats)
+	}
+
 	return convertStats(stats), nil
 }
 
@@ -266,6 +868,20 @@ func DownloadToMemory(ctx context.Context, url string) ([]byte, *DownloadStats,
 	return buf.Bytes(), stats, err
 }
 
+// DownloadToMemoryWithOptions downloads to memory with custom options; set
+// MaxInMemorySize to bound the memory a response may take.
+//
+// Example:
+//
+//	data, _, err := gdl.DownloadToMemoryWithOptions(ctx, "https://example.com/api/data.json",
+//	    &gdl.Options{MaxInMemorySize: 10 << 20})
+//	if errors.Is(err, gdlerrors.ErrResponseTooLarge) {
+//	    log.Fatal("response larger than 10 MiB")
+//	}
+func DownloadToMemoryWithOptions(ctx context.Context, url string, opts *Options) ([]byte, *DownloadStats, error) {
+	return NewDownloader().DownloadToMemory(ctx, url, opts)
+}
+
 // DownloadWithResume downloads a file with resume support.
 //
 // Example:
@@ -307,22 +923,89 @@ func GetFileInfo(ctx context.Context, url string) (*FileInfo, error) {
 		return nil, err
 	}
 
+	return convertFileInfo(info), nil
+}
+
+// GetFileInfoBatch retrieves information about several files concurrently,
+// for example to check sizes and range support before choosing how to
+// download them. Results are returned in the order of urls; a URL that fails
+// has its Error set and does not affect the others.
+//
+// Example:
+//
+//	results := gdl.GetFileInfoBatch(ctx, []string{url1, url2})
+//	for _, r := range results {
+//	    if r.Error != nil {
+//	        log.Printf("%s: %v", r.URL, r.Error)
+//	        continue
+//	    }
+//	    fmt.Printf("%s: %d bytes\n", r.URL, r.Info.Size)
+//	}
+func GetFileInfoBatch(ctx context.Context, urls []string) []FileInfoResult {
+	return getFileInfoBatch(ctx, core.NewDownloader(), urls)
+}
+
+// getFileInfoBatch validates urls and queries the valid ones with dl.
+func getFileInfoBatch(ctx context.Context, dl *core.Downloader, urls []string) []FileInfoResult {
+	results := make([]FileInfoResult, len(urls))
+	valid := make([]string, 0, len(urls))
+	positions := make([]int, 0, len(urls))
+
+	for i, url := range urls {
+		results[i].URL = url
+
+		if err := validation.ValidateURL(url); err != nil {
+			results[i].Error = gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", url)
+			continue
+		}
+
+		valid = append(valid, url)
+		positions = append(positions, i)
+	}
+
+	for i, result := range dl.GetFileInfoBatch(ctx, valid) {
+		if result.Error != nil {
+			results[positions[i]].Error = result.Error
+			continue
+		}
+
+		results[positions[i]].Info = convertFileInfo(result.Info)
+	}
+
+	return results
+}
+
+// convertFileInfo converts core file information to the public type.
+func convertFileInfo(info *types.FileInfo) *FileInfo {
 	return &FileInfo{
+		FinalURL:       info.FinalURL,
 		Size:           info.Size,
 		Filename:       info.Filename,
 		ContentType:    info.ContentType,
 		LastModified:   info.LastModified,
 		SupportsRanges: info.SupportsRanges,
-	}, nil
+		ETag:           http.Header(info.Headers).Get("ETag"),
+	}
 }
 
-// FileInfo contains information about a remote file.
+// FileInfo contains information about a remote file. FinalURL is the URL
+// the request ended at after following redirects.
 type FileInfo struct {
+	FinalURL       string
 	Size           int64
 	Filename       string
 	ContentType    string
 	LastModified   time.Time
 	SupportsRanges bool
+	ETag           string
+}
+
+// FileInfoResult is the outcome of retrieving information about one URL with
+// GetFileInfoBatch.
+type FileInfoResult struct {
+	URL   string
+	Info  *FileInfo
+	Error error
 }
 
 // Downloader provides an extensible download client with plugin support.
@@ -333,18 +1016,37 @@ type Downloader struct {
 	protocolRegistry *protocols.ProtocolRegistry
 	storageManager   *storage.StorageManager
 	coreDownloader   *core.Downloader
+	transforms       *plugin.TransformPipeline
+	defaults         *Options
 }
 
-// NewDownloader creates a new Downloader with plugin support.
-func NewDownloader() *Downloader {
-	return &Downloader{
+// NewDownloader creates a new Downloader with plugin support. Options such as
+// WithDefaultHeader and WithDefaultOptions set defaults for every download;
+// the options passed to a download override only the fields they set.
+//
+// Example:
+//
+//	dl := gdl.NewDownloader(
+//	    gdl.WithDefaultUserAgent("myapp/1.0"),
+//	    gdl.WithDefaultHeader("Authorization", "Bearer "+token),
+//	    gdl.WithDefaultMaxRate(1<<20),
+//	)
+func NewDownloader(options ...DownloaderOption) *Downloader {
+	d := &Downloader{
 		pluginManager:    plugin.NewPluginManager(),
 		eventEmitter:     events.NewEventEmitter(),
 		middleware:       middleware.NewMiddlewareChain(),
 		protocolRegistry: protocols.NewProtocolRegistry(),
 		storageManager:   storage.NewStorageManager(),
 		coreDownloader:   core.NewDownloader(),
+		transforms:       plugin.NewTransformPipeline(),
+	}
+
+	for _, option := range options {
+		option(d)
 	}
+
+	return d
 }
 
 // UsePlugin registers and initializes a plugin.
@@ -357,6 +1059,20 @@ func (d *Downloader) UseMiddleware(m middleware.Middleware) {
 	d.middleware.Use(m)
 }
 
+// UseRequestMiddleware adds middleware wrapping each HTTP request of a
+// download, e.g. to sign requests or inject headers, rather than the download
+// as a whole.
+func (d *Downloader) UseRequestMiddleware(mw ...middleware.RequestMiddleware) {
+	d.coreDownloader.Use(mw...)
+}
+
+// UseTransform adds streaming transforms that every download passes through, in
+// the order added, before it is written. Wrap a TransformPlugin with
+// plugin.BufferedTransform to use it here.
+func (d *Downloader) UseTransform(transforms ...plugin.StreamTransformPlugin) {
+	d.transforms.Add(transforms...)
+}
+
 // On registers an event listener.
 func (d *Downloader) On(event events.EventType, handler events.EventListener) {
 	d.eventEmitter.On(event, handler)
@@ -372,8 +1088,11 @@ func (d *Downloader) SetStorageBackend(name string, backend storage.StorageBacke
 	return d.storageManager.Register(name, backend)
 }
 
-// Download downloads a file using the configured plugins and middleware.
+// Download downloads a file using the configured plugins and middleware. opts
+// is laid over the Downloader's defaults.
 func (d *Downloader) Download(ctx context.Context, url, dest string, opts *Options) (*DownloadStats, error) {
+	opts = mergeOptions(d.defaults, opts)
+
 	// Validate inputs
 	if err := validation.ValidateURL(url); err != nil {
 		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", url)
@@ -381,6 +1100,11 @@ func (d *Downloader) Download(ctx context.Context, url, dest string, opts *Optio
 	if err := validation.ValidateDestination(dest); err != nil {
 		return nil, gdlerrors.WrapError(err, gdlerrors.CodeInvalidPath, "invalid destination")
 	}
+	if opts != nil {
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Emit pre-download event
 	event := events.Event{
@@ -402,41 +1126,149 @@ func (d *Downloader) Download(ctx context.Context, url, dest string, opts *Optio
 	}
 
 	// Convert options
-	var downloadOptions *types.DownloadOptions
+	var (
+		downloadOptions *types.DownloadOptions
+		reporter        *progressReporter
+	)
 	if opts != nil {
 		downloadOptions = &types.DownloadOptions{
-			MaxConcurrency:    opts.MaxConcurrency,
-			ChunkSize:         opts.ChunkSize,
-			Resume:            opts.EnableResume,
-			Timeout:           opts.Timeout,
-			UserAgent:         opts.UserAgent,
-			Headers:           opts.Headers,
-			CreateDirs:        opts.CreateDirs,
-			OverwriteExisting: opts.OverwriteExisting,
-			MaxRate:           opts.MaxRate,
+			MaxConcurrency:     opts.MaxConcurrency,
+			ChunkSize:          opts.ChunkSize,
+			Resume:             opts.EnableResume,
+			Timeout:            opts.Timeout,
+			UserAgent:          opts.UserAgent,
+			Headers:            opts.Headers,
+			CreateDirs:         opts.CreateDirs,
+			OverwriteExisting:  opts.OverwriteExisting,
+			CollisionPolicy:    opts.CollisionPolicy,
+			ResumeValidation:   opts.ResumeValidation,
+			OnlyIfNewer:        opts.OnlyIfNewer,
+			ByteRange:          opts.ByteRange,
+			Method:             opts.Method,
+			Body:               opts.Body,
+			BodyFile:           opts.BodyFile,
+			AtomicWrite:        opts.AtomicWrite,
+			TempDir:            opts.TempDir,
+			KeepDownloadTime:   opts.KeepDownloadTime,
+			FileMode:           opts.FileMode,
+			Xattrs:             opts.Xattrs,
+			DirectIO:           opts.DirectIO,
+			WriteBufferSize:    opts.WriteBufferSize,
+			IOEngine:           opts.IOEngine,
+			SparseFile:         opts.SparseFile,
+			StreamOrder:        opts.StreamOrder,
+			Mirrors:            opts.Mirrors,
+			MirrorStrategy:     opts.MirrorStrategy,
+			MaxMirrors:         opts.MaxMirrors,
+			SmallFileThreshold: opts.SmallFileThreshold,
+			MaxRate:            opts.MaxRate,
+			MaxRateBurst:       opts.MaxRateBurst,
+			MinSpeed:           opts.MinSpeed,
+			StallTimeout:       opts.StallTimeout,
+			MinFreeSpace:       opts.MinFreeSpace,
+			CircuitBreaker:     circuitBreakerPolicy(opts),
+			HostLimits:         hostLimitPolicy(opts),
+			HostCache:          opts.HostCache,
+			Transport:          transportOptions(opts),
+			DNS:                dnsOptions(opts),
+			Proxy:              opts.Proxy,
+			TLS:                opts.TLS,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+			ContentStore:       opts.ContentStore,
+			Delta:              opts.Delta,
+			Quota:              opts.Quota,
+			Checksum:           opts.Checksum,
+			ChecksumAlgorithm:  opts.ChecksumAlgorithm,
+			Signature:          opts.Signature,
+			Scan:               opts.Scan,
+			URLRefresher:       opts.URLRefresher,
+			RetryClassifier:    opts.RetryClassifier,
 		}
 
 		// Handle progress callback
 		if opts.ProgressCallback != nil {
-			downloadOptions.ProgressCallback = func(downloaded, total int64, speed int64) {
-				progress := Progress{
-					TotalSize:       total,
-					BytesDownloaded: downloaded,
-					Speed:           speed,
-				}
-				if total > 0 {
-					progress.Percentage = float64(downloaded) / float64(total) * 100
-				}
-				opts.ProgressCallback(progress)
-			}
+			reporter = newProgressReporter(opts)
+			downloadOptions.ProgressCallback = reporter.update
 		}
 	}
 
-	// Use core downloader for actual download
-	stats, err := d.coreDownloader.Download(ctx, url, dest, downloadOptions)
+	// Settle an existing destination before the middleware sees it
+	kept, renamed := false, false
+	if downloadOptions != nil && downloadOptions.CollisionPolicy != "" {
+		resolved, resolvedOptions, err := core.ResolveCollision(dest, downloadOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		if resolved == "" {
+			kept = true
+		} else {
+			renamed = resolved != dest
+			dest, downloadOptions = resolved, resolvedOptions
+		}
+	}
+
+	// Run the core download through the middleware chain
+	request := &middleware.DownloadRequest{
+		URL:         url,
+		Destination: dest,
+		Options:     downloadOptions,
+		Headers:     make(map[string]string),
+		Client:      d.coreDownloader.HTTPClient(downloadOptions),
+	}
+	if downloadOptions != nil {
+		for key, value := range downloadOptions.Headers {
+			request.Headers[key] = value
+		}
+		request.UserAgent = downloadOptions.UserAgent
+	}
+
+	handler := d.middleware.Then(func(ctx context.Context, req *middleware.DownloadRequest) (*middleware.DownloadResponse, error) {
+		options := &types.DownloadOptions{}
+		if req.Options != nil {
+			*options = *req.Options
+		}
+		// Middleware may have rewritten the headers (e.g. authentication)
+		options.Headers = req.Headers
+		options.UserAgent = req.UserAgent
+
+		if d.transforms.Len() > 0 {
+			stats, err := d.downloadTransformed(ctx, req.URL, req.Destination, options)
+			return &middleware.DownloadResponse{Stats: stats}, err
+		}
+
+		stats, err := d.coreDownloader.Download(ctx, req.URL, req.Destination, options)
+		return &middleware.DownloadResponse{Stats: stats}, err
+	})
+
+	var (
+		stats *types.DownloadStats
+		err   error
+	)
+	if kept {
+		// The core downloader reports the kept file without a request
+		stats, err = d.coreDownloader.Download(ctx, url, dest, downloadOptions)
+	} else {
+		var resp *middleware.DownloadResponse
+		resp, err = handler(ctx, request)
+		if resp != nil {
+			stats = resp.Stats
+		}
+	}
+
+	// A failed download gives back the name CollisionRename reserved
+	if err != nil && renamed {
+		if info, statErr := os.Stat(dest); statErr == nil && info.Size() == 0 {
+			_ = os.Remove(dest)
+		}
+	}
 
 	// Execute post-download hooks
 	if err == nil {
+		if reporter != nil {
+			reporter.finish(stats)
+		}
+
 		// Emit success event
 		successEvent := events.Event{
 			Type: events.EventDownloadCompleted,
@@ -483,27 +1315,202 @@ func (d *Downloader) Download(ctx context.Context, url, dest string, opts *Optio
 	return convertStats(stats), nil
 }
 
-// DownloadToWriter downloads to an io.Writer with plugin support.
+// DownloadToWriter downloads to an io.Writer with plugin support. opts is laid
+// over the Downloader's defaults.
 func (d *Downloader) DownloadToWriter(ctx context.Context, url string, w io.Writer, opts *Options) (*DownloadStats, error) {
+	return d.downloadToWriter(ctx, url, w, opts, 0)
+}
+
+// DownloadToMemory downloads to memory and returns the bytes. opts is laid
+// over the Downloader's defaults; its MaxInMemorySize bounds the response.
+func (d *Downloader) DownloadToMemory(ctx context.Context, url string, opts *Options) ([]byte, *DownloadStats, error) {
+	var limit int64
+	if merged := mergeOptions(d.defaults, opts); merged != nil {
+		if merged.MaxInMemorySize < 0 {
+			return nil, nil, gdlerrors.NewValidationError("max_in_memory_size",
+				fmt.Sprintf("must not be negative, got %d", merged.MaxInMemorySize))
+		}
+
+		limit = merged.MaxInMemorySize
+	}
+
+	var buf bytes.Buffer
+
+	stats, err := d.downloadToWriter(ctx, url, &buf, opts, limit)
+
+	return buf.Bytes(), stats, err
+}
+
+// DownloadChunks downloads url and yields its body in chunks as it arrives, so
+// that it can be processed without a destination file and without holding it
+// in memory. The chunk is reused and only valid until the next iteration. A
+// failed download ends with a nil chunk and its error; stopping the iteration
+// early cancels the download.
+//
+// Example:
+//
+//	hash := sha256.New()
+//	for chunk, err := range gdl.NewDownloader().DownloadChunks(ctx, url, nil) {
+//	    if err != nil {
+//	        log.Fatal(err)
+//	    }
+//	    hash.Write(chunk)
+//	}
+func (d *Downloader) DownloadChunks(ctx context.Context, url string, opts *Options) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		size := int64(core.DefaultChunkSize)
+		if merged := mergeOptions(d.defaults, opts); merged != nil && merged.ChunkSize > 0 {
+			size = merged.ChunkSize
+		}
+
+		reader, writer := io.Pipe()
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			_, err := d.DownloadToWriter(ctx, url, writer, opts)
+			_ = writer.CloseWithError(err)
+		}()
+
+		// Unblock and wait for the download when the caller stops early
+		defer func() {
+			cancel()
+			_ = reader.Close()
+			<-done
+		}()
+
+		chunk := make([]byte, size)
+
+		for {
+			n, err := reader.Read(chunk)
+			if n > 0 && !yield(chunk[:n], nil) {
+				return
+			}
+
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// DownloadToDestination downloads url into dest: a local file, memory or a
+// bucket object from the destination package, or any other
+// types.Destination. The file is fetched in pieces over several connections
+// when the server allows and committed to dest only once it is complete.
+// With EnableResume a failed download is kept by a resumable destination and
+// the next call fetches only the rest.
+//
+// Example:
+//
+//	dest := destination.NewS3(s3.NewFromConfig(cfg), "backups", "db.dump", "")
+//	stats, err := gdl.NewDownloader().DownloadToDestination(ctx, url, dest, nil)
+func (d *Downloader) DownloadToDestination(
+	ctx context.Context,
+	url string,
+	dest types.Destination,
+	opts *Options,
+) (*DownloadStats, error) {
+	opts = mergeOptions(d.defaults, opts)
+
+	if err := validation.ValidateURL(url); err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", url)
+	}
+	if opts != nil {
+		if err := validateRequest(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var downloadOptions *types.DownloadOptions
+	if opts != nil {
+		downloadOptions = &types.DownloadOptions{
+			MaxConcurrency:     opts.MaxConcurrency,
+			ChunkSize:          opts.ChunkSize,
+			Resume:             opts.EnableResume,
+			Timeout:            opts.Timeout,
+			UserAgent:          opts.UserAgent,
+			Headers:            opts.Headers,
+			OverwriteExisting:  opts.OverwriteExisting,
+			MaxRate:            opts.MaxRate,
+			MaxRateBurst:       opts.MaxRateBurst,
+			MinSpeed:           opts.MinSpeed,
+			StallTimeout:       opts.StallTimeout,
+			Transport:          transportOptions(opts),
+			DNS:                dnsOptions(opts),
+			Proxy:              opts.Proxy,
+			TLS:                opts.TLS,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+		}
+
+		if opts.ProgressCallback != nil {
+			downloadOptions.ProgressCallback = newProgressReporter(opts).update
+		}
+	}
+
+	stats, err := d.coreDownloader.DownloadToDestination(ctx, url, dest, downloadOptions)
+
+	return convertStats(stats), err
+}
+
+// downloadToWriter is DownloadToWriter failing once the response is larger
+// than maxBodySize bytes (0 = unlimited).
+func (d *Downloader) downloadToWriter(
+	ctx context.Context,
+	url string,
+	w io.Writer,
+	opts *Options,
+	maxBodySize int64,
+) (*DownloadStats, error) {
+	opts = mergeOptions(d.defaults, opts)
+
 	if err := validation.ValidateURL(url); err != nil {
 		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", url)
 	}
 	if w == nil {
 		return nil, gdlerrors.NewValidationError("writer", "writer cannot be nil")
 	}
+	if opts != nil && opts.ByteRange != nil {
+		if err := opts.ByteRange.Validate(); err != nil {
+			return nil, gdlerrors.NewValidationError("byte_range", err.Error())
+		}
+	}
+	if opts != nil {
+		if err := validateRequest(opts); err != nil {
+			return nil, err
+		}
+	}
 
 	// Convert options
 	var downloadOptions *types.DownloadOptions
 	if opts != nil {
-		downloadOptions = &types.DownloadOptions{
-			MaxConcurrency: opts.MaxConcurrency,
-			ChunkSize:      opts.ChunkSize,
-			Resume:         opts.EnableResume,
-			Timeout:        opts.Timeout,
-			UserAgent:      opts.UserAgent,
-			Headers:        opts.Headers,
-			MaxRate:        opts.MaxRate,
+		downloadOptions = writerOptions(opts)
+		downloadOptions.ByteRange = opts.ByteRange
+		downloadOptions.Method = opts.Method
+		downloadOptions.Body = opts.Body
+		downloadOptions.BodyFile = opts.BodyFile
+	}
+
+	if maxBodySize > 0 {
+		if downloadOptions == nil {
+			downloadOptions = &types.DownloadOptions{}
 		}
+
+		downloadOptions.MaxBodySize = maxBodySize
+	}
+
+	if d.transforms.Len() > 0 {
+		stats, err := d.downloadToTransforms(ctx, url, w, downloadOptions)
+		return convertStats(stats), err
 	}
 
 	stats, err := d.coreDownloader.DownloadToWriter(ctx, url, w, downloadOptions)
@@ -513,24 +1520,887 @@ func (d *Downloader) DownloadToWriter(ctx context.Context, url string, w io.Writ
 	return convertStats(stats), nil
 }
 
-// GetFileInfo retrieves file information with plugin support.
-func (d *Downloader) GetFileInfo(ctx context.Context, url string) (*FileInfo, error) {
-	if err := validation.ValidateURL(url); err != nil {
-		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", url)
+// writerOptions converts the connection settings of opts to the options of
+// a download to a writer.
+func writerOptions(opts *Options) *types.DownloadOptions {
+	return &types.DownloadOptions{
+		MaxConcurrency:     opts.MaxConcurrency,
+		ChunkSize:          opts.ChunkSize,
+		Resume:             opts.EnableResume,
+		Timeout:            opts.Timeout,
+		UserAgent:          opts.UserAgent,
+		Headers:            opts.Headers,
+		MaxRate:            opts.MaxRate,
+		MaxRateBurst:       opts.MaxRateBurst,
+		MinSpeed:           opts.MinSpeed,
+		StallTimeout:       opts.StallTimeout,
+		Transport:          transportOptions(opts),
+		DNS:                dnsOptions(opts),
+		Proxy:              opts.Proxy,
+		TLS:                opts.TLS,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
 	}
+}
 
-	info, err := d.coreDownloader.GetFileInfo(ctx, url)
-	if err != nil {
+// downloadToTransforms streams a download through the transform pipeline
+// into w.
+func (d *Downloader) downloadToTransforms(
+	ctx context.Context,
+	url string,
+	w io.Writer,
+	options *types.DownloadOptions,
+) (*types.DownloadStats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pipeline := d.transforms.Writer(ctx, w)
+
+	stats, err := d.coreDownloader.DownloadToWriter(ctx, url, pipeline, options)
+	if err != nil {
+		// Stop the transforms rather than flushing a partial download
+		cancel()
+	}
+
+	if closeErr := pipeline.Close(); err == nil {
+		err = closeErr
+	}
+
+	return stats, err
+}
+
+// downloadTransformed streams a download through the transform pipeline into
+// dest. Transforms need the data in order, so the download is a single
+// stream; the output goes to dest's part file and is renamed into place once
+// every transform has finished.
+func (d *Downloader) downloadTransformed(
+	ctx context.Context,
+	url, dest string,
+	options *types.DownloadOptions,
+) (*types.DownloadStats, error) {
+	if _, err := os.Stat(dest); err == nil && !options.OverwriteExisting {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeFileExists,
+			"File already exists", fmt.Sprintf("File exists at: %s", dest))
+	}
+
+	if options.CreateDirs {
+		if err := os.MkdirAll(filepath.Dir(dest), 0o750); err != nil {
+			return nil, gdlerrors.NewInvalidPathError(dest, err)
+		}
+	}
+
+	partPath := dest + core.PartFileSuffix
+
+	// #nosec G304 -- dest has been validated by Download
+	file, err := os.Create(partPath)
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("create file", err, partPath)
+	}
+
+	stats, err := d.downloadToTransforms(ctx, url, file, options)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = gdlerrors.NewStorageError("close file", closeErr, partPath)
+	}
+
+	if err == nil {
+		if renameErr := os.Rename(partPath, dest); renameErr != nil {
+			err = gdlerrors.NewStorageError("rename file", renameErr, dest)
+		}
+	}
+
+	if err != nil {
+		_ = os.Remove(partPath)
+		return stats, err
+	}
+
+	if stats != nil {
+		stats.Filename = dest
+	}
+
+	return stats, nil
+}
+
+// GetFileInfo retrieves file information with plugin support.
+func (d *Downloader) GetFileInfo(ctx context.Context, url string) (*FileInfo, error) {
+	if err := validation.ValidateURL(url); err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", url)
+	}
+
+	info, err := d.coreDownloader.GetFileInfo(ctx, url)
+	if err != nil {
 		return nil, err
 	}
 
-	return &FileInfo{
-		Size:           info.Size,
-		Filename:       info.Filename,
-		ContentType:    info.ContentType,
-		LastModified:   info.LastModified,
-		SupportsRanges: info.SupportsRanges,
-	}, nil
+	return convertFileInfo(info), nil
+}
+
+// GetFileInfoBatch retrieves information about several files concurrently.
+// See the package-level GetFileInfoBatch.
+func (d *Downloader) GetFileInfoBatch(ctx context.Context, urls []string) []FileInfoResult {
+	return getFileInfoBatch(ctx, d.coreDownloader, urls)
+}
+
+// BatchJob is one download in a batch run with DownloadBatch.
+type BatchJob struct {
+	// ID names the job in DependsOn lists and results. It defaults to the
+	// job's position in the batch.
+	ID          string
+	URL         string
+	Destination string
+
+	// Priority orders jobs that are ready to start: higher starts first.
+	Priority int
+
+	// DependsOn lists the IDs of jobs that must succeed before this one
+	// starts. If one of them does not, the job is skipped.
+	DependsOn []string
+
+	Options *Options
+}
+
+// BatchOptions limits how a batch is downloaded.
+type BatchOptions struct {
+	// MaxParallelJobs is the number of downloads run at once (0 = 4).
+	MaxParallelJobs int
+
+	// MaxConnectionsPerHost caps the connections open to one host across
+	// all running jobs (0 = unlimited). Each job's MaxConcurrency is lowered
+	// to fit under it.
+	MaxConnectionsPerHost int
+
+	// HostDelay is the minimum time between two requests to the same host
+	// across all running jobs (0 = none).
+	HostDelay time.Duration
+
+	// Prefetch is how many upcoming jobs have their host names resolved
+	// while earlier jobs download (0 = none), so the next file does not
+	// wait on DNS.
+	Prefetch int
+
+	// WarmConnections also opens a connection, TLS handshake included, to
+	// the host of each prefetched job, once per host, for its download to
+	// reuse.
+	WarmConnections bool
+
+	// Progress receives the progress of every job under its ID, such as a
+	// progress.Aggregator merging them into batch-level totals. Jobs that
+	// never run because a dependency failed or the batch was cancelled are
+	// reported failed.
+	Progress types.AggregateProgress
+}
+
+// BatchResult is the outcome of one job in a batch.
+type BatchResult struct {
+	ID    string
+	State scheduler.State
+	Stats *DownloadStats
+	Error error
+}
+
+// DownloadBatch downloads jobs in priority order, at most
+// opts.MaxParallelJobs at a time and within opts.MaxConnectionsPerHost,
+// starting each job only after the jobs it depends on have succeeded. It
+// returns one result per job, in the order of jobs, and fails without
+// downloading anything if the jobs' IDs or dependencies are invalid. Jobs
+// with URLs other than http(s), such as s3:// or ftp://, are downloaded by
+// the handler registered for their scheme.
+//
+// Example:
+//
+//	results, err := dl.DownloadBatch(ctx, []gdl.BatchJob{
+//	    {ID: "index", URL: indexURL, Destination: "index.json", Priority: 10},
+//	    {ID: "data", URL: dataURL, Destination: "data.bin", DependsOn: []string{"index"}},
+//	}, &gdl.BatchOptions{MaxParallelJobs: 2, MaxConnectionsPerHost: 4})
+func (d *Downloader) DownloadBatch(ctx context.Context, jobs []BatchJob, opts *BatchOptions) ([]BatchResult, error) {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+
+	batch := make(map[string]*BatchJob, len(jobs))
+	stats := make(map[string]*DownloadStats, len(jobs))
+	schedulerJobs := make([]*scheduler.Job, len(jobs))
+
+	for i := range jobs {
+		job := jobs[i]
+		if job.ID == "" {
+			job.ID = strconv.Itoa(i)
+		}
+
+		job.Options = batchJobOptions(mergeOptions(d.defaults, job.Options), opts)
+		if opts.Progress != nil {
+			job.Options = withJobProgress(job.Options, opts.Progress.Job(job.ID))
+		}
+
+		connections := 1
+		if job.Options != nil && job.Options.MaxConcurrency > 0 {
+			connections = job.Options.MaxConcurrency
+		}
+
+		batch[job.ID] = &job
+		schedulerJobs[i] = &scheduler.Job{
+			ID:          job.ID,
+			URL:         job.URL,
+			Priority:    job.Priority,
+			DependsOn:   job.DependsOn,
+			Connections: connections,
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		warmed = make(map[string]bool)
+	)
+
+	// Warm-ups still running when the batch ends are abandoned
+	warmCtx, stopWarming := context.WithCancel(ctx)
+	defer stopWarming()
+
+	s := scheduler.New(scheduler.Config{
+		MaxParallel: opts.MaxParallelJobs,
+		MaxPerHost:  opts.MaxConnectionsPerHost,
+		Lookahead:   opts.Prefetch,
+		Prepare: func(_ context.Context, sj *scheduler.Job) {
+			job := batch[sj.ID]
+
+			parsed, err := url.Parse(job.URL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				return
+			}
+
+			// One warm-up per host is enough: later jobs reuse its connection
+			host := strings.ToLower(parsed.Host)
+
+			mu.Lock()
+			done := warmed[host]
+			warmed[host] = true
+			mu.Unlock()
+
+			if !done {
+				d.warmJob(warmCtx, job, opts.WarmConnections)
+			}
+		},
+	}, func(ctx context.Context, sj *scheduler.Job) error {
+		job := batch[sj.ID]
+
+		var tracker types.Progress
+		if opts.Progress != nil {
+			tracker = opts.Progress.Job(sj.ID)
+			tracker.Start(job.Destination, 0)
+		}
+
+		result, err := d.downloadJob(ctx, job.URL, job.Destination, job.Options)
+
+		mu.Lock()
+		stats[sj.ID] = result
+		mu.Unlock()
+
+		if tracker != nil {
+			reportJobDone(tracker, job.Destination, result, err)
+		}
+
+		return err
+	})
+
+	if err := s.Add(schedulerJobs...); err != nil {
+		return nil, gdlerrors.NewValidationError("jobs", err.Error())
+	}
+
+	scheduled := s.Run(ctx)
+	results := make([]BatchResult, len(scheduled))
+
+	for i, r := range scheduled {
+		results[i] = BatchResult{
+			ID:    r.Job.ID,
+			State: r.State,
+			Stats: stats[r.Job.ID],
+			Error: r.Err,
+		}
+
+		if _, ran := stats[r.Job.ID]; !ran && opts.Progress != nil {
+			opts.Progress.Job(r.Job.ID).Error(batch[r.Job.ID].Destination, r.Err)
+		}
+	}
+
+	return results, nil
+}
+
+// withJobProgress returns a copy of opts whose progress callback also
+// reports to tracker.
+func withJobProgress(opts *Options, tracker types.Progress) *Options {
+	withProgress := &Options{}
+	if opts != nil {
+		*withProgress = *opts
+	}
+
+	callback := withProgress.ProgressCallback
+	withProgress.ProgressCallback = func(p Progress) {
+		tracker.Update(p.BytesDownloaded, p.TotalSize, p.Speed)
+
+		if callback != nil {
+			callback(p)
+		}
+	}
+
+	return withProgress
+}
+
+// reportJobDone reports the end of a batch job's download of dest to tracker.
+func reportJobDone(tracker types.Progress, dest string, stats *DownloadStats, err error) {
+	if err != nil {
+		tracker.Error(dest, err)
+		return
+	}
+
+	var final *types.DownloadStats
+	if stats != nil {
+		final = &types.DownloadStats{TotalSize: stats.TotalSize, BytesDownloaded: stats.BytesDownloaded}
+	}
+
+	tracker.Finish(dest, final)
+}
+
+// downloadJob downloads url to dest with Download or, for schemes other than
+// http(s), with the protocol handler registered for the scheme.
+func (d *Downloader) downloadJob(ctx context.Context, url, dest string, opts *Options) (*DownloadStats, error) {
+	scheme, _, _ := strings.Cut(url, "://")
+	scheme = strings.ToLower(scheme)
+
+	if scheme == "http" || scheme == "https" {
+		return d.Download(ctx, url, dest, opts)
+	}
+
+	if opts != nil && opts.CreateDirs {
+		if err := os.MkdirAll(filepath.Dir(dest), 0o750); err != nil {
+			return nil, gdlerrors.NewInvalidPathError(dest, err)
+		}
+	}
+
+	stats, err := d.protocolRegistry.Download(ctx, url, &types.DownloadOptions{Destination: dest})
+
+	return convertStats(stats), err
+}
+
+// warmJob resolves the host of an upcoming http(s) job and, with connect,
+// opens a connection to it. Failures are left for the download to report.
+func (d *Downloader) warmJob(ctx context.Context, job *BatchJob, connect bool) {
+	options := &types.DownloadOptions{}
+	if opts := job.Options; opts != nil {
+		options = &types.DownloadOptions{
+			Resume:             opts.EnableResume,
+			UserAgent:          opts.UserAgent,
+			Headers:            opts.Headers,
+			Mirrors:            opts.Mirrors,
+			MirrorStrategy:     opts.MirrorStrategy,
+			MaxMirrors:         opts.MaxMirrors,
+			SmallFileThreshold: opts.SmallFileThreshold,
+			Transport:          transportOptions(opts),
+			DNS:                dnsOptions(opts),
+			Proxy:              opts.Proxy,
+			TLS:                opts.TLS,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+		}
+	}
+
+	_ = d.coreDownloader.Warm(ctx, job.URL, options, connect)
+}
+
+// TreeOptions configures DownloadTree.
+type TreeOptions struct {
+	// Include keeps only files matching one of these patterns, and Exclude
+	// drops files matching any of them. Patterns use path.Match syntax: a
+	// pattern without a slash matches the file name, one with a slash the
+	// file's path relative to the root URL.
+	Include []string
+	Exclude []string
+
+	// MaxDepth is how many subdirectory levels below the root index page
+	// are followed (0 = 10, negative = the root page only).
+	MaxDepth int
+
+	// OutputTemplate names each file, relative to destDir, with the
+	// variables of package pathtemplate, such as "{path:-1}/{date}-{filename}".
+	// The default keeps the files' paths relative to the root URL.
+	OutputTemplate string
+
+	// Options applies to every file. Parent directories are always created.
+	Options *Options
+
+	// Batch limits how many files are downloaded at once.
+	Batch *BatchOptions
+
+	// IgnoreRobots crawls index pages and downloads files that the site's
+	// robots.txt disallows, and ignores its Crawl-delay.
+	IgnoreRobots bool
+}
+
+// DownloadTree downloads everything under rootURL into destDir, preserving
+// the files' relative paths. rootURL is either a directory index page, as
+// generated by nginx autoindex or Apache mod_autoindex, whose subdirectory
+// pages are followed too, or an s3://bucket/prefix listed with the default
+// AWS configuration. Results are identified by the files' relative paths.
+//
+// Unless opts.IgnoreRobots is set, the robots.txt of an http(s) site is
+// obeyed: disallowed pages and files are skipped, and its Crawl-delay spaces
+// out all requests to the host, as BatchOptions.HostDelay does.
+//
+// Example:
+//
+//	results, err := dl.DownloadTree(ctx, "https://example.com/pub/", "./mirror",
+//	    &gdl.TreeOptions{Include: []string{"*.tar.gz"}, Exclude: []string{"*-rc*"}})
+func (d *Downloader) DownloadTree(ctx context.Context, rootURL, destDir string, opts *TreeOptions) ([]BatchResult, error) {
+	if opts == nil {
+		opts = &TreeOptions{}
+	}
+
+	if !strings.HasPrefix(strings.ToLower(rootURL), "s3://") {
+		if err := validation.ValidateURL(rootURL); err != nil {
+			return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", rootURL)
+		}
+	}
+
+	fileOptions := Options{}
+	if opts.Options != nil {
+		fileOptions = *opts.Options
+	}
+	fileOptions.CreateDirs = true
+
+	header := http.Header{}
+	for name, value := range fileOptions.Headers {
+		header.Set(name, value)
+	}
+	if fileOptions.UserAgent != "" {
+		header.Set("User-Agent", fileOptions.UserAgent)
+	}
+
+	var rules *robots.Rules
+	if parsed, err := url.Parse(rootURL); err == nil && !opts.IgnoreRobots &&
+		(parsed.Scheme == "http" || parsed.Scheme == "https") {
+		if rules, err = robots.Fetch(ctx, nil, parsed, header, core.DefaultUserAgent); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := listing.List(ctx, rootURL, &listing.Options{
+		Header:   header,
+		MaxDepth: opts.MaxDepth,
+		Include:  opts.Include,
+		Exclude:  opts.Exclude,
+		Robots:   rules,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	batch := opts.Batch
+	if rules != nil && rules.CrawlDelay > 0 {
+		paced := BatchOptions{}
+		if batch != nil {
+			paced = *batch
+		}
+		paced.HostDelay = max(paced.HostDelay, rules.CrawlDelay)
+		batch = &paced
+	}
+
+	jobs := make([]BatchJob, len(entries))
+	outputs := make([]string, len(entries))
+	for i, entry := range entries {
+		jobs[i] = BatchJob{
+			ID:          entry.Path,
+			URL:         entry.URL,
+			Destination: filepath.Join(destDir, filepath.FromSlash(entry.Path)),
+			Options:     &fileOptions,
+		}
+		outputs[i] = opts.OutputTemplate
+	}
+
+	if opts.OutputTemplate != "" {
+		if err := renderOutputs(jobs, outputs, destDir, contentTypes(ctx, d.coreDownloader)); err != nil {
+			return nil, err
+		}
+
+		if err := checkDestinations(jobs, "use {path} or {index} in the template"); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.DownloadBatch(ctx, jobs, batch)
+}
+
+// GlobOptions configures DownloadGlob.
+type GlobOptions struct {
+	// Output is the destination of each URL. "#1" to "#9" are replaced with
+	// the value the corresponding set or range took, as in curl's -o, and
+	// the variables of package pathtemplate, such as {host} or {index}, are
+	// filled in; the default is the file name of each URL in the current
+	// directory. Set Options.CreateDirs when the output names directories.
+	Output string
+
+	// MaxURLs bounds the number of URLs the pattern may expand to
+	// (urlglob.DefaultMaxURLs if 0).
+	MaxURLs int
+
+	// Options applies to every file.
+	Options *Options
+
+	// Batch limits how many files are downloaded at once.
+	Batch *BatchOptions
+}
+
+// ExpandGlob expands a curl-style URL pattern, such as
+// "https://example.com/img[001-100].jpg" or "https://{a,b}.example.com/f.zip",
+// into batch jobs identified by their URLs. Destinations come from the output
+// template as described for GlobOptions.Output, and must all differ. No
+// requests are made, so {ext} and {filename} cannot take the extension from
+// the Content-Type of URLs without one; Downloader.ResolveGlob can.
+func ExpandGlob(pattern, output string, maxURLs int) ([]BatchJob, error) {
+	return globJobs(pattern, output, maxURLs, nil)
+}
+
+// ResolveGlob expands a URL pattern as ExpandGlob does, with HEAD requests
+// for the Content-Type of URLs without an extension when the output template
+// needs it.
+func (d *Downloader) ResolveGlob(ctx context.Context, pattern string, opts *GlobOptions) ([]BatchJob, error) {
+	if opts == nil {
+		opts = &GlobOptions{}
+	}
+
+	return globJobs(pattern, opts.Output, opts.MaxURLs, contentTypes(ctx, d.coreDownloader))
+}
+
+// globJobs expands pattern into jobs, looking up Content-Types with
+// contentTypes if it is not nil.
+func globJobs(pattern, output string, maxURLs int, contentTypes func(urls []string) map[string]string) ([]BatchJob, error) {
+	matches, err := urlglob.Expand(pattern, maxURLs)
+	if err != nil {
+		return nil, gdlerrors.NewValidationError("pattern", err.Error())
+	}
+
+	jobs := make([]BatchJob, len(matches))
+	templates := make([]string, len(matches))
+
+	for i, match := range matches {
+		dest := urlglob.FormatOutput(output, match.Values)
+		if output == "" {
+			dest = globFilename(match.URL)
+		} else if pathtemplate.Has(dest) {
+			templates[i] = dest
+		}
+
+		jobs[i] = BatchJob{ID: match.URL, URL: match.URL, Destination: dest}
+	}
+
+	if err := renderOutputs(jobs, templates, "", contentTypes); err != nil {
+		return nil, err
+	}
+
+	if err := checkDestinations(jobs, "use #1, #2... or {index} in the output name"); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// renderOutputs sets the destination of each job with an output template in
+// outputs (empty for none), relative to dir. The Content-Type of URLs whose
+// template needs it comes from contentTypes, if not nil.
+func renderOutputs(jobs []BatchJob, outputs []string, dir string, contentTypes func(urls []string) map[string]string) error {
+	templates := make([]*pathtemplate.Template, len(jobs))
+
+	var lookup []string
+	for i, output := range outputs {
+		if output == "" {
+			continue
+		}
+
+		tmpl, err := pathtemplate.Parse(output)
+		if err != nil {
+			return gdlerrors.NewValidationError("output", err.Error())
+		}
+		templates[i] = tmpl
+
+		if contentTypes != nil && tmpl.NeedsContentType(jobs[i].URL) {
+			lookup = append(lookup, jobs[i].URL)
+		}
+	}
+
+	var found map[string]string
+	if len(lookup) > 0 {
+		found = contentTypes(lookup)
+	}
+
+	now := time.Now()
+	for i, tmpl := range templates {
+		if tmpl == nil {
+			continue
+		}
+
+		dest, err := tmpl.Execute(pathtemplate.Vars{
+			URL:         jobs[i].URL,
+			Index:       i + 1,
+			ContentType: found[jobs[i].URL],
+			Time:        now,
+		})
+		if err != nil {
+			return gdlerrors.NewValidationError("output", err.Error())
+		}
+
+		jobs[i].Destination = filepath.Join(dir, filepath.FromSlash(dest))
+	}
+
+	return nil
+}
+
+// checkDestinations rejects jobs that would be saved to the same file.
+func checkDestinations(jobs []BatchJob, hint string) error {
+	destinations := make(map[string]string, len(jobs))
+
+	for _, job := range jobs {
+		if other, ok := destinations[job.Destination]; ok {
+			return gdlerrors.NewValidationError("output",
+				fmt.Sprintf("%s and %s would both be saved to %s; %s", other, job.URL, job.Destination, hint))
+		}
+		destinations[job.Destination] = job.URL
+	}
+
+	return nil
+}
+
+// contentTypes returns a function that looks up the Content-Type of URLs
+// with HEAD requests through dl, leaving out those that fail.
+func contentTypes(ctx context.Context, dl *core.Downloader) func(urls []string) map[string]string {
+	return func(urls []string) map[string]string {
+		found := make(map[string]string, len(urls))
+
+		for _, result := range getFileInfoBatch(ctx, dl, urls) {
+			if result.Info != nil {
+				found[result.URL] = result.Info.ContentType
+			}
+		}
+
+		return found
+	}
+}
+
+// ExpandOutputTemplate renders the output template for a single download of
+// url, with a HEAD request for its Content-Type if the template needs it.
+// See package pathtemplate for the variables.
+func ExpandOutputTemplate(ctx context.Context, template, url string) (string, error) {
+	jobs := []BatchJob{{ID: url, URL: url}}
+
+	if err := renderOutputs(jobs, []string{template}, "", contentTypes(ctx, core.NewDownloader())); err != nil {
+		return "", err
+	}
+
+	return jobs[0].Destination, nil
+}
+
+// globFilename returns the file name of an expanded URL.
+func globFilename(rawURL string) string {
+	rest := rawURL
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if _, after, ok := strings.Cut(rest, "://"); ok {
+		rest = after
+	}
+
+	slash := strings.IndexByte(rest, '/')
+	if slash < 0 {
+		return "download"
+	}
+
+	name := path.Base(rest[slash:])
+	if name == "/" {
+		return "download"
+	}
+
+	return name
+}
+
+// DownloadGlob downloads every URL a curl-style pattern expands to as one
+// batch sharing opts.Options. Results are identified by URL.
+//
+// Example:
+//
+//	results, err := dl.DownloadGlob(ctx, "https://example.com/photos/img[001-120].jpg",
+//	    &gdl.GlobOptions{Output: "photos/#1.jpg", Batch: &gdl.BatchOptions{MaxParallelJobs: 8}})
+func (d *Downloader) DownloadGlob(ctx context.Context, pattern string, opts *GlobOptions) ([]BatchResult, error) {
+	if opts == nil {
+		opts = &GlobOptions{}
+	}
+
+	jobs, err := d.ResolveGlob(ctx, pattern, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range jobs {
+		if err := validation.ValidateURL(jobs[i].URL); err != nil {
+			return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", jobs[i].URL)
+		}
+		jobs[i].Options = opts.Options
+	}
+
+	return d.DownloadBatch(ctx, jobs, opts.Batch)
+}
+
+// batchJobOptions returns opts with MaxConcurrency lowered to the batch's
+// per-host cap, so that a job's connections fit under it, and with the
+// batch's host limits applied to every request of the job.
+func batchJobOptions(opts *Options, batch *BatchOptions) *Options {
+	if batch.MaxConnectionsPerHost <= 0 && batch.HostDelay <= 0 {
+		return opts
+	}
+
+	limited := Options{}
+	if opts != nil {
+		limited = *opts
+	}
+
+	if maxPerHost := batch.MaxConnectionsPerHost; maxPerHost > 0 {
+		if limited.MaxConcurrency <= 0 || limited.MaxConcurrency > maxPerHost {
+			limited.MaxConcurrency = maxPerHost
+		}
+
+		if limited.MaxConnectionsPerHost <= 0 || limited.MaxConnectionsPerHost > maxPerHost {
+			limited.MaxConnectionsPerHost = maxPerHost
+		}
+	}
+
+	limited.HostDelay = max(limited.HostDelay, batch.HostDelay)
+
+	return &limited
+}
+
+// StreamOptions configures DownloadStream.
+type StreamOptions struct {
+	// MaxBandwidth (bits per second) and MaxHeight (pixels) bound the
+	// variant downloaded: the best one within them, or the smallest one if
+	// none is. 0 leaves them unbounded.
+	MaxBandwidth int64
+	MaxHeight    int
+
+	// Concurrency is the number of segments fetched at once (0 = 4).
+	Concurrency int
+
+	// NoAudio skips the separate audio track of the stream.
+	NoAudio bool
+
+	// KeepSegments writes the segments of each track as separate files in
+	// the directory dest, with a local index.m3u8 playlist, instead of
+	// concatenating them into dest.
+	KeepSegments bool
+
+	// Options applies to every request: headers, proxy, TLS, rate limit and
+	// the like. Its RetryAttempts caps the retries of each segment (0 = 3)
+	// and OverwriteExisting allows replacing dest.
+	Options *Options
+
+	// Progress is called after each segment is written, with the number of
+	// segments written and their total.
+	Progress func(done, total int)
+}
+
+// StreamResult describes a downloaded stream.
+type StreamResult struct {
+	// Format is "hls" or "dash".
+	Format string
+
+	// Files lists what was written: dest, then separate tracks such as the
+	// audio next to it ("movie.audio.mp4").
+	Files []string
+
+	// Segments and Bytes count the segments written and their size after
+	// decryption.
+	Segments int
+	Bytes    int64
+
+	// Duration is the length of the media.
+	Duration time.Duration
+}
+
+// DownloadStream downloads the HLS playlist (.m3u8) or DASH manifest (.mpd)
+// at manifestURL to dest. It picks a variant within opts' bounds, fetches its
+// segments several at a time, retrying failed ones, decrypts AES-128
+// segments with the keys the playlist names, and concatenates them in order
+// into dest, an MPEG-TS or fragmented MP4 file. A separate audio track goes
+// next to dest. Live streams and DRM-protected ones are not supported.
+//
+// Example:
+//
+//	result, err := dl.DownloadStream(ctx, "https://example.com/vod/master.m3u8", "talk.ts",
+//	    &gdl.StreamOptions{MaxHeight: 720})
+func (d *Downloader) DownloadStream(ctx context.Context, manifestURL, dest string, opts *StreamOptions) (*StreamResult, error) {
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
+
+	if err := validation.ValidateURL(manifestURL); err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", manifestURL)
+	}
+
+	requestOptions := mergeOptions(d.defaults, opts.Options)
+	if requestOptions == nil {
+		requestOptions = &Options{}
+	}
+	if err := validateRequest(requestOptions); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(dest); err == nil && !requestOptions.OverwriteExisting {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeFileExists,
+			"File already exists", fmt.Sprintf("File exists at: %s", dest))
+	}
+
+	// Segments are small: retry them quickly, as the core downloader does
+	retries := retry.NewRetryManager().
+		WithBaseDelay(100 * time.Millisecond).
+		WithMaxDelay(2 * time.Second)
+	if requestOptions.RetryAttempts > 0 {
+		retries = retries.WithMaxRetries(requestOptions.RetryAttempts)
+	}
+
+	fetch := func(ctx context.Context, url string, r *types.ByteRange) ([]byte, error) {
+		for attempt := 0; ; attempt++ {
+			downloadOptions := writerOptions(requestOptions)
+			downloadOptions.ByteRange = r
+
+			var buf bytes.Buffer
+			_, err := d.coreDownloader.DownloadToWriter(ctx, url, &buf, downloadOptions)
+			if err == nil {
+				return buf.Bytes(), nil
+			}
+			if !retries.ShouldRetry(err, attempt) {
+				return nil, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retries.DelayFor(err, attempt)):
+			}
+		}
+	}
+
+	result, err := stream.Download(ctx, manifestURL, dest, &stream.Options{
+		Fetch:        fetch,
+		Concurrency:  opts.Concurrency,
+		MaxBandwidth: opts.MaxBandwidth,
+		MaxHeight:    opts.MaxHeight,
+		NoAudio:      opts.NoAudio,
+		KeepSegments: opts.KeepSegments,
+		Progress:     opts.Progress,
+	})
+	if result == nil {
+		return nil, err
+	}
+
+	return &StreamResult{
+		Format:   result.Format,
+		Files:    result.Files,
+		Segments: result.Segments,
+		Bytes:    result.Bytes,
+		Duration: time.Duration(result.Duration * float64(time.Second)),
+	}, err
 }
 
 // executePluginHook is a helper method to execute plugin hooks
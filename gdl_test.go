@@ -3,17 +3,24 @@ package gdl
 import (
 	"bytes"
 	"context"
+	stdErrors "errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 	"github.com/forest6511/gdl/pkg/events"
 	"github.com/forest6511/gdl/pkg/middleware"
+	"github.com/forest6511/gdl/pkg/progress"
+	"github.com/forest6511/gdl/pkg/scheduler"
 	"github.com/forest6511/gdl/pkg/types"
 	"github.com/forest6511/gdl/pkg/validation"
 )
@@ -124,6 +131,128 @@ func TestDownloadToMemory(t *testing.T) {
 	}
 }
 
+func TestDownloadToMemoryLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 10000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// Flushed in parts, without a Content-Length
+			for i := 0; i < len(content); i += 1000 {
+				_, _ = w.Write(content[i : i+1000])
+				w.(http.Flusher).Flush()
+			}
+
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		limit   int64
+		wantErr bool
+	}{
+		{"no limit", "/", 0, false},
+		{"exactly the limit", "/", 10000, false},
+		{"announced too large", "/", 9999, true},
+		{"chunked within the limit", "/chunked", 10000, false},
+		{"chunked too large", "/chunked", 4096, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _, err := DownloadToMemoryWithOptions(context.Background(), server.URL+tt.path,
+				&Options{MaxInMemorySize: tt.limit})
+
+			if !tt.wantErr {
+				if err != nil || !bytes.Equal(data, content) {
+					t.Fatalf("DownloadToMemoryWithOptions() = %d bytes, error %v", len(data), err)
+				}
+				return
+			}
+
+			if !stdErrors.Is(err, gdlerrors.ErrResponseTooLarge) {
+				t.Fatalf("DownloadToMemoryWithOptions() error = %v, want ErrResponseTooLarge", err)
+			}
+			if gdlerrors.GetErrorCode(err) != gdlerrors.CodeValidationError || gdlerrors.IsRetryable(err) {
+				t.Errorf("error code = %v, want a CodeValidationError that is not retried", gdlerrors.GetErrorCode(err))
+			}
+			if int64(len(data)) > tt.limit {
+				t.Errorf("%d bytes held in memory, over the limit of %d", len(data), tt.limit)
+			}
+		})
+	}
+}
+
+func TestDownloadChunks(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 20000)
+
+	var cancelled atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/endless":
+			for r.Context().Err() == nil {
+				if _, err := w.Write(content); err != nil {
+					break
+				}
+			}
+			cancelled.Store(true)
+		default:
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	dl := NewDownloader()
+
+	var got []byte
+	for chunk, err := range dl.DownloadChunks(context.Background(), server.URL, &Options{ChunkSize: 4096}) {
+		if err != nil {
+			t.Fatalf("DownloadChunks() error = %v", err)
+		}
+		if len(chunk) > 4096 {
+			t.Errorf("chunk of %d bytes, want at most ChunkSize", len(chunk))
+		}
+		got = append(got, chunk...)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("chunks hold %d bytes, want %d", len(got), len(content))
+	}
+
+	var lastErr error
+	for _, err := range dl.DownloadChunks(context.Background(), server.URL+"/missing", nil) {
+		lastErr = err
+	}
+	if lastErr == nil {
+		t.Error("DownloadChunks() of a missing file should end with an error")
+	}
+
+	// Stopping early cancels the download
+	received := 0
+	for chunk, err := range dl.DownloadChunks(context.Background(), server.URL+"/endless", nil) {
+		if err != nil {
+			t.Fatalf("DownloadChunks() error = %v", err)
+		}
+		if received += len(chunk); received > 1<<20 {
+			break
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cancelled.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !cancelled.Load() {
+		t.Error("the download went on after the iteration stopped")
+	}
+}
+
 func TestDownloadWithResume(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Simulate a server that supports range requests
@@ -278,6 +407,438 @@ func TestGetFileInfo(t *testing.T) {
 	}
 }
 
+func TestGetFileInfoBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HEAD is refused, as some CDNs do
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Range", "bytes 0-0/2048")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte{0})
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/a.bin", "invalid://url", server.URL + "/b.bin"}
+
+	for _, results := range [][]FileInfoResult{
+		GetFileInfoBatch(context.Background(), urls),
+		NewDownloader().GetFileInfoBatch(context.Background(), urls),
+	} {
+		if len(results) != len(urls) {
+			t.Fatalf("GetFileInfoBatch() returned %d results, want %d", len(results), len(urls))
+		}
+
+		for _, i := range []int{0, 2} {
+			if results[i].Error != nil || results[i].Info == nil {
+				t.Fatalf("result %d error = %v", i, results[i].Error)
+			}
+
+			if results[i].Info.Size != 2048 || !results[i].Info.SupportsRanges {
+				t.Errorf("result %d = %+v, want 2048 bytes with range support", i, results[i].Info)
+			}
+		}
+
+		if results[1].URL != urls[1] || results[1].Error == nil {
+			t.Errorf("invalid URL result = %+v, want an error", results[1])
+		}
+	}
+}
+
+func TestDownloadBatch(t *testing.T) {
+	var order []string
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		mu.Lock()
+		order = append(order, r.URL.Path)
+		mu.Unlock()
+
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("contents of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	job := func(id string, priority int, deps ...string) BatchJob {
+		return BatchJob{
+			ID:          id,
+			URL:         server.URL + "/" + id,
+			Destination: filepath.Join(dir, id),
+			Priority:    priority,
+			DependsOn:   deps,
+			Options:     &Options{MaxConcurrency: 8, RetryAttempts: 1},
+		}
+	}
+
+	jobs := []BatchJob{
+		job("low", 0),
+		job("high", 5),
+		job("after-high", 10, "high"),
+		job("missing", 1),
+		job("after-missing", 0, "missing"),
+	}
+
+	aggregate := progress.NewAggregator(nil)
+
+	results, err := NewDownloader().DownloadBatch(context.Background(), jobs,
+		&BatchOptions{MaxParallelJobs: 1, MaxConnectionsPerHost: 2, Progress: aggregate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]scheduler.State{
+		"low":           scheduler.StateSucceeded,
+		"high":          scheduler.StateSucceeded,
+		"after-high":    scheduler.StateSucceeded,
+		"missing":       scheduler.StateFailed,
+		"after-missing": scheduler.StateSkipped,
+	}
+	for i, result := range results {
+		if result.ID != jobs[i].ID || result.State != want[result.ID] {
+			t.Errorf("result %d = %s %s, want %s %s", i, result.ID, result.State, jobs[i].ID, want[jobs[i].ID])
+		}
+	}
+
+	if results[0].Stats == nil || !results[0].Stats.Success {
+		t.Errorf("successful job stats = %+v", results[0].Stats)
+	}
+	if results[4].Stats != nil || !stdErrors.Is(results[4].Error, scheduler.ErrDependencyFailed) {
+		t.Errorf("skipped job = %+v, want no stats and ErrDependencyFailed", results[4])
+	}
+
+	mu.Lock()
+	got := strings.Join(order, ",")
+	mu.Unlock()
+	if got != "/high,/after-high,/missing,/low" {
+		t.Errorf("download order = %s, want /high,/after-high,/missing,/low", got)
+	}
+
+	// The skipped job never ran, and is reported failed all the same
+	wantBytes := int64(len("contents of /low") + len("contents of /high") + len("contents of /after-high"))
+	if snapshot := aggregate.Snapshot(); snapshot.TotalJobs != 5 || snapshot.CompletedJobs != 3 ||
+		snapshot.FailedJobs != 2 || snapshot.ActiveJobs != 0 || snapshot.DownloadedBytes != wantBytes {
+		t.Errorf("aggregate = %+v, want 3 of 5 jobs completed with %d bytes and 2 failed", snapshot, wantBytes)
+	}
+
+	if _, err := NewDownloader().DownloadBatch(context.Background(),
+		[]BatchJob{job("a", 0, "b"), job("b", 0, "a")}, nil); err == nil {
+		t.Error("DownloadBatch() with a dependency cycle should fail")
+	}
+}
+
+func TestDownloadBatchWarmConnections(t *testing.T) {
+	var heads [2]atomic.Int32
+
+	dir := t.TempDir()
+	var jobs []BatchJob
+
+	for i := range heads {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				heads[i].Add(1)
+			}
+			_, _ = w.Write([]byte("contents of " + r.URL.Path))
+		}))
+		defer server.Close()
+
+		for _, name := range []string{"a", "b", "c"} {
+			id := fmt.Sprintf("%d-%s", i, name)
+			jobs = append(jobs, BatchJob{
+				ID:          id,
+				URL:         server.URL + "/" + id,
+				Destination: filepath.Join(dir, id),
+				Options:     &Options{SmallFileThreshold: 1024},
+			})
+		}
+	}
+
+	results, err := NewDownloader().DownloadBatch(context.Background(), jobs,
+		&BatchOptions{MaxParallelJobs: 1, Prefetch: 4, WarmConnections: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.State != scheduler.StateSucceeded {
+			t.Errorf("%s: state = %s, err = %v", result.ID, result.State, result.Error)
+		}
+	}
+
+	// Small files are fetched without HEAD requests, so any are warm-ups
+	for i := range heads {
+		if got := heads[i].Load(); got > 1 {
+			t.Errorf("host %d got %d warm-up requests, want at most one", i, got)
+		}
+	}
+}
+
+func TestDownloadTree(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pub/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="../">../</a><a href="a.txt">a.txt</a><a href="b.log">b.log</a><a href="sub/">sub/</a>`))
+		case "/pub/sub/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="c.txt">c.txt</a>`))
+		case "/pub/a.txt", "/pub/b.log", "/pub/sub/c.txt":
+			_, _ = w.Write([]byte("content of " + r.URL.Path))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dest := t.TempDir()
+	results, err := NewDownloader().DownloadTree(context.Background(), server.URL+"/pub/", dest,
+		&TreeOptions{Exclude: []string{"*.log"}, Batch: &BatchOptions{MaxParallelJobs: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("DownloadTree() = %+v, want 2 files", results)
+	}
+
+	for _, rel := range []string{"a.txt", "sub/c.txt"} {
+		content, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel))) // #nosec G304 -- test file
+		if err != nil || string(content) != "content of /pub/"+rel {
+			t.Errorf("%s = %q, %v", rel, content, err)
+		}
+	}
+
+	for _, result := range results {
+		if result.State != scheduler.StateSucceeded {
+			t.Errorf("%s: state = %s, error = %v", result.ID, result.State, result.Error)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "b.log")); !os.IsNotExist(err) {
+		t.Error("excluded file was downloaded")
+	}
+
+	if _, err := NewDownloader().DownloadTree(context.Background(), server.URL+"/missing/", dest, nil); err == nil {
+		t.Error("DownloadTree() of a missing index page should fail")
+	}
+
+	// An output template flattens the tree
+	flat := t.TempDir()
+	results, err = NewDownloader().DownloadTree(context.Background(), server.URL+"/pub/", flat,
+		&TreeOptions{Include: []string{"*.txt"}, OutputTemplate: "{path:-1}-{filename}"})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("DownloadTree() = %+v, %v", results, err)
+	}
+
+	for _, name := range []string{"pub-a.txt", "sub-c.txt"} {
+		if _, err := os.Stat(filepath.Join(flat, name)); err != nil {
+			t.Errorf("%s was not downloaded: %v", name, err)
+		}
+	}
+
+	if _, err := NewDownloader().DownloadTree(context.Background(), server.URL+"/pub/", flat,
+		&TreeOptions{OutputTemplate: "{host}.txt"}); err == nil {
+		t.Error("DownloadTree() should reject a template saving files to the same name")
+	}
+}
+
+func TestDownloadTreeRobots(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		starts []time.Time
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /pub/sub/\nCrawl-delay: 0.02\n"))
+		case "/pub/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="a.txt">a.txt</a><a href="b.txt">b.txt</a><a href="sub/">sub/</a>`))
+		case "/pub/sub/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="c.txt">c.txt</a>`))
+		default:
+			_, _ = w.Write([]byte("content of " + r.URL.Path))
+		}
+	}))
+	defer server.Close()
+
+	results, err := NewDownloader().DownloadTree(context.Background(), server.URL+"/pub/", t.TempDir(),
+		&TreeOptions{Batch: &BatchOptions{MaxParallelJobs: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("DownloadTree() = %+v, want the 2 files robots.txt allows", results)
+	}
+
+	// The file downloads keep the crawl delay between their requests
+	mu.Lock()
+	downloads := starts[2:]
+	mu.Unlock()
+
+	for i := 1; i < len(downloads); i++ {
+		if gap := downloads[i].Sub(downloads[i-1]); gap < 10*time.Millisecond {
+			t.Errorf("requests %d and %d started %v apart, want about 20ms", i-1, i, gap)
+		}
+	}
+
+	results, err = NewDownloader().DownloadTree(context.Background(), server.URL+"/pub/", t.TempDir(),
+		&TreeOptions{IgnoreRobots: true})
+	if err != nil || len(results) != 3 {
+		t.Errorf("DownloadTree() ignoring robots.txt = %+v, %v, want 3 files", results, err)
+	}
+}
+
+func TestExpandGlob(t *testing.T) {
+	jobs, err := ExpandGlob("https://{www,cdn}.example.com/img[1-2].png?v=1", "out/#1-#2.png", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"https://www.example.com/img1.png?v=1": "out/www-1.png",
+		"https://www.example.com/img2.png?v=1": "out/www-2.png",
+		"https://cdn.example.com/img1.png?v=1": "out/cdn-1.png",
+		"https://cdn.example.com/img2.png?v=1": "out/cdn-2.png",
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("ExpandGlob() = %d jobs, want %d", len(jobs), len(want))
+	}
+	for _, job := range jobs {
+		if job.ID != job.URL || want[job.URL] != job.Destination {
+			t.Errorf("job = %+v", job)
+		}
+	}
+
+	// Without a template, files are named after the URL
+	jobs, err = ExpandGlob("https://example.com/{a,b}.zip#top", "", 0)
+	if err != nil || len(jobs) != 2 || jobs[0].Destination != "a.zip" || jobs[1].Destination != "b.zip" {
+		t.Errorf("ExpandGlob() = %+v, %v", jobs, err)
+	}
+
+	// Colliding destinations are rejected
+	if _, err := ExpandGlob("https://{a,b}.example.com/file.zip", "", 0); err == nil {
+		t.Error("ExpandGlob() should reject URLs saved to the same file")
+	}
+
+	if _, err := ExpandGlob("https://example.com/[1-", "", 0); err == nil {
+		t.Error("ExpandGlob() should reject a malformed pattern")
+	}
+
+	if _, err := ExpandGlob("https://example.com/[1-20]", "#1", 10); err == nil {
+		t.Error("ExpandGlob() should enforce the URL limit")
+	}
+
+	// Output template variables are filled in after #1... are replaced
+	jobs, err = ExpandGlob("https://{eu,us}.example.com/data/report", "#1/{path}/{index:2}-{name}.csv", 0)
+	if err != nil || len(jobs) != 2 || jobs[1].Destination != filepath.FromSlash("us/data/02-report.csv") {
+		t.Errorf("ExpandGlob(template) = %+v, %v", jobs, err)
+	}
+
+	if _, err := ExpandGlob("https://example.com/[1-2].txt", "{nope}", 0); err == nil {
+		t.Error("ExpandGlob() should reject an unknown template variable")
+	}
+}
+
+func TestExpandOutputTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+	}))
+	defer server.Close()
+
+	host := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+
+	got, err := ExpandOutputTemplate(context.Background(), "{host}/{path}/{filename}", server.URL+"/v1/export")
+	if want := filepath.FromSlash(host + "/v1/export.csv"); err != nil || got != want {
+		t.Errorf("ExpandOutputTemplate() = %q, %v, want %q", got, err, want)
+	}
+
+	jobs, err := NewDownloader().ResolveGlob(context.Background(), server.URL+"/export[1-2]", &GlobOptions{Output: "{filename}"})
+	if err != nil || len(jobs) != 2 || jobs[0].Destination != "export1.csv" {
+		t.Errorf("ResolveGlob() = %+v, %v", jobs, err)
+	}
+}
+
+func TestDownloadGlob(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file03.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dest := t.TempDir()
+	results, err := NewDownloader().DownloadGlob(context.Background(), server.URL+"/file[01-03].txt",
+		&GlobOptions{Output: filepath.Join(dest, "#1.txt"), Options: &Options{CreateDirs: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("DownloadGlob() = %+v, want 3 results", results)
+	}
+
+	for _, n := range []string{"01", "02"} {
+		content, err := os.ReadFile(filepath.Join(dest, n+".txt")) // #nosec G304 -- test file
+		if err != nil || string(content) != "content of /file"+n+".txt" {
+			t.Errorf("%s.txt = %q, %v", n, content, err)
+		}
+	}
+
+	for _, result := range results {
+		wantState := scheduler.StateSucceeded
+		if strings.HasSuffix(result.ID, "/file03.txt") {
+			wantState = scheduler.StateFailed
+		}
+		if result.State != wantState {
+			t.Errorf("%s: state = %s, want %s", result.ID, result.State, wantState)
+		}
+	}
+}
+
+func TestBatchJobOptions(t *testing.T) {
+	if got := batchJobOptions(nil, &BatchOptions{}); got != nil {
+		t.Errorf("batchJobOptions(nil, 0) = %+v, want nil", got)
+	}
+
+	opts := &Options{MaxConcurrency: 8, UserAgent: "agent"}
+	got := batchJobOptions(opts, &BatchOptions{MaxConnectionsPerHost: 3})
+	if got.MaxConcurrency != 3 || got.UserAgent != "agent" || opts.MaxConcurrency != 8 {
+		t.Errorf("batchJobOptions() = %+v, want a copy limited to 3 connections", got)
+	}
+
+	if got.MaxConnectionsPerHost != 3 {
+		t.Errorf("batchJobOptions().MaxConnectionsPerHost = %d, want 3", got.MaxConnectionsPerHost)
+	}
+
+	if got := batchJobOptions(nil, &BatchOptions{MaxConnectionsPerHost: 2}); got.MaxConcurrency != 2 {
+		t.Errorf("batchJobOptions(nil, 2).MaxConcurrency = %d, want 2", got.MaxConcurrency)
+	}
+
+	got = batchJobOptions(&Options{HostDelay: time.Second}, &BatchOptions{HostDelay: time.Millisecond})
+	if got.HostDelay != time.Second || got.MaxConcurrency != 0 {
+		t.Errorf("batchJobOptions() = %+v, want the longer delay and no connection cap", got)
+	}
+}
+
 func TestNewDownloader(t *testing.T) {
 	downloader := NewDownloader()
 	if downloader == nil {
@@ -471,6 +1032,88 @@ func TestProgressCallback(t *testing.T) {
 	}
 }
 
+func TestProgressSmoothedSpeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		w.WriteHeader(http.StatusOK)
+
+		for range 4 {
+			_, _ = w.Write(make([]byte, 1024))
+			w.(http.Flusher).Flush()
+			time.Sleep(150 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	var (
+		mu       sync.Mutex
+		smoothed bool
+		eta      bool
+	)
+	opts := &Options{
+		SpeedWindow: time.Second,
+		ProgressCallback: func(p Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if p.SmoothedSpeed > 0 && p.InstantSpeed > 0 {
+				smoothed = true
+			}
+			if p.BytesDownloaded < p.TotalSize && p.TimeRemaining > 0 {
+				eta = true
+			}
+		},
+	}
+
+	dest := filepath.Join(t.TempDir(), "smoothed.bin")
+	if _, err := DownloadWithOptions(context.Background(), server.URL, dest, opts); err != nil {
+		t.Fatalf("DownloadWithOptions() error = %v", err)
+	}
+
+	if !smoothed || !eta {
+		t.Errorf("progress reported smoothed speed = %v, time remaining = %v", smoothed, eta)
+	}
+}
+
+func TestProgressInterval(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No Content-Length: only the end of the download marks completion
+		for range 50 {
+			_, _ = w.Write(make([]byte, 512))
+			w.(http.Flusher).Flush()
+			time.Sleep(2 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	var (
+		mu    sync.Mutex
+		calls []Progress
+	)
+	opts := &Options{
+		ProgressInterval: time.Hour,
+		ProgressCallback: func(p Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, p)
+		},
+	}
+
+	dest := filepath.Join(t.TempDir(), "throttled.bin")
+	if _, err := DownloadWithOptions(context.Background(), server.URL, dest, opts); err != nil {
+		t.Fatalf("DownloadWithOptions() error = %v", err)
+	}
+
+	// The first update and the guaranteed final one
+	if len(calls) != 2 {
+		t.Fatalf("callback called %d times, want 2", len(calls))
+	}
+
+	if final := calls[len(calls)-1]; final.BytesDownloaded != 50*512 {
+		t.Errorf("final BytesDownloaded = %d, want %d", final.BytesDownloaded, 50*512)
+	}
+}
+
 func TestDownloadWithMaxRate(t *testing.T) {
 	// Create a server that serves data in small chunks over time
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -604,15 +1247,14 @@ func TestDownloadWithOptionsComprehensive(t *testing.T) {
 	t.Run("with all options set", func(t *testing.T) {
 		var progressCalls []Progress
 		opts := &Options{
-			Timeout:           10 * time.Second,
-			UserAgent:         "test-agent",
-			MaxConcurrency:    2,
-			ChunkSize:         1024,
-			EnableResume:      true,
-			CreateDirs:        true,
-			OverwriteExisting: true,
-			MaxRate:           1024, // 1KB/s
-			Headers:           map[string]string{"X-Test": "value"},
+			Timeout:        10 * time.Second,
+			UserAgent:      "test-agent",
+			MaxConcurrency: 2,
+			ChunkSize:      1024,
+			EnableResume:   true,
+			CreateDirs:     true,
+			MaxRate:        1024, // 1KB/s
+			Headers:        map[string]string{"X-Test": "value"},
 			ProgressCallback: func(p Progress) {
 				progressCalls = append(progressCalls, p)
 			},
@@ -745,6 +1387,164 @@ func TestUseMiddleware(t *testing.T) {
 	}
 }
 
+// TestUseRequestMiddleware tests that request middleware sees each HTTP request
+func TestUseRequestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Signed") != "yes" {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("test content"))
+	}))
+	defer server.Close()
+
+	var requests atomic.Int32
+
+	downloader := NewDownloader()
+	downloader.UseRequestMiddleware(
+		middleware.RequestHeaderMiddleware(map[string]string{"X-Signed": "yes"}),
+		func(next http.RoundTripper) http.RoundTripper {
+			return middleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				requests.Add(1)
+				return next.RoundTrip(req)
+			})
+		},
+	)
+
+	dest := filepath.Join(t.TempDir(), "file.txt")
+	if _, err := downloader.Download(context.Background(), server.URL, dest, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if requests.Load() == 0 {
+		t.Error("request middleware was not called")
+	}
+}
+
+// upperStream is a streaming transform that upper-cases its input.
+type upperStream struct {
+	fail bool
+}
+
+func (u *upperStream) Name() string                                           { return "upper" }
+func (u *upperStream) Version() string                                        { return "1.0.0" }
+func (u *upperStream) Init(config map[string]interface{}) error               { return nil }
+func (u *upperStream) Close() error                                           { return nil }
+func (u *upperStream) ValidateAccess(operation string, resource string) error { return nil }
+
+func (u *upperStream) TransformStream(ctx context.Context, input io.Reader, output io.Writer) error {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return err
+	}
+	if u.fail {
+		return io.ErrUnexpectedEOF
+	}
+	_, err = output.Write(bytes.ToUpper(data))
+	return err
+}
+
+// TestUseTransform tests that downloads stream through the transforms
+func TestUseTransform(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("test content"))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.UseTransform(&upperStream{})
+
+	dest := filepath.Join(t.TempDir(), "file.txt")
+	if _, err := downloader.Download(context.Background(), server.URL, dest, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil || string(data) != "TEST CONTENT" {
+		t.Errorf("file = %q, %v, want TEST CONTENT", data, err)
+	}
+
+	if _, err := downloader.Download(context.Background(), server.URL, dest, nil); err == nil {
+		t.Error("Download() over an existing file without OverwriteExisting should fail")
+	}
+
+	var buf bytes.Buffer
+	if _, err := downloader.DownloadToWriter(context.Background(), server.URL, &buf, nil); err != nil {
+		t.Fatalf("DownloadToWriter() error = %v", err)
+	}
+	if buf.String() != "TEST CONTENT" {
+		t.Errorf("DownloadToWriter() wrote %q, want TEST CONTENT", buf.String())
+	}
+
+	failing := NewDownloader()
+	failing.UseTransform(&upperStream{fail: true})
+
+	failedDest := filepath.Join(t.TempDir(), "failed.txt")
+	if _, err := failing.Download(context.Background(), server.URL, failedDest, nil); err == nil {
+		t.Fatal("Download() with a failing transform should fail")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(failedDest)); len(entries) != 0 {
+		t.Errorf("failed transform left %d files, want 0", len(entries))
+	}
+}
+
+// TestDownloaderDownloadAppliesMiddleware tests that Download runs through the middleware chain
+func TestDownloaderDownloadAppliesMiddleware(t *testing.T) {
+	var gotHeader atomic.Value
+	gotHeader.Store("")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if value := r.Header.Get("X-Middleware"); value != "" {
+			gotHeader.Store(value)
+		}
+		_, _ = w.Write([]byte("test content"))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.UseMiddleware(func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req *middleware.DownloadRequest) (*middleware.DownloadResponse, error) {
+			req.Headers["X-Middleware"] = "applied"
+			return next(ctx, req)
+		}
+	})
+
+	dest := filepath.Join(t.TempDir(), "file.txt")
+
+	stats, err := downloader.Download(context.Background(), server.URL, dest, &Options{EnableResume: true})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if !stats.Success {
+		t.Error("Download() should succeed")
+	}
+
+	if got := gotHeader.Load().(string); got != "applied" {
+		t.Errorf("X-Middleware header = %q, want %q", got, "applied")
+	}
+
+	// A middleware can answer without reaching the network
+	downloader = NewDownloader()
+	downloader.UseMiddleware(func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req *middleware.DownloadRequest) (*middleware.DownloadResponse, error) {
+			return &middleware.DownloadResponse{
+				Stats:  &types.DownloadStats{URL: req.URL, BytesDownloaded: 42, Success: true},
+				Cached: true,
+			}, nil
+		}
+	})
+
+	stats, err = downloader.Download(context.Background(), "http://example.com/file", dest, nil)
+	if err != nil {
+		t.Fatalf("Download() with short-circuit middleware error = %v", err)
+	}
+
+	if stats.BytesDownloaded != 42 {
+		t.Errorf("BytesDownloaded = %d, want 42", stats.BytesDownloaded)
+	}
+}
+
 // TestOn tests the On event listener registration
 func TestOn(t *testing.T) {
 	downloader := NewDownloader()
@@ -797,3 +1597,243 @@ func TestDownloaderMethodChaining(t *testing.T) {
 		t.Error("Expected middleware to remain initialized after chaining")
 	}
 }
+
+func TestValidateScanOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *types.ScanOptions
+		wantErr bool
+	}{
+		{"clamd", &types.ScanOptions{Clamd: "localhost:3310"}, false},
+		{"command deleted", &types.ScanOptions{Command: "clamscan", Action: types.ScanActionDelete}, false},
+		{"quarantine", &types.ScanOptions{Clamd: "localhost:3310", Action: types.ScanActionQuarantine, QuarantineDir: "/q"}, false},
+		{"no scanner", &types.ScanOptions{Command: "  "}, true},
+		{"quarantine without dir", &types.ScanOptions{Clamd: "localhost:3310", Action: types.ScanActionQuarantine}, true},
+		{"unknown action", &types.ScanOptions{Clamd: "localhost:3310", Action: "ignore"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateScanOptions(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateScanOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateByteRange(t *testing.T) {
+	first := &types.ByteRange{Start: 0, End: 1023}
+
+	tests := []struct {
+		name    string
+		options *Options
+		wantErr bool
+	}{
+		{"no range", &Options{EnableResume: true}, false},
+		{"range", &Options{ByteRange: first}, false},
+		{"suffix", &Options{ByteRange: &types.ByteRange{Start: -100, End: -1}}, false},
+		{"end before start", &Options{ByteRange: &types.ByteRange{Start: 10, End: 5}}, true},
+		{"with resume", &Options{ByteRange: first, EnableResume: true}, true},
+		{"with timestamping", &Options{ByteRange: first, OnlyIfNewer: true}, true},
+		{"with content store", &Options{ByteRange: first, ContentStore: &types.ContentStoreOptions{Dir: "/cas"}}, true},
+		{"with delta update", &Options{ByteRange: first, Delta: &types.DeltaOptions{Control: "file.zsync"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateByteRange(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateByteRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloadWithOptionsByteRange(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "slice.bin")
+
+	stats, err := DownloadWithOptions(context.Background(), server.URL+"/file.bin", dest, &Options{
+		ByteRange: &types.ByteRange{Start: -5, End: -1},
+	})
+	if err != nil {
+		t.Fatalf("DownloadWithOptions() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(dest) // #nosec G304 -- test file
+	if string(got) != "fghij" || stats.BytesDownloaded != 5 {
+		t.Errorf("content = %q (%d bytes), want %q", got, stats.BytesDownloaded, "fghij")
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *Options
+		wantErr bool
+	}{
+		{"default", &Options{}, false},
+		{"post with body", &Options{Method: "POST", Body: []byte("{}")}, false},
+		{"custom method", &Options{Method: "PROPFIND"}, false},
+		{"invalid method", &Options{Method: "GET ME"}, true},
+		{"body and body file", &Options{Body: []byte("{}"), BodyFile: "query.json"}, true},
+		{"get with timestamping", &Options{Method: "GET", OnlyIfNewer: true}, false},
+		{"post with timestamping", &Options{Method: "POST", OnlyIfNewer: true}, true},
+		{"body with content store", &Options{Body: []byte("{}"), ContentStore: &types.ContentStoreOptions{Dir: "/cas"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRequest(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloadWithOptionsPost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + " " + string(body)))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "export.txt")
+
+	_, err := DownloadWithOptions(context.Background(), server.URL+"/export", dest, &Options{
+		Method: "POST",
+		Body:   []byte(`{"format":"csv"}`),
+	})
+	if err != nil {
+		t.Fatalf("DownloadWithOptions() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(dest) // #nosec G304 -- test file
+	if want := `POST {"format":"csv"}`; string(got) != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadBatchCollisionPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("new"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(dest, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	job := func(id, policy string) BatchJob {
+		return BatchJob{
+			ID:          id,
+			URL:         server.URL + "/report.pdf",
+			Destination: dest,
+			Options:     &Options{CollisionPolicy: policy},
+		}
+	}
+
+	d := NewDownloader()
+	results, err := d.DownloadBatch(context.Background(), []BatchJob{
+		job("skip", types.CollisionSkip),
+		job("rename", types.CollisionRename),
+		job("fail", types.CollisionFail),
+	}, &BatchOptions{MaxParallelJobs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := results[0].Stats; results[0].Error != nil || stats == nil || !stats.Skipped {
+		t.Errorf("skip job = %+v, want a skipped download", results[0])
+	}
+
+	renamed := filepath.Join(dir, "report-1.pdf")
+	if stats := results[1].Stats; results[1].Error != nil || stats == nil || stats.Filename != renamed {
+		t.Errorf("rename job = %+v, want a download to %s", results[1], renamed)
+	}
+	if got, _ := os.ReadFile(renamed); string(got) != "new" { // #nosec G304 -- test file
+		t.Errorf("renamed file = %q, want %q", got, "new")
+	}
+
+	if results[2].State != scheduler.StateFailed {
+		t.Errorf("fail job state = %s, want %s", results[2].State, scheduler.StateFailed)
+	}
+
+	if got, _ := os.ReadFile(dest); string(got) != "old" { // #nosec G304 -- test file
+		t.Errorf("existing file = %q, want it kept", got)
+	}
+
+	if _, err := d.Download(context.Background(), server.URL, dest,
+		&Options{CollisionPolicy: types.CollisionSkip, OnlyIfNewer: true}); err == nil {
+		t.Error("Download() with a collision policy and OnlyIfNewer should fail")
+	}
+	if _, err := d.Download(context.Background(), server.URL, dest, &Options{CollisionPolicy: "clobber"}); err == nil {
+		t.Error("Download() with an unknown collision policy should fail")
+	}
+}
+
+func TestDownloaderDownloadStream(t *testing.T) {
+	media := []byte("init|seg1|seg2|")
+	var failed atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/master.m3u8":
+			_, _ = w.Write([]byte("#EXTM3U\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=500000,RESOLUTION=640x360\nlow.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1920x1080\nhigh.m3u8\n"))
+		case "/low.m3u8":
+			_, _ = w.Write([]byte("#EXTM3U\n#EXT-X-MAP:URI=\"media.mp4\",BYTERANGE=\"5@0\"\n" +
+				"#EXTINF:4,\n#EXT-X-BYTERANGE:5@5\nmedia.mp4\n" +
+				"#EXTINF:3,\n#EXT-X-BYTERANGE:5\nmedia.mp4\n#EXT-X-ENDLIST\n"))
+		case "/media.mp4":
+			// The first request fails once, to be retried
+			if failed.CompareAndSwap(false, true) {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			http.ServeContent(w, r, "media.mp4", time.Time{}, bytes.NewReader(media))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	d := NewDownloader()
+	dest := filepath.Join(t.TempDir(), "video.mp4")
+	opts := &StreamOptions{MaxHeight: 720, Options: &Options{Headers: map[string]string{"X-Token": "secret"}}}
+
+	result, err := d.DownloadStream(context.Background(), server.URL+"/master.m3u8", dest, opts)
+	if err != nil {
+		t.Fatalf("DownloadStream() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(dest) // #nosec G304 -- test file
+	if string(got) != string(media) {
+		t.Errorf("content = %q, want %q", got, media)
+	}
+	if result.Format != "hls" || result.Segments != 2 || result.Duration != 7*time.Second {
+		t.Errorf("DownloadStream() result = %+v", result)
+	}
+
+	if _, err := d.DownloadStream(context.Background(), server.URL+"/master.m3u8", dest, opts); err == nil {
+		t.Error("DownloadStream() over an existing file should fail")
+	}
+	if _, err := d.DownloadStream(context.Background(), server.URL+"/missing.m3u8", dest+".2", opts); err == nil {
+		t.Error("DownloadStream() of a missing playlist should fail")
+	}
+}
@@ -0,0 +1,17 @@
+// Package benchmarks holds the end-to-end transfer benchmarks of gdl: a
+// single stream against chunked and multi-source downloads, copy buffer
+// sizes, and the writers a download can be written to. The downloads go to
+// a local test server, so the results measure gdl's own overhead rather than
+// the network.
+//
+// Run them with
+//
+//	make bench
+//
+// which writes bench.txt in the format benchstat compares:
+//
+//	benchstat old.txt bench.txt
+//
+// Sub-benchmark names stay the same between releases so that results of
+// different commits line up.
+package benchmarks
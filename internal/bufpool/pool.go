@@ -0,0 +1,116 @@
+// Package bufpool provides the read buffers shared by the single-stream and
+// chunked download paths.
+//
+// Buffers are kept in sync.Pools by power-of-two size class, so downloads with
+// different chunk sizes share a bounded number of pools and high-concurrency
+// downloads reuse buffers instead of allocating one per request.
+package bufpool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	// DefaultSize is the buffer size used when no chunk size is configured.
+	DefaultSize = 32 * 1024
+
+	// MinSize and MaxSize bound the pooled buffer sizes. Larger requests are
+	// served with a one-off allocation that is not retained.
+	MinSize = 4 * 1024
+	MaxSize = 16 * 1024 * 1024
+
+	minClass = 12 // log2(MinSize)
+	maxClass = 24 // log2(MaxSize)
+)
+
+// Pool hands out byte buffers from size-classed sync.Pools.
+type Pool struct {
+	classes [maxClass - minClass + 1]sync.Pool
+}
+
+// Default is the pool shared by all downloads.
+var Default = New()
+
+// New creates an empty pool.
+func New() *Pool {
+	p := &Pool{}
+
+	for i := range p.classes {
+		size := 1 << (minClass + i)
+		p.classes[i].New = func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		}
+	}
+
+	return p
+}
+
+// SizeFor returns the buffer size for a download with the given chunk size:
+// DefaultSize when unset, otherwise the chunk size clamped to MinSize.
+func SizeFor(chunkSize int64) int {
+	switch {
+	case chunkSize <= 0:
+		return DefaultSize
+	case chunkSize < MinSize:
+		return MinSize
+	case chunkSize > int64(^uint(0)>>1):
+		return int(^uint(0) >> 1)
+	default:
+		return int(chunkSize)
+	}
+}
+
+// Get returns a buffer of exactly size bytes. The handle must be passed back
+// to Put once the buffer is no longer used.
+func (p *Pool) Get(size int) *[]byte {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	class, ok := classFor(size)
+	if !ok {
+		buf := make([]byte, size)
+		return &buf
+	}
+
+	bufp := p.classes[class].Get().(*[]byte)
+	*bufp = (*bufp)[:size]
+
+	return bufp
+}
+
+// Put returns a buffer obtained from Get to the pool. Buffers that do not
+// belong to a size class are dropped.
+func (p *Pool) Put(bufp *[]byte) {
+	if bufp == nil {
+		return
+	}
+
+	size := cap(*bufp)
+	if size&(size-1) != 0 {
+		return
+	}
+
+	class, ok := classFor(size)
+	if !ok {
+		return
+	}
+
+	*bufp = (*bufp)[:size]
+	p.classes[class].Put(bufp)
+}
+
+// classFor returns the index of the smallest size class holding size bytes.
+func classFor(size int) (int, bool) {
+	if size > MaxSize {
+		return 0, false
+	}
+
+	if size <= MinSize {
+		return 0, true
+	}
+
+	return bits.Len(uint(size-1)) - minClass, true
+}
@@ -0,0 +1,157 @@
+package bufpool
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestSizeFor(t *testing.T) {
+	tests := []struct {
+		chunkSize int64
+		want      int
+	}{
+		{0, DefaultSize},
+		{-1, DefaultSize},
+		{100, MinSize},
+		{64 * 1024, 64 * 1024},
+		{3 * 1024 * 1024, 3 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		if got := SizeFor(tt.chunkSize); got != tt.want {
+			t.Errorf("SizeFor(%d) = %d, want %d", tt.chunkSize, got, tt.want)
+		}
+	}
+}
+
+func TestPool_GetPut(t *testing.T) {
+	pool := New()
+
+	for _, size := range []int{1, MinSize, MinSize + 1, 100 * 1024, MaxSize} {
+		bufp := pool.Get(size)
+		if len(*bufp) != size {
+			t.Errorf("Get(%d) len = %d", size, len(*bufp))
+		}
+
+		if c := cap(*bufp); c < size || c&(c-1) != 0 {
+			t.Errorf("Get(%d) cap = %d, want a power of two >= size", size, c)
+		}
+
+		pool.Put(bufp)
+	}
+
+	// Oversized buffers are allocated exactly and not retained
+	bufp := pool.Get(MaxSize + 1)
+	if len(*bufp) != MaxSize+1 {
+		t.Errorf("Get(MaxSize+1) len = %d", len(*bufp))
+	}
+
+	pool.Put(bufp)
+	pool.Put(nil)
+
+	if got := pool.Get(0); len(*got) != DefaultSize {
+		t.Errorf("Get(0) len = %d, want %d", len(*got), DefaultSize)
+	}
+}
+
+func TestPool_Reuse(t *testing.T) {
+	pool := New()
+
+	bufp := pool.Get(50 * 1024)
+	(*bufp)[0] = 42
+	pool.Put(bufp)
+
+	// sync.Pool may drop items, e.g. under the race detector, so only check
+	// that a reused buffer keeps its full capacity
+	again := pool.Get(64 * 1024)
+	if len(*again) != 64*1024 || cap(*again) != 64*1024 {
+		t.Errorf("Get() after Put() len, cap = %d, %d", len(*again), cap(*again))
+	}
+}
+
+func TestPool_Concurrent(t *testing.T) {
+	pool := New()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				bufp := pool.Get(32 * 1024)
+				for k := range *bufp {
+					(*bufp)[k] = byte(id)
+				}
+
+				for _, b := range *bufp {
+					if b != byte(id) {
+						t.Error("buffer shared between goroutines")
+						return
+					}
+				}
+
+				pool.Put(bufp)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// BenchmarkChunkWorkers simulates 32 chunk workers each taking a read buffer
+// per range request, with and without the pool. Compare allocs/op and the
+// reported GC cycles.
+func BenchmarkChunkWorkers(b *testing.B) {
+	const (
+		workers    = 32
+		bufferSize = 256 * 1024
+	)
+
+	run := func(b *testing.B, get func() *[]byte, put func(*[]byte)) {
+		var before, after runtime.MemStats
+
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			var wg sync.WaitGroup
+
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					bufp := get()
+					(*bufp)[0] = 1
+					put(bufp)
+				}()
+			}
+
+			wg.Wait()
+		}
+
+		b.StopTimer()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gc/op")
+	}
+
+	b.Run("Pooled", func(b *testing.B) {
+		pool := New()
+		run(b, func() *[]byte { return pool.Get(bufferSize) }, pool.Put)
+	})
+
+	b.Run("Make", func(b *testing.B) {
+		run(b, func() *[]byte {
+			buf := make([]byte, bufferSize)
+			return &buf
+		}, func(*[]byte) {})
+	})
+}
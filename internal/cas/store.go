@@ -0,0 +1,260 @@
+// Package cas implements a content-addressable store for downloaded files.
+//
+// Files are stored under their SHA-256 digest, and an index maps a URL and
+// the ETag it was served with to the digest of its content, so identical
+// content can be reused instead of being downloaded again.
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/forest6511/gdl/internal/checksum"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// indexEntry records the content a URL was served with.
+type indexEntry struct {
+	URL    string `json:"url"`
+	ETag   string `json:"etag"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Store is a content-addressable store rooted at a directory.
+type Store struct {
+	dir string
+}
+
+// Open opens (creating if needed) the store in dir.
+func Open(dir string) (*Store, error) {
+	for _, sub := range []string{"objects", "urls"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+			return nil, gdlerrors.NewStorageError("create content store", err, dir)
+		}
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// NormalizeHash validates a hex encoded SHA-256 digest and returns it in
+// lower case.
+func NormalizeHash(hash string) (string, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+		return "", gdlerrors.NewValidationError("sha256",
+			fmt.Sprintf("invalid SHA-256 digest %q: expected 64 hex characters", hash))
+	}
+
+	return hash, nil
+}
+
+// ObjectPath returns where the content with the given digest is stored.
+func (s *Store) ObjectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash)
+}
+
+// Has reports whether the store holds the content with the given digest.
+func (s *Store) Has(hash string) bool {
+	if len(hash) != 2*sha256.Size {
+		return false
+	}
+
+	info, err := os.Stat(s.ObjectPath(hash))
+
+	return err == nil && info.Mode().IsRegular()
+}
+
+// indexPath returns the index file for a URL and ETag.
+func (s *Store) indexPath(url, etag string) string {
+	sum := sha256.Sum256([]byte(url + "\x00" + etag))
+	return filepath.Join(s.dir, "urls", hex.EncodeToString(sum[:])+".json")
+}
+
+// strongETag reports whether etag identifies the content it was served with.
+// Weak ETags ("W/...") only promise semantic equivalence, so the store never
+// indexes them.
+func strongETag(etag string) bool {
+	return etag != "" && !strings.HasPrefix(etag, "W/")
+}
+
+// Lookup returns the digest of the content url was served with under etag.
+// Weak ETags are never found.
+func (s *Store) Lookup(url, etag string) (string, bool) {
+	if !strongETag(etag) {
+		return "", false
+	}
+
+	data, err := os.ReadFile(s.indexPath(url, etag))
+	if err != nil {
+		return "", false
+	}
+
+	var entry indexEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url || entry.ETag != etag {
+		return "", false
+	}
+
+	return entry.SHA256, s.Has(entry.SHA256)
+}
+
+// Add copies the file at path into the store and returns its digest. When
+// etag is a strong ETag, url is indexed so later requests for the same version
+// find it.
+func (s *Store) Add(path, url, etag string) (string, error) {
+	hash, err := checksum.File(path, checksum.SHA256)
+	if err != nil {
+		return "", gdlerrors.NewStorageError("hash file", err, path)
+	}
+
+	if err := s.AddHashed(path, hash, url, etag); err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// AddHashed is Add for a file whose digest the caller has already computed.
+func (s *Store) AddHashed(path, hash, url, etag string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return gdlerrors.NewStorageError("stat file", err, path)
+	}
+	size := info.Size()
+
+	// Content the store already holds is not copied again
+	if !s.Has(hash) {
+		object := s.ObjectPath(hash)
+		if err := os.MkdirAll(filepath.Dir(object), 0o750); err != nil {
+			return gdlerrors.NewStorageError("create content store", err, filepath.Dir(object))
+		}
+
+		tmpPath, err := copyFile(path, filepath.Join(s.dir, "objects"), ".tmp-*")
+		defer func() { _ = os.Remove(tmpPath) }()
+		if err != nil {
+			return gdlerrors.NewStorageError("write store object", err, s.dir)
+		}
+
+		if err := os.Rename(tmpPath, object); err != nil {
+			return gdlerrors.NewStorageError("store object", err, object)
+		}
+	}
+
+	if url != "" && strongETag(etag) {
+		data, err := json.Marshal(indexEntry{URL: url, ETag: etag, SHA256: hash, Size: size})
+		if err != nil {
+			return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "marshal content store index")
+		}
+
+		if err := os.WriteFile(s.indexPath(url, etag), data, 0o600); err != nil {
+			return gdlerrors.NewStorageError("write content store index", err, s.indexPath(url, etag))
+		}
+	}
+
+	return nil
+}
+
+// Materialize places the content with the given digest at destination,
+// replacing any existing file. With hardLink the destination is hard-linked to
+// the stored object when possible, otherwise the object is copied. The object
+// is verified first; a corrupted object is removed and an error returned.
+func (s *Store) Materialize(hash, destination string, hardLink bool) (int64, error) {
+	object := s.ObjectPath(hash)
+
+	if actual, err := checksum.File(object, checksum.SHA256); err != nil {
+		return 0, gdlerrors.NewStorageError("hash file", err, object)
+	} else if actual != hash {
+		return 0, s.corrupted(hash)
+	}
+
+	if hardLink {
+		if size, err := linkFile(object, destination); err == nil {
+			return size, nil
+		}
+	}
+
+	tmpPath, err := copyFile(object, filepath.Dir(destination), "."+filepath.Base(destination)+".tmp-*")
+	defer func() { _ = os.Remove(tmpPath) }()
+	if err != nil {
+		return 0, gdlerrors.NewStorageError("copy store object", err, destination)
+	}
+
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return 0, gdlerrors.NewStorageError("copy store object", err, destination)
+	}
+
+	if err := os.Chmod(tmpPath, 0o644); err != nil {
+		return 0, gdlerrors.NewStorageError("copy store object", err, destination)
+	}
+
+	if err := os.Rename(tmpPath, destination); err != nil {
+		return 0, gdlerrors.NewStorageError("copy store object", err, destination)
+	}
+
+	return info.Size(), nil
+}
+
+// copyFile copies the file at path to a new temporary file in dir, named
+// after pattern as os.CreateTemp does, and returns its path, which is set
+// even when the copy fails. The copy goes from file to file so that the
+// kernel can do it (copy_file_range, or a reflink on filesystems that share
+// extents) instead of reading it through a buffer.
+func copyFile(path, dir, pattern string) (string, error) {
+	// #nosec G304 -- path is a completed download or a store object
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = src.Close() }()
+
+	tmp, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	return tmp.Name(), err
+}
+
+// corrupted drops an object whose content no longer matches its digest.
+func (s *Store) corrupted(hash string) error {
+	_ = os.Remove(s.ObjectPath(hash))
+
+	return gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeCorruptedData,
+		"Content store object is corrupted", fmt.Sprintf("Object %s no longer matches its digest", hash))
+}
+
+// linkFile hard-links object to destination through a temporary name, so an
+// existing destination is replaced atomically.
+func linkFile(object, destination string) (int64, error) {
+	info, err := os.Stat(object)
+	if err != nil {
+		return 0, err
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(destination), "."+filepath.Base(destination)+".link")
+	_ = os.Remove(tmpPath)
+
+	if err := os.Link(object, tmpPath); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmpPath, destination); err != nil {
+		_ = os.Remove(tmpPath)
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
@@ -0,0 +1,158 @@
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNormalizeHash(t *testing.T) {
+	valid := digest("payload")
+
+	got, err := NormalizeHash(" " + strings.ToUpper(valid) + " ")
+	if err != nil || got != valid {
+		t.Errorf("NormalizeHash() = %q, %v, want %q", got, err, valid)
+	}
+
+	for _, invalid := range []string{"", "abc", valid[:62], valid + "00", strings.Repeat("g", 64)} {
+		if _, err := NormalizeHash(invalid); err == nil {
+			t.Errorf("NormalizeHash(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestStore_AddAndLookup(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	hash, err := store.Add(writeFile(t, "payload"), "https://example.com/file", `"v1"`)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if hash != digest("payload") {
+		t.Errorf("Add() = %s, want %s", hash, digest("payload"))
+	}
+
+	if !store.Has(hash) {
+		t.Error("Has() = false after Add()")
+	}
+
+	if got, found := store.Lookup("https://example.com/file", `"v1"`); !found || got != hash {
+		t.Errorf("Lookup() = %q, %v, want %q, true", got, found, hash)
+	}
+
+	if _, found := store.Lookup("https://example.com/file", `"v2"`); found {
+		t.Error("Lookup() should not match a different ETag")
+	}
+
+	if _, found := store.Lookup("https://example.com/file", ""); found {
+		t.Error("Lookup() should not match without an ETag")
+	}
+}
+
+func TestStore_WeakETag(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	hash, err := store.Add(writeFile(t, "payload"), "https://example.com/file", `W/"v1"`)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if !store.Has(hash) {
+		t.Error("content served with a weak ETag should still be stored")
+	}
+
+	if _, found := store.Lookup("https://example.com/file", `W/"v1"`); found {
+		t.Error("Lookup() should not match a weak ETag")
+	}
+}
+
+func TestStore_Materialize(t *testing.T) {
+	for _, hardLink := range []bool{false, true} {
+		name := "copy"
+		if hardLink {
+			name = "hardlink"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			store, err := Open(t.TempDir())
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+
+			hash, err := store.Add(writeFile(t, "payload"), "", "")
+			if err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			dest := filepath.Join(t.TempDir(), "out.bin")
+			if err := os.WriteFile(dest, []byte("old"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			size, err := store.Materialize(hash, dest, hardLink)
+			if err != nil {
+				t.Fatalf("Materialize() error = %v", err)
+			}
+
+			data, _ := os.ReadFile(dest)
+			if string(data) != "payload" || size != int64(len("payload")) {
+				t.Errorf("Materialize() wrote %q (%d bytes), want %q", data, size, "payload")
+			}
+		})
+	}
+}
+
+func TestStore_MaterializeCorrupted(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	hash, err := store.Add(writeFile(t, "payload"), "", "")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if err := os.WriteFile(store.ObjectPath(hash), []byte("tampered"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out.bin")
+	if _, err := store.Materialize(hash, dest, false); err == nil {
+		t.Fatal("Materialize() should fail for a corrupted object")
+	}
+
+	if store.Has(hash) {
+		t.Error("corrupted object should be removed from the store")
+	}
+
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("Materialize() should not leave a corrupted destination behind")
+	}
+}
@@ -0,0 +1,125 @@
+// Package checksum computes the digests downloads are verified with: the
+// standard cryptographic hashes, and BLAKE3 and xxh3 for very large files,
+// where SHA-256 makes hashing rather than the network the bottleneck.
+package checksum
+
+import (
+	"crypto/md5"  // #nosec G501 -- offered for servers that only publish MD5 sums
+	"crypto/sha1" // #nosec G505 -- offered for servers that only publish SHA-1 sums
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zeebo/xxh3"
+	"lukechampine.com/blake3"
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// Supported algorithms.
+const (
+	MD5    = "md5"
+	SHA1   = "sha1"
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+	BLAKE3 = "blake3"
+	XXH3   = "xxh3"
+)
+
+// Algorithms lists the supported algorithms.
+var Algorithms = []string{MD5, SHA1, SHA256, SHA512, BLAKE3, XXH3}
+
+// copyBufferSize is the size of the reads hashed at once. Large reads let
+// BLAKE3 hash many of its 1 KiB chunks in parallel with SIMD.
+const copyBufferSize = 1024 * 1024
+
+// constructors create the hash of each algorithm.
+var constructors = map[string]func() hash.Hash{
+	MD5:    md5.New,
+	SHA1:   sha1.New,
+	SHA256: sha256.New,
+	SHA512: sha512.New,
+	BLAKE3: func() hash.Hash { return blake3.New(32, nil) },
+	XXH3:   func() hash.Hash { return xxh3.New() },
+}
+
+// Normalize returns the canonical name of algorithm, accepting any case and
+// the spellings "sha-256", "xxh3-64" and "b3"; "" is SHA256.
+func Normalize(algorithm string) (string, error) {
+	name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(algorithm)), "-", "")
+
+	switch name {
+	case "":
+		return SHA256, nil
+	case "b3":
+		return BLAKE3, nil
+	case "xxh364", "xxh3_64":
+		return XXH3, nil
+	}
+
+	if _, ok := constructors[name]; !ok {
+		return "", errors.NewValidationError("checksum_algorithm",
+			fmt.Sprintf("unsupported algorithm %q (supported: %s)", algorithm, strings.Join(Algorithms, ", ")))
+	}
+
+	return name, nil
+}
+
+// New returns a hash of algorithm, which is normalized first.
+func New(algorithm string) (hash.Hash, error) {
+	name, err := Normalize(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return constructors[name](), nil
+}
+
+// NormalizeDigest checks that digest is a hex encoded digest of algorithm
+// and returns it in lower case.
+func NormalizeDigest(algorithm, digest string) (string, error) {
+	h, err := New(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != 2*h.Size() {
+		return "", errors.NewValidationError("checksum",
+			fmt.Sprintf("%q is not a %d hex digit digest", digest, 2*h.Size()))
+	}
+
+	return digest, nil
+}
+
+// Reader returns the hex encoded digest of the content of r.
+func Reader(r io.Reader, algorithm string) (string, error) {
+	h, err := New(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.CopyBuffer(h, r, make([]byte, copyBufferSize)); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// File returns the hex encoded digest of the file at path. Errors opening or
+// reading the file are returned as they are, so os.IsNotExist works on them.
+func File(path, algorithm string) (string, error) {
+	// #nosec G304 -- a downloaded file or one listed in a manifest
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	return Reader(file, algorithm)
+}
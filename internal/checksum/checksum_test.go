@@ -0,0 +1,162 @@
+package checksum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	// Digests of the empty input
+	tests := map[string]string{
+		MD5:       "d41d8cd98f00b204e9800998ecf8427e",
+		SHA1:      "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+		"SHA-256": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		SHA512: "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce" +
+			"47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e",
+		BLAKE3: "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262",
+		XXH3:   "2d06800538d394c2",
+	}
+
+	for algorithm, want := range tests {
+		got, err := Reader(bytes.NewReader(nil), algorithm)
+		if err != nil {
+			t.Fatalf("Reader(%s) error = %v", algorithm, err)
+		}
+		if got != want {
+			t.Errorf("Reader(%s) = %s, want %s", algorithm, got, want)
+		}
+
+		if _, err := NormalizeDigest(algorithm, " "+want[:len(want)-2]+"AB"); err != nil {
+			t.Errorf("NormalizeDigest(%s) error = %v", algorithm, err)
+		}
+		if _, err := NormalizeDigest(algorithm, want[2:]); err == nil {
+			t.Errorf("NormalizeDigest(%s) accepted a short digest", algorithm)
+		}
+	}
+
+	if _, err := New("crc32"); err == nil {
+		t.Error("New() accepted an unsupported algorithm")
+	}
+}
+
+func TestTracker(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	content := make([]byte, 3*copyBufferSize+12345)
+	random.Read(content)
+	want := sha256.Sum256(content)
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	tracker, err := NewTracker(file, SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Four writers fill interleaved pieces, each in small writes, half of
+	// them passing the data written
+	const piece = 100000
+
+	var wg sync.WaitGroup
+	for writer := 0; writer < 4; writer++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for start := writer * piece; start < len(content); start += 4 * piece {
+				end := min(start+piece, len(content))
+				for off := start; off < end; off += 4096 {
+					n := min(4096, end-off)
+					if _, err := file.WriteAt(content[off:off+n], int64(off)); err != nil {
+						t.Error(err)
+						return
+					}
+					if writer%2 == 0 {
+						tracker.WrittenData(content[off:off+n], int64(off))
+					} else {
+						tracker.Written(int64(off), int64(n))
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := tracker.Sum(int64(len(content)))
+	if err != nil {
+		t.Fatalf("Sum() error = %v", err)
+	}
+	if got != hex.EncodeToString(want[:]) {
+		t.Errorf("Sum() = %s, want %x", got, want)
+	}
+
+	tracker.Close()
+}
+
+func TestTrackerGap(t *testing.T) {
+	tracker, err := NewTracker(bytes.NewReader(make([]byte, 100)), BLAKE3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracker.Written(0, 40)
+	tracker.Written(50, 50)
+
+	if _, err := tracker.Sum(100); err == nil {
+		t.Error("Sum() should fail when bytes 40-49 were not written")
+	}
+}
+
+// countingReaderAt counts the bytes read from it.
+type countingReaderAt struct {
+	r    *bytes.Reader
+	mu   sync.Mutex
+	read int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+
+	c.mu.Lock()
+	c.read += int64(n)
+	c.mu.Unlock()
+
+	return n, err
+}
+
+func TestTrackerWrittenData(t *testing.T) {
+	content := bytes.Repeat([]byte("gdl"), 1000)
+	want := sha256.Sum256(content)
+	file := &countingReaderAt{r: bytes.NewReader(content)}
+
+	tracker, err := NewTracker(file, SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for off := 0; off < len(content); off += 100 {
+		tracker.WrittenData(content[off:off+100], int64(off))
+	}
+
+	got, err := tracker.Sum(int64(len(content)))
+	if err != nil {
+		t.Fatalf("Sum() error = %v", err)
+	}
+	if got != hex.EncodeToString(want[:]) {
+		t.Errorf("Sum() = %s, want %x", got, want)
+	}
+	if file.read != 0 {
+		t.Errorf("read back %d bytes written in order, want 0", file.read)
+	}
+}
@@ -0,0 +1,194 @@
+package checksum
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// Tracker hashes a file in order while its pieces are written out of order,
+// as those of a chunked download are. Writes reported with WrittenData that
+// continue the hashed data are hashed from memory as they come. A goroutine
+// reads back and hashes the rest of what has been written contiguously from
+// the start, which is usually still in the page cache, so the digest is
+// ready soon after the last piece is written, instead of after reading the
+// whole file again.
+type Tracker struct {
+	r    io.ReaderAt
+	hash hash.Hash
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	frontier int64           // End of the data written from the start
+	starts   map[int64]int64 // Written ranges past frontier, start to end
+	ends     map[int64]int64 // The same ranges, end to start
+	hashed   int64           // End of the data hashed
+	reading  bool            // The goroutine is hashing data read back
+	final    bool            // No more writes; hash up to frontier and stop
+	stopped  bool
+	err      error
+
+	done chan struct{}
+}
+
+// NewTracker starts hashing the content written to r with algorithm. The
+// caller reports each write with Written and ends with Sum or Close.
+func NewTracker(r io.ReaderAt, algorithm string) (*Tracker, error) {
+	h, err := New(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tracker{
+		r:      r,
+		hash:   h,
+		starts: make(map[int64]int64),
+		ends:   make(map[int64]int64),
+		done:   make(chan struct{}),
+	}
+	t.cond = sync.NewCond(&t.mu)
+
+	go t.run()
+
+	return t, nil
+}
+
+// Written records that the n bytes at off hold their final content. Each
+// byte is recorded once.
+func (t *Tracker) Written(off, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.record(off, n)
+}
+
+// WrittenData records that p, written at off, holds its final content, as
+// Written does, hashing it right away when it continues the hashed data so
+// it need not be read back.
+func (t *Tracker) WrittenData(p []byte, off int64) {
+	if len(p) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.reading && t.err == nil && off == t.hashed && t.hashed == t.frontier {
+		_, _ = t.hash.Write(p)
+		t.hashed += int64(len(p))
+	}
+
+	t.record(off, int64(len(p)))
+}
+
+// record adds the n bytes at off to the written ranges and moves frontier
+// past them when they join it. t.mu is held.
+func (t *Tracker) record(off, n int64) {
+	start, end := off, off+n
+
+	// Join the ranges written right before and after this one
+	if s, ok := t.ends[start]; ok {
+		delete(t.ends, start)
+		delete(t.starts, s)
+		start = s
+	}
+	if e, ok := t.starts[end]; ok {
+		delete(t.starts, end)
+		delete(t.ends, e)
+		end = e
+	}
+
+	if start > t.frontier {
+		t.starts[start] = end
+		t.ends[end] = start
+
+		return
+	}
+
+	t.frontier = max(t.frontier, end)
+	t.cond.Broadcast()
+}
+
+// Sum waits until the first size bytes are hashed and returns their hex
+// encoded digest. It fails when some of them were never written.
+func (t *Tracker) Sum(size int64) (string, error) {
+	t.mu.Lock()
+	if t.frontier < size {
+		frontier := t.frontier
+		t.mu.Unlock()
+		t.Close()
+
+		return "", errors.NewDownloadError(errors.CodeCorruptedData,
+			fmt.Sprintf("only %d of %d bytes were written in order", frontier, size))
+	}
+
+	t.final = true
+	t.cond.Broadcast()
+	t.mu.Unlock()
+
+	<-t.done
+
+	if t.err != nil {
+		return "", t.err
+	}
+	if t.hashed != size {
+		return "", errors.NewDownloadError(errors.CodeCorruptedData,
+			fmt.Sprintf("%d bytes were written, expected %d", t.hashed, size))
+	}
+
+	return hex.EncodeToString(t.hash.Sum(nil)), nil
+}
+
+// Close stops hashing and waits for the goroutine to end. It may be called
+// after Sum.
+func (t *Tracker) Close() {
+	t.mu.Lock()
+	t.stopped = true
+	t.cond.Broadcast()
+	t.mu.Unlock()
+
+	<-t.done
+}
+
+// run hashes the data between hashed and frontier whenever frontier moves.
+func (t *Tracker) run() {
+	defer close(t.done)
+
+	buffer := make([]byte, copyBufferSize)
+
+	for {
+		t.mu.Lock()
+		for t.hashed == t.frontier && !t.final && !t.stopped {
+			t.cond.Wait()
+		}
+		start, end, stopped := t.hashed, t.frontier, t.stopped
+		t.reading = !stopped && start != end
+		t.mu.Unlock()
+
+		if stopped || start == end {
+			return
+		}
+
+		if _, err := io.CopyBuffer(t.hash, io.NewSectionReader(t.r, start, end-start), buffer); err != nil {
+			t.mu.Lock()
+			t.err = errors.NewStorageError("hash file", err, "")
+			t.reading = false
+			t.mu.Unlock()
+
+			return
+		}
+
+		t.mu.Lock()
+		t.hashed = end
+		t.reading = false
+		t.mu.Unlock()
+	}
+}
@@ -1,5 +1,7 @@
 package concurrent
 
+import "time"
+
 type ChunkInfo struct {
 	Index      int
 	Start      int64
@@ -15,8 +17,14 @@ type Chunker struct {
 }
 
 const (
-	minChunkSize = 1024 * 1024 // 1MB minimum chunk size
-	maxChunks    = 32          // Maximum number of chunks
+	minChunkSize    = 1024 * 1024 // 1MB minimum chunk size
+	maxChunks       = 32          // Maximum number of chunks
+	streamChunkSize = 1024 * 1024 // Chunk size of stream-order downloads
+	streamLookahead = 8           // Stream-order chunks the workers may fetch at once
+
+	// coalesceDuration is how long one request of a stream-order download
+	// should last; adjacent chunks are fetched together up to it.
+	coalesceDuration = time.Second
 )
 
 // NewChunker creates a new chunker for the given file size.
@@ -30,6 +38,18 @@ func NewChunker(fileSize int64) *Chunker {
 	return c
 }
 
+// NewStreamChunker creates a chunker that splits the file into chunks of about
+// streamChunkSize bytes, for downloads that fetch the file in order.
+func NewStreamChunker(fileSize int64) *Chunker {
+	c := &Chunker{
+		fileSize:   fileSize,
+		chunkCount: int(max((fileSize+streamChunkSize-1)/streamChunkSize, 1)),
+	}
+	c.SplitIntoChunks()
+
+	return c
+}
+
 // CalculateOptimalChunks determines the optimal number of chunks based on file size.
 func (c *Chunker) CalculateOptimalChunks() int {
 	if c.fileSize <= 0 {
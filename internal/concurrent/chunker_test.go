@@ -282,3 +282,22 @@ func TestGetChunks(t *testing.T) {
 		t.Error("GetChunks() should return the same chunk references")
 	}
 }
+
+func TestNewStreamChunker(t *testing.T) {
+	chunks := NewStreamChunker(5 * streamChunkSize / 2).GetChunks()
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+
+	var next int64
+	for i, chunk := range chunks {
+		if chunk.Start != next || chunk.End-chunk.Start+1 > streamChunkSize {
+			t.Errorf("chunk %d = %d-%d", i, chunk.Start, chunk.End)
+		}
+		next = chunk.End + 1
+	}
+
+	if next != 5*streamChunkSize/2 {
+		t.Errorf("chunks end at %d, want the file size", next)
+	}
+}
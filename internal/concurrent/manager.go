@@ -2,14 +2,20 @@ package concurrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/forest6511/gdl/internal/bufpool"
+	"github.com/forest6511/gdl/internal/network"
+	"github.com/forest6511/gdl/internal/resume"
+	"github.com/forest6511/gdl/internal/storage"
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 	"github.com/forest6511/gdl/pkg/progress"
 	"github.com/forest6511/gdl/pkg/ratelimit"
@@ -20,8 +26,22 @@ type ConcurrentDownloadManager struct {
 	workers     []*Worker
 	chunker     *Chunker
 	progressMgr *progress.Manager
+	progress    types.Progress
 	wg          sync.WaitGroup
 	rateLimiter ratelimit.Limiter
+	hostLimiter *network.HostLimiter // Caps and paces the workers' requests (nil = unlimited)
+	ioEngine    string
+	bufferSize  int
+	sparse      bool            // Write chunks in place into a sparse file
+	streamOrder bool            // Fetch small chunks in order, a few at a time
+	maxWorkers  int             // Chunks fetched at once in stream order
+	resume      *resume.Manager // Keeps the chunk map of sparse downloads (nil = no resume)
+
+	cancelChunks context.CancelFunc // Stops all workers of the current download
+	rangeIgnored atomic.Bool        // A chunk's range kept being ignored
+
+	rangeViolations int  // Responses for the wrong range in the last Download
+	rangeFallback   bool // The last Download fell back to a single stream
 }
 
 // NewConcurrentDownloadManager creates a new concurrent download manager.
@@ -39,7 +59,24 @@ func NewConcurrentDownloadManagerWithOptions(options *types.DownloadOptions) *Co
 
 	// Create rate limiter if MaxRate is specified
 	if options != nil && options.MaxRate > 0 {
-		manager.rateLimiter = ratelimit.NewBandwidthLimiter(options.MaxRate)
+		manager.rateLimiter = ratelimit.NewBandwidthLimiterWithBurst(options.MaxRate, options.MaxRateBurst)
+	}
+
+	if options != nil {
+		manager.progress = options.Progress
+		manager.ioEngine = options.IOEngine
+		manager.bufferSize = bufpool.SizeFor(options.ChunkSize)
+		manager.sparse = options.SparseFile
+		manager.streamOrder = options.StreamOrder
+		manager.maxWorkers = options.MaxConcurrency
+
+		if limits := options.HostLimits; limits != nil {
+			manager.hostLimiter = network.NewHostLimiter(limits.MaxConnections, limits.Delay)
+		}
+
+		if options.SparseFile && options.Resume {
+			manager.resume = resume.NewManager(resume.DefaultDir())
+		}
 	}
 
 	return manager
@@ -65,20 +102,62 @@ func (m *ConcurrentDownloadManager) Download(ctx context.Context, url, dest stri
 	}
 
 	// Initialize chunker
-	m.chunker = NewChunker(fileSize)
+	if m.streamOrder {
+		m.chunker = NewStreamChunker(fileSize)
+	} else {
+		m.chunker = NewChunker(fileSize)
+	}
 	chunks := m.chunker.GetChunks()
 
-	// Create temporary directory for chunks
-	tempDir := dest + ".chunks"
-	if err := os.MkdirAll(tempDir, 0o750); err != nil {
-		return gdlerrors.NewStorageError("creating temp directory", err, tempDir)
+	var (
+		destFile *os.File
+		writer   storage.ChunkWriter
+	)
+
+	// Stream-order chunks are written in place, so that the beginning of
+	// the file can be read while the rest is downloading
+	if m.sparse || m.streamOrder {
+		destFile, writer, err = m.openSparseWriter(url, dest, fileSize, chunks)
+	} else {
+		// Reserve space for the merged file up front to fail early on a full disk
+		if err := m.preallocate(dest, fileSize); err != nil {
+			return err
+		}
+
+		// Write chunks in place when an asynchronous I/O engine is available
+		destFile, writer, err = m.openChunkWriter(dest, fileSize)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	tempDir := ""
+
+	if writer == nil {
+		// Create temporary directory for chunks
+		tempDir = dest + ".chunks"
+		if err := os.MkdirAll(tempDir, 0o750); err != nil {
+			return gdlerrors.NewStorageError("creating temp directory", err, tempDir)
+		}
+		defer m.cleanup(tempDir)
+	} else {
+		defer func() { _ = destFile.Close() }()
 	}
-	defer m.cleanup(tempDir)
 
 	// Start progress manager
 	m.progressMgr.Start()
 	defer m.progressMgr.Stop()
 
+	// Workers share a context so that all of them can be stopped when the
+	// server turns out to ignore ranges
+	chunkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m.cancelChunks = cancel
+	m.rangeIgnored.Store(false)
+	m.rangeViolations, m.rangeFallback = 0, false
+
 	// Create channels for worker communication
 	progressChan := make(chan Progress, len(chunks))
 	errorChan := make(chan error, len(chunks))
@@ -91,14 +170,26 @@ func (m *ConcurrentDownloadManager) Download(ctx context.Context, url, dest stri
 		m.workers[i].Progress = progressChan
 		m.workers[i].Error = errorChan
 		m.workers[i].RateLimiter = m.rateLimiter // Share the same rate limiter across all workers
+		m.workers[i].BufferSize = m.bufferSize
+
+		if m.hostLimiter != nil {
+			m.workers[i].Client.Transport = m.hostLimiter.Transport(m.workers[i].Client.Transport)
+		}
 	}
 
+	// Taken before the workers start, as resumed chunks begin part way
+	segments := m.initialSegments()
+
 	// Start workers
-	m.startWorkers(ctx, tempDir)
+	if writer != nil {
+		m.startWorkersAt(chunkCtx, writer, dest)
+	} else {
+		m.startWorkers(chunkCtx, tempDir)
+	}
 
 	// Monitor progress and errors
 	done := make(chan bool)
-	go m.monitorProgress(progressChan, errorChan, done, fileSize)
+	go m.monitorProgress(progressChan, errorChan, done, fileSize, segments)
 
 	// Wait for all workers to complete
 	m.wg.Wait()
@@ -106,6 +197,33 @@ func (m *ConcurrentDownloadManager) Download(ctx context.Context, url, dest stri
 	close(errorChan)
 	<-done
 
+	for _, w := range m.workers {
+		m.rangeViolations += w.rangeViolations
+	}
+
+	if m.rangeIgnored.Load() {
+		// The chunks cannot be trusted; stream the file in one piece instead
+		if writer != nil {
+			_ = writer.Close()
+			_ = destFile.Close()
+		}
+
+		m.workers = nil
+		m.rangeFallback = true
+
+		return m.singleDownload(ctx, url, dest)
+	}
+
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			return err
+		}
+	}
+
+	if m.sparse {
+		m.saveChunkMap(url, dest, fileSize, chunks)
+	}
+
 	// Check if all chunks completed
 	for _, chunk := range chunks {
 		if !chunk.Complete {
@@ -116,6 +234,15 @@ func (m *ConcurrentDownloadManager) Download(ctx context.Context, url, dest stri
 		}
 	}
 
+	if writer != nil {
+		// Drop any previous content beyond the downloaded data
+		if err := destFile.Truncate(fileSize); err != nil {
+			return gdlerrors.NewStorageError("truncating destination file", err, dest)
+		}
+
+		return nil
+	}
+
 	// Merge chunks into final file
 	if err := m.mergeChunks(tempDir, dest, chunks); err != nil {
 		return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "merging chunks")
@@ -132,10 +259,17 @@ func (m *ConcurrentDownloadManager) startWorkers(ctx context.Context, tempDir st
 		go func(w *Worker, chunkFile string) {
 			defer m.wg.Done()
 
+			ctx, serverIP := network.TraceConnection(ctx)
+			start := time.Now()
+
+			defer func() { w.recordStats(start, serverIP()) }()
+
 			// Create chunk file
 			// #nosec G304 -- chunkFile is constructed internally from validated paths
 			file, err := os.Create(chunkFile)
 			if err != nil {
+				w.reportFailure()
+
 				if w.Error != nil {
 					w.Error <- gdlerrors.NewStorageError("creating chunk file", err, chunkFile)
 				}
@@ -150,42 +284,305 @@ func (m *ConcurrentDownloadManager) startWorkers(ctx context.Context, tempDir st
 			downloadErr := w.downloadChunkToFile(ctx, file)
 			if downloadErr != nil {
 				w.ChunkInfo = originalChunk // Restore chunk info
-				if w.Error != nil {
-					w.Error <- downloadErr
-				}
+				m.workerFailed(w, downloadErr)
 			}
 		}(worker, filepath.Join(tempDir, fmt.Sprintf("chunk_%d", i)))
 	}
 }
 
-// downloadChunkToFile downloads a chunk and writes it to a file.
-func (w *Worker) downloadChunkToFile(ctx context.Context, file *os.File) error {
-	// Create range request
-	req, err := http.NewRequestWithContext(ctx, "GET", w.URL, nil)
-	if err != nil {
-		return gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "creating request", w.URL)
+// startWorkersAt launches the workers of all incomplete chunks, writing their
+// chunks directly into the destination through writer. In stream order only
+// maxWorkers chunks are fetched at once, taken in order from the beginning of
+// the file, so the file fills in from its start with a short lookahead.
+func (m *ConcurrentDownloadManager) startWorkersAt(ctx context.Context, writer storage.ChunkWriter, dest string) {
+	if m.streamOrder {
+		m.startStreamWorkers(ctx, writer, dest)
+		return
+	}
+
+	for _, worker := range m.workers {
+		if worker.ChunkInfo.Complete {
+			continue
+		}
+
+		m.wg.Add(1)
+
+		go func(w *Worker) {
+			defer m.wg.Done()
+			m.downloadChunkAt(ctx, w, writer, dest)
+		}(worker)
+	}
+}
+
+// startStreamWorkers fetches the incomplete chunks in order, maxWorkers
+// (default 4) at a time. Adjacent chunks are coalesced into one request as the
+// stream queue allows.
+func (m *ConcurrentDownloadManager) startStreamWorkers(ctx context.Context, writer storage.ChunkWriter, dest string) {
+	workers := m.maxWorkers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	var incomplete []*Worker
+
+	for _, worker := range m.workers {
+		if !worker.ChunkInfo.Complete {
+			incomplete = append(incomplete, worker)
+		}
 	}
 
-	// Set range header
-	rangeStart := w.ChunkInfo.Start + w.ChunkInfo.Downloaded
-	rangeEnd := w.ChunkInfo.End
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", rangeStart, rangeEnd))
+	queue := newStreamQueue(incomplete, workers)
 
-	// Execute request
-	resp, err := w.Client.Do(req)
+	for range min(workers, len(incomplete)) {
+		m.wg.Add(1)
+
+		go func() {
+			defer m.wg.Done()
+
+			for ctx.Err() == nil {
+				run := queue.next()
+				if run == nil {
+					return
+				}
+
+				m.downloadRunAt(ctx, queue, run, writer, dest)
+			}
+		}()
+	}
+}
+
+// streamQueue hands the chunks of a stream-order download to its workers in
+// order. Once requests have shown how fast a connection is, a worker takes the
+// adjacent pending chunks along with the next one, as many as a connection
+// fetches in coalesceDuration, within its share of the lookahead.
+type streamQueue struct {
+	mu      sync.Mutex
+	pending []*Worker
+	share   int64         // Most bytes one request may cover
+	bytes   int64         // Bytes fetched by the finished requests
+	elapsed time.Duration // Time the finished requests took
+}
+
+func newStreamQueue(pending []*Worker, workers int) *streamQueue {
+	return &streamQueue{
+		pending: pending,
+		share:   max(streamLookahead*streamChunkSize/int64(workers), streamChunkSize),
+	}
+}
+
+// next takes the next pending chunk and the adjacent chunks coalesced with it.
+// It returns nil when no chunk is pending.
+func (q *streamQueue) next() []*Worker {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return nil
+	}
+
+	first := q.pending[0].ChunkInfo
+	limit := first.Start + first.Downloaded + q.requestSize()
+	end := first.End
+	n := 1
+
+	for ; n < len(q.pending); n++ {
+		chunk := q.pending[n].ChunkInfo
+		if chunk.Start != end+1 || chunk.Downloaded > 0 || chunk.End >= limit {
+			break
+		}
+
+		end = chunk.End
+	}
+
+	run := append([]*Worker(nil), q.pending[:n]...)
+	q.pending = q.pending[n:]
+
+	return run
+}
+
+// requestSize returns how many bytes one request may cover: what a
+// connection fetched in coalesceDuration so far, within the worker's share of
+// the lookahead. It is 0 until a request has finished.
+func (q *streamQueue) requestSize() int64 {
+	if q.elapsed <= 0 {
+		return 0
+	}
+
+	speed := float64(q.bytes) / q.elapsed.Seconds()
+
+	return min(int64(speed*coalesceDuration.Seconds()), q.share)
+}
+
+// record adds a finished request that fetched bytes in elapsed.
+func (q *streamQueue) record(bytes int64, elapsed time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.bytes += bytes
+	q.elapsed += elapsed
+}
+
+// requeue puts chunks of a failed request that were not started back at the
+// front of the queue, in order.
+func (q *streamQueue) requeue(chunks []*Worker) {
+	if len(chunks) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = append(append([]*Worker(nil), chunks...), q.pending...)
+}
+
+// downloadRunAt downloads the adjacent chunks of run in one request into the
+// destination through writer. If the request fails, the chunk it was fetching
+// fails and the chunks after it go back to queue.
+func (m *ConcurrentDownloadManager) downloadRunAt(
+	ctx context.Context,
+	queue *streamQueue,
+	run []*Worker,
+	writer storage.ChunkWriter,
+	dest string,
+) {
+	ctx, serverIP := network.TraceConnection(ctx)
+	start := time.Now()
+	lead := run[0]
+
+	downloaded := make([]int64, len(run))
+	before := int64(0)
+
+	for i, w := range run {
+		downloaded[i] = w.ChunkInfo.Downloaded
+		before += w.ChunkInfo.Downloaded
+	}
+
+	chunkWriter := io.NewOffsetWriter(writer, lead.ChunkInfo.Start+lead.ChunkInfo.Downloaded)
+	err := lead.downloadRunTo(ctx, run, chunkWriter, dest)
+
+	fetched := -before
+	for _, w := range run {
+		w.recordStats(start, serverIP())
+		fetched += w.ChunkInfo.Downloaded
+	}
+
+	if err == nil {
+		queue.record(fetched, time.Since(start))
+		return
+	}
+
+	for i, w := range run {
+		if w.ChunkInfo.Complete {
+			continue
+		}
+
+		if i == 0 || w.ChunkInfo.Downloaded > downloaded[i] {
+			m.workerFailed(w, err)
+
+			continue
+		}
+
+		queue.requeue(run[i:])
+
+		return
+	}
+}
+
+// downloadChunkAt downloads the chunk of w into the destination through
+// writer.
+func (m *ConcurrentDownloadManager) downloadChunkAt(ctx context.Context, w *Worker, writer storage.ChunkWriter, dest string) {
+	ctx, serverIP := network.TraceConnection(ctx)
+	start := time.Now()
+
+	defer func() { w.recordStats(start, serverIP()) }()
+
+	originalChunk := w.ChunkInfo
+	chunkWriter := io.NewOffsetWriter(writer, w.ChunkInfo.Start+w.ChunkInfo.Downloaded)
+
+	if err := w.downloadChunkTo(ctx, chunkWriter, dest); err != nil {
+		w.ChunkInfo = originalChunk // Restore chunk info
+		m.workerFailed(w, err)
+	}
+}
+
+// workerFailed handles a chunk that failed with err. A chunk whose range kept
+// being ignored stops all workers, as Download then falls back to a single stream;
+// failures of workers stopped that way are not reported.
+func (m *ConcurrentDownloadManager) workerFailed(w *Worker, err error) {
+	if errors.Is(err, gdlerrors.ErrRangeIgnored) {
+		m.rangeIgnored.Store(true)
+
+		if m.cancelChunks != nil {
+			m.cancelChunks()
+		}
+	}
+
+	if m.rangeIgnored.Load() {
+		return
+	}
+
+	w.reportFailure()
+
+	if w.Error != nil {
+		w.Error <- err
+	}
+}
+
+// openChunkWriter opens dest for in-place chunk writes through the configured
+// I/O engine. It returns a nil writer when standard writes are used, in which
+// case chunks are written to temporary files and merged.
+func (m *ConcurrentDownloadManager) openChunkWriter(dest string, size int64) (*os.File, storage.ChunkWriter, error) {
+	if m.ioEngine != types.IOEngineURing && m.ioEngine != types.IOEngineMmap {
+		return nil, nil, nil
+	}
+
+	// Opened read-write as shared mappings require it
+	// #nosec G304 -- dest validated by ValidateDestination() in public API functions
+	file, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
-		return gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "executing request", w.URL)
+		return nil, nil, gdlerrors.NewStorageError("creating destination file", err, dest)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		return gdlerrors.FromHTTPStatus(resp.StatusCode, w.URL)
+	writer, engine, err := storage.NewChunkWriter(file, size, m.ioEngine)
+	if err != nil || engine == types.IOEngineStandard {
+		_ = file.Close()
+		return nil, nil, err
 	}
 
+	return file, writer, nil
+}
+
+// downloadChunkToFile downloads a chunk and writes it to a file.
+func (w *Worker) downloadChunkToFile(ctx context.Context, file *os.File) error {
+	return w.downloadChunkTo(ctx, file, file.Name())
+}
+
+// downloadChunkTo downloads a chunk and writes it to dst; name identifies the
+// destination in errors.
+func (w *Worker) downloadChunkTo(ctx context.Context, dst io.Writer, name string) error {
+	return w.downloadRunTo(ctx, []*Worker{w}, dst, name)
+}
+
+// downloadRunTo downloads the rest of the chunk of w and the adjacent chunks
+// after it in run with one request, writing them to dst and advancing the
+// progress of each chunk in turn; run starts with w. name identifies the
+// destination in errors.
+func (w *Worker) downloadRunTo(ctx context.Context, run []*Worker, dst io.Writer, name string) error {
+	resp, err := w.requestRangeTo(ctx, run[len(run)-1].ChunkInfo.End)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
 	// Download and write to file
-	buffer := make([]byte, 32*1024)
+	bufp := bufpool.Default.Get(w.BufferSize)
+	defer bufpool.Default.Put(bufp)
+
+	current := 0
+	buffer := *bufp
+
 	for {
-		n, err := resp.Body.Read(buffer)
+		n, err := resp.Body.Read(buffer[:ratelimit.MaxRead(w.RateLimiter, len(buffer))])
 		if n > 0 {
 			// Apply rate limiting if a limiter is set
 			if w.RateLimiter != nil {
@@ -197,21 +594,11 @@ func (w *Worker) downloadChunkToFile(ctx context.Context, file *os.File) error {
 				}
 			}
 
-			if _, writeErr := file.Write(buffer[:n]); writeErr != nil {
-				return gdlerrors.NewStorageError("writing to file", writeErr, file.Name())
+			if _, writeErr := dst.Write(buffer[:n]); writeErr != nil {
+				return gdlerrors.NewStorageError("writing to file", writeErr, name)
 			}
 
-			w.ChunkInfo.Downloaded += int64(n)
-
-			if w.Progress != nil {
-				w.Progress <- Progress{
-					WorkerID:   w.ID,
-					ChunkIndex: w.ChunkInfo.Index,
-					Downloaded: w.ChunkInfo.Downloaded,
-					Total:      w.ChunkInfo.End - w.ChunkInfo.Start + 1,
-					Complete:   false,
-				}
-			}
+			current = advanceRun(run, current, int64(n))
 		}
 
 		if err == io.EOF {
@@ -223,6 +610,57 @@ func (w *Worker) downloadChunkToFile(ctx context.Context, file *os.File) error {
 		}
 	}
 
+	if current < len(run)-1 {
+		return gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeCorruptedData,
+			fmt.Sprintf("response ended in chunk %d of a request up to chunk %d",
+				run[current].ChunkInfo.Index, run[len(run)-1].ChunkInfo.Index), w.URL)
+	}
+
+	if current == len(run)-1 {
+		run[current].completeChunk()
+	}
+
+	return nil
+}
+
+// advanceRun attributes n bytes written for run to its chunks in order,
+// starting with run[current], and returns the chunk the next bytes belong to.
+// Filled chunks are marked complete, except the last, which completes at the
+// end of the response.
+func advanceRun(run []*Worker, current int, n int64) int {
+	for n > 0 && current < len(run) {
+		w := run[current]
+		size := w.ChunkInfo.End - w.ChunkInfo.Start + 1
+
+		written := n
+		if current < len(run)-1 {
+			written = min(n, size-w.ChunkInfo.Downloaded)
+		}
+
+		w.ChunkInfo.Downloaded += written
+		n -= written
+
+		if w.Progress != nil {
+			w.Progress <- Progress{
+				WorkerID:   w.ID,
+				ChunkIndex: w.ChunkInfo.Index,
+				Downloaded: w.ChunkInfo.Downloaded,
+				Total:      size,
+				Complete:   false,
+			}
+		}
+
+		if current < len(run)-1 && w.ChunkInfo.Downloaded == size {
+			w.completeChunk()
+			current++
+		}
+	}
+
+	return current
+}
+
+// completeChunk marks the chunk of w complete.
+func (w *Worker) completeChunk() {
 	w.ChunkInfo.Complete = true
 	if w.Progress != nil {
 		w.Progress <- Progress{
@@ -233,20 +671,20 @@ func (w *Worker) downloadChunkToFile(ctx context.Context, file *os.File) error {
 			Complete:   true,
 		}
 	}
-
-	return nil
 }
 
 // mergeChunks combines all chunk files into the final destination file.
 func (m *ConcurrentDownloadManager) mergeChunks(tempDir, dest string, chunks []*ChunkInfo) error {
-	// Create destination file
+	// Open without truncating so space preallocated for the file is kept
 	// #nosec G304 -- dest validated by ValidateDestination() in public API functions
-	destFile, err := os.Create(dest)
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE, 0o644)
 	if err != nil {
 		return gdlerrors.NewStorageError("creating destination file", err, dest)
 	}
 	defer func() { _ = destFile.Close() }()
 
+	var written int64
+
 	// Merge chunks in order
 	for i := range chunks {
 		chunkPath := filepath.Join(tempDir, fmt.Sprintf("chunk_%d", i))
@@ -261,7 +699,8 @@ func (m *ConcurrentDownloadManager) mergeChunks(tempDir, dest string, chunks []*
 			)
 		}
 
-		if _, err := io.Copy(destFile, chunkFile); err != nil {
+		n, err := io.Copy(destFile, chunkFile)
+		if err != nil {
 			_ = chunkFile.Close()
 			return gdlerrors.NewStorageError(
 				fmt.Sprintf("copying chunk %d", i),
@@ -270,9 +709,136 @@ func (m *ConcurrentDownloadManager) mergeChunks(tempDir, dest string, chunks []*
 			)
 		}
 
+		written += n
+
 		_ = chunkFile.Close()
 	}
 
+	// Drop any previous content beyond the merged data
+	if err := destFile.Truncate(written); err != nil {
+		return gdlerrors.NewStorageError("truncating destination file", err, dest)
+	}
+
+	return nil
+}
+
+// openSparseWriter opens dest for in-place chunk writes into a sparse file of
+// size bytes: the file is sized with truncate and chunks are written at their
+// offsets, so disk space is only used for data received. A download continued
+// from its chunk map keeps the data already written; otherwise the previous
+// content is dropped first.
+func (m *ConcurrentDownloadManager) openSparseWriter(
+	url, dest string,
+	size int64,
+	chunks []*ChunkInfo,
+) (*os.File, storage.ChunkWriter, error) {
+	resumed := m.restoreChunkMap(url, dest, size, chunks)
+
+	// #nosec G304 -- dest validated by ValidateDestination() in public API functions
+	file, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, gdlerrors.NewStorageError("creating destination file", err, dest)
+	}
+
+	if !resumed {
+		if err := file.Truncate(0); err != nil {
+			_ = file.Close()
+			return nil, nil, gdlerrors.NewStorageError("truncating destination file", err, dest)
+		}
+	}
+
+	if err := file.Truncate(size); err != nil {
+		_ = file.Close()
+		return nil, nil, gdlerrors.NewStorageError("sizing sparse file", err, dest)
+	}
+
+	writer, _, err := storage.NewChunkWriter(file, size, m.ioEngine)
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+
+	return file, writer, nil
+}
+
+// restoreChunkMap applies the chunk map saved when a sparse download of url to
+// dest was interrupted, so that workers only fetch the holes. It reports
+// whether a chunk map matching the file, its size and its chunks was found.
+func (m *ConcurrentDownloadManager) restoreChunkMap(url, dest string, size int64, chunks []*ChunkInfo) bool {
+	if m.resume == nil {
+		return false
+	}
+
+	info, err := m.resume.Load(dest)
+	if err != nil || info == nil || info.URL != url || info.TotalBytes != size ||
+		len(info.Chunks) != len(chunks) || !m.resume.CanResume(info) {
+		return false
+	}
+
+	for i, chunk := range chunks {
+		if info.Chunks[i].Start != chunk.Start || info.Chunks[i].End != chunk.End {
+			return false
+		}
+	}
+
+	for i, chunk := range chunks {
+		length := chunk.End - chunk.Start + 1
+		chunk.Downloaded = min(max(info.Chunks[i].Downloaded, 0), length)
+		chunk.Complete = chunk.Downloaded == length
+	}
+
+	return true
+}
+
+// saveChunkMap records which ranges of the sparse download of url to dest have
+// been written, or removes the record once every chunk is complete. A chunk map
+// that cannot be saved only costs the data of the next attempt.
+func (m *ConcurrentDownloadManager) saveChunkMap(url, dest string, size int64, chunks []*ChunkInfo) {
+	if m.resume == nil {
+		return
+	}
+
+	info := &resume.ResumeInfo{
+		URL:           url,
+		FilePath:      dest,
+		TotalBytes:    size,
+		ContentLength: size,
+		AcceptRanges:  true,
+	}
+
+	complete := true
+
+	for _, chunk := range chunks {
+		info.Chunks = append(info.Chunks, resume.ChunkState{
+			Start:      chunk.Start,
+			End:        chunk.End,
+			Downloaded: chunk.Downloaded,
+		})
+		info.DownloadedBytes += chunk.Downloaded
+		complete = complete && chunk.Complete
+	}
+
+	if complete || info.DownloadedBytes == 0 {
+		_ = m.resume.Delete(dest)
+		return
+	}
+
+	_ = m.resume.Save(info)
+}
+
+// preallocate reserves size bytes for the destination file.
+func (m *ConcurrentDownloadManager) preallocate(dest string, size int64) error {
+	// #nosec G304 -- dest validated by ValidateDestination() in public API functions
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return gdlerrors.NewStorageError("creating destination file", err, dest)
+	}
+	defer func() { _ = file.Close() }()
+
+	if err := storage.Preallocate(file, size); err != nil && !errors.Is(err, storage.ErrPreallocateUnsupported) {
+		return err
+	}
+
 	return nil
 }
 
@@ -283,21 +849,37 @@ func (m *ConcurrentDownloadManager) cleanup(tempDir string) {
 	}
 }
 
+// segmentUpdateInterval is the minimum time between progress reports to the
+// download's Progress tracker.
+const segmentUpdateInterval = 100 * time.Millisecond
+
 // monitorProgress monitors download progress from all workers.
 func (m *ConcurrentDownloadManager) monitorProgress(
 	progressChan <-chan Progress,
 	errorChan <-chan error,
 	done chan<- bool,
 	totalSize int64,
+	segments []types.Segment,
 ) {
-	var totalDownloaded int64
+	var (
+		totalDownloaded int64
+		lastReport      time.Time
+	)
 
+	// Resumed chunks start with the data already written
 	chunkProgress := make(map[int]int64)
+	for _, segment := range segments {
+		chunkProgress[segment.Index] = segment.Downloaded
+		totalDownloaded += segment.Downloaded
+	}
+
+	start := time.Now()
 
 	for {
 		select {
 		case prog, ok := <-progressChan:
 			if !ok {
+				m.reportProgress(totalDownloaded, totalSize, start, segments)
 				done <- true
 				return
 			}
@@ -312,6 +894,25 @@ func (m *ConcurrentDownloadManager) monitorProgress(
 			// Update progress manager
 			m.progressMgr.Update(totalDownloaded, totalSize)
 
+			if prog.ChunkIndex >= 0 && prog.ChunkIndex < len(segments) {
+				segment := &segments[prog.ChunkIndex]
+				segment.Downloaded = prog.Downloaded
+
+				switch {
+				case prog.Failed:
+					segment.State = types.SegmentFailed
+				case prog.Complete:
+					segment.State = types.SegmentComplete
+				default:
+					segment.State = types.SegmentActive
+				}
+			}
+
+			if time.Since(lastReport) >= segmentUpdateInterval || prog.Complete || prog.Failed {
+				m.reportProgress(totalDownloaded, totalSize, start, segments)
+				lastReport = time.Now()
+			}
+
 		case err, ok := <-errorChan:
 			if ok && err != nil {
 				// Log error but continue monitoring
@@ -321,6 +922,93 @@ func (m *ConcurrentDownloadManager) monitorProgress(
 	}
 }
 
+// ConnectionStats returns the per-chunk transfer stats of the last Download,
+// one entry per chunk, or nil if it was not split into chunks.
+func (m *ConcurrentDownloadManager) ConnectionStats() []types.ConnectionStats {
+	if len(m.workers) == 0 {
+		return nil
+	}
+
+	stats := make([]types.ConnectionStats, len(m.workers))
+	for i, w := range m.workers {
+		stats[i] = w.ConnectionStats()
+	}
+
+	return stats
+}
+
+// Plan returns how the last Download was split into chunks and how many range
+// requests fetched them, or nil if it was not split into chunks.
+func (m *ConcurrentDownloadManager) Plan() *types.TransferPlan {
+	if len(m.workers) == 0 {
+		return nil
+	}
+
+	first := m.workers[0].ChunkInfo
+	plan := &types.TransferPlan{
+		Sources:   1,
+		Pieces:    len(m.workers),
+		PieceSize: first.End - first.Start + 1,
+	}
+
+	for _, w := range m.workers {
+		plan.Requests += w.requests
+	}
+
+	return plan
+}
+
+// RangeStats reports how many responses of the last Download were for other
+// bytes than requested, and whether it fell back to a single stream because a
+// chunk's range kept being ignored.
+func (m *ConcurrentDownloadManager) RangeStats() (violations int, fellBack bool) {
+	return m.rangeViolations, m.rangeFallback
+}
+
+// initialSegments returns the segment map of the current download, with the
+// chunks restored complete from a chunk map marked complete and the others
+// pending.
+func (m *ConcurrentDownloadManager) initialSegments() []types.Segment {
+	if m.chunker == nil {
+		return nil
+	}
+
+	chunks := m.chunker.GetChunks()
+	segments := make([]types.Segment, len(chunks))
+
+	for i, chunk := range chunks {
+		segments[i] = types.Segment{Index: chunk.Index, Start: chunk.Start, End: chunk.End, Downloaded: chunk.Downloaded}
+		if chunk.Complete {
+			segments[i].State = types.SegmentComplete
+		}
+	}
+
+	return segments
+}
+
+// reportProgress passes the overall progress and, to trackers that display
+// them, a snapshot of the segments to the download's Progress tracker.
+func (m *ConcurrentDownloadManager) reportProgress(
+	downloaded, totalSize int64,
+	start time.Time,
+	segments []types.Segment,
+) {
+	if m.progress == nil {
+		return
+	}
+
+	if tracker, ok := m.progress.(types.SegmentProgress); ok && len(segments) > 0 {
+		tracker.UpdateSegments(append([]types.Segment(nil), segments...))
+	}
+
+	var speed int64
+	if elapsed := time.Since(start); elapsed > 0 {
+		speed = int64(float64(downloaded) / elapsed.Seconds())
+	}
+
+	m.progress.Update(downloaded, totalSize, speed)
+}
+
 // getFileSize retrieves the size of the file from the server.
 func (m *ConcurrentDownloadManager) getFileSize(url string) (int64, error) {
 	client := &http.Client{Timeout: 5 * time.Second}
@@ -386,9 +1074,12 @@ func (m *ConcurrentDownloadManager) singleDownload(ctx context.Context, url, des
 
 	// Copy with rate limiting if enabled
 	if m.rateLimiter != nil {
-		buffer := make([]byte, 32*1024)
+		bufp := bufpool.Default.Get(m.bufferSize)
+		defer bufpool.Default.Put(bufp)
+
+		buffer := *bufp
 		for {
-			n, readErr := resp.Body.Read(buffer)
+			n, readErr := resp.Body.Read(buffer[:ratelimit.MaxRead(m.rateLimiter, len(buffer))])
 			if n > 0 {
 				// Apply rate limiting
 				if rateLimiterErr := m.rateLimiter.Wait(ctx, n); rateLimiterErr != nil {
@@ -0,0 +1,57 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloadSparseFileUsage(t *testing.T) {
+	// Split into two chunks, of which only the first arrives
+	testData := make([]byte, 4*1024*1024)
+	for i := range testData {
+		testData[i] = byte(i%250 + 1)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		if r.Header.Get("Range") != "" && r.Header.Get("Range") != "bytes=0-2097151" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testData))
+	}))
+	defer server.Close()
+
+	destFile := filepath.Join(t.TempDir(), "sparse.dat")
+
+	manager := NewConcurrentDownloadManagerWithOptions(&types.DownloadOptions{SparseFile: true})
+	if err := manager.Download(context.Background(), server.URL, destFile); err == nil {
+		t.Fatal("Download() should fail when a chunk is refused")
+	}
+
+	info, err := os.Stat(destFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		t.Skip("file system does not report allocated blocks")
+	}
+
+	// Disk usage reflects the data received, not the size of the file
+	if allocated := stat.Blocks * 512; info.Size() != int64(len(testData)) || allocated >= int64(len(testData))*3/4 {
+		t.Errorf("file of %d bytes uses %d bytes on disk, want about half", info.Size(), allocated)
+	}
+}
@@ -1,6 +1,7 @@
 package concurrent
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
@@ -8,9 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/forest6511/gdl/internal/resume"
 	"github.com/forest6511/gdl/pkg/types"
 )
 
@@ -278,6 +283,292 @@ func TestDownloadWithRangeSupport(t *testing.T) {
 	// In real implementation, chunks should be written to separate files first
 }
 
+func TestDownloadIOEngines(t *testing.T) {
+	// Large enough to be split into several chunks
+	testData := make([]byte, 3*1024*1024+123)
+	for i := range testData {
+		testData[i] = byte(i % 251)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testData))
+	}))
+	defer server.Close()
+
+	for _, engine := range []string{types.IOEngineAuto, types.IOEngineStandard, types.IOEngineURing, types.IOEngineMmap} {
+		t.Run(engine, func(t *testing.T) {
+			destFile := filepath.Join(t.TempDir(), "downloaded.dat")
+
+			// Stale content longer than the download must not survive
+			if err := os.WriteFile(destFile, make([]byte, len(testData)+4096), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			manager := NewConcurrentDownloadManagerWithOptions(&types.DownloadOptions{IOEngine: engine})
+			if err := manager.Download(context.Background(), server.URL, destFile); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			content, err := os.ReadFile(destFile)
+			if err != nil {
+				t.Fatalf("failed to read downloaded file: %v", err)
+			}
+
+			if !bytes.Equal(content, testData) {
+				t.Errorf("downloaded %d bytes that differ from the %d bytes served", len(content), len(testData))
+			}
+
+			if _, err := os.Stat(destFile + ".chunks"); !os.IsNotExist(err) {
+				t.Error("chunk directory should not be left behind")
+			}
+		})
+	}
+}
+
+func TestDownloadSparseResume(t *testing.T) {
+	// Split into two chunks
+	testData := make([]byte, 3*1024*1024+123)
+	for i := range testData {
+		testData[i] = byte(i % 251)
+	}
+
+	var (
+		failing atomic.Bool
+		mu      sync.Mutex
+		ranges  []string
+	)
+
+	failing.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		if r.Method != http.MethodHead {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil && start > 0 && failing.Load() {
+			// Drop the connection half way through the second chunk
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(testData)))
+			w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(testData[start : start+(end-start+1)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testData))
+	}))
+	defer server.Close()
+
+	destFile := filepath.Join(t.TempDir(), "sparse.dat")
+	resumeDir := t.TempDir()
+
+	download := func() error {
+		manager := NewConcurrentDownloadManagerWithOptions(&types.DownloadOptions{SparseFile: true, Resume: true})
+		manager.resume = resume.NewManager(resumeDir)
+
+		return manager.Download(context.Background(), server.URL, destFile)
+	}
+
+	if err := download(); err == nil {
+		t.Fatal("Download() should fail when a chunk is cut off")
+	}
+
+	// The partial file has its full size; the chunk map tells where the hole is
+	if info, err := os.Stat(destFile); err != nil || info.Size() != int64(len(testData)) {
+		t.Fatalf("partial file = %v, %v, want %d bytes", info, err, len(testData))
+	}
+
+	saved, err := resume.NewManager(resumeDir).Load(destFile)
+	if err != nil || saved == nil {
+		t.Fatalf("chunk map = %v, %v", saved, err)
+	}
+
+	holes := saved.Holes()
+	if len(holes) != 1 || holes[0].End != int64(len(testData)-1) {
+		t.Fatalf("Holes() = %+v, want the rest of the second chunk", holes)
+	}
+
+	failing.Store(false)
+	mu.Lock()
+	ranges = nil
+	mu.Unlock()
+
+	if err := download(); err != nil {
+		t.Fatalf("resumed Download() error = %v", err)
+	}
+
+	// Only the hole is downloaded again
+	if want := fmt.Sprintf("bytes=%d-%d", holes[0].Start, holes[0].End); len(ranges) != 1 || ranges[0] != want {
+		t.Errorf("resumed requests = %v, want only %s", ranges, want)
+	}
+
+	content, err := os.ReadFile(destFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testData) {
+		t.Error("resumed sparse download differs from the served data")
+	}
+
+	if saved, _ := resume.NewManager(resumeDir).Load(destFile); saved != nil {
+		t.Error("chunk map should be removed once the download is complete")
+	}
+}
+
+func TestDownloadRangeIgnored(t *testing.T) {
+	testData := make([]byte, 3*1024*1024+123)
+	for i := range testData {
+		testData[i] = byte(i % 251)
+	}
+
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter, start, end int64)
+	}{
+		{"whole file", func(w http.ResponseWriter, start, end int64) {
+			_, _ = w.Write(testData)
+		}},
+		{"wrong range", func(w http.ResponseWriter, start, end int64) {
+			// Always the first bytes of the file, whatever was asked for
+			length := end - start + 1
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", length-1, len(testData)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(testData[:length])
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{types.IOEngineStandard, types.IOEngineMmap} {
+			t.Run(tt.name+"/"+engine, func(t *testing.T) {
+				var ranged, full atomic.Int32
+
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Accept-Ranges", "bytes")
+					w.Header().Set("Content-Length", fmt.Sprint(len(testData)))
+
+					if r.Method == http.MethodHead {
+						return
+					}
+
+					var start, end int64
+					if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+						full.Add(1)
+						_, _ = w.Write(testData)
+
+						return
+					}
+
+					ranged.Add(1)
+					w.Header().Del("Content-Length")
+					tt.respond(w, start, end)
+				}))
+				defer server.Close()
+
+				destFile := filepath.Join(t.TempDir(), "downloaded.dat")
+
+				manager := NewConcurrentDownloadManagerWithOptions(&types.DownloadOptions{IOEngine: engine})
+				if err := manager.Download(context.Background(), server.URL, destFile); err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+
+				content, err := os.ReadFile(destFile)
+				if err != nil {
+					t.Fatalf("failed to read downloaded file: %v", err)
+				}
+
+				if !bytes.Equal(content, testData) {
+					t.Errorf("downloaded %d bytes that differ from the %d bytes served", len(content), len(testData))
+				}
+
+				if full.Load() != 1 || ranged.Load() == 0 {
+					t.Errorf("got %d ranged and %d full requests, want chunks abandoned for one full download",
+						ranged.Load(), full.Load())
+				}
+
+				if manager.ConnectionStats() != nil {
+					t.Error("ConnectionStats() should be nil after falling back to a single stream")
+				}
+
+				if violations, fellBack := manager.RangeStats(); violations <= maxRangeViolations || !fellBack {
+					t.Errorf("RangeStats() = %d, %v, want more than %d violations and a fallback",
+						violations, fellBack, maxRangeViolations)
+				}
+			})
+		}
+	}
+}
+
+func TestDownloadIntermittentRangeIgnored(t *testing.T) {
+	testData := make([]byte, 3*1024*1024+123)
+	for i := range testData {
+		testData[i] = byte(i % 251)
+	}
+
+	var ranged, full atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(testData)))
+			return
+		}
+
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			full.Add(1)
+			_, _ = w.Write(testData)
+
+			return
+		}
+
+		// One misbehaving edge node answers the first range request whole
+		if ranged.Add(1) == 1 {
+			_, _ = w.Write(testData)
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(testData)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(testData[start : end+1])
+	}))
+	defer server.Close()
+
+	destFile := filepath.Join(t.TempDir(), "downloaded.dat")
+
+	manager := NewConcurrentDownloadManager()
+	if err := manager.Download(context.Background(), server.URL, destFile); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	content, err := os.ReadFile(destFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testData) {
+		t.Error("downloaded data differs from the served data")
+	}
+
+	if violations, fellBack := manager.RangeStats(); violations != 1 || fellBack || full.Load() != 0 {
+		t.Errorf("RangeStats() = %d, %v with %d full downloads, want 1 violation retried in chunks",
+			violations, fellBack, full.Load())
+	}
+
+	total := 0
+	for _, conn := range manager.ConnectionStats() {
+		total += conn.RangeViolations
+	}
+	if total != 1 {
+		t.Errorf("violations in ConnectionStats = %d, want 1", total)
+	}
+}
+
 func TestDownloadWithoutRangeSupport(t *testing.T) {
 	testData := []byte("Server does not support range requests")
 
@@ -357,7 +648,7 @@ func TestMonitorProgress(t *testing.T) {
 	totalSize := int64(1000)
 
 	// Start monitoring in goroutine
-	go manager.monitorProgress(progressChan, errorChan, done, totalSize)
+	go manager.monitorProgress(progressChan, errorChan, done, totalSize, nil)
 
 	// Send progress updates
 	progressChan <- Progress{
@@ -1121,3 +1412,273 @@ func TestDownloadWithRateLimit(t *testing.T) {
 		}
 	})
 }
+
+// segmentRecorder is a types.SegmentProgress that keeps the last segment map.
+type segmentRecorder struct {
+	mu       sync.Mutex
+	segments []types.Segment
+	updates  int
+}
+
+func (r *segmentRecorder) Start(string, int64)                 {}
+func (r *segmentRecorder) Update(int64, int64, int64)          {}
+func (r *segmentRecorder) Finish(string, *types.DownloadStats) {}
+func (r *segmentRecorder) Error(string, error)                 {}
+func (r *segmentRecorder) UpdateSegments(segments []types.Segment) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.segments = segments
+	r.updates++
+}
+
+func TestDownloadSegmentProgress(t *testing.T) {
+	testData := make([]byte, 3*1024*1024)
+
+	// Requests for the second chunk always fail
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		if r.Method == http.MethodGet && strings.HasPrefix(r.Header.Get("Range"), "bytes=1572864-") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testData))
+	}))
+	defer server.Close()
+
+	recorder := &segmentRecorder{}
+	manager := NewConcurrentDownloadManagerWithOptions(&types.DownloadOptions{Progress: recorder})
+
+	if err := manager.Download(context.Background(), server.URL, filepath.Join(t.TempDir(), "out.bin")); err == nil {
+		t.Fatal("Download() should fail when a chunk fails")
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.updates == 0 || len(recorder.segments) != 2 {
+		t.Fatalf("got %d segment updates with %d segments, want 2 segments", recorder.updates, len(recorder.segments))
+	}
+
+	first, second := recorder.segments[0], recorder.segments[1]
+	if first.State != types.SegmentComplete || first.Downloaded != first.End-first.Start+1 {
+		t.Errorf("first segment = %+v, want complete", first)
+	}
+
+	if second.State != types.SegmentFailed || second.Start != 1572864 {
+		t.Errorf("second segment = %+v, want failed from offset 1572864", second)
+	}
+}
+
+func TestDownloadConnectionStats(t *testing.T) {
+	testData := make([]byte, 3*1024*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testData))
+	}))
+	defer server.Close()
+
+	manager := NewConcurrentDownloadManagerWithOptions(&types.DownloadOptions{})
+	if err := manager.Download(context.Background(), server.URL, filepath.Join(t.TempDir(), "out.bin")); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	stats := manager.ConnectionStats()
+	if len(stats) != 2 {
+		t.Fatalf("ConnectionStats() = %+v, want one entry per chunk", stats)
+	}
+
+	var total int64
+
+	for i, conn := range stats {
+		if conn.Index != i || conn.ServerIP != "127.0.0.1" || conn.BytesDownloaded != conn.RangeEnd-conn.RangeStart+1 {
+			t.Errorf("connection %d stats = %+v", i, conn)
+		}
+
+		total += conn.BytesDownloaded
+	}
+
+	if total != int64(len(testData)) {
+		t.Errorf("connections downloaded %d bytes, want %d", total, len(testData))
+	}
+}
+
+func TestDownloadWithHostLimits(t *testing.T) {
+	testData := bytes.Repeat([]byte("0123456789abcdef"), 4*1024*1024/16)
+
+	var active, peak, ranged atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranged.Add(1)
+		}
+
+		n := active.Add(1)
+		defer active.Add(-1)
+
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testData))
+	}))
+	defer server.Close()
+
+	manager := NewConcurrentDownloadManagerWithOptions(&types.DownloadOptions{
+		HostLimits: &types.HostLimitPolicy{MaxConnections: 1},
+	})
+
+	destFile := filepath.Join(t.TempDir(), "limited.bin")
+	if err := manager.Download(context.Background(), server.URL, destFile); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	content, err := os.ReadFile(destFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testData) {
+		t.Fatal("downloaded file differs from the served data")
+	}
+
+	if ranged.Load() < 2 {
+		t.Fatalf("server got %d range requests, want several chunks", ranged.Load())
+	}
+	if got := peak.Load(); got != 1 {
+		t.Errorf("server saw %d chunk requests at once, want 1", got)
+	}
+}
+
+func TestDownloadStreamOrder(t *testing.T) {
+	testData := bytes.Repeat([]byte("0123456789abcdef"), 6*streamChunkSize/16)
+
+	var (
+		mu     sync.Mutex
+		starts []int64
+	)
+
+	var active, peak atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			mu.Lock()
+			starts = append(starts, start)
+			mu.Unlock()
+
+			n := active.Add(1)
+			defer active.Add(-1)
+
+			for {
+				current := peak.Load()
+				if n <= current || peak.CompareAndSwap(current, n) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testData))
+	}))
+	defer server.Close()
+
+	manager := NewConcurrentDownloadManagerWithOptions(&types.DownloadOptions{StreamOrder: true, MaxConcurrency: 2})
+
+	destFile := filepath.Join(t.TempDir(), "stream.bin")
+	if err := manager.Download(context.Background(), server.URL, destFile); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	content, err := os.ReadFile(destFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testData) {
+		t.Fatal("downloaded file differs from the served data")
+	}
+
+	// The first requests fetch one chunk each; once they show how fast the
+	// server is, the adjacent chunks are coalesced into fewer requests
+	plan := manager.Plan()
+	if plan == nil || plan.Pieces != 6 || plan.PieceSize != streamChunkSize {
+		t.Fatalf("Plan() = %+v, want 6 pieces of 1 MiB", plan)
+	}
+	if plan.Requests != len(starts) {
+		t.Errorf("Plan().Requests = %d, want the %d requests made", plan.Requests, len(starts))
+	}
+	if len(starts) < 2 || len(starts) >= 6 {
+		t.Errorf("server got %d range requests, want adjacent chunks coalesced", len(starts))
+	}
+	if got := peak.Load(); got > 2 {
+		t.Errorf("server saw %d chunk requests at once, want at most 2", got)
+	}
+
+	for i, start := range starts {
+		if start%streamChunkSize != 0 {
+			t.Errorf("request %d started at %d, not at a chunk", i, start)
+		}
+	}
+
+	if _, err := os.Stat(destFile + ".chunks"); !os.IsNotExist(err) {
+		t.Error("chunk files were written instead of the destination")
+	}
+}
+
+func TestStreamQueue(t *testing.T) {
+	pending := make([]*Worker, 8)
+	for i := range pending {
+		pending[i] = &Worker{ChunkInfo: &ChunkInfo{
+			Index: i,
+			Start: int64(i) * streamChunkSize,
+			End:   int64(i+1)*streamChunkSize - 1,
+		}}
+	}
+
+	queue := newStreamQueue(pending, 2)
+
+	// Nothing is coalesced before a request has shown the connection speed
+	if run := queue.next(); len(run) != 1 || run[0].ChunkInfo.Index != 0 {
+		t.Fatalf("first next() = %d chunks, want chunk 0 alone", len(run))
+	}
+
+	// 2 MiB/s: the next request covers the chunks fetched in coalesceDuration
+	queue.record(2*streamChunkSize, time.Second)
+
+	run := queue.next()
+	if len(run) != 2 || run[0].ChunkInfo.Index != 1 {
+		t.Fatalf("next() at 2 MiB/s = %d chunks, want chunks 1-2", len(run))
+	}
+
+	// A failed request's untouched chunks go back to the front of the queue
+	queue.requeue(run[1:])
+
+	// Fast connections are held to their share of the lookahead
+	queue.record(100*streamChunkSize, time.Second)
+
+	run = queue.next()
+	if len(run) != streamLookahead/2 || run[0].ChunkInfo.Index != 2 {
+		t.Fatalf("next() when fast = %d chunks from %d, want %d from chunk 2",
+			len(run), run[0].ChunkInfo.Index, streamLookahead/2)
+	}
+
+	// A partly fetched chunk starts its own request
+	pending[7].ChunkInfo.Downloaded = 1
+
+	if run = queue.next(); len(run) != 1 || run[0].ChunkInfo.Index != 6 {
+		t.Fatalf("next() before a partial chunk = %d chunks, want chunk 6 alone", len(run))
+	}
+	if run = queue.next(); len(run) != 1 || run[0].ChunkInfo.Index != 7 {
+		t.Fatalf("last next() = %d chunks, want chunk 7", len(run))
+	}
+	if run = queue.next(); run != nil {
+		t.Errorf("next() on an empty queue = %d chunks, want nil", len(run))
+	}
+}
@@ -2,13 +2,17 @@ package concurrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
+	"github.com/forest6511/gdl/internal/bufpool"
+	"github.com/forest6511/gdl/internal/network"
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 type Progress struct {
@@ -17,6 +21,7 @@ type Progress struct {
 	Downloaded int64
 	Total      int64
 	Complete   bool
+	Failed     bool
 }
 
 type Worker struct {
@@ -27,6 +32,27 @@ type Worker struct {
 	Progress    chan<- Progress
 	Error       chan<- error
 	RateLimiter ratelimit.Limiter // Shared rate limiter across all workers
+	BufferSize  int               // Read buffer size from the shared pool (0 = bufpool.DefaultSize)
+
+	retries         int                   // Failed attempts of the current chunk
+	requests        int                   // Range requests made, for this chunk and those coalesced with it
+	rangeViolations int                   // Responses to the chunk's requests for the wrong bytes
+	stats           types.ConnectionStats // Transfer stats of the chunk, set when it ends
+}
+
+// maxRangeViolations is how many times a chunk is requested again, over a
+// fresh connection, after a response that ignored its range. Some CDNs do so
+// intermittently, from a few edge nodes only; one that keeps doing it makes
+// the download fall back to a single stream.
+const maxRangeViolations = 2
+
+// workerTransportConfig returns the transport settings shared by all chunk workers.
+// Compression is disabled so that range responses are written byte for byte.
+func workerTransportConfig() network.TransportConfig {
+	config := network.DefaultTransportConfig()
+	config.DisableCompression = true
+
+	return config
 }
 
 // NewWorker creates a new download worker.
@@ -35,13 +61,8 @@ func NewWorker(id int, url string) *Worker {
 		ID:  id,
 		URL: url,
 		Client: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:       10,
-				IdleConnTimeout:    30 * time.Second,
-				DisableCompression: true,
-				DisableKeepAlives:  false,
-			},
+			Timeout:   30 * time.Second,
+			Transport: network.SharedTransport(workerTransportConfig()),
 		},
 	}
 }
@@ -56,8 +77,15 @@ func (w *Worker) Download(ctx context.Context) error {
 	}
 
 	// Try download with retry logic
+	ctx, serverIP := network.TraceConnection(ctx)
+	start := time.Now()
+
 	err := w.downloadChunk(ctx)
+	w.recordStats(start, serverIP())
+
 	if err != nil {
+		w.reportFailure()
+
 		if w.Error != nil {
 			// Don't re-wrap DownloadError instances
 			if gdlerrors.GetErrorCode(err) != gdlerrors.CodeUnknown {
@@ -91,6 +119,119 @@ func (w *Worker) Download(ctx context.Context) error {
 	return nil
 }
 
+// reportFailure sends a progress update marking the worker's chunk as failed.
+func (w *Worker) reportFailure() {
+	if w.Progress != nil {
+		w.Progress <- Progress{
+			WorkerID:   w.ID,
+			ChunkIndex: w.ChunkInfo.Index,
+			Downloaded: w.ChunkInfo.Downloaded,
+			Total:      w.ChunkInfo.End - w.ChunkInfo.Start + 1,
+			Failed:     true,
+		}
+	}
+}
+
+// recordStats records the connection stats of the chunk transfer that started
+// at start.
+func (w *Worker) recordStats(start time.Time, serverIP string) {
+	w.stats = types.ConnectionStats{
+		Index:           w.ChunkInfo.Index,
+		RangeStart:      w.ChunkInfo.Start,
+		RangeEnd:        w.ChunkInfo.End,
+		BytesDownloaded: w.ChunkInfo.Downloaded,
+		Duration:        time.Since(start),
+		Retries:         w.retries,
+		ServerIP:        serverIP,
+		RangeViolations: w.rangeViolations,
+	}
+
+	if w.stats.Duration > 0 {
+		w.stats.Speed = int64(float64(w.stats.BytesDownloaded) / w.stats.Duration.Seconds())
+	}
+}
+
+// ConnectionStats returns the transfer stats of the worker's chunk once it
+// has finished.
+func (w *Worker) ConnectionStats() types.ConnectionStats {
+	return w.stats
+}
+
+// checkRangeResponse checks that resp is the requested byte range. A 200
+// response or a Content-Range for other bytes means the server ignored the
+// range, and writing the body at the chunk's offset would corrupt the file.
+func checkRangeResponse(resp *http.Response, rangeStart, rangeEnd int64, url string) error {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return gdlerrors.WrapErrorWithURL(gdlerrors.ErrRangeIgnored, gdlerrors.CodeServerError,
+			fmt.Sprintf("server sent the whole file for range %d-%d", rangeStart, rangeEnd), url)
+	default:
+		return gdlerrors.FromHTTPStatus(resp.StatusCode, url)
+	}
+
+	contentRange := resp.Header.Get("Content-Range")
+	if contentRange == "" {
+		return nil
+	}
+
+	var start, end int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &start, &end); err != nil ||
+		start != rangeStart || end != rangeEnd {
+		return gdlerrors.WrapErrorWithURL(gdlerrors.ErrRangeIgnored, gdlerrors.CodeServerError,
+			fmt.Sprintf("server sent %q for range %d-%d", contentRange, rangeStart, rangeEnd), url)
+	}
+
+	return nil
+}
+
+// requestRange requests the rest of the chunk and checks that the response
+// holds the requested bytes. The connection of a response for other bytes is
+// closed, so no worker reuses it, and the range is requested again up to
+// maxRangeViolations times. The caller closes the returned response's body.
+func (w *Worker) requestRange(ctx context.Context) (*http.Response, error) {
+	return w.requestRangeTo(ctx, w.ChunkInfo.End)
+}
+
+// requestRangeTo is requestRange for the rest of the chunk and the bytes after
+// it up to rangeEnd, which adjacent chunks coalesced with it cover.
+func (w *Worker) requestRangeTo(ctx context.Context, rangeEnd int64) (*http.Response, error) {
+	rangeStart := w.ChunkInfo.Start + w.ChunkInfo.Downloaded
+
+	for {
+		reqCtx, quarantine := network.QuarantineConnection(ctx)
+
+		req, err := http.NewRequestWithContext(reqCtx, "GET", w.URL, nil)
+		if err != nil {
+			return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "creating request", w.URL)
+		}
+
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", rangeStart, rangeEnd))
+
+		w.requests++
+		resp, err := w.Client.Do(req)
+		if err != nil {
+			return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "executing request", w.URL)
+		}
+
+		err = checkRangeResponse(resp, rangeStart, rangeEnd, w.URL)
+		if err == nil {
+			return resp, nil
+		}
+
+		if errors.Is(err, gdlerrors.ErrRangeIgnored) {
+			quarantine()
+			w.rangeViolations++
+		}
+
+		_ = resp.Body.Close()
+
+		if !errors.Is(err, gdlerrors.ErrRangeIgnored) || w.rangeViolations > maxRangeViolations {
+			return nil, err
+		}
+	}
+}
+
 // downloadChunk performs the actual chunk download with retry logic.
 func (w *Worker) downloadChunk(ctx context.Context) error {
 	maxRetries := 3
@@ -114,6 +255,15 @@ func (w *Worker) downloadChunk(ctx context.Context) error {
 			return nil
 		}
 
+		// The range was already requested again over fresh connections
+		if errors.Is(err, gdlerrors.ErrRangeIgnored) {
+			return err
+		}
+
+		if attempt < maxRetries {
+			w.retries++
+		}
+
 		// Log retry attempt
 		if attempt < maxRetries {
 			// Send error notification about retry
@@ -138,35 +288,21 @@ func (w *Worker) downloadChunk(ctx context.Context) error {
 
 // performDownload performs a single download attempt.
 func (w *Worker) performDownload(ctx context.Context) error {
-	// Create range request
-	req, err := http.NewRequest("GET", w.URL, nil)
-	if err != nil {
-		return gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "creating request", w.URL)
-	}
-
-	// Set range header for partial content
-	rangeStart := w.ChunkInfo.Start + w.ChunkInfo.Downloaded
-	rangeEnd := w.ChunkInfo.End
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", rangeStart, rangeEnd))
-
-	// Execute request
-	resp, err := w.Client.Do(req)
+	resp, err := w.requestRange(ctx)
 	if err != nil {
-		return gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "executing request", w.URL)
+		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	// Check status code
-	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		return gdlerrors.FromHTTPStatus(resp.StatusCode, w.URL)
-	}
+	// Take a read buffer from the shared pool
+	bufp := bufpool.Default.Get(w.BufferSize)
+	defer bufpool.Default.Put(bufp)
 
-	// Create buffer for reading
-	buffer := make([]byte, 32*1024) // 32KB buffer
+	buffer := *bufp
 
 	for {
 		// Read from response body
-		n, err := resp.Body.Read(buffer)
+		n, err := resp.Body.Read(buffer[:ratelimit.MaxRead(w.RateLimiter, len(buffer))])
 		if n > 0 {
 			// Apply rate limiting if a limiter is set
 			if w.RateLimiter != nil {
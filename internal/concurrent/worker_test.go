@@ -2,12 +2,14 @@ package concurrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 	"github.com/forest6511/gdl/pkg/ratelimit"
 )
 
@@ -649,3 +651,39 @@ func TestWorkerResumeDownload(t *testing.T) {
 		close(progressChan)
 	})
 }
+
+func TestCheckRangeResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		contentRange string
+		wantIgnored  bool
+		wantErr      bool
+	}{
+		{"matching range", http.StatusPartialContent, "bytes 100-199/1000", false, false},
+		{"no content range", http.StatusPartialContent, "", false, false},
+		{"whole file", http.StatusOK, "", true, true},
+		{"other range", http.StatusPartialContent, "bytes 0-99/1000", true, true},
+		{"shorter range", http.StatusPartialContent, "bytes 100-149/1000", true, true},
+		{"malformed range", http.StatusPartialContent, "bytes */1000", true, true},
+		{"server error", http.StatusInternalServerError, "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.contentRange != "" {
+				resp.Header.Set("Content-Range", tt.contentRange)
+			}
+
+			err := checkRangeResponse(resp, 100, 199, "http://example.com/file")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkRangeResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := errors.Is(err, gdlerrors.ErrRangeIgnored); got != tt.wantIgnored {
+				t.Errorf("errors.Is(err, ErrRangeIgnored) = %v, want %v", got, tt.wantIgnored)
+			}
+		})
+	}
+}
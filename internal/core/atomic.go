@@ -0,0 +1,243 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// PartFileSuffix is appended to the destination name while an atomic download
+// is in progress.
+const PartFileSuffix = ".gdl-part"
+
+// PartFilePath returns the temporary file an atomic download of destination
+// is written to: "<destination>.gdl-part", or a file in tempDir when set. Names
+// in tempDir carry a hash of the destination so equal base names do not collide.
+func PartFilePath(destination, tempDir string) string {
+	if tempDir == "" {
+		return destination + PartFileSuffix
+	}
+
+	abs, err := filepath.Abs(destination)
+	if err != nil {
+		abs = destination
+	}
+
+	sum := sha256.Sum256([]byte(abs))
+
+	return filepath.Join(tempDir, fmt.Sprintf("%s.%x%s", filepath.Base(destination), sum[:4], PartFileSuffix))
+}
+
+// transfer downloads url to destination, through a part file that is renamed
+// into place on success when atomic writes are enabled, and sets the metadata
+// of the completed file.
+func (d *Downloader) transfer(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) (*types.DownloadStats, error) {
+	if !options.AtomicWrite {
+		result, err := d.executeDownloadWithRetries(ctx, url, destination, options, stats)
+		if err != nil {
+			return result, err
+		}
+
+		return result, d.completeDownload(ctx, url, destination, options, result)
+	}
+
+	part := PartFilePath(destination, options.TempDir)
+	_, partErr := os.Stat(part)
+
+	// Only a part file recorded as a download of this URL is continued, and
+	// only with Resume; any other is left over from another download
+	if partErr == nil && (!options.Resume || d.loadPartialVersion(url, part) == nil) {
+		if err := d.discardPartFile(part); err != nil {
+			downloadErr := errors.NewStorageError("remove stale part file", err, part)
+			stats.Error = downloadErr
+
+			return stats, downloadErr
+		}
+
+		partErr = os.ErrNotExist
+	}
+
+	// A partial destination from a non-atomic download is resumed in place
+	if options.Resume && os.IsNotExist(partErr) {
+		if _, err := os.Stat(destination); err == nil {
+			result, err := d.executeDownloadWithRetries(ctx, url, destination, options, stats)
+			if err != nil {
+				return result, err
+			}
+
+			return result, d.completeDownload(ctx, url, destination, options, result)
+		}
+	}
+
+	if !options.Resume {
+		if err := d.handleExistingFile(destination, options); err != nil {
+			downloadErr := d.wrapDownloadError(err, url, destination, 0, 0)
+			stats.Error = downloadErr
+
+			return stats, downloadErr
+		}
+	}
+
+	if options.CreateDirs {
+		if err := d.createParentDirs(destination); err != nil {
+			downloadErr := errors.WrapErrorWithURL(err, errors.CodePermissionDenied,
+				"Failed to create parent directories", url)
+			stats.Error = downloadErr
+
+			return stats, downloadErr
+		}
+	}
+
+	if options.TempDir != "" {
+		if err := os.MkdirAll(options.TempDir, 0o750); err != nil {
+			downloadErr := errors.NewStorageError("create temp directory", err, options.TempDir)
+			stats.Error = downloadErr
+
+			return stats, downloadErr
+		}
+	}
+
+	// The part file belongs to this download; an existing one is resumed
+	partOptions := *options
+	partOptions.OverwriteExisting = true
+	partOptions.CreateDirs = false
+
+	if partErr == nil {
+		partOptions.Resume = true
+
+		d.logInfo("adopt_part_file", "Resuming from existing part file", map[string]interface{}{
+			"part": part,
+		})
+	}
+
+	result, err := d.executeDownloadWithRetries(ctx, url, part, &partOptions, stats)
+	if result != nil {
+		result.Filename = destination
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	// A part file failing verification never replaces the destination
+	if err := d.checkDownload(ctx, url, part, destination, options, result); err != nil {
+		return result, err
+	}
+
+	if err := moveFile(part, destination); err != nil {
+		downloadErr := errors.NewStorageError("rename part file", err, destination)
+		result.Success = false
+		result.Error = downloadErr
+
+		return result, downloadErr
+	}
+
+	d.applyMetadata(url, destination, options, result)
+
+	return result, nil
+}
+
+// discardPartFile removes a part file that is not continued, with the resume
+// records kept for it.
+func (d *Downloader) discardPartFile(part string) error {
+	d.logInfo("discard_part_file", "Removing part file of another download", map[string]interface{}{
+		"part": part,
+	})
+
+	if err := os.Remove(part); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	d.forgetPartialVersion(part)
+
+	return nil
+}
+
+// completeDownload checks the download of url completed in place at
+// destination and then sets its metadata.
+func (d *Downloader) completeDownload(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	result *types.DownloadStats,
+) error {
+	if err := d.checkDownload(ctx, url, destination, destination, options, result); err != nil {
+		return err
+	}
+
+	d.applyMetadata(url, destination, options, result)
+
+	return nil
+}
+
+// checkDownload verifies the checksum and signature of the completed download
+// of url to destination, held at path, and scans it for malware.
+func (d *Downloader) checkDownload(
+	ctx context.Context,
+	url, path, destination string,
+	options *types.DownloadOptions,
+	result *types.DownloadStats,
+) error {
+	if err := d.checkChecksum(url, path, options, result); err != nil {
+		return err
+	}
+
+	if err := d.checkSignature(ctx, url, path, options, result); err != nil {
+		return err
+	}
+
+	return d.checkScan(ctx, url, path, destination, options, result)
+}
+
+// moveFile renames src to dst, copying through a temporary file next to dst
+// when they are on different file systems so dst is still replaced atomically.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// #nosec G304 -- src is the part file of this download
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmp.Name()
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info, err := in.Stat(); err == nil {
+		_ = os.Chmod(tmpPath, info.Mode().Perm())
+	}
+
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"io"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// errBodyLimit ends the read of a body that grew past its limit; Err replaces
+// the error it becomes with the one for the caller.
+var errBodyLimit = stdErrors.New("response body limit reached")
+
+// bodyLimit reads a response body and stops the transfer once it grows past
+// limit bytes, handing out no byte beyond the limit.
+type bodyLimit struct {
+	body    io.Reader
+	limit   int64
+	read    int64
+	tripped bool
+}
+
+// limitBody returns body, read through a bodyLimit when options set
+// MaxBodySize. A nil bodyLimit is returned when there is no limit.
+func limitBody(body io.Reader, options *types.DownloadOptions) (io.Reader, *bodyLimit) {
+	if options.MaxBodySize <= 0 {
+		return body, nil
+	}
+
+	l := &bodyLimit{body: body, limit: options.MaxBodySize}
+
+	return l, l
+}
+
+// Read reads from the body, asking for at most one byte past the limit to
+// tell a body of exactly limit bytes from a longer one.
+func (l *bodyLimit) Read(p []byte) (int, error) {
+	if remaining := l.limit - l.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := l.body.Read(p)
+	l.read += int64(n)
+
+	if l.read > l.limit {
+		l.tripped = true
+		return n - int(l.read-l.limit), errBodyLimit
+	}
+
+	return n, err
+}
+
+// Err replaces err, the error that ended the transfer, with the error of a
+// response too large when the limit stopped it. It is safe to call on a nil
+// bodyLimit.
+func (l *bodyLimit) Err(err error) error {
+	if l == nil || err == nil || !l.tripped {
+		return err
+	}
+
+	return responseTooLarge(l.limit, -1)
+}
+
+// responseTooLarge returns the CodeValidationError wrapping
+// errors.ErrResponseTooLarge for a response over limit bytes, of size bytes
+// when known (-1 otherwise).
+func responseTooLarge(limit, size int64) error {
+	details := fmt.Sprintf("more than %d bytes received", limit)
+	if size >= 0 {
+		details = fmt.Sprintf("Content-Length %d", size)
+	}
+
+	downloadErr := errors.WrapError(errors.ErrResponseTooLarge, errors.CodeValidationError,
+		fmt.Sprintf("Response is larger than the limit of %d bytes", limit))
+	downloadErr.Details = details
+
+	return downloadErr
+}
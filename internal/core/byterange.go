@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// downloadRange downloads options.ByteRange of url to destination. A failed
+// attempt is retried from the start of the range.
+func (d *Downloader) downloadRange(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) (*types.DownloadStats, error) {
+	fail := func(err error) (*types.DownloadStats, error) {
+		stats.Success = false
+		stats.Error = err
+		stats.EndTime = time.Now()
+		stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+		return stats, err
+	}
+
+	if err := options.ByteRange.Validate(); err != nil {
+		return fail(errors.NewValidationError("range", err.Error()))
+	}
+
+	if err := d.handleExistingFile(destination, options); err != nil {
+		return fail(d.wrapDownloadError(err, url, destination, 0, 0))
+	}
+
+	if options.CreateDirs {
+		if err := d.createParentDirs(destination); err != nil {
+			return fail(errors.WrapErrorWithURL(err, errors.CodePermissionDenied,
+				"Failed to create parent directories", url))
+		}
+	}
+
+	releaseQuota, err := d.reserveQuota(destination, max(options.ByteRange.Length(), 0), options)
+	if err != nil {
+		return fail(d.wrapDownloadError(err, url, destination, 0, 0))
+	}
+	defer releaseQuota()
+
+	target := destination
+	if options.AtomicWrite {
+		target = PartFilePath(destination, options.TempDir)
+
+		if options.TempDir != "" {
+			if err := os.MkdirAll(options.TempDir, 0o750); err != nil {
+				return fail(errors.NewStorageError("create temp directory", err, options.TempDir))
+			}
+		}
+	}
+
+	retryManager := d.retryManagerFor(options)
+
+	for attempt := 0; ; attempt++ {
+		err = d.writeRange(ctx, url, target, options, stats)
+		if err == nil || ctx.Err() != nil || attempt >= retryManager.MaxRetries {
+			break
+		}
+
+		decision := retryDecision(options, err, attempt+1)
+		if !decision.Retry {
+			break
+		}
+
+		delay := retryManager.DelayFor(err, attempt)
+		if decision.Delay > 0 {
+			delay = decision.Delay
+		}
+
+		if options.RetryCallback != nil {
+			options.RetryCallback(attempt+1, err, delay)
+		}
+
+		d.logInfo("range_retry", "Retrying range download", map[string]interface{}{
+			"attempt": attempt + 1,
+			"error":   err.Error(),
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = errors.WrapError(ctx.Err(), errors.CodeCancelled, "Download cancelled")
+		case <-timer.C:
+			stats.Retries++
+			continue
+		}
+
+		break
+	}
+
+	stats.Filename = destination
+
+	if err != nil {
+		if target != destination {
+			_ = os.Remove(target)
+		}
+
+		return fail(d.wrapDownloadError(err, url, destination, stats.BytesDownloaded, stats.TotalSize))
+	}
+
+	if target != destination {
+		if err := moveFile(target, destination); err != nil {
+			return fail(errors.NewStorageError("rename part file", err, destination))
+		}
+	}
+
+	stats.Success = true
+	stats.Error = nil
+	stats.EndTime = time.Now()
+	stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+	if stats.Duration > 0 {
+		stats.AverageSpeed = int64(float64(stats.BytesDownloaded) / stats.Duration.Seconds())
+	}
+
+	return stats, nil
+}
+
+// writeRange makes one attempt at downloading options.ByteRange of url to
+// path, replacing its content.
+func (d *Downloader) writeRange(
+	ctx context.Context,
+	url, path string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) error {
+	// #nosec G304 -- path is the destination, or its part file, validated by the caller
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.WrapErrorWithURL(err, errors.CodePermissionDenied,
+			"Failed to create destination file", url)
+	}
+
+	attempt, err := d.DownloadToWriter(ctx, url, d.guardSpace(file, path, options), options)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = errors.NewStorageError("close file", closeErr, path)
+	}
+
+	if attempt != nil {
+		stats.BytesDownloaded = attempt.BytesDownloaded
+		stats.TotalSize = attempt.TotalSize
+		stats.Connections = attempt.Connections
+	}
+
+	return err
+}
+
+// rangeBody returns the part of body, the response to a request for r, that
+// holds the range, and its length (-1 if unknown). A 206 response must start
+// where r does; a 200 response means the server ignored the Range header, and
+// the range is cut out of the full body.
+func rangeBody(resp *http.Response, body io.Reader, r types.ByteRange, url string) (io.Reader, int64, error) {
+	if resp.StatusCode == http.StatusPartialContent {
+		contentRange := resp.Header.Get("Content-Range")
+
+		var start, end int64
+		if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &start, &end); err != nil ||
+			(r.Start >= 0 && start != r.Start) || end < start {
+			return nil, 0, errors.WrapErrorWithURL(errors.ErrRangeIgnored, errors.CodeServerError,
+				fmt.Sprintf("server sent %q for %s", contentRange, r), url)
+		}
+
+		return body, end - start + 1, nil
+	}
+
+	total := resp.ContentLength
+
+	skip := r.Start
+	if r.Start < 0 {
+		if total < 0 {
+			return nil, 0, errors.NewDownloadErrorWithDetails(errors.CodeServerError,
+				"Server does not support range requests",
+				fmt.Sprintf("cannot select %s of a response of unknown size", r))
+		}
+		skip = max(total+r.Start, 0)
+	}
+
+	length := r.Length()
+	if r.Start < 0 {
+		length = total - skip
+	} else if total >= 0 {
+		if skip >= total {
+			return nil, 0, errors.FromHTTPStatus(http.StatusRequestedRangeNotSatisfiable, url)
+		}
+		if length < 0 || skip+length > total {
+			length = total - skip
+		}
+	}
+
+	if _, err := io.CopyN(io.Discard, body, skip); err != nil {
+		if err == io.EOF {
+			return nil, 0, errors.FromHTTPStatus(http.StatusRequestedRangeNotSatisfiable, url)
+		}
+
+		return nil, 0, errors.WrapError(err, errors.CodeNetworkError, "Failed to read data")
+	}
+
+	if length >= 0 {
+		body = io.LimitReader(body, length)
+	}
+
+	return body, length, nil
+}
+
+// checkRangeLength fails a range download that ended before the range did.
+func checkRangeLength(received, length int64) error {
+	if length < 0 || received >= length {
+		return nil
+	}
+
+	return errors.NewDownloadErrorWithDetails(errors.CodeNetworkError, "Range download incomplete",
+		fmt.Sprintf("received %d of %d bytes", received, length))
+}
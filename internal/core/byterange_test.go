@@ -0,0 +1,122 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+var rangeContent = []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+// rangeServer serves rangeContent, honouring Range headers unless
+// ignoreRange is set.
+func rangeServer(ignoreRange bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ignoreRange {
+			w.Header().Set("Content-Length", strconv.Itoa(len(rangeContent)))
+			_, _ = w.Write(rangeContent)
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(rangeContent))
+	}))
+}
+
+func TestDownload_ByteRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		r     types.ByteRange
+		want  string
+		error bool
+	}{
+		{name: "first bytes", r: types.ByteRange{Start: 0, End: 9}, want: "0123456789"},
+		{name: "middle", r: types.ByteRange{Start: 10, End: 15}, want: "abcdef"},
+		{name: "open ended", r: types.ByteRange{Start: 30, End: -1}, want: "uvwxyz"},
+		{name: "suffix", r: types.ByteRange{Start: -4, End: -1}, want: "wxyz"},
+		{name: "end past the file", r: types.ByteRange{Start: 33, End: 100}, want: "xyz"},
+		{name: "start past the file", r: types.ByteRange{Start: 100, End: -1}, error: true},
+	}
+
+	for _, ignoreRange := range []bool{false, true} {
+		server := rangeServer(ignoreRange)
+
+		for _, tt := range tests {
+			t.Run(tt.name+"/ignoreRange="+strconv.FormatBool(ignoreRange), func(t *testing.T) {
+				dest := filepath.Join(t.TempDir(), "slice.bin")
+				options := &types.DownloadOptions{ByteRange: &tt.r, AtomicWrite: true, MaxRetries: 1}
+
+				stats, err := NewDownloader().Download(context.Background(), server.URL, dest, options)
+				if tt.error {
+					if err == nil {
+						t.Fatal("Download() succeeded, want an error")
+					}
+
+					if _, statErr := os.Stat(PartFilePath(dest, "")); !os.IsNotExist(statErr) {
+						t.Error("part file left behind after a failed range download")
+					}
+
+					return
+				}
+
+				if err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+
+				got, _ := os.ReadFile(dest) // #nosec G304 -- test file
+				if string(got) != tt.want {
+					t.Errorf("content = %q, want %q", got, tt.want)
+				}
+
+				if stats.BytesDownloaded != int64(len(tt.want)) {
+					t.Errorf("BytesDownloaded = %d, want %d", stats.BytesDownloaded, len(tt.want))
+				}
+			})
+		}
+
+		server.Close()
+	}
+}
+
+func TestDownloadToWriter_ByteRange(t *testing.T) {
+	server := rangeServer(false)
+	defer server.Close()
+
+	var buf bytes.Buffer
+
+	options := &types.DownloadOptions{ByteRange: &types.ByteRange{Start: 5, End: 9}}
+	if _, err := NewDownloader().DownloadToWriter(context.Background(), server.URL, &buf, options); err != nil {
+		t.Fatalf("DownloadToWriter() error = %v", err)
+	}
+
+	if buf.String() != "56789" {
+		t.Errorf("content = %q, want %q", buf.String(), "56789")
+	}
+}
+
+func TestDownloadToWriter_ByteRangeMismatch(t *testing.T) {
+	// A server answering with a different slice than requested
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-4/36")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(rangeContent[:5])
+	}))
+	defer server.Close()
+
+	options := &types.DownloadOptions{ByteRange: &types.ByteRange{Start: 5, End: 9}, MaxRetries: 1}
+
+	_, err := NewDownloader().DownloadToWriter(context.Background(), server.URL, &bytes.Buffer{}, options)
+	if !stdErrors.Is(err, errors.ErrRangeIgnored) {
+		t.Errorf("DownloadToWriter() error = %v, want ErrRangeIgnored", err)
+	}
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// wantsChecksum reports whether options ask for the digest of the download.
+func wantsChecksum(options *types.DownloadOptions) bool {
+	return options.Checksum != "" || options.ChecksumAlgorithm != ""
+}
+
+// streamHash writes to a download's destination and hashes what is written,
+// so the digest is known when the transfer ends without reading the file
+// again.
+type streamHash struct {
+	w    io.Writer
+	hash hash.Hash
+}
+
+// hashStream wraps w, the writer for the file at path that already holds
+// offset bytes of the download, to hash the download as it is written when
+// options ask for its digest. The offset bytes already there are hashed
+// first. It returns w and a nil streamHash when no digest is wanted, or when
+// they cannot be read, leaving the hashing to checkChecksum.
+func (d *Downloader) hashStream(w io.Writer, path string, offset int64, options *types.DownloadOptions) (io.Writer, *streamHash) {
+	if !wantsChecksum(options) {
+		return w, nil
+	}
+
+	h, err := checksum.New(options.ChecksumAlgorithm)
+	if err != nil {
+		return w, nil
+	}
+
+	if offset > 0 {
+		// #nosec G304 -- the destination being downloaded to
+		file, err := os.Open(path)
+		if err != nil {
+			return w, nil
+		}
+		defer func() { _ = file.Close() }()
+
+		if _, err := io.CopyN(h, file, offset); err != nil {
+			d.logError("checksum_prefix", err, map[string]interface{}{"path": path})
+			return w, nil
+		}
+	}
+
+	s := &streamHash{w: w, hash: h}
+
+	return s, s
+}
+
+// Write writes p and hashes the part of it written.
+func (s *streamHash) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	_, _ = s.hash.Write(p[:n])
+
+	return n, err
+}
+
+// record stores the digest of what was written in stats when the download
+// ended without err. It does nothing on a nil streamHash.
+func (s *streamHash) record(stats *types.DownloadStats, err error) {
+	if s == nil || stats == nil || err != nil {
+		return
+	}
+
+	stats.Checksum = hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// checkChecksum computes the digest of the completed download at path, unless
+// it was hashed while being written, records it in result
+// and compares it with options.Checksum. A file that does not match is
+// deleted so it cannot be mistaken for a good download.
+func (d *Downloader) checkChecksum(url, path string, options *types.DownloadOptions, result *types.DownloadStats) error {
+	if !wantsChecksum(options) {
+		return nil
+	}
+
+	fail := func(err error) error {
+		result.Success = false
+		result.Error = err
+
+		return err
+	}
+
+	algorithm, err := checksum.Normalize(options.ChecksumAlgorithm)
+	if err != nil {
+		return fail(err)
+	}
+
+	if result.Checksum == "" {
+		digest, err := checksum.File(path, algorithm)
+		if err != nil {
+			return fail(errors.NewStorageError("hash file", err, path))
+		}
+
+		result.Checksum = digest
+	}
+
+	if options.Checksum == "" {
+		return nil
+	}
+
+	expected, err := checksum.NormalizeDigest(algorithm, options.Checksum)
+	if err != nil {
+		return fail(err)
+	}
+
+	if result.Checksum != expected {
+		if removeErr := os.Remove(path); removeErr != nil && !os.IsNotExist(removeErr) {
+			d.logError("checksum_cleanup", removeErr, map[string]interface{}{"path": path})
+		}
+
+		return fail(errors.WrapErrorWithURL(errors.ErrChecksumMismatch, errors.CodeCorruptedData,
+			fmt.Sprintf("Downloaded file does not match its checksum: %s %s, expected %s",
+				algorithm, result.Checksum, expected), url))
+	}
+
+	d.logInfo("checksum_verified", "Downloaded file matches its checksum", map[string]interface{}{
+		"url":       url,
+		"algorithm": algorithm,
+	})
+
+	return nil
+}
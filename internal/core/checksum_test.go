@@ -0,0 +1,161 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_Checksum(t *testing.T) {
+	content := mirrorTestData(256 * 1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	digest := func(algorithm string) string {
+		sum, err := checksum.Reader(bytes.NewReader(content), algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return sum
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		checksum  string
+		atomic    bool
+		wantErr   bool
+	}{
+		{"sha256 by default", "", digest(checksum.SHA256), false, false},
+		{"blake3", checksum.BLAKE3, strings.ToUpper(digest(checksum.BLAKE3)), true, false},
+		{"xxh3", checksum.XXH3, digest(checksum.XXH3), false, false},
+		{"report only", checksum.SHA512, "", false, false},
+		{"mismatch", checksum.XXH3, "0123456789abcdef", false, true},
+		{"mismatch atomic", checksum.BLAKE3, digest(checksum.SHA256), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "file.bin")
+
+			stats, err := NewDownloader().Download(context.Background(), server.URL+"/file.bin", dest,
+				&types.DownloadOptions{
+					Checksum:          tt.checksum,
+					ChecksumAlgorithm: tt.algorithm,
+					AtomicWrite:       tt.atomic,
+				})
+
+			if tt.wantErr {
+				if !stdErrors.Is(err, errors.ErrChecksumMismatch) || errors.IsRetryable(err) {
+					t.Fatalf("Download() error = %v, want a non-retryable ErrChecksumMismatch", err)
+				}
+				if _, statErr := os.Stat(dest); !os.IsNotExist(statErr) {
+					t.Error("a file failing its checksum was left behind")
+				}
+				if _, statErr := os.Stat(PartFilePath(dest, "")); !os.IsNotExist(statErr) {
+					t.Error("part file left behind")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			algorithm, _ := checksum.Normalize(tt.algorithm)
+			if stats.Checksum != digest(algorithm) {
+				t.Errorf("Checksum = %s, want %s", stats.Checksum, digest(algorithm))
+			}
+		})
+	}
+}
+
+func TestDownloader_ChecksumMultiSource(t *testing.T) {
+	data := mirrorTestData(4 * 1024 * 1024)
+
+	primary := newMirrorServer(t, data, 0, nil)
+	mirror := newMirrorServer(t, data, 0, nil)
+
+	want, err := checksum.Reader(bytes.NewReader(data), checksum.BLAKE3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	stats, err := NewDownloader().Download(context.Background(), primary.URL+"/file.bin", dest,
+		&types.DownloadOptions{
+			Mirrors:           []string{mirror.URL + "/file.bin"},
+			Checksum:          want,
+			ChecksumAlgorithm: "BLAKE3",
+		})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if stats.Checksum != want {
+		t.Errorf("Checksum = %s, want %s", stats.Checksum, want)
+	}
+}
+
+func TestDownloader_ChecksumWhileStreaming(t *testing.T) {
+	content := mirrorTestData(512 * 1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	want, err := checksum.Reader(bytes.NewReader(content), checksum.XXH3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileInfo := &types.FileInfo{Size: int64(len(content)), SupportsRanges: true}
+	options := &types.DownloadOptions{ChecksumAlgorithm: checksum.XXH3}
+
+	// The digest is known before checkDownload, which would hash the file
+	// again without it
+	t.Run("single", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "file.bin")
+
+		stats, err := NewDownloader().performSingleDownload(context.Background(), server.URL, dest, options, fileInfo)
+		if err != nil {
+			t.Fatalf("performSingleDownload() error = %v", err)
+		}
+		if stats.Checksum != want {
+			t.Errorf("Checksum = %s, want %s", stats.Checksum, want)
+		}
+	})
+
+	t.Run("resumed", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "file.bin")
+		if err := os.WriteFile(dest, content[:100000], 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		stats, err := NewDownloader().performResumeDownload(context.Background(), server.URL, dest, options, fileInfo)
+		if err != nil {
+			t.Fatalf("performResumeDownload() error = %v", err)
+		}
+		if stats.Checksum != want {
+			t.Errorf("Checksum = %s, want %s", stats.Checksum, want)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// maxRenameAttempts bounds the numeric suffixes tried by CollisionRename.
+const maxRenameAttempts = 10000
+
+// ValidateCollisionPolicy checks a DownloadOptions.CollisionPolicy value.
+func ValidateCollisionPolicy(policy string) error {
+	switch policy {
+	case "", types.CollisionFail, types.CollisionOverwrite, types.CollisionSkip,
+		types.CollisionRename, types.CollisionResume:
+		return nil
+	default:
+		return errors.NewValidationError("collision_policy",
+			fmt.Sprintf("unknown collision policy %q: expected %s, %s, %s, %s or %s", policy,
+				types.CollisionFail, types.CollisionOverwrite, types.CollisionSkip,
+				types.CollisionRename, types.CollisionResume))
+	}
+}
+
+// ResolveCollision applies options.CollisionPolicy to destination before a
+// download. It returns the path to download to, empty when the existing file
+// is kept, and options in which the policy has been turned into
+// OverwriteExisting and Resume. CollisionRename creates the new file empty,
+// so that concurrent downloads to the same destination pick different names.
+func ResolveCollision(destination string, options *types.DownloadOptions) (string, *types.DownloadOptions, error) {
+	if options.CollisionPolicy == "" {
+		return destination, options, nil
+	}
+
+	if err := ValidateCollisionPolicy(options.CollisionPolicy); err != nil {
+		return "", nil, err
+	}
+
+	resolved := *options
+	resolved.CollisionPolicy = ""
+
+	info, err := os.Stat(destination)
+	if os.IsNotExist(err) {
+		return destination, &resolved, nil
+	}
+
+	if err != nil {
+		return "", nil, errors.WrapError(err, errors.CodePermissionDenied, "Failed to check file existence")
+	}
+
+	switch options.CollisionPolicy {
+	case types.CollisionFail:
+		return "", nil, errors.NewDownloadErrorWithDetails(errors.CodeFileExists,
+			"File already exists", fmt.Sprintf("File exists at: %s", destination))
+	case types.CollisionOverwrite:
+		resolved.OverwriteExisting = true
+		resolved.Resume = false
+	case types.CollisionSkip:
+		return "", options, nil
+	case types.CollisionRename:
+		renamed, err := reserveFreeName(destination)
+		if err != nil {
+			return "", nil, err
+		}
+
+		destination = renamed
+		resolved.OverwriteExisting = true
+		resolved.Resume = false
+	case types.CollisionResume:
+		// An empty file or a directory is not a partial download
+		resolved.Resume = info.Mode().IsRegular() && info.Size() > 0
+		resolved.OverwriteExisting = !resolved.Resume
+	}
+
+	return destination, &resolved, nil
+}
+
+// reserveFreeName creates the first of "name-1.ext", "name-2.ext"... next to
+// destination that does not exist yet, and returns its path.
+func reserveFreeName(destination string) (string, error) {
+	dir, file := filepath.Split(destination)
+	stem, ext := splitExt(file)
+
+	for n := 1; n <= maxRenameAttempts; n++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, n, ext))
+
+		// #nosec G304 -- candidate is derived from the validated destination
+		file, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			_ = file.Close()
+			return candidate, nil
+		}
+
+		if !os.IsExist(err) {
+			return "", errors.NewStorageError("create renamed file", err, candidate)
+		}
+	}
+
+	return "", errors.NewDownloadErrorWithDetails(errors.CodeFileExists, "File already exists",
+		fmt.Sprintf("no free name found for %s after %d attempts", destination, maxRenameAttempts))
+}
+
+// splitExt splits a file name before its extension, keeping compound
+// extensions such as ".tar.gz" together.
+func splitExt(name string) (string, string) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	if inner := filepath.Ext(stem); strings.EqualFold(inner, ".tar") {
+		stem = strings.TrimSuffix(stem, inner)
+		ext = inner + ext
+	}
+
+	// A dotfile such as ".bashrc" has no extension
+	if stem == "" {
+		return name, ""
+	}
+
+	return stem, ext
+}
+
+// skipExisting finishes stats for a download skipped because its destination
+// exists.
+func (d *Downloader) skipExisting(destination string, stats *types.DownloadStats) *types.DownloadStats {
+	d.logInfo("skip_existing", "Destination exists, skipping download", map[string]interface{}{
+		"destination": destination,
+	})
+
+	if info, err := os.Stat(destination); err == nil {
+		stats.TotalSize = info.Size()
+	}
+
+	stats.Success = true
+	stats.Skipped = true
+	stats.EndTime = time.Now()
+	stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+	return stats
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	stdErrors "errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownload_CollisionPolicy(t *testing.T) {
+	server := rangeServer(false)
+	defer server.Close()
+
+	tests := []struct {
+		policy   string
+		existing string
+		wantFile string
+		want     string
+		skipped  bool
+		fails    bool
+	}{
+		{policy: types.CollisionOverwrite, existing: "old", wantFile: "file.bin", want: string(rangeContent)},
+		{policy: types.CollisionSkip, existing: "old", wantFile: "file.bin", want: "old", skipped: true},
+		{policy: types.CollisionRename, existing: "old", wantFile: "file-1.bin", want: string(rangeContent)},
+		{policy: types.CollisionResume, existing: string(rangeContent[:10]), wantFile: "file.bin", want: string(rangeContent)},
+		{policy: types.CollisionResume, existing: string(rangeContent), wantFile: "file.bin", want: string(rangeContent)},
+		{policy: types.CollisionFail, existing: "old", fails: true},
+		{policy: types.CollisionSkip, wantFile: "file.bin", want: string(rangeContent)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy+"/"+tt.existing, func(t *testing.T) {
+			dir := t.TempDir()
+			dest := filepath.Join(dir, "file.bin")
+
+			if tt.existing != "" {
+				if err := os.WriteFile(dest, []byte(tt.existing), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// OverwriteExisting is ignored once a policy is set
+			options := &types.DownloadOptions{CollisionPolicy: tt.policy, OverwriteExisting: true, AtomicWrite: true}
+
+			stats, err := NewDownloader().Download(context.Background(), server.URL, dest, options)
+			if tt.fails {
+				var downloadErr *errors.DownloadError
+				if !stdErrors.As(err, &downloadErr) || downloadErr.Code != errors.CodeFileExists {
+					t.Fatalf("Download() error = %v, want CodeFileExists", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			wantPath := filepath.Join(dir, tt.wantFile)
+			if stats.Filename != wantPath {
+				t.Errorf("stats.Filename = %q, want %q", stats.Filename, wantPath)
+			}
+
+			if stats.Skipped != tt.skipped {
+				t.Errorf("stats.Skipped = %v, want %v", stats.Skipped, tt.skipped)
+			}
+
+			got, _ := os.ReadFile(wantPath) // #nosec G304 -- test file
+			if string(got) != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+
+			if tt.policy == types.CollisionRename {
+				if old, _ := os.ReadFile(dest); string(old) != tt.existing { // #nosec G304 -- test file
+					t.Errorf("renamed download changed the existing file to %q", old)
+				}
+			}
+		})
+	}
+}
+
+func TestDownload_CollisionRenameConcurrent(t *testing.T) {
+	server := rangeServer(false)
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "app.tar.gz")
+	if err := os.WriteFile(dest, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 3)
+
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			options := &types.DownloadOptions{CollisionPolicy: types.CollisionRename}
+			if stats, err := NewDownloader().Download(context.Background(), server.URL, dest, options); err == nil {
+				names[i] = filepath.Base(stats.Filename)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] || name == "" {
+			t.Fatalf("names = %v, want three different names", names)
+		}
+		seen[name] = true
+	}
+
+	for _, want := range []string{"app-1.tar.gz", "app-2.tar.gz", "app-3.tar.gz"} {
+		if !seen[want] {
+			t.Errorf("names = %v, missing %s", names, want)
+		}
+	}
+}
+
+func TestValidateCollisionPolicy(t *testing.T) {
+	if err := ValidateCollisionPolicy(types.CollisionRename); err != nil {
+		t.Errorf("ValidateCollisionPolicy(rename) error = %v", err)
+	}
+
+	if err := ValidateCollisionPolicy("clobber"); err == nil {
+		t.Error("ValidateCollisionPolicy(clobber) should fail")
+	}
+}
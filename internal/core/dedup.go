@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/forest6511/gdl/internal/cas"
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// downloadDeduplicated places content already held by the content store at
+// destination, looking it up by the expected digest or by the URL and its
+// current ETag. Otherwise the file is downloaded and added to the store; a
+// download that does not match the expected digest is deleted and fails with
+// CodeCorruptedData instead.
+func (d *Downloader) downloadDeduplicated(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) (*types.DownloadStats, error) {
+	store, err := cas.Open(options.ContentStore.Dir)
+	if err != nil {
+		stats.Error = err
+		return stats, err
+	}
+
+	expected := ""
+	if options.ContentStore.SHA256 != "" {
+		if expected, err = cas.NormalizeHash(options.ContentStore.SHA256); err != nil {
+			stats.Error = err
+			return stats, err
+		}
+
+		if d.placeFromStore(store, expected, destination, options, stats) {
+			return stats, nil
+		}
+	}
+
+	etag := d.remoteETag(ctx, url, options)
+	if hash, found := store.Lookup(url, etag); found && hash != expected {
+		if d.placeFromStore(store, hash, destination, options, stats) {
+			return stats, nil
+		}
+	}
+
+	result, err := d.fetch(ctx, url, destination, options, stats)
+	if err != nil || result.NotModified {
+		return result, err
+	}
+
+	hash, err := checksum.File(destination, checksum.SHA256)
+	if err != nil {
+		d.logError("content_store_add", err, map[string]interface{}{"destination": destination})
+		return result, nil
+	}
+
+	// Content that is not what was asked for must not be indexed under its URL
+	if expected != "" && hash != expected {
+		if removeErr := os.Remove(destination); removeErr != nil && !os.IsNotExist(removeErr) {
+			d.logError("content_hash_cleanup", removeErr, map[string]interface{}{"path": destination})
+		}
+
+		err := errors.WrapErrorWithURL(errors.ErrChecksumMismatch, errors.CodeCorruptedData,
+			fmt.Sprintf("Downloaded content does not match the expected SHA-256: %s, expected %s", hash, expected), url)
+		result.Success = false
+		result.Error = err
+
+		return result, err
+	}
+
+	if err := store.AddHashed(destination, hash, url, etag); err != nil {
+		d.logError("content_store_add", err, map[string]interface{}{"destination": destination})
+	}
+
+	return result, nil
+}
+
+// placeFromStore materializes the object with the given digest at destination
+// and fills in stats. It reports whether the download can be skipped.
+func (d *Downloader) placeFromStore(
+	store *cas.Store,
+	hash, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) bool {
+	if !store.Has(hash) {
+		return false
+	}
+
+	size, err := store.Materialize(hash, destination, options.ContentStore.HardLink)
+	if err != nil {
+		d.logError("content_store_reuse", err, map[string]interface{}{"sha256": hash})
+		return false
+	}
+
+	d.logInfo("deduplicated", "Placed content from the content store", map[string]interface{}{
+		"sha256":      hash,
+		"destination": destination,
+	})
+
+	stats.TotalSize = size
+	stats.Success = true
+	stats.Deduplicated = true
+	stats.EndTime = time.Now()
+	stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+	return true
+}
+
+// remoteETag returns the ETag the server currently reports for url, or an
+// empty string if it cannot be determined.
+func (d *Downloader) remoteETag(ctx context.Context, url string, options *types.DownloadOptions) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return ""
+	}
+
+	d.setRequestHeaders(req, options)
+
+	resp, err := d.clientFor(options).Do(req)
+	if err != nil {
+		d.logInfo("content_store_head_failed", "HEAD request failed, downloading", map[string]interface{}{
+			"error": err.Error(),
+		})
+
+		return ""
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	return resp.Header.Get("ETag")
+}
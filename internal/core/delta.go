@@ -0,0 +1,291 @@
+package core
+
+import (
+	"context"
+	"crypto/sha1" // #nosec G505 -- SHA-1 is the whole-file checksum of the zsync format
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/forest6511/gdl/internal/zsync"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// maxControlSize bounds how much of a remote zsync control file is read. The
+// block checksums of a 10 GB image take about 30 MB.
+const maxControlSize = 256 << 20
+
+// downloadDelta updates destination from the zsync control file in
+// options.Delta: the blocks the seed already holds are copied from it, the
+// others are downloaded from url with range requests, and the result must
+// match the control file's SHA-1 before it replaces destination. When the
+// control file or the seed cannot be read, or the update fails, the whole
+// file is downloaded instead.
+func (d *Downloader) downloadDelta(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) (*types.DownloadStats, error) {
+	control, err := d.loadControl(ctx, options)
+	if err != nil {
+		return d.deltaFallback(ctx, url, destination, options, stats, err)
+	}
+
+	seedPath := options.Delta.Seed
+	if seedPath == "" {
+		seedPath = destination
+	}
+
+	// #nosec G304 -- the seed is the destination or a file chosen by the user
+	seed, err := os.Open(seedPath)
+	if err != nil {
+		return d.deltaFallback(ctx, url, destination, options, stats, err)
+	}
+	defer func() { _ = seed.Close() }()
+
+	offsets, err := control.Match(seed)
+	if err != nil {
+		return d.deltaFallback(ctx, url, destination, options, stats, err)
+	}
+
+	fail := func(err error) (*types.DownloadStats, error) {
+		stats.Success = false
+		stats.Error = err
+		stats.EndTime = time.Now()
+		stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+		return stats, err
+	}
+
+	if options.CreateDirs {
+		if err := d.createParentDirs(destination); err != nil {
+			return fail(errors.WrapErrorWithURL(err, errors.CodePermissionDenied,
+				"Failed to create parent directories", url))
+		}
+	}
+
+	if options.TempDir != "" {
+		if err := os.MkdirAll(options.TempDir, 0o750); err != nil {
+			return fail(errors.NewStorageError("create temp directory", err, options.TempDir))
+		}
+	}
+
+	releaseQuota, err := d.reserveQuota(destination, control.Length, options)
+	if err != nil {
+		return fail(d.wrapDownloadError(err, url, destination, 0, 0))
+	}
+	defer releaseQuota()
+
+	part := PartFilePath(destination, options.TempDir)
+
+	if err := d.assembleDelta(ctx, url, part, control, offsets, seed, options, stats); err != nil {
+		_ = os.Remove(part)
+
+		if ctx.Err() != nil {
+			return fail(errors.WrapError(ctx.Err(), errors.CodeCancelled, "Download cancelled"))
+		}
+
+		return d.deltaFallback(ctx, url, destination, options, stats, err)
+	}
+
+	d.logInfo("delta_update", "Updated file from its zsync control file", map[string]interface{}{
+		"url":        url,
+		"reused":     stats.DeltaReused,
+		"downloaded": stats.BytesDownloaded,
+	})
+
+	stats.Filename = destination
+	stats.TotalSize = control.Length
+	stats.LastModified = control.MTime
+	stats.Success = true
+	stats.Error = nil
+	stats.EndTime = time.Now()
+	stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+	if stats.Duration > 0 {
+		stats.AverageSpeed = int64(float64(stats.BytesDownloaded) / stats.Duration.Seconds())
+	}
+
+	// A part file failing verification never replaces the destination
+	if err := d.checkDownload(ctx, url, part, destination, options, stats); err != nil {
+		return stats, err
+	}
+
+	if err := moveFile(part, destination); err != nil {
+		return fail(errors.NewStorageError("rename part file", err, destination))
+	}
+
+	d.applyMetadata(url, destination, options, stats)
+
+	return stats, nil
+}
+
+// deltaFallback downloads the whole file after a delta update could not be
+// made for the reason in cause. The destination is replaced, as the delta
+// update would have done.
+func (d *Downloader) deltaFallback(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+	cause error,
+) (*types.DownloadStats, error) {
+	d.logInfo("delta_fallback", "Delta update not possible, downloading the whole file", map[string]interface{}{
+		"url":   url,
+		"error": cause.Error(),
+	})
+
+	stats.BytesDownloaded = 0
+	stats.DeltaReused = 0
+
+	fullOptions := *options
+	fullOptions.Delta = nil
+	fullOptions.OverwriteExisting = true
+
+	return d.fetch(ctx, url, destination, &fullOptions, stats)
+}
+
+// assembleDelta writes the target file to path: the blocks found in seed at
+// offsets are copied from it and consecutive missing blocks are downloaded
+// from url with one range request each. The file is then checked against the
+// control file's SHA-1.
+func (d *Downloader) assembleDelta(
+	ctx context.Context,
+	url, path string,
+	control *zsync.Control,
+	offsets []int64,
+	seed io.ReaderAt,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) error {
+	// #nosec G304 -- path is the part file of the destination
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.NewStorageError("create part file", err, path)
+	}
+	defer func() { _ = file.Close() }()
+
+	if err := file.Truncate(control.Length); err != nil {
+		return errors.NewStorageError("allocate part file", err, path)
+	}
+
+	var missing []types.ByteRange
+
+	block := make([]byte, control.BlockSize)
+
+	for i, offset := range offsets {
+		start, end := control.BlockRange(i)
+
+		if offset < 0 {
+			if n := len(missing); n > 0 && missing[n-1].End+1 == start {
+				missing[n-1].End = end
+			} else {
+				missing = append(missing, types.ByteRange{Start: start, End: end})
+			}
+
+			continue
+		}
+
+		// The last block may have matched the zero padding past the seed's end
+		data := block[:end-start+1]
+		n, err := seed.ReadAt(data, offset)
+		if err != nil && err != io.EOF {
+			return errors.NewStorageError("read seed", err, path)
+		}
+		clear(data[n:])
+
+		if _, err := file.WriteAt(data, start); err != nil {
+			return errors.NewStorageError("write part file", err, path)
+		}
+
+		stats.DeltaReused += int64(len(data))
+	}
+
+	reportProgress := func() {
+		if options.ProgressCallback != nil {
+			options.ProgressCallback(stats.DeltaReused+stats.BytesDownloaded, control.Length, 0)
+		}
+	}
+	reportProgress()
+
+	for _, byteRange := range missing {
+		rangeOptions := *options
+		rangeOptions.ByteRange = &byteRange
+		rangeOptions.Delta = nil
+		rangeOptions.Progress = nil
+		rangeOptions.ProgressCallback = nil
+
+		attempt, err := d.DownloadToWriter(ctx, url, io.NewOffsetWriter(file, byteRange.Start), &rangeOptions)
+		if attempt != nil {
+			stats.BytesDownloaded += attempt.BytesDownloaded
+			stats.Retries += attempt.Retries
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := checkRangeLength(attempt.BytesDownloaded, byteRange.Length()); err != nil {
+			return err
+		}
+
+		reportProgress()
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return errors.NewStorageError("read part file", err, path)
+	}
+
+	hash := sha1.New() // #nosec G401 -- required by the format
+	if _, err := io.Copy(hash, file); err != nil {
+		return errors.NewStorageError("read part file", err, path)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != control.SHA1 {
+		return errors.NewDownloadErrorWithDetails(errors.CodeCorruptedData,
+			"Delta update does not match the control file",
+			"SHA-1 "+sum+", expected "+control.SHA1)
+	}
+
+	return nil
+}
+
+// loadControl reads and parses the zsync control file in options.Delta,
+// fetching it when it is given as an http(s) URL.
+func (d *Downloader) loadControl(ctx context.Context, options *types.DownloadOptions) (*zsync.Control, error) {
+	location := options.Delta.Control
+
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		// #nosec G304 -- the control file path is chosen by the user
+		file, err := os.Open(location)
+		if err != nil {
+			return nil, errors.NewStorageError("open zsync control file", err, location)
+		}
+		defer func() { _ = file.Close() }()
+
+		return zsync.ParseControl(file)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, errors.WrapErrorWithURL(err, errors.CodeInvalidURL, "Invalid zsync control file URL", location)
+	}
+
+	d.setRequestHeaders(req, options)
+
+	resp, err := d.clientFor(options).Do(req)
+	if err != nil {
+		return nil, errors.WrapErrorWithURL(err, errors.CodeNetworkError, "Failed to fetch zsync control file", location)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpStatusError(resp, location)
+	}
+
+	return zsync.ParseControl(io.LimitReader(resp.Body, maxControlSize))
+}
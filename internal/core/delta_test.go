@@ -0,0 +1,168 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/zsync"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_DeltaUpdate(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+
+	target := make([]byte, 256*1024)
+	random.Read(target)
+
+	// Yesterday's image differs in two places and is a little longer
+	old := bytes.Clone(target)
+	random.Read(old[50000:52000])
+	random.Read(old[200000:201000])
+	old = append(old, []byte("trailing data")...)
+
+	var control bytes.Buffer
+	mtime := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := zsync.Generate(&control, bytes.NewReader(target), "image.bin", "image.bin", mtime, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	var rangeRequests, fullRequests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.bin.zsync":
+			_, _ = w.Write(control.Bytes())
+		case "/image.bin":
+			if r.Header.Get("Range") != "" {
+				rangeRequests.Add(1)
+			} else if r.Method == http.MethodGet {
+				fullRequests.Add(1)
+			}
+			http.ServeContent(w, r, "image.bin", mtime, bytes.NewReader(target))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		control    string
+		seed       bool
+		wantDelta  bool
+		wantRanges bool
+	}{
+		{"delta update", server.URL + "/image.bin.zsync", true, true, true},
+		{"control file missing", server.URL + "/missing.zsync", true, false, false},
+		{"no local copy", server.URL + "/image.bin.zsync", false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rangeRequests.Store(0)
+			fullRequests.Store(0)
+
+			dest := filepath.Join(t.TempDir(), "image.bin")
+			if tt.seed {
+				if err := os.WriteFile(dest, old, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stats, err := NewDownloader().Download(context.Background(), server.URL+"/image.bin", dest,
+				&types.DownloadOptions{Delta: &types.DeltaOptions{Control: tt.control}, MaxConcurrency: 1})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			got, _ := os.ReadFile(dest) // #nosec G304 -- test file
+			if !bytes.Equal(got, target) {
+				t.Fatalf("content differs from the target (%d bytes, want %d)", len(got), len(target))
+			}
+
+			if tt.wantDelta {
+				if stats.DeltaReused < int64(len(target))*9/10 || stats.BytesDownloaded > int64(len(target))/10 {
+					t.Errorf("reused %d and downloaded %d bytes of %d", stats.DeltaReused, stats.BytesDownloaded, len(target))
+				}
+				if stats.DeltaReused+stats.BytesDownloaded != int64(len(target)) {
+					t.Errorf("reused %d + downloaded %d != %d", stats.DeltaReused, stats.BytesDownloaded, len(target))
+				}
+				if fullRequests.Load() != 0 {
+					t.Error("the whole file was downloaded")
+				}
+
+				if info, err := os.Stat(dest); err != nil || !info.ModTime().Equal(mtime) {
+					t.Errorf("mtime = %v, want the control file's %v", info.ModTime(), mtime)
+				}
+			} else if stats.DeltaReused != 0 || fullRequests.Load() != 1 {
+				t.Errorf("reused %d bytes in %d full requests, want a full download", stats.DeltaReused, fullRequests.Load())
+			}
+
+			if got := rangeRequests.Load() > 0; got != tt.wantRanges {
+				t.Errorf("range requests made = %v, want %v", got, tt.wantRanges)
+			}
+
+			if _, err := os.Stat(PartFilePath(dest, "")); !os.IsNotExist(err) {
+				t.Error("part file left behind")
+			}
+		})
+	}
+}
+
+func TestDownloader_DeltaUpdateMismatch(t *testing.T) {
+	random := rand.New(rand.NewSource(4))
+
+	target := make([]byte, 32*1024)
+	random.Read(target)
+
+	previous := make([]byte, len(target))
+	random.Read(previous)
+
+	// A stale control file that describes other content than the server
+	// sends yields a file that fails its SHA-1 check once the blocks missing
+	// from the seed are downloaded, so the whole file is downloaded
+	var control bytes.Buffer
+	if err := zsync.Generate(&control, bytes.NewReader(previous), "", "", time.Time{}, 512); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := bytes.Clone(previous)
+	copy(seed[10000:], bytes.Repeat([]byte{0xff}, 2000))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(target))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	controlPath := filepath.Join(dir, "file.bin.zsync")
+	dest := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(controlPath, control.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest, seed, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := NewDownloader().Download(context.Background(), server.URL, dest,
+		&types.DownloadOptions{Delta: &types.DeltaOptions{Control: controlPath}})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, target) { // #nosec G304 -- test file
+		t.Error("content differs from the target")
+	}
+
+	if stats.DeltaReused != 0 {
+		t.Errorf("DeltaReused = %d after a fallback, want 0", stats.DeltaReused)
+	}
+}
@@ -0,0 +1,295 @@
+package core
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// minDestinationPiece is the smallest piece a download to a Destination is
+// split into; smaller files are fetched in one request.
+const minDestinationPiece = 1024 * 1024
+
+// DownloadToDestination downloads url into dest. When the server supports
+// range requests the file is fetched in pieces over up to MaxConcurrency
+// connections, each written at its offset. The content is committed once the
+// download is complete; a failed download is aborted, or with Resume kept by
+// a ResumableDestination so that the next attempt fetches only the rest. A
+// resumed download is fetched in one request, so that what it keeps is
+// always a prefix of the file. The pieces of a download to a
+// PartedDestination start on its part boundaries. Progress is reported to
+// ProgressCallback.
+func (d *Downloader) DownloadToDestination(
+	ctx context.Context,
+	url string,
+	dest types.Destination,
+	options *types.DownloadOptions,
+) (*types.DownloadStats, error) {
+	if err := d.validateURL(url); err != nil {
+		return nil, err
+	}
+
+	if dest == nil {
+		return nil, errors.NewValidationError("destination", "destination cannot be nil")
+	}
+
+	if options == nil {
+		options = &types.DownloadOptions{}
+	}
+
+	d.setDefaultOptions(options)
+
+	stats := &types.DownloadStats{
+		URL:       url,
+		StartTime: time.Now(),
+	}
+
+	fail := func(err error) (*types.DownloadStats, error) {
+		stats.Success = false
+		stats.Error = err
+		stats.EndTime = time.Now()
+		stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+		return stats, err
+	}
+
+	exists, err := dest.Exists(ctx)
+	if err != nil {
+		return fail(errors.WrapError(err, errors.CodeStorageError, "Failed to check destination"))
+	}
+
+	if exists && !options.OverwriteExisting {
+		return fail(errors.NewDownloadError(errors.CodeFileExists, "Destination already exists"))
+	}
+
+	var resumable types.ResumableDestination
+	if options.Resume {
+		resumable, _ = dest.(types.ResumableDestination)
+	}
+
+	// Without a size the file is streamed in one request from the start
+	size := int64(-1)
+	ranges := false
+
+	if info, err := d.GetFileInfoWithOptions(ctx, url, options); err == nil && info.Size > 0 {
+		size = info.Size
+		ranges = info.SupportsRanges
+	}
+
+	var offset int64
+
+	if resumable != nil && ranges {
+		if written, err := resumable.Written(ctx); err == nil && written > 0 && written <= size {
+			offset = written
+			stats.Resumed = true
+		}
+	}
+
+	// What an earlier attempt left is discarded unless the download goes on
+	// from it
+	if offset == 0 {
+		if err := dest.Abort(ctx); err != nil {
+			return fail(errors.WrapError(err, errors.CodeStorageError, "Failed to clear destination"))
+		}
+	}
+
+	w, err := dest.CreateWriterAt(ctx, size)
+	if err != nil {
+		return fail(errors.WrapError(err, errors.CodeStorageError, "Failed to open destination"))
+	}
+
+	// The destination is cleaned up even when ctx was cancelled
+	cleanupCtx := context.WithoutCancel(ctx)
+	release := func() {
+		if resumable != nil {
+			_ = resumable.Suspend(cleanupCtx)
+		} else {
+			_ = dest.Abort(cleanupCtx)
+		}
+	}
+
+	// Pieces are whole parts, so that no part is filled by two connections
+	align := int64(1)
+	if parted, ok := dest.(types.PartedDestination); ok {
+		align = max(parted.PartSize(), 1)
+	}
+
+	if err := d.fillDestination(ctx, url, w, size, offset, align, ranges && resumable == nil, options, stats); err != nil {
+		release()
+
+		if ctx.Err() != nil {
+			return fail(errors.WrapError(ctx.Err(), errors.CodeCancelled, "Download cancelled"))
+		}
+
+		return fail(err)
+	}
+
+	if err := dest.Commit(ctx); err != nil {
+		release()
+
+		return fail(errors.WrapError(err, errors.CodeStorageError, "Failed to commit download"))
+	}
+
+	stats.TotalSize = size
+	if size < 0 {
+		stats.TotalSize = stats.BytesDownloaded
+	}
+
+	stats.Success = true
+	stats.EndTime = time.Now()
+	stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+	if stats.Duration > 0 {
+		stats.AverageSpeed = int64(float64(stats.BytesDownloaded) / stats.Duration.Seconds())
+	}
+
+	d.rememberThroughput(options, stats)
+
+	return stats, nil
+}
+
+// fillDestination writes the bytes of url from offset on into w, in pieces
+// of at least minDestinationPiece, and at least what the host is known to
+// serve in coalesceDuration, over up to MaxConcurrency connections when split
+// is set, in one request otherwise. Piece sizes are multiples of align. size
+// is -1 when unknown.
+func (d *Downloader) fillDestination(
+	ctx context.Context,
+	url string,
+	w io.WriterAt,
+	size, offset, align int64,
+	split bool,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) error {
+	if size >= 0 && offset >= size {
+		return nil
+	}
+
+	progress := &destinationProgress{
+		w:        w,
+		offset:   offset,
+		size:     size,
+		start:    stats.StartTime,
+		callback: options.ProgressCallback,
+	}
+
+	if size < 0 || (!split && offset == 0) {
+		pieceOptions := *options
+		pieceOptions.Progress = nil
+		pieceOptions.ProgressCallback = nil
+
+		attempt, err := d.DownloadToWriter(ctx, url, io.NewOffsetWriter(progress, 0), &pieceOptions)
+		addAttempt(stats, attempt)
+
+		if err != nil {
+			return err
+		}
+
+		return checkRangeLength(stats.BytesDownloaded, size)
+	}
+
+	remaining := size - offset
+
+	// Pieces a host is known to serve in less than coalesceDuration are not
+	// worth a request of their own
+	minPiece := max(minDestinationPiece, int64(float64(knownThroughput(hostCacheFor(options), url))*coalesceDuration.Seconds()))
+
+	pieces := int64(1)
+	if split {
+		pieces = max(min(int64(options.MaxConcurrency), remaining/minPiece), 1)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	pieceSize := (remaining + pieces - 1) / pieces
+	pieceSize = (pieceSize + align - 1) / align * align
+
+	for start := offset; start < size; start += pieceSize {
+		byteRange := types.ByteRange{Start: start, End: min(start+pieceSize, size) - 1}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			pieceOptions := *options
+			pieceOptions.ByteRange = &byteRange
+			pieceOptions.Progress = nil
+			pieceOptions.ProgressCallback = nil
+
+			attempt, err := d.DownloadToWriter(ctx, url, io.NewOffsetWriter(progress, byteRange.Start), &pieceOptions)
+			if err == nil {
+				err = checkRangeLength(attempt.BytesDownloaded, byteRange.Length())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			addAttempt(stats, attempt)
+
+			if err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+// addAttempt adds the transfer of one request to the stats of a download.
+func addAttempt(stats, attempt *types.DownloadStats) {
+	if attempt == nil {
+		return
+	}
+
+	stats.BytesDownloaded += attempt.BytesDownloaded
+	stats.Retries += attempt.Retries
+	stats.Connections = append(stats.Connections, attempt.Connections...)
+}
+
+// destinationProgress passes writes to a destination on and reports the
+// bytes written by all connections together to callback.
+type destinationProgress struct {
+	w        io.WriterAt
+	offset   int64 // Bytes kept from an earlier attempt
+	size     int64
+	start    time.Time
+	callback func(downloaded, total int64, speed int64)
+	written  atomic.Int64
+	mu       sync.Mutex // Serializes the calls of callback
+}
+
+// WriteAt writes b at off and reports the progress.
+func (p *destinationProgress) WriteAt(b []byte, off int64) (int, error) {
+	n, err := p.w.WriteAt(b, off)
+
+	written := p.written.Add(int64(n))
+	if p.callback != nil && n > 0 {
+		var speed int64
+		if elapsed := time.Since(p.start); elapsed > 0 {
+			speed = int64(float64(written) / elapsed.Seconds())
+		}
+
+		p.mu.Lock()
+		p.callback(p.offset+written, p.size, speed)
+		p.mu.Unlock()
+	}
+
+	return n, err
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/destination"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_DownloadToDestination(t *testing.T) {
+	content := make([]byte, 5*minDestinationPiece+123)
+	rand.New(rand.NewSource(5)).Read(content)
+
+	var ranges atomic.Int32
+	var firstRange atomic.Value
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plain":
+			_, _ = w.Write(content)
+			return
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		}
+
+		if header := r.Header.Get("Range"); header != "" && r.Method == http.MethodGet {
+			if ranges.Add(1) == 1 {
+				firstRange.Store(header)
+			}
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	t.Run("chunked", func(t *testing.T) {
+		ranges.Store(0)
+
+		dest := destination.NewMemory()
+
+		var reported int64
+		stats, err := NewDownloader().DownloadToDestination(context.Background(), server.URL+"/file.bin", dest,
+			&types.DownloadOptions{
+				MaxConcurrency:   4,
+				ProgressCallback: func(downloaded, _, _ int64) { reported = downloaded },
+			})
+		if err != nil {
+			t.Fatalf("DownloadToDestination() error = %v", err)
+		}
+
+		if !bytes.Equal(dest.Bytes(), content) {
+			t.Error("content differs")
+		}
+		if ranges.Load() != 4 {
+			t.Errorf("made %d range requests, want 4", ranges.Load())
+		}
+		if stats.BytesDownloaded != int64(len(content)) || reported != int64(len(content)) {
+			t.Errorf("downloaded %d, reported %d, want %d", stats.BytesDownloaded, reported, len(content))
+		}
+	})
+
+	t.Run("parted", func(t *testing.T) {
+		ranges.Store(0)
+
+		dest := partedMemory{Memory: destination.NewMemory(), partSize: 2 * minDestinationPiece}
+
+		if _, err := NewDownloader().DownloadToDestination(context.Background(), server.URL+"/file.bin", dest,
+			&types.DownloadOptions{MaxConcurrency: 4}); err != nil {
+			t.Fatalf("DownloadToDestination() error = %v", err)
+		}
+
+		if !bytes.Equal(dest.Bytes(), content) {
+			t.Error("content differs")
+		}
+		// Pieces are rounded up to whole parts: 0-2, 2-4 and 4-5 MB
+		if ranges.Load() != 3 {
+			t.Errorf("made %d range requests, want 3", ranges.Load())
+		}
+	})
+
+	t.Run("no ranges", func(t *testing.T) {
+		dest := destination.NewMemory()
+
+		if _, err := NewDownloader().DownloadToDestination(context.Background(), server.URL+"/plain", dest, nil); err != nil {
+			t.Fatalf("DownloadToDestination() error = %v", err)
+		}
+
+		if !bytes.Equal(dest.Bytes(), content) {
+			t.Error("content differs")
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		ranges.Store(0)
+
+		path := filepath.Join(t.TempDir(), "file.bin")
+		if err := os.WriteFile(path+destination.PartSuffix, content[:minDestinationPiece], 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		stats, err := NewDownloader().DownloadToDestination(context.Background(), server.URL+"/file.bin",
+			destination.NewFile(path), &types.DownloadOptions{Resume: true})
+		if err != nil {
+			t.Fatalf("DownloadToDestination() error = %v", err)
+		}
+
+		if got, _ := os.ReadFile(path); !bytes.Equal(got, content) { // #nosec G304 -- test file
+			t.Error("content differs")
+		}
+		if !stats.Resumed || stats.BytesDownloaded != int64(len(content)-minDestinationPiece) {
+			t.Errorf("resumed = %v after downloading %d bytes", stats.Resumed, stats.BytesDownloaded)
+		}
+		if header, _ := firstRange.Load().(string); ranges.Load() != 1 || !strings.HasPrefix(header, "bytes=1048576-") {
+			t.Errorf("made %d range requests starting with %q, want one from the kept bytes", ranges.Load(), header)
+		}
+		if _, err := os.Stat(path + destination.PartSuffix); !os.IsNotExist(err) {
+			t.Error("part file left behind")
+		}
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file.bin")
+		if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := NewDownloader().DownloadToDestination(context.Background(), server.URL+"/file.bin",
+			destination.NewFile(path), nil)
+		if errors.GetErrorCode(err) != errors.CodeFileExists {
+			t.Errorf("error = %v, want CodeFileExists", err)
+		}
+	})
+
+	t.Run("failed download", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file.bin")
+		if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := NewDownloader().DownloadToDestination(context.Background(), server.URL+"/missing",
+			destination.NewFile(path), &types.DownloadOptions{OverwriteExisting: true})
+		if err == nil {
+			t.Fatal("DownloadToDestination() of a missing file should fail")
+		}
+
+		if got, _ := os.ReadFile(path); string(got) != "old" { // #nosec G304 -- test file
+			t.Errorf("destination = %q, want it untouched", got)
+		}
+		if _, err := os.Stat(path + destination.PartSuffix); !os.IsNotExist(err) {
+			t.Error("part file left behind")
+		}
+	})
+}
+
+// partedMemory is a memory destination stored in parts of partSize.
+type partedMemory struct {
+	*destination.Memory
+	partSize int64
+}
+
+func (m partedMemory) PartSize() int64 {
+	return m.partSize
+}
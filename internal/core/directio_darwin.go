@@ -0,0 +1,25 @@
+//go:build darwin
+
+package core
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDirect creates path for writing with the page cache disabled (F_NOCACHE).
+func openDirect(path string) (*os.File, error) {
+	// #nosec G304 -- path validated by validateDestination() in DownloadFile()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := unix.FcntlInt(file.Fd(), unix.F_NOCACHE, 1); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
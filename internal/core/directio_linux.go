@@ -0,0 +1,14 @@
+//go:build linux
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDirect creates path for writing with O_DIRECT.
+func openDirect(path string) (*os.File, error) {
+	// #nosec G304 -- path validated by validateDestination() in DownloadFile()
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_DIRECT, 0o600)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+// openDirect is not supported on this platform; regular writes are used.
+func openDirect(_ string) (*os.File, error) {
+	return nil, errors.New("direct I/O not supported on this platform")
+}
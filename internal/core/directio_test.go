@@ -0,0 +1,187 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"unsafe"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func directIOTestData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	return data
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	for _, size := range []int{directIOAlignment, 3 * directIOAlignment} {
+		buf := alignedBuffer(size)
+		if len(buf) != size || cap(buf) != size {
+			t.Errorf("alignedBuffer(%d) len, cap = %d, %d", size, len(buf), cap(buf))
+		}
+
+		if addr := uintptr(unsafe.Pointer(&buf[0])); addr%directIOAlignment != 0 {
+			t.Errorf("alignedBuffer(%d) starts at unaligned address %#x", size, addr)
+		}
+	}
+}
+
+func TestCopyToFile(t *testing.T) {
+	sizes := []int{0, 1, directIOAlignment - 1, directIOAlignment, 3*directIOAlignment + 17, 256*1024 + 5}
+
+	modes := []struct {
+		name string
+		opts WriteOptions
+	}{
+		{"default", WriteOptions{}},
+		{"buffered", WriteOptions{BufferSize: 64 * 1024}},
+		{"direct", WriteOptions{DirectIO: true, BufferSize: 64 * 1024}},
+		{"direct unaligned buffer", WriteOptions{DirectIO: true, BufferSize: 10000}},
+	}
+
+	for _, mode := range modes {
+		for _, size := range sizes {
+			t.Run(fmt.Sprintf("%s/%d", mode.name, size), func(t *testing.T) {
+				data := directIOTestData(size)
+				dest := filepath.Join(t.TempDir(), "out.bin")
+
+				file, direct, err := createWriteTarget(dest, mode.opts)
+				if err != nil {
+					t.Fatalf("createWriteTarget() error = %v", err)
+				}
+
+				// Short reads exercise partially filled buffers
+				n, err := copyToFile(file, iotest.HalfReader(bytes.NewReader(data)), direct, mode.opts)
+				if closeErr := file.Close(); err == nil {
+					err = closeErr
+				}
+
+				if err != nil {
+					t.Fatalf("copyToFile() error = %v", err)
+				}
+
+				if n != int64(size) {
+					t.Errorf("copyToFile() = %d, want %d", n, size)
+				}
+
+				got, err := os.ReadFile(dest)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(got, data) {
+					t.Errorf("file content mismatch: got %d bytes, want %d", len(got), size)
+				}
+			})
+		}
+	}
+}
+
+func TestCopyToFile_ReadError(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out.bin")
+
+	opts := WriteOptions{DirectIO: true}
+
+	file, direct, err := createWriteTarget(dest, opts)
+	if err != nil {
+		t.Fatalf("createWriteTarget() error = %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	wantErr := io.ErrUnexpectedEOF
+	src := io.MultiReader(bytes.NewReader(directIOTestData(1000)), iotest.ErrReader(wantErr))
+
+	if _, err := copyToFile(file, src, direct, opts); err != wantErr {
+		t.Errorf("copyToFile() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestDownloader_DirectIO(t *testing.T) {
+	data := directIOTestData(2*1024*1024 + 123)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	for _, opts := range []types.DownloadOptions{
+		{DirectIO: true},
+		{WriteBufferSize: 256 * 1024},
+	} {
+		dest := filepath.Join(t.TempDir(), "large.bin")
+
+		stats, err := NewDownloader().Download(context.Background(), server.URL, dest, &opts)
+		if err != nil {
+			t.Fatalf("Download(%+v) error = %v", opts, err)
+		}
+
+		if !stats.Success || stats.BytesDownloaded != int64(len(data)) {
+			t.Errorf("Download(%+v) stats = %+v", opts, stats)
+		}
+
+		got, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, data) {
+			t.Errorf("Download(%+v) wrote %d bytes, want %d", opts, len(got), len(data))
+		}
+	}
+}
+
+// BenchmarkWritePath compares the default io.Copy loop with the tuned buffer
+// and direct I/O write paths.
+func BenchmarkWritePath(b *testing.B) {
+	data := directIOTestData(64 * 1024 * 1024)
+
+	modes := []struct {
+		name string
+		opts WriteOptions
+	}{
+		{"IOCopy", WriteOptions{}},
+		{"Buffer8MB", WriteOptions{BufferSize: 8 * 1024 * 1024}},
+		{"DirectIO", WriteOptions{DirectIO: true}},
+		{"DirectIO16MB", WriteOptions{DirectIO: true, BufferSize: 16 * 1024 * 1024}},
+	}
+
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			dest := filepath.Join(b.TempDir(), "out.bin")
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				file, direct, err := createWriteTarget(dest, mode.opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				// Hide WriteTo so the copy reads like a response body
+				if _, err := copyToFile(file, struct{ io.Reader }{bytes.NewReader(data)}, direct, mode.opts); err != nil {
+					b.Fatal(err)
+				}
+
+				_ = file.Close()
+			}
+		})
+	}
+}
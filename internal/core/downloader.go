@@ -11,19 +11,22 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/forest6511/gdl/internal/bufpool"
 	"github.com/forest6511/gdl/internal/network"
 	"github.com/forest6511/gdl/internal/recovery"
 	"github.com/forest6511/gdl/internal/resume"
 	"github.com/forest6511/gdl/internal/retry"
 	"github.com/forest6511/gdl/internal/storage"
 	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/middleware"
 	"github.com/forest6511/gdl/pkg/progress"
 	"github.com/forest6511/gdl/pkg/ratelimit"
 	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/validation"
 )
 
 // DefaultChunkSize is the default size for reading chunks during download.
@@ -52,10 +55,18 @@ type Downloader struct {
 	enableLogging   bool
 	lightweight     *LightweightDownloader
 	zeroCopy        *ZeroCopyDownloader
-	bufferPool      *BufferPool
+	buffers         *bufpool.Pool
 	connectionPool  *network.ConnectionPool
 	platformInfo    *PlatformInfo
 	resumeManager   *resume.Manager
+	circuitBreaker  *network.HostCircuitBreaker
+	transportConfig network.TransportConfig
+	breakerMu       sync.Mutex
+	quotas          map[string]*storage.Quota // Directory quotas shared by this downloader's downloads
+	quotasMu        sync.Mutex
+	middleware      []middleware.RequestMiddleware // Wraps every HTTP request
+	hostLimiter     *network.HostLimiter           // Paces every HTTP request per host
+	middlewareMu    sync.RWMutex
 }
 
 // NewDownloader creates a new Downloader instance with default settings.
@@ -63,12 +74,15 @@ func NewDownloader() *Downloader {
 	// Detect platform and apply optimizations
 	platformInfo := DetectPlatform()
 
-	// Create optimized HTTP client for platform
-	client := network.CreateOptimizedClient(DefaultTimeout)
+	// Share one pooled transport per configuration so connections and TLS
+	// sessions are reused across downloaders and batch jobs
+	transportConfig := platformTransportConfig(platformInfo)
+	transport := network.SharedTransport(transportConfig)
+	PlatformSpecificInit()
 
-	// Apply platform optimizations to the HTTP transport
-	if transport, ok := client.Transport.(*http.Transport); ok {
-		ApplyPlatformOptimizations(transport)
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   DefaultTimeout,
 	}
 
 	retryManager := retry.NewRetryManager().
@@ -78,13 +92,6 @@ func NewDownloader() *Downloader {
 		WithBackoffFactor(2.0).
 		WithJitter(true)
 
-	// Get user's home directory for resume files
-	homeDir, err := os.UserHomeDir()
-	resumeDir := "."
-	if err == nil {
-		resumeDir = filepath.Join(homeDir, ".gdl", "resume")
-	}
-
 	return &Downloader{
 		client:          client,
 		retryManager:    retryManager,
@@ -93,15 +100,16 @@ func NewDownloader() *Downloader {
 		recoveryAdvisor: recovery.NewRecoveryAdvisor(),
 		logger:          log.New(os.Stderr, "[GODL] ", log.LstdFlags),
 		enableLogging:   false, // Disabled by default, can be enabled via WithLogging
-		lightweight:     NewLightweightDownloader(),
-		zeroCopy:        NewZeroCopyDownloader(),
-		bufferPool:      GlobalBufferPool,
+		lightweight:     newLightweightDownloader(transport),
+		zeroCopy:        newZeroCopyDownloader(network.SharedTransport(zeroCopyTransportConfig(transportConfig))),
+		buffers:         bufpool.Default,
 		connectionPool: network.NewConnectionPool(
 			platformInfo.Optimizations.MaxConnections,
 			platformInfo.Optimizations.MaxConnections,
 		),
-		platformInfo:  platformInfo,
-		resumeManager: resume.NewManager(resumeDir),
+		platformInfo:    platformInfo,
+		resumeManager:   resume.NewManager(resume.DefaultDir()),
+		transportConfig: transportConfig,
 	}
 }
 
@@ -125,6 +133,40 @@ func (d *Downloader) WithRetryStrategy(manager *retry.RetryManager) *Downloader
 	return d
 }
 
+// WithCircuitBreaker configures the per-host circuit breaker shared by all
+// downloads made through this downloader. Passing nil disables it.
+func (d *Downloader) WithCircuitBreaker(breaker *network.HostCircuitBreaker) *Downloader {
+	d.breakerMu.Lock()
+	defer d.breakerMu.Unlock()
+
+	d.circuitBreaker = breaker
+
+	return d
+}
+
+// WithHostLimiter configures the per-host connection cap and delay shared by
+// all downloads made through this downloader. Passing nil disables it.
+func (d *Downloader) WithHostLimiter(limiter *network.HostLimiter) *Downloader {
+	d.middlewareMu.Lock()
+	defer d.middlewareMu.Unlock()
+
+	d.hostLimiter = limiter
+
+	return d
+}
+
+// Use adds middleware wrapping every HTTP request made by this downloader's
+// downloads, in the order given. It should be called before downloads start;
+// downloads in progress keep the middleware they started with.
+func (d *Downloader) Use(mw ...middleware.RequestMiddleware) *Downloader {
+	d.middlewareMu.Lock()
+	defer d.middlewareMu.Unlock()
+
+	d.middleware = append(d.middleware, mw...)
+
+	return d
+}
+
 // WithSpaceChecker configures the disk space checker.
 func (d *Downloader) WithSpaceChecker(checker *storage.SpaceChecker) *Downloader {
 	d.spaceChecker = checker
@@ -300,9 +342,39 @@ func (d *Downloader) executeDownloadWithRetries(
 		attemptCount    int
 		previousActions []recovery.ActionType
 		lastErr         error
+		refreshed       bool
 	)
 
-	for attemptCount = 1; attemptCount <= d.retryManager.MaxRetries+1; attemptCount++ {
+	retryManager := d.retryManagerFor(options)
+	retryStart := time.Now()
+	breaker := d.circuitBreakerFor(options)
+	host := hostOf(url)
+	maxAttempts := retryManager.MaxRetries + 1
+
+	// The URLs a RetryClassifier can switch between, and the one in use
+	sources := append([]string{url}, options.Mirrors...)
+	source := 0
+
+	for attemptCount = 1; attemptCount <= maxAttempts; attemptCount++ {
+		// Fail fast while the host's circuit is open
+		if breaker != nil {
+			if err := breaker.Allow(host); err != nil {
+				var downloadErr *errors.DownloadError
+				if stdErrors.As(err, &downloadErr) {
+					downloadErr.URL = url
+				}
+
+				d.logError("circuit_open", err, map[string]interface{}{
+					"attempt": attemptCount,
+					"host":    host,
+				})
+
+				lastErr = err
+
+				break
+			}
+		}
+
 		d.logInfo(
 			"download_attempt",
 			fmt.Sprintf("Attempt %d", attemptCount),
@@ -315,7 +387,13 @@ func (d *Downloader) executeDownloadWithRetries(
 		downloadStats, err := d.performDownloadAttempt(ctx, url, destination, options, attemptCount)
 		lastErr = err
 
+		if breaker != nil {
+			breaker.Record(host, err)
+		}
+
 		if err == nil {
+			downloadStats.Retries = attemptCount - 1
+
 			d.logInfo("download_success", "Download completed successfully", map[string]interface{}{
 				"url":              url,
 				"bytes_downloaded": downloadStats.BytesDownloaded,
@@ -329,14 +407,59 @@ func (d *Downloader) executeDownloadWithRetries(
 			break
 		}
 
-		if attemptCount >= d.retryManager.MaxRetries+1 || !errors.IsRetryable(err) {
+		// An expired URL is replaced and tried again at once; the attempt with
+		// the new URL does not count as a retry
+		if options.URLRefresher != nil && !refreshed && urlRejected(err) {
+			newURL, refreshErr := d.refreshURL(ctx, url, options)
+			if refreshErr != nil {
+				lastErr = refreshErr
+				break
+			}
+
+			url, host, refreshed = newURL, hostOf(newURL), true
+			sources[source] = newURL
+			maxAttempts++
+
+			continue
+		}
+
+		refreshed = false
+
+		decision := retryDecision(options, err, attemptCount)
+		if attemptCount >= maxAttempts || !decision.Retry {
+			break
+		}
+
+		// Stop once the next attempt would start outside the retry budget
+		delay := retryManager.DelayFor(err, attemptCount-1)
+		if decision.Delay > 0 {
+			delay = decision.Delay
+		}
+
+		if !retryManager.WithinBudget(time.Since(retryStart), delay) {
+			d.logInfo("retry_budget_exhausted", "Retry budget exhausted", map[string]interface{}{
+				"attempt": attemptCount,
+				"budget":  retryManager.MaxElapsedTime.String(),
+				"elapsed": time.Since(retryStart).String(),
+				"delay":   delay.String(),
+			})
 			break
 		}
 
 		// Wait before retry
-		if err := d.waitForRetry(ctx, attemptCount); err != nil {
+		if err := d.waitForRetry(ctx, attemptCount, lastErr, delay, options); err != nil {
 			return stats, err
 		}
+
+		if decision.SwitchMirror && len(sources) > 1 {
+			source = (source + 1) % len(sources)
+			url, host = sources[source], hostOf(sources[source])
+
+			d.logInfo("mirror_switch", "Retrying from another mirror", map[string]interface{}{
+				"attempt": attemptCount + 1,
+				"url":     url,
+			})
+		}
 	}
 
 	// All attempts failed
@@ -399,8 +522,291 @@ func (d *Downloader) handleDownloadFailure(
 	return false
 }
 
-func (d *Downloader) waitForRetry(ctx context.Context, attemptCount int) error {
-	delay := d.retryManager.NextDelay(attemptCount - 1)
+// retryDecision asks the options' RetryClassifier what to do after a failed
+// attempt. Without one, the errors errors.IsRetryable accepts are retried.
+func retryDecision(options *types.DownloadOptions, err error, attempt int) types.RetryDecision {
+	if options != nil && options.RetryClassifier != nil {
+		return options.RetryClassifier(err, attempt)
+	}
+
+	return types.RetryDecision{Retry: errors.IsRetryable(err)}
+}
+
+// retryManagerFor returns the retry manager to use for a download, applying
+// the backoff policy from the options on top of the downloader's retry strategy.
+func (d *Downloader) retryManagerFor(options *types.DownloadOptions) *retry.RetryManager {
+	if options == nil || options.Backoff == nil {
+		return d.retryManager
+	}
+
+	policy := options.Backoff
+	manager := d.retryManager.
+		WithFullJitter(policy.Jitter).
+		WithJitter(false).
+		WithMaxElapsedTime(policy.MaxElapsedTime).
+		WithRetryAfter(!policy.IgnoreRetryAfter)
+
+	if policy.InitialDelay > 0 {
+		manager = manager.WithBaseDelay(policy.InitialDelay)
+	}
+
+	if policy.MaxDelay > 0 {
+		manager = manager.WithMaxDelay(policy.MaxDelay)
+	}
+
+	if policy.Multiplier >= 1 {
+		manager = manager.WithBackoffFactor(policy.Multiplier)
+	}
+
+	return manager
+}
+
+// transportConfigFor returns the transport settings for a download: the
+// downloader's settings with any overrides from the options applied.
+func (d *Downloader) transportConfigFor(options *types.DownloadOptions) (network.TransportConfig, bool) {
+	config := d.transportConfig
+	if !hasTransportOverrides(options) {
+		return config, false
+	}
+
+	if options.DNS != nil {
+		config.DNS = dnsConfig(options.DNS)
+	}
+
+	config.Proxy = proxyConfig(options)
+	config.TLS = tlsConfig(options)
+
+	overrides := options.Transport
+	if overrides == nil {
+		return config, true
+	}
+
+	if overrides.MaxIdleConns > 0 {
+		config.MaxIdleConns = overrides.MaxIdleConns
+	}
+
+	if overrides.MaxIdleConnsPerHost > 0 {
+		config.MaxIdleConnsPerHost = overrides.MaxIdleConnsPerHost
+	}
+
+	if overrides.MaxConnsPerHost > 0 {
+		config.MaxConnsPerHost = overrides.MaxConnsPerHost
+	}
+
+	if overrides.IdleConnTimeout > 0 {
+		config.IdleConnTimeout = overrides.IdleConnTimeout
+	}
+
+	if overrides.KeepAlive > 0 {
+		config.KeepAlive = overrides.KeepAlive
+	}
+
+	if overrides.TLSSessionCacheSize > 0 {
+		config.TLSSessionCacheSize = overrides.TLSSessionCacheSize
+	}
+
+	config.DisableKeepAlives = config.DisableKeepAlives || overrides.DisableKeepAlives
+
+	return config, true
+}
+
+// hasTransportOverrides reports whether a download needs a transport other than
+// the downloader's default one.
+func hasTransportOverrides(options *types.DownloadOptions) bool {
+	return options != nil &&
+		(options.Transport != nil || options.DNS != nil || options.Proxy != nil || options.ProxyURL != "" ||
+			options.TLS != nil || options.InsecureSkipVerify)
+}
+
+// tlsConfig converts the TLS options.
+func tlsConfig(options *types.DownloadOptions) network.TLSConfig {
+	config := network.TLSConfig{InsecureSkipVerify: options.InsecureSkipVerify}
+
+	if options.TLS != nil {
+		config.CAFile = options.TLS.CAFile
+		config.CertFile = options.TLS.CertFile
+		config.KeyFile = options.TLS.KeyFile
+		config.PinnedPublicKeys = options.TLS.PinnedPublicKeys
+	}
+
+	return config
+}
+
+// proxyConfig converts the proxy options, falling back to the deprecated ProxyURL.
+func proxyConfig(options *types.DownloadOptions) network.ProxyConfig {
+	if options.Proxy == nil {
+		return network.ProxyConfig{URL: options.ProxyURL}
+	}
+
+	return network.ProxyConfig{
+		URL:      options.Proxy.URL,
+		HTTPURL:  options.Proxy.HTTPURL,
+		HTTPSURL: options.Proxy.HTTPSURL,
+		NoProxy:  options.Proxy.NoProxy,
+		Username: options.Proxy.Username,
+		Password: options.Proxy.Password,
+	}
+}
+
+// dnsConfig converts the DNS options into the network dialer configuration.
+func dnsConfig(options *types.DNSOptions) network.DNSConfig {
+	config := network.DNSConfig{
+		Servers:     options.Servers,
+		DoHURL:      options.DoHURL,
+		StaticHosts: options.Resolve,
+	}
+
+	switch options.IPVersion {
+	case 4:
+		config.IPVersion = network.IPv4Only
+	case 6:
+		config.IPVersion = network.IPv6Only
+	}
+
+	return config
+}
+
+// clientFor returns the HTTP client for a download. Without transport overrides
+// this is the downloader's client; otherwise a client on the shared transport
+// matching the overridden settings.
+func (d *Downloader) clientFor(options *types.DownloadOptions) *http.Client {
+	config, overridden := d.transportConfigFor(options)
+	if !overridden {
+		return d.withMiddleware(d.client)
+	}
+
+	client := *d.client
+	client.Transport = network.SharedTransport(config)
+
+	return d.withMiddleware(&client)
+}
+
+// HTTPClient returns the client a download with options sends its requests
+// with: the options' proxy, TLS and DNS settings, behind the request
+// middleware.
+func (d *Downloader) HTTPClient(options *types.DownloadOptions) *http.Client {
+	return d.clientFor(options)
+}
+
+// withMiddleware returns client with its transport wrapped by the request
+// middleware and host limiter, or client itself when there are none.
+func (d *Downloader) withMiddleware(client *http.Client) *http.Client {
+	if !d.hasMiddleware() {
+		return client
+	}
+
+	wrapped := *client
+	wrapped.Transport = d.wrapTransport(client.Transport)
+
+	return &wrapped
+}
+
+// wrapTransport wraps transport with the host limiter and the request
+// middleware, so every request the middleware sends is paced.
+func (d *Downloader) wrapTransport(transport http.RoundTripper) http.RoundTripper {
+	d.middlewareMu.RLock()
+	defer d.middlewareMu.RUnlock()
+
+	if d.hostLimiter != nil {
+		transport = d.hostLimiter.Transport(transport)
+	}
+
+	if len(d.middleware) == 0 {
+		return transport
+	}
+
+	return middleware.ChainRequestMiddleware(transport, d.middleware...)
+}
+
+// hasMiddleware reports whether request middleware or a host limiter is registered.
+func (d *Downloader) hasMiddleware() bool {
+	d.middlewareMu.RLock()
+	defer d.middlewareMu.RUnlock()
+
+	return len(d.middleware) > 0 || d.hostLimiter != nil
+}
+
+// lightweightFor returns the lightweight downloader for a download, honoring transport overrides.
+func (d *Downloader) lightweightFor(options *types.DownloadOptions) *LightweightDownloader {
+	config, overridden := d.transportConfigFor(options)
+	if !overridden && !d.hasMiddleware() {
+		return d.lightweight
+	}
+
+	return newLightweightDownloader(d.wrapTransport(network.SharedTransport(config)))
+}
+
+// zeroCopyFor returns the zero-copy downloader for a download, honoring transport overrides.
+func (d *Downloader) zeroCopyFor(options *types.DownloadOptions) *ZeroCopyDownloader {
+	config, overridden := d.transportConfigFor(options)
+	if !overridden && !d.hasMiddleware() {
+		return d.zeroCopy
+	}
+
+	return newZeroCopyDownloader(d.wrapTransport(network.SharedTransport(zeroCopyTransportConfig(config))))
+}
+
+// circuitBreakerFor returns the circuit breaker to use for a download. A policy
+// in the options enables the downloader's breaker or updates its settings, so
+// the per-host state is shared across downloads.
+func (d *Downloader) circuitBreakerFor(options *types.DownloadOptions) *network.HostCircuitBreaker {
+	d.breakerMu.Lock()
+	defer d.breakerMu.Unlock()
+
+	if options == nil || options.CircuitBreaker == nil {
+		return d.circuitBreaker
+	}
+
+	policy := options.CircuitBreaker
+	if d.circuitBreaker == nil {
+		d.circuitBreaker = network.NewHostCircuitBreaker(policy.FailureThreshold, policy.Cooldown)
+	} else {
+		d.circuitBreaker.Configure(policy.FailureThreshold, policy.Cooldown)
+	}
+
+	return d.circuitBreaker
+}
+
+// configureHostLimits applies the host limits of a download. A policy in the
+// options enables the downloader's limiter or updates its settings, so
+// concurrent downloads to a host share one cap and one delay.
+func (d *Downloader) configureHostLimits(options *types.DownloadOptions) {
+	if options == nil || options.HostLimits == nil {
+		return
+	}
+
+	d.middlewareMu.Lock()
+	defer d.middlewareMu.Unlock()
+
+	policy := options.HostLimits
+	if d.hostLimiter == nil {
+		d.hostLimiter = network.NewHostLimiter(policy.MaxConnections, policy.Delay)
+	} else {
+		d.hostLimiter.Configure(policy.MaxConnections, policy.Delay)
+	}
+}
+
+// hostOf returns the host (with port) of a URL, or the URL itself if it cannot be parsed.
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+
+	return parsed.Host
+}
+
+func (d *Downloader) waitForRetry(
+	ctx context.Context,
+	attemptCount int,
+	lastErr error,
+	delay time.Duration,
+	options *types.DownloadOptions,
+) error {
+	if options != nil && options.RetryCallback != nil {
+		options.RetryCallback(attemptCount, lastErr, delay)
+	}
+
 	d.logInfo(
 		"retry_delay",
 		fmt.Sprintf("Waiting %v before retry", delay),
@@ -512,18 +918,97 @@ func (d *Downloader) Download(
 		options = &types.DownloadOptions{}
 	}
 	d.setDefaultOptions(options)
+	d.configureHostLimits(options)
 
 	if err := d.validateDownloadRequest(url, destination, stats); err != nil {
 		return stats, err
 	}
 
+	// Decide what to do about an existing destination
+	if options.CollisionPolicy != "" {
+		resolved, resolvedOptions, err := ResolveCollision(destination, options)
+		if err != nil {
+			stats.Error = d.wrapDownloadError(err, url, destination, 0, 0)
+			stats.EndTime = time.Now()
+			stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+			return stats, stats.Error
+		}
+
+		if resolved == "" {
+			return d.skipExisting(destination, stats), nil
+		}
+
+		renamed := resolved != destination
+		destination, options = resolved, resolvedOptions
+		stats.Filename = destination
+
+		if renamed {
+			result, err := d.download(ctx, url, destination, options, stats)
+			if err != nil {
+				// Don't leave the reserved name behind
+				if info, statErr := os.Stat(destination); statErr == nil && info.Size() == 0 {
+					_ = os.Remove(destination)
+				}
+			}
+
+			return result, err
+		}
+	}
+
+	return d.download(ctx, url, destination, options, stats)
+}
+
+// download runs the download of url to destination once the destination has
+// been settled, and records the speed of a completed one in the host cache.
+func (d *Downloader) download(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) (result *types.DownloadStats, err error) {
+	defer func() {
+		if err == nil {
+			d.rememberThroughput(options, result)
+		}
+	}()
+
 	// Check disk space before starting
 	if err := d.performPreDownloadChecks(destination, options, stats); err != nil {
 		return stats, err
 	}
 
+	// Fetch only a slice of the resource
+	if options.ByteRange != nil {
+		return d.downloadRange(ctx, url, destination, options, stats)
+	}
+
+	// Update a local copy from a zsync control file
+	if options.Delta != nil && options.Delta.Control != "" {
+		return d.downloadDelta(ctx, url, destination, options, stats)
+	}
+
+	// Reuse identical content from the content store
+	if options.ContentStore != nil && options.ContentStore.Dir != "" {
+		return d.downloadDeduplicated(ctx, url, destination, options, stats)
+	}
+
+	return d.fetch(ctx, url, destination, options, stats)
+}
+
+// fetch downloads url to destination, skipping unchanged files in timestamping mode.
+func (d *Downloader) fetch(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) (*types.DownloadStats, error) {
+	if options.OnlyIfNewer {
+		return d.downloadIfNewer(ctx, url, destination, options, stats)
+	}
+
 	// Main download loop with retry logic
-	return d.executeDownloadWithRetries(ctx, url, destination, options, stats)
+	return d.transfer(ctx, url, destination, options, stats)
 }
 
 // checkDiskSpace validates available disk space for the download.
@@ -630,8 +1115,47 @@ func (d *Downloader) performDownloadAttempt(
 		}
 	}
 
+	// A HEAD request tells nothing about the response to a POST or a request
+	// with a body, so those are downloaded as a single stream
+	if customRequest(options) {
+		return d.performRequestDownload(ctx, url, destination, options)
+	}
+
+	// Small files are fetched with their GET request alone; for larger ones
+	// its headers stand in for the HEAD response
+	var (
+		fileInfo *types.FileInfo
+		err      error
+	)
+
+	if smallFileFastPath(options) {
+		var stats *types.DownloadStats
+		if stats, fileInfo, err = d.downloadSmallFile(ctx, url, destination, options); stats != nil || err != nil {
+			return stats, err
+		}
+	}
+
 	// Get file info to check server capabilities and file size with retry
-	fileInfo, err := d.GetFileInfo(ctx, url)
+	if fileInfo == nil {
+		fileInfo, err = d.getFileInfo(ctx, url, d.clientFor(options), hostCacheFor(options))
+	}
+
+	var size int64
+	if err == nil {
+		size = fileInfo.Size
+	}
+
+	releaseQuota, quotaErr := d.reserveQuota(destination, size, options)
+	if quotaErr != nil {
+		return nil, d.wrapDownloadError(quotaErr, url, destination, 0, size)
+	}
+	defer releaseQuota()
+
+	// A rejected URL is refreshed before the partial file is touched
+	if err != nil && options.URLRefresher != nil && urlRejected(err) {
+		return nil, d.wrapDownloadError(err, url, destination, 0, 0)
+	}
+
 	if err != nil {
 		// Fall back to simple download if HEAD request fails
 		d.logInfo(
@@ -645,17 +1169,42 @@ func (d *Downloader) performDownloadAttempt(
 		return d.performSimpleDownload(ctx, url, destination, options)
 	}
 
+	stats, err := d.downloadKnownFile(ctx, url, destination, options, fileInfo)
+	if stats != nil {
+		stats.LastModified = fileInfo.LastModified
+	}
+
+	return stats, err
+}
+
+// downloadKnownFile downloads a file whose size and range support fileInfo
+// describes, choosing the download mode from them.
+func (d *Downloader) downloadKnownFile(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	fileInfo *types.FileInfo,
+) (*types.DownloadStats, error) {
+	// The lightweight and zero-copy modes neither throttle, watch the
+	// transfer speed or free space, hash the data, send custom headers nor
+	// use mirrors, so downloads that need any of these take the regular path
+	regularPathOnly := options.Resume || options.MaxRate > 0 || stallDetectionEnabled(options) ||
+		options.MinFreeSpace > 0 || len(options.Headers) > 0 || len(options.Mirrors) > 0 ||
+		wantsChecksum(options)
+
 	// Check if we should use lightweight mode for small files
-	// Only use lightweight mode when resume is not enabled
-	if !options.Resume && shouldUseLightweight(fileInfo.Size) {
+	if !regularPathOnly && shouldUseLightweight(fileInfo.Size) {
 		d.logInfo("using_lightweight_mode", "Using lightweight mode for small file", map[string]interface{}{
 			"size": fileInfo.Size,
 		})
 		return d.performLightweightDownload(ctx, url, destination, options)
 	}
 
-	// Check if we should use zero-copy mode for large files (platform-aware)
-	if !options.Resume && d.platformInfo.Optimizations.UseZeroCopy && ShouldUseZeroCopyPlatform(fileInfo.Size) {
+	// Check if we should use zero-copy mode for large files (platform-aware),
+	// which also carries the opt-in direct I/O and tuned buffer write paths
+	highPerformanceWrite := options.DirectIO || options.WriteBufferSize > 0
+	if !regularPathOnly && (highPerformanceWrite ||
+		(d.platformInfo.Optimizations.UseZeroCopy && ShouldUseZeroCopyPlatform(fileInfo.Size))) {
 		d.logInfo("using_zerocopy_mode", "Using zero-copy mode for large file", map[string]interface{}{
 			"size":     fileInfo.Size,
 			"platform": GetPlatformString(),
@@ -675,6 +1224,11 @@ func (d *Downloader) performDownloadAttempt(
 		return d.performResumeDownload(ctx, url, destination, options, fileInfo)
 	}
 
+	// Split the file across its mirrors when they serve it in ranges
+	if len(options.Mirrors) > 0 && fileInfo.SupportsRanges && fileInfo.Size > 0 && !customRequest(options) {
+		return d.performMultiSourceDownload(ctx, url, destination, options, fileInfo)
+	}
+
 	// Determine download strategy based on conditions
 	shouldUseConcurrent := options.MaxConcurrency > 1 &&
 		fileInfo.SupportsRanges &&
@@ -728,7 +1282,14 @@ func (d *Downloader) isFileComplete(resumeOffset int64, fileInfo *types.FileInfo
 	return false
 }
 
-func (d *Downloader) createResumeRequest(ctx context.Context, url string, resumeOffset int64, fileInfo *types.FileInfo) (*http.Request, error) {
+func (d *Downloader) createResumeRequest(
+	ctx context.Context,
+	url string,
+	resumeOffset int64,
+	fileInfo *types.FileInfo,
+	partial *resume.Metadata,
+	options *types.DownloadOptions,
+) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, errors.WrapErrorWithURL(
@@ -742,12 +1303,20 @@ func (d *Downloader) createResumeRequest(ctx context.Context, url string, resume
 	// Set Range header to resume from where we left off
 	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumeOffset))
 
-	// Set If-Range header if we have ETag or Last-Modified (for validation)
+	// Set If-Range so a file that changes on the server now is sent whole;
+	// the validators recorded when the partial file was started also catch
+	// changes made before the HEAD request
 	headers := http.Header(fileInfo.Headers)
-	if etag := headers.Get("ETag"); etag != "" {
-		req.Header.Set("If-Range", etag)
-	} else if lastModified := headers.Get("Last-Modified"); lastModified != "" {
-		req.Header.Set("If-Range", lastModified)
+	switch {
+	case options.ResumeValidation == types.ResumeIgnore:
+	case partial != nil:
+		if validator := ifRangeValidator(partial); validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	case headers.Get("ETag") != "":
+		req.Header.Set("If-Range", headers.Get("ETag"))
+	case headers.Get("Last-Modified") != "":
+		req.Header.Set("If-Range", headers.Get("Last-Modified"))
 	}
 
 	return req, nil
@@ -763,7 +1332,10 @@ func (d *Downloader) handleResumeResponse(
 	fileInfo *types.FileInfo,
 ) (*types.DownloadStats, error) {
 	// Perform the HTTP request
-	resp, err := d.client.Do(req)
+	traceCtx, serverIP := network.TraceConnection(req.Context())
+	req = req.WithContext(traceCtx)
+
+	resp, err := d.clientFor(options).Do(req)
 	if err != nil {
 		downloadErr := d.handleHTTPError(err, stats.URL)
 		stats.Error = downloadErr
@@ -776,7 +1348,12 @@ func (d *Downloader) handleResumeResponse(
 	// Handle different response status codes
 	switch resp.StatusCode {
 	case http.StatusPartialContent:
-		return d.handlePartialContentResponse(ctx, resp, destination, options, stats, resumeOffset, fileInfo)
+		result, err := d.handlePartialContentResponse(ctx, resp, destination, options, stats, resumeOffset, fileInfo)
+		result.Connections = []types.ConnectionStats{
+			connectionStats(resumeOffset, result.BytesDownloaded-resumeOffset, result.StartTime, serverIP()),
+		}
+
+		return result, err
 	case http.StatusOK:
 		// Server returned full content, fall back to normal download
 		stats.Resumed = false
@@ -787,7 +1364,7 @@ func (d *Downloader) handleResumeResponse(
 		return d.performSingleDownload(ctx, stats.URL, destination, options, fileInfo)
 	default:
 		// Some other error
-		downloadErr := errors.FromHTTPStatus(resp.StatusCode, stats.URL)
+		downloadErr := httpStatusError(resp, stats.URL)
 		stats.Error = downloadErr
 		stats.EndTime = time.Now()
 		stats.Duration = stats.EndTime.Sub(stats.StartTime)
@@ -826,8 +1403,14 @@ func (d *Downloader) handlePartialContentResponse(
 		options.Progress.Start(stats.Filename, fileInfo.Size)
 	}
 
+	body, watchdog := watchSpeed(resp.Body, options)
+	defer watchdog.Stop()
+
 	// Download the remaining content
-	bytesDownloaded, err := d.downloadContent(ctx, resp.Body, file, options, stats)
+	writer, digest := d.hashStream(d.guardSpace(file, destination, options), destination, resumeOffset, options)
+
+	bytesDownloaded, err := d.downloadContent(ctx, body, writer, options, stats)
+	err = watchdog.Err(err)
 	stats.BytesDownloaded = resumeOffset + bytesDownloaded // Include already downloaded bytes
 	stats.EndTime = time.Now()
 	stats.Duration = stats.EndTime.Sub(stats.StartTime)
@@ -835,6 +1418,9 @@ func (d *Downloader) handlePartialContentResponse(
 	if err != nil {
 		stats.Error = err
 		stats.Success = false
+		if ctx.Err() != nil {
+			d.keepPartial(stats.URL, file, -1, fileInfo)
+		}
 		if options.Progress != nil {
 			options.Progress.Error(stats.Filename, err)
 		}
@@ -847,6 +1433,8 @@ func (d *Downloader) handlePartialContentResponse(
 		stats.AverageSpeed = int64(float64(bytesDownloaded) / stats.Duration.Seconds())
 	}
 
+	digest.record(stats, nil)
+
 	// Notify progress completion
 	if options.Progress != nil {
 		options.Progress.Finish(stats.Filename, stats)
@@ -876,18 +1464,45 @@ func (d *Downloader) performResumeDownload(
 		return stats, err
 	}
 
+	// A partial file of a file that has changed on the server since cannot
+	// be continued, nor taken for complete
+	partial := d.loadPartialVersion(url, destination)
+	if resumeOffset > 0 {
+		resumable, err := d.checkPartialVersion(url, options, partial, fileInfo)
+		if err != nil {
+			stats.Error = err
+			stats.EndTime = time.Now()
+			stats.Duration = stats.EndTime.Sub(stats.StartTime)
+			return stats, err
+		}
+
+		if !resumable {
+			resumeOffset, partial = 0, nil
+		}
+	}
+
 	// If file is complete, return success
 	if d.isFileComplete(resumeOffset, fileInfo, stats) {
+		d.forgetPartialVersion(destination)
 		return stats, nil
 	}
 
+	if partial == nil {
+		d.recordPartialVersion(url, destination, fileInfo)
+	}
+
 	// If no existing file or server doesn't support ranges, do normal download
 	if resumeOffset == 0 || !fileInfo.SupportsRanges {
-		return d.performSingleDownload(ctx, url, destination, options, fileInfo)
+		result, err := d.performSingleDownload(ctx, url, destination, options, fileInfo)
+		if err == nil {
+			d.forgetPartialVersion(destination)
+		}
+
+		return result, err
 	}
 
 	// Create resume request
-	req, err := d.createResumeRequest(ctx, url, resumeOffset, fileInfo)
+	req, err := d.createResumeRequest(ctx, url, resumeOffset, fileInfo, partial, options)
 	if err != nil {
 		stats.Error = err
 		stats.EndTime = time.Now()
@@ -899,7 +1514,12 @@ func (d *Downloader) performResumeDownload(
 	d.setRequestHeaders(req, options)
 
 	// Perform the HTTP request and handle response
-	return d.handleResumeResponse(ctx, req, destination, options, stats, resumeOffset, fileInfo)
+	result, err := d.handleResumeResponse(ctx, req, destination, options, stats, resumeOffset, fileInfo)
+	if err == nil {
+		d.forgetPartialVersion(destination)
+	}
+
+	return result, err
 }
 
 // performSimpleDownload performs a simple download without file info.
@@ -916,10 +1536,13 @@ func (d *Downloader) performSimpleDownload(
 	}
 	defer func() { _ = file.Close() }()
 
-	stats, err := d.DownloadToWriter(ctx, url, file, options)
+	writer, digest := d.hashStream(d.guardSpace(file, destination, options), destination, 0, options)
+
+	stats, err := d.DownloadToWriter(ctx, url, writer, options)
 	if stats != nil {
 		stats.Filename = destination
 	}
+	digest.record(stats, err)
 
 	return stats, err
 }
@@ -939,14 +1562,44 @@ func (d *Downloader) performSingleDownload(
 	}
 	defer func() { _ = file.Close() }()
 
-	stats, err := d.DownloadToWriter(ctx, url, file, options)
+	if err := d.preallocate(file, fileInfo.Size, options); err != nil {
+		return nil, d.wrapDownloadError(err, url, destination, 0, fileInfo.Size)
+	}
+
+	writer, digest := d.hashStream(d.guardSpace(file, destination, options), destination, 0, options)
+
+	stats, err := d.DownloadToWriter(ctx, url, writer, options)
 	if stats != nil {
 		stats.Filename = destination
 	}
+	digest.record(stats, err)
+
+	if err != nil && ctx.Err() != nil {
+		d.keepPartial(url, file, -1, fileInfo)
+	}
 
 	return stats, err
 }
 
+// preallocate reserves disk space for chunked downloads (MaxConcurrency > 1) of
+// known size, failing early when the disk cannot hold the file.
+func (d *Downloader) preallocate(file *os.File, size int64, options *types.DownloadOptions) error {
+	if options.MaxConcurrency <= 1 || size <= 0 {
+		return nil
+	}
+
+	checker := d.spaceChecker
+	if checker == nil {
+		if err := storage.Preallocate(file, size); err != nil && !stdErrors.Is(err, storage.ErrPreallocateUnsupported) {
+			return err
+		}
+
+		return nil
+	}
+
+	return checker.Preallocate(file, size)
+}
+
 // fallbackToSimpleDownload performs a simple download when HEAD request fails.
 func (d *Downloader) fallbackToSimpleDownload(
 	ctx context.Context,
@@ -969,7 +1622,7 @@ func (d *Downloader) fallbackToSimpleDownload(
 	defer func() { _ = file.Close() }()
 
 	// Use the existing DownloadToWriter method for simple download
-	return d.DownloadToWriter(ctx, url, file, options)
+	return d.DownloadToWriter(ctx, url, d.guardSpace(file, destination, options), options)
 }
 
 // downloadWithResumeSupport handles traditional download with resume capabilities.
@@ -1026,6 +1679,15 @@ func (d *Downloader) downloadWithResumeSupport(
 	}
 	defer func() { _ = file.Close() }()
 
+	if err := d.preallocate(file, fileInfo.Size, options); err != nil {
+		downloadErr := d.wrapDownloadError(err, url, destination, resumeOffset, fileInfo.Size)
+		stats.Error = downloadErr
+		stats.EndTime = time.Now()
+		stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+		return stats, downloadErr
+	}
+
 	// If resuming, perform resume download; otherwise, regular download
 	if resumeOffset > 0 {
 		return d.downloadWithResume(ctx, url, file, options, resumeOffset)
@@ -1047,7 +1709,7 @@ func (d *Downloader) downloadWithResumeSupport(
 	}
 
 	// Use the existing DownloadToWriter method
-	result, err := d.DownloadToWriter(ctx, url, file, options)
+	result, err := d.DownloadToWriter(ctx, url, d.guardSpace(file, destination, options), options)
 
 	// Clean up resume file on successful download
 	if err == nil && options.Resume {
@@ -1076,6 +1738,13 @@ func (d *Downloader) DownloadToWriter(
 	}
 
 	d.setDefaultOptions(options)
+	d.configureHostLimits(options)
+
+	if options.ByteRange != nil {
+		if err := options.ByteRange.Validate(); err != nil {
+			return nil, errors.NewValidationError("range", err.Error())
+		}
+	}
 
 	// Initialize download stats
 	stats := &types.DownloadStats{
@@ -1083,32 +1752,27 @@ func (d *Downloader) DownloadToWriter(
 		StartTime: time.Now(),
 	}
 
-	// Create HTTP request with context
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	// Create HTTP request with context, recording the server it connects to
+	ctx, serverIP := network.TraceConnection(ctx)
+
+	req, err := newRequest(ctx, url, options)
 	if err != nil {
-		downloadErr := errors.WrapErrorWithURL(err, errors.CodeInvalidURL,
-			"Failed to create HTTP request", url)
-		stats.Error = downloadErr
+		stats.Error = err
 		stats.EndTime = time.Now()
 		stats.Duration = stats.EndTime.Sub(stats.StartTime)
 
-		return stats, downloadErr
+		return stats, err
 	}
 
 	// Set request headers
 	d.setRequestHeaders(req, options)
 
-	// Get client from connection pool for better performance
-	parsedURL, parseErr := parseURL(url)
-	var client *http.Client
-	if parseErr == nil && parsedURL != nil && d.connectionPool != nil {
-		client = d.connectionPool.GetClient(parsedURL.Host, DefaultTimeout)
-	} else {
-		client = d.client
+	if options.ByteRange != nil {
+		req.Header.Set("Range", options.ByteRange.String())
 	}
 
 	// Perform the HTTP request
-	resp, err := client.Do(req)
+	resp, err := d.streamClient(url, options).Do(req)
 	if err != nil {
 		downloadErr := d.handleHTTPError(err, url)
 		stats.Error = downloadErr
@@ -1120,8 +1784,9 @@ func (d *Downloader) DownloadToWriter(
 	defer func() { _ = resp.Body.Close() }()
 
 	// Check HTTP status code
-	if resp.StatusCode != http.StatusOK {
-		downloadErr := errors.FromHTTPStatus(resp.StatusCode, url)
+	if resp.StatusCode != http.StatusOK &&
+		(options.ByteRange == nil || resp.StatusCode != http.StatusPartialContent) {
+		downloadErr := httpStatusError(resp, url)
 		stats.Error = downloadErr
 		stats.EndTime = time.Now()
 		stats.Duration = stats.EndTime.Sub(stats.StartTime)
@@ -1129,8 +1794,53 @@ func (d *Downloader) DownloadToWriter(
 		return stats, downloadErr
 	}
 
+	return d.receive(ctx, url, resp, writer, options, stats, serverIP)
+}
+
+// streamClient returns the client for a single-stream download of url: the
+// pooled client of its host unless options override the transport.
+func (d *Downloader) streamClient(url string, options *types.DownloadOptions) *http.Client {
+	if hasTransportOverrides(options) {
+		return d.clientFor(options)
+	}
+
+	parsedURL, err := parseURL(url)
+	if err == nil && parsedURL != nil && d.connectionPool != nil {
+		return d.withMiddleware(d.connectionPool.GetClient(parsedURL.Host, DefaultTimeout))
+	}
+
+	return d.withMiddleware(d.client)
+}
+
+// receive writes the body of resp, the successful response to the download
+// request for url, to writer and completes stats.
+func (d *Downloader) receive(
+	ctx context.Context,
+	url string,
+	resp *http.Response,
+	writer io.Writer,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+	serverIP func() string,
+) (*types.DownloadStats, error) {
+	body, watchdog := watchSpeed(resp.Body, options)
+	defer watchdog.Stop()
+
 	// Get content length for progress tracking
 	contentLength := resp.ContentLength
+
+	if options.ByteRange != nil {
+		var rangeErr error
+		body, contentLength, rangeErr = rangeBody(resp, body, *options.ByteRange, url)
+		if rangeErr = watchdog.Err(rangeErr); rangeErr != nil {
+			stats.Error = rangeErr
+			stats.EndTime = time.Now()
+			stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+			return stats, rangeErr
+		}
+	}
+
 	if contentLength > 0 {
 		stats.TotalSize = contentLength
 
@@ -1138,11 +1848,23 @@ func (d *Downloader) DownloadToWriter(
 		optimizeOptionsForContentLength(options, contentLength)
 	}
 
+	// A body announced larger than the limit is not read at all
+	if options.MaxBodySize > 0 && contentLength > options.MaxBodySize {
+		limitErr := responseTooLarge(options.MaxBodySize, contentLength)
+		stats.Error = limitErr
+		stats.EndTime = time.Now()
+		stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+		return stats, limitErr
+	}
+
+	body, limit := limitBody(body, options)
+
 	// Create progress reader if callback is available
-	var progressReader io.Reader = resp.Body
+	progressReader := body
 	if options.ProgressCallback != nil {
 		progressReader = progress.NewProgressReader(
-			resp.Body,
+			body,
 			contentLength,
 			options.ProgressCallback,
 		)
@@ -1156,7 +1878,12 @@ func (d *Downloader) DownloadToWriter(
 
 	// Download the content
 	bytesDownloaded, err := d.downloadContent(ctx, progressReader, writer, options, stats)
+	err = limit.Err(watchdog.Err(err))
+	if err == nil && options.ByteRange != nil {
+		err = checkRangeLength(bytesDownloaded, contentLength)
+	}
 	stats.BytesDownloaded = bytesDownloaded
+	stats.Connections = []types.ConnectionStats{connectionStats(0, bytesDownloaded, stats.StartTime, serverIP())}
 	stats.EndTime = time.Now()
 	stats.Duration = stats.EndTime.Sub(stats.StartTime)
 
@@ -1188,63 +1915,13 @@ func (d *Downloader) DownloadToWriter(
 // GetFileInfo retrieves information about a file without downloading it.
 // It implements the types.Downloader interface.
 func (d *Downloader) GetFileInfo(ctx context.Context, url string) (*types.FileInfo, error) {
-	// Validate URL
-	if err := d.validateURL(url); err != nil {
-		return nil, err
-	}
-
-	// Create HEAD request
-	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
-	if err != nil {
-		return nil, errors.WrapErrorWithURL(err, errors.CodeInvalidURL,
-			"Failed to create HTTP request", url)
-	}
-
-	// Set default User-Agent
-	req.Header.Set("User-Agent", DefaultUserAgent)
-
-	// Perform the request
-	resp, err := d.client.Do(req)
-	if err != nil {
-		return nil, d.handleHTTPError(err, url)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.FromHTTPStatus(resp.StatusCode, url)
-	}
-
-	// Extract file information
-	fileInfo := &types.FileInfo{
-		URL:     url,
-		Headers: resp.Header,
-	}
-
-	// Extract content length
-	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
-		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
-			fileInfo.Size = size
-		}
-	}
-
-	// Extract content type
-	fileInfo.ContentType = resp.Header.Get("Content-Type")
-
-	// Extract last modified
-	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
-		if t, err := http.ParseTime(lastModified); err == nil {
-			fileInfo.LastModified = t
-		}
-	}
-
-	// Extract filename
-	fileInfo.Filename = d.extractFilename(url, resp)
-
-	// Check if server supports range requests
-	fileInfo.SupportsRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+	return d.getFileInfo(ctx, url, d.withMiddleware(d.client), nil)
+}
 
-	return fileInfo, nil
+// GetFileInfoWithOptions is GetFileInfo through the proxy, TLS and name
+// resolution settings of options, as the download itself will be made.
+func (d *Downloader) GetFileInfoWithOptions(ctx context.Context, url string, options *types.DownloadOptions) (*types.FileInfo, error) {
+	return d.getFileInfo(ctx, url, d.clientFor(options), hostCacheFor(options))
 }
 
 // validateURL validates that the provided URL is valid and supported.
@@ -1340,6 +2017,21 @@ func (d *Downloader) setRequestHeaders(req *http.Request, options *types.Downloa
 	}
 }
 
+// httpStatusError converts an unexpected HTTP response into a DownloadError,
+// keeping the start of the response body and carrying over any Retry-After
+// hint on 429 and 503 responses.
+func httpStatusError(resp *http.Response, rawURL string) *errors.DownloadError {
+	downloadErr := errors.FromHTTPResponse(resp, rawURL)
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if delay, ok := retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			downloadErr.RetryAfter = delay
+		}
+	}
+
+	return downloadErr
+}
+
 // handleHTTPError converts HTTP client errors to DownloadError.
 func (d *Downloader) handleHTTPError(err error, rawURL string) *errors.DownloadError {
 	if stdErrors.Is(err, context.Canceled) {
@@ -1375,6 +2067,34 @@ func (d *Downloader) handleHTTPError(err error, rawURL string) *errors.DownloadE
 	return errors.WrapErrorWithURL(err, errors.CodeNetworkError, "Network error occurred", rawURL)
 }
 
+// newRateLimiter returns the bandwidth limiter for a download, or a no-op
+// limiter without MaxRate.
+func newRateLimiter(options *types.DownloadOptions) ratelimit.Limiter {
+	if options.MaxRate <= 0 {
+		return ratelimit.NewNullLimiter()
+	}
+
+	return ratelimit.NewBandwidthLimiterWithBurst(options.MaxRate, options.MaxRateBurst)
+}
+
+// connectionStats returns the stats of a single-connection transfer of
+// bytesDownloaded bytes, requested from rangeStart, that started at start.
+func connectionStats(rangeStart, bytesDownloaded int64, start time.Time, serverIP string) types.ConnectionStats {
+	stats := types.ConnectionStats{
+		RangeStart:      rangeStart,
+		RangeEnd:        -1,
+		BytesDownloaded: bytesDownloaded,
+		Duration:        time.Since(start),
+		ServerIP:        serverIP,
+	}
+
+	if stats.Duration > 0 {
+		stats.Speed = int64(float64(bytesDownloaded) / stats.Duration.Seconds())
+	}
+
+	return stats
+}
+
 // downloadContent downloads the content from the response body to the writer.
 func (d *Downloader) downloadContent(
 	ctx context.Context,
@@ -1383,16 +2103,17 @@ func (d *Downloader) downloadContent(
 	options *types.DownloadOptions,
 	stats *types.DownloadStats,
 ) (int64, error) {
-	buffer := make([]byte, options.ChunkSize)
-
-	// Create rate limiter if max rate is specified
-	var rateLimiter ratelimit.Limiter
-	if options.MaxRate > 0 {
-		rateLimiter = ratelimit.NewBandwidthLimiter(options.MaxRate)
-	} else {
-		rateLimiter = ratelimit.NewNullLimiter()
+	if rf := readerFrom(dst, options); rf != nil {
+		return copyWithReadFrom(ctx, rf, src)
 	}
 
+	bufp := d.buffers.Get(bufpool.SizeFor(options.ChunkSize))
+	defer d.buffers.Put(bufp)
+
+	buffer := *bufp
+
+	rateLimiter := newRateLimiter(options)
+
 	var totalBytes int64
 
 	lastProgressUpdate := time.Now()
@@ -1409,8 +2130,8 @@ func (d *Downloader) downloadContent(
 		default:
 		}
 
-		// Read chunk
-		n, err := src.Read(buffer)
+		// Read chunk, no more than the rate limiter's burst at once
+		n, err := src.Read(buffer[:ratelimit.MaxRead(rateLimiter, len(buffer))])
 		if n > 0 {
 			// Apply rate limiting before writing
 			if rateLimiterErr := rateLimiter.Wait(ctx, n); rateLimiterErr != nil {
@@ -1424,11 +2145,7 @@ func (d *Downloader) downloadContent(
 			// Write chunk
 			written, writeErr := dst.Write(buffer[:n])
 			if writeErr != nil {
-				return totalBytes, errors.WrapError(
-					writeErr,
-					errors.CodePermissionDenied,
-					"Failed to write data",
-				)
+				return totalBytes, wrapWriteError(writeErr)
 			}
 
 			totalBytes += int64(written)
@@ -1461,12 +2178,13 @@ func (d *Downloader) downloadContent(
 	return totalBytes, nil
 }
 
-// extractFilename extracts a filename from the URL or HTTP response headers.
+// extractFilename extracts a filename from the URL or HTTP response headers,
+// sanitized so that it is a safe name on every platform.
 func (d *Downloader) extractFilename(rawURL string, resp *http.Response) string {
 	// Try to get filename from Content-Disposition header
 	if contentDisposition := resp.Header.Get("Content-Disposition"); contentDisposition != "" {
 		if filename := d.parseContentDisposition(contentDisposition); filename != "" {
-			return filename
+			return validation.SanitizeFilename(filename)
 		}
 	}
 
@@ -1494,7 +2212,7 @@ func (d *Downloader) extractFilename(rawURL string, resp *http.Response) string
 		return defaultFilename
 	}
 
-	return filename
+	return validation.SanitizeFilename(filename)
 }
 
 // parseContentDisposition parses the Content-Disposition header to extract filename.
@@ -1524,11 +2242,12 @@ func (d *Downloader) downloadWithResume(
 ) (*types.DownloadStats, error) {
 	startTime := time.Now()
 
-	// Create HTTP request with Range header
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	// Create HTTP request with Range header, recording the server it connects to
+	ctx, serverIP := network.TraceConnection(ctx)
+
+	req, err := newRequest(ctx, url, options)
 	if err != nil {
-		return nil, errors.WrapErrorWithURL(err, errors.CodeInvalidURL,
-			"Failed to create HTTP request", url)
+		return nil, err
 	}
 
 	// Set Range header to resume from offset
@@ -1536,7 +2255,7 @@ func (d *Downloader) downloadWithResume(
 	d.setRequestHeaders(req, options)
 
 	// Perform the request
-	resp, err := d.client.Do(req)
+	resp, err := d.clientFor(options).Do(req)
 	if err != nil {
 		return nil, errors.WrapErrorWithURL(err, errors.CodeNetworkError,
 			"Failed to perform resume request", url)
@@ -1545,9 +2264,12 @@ func (d *Downloader) downloadWithResume(
 
 	// Check for proper resume response (206 Partial Content) or full content (200 OK)
 	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		return nil, errors.FromHTTPStatus(resp.StatusCode, url)
+		return nil, httpStatusError(resp, url)
 	}
 
+	body, watchdog := watchSpeed(resp.Body, options)
+	defer watchdog.Stop()
+
 	// If server doesn't support range requests, it returns 200 OK
 	// In this case, we need to skip the already downloaded bytes
 	actualResumeOffset := int64(0)
@@ -1579,15 +2301,25 @@ func (d *Downloader) downloadWithResume(
 		d.logInfo("Server doesn't support resume, discarding offset", url, map[string]interface{}{
 			"offset": resumeOffset,
 		})
-		_, _ = io.CopyN(io.Discard, resp.Body, resumeOffset)
+		_, _ = io.CopyN(io.Discard, body, resumeOffset)
 	}
 
 	// Copy data to file with progress tracking
-	buf := d.bufferPool.Get(DefaultChunkSize)
-	defer d.bufferPool.Put(buf)
+	bufp := d.buffers.Get(bufpool.SizeFor(options.ChunkSize))
+	defer d.buffers.Put(bufp)
+
+	buf := *bufp
+
+	rateLimiter := newRateLimiter(options)
+	writer, digest := d.hashStream(d.guardSpace(file, file.Name(), options), file.Name(), resumeOffset, options)
 
 	var written int64
 	var lastProgressUpdate time.Time
+
+	defer func() {
+		stats.Connections = []types.ConnectionStats{connectionStats(actualResumeOffset, written, startTime, serverIP())}
+	}()
+
 	progressInterval := 100 * time.Millisecond
 
 	for {
@@ -1601,11 +2333,23 @@ func (d *Downloader) downloadWithResume(
 		default:
 		}
 
-		n, err := resp.Body.Read(buf)
+		n, err := body.Read(buf[:ratelimit.MaxRead(rateLimiter, len(buf))])
 		if n > 0 {
-			nw, werr := file.Write(buf[:n])
+			if rateLimiterErr := rateLimiter.Wait(ctx, n); rateLimiterErr != nil {
+				_ = d.saveResumeProgress(url, file.Name(), stats.BytesDownloaded, stats.TotalSize)
+				return stats, errors.WrapError(rateLimiterErr, errors.CodeCancelled,
+					"Download cancelled during rate limiting")
+			}
+
+			nw, werr := writer.Write(buf[:n])
 			if werr != nil {
 				_ = d.saveResumeProgress(url, file.Name(), stats.BytesDownloaded, stats.TotalSize)
+
+				// The space guard's error already says why the write stopped
+				if errors.GetErrorCode(werr) == errors.CodeInsufficientSpace {
+					return stats, werr
+				}
+
 				return stats, errors.WrapErrorWithURL(werr, errors.CodePermissionDenied,
 					"Failed to write to file", url)
 			}
@@ -1625,8 +2369,8 @@ func (d *Downloader) downloadWithResume(
 				break
 			}
 			_ = d.saveResumeProgress(url, file.Name(), stats.BytesDownloaded, stats.TotalSize)
-			return stats, errors.WrapErrorWithURL(err, errors.CodeNetworkError,
-				"Failed to read response body", url)
+			return stats, watchdog.Err(errors.WrapErrorWithURL(err, errors.CodeNetworkError,
+				"Failed to read response body", url))
 		}
 	}
 
@@ -1634,6 +2378,7 @@ func (d *Downloader) downloadWithResume(
 	stats.Duration = stats.EndTime.Sub(startTime)
 	stats.AverageSpeed = d.calculateDownloadSpeed(written, stats.Duration)
 	stats.Success = true
+	digest.record(stats, nil)
 
 	// Clean up resume file on successful download
 	_ = d.resumeManager.Delete(file.Name())
@@ -1664,6 +2409,8 @@ func (d *Downloader) performLightweightDownload(
 		StartTime: startTime,
 	}
 
+	ctx, serverIP := network.TraceConnection(ctx)
+
 	// Use lightweight downloader with progress if callback is provided
 	var downloaded int64
 	userAgent := ""
@@ -1672,7 +2419,7 @@ func (d *Downloader) performLightweightDownload(
 	}
 
 	if options.ProgressCallback != nil {
-		downloaded, err = d.lightweight.DownloadWithProgressAndOptions(
+		downloaded, err = d.lightweightFor(options).DownloadWithProgressAndOptions(
 			ctx, url, file,
 			func(down, total int64) {
 				// Calculate speed
@@ -1686,13 +2433,14 @@ func (d *Downloader) performLightweightDownload(
 			userAgent,
 		)
 	} else {
-		downloaded, err = d.lightweight.DownloadWithOptions(ctx, url, file, userAgent)
+		downloaded, err = d.lightweightFor(options).DownloadWithOptions(ctx, url, file, userAgent)
 	}
 
 	stats.EndTime = time.Now()
 	stats.Duration = stats.EndTime.Sub(stats.StartTime)
 	stats.BytesDownloaded = downloaded
 	stats.TotalSize = downloaded
+	stats.Connections = []types.ConnectionStats{connectionStats(0, downloaded, startTime, serverIP())}
 
 	if err != nil {
 		stats.Error = err
@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"context"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
@@ -12,11 +13,16 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/forest6511/gdl/internal/cas"
+	"github.com/forest6511/gdl/internal/checksum"
 	"github.com/forest6511/gdl/internal/resume"
 	"github.com/forest6511/gdl/internal/retry"
 	"github.com/forest6511/gdl/internal/storage"
@@ -6496,3 +6502,925 @@ func TestDownloader_DownloadWithResumeSupport(t *testing.T) {
 		}
 	})
 }
+
+func TestDownloader_RetryBudget(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		requests++
+
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader().WithRetryStrategy(retry.NewRetryManager().WithMaxRetries(5))
+	downloader.spaceChecker = nil
+
+	var retries int
+
+	options := &types.DownloadOptions{
+		Backoff: &types.BackoffPolicy{
+			InitialDelay:   time.Millisecond,
+			MaxElapsedTime: time.Second,
+		},
+		RetryCallback: func(attempt int, err error, delay time.Duration) {
+			retries++
+		},
+	}
+
+	start := time.Now()
+	_, err := downloader.Download(context.Background(), server.URL, filepath.Join(t.TempDir(), "out"), options)
+
+	if err == nil {
+		t.Fatal("expected download to fail")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("download took %v, Retry-After beyond the budget should stop retries", elapsed)
+	}
+
+	if requests != 1 || retries != 0 {
+		t.Errorf("requests = %d, retries = %d; want a single attempt", requests, retries)
+	}
+}
+
+func TestDownloader_RetryBackoffPolicy(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		requests++
+		if requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.spaceChecker = nil
+
+	var delays []time.Duration
+
+	options := &types.DownloadOptions{
+		OverwriteExisting: true,
+		Backoff: &types.BackoffPolicy{
+			InitialDelay: 5 * time.Millisecond,
+			MaxDelay:     10 * time.Millisecond,
+			Multiplier:   2,
+		},
+		RetryCallback: func(attempt int, err error, delay time.Duration) {
+			delays = append(delays, delay)
+		},
+	}
+
+	if _, err := downloader.Download(context.Background(), server.URL, filepath.Join(t.TempDir(), "out"), options); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if len(delays) != 2 || delays[0] != 5*time.Millisecond || delays[1] != 10*time.Millisecond {
+		t.Errorf("retry delays = %v, want [5ms 10ms]", delays)
+	}
+}
+
+func TestDownloader_RetryClassifier(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer primary.Close()
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mirror.Close()
+
+	t.Run("switches mirror", func(t *testing.T) {
+		downloader := NewDownloader()
+		downloader.spaceChecker = nil
+
+		var (
+			attempts []int
+			delays   []time.Duration
+		)
+
+		options := &types.DownloadOptions{
+			OverwriteExisting: true,
+			Mirrors:           []string{mirror.URL},
+			RetryClassifier: func(err error, attempt int) types.RetryDecision {
+				attempts = append(attempts, attempt)
+				if downloadErrors.StatusCode(err) != http.StatusNotFound {
+					t.Errorf("classified error = %v, want the 404", err)
+				}
+
+				return types.RetryDecision{Retry: true, Delay: time.Millisecond, SwitchMirror: true}
+			},
+			RetryCallback: func(attempt int, err error, delay time.Duration) {
+				delays = append(delays, delay)
+			},
+		}
+
+		dest := filepath.Join(t.TempDir(), "out")
+		if _, err := downloader.Download(context.Background(), primary.URL, dest, options); err != nil {
+			t.Fatalf("Download() error = %v", err)
+		}
+
+		if content, _ := os.ReadFile(dest); string(content) != "ok" {
+			t.Errorf("content = %q, want the mirror's", content)
+		}
+
+		if len(attempts) != 1 || attempts[0] != 1 {
+			t.Errorf("classifier called for attempts %v, want [1]", attempts)
+		}
+
+		if len(delays) != 1 || delays[0] != time.Millisecond {
+			t.Errorf("retry delays = %v, want [1ms]", delays)
+		}
+	})
+
+	t.Run("stops retrying", func(t *testing.T) {
+		var requests int
+
+		unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer unavailable.Close()
+
+		downloader := NewDownloader()
+		downloader.spaceChecker = nil
+
+		var calls int
+
+		options := &types.DownloadOptions{
+			OverwriteExisting: true,
+			RetryClassifier: func(err error, attempt int) types.RetryDecision {
+				calls++
+				return types.RetryDecision{}
+			},
+		}
+
+		_, err := downloader.Download(context.Background(), unavailable.URL, filepath.Join(t.TempDir(), "out"), options)
+		if err == nil {
+			t.Fatal("Download() succeeded, want the 503")
+		}
+
+		if calls != 1 {
+			t.Errorf("classifier called %d times, want 1", calls)
+		}
+
+		// The file info request and the one download attempt
+		if requests > 2 {
+			t.Errorf("server saw %d requests, want no retries", requests)
+		}
+	})
+}
+
+func TestHTTPStatusError_RetryAfter(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "3")
+
+	err := httpStatusError(resp, "https://example.com")
+	if err.RetryAfter != 3*time.Second {
+		t.Errorf("RetryAfter = %v, want 3s", err.RetryAfter)
+	}
+
+	if !err.Retryable {
+		t.Error("429 responses should be retryable")
+	}
+
+	resp = &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "3")
+
+	if err := httpStatusError(resp, "https://example.com"); err.RetryAfter != 0 {
+		t.Errorf("RetryAfter = %v, want 0 for 404", err.RetryAfter)
+	}
+}
+
+func TestDownloader_ErrorResponseBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+
+		if r.Method != http.MethodHead {
+			_, _ = w.Write([]byte(`{"error": {"code": 403, "message": "Token expired"}}`))
+		}
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.spaceChecker = nil
+
+	_, err := downloader.Download(context.Background(), server.URL+"/file", filepath.Join(t.TempDir(), "file"), nil)
+
+	var downloadErr *downloadErrors.DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("Download() error = %v, want a DownloadError", err)
+	}
+
+	if downloadErr.HTTPStatusCode != http.StatusForbidden || downloadErr.Details != "Server message: Token expired" {
+		t.Errorf("error = %+v, want the server message in Details", downloadErr)
+	}
+
+	if !strings.Contains(downloadErr.ResponseBody, `"code": 403`) {
+		t.Errorf("ResponseBody = %q, want the JSON document", downloadErr.ResponseBody)
+	}
+}
+
+func TestDownloader_CircuitBreaker(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		requests++
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader().WithRetryStrategy(
+		retry.NewRetryManager().WithMaxRetries(5).WithBaseDelay(time.Millisecond),
+	)
+	downloader.spaceChecker = nil
+
+	options := &types.DownloadOptions{
+		OverwriteExisting: true,
+		CircuitBreaker: &types.CircuitBreakerPolicy{
+			FailureThreshold: 2,
+			Cooldown:         time.Minute,
+		},
+	}
+
+	dir := t.TempDir()
+
+	_, err := downloader.Download(context.Background(), server.URL+"/a", filepath.Join(dir, "a"), options)
+	if !errors.Is(err, downloadErrors.ErrCircuitOpen) {
+		t.Fatalf("first download error = %v, want ErrCircuitOpen", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2 before the circuit opens", requests)
+	}
+
+	// A second download to the same host fails fast without a request
+	_, err = downloader.Download(context.Background(), server.URL+"/b", filepath.Join(dir, "b"), options)
+	if !errors.Is(err, downloadErrors.ErrCircuitOpen) {
+		t.Fatalf("second download error = %v, want ErrCircuitOpen", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("requests = %d, want no requests while the circuit is open", requests)
+	}
+}
+
+func TestDownloader_HostLimits(t *testing.T) {
+	const delay = 20 * time.Millisecond
+
+	var (
+		mu     sync.Mutex
+		starts []time.Time
+		active int
+		peak   int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		time.Sleep(5 * time.Millisecond)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("limited content"))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.spaceChecker = nil
+
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := downloader.Download(context.Background(), fmt.Sprintf("%s/%d", server.URL, i),
+				filepath.Join(dir, strconv.Itoa(i)), &types.DownloadOptions{
+					HostLimits: &types.HostLimitPolicy{MaxConnections: 1, Delay: delay},
+				})
+			if err != nil {
+				t.Errorf("Download() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak != 1 {
+		t.Errorf("server saw %d requests at once, want 1", peak)
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < delay/2 {
+			t.Errorf("requests %d and %d started %v apart, want about %v", i-1, i, gap, delay)
+		}
+	}
+}
+
+func TestDownloader_SharedTransport(t *testing.T) {
+	first := NewDownloader()
+	second := NewDownloader()
+
+	if first.client.Transport != second.client.Transport {
+		t.Error("downloaders should share the pooled transport")
+	}
+
+	if first.lightweight.client.Transport != first.client.Transport {
+		t.Error("lightweight mode should reuse the downloader's transport")
+	}
+
+	if first.clientFor(nil) != first.client {
+		t.Error("clientFor() without overrides should return the downloader's client")
+	}
+
+	options := &types.DownloadOptions{
+		Transport: &types.TransportOptions{MaxIdleConnsPerHost: 3, TLSSessionCacheSize: 16},
+	}
+
+	client := first.clientFor(options)
+	if client.Transport == first.client.Transport {
+		t.Fatal("transport overrides should select a different transport")
+	}
+
+	if second.clientFor(options).Transport != client.Transport {
+		t.Error("equal overrides should share one transport across downloaders")
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport type = %T, want *http.Transport", client.Transport)
+	}
+
+	if transport.MaxIdleConnsPerHost != 3 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want 3", transport.MaxIdleConnsPerHost)
+	}
+}
+
+func TestDownloader_ProxyConfig(t *testing.T) {
+	content := "proxied content"
+
+	var proxiedRequests int32
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute target URL
+		if r.URL.Host != "origin.invalid" {
+			http.Error(w, "unexpected target", http.StatusBadGateway)
+			return
+		}
+
+		if r.Header.Get("Proxy-Authorization") == "" {
+			w.Header().Set("Proxy-Authenticate", "Basic")
+			http.Error(w, "auth required", http.StatusProxyAuthRequired)
+
+			return
+		}
+
+		atomic.AddInt32(&proxiedRequests, 1)
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		_, _ = w.Write([]byte(content))
+	}))
+	defer proxy.Close()
+
+	tmpDir := t.TempDir()
+	dest := filepath.Join(tmpDir, "proxied.txt")
+
+	options := &types.DownloadOptions{
+		OverwriteExisting: true,
+		Proxy: &types.ProxyConfig{
+			HTTPURL:  proxy.URL,
+			Username: "user",
+			Password: "secret",
+		},
+	}
+
+	stats, err := NewDownloader().Download(context.Background(), "http://origin.invalid/file.txt", dest, options)
+	if err != nil {
+		t.Fatalf("Download() through proxy error = %v", err)
+	}
+
+	if !stats.Success {
+		t.Error("download through proxy should succeed")
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+
+	if string(data) != content {
+		t.Errorf("content = %q, want %q", data, content)
+	}
+
+	if atomic.LoadInt32(&proxiedRequests) == 0 {
+		t.Error("requests should go through the configured proxy")
+	}
+
+	// NO_PROXY bypasses the proxy for matching hosts
+	options.Proxy.NoProxy = []string{".invalid"}
+
+	if _, err := NewDownloader().Download(context.Background(), "http://origin.invalid/file.txt", dest, options); err == nil {
+		t.Error("Download() should connect directly and fail for a NO_PROXY host")
+	}
+}
+
+func TestDownloader_TLSOptions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "tls.txt")
+	downloader := NewDownloader().WithRetryStrategy(retry.NewRetryManager().WithMaxRetries(0))
+
+	if _, err := downloader.Download(context.Background(), server.URL, dest, &types.DownloadOptions{OverwriteExisting: true}); err == nil {
+		t.Error("download from a self-signed server should fail by default")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+
+	for name, options := range map[string]*types.DownloadOptions{
+		"ca_bundle": {OverwriteExisting: true, TLS: &types.TLSOptions{CAFile: caFile}},
+		"insecure":  {OverwriteExisting: true, InsecureSkipVerify: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := downloader.Download(context.Background(), server.URL, dest, options); err != nil {
+				t.Errorf("Download() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloader_OnlyIfNewer(t *testing.T) {
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	etag := `"v1"`
+	content := "version one"
+
+	var (
+		gets int32
+		mu   sync.Mutex
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+		if match := r.Header.Get("If-None-Match"); match != "" {
+			if match == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil &&
+			!lastModified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+			_, _ = w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.resumeManager = resume.NewManager(t.TempDir())
+
+	dest := filepath.Join(t.TempDir(), "mirror.txt")
+	options := &types.DownloadOptions{OnlyIfNewer: true}
+
+	stats, err := downloader.Download(context.Background(), server.URL, dest, options)
+	if err != nil {
+		t.Fatalf("first Download() error = %v", err)
+	}
+
+	if stats.NotModified {
+		t.Error("first download should not be reported as not modified")
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatalf("failed to stat downloaded file: %v", err)
+	}
+
+	if !info.ModTime().Equal(lastModified) {
+		t.Errorf("mtime = %v, want Last-Modified %v", info.ModTime(), lastModified)
+	}
+
+	stats, err = downloader.Download(context.Background(), server.URL, dest, options)
+	if err != nil {
+		t.Fatalf("second Download() error = %v", err)
+	}
+
+	if !stats.NotModified || !stats.Success {
+		t.Errorf("unchanged file: NotModified = %v, Success = %v, want both true", stats.NotModified, stats.Success)
+	}
+
+	if got := atomic.LoadInt32(&gets); got != 1 {
+		t.Errorf("GET requests = %d, want 1", got)
+	}
+
+	// A new server version is downloaded even though Last-Modified did not change
+	mu.Lock()
+	etag = `"v2"`
+	content = "version two!"
+	mu.Unlock()
+
+	stats, err = downloader.Download(context.Background(), server.URL, dest, options)
+	if err != nil {
+		t.Fatalf("third Download() error = %v", err)
+	}
+
+	if stats.NotModified {
+		t.Error("changed file should be downloaded")
+	}
+
+	data, _ := os.ReadFile(dest)
+	if string(data) != "version two!" {
+		t.Errorf("content = %q, want %q", data, "version two!")
+	}
+}
+
+func TestDownloader_ContentStore(t *testing.T) {
+	content := "shared content"
+
+	var (
+		gets int32
+		mu   sync.Mutex
+		etag = `"v1"`
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+			_, _ = w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	storeDir := t.TempDir()
+	destDir := t.TempDir()
+
+	download := func(name string, store *types.ContentStoreOptions) *types.DownloadStats {
+		t.Helper()
+
+		stats, err := downloader.Download(context.Background(), server.URL,
+			filepath.Join(destDir, name), &types.DownloadOptions{ContentStore: store})
+		if err != nil {
+			t.Fatalf("Download(%s) error = %v", name, err)
+		}
+
+		data, _ := os.ReadFile(filepath.Join(destDir, name))
+		if string(data) != content {
+			t.Errorf("%s content = %q, want %q", name, data, content)
+		}
+
+		return stats
+	}
+
+	if stats := download("first.txt", &types.ContentStoreOptions{Dir: storeDir}); stats.Deduplicated {
+		t.Error("first download should not be deduplicated")
+	}
+
+	// Same URL and ETag: placed from the store
+	if stats := download("second.txt", &types.ContentStoreOptions{Dir: storeDir}); !stats.Deduplicated {
+		t.Error("second download should be deduplicated")
+	}
+
+	if got := atomic.LoadInt32(&gets); got != 1 {
+		t.Errorf("GET requests = %d, want 1", got)
+	}
+
+	// A known digest is placed without consulting the server
+	hash, err := checksum.File(filepath.Join(destDir, "first.txt"), checksum.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	etag = `"v2"`
+	mu.Unlock()
+
+	if stats := download("third.txt", &types.ContentStoreOptions{Dir: storeDir, SHA256: hash, HardLink: true}); !stats.Deduplicated {
+		t.Error("download by digest should be deduplicated")
+	}
+
+	// A new ETag without a digest downloads again
+	if stats := download("fourth.txt", &types.ContentStoreOptions{Dir: storeDir}); stats.Deduplicated {
+		t.Error("changed ETag should not be deduplicated")
+	}
+
+	if got := atomic.LoadInt32(&gets); got != 2 {
+		t.Errorf("GET requests = %d, want 2", got)
+	}
+}
+
+func TestDownloader_ContentStoreHashMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("unexpected content"))
+	}))
+	defer server.Close()
+
+	storeDir := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "file.txt")
+	expected := strings.Repeat("ab", 32)
+
+	stats, err := NewDownloader().Download(context.Background(), server.URL, dest,
+		&types.DownloadOptions{ContentStore: &types.ContentStoreOptions{Dir: storeDir, SHA256: expected}})
+	if downloadErrors.GetErrorCode(err) != downloadErrors.CodeCorruptedData {
+		t.Fatalf("Download() error = %v, want CodeCorruptedData", err)
+	}
+	if stats.Success {
+		t.Error("a download that does not match the expected digest should not succeed")
+	}
+	if _, statErr := os.Stat(dest); !os.IsNotExist(statErr) {
+		t.Error("a download that does not match the expected digest should be deleted")
+	}
+
+	store, err := cas.Open(storeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := store.Lookup(server.URL, `"v1"`); found {
+		t.Error("a download that does not match the expected digest should not be indexed")
+	}
+}
+
+func TestPartFilePath(t *testing.T) {
+	if got := PartFilePath("/data/file.iso", ""); got != "/data/file.iso"+PartFileSuffix {
+		t.Errorf("PartFilePath() = %q, want %q", got, "/data/file.iso"+PartFileSuffix)
+	}
+
+	a := PartFilePath("/data/a/file.iso", "/tmp/parts")
+	b := PartFilePath("/data/b/file.iso", "/tmp/parts")
+
+	if filepath.Dir(a) != "/tmp/parts" || !strings.HasSuffix(a, PartFileSuffix) {
+		t.Errorf("PartFilePath() with temp dir = %q", a)
+	}
+
+	if a == b {
+		t.Error("PartFilePath() should not collide for equal base names")
+	}
+}
+
+func TestDownloader_AtomicWrite(t *testing.T) {
+	content := strings.Repeat("atomic download ", 4096)
+
+	var ranges int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&ranges, 1)
+		}
+
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	t.Run("renames on success", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "file.txt")
+
+		stats, err := NewDownloader().Download(context.Background(), server.URL, dest,
+			&types.DownloadOptions{AtomicWrite: true})
+		if err != nil {
+			t.Fatalf("Download() error = %v", err)
+		}
+
+		if stats.Filename != dest {
+			t.Errorf("Filename = %q, want %q", stats.Filename, dest)
+		}
+
+		if data, _ := os.ReadFile(dest); string(data) != content {
+			t.Errorf("destination has %d bytes, want %d", len(data), len(content))
+		}
+
+		if _, err := os.Stat(PartFilePath(dest, "")); !os.IsNotExist(err) {
+			t.Error("part file should be gone after a successful download")
+		}
+	})
+
+	t.Run("adopts an existing part file", func(t *testing.T) {
+		tempDir := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "file.txt")
+		part := PartFilePath(dest, tempDir)
+
+		if err := os.WriteFile(part, []byte(content[:1000]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		d := NewDownloader()
+		d.resumeManager = resume.NewManager(t.TempDir())
+		d.recordPartialVersion(server.URL, part, &types.FileInfo{Size: int64(len(content))})
+
+		atomic.StoreInt32(&ranges, 0)
+
+		if _, err := d.Download(context.Background(), server.URL, dest,
+			&types.DownloadOptions{AtomicWrite: true, TempDir: tempDir, Resume: true}); err != nil {
+			t.Fatalf("Download() error = %v", err)
+		}
+
+		if data, _ := os.ReadFile(dest); string(data) != content {
+			t.Errorf("destination has %d bytes, want %d", len(data), len(content))
+		}
+
+		if atomic.LoadInt32(&ranges) == 0 {
+			t.Error("existing part file should be resumed with a Range request")
+		}
+
+		if _, err := os.Stat(part); !os.IsNotExist(err) {
+			t.Error("part file should be gone after a successful download")
+		}
+	})
+
+	t.Run("starts over with a part file of another download", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			url    string
+			resume bool
+		}{
+			{"without resume", server.URL, false},
+			{"from another URL", server.URL + "/other", true},
+			{"without a record", "", true},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tempDir := t.TempDir()
+				dest := filepath.Join(t.TempDir(), "file.txt")
+				part := PartFilePath(dest, tempDir)
+
+				if err := os.WriteFile(part, []byte(strings.Repeat("x", 1000)), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				d := NewDownloader()
+				d.resumeManager = resume.NewManager(t.TempDir())
+				if tt.url != "" {
+					d.recordPartialVersion(tt.url, part, &types.FileInfo{Size: int64(len(content))})
+				}
+
+				atomic.StoreInt32(&ranges, 0)
+
+				if _, err := d.Download(context.Background(), server.URL, dest,
+					&types.DownloadOptions{AtomicWrite: true, TempDir: tempDir, Resume: tt.resume}); err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+
+				if data, _ := os.ReadFile(dest); string(data) != content {
+					t.Errorf("destination has %d bytes of %d, want the server's content only", len(data), len(content))
+				}
+
+				if atomic.LoadInt32(&ranges) != 0 {
+					t.Error("part file of another download should not be resumed")
+				}
+			})
+		}
+	})
+
+	t.Run("keeps an existing destination", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "file.txt")
+		if err := os.WriteFile(dest, []byte("keep"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewDownloader().Download(context.Background(), server.URL, dest,
+			&types.DownloadOptions{AtomicWrite: true}); err == nil {
+			t.Error("Download() should refuse to replace an existing file without OverwriteExisting")
+		}
+
+		if data, _ := os.ReadFile(dest); string(data) != "keep" {
+			t.Errorf("destination = %q, want it untouched", data)
+		}
+	})
+}
+
+func TestDownloader_Preallocate(t *testing.T) {
+	downloader := NewDownloader()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	// Single-connection downloads and unknown sizes are not preallocated
+	if err := downloader.preallocate(file, 1<<62, &types.DownloadOptions{MaxConcurrency: 1}); err != nil {
+		t.Errorf("preallocate() with one connection error = %v", err)
+	}
+
+	if err := downloader.preallocate(file, 0, &types.DownloadOptions{MaxConcurrency: 4}); err != nil {
+		t.Errorf("preallocate() with unknown size error = %v", err)
+	}
+
+	// Chunked downloads fail early when the disk cannot hold the file
+	err = downloader.preallocate(file, 1<<62, &types.DownloadOptions{MaxConcurrency: 4})
+
+	var downloadErr *downloadErrors.DownloadError
+	if !errors.As(err, &downloadErr) || downloadErr.Code != downloadErrors.CodeInsufficientSpace {
+		t.Errorf("preallocate() error = %v, want CodeInsufficientSpace", err)
+	}
+
+	if info, _ := file.Stat(); info.Size() != 0 {
+		t.Errorf("preallocate() changed the file size to %d, want 0", info.Size())
+	}
+}
+
+func TestDownloader_ConnectionStats(t *testing.T) {
+	data := bytes.Repeat([]byte("gdl"), 1000)
+
+	var gets atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		// The first attempt fails
+		if gets.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader().WithRetryStrategy(retry.NewRetryManager().WithMaxRetries(2))
+	downloader.spaceChecker = nil
+
+	options := &types.DownloadOptions{
+		OverwriteExisting: true,
+		Backoff:           &types.BackoffPolicy{InitialDelay: time.Millisecond},
+	}
+
+	stats, err := downloader.Download(context.Background(), server.URL, filepath.Join(t.TempDir(), "out"), options)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if stats.Retries != 1 {
+		t.Errorf("Retries = %d, want 1", stats.Retries)
+	}
+
+	if len(stats.Connections) != 1 {
+		t.Fatalf("Connections = %+v, want one entry", stats.Connections)
+	}
+
+	conn := stats.Connections[0]
+	if conn.BytesDownloaded != int64(len(data)) || conn.ServerIP != "127.0.0.1" || conn.RangeStart != 0 || conn.RangeEnd != -1 {
+		t.Errorf("connection stats = %+v", conn)
+	}
+}
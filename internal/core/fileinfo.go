@@ -0,0 +1,205 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forest6511/gdl/internal/hostcache"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// DefaultFileInfoConcurrency is how many URLs GetFileInfoBatch queries at once.
+const DefaultFileInfoConcurrency = 8
+
+// GetFileInfoBatch retrieves information about several files, querying at most
+// DefaultFileInfoConcurrency of them at once. Results are returned in the
+// order of urls; a failure for one URL is reported in its result and does not
+// affect the others.
+func (d *Downloader) GetFileInfoBatch(ctx context.Context, urls []string) []types.FileInfoResult {
+	results := make([]types.FileInfoResult, len(urls))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(len(urls), DefaultFileInfoConcurrency) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				info, err := d.GetFileInfo(ctx, urls[i])
+				results[i] = types.FileInfoResult{URL: urls[i], Info: info, Error: err}
+			}
+		}()
+	}
+
+	for i := range urls {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// getFileInfo performs the HEAD request for GetFileInfo using the given client.
+// Servers that refuse HEAD are probed with a one-byte range GET instead,
+// straight away when cache knows the host refuses it. What the probe learns
+// about the host is recorded in cache, which may be nil.
+func (d *Downloader) getFileInfo(
+	ctx context.Context,
+	url string,
+	client *http.Client,
+	cache *hostcache.Cache,
+) (*types.FileInfo, error) {
+	// Validate URL
+	if err := d.validateURL(url); err != nil {
+		return nil, err
+	}
+
+	host := hostcache.Host(url)
+	entry, _ := cache.Get(host)
+
+	method := http.MethodHead
+	if entry.HeadRejected {
+		d.logInfo("head_skipped", "Host is known to reject HEAD requests", map[string]interface{}{
+			"host": host,
+		})
+
+		method = http.MethodGet
+	}
+
+	start := time.Now()
+
+	resp, err := d.fileInfoRequest(ctx, method, url, client)
+	if err != nil {
+		return nil, err
+	}
+
+	rtt := time.Since(start)
+	rejected := entry.HeadRejected
+
+	if method == http.MethodHead && headRejected(resp.StatusCode) {
+		_ = resp.Body.Close()
+		rejected = true
+
+		// Many CDNs answer HEAD with 403 or 405 but serve GET normally
+		resp, err = d.fileInfoRequest(ctx, http.MethodGet, url, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Check status code
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, httpStatusError(resp, url)
+	}
+
+	info := d.responseFileInfo(url, resp)
+	if cache != nil {
+		d.rememberProbe(cache, host, resp.Proto, rejected, rtt, info)
+	}
+
+	return info, nil
+}
+
+// responseFileInfo describes the file at url from the headers of a successful
+// response to a HEAD, ranged GET or full GET request.
+func (d *Downloader) responseFileInfo(url string, resp *http.Response) *types.FileInfo {
+	fileInfo := &types.FileInfo{
+		URL:      url,
+		FinalURL: url,
+		Headers:  resp.Header,
+	}
+
+	if resp.Request != nil && resp.Request.URL != nil {
+		fileInfo.FinalURL = resp.Request.URL.String()
+	}
+
+	if resp.StatusCode == http.StatusPartialContent {
+		// The body is a single byte; the size is the Content-Range total
+		fileInfo.Size = contentRangeTotal(resp.Header.Get("Content-Range"))
+		fileInfo.SupportsRanges = true
+	} else {
+		// Extract content length
+		if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
+			if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
+				fileInfo.Size = size
+			}
+		}
+
+		// Check if server supports range requests
+		fileInfo.SupportsRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+	}
+
+	// Extract content type
+	fileInfo.ContentType = resp.Header.Get("Content-Type")
+
+	// Extract last modified
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		if t, err := http.ParseTime(lastModified); err == nil {
+			fileInfo.LastModified = t
+		}
+	}
+
+	// Extract filename
+	fileInfo.Filename = d.extractFilename(url, resp)
+
+	return fileInfo
+}
+
+// fileInfoRequest sends a metadata request for url. GET requests ask for the
+// first byte only, so the body of a full response is left unread.
+func (d *Downloader) fileInfoRequest(ctx context.Context, method, url string, client *http.Client) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, errors.WrapErrorWithURL(err, errors.CodeInvalidURL,
+			"Failed to create HTTP request", url)
+	}
+
+	// Set default User-Agent
+	req.Header.Set("User-Agent", DefaultUserAgent)
+
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, d.handleHTTPError(err, url)
+	}
+
+	return resp, nil
+}
+
+// headRejected reports whether a HEAD response status means the server does
+// not allow HEAD rather than that the file is unavailable.
+func headRejected(status int) bool {
+	return status == http.StatusForbidden ||
+		status == http.StatusMethodNotAllowed ||
+		status == http.StatusNotImplemented
+}
+
+// contentRangeTotal returns the complete length from a Content-Range header
+// such as "bytes 0-0/1234", or 0 when it is missing or unknown ("*").
+func contentRangeTotal(header string) int64 {
+	_, total, found := strings.Cut(header, "/")
+	if !found {
+		return 0
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(total), 10, 64)
+	if err != nil || size < 0 {
+		return 0
+	}
+
+	return size
+}
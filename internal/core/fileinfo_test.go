@@ -0,0 +1,196 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetFileInfo_RangeProbe(t *testing.T) {
+	tests := []struct {
+		name       string
+		headStatus int
+		ranges     bool
+		wantRanges bool
+	}{
+		{"HEAD forbidden", http.StatusForbidden, true, true},
+		{"HEAD not allowed", http.StatusMethodNotAllowed, true, true},
+		{"HEAD not implemented", http.StatusNotImplemented, true, true},
+		{"range ignored", http.StatusMethodNotAllowed, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRange string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					w.WriteHeader(tt.headStatus)
+					return
+				}
+
+				gotRange = r.Header.Get("Range")
+				w.Header().Set("Content-Type", "application/zip")
+
+				if tt.ranges {
+					w.Header().Set("Content-Range", "bytes 0-0/123456")
+					w.Header().Set("Content-Length", "1")
+					w.WriteHeader(http.StatusPartialContent)
+					_, _ = w.Write([]byte{0})
+
+					return
+				}
+
+				w.Header().Set("Content-Length", "123456")
+				_, _ = w.Write(make([]byte, 123456))
+			}))
+			defer server.Close()
+
+			info, err := NewDownloader().GetFileInfo(context.Background(), server.URL+"/file.zip")
+			if err != nil {
+				t.Fatalf("GetFileInfo() error = %v", err)
+			}
+
+			if gotRange != "bytes=0-0" {
+				t.Errorf("probe Range = %q, want bytes=0-0", gotRange)
+			}
+
+			if info.Size != 123456 || info.SupportsRanges != tt.wantRanges {
+				t.Errorf("GetFileInfo() = size %d, ranges %v, want 123456, %v",
+					info.Size, info.SupportsRanges, tt.wantRanges)
+			}
+
+			if info.ContentType != "application/zip" || info.Filename != "file.zip" {
+				t.Errorf("GetFileInfo() = type %q, filename %q", info.ContentType, info.Filename)
+			}
+		})
+	}
+}
+
+func TestGetFileInfo_FinalURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest" {
+			http.Redirect(w, r, "/releases/v2/app.tar.gz", http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Length", "42")
+	}))
+	defer server.Close()
+
+	info, err := NewDownloader().GetFileInfo(context.Background(), server.URL+"/latest")
+	if err != nil {
+		t.Fatalf("GetFileInfo() error = %v", err)
+	}
+
+	if info.URL != server.URL+"/latest" || info.FinalURL != server.URL+"/releases/v2/app.tar.gz" {
+		t.Errorf("GetFileInfo() = URL %s, FinalURL %s", info.URL, info.FinalURL)
+	}
+}
+
+func TestGetFileInfo_NoProbeForMissingFile(t *testing.T) {
+	var gets atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, err := NewDownloader().GetFileInfo(context.Background(), server.URL); err == nil {
+		t.Fatal("GetFileInfo() should fail for a missing file")
+	}
+
+	if gets.Load() != 0 {
+		t.Errorf("GetFileInfo() sent %d GET requests for a 404, want none", gets.Load())
+	}
+}
+
+func TestGetFileInfo_ProbeFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if _, err := NewDownloader().GetFileInfo(context.Background(), server.URL); err == nil {
+		t.Fatal("GetFileInfo() should fail when GET is forbidden too")
+	}
+}
+
+func TestGetFileInfoBatch(t *testing.T) {
+	var active, peak atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Length", fmt.Sprint(len(r.URL.Path)))
+	}))
+	defer server.Close()
+
+	urls := make([]string, 0, 3*DefaultFileInfoConcurrency)
+	for i := range cap(urls) - 1 {
+		urls = append(urls, fmt.Sprintf("%s/%d", server.URL, i*1000))
+	}
+
+	urls = append(urls, server.URL+"/missing")
+
+	results := NewDownloader().GetFileInfoBatch(context.Background(), urls)
+	if len(results) != len(urls) {
+		t.Fatalf("GetFileInfoBatch() returned %d results, want %d", len(results), len(urls))
+	}
+
+	for i, result := range results[:len(urls)-1] {
+		if result.URL != urls[i] || result.Error != nil {
+			t.Fatalf("result %d = %s, %v, want %s without error", i, result.URL, result.Error, urls[i])
+		}
+
+		if want := int64(len(fmt.Sprint(i*1000)) + 1); result.Info.Size != want {
+			t.Errorf("result %d size = %d, want %d", i, result.Info.Size, want)
+		}
+	}
+
+	if missing := results[len(urls)-1]; missing.Error == nil || missing.Info != nil {
+		t.Errorf("missing URL result = %+v, want an error", missing)
+	}
+
+	if p := peak.Load(); p > DefaultFileInfoConcurrency {
+		t.Errorf("GetFileInfoBatch() made %d concurrent requests, want at most %d", p, DefaultFileInfoConcurrency)
+	}
+}
+
+func TestContentRangeTotal(t *testing.T) {
+	tests := map[string]int64{
+		"bytes 0-0/1234": 1234,
+		"bytes 0-0/*":    0,
+		"":               0,
+		"bytes 0-0/-5":   0,
+	}
+
+	for header, want := range tests {
+		if got := contentRangeTotal(header); got != want {
+			t.Errorf("contentRangeTotal(%q) = %d, want %d", header, got, want)
+		}
+	}
+}
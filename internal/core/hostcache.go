@@ -0,0 +1,81 @@
+package core
+
+import (
+	"time"
+
+	"github.com/forest6511/gdl/internal/hostcache"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// minThroughputSample is the least a download must transfer from a host for
+// its speed to be remembered as the host's throughput; the speed of shorter
+// ones mostly measures setting up the connection.
+const minThroughputSample = 1024 * 1024
+
+// hostCacheFor returns the host cache options name, or nil when they name
+// none.
+func hostCacheFor(options *types.DownloadOptions) *hostcache.Cache {
+	if options == nil || options.HostCache == "" {
+		return nil
+	}
+
+	return hostcache.Open(options.HostCache)
+}
+
+// knownThroughput returns the throughput remembered for the host of url, or
+// 0 when there is none.
+func knownThroughput(cache *hostcache.Cache, url string) int64 {
+	entry, _ := cache.Get(hostcache.Host(url))
+	return entry.Throughput
+}
+
+// rememberProbe records in cache what a metadata request to host that took
+// rtt learned about it.
+func (d *Downloader) rememberProbe(
+	cache *hostcache.Cache,
+	host, protocol string,
+	headRejected bool,
+	rtt time.Duration,
+	info *types.FileInfo,
+) {
+	err := cache.Update(host, func(entry *hostcache.Entry) {
+		entry.HeadRejected = headRejected
+		entry.SupportsRanges = info.SupportsRanges
+		entry.Protocol = protocol
+		entry.RTT = rtt
+	})
+	if err != nil {
+		d.logError("host_cache", err, map[string]interface{}{"host": host})
+	}
+}
+
+// rememberThroughput records the speed of a completed download as the
+// throughput of its host, or of each source's host for a multi-source one.
+// Downloads too short to measure it are left out.
+func (d *Downloader) rememberThroughput(options *types.DownloadOptions, stats *types.DownloadStats) {
+	cache := hostCacheFor(options)
+	if cache == nil || stats == nil || !stats.Success {
+		return
+	}
+
+	speeds := make(map[string]int64)
+	for _, conn := range stats.Connections {
+		if conn.URL != "" && conn.BytesDownloaded >= minThroughputSample {
+			speeds[hostcache.Host(conn.URL)] = conn.Speed
+		}
+	}
+
+	if len(speeds) == 0 && stats.BytesDownloaded >= minThroughputSample {
+		speeds[hostcache.Host(stats.URL)] = stats.AverageSpeed
+	}
+
+	for host, speed := range speeds {
+		if host == "" || speed <= 0 {
+			continue
+		}
+
+		if err := cache.Update(host, func(entry *hostcache.Entry) { entry.Throughput = speed }); err != nil {
+			d.logError("host_cache", err, map[string]interface{}{"host": host})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/hostcache"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_HostCache(t *testing.T) {
+	content := mirrorTestData(2 * minThroughputSample)
+
+	var heads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	options := func() *types.DownloadOptions {
+		return &types.DownloadOptions{HostCache: filepath.Join(t.TempDir(), "hostcache.json")}
+	}
+	first := options()
+	cache := hostcache.Open(first.HostCache)
+
+	if _, err := NewDownloader().Download(context.Background(), server.URL+"/a.bin",
+		filepath.Join(t.TempDir(), "a.bin"), first); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	entry, ok := cache.Get(hostcache.Host(server.URL))
+	if !ok || !entry.HeadRejected || !entry.SupportsRanges || entry.Protocol != "HTTP/1.1" ||
+		entry.RTT <= 0 || entry.Throughput <= 0 {
+		t.Fatalf("entry = %+v, %v, want the probe and the speed recorded", entry, ok)
+	}
+
+	// The next download from the host goes straight to the range probe
+	second := *first
+	if _, err := NewDownloader().Download(context.Background(), server.URL+"/b.bin",
+		filepath.Join(t.TempDir(), "b.bin"), &second); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if got := heads.Load(); got != 1 {
+		t.Errorf("%d HEAD requests, want only the first download's", got)
+	}
+
+	// Without a cache, every download probes with HEAD first
+	if _, err := NewDownloader().Download(context.Background(), server.URL+"/c.bin",
+		filepath.Join(t.TempDir(), "c.bin"), &types.DownloadOptions{}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if got := heads.Load(); got != 2 {
+		t.Errorf("%d HEAD requests, want 2", got)
+	}
+}
+
+func TestSourceSchedulerExpectedSpeed(t *testing.T) {
+	s := newSourceScheduler(20*streamPieceSize, []string{"a"}, true)
+	s.sources[0].expected = 4 * streamPieceSize
+
+	// The remembered speed sizes the first request, within the lookahead
+	if piece := s.next(context.Background(), s.sources[0]); piece.end != 4*streamPieceSize-1 {
+		t.Errorf("first piece ends at %d, want 4 pieces", piece.end)
+	}
+}
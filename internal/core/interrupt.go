@@ -0,0 +1,65 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/forest6511/gdl/internal/resume"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// keepPartial leaves what an interrupted download of url wrote to file ready
+// to be resumed: it cuts the file to its first size bytes, which have been
+// written without gaps, or keeps all of it when size is negative, flushes it
+// to disk and records the download in the resume directory, where "gdl
+// resume" lists it. fileInfo describes the file on the server.
+func (d *Downloader) keepPartial(url string, file *os.File, size int64, fileInfo *types.FileInfo) {
+	if size >= 0 {
+		if err := file.Truncate(size); err != nil {
+			d.logError("keep_partial", err, map[string]interface{}{"url": url})
+			return
+		}
+	} else if stat, err := file.Stat(); err == nil {
+		size = stat.Size()
+	}
+
+	if err := file.Sync(); err != nil {
+		d.logError("keep_partial", err, map[string]interface{}{"url": url})
+	}
+
+	if d.resumeManager == nil || size <= 0 || !fileInfo.SupportsRanges {
+		return
+	}
+
+	path, err := filepath.Abs(file.Name())
+	if err != nil {
+		return
+	}
+
+	// No checksum: hashing a large partial file could outlast the grace
+	// period of a shutdown
+	info := &resume.ResumeInfo{
+		URL:             url,
+		FilePath:        path,
+		DownloadedBytes: size,
+		TotalBytes:      fileInfo.Size,
+		ETag:            d.getETagFromHeaders(fileInfo.Headers),
+		LastModified:    fileInfo.LastModified,
+		ContentLength:   fileInfo.Size,
+		AcceptRanges:    true,
+	}
+	if err := d.resumeManager.Save(info); err != nil {
+		d.logError("keep_partial", err, map[string]interface{}{"url": url})
+		return
+	}
+
+	// The next run checks that the file has not changed in the meantime
+	if d.loadPartialVersion(url, path) == nil {
+		d.recordPartialVersion(url, path, fileInfo)
+	}
+
+	d.logInfo("partial_kept", "Kept the partial download for resuming", map[string]interface{}{
+		"url":   url,
+		"bytes": size,
+	})
+}
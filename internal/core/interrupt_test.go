@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/resume"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_KeepPartialOnInterrupt(t *testing.T) {
+	data := mirrorTestData(4 * 1024 * 1024)
+
+	// Serves whole-file GETs slowly, in blocks of 16 KiB
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			return
+		}
+
+		w.Header().Set("Accept-Ranges", "bytes")
+		for pos := 0; pos < len(data); pos += 16 * 1024 {
+			if _, err := w.Write(data[pos : pos+16*1024]); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}))
+	defer slow.Close()
+
+	mirror := newMirrorServer(t, data, 20*time.Millisecond, nil)
+	primary := newMirrorServer(t, data, 20*time.Millisecond, nil)
+
+	tests := []struct {
+		name    string
+		url     string
+		options *types.DownloadOptions
+	}{
+		{"single stream", slow.URL + "/file.bin", &types.DownloadOptions{Resume: true}},
+		{"multi source", primary.URL + "/file.bin", &types.DownloadOptions{Mirrors: []string{mirror.URL + "/file.bin"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader()
+			d.resumeManager = resume.NewManager(t.TempDir())
+
+			dest := filepath.Join(t.TempDir(), "file.bin")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			if _, err := d.Download(ctx, tt.url, dest, tt.options); err == nil {
+				t.Fatal("Download() succeeded despite the interruption")
+			}
+
+			// What is kept is a gapless beginning of the file, recorded for resuming
+			content, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(content) == 0 || len(content) >= len(data) || !bytes.Equal(content, data[:len(content)]) {
+				t.Fatalf("kept %d bytes, want a prefix of the file", len(content))
+			}
+
+			info, err := d.resumeManager.Load(dest)
+			if err != nil || info == nil || info.DownloadedBytes != int64(len(content)) || info.URL != tt.url {
+				t.Fatalf("resume record = %+v (%v), want %d bytes of %s", info, err, len(content), tt.url)
+			}
+
+			stats, err := d.Download(context.Background(), tt.url, dest, &types.DownloadOptions{Resume: true})
+			if err != nil {
+				t.Fatalf("resumed Download() error = %v", err)
+			}
+			if !stats.Resumed {
+				t.Error("the download started over instead of resuming")
+			}
+
+			if content, _ := os.ReadFile(dest); !bytes.Equal(content, data) {
+				t.Error("resumed file differs from the served data")
+			}
+			if info, _ := d.resumeManager.Load(dest); info != nil {
+				t.Error("resume record kept after the download completed")
+			}
+		})
+	}
+}
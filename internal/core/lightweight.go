@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/forest6511/gdl/internal/network"
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 )
 
@@ -15,19 +16,18 @@ type LightweightDownloader struct {
 	client *http.Client
 }
 
-// NewLightweightDownloader creates a new lightweight downloader optimized for small files
+// NewLightweightDownloader creates a new lightweight downloader optimized for small files.
+// It uses the shared download transport so that many small files reuse connections.
 func NewLightweightDownloader() *LightweightDownloader {
+	return newLightweightDownloader(network.SharedTransport(network.DefaultTransportConfig()))
+}
+
+// newLightweightDownloader creates a lightweight downloader on the given transport
+func newLightweightDownloader(transport http.RoundTripper) *LightweightDownloader {
 	return &LightweightDownloader{
 		client: &http.Client{
-			Transport: &http.Transport{
-				MaxIdleConns:        1,
-				MaxIdleConnsPerHost: 1,
-				MaxConnsPerHost:     1,
-				IdleConnTimeout:     10 * time.Second,
-				DisableCompression:  false,
-				DisableKeepAlives:   true, // Disable keep-alive for single small downloads
-			},
-			Timeout: 30 * time.Second,
+			Transport: transport,
+			Timeout:   30 * time.Second,
 		},
 	}
 }
@@ -57,7 +57,7 @@ func (ld *LightweightDownloader) DownloadWithOptions(ctx context.Context, url st
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, gdlerrors.FromHTTPStatus(resp.StatusCode, url)
+		return 0, httpStatusError(resp, url)
 	}
 
 	// Use a small buffer for small files to reduce memory overhead
@@ -96,7 +96,7 @@ func (ld *LightweightDownloader) DownloadWithProgressAndOptions(ctx context.Cont
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, gdlerrors.FromHTTPStatus(resp.StatusCode, url)
+		return 0, httpStatusError(resp, url)
 	}
 
 	contentLength := resp.ContentLength
@@ -0,0 +1,59 @@
+package core
+
+import (
+	stdErrors "errors"
+	"os"
+	"time"
+
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/internal/storage"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// applyMetadata sets the file system metadata of the completed download of
+// url at path: the modification time from the server's Last-Modified time,
+// the permission bits and the provenance extended attributes, as options ask.
+// Metadata that cannot be set is logged and does not fail the download.
+func (d *Downloader) applyMetadata(url, path string, options *types.DownloadOptions, result *types.DownloadStats) {
+	if result == nil {
+		return
+	}
+
+	if !options.KeepDownloadTime && !result.LastModified.IsZero() {
+		if err := os.Chtimes(path, time.Now(), result.LastModified); err != nil {
+			d.logError("set_mtime", err, map[string]interface{}{"destination": path})
+		}
+	}
+
+	if options.FileMode != 0 {
+		if err := os.Chmod(path, options.FileMode.Perm()); err != nil {
+			d.logError("set_mode", err, map[string]interface{}{"destination": path})
+		}
+	}
+
+	if options.Xattrs {
+		d.setProvenance(url, path)
+	}
+}
+
+// setProvenance records the source URL and the SHA-256 of the file at path in
+// its extended attributes.
+func (d *Downloader) setProvenance(url, path string) {
+	attrs := map[string]string{storage.XattrOriginURL: url}
+
+	if digest, err := checksum.File(path, checksum.SHA256); err == nil {
+		attrs[storage.XattrSHA256] = digest
+	} else {
+		d.logError("hash_file", err, map[string]interface{}{"destination": path})
+	}
+
+	for name, value := range attrs {
+		if err := storage.SetXattr(path, name, []byte(value)); err != nil {
+			d.logError("set_xattr", err, map[string]interface{}{"destination": path, "name": name})
+
+			if stdErrors.Is(err, storage.ErrXattrUnsupported) {
+				return
+			}
+		}
+	}
+}
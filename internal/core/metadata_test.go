@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_FileMetadata(t *testing.T) {
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	content := "versioned content"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		options   types.DownloadOptions
+		wantMtime bool
+	}{
+		{"default", types.DownloadOptions{}, true},
+		{"atomic", types.DownloadOptions{AtomicWrite: true}, true},
+		{"keep download time", types.DownloadOptions{KeepDownloadTime: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "file.txt")
+			options := tt.options
+
+			stats, err := NewDownloader().Download(context.Background(), server.URL+"/file.txt", dest, &options)
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if !stats.LastModified.Equal(lastModified) {
+				t.Errorf("LastModified = %v, want %v", stats.LastModified, lastModified)
+			}
+
+			info, err := os.Stat(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := info.ModTime().Equal(lastModified); got != tt.wantMtime {
+				t.Errorf("mtime = %v, set from Last-Modified = %v, want %v", info.ModTime(), got, tt.wantMtime)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+//go:build linux || darwin
+
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/internal/storage"
+	"github.com/forest6511/gdl/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+func TestDownloader_FileModeAndXattrs(t *testing.T) {
+	content := "provenance"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "tool.sh")
+	url := server.URL + "/tool.sh"
+
+	options := &types.DownloadOptions{FileMode: 0o750, Xattrs: true}
+	if _, err := NewDownloader().Download(context.Background(), url, dest, options); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o750 {
+		t.Errorf("mode = %v, want 0750", info.Mode().Perm())
+	}
+
+	// Probe the file system before expecting attributes on the download
+	probe := filepath.Join(t.TempDir(), "probe")
+	if err := os.WriteFile(probe, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetXattr(probe, storage.XattrOriginURL, []byte("x")); errors.Is(err, storage.ErrXattrUnsupported) {
+		t.Skip("file system does not support extended attributes")
+	}
+
+	digest, err := checksum.File(dest, checksum.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{storage.XattrOriginURL: url, storage.XattrSHA256: digest} {
+		if got := getXattr(t, dest, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// getXattr returns the extended attribute name of the file at path.
+func getXattr(t *testing.T, path, name string) string {
+	t.Helper()
+
+	buf := make([]byte, 256)
+	n, err := unix.Getxattr(path, name, buf)
+	if err != nil {
+		t.Fatalf("Getxattr(%s) error = %v", name, err)
+	}
+
+	return string(buf[:n])
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/middleware"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_Use(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Signed request" {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+
+		_, _ = w.Write(bytes.Repeat([]byte{'x'}, 4096))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		options *types.DownloadOptions
+	}{
+		{"default", &types.DownloadOptions{}},
+		{"resume", &types.DownloadOptions{Resume: true}},
+		{"transport override", &types.DownloadOptions{Transport: &types.TransportOptions{MaxIdleConnsPerHost: 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+
+			count := func(next http.RoundTripper) http.RoundTripper {
+				return middleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					requests.Add(1)
+					return next.RoundTrip(req)
+				})
+			}
+
+			downloader := NewDownloader().Use(
+				middleware.RequestHeaderMiddleware(map[string]string{"Authorization": "Signed request"}),
+				count,
+			)
+			downloader.spaceChecker = nil
+
+			dest := filepath.Join(t.TempDir(), "file.bin")
+
+			stats, err := downloader.Download(context.Background(), server.URL, dest, tt.options)
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if stats.BytesDownloaded != 4096 {
+				t.Errorf("BytesDownloaded = %d, want 4096", stats.BytesDownloaded)
+			}
+
+			// The HEAD probe and the GET both pass through the middleware
+			if requests.Load() < 2 {
+				t.Errorf("middleware saw %d requests, want at least 2", requests.Load())
+			}
+		})
+	}
+}
+
+func TestDownloader_UseDownloadToWriter(t *testing.T) {
+	var sawHeader atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawHeader.Store(r.Header.Get("X-Trace") == "on")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader().Use(middleware.RequestHeaderMiddleware(map[string]string{"X-Trace": "on"}))
+
+	var buf bytes.Buffer
+	if _, err := downloader.DownloadToWriter(context.Background(), server.URL, &buf, nil); err != nil {
+		t.Fatalf("DownloadToWriter() error = %v", err)
+	}
+
+	if !sawHeader.Load() || buf.String() != "data" {
+		t.Errorf("header seen = %v, body = %q", sawHeader.Load(), buf.String())
+	}
+}
@@ -0,0 +1,850 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/forest6511/gdl/internal/bufpool"
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/internal/network"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+const (
+	// minSourcePiece is the smallest range split off for another source;
+	// smaller remainders are only handed over whole.
+	minSourcePiece = 256 * 1024
+
+	// piecesPerSource is how many pieces per source a multi-source download
+	// is split into up front.
+	piecesPerSource = 4
+
+	// maxSourceFailures is how many failed requests take a source out of a
+	// multi-source download.
+	maxSourceFailures = 3
+
+	// maxRangeViolations is how many responses for other bytes than requested
+	// a source may send before it is taken out. Some CDNs answer range
+	// requests with the whole file from a few edge nodes only, so the
+	// connection of each such response is closed and the range asked again.
+	maxRangeViolations = 2
+
+	// streamPieceSize is the piece size of stream-order downloads, and
+	// streamLookahead how many pieces past the first missing byte sources may
+	// start fetching.
+	streamPieceSize = 1024 * 1024
+	streamLookahead = 8
+
+	// sourceCheckInterval is how often idle sources look for a slow source to
+	// take work from, and how often progress is reported.
+	sourceCheckInterval = 250 * time.Millisecond
+
+	// coalesceDuration is how long a request is meant to last at least. A
+	// source that would fetch a piece faster takes the adjacent pending
+	// pieces along in the same request, up to what it fetches in this time,
+	// so small pieces do not cost a round trip each.
+	coalesceDuration = time.Second
+)
+
+// downloadSource is one URL of a multi-source download. Its fields are
+// guarded by the scheduler.
+type downloadSource struct {
+	index    int
+	url      string
+	bytes    int64
+	first    int64 // Lowest offset written from the source (-1 = none)
+	last     int64 // Highest offset written from the source
+	requests int
+	failures int
+	expected float64 // Speed remembered for the source's host, until it sends data
+	ranges   int     // Responses for other bytes than requested
+	disabled bool
+	serverIP string
+	duration time.Duration
+}
+
+// sourcePiece is a byte range of a multi-source download, fetched by one
+// source at a time. next is the first byte still to be written; end shrinks
+// when the rest of the piece is handed to a faster source.
+type sourcePiece struct {
+	next   int64
+	end    int64
+	owner  *downloadSource
+	cancel context.CancelFunc // Stops the request for the piece
+}
+
+// sourceScheduler hands the pieces of a multi-source download to its sources.
+// Pieces are taken in order as sources become idle, so faster sources fetch
+// more of them; once none are left, an idle source takes half of the rest of
+// a piece, or all of a small rest, from a source less than half as fast.
+// In stream order, pieces are small and no piece starting more than window
+// bytes past the first missing byte is started, so the file fills in from
+// its beginning. A source fast enough to fetch a piece in less than
+// coalesceDuration is handed adjacent pending pieces together, as one range.
+type sourceScheduler struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	sources []*downloadSource
+	pending []*sourcePiece
+	active  []*sourcePiece
+	start   time.Time
+	written int64
+	size    int64
+	window  int64 // Lookahead of stream-order downloads (0 = unlimited)
+	err     error
+}
+
+// newSourceScheduler splits size bytes into pieces for downloading from urls,
+// in stream order when streamOrder is set.
+func newSourceScheduler(size int64, urls []string, streamOrder bool) *sourceScheduler {
+	s := &sourceScheduler{start: time.Now(), size: size}
+	s.cond = sync.NewCond(&s.mu)
+
+	for i, url := range urls {
+		s.sources = append(s.sources, &downloadSource{index: i, url: url, first: -1})
+	}
+
+	pieceSize := max(size/int64(len(urls)*piecesPerSource), minSourcePiece)
+	if streamOrder {
+		pieceSize = streamPieceSize
+		s.window = streamLookahead * streamPieceSize
+	}
+
+	for start := int64(0); start < size; start += pieceSize {
+		s.pending = append(s.pending, &sourcePiece{next: start, end: min(start+pieceSize, size) - 1})
+	}
+
+	return s
+}
+
+// next returns the piece src fetches next, waiting while other sources are
+// busy and there is nothing to take over, or nil when src is done.
+func (s *sourceScheduler) next(ctx context.Context, src *downloadSource) *sourcePiece {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.err == nil && ctx.Err() == nil && !src.disabled {
+		if len(s.pending) > 0 && s.inWindow(s.pending[0]) {
+			limit := s.windowEnd()
+			piece := s.pending[0]
+			s.pending = s.pending[1:]
+			s.coalesce(piece, src, limit)
+
+			return s.assign(piece, src)
+		}
+
+		if piece := s.steal(src); piece != nil {
+			return s.assign(piece, src)
+		}
+
+		if len(s.active) == 0 {
+			break
+		}
+
+		s.cond.Wait()
+	}
+
+	return nil
+}
+
+// inWindow reports whether piece starts within the lookahead of a
+// stream-order download.
+func (s *sourceScheduler) inWindow(piece *sourcePiece) bool {
+	return piece.next < s.windowEnd()
+}
+
+// windowEnd returns the offset no piece of a stream-order download may start
+// at or past, or size when there is no lookahead. There is a pending piece.
+func (s *sourceScheduler) windowEnd() int64 {
+	if s.window == 0 {
+		return s.size
+	}
+
+	// The first missing byte is in an active piece or the first pending one
+	first := s.pending[0].next
+	for _, active := range s.active {
+		if active.next <= active.end {
+			first = min(first, active.next)
+		}
+	}
+
+	return first + s.window
+}
+
+// coalesce extends piece, just taken by src, over the pending pieces right
+// after it, as long as src fetches the result within coalesceDuration at
+// its speed so far, or the one remembered for its host before it has sent
+// any data, and, in stream order, it ends before limit and leaves the other
+// sources their share of the lookahead.
+func (s *sourceScheduler) coalesce(piece *sourcePiece, src *downloadSource, limit int64) {
+	size := int64(s.speed(src) * coalesceDuration.Seconds())
+	if s.window > 0 {
+		size = min(size, s.window/int64(len(s.sources)))
+	}
+
+	for len(s.pending) > 0 {
+		next := s.pending[0]
+		if next.next != piece.end+1 || next.end >= limit || next.end-piece.next+1 > size {
+			return
+		}
+
+		piece.end = next.end
+		s.pending = s.pending[1:]
+	}
+}
+
+// assign makes src the owner of piece.
+func (s *sourceScheduler) assign(piece *sourcePiece, src *downloadSource) *sourcePiece {
+	piece.owner = src
+	src.requests++
+	s.active = append(s.active, piece)
+
+	return piece
+}
+
+// steal splits off the rest of the largest piece owned by a source less than
+// half as fast as src, or returns nil if there is none.
+func (s *sourceScheduler) steal(src *downloadSource) *sourcePiece {
+	var victim *sourcePiece
+
+	speed := s.speed(src)
+	for _, piece := range s.active {
+		if piece.owner == src || piece.next > piece.end || s.speed(piece.owner)*2 >= speed {
+			continue
+		}
+
+		if victim == nil || piece.end-piece.next > victim.end-victim.next {
+			victim = piece
+		}
+	}
+
+	if victim == nil {
+		return nil
+	}
+
+	start := victim.next
+	if remaining := victim.end - victim.next + 1; remaining >= 2*minSourcePiece {
+		start += remaining / 2
+	}
+
+	piece := &sourcePiece{next: start, end: victim.end}
+	victim.end = start - 1
+
+	// Nothing is left for a stalled request to wait for
+	if start == victim.next && victim.cancel != nil {
+		victim.cancel()
+	}
+
+	return piece
+}
+
+// speed returns the average speed of src since the download started, or
+// the speed expected of it before it has sent any data.
+func (s *sourceScheduler) speed(src *downloadSource) float64 {
+	if src.bytes == 0 {
+		return src.expected
+	}
+
+	elapsed := time.Since(s.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(src.bytes) / elapsed
+}
+
+// reserve claims up to n bytes of piece for writing and returns the offset
+// they are written at and how many may be written; fewer than n once the
+// piece ends or has been handed over in part.
+func (s *sourceScheduler) reserve(piece *sourcePiece, n int64) (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset := piece.next
+	allowed := max(min(n, piece.end-piece.next+1), 0)
+	if allowed == 0 {
+		return offset, 0
+	}
+
+	piece.next += allowed
+	s.written += allowed
+
+	src := piece.owner
+	src.bytes += allowed
+	src.last = max(src.last, offset+allowed-1)
+	if src.first < 0 || offset < src.first {
+		src.first = offset
+	}
+
+	return offset, allowed
+}
+
+// finish ends the fetch of piece by its owner with err. The rest of a piece
+// that was not completed is fetched again, by the next idle source, and the
+// owner is taken out after too many failures or responses ignoring ranges.
+func (s *sourceScheduler) finish(piece *sourcePiece, serverIP string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.cond.Broadcast()
+
+	src := piece.owner
+	if serverIP != "" {
+		src.serverIP = serverIP
+	}
+
+	for i, active := range s.active {
+		if active == piece {
+			s.active = append(s.active[:i], s.active[i+1:]...)
+			break
+		}
+	}
+
+	if piece.next > piece.end {
+		return
+	}
+
+	if err == nil {
+		err = errors.NewDownloadErrorWithDetails(errors.CodeNetworkError, "Range download incomplete",
+			fmt.Sprintf("%s ended before byte %d", src.url, piece.end))
+	}
+
+	src.failures++
+	if stdErrors.Is(err, errors.ErrRangeIgnored) {
+		src.ranges++
+	}
+
+	if src.failures >= maxSourceFailures || src.ranges > maxRangeViolations {
+		src.disabled = true
+	}
+
+	piece.owner = nil
+	piece.cancel = nil
+	s.pending = append([]*sourcePiece{piece}, s.pending...)
+
+	for _, source := range s.sources {
+		if !source.disabled {
+			return
+		}
+	}
+
+	// No source is left for the rest of the file
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// done records that src has stopped fetching.
+func (s *sourceScheduler) done(src *downloadSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src.duration = time.Since(s.start)
+}
+
+// fail stops the download with err.
+func (s *sourceScheduler) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+
+	s.cond.Broadcast()
+}
+
+// progress returns the number of bytes written so far.
+func (s *sourceScheduler) progress() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.written
+}
+
+// contiguous returns how many bytes from the start of the file have been
+// written without a gap, once every source has stopped.
+func (s *sourceScheduler) contiguous() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := s.size
+	for _, piece := range slices.Concat(s.pending, s.active) {
+		if piece.next <= piece.end {
+			first = min(first, piece.next)
+		}
+	}
+
+	return first
+}
+
+// result returns the bytes written and the transfer stats of each source.
+func (s *sourceScheduler) result() (int64, []types.ConnectionStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	connections := make([]types.ConnectionStats, len(s.sources))
+	for i, src := range s.sources {
+		connections[i] = types.ConnectionStats{
+			Index:           src.index,
+			RangeStart:      max(src.first, 0),
+			RangeEnd:        src.last,
+			BytesDownloaded: src.bytes,
+			Duration:        src.duration,
+			Requests:        src.requests,
+			Retries:         src.failures,
+			ServerIP:        src.serverIP,
+			URL:             src.url,
+			RangeViolations: src.ranges,
+		}
+
+		if src.duration > 0 {
+			connections[i].Speed = int64(float64(src.bytes) / src.duration.Seconds())
+		}
+	}
+
+	return s.written, connections
+}
+
+// monitor wakes idle sources to look for work to take over and reports the
+// progress of the download until stop is closed.
+func (s *sourceScheduler) monitor(stop <-chan struct{}, options *types.DownloadOptions) {
+	ticker := time.NewTicker(sourceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+
+		written := s.progress()
+
+		var speed int64
+		if elapsed := time.Since(s.start); elapsed > 0 {
+			speed = int64(float64(written) / elapsed.Seconds())
+		}
+
+		if options.Progress != nil {
+			options.Progress.Update(written, s.size, speed)
+		}
+
+		if options.ProgressCallback != nil {
+			options.ProgressCallback(written, s.size, speed)
+		}
+	}
+}
+
+// ValidateMirrorStrategy checks that strategy is one of the
+// DownloadOptions.MirrorStrategy values, or empty.
+func ValidateMirrorStrategy(strategy string) error {
+	switch strategy {
+	case "", types.MirrorOrdered, types.MirrorFastest, types.MirrorRandom:
+		return nil
+	default:
+		return errors.NewValidationError("mirror_strategy",
+			fmt.Sprintf("unknown mirror strategy %q: expected %s, %s or %s", strategy,
+				types.MirrorOrdered, types.MirrorFastest, types.MirrorRandom))
+	}
+}
+
+// mirrorProbe is the outcome of probing a mirror.
+type mirrorProbe struct {
+	url    string
+	rtt    time.Duration
+	usable bool
+}
+
+// selectMirrors returns the URLs of the usable mirrors among probes, which
+// are in the listed order, ordered by strategy and cut to limit when it is
+// positive.
+func selectMirrors(probes []mirrorProbe, strategy string, limit int) []string {
+	usable := make([]mirrorProbe, 0, len(probes))
+	for _, probe := range probes {
+		if probe.usable {
+			usable = append(usable, probe)
+		}
+	}
+
+	switch strategy {
+	case types.MirrorFastest:
+		slices.SortStableFunc(usable, func(a, b mirrorProbe) int {
+			return cmp.Compare(a.rtt, b.rtt)
+		})
+	case types.MirrorRandom:
+		rand.Shuffle(len(usable), func(i, j int) {
+			usable[i], usable[j] = usable[j], usable[i]
+		})
+	}
+
+	if limit > 0 && len(usable) > limit {
+		usable = usable[:limit]
+	}
+
+	urls := make([]string, len(usable))
+	for i, probe := range usable {
+		urls[i] = probe.url
+	}
+
+	return urls
+}
+
+// mirrorSources returns url followed by the mirrors in options that serve the
+// file described by fileInfo in ranges, with the same size, chosen and
+// ordered by options.MirrorStrategy and options.MaxMirrors. The mirrors are
+// probed at the same time, and how long each took to answer is its round
+// trip time for MirrorFastest. Other mirrors are left out.
+func (d *Downloader) mirrorSources(
+	ctx context.Context,
+	url string,
+	options *types.DownloadOptions,
+	fileInfo *types.FileInfo,
+) []string {
+	var probes []mirrorProbe
+
+	seen := map[string]bool{url: true}
+
+	for _, mirror := range options.Mirrors {
+		if seen[mirror] {
+			continue
+		}
+
+		seen[mirror] = true
+
+		if err := d.validateURL(mirror); err != nil {
+			d.logError("mirror_skipped", err, map[string]interface{}{"mirror": mirror})
+			continue
+		}
+
+		probes = append(probes, mirrorProbe{url: mirror})
+	}
+
+	var wg sync.WaitGroup
+
+	for i := range probes {
+		wg.Add(1)
+
+		go func(probe *mirrorProbe) {
+			defer wg.Done()
+
+			start := time.Now()
+			info, err := d.GetFileInfoWithOptions(ctx, probe.url, options)
+			probe.rtt = time.Since(start)
+
+			if err != nil || !info.SupportsRanges || info.Size != fileInfo.Size {
+				d.logInfo("mirror_skipped", "Mirror does not serve the same file in ranges", map[string]interface{}{
+					"mirror": probe.url,
+				})
+
+				return
+			}
+
+			probe.usable = true
+		}(&probes[i])
+	}
+
+	wg.Wait()
+
+	mirrors := selectMirrors(probes, options.MirrorStrategy, options.MaxMirrors)
+
+	if len(mirrors) > 0 {
+		rtts := make(map[string]string, len(probes))
+		for _, probe := range probes {
+			if probe.usable {
+				rtts[probe.url] = probe.rtt.Round(time.Millisecond).String()
+			}
+		}
+
+		d.logInfo("mirrors_selected", "Selected mirrors", map[string]interface{}{
+			"strategy": options.MirrorStrategy,
+			"mirrors":  mirrors,
+			"rtts":     rtts,
+		})
+	}
+
+	return append([]string{url}, mirrors...)
+}
+
+// performMultiSourceDownload downloads the file at url to destination in
+// pieces fetched from url and its mirrors at the same time, one connection
+// per source. Without a usable mirror it is a single download.
+func (d *Downloader) performMultiSourceDownload(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	fileInfo *types.FileInfo,
+) (*types.DownloadStats, error) {
+	urls := d.mirrorSources(ctx, url, options, fileInfo)
+	if len(urls) == 1 {
+		return d.performSingleDownload(ctx, url, destination, options, fileInfo)
+	}
+
+	scheduler := newSourceScheduler(fileInfo.Size, urls, options.StreamOrder)
+	if cache := hostCacheFor(options); cache != nil {
+		for _, src := range scheduler.sources {
+			src.expected = float64(knownThroughput(cache, src.url))
+		}
+	}
+
+	plan := &types.TransferPlan{
+		Sources:   len(urls),
+		Pieces:    len(scheduler.pending),
+		PieceSize: scheduler.pending[0].end + 1,
+	}
+
+	d.logInfo("using_multi_source", "Downloading from several sources", map[string]interface{}{
+		"sources":    plan.Sources,
+		"size":       fileInfo.Size,
+		"pieces":     plan.Pieces,
+		"piece_size": plan.PieceSize,
+	})
+
+	stats := &types.DownloadStats{
+		URL:       url,
+		Filename:  destination,
+		TotalSize: fileInfo.Size,
+		StartTime: time.Now(),
+	}
+
+	// #nosec G304 -- destination validated by ValidateDestination() in public API functions
+	file, err := os.Create(destination)
+	if err != nil {
+		return nil, errors.WrapErrorWithURL(err, errors.CodePermissionDenied,
+			"Failed to create destination file", url)
+	}
+	defer func() { _ = file.Close() }()
+
+	if err := d.preallocate(file, fileInfo.Size, options); err != nil {
+		return nil, d.wrapDownloadError(err, url, destination, 0, fileInfo.Size)
+	}
+
+	if options.Progress != nil {
+		options.Progress.Start(filepath.Base(destination), fileInfo.Size)
+	}
+
+	client := d.clientFor(options)
+	limiter := newRateLimiter(options)
+
+	// The file is hashed while the pieces are written
+	var tracker *checksum.Tracker
+	if wantsChecksum(options) {
+		if tracker, err = checksum.NewTracker(file, options.ChecksumAlgorithm); err != nil {
+			return nil, err
+		}
+		defer tracker.Close()
+	}
+
+	stop := make(chan struct{})
+	monitorDone := make(chan struct{})
+
+	go func() {
+		defer close(monitorDone)
+		scheduler.monitor(stop, options)
+	}()
+
+	var wg sync.WaitGroup
+	for _, src := range scheduler.sources {
+		wg.Add(1)
+
+		go func(src *downloadSource) {
+			defer wg.Done()
+			defer scheduler.done(src)
+
+			for {
+				piece := scheduler.next(ctx, src)
+				if piece == nil {
+					return
+				}
+
+				serverIP, err := d.fetchPiece(ctx, scheduler, piece, src.url, file, tracker, client, limiter, options)
+				scheduler.finish(piece, serverIP, err)
+			}
+		}(src)
+	}
+
+	wg.Wait()
+	close(stop)
+	<-monitorDone
+
+	stats.BytesDownloaded, stats.Connections = scheduler.result()
+	stats.EndTime = time.Now()
+	stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+	for _, conn := range stats.Connections {
+		stats.RangeViolations += conn.RangeViolations
+		plan.Requests += conn.Requests
+	}
+	stats.Plan = plan
+
+	err = scheduler.err
+	if ctx.Err() != nil {
+		// The workers have stopped; keep the part of the file written without
+		// gaps so that resuming continues from its end
+		d.keepPartial(url, file, scheduler.contiguous(), fileInfo)
+
+		err = errors.WrapError(ctx.Err(), errors.CodeCancelled, "Download cancelled")
+	} else if stdErrors.Is(err, errors.ErrRangeIgnored) {
+		// Every source kept ignoring ranges: stream the file in one piece
+		d.logInfo("range_fallback", "Range requests keep being ignored, downloading as a single stream",
+			map[string]interface{}{"violations": stats.RangeViolations})
+
+		_ = file.Close()
+
+		result, err := d.performSingleDownload(ctx, url, destination, options, fileInfo)
+		if result != nil {
+			result.RangeViolations = stats.RangeViolations
+			result.RangeFallback = true
+		}
+
+		return result, err
+	}
+
+	if err != nil {
+		stats.Error = err
+
+		if options.Progress != nil {
+			options.Progress.Error(destination, err)
+		}
+
+		return stats, err
+	}
+
+	if tracker != nil {
+		// Without a digest here, checkChecksum hashes the file itself
+		if stats.Checksum, err = tracker.Sum(fileInfo.Size); err != nil {
+			d.logError("checksum_tracking", err, map[string]interface{}{"url": url})
+		}
+	}
+
+	stats.Success = true
+	if stats.Duration > 0 {
+		stats.AverageSpeed = int64(float64(stats.BytesDownloaded) / stats.Duration.Seconds())
+	}
+
+	if options.Progress != nil {
+		options.Progress.Finish(destination, stats)
+	}
+
+	return stats, nil
+}
+
+// fetchPiece requests the rest of piece from url and writes it into file
+// until the piece ends, which happens early when its rest is handed to
+// another source, reporting the writes to tracker when it is not nil. It
+// returns the IP address of the server it connected to.
+func (d *Downloader) fetchPiece(
+	ctx context.Context,
+	scheduler *sourceScheduler,
+	piece *sourcePiece,
+	url string,
+	file *os.File,
+	tracker *checksum.Tracker,
+	client *http.Client,
+	limiter ratelimit.Limiter,
+	options *types.DownloadOptions,
+) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	scheduler.mu.Lock()
+	byteRange := types.ByteRange{Start: piece.next, End: piece.end}
+	piece.cancel = cancel
+	scheduler.mu.Unlock()
+
+	if byteRange.Start > byteRange.End {
+		return "", nil
+	}
+
+	ctx, serverIP := network.TraceConnection(ctx)
+	ctx, quarantine := network.QuarantineConnection(ctx)
+
+	req, err := newRequest(ctx, url, options)
+	if err != nil {
+		return "", err
+	}
+
+	d.setRequestHeaders(req, options)
+	req.Header.Set("Range", byteRange.String())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return serverIP(), d.handleHTTPError(err, url)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// Never reuse the connection: the next request may reach a node that
+		// honors ranges
+		quarantine()
+
+		return serverIP(), errors.WrapErrorWithURL(errors.ErrRangeIgnored, errors.CodeServerError,
+			fmt.Sprintf("server sent the whole file for %s", byteRange), url)
+	default:
+		return serverIP(), httpStatusError(resp, url)
+	}
+
+	body, _, err := rangeBody(resp, resp.Body, byteRange, url)
+	if err != nil {
+		quarantine()
+		return serverIP(), err
+	}
+
+	bufp := d.buffers.Get(bufpool.SizeFor(options.ChunkSize))
+	defer d.buffers.Put(bufp)
+
+	buffer := *bufp
+
+	for {
+		n, readErr := body.Read(buffer[:ratelimit.MaxRead(limiter, len(buffer))])
+		if n > 0 {
+			if err := limiter.Wait(ctx, n); err != nil {
+				return serverIP(), errors.WrapError(err, errors.CodeCancelled, "Download cancelled during rate limiting")
+			}
+
+			offset, allowed := scheduler.reserve(piece, int64(n))
+			if allowed > 0 {
+				if _, err := file.WriteAt(buffer[:allowed], offset); err != nil {
+					writeErr := errors.NewStorageError("write file", err, file.Name())
+					scheduler.fail(writeErr)
+
+					return serverIP(), writeErr
+				}
+
+				if tracker != nil {
+					tracker.WrittenData(buffer[:allowed], offset)
+				}
+			}
+
+			// The piece is done, or its rest now belongs to another source
+			if allowed < int64(n) {
+				return serverIP(), nil
+			}
+		}
+
+		if readErr == io.EOF {
+			return serverIP(), nil
+		}
+
+		if readErr != nil {
+			return serverIP(), errors.WrapError(readErr, errors.CodeNetworkError, "Failed to read data")
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// newMirrorServer serves data with range support, waiting delay between
+// blocks of 16 KiB when it is set, and counts the range requests it gets.
+func newMirrorServer(t *testing.T, data []byte, delay time.Duration, ranged *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" && ranged != nil {
+			ranged.Add(1)
+		}
+
+		var start, end int64
+		if delay == 0 || r.Method != http.MethodGet {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			return
+		}
+
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+
+		for pos := start; pos <= end; pos += 16 * 1024 {
+			if _, err := w.Write(data[pos:min(pos+16*1024, end+1)]); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func mirrorTestData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+
+	return data
+}
+
+func TestDownloader_MultiSource(t *testing.T) {
+	data := mirrorTestData(4 * 1024 * 1024)
+
+	var primaryRanges, mirrorRanges atomic.Int32
+	primary := newMirrorServer(t, data, 0, &primaryRanges)
+	mirror := newMirrorServer(t, data, 0, &mirrorRanges)
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	stats, err := NewDownloader().Download(context.Background(), primary.URL+"/file.bin", dest,
+		&types.DownloadOptions{Mirrors: []string{mirror.URL + "/file.bin"}})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Fatal("downloaded file differs from the served data")
+	}
+
+	if primaryRanges.Load() == 0 || mirrorRanges.Load() == 0 {
+		t.Errorf("range requests: primary %d, mirror %d, want both used", primaryRanges.Load(), mirrorRanges.Load())
+	}
+
+	if len(stats.Connections) != 2 || stats.Connections[1].URL != mirror.URL+"/file.bin" {
+		t.Fatalf("Connections = %+v, want one entry per source", stats.Connections)
+	}
+	if total := stats.Connections[0].BytesDownloaded + stats.Connections[1].BytesDownloaded; total != int64(len(data)) ||
+		stats.BytesDownloaded != int64(len(data)) {
+		t.Errorf("sources downloaded %d bytes (total %d), want %d", total, stats.BytesDownloaded, len(data))
+	}
+
+	want := int(primaryRanges.Load() + mirrorRanges.Load())
+	if plan := stats.Plan; plan == nil || plan.Sources != 2 || plan.Pieces == 0 || plan.Requests != want {
+		t.Errorf("Plan = %+v, want 2 sources and the %d range requests made", stats.Plan, want)
+	}
+}
+
+func TestDownloader_MultiSourceRebalance(t *testing.T) {
+	data := mirrorTestData(4 * 1024 * 1024)
+
+	fast := newMirrorServer(t, data, 0, nil)
+	slow := newMirrorServer(t, data, 50*time.Millisecond, nil)
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	stats, err := NewDownloader().Download(context.Background(), fast.URL+"/file.bin", dest,
+		&types.DownloadOptions{Mirrors: []string{slow.URL + "/file.bin"}})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Fatal("downloaded file differs from the served data")
+	}
+
+	// The slow source gave up the rest of its first piece to the fast one
+	pieceSize := int64(len(data) / (2 * piecesPerSource))
+	if slowBytes := stats.Connections[1].BytesDownloaded; slowBytes >= pieceSize {
+		t.Errorf("slow source downloaded %d bytes, want less than its piece of %d", slowBytes, pieceSize)
+	}
+}
+
+func TestDownloader_MultiSourceUnusableMirrors(t *testing.T) {
+	data := mirrorTestData(2 * 1024 * 1024)
+
+	primary := newMirrorServer(t, data, 0, nil)
+
+	// A different file, and a mirror that refuses every range
+	var otherRanges, brokenRanges atomic.Int32
+	other := newMirrorServer(t, data[:len(data)-1], 0, &otherRanges)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+
+		if r.Method == http.MethodGet {
+			brokenRanges.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer broken.Close()
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	_, err := NewDownloader().Download(context.Background(), primary.URL+"/file.bin", dest,
+		&types.DownloadOptions{Mirrors: []string{other.URL + "/file.bin", broken.URL + "/file.bin"}})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Fatal("downloaded file differs from the served data")
+	}
+
+	if otherRanges.Load() != 0 {
+		t.Error("a mirror of a different size should not be used")
+	}
+	if n := brokenRanges.Load(); n > maxSourceFailures {
+		t.Errorf("failing mirror got %d requests, want at most %d", n, maxSourceFailures)
+	}
+}
+
+func TestDownloader_MultiSourceFastestMirror(t *testing.T) {
+	data := mirrorTestData(2 * 1024 * 1024)
+
+	primary := newMirrorServer(t, data, 0, nil)
+
+	// Listed first, but slow to answer its probe
+	var slowRanges, fastRanges atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			time.Sleep(200 * time.Millisecond)
+		} else if r.Header.Get("Range") != "" {
+			slowRanges.Add(1)
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer slow.Close()
+	fast := newMirrorServer(t, data, 0, &fastRanges)
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	stats, err := NewDownloader().Download(context.Background(), primary.URL+"/file.bin", dest, &types.DownloadOptions{
+		Mirrors:        []string{slow.URL + "/file.bin", fast.URL + "/file.bin"},
+		MirrorStrategy: types.MirrorFastest,
+		MaxMirrors:     1,
+	})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Fatal("downloaded file differs from the served data")
+	}
+
+	if len(stats.Connections) != 2 || stats.Connections[1].URL != fast.URL+"/file.bin" {
+		t.Fatalf("Connections = %+v, want the primary and the fast mirror", stats.Connections)
+	}
+	if slowRanges.Load() != 0 || fastRanges.Load() == 0 {
+		t.Errorf("range requests: slow %d, fast %d, want only the fast mirror used", slowRanges.Load(), fastRanges.Load())
+	}
+}
+
+func TestSelectMirrors(t *testing.T) {
+	probes := []mirrorProbe{
+		{url: "a", rtt: 30 * time.Millisecond, usable: true},
+		{url: "b", rtt: 10 * time.Millisecond, usable: true},
+		{url: "c", rtt: time.Millisecond},
+		{url: "d", rtt: 20 * time.Millisecond, usable: true},
+	}
+
+	tests := []struct {
+		strategy string
+		limit    int
+		want     []string
+	}{
+		{"", 0, []string{"a", "b", "d"}},
+		{types.MirrorOrdered, 2, []string{"a", "b"}},
+		{types.MirrorFastest, 0, []string{"b", "d", "a"}},
+		{types.MirrorFastest, 1, []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		if got := selectMirrors(probes, tt.strategy, tt.limit); !slices.Equal(got, tt.want) {
+			t.Errorf("selectMirrors(%q, %d) = %q, want %q", tt.strategy, tt.limit, got, tt.want)
+		}
+	}
+
+	got := selectMirrors(probes, types.MirrorRandom, 0)
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"a", "b", "d"}) {
+		t.Errorf("selectMirrors(random) = %q, want the usable mirrors", got)
+	}
+}
+
+func TestDownloader_MultiSourceRangeViolations(t *testing.T) {
+	data := mirrorTestData(2 * 1024 * 1024)
+
+	// ignoring answers range requests with the whole file, the first n times
+	// or always when n is negative
+	ignoring := func(n int32) *httptest.Server {
+		var ranged atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && r.Header.Get("Range") != "" {
+				if count := ranged.Add(1); n < 0 || count <= n {
+					w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+					_, _ = w.Write(data)
+					return
+				}
+			}
+
+			w.Header().Set("Accept-Ranges", "bytes")
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}))
+		t.Cleanup(server.Close)
+
+		return server
+	}
+
+	tests := []struct {
+		name           string
+		primary        *httptest.Server
+		mirror         *httptest.Server
+		wantViolations func(int) bool
+		wantFallback   bool
+	}{
+		{"intermittent", newMirrorServer(t, data, 0, nil), ignoring(1),
+			func(n int) bool { return n == 1 }, false},
+		{"always", ignoring(-1), ignoring(-1),
+			func(n int) bool { return n > maxRangeViolations }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "file.bin")
+
+			stats, err := NewDownloader().Download(context.Background(), tt.primary.URL+"/file.bin", dest,
+				&types.DownloadOptions{Mirrors: []string{tt.mirror.URL + "/file.bin"}})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			content, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, data) {
+				t.Fatal("downloaded file differs from the served data")
+			}
+
+			if !tt.wantViolations(stats.RangeViolations) || stats.RangeFallback != tt.wantFallback {
+				t.Errorf("RangeViolations = %d, RangeFallback = %v, want fallback %v",
+					stats.RangeViolations, stats.RangeFallback, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestSourceSchedulerSteal(t *testing.T) {
+	s := newSourceScheduler(4*minSourcePiece, []string{"fast", "slow"}, false)
+	s.start = time.Now().Add(-time.Second)
+	s.pending = []*sourcePiece{{next: 0, end: 4*minSourcePiece - 1}}
+
+	fast, slow := s.sources[0], s.sources[1]
+	slowPiece := s.next(context.Background(), slow)
+	fast.bytes = 3 * minSourcePiece
+
+	// The idle fast source takes the second half of the slow source's piece
+	stolen := s.steal(fast)
+	if stolen == nil || stolen.next != 2*minSourcePiece || stolen.end != 4*minSourcePiece-1 ||
+		slowPiece.end != 2*minSourcePiece-1 {
+		t.Fatalf("steal() = %+v, slow piece %+v, want the second half", stolen, slowPiece)
+	}
+
+	// A small rest is taken whole and its request stopped
+	var cancelled bool
+	slowPiece.next = slowPiece.end - 100
+	slowPiece.cancel = func() { cancelled = true }
+
+	if stolen := s.steal(fast); stolen == nil || stolen.end != 2*minSourcePiece-1 || !cancelled {
+		t.Errorf("steal() = %+v, cancelled %v, want the whole rest", stolen, cancelled)
+	}
+
+	// Sources at a similar speed keep their pieces
+	slowPiece.end = 2*minSourcePiece - 1
+	slow.bytes = 2 * minSourcePiece
+	if piece := s.steal(fast); piece != nil {
+		t.Errorf("steal() = %+v from a source at a similar speed", piece)
+	}
+}
+
+func TestSourceSchedulerStreamOrder(t *testing.T) {
+	s := newSourceScheduler(20*streamPieceSize, []string{"a", "b"}, true)
+	if len(s.pending) != 20 {
+		t.Fatalf("%d pieces, want 20 of streamPieceSize", len(s.pending))
+	}
+
+	// Sources take pieces in order until they are streamLookahead ahead of
+	// the first missing byte
+	var taken []*sourcePiece
+	for i := range streamLookahead {
+		piece := s.next(context.Background(), s.sources[i%2])
+		if piece.next != int64(i)*streamPieceSize {
+			t.Fatalf("piece %d starts at %d", i, piece.next)
+		}
+		taken = append(taken, piece)
+	}
+
+	if s.inWindow(s.pending[0]) {
+		t.Fatal("a piece past the lookahead may be started")
+	}
+
+	// Completing the first piece moves the window on
+	taken[0].next = taken[0].end + 1
+	if !s.inWindow(s.pending[0]) {
+		t.Error("the next piece stays out of the window after the first completed")
+	}
+
+	if unordered := newSourceScheduler(20*streamPieceSize, []string{"a", "b"}, false); unordered.window != 0 {
+		t.Errorf("window = %d without stream order", unordered.window)
+	}
+}
+
+func TestSourceSchedulerCoalesce(t *testing.T) {
+	s := newSourceScheduler(20*streamPieceSize, []string{"a", "b"}, true)
+	s.start = time.Now().Add(-time.Second)
+
+	a, b := s.sources[0], s.sources[1]
+
+	// Without a speed yet, a source takes one piece per request
+	if piece := s.next(context.Background(), a); piece.end != streamPieceSize-1 {
+		t.Fatalf("first piece ends at %d, want one piece", piece.end)
+	}
+
+	// A source fetching 3.5 pieces a second takes 3 at once
+	a.bytes = 7 * streamPieceSize / 2
+	if piece := s.next(context.Background(), a); piece.next != streamPieceSize || piece.end != 4*streamPieceSize-1 {
+		t.Fatalf("piece = %d-%d, want 3 pieces", piece.next, piece.end)
+	}
+
+	// A much faster one is held to its share of the lookahead
+	b.bytes = 100 * streamPieceSize
+	if piece := s.next(context.Background(), b); piece.end-piece.next+1 != streamLookahead/2*streamPieceSize {
+		t.Errorf("piece = %d-%d, want half the lookahead", piece.next, piece.end)
+	}
+
+	if a.requests != 2 || b.requests != 1 {
+		t.Errorf("requests = %d, %d, want 2, 1", a.requests, b.requests)
+	}
+
+	// Pieces that are not adjacent stay apart
+	s = newSourceScheduler(4*minSourcePiece, []string{"a"}, false)
+	s.start = time.Now().Add(-time.Second)
+	s.sources[0].bytes = 100 * minSourcePiece
+	s.pending = []*sourcePiece{
+		{next: 0, end: minSourcePiece - 1},
+		{next: minSourcePiece, end: 2*minSourcePiece - 1},
+		{next: 3 * minSourcePiece, end: 4*minSourcePiece - 1},
+	}
+
+	if piece := s.next(context.Background(), s.sources[0]); piece.end != 2*minSourcePiece-1 || len(s.pending) != 1 {
+		t.Errorf("piece = %d-%d with %d pending, want the first two", piece.next, piece.end, len(s.pending))
+	}
+}
+
+func TestDownloader_MultiSourceStreamOrder(t *testing.T) {
+	data := mirrorTestData(4 * streamPieceSize)
+
+	var primaryRanges, mirrorRanges atomic.Int32
+	primary := newMirrorServer(t, data, 0, &primaryRanges)
+	mirror := newMirrorServer(t, data, 0, &mirrorRanges)
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	if _, err := NewDownloader().Download(context.Background(), primary.URL+"/file.bin", dest,
+		&types.DownloadOptions{Mirrors: []string{mirror.URL + "/file.bin"}, StreamOrder: true}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Fatal("downloaded file differs from the served data")
+	}
+
+	// At most one request per 1 MiB piece, fewer once a fast source takes
+	// adjacent pieces together, besides the probes for range support
+	if got := primaryRanges.Load() + mirrorRanges.Load(); got > 6 {
+		t.Errorf("%d range requests, want at most one per piece", got)
+	}
+}
@@ -34,6 +34,13 @@ func getOptimalConcurrency(contentLength int64) int {
 	return 16
 }
 
+// OptimalConcurrency returns the number of connections gdl uses by default
+// for a file of contentLength bytes, from 1 for small files to 16 for files
+// over 1GB.
+func OptimalConcurrency(contentLength int64) int {
+	return getOptimalConcurrency(contentLength)
+}
+
 // shouldUseLightweightMode determines if lightweight mode should be used
 // for very small files to minimize overhead
 func shouldUseLightweightMode(contentLength int64) bool {
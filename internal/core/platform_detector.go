@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"runtime"
 	"strings"
+
+	"github.com/forest6511/gdl/internal/network"
 )
 
 // PlatformInfo contains information about the current platform
@@ -133,6 +135,19 @@ func ApplyPlatformOptimizations(transport *http.Transport) {
 	PlatformSpecificInit()
 }
 
+// platformTransportConfig returns the shared transport settings tuned for the platform
+func platformTransportConfig(info *PlatformInfo) network.TransportConfig {
+	opts := info.Optimizations
+
+	config := network.DefaultTransportConfig()
+	config.MaxIdleConns = opts.MaxConnections
+	config.MaxIdleConnsPerHost = opts.MaxConnections / 4
+	config.MaxConnsPerHost = opts.MaxConnections / 4
+	config.DisableKeepAlives = !opts.ConnectionReuse
+
+	return config
+}
+
 // GetPlatformString returns a string describing the platform
 func GetPlatformString() string {
 	info := DetectPlatform()
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/forest6511/gdl/internal/storage"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// reserveQuota makes room for a download of size bytes to destination under
+// options.Quota, evicting files as its policy allows, and returns a function
+// releasing the reservation once the file is on disk. A size of 0 (unknown)
+// only checks that the directory is not already over its quota.
+func (d *Downloader) reserveQuota(destination string, size int64, options *types.DownloadOptions) (func(), error) {
+	if options.Quota == nil || options.Quota.MaxSize <= 0 {
+		return func() {}, nil
+	}
+
+	dir := options.Quota.Dir
+	if dir == "" {
+		dir = filepath.Dir(destination)
+	}
+
+	// Data already written for this download, as when resuming, is counted
+	// by the quota's own scan
+	if info, err := os.Stat(destination); err == nil {
+		size -= info.Size()
+	}
+
+	return d.quota(dir, options.Quota).Reserve(size, destination)
+}
+
+// quota returns the quota for dir with the given settings, shared by all
+// downloads of this downloader so that concurrent downloads see each other's
+// reservations.
+func (d *Downloader) quota(dir string, options *types.QuotaOptions) *storage.Quota {
+	quota := storage.NewQuota(dir, options.MaxSize, options.Policy)
+	key := fmt.Sprintf("%s|%d|%s", quota.Dir(), options.MaxSize, options.Policy)
+
+	d.quotasMu.Lock()
+	defer d.quotasMu.Unlock()
+
+	if existing, ok := d.quotas[key]; ok {
+		return existing
+	}
+
+	if d.quotas == nil {
+		d.quotas = make(map[string]*storage.Quota)
+	}
+
+	d.quotas[key] = quota
+
+	return quota
+}
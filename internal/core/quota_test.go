@@ -0,0 +1,113 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_Quota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(bytes.Repeat([]byte{'x'}, 4096))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		policy    string
+		wantErr   bool
+		wantOldOK bool
+	}{
+		{types.QuotaPolicyRefuse, true, true},
+		{types.QuotaPolicyOldest, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			dir := t.TempDir()
+			old := filepath.Join(dir, "old.bin")
+
+			if err := os.WriteFile(old, make([]byte, 8192), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			downloader := NewDownloader()
+			downloader.spaceChecker = nil
+
+			dest := filepath.Join(dir, "new.bin")
+			options := &types.DownloadOptions{
+				Quota: &types.QuotaOptions{MaxSize: 10000, Policy: tt.policy},
+			}
+
+			_, err := downloader.Download(context.Background(), server.URL, dest, options)
+			if tt.wantErr {
+				if !stdErrors.Is(err, errors.ErrQuotaExceeded) || errors.GetErrorCode(err) != errors.CodeInsufficientSpace {
+					t.Fatalf("Download() error = %v, want ErrQuotaExceeded", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if _, statErr := os.Stat(old); (statErr == nil) != tt.wantOldOK {
+				t.Errorf("old file kept = %v, want %v", statErr == nil, tt.wantOldOK)
+			}
+		})
+	}
+}
+
+func TestDownloader_QuotaSharedReservations(t *testing.T) {
+	dir := t.TempDir()
+	downloader := NewDownloader()
+	options := &types.DownloadOptions{Quota: &types.QuotaOptions{Dir: dir, MaxSize: 1000}}
+
+	release, err := downloader.reserveQuota(filepath.Join(dir, "a.bin"), 800, options)
+	if err != nil {
+		t.Fatalf("reserveQuota() error = %v", err)
+	}
+
+	// A second download into the same directory sees the first reservation
+	if _, err := downloader.reserveQuota(filepath.Join(dir, "b.bin"), 800, options); !stdErrors.Is(err, errors.ErrQuotaExceeded) {
+		t.Errorf("reserveQuota() error = %v, want ErrQuotaExceeded", err)
+	}
+
+	release()
+
+	if _, err := downloader.reserveQuota(filepath.Join(dir, "b.bin"), 800, options); err != nil {
+		t.Errorf("reserveQuota() after release error = %v", err)
+	}
+}
+
+func TestDownloader_QuotaCountsPartialData(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "file.bin")
+
+	// Half of the file is already on disk, as when resuming
+	if err := os.WriteFile(dest, make([]byte, 500), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := &types.DownloadOptions{Quota: &types.QuotaOptions{MaxSize: 1000}}
+
+	if _, err := NewDownloader().reserveQuota(dest, 1000, options); err != nil {
+		t.Errorf("reserveQuota() error = %v, want the partial data counted once", err)
+	}
+}
+
+func TestDownloader_NoQuota(t *testing.T) {
+	release, err := NewDownloader().reserveQuota("out.bin", 1<<40, &types.DownloadOptions{})
+	if err != nil {
+		t.Fatalf("reserveQuota() error = %v", err)
+	}
+
+	release()
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// readerFrom returns dst when the body is better handed to its ReadFrom
+// than copied through a pooled buffer. That holds for a bytes.Buffer, which
+// then reads straight into its own storage, but not for other ReaderFroms,
+// which copy through smaller buffers of their own: io.Discard through 8 KiB
+// and an os.File through 32 KiB, since only file and socket sources let it
+// use copy_file_range or splice. Rate limiting and progress updates need to
+// see every read, so they keep the copy loop.
+func readerFrom(dst io.Writer, options *types.DownloadOptions) io.ReaderFrom {
+	if options.MaxRate > 0 || options.Progress != nil {
+		return nil
+	}
+
+	if buf, ok := dst.(*bytes.Buffer); ok {
+		return buf
+	}
+
+	return nil
+}
+
+// copyWithReadFrom copies src to dst with dst's ReadFrom and classifies the
+// failure as the copy loop of downloadContent does: a cancelled context,
+// a failed read of the body or a failed write.
+func copyWithReadFrom(ctx context.Context, dst io.ReaderFrom, src io.Reader) (int64, error) {
+	body := &contextReader{ctx: ctx, r: src}
+
+	n, err := dst.ReadFrom(body)
+	if err == nil {
+		return n, nil
+	}
+
+	if body.err != nil && err == body.err {
+		if ctx.Err() != nil {
+			return n, errors.WrapError(ctx.Err(), errors.CodeCancelled, "Download cancelled")
+		}
+
+		return n, errors.WrapError(err, errors.CodeNetworkError, "Failed to read data")
+	}
+
+	return n, wrapWriteError(err)
+}
+
+// wrapWriteError wraps an error writing the body to its destination.
+func wrapWriteError(err error) error {
+	// The space guard's error already says why the write stopped
+	if errors.GetErrorCode(err) == errors.CodeInsufficientSpace {
+		return err
+	}
+
+	return errors.WrapError(err, errors.CodePermissionDenied, "Failed to write data")
+}
+
+// contextReader stops reading once ctx is done and remembers the error of
+// the last failed read, so that it can be told from a write error.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+	err error
+}
+
+// Read reads from the underlying reader unless ctx is done.
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		c.err = err
+		return 0, err
+	}
+
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+
+	return n, err
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// failingReaderFrom is a ReaderFrom whose writes fail.
+type failingReaderFrom struct{}
+
+func (failingReaderFrom) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func (failingReaderFrom) ReadFrom(r io.Reader) (int64, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestReaderFrom(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	tests := []struct {
+		name    string
+		dst     io.Writer
+		options types.DownloadOptions
+		want    bool
+	}{
+		{"buffer", &bytes.Buffer{}, types.DownloadOptions{}, true},
+		{"discard", io.Discard, types.DownloadOptions{}, false},
+		{"file", file, types.DownloadOptions{}, false},
+		{"plain writer", struct{ io.Writer }{&bytes.Buffer{}}, types.DownloadOptions{}, false},
+		{"rate limited", &bytes.Buffer{}, types.DownloadOptions{MaxRate: 1024}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readerFrom(tt.dst, &tt.options) != nil; got != tt.want {
+				t.Errorf("readerFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyWithReadFrom(t *testing.T) {
+	content := strings.Repeat("gdl", 100000)
+
+	var buf bytes.Buffer
+	n, err := copyWithReadFrom(context.Background(), &buf, strings.NewReader(content))
+	if err != nil || n != int64(len(content)) || buf.String() != content {
+		t.Fatalf("copyWithReadFrom() = %d, %v", n, err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		dst  io.ReaderFrom
+		src  io.Reader
+		code gdlerrors.ErrorCode
+	}{
+		{"read error", context.Background(), &bytes.Buffer{}, io.MultiReader(strings.NewReader("abc"), &errorReader{}), gdlerrors.CodeNetworkError},
+		{"write error", context.Background(), failingReaderFrom{}, strings.NewReader(content), gdlerrors.CodePermissionDenied},
+		{"cancelled", cancelled, &bytes.Buffer{}, strings.NewReader(content), gdlerrors.CodeCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := copyWithReadFrom(tt.ctx, tt.dst, tt.src)
+			if code := gdlerrors.GetErrorCode(err); code != tt.code {
+				t.Errorf("error code = %v (%v), want %v", code, err, tt.code)
+			}
+		})
+	}
+}
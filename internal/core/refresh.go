@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+	stdErrors "errors"
+	"net/http"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// urlRejected reports whether err is a rejection of the URL itself, as servers
+// answer requests for presigned URLs that have expired: S3 and Azure respond
+// with 403, GCS with 400 and some CDNs with 401.
+func urlRejected(err error) bool {
+	var downloadErr *errors.DownloadError
+	if !stdErrors.As(err, &downloadErr) {
+		return false
+	}
+
+	switch downloadErr.HTTPStatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	default:
+		return false
+	}
+}
+
+// refreshURL asks the URL refresher in options for a replacement of url.
+func (d *Downloader) refreshURL(ctx context.Context, url string, options *types.DownloadOptions) (string, error) {
+	newURL, err := options.URLRefresher(ctx, url)
+	if err == nil && newURL == "" {
+		err = stdErrors.New("no URL returned")
+	}
+
+	if err != nil {
+		return "", errors.WrapErrorWithURL(err, errors.CodeAuthenticationFailed,
+			"Failed to refresh the rejected URL", url)
+	}
+
+	// Presigned URLs carry credentials, so only the host is logged
+	d.logInfo("url_refreshed", "Server rejected the URL, continuing with a refreshed one", map[string]interface{}{
+		"host": hostOf(newURL),
+	})
+
+	return newURL, nil
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/retry"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_URLRefresher(t *testing.T) {
+	content := []byte("presigned object contents")
+
+	// Only URLs signed with "fresh" are accepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("signature") != "fresh" {
+			http.Error(w, "Request has expired", http.StatusForbidden)
+			return
+		}
+
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	errSigning := stdErrors.New("signing service unavailable")
+
+	tests := []struct {
+		name       string
+		refreshed  string
+		refreshErr error
+		wantErr    bool
+		wantIs     error
+	}{
+		{"refreshed", server.URL + "/object?signature=fresh", nil, false, nil},
+		{"refreshed URL rejected", server.URL + "/object?signature=stale", nil, true, nil},
+		{"refresher fails", "", errSigning, true, errSigning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+
+			options := &types.DownloadOptions{
+				OverwriteExisting: true,
+				URLRefresher: func(ctx context.Context, oldURL string) (string, error) {
+					calls.Add(1)
+					return tt.refreshed, tt.refreshErr
+				},
+			}
+
+			// Refreshing does not need a retry
+			downloader := NewDownloader().WithRetryStrategy(retry.NewRetryManager().WithMaxRetries(0))
+			downloader.spaceChecker = nil
+
+			dest := filepath.Join(t.TempDir(), "object")
+
+			_, err := downloader.Download(context.Background(), server.URL+"/object?signature=expired", dest, options)
+			if calls.Load() != 1 {
+				t.Errorf("URLRefresher called %d times, want 1", calls.Load())
+			}
+
+			if tt.wantErr {
+				if errors.GetErrorCode(err) != errors.CodeAuthenticationFailed {
+					t.Fatalf("Download() error = %v, want an authentication error", err)
+				}
+
+				if tt.wantIs != nil && !stdErrors.Is(err, tt.wantIs) {
+					t.Errorf("Download() error = %v, want it to wrap %v", err, tt.wantIs)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if got, _ := os.ReadFile(dest); string(got) != string(content) {
+				t.Errorf("downloaded content = %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func TestURLRejected(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.FromHTTPStatus(http.StatusForbidden, "u"), true},
+		{errors.FromHTTPStatus(http.StatusBadRequest, "u"), true},
+		{errors.FromHTTPStatus(http.StatusNotFound, "u"), false},
+		{errors.FromHTTPStatus(http.StatusServiceUnavailable, "u"), false},
+		{stdErrors.New("connection reset"), false},
+	}
+
+	for _, tt := range tests {
+		if got := urlRejected(tt.err); got != tt.want {
+			t.Errorf("urlRejected(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDownloader_URLRefresherResume(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	partial := 10
+
+	var resumedFrom atomic.Value
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("signature") != "fresh" {
+			http.Error(w, "Request has expired", http.StatusForbidden)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			resumedFrom.Store(r.Header.Get("Range"))
+		}
+
+		http.ServeContent(w, r, "object", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "object")
+	if err := os.WriteFile(dest, content[:partial], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := &types.DownloadOptions{
+		Resume: true,
+		URLRefresher: func(ctx context.Context, oldURL string) (string, error) {
+			return server.URL + "/object?signature=fresh", nil
+		},
+	}
+
+	downloader := NewDownloader()
+	downloader.spaceChecker = nil
+
+	if _, err := downloader.Download(context.Background(), server.URL+"/object?signature=expired", dest, options); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Errorf("downloaded content = %q, want %q", got, content)
+	}
+
+	if got := resumedFrom.Load(); got != fmt.Sprintf("bytes=%d-", partial) {
+		t.Errorf("refreshed request Range = %v, want the download resumed at %d", got, partial)
+	}
+}
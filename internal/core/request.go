@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// customRequest reports whether options ask for something other than a plain
+// GET request.
+func customRequest(options *types.DownloadOptions) bool {
+	return (options.Method != "" && !strings.EqualFold(options.Method, http.MethodGet)) ||
+		options.Body != nil || options.BodyFile != ""
+}
+
+// newRequest creates the request for downloading url, with the method and
+// body in options. The body can be read again through GetBody, so that
+// redirects keep it.
+func newRequest(ctx context.Context, url string, options *types.DownloadOptions) (*http.Request, error) {
+	method := http.MethodGet
+	if options.Method != "" {
+		method = strings.ToUpper(options.Method)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, errors.WrapErrorWithURL(err, errors.CodeInvalidURL,
+			"Failed to create HTTP request", url)
+	}
+
+	switch {
+	case options.BodyFile != "":
+		path := options.BodyFile
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.NewStorageError("open request body", err, path)
+		}
+
+		req.GetBody = func() (io.ReadCloser, error) {
+			// #nosec G304 -- the request body file is chosen by the caller
+			return os.Open(path)
+		}
+		req.ContentLength = info.Size()
+		req.Header.Set("Content-Type", bodyFileType(path))
+	case options.Body != nil:
+		body := options.Body
+
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.ContentLength = int64(len(body))
+		req.Header.Set("Content-Type", bodyType(body))
+	default:
+		return req, nil
+	}
+
+	if req.Body, err = req.GetBody(); err != nil {
+		return nil, errors.NewStorageError("open request body", err, options.BodyFile)
+	}
+
+	return req, nil
+}
+
+// bodyType returns the default Content-Type of a request body: JSON when it
+// parses as JSON, otherwise form data, as curl --data sends.
+func bodyType(body []byte) string {
+	if json.Valid(body) {
+		return "application/json"
+	}
+
+	return "application/x-www-form-urlencoded"
+}
+
+// bodyFileType returns the default Content-Type of a request body file, from
+// its extension.
+func bodyFileType(path string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
+
+// performRequestDownload downloads the response to a custom request to
+// destination. With Resume, an existing partial file is continued with a
+// Range request, which the server may honour or answer with the full body.
+func (d *Downloader) performRequestDownload(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+) (*types.DownloadStats, error) {
+	releaseQuota, err := d.reserveQuota(destination, 0, options)
+	if err != nil {
+		return nil, d.wrapDownloadError(err, url, destination, 0, 0)
+	}
+	defer releaseQuota()
+
+	// Without Resume, a failed attempt leaves nothing behind for the next
+	if !options.Resume {
+		stats, err := d.performSimpleDownload(ctx, url, destination, options)
+		if err != nil {
+			_ = os.Remove(destination)
+		}
+
+		return stats, err
+	}
+
+	info, err := os.Stat(destination)
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return d.performSimpleDownload(ctx, url, destination, options)
+	}
+
+	// #nosec G304 -- destination validated by ValidateDestination() in public API functions
+	file, err := os.OpenFile(destination, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.WrapErrorWithURL(err, errors.CodePermissionDenied,
+			"Failed to open destination file", url)
+	}
+	defer func() { _ = file.Close() }()
+
+	stats, err := d.downloadWithResume(ctx, url, file, options, info.Size())
+	if stats != nil {
+		stats.Filename = destination
+	}
+
+	return stats, err
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/retry"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// echoServer answers POST requests with the request body and its
+// Content-Type, failing the first failures requests with 503.
+func echoServer(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, r.Header.Get("Content-Type")+" "+string(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestDownload_PostBody(t *testing.T) {
+	server, requests := echoServer(t, 1)
+
+	dest := filepath.Join(t.TempDir(), "report.txt")
+	options := &types.DownloadOptions{Method: "post", Body: []byte(`{"q":"all"}`)}
+
+	downloader := NewDownloader().WithRetryStrategy(
+		retry.NewRetryManager().WithMaxRetries(2).WithBaseDelay(time.Millisecond))
+
+	if _, err := downloader.Download(context.Background(), server.URL, dest, options); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(dest) // #nosec G304 -- test file
+	if want := `application/json {"q":"all"}`; string(got) != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+
+	// The body is sent again after the 503, and no HEAD request is made
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestDownloadToWriter_BodyFile(t *testing.T) {
+	server, _ := echoServer(t, 0)
+
+	bodyFile := filepath.Join(t.TempDir(), "query.json")
+	if err := os.WriteFile(bodyFile, []byte(`[1,2]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+
+	options := &types.DownloadOptions{
+		Method:   http.MethodPost,
+		BodyFile: bodyFile,
+		Headers:  map[string]string{"Content-Type": "text/plain"},
+	}
+	if _, err := NewDownloader().DownloadToWriter(context.Background(), server.URL, &out, options); err != nil {
+		t.Fatalf("DownloadToWriter() error = %v", err)
+	}
+
+	// An explicit Content-Type header wins over the one from the extension
+	if want := "text/plain [1,2]"; out.String() != want {
+		t.Errorf("content = %q, want %q", out.String(), want)
+	}
+
+	options.BodyFile = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := NewDownloader().DownloadToWriter(context.Background(), server.URL, &out, options); err == nil {
+		t.Error("DownloadToWriter() should fail for a missing body file")
+	}
+}
+
+func TestDownload_PostResume(t *testing.T) {
+	content := "0123456789abcdefghij"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var start int
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rangeHeader, "bytes="), "-"))
+			w.Header().Set("Content-Range", "bytes "+strconv.Itoa(start)+"-19/20")
+			w.WriteHeader(http.StatusPartialContent)
+		}
+
+		_, _ = io.WriteString(w, content[start:])
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "export.bin")
+	if err := os.WriteFile(dest, []byte(content[:8]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := &types.DownloadOptions{Method: http.MethodPost, Body: []byte("q=all"), Resume: true}
+
+	stats, err := NewDownloader().Download(context.Background(), server.URL, dest, options)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(dest) // #nosec G304 -- test file
+	if string(got) != content {
+		t.Errorf("content = %q, want %q", got, content)
+	}
+
+	if !stats.Resumed {
+		t.Error("Download() did not resume the partial file")
+	}
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/forest6511/gdl/internal/resume"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// ValidateResumeValidation checks a DownloadOptions.ResumeValidation value.
+func ValidateResumeValidation(policy string) error {
+	switch policy {
+	case "", types.ResumeStrict, types.ResumeRestart, types.ResumeIgnore:
+		return nil
+	default:
+		return errors.NewValidationError("resume_validation",
+			fmt.Sprintf("unknown resume validation %q: expected %s, %s or %s", policy,
+				types.ResumeStrict, types.ResumeRestart, types.ResumeIgnore))
+	}
+}
+
+// loadPartialVersion returns the validators recorded when the partial
+// download of url to destination was started, or nil when there are none.
+func (d *Downloader) loadPartialVersion(url, destination string) *resume.Metadata {
+	if d.resumeManager == nil {
+		return nil
+	}
+
+	path, err := filepath.Abs(destination)
+	if err != nil {
+		return nil
+	}
+
+	meta, err := d.resumeManager.LoadPartial(path)
+	if err != nil || meta == nil || meta.URL != url {
+		return nil
+	}
+
+	return meta
+}
+
+// recordPartialVersion records the validators of the file fileInfo describes
+// as those the partial download of url to destination is made of, so that
+// resuming it can tell whether the file changed on the server.
+func (d *Downloader) recordPartialVersion(url, destination string, fileInfo *types.FileInfo) {
+	if d.resumeManager == nil {
+		return
+	}
+
+	path, err := filepath.Abs(destination)
+	if err != nil {
+		return
+	}
+
+	_ = d.resumeManager.SavePartial(&resume.Metadata{
+		URL:          url,
+		FilePath:     path,
+		ETag:         d.getETagFromHeaders(fileInfo.Headers),
+		LastModified: fileInfo.LastModified,
+		Size:         fileInfo.Size,
+	})
+}
+
+// forgetPartialVersion removes the validators and the resume record kept for
+// the download to destination once it is complete.
+func (d *Downloader) forgetPartialVersion(destination string) {
+	if d.resumeManager == nil {
+		return
+	}
+
+	if path, err := filepath.Abs(destination); err == nil {
+		_ = d.resumeManager.DeletePartial(path)
+		_ = d.resumeManager.Delete(path)
+	}
+}
+
+// remoteChange describes how the file fileInfo describes differs from the one
+// the partial download recorded in meta was started from, or returns "" when
+// nothing shows that it changed. The ETag decides when both have one;
+// otherwise the size and the Last-Modified time do.
+func (d *Downloader) remoteChange(meta *resume.Metadata, fileInfo *types.FileInfo) string {
+	etag := d.getETagFromHeaders(fileInfo.Headers)
+	if meta.ETag != "" && etag != "" {
+		if meta.ETag != etag {
+			return fmt.Sprintf("ETag %s, was %s", etag, meta.ETag)
+		}
+
+		return ""
+	}
+
+	if meta.Size > 0 && fileInfo.Size > 0 && meta.Size != fileInfo.Size {
+		return fmt.Sprintf("size %d, was %d", fileInfo.Size, meta.Size)
+	}
+
+	if !meta.LastModified.IsZero() && !fileInfo.LastModified.IsZero() &&
+		!meta.LastModified.Equal(fileInfo.LastModified) {
+		return fmt.Sprintf("Last-Modified %s, was %s",
+			fileInfo.LastModified.UTC().Format(http.TimeFormat), meta.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	return ""
+}
+
+// checkPartialVersion applies options.ResumeValidation to the partial
+// download of url recorded in meta, which may be nil. It reports whether the
+// partial file may be continued; an error means it must be kept as it is.
+func (d *Downloader) checkPartialVersion(
+	url string,
+	options *types.DownloadOptions,
+	meta *resume.Metadata,
+	fileInfo *types.FileInfo,
+) (bool, error) {
+	if meta == nil {
+		return true, nil
+	}
+
+	change := d.remoteChange(meta, fileInfo)
+	if change == "" {
+		return true, nil
+	}
+
+	fields := map[string]interface{}{
+		"url":    url,
+		"change": change,
+	}
+
+	switch options.ResumeValidation {
+	case types.ResumeIgnore:
+		d.logInfo("remote_changed", "File changed on the server, resuming anyway", fields)
+
+		return true, nil
+	case types.ResumeStrict:
+		return false, errors.WrapErrorWithURL(errors.ErrRemoteChanged, errors.CodeCorruptedData,
+			"File changed on the server since the partial download started: "+change, url)
+	default:
+		d.logInfo("remote_changed", "File changed on the server, downloading it again", fields)
+
+		return false, nil
+	}
+}
+
+// ifRangeValidator returns the If-Range value that makes the server send the
+// rest of the file only when it is still the one meta recorded: its strong
+// ETag, or else its Last-Modified time. It is empty without either.
+func ifRangeValidator(meta *resume.Metadata) string {
+	switch {
+	case meta.ETag != "" && !strings.HasPrefix(meta.ETag, "W/"):
+		return meta.ETag
+	case !meta.LastModified.IsZero():
+		return meta.LastModified.UTC().Format(http.TimeFormat)
+	default:
+		return ""
+	}
+}
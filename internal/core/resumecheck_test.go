@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/resume"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_ResumeValidation(t *testing.T) {
+	v1 := mirrorTestData(256 * 1024)
+	v2 := slices.Clone(v1)
+	slices.Reverse(v2)
+
+	const written = 100 * 1024
+
+	var (
+		mu   sync.Mutex
+		data []byte
+		etag string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		content, tag := data, etag
+		mu.Unlock()
+
+		w.Header().Set("ETag", tag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	url := server.URL + "/file.bin"
+
+	tests := []struct {
+		name    string
+		policy  string
+		changed bool
+		want    []byte
+		wantErr bool
+	}{
+		{"unchanged", types.ResumeStrict, false, v1, false},
+		{"restart", "", true, v2, false},
+		{"strict", types.ResumeStrict, true, v1[:written], true},
+		{"ignore", types.ResumeIgnore, true, append(slices.Clone(v1[:written]), v2[written:]...), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader()
+			d.resumeManager = resume.NewManager(t.TempDir())
+
+			// A partial download of the first version was interrupted
+			dest := filepath.Join(t.TempDir(), "file.bin")
+			if err := os.WriteFile(dest, v1[:written], 0o600); err != nil {
+				t.Fatal(err)
+			}
+			d.recordPartialVersion(url, dest, &types.FileInfo{
+				Size:    int64(len(v1)),
+				Headers: http.Header{"Etag": {`"v1"`}},
+			})
+
+			mu.Lock()
+			data, etag = v1, `"v1"`
+			if tt.changed {
+				data, etag = v2, `"v2"`
+			}
+			mu.Unlock()
+
+			_, err := d.Download(context.Background(), url, dest,
+				&types.DownloadOptions{Resume: true, ResumeValidation: tt.policy})
+			if tt.wantErr {
+				if errors.GetErrorCode(err) != errors.CodeCorruptedData || !stdErrors.Is(err, errors.ErrRemoteChanged) {
+					t.Fatalf("Download() error = %v, want a remote change", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			content, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, tt.want) {
+				t.Fatalf("file holds %d bytes, not the expected %d", len(content), len(tt.want))
+			}
+
+			// The validators are kept until the download completes
+			if kept := d.loadPartialVersion(url, dest) != nil; kept != tt.wantErr {
+				t.Errorf("validators kept = %v, want %v", kept, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloader_ResumeValidationRecorded(t *testing.T) {
+	data := mirrorTestData(256 * 1024)
+
+	// The server drops the first request half way through the file
+	var mu sync.Mutex
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+
+		mu.Lock()
+		if r.Method == http.MethodGet {
+			requests++
+		}
+		first := r.Method == http.MethodGet && requests == 1
+		mu.Unlock()
+
+		if !first {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			return
+		}
+
+		w.Header().Set("Content-Length", "262144")
+		_, _ = w.Write(data[:len(data)/2])
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	url := server.URL + "/file.bin"
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	d := NewDownloader()
+	d.resumeManager = resume.NewManager(t.TempDir())
+
+	options := &types.DownloadOptions{
+		Resume:          true,
+		RetryClassifier: func(error, int) types.RetryDecision { return types.RetryDecision{} },
+	}
+	if _, err := d.Download(context.Background(), url, dest, options); err == nil {
+		t.Fatal("Download() succeeded through a dropped connection")
+	}
+
+	if meta := d.loadPartialVersion(url, dest); meta == nil || meta.ETag != `"v1"` || meta.Size != int64(len(data)) {
+		t.Fatalf("recorded validators = %+v, want those of the file", meta)
+	}
+
+	if _, err := d.Download(context.Background(), url, dest, options); err != nil {
+		t.Fatalf("resumed Download() error = %v", err)
+	}
+	if content, _ := os.ReadFile(dest); !bytes.Equal(content, data) {
+		t.Error("resumed file differs from the served data")
+	}
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/forest6511/gdl/internal/scan"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// defaultScanTimeout bounds each scanner when ScanOptions.Timeout is unset.
+const defaultScanTimeout = 5 * time.Minute
+
+// scanFile runs the scanners in options on the file at path, the completed
+// download of url to destination. A flagged file is deleted or quarantined;
+// a file that cannot be scanned is kept. Both fail with CodeScanFailed.
+func (d *Downloader) scanFile(
+	ctx context.Context,
+	url, path, destination string,
+	options *types.DownloadOptions,
+) error {
+	if options.Scan == nil {
+		return nil
+	}
+
+	scanners, err := fileScanners(options.Scan)
+	if err != nil {
+		return err
+	}
+
+	timeout := options.Scan.Timeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+
+	for _, scanner := range scanners {
+		scanCtx, cancel := context.WithTimeout(ctx, timeout)
+		result, err := scanner.ScanFile(scanCtx, path)
+		cancel()
+
+		if err != nil {
+			scanErr := errors.WrapErrorWithURL(err, errors.CodeScanFailed, "Failed to scan downloaded file", url)
+			scanErr.Retryable = false
+
+			return scanErr
+		}
+
+		if !result.Clean {
+			return d.rejectFlaggedFile(url, path, destination, result.Threat, options.Scan)
+		}
+	}
+
+	d.logInfo("scan_clean", "Downloaded file passed the malware scan", map[string]interface{}{
+		"url":      url,
+		"scanners": len(scanners),
+	})
+
+	return nil
+}
+
+// fileScanners returns the scanners configured in opts, in order.
+func fileScanners(opts *types.ScanOptions) ([]types.FileScanner, error) {
+	var scanners []types.FileScanner
+
+	if opts.Clamd != "" {
+		scanners = append(scanners, scan.NewClamd(opts.Clamd))
+	}
+
+	if opts.Command != "" {
+		command, err := scan.NewCommand(opts.Command)
+		if err != nil {
+			return nil, errors.NewValidationError("scan_command", err.Error())
+		}
+		scanners = append(scanners, command)
+	}
+
+	if opts.Scanner != nil {
+		scanners = append(scanners, opts.Scanner)
+	}
+
+	return scanners, nil
+}
+
+// rejectFlaggedFile deletes or quarantines a file flagged by a scanner and
+// returns the error the download fails with.
+func (d *Downloader) rejectFlaggedFile(url, path, destination, threat string, opts *types.ScanOptions) error {
+	scanErr := errors.WrapErrorWithURL(errors.ErrScanFailed, errors.CodeScanFailed,
+		"Malware scan flagged the downloaded file", url)
+	scanErr.Details = threat
+
+	logContext := map[string]interface{}{"url": url, "threat": threat}
+
+	if opts.Action == types.ScanActionQuarantine {
+		quarantined, err := quarantineFile(path, destination, opts.QuarantineDir)
+		if err == nil {
+			logContext["quarantine"] = quarantined
+			d.logError("scan_quarantined", scanErr, logContext)
+			scanErr.Details = fmt.Sprintf("%s (quarantined as %s)", threat, quarantined)
+
+			return scanErr
+		}
+
+		// Never leave a flagged file in place
+		d.logError("scan_quarantine", err, map[string]interface{}{"path": path})
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		d.logError("scan_cleanup", err, map[string]interface{}{"path": path})
+	}
+
+	d.logError("scan_deleted", scanErr, logContext)
+
+	return scanErr
+}
+
+// quarantineFile moves the flagged file at path into dir under destination's
+// base name, made unique and read-only, and returns its new path.
+func quarantineFile(path, destination, dir string) (string, error) {
+	if dir == "" {
+		return "", errors.NewValidationError("quarantine_dir", "required to quarantine files")
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(dir, fmt.Sprintf("%s.%d", filepath.Base(destination), time.Now().UnixNano()))
+
+	if err := moveFile(path, target); err != nil {
+		return "", err
+	}
+
+	// Keep the file from being executed by accident
+	_ = os.Chmod(target, 0o400)
+
+	return target, nil
+}
+
+// checkScan scans the completed download at path and records a failure in
+// result.
+func (d *Downloader) checkScan(
+	ctx context.Context,
+	url, path, destination string,
+	options *types.DownloadOptions,
+	result *types.DownloadStats,
+) error {
+	if err := d.scanFile(ctx, url, path, destination, options); err != nil {
+		result.Success = false
+		result.Error = err
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// fakeScanner flags files containing "malware" and fails on files containing
+// "unscannable".
+type fakeScanner struct{}
+
+func (fakeScanner) ScanFile(ctx context.Context, path string) (*types.ScanResult, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- test file
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Contains(data, []byte("unscannable")):
+		return nil, stdErrors.New("scanner unavailable")
+	case bytes.Contains(data, []byte("malware")):
+		return &types.ScanResult{Threat: "Test.Malware"}, nil
+	default:
+		return &types.ScanResult{Clean: true}, nil
+	}
+}
+
+func TestDownloader_Scan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/") + " contents"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		atomic     bool
+		quarantine bool
+		wantErr    bool
+		wantKept   bool // The file is left in place after a failed scan
+	}{
+		{"clean", "/clean", false, false, false, true},
+		{"clean atomic", "/clean", true, false, false, true},
+		{"infected deleted", "/malware", false, false, true, false},
+		{"infected deleted atomic", "/malware", true, false, true, false},
+		{"infected quarantined", "/malware", false, true, true, false},
+		{"infected quarantined atomic", "/malware", true, true, true, false},
+		{"scan error", "/unscannable", false, false, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dest := filepath.Join(dir, "file.bin")
+			quarantineDir := filepath.Join(dir, "quarantine")
+
+			scan := &types.ScanOptions{Scanner: fakeScanner{}}
+			if tt.quarantine {
+				scan.Action = types.ScanActionQuarantine
+				scan.QuarantineDir = quarantineDir
+			}
+
+			downloader := NewDownloader()
+			downloader.spaceChecker = nil
+
+			stats, err := downloader.Download(context.Background(), server.URL+tt.path, dest,
+				&types.DownloadOptions{AtomicWrite: tt.atomic, Scan: scan})
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+				if _, statErr := os.Stat(dest); statErr != nil {
+					t.Errorf("clean file missing: %v", statErr)
+				}
+				return
+			}
+
+			if errors.GetErrorCode(err) != errors.CodeScanFailed || !stdErrors.Is(err, errors.ErrScanFailed) || errors.IsRetryable(err) {
+				t.Fatalf("Download() error = %v, want a non-retryable CodeScanFailed error", err)
+			}
+
+			if stats.Success {
+				t.Error("stats.Success = true for a file failing the scan")
+			}
+
+			_, statErr := os.Stat(dest)
+			if kept := statErr == nil; kept != tt.wantKept {
+				t.Errorf("file kept = %v, want %v", kept, tt.wantKept)
+			}
+
+			if _, statErr := os.Stat(PartFilePath(dest, "")); !tt.wantKept && !os.IsNotExist(statErr) {
+				t.Errorf("part file of a flagged download was kept: %v", statErr)
+			}
+
+			quarantined, _ := filepath.Glob(filepath.Join(quarantineDir, "file.bin.*"))
+			if tt.quarantine != (len(quarantined) == 1) {
+				t.Errorf("quarantined files = %v, want quarantined %v", quarantined, tt.quarantine)
+			}
+
+			var downloadErr *errors.DownloadError
+			if stdErrors.As(err, &downloadErr) && tt.path == "/malware" && !strings.Contains(downloadErr.Details, "Test.Malware") {
+				t.Errorf("error details = %q, want the threat", downloadErr.Details)
+			}
+		})
+	}
+}
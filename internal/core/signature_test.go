@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_Signature(t *testing.T) {
+	content := []byte("release tarball contents")
+
+	signer, err := openpgp.NewEntity("Release Signing", "", "release@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keyring, sig bytes.Buffer
+	if err := signer.Serialize(&keyring); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file.tar.gz":
+			_, _ = w.Write(content)
+		case "/file.tar.gz.asc":
+			_, _ = w.Write(sig.Bytes())
+		case "/tampered.tar.gz":
+			_, _ = w.Write(bytes.ToUpper(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	keyringPath := filepath.Join(dir, "keyring.gpg")
+	sigPath := filepath.Join(dir, "file.tar.gz.asc")
+
+	if err := os.WriteFile(keyringPath, keyring.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(sigPath, sig.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		signature string
+		atomic    bool
+		wantErr   bool
+	}{
+		{"local signature", "/file.tar.gz", sigPath, false, false},
+		{"remote signature", "/file.tar.gz", server.URL + "/file.tar.gz.asc", true, false},
+		{"tampered file", "/tampered.tar.gz", sigPath, false, true},
+		{"tampered file atomic", "/tampered.tar.gz", sigPath, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "file.tar.gz")
+			options := &types.DownloadOptions{
+				AtomicWrite: tt.atomic,
+				Signature:   &types.SignatureOptions{Signature: tt.signature, Keyring: keyringPath},
+			}
+
+			downloader := NewDownloader()
+			downloader.spaceChecker = nil
+
+			stats, err := downloader.Download(context.Background(), server.URL+tt.path, dest, options)
+
+			if tt.wantErr {
+				if !stdErrors.Is(err, errors.ErrSignatureMismatch) || errors.IsRetryable(err) {
+					t.Fatalf("Download() error = %v, want a non-retryable ErrSignatureMismatch", err)
+				}
+
+				if stats.Success {
+					t.Error("stats.Success = true for a file failing verification")
+				}
+
+				if _, statErr := os.Stat(dest); !os.IsNotExist(statErr) {
+					t.Errorf("file failing verification was kept: %v", statErr)
+				}
+
+				if _, statErr := os.Stat(PartFilePath(dest, "")); !os.IsNotExist(statErr) {
+					t.Errorf("part file failing verification was kept: %v", statErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+				t.Errorf("downloaded content = %q, want %q", got, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_SmallFileThreshold(t *testing.T) {
+	large := strings.Repeat("x", 4096)
+	lastModified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var (
+		mu      sync.Mutex
+		methods []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+		switch r.URL.Path {
+		case "/small":
+			_, _ = w.Write([]byte("small"))
+		case "/large":
+			w.Header().Set("Content-Length", "4096")
+			_, _ = w.Write([]byte(large))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		threshold   int64
+		wantContent string
+		wantMethods []string
+	}{
+		{"small file", "/small", 1024, "small", []string{http.MethodGet}},
+		{"large file", "/large", 1024, large, []string{http.MethodGet, http.MethodGet}},
+		{"disabled", "/small", 0, "small", []string{http.MethodHead, http.MethodGet}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			methods = nil
+			mu.Unlock()
+
+			downloader := NewDownloader()
+			downloader.spaceChecker = nil
+
+			dest := filepath.Join(t.TempDir(), "out")
+			options := &types.DownloadOptions{SmallFileThreshold: tt.threshold}
+
+			stats, err := downloader.Download(context.Background(), server.URL+tt.path, dest, options)
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if content, _ := os.ReadFile(dest); string(content) != tt.wantContent {
+				t.Errorf("content has %d bytes, want %d", len(content), len(tt.wantContent))
+			}
+
+			if !stats.LastModified.Equal(lastModified) {
+				t.Errorf("LastModified = %v, want %v", stats.LastModified, lastModified)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if strings.Join(methods, ",") != strings.Join(tt.wantMethods, ",") {
+				t.Errorf("requests = %v, want %v", methods, tt.wantMethods)
+			}
+		})
+	}
+
+	t.Run("error status", func(t *testing.T) {
+		downloader := NewDownloader()
+		downloader.spaceChecker = nil
+
+		dest := filepath.Join(t.TempDir(), "out")
+		options := &types.DownloadOptions{SmallFileThreshold: 1024, MaxRetries: 0}
+
+		if _, err := downloader.Download(context.Background(), server.URL+"/missing", dest, options); err == nil {
+			t.Fatal("Download() succeeded, want the 404")
+		}
+
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Errorf("destination exists after a failed download: %v", err)
+		}
+	})
+}
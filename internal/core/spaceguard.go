@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/forest6511/gdl/internal/storage"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// A running download rechecks free space after this much time or this many
+// bytes written, whichever comes first.
+const (
+	spaceCheckInterval = 2 * time.Second
+	spaceCheckBytes    = 32 * 1024 * 1024
+)
+
+// spaceGuard writes to a download's destination and stops the download once
+// the free space on its filesystem falls below a minimum, before the disk
+// fills up. The data written so far is kept, so the download can be resumed
+// once space has been freed.
+type spaceGuard struct {
+	w         io.Writer
+	minFree   uint64
+	available func() (uint64, error)
+
+	written   int64 // bytes written since the last check
+	lastCheck time.Time
+}
+
+// guardSpace wraps w, the writer for destination, to enforce
+// options.MinFreeSpace while the download runs. It returns w unchanged when
+// no minimum is set.
+func (d *Downloader) guardSpace(w io.Writer, destination string, options *types.DownloadOptions) io.Writer {
+	if options.MinFreeSpace <= 0 {
+		return w
+	}
+
+	// The minimum was asked for explicitly, so it applies even when the
+	// pre-download check is disabled
+	checker := d.spaceChecker
+	if checker == nil {
+		checker = storage.NewSpaceChecker()
+	}
+
+	dir := filepath.Dir(destination)
+
+	return &spaceGuard{
+		w:       w,
+		minFree: uint64(options.MinFreeSpace),
+		available: func() (uint64, error) {
+			info, err := checker.GetSpaceInfo(dir)
+			if err != nil {
+				return 0, err
+			}
+
+			return info.AvailableBytes, nil
+		},
+	}
+}
+
+// Write checks the free space when a check is due and writes p.
+func (g *spaceGuard) Write(p []byte) (int, error) {
+	if g.written >= spaceCheckBytes || time.Since(g.lastCheck) >= spaceCheckInterval {
+		if err := g.check(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := g.w.Write(p)
+	g.written += int64(n)
+
+	return n, err
+}
+
+// check fails with a CodeInsufficientSpace error when less than the minimum is
+// available. Space that cannot be determined does not stop the download;
+// a full disk still surfaces as a write error.
+func (g *spaceGuard) check() error {
+	g.written = 0
+	g.lastCheck = time.Now()
+
+	available, err := g.available()
+	if err != nil || available >= g.minFree {
+		return nil
+	}
+
+	return errors.NewDownloadErrorWithDetails(
+		errors.CodeInsufficientSpace,
+		"Free disk space fell below the minimum during download",
+		fmt.Sprintf("Available: %d bytes, minimum to keep free: %d bytes", available, g.minFree),
+	)
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestSpaceGuard(t *testing.T) {
+	var buf bytes.Buffer
+
+	free := uint64(100 * 1024 * 1024)
+	checks := 0
+
+	guard := &spaceGuard{
+		w:       &buf,
+		minFree: 64 * 1024 * 1024,
+		available: func() (uint64, error) {
+			checks++
+			return free, nil
+		},
+	}
+
+	chunk := make([]byte, 1024*1024)
+
+	// Plenty of space: the first write checks, later ones wait for the next check
+	for range 8 {
+		if _, err := guard.Write(chunk); err != nil {
+			t.Fatalf("Write() error = %v with enough space", err)
+		}
+	}
+
+	if checks != 1 {
+		t.Errorf("checked %d times for 8MB written, want 1", checks)
+	}
+
+	// Space drops below the minimum; caught once spaceCheckBytes are written
+	free = 10 * 1024 * 1024
+
+	var err error
+	for written := 0; err == nil && written <= 2*spaceCheckBytes; written += len(chunk) {
+		_, err = guard.Write(chunk)
+	}
+
+	if errors.GetErrorCode(err) != errors.CodeInsufficientSpace || !stdErrors.Is(err, errors.ErrInsufficientSpace) {
+		t.Fatalf("Write() error = %v, want CodeInsufficientSpace", err)
+	}
+
+	if errors.IsRetryable(err) {
+		t.Error("running out of space should not be retried")
+	}
+
+	if int64(buf.Len()) > 8*1024*1024+spaceCheckBytes {
+		t.Errorf("wrote %d bytes, want the guard to stop within %d bytes of the drop", buf.Len(), spaceCheckBytes)
+	}
+}
+
+func TestSpaceGuard_UnknownSpace(t *testing.T) {
+	guard := &spaceGuard{
+		w:         &bytes.Buffer{},
+		minFree:   1,
+		available: func() (uint64, error) { return 0, os.ErrPermission },
+	}
+
+	if _, err := guard.Write([]byte("data")); err != nil {
+		t.Errorf("Write() error = %v, want writes to continue when space is unknown", err)
+	}
+}
+
+func TestDownloader_MinFreeSpace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte{'x'}, 64*1024))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.spaceChecker = nil
+
+	dest := filepath.Join(t.TempDir(), "out.bin")
+
+	// More free space than any disk has
+	options := &types.DownloadOptions{MinFreeSpace: 1 << 62}
+
+	_, err := downloader.Download(context.Background(), server.URL, dest, options)
+	if errors.GetErrorCode(err) != errors.CodeInsufficientSpace {
+		t.Fatalf("Download() error = %v, want CodeInsufficientSpace", err)
+	}
+
+	// The partial file is kept for resuming
+	if _, statErr := os.Stat(dest); statErr != nil {
+		t.Errorf("partial file should be kept: %v", statErr)
+	}
+
+	if _, err := downloader.Download(context.Background(), server.URL, dest,
+		&types.DownloadOptions{MinFreeSpace: 1, OverwriteExisting: true}); err != nil {
+		t.Errorf("Download() with a small minimum error = %v", err)
+	}
+}
+
+func TestGuardSpace_Disabled(t *testing.T) {
+	var buf bytes.Buffer
+	if w := NewDownloader().guardSpace(&buf, "out.bin", &types.DownloadOptions{}); w != &buf {
+		t.Error("guardSpace() should not wrap the writer without MinFreeSpace")
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// DefaultMinSpeedTime is the window the transfer speed is measured over when
+// MinSpeed is set without StallTimeout.
+const DefaultMinSpeedTime = 30 * time.Second
+
+// speedSamples is how many times per window the watchdog samples progress.
+const speedSamples = 10
+
+// speedWatchdog reads a response body and aborts the transfer when fewer bytes
+// than required arrive within a whole window. It closes the body, so a read
+// blocked on a dead connection returns instead of waiting for the timeout.
+type speedWatchdog struct {
+	body     io.ReadCloser
+	minSpeed int64
+	window   time.Duration
+	minBytes int64 // bytes required per window
+
+	bytes   atomic.Int64
+	tripped atomic.Bool
+	done    chan struct{}
+	once    sync.Once
+}
+
+// stallDetectionEnabled reports whether the options ask for slow or stalled
+// transfers to be aborted.
+func stallDetectionEnabled(options *types.DownloadOptions) bool {
+	return options.MinSpeed > 0 || options.StallTimeout > 0
+}
+
+// watchSpeed starts a watchdog for body when stall detection is enabled. The
+// returned reader must be used in place of body and the watchdog stopped when
+// the transfer ends; a nil watchdog is returned when detection is disabled.
+func watchSpeed(body io.ReadCloser, options *types.DownloadOptions) (io.Reader, *speedWatchdog) {
+	if !stallDetectionEnabled(options) {
+		return body, nil
+	}
+
+	window := options.StallTimeout
+	if window <= 0 {
+		window = DefaultMinSpeedTime
+	}
+
+	w := &speedWatchdog{
+		body:     body,
+		minSpeed: options.MinSpeed,
+		window:   window,
+		minBytes: max(1, int64(float64(options.MinSpeed)*window.Seconds())),
+		done:     make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w, w
+}
+
+// Read reads from the body and counts the bytes received.
+func (w *speedWatchdog) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	w.bytes.Add(int64(n))
+
+	return n, err
+}
+
+// run samples the byte count and trips once the bytes received over the last
+// window fall below the minimum.
+func (w *speedWatchdog) run() {
+	ticker := time.NewTicker(w.window / speedSamples)
+	defer ticker.Stop()
+
+	history := make([]int64, 1, speedSamples+1)
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		history = append(history, w.bytes.Load())
+		if len(history) > speedSamples+1 {
+			history = append(history[:0], history[1:]...)
+		}
+
+		if len(history) == speedSamples+1 && history[speedSamples]-history[0] < w.minBytes {
+			w.tripped.Store(true)
+			_ = w.body.Close()
+
+			return
+		}
+	}
+}
+
+// Stop ends the watchdog. It is safe to call on a nil watchdog.
+func (w *speedWatchdog) Stop() {
+	if w == nil {
+		return
+	}
+
+	w.once.Do(func() { close(w.done) })
+}
+
+// Err replaces err, the error that ended the transfer, with a retryable
+// CodeTimeout error wrapping ErrTooSlow when the watchdog aborted it.
+func (w *speedWatchdog) Err(err error) error {
+	if w == nil || err == nil || !w.tripped.Load() {
+		return err
+	}
+
+	message := fmt.Sprintf("No data received for %s", w.window)
+	if w.minSpeed > 0 {
+		message = fmt.Sprintf("Transfer speed stayed below %s for %s",
+			ratelimit.FormatRate(w.minSpeed), w.window)
+	}
+
+	return errors.WrapError(errors.ErrTooSlow, errors.CodeTimeout, message)
+}
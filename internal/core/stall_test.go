@@ -0,0 +1,151 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/internal/retry"
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// trickleServer sends size bytes, writing chunk bytes every interval, and
+// hangs after sending stallAfter bytes while stall reports true.
+func trickleServer(size, chunk int, interval time.Duration, stallAfter int, stall func() bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(size))
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		stalling := stall()
+		flusher, _ := w.(http.Flusher)
+
+		for sent := 0; sent < size; sent += chunk {
+			if stalling && sent >= stallAfter {
+				<-r.Context().Done()
+				return
+			}
+
+			_, _ = w.Write(bytes.Repeat([]byte{'x'}, min(chunk, size-sent)))
+			flusher.Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}))
+}
+
+func TestDownloadToWriter_Stall(t *testing.T) {
+	server := trickleServer(64*1024, 1024, time.Millisecond, 4096, func() bool { return true })
+	defer server.Close()
+
+	options := &types.DownloadOptions{StallTimeout: 200 * time.Millisecond}
+
+	start := time.Now()
+	_, err := NewDownloader().DownloadToWriter(context.Background(), server.URL, &bytes.Buffer{}, options)
+
+	if !stdErrors.Is(err, errors.ErrTooSlow) {
+		t.Fatalf("DownloadToWriter() error = %v, want ErrTooSlow", err)
+	}
+
+	if !errors.IsRetryable(err) || errors.GetErrorCode(err) != errors.CodeTimeout {
+		t.Errorf("stall error should be a retryable timeout, got code %s", errors.GetErrorCode(err))
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("stalled download aborted after %v, want about 200ms", elapsed)
+	}
+}
+
+func TestDownloadToWriter_MinSpeed(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		wantErr  bool
+	}{
+		// 1KB every 20ms is about 50KB/s, below the minimum
+		{"too slow", 20 * time.Millisecond, true},
+		{"fast enough", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := trickleServer(256*1024, 1024, tt.interval, 0, func() bool { return false })
+			defer server.Close()
+
+			options := &types.DownloadOptions{
+				MinSpeed:     200 * 1024,
+				StallTimeout: 300 * time.Millisecond,
+			}
+
+			_, err := NewDownloader().DownloadToWriter(context.Background(), server.URL, &bytes.Buffer{}, options)
+			if tt.wantErr != stdErrors.Is(err, errors.ErrTooSlow) {
+				t.Errorf("DownloadToWriter() error = %v, want ErrTooSlow: %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && err != nil {
+				t.Errorf("DownloadToWriter() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloader_StallRetried(t *testing.T) {
+	var requests atomic.Int32
+
+	// Only the first GET stalls
+	server := trickleServer(64*1024, 4096, 0, 8192, func() bool { return requests.Add(1) == 1 })
+	defer server.Close()
+
+	downloader := NewDownloader().WithRetryStrategy(retry.NewRetryManager().WithMaxRetries(2))
+	downloader.spaceChecker = nil
+
+	dest := filepath.Join(t.TempDir(), "out.bin")
+	options := &types.DownloadOptions{
+		StallTimeout:      200 * time.Millisecond,
+		OverwriteExisting: true,
+		Backoff:           &types.BackoffPolicy{InitialDelay: time.Millisecond},
+	}
+
+	stats, err := downloader.Download(context.Background(), server.URL, dest, options)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if !stats.Success || requests.Load() != 2 {
+		t.Errorf("Success = %v after %d requests, want a retried download", stats.Success, requests.Load())
+	}
+
+	if info, err := os.Stat(dest); err != nil || info.Size() != 64*1024 {
+		t.Errorf("downloaded file = %v, %v, want 65536 bytes", info, err)
+	}
+}
+
+func TestSpeedWatchdog_Disabled(t *testing.T) {
+	body := http.NoBody
+	reader, watchdog := watchSpeed(body, &types.DownloadOptions{})
+
+	if watchdog != nil || reader != body {
+		t.Fatal("watchSpeed() should not wrap the body without MinSpeed or StallTimeout")
+	}
+
+	// A nil watchdog is safe to use
+	watchdog.Stop()
+
+	if err := watchdog.Err(errors.ErrNetworkError); err != errors.ErrNetworkError {
+		t.Errorf("Err() = %v, want the original error", err)
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/forest6511/gdl/internal/resume"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// remoteVersion holds the validators the server reported for a URL.
+type remoteVersion struct {
+	etag         string
+	lastModified time.Time
+}
+
+// downloadIfNewer implements timestamping: the download is skipped when the
+// local file is as new as the server copy, otherwise the file is replaced and
+// its modification time set to the server's Last-Modified time.
+func (d *Downloader) downloadIfNewer(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+	stats *types.DownloadStats,
+) (*types.DownloadStats, error) {
+	remote, upToDate := d.checkRemoteVersion(ctx, url, destination, options)
+	if upToDate {
+		d.logInfo("not_modified", "Local file is up to date, skipping download", map[string]interface{}{
+			"url":         url,
+			"destination": destination,
+		})
+
+		if info, err := os.Stat(destination); err == nil {
+			stats.TotalSize = info.Size()
+		}
+
+		stats.Success = true
+		stats.NotModified = true
+		stats.EndTime = time.Now()
+		stats.Duration = stats.EndTime.Sub(stats.StartTime)
+
+		return stats, nil
+	}
+
+	// A newer server copy always replaces the local file
+	replace := *options
+	replace.OverwriteExisting = true
+
+	result, err := d.transfer(ctx, url, destination, &replace, stats)
+	if err == nil && remote != nil {
+		d.recordRemoteVersion(url, destination, remote)
+	}
+
+	return result, err
+}
+
+// checkRemoteVersion sends a HEAD request conditional on the local file and
+// its recorded validators. It reports whether the local file is up to date and
+// returns the server's validators, or nil if they could not be determined.
+func (d *Downloader) checkRemoteVersion(
+	ctx context.Context,
+	url, destination string,
+	options *types.DownloadOptions,
+) (*remoteVersion, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, false
+	}
+
+	d.setRequestHeaders(req, options)
+
+	local, statErr := os.Stat(destination)
+	if statErr == nil {
+		req.Header.Set("If-Modified-Since", local.ModTime().UTC().Format(http.TimeFormat))
+
+		if meta := d.loadRemoteVersion(url, destination, local.Size()); meta != nil && meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+	}
+
+	resp, err := d.clientFor(options).Do(req)
+	if err != nil {
+		d.logInfo("timestamp_check_failed", "Conditional request failed, downloading", map[string]interface{}{
+			"error": err.Error(),
+		})
+
+		return nil, false
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, statErr == nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false
+	}
+
+	remote := &remoteVersion{etag: resp.Header.Get("ETag")}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		remote.lastModified = lastModified
+	}
+
+	if statErr != nil {
+		return remote, false
+	}
+
+	// Servers that ignore conditional requests: compare like wget -N does
+	sentETag := req.Header.Get("If-None-Match")
+	upToDate := !remote.lastModified.IsZero() &&
+		!remote.lastModified.After(local.ModTime()) &&
+		sizeMatches(resp, local.Size()) &&
+		(sentETag == "" || sentETag == remote.etag)
+
+	return remote, upToDate
+}
+
+// sizeMatches reports whether the response's Content-Length, if any, equals size.
+func sizeMatches(resp *http.Response, size int64) bool {
+	contentLength := resp.Header.Get("Content-Length")
+	if contentLength == "" {
+		return true
+	}
+
+	length, err := strconv.ParseInt(contentLength, 10, 64)
+
+	return err != nil || length == size
+}
+
+// loadRemoteVersion returns the validators recorded for destination if they
+// still describe the local file.
+func (d *Downloader) loadRemoteVersion(url, destination string, size int64) *resume.Metadata {
+	if d.resumeManager == nil {
+		return nil
+	}
+
+	path, err := filepath.Abs(destination)
+	if err != nil {
+		return nil
+	}
+
+	meta, err := d.resumeManager.LoadMetadata(path)
+	if err != nil || meta == nil || meta.URL != url || meta.Size != size {
+		return nil
+	}
+
+	return meta
+}
+
+// recordRemoteVersion stamps the downloaded file with the server's
+// Last-Modified time and records its validators for the next run.
+func (d *Downloader) recordRemoteVersion(url, destination string, remote *remoteVersion) {
+	if !remote.lastModified.IsZero() {
+		if err := os.Chtimes(destination, time.Now(), remote.lastModified); err != nil {
+			d.logError("set_mtime", err, map[string]interface{}{"destination": destination})
+		}
+	}
+
+	info, err := os.Stat(destination)
+	if err != nil || d.resumeManager == nil {
+		return
+	}
+
+	path, err := filepath.Abs(destination)
+	if err != nil {
+		return
+	}
+
+	_ = d.resumeManager.SaveMetadata(&resume.Metadata{
+		URL:          url,
+		FilePath:     path,
+		ETag:         remote.etag,
+		LastModified: remote.lastModified,
+		Size:         info.Size(),
+	})
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// Warm gets ready to download url: it resolves the host name, so the system
+// resolver has it cached, and with connect also opens a connection, TLS
+// handshake included, that the download's first request can reuse. The
+// connection is opened with a HEAD request through the client that request
+// will use, so the host limiter and request middleware apply to it.
+func (d *Downloader) Warm(ctx context.Context, url string, options *types.DownloadOptions, connect bool) error {
+	if err := d.validateURL(url); err != nil {
+		return err
+	}
+
+	if options == nil {
+		options = &types.DownloadOptions{}
+	}
+
+	parsedURL, err := parseURL(url)
+	if err != nil {
+		return errors.WrapErrorWithURL(err, errors.CodeInvalidURL, "invalid URL", url)
+	}
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, parsedURL.Hostname()); err != nil {
+		return errors.WrapErrorWithURL(err, errors.CodeNetworkError, "failed to resolve host", url)
+	}
+
+	if !connect {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return errors.WrapErrorWithURL(err, errors.CodeInvalidURL, "Failed to create HTTP request", url)
+	}
+
+	d.setRequestHeaders(req, options)
+
+	client := d.clientFor(options)
+	if smallFileFastPath(options) {
+		client = d.streamClient(url, options)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.WrapErrorWithURL(err, errors.CodeNetworkError, "failed to open connection", url)
+	}
+
+	// Closing the empty body returns the connection to the idle pool
+	return resp.Body.Close()
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDownloader_Warm(t *testing.T) {
+	var heads, conns atomic.Int32
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		}
+		_, _ = w.Write([]byte("data"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	d := NewDownloader()
+	options := &types.DownloadOptions{SmallFileThreshold: 1024}
+
+	if err := d.Warm(context.Background(), server.URL+"/file", options, false); err != nil {
+		t.Fatalf("Warm() without connecting error = %v", err)
+	}
+	if heads.Load() != 0 {
+		t.Errorf("Warm() without connecting sent %d requests, want none", heads.Load())
+	}
+
+	if err := d.Warm(context.Background(), server.URL+"/file", options, true); err != nil {
+		t.Fatalf("Warm() error = %v", err)
+	}
+	if heads.Load() != 1 {
+		t.Errorf("Warm() sent %d HEAD requests, want 1", heads.Load())
+	}
+
+	if _, err := d.DownloadToWriter(context.Background(), server.URL+"/file", io.Discard, options); err != nil {
+		t.Fatalf("DownloadToWriter() error = %v", err)
+	}
+	if got := conns.Load(); got != 1 {
+		t.Errorf("server accepted %d connections, want the warmed one reused", got)
+	}
+
+	if err := d.Warm(context.Background(), "ftp://example.com/file", options, false); err == nil {
+		t.Error("Warm() of an unsupported URL succeeded")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"runtime"
 
+	"github.com/forest6511/gdl/internal/network"
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 )
 
@@ -17,17 +18,23 @@ type ZeroCopyDownloader struct {
 
 // NewZeroCopyDownloader creates a new zero-copy optimized downloader
 func NewZeroCopyDownloader() *ZeroCopyDownloader {
+	return newZeroCopyDownloader(network.SharedTransport(zeroCopyTransportConfig(network.DefaultTransportConfig())))
+}
+
+// newZeroCopyDownloader creates a zero-copy downloader on the given transport
+func newZeroCopyDownloader(transport http.RoundTripper) *ZeroCopyDownloader {
 	return &ZeroCopyDownloader{
-		client: &http.Client{
-			Transport: &http.Transport{
-				DisableCompression: true, // Compression prevents zero-copy
-				MaxIdleConns:       10,
-				MaxConnsPerHost:    10,
-			},
-		},
+		client: &http.Client{Transport: transport},
 	}
 }
 
+// zeroCopyTransportConfig derives the zero-copy transport settings from a base configuration
+func zeroCopyTransportConfig(config network.TransportConfig) network.TransportConfig {
+	config.DisableCompression = true // Compression prevents zero-copy
+
+	return config
+}
+
 // Download performs a zero-copy download using platform-specific optimizations
 func (zd *ZeroCopyDownloader) Download(ctx context.Context, url string, dest string) (int64, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -44,7 +51,7 @@ func (zd *ZeroCopyDownloader) Download(ctx context.Context, url string, dest str
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-		return 0, gdlerrors.FromHTTPStatus(resp.StatusCode, url)
+		return 0, httpStatusError(resp, url)
 	}
 
 	// Create destination file
@@ -109,7 +116,7 @@ func (zd *ZeroCopyDownloader) DownloadWithProgress(
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-		return 0, gdlerrors.FromHTTPStatus(resp.StatusCode, url)
+		return 0, httpStatusError(resp, url)
 	}
 
 	// Create destination file
@@ -133,6 +140,51 @@ func (zd *ZeroCopyDownloader) DownloadWithProgress(
 	return zd.zeroCopyTransfer(pr, file)
 }
 
+// DownloadWithWriteOptions downloads url to dest through the write path
+// selected by opts, such as direct I/O or a tuned write buffer. progressFunc
+// may be nil.
+func (zd *ZeroCopyDownloader) DownloadWithWriteOptions(
+	ctx context.Context,
+	url string,
+	dest string,
+	progressFunc func(downloaded, total int64),
+	opts WriteOptions,
+) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL,
+			"failed to create request", url)
+	}
+
+	resp, err := zd.client.Do(req)
+	if err != nil {
+		return 0, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError,
+			"failed to execute request", url)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return 0, httpStatusError(resp, url)
+	}
+
+	file, direct, err := createWriteTarget(dest, opts)
+	if err != nil {
+		return 0, gdlerrors.NewStorageError("create file", err, dest)
+	}
+	defer func() { _ = file.Close() }()
+
+	var src io.Reader = resp.Body
+	if progressFunc != nil {
+		src = &zeroCopyProgressReader{
+			reader:       resp.Body,
+			progressFunc: progressFunc,
+			total:        resp.ContentLength,
+		}
+	}
+
+	return copyToFile(file, src, direct, opts)
+}
+
 // zeroCopyProgressReader wraps an io.Reader to report progress for zero-copy operations
 type zeroCopyProgressReader struct {
 	reader       io.Reader
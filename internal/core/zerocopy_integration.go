@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/forest6511/gdl/internal/network"
 	"github.com/forest6511/gdl/pkg/types"
 )
 
@@ -23,26 +24,37 @@ func (d *Downloader) performZeroCopyDownload(
 	var downloaded int64
 	var err error
 
+	ctx, serverIP := network.TraceConnection(ctx)
+
+	var progressFunc func(down, total int64)
 	if options.ProgressCallback != nil {
-		downloaded, err = d.zeroCopy.DownloadWithProgress(
-			ctx, url, destination,
-			func(down, total int64) {
-				elapsed := time.Since(startTime).Seconds()
-				speed := int64(0)
-				if elapsed > 0 {
-					speed = int64(float64(down) / elapsed)
-				}
-				options.ProgressCallback(down, total, speed)
-			},
-		)
-	} else {
-		downloaded, err = d.zeroCopy.Download(ctx, url, destination)
+		progressFunc = func(down, total int64) {
+			elapsed := time.Since(startTime).Seconds()
+			speed := int64(0)
+			if elapsed > 0 {
+				speed = int64(float64(down) / elapsed)
+			}
+			options.ProgressCallback(down, total, speed)
+		}
+	}
+
+	writeOptions := WriteOptions{DirectIO: options.DirectIO, BufferSize: options.WriteBufferSize}
+
+	switch {
+	case writeOptions.enabled():
+		downloaded, err = d.zeroCopyFor(options).DownloadWithWriteOptions(
+			ctx, url, destination, progressFunc, writeOptions)
+	case progressFunc != nil:
+		downloaded, err = d.zeroCopyFor(options).DownloadWithProgress(ctx, url, destination, progressFunc)
+	default:
+		downloaded, err = d.zeroCopyFor(options).Download(ctx, url, destination)
 	}
 
 	stats.EndTime = time.Now()
 	stats.Duration = stats.EndTime.Sub(stats.StartTime)
 	stats.BytesDownloaded = downloaded
 	stats.TotalSize = downloaded
+	stats.Connections = []types.ConnectionStats{connectionStats(0, downloaded, startTime, serverIP())}
 
 	if err != nil {
 		stats.Error = err
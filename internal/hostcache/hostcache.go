@@ -0,0 +1,221 @@
+// Package hostcache remembers what was learned about the servers downloads
+// come from, such as whether they allow HEAD requests and how fast they
+// serve, in a JSON file shared by gdl processes, so that later downloads from
+// the same host skip probes known to fail and start tuned to it.
+package hostcache
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// DefaultTTL is how long an entry is trusted after it was last updated.
+// Servers change; an older entry is ignored until it is learned again.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// Entry holds the facts known about one host. Zero values mean unknown.
+type Entry struct {
+	// HeadRejected is set when the host answers HEAD requests with an
+	// error but serves GET requests.
+	HeadRejected bool `json:"head_rejected,omitempty"`
+
+	// SupportsRanges is set when the host answered a probe with range
+	// support.
+	SupportsRanges bool `json:"supports_ranges,omitempty"`
+
+	// Protocol is the HTTP version of the host's last response, such as
+	// "HTTP/2.0".
+	Protocol string `json:"protocol,omitempty"`
+
+	// RTT is how long the host took to answer a probe, connection setup
+	// included.
+	RTT time.Duration `json:"rtt,omitempty"`
+
+	// Throughput is the speed, in bytes per second, of the last download
+	// from the host that was long enough to measure it.
+	Throughput int64 `json:"throughput,omitempty"`
+
+	Updated time.Time `json:"updated"`
+}
+
+// file is the content of a cache file.
+type file struct {
+	Hosts map[string]Entry `json:"hosts"`
+}
+
+// Cache is a host cache backed by a JSON file.
+type Cache struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]Entry // nil until the file is read
+}
+
+var (
+	openMu sync.Mutex
+	caches = make(map[string]*Cache)
+)
+
+// Open returns the cache backed by path, shared by all its users in the
+// process. The file is read on first use and need not exist.
+func Open(path string) *Cache {
+	openMu.Lock()
+	defer openMu.Unlock()
+
+	if c, ok := caches[path]; ok {
+		return c
+	}
+
+	c := &Cache{path: path, ttl: DefaultTTL}
+	caches[path] = c
+
+	return c
+}
+
+// DefaultFile returns the default cache file, ~/.gdl/hostcache.json.
+func DefaultFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "./hostcache.json"
+	}
+
+	return filepath.Join(homeDir, ".gdl", "hostcache.json")
+}
+
+// Host returns the key of rawURL's host: its lowercase host and port, or ""
+// when it has none.
+func Host(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(parsed.Host)
+}
+
+// Get returns the entry of host, and false when there is none or it is
+// older than the TTL. A file that cannot be read is an empty cache, and so
+// is a nil Cache.
+func (c *Cache) Get(host string) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries, _ = c.load()
+	}
+
+	entry, ok := c.entries[host]
+	if !ok || time.Since(entry.Updated) > c.ttl {
+		return Entry{}, false
+	}
+
+	return entry, true
+}
+
+// Update applies update to the entry of host, a zero Entry when there is
+// none or it expired, and saves the cache. The file is read again first, so
+// the entries other processes saved in the meantime are kept. It does
+// nothing on a nil Cache.
+func (c *Cache) Update(host string, update func(*Entry)) error {
+	if c == nil {
+		return nil
+	}
+
+	if host == "" {
+		return gdlerrors.NewValidationError("host", "host cannot be empty")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	entry := entries[host]
+	if time.Since(entry.Updated) > c.ttl {
+		entry = Entry{}
+	}
+
+	update(&entry)
+	entry.Updated = time.Now()
+	entries[host] = entry
+	c.entries = entries
+
+	return c.save(entries)
+}
+
+// load reads the cache file.
+func (c *Cache) load() (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return entries, gdlerrors.NewStorageError("read host cache", err, c.path)
+	}
+
+	if len(data) == 0 {
+		return entries, nil
+	}
+
+	var content file
+	if err := json.Unmarshal(data, &content); err != nil {
+		// A damaged cache is rebuilt as hosts are learned again
+		return entries, nil
+	}
+
+	for host, entry := range content.Hosts {
+		entries[host] = entry
+	}
+
+	return entries, nil
+}
+
+// save writes the cache file through a temporary file of its own, so that
+// gdl processes running side by side never read a partial file.
+func (c *Cache) save(entries map[string]Entry) error {
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return gdlerrors.NewInvalidPathError(dir, err)
+	}
+
+	data, err := json.MarshalIndent(file{Hosts: entries}, "", "  ")
+	if err != nil {
+		return gdlerrors.NewConfigError("failed to marshal host cache", err, c.path)
+	}
+
+	temp, err := os.CreateTemp(dir, filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return gdlerrors.NewStorageError("write host cache", err, dir)
+	}
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), c.path)
+	}
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		return gdlerrors.NewStorageError("write host cache", err, c.path)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package hostcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hostcache.json")
+
+	cache := Open(path)
+	if Open(path) != cache {
+		t.Error("Open() returned another cache for the same file")
+	}
+
+	if _, ok := cache.Get("example.com"); ok {
+		t.Fatal("Get() found an entry in a missing file")
+	}
+
+	if err := cache.Update("example.com", func(e *Entry) { e.HeadRejected = true }); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := cache.Update("example.com", func(e *Entry) { e.Throughput = 1000 }); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// Another process reads what was saved
+	other := &Cache{path: path, ttl: DefaultTTL}
+
+	entry, ok := other.Get("example.com")
+	if !ok || !entry.HeadRejected || entry.Throughput != 1000 || entry.Updated.IsZero() {
+		t.Errorf("Get() = %+v, %v, want both updates", entry, ok)
+	}
+
+	// Expired entries are ignored and start over when updated
+	other.ttl = time.Nanosecond
+	time.Sleep(time.Millisecond)
+
+	if _, ok := other.Get("example.com"); ok {
+		t.Error("Get() returned an expired entry")
+	}
+	if err := other.Update("example.com", func(e *Entry) { e.RTT = time.Second }); err != nil {
+		t.Fatal(err)
+	}
+	if entry := other.entries["example.com"]; entry.HeadRejected || entry.RTT != time.Second {
+		t.Errorf("entry = %+v, want only the new fact", entry)
+	}
+
+	if err := cache.Update("", func(*Entry) {}); err == nil {
+		t.Error("Update() accepted an empty host")
+	}
+}
+
+func TestCacheDamagedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hostcache.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := &Cache{path: path, ttl: DefaultTTL}
+	if err := cache.Update("example.com:8080", func(e *Entry) { e.SupportsRanges = true }); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if entry, ok := (&Cache{path: path, ttl: DefaultTTL}).Get("example.com:8080"); !ok || !entry.SupportsRanges {
+		t.Errorf("Get() = %+v, %v after rebuilding the file", entry, ok)
+	}
+
+	var nilCache *Cache
+	if _, ok := nilCache.Get("example.com"); ok || nilCache.Update("example.com", func(*Entry) {}) != nil {
+		t.Error("a nil Cache should be empty and ignore updates")
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := map[string]string{
+		"https://Example.COM/file.iso":    "example.com",
+		"http://example.com:8080/a?b=c":   "example.com:8080",
+		"https://user@[::1]:443/download": "[::1]:443",
+		"not a url\x7f":                   "",
+	}
+
+	for url, want := range tests {
+		if got := Host(url); got != want {
+			t.Errorf("Host(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
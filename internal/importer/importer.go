@@ -0,0 +1,468 @@
+// Package importer reads the lists of URLs other tools keep — the downloads
+// list of Chrome or Firefox, as a downloads extension exports it, HAR files
+// saved from the browser's developer tools, and HTML bookmark files — so that
+// they can be downloaded again with gdl.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+
+	"github.com/forest6511/gdl/internal/listing"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// Formats of the files Parse reads.
+const (
+	// FormatAuto detects the format from the content.
+	FormatAuto = "auto"
+
+	// FormatDownloads is the JSON the WebExtension downloads.search API
+	// returns, as Chrome and Firefox downloads extensions export it: an
+	// array of download items, or an object holding one under "downloads".
+	FormatDownloads = "downloads"
+
+	// FormatHAR is an HTTP Archive, as saved from the network panel of the
+	// browser's developer tools.
+	FormatHAR = "har"
+
+	// FormatBookmarks is an HTML page of links, such as the Netscape
+	// bookmark files browsers export.
+	FormatBookmarks = "bookmarks"
+)
+
+// Formats lists the formats Parse accepts.
+var Formats = []string{FormatAuto, FormatDownloads, FormatHAR, FormatBookmarks}
+
+// maxFileSize bounds the size of a file read into memory.
+const maxFileSize = 256 << 20
+
+// States of an Entry.
+const (
+	// StateComplete is a finished download, a successful HAR response or a
+	// bookmark.
+	StateComplete = "complete"
+
+	// StateFailed is an interrupted or cancelled download, or a HAR request
+	// that failed or got an error status.
+	StateFailed = "failed"
+)
+
+// Entry is a URL read from a file.
+type Entry struct {
+	// URL is the absolute http(s) URL.
+	URL string
+
+	// Name is the file name the browser saved the download as, or empty.
+	Name string
+
+	// MimeType is the media type of the download or response, or empty.
+	MimeType string
+
+	// Time is when the download, request or bookmark was made, or zero.
+	Time time.Time
+
+	// State is StateComplete or StateFailed.
+	State string
+}
+
+// Parse reads the entries of a file in format, one of Formats. Entries
+// other than http and https URLs, such as data: and blob: URLs, are
+// skipped.
+func Parse(r io.Reader, format string) ([]Entry, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileSize {
+		return nil, gdlerrors.NewValidationError("file", fmt.Sprintf("file is larger than %d MB", maxFileSize>>20))
+	}
+
+	if format == "" || format == FormatAuto {
+		if format = Detect(data); format == "" {
+			return nil, gdlerrors.NewValidationError("format",
+				"cannot tell the format of the file; use --format downloads, har or bookmarks")
+		}
+	}
+
+	var entries []Entry
+	switch format {
+	case FormatDownloads:
+		entries, err = parseDownloads(data)
+	case FormatHAR:
+		entries, err = parseHAR(data)
+	case FormatBookmarks:
+		entries, err = parseBookmarks(data)
+	default:
+		return nil, gdlerrors.NewValidationError("format",
+			fmt.Sprintf("unknown format %q (supported: %s)", format, strings.Join(Formats, ", ")))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if u, err := url.Parse(entry.URL); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+			kept = append(kept, entry)
+		}
+	}
+
+	return kept, nil
+}
+
+// Detect returns the format of data, or "" if it is none of them.
+func Detect(data []byte) string {
+	trimmed := bytes.TrimLeftFunc(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), unicode.IsSpace)
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	switch trimmed[0] {
+	case '[':
+		return FormatDownloads
+	case '{':
+		var probe struct {
+			Log       json.RawMessage `json:"log"`
+			Downloads json.RawMessage `json:"downloads"`
+		}
+		if json.Unmarshal(trimmed, &probe) != nil {
+			return ""
+		}
+		switch {
+		case probe.Log != nil:
+			return FormatHAR
+		case probe.Downloads != nil:
+			return FormatDownloads
+		}
+	case '<':
+		return FormatBookmarks
+	}
+
+	return ""
+}
+
+// downloadItem holds the fields of a downloads.DownloadItem that are
+// imported.
+type downloadItem struct {
+	URL       string `json:"url"`
+	FinalURL  string `json:"finalUrl"`
+	Filename  string `json:"filename"`
+	Mime      string `json:"mime"`
+	StartTime string `json:"startTime"`
+	State     string `json:"state"`
+}
+
+// parseDownloads reads downloads.search results.
+func parseDownloads(data []byte) ([]Entry, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var items []downloadItem
+	if trimmed := bytes.TrimLeftFunc(data, unicode.IsSpace); len(trimmed) > 0 && trimmed[0] == '{' {
+		var wrapped struct {
+			Downloads []downloadItem `json:"downloads"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapped); err != nil {
+			return nil, gdlerrors.NewValidationError("file", fmt.Sprintf("invalid downloads list: %v", err))
+		}
+		items = wrapped.Downloads
+	} else if err := json.Unmarshal(data, &items); err != nil {
+		return nil, gdlerrors.NewValidationError("file", fmt.Sprintf("invalid downloads list: %v", err))
+	}
+
+	entries := make([]Entry, 0, len(items))
+	for _, item := range items {
+		link := item.URL
+		if link == "" {
+			link = item.FinalURL
+		}
+
+		state := StateComplete
+		if item.State != "" && item.State != "complete" {
+			state = StateFailed
+		}
+
+		entries = append(entries, Entry{
+			URL:      link,
+			Name:     baseName(item.Filename),
+			MimeType: item.Mime,
+			Time:     parseTime(item.StartTime),
+			State:    state,
+		})
+	}
+
+	return entries, nil
+}
+
+// harFile holds the parts of a HAR file that are imported.
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime string `json:"startedDateTime"`
+			Request         struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// parseHAR reads the GET requests of a HAR file. Redirects are skipped,
+// since the request they lead to is an entry of its own.
+func parseHAR(data []byte) ([]Entry, error) {
+	var har harFile
+	if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), &har); err != nil {
+		return nil, gdlerrors.NewValidationError("file", fmt.Sprintf("invalid HAR file: %v", err))
+	}
+
+	entries := make([]Entry, 0, len(har.Log.Entries))
+	for _, e := range har.Log.Entries {
+		if !strings.EqualFold(e.Request.Method, "GET") {
+			continue
+		}
+
+		status := e.Response.Status
+		if status >= 300 && status < 400 && status != 304 {
+			continue
+		}
+
+		state := StateComplete
+		if status == 0 || status >= 400 {
+			state = StateFailed
+		}
+
+		mimeType, _, _ := strings.Cut(e.Response.Content.MimeType, ";")
+
+		entries = append(entries, Entry{
+			URL:      e.Request.URL,
+			MimeType: strings.TrimSpace(mimeType),
+			Time:     parseTime(e.StartedDateTime),
+			State:    state,
+		})
+	}
+
+	return entries, nil
+}
+
+// parseBookmarks reads the links of an HTML page, with the ADD_DATE of the
+// bookmark files browsers export.
+func parseBookmarks(data []byte) ([]Entry, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, gdlerrors.NewValidationError("file", fmt.Sprintf("invalid bookmarks file: %v", err))
+	}
+
+	var entries []Entry
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			entry := Entry{State: StateComplete}
+			for _, attr := range n.Attr {
+				switch attr.Key {
+				case "href":
+					entry.URL = strings.TrimSpace(attr.Val)
+				case "add_date":
+					if seconds, err := strconv.ParseInt(attr.Val, 10, 64); err == nil && seconds > 0 {
+						entry.Time = time.Unix(seconds, 0).UTC()
+					}
+				}
+			}
+			if entry.URL != "" {
+				entries = append(entries, entry)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return entries, nil
+}
+
+// parseTime parses an RFC 3339 time, returning zero if it does not parse.
+func parseTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// baseName returns the file name of a local path, which may come from
+// Windows, without the characters a batch file or a file system would not
+// keep.
+func baseName(filename string) string {
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+
+	filename = strings.TrimSpace(filename)
+	if filename == "." || filename == ".." {
+		return ""
+	}
+
+	return filename
+}
+
+// Filter selects entries.
+type Filter struct {
+	// Include keeps only entries matching one of these patterns, and
+	// Exclude drops entries matching any of them. A pattern without a slash
+	// is matched against the file name, one with a slash against the URL
+	// path without its leading slash (see listing.Match).
+	Include []string
+	Exclude []string
+
+	// Hosts keeps only entries whose host matches one of these shell
+	// patterns, such as "*.example.com".
+	Hosts []string
+
+	// MimeTypes keeps only entries whose media type is one of these or, for
+	// a value ending in a slash such as "video/", starts with it.
+	MimeTypes []string
+
+	// Since keeps only entries made at or after this time.
+	Since time.Time
+
+	// State keeps only entries in this state, if set.
+	State string
+}
+
+// Validate checks the patterns and state of the filter.
+func (f *Filter) Validate() error {
+	for _, pattern := range append(append(append([]string(nil), f.Include...), f.Exclude...), f.Hosts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return gdlerrors.NewValidationError("pattern", fmt.Sprintf("invalid pattern %q", pattern))
+		}
+	}
+
+	if f.State != "" && f.State != StateComplete && f.State != StateFailed {
+		return gdlerrors.NewValidationError("state",
+			fmt.Sprintf("unknown state %q (supported: %s, %s)", f.State, StateComplete, StateFailed))
+	}
+
+	return nil
+}
+
+// Apply returns the entries passing the filter, keeping the first entry of
+// each URL.
+func (f *Filter) Apply(entries []Entry) []Entry {
+	seen := make(map[string]bool)
+
+	var kept []Entry
+	for _, entry := range entries {
+		if seen[entry.URL] || !f.matches(entry) {
+			continue
+		}
+		seen[entry.URL] = true
+		kept = append(kept, entry)
+	}
+
+	return kept
+}
+
+// matches reports whether entry passes the filter.
+func (f *Filter) matches(entry Entry) bool {
+	if f.State != "" && entry.State != f.State {
+		return false
+	}
+
+	if !f.Since.IsZero() && (entry.Time.IsZero() || entry.Time.Before(f.Since)) {
+		return false
+	}
+
+	if len(f.MimeTypes) > 0 && !matchMimeType(entry.MimeType, f.MimeTypes) {
+		return false
+	}
+
+	u, err := url.Parse(entry.URL)
+	if err != nil {
+		return false
+	}
+
+	if len(f.Hosts) > 0 && !matchHost(strings.ToLower(u.Hostname()), f.Hosts) {
+		return false
+	}
+
+	rel := strings.TrimPrefix(u.Path, "/")
+	if entry.Name != "" {
+		rel = path.Join(path.Dir(rel), entry.Name)
+	}
+
+	return listing.Match(rel, f.Include, f.Exclude)
+}
+
+// matchHost reports whether host matches one of patterns.
+func matchHost(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchMimeType reports whether mimeType is one of types, or starts with
+// one of them that ends in a slash.
+func matchMimeType(mimeType string, types []string) bool {
+	mimeType = strings.ToLower(mimeType)
+	if mimeType == "" {
+		return false
+	}
+
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if mimeType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mimeType, t)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteBatch writes entries as a batch file for "gdl batch": one URL per
+// line, followed by the name the browser saved it as, unless names is
+// false. Spaces in URLs are escaped, since a space separates the
+// destination.
+func WriteBatch(w io.Writer, entries []Entry, names bool) error {
+	bw := bufio.NewWriter(w)
+
+	for _, entry := range entries {
+		line := strings.ReplaceAll(entry.URL, " ", "%20")
+		if names && entry.Name != "" {
+			line += " " + entry.Name
+		}
+		if _, err := fmt.Fprintln(bw, line); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
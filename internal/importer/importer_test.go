@@ -0,0 +1,222 @@
+package importer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const downloadsJSON = `[
+  {"id": 1, "url": "https://example.com/files/report.pdf", "finalUrl": "https://cdn.example.com/r.pdf",
+   "filename": "C:\\Users\\me\\Downloads\\report (1).pdf", "mime": "application/pdf",
+   "startTime": "2025-03-01T10:00:00.000Z", "state": "complete"},
+  {"id": 2, "url": "https://videos.example.org/clip.mp4", "filename": "/home/me/Downloads/clip.mp4",
+   "mime": "video/mp4", "startTime": "2025-03-05T08:30:00.000Z", "state": "interrupted"},
+  {"id": 3, "url": "blob:https://example.com/1234", "filename": "/tmp/blob.bin", "state": "complete"},
+  {"id": 4, "url": "data:text/plain,hello", "state": "complete"}
+]`
+
+const harJSON = `{"log": {"version": "1.2", "entries": [
+  {"startedDateTime": "2025-04-01T12:00:00.000Z",
+   "request": {"method": "GET", "url": "https://example.com/app.js"},
+   "response": {"status": 200, "content": {"mimeType": "application/javascript; charset=utf-8"}}},
+  {"startedDateTime": "2025-04-01T12:00:01.000Z",
+   "request": {"method": "GET", "url": "https://example.com/old"},
+   "response": {"status": 301, "content": {"mimeType": ""}}},
+  {"startedDateTime": "2025-04-01T12:00:02.000Z",
+   "request": {"method": "POST", "url": "https://example.com/api"},
+   "response": {"status": 200, "content": {"mimeType": "application/json"}}},
+  {"startedDateTime": "2025-04-01T12:00:03.000Z",
+   "request": {"method": "GET", "url": "https://example.com/missing.png"},
+   "response": {"status": 404, "content": {"mimeType": "text/html"}}}
+]}}`
+
+const bookmarksHTML = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1700000000">Downloads</H3>
+    <DL><p>
+        <DT><A HREF="https://example.com/iso/distro.iso" ADD_DATE="1710000000">Distro ISO</A>
+        <DT><A HREF="javascript:void(0)">Bookmarklet</A>
+        <DT><A HREF="ftp://example.com/file.txt">FTP</A>
+    </DL><p>
+</DL><p>`
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"downloads array", downloadsJSON, FormatDownloads},
+		{"downloads object", `{"downloads": []}`, FormatDownloads},
+		{"har", harJSON, FormatHAR},
+		{"bookmarks", bookmarksHTML, FormatBookmarks},
+		{"bom and space", "\xef\xbb\xbf\n  <a href=x>", FormatBookmarks},
+		{"unknown object", `{"items": []}`, ""},
+		{"text", "https://example.com/file", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect([]byte(tt.data)); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		want   []Entry
+	}{
+		{
+			name:   "downloads",
+			data:   downloadsJSON,
+			format: FormatAuto,
+			want: []Entry{
+				{URL: "https://example.com/files/report.pdf", Name: "report (1).pdf", MimeType: "application/pdf",
+					Time: time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC), State: StateComplete},
+				{URL: "https://videos.example.org/clip.mp4", Name: "clip.mp4", MimeType: "video/mp4",
+					Time: time.Date(2025, 3, 5, 8, 30, 0, 0, time.UTC), State: StateFailed},
+			},
+		},
+		{
+			name:   "har",
+			data:   harJSON,
+			format: FormatHAR,
+			want: []Entry{
+				{URL: "https://example.com/app.js", MimeType: "application/javascript",
+					Time: time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC), State: StateComplete},
+				{URL: "https://example.com/missing.png", MimeType: "text/html",
+					Time: time.Date(2025, 4, 1, 12, 0, 3, 0, time.UTC), State: StateFailed},
+			},
+		},
+		{
+			name: "bookmarks",
+			data: bookmarksHTML,
+			want: []Entry{
+				{URL: "https://example.com/iso/distro.iso", Time: time.Unix(1710000000, 0).UTC(), State: StateComplete},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			for i := range got {
+				got[i].Time = got[i].Time.UTC()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+	}{
+		{"undetectable", "just text", FormatAuto},
+		{"unknown format", downloadsJSON, "csv"},
+		{"invalid downloads", `[{"url": 1}]`, FormatDownloads},
+		{"invalid har", `{"log": []}`, FormatHAR},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.data), tt.format); err == nil {
+				t.Error("Parse() should fail")
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	entries := []Entry{
+		{URL: "https://example.com/files/report.pdf", Name: "report (1).pdf", MimeType: "application/pdf",
+			Time: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), State: StateComplete},
+		{URL: "https://videos.example.org/media/clip.mp4", MimeType: "video/mp4",
+			Time: time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC), State: StateFailed},
+		{URL: "https://example.com/iso/distro.iso", State: StateComplete},
+		{URL: "https://example.com/files/report.pdf", Name: "report (2).pdf", State: StateComplete},
+	}
+
+	urls := func(entries []Entry) []string {
+		var result []string
+		for _, entry := range entries {
+			result = append(result, entry.URL)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"no filter drops duplicates", Filter{}, []string{entries[0].URL, entries[1].URL, entries[2].URL}},
+		{"include by saved name", Filter{Include: []string{"report (1).pdf"}}, []string{entries[0].URL}},
+		{"include by path", Filter{Include: []string{"media/*"}}, []string{entries[1].URL}},
+		{"exclude", Filter{Exclude: []string{"*.pdf", "*.iso"}}, []string{entries[1].URL}},
+		{"host", Filter{Hosts: []string{"*.EXAMPLE.org"}}, []string{entries[1].URL}},
+		{"mime prefix", Filter{MimeTypes: []string{"video/"}}, []string{entries[1].URL}},
+		{"mime exact", Filter{MimeTypes: []string{"application/pdf"}}, []string{entries[0].URL}},
+		{"since drops undated", Filter{Since: time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)}, []string{entries[1].URL}},
+		{"state", Filter{State: StateComplete}, []string{entries[0].URL, entries[2].URL}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if got := urls(tt.filter.Apply(entries)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, filter := range []Filter{{Include: []string{"["}}, {Hosts: []string{"[a"}}, {State: "done"}} {
+		if err := filter.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", filter)
+		}
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	entries := []Entry{
+		{URL: "https://example.com/a file.zip", Name: "a file.zip"},
+		{URL: "https://example.com/b.zip"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBatch(&buf, entries, true); err != nil {
+		t.Fatalf("WriteBatch() error = %v", err)
+	}
+	if want := "https://example.com/a%20file.zip a file.zip\nhttps://example.com/b.zip\n"; buf.String() != want {
+		t.Errorf("WriteBatch() = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteBatch(&buf, entries, false); err != nil {
+		t.Fatalf("WriteBatch() error = %v", err)
+	}
+	if want := "https://example.com/a%20file.zip\nhttps://example.com/b.zip\n"; buf.String() != want {
+		t.Errorf("WriteBatch() without names = %q, want %q", buf.String(), want)
+	}
+}
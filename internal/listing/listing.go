@@ -0,0 +1,360 @@
+// Package listing finds the files under a URL: the links of HTML directory
+// index pages, as generated by nginx autoindex and Apache mod_autoindex, or
+// the objects under an S3 prefix.
+package listing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/forest6511/gdl/internal/network"
+	s3protocol "github.com/forest6511/gdl/internal/protocols/s3"
+	"github.com/forest6511/gdl/internal/robots"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// DefaultMaxDepth is how many directory levels below the root are followed
+// when Options.MaxDepth is not set.
+const DefaultMaxDepth = 10
+
+// maxIndexPageSize bounds the size of an index page read into memory.
+const maxIndexPageSize = 16 << 20
+
+// Entry is a file found under a listed URL.
+type Entry struct {
+	// URL is the file's absolute URL.
+	URL string
+
+	// Path is the file's slash-separated path relative to the listed URL.
+	Path string
+
+	// Size is the file's size in bytes, or -1 if the listing does not say.
+	Size int64
+}
+
+// S3Lister lists the objects under a prefix of a bucket.
+type S3Lister interface {
+	ListAllObjects(ctx context.Context, bucket, prefix string) ([]s3protocol.Object, error)
+}
+
+// Options configures List.
+type Options struct {
+	// Client fetches index pages (http.DefaultClient if nil).
+	Client *http.Client
+
+	// Header is sent with every index page request.
+	Header http.Header
+
+	// MaxDepth is how many directory levels below the root are followed
+	// (0 = DefaultMaxDepth, negative = the root only).
+	MaxDepth int
+
+	// Include keeps only files matching one of these patterns, and Exclude
+	// drops files matching any of them (see Match).
+	Include []string
+	Exclude []string
+
+	// Robots skips the index pages and files they disallow, and index pages
+	// are fetched their CrawlDelay apart (nil = robots.txt is not obeyed).
+	Robots *robots.Rules
+
+	// S3 lists s3:// URLs (an S3 client with the default AWS configuration
+	// if nil).
+	S3 S3Lister
+}
+
+// List returns the files under root, an http(s) URL of a directory index page
+// or an s3://bucket/prefix URL, that pass the Include and Exclude patterns.
+func List(ctx context.Context, root string, opts *Options) ([]Entry, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	for _, pattern := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, gdlerrors.NewValidationError("pattern", fmt.Sprintf("invalid pattern %q", pattern))
+		}
+	}
+
+	rootURL, err := url.Parse(root)
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", root)
+	}
+
+	var entries []Entry
+	switch strings.ToLower(rootURL.Scheme) {
+	case "http", "https":
+		entries, err = listIndex(ctx, rootURL, opts)
+	case "s3":
+		entries, err = listS3(ctx, rootURL, opts)
+	default:
+		return nil, gdlerrors.NewValidationError("url", "cannot list "+rootURL.Scheme+" URLs")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if Match(entry.Path, opts.Include, opts.Exclude) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered, nil
+}
+
+// Match reports whether the relative path rel passes the filters: it must
+// match one of include, if any, and none of exclude. Patterns use path.Match
+// syntax; a pattern without a slash is matched against the file name, one with
+// a slash against the whole relative path.
+func Match(rel string, include, exclude []string) bool {
+	for _, pattern := range exclude {
+		if matchPattern(pattern, rel) {
+			return false
+		}
+	}
+
+	if len(include) == 0 {
+		return true
+	}
+
+	for _, pattern := range include {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPattern matches pattern against rel or, for patterns without a slash,
+// against rel's base name.
+func matchPattern(pattern, rel string) bool {
+	name := rel
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(rel)
+	}
+
+	matched, _ := path.Match(pattern, name)
+
+	return matched
+}
+
+// listIndex follows an HTML index page and the index pages of its
+// subdirectories.
+func listIndex(ctx context.Context, root *url.URL, opts *Options) ([]Entry, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if opts.Robots != nil && opts.Robots.CrawlDelay > 0 {
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+
+		paced := *client
+		paced.Transport = network.NewHostLimiter(0, opts.Robots.CrawlDelay).Transport(transport)
+		client = &paced
+	}
+
+	maxDepth := opts.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	// Links resolve against the directory, so it must end in a slash
+	base := *root
+	base.RawQuery, base.Fragment = "", ""
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+
+	if !opts.Robots.Allowed(base.RequestURI()) {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodePermissionDenied,
+			"robots.txt disallows the URL", fmt.Sprintf("%s is disallowed by %s://%s/robots.txt", &base, base.Scheme, base.Host))
+	}
+
+	var entries []Entry
+	visited := map[string]bool{base.String(): true}
+	seen := make(map[string]bool)
+
+	type page struct {
+		url   *url.URL
+		depth int
+	}
+	queue := []page{{&base, 0}}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		links, err := fetchLinks(ctx, client, opts.Header, current.url)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, link := range links {
+			rel, ok := relativePath(&base, link)
+			if !ok || !opts.Robots.Allowed(link.RequestURI()) {
+				continue
+			}
+
+			key := link.String()
+			if strings.HasSuffix(link.Path, "/") {
+				if !visited[key] && current.depth < maxDepth {
+					visited[key] = true
+					queue = append(queue, page{link, current.depth + 1})
+				}
+				continue
+			}
+
+			if !seen[key] {
+				seen[key] = true
+				entries = append(entries, Entry{URL: key, Path: rel, Size: -1})
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// fetchLinks fetches an index page and returns its links, resolved against
+// the page's URL.
+func fetchLinks(ctx context.Context, client *http.Client, header http.Header, pageURL *url.URL) ([]*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", pageURL.String())
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "failed to fetch index page", pageURL.String())
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, gdlerrors.FromHTTPResponse(resp, pageURL.String())
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+			"URL is not a directory index page", fmt.Sprintf("%s is %s", pageURL, contentType))
+	}
+
+	doc, err := html.Parse(io.LimitReader(resp.Body, maxIndexPageSize))
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "failed to parse index page", pageURL.String())
+	}
+
+	var links []*url.URL
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for _, attr := range n.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				if link, err := pageURL.Parse(strings.TrimSpace(attr.Val)); err == nil {
+					links = append(links, link)
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return links, nil
+}
+
+// relativePath returns link's path relative to the directory base, and false
+// for links outside it: other hosts, parent directories, the directory itself
+// and the column-sorting links of index pages ("?C=N;O=D").
+func relativePath(base, link *url.URL) (string, bool) {
+	if link.Scheme != base.Scheme || link.Host != base.Host || link.RawQuery != "" {
+		return "", false
+	}
+
+	if !strings.HasPrefix(link.Path, base.Path) {
+		return "", false
+	}
+
+	rel := strings.TrimSuffix(strings.TrimPrefix(link.Path, base.Path), "/")
+	if !safeRelative(rel) {
+		return "", false
+	}
+
+	link.Fragment = ""
+
+	return rel, true
+}
+
+// safeRelative reports whether rel is a non-empty, clean relative path that
+// stays inside its directory, so that it can be joined to a destination.
+func safeRelative(rel string) bool {
+	return rel != "" && !strings.HasPrefix(rel, "/") && path.Clean(rel) == rel && rel != ".." &&
+		!strings.HasPrefix(rel, "../")
+}
+
+// listS3 lists the objects under an s3://bucket/prefix URL.
+func listS3(ctx context.Context, root *url.URL, opts *Options) ([]Entry, error) {
+	bucket := root.Host
+	if bucket == "" {
+		return nil, gdlerrors.NewValidationError("bucket", "bucket name is required in S3 URL")
+	}
+
+	prefix := strings.TrimPrefix(root.Path, "/")
+
+	lister := opts.S3
+	if lister == nil {
+		downloader, err := s3protocol.NewS3Downloader(nil)
+		if err != nil {
+			return nil, err
+		}
+		lister = downloader
+	}
+
+	objects, err := lister.ListAllObjects(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// A prefix names a directory unless it is the start of an object name
+	dir := prefix
+	if dir != "" && !strings.HasSuffix(dir, "/") {
+		dir = dir[:strings.LastIndex(dir, "/")+1]
+	}
+
+	entries := make([]Entry, 0, len(objects))
+	for _, obj := range objects {
+		// Keys are arbitrary strings; skip those that are not plain paths
+		rel := strings.TrimPrefix(obj.Key, dir)
+		if !safeRelative(rel) {
+			continue
+		}
+
+		entries = append(entries, Entry{
+			URL:  (&url.URL{Scheme: "s3", Host: bucket, Path: "/" + obj.Key}).String(),
+			Path: rel,
+			Size: obj.Size,
+		})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,295 @@
+package listing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	s3protocol "github.com/forest6511/gdl/internal/protocols/s3"
+	"github.com/forest6511/gdl/internal/robots"
+)
+
+// indexServer serves nginx- and Apache-style index pages for a small tree.
+func indexServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	pages := map[string]string{
+		// nginx autoindex
+		"/pub/": `<html><head><title>Index of /pub/</title></head><body>
+<h1>Index of /pub/</h1><hr><pre><a href="../">../</a>
+<a href="docs/">docs/</a>                                   01-Jan-2025 00:00       -
+<a href="release-1.0.tar.gz">release-1.0.tar.gz</a>         01-Jan-2025 00:00    1024
+<a href="release-1.0.tar.gz.asc">release-1.0.tar.gz.asc</a> 01-Jan-2025 00:00     833
+<a href="notes%20v1.txt">notes v1.txt</a>                   01-Jan-2025 00:00      12
+<a href="https://elsewhere.example.com/x.zip">mirror</a>
+<a href="/other/y.zip">outside</a>
+</pre><hr></body></html>`,
+		// Apache mod_autoindex, with sorting links and absolute hrefs
+		"/pub/docs/": `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 3.2 Final//EN">
+<html><head><title>Index of /pub/docs</title></head><body>
+<h1>Index of /pub/docs</h1><table>
+<tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th></tr>
+<tr><td><a href="/pub/">Parent Directory</a></td></tr>
+<tr><td><a href="guide.pdf">guide.pdf</a></td></tr>
+<tr><td><a href="/pub/docs/api/">api/</a></td></tr>
+<tr><td><a href="guide.pdf#page=2">guide.pdf</a></td></tr>
+</table></body></html>`,
+		"/pub/docs/api/":      `<a href="../">Parent</a><a href="index.html">index.html</a><a href="deep/">deep/</a>`,
+		"/pub/docs/api/deep/": `<a href="bottom.txt">bottom.txt</a>`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pub/plain.txt" {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("not an index"))
+			return
+		}
+
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}))
+}
+
+func paths(entries []Entry) []string {
+	var result []string
+	for _, entry := range entries {
+		result = append(result, entry.Path)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func TestList_HTTPIndex(t *testing.T) {
+	server := indexServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		root string
+		opts *Options
+		want []string
+	}{
+		{"everything", "/pub/", nil, []string{
+			"docs/api/deep/bottom.txt", "docs/api/index.html", "docs/guide.pdf",
+			"notes v1.txt", "release-1.0.tar.gz", "release-1.0.tar.gz.asc",
+		}},
+		{"root without slash", "/pub", &Options{MaxDepth: -1}, []string{
+			"notes v1.txt", "release-1.0.tar.gz", "release-1.0.tar.gz.asc",
+		}},
+		{"depth 1", "/pub/", &Options{MaxDepth: 1}, []string{
+			"docs/guide.pdf", "notes v1.txt", "release-1.0.tar.gz", "release-1.0.tar.gz.asc",
+		}},
+		{"subdirectory", "/pub/docs/", nil, []string{
+			"api/deep/bottom.txt", "api/index.html", "guide.pdf",
+		}},
+		{"include", "/pub/", &Options{Include: []string{"*.tar.gz", "*.pdf"}}, []string{
+			"docs/guide.pdf", "release-1.0.tar.gz",
+		}},
+		{"exclude", "/pub/", &Options{Exclude: []string{"*.asc", "docs/api/*"}}, []string{
+			"docs/api/deep/bottom.txt", "docs/guide.pdf", "notes v1.txt", "release-1.0.tar.gz",
+		}},
+		{"robots", "/pub/", &Options{Robots: robots.Parse(strings.NewReader(
+			"User-agent: *\nDisallow: /pub/docs/api/\nDisallow: /*.asc$\n"), "gdl")}, []string{
+			"docs/guide.pdf", "notes v1.txt", "release-1.0.tar.gz",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := List(context.Background(), server.URL+tt.root, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := paths(entries); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("List() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_HTTPIndexURLs(t *testing.T) {
+	server := indexServer(t)
+	defer server.Close()
+
+	entries, err := List(context.Background(), server.URL+"/pub/", &Options{Include: []string{"notes*", "guide.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"notes v1.txt":   server.URL + "/pub/notes%20v1.txt",
+		"docs/guide.pdf": server.URL + "/pub/docs/guide.pdf",
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("List() = %+v, want %d entries", entries, len(want))
+	}
+	for _, entry := range entries {
+		if entry.URL != want[entry.Path] || entry.Size != -1 {
+			t.Errorf("entry %q = %+v, want URL %s", entry.Path, entry, want[entry.Path])
+		}
+	}
+}
+
+func TestList_Robots(t *testing.T) {
+	server := indexServer(t)
+	defer server.Close()
+
+	_, err := List(context.Background(), server.URL+"/pub/docs/", &Options{
+		Robots: robots.Parse(strings.NewReader("User-agent: gdl\nDisallow: /pub/\n"), "gdl"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "robots.txt") {
+		t.Errorf("List() of a disallowed URL error = %v, want a robots.txt error", err)
+	}
+
+	// Three index pages, fetched a crawl delay apart
+	start := time.Now()
+	_, err = List(context.Background(), server.URL+"/pub/docs/", &Options{
+		Robots: robots.Parse(strings.NewReader("User-agent: *\nCrawl-delay: 0.03\n"), "gdl"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("List() took %v, want at least two crawl delays", elapsed)
+	}
+}
+
+func TestList_Errors(t *testing.T) {
+	server := indexServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		root string
+		opts *Options
+	}{
+		{"not found", server.URL + "/missing/", nil},
+		{"not an index page", server.URL + "/pub/plain.txt", nil},
+		{"unsupported scheme", "ftp://example.com/pub/", nil},
+		{"bad pattern", server.URL + "/pub/", &Options{Include: []string{"[a-"}}},
+		{"S3 without bucket", "s3:///prefix/", &Options{S3: &fakeS3{}}},
+		{"S3 failure", "s3://bucket/prefix/", &Options{S3: &fakeS3{err: errors.New("access denied")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := List(context.Background(), tt.root, tt.opts); err == nil {
+				t.Error("List() should fail")
+			}
+		})
+	}
+}
+
+type fakeS3 struct {
+	keys           []string
+	err            error
+	bucket, prefix string
+}
+
+func (f *fakeS3) ListAllObjects(ctx context.Context, bucket, prefix string) ([]s3protocol.Object, error) {
+	f.bucket, f.prefix = bucket, prefix
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	var objects []s3protocol.Object
+	for i, key := range f.keys {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, s3protocol.Object{Key: key, Size: int64(i)})
+		}
+	}
+
+	return objects, nil
+}
+
+func TestList_S3(t *testing.T) {
+	keys := []string{
+		"logs/2025/01/a.log", "logs/2025/01/b.gz", "logs/2025/02/c.log",
+		"logs/../../etc/passwd", "logs//double", "logsfile.txt",
+	}
+
+	tests := []struct {
+		root       string
+		opts       Options
+		wantPrefix string
+		want       []string
+	}{
+		{"s3://bucket/logs/", Options{}, "logs/", []string{"2025/01/a.log", "2025/01/b.gz", "2025/02/c.log"}},
+		{"s3://bucket/logs/2025/01/", Options{}, "logs/2025/01/", []string{"a.log", "b.gz"}},
+		// A prefix that is not a directory keeps the rest of the key
+		{"s3://bucket/logs/2025/0", Options{}, "logs/2025/0", []string{"01/a.log", "01/b.gz", "02/c.log"}},
+		{"s3://bucket/logs/", Options{Include: []string{"*.log"}}, "logs/", []string{"2025/01/a.log", "2025/02/c.log"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.root, func(t *testing.T) {
+			s3 := &fakeS3{keys: keys}
+			tt.opts.S3 = s3
+
+			entries, err := List(context.Background(), tt.root, &tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s3.bucket != "bucket" || s3.prefix != tt.wantPrefix {
+				t.Errorf("listed %s %q, want bucket %q", s3.bucket, s3.prefix, tt.wantPrefix)
+			}
+
+			if got := paths(entries); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("List() = %q, want %q", got, tt.want)
+			}
+
+			for _, entry := range entries {
+				if !strings.HasPrefix(entry.URL, "s3://bucket/") || !strings.HasSuffix(entry.URL, entry.Path) || entry.Size < 0 {
+					t.Errorf("entry = %+v", entry)
+				}
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		rel              string
+		include, exclude []string
+		want             bool
+	}{
+		{"a/b/file.iso", nil, nil, true},
+		{"a/b/file.iso", []string{"*.iso"}, nil, true},
+		{"a/b/file.iso", []string{"*.zip"}, nil, false},
+		{"a/b/file.iso", []string{"a/*/file.iso"}, nil, true},
+		{"a/b/file.iso", []string{"*/file.iso"}, nil, false},
+		{"a/b/file.iso", nil, []string{"file.*"}, false},
+		{"a/b/file.iso", []string{"*.iso"}, []string{"a/b/*"}, false},
+		{"file.iso", []string{"[fg]ile.iso"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.rel, tt.include, tt.exclude); got != tt.want {
+			t.Errorf("Match(%q, %q, %q) = %v, want %v", tt.rel, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestSafeRelative(t *testing.T) {
+	for rel, want := range map[string]bool{
+		"a.txt": true, "a/b.txt": true, "": false, "/a": false, "../a": false,
+		"..": false, "a/../b": false, "a//b": false, "./a": false, "a/.": false,
+	} {
+		if got := safeRelative(rel); got != want {
+			t.Errorf("safeRelative(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package manifest writes and checks checksum manifests in the format of
+// sha256sum and b3sum: one "<hex digest>  <path>" line per file, with paths
+// relative to the manifest's directory.
+package manifest
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// Supported checksum algorithms.
+const (
+	SHA256 = checksum.SHA256
+	BLAKE3 = checksum.BLAKE3
+)
+
+// Algorithms lists the supported algorithms.
+var Algorithms = []string{SHA256, BLAKE3}
+
+// filenames are the conventional manifest names of each algorithm.
+var filenames = map[string]string{
+	SHA256: "SHA256SUMS",
+	BLAKE3: "BLAKE3SUMS",
+}
+
+// Entry is one file listed in a manifest.
+type Entry struct {
+	Digest string
+	Path   string // Relative to the manifest's directory, with forward slashes
+}
+
+// Result is the outcome of checking one entry.
+type Result struct {
+	Entry
+	OK  bool
+	Err error // Why the file could not be read, nil when it was hashed
+}
+
+// Filename returns the manifest name of algorithm, such as SHA256SUMS.
+func Filename(algorithm string) string {
+	return filenames[algorithm]
+}
+
+// ParseAlgorithms parses a comma-separated list of algorithms, such as
+// "sha256,blake3".
+func ParseAlgorithms(list string) ([]string, error) {
+	var algorithms []string
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := filenames[name]; !ok {
+			return nil, errors.NewValidationError("checksums",
+				fmt.Sprintf("unsupported algorithm %q (supported: %s)", name, strings.Join(Algorithms, ", ")))
+		}
+
+		algorithms = append(algorithms, name)
+	}
+
+	return algorithms, nil
+}
+
+// DetectAlgorithm guesses the algorithm of the manifest at path from its
+// name: BLAKE3SUMS, B3SUMS and names containing "blake3" or "b3" are BLAKE3,
+// anything else SHA-256. Both have 64 hex digit digests, so the content does
+// not tell them apart.
+func DetectAlgorithm(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	if strings.Contains(name, "blake3") || strings.HasPrefix(name, "b3") {
+		return BLAKE3
+	}
+
+	return SHA256
+}
+
+// Create hashes files, given relative to dir, and writes their manifest to
+// dir under the algorithm's conventional name, replacing any earlier one. It
+// returns the manifest's path.
+func Create(dir string, files []string, algorithm string) (string, error) {
+	entries := make([]Entry, 0, len(files))
+
+	for _, file := range files {
+		digest, err := checksum.File(filepath.Join(dir, filepath.FromSlash(file)), algorithm)
+		if err != nil {
+			return "", errors.NewStorageError("hash file", err, file)
+		}
+
+		entries = append(entries, Entry{Digest: digest, Path: filepath.ToSlash(file)})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	path := filepath.Join(dir, Filename(algorithm))
+
+	tmp, err := os.CreateTemp(dir, "."+Filename(algorithm)+".tmp-*")
+	if err != nil {
+		return "", errors.NewStorageError("create manifest", err, path)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	err = Write(tmp, entries)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return "", errors.NewStorageError("write manifest", err, path)
+	}
+
+	return path, nil
+}
+
+// Write writes entries as manifest lines. A path with a backslash or newline
+// is escaped and its line marked with a leading backslash, as sha256sum does.
+func Write(w io.Writer, entries []Entry) error {
+	buffered := bufio.NewWriter(w)
+
+	for _, entry := range entries {
+		path := entry.Path
+		prefix := ""
+
+		if strings.ContainsAny(path, "\\\n\r") {
+			prefix = "\\"
+			path = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r").Replace(path)
+		}
+
+		if _, err := fmt.Fprintf(buffered, "%s%s  %s\n", prefix, entry.Digest, path); err != nil {
+			return err
+		}
+	}
+
+	return buffered.Flush()
+}
+
+// Parse reads manifest lines: "<digest>  <path>", or "<digest> *<path>" for
+// files hashed in binary mode. Blank lines and lines starting with # are
+// skipped.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		escaped := strings.HasPrefix(text, "\\")
+		text = strings.TrimPrefix(text, "\\")
+
+		digest, path, ok := strings.Cut(text, " ")
+		if !ok || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+			return nil, errors.NewValidationError("manifest", fmt.Sprintf("line %d is not \"<digest>  <path>\"", line))
+		}
+		path = path[1:]
+
+		if _, err := hex.DecodeString(digest); err != nil {
+			return nil, errors.NewValidationError("manifest", fmt.Sprintf("line %d has an invalid digest", line))
+		}
+
+		if escaped {
+			path = strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r").Replace(path)
+		}
+
+		entries = append(entries, Entry{Digest: strings.ToLower(digest), Path: path})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Verify hashes the file of each entry, relative to dir, and compares it
+// with the entry's digest.
+func Verify(dir string, entries []Entry, algorithm string) []Result {
+	results := make([]Result, len(entries))
+
+	for i, entry := range entries {
+		path := entry.Path
+		if !filepath.IsAbs(filepath.FromSlash(path)) {
+			path = filepath.Join(dir, filepath.FromSlash(path))
+		}
+
+		digest, err := checksum.File(path, algorithm)
+		results[i] = Result{Entry: entry, OK: err == nil && digest == entry.Digest, Err: err}
+	}
+
+	return results
+}
@@ -0,0 +1,129 @@
+package manifest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateAndVerify(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"a.txt":         "alpha",
+		"sub/b.txt":     "beta",
+		"sub/empty.bin": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			path, err := Create(dir, []string{"sub/b.txt", "a.txt", "sub/empty.bin"}, algorithm)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if filepath.Base(path) != Filename(algorithm) || DetectAlgorithm(path) != algorithm {
+				t.Errorf("manifest %s, detected as %s", path, DetectAlgorithm(path))
+			}
+
+			data, _ := os.ReadFile(path) // #nosec G304 -- test file
+			entries, err := Parse(bytes.NewReader(data))
+			if err != nil || len(entries) != 3 || entries[0].Path != "a.txt" || entries[2].Path != "sub/empty.bin" {
+				t.Fatalf("Parse() = %+v, %v", entries, err)
+			}
+
+			for _, result := range Verify(dir, entries, algorithm) {
+				if !result.OK {
+					t.Errorf("%s failed: %v", result.Path, result.Err)
+				}
+			}
+		})
+	}
+
+	// The empty file's digests are the published ones
+	entries, _ := Parse(strings.NewReader(
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  sub/empty.bin\n"))
+	if results := Verify(dir, entries, SHA256); !results[0].OK {
+		t.Error("SHA-256 of the empty file differs")
+	}
+	entries, _ = Parse(strings.NewReader(
+		"af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262  sub/empty.bin\n"))
+	if results := Verify(dir, entries, BLAKE3); !results[0].OK {
+		t.Error("BLAKE3 of the empty file differs")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	entries = []Entry{{Digest: strings.Repeat("0", 64), Path: "a.txt"}, {Digest: strings.Repeat("0", 64), Path: "gone.txt"}}
+	results := Verify(dir, entries, SHA256)
+	if results[0].OK || results[0].Err != nil {
+		t.Errorf("changed file: %+v", results[0])
+	}
+	if results[1].OK || !os.IsNotExist(results[1].Err) {
+		t.Errorf("missing file: %+v", results[1])
+	}
+}
+
+func TestParse(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []Entry
+		wantErr bool
+	}{
+		{"text mode", digest + "  dir/file.iso\n", []Entry{{digest, "dir/file.iso"}}, false},
+		{"binary mode", strings.ToUpper(digest) + " *file.iso\n", []Entry{{digest, "file.iso"}}, false},
+		{"comments and blank lines", "# generated\n\n" + digest + "  a b.txt\r\n", []Entry{{digest, "a b.txt"}}, false},
+		{"escaped", "\\" + digest + "  new\\nline\\\\name\n", []Entry{{digest, "new\nline\\name"}}, false},
+		{"one space", digest + " file.iso\n", nil, true},
+		{"not hex", "xyz  file.iso\n", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("Parse() = %+v, want %+v", entries, tt.want)
+			}
+			for i := range entries {
+				if entries[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, entries[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Escaped names survive a round trip
+	var buf bytes.Buffer
+	if err := Write(&buf, []Entry{{digest, "new\nline\\name"}}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := Parse(&buf); err != nil || entries[0].Path != "new\nline\\name" {
+		t.Errorf("round trip = %+v, %v", entries, err)
+	}
+}
+
+func TestParseAlgorithms(t *testing.T) {
+	if got, err := ParseAlgorithms("SHA256, blake3"); err != nil || len(got) != 2 || got[1] != BLAKE3 {
+		t.Errorf("ParseAlgorithms() = %v, %v", got, err)
+	}
+	if _, err := ParseAlgorithms("md5"); err == nil {
+		t.Error("ParseAlgorithms(md5) should fail")
+	}
+}
@@ -0,0 +1,181 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+const (
+	// DefaultCircuitFailureThreshold is the number of consecutive failures
+	// after which a host's circuit opens.
+	DefaultCircuitFailureThreshold = 5
+
+	// DefaultCircuitCooldown is how long a host's circuit stays open before
+	// a single probe request is let through.
+	DefaultCircuitCooldown = 30 * time.Second
+)
+
+// hostCircuit is the breaker state of a single host.
+type hostCircuit struct {
+	state    gdlerrors.CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// HostCircuitBreaker tracks consecutive failures per host and rejects requests
+// to hosts that keep failing, so batch downloads stop hammering them.
+//
+// A host's circuit opens after the configured number of consecutive host failures.
+// While open, Allow fails fast with a CodeCircuitOpen error. Once the cool-down
+// has passed the circuit becomes half-open and a single probe request is let
+// through; its outcome closes the circuit again or re-opens it.
+type HostCircuitBreaker struct {
+	mu        sync.Mutex
+	hosts     map[string]*hostCircuit
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+// NewHostCircuitBreaker creates a new per-host circuit breaker. Non-positive
+// values fall back to the defaults.
+func NewHostCircuitBreaker(threshold int, cooldown time.Duration) *HostCircuitBreaker {
+	cb := &HostCircuitBreaker{
+		hosts: make(map[string]*hostCircuit),
+		now:   time.Now,
+	}
+	cb.Configure(threshold, cooldown)
+
+	return cb
+}
+
+// Configure updates the failure threshold and cool-down. Existing host state is kept.
+func (cb *HostCircuitBreaker) Configure(threshold int, cooldown time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if threshold <= 0 {
+		threshold = DefaultCircuitFailureThreshold
+	}
+
+	if cooldown <= 0 {
+		cooldown = DefaultCircuitCooldown
+	}
+
+	cb.threshold = threshold
+	cb.cooldown = cooldown
+}
+
+// Allow reports whether a request to host may be made. It returns a
+// DownloadError with CodeCircuitOpen when the host's circuit is open or a
+// recovery probe is already in flight.
+func (cb *HostCircuitBreaker) Allow(host string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	circuit, exists := cb.hosts[host]
+	if !exists {
+		return nil
+	}
+
+	switch circuit.state {
+	case gdlerrors.CircuitOpen:
+		remaining := cb.cooldown - cb.now().Sub(circuit.openedAt)
+		if remaining > 0 {
+			return cb.openError(host, remaining)
+		}
+
+		circuit.state = gdlerrors.CircuitHalfOpen
+		circuit.probing = true
+
+		return nil
+	case gdlerrors.CircuitHalfOpen:
+		if circuit.probing {
+			return cb.openError(host, 0)
+		}
+
+		circuit.probing = true
+
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a request to host. A nil error closes the
+// circuit. Retryable errors (network failures, timeouts, 5xx and 429
+// responses) count as host failures; other errors mean the host answered and
+// only end a recovery probe. Cancellation leaves the state untouched.
+func (cb *HostCircuitBreaker) Record(host string, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	circuit, exists := cb.hosts[host]
+
+	switch {
+	case err == nil:
+		if exists {
+			delete(cb.hosts, host)
+		}
+	case errors.Is(err, context.Canceled) || errors.Is(err, gdlerrors.ErrCircuitOpen):
+		if exists {
+			circuit.probing = false
+		}
+	case gdlerrors.IsRetryable(err):
+		if !exists {
+			circuit = &hostCircuit{state: gdlerrors.CircuitClosed}
+			cb.hosts[host] = circuit
+		}
+
+		circuit.failures++
+		circuit.probing = false
+
+		if circuit.state == gdlerrors.CircuitHalfOpen || circuit.failures >= cb.threshold {
+			circuit.state = gdlerrors.CircuitOpen
+			circuit.openedAt = cb.now()
+		}
+	default:
+		if exists {
+			delete(cb.hosts, host)
+		}
+	}
+}
+
+// State returns the current circuit state of host.
+func (cb *HostCircuitBreaker) State(host string) gdlerrors.CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if circuit, exists := cb.hosts[host]; exists {
+		return circuit.state
+	}
+
+	return gdlerrors.CircuitClosed
+}
+
+// Reset closes the circuits of all hosts.
+func (cb *HostCircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.hosts = make(map[string]*hostCircuit)
+}
+
+// openError builds the fail-fast error (must be called with lock held).
+func (cb *HostCircuitBreaker) openError(host string, retryIn time.Duration) error {
+	return &gdlerrors.DownloadError{
+		Code:    gdlerrors.CodeCircuitOpen,
+		Message: fmt.Sprintf("Circuit breaker open for host %s", host),
+		Details: fmt.Sprintf(
+			"%d consecutive failures; requests are rejected for %v",
+			cb.hosts[host].failures, cb.cooldown,
+		),
+		RetryAfter: retryIn,
+	}
+}
@@ -0,0 +1,127 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*HostCircuitBreaker, *time.Time) {
+	now := time.Unix(0, 0)
+	cb := NewHostCircuitBreaker(threshold, cooldown)
+	cb.now = func() time.Time { return now }
+
+	return cb, &now
+}
+
+func TestHostCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	cb, _ := newTestBreaker(3, time.Minute)
+	serverErr := gdlerrors.FromHTTPStatus(503, "https://example.com/f")
+
+	for i := 0; i < 2; i++ {
+		if err := cb.Allow("example.com"); err != nil {
+			t.Fatalf("Allow() before threshold error = %v", err)
+		}
+
+		cb.Record("example.com", serverErr)
+	}
+
+	if state := cb.State("example.com"); state != gdlerrors.CircuitClosed {
+		t.Errorf("State() = %v, want closed below threshold", state)
+	}
+
+	cb.Record("example.com", serverErr)
+
+	if state := cb.State("example.com"); state != gdlerrors.CircuitOpen {
+		t.Fatalf("State() = %v, want open", state)
+	}
+
+	err := cb.Allow("example.com")
+	if !errors.Is(err, gdlerrors.ErrCircuitOpen) {
+		t.Fatalf("Allow() error = %v, want ErrCircuitOpen", err)
+	}
+
+	if gdlerrors.GetErrorCode(err) != gdlerrors.CodeCircuitOpen {
+		t.Errorf("error code = %v, want circuit_open", gdlerrors.GetErrorCode(err))
+	}
+
+	if gdlerrors.IsRetryable(err) {
+		t.Error("circuit open error should not be retryable")
+	}
+
+	if err := cb.Allow("other.com"); err != nil {
+		t.Errorf("Allow() for another host error = %v", err)
+	}
+}
+
+func TestHostCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	cb, now := newTestBreaker(1, time.Minute)
+	cb.Record("example.com", gdlerrors.FromHTTPStatus(500, ""))
+
+	*now = now.Add(time.Minute)
+
+	if err := cb.Allow("example.com"); err != nil {
+		t.Fatalf("Allow() after cool-down error = %v", err)
+	}
+
+	if state := cb.State("example.com"); state != gdlerrors.CircuitHalfOpen {
+		t.Fatalf("State() = %v, want half-open", state)
+	}
+
+	if err := cb.Allow("example.com"); err == nil {
+		t.Error("Allow() should reject a second request while the probe is in flight")
+	}
+
+	// A failed probe re-opens the circuit for another cool-down
+	cb.Record("example.com", gdlerrors.FromHTTPStatus(500, ""))
+
+	if err := cb.Allow("example.com"); err == nil {
+		t.Error("Allow() should fail after a failed probe")
+	}
+
+	*now = now.Add(time.Minute)
+
+	if err := cb.Allow("example.com"); err != nil {
+		t.Fatalf("Allow() after second cool-down error = %v", err)
+	}
+
+	cb.Record("example.com", nil)
+
+	if state := cb.State("example.com"); state != gdlerrors.CircuitClosed {
+		t.Errorf("State() = %v, want closed after a successful probe", state)
+	}
+}
+
+func TestHostCircuitBreaker_IgnoresNonHostFailures(t *testing.T) {
+	cb, _ := newTestBreaker(1, time.Minute)
+
+	cb.Record("example.com", gdlerrors.FromHTTPStatus(404, ""))
+	cb.Record("example.com", context.Canceled)
+
+	if state := cb.State("example.com"); state != gdlerrors.CircuitClosed {
+		t.Errorf("State() = %v, want closed for non-host failures", state)
+	}
+}
+
+func TestHostCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	cb, _ := newTestBreaker(2, time.Minute)
+	serverErr := gdlerrors.FromHTTPStatus(502, "")
+
+	cb.Record("example.com", serverErr)
+	cb.Record("example.com", nil)
+	cb.Record("example.com", serverErr)
+
+	if state := cb.State("example.com"); state != gdlerrors.CircuitClosed {
+		t.Errorf("State() = %v, want closed since failures were not consecutive", state)
+	}
+
+	cb.Record("example.com", serverErr)
+	cb.Reset()
+
+	if state := cb.State("example.com"); state != gdlerrors.CircuitClosed {
+		t.Errorf("State() after Reset() = %v, want closed", state)
+	}
+}
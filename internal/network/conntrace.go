@@ -0,0 +1,72 @@
+package network
+
+import (
+	"context"
+	"net"
+	"net/http/httptrace"
+	"sync"
+)
+
+// TraceConnection returns a context that records the connections of the
+// requests made with it. The returned function reports the IP address of the
+// remote end of the latest connection (the proxy's when a proxy is used), or
+// an empty string until a connection has been obtained.
+func TraceConnection(ctx context.Context) (context.Context, func() string) {
+	var (
+		mu sync.Mutex
+		ip string
+	)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn == nil {
+				return
+			}
+
+			addr := info.Conn.RemoteAddr().String()
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				addr = host
+			}
+
+			mu.Lock()
+			ip = addr
+			mu.Unlock()
+		},
+	}
+
+	return httptrace.WithClientTrace(ctx, trace), func() string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return ip
+	}
+}
+
+// QuarantineConnection returns a context that records the connections of the
+// requests made with it, and a function closing the latest one. A connection
+// that served a bad response, such as a CDN node answering range requests
+// with the whole file, is closed so the transport never reuses it; the next
+// request opens a fresh one.
+func QuarantineConnection(ctx context.Context) (context.Context, func()) {
+	var (
+		mu   sync.Mutex
+		conn net.Conn
+	)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			conn = info.Conn
+			mu.Unlock()
+		},
+	}
+
+	return httptrace.WithClientTrace(ctx, trace), func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+}
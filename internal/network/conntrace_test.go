@@ -0,0 +1,83 @@
+package network
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTraceConnection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	ctx, serverIP := TraceConnection(context.Background())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := serverIP(); got != "" {
+		t.Errorf("serverIP() before the request = %q, want empty", got)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if got := serverIP(); got != "127.0.0.1" {
+		t.Errorf("serverIP() = %q, want 127.0.0.1", got)
+	}
+}
+
+func TestQuarantineConnection(t *testing.T) {
+	var conns atomic.Int32
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+
+	get := func(ctx context.Context) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	ctx, quarantine := QuarantineConnection(context.Background())
+	get(ctx)
+	get(context.Background())
+
+	if got := conns.Load(); got != 1 {
+		t.Fatalf("connections before quarantine = %d, want 1 reused", got)
+	}
+
+	quarantine()
+	get(context.Background())
+
+	if got := conns.Load(); got != 2 {
+		t.Errorf("connections after quarantine = %d, want a fresh one", got)
+	}
+}
@@ -0,0 +1,319 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// IPVersion restricts which address family is used for connections.
+type IPVersion int
+
+const (
+	// IPAny uses both IPv4 and IPv6 with happy-eyeballs fallback.
+	IPAny IPVersion = iota
+	// IPv4Only connects over IPv4 only.
+	IPv4Only
+	// IPv6Only connects over IPv6 only.
+	IPv6Only
+)
+
+// dohContentType is the media type for RFC 8484 DNS-over-HTTPS messages.
+const dohContentType = "application/dns-message"
+
+// DNSConfig controls how host names are resolved when dialing.
+type DNSConfig struct {
+	// Servers are DNS servers (host or host:port) used instead of the system resolver
+	Servers []string
+
+	// DoHURL is a DNS-over-HTTPS endpoint (RFC 8484); it takes precedence over Servers
+	DoHURL string
+
+	// IPVersion restricts connections to one address family
+	IPVersion IPVersion
+
+	// StaticHosts maps "host:port" to a fixed address, like curl's --resolve
+	StaticHosts map[string]string
+}
+
+// IsZero reports whether the configuration keeps the default system behavior.
+func (c DNSConfig) IsZero() bool {
+	return len(c.Servers) == 0 && c.DoHURL == "" && c.IPVersion == IPAny && len(c.StaticHosts) == 0
+}
+
+// ParseResolveEntry parses a curl-style "host:port:address" entry into its
+// "host:port" key and address. IPv6 addresses may be given in brackets.
+func ParseResolveEntry(entry string) (string, string, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", gdlerrors.NewValidationError("resolve",
+			fmt.Sprintf("expected host:port:address, got %q", entry))
+	}
+
+	address := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+	if net.ParseIP(address) == nil {
+		return "", "", gdlerrors.NewValidationError("resolve",
+			fmt.Sprintf("invalid IP address %q", parts[2]))
+	}
+
+	return net.JoinHostPort(parts[0], parts[1]), address, nil
+}
+
+// Dialer establishes connections using the DNS controls of a DNSConfig.
+type Dialer struct {
+	config DNSConfig
+	dialer *net.Dialer
+	doh    *DoHResolver
+}
+
+// NewDialer creates a dialer applying the given DNS configuration.
+func NewDialer(config DNSConfig, timeout, keepAlive time.Duration) *Dialer {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: keepAlive,
+	}
+
+	if len(config.Servers) > 0 {
+		dialer.Resolver = newServerResolver(config.Servers, timeout)
+	}
+
+	d := &Dialer{config: config, dialer: dialer}
+	if config.DoHURL != "" {
+		d.doh = NewDoHResolver(config.DoHURL)
+	}
+
+	return d
+}
+
+// DialContext connects to the address, honoring static hosts, custom resolvers
+// and the address family preference.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	network = d.network(network)
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	if static, exists := d.config.StaticHosts[address]; exists {
+		return d.dialer.DialContext(ctx, network, net.JoinHostPort(static, port))
+	}
+
+	if d.doh == nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	ips, err := d.doh.LookupIP(ctx, host, d.config.IPVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+
+	for _, ip := range ips {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// network narrows a generic network name to the preferred address family.
+func (d *Dialer) network(network string) string {
+	if network != "tcp" {
+		return network
+	}
+
+	switch d.config.IPVersion {
+	case IPv4Only:
+		return "tcp4"
+	case IPv6Only:
+		return "tcp6"
+	default:
+		return network
+	}
+}
+
+// newServerResolver returns a resolver that queries the given DNS servers in order.
+func newServerResolver(servers []string, timeout time.Duration) *net.Resolver {
+	addresses := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+
+		addresses = append(addresses, server)
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: timeout}
+
+			var lastErr error
+
+			for _, address := range addresses {
+				conn, err := dialer.DialContext(ctx, network, address)
+				if err == nil {
+					return conn, nil
+				}
+
+				lastErr = err
+			}
+
+			return nil, lastErr
+		},
+	}
+}
+
+// DoHResolver resolves host names through a DNS-over-HTTPS endpoint (RFC 8484).
+type DoHResolver struct {
+	url    string
+	client *http.Client
+}
+
+// NewDoHResolver creates a resolver for the given DNS-over-HTTPS endpoint.
+func NewDoHResolver(url string) *DoHResolver {
+	return &DoHResolver{
+		url:    url,
+		client: &http.Client{Timeout: DefaultDNSTimeout},
+	}
+}
+
+// LookupIP resolves host to its addresses. With IPAny, IPv6 and IPv4 addresses
+// are interleaved so that a broken family falls back quickly to the other one.
+func (r *DoHResolver) LookupIP(ctx context.Context, host string, version IPVersion) ([]net.IP, error) {
+	var ipv4, ipv6 []net.IP
+
+	var lastErr error
+
+	if version != IPv6Only {
+		ips, err := r.query(ctx, host, dnsmessage.TypeA)
+		if err != nil {
+			lastErr = err
+		}
+
+		ipv4 = ips
+	}
+
+	if version != IPv4Only {
+		ips, err := r.query(ctx, host, dnsmessage.TypeAAAA)
+		if err != nil {
+			lastErr = err
+		}
+
+		ipv6 = ips
+	}
+
+	ips := interleaveIPs(ipv6, ipv4)
+	if len(ips) == 0 {
+		if lastErr == nil {
+			lastErr = gdlerrors.NewDownloadError(gdlerrors.CodeNetworkError,
+				fmt.Sprintf("DNS-over-HTTPS lookup returned no addresses for %s", host))
+		}
+
+		return nil, lastErr
+	}
+
+	return ips, nil
+}
+
+// query sends a single DNS question and returns the addresses in the answer.
+func (r *DoHResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]net.IP, error) {
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeInvalidURL, "invalid host name for DNS lookup")
+	}
+
+	// RFC 8484 recommends an ID of 0 for cache friendliness
+	message := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+
+	packed, err := message.Pack()
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeNetworkError, "failed to build DNS query")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeConfigError, "invalid DNS-over-HTTPS URL")
+	}
+
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeNetworkError, "DNS-over-HTTPS request failed")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, gdlerrors.NewDownloadError(gdlerrors.CodeNetworkError,
+			fmt.Sprintf("DNS-over-HTTPS server returned HTTP %d", resp.StatusCode))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeNetworkError, "failed to read DNS-over-HTTPS response")
+	}
+
+	var reply dnsmessage.Message
+	if err := reply.Unpack(body); err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeNetworkError, "invalid DNS-over-HTTPS response")
+	}
+
+	var ips []net.IP
+
+	for _, answer := range reply.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		}
+	}
+
+	return ips, nil
+}
+
+// dnsName returns host as a fully qualified domain name.
+func dnsName(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+
+	return host + "."
+}
+
+// interleaveIPs alternates between the preferred and fallback address lists.
+func interleaveIPs(preferred, fallback []net.IP) []net.IP {
+	ips := make([]net.IP, 0, len(preferred)+len(fallback))
+
+	for i := 0; i < len(preferred) || i < len(fallback); i++ {
+		if i < len(preferred) {
+			ips = append(ips, preferred[i])
+		}
+
+		if i < len(fallback) {
+			ips = append(ips, fallback[i])
+		}
+	}
+
+	return ips
+}
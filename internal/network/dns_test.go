@@ -0,0 +1,180 @@
+package network
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseResolveEntry(t *testing.T) {
+	tests := []struct {
+		entry    string
+		wantKey  string
+		wantAddr string
+		wantErr  bool
+	}{
+		{"example.com:443:127.0.0.1", "example.com:443", "127.0.0.1", false},
+		{"example.com:80:[::1]", "example.com:80", "::1", false},
+		{"example.com:80:::1", "example.com:80", "::1", false},
+		{"example.com:443", "", "", true},
+		{"example.com:443:not-an-ip", "", "", true},
+		{":443:127.0.0.1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			key, addr, err := ParseResolveEntry(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseResolveEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if key != tt.wantKey || addr != tt.wantAddr {
+				t.Errorf("ParseResolveEntry() = %q, %q, want %q, %q", key, addr, tt.wantKey, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestDialer_StaticHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	_, port, _ := net.SplitHostPort(serverURL.Host)
+
+	config := DNSConfig{
+		StaticHosts: map[string]string{net.JoinHostPort("gdl.invalid", port): "127.0.0.1"},
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: NewDialer(config, 5*time.Second, 0).DialContext,
+	}}
+
+	resp, err := client.Get("http://" + net.JoinHostPort("gdl.invalid", port) + "/")
+	if err != nil {
+		t.Fatalf("Get() through static host error = %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Errorf("body = %q, want %q", body, "ok")
+	}
+}
+
+func TestDialer_Network(t *testing.T) {
+	tests := []struct {
+		version IPVersion
+		network string
+		want    string
+	}{
+		{IPAny, "tcp", "tcp"},
+		{IPv4Only, "tcp", "tcp4"},
+		{IPv6Only, "tcp", "tcp6"},
+		{IPv4Only, "udp", "udp"},
+	}
+
+	for _, tt := range tests {
+		d := NewDialer(DNSConfig{IPVersion: tt.version}, time.Second, 0)
+		if got := d.network(tt.network); got != tt.want {
+			t.Errorf("network(%q) with version %d = %q, want %q", tt.network, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestDoHResolver_LookupIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		var query dnsmessage.Message
+		if err := query.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		question := query.Questions[0]
+		reply := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true},
+			Questions: query.Questions,
+		}
+
+		header := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}
+
+		switch question.Type {
+		case dnsmessage.TypeA:
+			reply.Answers = append(reply.Answers,
+				dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}})
+		case dnsmessage.TypeAAAA:
+			reply.Answers = append(reply.Answers,
+				dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}})
+		}
+
+		packed, _ := reply.Pack()
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(packed)
+	}))
+	defer server.Close()
+
+	resolver := NewDoHResolver(server.URL)
+
+	ips, err := resolver.LookupIP(context.Background(), "example.com", IPAny)
+	if err != nil {
+		t.Fatalf("LookupIP() error = %v", err)
+	}
+
+	if len(ips) != 2 || ips[0].String() != "2001:db8::1" || ips[1].String() != "192.0.2.1" {
+		t.Errorf("LookupIP() = %v, want [2001:db8::1 192.0.2.1]", ips)
+	}
+
+	ips, err = resolver.LookupIP(context.Background(), "example.com", IPv4Only)
+	if err != nil {
+		t.Fatalf("LookupIP(IPv4Only) error = %v", err)
+	}
+
+	if len(ips) != 1 || ips[0].String() != "192.0.2.1" {
+		t.Errorf("LookupIP(IPv4Only) = %v, want [192.0.2.1]", ips)
+	}
+}
+
+func TestDoHResolver_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if _, err := NewDoHResolver(server.URL).LookupIP(context.Background(), "example.com", IPAny); err == nil {
+		t.Error("LookupIP() should fail when the DoH server returns an error")
+	}
+}
+
+func TestInterleaveIPs(t *testing.T) {
+	preferred := []net.IP{net.ParseIP("::1"), net.ParseIP("::2"), net.ParseIP("::3")}
+	fallback := []net.IP{net.ParseIP("10.0.0.1")}
+
+	got := interleaveIPs(preferred, fallback)
+	want := []string{"::1", "10.0.0.1", "::2", "::3"}
+
+	if len(got) != len(want) {
+		t.Fatalf("interleaveIPs() = %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("interleaveIPs()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
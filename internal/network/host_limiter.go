@@ -0,0 +1,171 @@
+package network
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// hostSlot is the limiter state of a single host.
+type hostSlot struct {
+	active  int
+	next    time.Time
+	changed chan struct{}
+}
+
+// HostLimiter caps the requests in flight to each host and spaces out their
+// starts, so large batches stay under server-side rate limits.
+//
+// A request holds its host's slot until its response body is closed, so
+// chunk workers and batch jobs sharing a limiter count against the same cap.
+type HostLimiter struct {
+	mu       sync.Mutex
+	hosts    map[string]*hostSlot
+	maxConns int
+	delay    time.Duration
+}
+
+// NewHostLimiter creates a limiter allowing maxConnections requests in flight
+// per host (0 = unlimited), started at least delay apart.
+func NewHostLimiter(maxConnections int, delay time.Duration) *HostLimiter {
+	hl := &HostLimiter{hosts: make(map[string]*hostSlot)}
+	hl.Configure(maxConnections, delay)
+
+	return hl
+}
+
+// Configure updates the connection cap and delay. Requests in flight keep
+// their slots.
+func (hl *HostLimiter) Configure(maxConnections int, delay time.Duration) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	hl.maxConns = max(maxConnections, 0)
+	hl.delay = max(delay, 0)
+
+	for _, slot := range hl.hosts {
+		slot.notify()
+	}
+}
+
+// Acquire waits until a request to host may start and returns the function
+// releasing its slot. It fails only when ctx is done first.
+func (hl *HostLimiter) Acquire(ctx context.Context, host string) (func(), error) {
+	hl.mu.Lock()
+
+	slot := hl.slot(host)
+	for hl.maxConns > 0 && slot.active >= hl.maxConns {
+		changed := slot.changed
+		hl.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+
+		hl.mu.Lock()
+		slot = hl.slot(host)
+	}
+
+	// Reserve the next start time before sleeping, so concurrent requests
+	// queue up one delay apart
+	start := time.Now()
+	if slot.next.After(start) {
+		start = slot.next
+	}
+
+	slot.next = start.Add(hl.delay)
+	slot.active++
+	hl.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			hl.mu.Lock()
+			defer hl.mu.Unlock()
+
+			slot.active--
+			slot.notify()
+
+			if slot.active == 0 && !slot.next.After(time.Now()) {
+				delete(hl.hosts, host)
+			}
+		})
+	}
+
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return release, nil
+}
+
+// Transport wraps rt so each request holds a slot of its host until the
+// response body is closed.
+func (hl *HostLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
+	return &hostLimitTransport{limiter: hl, next: rt}
+}
+
+// slot returns the state of host, creating it (must be called with lock held).
+func (hl *HostLimiter) slot(host string) *hostSlot {
+	slot, exists := hl.hosts[host]
+	if !exists {
+		slot = &hostSlot{changed: make(chan struct{})}
+		hl.hosts[host] = slot
+	}
+
+	return slot
+}
+
+// notify wakes the requests waiting for the host (must be called with lock held).
+func (slot *hostSlot) notify() {
+	close(slot.changed)
+	slot.changed = make(chan struct{})
+}
+
+// hostLimitTransport applies a HostLimiter to every request.
+type hostLimitTransport struct {
+	limiter *HostLimiter
+	next    http.RoundTripper
+}
+
+func (t *hostLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.Acquire(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+
+	return resp, nil
+}
+
+// releasingBody releases the request's host slot when it is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+
+	return err
+}
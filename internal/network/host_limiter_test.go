@@ -0,0 +1,150 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter_MaxConnections(t *testing.T) {
+	hl := NewHostLimiter(2, 0)
+
+	first, err := hl.Acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	if _, err := hl.Acquire(context.Background(), "example.com"); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	if release, err := hl.Acquire(context.Background(), "other.com"); err != nil {
+		t.Fatalf("Acquire() for another host error = %v", err)
+	} else {
+		release()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := hl.Acquire(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() over the cap error = %v, want deadline exceeded", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		if release, err := hl.Acquire(context.Background(), "example.com"); err == nil {
+			release()
+		}
+		close(acquired)
+	}()
+
+	first()
+	first() // Releasing twice frees one slot only
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire() still blocked after a slot was released")
+	}
+}
+
+func TestHostLimiter_Delay(t *testing.T) {
+	const delay = 30 * time.Millisecond
+
+	hl := NewHostLimiter(0, delay)
+
+	var wg sync.WaitGroup
+	starts := make([]time.Time, 3)
+
+	begin := time.Now()
+	for i := range starts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release, err := hl.Acquire(context.Background(), "example.com")
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			defer release()
+
+			starts[i] = time.Now()
+		}()
+	}
+	wg.Wait()
+
+	var last time.Time
+	for _, start := range starts {
+		if start.After(last) {
+			last = start
+		}
+	}
+
+	if elapsed := last.Sub(begin); elapsed < 2*delay {
+		t.Errorf("three requests started within %v, want at least %v", elapsed, 2*delay)
+	}
+
+	// Another host is not delayed
+	begin = time.Now()
+	release, err := hl.Acquire(context.Background(), "other.com")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	release()
+
+	if elapsed := time.Since(begin); elapsed >= delay {
+		t.Errorf("first request to another host waited %v", elapsed)
+	}
+}
+
+func TestHostLimiter_Transport(t *testing.T) {
+	var active, peak atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewHostLimiter(2, 0).Transport(http.DefaultTransport)}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+				return
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			_, _ = io.Copy(io.Discard, resp.Body)
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 2 {
+		t.Errorf("server saw %d requests at once, want at most 2", got)
+	}
+}
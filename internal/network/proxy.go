@@ -0,0 +1,129 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// ProxyConfig selects the proxy used for each request. HTTP(S) and SOCKS5
+// proxies are supported; a socks5h:// URL resolves host names on the proxy.
+type ProxyConfig struct {
+	// URL is the proxy used for every scheme without a more specific proxy
+	URL string
+
+	// HTTPURL is the proxy used for http:// requests
+	HTTPURL string
+
+	// HTTPSURL is the proxy used for https:// requests
+	HTTPSURL string
+
+	// NoProxy lists hosts, domains (".example.com"), IPs and CIDR ranges that are
+	// connected to directly, using the NO_PROXY syntax. "*" disables the proxy.
+	NoProxy []string
+
+	// Username and Password authenticate with the proxy, unless the proxy URL
+	// already carries credentials
+	Username string
+	Password string
+}
+
+// IsZero reports whether no proxy is configured, in which case the proxy
+// environment variables apply.
+func (c ProxyConfig) IsZero() bool {
+	return c.URL == "" && c.HTTPURL == "" && c.HTTPSURL == "" && len(c.NoProxy) == 0 &&
+		c.Username == "" && c.Password == ""
+}
+
+// Validate checks that all proxy URLs are well formed and use a supported scheme.
+func (c ProxyConfig) Validate() error {
+	for _, raw := range []string{c.URL, c.HTTPURL, c.HTTPSURL} {
+		if raw == "" {
+			continue
+		}
+
+		if _, err := ParseProxyURL(raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseProxyURL parses a proxy URL. A missing scheme defaults to http.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	proxyURL, err := url.Parse(raw)
+	if err != nil || proxyURL.Host == "" {
+		return nil, gdlerrors.NewValidationError("proxy", fmt.Sprintf("invalid proxy URL %q", raw))
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return proxyURL, nil
+	default:
+		return nil, gdlerrors.NewValidationError("proxy",
+			fmt.Sprintf("unsupported proxy scheme %q (use http, https, socks5 or socks5h)", proxyURL.Scheme))
+	}
+}
+
+// ProxyFunc returns the proxy selection function for http.Transport.Proxy.
+// Without any configuration the standard proxy environment variables are used.
+func (c ProxyConfig) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	if c.IsZero() {
+		return http.ProxyFromEnvironment
+	}
+
+	config := httpproxy.Config{
+		HTTPProxy:  firstNonEmpty(c.HTTPURL, c.URL),
+		HTTPSProxy: firstNonEmpty(c.HTTPSURL, c.URL),
+		NoProxy:    strings.Join(c.NoProxy, ","),
+	}
+
+	// Credentials only, or NO_PROXY only: keep the proxies from the environment
+	if config.HTTPProxy == "" && config.HTTPSProxy == "" {
+		env := httpproxy.FromEnvironment()
+		config.HTTPProxy = env.HTTPProxy
+		config.HTTPSProxy = env.HTTPSProxy
+
+		if config.NoProxy == "" {
+			config.NoProxy = env.NoProxy
+		}
+	}
+
+	proxyFor := config.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxyFor(req.URL)
+		if err != nil {
+			return nil, gdlerrors.WrapError(err, gdlerrors.CodeConfigError, "invalid proxy configuration")
+		}
+
+		if proxyURL != nil && proxyURL.User == nil && c.Username != "" {
+			withAuth := *proxyURL
+			withAuth.User = url.UserPassword(c.Username, c.Password)
+			proxyURL = &withAuth
+		}
+
+		return proxyURL, nil
+	}
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,249 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransportConfig describes a pooled HTTP transport. Configurations with identical
+// settings share a single transport, so its idle connections and TLS sessions are
+// reused across downloaders, chunk workers and batch jobs.
+type TransportConfig struct {
+	// MaxIdleConns limits idle connections across all hosts
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost limits idle connections kept per host
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits total connections per host (0 = unlimited)
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection stays in the pool
+	IdleConnTimeout time.Duration
+
+	// KeepAlive is the TCP keep-alive probe interval
+	KeepAlive time.Duration
+
+	// DisableKeepAlives closes connections after each request
+	DisableKeepAlives bool
+
+	// DisableCompression disables transparent gzip, required for range and zero-copy downloads
+	DisableCompression bool
+
+	// TLSSessionCacheSize is the number of TLS sessions cached for resumption (0 = disabled)
+	TLSSessionCacheSize int
+
+	// DNS controls name resolution and the address family used when dialing
+	DNS DNSConfig
+
+	// Proxy selects the proxy per request (zero = proxy environment variables)
+	Proxy ProxyConfig
+
+	// TLS configures CA bundles, client certificates and public key pinning
+	TLS TLSConfig
+}
+
+// transportKey is the comparable identity of a TransportConfig. Slices and
+// maps are flattened into strings, in sorted order where order does not matter.
+type transportKey struct {
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	keepAlive           time.Duration
+	disableKeepAlives   bool
+	disableCompression  bool
+	tlsSessionCacheSize int
+
+	dnsServers     string
+	dohURL         string
+	ipVersion      IPVersion
+	staticHosts    string
+	proxyURL       string
+	proxyHTTPURL   string
+	proxyHTTPSURL  string
+	noProxy        string
+	proxyUsername  string
+	proxyPassword  string
+	caFile         string
+	certFile       string
+	keyFile        string
+	pinnedKeys     string
+	insecureVerify bool
+}
+
+// key returns the identity of the configuration.
+func (c TransportConfig) key() transportKey {
+	hosts := make([]string, 0, len(c.DNS.StaticHosts))
+	for host, address := range c.DNS.StaticHosts {
+		hosts = append(hosts, host+"="+address)
+	}
+
+	sort.Strings(hosts)
+
+	return transportKey{
+		maxIdleConns:        c.MaxIdleConns,
+		maxIdleConnsPerHost: c.MaxIdleConnsPerHost,
+		maxConnsPerHost:     c.MaxConnsPerHost,
+		idleConnTimeout:     c.IdleConnTimeout,
+		keepAlive:           c.KeepAlive,
+		disableKeepAlives:   c.DisableKeepAlives,
+		disableCompression:  c.DisableCompression,
+		tlsSessionCacheSize: c.TLSSessionCacheSize,
+
+		dnsServers:     strings.Join(c.DNS.Servers, "\x00"),
+		dohURL:         c.DNS.DoHURL,
+		ipVersion:      c.DNS.IPVersion,
+		staticHosts:    strings.Join(hosts, "\x00"),
+		proxyURL:       c.Proxy.URL,
+		proxyHTTPURL:   c.Proxy.HTTPURL,
+		proxyHTTPSURL:  c.Proxy.HTTPSURL,
+		noProxy:        strings.Join(c.Proxy.NoProxy, "\x00"),
+		proxyUsername:  c.Proxy.Username,
+		proxyPassword:  c.Proxy.Password,
+		caFile:         c.TLS.CAFile,
+		certFile:       c.TLS.CertFile,
+		keyFile:        c.TLS.KeyFile,
+		pinnedKeys:     strings.Join(c.TLS.PinnedPublicKeys, "\x00"),
+		insecureVerify: c.TLS.InsecureSkipVerify,
+	}
+}
+
+// DefaultTransportConfig returns the pooling settings used for file downloads.
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		MaxConnsPerHost:     30,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TLSSessionCacheSize: 64,
+	}
+}
+
+// maxSharedTransports bounds the number of cached transports. Beyond it the
+// least recently used one is dropped and its idle connections closed; clients
+// still holding it keep working, they just no longer share it.
+const maxSharedTransports = 32
+
+// sharedTransport is a cached transport and the sequence number of the call
+// that last handed it out.
+type sharedTransport struct {
+	transport *http.Transport
+	lastUsed  uint64
+}
+
+var (
+	sharedTransportsMu   sync.Mutex
+	sharedTransports     = make(map[transportKey]*sharedTransport)
+	sharedTransportsUses uint64
+)
+
+// SharedTransport returns the process-wide transport for the given configuration,
+// creating it on first use.
+func SharedTransport(config TransportConfig) *http.Transport {
+	sharedTransportsMu.Lock()
+	defer sharedTransportsMu.Unlock()
+
+	sharedTransportsUses++
+
+	key := config.key()
+	if shared, exists := sharedTransports[key]; exists {
+		shared.lastUsed = sharedTransportsUses
+		return shared.transport
+	}
+
+	if len(sharedTransports) >= maxSharedTransports {
+		evictSharedTransport()
+	}
+
+	transport := NewTransport(config)
+	sharedTransports[key] = &sharedTransport{transport: transport, lastUsed: sharedTransportsUses}
+
+	return transport
+}
+
+// evictSharedTransport drops the least recently used shared transport (must be
+// called with sharedTransportsMu held).
+func evictSharedTransport() {
+	var (
+		oldestKey transportKey
+		oldest    *sharedTransport
+	)
+
+	for key, shared := range sharedTransports {
+		if oldest == nil || shared.lastUsed < oldest.lastUsed {
+			oldestKey, oldest = key, shared
+		}
+	}
+
+	if oldest != nil {
+		delete(sharedTransports, oldestKey)
+		oldest.transport.CloseIdleConnections()
+	}
+}
+
+// CloseSharedTransports closes the idle connections of all shared transports.
+func CloseSharedTransports() {
+	sharedTransportsMu.Lock()
+	defer sharedTransportsMu.Unlock()
+
+	for _, shared := range sharedTransports {
+		shared.transport.CloseIdleConnections()
+	}
+}
+
+// NewTransport creates a new download-optimized transport with the given pooling settings.
+func NewTransport(config TransportConfig) *http.Transport {
+	transport := CreateOptimizedTransport()
+
+	transport.Proxy = config.Proxy.ProxyFunc()
+	transport.MaxIdleConns = config.MaxIdleConns
+	transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = config.MaxConnsPerHost
+	transport.IdleConnTimeout = config.IdleConnTimeout
+	transport.DisableKeepAlives = config.DisableKeepAlives
+	transport.DisableCompression = config.DisableCompression
+
+	keepAlive := config.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = 30 * time.Second
+	}
+
+	if !config.DNS.IsZero() {
+		transport.DialContext = NewDialer(config.DNS, 30*time.Second, keepAlive).DialContext
+	} else if config.KeepAlive != 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: keepAlive,
+		}).DialContext
+	}
+
+	if !config.TLS.IsZero() {
+		tlsConfig, err := config.TLS.Build()
+		if err != nil {
+			// Never fall back to default verification: fail every TLS connection instead
+			transport.DialTLSContext = func(context.Context, string, string) (net.Conn, error) {
+				return nil, err
+			}
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if config.TLSSessionCacheSize > 0 {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+
+		transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(config.TLSSessionCacheSize)
+	}
+
+	return transport
+}
@@ -0,0 +1,125 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSharedTransport_ReusedForEqualConfig(t *testing.T) {
+	config := DefaultTransportConfig()
+
+	first := SharedTransport(config)
+	second := SharedTransport(config)
+
+	if first != second {
+		t.Error("SharedTransport() should return the same transport for equal configurations")
+	}
+
+	config.MaxIdleConnsPerHost = 7
+
+	if SharedTransport(config) == first {
+		t.Error("SharedTransport() should return a different transport for a different configuration")
+	}
+}
+
+func TestNewTransport_AppliesConfig(t *testing.T) {
+	transport := NewTransport(TransportConfig{
+		MaxIdleConns:        50,
+		MaxIdleConnsPerHost: 10,
+		MaxConnsPerHost:     12,
+		IdleConnTimeout:     45 * time.Second,
+		KeepAlive:           15 * time.Second,
+		DisableCompression:  true,
+		TLSSessionCacheSize: 8,
+	})
+
+	if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 10 || transport.MaxConnsPerHost != 12 {
+		t.Errorf("pool limits = %d/%d/%d, want 50/10/12",
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+	}
+
+	if transport.IdleConnTimeout != 45*time.Second {
+		t.Errorf("IdleConnTimeout = %v, want 45s", transport.IdleConnTimeout)
+	}
+
+	if !transport.DisableCompression {
+		t.Error("DisableCompression should be set")
+	}
+
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.ClientSessionCache == nil {
+		t.Error("TLS session cache should be configured")
+	}
+
+	if transport.Proxy == nil {
+		t.Error("Proxy should default to the environment")
+	}
+}
+
+func TestNewTransport_WithoutSessionCache(t *testing.T) {
+	transport := NewTransport(TransportConfig{DisableKeepAlives: true})
+
+	if transport.TLSClientConfig != nil {
+		t.Error("TLSClientConfig should be left unset without a session cache")
+	}
+
+	if !transport.DisableKeepAlives {
+		t.Error("DisableKeepAlives should be set")
+	}
+
+	CloseSharedTransports()
+}
+
+func TestSharedTransport_KeyIgnoresStaticHostOrder(t *testing.T) {
+	first := DefaultTransportConfig()
+	first.DNS.StaticHosts = map[string]string{"a.example:443": "192.0.2.1", "b.example:443": "192.0.2.2"}
+
+	second := DefaultTransportConfig()
+	second.DNS.StaticHosts = map[string]string{"b.example:443": "192.0.2.2", "a.example:443": "192.0.2.1"}
+
+	if first.key() != second.key() {
+		t.Error("key() should not depend on map iteration order")
+	}
+
+	second.DNS.StaticHosts["b.example:443"] = "192.0.2.3"
+
+	if first.key() == second.key() {
+		t.Error("key() should differ for different static hosts")
+	}
+}
+
+func TestSharedTransport_EvictsLeastRecentlyUsed(t *testing.T) {
+	base := DefaultTransportConfig()
+	kept := SharedTransport(base)
+
+	for i := 1; i <= maxSharedTransports; i++ {
+		config := base
+		config.MaxConnsPerHost = 1000 + i
+		SharedTransport(config)
+
+		// Keep the base configuration in use so another one is evicted
+		SharedTransport(base)
+	}
+
+	sharedTransportsMu.Lock()
+	count := len(sharedTransports)
+	sharedTransportsMu.Unlock()
+
+	if count > maxSharedTransports {
+		t.Errorf("cached transports = %d, want at most %d", count, maxSharedTransports)
+	}
+
+	if SharedTransport(base) != kept {
+		t.Error("recently used transport should not be evicted")
+	}
+
+	oldest := base
+	oldest.MaxConnsPerHost = 1001
+
+	sharedTransportsMu.Lock()
+	_, cached := sharedTransports[oldest.key()]
+	sharedTransportsMu.Unlock()
+
+	if cached {
+		t.Error("least recently used transport should have been evicted")
+	}
+}
@@ -0,0 +1,180 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeServerCA writes the test server's certificate as a PEM CA bundle.
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+
+	return path
+}
+
+// writeClientCert generates a self-signed client certificate and key.
+func writeClientCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gdl-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	return certFile, keyFile
+}
+
+func getWithTLS(t *testing.T, config TLSConfig, url string) error {
+	t.Helper()
+
+	transport := NewTransport(TransportConfig{TLS: config})
+	defer transport.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get(url)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func TestTLSConfig_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if err := getWithTLS(t, TLSConfig{}, server.URL); err == nil {
+		t.Fatal("self-signed server should be rejected without a CA bundle")
+	}
+
+	if err := getWithTLS(t, TLSConfig{CAFile: writeServerCA(t, server)}, server.URL); err != nil {
+		t.Errorf("request with CA bundle error = %v", err)
+	}
+}
+
+func TestTLSConfig_PinnedPublicKeys(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	hash := PublicKeyHash(server.Certificate())
+	caFile := writeServerCA(t, server)
+
+	matching := TLSConfig{CAFile: caFile, PinnedPublicKeys: []string{"sha256//" + base64.StdEncoding.EncodeToString(hash)}}
+	if err := getWithTLS(t, matching, server.URL); err != nil {
+		t.Errorf("request with matching pin error = %v", err)
+	}
+
+	// A pin alone is enough to trust a self-signed server safely
+	pinnedOnly := TLSConfig{InsecureSkipVerify: true, PinnedPublicKeys: []string{hex.EncodeToString(hash)}}
+	if err := getWithTLS(t, pinnedOnly, server.URL); err != nil {
+		t.Errorf("request with hex pin error = %v", err)
+	}
+
+	wrong := make([]byte, len(hash))
+	mismatched := TLSConfig{InsecureSkipVerify: true, PinnedPublicKeys: []string{hex.EncodeToString(wrong)}}
+
+	if err := getWithTLS(t, mismatched, server.URL); err == nil {
+		t.Error("request with mismatched pin should fail even when verification is skipped")
+	}
+}
+
+func TestTLSConfig_ClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+
+	defer server.Close()
+
+	caFile := writeServerCA(t, server)
+
+	if err := getWithTLS(t, TLSConfig{CAFile: caFile}, server.URL); err == nil {
+		t.Error("request without a client certificate should fail")
+	}
+
+	certFile, keyFile := writeClientCert(t)
+	if err := getWithTLS(t, TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, server.URL); err != nil {
+		t.Errorf("request with client certificate error = %v", err)
+	}
+}
+
+func TestTLSConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config TLSConfig
+	}{
+		{"missing CA file", TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"cert without key", TLSConfig{CertFile: "client.pem"}},
+		{"malformed pin", TLSConfig{PinnedPublicKeys: []string{"sha256//not-base64!"}}},
+		{"short pin", TLSConfig{PinnedPublicKeys: []string{"abcd"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err == nil {
+				t.Error("Validate() should fail")
+			}
+		})
+	}
+
+	// A broken configuration must not silently fall back to default verification
+	transport := NewTransport(TransportConfig{TLS: tests[0].config})
+	if transport.DialTLSContext == nil {
+		t.Error("NewTransport() should fail TLS connections for an invalid TLS configuration")
+	}
+}
+
+func TestParsePinnedPublicKeys(t *testing.T) {
+	pins := ParsePinnedPublicKeys("sha256//AAAA; sha256//BBBB;")
+	if len(pins) != 2 || pins[1] != "sha256//BBBB" {
+		t.Errorf("ParsePinnedPublicKeys() = %v", pins)
+	}
+}
@@ -231,6 +231,44 @@ func (s *S3Downloader) ListObjects(ctx context.Context, bucket, prefix string, m
 	return objects, nil
 }
 
+// Object describes an object found by ListAllObjects
+type Object struct {
+	Key  string
+	Size int64
+}
+
+// ListAllObjects lists every object under prefix in bucket, following
+// continuation tokens across pages. Zero-byte "folder/" markers are left out.
+func (s *S3Downloader) ListAllObjects(ctx context.Context, bucket, prefix string) ([]Object, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	var objects []Object
+	for {
+		result, err := s.client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, gdlerrors.WrapError(err, gdlerrors.CodeNetworkError, fmt.Sprintf("failed to list objects in bucket %s", bucket))
+		}
+
+		for _, obj := range result.Contents {
+			if obj.Key == nil || strings.HasSuffix(*obj.Key, "/") {
+				continue
+			}
+			objects = append(objects, Object{Key: *obj.Key, Size: aws.ToInt64(obj.Size)})
+		}
+
+		if !aws.ToBool(result.IsTruncated) || result.NextContinuationToken == nil {
+			return objects, nil
+		}
+		input.ContinuationToken = result.NextContinuationToken
+	}
+}
+
 // ObjectExists checks if an object exists in S3
 func (s *S3Downloader) ObjectExists(ctx context.Context, url string) (bool, error) {
 	bucket, key, err := s.parseS3URL(url)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
@@ -1222,3 +1223,59 @@ func TestDownloadRangeWithMock(t *testing.T) {
 		}
 	})
 }
+
+// pagedS3Client serves ListObjectsV2 in pages of two objects.
+type pagedS3Client struct {
+	MockS3Client
+	keys   []string
+	prefix string
+}
+
+func (p *pagedS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	p.prefix = aws.ToString(params.Prefix)
+
+	start := 0
+	if params.ContinuationToken != nil {
+		_, _ = fmt.Sscanf(*params.ContinuationToken, "%d", &start)
+	}
+
+	end := min(start+2, len(p.keys))
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(p.keys))}
+	for _, key := range p.keys[start:end] {
+		output.Contents = append(output.Contents, types.Object{Key: aws.String(key), Size: aws.Int64(int64(len(key)))})
+	}
+	if end < len(p.keys) {
+		output.NextContinuationToken = aws.String(fmt.Sprint(end))
+	}
+
+	return output, nil
+}
+
+func TestListAllObjects(t *testing.T) {
+	client := &pagedS3Client{keys: []string{"data/a.csv", "data/sub/", "data/sub/b.csv", "data/c.csv", "data/d.csv"}}
+	downloader := &S3Downloader{config: DefaultConfig(), client: client}
+
+	objects, err := downloader.ListAllObjects(context.Background(), "bucket", "data/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.prefix != "data/" {
+		t.Errorf("listed prefix = %q, want data/", client.prefix)
+	}
+
+	want := []string{"data/a.csv", "data/sub/b.csv", "data/c.csv", "data/d.csv"}
+	if len(objects) != len(want) {
+		t.Fatalf("ListAllObjects() = %+v, want %v", objects, want)
+	}
+	for i, obj := range objects {
+		if obj.Key != want[i] || obj.Size != int64(len(want[i])) {
+			t.Errorf("object %d = %+v, want %s", i, obj, want[i])
+		}
+	}
+
+	failing := &S3Downloader{config: DefaultConfig(), client: &MockS3Client{listObjectsErr: errors.New("access denied")}}
+	if _, err := failing.ListAllObjects(context.Background(), "bucket", ""); err == nil {
+		t.Error("ListAllObjects() should fail when listing fails")
+	}
+}
@@ -0,0 +1,135 @@
+package resume
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// Metadata records the validators of a completed download, so later runs can
+// send conditional requests (If-None-Match / If-Modified-Since) for the file,
+// or those of a partial download, so resuming it can check that the file on
+// the server has not changed in the meantime.
+type Metadata struct {
+	// URL is the source URL of the download.
+	URL string `json:"url"`
+
+	// FilePath is the local path of the downloaded file.
+	FilePath string `json:"file_path"`
+
+	// ETag is the entity tag reported by the server.
+	ETag string `json:"etag,omitempty"`
+
+	// LastModified is the Last-Modified time reported by the server.
+	LastModified time.Time `json:"last_modified,omitempty"`
+
+	// Size is the size of the downloaded file; for a partial download, the
+	// size of the complete file.
+	Size int64 `json:"size"`
+
+	// UpdatedAt is when the metadata was recorded.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// getMetadataFilePath returns the path to the metadata file for a downloaded file.
+func (m *Manager) getMetadataFilePath(filePath string) string {
+	return filepath.Join(m.resumeDir, fmt.Sprintf(".%s.gdlmeta.json", filepath.Base(filePath)))
+}
+
+// getPartialFilePath returns the path to the metadata file for a partial
+// download.
+func (m *Manager) getPartialFilePath(filePath string) string {
+	return filepath.Join(m.resumeDir, fmt.Sprintf(".%s.gdlpart.json", filepath.Base(filePath)))
+}
+
+// SaveMetadata saves the validators of a completed download.
+func (m *Manager) SaveMetadata(meta *Metadata) error {
+	return m.writeMetadata(m.getMetadataFilePath(meta.FilePath), meta)
+}
+
+// LoadMetadata loads the validators recorded for filePath. It returns nil when
+// none are recorded or they belong to a different file with the same name.
+func (m *Manager) LoadMetadata(filePath string) (*Metadata, error) {
+	return m.readMetadata(m.getMetadataFilePath(filePath), filePath)
+}
+
+// DeleteMetadata removes the metadata recorded for filePath.
+func (m *Manager) DeleteMetadata(filePath string) error {
+	return m.removeMetadata(m.getMetadataFilePath(filePath))
+}
+
+// SavePartial saves the validators of the file a partial download was
+// started from.
+func (m *Manager) SavePartial(meta *Metadata) error {
+	return m.writeMetadata(m.getPartialFilePath(meta.FilePath), meta)
+}
+
+// LoadPartial loads the validators recorded for the partial download at
+// filePath, as LoadMetadata does for completed downloads.
+func (m *Manager) LoadPartial(filePath string) (*Metadata, error) {
+	return m.readMetadata(m.getPartialFilePath(filePath), filePath)
+}
+
+// DeletePartial removes the validators recorded for the partial download at
+// filePath.
+func (m *Manager) DeletePartial(filePath string) error {
+	return m.removeMetadata(m.getPartialFilePath(filePath))
+}
+
+// writeMetadata saves meta to metaFilePath.
+func (m *Manager) writeMetadata(metaFilePath string, meta *Metadata) error {
+	meta.UpdatedAt = time.Now()
+
+	if err := os.MkdirAll(m.resumeDir, 0o750); err != nil {
+		return gdlerrors.NewStorageError("create resume directory", err, m.resumeDir)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "marshal download metadata")
+	}
+
+	if err := os.WriteFile(metaFilePath, data, 0o600); err != nil {
+		return gdlerrors.NewStorageError("write metadata file", err, metaFilePath)
+	}
+
+	return nil
+}
+
+// readMetadata loads the metadata in metaFilePath, or nil when there is none
+// or it belongs to another file than filePath.
+func (m *Manager) readMetadata(metaFilePath, filePath string) (*Metadata, error) {
+	// #nosec G304 -- metadata file path is constructed internally, not from user input
+	data, err := os.ReadFile(metaFilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("read metadata file", err, metaFilePath)
+	}
+
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "unmarshal download metadata")
+	}
+
+	if meta.FilePath != filePath {
+		return nil, nil
+	}
+
+	return &meta, nil
+}
+
+// removeMetadata deletes metaFilePath if it exists.
+func (m *Manager) removeMetadata(metaFilePath string) error {
+	if err := os.Remove(metaFilePath); err != nil && !os.IsNotExist(err) {
+		return gdlerrors.NewStorageError("delete metadata file", err, metaFilePath)
+	}
+
+	return nil
+}
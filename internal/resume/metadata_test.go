@@ -0,0 +1,97 @@
+package resume
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadMetadata(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	filePath := filepath.Join(t.TempDir(), "file.iso")
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	meta := &Metadata{
+		URL:          "https://example.com/file.iso",
+		FilePath:     filePath,
+		ETag:         `"abc123"`,
+		LastModified: lastModified,
+		Size:         1024,
+	}
+
+	if err := manager.SaveMetadata(meta); err != nil {
+		t.Fatalf("SaveMetadata() error = %v", err)
+	}
+
+	loaded, err := manager.LoadMetadata(filePath)
+	if err != nil {
+		t.Fatalf("LoadMetadata() error = %v", err)
+	}
+
+	if loaded == nil || loaded.ETag != meta.ETag || !loaded.LastModified.Equal(lastModified) || loaded.Size != 1024 {
+		t.Errorf("LoadMetadata() = %+v, want %+v", loaded, meta)
+	}
+
+	// A file with the same name in another directory has no metadata
+	other, err := manager.LoadMetadata(filepath.Join(t.TempDir(), "file.iso"))
+	if err != nil || other != nil {
+		t.Errorf("LoadMetadata() for other path = %+v, %v, want nil", other, err)
+	}
+
+	if err := manager.DeleteMetadata(filePath); err != nil {
+		t.Fatalf("DeleteMetadata() error = %v", err)
+	}
+
+	if loaded, _ := manager.LoadMetadata(filePath); loaded != nil {
+		t.Error("LoadMetadata() after DeleteMetadata() should return nil")
+	}
+}
+
+func TestMetadataNotListedAsResumeFile(t *testing.T) {
+	manager := NewManager(t.TempDir())
+
+	if err := manager.SaveMetadata(&Metadata{FilePath: "file.iso"}); err != nil {
+		t.Fatalf("SaveMetadata() error = %v", err)
+	}
+
+	files, err := manager.ListResumeFiles()
+	if err != nil {
+		t.Fatalf("ListResumeFiles() error = %v", err)
+	}
+
+	if len(files) != 0 {
+		t.Errorf("ListResumeFiles() = %v, metadata should not be listed", files)
+	}
+}
+
+func TestSaveAndLoadPartial(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	filePath := filepath.Join(t.TempDir(), "file.iso")
+
+	// The validators of the completed file and of a partial download of it
+	// are kept apart
+	if err := manager.SaveMetadata(&Metadata{FilePath: filePath, ETag: `"old"`}); err != nil {
+		t.Fatalf("SaveMetadata() error = %v", err)
+	}
+	if err := manager.SavePartial(&Metadata{FilePath: filePath, ETag: `"new"`, Size: 2048}); err != nil {
+		t.Fatalf("SavePartial() error = %v", err)
+	}
+
+	partial, err := manager.LoadPartial(filePath)
+	if err != nil || partial == nil || partial.ETag != `"new"` || partial.Size != 2048 {
+		t.Fatalf("LoadPartial() = %+v, %v", partial, err)
+	}
+	if meta, _ := manager.LoadMetadata(filePath); meta == nil || meta.ETag != `"old"` {
+		t.Errorf("LoadMetadata() = %+v, want the completed file's validators", meta)
+	}
+
+	if err := manager.DeletePartial(filePath); err != nil {
+		t.Fatalf("DeletePartial() error = %v", err)
+	}
+	if partial, _ := manager.LoadPartial(filePath); partial != nil {
+		t.Error("LoadPartial() after DeletePartial() should return nil")
+	}
+	if meta, _ := manager.LoadMetadata(filePath); meta == nil {
+		t.Error("DeletePartial() removed the completed file's validators")
+	}
+}
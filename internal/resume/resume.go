@@ -50,6 +50,33 @@ type ResumeInfo struct {
 
 	// AcceptRanges indicates if the server supports range requests.
 	AcceptRanges bool `json:"accept_ranges"`
+
+	// Chunks is the chunk map of a download written in place into a sparse
+	// file: the partial file has its full size, and only the ranges recorded
+	// here hold downloaded data.
+	Chunks []ChunkState `json:"chunks,omitempty"`
+}
+
+// ChunkState records how much of the byte range Start-End (inclusive) of a
+// chunked download has been written, counting from Start.
+type ChunkState struct {
+	Start      int64 `json:"start"`
+	End        int64 `json:"end"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+// Holes returns the byte ranges of a chunked download that have not been
+// downloaded yet, or nil when the download has no chunk map.
+func (info *ResumeInfo) Holes() []ChunkState {
+	var holes []ChunkState
+
+	for _, chunk := range info.Chunks {
+		if start := chunk.Start + chunk.Downloaded; start <= chunk.End {
+			holes = append(holes, ChunkState{Start: start, End: chunk.End})
+		}
+	}
+
+	return holes
 }
 
 // Manager handles saving and loading resume information.
@@ -58,6 +85,17 @@ type Manager struct {
 	resumeDir string
 }
 
+// DefaultDir returns the directory where downloads keep their resume files,
+// ~/.gdl/resume, or the current directory when there is no home directory.
+func DefaultDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+
+	return filepath.Join(homeDir, ".gdl", "resume")
+}
+
 // NewManager creates a new resume manager with the specified directory.
 // If resumeDir is empty, it uses the current directory.
 func NewManager(resumeDir string) *Manager {
@@ -163,11 +201,18 @@ func (m *Manager) ValidatePartialFile(info *ResumeInfo) error {
 		return gdlerrors.NewStorageError("stat partial file", err, info.FilePath)
 	}
 
+	// A sparse file has its full size whatever has been downloaded; the chunk
+	// map tells the holes apart
+	wantSize := info.DownloadedBytes
+	if len(info.Chunks) > 0 {
+		wantSize = info.TotalBytes
+	}
+
 	// Check if the file size matches the resume info
-	if fileInfo.Size() != info.DownloadedBytes {
+	if fileInfo.Size() != wantSize {
 		return gdlerrors.NewValidationError(
 			"partial file size",
-			fmt.Sprintf("size %d does not match resume info %d", fileInfo.Size(), info.DownloadedBytes),
+			fmt.Sprintf("size %d does not match resume info %d", fileInfo.Size(), wantSize),
 		)
 	}
 
@@ -3,6 +3,7 @@ package resume
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
 	"time"
@@ -29,6 +30,16 @@ func TestNewManager(t *testing.T) {
 	}
 }
 
+func TestDefaultDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if got, want := DefaultDir(), filepath.Join(home, ".gdl", "resume"); got != want {
+		t.Errorf("DefaultDir() = %s, want %s", got, want)
+	}
+}
+
 func TestResumeFilePath(t *testing.T) {
 	tmpDir := t.TempDir()
 	manager := NewManager(tmpDir)
@@ -321,6 +332,53 @@ func TestValidatePartialFile(t *testing.T) {
 	}
 }
 
+func TestChunkMap(t *testing.T) {
+	manager := NewManager(t.TempDir())
+
+	// A sparse partial file has the full size of the download
+	testFile := filepath.Join(t.TempDir(), "sparse.bin")
+	if err := os.WriteFile(testFile, make([]byte, 300), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info := &ResumeInfo{
+		URL:             "https://example.com/sparse.bin",
+		FilePath:        testFile,
+		DownloadedBytes: 150,
+		TotalBytes:      300,
+		AcceptRanges:    true,
+		Chunks: []ChunkState{
+			{Start: 0, End: 99, Downloaded: 100},
+			{Start: 100, End: 199, Downloaded: 30},
+			{Start: 200, End: 299, Downloaded: 20},
+		},
+	}
+
+	if err := manager.Save(info); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := manager.Load(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ChunkState{{Start: 130, End: 199}, {Start: 220, End: 299}}
+	if holes := loaded.Holes(); !reflect.DeepEqual(holes, want) {
+		t.Errorf("Holes() = %+v, want %+v", holes, want)
+	}
+
+	if !manager.CanResume(loaded) {
+		t.Error("CanResume() = false for a sparse file of the full size")
+	}
+
+	// Without the chunk map, the size must match the downloaded bytes
+	loaded.Chunks = nil
+	if manager.CanResume(loaded) {
+		t.Error("CanResume() = true for a file larger than the downloaded bytes")
+	}
+}
+
 func TestCalculateAndSetChecksum(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "gdl-resume-test")
 	if err != nil {
@@ -2,8 +2,12 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"math"
 	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
@@ -16,6 +20,12 @@ type RetryManager struct {
 	MaxDelay      time.Duration // Maximum delay between retries
 	BackoffFactor float64       // Multiplier for exponential backoff
 	Jitter        bool          // Whether to add jitter to delays
+	FullJitter    bool          // Whether to pick delays uniformly from [0, delay] instead of ±5%
+	// MaxElapsedTime is the retry budget: no retry is started once it would end
+	// later than this long after the first attempt. Zero means no budget.
+	MaxElapsedTime time.Duration
+	// IgnoreRetryAfter disables honoring Retry-After hints carried by errors.
+	IgnoreRetryAfter bool
 }
 
 // NewRetryManager creates a new RetryManager with default settings.
@@ -64,11 +74,7 @@ func (rm *RetryManager) NextDelay(attempt int) time.Duration {
 
 	// For very large attempt numbers, avoid overflow by returning MaxDelay early
 	if attempt > 50 {
-		delay := rm.MaxDelay
-		if rm.Jitter {
-			delay = rm.addJitter(delay)
-		}
-		return delay
+		return rm.applyJitter(rm.MaxDelay)
 	}
 
 	// Calculate exponential backoff: baseDelay * (backoffFactor ^ attempt)
@@ -76,11 +82,7 @@ func (rm *RetryManager) NextDelay(attempt int) time.Duration {
 
 	// Check for potential overflow before converting to Duration
 	if power > float64(rm.MaxDelay)/float64(rm.BaseDelay) {
-		delay := rm.MaxDelay
-		if rm.Jitter {
-			delay = rm.addJitter(delay)
-		}
-		return delay
+		return rm.applyJitter(rm.MaxDelay)
 	}
 
 	delay := time.Duration(float64(rm.BaseDelay) * power)
@@ -91,13 +93,90 @@ func (rm *RetryManager) NextDelay(attempt int) time.Duration {
 	}
 
 	// Apply jitter if enabled
+	return rm.applyJitter(delay)
+}
+
+// applyJitter applies the configured jitter mode to a delay.
+func (rm *RetryManager) applyJitter(delay time.Duration) time.Duration {
+	if rm.FullJitter {
+		return rm.addFullJitter(delay)
+	}
+
 	if rm.Jitter {
-		delay = rm.addJitter(delay)
+		return rm.addJitter(delay)
 	}
 
 	return delay
 }
 
+// addFullJitter picks a delay uniformly from [0, delay] ("full jitter"), which
+// spreads out retries from many clients better than a small percentage.
+func (rm *RetryManager) addFullJitter(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+
+	// #nosec G404 -- Jitter for retry delays doesn't require cryptographic randomness
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// DelayFor returns the delay to wait after err before the next attempt.
+// A Retry-After hint carried by err takes precedence over the computed
+// backoff unless IgnoreRetryAfter is set, but is capped at MaxDelay so that a
+// single header cannot stall a download for hours.
+func (rm *RetryManager) DelayFor(err error, attempt int) time.Duration {
+	if !rm.IgnoreRetryAfter {
+		var downloadErr *gdlerrors.DownloadError
+		if errors.As(err, &downloadErr) && downloadErr.RetryAfter > 0 {
+			if rm.MaxDelay > 0 && downloadErr.RetryAfter > rm.MaxDelay {
+				return rm.MaxDelay
+			}
+
+			return downloadErr.RetryAfter
+		}
+	}
+
+	return rm.NextDelay(attempt)
+}
+
+// WithinBudget reports whether a retry started after delay would still
+// begin within the retry budget, given the time elapsed since the first attempt.
+func (rm *RetryManager) WithinBudget(elapsed, delay time.Duration) bool {
+	if rm.MaxElapsedTime <= 0 {
+		return true
+	}
+
+	return elapsed+delay <= rm.MaxElapsedTime
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date, into a delay relative to now.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		delay := t.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+
+		return delay, true
+	}
+
+	return 0, false
+}
+
 // addJitter adds randomness to the delay to prevent thundering herd problems.
 func (rm *RetryManager) addJitter(delay time.Duration) time.Duration {
 	// Add up to 10% jitter (±5%)
@@ -262,6 +341,30 @@ func (rm *RetryManager) WithJitter(enabled bool) *RetryManager {
 	return &newManager
 }
 
+// WithFullJitter returns a new RetryManager with full jitter enabled or disabled.
+func (rm *RetryManager) WithFullJitter(enabled bool) *RetryManager {
+	newManager := *rm
+	newManager.FullJitter = enabled
+
+	return &newManager
+}
+
+// WithMaxElapsedTime returns a new RetryManager with the specified retry budget.
+func (rm *RetryManager) WithMaxElapsedTime(budget time.Duration) *RetryManager {
+	newManager := *rm
+	newManager.MaxElapsedTime = budget
+
+	return &newManager
+}
+
+// WithRetryAfter returns a new RetryManager that honors or ignores Retry-After hints.
+func (rm *RetryManager) WithRetryAfter(enabled bool) *RetryManager {
+	newManager := *rm
+	newManager.IgnoreRetryAfter = !enabled
+
+	return &newManager
+}
+
 // Stats holds statistics about retry operations.
 type Stats struct {
 	TotalAttempts int           // Total number of attempts made
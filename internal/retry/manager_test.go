@@ -653,3 +653,89 @@ func TestRetryManager_ExecuteWithRetryAndStats_MaxDelay(t *testing.T) {
 		t.Errorf("Expected 4 attempts, got %d", stats.TotalAttempts)
 	}
 }
+
+func TestRetryManager_FullJitter(t *testing.T) {
+	rm := NewRetryManager().
+		WithBaseDelay(100 * time.Millisecond).
+		WithMaxDelay(time.Second).
+		WithFullJitter(true)
+
+	for i := 0; i < 100; i++ {
+		delay := rm.NextDelay(2)
+		if delay < 0 || delay > 400*time.Millisecond {
+			t.Fatalf("NextDelay(2) = %v, want within [0, 400ms]", delay)
+		}
+	}
+
+	if got := rm.addFullJitter(0); got != 0 {
+		t.Errorf("addFullJitter(0) = %v, want 0", got)
+	}
+}
+
+func TestRetryManager_DelayFor(t *testing.T) {
+	rm := NewRetryManager().WithJitter(false).WithBaseDelay(time.Second)
+
+	hinted := errors.FromHTTPStatus(503, "https://example.com")
+	hinted.RetryAfter = 7 * time.Second
+
+	if got := rm.DelayFor(hinted, 0); got != 7*time.Second {
+		t.Errorf("DelayFor() with Retry-After = %v, want 7s", got)
+	}
+
+	if got := rm.DelayFor(stderrors.New("plain"), 0); got != time.Second {
+		t.Errorf("DelayFor() without Retry-After = %v, want 1s", got)
+	}
+
+	if got := rm.WithRetryAfter(false).DelayFor(hinted, 0); got != time.Second {
+		t.Errorf("DelayFor() with Retry-After ignored = %v, want 1s", got)
+	}
+
+	// A Retry-After hint never exceeds MaxDelay
+	hinted.RetryAfter = 6 * time.Hour
+	if got := rm.WithMaxDelay(time.Minute).DelayFor(hinted, 0); got != time.Minute {
+		t.Errorf("DelayFor() with a Retry-After beyond MaxDelay = %v, want 1m", got)
+	}
+}
+
+func TestRetryManager_WithinBudget(t *testing.T) {
+	rm := NewRetryManager()
+	if !rm.WithinBudget(time.Hour, time.Hour) {
+		t.Error("WithinBudget() should always be true without a budget")
+	}
+
+	rm = rm.WithMaxElapsedTime(10 * time.Second)
+	if !rm.WithinBudget(5*time.Second, 5*time.Second) {
+		t.Error("WithinBudget() should allow a retry that starts exactly at the budget")
+	}
+
+	if rm.WithinBudget(5*time.Second, 6*time.Second) {
+		t.Error("WithinBudget() should reject a retry that starts after the budget")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "seconds", value: "120", want: 2 * time.Minute, wantOK: true},
+		{name: "http date", value: "Wed, 01 Jan 2025 12:00:30 GMT", want: 30 * time.Second, wantOK: true},
+		{name: "date in the past", value: "Wed, 01 Jan 2025 11:00:00 GMT", want: 0, wantOK: true},
+		{name: "empty", value: "", wantOK: false},
+		{name: "negative", value: "-5", wantOK: false},
+		{name: "garbage", value: "soon", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRetryAfter(tt.value, now)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ParseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
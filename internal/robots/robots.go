@@ -0,0 +1,242 @@
+// Package robots parses robots.txt files (RFC 9309) and answers whether a
+// crawler may fetch a path and how long it should wait between requests.
+package robots
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// maxFileSize bounds the part of a robots.txt file that is parsed, as
+// RFC 9309 allows.
+const maxFileSize = 500 << 10
+
+// Rules are the robots.txt rules that apply to one user agent. A nil *Rules
+// allows everything.
+type Rules struct {
+	rules []rule
+
+	// CrawlDelay is the Crawl-delay the site asks of the user agent, or zero.
+	CrawlDelay time.Duration
+}
+
+// rule is a single Allow or Disallow line.
+type rule struct {
+	pattern string
+	allow   bool
+}
+
+// group is the rules following one or more User-agent lines.
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// DisallowAll returns rules forbidding every path, used when a site's
+// robots.txt cannot be read because of a server error.
+func DisallowAll() *Rules {
+	return &Rules{rules: []rule{{pattern: "/"}}}
+}
+
+// Parse reads a robots.txt file and returns the rules for userAgent, matched
+// by its product token ("gdl" for "gdl/1.0"). The groups naming the token
+// apply; if there are none, those for "*" do.
+func Parse(r io.Reader, userAgent string) *Rules {
+	var groups []*group
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxFileSize))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share one group
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, rule{pattern: value, allow: key == "allow"})
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	token := productToken(userAgent)
+	rules := collect(groups, token)
+	if rules == nil {
+		rules = collect(groups, "*")
+	}
+	if rules == nil {
+		rules = &Rules{}
+	}
+
+	return rules
+}
+
+// collect merges the groups naming agent, or returns nil if there are none.
+func collect(groups []*group, agent string) *Rules {
+	var rules *Rules
+
+	for _, g := range groups {
+		for _, name := range g.agents {
+			if name != agent {
+				continue
+			}
+
+			if rules == nil {
+				rules = &Rules{}
+			}
+			rules.rules = append(rules.rules, g.rules...)
+			rules.CrawlDelay = max(rules.CrawlDelay, g.crawlDelay)
+
+			break
+		}
+	}
+
+	return rules
+}
+
+// productToken returns the lowercase name of a User-Agent, without version
+// and comments.
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(userAgent), " ")
+	token, _, _ = strings.Cut(token, "/")
+
+	return strings.ToLower(token)
+}
+
+// Allowed reports whether the rules let the user agent fetch path, the path
+// and query of a URL. The longest matching pattern decides; Allow wins a tie.
+func (r *Rules) Allowed(path string) bool {
+	if r == nil || path == "/robots.txt" {
+		return true
+	}
+
+	if path == "" {
+		path = "/"
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !match(rule.pattern, path) {
+			continue
+		}
+
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			allowed, longest = rule.allow, n
+		}
+	}
+
+	return allowed
+}
+
+// match reports whether path matches pattern, where * matches any sequence
+// of characters and a trailing $ anchors the pattern at the end of the path.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(rest, last)
+	}
+
+	return strings.Contains(rest, last)
+}
+
+// Fetch reads the robots.txt of the site serving siteURL and returns its
+// rules for the User-Agent in header (userAgent if header has none). As
+// RFC 9309 specifies, a missing file (any 4xx status) allows everything and
+// a server error disallows everything.
+func Fetch(ctx context.Context, client *http.Client, siteURL *url.URL, header http.Header, userAgent string) (*Rules, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	robotsURL := (&url.URL{Scheme: siteURL.Scheme, Host: siteURL.Host, Path: "/robots.txt"}).String()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", robotsURL)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	if agent := req.Header.Get("User-Agent"); agent != "" {
+		userAgent = agent
+	} else {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "failed to fetch robots.txt", robotsURL)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return Parse(resp.Body, userAgent), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &Rules{}, nil
+	case resp.StatusCode >= 500:
+		return DisallowAll(), nil
+	default:
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeNetworkError,
+			"failed to fetch robots.txt", fmt.Sprintf("%s returned status %d", robotsURL, resp.StatusCode))
+	}
+}
@@ -0,0 +1,141 @@
+package robots
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRobots = `# Example robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public/
+Disallow: /*.tmp$
+Crawl-delay: 2
+
+User-agent: BadBot
+User-agent: gdl
+Disallow: /archive/
+Allow: /archive/latest
+Crawl-delay: 0.5
+
+User-agent: other
+Disallow: /
+`
+
+func TestParseAllowed(t *testing.T) {
+	tests := []struct {
+		agent string
+		path  string
+		want  bool
+	}{
+		{"curl/8.0", "/index.html", true},
+		{"curl/8.0", "/private/key", false},
+		{"curl/8.0", "/private/public/file", true},
+		{"curl/8.0", "/data/file.tmp", false},
+		{"curl/8.0", "/data/file.tmp.gz", true},
+		{"curl/8.0", "/robots.txt", true},
+		{"gdl/1.0", "/private/key", true},
+		{"gdl/1.0", "/archive/2020.tar", false},
+		{"gdl/1.0", "/archive/latest.tar", true},
+		{"GDL", "/archive/2020.tar", false},
+		{"Other/2.0 (compatible)", "/anything", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.agent+tt.path, func(t *testing.T) {
+			rules := Parse(strings.NewReader(testRobots), tt.agent)
+			if got := rules.Allowed(tt.path); got != tt.want {
+				t.Errorf("Allowed(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCrawlDelay(t *testing.T) {
+	if delay := Parse(strings.NewReader(testRobots), "gdl/1.0").CrawlDelay; delay != 500*time.Millisecond {
+		t.Errorf("CrawlDelay for gdl = %v, want 500ms", delay)
+	}
+
+	if delay := Parse(strings.NewReader(testRobots), "curl").CrawlDelay; delay != 2*time.Second {
+		t.Errorf("CrawlDelay for * = %v, want 2s", delay)
+	}
+
+	if rules := Parse(strings.NewReader("Disallow: /orphan\n"), "gdl"); !rules.Allowed("/orphan") || rules.CrawlDelay != 0 {
+		t.Error("rules outside a group should be ignored")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.asp", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/*.php$", "/folder/filename.php", true},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/a*b*c$", "/axxbyyc", true},
+		{"/a*b*c$", "/axxbyycd", false},
+	}
+
+	for _, tt := range tests {
+		if got := match(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantAllowed bool
+	}{
+		{"rules", http.StatusOK, "User-agent: gdl\nDisallow: /pub/\n", false},
+		{"missing", http.StatusNotFound, "", true},
+		{"forbidden", http.StatusForbidden, "", true},
+		{"server error", http.StatusServiceUnavailable, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAgent string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/robots.txt" {
+					t.Errorf("requested %s, want /robots.txt", r.URL.Path)
+				}
+				gotAgent = r.Header.Get("User-Agent")
+
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			site, _ := url.Parse(server.URL + "/pub/releases/")
+
+			rules, err := Fetch(context.Background(), nil, site, nil, "gdl/1.0")
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+
+			if got := rules.Allowed("/pub/file"); got != tt.wantAllowed {
+				t.Errorf("Allowed() = %v, want %v", got, tt.wantAllowed)
+			}
+			if gotAgent != "gdl/1.0" {
+				t.Errorf("User-Agent = %q, want gdl/1.0", gotAgent)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package scan checks downloaded files for viruses and malware, either with a
+// ClamAV daemon or with an external scanner command.
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// clamdChunkSize is the size of the chunks a file is streamed to clamd in;
+// clamd's StreamMaxLength limits the total, not the chunk size.
+const clamdChunkSize = 64 * 1024
+
+// Clamd scans files with a ClamAV daemon using its INSTREAM command, so the
+// daemon needs no access to the file itself.
+type Clamd struct {
+	network string
+	address string
+}
+
+// NewClamd returns a scanner for the daemon at address: "host:port",
+// "tcp://host:port", "unix:///path" or a socket path.
+func NewClamd(address string) *Clamd {
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		return &Clamd{network: "unix", address: strings.TrimPrefix(address, "unix://")}
+	case strings.HasPrefix(address, "tcp://"):
+		return &Clamd{network: "tcp", address: strings.TrimPrefix(address, "tcp://")}
+	case strings.HasPrefix(address, "/"):
+		return &Clamd{network: "unix", address: address}
+	default:
+		return &Clamd{network: "tcp", address: address}
+	}
+}
+
+// ScanFile streams the file at path to clamd and returns its verdict.
+func (c *Clamd) ScanFile(ctx context.Context, path string) (*types.ScanResult, error) {
+	// #nosec G304 -- path is the file just downloaded
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("connect to clamd: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// Unblock the connection when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if err := c.stream(conn, file); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("send file to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("read clamd reply: %w", err)
+	}
+
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// stream sends the INSTREAM command followed by the file in length-prefixed
+// chunks and a zero-length terminator.
+func (c *Clamd) stream(conn io.Writer, file io.Reader) error {
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := file.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n)) // #nosec G115 -- n <= clamdChunkSize
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+
+	return err
+}
+
+// parseClamdReply interprets "stream: OK", "stream: <threat> FOUND" and
+// "<message> ERROR" replies.
+func parseClamdReply(reply string) (*types.ScanResult, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return &types.ScanResult{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &types.ScanResult{Threat: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd: %s", reply)
+	}
+}
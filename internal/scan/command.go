@@ -0,0 +1,105 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// pathPlaceholder is replaced with the scanned file's path in a command line.
+const pathPlaceholder = "{}"
+
+// Command scans files by running an external scanner, following the exit
+// status convention of clamscan: 0 means clean, 1 means infected and anything
+// else that the scan failed.
+type Command struct {
+	args []string
+}
+
+// NewCommand returns a scanner running cmdline. The file's path replaces "{}"
+// in cmdline or is appended to it. Arguments are separated by whitespace;
+// there is no shell quoting.
+func NewCommand(cmdline string) (*Command, error) {
+	args := strings.Fields(cmdline)
+	if len(args) == 0 {
+		return nil, errors.New("empty scan command")
+	}
+
+	return &Command{args: args}, nil
+}
+
+// ScanFile runs the command on the file at path.
+func (c *Command) ScanFile(ctx context.Context, path string) (*types.ScanResult, error) {
+	args := make([]string, 0, len(c.args)+1)
+	replaced := false
+	for _, arg := range c.args[1:] {
+		if strings.Contains(arg, pathPlaceholder) {
+			arg = strings.ReplaceAll(arg, pathPlaceholder, path)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+
+	// #nosec G204 -- the scan command is chosen by the user
+	cmd := exec.CommandContext(ctx, c.args[0], args...)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if err == nil {
+		return &types.ScanResult{Clean: true}, nil
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return &types.ScanResult{Threat: threatFrom(output.String(), c.args[0])}, nil
+	}
+
+	return nil, fmt.Errorf("scan command %s: %w: %s", c.args[0], err, firstLine(output.String()))
+}
+
+// threatFrom picks the line naming the threat from a scanner's output,
+// preferring clamscan's "<path>: <threat> FOUND" lines.
+func threatFrom(output, scanner string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, " FOUND") {
+			line = strings.TrimSuffix(line, " FOUND")
+			if i := strings.LastIndex(line, ": "); i >= 0 {
+				line = line[i+2:]
+			}
+			return line
+		}
+	}
+
+	if line := firstLine(output); line != "" {
+		return line
+	}
+
+	return "flagged by " + scanner
+}
+
+// firstLine returns the first non-empty line of output.
+func firstLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,233 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// eicar is the standard antivirus test string.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd serves the INSTREAM command, flagging streams containing eicar,
+// and returns its address.
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveClamd(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		_, _ = io.WriteString(conn, "UNKNOWN COMMAND\x00")
+		return
+	}
+
+	var data bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&data, reader, int64(size)); err != nil {
+			return
+		}
+	}
+
+	switch {
+	case strings.Contains(data.String(), eicar):
+		_, _ = io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+	case strings.Contains(data.String(), "too large"):
+		_, _ = io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+	default:
+		_, _ = io.WriteString(conn, "stream: OK\x00")
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "download.bin")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestClamd_ScanFile(t *testing.T) {
+	clamd := NewClamd("tcp://" + fakeClamd(t))
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		content string
+		clean   bool
+		threat  string
+		wantErr bool
+	}{
+		{"clean", "hello world", true, "", false},
+		{"large clean", strings.Repeat("x", 3*clamdChunkSize+17), true, "", false},
+		{"infected", "prefix " + eicar, false, "Eicar-Test-Signature", false},
+		{"error reply", "too large", false, "", true},
+		{"empty", "", true, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := clamd.ScanFile(ctx, writeFile(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ScanFile() should fail on an ERROR reply")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ScanFile() error = %v", err)
+			}
+
+			if result.Clean != tt.clean || result.Threat != tt.threat {
+				t.Errorf("ScanFile() = %+v, want clean %v, threat %q", result, tt.clean, tt.threat)
+			}
+		})
+	}
+}
+
+func TestClamd_Unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	if _, err := NewClamd(address).ScanFile(context.Background(), writeFile(t, "data")); err == nil {
+		t.Error("ScanFile() with no daemon listening should fail")
+	}
+}
+
+func TestNewClamd(t *testing.T) {
+	tests := []struct {
+		address, network, want string
+	}{
+		{"localhost:3310", "tcp", "localhost:3310"},
+		{"tcp://clamav:3310", "tcp", "clamav:3310"},
+		{"unix:///run/clamd.ctl", "unix", "/run/clamd.ctl"},
+		{"/var/run/clamav/clamd.sock", "unix", "/var/run/clamav/clamd.sock"},
+	}
+
+	for _, tt := range tests {
+		c := NewClamd(tt.address)
+		if c.network != tt.network || c.address != tt.want {
+			t.Errorf("NewClamd(%q) = %s %s, want %s %s", tt.address, c.network, c.address, tt.network, tt.want)
+		}
+	}
+}
+
+// writeScript writes an executable shell script and returns its path.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("scanner scripts need a POSIX shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "scanner.sh")
+	// #nosec G306 -- the test script must be executable
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestCommand_ScanFile(t *testing.T) {
+	// Flags files containing "virus" the way clamscan reports them
+	script := writeScript(t, `
+file="$2"
+[ "$1" = "--flag" ] || { echo "bad args: $*" >&2; exit 2; }
+if grep -q virus "$file"; then echo "$file: Test.Virus FOUND"; exit 1; fi
+echo "$file: OK"`)
+
+	ctx := context.Background()
+
+	for _, cmdline := range []string{script + " --flag", script + " --flag {}"} {
+		command, err := NewCommand(cmdline)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := command.ScanFile(ctx, writeFile(t, "clean"))
+		if err != nil || !result.Clean {
+			t.Errorf("%s: ScanFile() of a clean file = %+v, %v", cmdline, result, err)
+		}
+
+		result, err = command.ScanFile(ctx, writeFile(t, "a virus"))
+		if err != nil || result.Clean || result.Threat != "Test.Virus" {
+			t.Errorf("%s: ScanFile() of an infected file = %+v, %v, want threat Test.Virus", cmdline, result, err)
+		}
+	}
+
+	command, _ := NewCommand(script)
+	if _, err := command.ScanFile(ctx, writeFile(t, "clean")); err == nil || !strings.Contains(err.Error(), "bad args") {
+		t.Errorf("ScanFile() with a failing scanner error = %v, want the scanner's output", err)
+	}
+}
+
+func TestCommand_Errors(t *testing.T) {
+	if _, err := NewCommand("   "); err == nil {
+		t.Error("NewCommand() of an empty command line should fail")
+	}
+
+	command, _ := NewCommand(filepath.Join(t.TempDir(), "missing-scanner"))
+	if _, err := command.ScanFile(context.Background(), writeFile(t, "data")); err == nil {
+		t.Error("ScanFile() with a missing scanner should fail")
+	}
+}
+
+func TestThreatFrom(t *testing.T) {
+	tests := []struct {
+		output, want string
+	}{
+		{"/tmp/f: Win.Trojan.Agent FOUND\n", "Win.Trojan.Agent"},
+		{"\n  malicious content detected \n", "malicious content detected"},
+		{"", "flagged by scanner"},
+	}
+
+	for _, tt := range tests {
+		if got := threatFrom(tt.output, "scanner"); got != tt.want {
+			t.Errorf("threatFrom(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
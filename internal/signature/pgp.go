@@ -0,0 +1,139 @@
+// Package signature verifies downloaded files against detached OpenPGP
+// signatures.
+package signature
+
+import (
+	"bufio"
+	"bytes"
+	stdErrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	// x/crypto/openpgp is frozen but still verifies the RSA, DSA and ECDSA
+	// signatures used by release keys without adding a dependency.
+	"golang.org/x/crypto/openpgp"                  //nolint:staticcheck
+	pgpErrors "golang.org/x/crypto/openpgp/errors" //nolint:staticcheck
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// armorPrefix starts every ASCII armored OpenPGP block.
+var armorPrefix = []byte("-----BEGIN PGP")
+
+// Signer describes the key that made a valid signature.
+type Signer struct {
+	// KeyID is the hex encoded ID of the signer's primary key.
+	KeyID string
+
+	// Identity is one of the key's user IDs, e.g. "Name <email>".
+	Identity string
+}
+
+// ReadKeyRing reads public keys, ASCII armored or binary, from path.
+func ReadKeyRing(path string) (openpgp.EntityList, error) {
+	// #nosec G304 -- the keyring path is chosen by the user
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.NewStorageError("open keyring", err, path)
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReader(file)
+
+	var keyring openpgp.EntityList
+	if isArmored(reader) {
+		keyring, err = openpgp.ReadArmoredKeyRing(reader)
+	} else {
+		keyring, err = openpgp.ReadKeyRing(reader)
+	}
+
+	if err != nil {
+		return nil, errors.NewDownloadErrorWithDetails(errors.CodeValidationError,
+			"Invalid keyring", fmt.Sprintf("%s: %v", path, err))
+	}
+
+	return keyring, nil
+}
+
+// Verify checks that signed matches the detached signature, ASCII armored or
+// binary, and that the signature was made by a key in keyring. A mismatch or
+// an unknown signer fails with a CodeCorruptedData error wrapping
+// ErrSignatureMismatch.
+func Verify(keyring openpgp.EntityList, signed, signature io.Reader) (*Signer, error) {
+	reader := bufio.NewReader(signature)
+
+	var (
+		entity *openpgp.Entity
+		err    error
+	)
+
+	if isArmored(reader) {
+		entity, err = openpgp.CheckArmoredDetachedSignature(keyring, signed, reader)
+	} else {
+		entity, err = openpgp.CheckDetachedSignature(keyring, signed, reader)
+	}
+
+	if err != nil {
+		message := fmt.Sprintf("Signature verification failed: %v", err)
+		if stdErrors.Is(err, pgpErrors.ErrUnknownIssuer) {
+			message = "Signature verification failed: the file is not signed by a key in the keyring"
+		}
+
+		return nil, errors.WrapError(errors.ErrSignatureMismatch, errors.CodeCorruptedData, message)
+	}
+
+	return &Signer{KeyID: entity.PrimaryKey.KeyIdString(), Identity: primaryIdentity(entity)}, nil
+}
+
+// primaryIdentity returns the user ID flagged as primary, or else the first in
+// sort order so the result does not depend on map iteration.
+func primaryIdentity(entity *openpgp.Entity) string {
+	names := make([]string, 0, len(entity.Identities))
+	for name, identity := range entity.Identities {
+		if sig := identity.SelfSignature; sig != nil && sig.IsPrimaryId != nil && *sig.IsPrimaryId {
+			return name
+		}
+
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	sort.Strings(names)
+
+	return names[0]
+}
+
+// VerifyFile checks the file at path against a detached signature read from
+// signature.
+func VerifyFile(keyring openpgp.EntityList, path string, signature io.Reader) (*Signer, error) {
+	// #nosec G304 -- path is the file just downloaded
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.NewStorageError("open file", err, path)
+	}
+	defer func() { _ = file.Close() }()
+
+	return Verify(keyring, bufio.NewReader(file), signature)
+}
+
+// isArmored reports whether reader starts with an ASCII armor header, skipping
+// leading whitespace.
+func isArmored(reader *bufio.Reader) bool {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil || !bytes.ContainsAny(b, " \t\r\n") {
+			break
+		}
+
+		_, _ = reader.ReadByte()
+	}
+
+	head, _ := reader.Peek(len(armorPrefix))
+
+	return bytes.Equal(head, armorPrefix)
+}
@@ -0,0 +1,127 @@
+package signature
+
+import (
+	"bytes"
+	stdErrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/armor"  //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// newTestKey generates a small signing key.
+func newTestKey(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatalf("NewEntity() error = %v", err)
+	}
+
+	return entity
+}
+
+// writeKeyRing exports the public key of entity to a file, armored or binary.
+func writeKeyRing(t *testing.T, entity *openpgp.Entity, armored bool) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if armored {
+		w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := entity.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+
+		_ = w.Close()
+	} else if err := entity.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keyring.gpg")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	signer := newTestKey(t, "Release Signing")
+	other := newTestKey(t, "Someone Else")
+	data := []byte("release tarball contents")
+
+	var armored, binary bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&armored, signer, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := openpgp.DetachSign(&binary, signer, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		keyring   string
+		data      []byte
+		signature []byte
+		wantErr   bool
+	}{
+		{"armored signature", writeKeyRing(t, signer, true), data, armored.Bytes(), false},
+		{"binary signature and keyring", writeKeyRing(t, signer, false), data, binary.Bytes(), false},
+		{"leading whitespace", writeKeyRing(t, signer, true), data, append([]byte("\n"), armored.Bytes()...), false},
+		{"tampered data", writeKeyRing(t, signer, true), []byte("release tarball c0ntents"), armored.Bytes(), true},
+		{"unknown signer", writeKeyRing(t, other, true), data, armored.Bytes(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring, err := ReadKeyRing(tt.keyring)
+			if err != nil {
+				t.Fatalf("ReadKeyRing() error = %v", err)
+			}
+
+			got, err := Verify(keyring, bytes.NewReader(tt.data), bytes.NewReader(tt.signature))
+			if tt.wantErr {
+				if !stdErrors.Is(err, errors.ErrSignatureMismatch) || errors.GetErrorCode(err) != errors.CodeCorruptedData {
+					t.Fatalf("Verify() error = %v, want ErrSignatureMismatch", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if got.KeyID != signer.PrimaryKey.KeyIdString() || !strings.HasPrefix(got.Identity, "Release Signing") {
+				t.Errorf("Verify() signer = %+v", got)
+			}
+		})
+	}
+}
+
+func TestReadKeyRing_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.gpg")
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadKeyRing(path); errors.GetErrorCode(err) != errors.CodeValidationError {
+		t.Errorf("ReadKeyRing() error = %v, want a validation error", err)
+	}
+
+	if _, err := ReadKeyRing(filepath.Join(t.TempDir(), "missing.gpg")); errors.GetErrorCode(err) != errors.CodeStorageError {
+		t.Errorf("ReadKeyRing() error = %v, want a storage error", err)
+	}
+}
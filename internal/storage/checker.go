@@ -653,6 +653,7 @@ func isTemporaryFile(fileName, filePath string) bool {
 func isPartialDownload(fileName string) bool {
 	return strings.HasSuffix(fileName, PartialFileExtension) ||
 		strings.HasSuffix(fileName, ".part") ||
+		strings.HasSuffix(fileName, ".gdl-part") ||
 		strings.HasSuffix(fileName, ".crdownload")
 }
 
@@ -235,15 +235,22 @@ func (sc *SpaceChecker) GetSpaceInfo(path string) (*SpaceInfo, error) {
 	}
 
 	// Ensure the path exists (to match Unix behavior)
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
 		return nil, errors.NewDownloadErrorWithDetails(errors.CodeFileNotFound,
 			"Path does not exist", fmt.Sprintf("Path: %s", absPath))
 	}
 
-	// Get the root of the path (drive)
-	root := filepath.VolumeName(absPath)
-	if root == "" {
-		root = absPath[:3] // Fallback to first 3 characters (e.g., "C:\")
+	// Ask about the directory rather than the root of its drive, so that
+	// volumes mounted in folders and per-user quotas are taken into account
+	root := absPath
+	if err == nil && !info.IsDir() {
+		root = filepath.Dir(absPath)
+	}
+	root = longPath(root)
+	if !strings.HasSuffix(root, `\`) {
+		// UNC shares must end with a backslash
+		root += `\`
 	}
 
 	var freeBytesAvailable, totalNumberOfBytes, totalNumberOfFreeBytes uint64
@@ -278,6 +285,20 @@ func (sc *SpaceChecker) GetSpaceInfo(path string) (*SpaceInfo, error) {
 	}, nil
 }
 
+// longPath adds the \\?\ prefix to an absolute path too long for MAX_PATH,
+// as Windows API calls made outside the os package need it.
+func longPath(path string) string {
+	if len(path) < windows.MAX_PATH || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+
+	if unc, ok := strings.CutPrefix(path, `\\`); ok {
+		return `\\?\UNC\` + unc
+	}
+
+	return `\\?\` + path
+}
+
 // CheckSpace verifies if there's enough space at the target path.
 func (sc *SpaceChecker) CheckSpace(targetPath string, requiredBytes uint64) error {
 	spaceInfo, err := sc.GetSpaceInfo(targetPath)
@@ -806,6 +827,7 @@ func isTemporaryFile(fileName, filePath string) bool {
 func isPartialDownload(fileName string) bool {
 	return strings.HasSuffix(fileName, PartialFileExtension) ||
 		strings.HasSuffix(fileName, ".part") ||
+		strings.HasSuffix(fileName, ".gdl-part") ||
 		strings.HasSuffix(fileName, ".crdownload")
 }
 
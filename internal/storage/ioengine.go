@@ -0,0 +1,82 @@
+package storage
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// ErrIOEngineUnsupported is returned when an I/O engine is not available on
+// this platform, kernel or build.
+var ErrIOEngineUnsupported = stdErrors.New("I/O engine not supported")
+
+// ChunkWriter writes the chunks of a download at their offsets in the
+// destination file. WriteAt may be called from several goroutines and may
+// return before the data reaches the file; write errors are then reported by a
+// later call or by Close.
+type ChunkWriter interface {
+	io.WriterAt
+
+	// Close waits for outstanding writes and releases the writer's resources.
+	// The underlying file stays open.
+	Close() error
+}
+
+// ValidateIOEngine reports whether engine names a known I/O engine. An empty
+// name selects the automatic choice.
+func ValidateIOEngine(engine string) error {
+	switch engine {
+	case "", types.IOEngineAuto, types.IOEngineStandard, types.IOEngineURing, types.IOEngineMmap:
+		return nil
+	default:
+		return errors.NewValidationError("io_engine",
+			fmt.Sprintf("unknown I/O engine %q: expected %s, %s, %s or %s", engine,
+				types.IOEngineAuto, types.IOEngineStandard, types.IOEngineURing, types.IOEngineMmap))
+	}
+}
+
+// NewChunkWriter returns a ChunkWriter for a destination file of size bytes
+// using the requested engine, and the name of the engine actually used. "uring"
+// and "mmap" fall back to standard positional writes where the platform, kernel
+// or file system does not support them; "auto" selects standard writes while
+// both are experimental.
+func NewChunkWriter(file *os.File, size int64, engine string) (ChunkWriter, string, error) {
+	if err := ValidateIOEngine(engine); err != nil {
+		return nil, "", err
+	}
+
+	switch engine {
+	case types.IOEngineURing:
+		if writer, err := newURingWriter(file); err == nil {
+			return writer, types.IOEngineURing, nil
+		}
+	case types.IOEngineMmap:
+		if writer, err := newMmapWriter(file, size); err == nil {
+			return writer, types.IOEngineMmap, nil
+		}
+	}
+
+	return &standardWriter{file: file}, types.IOEngineStandard, nil
+}
+
+// standardWriter writes chunks synchronously with pwrite.
+type standardWriter struct {
+	file *os.File
+}
+
+func (w *standardWriter) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.file.WriteAt(p, off)
+	if err != nil {
+		return n, errors.NewStorageError("write file", err, w.file.Name())
+	}
+
+	return n, nil
+}
+
+func (w *standardWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package storage
+
+import "os"
+
+// newMmapWriter is not available on this platform.
+func newMmapWriter(_ *os.File, _ int64) (ChunkWriter, error) {
+	return nil, ErrIOEngineUnsupported
+}
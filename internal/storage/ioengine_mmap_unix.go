@@ -0,0 +1,83 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package storage
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime/debug"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// maxMmapSize bounds the mappings attempted, leaving address space for the
+// rest of the process on 32-bit platforms.
+const maxMmapSize = math.MaxInt >> 1
+
+// mmapWriter writes chunks by copying them into a shared mapping of the whole
+// destination file, so chunk workers fill their regions without a system call
+// per write.
+type mmapWriter struct {
+	file *os.File
+	data []byte
+}
+
+// newMmapWriter sizes file to size bytes and maps it for writing. It fails
+// with ErrIOEngineUnsupported when the file cannot be mapped, for example on
+// file systems without mmap support or for sizes beyond the address space.
+func newMmapWriter(file *os.File, size int64) (ChunkWriter, error) {
+	if size <= 0 || size > maxMmapSize {
+		return nil, ErrIOEngineUnsupported
+	}
+
+	if err := file.Truncate(size); err != nil {
+		return nil, errors.NewStorageError("truncate file", err, file.Name())
+	}
+
+	data, err := unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, ErrIOEngineUnsupported
+	}
+
+	return &mmapWriter{file: file, data: data}, nil
+}
+
+// WriteAt copies p into the mapping at off. Writes beyond the file size fail.
+func (w *mmapWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off > int64(len(w.data))-int64(len(p)) {
+		return 0, errors.NewStorageError("write file",
+			fmt.Errorf("write of %d bytes at offset %d exceeds mapped size %d", len(p), off, len(w.data)),
+			w.file.Name())
+	}
+
+	// A page that cannot be backed, e.g. on a full disk, faults with SIGBUS;
+	// report it as an error instead of crashing
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			n, err = 0, errors.NewStorageError("write file", fmt.Errorf("memory-mapped write failed: %v", r), w.file.Name())
+		}
+	}()
+
+	return copy(w.data[off:], p), nil
+}
+
+// Close unmaps the file. Written pages stay in the page cache and are written
+// back like regular writes.
+func (w *mmapWriter) Close() error {
+	if w.data == nil {
+		return nil
+	}
+
+	err := unix.Munmap(w.data)
+	w.data = nil
+
+	if err != nil {
+		return errors.NewStorageError("unmap file", err, w.file.Name())
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestMmapWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.bin")
+
+	// Stale content beyond the new size is cut off
+	if err := os.WriteFile(path, []byte("stale content of a previous download"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	writer, used, err := NewChunkWriter(file, 8, types.IOEngineMmap)
+	if err != nil {
+		t.Fatalf("NewChunkWriter() error = %v", err)
+	}
+
+	if used != types.IOEngineMmap {
+		t.Skipf("mmap not supported here, using %s", used)
+	}
+
+	if _, err := writer.WriteAt([]byte("5678"), 4); err != nil {
+		t.Fatalf("WriteAt() error = %v", err)
+	}
+
+	if _, err := writer.WriteAt([]byte("1234"), 0); err != nil {
+		t.Fatalf("WriteAt() error = %v", err)
+	}
+
+	if _, err := writer.WriteAt([]byte("overflow"), 4); err == nil {
+		t.Error("WriteAt() beyond the mapped size should fail")
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "12345678" {
+		t.Errorf("file content = %q, want %q", data, "12345678")
+	}
+}
+
+func TestMmapWriter_FallsBack(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	// Unknown sizes cannot be mapped
+	writer, used, err := NewChunkWriter(file, 0, types.IOEngineMmap)
+	if err != nil {
+		t.Fatalf("NewChunkWriter() error = %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+
+	if used != types.IOEngineStandard {
+		t.Errorf("NewChunkWriter() used %q, want %q", used, types.IOEngineStandard)
+	}
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestValidateIOEngine(t *testing.T) {
+	for _, engine := range []string{"", types.IOEngineAuto, types.IOEngineStandard, types.IOEngineURing, types.IOEngineMmap} {
+		if err := ValidateIOEngine(engine); err != nil {
+			t.Errorf("ValidateIOEngine(%q) error = %v", engine, err)
+		}
+	}
+
+	if err := ValidateIOEngine("aio"); err == nil {
+		t.Error("ValidateIOEngine(\"aio\") should fail")
+	}
+
+	if _, _, err := NewChunkWriter(nil, 0, "aio"); err == nil {
+		t.Error("NewChunkWriter() should reject an unknown engine")
+	}
+}
+
+func TestChunkWriter_ConcurrentChunks(t *testing.T) {
+	const (
+		chunks    = 8
+		chunkSize = 100*1024 + 7
+		blockSize = 32 * 1024
+	)
+
+	want := make([]byte, chunks*chunkSize)
+	for i := range want {
+		want[i] = byte(i % 253)
+	}
+
+	for _, engine := range []string{types.IOEngineAuto, types.IOEngineStandard, types.IOEngineURing, types.IOEngineMmap} {
+		t.Run(engine, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.bin")
+
+			file, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = file.Close() }()
+
+			writer, used, err := NewChunkWriter(file, int64(len(want)), engine)
+			if err != nil {
+				t.Fatalf("NewChunkWriter() error = %v", err)
+			}
+
+			if engine == types.IOEngineStandard && used != types.IOEngineStandard {
+				t.Errorf("NewChunkWriter(standard) used %q", used)
+			}
+
+			var wg sync.WaitGroup
+
+			for c := 0; c < chunks; c++ {
+				wg.Add(1)
+
+				go func(start int) {
+					defer wg.Done()
+
+					// Reuse one buffer per worker, as chunk workers do
+					buf := make([]byte, blockSize)
+
+					for off := start; off < start+chunkSize; off += blockSize {
+						n := copy(buf, want[off:min(off+blockSize, start+chunkSize)])
+						if _, err := writer.WriteAt(buf[:n], int64(off)); err != nil {
+							t.Errorf("WriteAt(%d) error = %v", off, err)
+							return
+						}
+					}
+				}(c * chunkSize)
+			}
+
+			wg.Wait()
+
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("file content mismatch using %s engine", used)
+			}
+		})
+	}
+}
+
+func BenchmarkChunkWriter(b *testing.B) {
+	const (
+		workers   = 8
+		perWorker = 8 * 1024 * 1024
+		blockSize = 32 * 1024
+	)
+
+	block := make([]byte, blockSize)
+
+	for _, engine := range []string{types.IOEngineStandard, types.IOEngineURing, types.IOEngineMmap} {
+		b.Run(engine, func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), "out.bin")
+
+			b.SetBytes(workers * perWorker)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				file, err := os.Create(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				writer, _, err := NewChunkWriter(file, workers*perWorker, engine)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				var wg sync.WaitGroup
+
+				for w := 0; w < workers; w++ {
+					wg.Add(1)
+
+					go func(start int64) {
+						defer wg.Done()
+
+						for off := start; off < start+perWorker; off += blockSize {
+							_, _ = writer.WriteAt(block, off)
+						}
+					}(int64(w) * perWorker)
+				}
+
+				wg.Wait()
+
+				if err := writer.Close(); err != nil {
+					b.Fatal(err)
+				}
+
+				_ = file.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+//go:build linux && !gdl_nouring
+
+package storage
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// io_uring ABI constants (linux/io_uring.h).
+const (
+	uringEntries = 64
+
+	uringOpWritev        = 2
+	uringEnterGetEvents  = 1
+	uringFeatSingleMmap  = 1
+	uringOffSQRing       = 0
+	uringOffCQRing       = 0x8000000
+	uringOffSQEs         = 0x10000000
+	uringSQESize         = 64
+	uringCQESize         = 16
+	uringRingIndexSize   = 4
+	uringMmapProtections = unix.PROT_READ | unix.PROT_WRITE
+	uringMmapFlags       = unix.MAP_SHARED | unix.MAP_POPULATE
+)
+
+type uringSQRingOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Flags       uint32
+	Dropped     uint32
+	Array       uint32
+	Resv1       uint32
+	UserAddr    uint64
+}
+
+type uringCQRingOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Overflow    uint32
+	CQEs        uint32
+	Flags       uint32
+	Resv1       uint32
+	UserAddr    uint64
+}
+
+type uringParams struct {
+	SQEntries    uint32
+	CQEntries    uint32
+	Flags        uint32
+	SQThreadCPU  uint32
+	SQThreadIdle uint32
+	Features     uint32
+	WQFd         uint32
+	Resv         [3]uint32
+	SQOff        uringSQRingOffsets
+	CQOff        uringCQRingOffsets
+}
+
+type uringSQE struct {
+	Opcode      uint8
+	Flags       uint8
+	IOPrio      uint16
+	Fd          int32
+	Off         uint64
+	Addr        uint64
+	Len         uint32
+	RWFlags     uint32
+	UserData    uint64
+	BufIndex    uint16
+	Personality uint16
+	SpliceFdIn  int32
+	Addr3       uint64
+	Pad         uint64
+}
+
+type uringCQE struct {
+	UserData uint64
+	Res      int32
+	Flags    uint32
+}
+
+// uringSlot owns the data of one queued write until it completes.
+type uringSlot struct {
+	iov    unix.Iovec
+	buf    []byte
+	offset int64
+}
+
+// uringWriter queues chunk writes on an io_uring instance. WriteAt copies the
+// data into a free slot and submits it without waiting, so workers keep
+// reading from the network while the kernel batches the disk writes.
+type uringWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	fd   int
+
+	ringFd     int
+	sqRing     []byte
+	cqRing     []byte
+	sqeMem     []byte
+	sharedRing bool // cqRing is the same mapping as sqRing
+
+	sqTail  *uint32
+	sqMask  uint32
+	sqes    []uringSQE
+	cqHead  *uint32
+	cqTail  *uint32
+	cqMask  uint32
+	cqes    []uringCQE
+	slots   []uringSlot
+	free    []int
+	pending uint32 // queued but not yet accepted by the kernel
+	flight  int    // submitted and not yet completed
+	err     error
+}
+
+// newURingWriter sets up an io_uring instance for writing to file. It fails
+// with ErrIOEngineUnsupported when the kernel does not provide io_uring or a
+// seccomp policy forbids it.
+func newURingWriter(file *os.File) (ChunkWriter, error) {
+	var params uringParams
+
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uringEntries, uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, ErrIOEngineUnsupported
+	}
+
+	w := &uringWriter{file: file, fd: int(file.Fd()), ringFd: int(fd)}
+	if err := w.mapRings(&params); err != nil {
+		w.release()
+		return nil, ErrIOEngineUnsupported
+	}
+
+	w.slots = make([]uringSlot, params.SQEntries)
+	w.free = make([]int, 0, params.SQEntries)
+
+	for i := range w.slots {
+		w.free = append(w.free, i)
+	}
+
+	return w, nil
+}
+
+// mapRings maps the submission and completion rings and the SQE array.
+func (w *uringWriter) mapRings(params *uringParams) error {
+	sqSize := int(params.SQOff.Array + params.SQEntries*uringRingIndexSize)
+	cqSize := int(params.CQOff.CQEs + params.CQEntries*uringCQESize)
+
+	if params.Features&uringFeatSingleMmap != 0 {
+		sqSize = max(sqSize, cqSize)
+	}
+
+	var err error
+
+	w.sqRing, err = unix.Mmap(w.ringFd, uringOffSQRing, sqSize, uringMmapProtections, uringMmapFlags)
+	if err != nil {
+		return err
+	}
+
+	if params.Features&uringFeatSingleMmap != 0 {
+		w.cqRing = w.sqRing
+		w.sharedRing = true
+	} else if w.cqRing, err = unix.Mmap(w.ringFd, uringOffCQRing, cqSize, uringMmapProtections, uringMmapFlags); err != nil {
+		return err
+	}
+
+	w.sqeMem, err = unix.Mmap(w.ringFd, uringOffSQEs, int(params.SQEntries)*uringSQESize,
+		uringMmapProtections, uringMmapFlags)
+	if err != nil {
+		return err
+	}
+
+	w.sqTail = (*uint32)(unsafe.Pointer(&w.sqRing[params.SQOff.Tail]))
+	w.sqMask = *(*uint32)(unsafe.Pointer(&w.sqRing[params.SQOff.RingMask]))
+	w.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&w.sqeMem[0])), params.SQEntries)
+
+	// Ring position i always refers to SQE i
+	array := unsafe.Slice((*uint32)(unsafe.Pointer(&w.sqRing[params.SQOff.Array])), params.SQEntries)
+	for i := range array {
+		array[i] = uint32(i)
+	}
+
+	w.cqHead = (*uint32)(unsafe.Pointer(&w.cqRing[params.CQOff.Head]))
+	w.cqTail = (*uint32)(unsafe.Pointer(&w.cqRing[params.CQOff.Tail]))
+	w.cqMask = *(*uint32)(unsafe.Pointer(&w.cqRing[params.CQOff.RingMask]))
+	w.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&w.cqRing[params.CQOff.CQEs])), params.CQEntries)
+
+	return nil
+}
+
+// WriteAt queues a copy of p to be written at off.
+func (w *uringWriter) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	for len(w.free) == 0 {
+		if err := w.wait(); err != nil {
+			return 0, w.fail(err)
+		}
+	}
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	index := w.free[len(w.free)-1]
+	w.free = w.free[:len(w.free)-1]
+
+	slot := &w.slots[index]
+	slot.buf = append(slot.buf[:0], p...)
+	slot.offset = off
+	slot.iov.Base = &slot.buf[0]
+	slot.iov.SetLen(len(slot.buf))
+
+	tail := atomic.LoadUint32(w.sqTail)
+	w.sqes[tail&w.sqMask] = uringSQE{
+		Opcode:   uringOpWritev,
+		Fd:       int32(w.fd), // #nosec G115 -- file descriptors fit in int32
+		Off:      uint64(off), // #nosec G115 -- chunk offsets are never negative
+		Addr:     uint64(uintptr(unsafe.Pointer(&slot.iov))),
+		Len:      1,
+		UserData: uint64(index), // #nosec G115 -- slot indexes are small and positive
+	}
+	atomic.StoreUint32(w.sqTail, tail+1)
+
+	w.pending++
+	w.flight++
+
+	if err := w.enter(0); err != nil {
+		return 0, w.fail(err)
+	}
+
+	w.reap()
+
+	return len(p), w.err
+}
+
+// Close waits for all queued writes and tears down the ring.
+func (w *uringWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Outstanding writes reference slot buffers, so wait for all of them
+	for w.flight > 0 {
+		if err := w.wait(); err != nil {
+			w.fail(err)
+			break
+		}
+	}
+
+	w.release()
+
+	return w.err
+}
+
+// enter submits pending entries and, with minComplete > 0, waits for that many
+// completions.
+func (w *uringWriter) enter(minComplete uint32) error {
+	var flags uintptr
+	if minComplete > 0 {
+		flags = uringEnterGetEvents
+	}
+
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(w.ringFd),
+			uintptr(w.pending), uintptr(minComplete), flags, 0, 0)
+
+		switch errno {
+		case 0:
+			w.pending -= uint32(n) // #nosec G115 -- at most pending entries are accepted
+			return nil
+		case unix.EINTR:
+			continue
+		case unix.EAGAIN, unix.EBUSY:
+			// Retried by the next submission or wait
+			return nil
+		default:
+			return errno
+		}
+	}
+}
+
+// wait blocks until at least one write completes and reaps it. Failed writes
+// are recorded in w.err; the returned error is a failure of the ring itself.
+func (w *uringWriter) wait() error {
+	if err := w.enter(1); err != nil {
+		return err
+	}
+
+	w.reap()
+
+	return nil
+}
+
+// reap processes completed writes and frees their slots. Short writes are
+// finished synchronously.
+func (w *uringWriter) reap() {
+	head := atomic.LoadUint32(w.cqHead)
+	tail := atomic.LoadUint32(w.cqTail)
+
+	for ; head != tail; head++ {
+		cqe := w.cqes[head&w.cqMask]
+		index := int(cqe.UserData) // #nosec G115 -- user data is a slot index
+		slot := &w.slots[index]
+
+		switch {
+		case cqe.Res < 0:
+			w.fail(unix.Errno(-cqe.Res))
+		case int(cqe.Res) < len(slot.buf):
+			if _, err := w.file.WriteAt(slot.buf[cqe.Res:], slot.offset+int64(cqe.Res)); err != nil {
+				w.fail(err)
+			}
+		}
+
+		w.free = append(w.free, index)
+		w.flight--
+	}
+
+	atomic.StoreUint32(w.cqHead, head)
+}
+
+// fail records the first write error.
+func (w *uringWriter) fail(err error) error {
+	if w.err == nil {
+		w.err = errors.NewStorageError("write file", err, w.file.Name())
+	}
+
+	return w.err
+}
+
+// release unmaps the rings and closes the io_uring instance.
+func (w *uringWriter) release() {
+	if w.sqeMem != nil {
+		_ = unix.Munmap(w.sqeMem)
+		w.sqeMem = nil
+	}
+
+	if w.cqRing != nil && !w.sharedRing {
+		_ = unix.Munmap(w.cqRing)
+	}
+
+	w.cqRing = nil
+
+	if w.sqRing != nil {
+		_ = unix.Munmap(w.sqRing)
+		w.sqRing = nil
+	}
+
+	if w.ringFd >= 0 {
+		_ = unix.Close(w.ringFd)
+		w.ringFd = -1
+	}
+}
@@ -0,0 +1,73 @@
+//go:build linux && !gdl_nouring
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func openURingWriter(t *testing.T, file *os.File) ChunkWriter {
+	t.Helper()
+
+	writer, err := newURingWriter(file)
+	if err != nil {
+		t.Skipf("io_uring not available: %v", err)
+	}
+
+	return writer
+}
+
+func TestNewChunkWriter_SelectsURing(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	_ = openURingWriter(t, file).Close()
+
+	engines := map[string]string{
+		types.IOEngineURing: types.IOEngineURing,
+		types.IOEngineAuto:  types.IOEngineStandard,
+	}
+
+	for engine, want := range engines {
+		writer, used, err := NewChunkWriter(file, 0, engine)
+		if err != nil {
+			t.Fatalf("NewChunkWriter(%s) error = %v", engine, err)
+		}
+
+		_ = writer.Close()
+
+		if used != want {
+			t.Errorf("NewChunkWriter(%s) used %q, want %q", engine, used, want)
+		}
+	}
+}
+
+func TestURingWriter_ReportsWriteErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.bin")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A read-only descriptor makes the queued write fail in the kernel
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	writer := openURingWriter(t, file)
+
+	_, writeErr := writer.WriteAt([]byte("data"), 0)
+	closeErr := writer.Close()
+
+	if writeErr == nil && closeErr == nil {
+		t.Error("a failed write should be reported by WriteAt or Close")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux || gdl_nouring
+
+package storage
+
+import "os"
+
+// newURingWriter is not available on this platform or build.
+func newURingWriter(_ *os.File) (ChunkWriter, error) {
+	return nil, ErrIOEngineUnsupported
+}
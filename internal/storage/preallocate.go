@@ -0,0 +1,56 @@
+package storage
+
+import (
+	stdErrors "errors"
+	"os"
+	"path/filepath"
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// ErrPreallocateUnsupported is returned by Preallocate when the platform or
+// file system cannot reserve space for a file.
+var ErrPreallocateUnsupported = stdErrors.New("preallocation not supported")
+
+// Preallocate reserves size bytes of disk space for file without changing its
+// apparent size, so sequential and resumed writes are unaffected. Reserving the
+// blocks up front reduces fragmentation and fails early when the disk is full.
+// It uses fallocate(FALLOC_FL_KEEP_SIZE) on Linux, F_PREALLOCATE on macOS and
+// the file allocation size on Windows; elsewhere ErrPreallocateUnsupported is
+// returned.
+func Preallocate(file *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	err := preallocate(file, size)
+	if err == nil || stdErrors.Is(err, ErrPreallocateUnsupported) {
+		return err
+	}
+
+	if isNoSpace(err) {
+		return errors.NewDownloadErrorWithDetails(errors.CodeInsufficientSpace,
+			"Insufficient disk space", "Failed to reserve "+formatBytes(uint64(size))+" for "+file.Name())
+	}
+
+	return errors.NewStorageError("preallocate file", err, file.Name())
+}
+
+// Preallocate checks that the file's directory has room for size bytes and
+// then reserves the space for file. Platforms or file systems without
+// preallocation support are not treated as an error.
+func (sc *SpaceChecker) Preallocate(file *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	if err := sc.CheckAvailableSpace(filepath.Dir(file.Name()), uint64(size)); err != nil {
+		return err
+	}
+
+	if err := Preallocate(file, size); err != nil && !stdErrors.Is(err, ErrPreallocateUnsupported) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build darwin
+
+package storage
+
+import (
+	stdErrors "errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func preallocate(file *os.File, size int64) error {
+	// Prefer a contiguous allocation, then accept any allocation
+	store := &unix.Fstore_t{
+		Flags:   unix.F_ALLOCATECONTIG | unix.F_ALLOCATEALL,
+		Posmode: unix.F_PEOFPOSMODE,
+		Length:  size,
+	}
+
+	err := unix.FcntlFstore(file.Fd(), unix.F_PREALLOCATE, store)
+	if err != nil && !isNoSpace(err) {
+		store.Flags = unix.F_ALLOCATEALL
+		err = unix.FcntlFstore(file.Fd(), unix.F_PREALLOCATE, store)
+	}
+
+	if stdErrors.Is(err, unix.ENOTSUP) || stdErrors.Is(err, unix.EINVAL) {
+		return ErrPreallocateUnsupported
+	}
+
+	return err
+}
+
+func isNoSpace(err error) bool {
+	return stdErrors.Is(err, unix.ENOSPC)
+}
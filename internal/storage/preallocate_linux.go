@@ -0,0 +1,23 @@
+//go:build linux
+
+package storage
+
+import (
+	stdErrors "errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func preallocate(file *os.File, size int64) error {
+	err := unix.Fallocate(int(file.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size)
+	if stdErrors.Is(err, unix.EOPNOTSUPP) || stdErrors.Is(err, unix.ENOSYS) {
+		return ErrPreallocateUnsupported
+	}
+
+	return err
+}
+
+func isNoSpace(err error) bool {
+	return stdErrors.Is(err, unix.ENOSPC)
+}
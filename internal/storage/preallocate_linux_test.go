@@ -0,0 +1,36 @@
+//go:build linux
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPreallocate_ReservesBlocks(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	const size = 4 << 20
+
+	if err := Preallocate(file, size); errors.Is(err, ErrPreallocateUnsupported) {
+		t.Skip("fallocate not supported on this file system")
+	} else if err != nil {
+		t.Fatalf("Preallocate() error = %v", err)
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(int(file.Fd()), &stat); err != nil {
+		t.Fatal(err)
+	}
+
+	if allocated := stat.Blocks * 512; allocated < size {
+		t.Errorf("allocated %d bytes, want at least %d", allocated, size)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package storage
+
+import "os"
+
+func preallocate(_ *os.File, _ int64) error {
+	return ErrPreallocateUnsupported
+}
+
+func isNoSpace(_ error) bool {
+	return false
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreallocate(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	err = Preallocate(file, 1<<20)
+	if errors.Is(err, ErrPreallocateUnsupported) {
+		t.Skip("preallocation not supported on this file system")
+	}
+
+	if err != nil {
+		t.Fatalf("Preallocate() error = %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 0 {
+		t.Errorf("Preallocate() changed the file size to %d, want 0", info.Size())
+	}
+
+	if err := Preallocate(file, 0); err != nil {
+		t.Errorf("Preallocate(0) error = %v", err)
+	}
+}
+
+func TestSpaceChecker_PreallocateInsufficientSpace(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	// Far more than any test machine has available
+	if err := NewSpaceChecker().Preallocate(file, 1<<62); err == nil {
+		t.Error("Preallocate() should fail when the disk cannot hold the file")
+	}
+}
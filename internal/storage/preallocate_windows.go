@@ -0,0 +1,30 @@
+//go:build windows
+
+package storage
+
+import (
+	stdErrors "errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// preallocate sets the file's allocation size, which reserves clusters without
+// moving the end of file. SetFileValidData is not used: it needs the
+// SE_MANAGE_VOLUME_NAME privilege and exposes stale disk contents.
+func preallocate(file *os.File, size int64) error {
+	allocationSize := size
+
+	err := windows.SetFileInformationByHandle(windows.Handle(file.Fd()), windows.FileAllocationInfo,
+		(*byte)(unsafe.Pointer(&allocationSize)), uint32(unsafe.Sizeof(allocationSize)))
+	if stdErrors.Is(err, windows.ERROR_INVALID_FUNCTION) || stdErrors.Is(err, windows.ERROR_NOT_SUPPORTED) {
+		return ErrPreallocateUnsupported
+	}
+
+	return err
+}
+
+func isNoSpace(err error) bool {
+	return stdErrors.Is(err, windows.ERROR_DISK_FULL)
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// Quota enforces a maximum total size for the files in a directory tree. It is
+// safe for concurrent use: space reserved for downloads in progress counts
+// against the quota until released, so downloads running side by side, as in
+// a batch, cannot exceed it together.
+type Quota struct {
+	dir     string
+	maxSize int64
+	policy  string
+
+	mu       sync.Mutex
+	reserved int64
+}
+
+// stateSubdirs are the directories below ~/.gdl holding gdl's own state
+// rather than downloads.
+var stateSubdirs = map[string]bool{"plugins": true, "resume": true, "locales": true}
+
+// quotaFile is a file counted against a quota.
+type quotaFile struct {
+	path       string
+	size       int64
+	modTime    time.Time
+	accessTime time.Time
+	evictable  bool
+}
+
+// ValidateQuotaPolicy reports whether policy is a known quota policy.
+func ValidateQuotaPolicy(policy string) error {
+	switch policy {
+	case "", types.QuotaPolicyRefuse, types.QuotaPolicyOldest, types.QuotaPolicyLRU:
+		return nil
+	default:
+		return errors.NewValidationError("quota_policy",
+			fmt.Sprintf("unknown quota policy %q: expected %s, %s or %s", policy,
+				types.QuotaPolicyRefuse, types.QuotaPolicyOldest, types.QuotaPolicyLRU))
+	}
+}
+
+// NewQuota returns a quota of maxSize bytes for dir, applying policy when a
+// reservation does not fit.
+func NewQuota(dir string, maxSize int64, policy string) *Quota {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	if policy == "" {
+		policy = types.QuotaPolicyRefuse
+	}
+
+	return &Quota{dir: dir, maxSize: maxSize, policy: policy}
+}
+
+// Dir returns the directory the quota applies to.
+func (q *Quota) Dir() string {
+	return q.dir
+}
+
+// Usage returns the total size of the files in the directory tree.
+func (q *Quota) Usage() (int64, error) {
+	_, usage, err := q.scan(nil)
+	return usage, err
+}
+
+// Reserve makes room for size more bytes in the directory, deleting files as
+// the policy allows, and holds the space until release is called. Files in
+// protected and partial downloads are never deleted. When the space cannot be
+// made available the error wraps errors.ErrQuotaExceeded with
+// CodeInsufficientSpace and nothing is deleted.
+func (q *Quota) Reserve(size int64, protected ...string) (release func(), err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	files, usage, err := q.scan(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	size = max(size, 0)
+
+	if excess := usage + q.reserved + size - q.maxSize; excess > 0 {
+		if err := q.evict(files, excess); err != nil {
+			if stdErrors.Is(err, errors.ErrQuotaExceeded) {
+				return nil, q.exceeded(size, usage)
+			}
+
+			return nil, err
+		}
+	}
+
+	q.reserved += size
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			q.reserved -= size
+			q.mu.Unlock()
+		})
+	}, nil
+}
+
+// evict deletes files in policy order until at least excess bytes are freed.
+// It deletes nothing when the policy refuses or the files cannot free enough.
+func (q *Quota) evict(files []quotaFile, excess int64) error {
+	if q.policy == types.QuotaPolicyRefuse {
+		return errors.ErrQuotaExceeded
+	}
+
+	var candidates []quotaFile
+
+	var available int64
+
+	for _, file := range files {
+		if file.evictable {
+			candidates = append(candidates, file)
+			available += file.size
+		}
+	}
+
+	if available < excess {
+		return errors.ErrQuotaExceeded
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if q.policy == types.QuotaPolicyLRU {
+			return candidates[i].accessTime.Before(candidates[j].accessTime)
+		}
+
+		return candidates[i].modTime.Before(candidates[j].modTime)
+	})
+
+	for _, file := range candidates {
+		if excess <= 0 {
+			break
+		}
+
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			return errors.NewStorageError("evict file", err, file.path)
+		}
+
+		excess -= file.size
+	}
+
+	return nil
+}
+
+// scan lists the regular files in the directory tree and their total size.
+// A missing directory is empty.
+func (q *Quota) scan(protected []string) ([]quotaFile, int64, error) {
+	keep := make(map[string]bool, len(protected))
+
+	for _, path := range protected {
+		if abs, err := filepath.Abs(path); err == nil {
+			keep[abs] = true
+		}
+	}
+
+	var (
+		files []quotaFile
+		usage int64
+	)
+
+	err := filepath.WalkDir(q.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// Removed while scanning
+			return nil
+		}
+
+		usage += info.Size()
+		files = append(files, quotaFile{
+			path:       path,
+			size:       info.Size(),
+			modTime:    info.ModTime(),
+			accessTime: accessTime(info),
+			evictable: !keep[path] && !isPartialDownload(entry.Name()) &&
+				filepath.Ext(filepath.Dir(path)) != ".chunks" && !isStateFile(path),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, errors.NewStorageError("scan quota directory", err, q.dir)
+	}
+
+	return files, usage, nil
+}
+
+// isStateFile reports whether path holds gdl's own state, which a quota on a
+// directory containing it must not evict: the configuration in ~/.config/gdl,
+// and in ~/.gdl the files at its top level (history, schedules, usage, host
+// cache, plugin config) and the plugins, resume and locales directories.
+// Other directories below ~/.gdl, such as a download cache, are evictable.
+func isStateFile(path string) bool {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+
+	if within(filepath.Join(homeDir, ".config", "gdl"), path) {
+		return true
+	}
+
+	stateDir := filepath.Join(homeDir, ".gdl")
+	if !within(stateDir, path) {
+		return false
+	}
+
+	rel, _ := filepath.Rel(stateDir, path)
+	top, _, nested := strings.Cut(rel, string(filepath.Separator))
+
+	return !nested || stateSubdirs[top]
+}
+
+// within reports whether path is in the directory tree of dir.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// exceeded returns the error for a reservation of size bytes that does not fit.
+func (q *Quota) exceeded(size, usage int64) error {
+	// #nosec G115 -- sizes are never negative
+	return errors.WrapError(errors.ErrQuotaExceeded, errors.CodeInsufficientSpace,
+		fmt.Sprintf("Downloading %s would exceed the %s quota of %s (%s used, %s reserved)",
+			formatBytes(uint64(size)), formatBytes(uint64(q.maxSize)), q.dir,
+			formatBytes(uint64(usage)), formatBytes(uint64(q.reserved))))
+}
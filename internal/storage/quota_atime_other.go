@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+
+package storage
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time of a file, as its access time is
+// not read on this platform.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// writeQuotaFile creates a file of size bytes in dir with the given
+// modification and access times, counted in hours before now.
+func writeQuotaFile(t *testing.T, dir, name string, size int, modAgo, accessAgo int) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, make([]byte, size), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(path, now.Add(-time.Duration(accessAgo)*time.Hour), now.Add(-time.Duration(modAgo)*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestQuota_Refuse(t *testing.T) {
+	dir := t.TempDir()
+	writeQuotaFile(t, dir, "a.bin", 600, 2, 2)
+
+	quota := NewQuota(dir, 1000, types.QuotaPolicyRefuse)
+
+	if usage, err := quota.Usage(); err != nil || usage != 600 {
+		t.Fatalf("Usage() = %d, %v, want 600", usage, err)
+	}
+
+	release, err := quota.Reserve(400)
+	if err != nil {
+		t.Fatalf("Reserve(400) error = %v, want it to fit exactly", err)
+	}
+
+	// The reservation counts until released
+	_, err = quota.Reserve(1)
+	if !errors.Is(err, gdlerrors.ErrQuotaExceeded) || gdlerrors.GetErrorCode(err) != gdlerrors.CodeInsufficientSpace {
+		t.Errorf("Reserve(1) error = %v, want ErrQuotaExceeded with CodeInsufficientSpace while 400 bytes are reserved", err)
+	}
+
+	release()
+	release() // Releasing twice has no effect
+
+	if _, err := quota.Reserve(400); err != nil {
+		t.Errorf("Reserve(400) after release error = %v", err)
+	}
+}
+
+func TestQuota_Evict(t *testing.T) {
+	tests := []struct {
+		policy      string
+		wantEvicted string
+	}{
+		// old.bin was modified first, stale.bin accessed longest ago
+		{types.QuotaPolicyOldest, "old.bin"},
+		{types.QuotaPolicyLRU, "stale.bin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{
+				"old.bin":   writeQuotaFile(t, dir, "old.bin", 300, 30, 1),
+				"stale.bin": writeQuotaFile(t, dir, "stale.bin", 300, 10, 20),
+				"new.bin":   writeQuotaFile(t, dir, "sub/new.bin", 300, 1, 1),
+			}
+
+			quota := NewQuota(dir, 1000, tt.policy)
+
+			release, err := quota.Reserve(250)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			defer release()
+
+			for name, path := range files {
+				if evicted := !exists(path); evicted != (name == tt.wantEvicted) {
+					t.Errorf("%s evicted = %v, want only %s evicted", name, evicted, tt.wantEvicted)
+				}
+			}
+		})
+	}
+}
+
+func TestQuota_EvictKeepsProtectedFiles(t *testing.T) {
+	dir := t.TempDir()
+	dest := writeQuotaFile(t, dir, "dest.bin", 300, 40, 40)
+	part := writeQuotaFile(t, dir, "other.iso.gdl-part", 300, 40, 40)
+	chunk := writeQuotaFile(t, dir, "big.iso.chunks/chunk_0", 300, 40, 40)
+	old := writeQuotaFile(t, dir, "old.bin", 100, 1, 1)
+
+	quota := NewQuota(dir, 1000, types.QuotaPolicyOldest)
+
+	// Only old.bin may go, which is not enough: nothing is deleted
+	if _, err := quota.Reserve(300, dest); !errors.Is(err, gdlerrors.ErrQuotaExceeded) {
+		t.Fatalf("Reserve() error = %v, want ErrQuotaExceeded", err)
+	}
+
+	for _, path := range []string{dest, part, chunk, old} {
+		if !exists(path) {
+			t.Errorf("%s was deleted", path)
+		}
+	}
+
+	if _, err := quota.Reserve(100, dest); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	if exists(old) || !exists(dest) || !exists(part) || !exists(chunk) {
+		t.Error("only old.bin should have been evicted")
+	}
+}
+
+func TestQuota_EvictKeepsStateFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	dir := filepath.Join(home, ".gdl")
+	state := []string{
+		writeQuotaFile(t, dir, "history.jsonl", 200, 50, 50),
+		writeQuotaFile(t, dir, "history.jsonl.1", 200, 50, 50),
+		writeQuotaFile(t, dir, "schedules.json", 100, 50, 50),
+		writeQuotaFile(t, dir, "plugins/auth.so", 200, 50, 50),
+		writeQuotaFile(t, dir, "resume/file.iso.json", 100, 50, 50),
+	}
+	cached := writeQuotaFile(t, dir, "cache/image.iso", 300, 10, 10)
+
+	quota := NewQuota(dir, 1200, types.QuotaPolicyOldest)
+
+	// State files count against the quota but only the cached file may go
+	if _, err := quota.Reserve(500); !errors.Is(err, gdlerrors.ErrQuotaExceeded) {
+		t.Fatalf("Reserve(500) error = %v, want ErrQuotaExceeded", err)
+	}
+
+	if _, err := quota.Reserve(300); err != nil {
+		t.Fatalf("Reserve(300) error = %v", err)
+	}
+
+	if exists(cached) {
+		t.Error("the cached file should have been evicted")
+	}
+
+	for _, path := range state {
+		if !exists(path) {
+			t.Errorf("state file %s was evicted", path)
+		}
+	}
+}
+
+func TestQuota_MissingDir(t *testing.T) {
+	quota := NewQuota(filepath.Join(t.TempDir(), "missing"), 100, "")
+
+	if _, err := quota.Reserve(50); err != nil {
+		t.Errorf("Reserve() error = %v, want a missing directory to be empty", err)
+	}
+
+	if _, err := quota.Reserve(100); !errors.Is(err, gdlerrors.ErrQuotaExceeded) {
+		t.Errorf("Reserve() error = %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestValidateQuotaPolicy(t *testing.T) {
+	for _, policy := range []string{"", types.QuotaPolicyRefuse, types.QuotaPolicyOldest, types.QuotaPolicyLRU} {
+		if err := ValidateQuotaPolicy(policy); err != nil {
+			t.Errorf("ValidateQuotaPolicy(%q) error = %v", policy, err)
+		}
+	}
+
+	if err := ValidateQuotaPolicy("fifo"); err == nil {
+		t.Error("ValidateQuotaPolicy(\"fifo\") should fail")
+	}
+}
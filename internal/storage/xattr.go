@@ -0,0 +1,30 @@
+package storage
+
+import (
+	stdErrors "errors"
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// ErrXattrUnsupported is returned by SetXattr when the platform or file
+// system cannot store extended attributes.
+var ErrXattrUnsupported = stdErrors.New("extended attributes not supported")
+
+// Extended attributes recording where a download came from. The origin URL
+// uses the freedesktop.org name that file managers and curl --xattr use.
+const (
+	XattrOriginURL = "user.xdg.origin.url"
+	XattrSHA256    = "user.checksum.sha256"
+)
+
+// SetXattr sets the extended attribute name of the file at path to value. It
+// is supported on Linux and macOS; elsewhere, and on file systems without
+// extended attributes, ErrXattrUnsupported is returned.
+func SetXattr(path, name string, value []byte) error {
+	err := setXattr(path, name, value)
+	if err == nil || stdErrors.Is(err, ErrXattrUnsupported) {
+		return err
+	}
+
+	return errors.NewStorageError("set extended attribute "+name, err, path)
+}
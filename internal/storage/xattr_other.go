@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package storage
+
+func setXattr(_, _ string, _ []byte) error {
+	return ErrXattrUnsupported
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package storage
+
+import (
+	stdErrors "errors"
+
+	"golang.org/x/sys/unix"
+)
+
+func setXattr(path, name string, value []byte) error {
+	err := unix.Setxattr(path, name, value, 0)
+	if stdErrors.Is(err, unix.ENOTSUP) || stdErrors.Is(err, unix.EOPNOTSUPP) {
+		return ErrXattrUnsupported
+	}
+
+	return err
+}
@@ -0,0 +1,40 @@
+//go:build linux || darwin
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSetXattr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := SetXattr(path, XattrOriginURL, []byte("https://example.com/file.txt"))
+	if errors.Is(err, ErrXattrUnsupported) {
+		t.Skip("file system does not support extended attributes")
+	}
+	if err != nil {
+		t.Fatalf("SetXattr() error = %v", err)
+	}
+
+	buf := make([]byte, 128)
+	n, err := unix.Getxattr(path, XattrOriginURL, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "https://example.com/file.txt" {
+		t.Errorf("%s = %q", XattrOriginURL, got)
+	}
+
+	if err := SetXattr(filepath.Join(t.TempDir(), "missing"), XattrOriginURL, nil); err == nil {
+		t.Error("SetXattr() of a missing file should fail")
+	}
+}
@@ -0,0 +1,510 @@
+package stream
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// maxDASHSegments bounds the segments a template may expand to, so that a
+// manifest with a tiny segment duration cannot exhaust memory.
+const maxDASHSegments = 1 << 20
+
+// mpd holds the parts of a DASH MPD that are downloaded.
+type mpd struct {
+	Type     string   `xml:"type,attr"`
+	Duration string   `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string   `xml:"BaseURL"`
+	Periods  []period `xml:"Period"`
+}
+
+type period struct {
+	Start          string          `xml:"start,attr"`
+	Duration       string          `xml:"duration,attr"`
+	BaseURL        string          `xml:"BaseURL"`
+	AdaptationSets []adaptationSet `xml:"AdaptationSet"`
+}
+
+type adaptationSet struct {
+	ContentType     string           `xml:"contentType,attr"`
+	MimeType        string           `xml:"mimeType,attr"`
+	BaseURL         string           `xml:"BaseURL"`
+	Protection      []struct{}       `xml:"ContentProtection"`
+	SegmentTemplate *segmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *segmentList     `xml:"SegmentList"`
+	Representations []representation `xml:"Representation"`
+}
+
+type representation struct {
+	ID              string           `xml:"id,attr"`
+	Bandwidth       int64            `xml:"bandwidth,attr"`
+	Width           int              `xml:"width,attr"`
+	Height          int              `xml:"height,attr"`
+	Codecs          string           `xml:"codecs,attr"`
+	MimeType        string           `xml:"mimeType,attr"`
+	BaseURL         string           `xml:"BaseURL"`
+	Protection      []struct{}       `xml:"ContentProtection"`
+	SegmentTemplate *segmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *segmentList     `xml:"SegmentList"`
+}
+
+type segmentTemplate struct {
+	Timescale      string `xml:"timescale,attr"`
+	Duration       string `xml:"duration,attr"`
+	StartNumber    string `xml:"startNumber,attr"`
+	Initialization string `xml:"initialization,attr"`
+	Media          string `xml:"media,attr"`
+	Timeline       *struct {
+		S []struct {
+			T *int64 `xml:"t,attr"`
+			D int64  `xml:"d,attr"`
+			R int64  `xml:"r,attr"`
+		} `xml:"S"`
+	} `xml:"SegmentTimeline"`
+}
+
+type segmentList struct {
+	Timescale      string `xml:"timescale,attr"`
+	Duration       string `xml:"duration,attr"`
+	Initialization *struct {
+		SourceURL string `xml:"sourceURL,attr"`
+		Range     string `xml:"range,attr"`
+	} `xml:"Initialization"`
+	SegmentURLs []struct {
+		Media      string `xml:"media,attr"`
+		MediaRange string `xml:"mediaRange,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// selectDASH picks the video and audio representations of each period of
+// an MPD and lists their segments. The representations of later periods
+// are appended to the tracks of the first.
+func selectDASH(opts *Options, base *url.URL, data []byte) ([]*Track, error) {
+	var manifest mpd
+	if err := xml.Unmarshal(data, &manifest); err != nil {
+		return nil, invalidDASH(base, "%v", err)
+	}
+
+	if manifest.Type == "dynamic" {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+			"live streams are not supported", base.Redacted()+" is a dynamic MPD")
+	}
+
+	mpdBase, err := joinBase(base, manifest.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	total, _ := parseISODuration(manifest.Duration)
+
+	var tracks []*Track
+	byKind := make(map[string]*Track)
+
+	for i, p := range manifest.Periods {
+		periodBase, err := joinBase(mpdBase, p.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		length, ok := parseISODuration(p.Duration)
+		if !ok {
+			start, _ := parseISODuration(p.Start)
+			length = total - start
+			if i+1 < len(manifest.Periods) {
+				if next, ok := parseISODuration(manifest.Periods[i+1].Start); ok {
+					length = next - start
+				}
+			}
+		}
+
+		for _, kind := range []string{KindVideo, KindAudio} {
+			if kind == KindAudio && opts.NoAudio && byKind[KindVideo] != nil {
+				continue
+			}
+
+			set, rep := pickRepresentation(p.AdaptationSets, kind, opts)
+			if rep == nil {
+				continue
+			}
+			if len(set.Protection) > 0 || len(rep.Protection) > 0 {
+				return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+					"DRM-protected streams are not supported", base.Redacted())
+			}
+
+			segments, err := dashSegments(periodBase, set, rep, length)
+			if err != nil {
+				return nil, err
+			}
+
+			track := byKind[kind]
+			if track == nil {
+				track = &Track{Kind: kind, ID: rep.ID, Bandwidth: rep.Bandwidth, Width: rep.Width,
+					Height: rep.Height, Codecs: rep.Codecs}
+				byKind[kind] = track
+				tracks = append(tracks, track)
+			}
+			track.Segments = append(track.Segments, segments...)
+		}
+	}
+
+	if len(tracks) == 0 {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+			"DASH manifest has no video or audio", base.Redacted())
+	}
+
+	return tracks, nil
+}
+
+// adaptationKind returns the kind of the representations of an adaptation
+// set: KindVideo (including sets that do not say), KindAudio, or "" for
+// subtitles, thumbnails and the like.
+func adaptationKind(set *adaptationSet) string {
+	kind := set.ContentType
+	if kind == "" {
+		mimeType := set.MimeType
+		if mimeType == "" && len(set.Representations) > 0 {
+			mimeType = set.Representations[0].MimeType
+		}
+		kind, _, _ = strings.Cut(mimeType, "/")
+	}
+
+	switch kind {
+	case KindAudio:
+		return KindAudio
+	case KindVideo, "":
+		return KindVideo
+	default:
+		return ""
+	}
+}
+
+// pickRepresentation returns the representation of kind to download: the
+// video within the bounds of opts, or the audio with the highest
+// bandwidth.
+func pickRepresentation(sets []adaptationSet, kind string, opts *Options) (*adaptationSet, *representation) {
+	var candidates []*Track
+	var owners []*adaptationSet
+	var reps []*representation
+
+	for i := range sets {
+		set := &sets[i]
+		if adaptationKind(set) != kind {
+			continue
+		}
+		for j := range set.Representations {
+			rep := &set.Representations[j]
+			candidates = append(candidates, &Track{Bandwidth: rep.Bandwidth, Height: rep.Height})
+			owners = append(owners, set)
+			reps = append(reps, rep)
+		}
+	}
+
+	if len(reps) == 0 {
+		return nil, nil
+	}
+
+	bounds := opts
+	if kind == KindAudio {
+		bounds = &Options{}
+	}
+	i := pickVariant(candidates, bounds)
+
+	return owners[i], reps[i]
+}
+
+// dashSegments lists the segments of a representation in a period of the
+// given length in seconds.
+func dashSegments(base *url.URL, set *adaptationSet, rep *representation, length float64) ([]Segment, error) {
+	setBase, err := joinBase(base, set.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	repBase, err := joinBase(setBase, rep.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if template := mergeTemplates(set.SegmentTemplate, rep.SegmentTemplate); template != nil {
+		return templateSegments(repBase, template, rep, length)
+	}
+
+	list := rep.SegmentList
+	if list == nil {
+		list = set.SegmentList
+	}
+	if list != nil {
+		return listSegments(repBase, list)
+	}
+
+	// A single file holding the whole representation
+	return []Segment{{URL: repBase.String(), Duration: length}}, nil
+}
+
+// mergeTemplates lays the attributes rep sets over those of set.
+func mergeTemplates(set, rep *segmentTemplate) *segmentTemplate {
+	if set == nil {
+		return rep
+	}
+	if rep == nil {
+		return set
+	}
+
+	merged := *set
+	for _, field := range []struct{ dst, src *string }{
+		{&merged.Timescale, &rep.Timescale},
+		{&merged.Duration, &rep.Duration},
+		{&merged.StartNumber, &rep.StartNumber},
+		{&merged.Initialization, &rep.Initialization},
+		{&merged.Media, &rep.Media},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	if rep.Timeline != nil {
+		merged.Timeline = rep.Timeline
+	}
+
+	return &merged
+}
+
+// templateSegments expands a SegmentTemplate.
+func templateSegments(base *url.URL, template *segmentTemplate, rep *representation, length float64) ([]Segment, error) {
+	timescale := parseIntAttr(template.Timescale, 1)
+	if timescale <= 0 {
+		timescale = 1
+	}
+	number := parseIntAttr(template.StartNumber, 1)
+
+	expand := func(pattern string, number, time int64) (string, error) {
+		return resolve(base, expandTemplate(pattern, rep, number, time))
+	}
+
+	var init *Segment
+	if template.Initialization != "" {
+		link, err := expand(template.Initialization, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		init = &Segment{URL: link}
+	}
+
+	if template.Media == "" {
+		return nil, invalidDASH(base, "representation %s has a SegmentTemplate without media", rep.ID)
+	}
+
+	var segments []Segment
+	add := func(time, duration int64) error {
+		if len(segments) >= maxDASHSegments {
+			return invalidDASH(base, "representation %s has over %d segments", rep.ID, maxDASHSegments)
+		}
+		link, err := expand(template.Media, number, time)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, Segment{URL: link, Duration: float64(duration) / float64(timescale),
+			Sequence: number, Init: init})
+		number++
+		return nil
+	}
+
+	if template.Timeline != nil {
+		end := int64(math.Round(length * float64(timescale)))
+		var time int64
+		for i, s := range template.Timeline.S {
+			if s.T != nil {
+				time = *s.T
+			}
+			if s.D <= 0 {
+				return nil, invalidDASH(base, "representation %s has a timeline entry without a duration", rep.ID)
+			}
+
+			repeat := s.R
+			if repeat < 0 {
+				// Repeat until the next entry or the end of the period
+				until := end
+				if i+1 < len(template.Timeline.S) && template.Timeline.S[i+1].T != nil {
+					until = *template.Timeline.S[i+1].T
+				}
+				repeat = (until-time+s.D-1)/s.D - 1
+			}
+
+			for r := int64(0); r <= repeat; r++ {
+				if err := add(time, s.D); err != nil {
+					return nil, err
+				}
+				time += s.D
+			}
+		}
+		return segments, nil
+	}
+
+	duration := parseIntAttr(template.Duration, 0)
+	if duration <= 0 || length <= 0 {
+		return nil, invalidDASH(base, "cannot tell how many segments representation %s has", rep.ID)
+	}
+
+	count := int64(math.Ceil(length * float64(timescale) / float64(duration)))
+	for i := int64(0); i < count; i++ {
+		segmentDuration := duration
+		if remaining := int64(math.Round(length*float64(timescale))) - i*duration; remaining < duration {
+			segmentDuration = remaining
+		}
+		if err := add(i*duration, segmentDuration); err != nil {
+			return nil, err
+		}
+	}
+
+	return segments, nil
+}
+
+// listSegments lists the segments of a SegmentList.
+func listSegments(base *url.URL, list *segmentList) ([]Segment, error) {
+	timescale := parseIntAttr(list.Timescale, 1)
+	if timescale <= 0 {
+		timescale = 1
+	}
+	duration := float64(parseIntAttr(list.Duration, 0)) / float64(timescale)
+
+	var init *Segment
+	if list.Initialization != nil {
+		link := base.String()
+		if list.Initialization.SourceURL != "" {
+			var err error
+			if link, err = resolve(base, list.Initialization.SourceURL); err != nil {
+				return nil, err
+			}
+		}
+		r, err := parseDASHRange(list.Initialization.Range)
+		if err != nil {
+			return nil, err
+		}
+		init = &Segment{URL: link, Range: r}
+	}
+
+	segments := make([]Segment, 0, len(list.SegmentURLs))
+	for i, entry := range list.SegmentURLs {
+		link := base.String()
+		if entry.Media != "" {
+			var err error
+			if link, err = resolve(base, entry.Media); err != nil {
+				return nil, err
+			}
+		}
+		r, err := parseDASHRange(entry.MediaRange)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, Segment{URL: link, Range: r, Duration: duration, Sequence: int64(i), Init: init})
+	}
+
+	return segments, nil
+}
+
+// templateIdentifier matches the identifiers of a segment template, such as
+// $Number$ or $Number%05d$.
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth|)(%0(\d+)d)?\$`)
+
+// expandTemplate fills in the identifiers of a segment template.
+func expandTemplate(pattern string, rep *representation, number, time int64) string {
+	return templateIdentifier.ReplaceAllStringFunc(pattern, func(match string) string {
+		parts := templateIdentifier.FindStringSubmatch(match)
+
+		var value string
+		switch parts[1] {
+		case "":
+			return "$"
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			value = strconv.FormatInt(number, 10)
+		case "Time":
+			value = strconv.FormatInt(time, 10)
+		case "Bandwidth":
+			value = strconv.FormatInt(rep.Bandwidth, 10)
+		}
+
+		if width, err := strconv.Atoi(parts[3]); err == nil && len(value) < width {
+			value = strings.Repeat("0", width-len(value)) + value
+		}
+
+		return value
+	})
+}
+
+// parseDASHRange parses a "FIRST-LAST" byte range, or returns nil for "".
+func parseDASHRange(value string) (*types.ByteRange, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	r, err := types.ParseByteRange(value)
+	if err != nil || r.Start < 0 || r.End < 0 {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+			fmt.Sprintf("invalid DASH manifest: invalid byte range %q", value), value)
+	}
+
+	return r, nil
+}
+
+// invalidDASH is the error for an MPD that cannot be downloaded as written.
+func invalidDASH(base *url.URL, format string, args ...interface{}) error {
+	return gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+		"invalid DASH manifest: "+fmt.Sprintf(format, args...), base.Redacted())
+}
+
+// joinBase resolves a BaseURL element against base.
+func joinBase(base *url.URL, ref string) (*url.URL, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return base, nil
+	}
+
+	u, err := base.Parse(ref)
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL in manifest", ref)
+	}
+
+	return u, nil
+}
+
+// parseIntAttr parses a numeric attribute, returning def if it is missing
+// or invalid.
+func parseIntAttr(value string, def int64) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return def
+	}
+
+	return n
+}
+
+// isoDuration matches the xs:duration values of MPDs, such as "PT1H2M3.5S".
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses an xs:duration into seconds. Years and months,
+// which have no fixed length, are not accepted.
+func parseISODuration(value string) (float64, bool) {
+	match := isoDuration.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || value == "P" || value == "PT" {
+		return 0, false
+	}
+
+	var seconds float64
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, _ := strconv.ParseFloat(match[i+1], 64)
+		seconds += n * unit
+	}
+
+	return seconds, true
+}
@@ -0,0 +1,186 @@
+package stream
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+const templateMPD = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT10S">
+  <BaseURL>media/</BaseURL>
+  <Period>
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <SegmentTemplate timescale="1000" duration="4000" startNumber="1"
+        initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/seg-$Number%03d$.m4s"/>
+      <Representation id="360p" bandwidth="800000" width="640" height="360" codecs="avc1.4d401e"/>
+      <Representation id="1080p" bandwidth="5000000" width="1920" height="1080" codecs="avc1.640028"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" mimeType="audio/mp4">
+      <Representation id="aac" bandwidth="128000">
+        <SegmentTemplate timescale="48000" initialization="aac/init.mp4" media="aac/$Time$.m4s">
+          <SegmentTimeline>
+            <S t="0" d="192000" r="1"/>
+            <S d="96000"/>
+          </SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="text" mimeType="text/vtt">
+      <Representation id="en" bandwidth="100"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+func TestSelectDASH_Template(t *testing.T) {
+	tracks, err := selectDASH(&Options{MaxHeight: 720}, mustParseURL(t, "https://example.com/vod/manifest.mpd"), []byte(templateMPD))
+	if err != nil {
+		t.Fatalf("selectDASH() error = %v", err)
+	}
+
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want video and audio", len(tracks))
+	}
+
+	video := tracks[0]
+	if video.Kind != KindVideo || video.ID != "360p" || video.Height != 360 {
+		t.Errorf("video track = %+v, want the 360p representation", video)
+	}
+
+	init := &Segment{URL: "https://example.com/vod/media/360p/init.mp4"}
+	wantVideo := []Segment{
+		{URL: "https://example.com/vod/media/360p/seg-001.m4s", Duration: 4, Sequence: 1, Init: init},
+		{URL: "https://example.com/vod/media/360p/seg-002.m4s", Duration: 4, Sequence: 2, Init: init},
+		{URL: "https://example.com/vod/media/360p/seg-003.m4s", Duration: 2, Sequence: 3, Init: init},
+	}
+	if !reflect.DeepEqual(video.Segments, wantVideo) {
+		t.Errorf("video segments = %+v, want %+v", video.Segments, wantVideo)
+	}
+
+	audio := tracks[1]
+	var urls []string
+	var duration float64
+	for _, segment := range audio.Segments {
+		urls = append(urls, strings.TrimPrefix(segment.URL, "https://example.com/vod/media/aac/"))
+		duration += segment.Duration
+	}
+	if want := []string{"0.m4s", "192000.m4s", "384000.m4s"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("audio segments = %v, want %v", urls, want)
+	}
+	if duration != 10 {
+		t.Errorf("audio duration = %v, want 10", duration)
+	}
+}
+
+func TestSelectDASH_NoAudio(t *testing.T) {
+	tracks, err := selectDASH(&Options{NoAudio: true}, mustParseURL(t, "https://example.com/manifest.mpd"), []byte(templateMPD))
+	if err != nil {
+		t.Fatalf("selectDASH() error = %v", err)
+	}
+
+	if len(tracks) != 1 || tracks[0].ID != "1080p" {
+		t.Errorf("selectDASH() picked %d tracks, want the 1080p video alone", len(tracks))
+	}
+}
+
+func TestSelectDASH_SegmentList(t *testing.T) {
+	data := `<MPD type="static" mediaPresentationDuration="PT4S">
+  <Period>
+    <AdaptationSet mimeType="video/mp4">
+      <Representation id="v" bandwidth="1000">
+        <BaseURL>https://cdn.example.com/movie.mp4</BaseURL>
+        <SegmentList timescale="10" duration="20">
+          <Initialization range="0-99"/>
+          <SegmentURL mediaRange="100-199"/>
+          <SegmentURL mediaRange="200-299"/>
+        </SegmentList>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	tracks, err := selectDASH(&Options{}, mustParseURL(t, "https://example.com/manifest.mpd"), []byte(data))
+	if err != nil {
+		t.Fatalf("selectDASH() error = %v", err)
+	}
+
+	init := &Segment{URL: "https://cdn.example.com/movie.mp4", Range: &types.ByteRange{Start: 0, End: 99}}
+	want := []Segment{
+		{URL: "https://cdn.example.com/movie.mp4", Range: &types.ByteRange{Start: 100, End: 199}, Duration: 2, Init: init},
+		{URL: "https://cdn.example.com/movie.mp4", Range: &types.ByteRange{Start: 200, End: 299}, Duration: 2, Sequence: 1, Init: init},
+	}
+	if len(tracks) != 1 || !reflect.DeepEqual(tracks[0].Segments, want) {
+		t.Errorf("selectDASH() segments = %+v, want %+v", tracks[0].Segments, want)
+	}
+}
+
+func TestSelectDASH_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"live", `<MPD type="dynamic"></MPD>`, "live streams"},
+		{"DRM", `<MPD><Period><AdaptationSet mimeType="video/mp4"><ContentProtection/>
+			<Representation id="v"/></AdaptationSet></Period></MPD>`, "DRM"},
+		{"no media", `<MPD><Period></Period></MPD>`, "no video or audio"},
+		{"no segment count", `<MPD><Period><AdaptationSet mimeType="video/mp4">
+			<SegmentTemplate media="$Number$.m4s" duration="4"/><Representation id="v"/></AdaptationSet></Period></MPD>`,
+			"cannot tell how many segments"},
+		{"not XML", `<MPD`, "invalid DASH manifest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := selectDASH(&Options{}, mustParseURL(t, "https://example.com/m.mpd"), []byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("selectDASH() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	rep := &representation{ID: "v1", Bandwidth: 500000}
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"$RepresentationID$/$Number$.m4s", "v1/7.m4s"},
+		{"seg-$Number%05d$.m4s", "seg-00007.m4s"},
+		{"$Time$-$Bandwidth$.m4s", "90000-500000.m4s"},
+		{"cost$$.m4s", "cost$.m4s"},
+	}
+
+	for _, tt := range tests {
+		if got := expandTemplate(tt.pattern, rep, 7, 90000); got != tt.want {
+			t.Errorf("expandTemplate(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"PT10S", 10, true},
+		{"PT1H2M3.5S", 3723.5, true},
+		{"P1DT1S", 86401, true},
+		{"PT0S", 0, true},
+		{"P1Y", 0, false},
+		{"PT", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseISODuration(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseISODuration(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package stream
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// download fetches the segments of the tracks of result and writes them to
+// result.Files.
+func download(ctx context.Context, opts *Options, result *Result) error {
+	total := 0
+	for _, track := range result.Tracks {
+		total += len(track.Segments)
+	}
+
+	keys := &keyCache{fetch: opts.Fetch, keys: make(map[string]*keyEntry)}
+
+	for i, track := range result.Tracks {
+		var w trackWriter
+		var err error
+		if opts.KeepSegments {
+			w, err = newSegmentsWriter(result.Files[i])
+		} else {
+			w, err = newConcatWriter(result.Files[i])
+		}
+		if err != nil {
+			return err
+		}
+
+		var lastInit *Segment
+		err = fetchTrack(ctx, opts, keys, track, func(segment *Segment, data []byte) error {
+			if segment.Init != nil && !sameSegment(segment.Init, lastInit) {
+				init, err := fetchSegment(ctx, opts.Fetch, keys, segment.Init)
+				if err != nil {
+					return fmt.Errorf("initialization segment of track %s: %w", trackName(track), err)
+				}
+				if err := w.writeInit(segment.Init, init); err != nil {
+					return err
+				}
+				lastInit = segment.Init
+			}
+
+			if err := w.writeSegment(segment, data); err != nil {
+				return err
+			}
+
+			result.Segments++
+			result.Bytes += int64(len(data))
+			if opts.Progress != nil {
+				opts.Progress(result.Segments, total)
+			}
+
+			return nil
+		})
+		if err != nil {
+			w.abort()
+			return err
+		}
+
+		if err := w.commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetched is the content of a segment, or the error fetching it.
+type fetched struct {
+	data []byte
+	err  error
+}
+
+// fetchTrack fetches the segments of track opts.Concurrency at a time and
+// passes them to write in order. At most twice as many segments as are
+// fetched at once are held in memory.
+func fetchTrack(ctx context.Context, opts *Options, keys *keyCache, track *Track, write func(*Segment, []byte) error) error {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	results := make([]chan fetched, len(track.Segments))
+	for i := range results {
+		results[i] = make(chan fetched, 1)
+	}
+
+	window := make(chan struct{}, 2*concurrency)
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range track.Segments {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				data, err := fetchSegment(ctx, opts.Fetch, keys, &track.Segments[i])
+				results[i] <- fetched{data, err}
+			}
+		}()
+	}
+
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for i := range track.Segments {
+		var result fetched
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if result.err != nil {
+			return fmt.Errorf("segment %d of %d of track %s: %w", i+1, len(track.Segments), trackName(track), result.err)
+		}
+		if err := write(&track.Segments[i], result.data); err != nil {
+			return err
+		}
+
+		<-window
+	}
+
+	return nil
+}
+
+// fetchSegment fetches a segment and decrypts it.
+func fetchSegment(ctx context.Context, fetch Fetcher, keys *keyCache, segment *Segment) ([]byte, error) {
+	data, err := fetch(ctx, segment.URL, segment.Range)
+	if err != nil {
+		return nil, err
+	}
+
+	if segment.Key == nil {
+		return data, nil
+	}
+
+	key, err := keys.get(ctx, segment.Key.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptAES128(data, key, segment.Key.IV, segment.Sequence)
+}
+
+// sameSegment reports whether a and b are the same piece of the same URL.
+func sameSegment(a, b *Segment) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || a.URL != b.URL {
+		return false
+	}
+	if a.Range == nil || b.Range == nil {
+		return a.Range == b.Range
+	}
+
+	return *a.Range == *b.Range
+}
+
+// keyCache fetches each AES-128 key once.
+type keyCache struct {
+	fetch Fetcher
+	mu    sync.Mutex
+	keys  map[string]*keyEntry
+}
+
+// keyEntry is a key being fetched or fetched.
+type keyEntry struct {
+	once sync.Once
+	key  []byte
+	err  error
+}
+
+// get returns the key at keyURL.
+func (c *keyCache) get(ctx context.Context, keyURL string) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.keys[keyURL]
+	if !ok {
+		entry = &keyEntry{}
+		c.keys[keyURL] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.key, entry.err = c.fetch(ctx, keyURL, nil)
+		if entry.err == nil && len(entry.key) != aes.BlockSize {
+			entry.err = gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeCorruptedData, "invalid AES-128 key",
+				fmt.Sprintf("%s holds %d bytes instead of %d", keyURL, len(entry.key), aes.BlockSize))
+		}
+	})
+
+	return entry.key, entry.err
+}
+
+// decryptAES128 decrypts an AES-128-CBC segment with PKCS#7 padding. Without
+// an IV, the media sequence number of the segment is the IV.
+func decryptAES128(data, key, iv []byte, sequence int64) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if iv == nil {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], uint64(sequence)) // #nosec G115 -- sequence numbers are not negative
+	}
+
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeCorruptedData, "cannot decrypt segment",
+			fmt.Sprintf("%d bytes is not a whole number of AES blocks", len(data)))
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeCorruptedData, "cannot decrypt segment",
+			"invalid padding; the key or IV is wrong")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeCorruptedData, "cannot decrypt segment",
+				"invalid padding; the key or IV is wrong")
+		}
+	}
+
+	return plain[:len(plain)-padding], nil
+}
+
+// trackWriter writes the segments of a track in order.
+type trackWriter interface {
+	writeInit(init *Segment, data []byte) error
+	writeSegment(segment *Segment, data []byte) error
+	commit() error
+	abort()
+}
+
+// concatWriter concatenates the segments of a track into one file, written
+// to a temporary file that replaces dest once complete.
+type concatWriter struct {
+	dest string
+	file *os.File
+}
+
+func newConcatWriter(dest string) (*concatWriter, error) {
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to create the destination directory")
+	}
+
+	file, err := os.CreateTemp(dir, "."+filepath.Base(dest)+".*.part")
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to create the destination file")
+	}
+
+	return &concatWriter{dest: dest, file: file}, nil
+}
+
+func (w *concatWriter) writeInit(_ *Segment, data []byte) error {
+	return w.write(data)
+}
+
+func (w *concatWriter) writeSegment(_ *Segment, data []byte) error {
+	return w.write(data)
+}
+
+func (w *concatWriter) write(data []byte) error {
+	if _, err := w.file.Write(data); err != nil {
+		return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to write "+w.dest)
+	}
+
+	return nil
+}
+
+func (w *concatWriter) commit() error {
+	if err := w.file.Close(); err != nil {
+		_ = os.Remove(w.file.Name())
+		return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to write "+w.dest)
+	}
+
+	if err := os.Rename(w.file.Name(), w.dest); err != nil {
+		_ = os.Remove(w.file.Name())
+		return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to move the download into place")
+	}
+
+	return nil
+}
+
+func (w *concatWriter) abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+// segmentsWriter writes the segments of a track as separate files in a
+// directory, with a local playlist listing them. They are written to a
+// temporary directory next to it and moved into place once complete.
+type segmentsWriter struct {
+	dir      string
+	temp     string
+	playlist strings.Builder
+	inits    int
+	segments int
+	longest  float64
+}
+
+func newSegmentsWriter(dir string) (*segmentsWriter, error) {
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o750); err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to create the segment directory")
+	}
+
+	temp, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+".*.part")
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to create the segment directory")
+	}
+
+	return &segmentsWriter{dir: dir, temp: temp}, nil
+}
+
+func (w *segmentsWriter) writeInit(init *Segment, data []byte) error {
+	w.inits++
+	name := fmt.Sprintf("init-%d%s", w.inits, extension(init.URL, ".mp4"))
+
+	if err := w.writeFile(name, data); err != nil {
+		return err
+	}
+
+	if w.segments > 0 {
+		w.playlist.WriteString("#EXT-X-DISCONTINUITY\n")
+	}
+	fmt.Fprintf(&w.playlist, "#EXT-X-MAP:URI=%q\n", name)
+
+	return nil
+}
+
+func (w *segmentsWriter) writeSegment(segment *Segment, data []byte) error {
+	w.segments++
+
+	fallback := ".ts"
+	if segment.Init != nil {
+		fallback = ".m4s"
+	}
+	name := fmt.Sprintf("%05d%s", w.segments, extension(segment.URL, fallback))
+
+	if err := w.writeFile(name, data); err != nil {
+		return err
+	}
+
+	w.longest = max(w.longest, segment.Duration)
+	fmt.Fprintf(&w.playlist, "#EXTINF:%.3f,\n%s\n", segment.Duration, name)
+
+	return nil
+}
+
+func (w *segmentsWriter) writeFile(name string, data []byte) error {
+	if err := os.WriteFile(filepath.Join(w.temp, name), data, 0o600); err != nil {
+		return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to write segment "+name)
+	}
+
+	return nil
+}
+
+// commit writes the playlist and moves the files into place: the temporary
+// directory becomes the directory, or its files are moved into one that
+// exists already.
+func (w *segmentsWriter) commit() error {
+	header := fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:%d\n#EXT-X-PLAYLIST-TYPE:VOD\n",
+		int(w.longest+0.999))
+
+	if err := w.writeFile("index.m3u8", []byte(header+w.playlist.String()+"#EXT-X-ENDLIST\n")); err != nil {
+		w.abort()
+		return err
+	}
+
+	if err := os.Rename(w.temp, w.dir); err == nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(w.temp)
+	if err != nil {
+		w.abort()
+		return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to move the segments into place")
+	}
+
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(w.temp, entry.Name()), filepath.Join(w.dir, entry.Name())); err != nil {
+			w.abort()
+			return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "failed to move the segments into place")
+		}
+	}
+
+	w.abort()
+
+	return nil
+}
+
+// abort removes the temporary directory and the segments written to it.
+func (w *segmentsWriter) abort() {
+	_ = os.RemoveAll(w.temp)
+}
+
+// extension returns the extension of the path of rawURL, or fallback if it
+// has none or one that is not letters and digits, such as an escaped newline
+// that would break the playlist.
+func extension(rawURL, fallback string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fallback
+	}
+
+	ext := path.Ext(u.Path)
+	if len(ext) < 2 || len(ext) > 6 {
+		return fallback
+	}
+
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fallback
+		}
+	}
+
+	return ext
+}
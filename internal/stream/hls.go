@@ -0,0 +1,401 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// hlsPlaylist is a parsed HLS playlist: a master playlist listing variants,
+// or a media playlist listing segments.
+type hlsPlaylist struct {
+	variants   []*hlsVariant
+	renditions []hlsRendition
+
+	segments []Segment
+	ended    bool
+}
+
+// hlsVariant is an EXT-X-STREAM-INF entry of a master playlist.
+type hlsVariant struct {
+	track      *Track
+	audioGroup string
+}
+
+// hlsRendition is an EXT-X-MEDIA entry of a master playlist.
+type hlsRendition struct {
+	kind      string
+	group     string
+	name      string
+	isDefault bool
+	url       string
+}
+
+// selectHLS picks the variant of an HLS playlist, and its audio rendition,
+// and reads their segments.
+func selectHLS(ctx context.Context, opts *Options, base *url.URL, data []byte) ([]*Track, error) {
+	playlist, err := parseHLS(base, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(playlist.variants) == 0 {
+		if !playlist.ended {
+			return nil, errLive(base.String())
+		}
+		return []*Track{{ID: "main", Segments: playlist.segments}}, nil
+	}
+
+	tracks := make([]*Track, len(playlist.variants))
+	for i, variant := range playlist.variants {
+		tracks[i] = variant.track
+	}
+	variant := playlist.variants[pickVariant(tracks, opts)]
+
+	selected := []*Track{variant.track}
+	if rendition := audioRendition(playlist.renditions, variant.audioGroup); rendition != nil && !opts.NoAudio {
+		selected = append(selected, &Track{Kind: KindAudio, ID: rendition.name, URL: rendition.url})
+		if variant.track.Height > 0 {
+			variant.track.Kind = KindVideo
+		}
+	}
+
+	for _, track := range selected {
+		if err := loadHLSTrack(ctx, opts.Fetch, track); err != nil {
+			return nil, err
+		}
+	}
+
+	return selected, nil
+}
+
+// audioRendition returns the audio rendition of group that has its own
+// playlist, preferring the default one, or nil if the audio is part of the
+// variant.
+func audioRendition(renditions []hlsRendition, group string) *hlsRendition {
+	if group == "" {
+		return nil
+	}
+
+	var found *hlsRendition
+	for i := range renditions {
+		rendition := &renditions[i]
+		if rendition.kind != "AUDIO" || rendition.group != group || rendition.url == "" {
+			continue
+		}
+		if rendition.isDefault {
+			return rendition
+		}
+		if found == nil {
+			found = rendition
+		}
+	}
+
+	return found
+}
+
+// loadHLSTrack reads the segments of a track from its media playlist.
+func loadHLSTrack(ctx context.Context, fetch Fetcher, track *Track) error {
+	data, err := fetchManifest(ctx, fetch, track.URL)
+	if err != nil {
+		return err
+	}
+
+	base, err := url.Parse(track.URL)
+	if err != nil {
+		return gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", track.URL)
+	}
+
+	playlist, err := parseHLS(base, data)
+	if err != nil {
+		return err
+	}
+	if len(playlist.variants) > 0 {
+		return gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+			"variant playlist is a master playlist", track.URL)
+	}
+	if !playlist.ended {
+		return errLive(track.URL)
+	}
+
+	track.Segments = playlist.segments
+	track.URL = ""
+
+	return nil
+}
+
+// errLive is the error for a playlist that has no end.
+func errLive(playlistURL string) error {
+	return gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+		"live streams are not supported", playlistURL+" has no #EXT-X-ENDLIST")
+}
+
+// parseHLS parses an HLS playlist, resolving its URLs against base.
+func parseHLS(base *url.URL, data []byte) (*hlsPlaylist, error) {
+	playlist := &hlsPlaylist{}
+
+	var (
+		sequence   int64
+		duration   float64
+		key        *Key
+		init       *Segment
+		byteRange  *types.ByteRange
+		lastURL    string
+		lastEnd    int64 = -1
+		streamInf  map[string]string
+		seenHeader bool
+	)
+
+	invalid := func(line int, format string, args ...interface{}) error {
+		return gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+			"invalid HLS playlist: "+fmt.Sprintf(format, args...), fmt.Sprintf("%s line %d", base.Redacted(), line))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	scanner.Buffer(make([]byte, 64*1024), maxManifestSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if !seenHeader {
+			if text != "#EXTM3U" {
+				return nil, invalid(line, "playlist does not start with #EXTM3U")
+			}
+			seenHeader = true
+			continue
+		}
+
+		if !strings.HasPrefix(text, "#") {
+			link, err := resolve(base, text)
+			if err != nil {
+				return nil, err
+			}
+
+			if streamInf != nil {
+				playlist.variants = append(playlist.variants, newHLSVariant(streamInf, link))
+				streamInf = nil
+				continue
+			}
+
+			segment := Segment{URL: link, Duration: duration, Key: key, Sequence: sequence, Init: init}
+			if byteRange != nil {
+				if byteRange.Start < 0 {
+					// No offset: the range follows the previous one
+					if lastURL != link || lastEnd < 0 {
+						return nil, invalid(line, "byte range without an offset does not follow a range of the same URL")
+					}
+					length := byteRange.End - byteRange.Start
+					byteRange = &types.ByteRange{Start: lastEnd + 1, End: lastEnd + length}
+				}
+				segment.Range = byteRange
+				lastEnd = byteRange.End
+			} else {
+				lastEnd = -1
+			}
+			lastURL = link
+
+			playlist.segments = append(playlist.segments, segment)
+			sequence++
+			duration, byteRange = 0, nil
+			continue
+		}
+
+		tag, value, _ := strings.Cut(text, ":")
+		switch tag {
+		case "#EXT-X-STREAM-INF":
+			streamInf = parseAttributes(value)
+		case "#EXT-X-MEDIA":
+			attrs := parseAttributes(value)
+			rendition := hlsRendition{
+				kind:      attrs["TYPE"],
+				group:     attrs["GROUP-ID"],
+				name:      attrs["NAME"],
+				isDefault: attrs["DEFAULT"] == "YES",
+			}
+			if uri := attrs["URI"]; uri != "" {
+				link, err := resolve(base, uri)
+				if err != nil {
+					return nil, err
+				}
+				rendition.url = link
+			}
+			playlist.renditions = append(playlist.renditions, rendition)
+		case "#EXT-X-MEDIA-SEQUENCE":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, invalid(line, "invalid media sequence %q", value)
+			}
+			sequence = n
+		case "#EXTINF":
+			seconds, _, _ := strings.Cut(value, ",")
+			d, err := strconv.ParseFloat(strings.TrimSpace(seconds), 64)
+			if err != nil || d < 0 {
+				return nil, invalid(line, "invalid segment duration %q", seconds)
+			}
+			duration = d
+		case "#EXT-X-BYTERANGE":
+			r, err := parseHLSByteRange(value)
+			if err != nil {
+				return nil, invalid(line, "%v", err)
+			}
+			byteRange = r
+		case "#EXT-X-KEY":
+			k, err := parseHLSKey(base, parseAttributes(value))
+			if err != nil {
+				return nil, invalid(line, "%v", err)
+			}
+			key = k
+		case "#EXT-X-MAP":
+			attrs := parseAttributes(value)
+			link, err := resolve(base, attrs["URI"])
+			if err != nil {
+				return nil, err
+			}
+			init = &Segment{URL: link, Key: key, Sequence: sequence}
+			if attrs["BYTERANGE"] != "" {
+				r, err := parseHLSByteRange(attrs["BYTERANGE"])
+				if err != nil || r.Start < 0 {
+					return nil, invalid(line, "invalid EXT-X-MAP byte range %q", attrs["BYTERANGE"])
+				}
+				init.Range = r
+			}
+		case "#EXT-X-ENDLIST":
+			playlist.ended = true
+		case "#EXT-X-PLAYLIST-TYPE":
+			if value == "VOD" {
+				playlist.ended = true
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "failed to read HLS playlist", base.Redacted())
+	}
+
+	if !seenHeader {
+		return nil, invalid(1, "playlist is empty")
+	}
+
+	return playlist, nil
+}
+
+// newHLSVariant returns the variant of an EXT-X-STREAM-INF tag.
+func newHLSVariant(attrs map[string]string, link string) *hlsVariant {
+	track := &Track{URL: link, ID: link, Codecs: attrs["CODECS"]}
+
+	if bandwidth, err := strconv.ParseInt(attrs["BANDWIDTH"], 10, 64); err == nil {
+		track.Bandwidth = bandwidth
+	}
+
+	if width, height, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+		track.Width, _ = strconv.Atoi(width)
+		track.Height, _ = strconv.Atoi(height)
+		track.ID = attrs["RESOLUTION"]
+	}
+
+	return &hlsVariant{track: track, audioGroup: attrs["AUDIO"]}
+}
+
+// parseHLSByteRange parses "LENGTH[@OFFSET]". Without an offset, the range
+// returned has a Start of -1 and an End of LENGTH-1, for the caller to move
+// after the previous range.
+func parseHLSByteRange(value string) (*types.ByteRange, error) {
+	lengthText, offsetText, hasOffset := strings.Cut(strings.TrimSpace(value), "@")
+
+	length, err := strconv.ParseInt(lengthText, 10, 64)
+	if err != nil || length <= 0 {
+		return nil, fmt.Errorf("invalid byte range %q", value)
+	}
+
+	if !hasOffset {
+		return &types.ByteRange{Start: -1, End: length - 1}, nil
+	}
+
+	offset, err := strconv.ParseInt(offsetText, 10, 64)
+	if err != nil || offset < 0 {
+		return nil, fmt.Errorf("invalid byte range %q", value)
+	}
+
+	return &types.ByteRange{Start: offset, End: offset + length - 1}, nil
+}
+
+// parseHLSKey returns the key of an EXT-X-KEY tag, or nil for METHOD=NONE.
+func parseHLSKey(base *url.URL, attrs map[string]string) (*Key, error) {
+	switch method := attrs["METHOD"]; method {
+	case "NONE":
+		return nil, nil
+	case "AES-128":
+	default:
+		return nil, fmt.Errorf("encryption method %s is not supported", method)
+	}
+
+	if format := attrs["KEYFORMAT"]; format != "" && format != "identity" {
+		return nil, fmt.Errorf("key format %s (DRM) is not supported", format)
+	}
+
+	if attrs["URI"] == "" {
+		return nil, fmt.Errorf("AES-128 key has no URI")
+	}
+
+	link, err := resolve(base, attrs["URI"])
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{URL: link}
+
+	if iv := attrs["IV"]; iv != "" {
+		digits := strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X")
+		if len(digits) < 32 {
+			digits = strings.Repeat("0", 32-len(digits)) + digits
+		}
+		decoded, err := hex.DecodeString(digits)
+		if err != nil || len(decoded) != 16 {
+			return nil, fmt.Errorf("invalid IV %q", iv)
+		}
+		key.IV = decoded
+	}
+
+	return key, nil
+}
+
+// parseAttributes parses an HLS attribute list: comma-separated NAME=VALUE
+// pairs whose values may be quoted strings holding commas.
+func parseAttributes(list string) map[string]string {
+	attrs := make(map[string]string)
+
+	for list != "" {
+		name, rest, ok := strings.Cut(list, "=")
+		if !ok {
+			break
+		}
+		name = strings.TrimSpace(name)
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, list = rest[1:], ""
+			} else {
+				value, list = rest[1:end+1], rest[end+2:]
+			}
+			list = strings.TrimPrefix(strings.TrimLeft(list, " "), ",")
+		} else {
+			value, list, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+
+		attrs[name] = value
+	}
+
+	return attrs
+}
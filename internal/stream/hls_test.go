@@ -0,0 +1,172 @@
+package stream
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+const masterPlaylist = `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=NO,URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Original",DEFAULT=YES,URI="audio/orig.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2",AUDIO="aac"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="aac"
+mid/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,CODECS="avc1.640028,mp4a.40.2",AUDIO="aac"
+https://cdn.example.com/high/index.m3u8
+`
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func TestParseHLS_Master(t *testing.T) {
+	playlist, err := parseHLS(mustParseURL(t, "https://example.com/vod/master.m3u8"), []byte(masterPlaylist))
+	if err != nil {
+		t.Fatalf("parseHLS() error = %v", err)
+	}
+
+	if len(playlist.variants) != 3 {
+		t.Fatalf("got %d variants, want 3", len(playlist.variants))
+	}
+
+	mid := playlist.variants[1]
+	want := &Track{ID: "1280x720", Bandwidth: 2500000, Width: 1280, Height: 720,
+		Codecs: "avc1.4d401f,mp4a.40.2", URL: "https://example.com/vod/mid/index.m3u8"}
+	if !reflect.DeepEqual(mid.track, want) {
+		t.Errorf("variant = %+v, want %+v", mid.track, want)
+	}
+	if mid.audioGroup != "aac" {
+		t.Errorf("audio group = %q, want aac", mid.audioGroup)
+	}
+	if got := playlist.variants[2].track.URL; got != "https://cdn.example.com/high/index.m3u8" {
+		t.Errorf("absolute variant URL = %q", got)
+	}
+
+	rendition := audioRendition(playlist.renditions, "aac")
+	if rendition == nil || rendition.url != "https://example.com/vod/audio/orig.m3u8" {
+		t.Errorf("audioRendition() = %+v, want the default rendition", rendition)
+	}
+	if audioRendition(playlist.renditions, "") != nil {
+		t.Error("audioRendition() found a rendition for a variant without an audio group")
+	}
+}
+
+func TestParseHLS_Media(t *testing.T) {
+	data := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+#EXTINF:6.0,
+#EXT-X-BYTERANGE:1000@720
+media.mp4
+#EXTINF:4.5,
+#EXT-X-BYTERANGE:500
+media.mp4
+#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/k1",IV=0x1
+#EXTINF:6.0,title
+seg3.m4s
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:2,
+seg4.m4s
+#EXT-X-ENDLIST
+`
+
+	playlist, err := parseHLS(mustParseURL(t, "https://example.com/a/b.m3u8"), []byte(data))
+	if err != nil {
+		t.Fatalf("parseHLS() error = %v", err)
+	}
+
+	if !playlist.ended {
+		t.Error("playlist with #EXT-X-ENDLIST is not ended")
+	}
+	if len(playlist.segments) != 4 {
+		t.Fatalf("got %d segments, want 4", len(playlist.segments))
+	}
+
+	init := &Segment{URL: "https://example.com/a/init.mp4", Range: &types.ByteRange{Start: 0, End: 719}, Sequence: 10}
+	iv := make([]byte, 16)
+	iv[15] = 1
+	want := []Segment{
+		{URL: "https://example.com/a/media.mp4", Range: &types.ByteRange{Start: 720, End: 1719}, Duration: 6, Sequence: 10, Init: init},
+		{URL: "https://example.com/a/media.mp4", Range: &types.ByteRange{Start: 1720, End: 2219}, Duration: 4.5, Sequence: 11, Init: init},
+		{URL: "https://example.com/a/seg3.m4s", Duration: 6, Sequence: 12, Init: init,
+			Key: &Key{URL: "https://keys.example.com/k1", IV: iv}},
+		{URL: "https://example.com/a/seg4.m4s", Duration: 2, Sequence: 13, Init: init},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(playlist.segments[i], want[i]) {
+			t.Errorf("segment %d = %+v, want %+v", i, playlist.segments[i], want[i])
+		}
+	}
+}
+
+func TestParseHLS_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"not a playlist", "<html></html>", "does not start with #EXTM3U"},
+		{"empty", "", "empty"},
+		{"bad duration", "#EXTM3U\n#EXTINF:abc,\nseg.ts\n", "invalid segment duration"},
+		{"range without offset first", "#EXTM3U\n#EXTINF:1,\n#EXT-X-BYTERANGE:100\nseg.ts\n", "does not follow"},
+		{"sample AES", "#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\"\n", "SAMPLE-AES is not supported"},
+		{"DRM key format", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",KEYFORMAT=\"com.apple.streamingkeydelivery\"\n", "DRM"},
+		{"key without URI", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128\n", "no URI"},
+		{"bad IV", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0xZZ\n", "invalid IV"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseHLS(mustParseURL(t, "https://example.com/p.m3u8"), []byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseHLS() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	got := parseAttributes(`BANDWIDTH=1280000, CODECS="avc1.42e00a,mp4a.40.2",RESOLUTION=416x234,NAME="a, b"`)
+	want := map[string]string{
+		"BANDWIDTH":  "1280000",
+		"CODECS":     "avc1.42e00a,mp4a.40.2",
+		"RESOLUTION": "416x234",
+		"NAME":       "a, b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAttributes() = %v, want %v", got, want)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"\xef\xbb\xbf#EXTM3U\n", FormatHLS},
+		{"\n  #EXTM3U\n", FormatHLS},
+		{`<?xml version="1.0"?><MPD xmlns="urn:mpeg:dash:schema:mpd:2011"></MPD>`, FormatDASH},
+		{"<html></html>", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Detect([]byte(tt.data)); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
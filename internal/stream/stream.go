@@ -0,0 +1,301 @@
+// Package stream downloads streaming media described by a manifest: HLS
+// playlists (.m3u8) and DASH MPDs (.mpd). It picks a variant, fetches its
+// segments several at a time, decrypts AES-128 segments with the keys the
+// playlist names, and writes the segments in order, either concatenated into
+// one file per track (MPEG-TS or fragmented MP4) or as separate files.
+//
+// Live streams, which have no end, are not supported.
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// Manifest formats.
+const (
+	FormatHLS  = "hls"
+	FormatDASH = "dash"
+)
+
+// DefaultConcurrency is the number of segments fetched at once when
+// Options.Concurrency is not set.
+const DefaultConcurrency = 4
+
+// maxManifestSize bounds the size of a playlist or MPD.
+const maxManifestSize = 16 << 20
+
+// Fetcher fetches url, or the byte range r of it when r is not nil, into
+// memory.
+type Fetcher func(ctx context.Context, url string, r *types.ByteRange) ([]byte, error)
+
+// Kinds of Track.
+const (
+	KindVideo = "video"
+	KindAudio = "audio"
+)
+
+// Track is one rendition of the media: a sequence of segments played one
+// after the other, such as the video or the audio of a program.
+type Track struct {
+	// Kind is KindVideo, KindAudio, or empty when the manifest does not
+	// say.
+	Kind string
+
+	// ID names the rendition in the manifest.
+	ID string
+
+	// Bandwidth is the peak bit rate of the rendition in bits per second,
+	// or 0 if unknown.
+	Bandwidth int64
+
+	// Width and Height are the video resolution, or 0 if unknown.
+	Width, Height int
+
+	// Codecs lists the codecs of the rendition, as the manifest gives them.
+	Codecs string
+
+	// URL is where the segment list of the track is read from: the media
+	// playlist of an HLS variant. It is empty once Segments are known.
+	URL string
+
+	// Segments are the media segments in playback order.
+	Segments []Segment
+}
+
+// Segment is a piece of a track.
+type Segment struct {
+	// URL is the absolute URL of the segment.
+	URL string
+
+	// Range is the byte range of URL holding the segment, or nil for all of
+	// it.
+	Range *types.ByteRange
+
+	// Duration is the length of the segment in seconds, or 0 if unknown.
+	Duration float64
+
+	// Key decrypts the segment, or is nil for clear segments.
+	Key *Key
+
+	// Sequence is the media sequence number of the segment, which AES-128
+	// keys without an IV use as the IV.
+	Sequence int64
+
+	// Init is the initialization section that precedes the segment, such as
+	// the fragmented MP4 header, or nil.
+	Init *Segment
+}
+
+// Key is an AES-128 key that decrypts segments.
+type Key struct {
+	// URL is where the 16-byte key is fetched from.
+	URL string
+
+	// IV is the initialization vector, or nil to use the segment's media
+	// sequence number.
+	IV []byte
+}
+
+// Options configures Download.
+type Options struct {
+	// Fetch fetches manifests, keys and segments. It is required.
+	Fetch Fetcher
+
+	// Concurrency is the number of segments fetched at once
+	// (DefaultConcurrency if 0).
+	Concurrency int
+
+	// MaxBandwidth and MaxHeight bound the variant picked: the one with the
+	// highest bandwidth among those within the bounds, or the smallest one
+	// if none is (0 = unbounded).
+	MaxBandwidth int64
+	MaxHeight    int
+
+	// NoAudio skips the separate audio track of HLS variants and DASH
+	// programs.
+	NoAudio bool
+
+	// KeepSegments writes the segments of each track as separate files in a
+	// directory named after the destination, with a local playlist
+	// (index.m3u8), instead of concatenating them.
+	KeepSegments bool
+
+	// Progress is called after each segment is written, with the number of
+	// segments written and their total over all tracks.
+	Progress func(done, total int)
+}
+
+// Result describes a finished download.
+type Result struct {
+	// Format is FormatHLS or FormatDASH.
+	Format string
+
+	// Tracks are the tracks downloaded, and Files where each of them was
+	// written: a file, or a directory with KeepSegments.
+	Tracks []*Track
+	Files  []string
+
+	// Segments and Bytes count the segments written and their size after
+	// decryption.
+	Segments int
+	Bytes    int64
+
+	// Duration is the length of the first track in seconds.
+	Duration float64
+}
+
+// Detect returns the format of a manifest, or "" if it is neither.
+func Detect(data []byte) string {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("#EXTM3U")):
+		return FormatHLS
+	case bytes.HasPrefix(trimmed, []byte("<")) && bytes.Contains(trimmed, []byte("<MPD")):
+		return FormatDASH
+	default:
+		return ""
+	}
+}
+
+// Download reads the manifest at manifestURL, picks the tracks to download
+// and writes them to dest: the main track to dest itself and a separate
+// audio track next to it, with ".audio" before the extension of dest.
+func Download(ctx context.Context, manifestURL, dest string, opts *Options) (*Result, error) {
+	if opts == nil || opts.Fetch == nil {
+		return nil, gdlerrors.NewValidationError("fetch", "a fetcher is required")
+	}
+
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", manifestURL)
+	}
+
+	data, err := fetchManifest(ctx, opts.Fetch, manifestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Format: Detect(data)}
+	switch result.Format {
+	case FormatHLS:
+		result.Tracks, err = selectHLS(ctx, opts, base, data)
+	case FormatDASH:
+		result.Tracks, err = selectDASH(opts, base, data)
+	default:
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+			"URL is not an HLS playlist or DASH manifest", manifestURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, track := range result.Tracks {
+		if len(track.Segments) == 0 {
+			return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+				"manifest has no segments", fmt.Sprintf("track %s of %s", trackName(track), manifestURL))
+		}
+
+		file := dest
+		if i > 0 {
+			file = sidecarPath(dest, track.Kind)
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	for _, segment := range result.Tracks[0].Segments {
+		result.Duration += segment.Duration
+	}
+
+	if err := download(ctx, opts, result); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// fetchManifest fetches a playlist or MPD.
+func fetchManifest(ctx context.Context, fetch Fetcher, manifestURL string) ([]byte, error) {
+	data, err := fetch(ctx, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxManifestSize {
+		return nil, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeInvalidURL,
+			"manifest is too large", fmt.Sprintf("%s is over %d MB", manifestURL, maxManifestSize>>20))
+	}
+
+	return data, nil
+}
+
+// pickVariant returns the index of the variant with the highest bandwidth
+// within the bounds of opts, or of the smallest variant if none is within
+// them.
+func pickVariant(tracks []*Track, opts *Options) int {
+	best, smallest := -1, 0
+	for i, track := range tracks {
+		if track.Bandwidth < tracks[smallest].Bandwidth {
+			smallest = i
+		}
+
+		if (opts.MaxBandwidth > 0 && track.Bandwidth > opts.MaxBandwidth) ||
+			(opts.MaxHeight > 0 && track.Height > opts.MaxHeight) {
+			continue
+		}
+		if best < 0 || track.Bandwidth > tracks[best].Bandwidth {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		return smallest
+	}
+
+	return best
+}
+
+// sidecarPath returns the path of a separate track of kind next to dest:
+// "movie.mp4" becomes "movie.audio.mp4".
+func sidecarPath(dest, kind string) string {
+	if kind == "" {
+		kind = "track"
+	}
+
+	slash := strings.LastIndexAny(dest, `/\`)
+	if dot := strings.LastIndex(dest, "."); dot > slash+1 {
+		return dest[:dot] + "." + kind + dest[dot:]
+	}
+
+	return dest + "." + kind
+}
+
+// trackName describes a track in messages.
+func trackName(track *Track) string {
+	name := track.ID
+	if name == "" {
+		name = track.Kind
+	}
+	if name == "" {
+		name = "main"
+	}
+
+	return name
+}
+
+// resolve returns ref resolved against base, as an absolute URL.
+func resolve(base *url.URL, ref string) (string, error) {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL in manifest", ref)
+	}
+
+	return u.String(), nil
+}
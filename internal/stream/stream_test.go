@@ -0,0 +1,298 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// memoryFetcher serves fixed content by URL.
+type memoryFetcher struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	fetches map[string]int
+}
+
+func newMemoryFetcher(files map[string]string) *memoryFetcher {
+	f := &memoryFetcher{files: make(map[string][]byte), fetches: make(map[string]int)}
+	for name, content := range files {
+		f.files[name] = []byte(content)
+	}
+
+	return f
+}
+
+func (f *memoryFetcher) fetch(_ context.Context, url string, r *types.ByteRange) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.fetches[url]++
+	data, ok := f.files[url]
+	if !ok {
+		return nil, fmt.Errorf("404 %s", url)
+	}
+	if r != nil {
+		data = data[r.Start : r.End+1]
+	}
+
+	return data, nil
+}
+
+// encrypt encrypts data with AES-128-CBC and PKCS#7 padding.
+func encrypt(t *testing.T, data, key, iv []byte) string {
+	t.Helper()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+
+	return string(out)
+}
+
+func TestDownload_HLS(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := bytes.Repeat([]byte{0x42}, 16)
+	sequenceIV := make([]byte, 16)
+	binary.BigEndian.PutUint64(sequenceIV[8:], 7)
+
+	fetcher := newMemoryFetcher(map[string]string{
+		"https://example.com/master.m3u8": `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="a",NAME="main",DEFAULT=YES,URI="audio.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=1280x720,AUDIO="a"
+video.m3u8
+`,
+		"https://example.com/video.m3u8": `#EXTM3U
+#EXT-X-MEDIA-SEQUENCE:5
+#EXTINF:2,
+v1.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x42424242424242424242424242424242
+#EXTINF:2,
+v2.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:1.5,
+v3.ts
+#EXT-X-ENDLIST
+`,
+		"https://example.com/audio.m3u8": "#EXTM3U\n#EXTINF:5.5,\na1.aac\n#EXT-X-ENDLIST\n",
+		"https://example.com/key.bin":    string(key),
+		"https://example.com/v1.ts":      "first-",
+		"https://example.com/v2.ts":      encrypt(t, []byte("second-"), key, iv),
+		"https://example.com/v3.ts":      encrypt(t, []byte("third"), key, sequenceIV),
+		"https://example.com/a1.aac":     "audio",
+	})
+
+	dest := filepath.Join(t.TempDir(), "out", "movie.ts")
+	var progress []int
+	result, err := Download(context.Background(), "https://example.com/master.m3u8", dest, &Options{
+		Fetch:       fetcher.fetch,
+		Concurrency: 2,
+		Progress:    func(done, total int) { progress = append(progress, done*10+total) },
+	})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	assertFile(t, dest, "first-second-third")
+	assertFile(t, filepath.Join(filepath.Dir(dest), "movie.audio.ts"), "audio")
+
+	if result.Format != FormatHLS || result.Segments != 4 || result.Bytes != 23 || result.Duration != 5.5 {
+		t.Errorf("Download() result = %+v", result)
+	}
+	if want := []int{14, 24, 34, 44}; fmt.Sprint(progress) != fmt.Sprint(want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+	if n := fetcher.fetches["https://example.com/key.bin"]; n != 1 {
+		t.Errorf("key fetched %d times, want once", n)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(dest))
+	if len(entries) != 2 {
+		t.Errorf("destination directory holds %d files, want no temporary files left", len(entries))
+	}
+}
+
+func TestDownload_DASHKeepSegments(t *testing.T) {
+	fetcher := newMemoryFetcher(map[string]string{
+		"https://example.com/m.mpd": `<MPD type="static" mediaPresentationDuration="PT6S"><Period>
+  <AdaptationSet mimeType="video/mp4">
+    <SegmentTemplate timescale="1" duration="3" initialization="init.mp4" media="$Number$.m4s"/>
+    <Representation id="v" bandwidth="1000"/>
+  </AdaptationSet>
+</Period></MPD>`,
+		"https://example.com/init.mp4": "INIT",
+		"https://example.com/1.m4s":    "one",
+		"https://example.com/2.m4s":    "two",
+	})
+
+	dest := filepath.Join(t.TempDir(), "segments")
+	result, err := Download(context.Background(), "https://example.com/m.mpd", dest, &Options{
+		Fetch:        fetcher.fetch,
+		KeepSegments: true,
+	})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	assertFile(t, filepath.Join(dest, "init-1.mp4"), "INIT")
+	assertFile(t, filepath.Join(dest, "00001.m4s"), "one")
+	assertFile(t, filepath.Join(dest, "00002.m4s"), "two")
+
+	index, err := os.ReadFile(filepath.Join(dest, "index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"#EXT-X-TARGETDURATION:3", `#EXT-X-MAP:URI="init-1.mp4"`, "#EXTINF:3.000,\n00002.m4s", "#EXT-X-ENDLIST"} {
+		if !strings.Contains(string(index), want) {
+			t.Errorf("index.m3u8 does not contain %q:\n%s", want, index)
+		}
+	}
+
+	if result.Format != FormatDASH || result.Segments != 2 || fetcher.fetches["https://example.com/init.mp4"] != 1 {
+		t.Errorf("Download() result = %+v, init fetched %d times", result, fetcher.fetches["https://example.com/init.mp4"])
+	}
+}
+
+func TestDownload_KeepSegmentsFailure(t *testing.T) {
+	fetcher := newMemoryFetcher(map[string]string{
+		"https://example.com/gone.m3u8": "#EXTM3U\n#EXTINF:2,\nok.ts\n#EXTINF:2,\nmissing.ts\n#EXT-X-ENDLIST\n",
+		"https://example.com/ok.ts":     "ok",
+		"https://example.com/vod.m3u8":  "#EXTM3U\n#EXTINF:2,\nok.ts\n#EXT-X-ENDLIST\n",
+	})
+
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "segments")
+
+	if _, err := Download(context.Background(), "https://example.com/gone.m3u8", dest,
+		&Options{Fetch: fetcher.fetch, KeepSegments: true}); err == nil {
+		t.Fatal("Download() with a missing segment succeeded")
+	}
+
+	if entries, _ := os.ReadDir(parent); len(entries) != 0 {
+		t.Errorf("failed download left %d files behind", len(entries))
+	}
+
+	// Segments are moved into a directory that exists already, next to its files
+	if err := os.Mkdir(dest, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "notes.txt"), []byte("mine"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Download(context.Background(), "https://example.com/vod.m3u8", dest,
+		&Options{Fetch: fetcher.fetch, KeepSegments: true}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	assertFile(t, filepath.Join(dest, "00001.ts"), "ok")
+	assertFile(t, filepath.Join(dest, "notes.txt"), "mine")
+
+	if entries, _ := os.ReadDir(parent); len(entries) != 1 {
+		t.Errorf("download left %d entries next to the segment directory, want none", len(entries)-1)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://example.com/seg/1.m4s?token=a.b", ".m4s"},
+		{"https://example.com/seg/1.TS", ".TS"},
+		{"https://example.com/seg/1", ".ts"},
+		{"https://example.com/seg/1.toolong", ".ts"},
+		{"https://example.com/seg/1.t%0As", ".ts"},
+		{"https://example.com/seg/1.%22x", ".ts"},
+		{"https://example.com/seg/1.", ".ts"},
+	}
+
+	for _, tt := range tests {
+		if got := extension(tt.url, ".ts"); got != tt.want {
+			t.Errorf("extension(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestDownload_Errors(t *testing.T) {
+	fetcher := newMemoryFetcher(map[string]string{
+		"https://example.com/page.html": "<html></html>",
+		"https://example.com/live.m3u8": "#EXTM3U\n#EXTINF:2,\nlive.ts\n",
+		"https://example.com/gone.m3u8": "#EXTM3U\n#EXTINF:2,\nok.ts\n#EXTINF:2,\nmissing.ts\n#EXT-X-ENDLIST\n",
+		"https://example.com/ok.ts":     "ok",
+		"https://example.com/bad.m3u8":  "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"short.key\"\n#EXTINF:2,\nok.ts\n#EXT-X-ENDLIST\n",
+		"https://example.com/short.key": "123",
+	})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/page.html", "not an HLS playlist or DASH manifest"},
+		{"https://example.com/live.m3u8", "live streams are not supported"},
+		{"https://example.com/gone.m3u8", "segment 2 of 2"},
+		{"https://example.com/bad.m3u8", "invalid AES-128 key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "out.ts")
+			_, err := Download(context.Background(), tt.url, dest, &Options{Fetch: fetcher.fetch})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Download() error = %v, want it to mention %q", err, tt.want)
+			}
+
+			entries, _ := os.ReadDir(filepath.Dir(dest))
+			if len(entries) != 0 {
+				t.Errorf("failed download left %d files behind", len(entries))
+			}
+		})
+	}
+
+	if _, err := Download(context.Background(), "https://example.com/x.m3u8", "out", nil); err == nil {
+		t.Error("Download() without a fetcher succeeded")
+	}
+}
+
+func TestSidecarPath(t *testing.T) {
+	tests := []struct {
+		dest, kind, want string
+	}{
+		{"movie.mp4", KindAudio, "movie.audio.mp4"},
+		{"dir.v2/movie", KindAudio, "dir.v2/movie.audio"},
+		{".hidden", KindAudio, ".hidden.audio"},
+		{"movie.ts", "", "movie.track.ts"},
+	}
+
+	for _, tt := range tests {
+		if got := sidecarPath(tt.dest, tt.kind); got != tt.want {
+			t.Errorf("sidecarPath(%q, %q) = %q, want %q", tt.dest, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", filepath.Base(path), data, want)
+	}
+}
@@ -0,0 +1,269 @@
+// Package zsync reads zsync control files and finds the blocks of the file
+// they describe that a local file already holds, so that updating the local
+// file only downloads the blocks that changed.
+package zsync
+
+import (
+	"bufio"
+	"crypto/sha1" // #nosec G505 -- SHA-1 is the whole-file checksum of the zsync format
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	// MD4 is the block checksum of the zsync format.
+	"golang.org/x/crypto/md4" //nolint:staticcheck
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// Version is the zsync format version written by Generate.
+const Version = "0.6.2"
+
+// DefaultBlockSize is the block size Generate uses for files of up to
+// 100 MB, as zsyncmake does.
+const DefaultBlockSize = 2048
+
+// Control is a parsed zsync control file: the length, block size and SHA-1
+// of the target file, and the checksums of each of its blocks.
+type Control struct {
+	// Filename is the name the target file is published under.
+	Filename string
+
+	// MTime is the modification time of the target file, if given.
+	MTime time.Time
+
+	// BlockSize is the size of the blocks the file is checksummed in.
+	BlockSize int
+
+	// Length is the size of the target file in bytes.
+	Length int64
+
+	// URL is the location of the target file, usually relative to the
+	// control file.
+	URL string
+
+	// SHA1 is the hex encoded SHA-1 of the target file.
+	SHA1 string
+
+	// SeqMatches is the number of consecutive blocks that must match before
+	// a block is taken from the local file (1 or 2). RsumBytes and
+	// ChecksumBytes are the lengths the block checksums are stored with.
+	SeqMatches    int
+	RsumBytes     int
+	ChecksumBytes int
+
+	sums []blockSum
+}
+
+// blockSum holds the weak rolling checksum and the truncated MD4 of a block.
+type blockSum struct {
+	rsum     uint32
+	checksum []byte
+}
+
+// Blocks returns the number of blocks of the target file.
+func (c *Control) Blocks() int {
+	return len(c.sums)
+}
+
+// BlockRange returns the offsets of the first and last byte of block i of
+// the target file.
+func (c *Control) BlockRange(i int) (start, end int64) {
+	start = int64(i) * int64(c.BlockSize)
+	return start, min(start+int64(c.BlockSize), c.Length) - 1
+}
+
+// invalidControl returns the error for a malformed control file.
+func invalidControl(format string, args ...interface{}) error {
+	return errors.NewDownloadErrorWithDetails(errors.CodeValidationError,
+		"Invalid zsync control file", fmt.Sprintf(format, args...))
+}
+
+// ParseControl reads a zsync control file. Control files for compressed
+// targets (with a Z-Map2 header) are not supported.
+func ParseControl(r io.Reader) (*Control, error) {
+	reader := bufio.NewReader(r)
+	c := &Control{SeqMatches: 1, RsumBytes: 4, ChecksumBytes: 16}
+	seenVersion := false
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, invalidControl("header ends before the block checksums")
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, invalidControl("malformed header line %q", line)
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "zsync":
+			seenVersion = true
+		case "Filename":
+			c.Filename = value
+		case "MTime":
+			if mtime, err := time.Parse(time.RFC1123Z, value); err == nil {
+				c.MTime = mtime
+			}
+		case "Blocksize":
+			c.BlockSize, err = strconv.Atoi(value)
+			if err != nil || c.BlockSize <= 0 || c.BlockSize&(c.BlockSize-1) != 0 {
+				return nil, invalidControl("block size %q is not a power of two", value)
+			}
+		case "Length":
+			c.Length, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || c.Length < 0 {
+				return nil, invalidControl("invalid length %q", value)
+			}
+		case "Hash-Lengths":
+			if _, err := fmt.Sscanf(value, "%d,%d,%d", &c.SeqMatches, &c.RsumBytes, &c.ChecksumBytes); err != nil ||
+				c.SeqMatches < 1 || c.SeqMatches > 2 ||
+				c.RsumBytes < 1 || c.RsumBytes > 4 ||
+				c.ChecksumBytes < 3 || c.ChecksumBytes > md4.Size {
+				return nil, invalidControl("invalid hash lengths %q", value)
+			}
+		case "URL":
+			if c.URL == "" {
+				c.URL = value
+			}
+		case "SHA-1":
+			if _, err := hex.DecodeString(value); err != nil || len(value) != 2*sha1.Size {
+				return nil, invalidControl("invalid SHA-1 %q", value)
+			}
+			c.SHA1 = strings.ToLower(value)
+		case "Z-Map2", "Z-URL", "Z-Filename", "Recompress":
+			return nil, errors.NewDownloadErrorWithDetails(errors.CodeValidationError,
+				"Unsupported zsync control file", "control files for compressed files are not supported")
+		}
+	}
+
+	switch {
+	case !seenVersion:
+		return nil, invalidControl("missing zsync version header")
+	case c.BlockSize == 0:
+		return nil, invalidControl("missing Blocksize header")
+	case c.SHA1 == "":
+		return nil, invalidControl("missing SHA-1 header")
+	}
+
+	blocks := (c.Length + int64(c.BlockSize) - 1) / int64(c.BlockSize)
+	if blocks > math.MaxInt32 {
+		return nil, invalidControl("too many blocks")
+	}
+
+	c.sums = make([]blockSum, blocks)
+	record := make([]byte, c.RsumBytes+c.ChecksumBytes)
+
+	for i := range c.sums {
+		if _, err := io.ReadFull(reader, record); err != nil {
+			return nil, invalidControl("block checksums end after %d of %d blocks", i, blocks)
+		}
+
+		var rsum [4]byte
+		copy(rsum[4-c.RsumBytes:], record[:c.RsumBytes])
+
+		c.sums[i] = blockSum{
+			rsum:     binary.BigEndian.Uint32(rsum[:]),
+			checksum: append([]byte(nil), record[c.RsumBytes:]...),
+		}
+	}
+
+	return c, nil
+}
+
+// Generate writes the control file of the content of r, as zsyncmake does
+// for an uncompressed file: filename and url go in its headers, and blockSize
+// 0 chooses DefaultBlockSize. The hash lengths are chosen from the file's
+// size with zsyncmake's formulas.
+func Generate(w io.Writer, r io.Reader, filename, url string, mtime time.Time, blockSize int) error {
+	if blockSize == 0 {
+		blockSize = DefaultBlockSize
+	}
+	if blockSize < 0 || blockSize&(blockSize-1) != 0 {
+		return errors.NewValidationError("block_size", "must be a power of two")
+	}
+
+	whole := sha1.New() // #nosec G401 -- required by the format
+	block := make([]byte, blockSize)
+
+	var (
+		length int64
+		sums   []blockSum
+	)
+
+	for {
+		n, err := io.ReadFull(r, block)
+		if n > 0 {
+			whole.Write(block[:n])
+			length += int64(n)
+			clear(block[n:])
+			sums = append(sums, sumBlock(block))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	seqMatches, rsumBytes, checksumBytes := hashLengths(length, blockSize)
+
+	buffered := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(buffered, "zsync: %s\n", Version)
+	if filename != "" {
+		_, _ = fmt.Fprintf(buffered, "Filename: %s\n", filename)
+	}
+	if !mtime.IsZero() {
+		_, _ = fmt.Fprintf(buffered, "MTime: %s\n", mtime.Format(time.RFC1123Z))
+	}
+	_, _ = fmt.Fprintf(buffered, "Blocksize: %d\nLength: %d\nHash-Lengths: %d,%d,%d\n",
+		blockSize, length, seqMatches, rsumBytes, checksumBytes)
+	if url != "" {
+		_, _ = fmt.Fprintf(buffered, "URL: %s\n", url)
+	}
+	_, _ = fmt.Fprintf(buffered, "SHA-1: %x\n\n", whole.Sum(nil))
+
+	for _, sum := range sums {
+		var rsum [4]byte
+		binary.BigEndian.PutUint32(rsum[:], sum.rsum)
+		_, _ = buffered.Write(rsum[4-rsumBytes:])
+		_, _ = buffered.Write(sum.checksum[:checksumBytes])
+	}
+
+	return buffered.Flush()
+}
+
+// hashLengths returns the sequential matches and the stored lengths of the
+// weak and strong block checksums that zsyncmake chooses for a file of
+// length bytes: enough to make false matches unlikely, and no more.
+func hashLengths(length int64, blockSize int) (seqMatches, rsumBytes, checksumBytes int) {
+	seqMatches = 1
+	if length > int64(blockSize) {
+		seqMatches = 2
+	}
+
+	size := math.Max(float64(length), 1)
+	blocks := float64(1 + length/int64(blockSize))
+
+	rsum := math.Ceil(((math.Log(size)+math.Log(float64(blockSize)))/math.Log(2) - 8.6) / float64(seqMatches) / 8)
+	rsumBytes = int(min(max(rsum, 2), 4))
+
+	checksum := math.Ceil((20 + (math.Log(size)+math.Log(blocks))/math.Log(2)) / float64(seqMatches) / 8)
+	checksum2 := math.Floor((7.9 + (20 + math.Log(blocks)/math.Log(2))) / 8)
+	checksumBytes = int(min(max(checksum, checksum2), md4.Size))
+
+	return seqMatches, rsumBytes, checksumBytes
+}
@@ -0,0 +1,77 @@
+package zsync
+
+import (
+	"bytes"
+	"crypto/sha1" // #nosec G505 -- the format's whole-file checksum
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateParseControl(t *testing.T) {
+	content := bytes.Repeat([]byte("the quick brown fox "), 1000)
+	mtime := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var control bytes.Buffer
+	if err := Generate(&control, bytes.NewReader(content), "fox.txt", "fox.txt", mtime, 1024); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if !strings.HasPrefix(control.String(), "zsync: 0.6.2\nFilename: fox.txt\n") {
+		t.Errorf("control file starts with %q", control.String()[:40])
+	}
+
+	c, err := ParseControl(&control)
+	if err != nil {
+		t.Fatalf("ParseControl() error = %v", err)
+	}
+
+	sum := sha1.Sum(content) // #nosec G401
+	if c.Filename != "fox.txt" || c.URL != "fox.txt" || c.BlockSize != 1024 ||
+		c.Length != int64(len(content)) || c.SHA1 != hex.EncodeToString(sum[:]) || !c.MTime.Equal(mtime) {
+		t.Errorf("ParseControl() = %+v", c)
+	}
+
+	if c.Blocks() != 20 {
+		t.Errorf("Blocks() = %d, want 20", c.Blocks())
+	}
+
+	if start, end := c.BlockRange(19); start != 19456 || end != 19999 {
+		t.Errorf("BlockRange(19) = %d-%d, want 19456-19999", start, end)
+	}
+
+	if c.SeqMatches != 2 || c.RsumBytes < 2 || c.ChecksumBytes < 3 {
+		t.Errorf("hash lengths = %d,%d,%d", c.SeqMatches, c.RsumBytes, c.ChecksumBytes)
+	}
+}
+
+func TestParseControlErrors(t *testing.T) {
+	header := "zsync: 0.6.2\nBlocksize: 2048\nLength: 4096\nHash-Lengths: 1,4,16\nSHA-1: " +
+		strings.Repeat("0", 40) + "\n\n"
+
+	tests := []struct {
+		name    string
+		control string
+	}{
+		{"empty", ""},
+		{"no version", strings.TrimPrefix(header, "zsync: 0.6.2\n")},
+		{"bad block size", strings.Replace(header, "2048", "1000", 1)},
+		{"bad hash lengths", strings.Replace(header, "1,4,16", "3,4,16", 1)},
+		{"bad SHA-1", strings.Replace(header, strings.Repeat("0", 40), "xyz", 1)},
+		{"compressed", strings.Replace(header, "\n\n", "\nZ-Map2: 4\n\n", 1)},
+		{"truncated checksums", header + strings.Repeat("x", 30)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseControl(strings.NewReader(tt.control)); err == nil {
+				t.Error("ParseControl() should fail")
+			}
+		})
+	}
+
+	if _, err := ParseControl(strings.NewReader(header + strings.Repeat("x", 40))); err != nil {
+		t.Errorf("ParseControl() of a valid file error = %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package zsync
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck
+)
+
+// seedBufferSize is the amount of the local file Match holds in memory.
+const seedBufferSize = 1 << 20
+
+// sumBlock returns the checksums of a block, zero padded to the block size.
+func sumBlock(block []byte) blockSum {
+	a, b := weakSum(block)
+
+	return blockSum{rsum: uint32(a)<<16 | uint32(b), checksum: md4Sum(block)}
+}
+
+// md4Sum returns the MD4 of data.
+func md4Sum(data []byte) []byte {
+	hash := md4.New()
+	hash.Write(data)
+
+	return hash.Sum(nil)
+}
+
+// weakSum returns the two halves of the rolling checksum of block: the sum
+// of its bytes, and the sum of each byte times its distance from the end.
+func weakSum(block []byte) (a, b uint16) {
+	n := len(block)
+	for i, c := range block {
+		a += uint16(c)
+		b += uint16(n-i) * uint16(c)
+	}
+
+	return a, b
+}
+
+// matcher finds the blocks of a Control in a stream of local data.
+type matcher struct {
+	control *Control
+	mask    uint32
+	index   map[uint32][]int
+	offsets []int64
+}
+
+// Match scans seed, usually the outdated local copy of the target file, for
+// blocks of the target and returns for each block the offset in seed it was
+// found at, or -1 for a block that has to be downloaded. Blocks may be found
+// at any offset, so data that moved within the file is reused too.
+func (c *Control) Match(seed io.Reader) ([]int64, error) {
+	m := &matcher{
+		control: c,
+		mask:    uint32(1<<(8*c.RsumBytes) - 1),
+		index:   make(map[uint32][]int, len(c.sums)),
+		offsets: make([]int64, len(c.sums)),
+	}
+
+	for i, sum := range c.sums {
+		m.index[sum.rsum] = append(m.index[sum.rsum], i)
+		m.offsets[i] = -1
+	}
+
+	if len(c.sums) == 0 {
+		return m.offsets, nil
+	}
+
+	if err := m.scan(seed); err != nil {
+		return nil, err
+	}
+
+	return m.offsets, nil
+}
+
+// scan slides a window of one block over seed, one byte at a time, updating
+// the rolling checksum. The window jumps a block ahead after a match, as the
+// next block of the target most likely follows. The end of seed is padded
+// with zeros like the last block of the target.
+func (m *matcher) scan(seed io.Reader) error {
+	blockSize := m.control.BlockSize
+
+	// Two blocks of lookahead let a match be confirmed by the next block
+	lookahead := 2*blockSize + 1
+	data := make([]byte, 0, max(seedBufferSize, 2*lookahead))
+
+	var (
+		base      int64 // offset in seed of data[0]
+		pos       int
+		eof       bool
+		a, b      uint16
+		haveSum   bool
+		remaining = len(m.offsets)
+	)
+
+	for remaining > 0 {
+		if !eof && len(data)-pos < lookahead {
+			base += int64(pos)
+			data = data[:copy(data, data[pos:])]
+			pos = 0
+
+			n, err := io.ReadFull(seed, data[len(data):cap(data)])
+			data = data[:len(data)+n]
+
+			switch err {
+			case nil:
+			case io.EOF, io.ErrUnexpectedEOF:
+				eof = true
+				data = append(data, make([]byte, blockSize)...)
+			default:
+				return err
+			}
+		}
+
+		if pos+blockSize > len(data) {
+			break
+		}
+
+		window := data[pos : pos+blockSize]
+		if !haveSum {
+			a, b = weakSum(window)
+			haveSum = true
+		}
+
+		if matched := m.matchWindow(data, pos, base, a, b); matched > 0 {
+			remaining -= matched
+			pos += blockSize
+			haveSum = false
+
+			continue
+		}
+
+		if pos+blockSize < len(data) {
+			old, next := uint16(data[pos]), uint16(data[pos+blockSize])
+			a += next - old
+			b += a - uint16(blockSize)*old
+		} else {
+			haveSum = false
+		}
+
+		pos++
+	}
+
+	return nil
+}
+
+// matchWindow records the window at data[pos:] for every missing block it
+// matches and returns how many blocks were found.
+func (m *matcher) matchWindow(data []byte, pos int, base int64, a, b uint16) int {
+	candidates := m.index[(uint32(a)<<16|uint32(b))&m.mask]
+	if len(candidates) == 0 {
+		return 0
+	}
+
+	blockSize := m.control.BlockSize
+	strong := m.strongSum(data[pos : pos+blockSize])
+	found := 0
+
+	for _, i := range candidates {
+		if m.offsets[i] >= 0 || !bytes.Equal(strong, m.control.sums[i].checksum) {
+			continue
+		}
+
+		// With short checksums a block only counts if the next one follows
+		next := i + 1
+		if m.control.SeqMatches > 1 && next < len(m.offsets) {
+			if pos+2*blockSize > len(data) || !m.matches(data[pos+blockSize:pos+2*blockSize], next) {
+				continue
+			}
+
+			if m.offsets[next] < 0 {
+				m.offsets[next] = base + int64(pos+blockSize)
+				found++
+			}
+		}
+
+		m.offsets[i] = base + int64(pos)
+		found++
+	}
+
+	return found
+}
+
+// matches reports whether window holds block i.
+func (m *matcher) matches(window []byte, i int) bool {
+	a, b := weakSum(window)
+	if (uint32(a)<<16|uint32(b))&m.mask != m.control.sums[i].rsum {
+		return false
+	}
+
+	return bytes.Equal(m.strongSum(window), m.control.sums[i].checksum)
+}
+
+// strongSum returns the MD4 of window truncated as the control file stores it.
+func (m *matcher) strongSum(window []byte) []byte {
+	return md4Sum(window)[:m.control.ChecksumBytes]
+}
@@ -0,0 +1,111 @@
+package zsync
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// controlFor generates and parses the control file of content.
+func controlFor(t *testing.T, content []byte, blockSize int) *Control {
+	t.Helper()
+
+	var control bytes.Buffer
+	if err := Generate(&control, bytes.NewReader(content), "", "", time.Time{}, blockSize); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	c, err := ParseControl(&control)
+	if err != nil {
+		t.Fatalf("ParseControl() error = %v", err)
+	}
+
+	return c
+}
+
+// checkOffsets fails the test if a block found in seed differs from the
+// target's block, and returns the number of blocks found.
+func checkOffsets(t *testing.T, c *Control, offsets []int64, target, seed []byte) int {
+	t.Helper()
+
+	padded := append(bytes.Clone(seed), make([]byte, c.BlockSize)...)
+	found := 0
+
+	for i, offset := range offsets {
+		if offset < 0 {
+			continue
+		}
+		found++
+
+		start, end := c.BlockRange(i)
+		length := end - start + 1
+		if !bytes.Equal(padded[offset:offset+length], target[start:end+1]) {
+			t.Errorf("block %d found at %d holds other data", i, offset)
+		}
+	}
+
+	return found
+}
+
+func TestWeakSumRolls(t *testing.T) {
+	data := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	const blockSize = 512
+	a, b := weakSum(data[:blockSize])
+
+	for pos := 1; pos+blockSize <= len(data); pos++ {
+		old, next := uint16(data[pos-1]), uint16(data[pos+blockSize-1])
+		a += next - old
+		b += a - blockSize*old
+
+		if wantA, wantB := weakSum(data[pos : pos+blockSize]); a != wantA || b != wantB {
+			t.Fatalf("rolled sum at %d = %d,%d, want %d,%d", pos, a, b, wantA, wantB)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	target := make([]byte, 200*1024+123)
+	random.Read(target)
+
+	const blockSize = 1024
+
+	// The old version lacks 3000 bytes near the start and has other data
+	// in the middle, so most blocks are found at shifted offsets
+	seed := append(bytes.Clone(target[:10000]), target[13000:]...)
+	random.Read(seed[100000:104000])
+
+	c := controlFor(t, target, blockSize)
+
+	offsets, err := c.Match(bytes.NewReader(seed))
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+
+	found := checkOffsets(t, c, offsets, target, seed)
+	if missing := c.Blocks() - found; missing < 5 || missing > 12 {
+		t.Errorf("Match() missed %d of %d blocks, want the changed ones only", missing, c.Blocks())
+	}
+
+	if offsets[c.Blocks()-1] < 0 {
+		t.Error("Match() missed the last, partial block")
+	}
+
+	// Identical files match in full; unrelated data matches nothing
+	if offsets, _ := c.Match(bytes.NewReader(target)); checkOffsets(t, c, offsets, target, target) != c.Blocks() {
+		t.Error("Match() of the target itself missed blocks")
+	}
+
+	other := make([]byte, len(target))
+	random.Read(other)
+	if offsets, _ := c.Match(bytes.NewReader(other)); checkOffsets(t, c, offsets, target, other) != 0 {
+		t.Error("Match() of unrelated data found blocks")
+	}
+
+	if offsets, _ := c.Match(bytes.NewReader(nil)); checkOffsets(t, c, offsets, target, nil) != 0 {
+		t.Error("Match() of an empty seed found blocks")
+	}
+}
@@ -0,0 +1,453 @@
+package gdl
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"time"
+
+	"github.com/forest6511/gdl/internal/cas"
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/internal/core"
+	diskstorage "github.com/forest6511/gdl/internal/storage"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+// Validate checks the options for values out of range and for settings that
+// conflict, such as EnableResume with OverwriteExisting. The error is a
+// *errors.DownloadError with CodeValidationError naming the offending field.
+// DownloadWithOptions and Downloader.Download validate their options, so a
+// misconfiguration fails before any request is made.
+func (o *Options) Validate() error {
+	if o.MaxConcurrency < 0 {
+		return gdlerrors.NewValidationError("max_concurrency",
+			fmt.Sprintf("must not be negative, got %d", o.MaxConcurrency))
+	}
+	if o.ChunkSize < 0 {
+		return gdlerrors.NewValidationError("chunk_size",
+			fmt.Sprintf("must not be negative, got %d", o.ChunkSize))
+	}
+	if o.ChunkSize > 0 {
+		if err := validation.ValidateChunkSize(o.ChunkSize); err != nil {
+			return gdlerrors.NewValidationError("chunk_size", err.Error())
+		}
+	}
+	if o.RetryAttempts < 0 {
+		return gdlerrors.NewValidationError("retry_attempts",
+			fmt.Sprintf("must not be negative, got %d", o.RetryAttempts))
+	}
+	if o.Timeout < 0 {
+		return gdlerrors.NewValidationError("timeout",
+			fmt.Sprintf("must not be negative, got %s", o.Timeout))
+	}
+	if o.Timeout > 0 {
+		timeoutSeconds := int(o.Timeout.Seconds())
+		if err := validation.ValidateTimeout(timeoutSeconds); err != nil {
+			return gdlerrors.NewValidationError("timeout", err.Error())
+		}
+	}
+	for field := range o.overridden {
+		if f, ok := reflect.TypeOf(*o).FieldByName(field); !ok || !f.IsExported() {
+			return gdlerrors.NewValidationError("override", fmt.Sprintf("unknown field %q", field))
+		}
+	}
+	if o.EnableResume && o.OverwriteExisting {
+		return gdlerrors.NewValidationError("overwrite_existing",
+			"cannot be combined with EnableResume; set CollisionPolicy to choose what happens to an existing file")
+	}
+	if o.MaxRate < 0 || o.MaxRateBurst < 0 {
+		return gdlerrors.NewValidationError("max_rate",
+			fmt.Sprintf("must not be negative, got %d (burst %d)", o.MaxRate, o.MaxRateBurst))
+	}
+	if o.SpeedWindow < 0 {
+		return gdlerrors.NewValidationError("speed_window",
+			fmt.Sprintf("must not be negative, got %s", o.SpeedWindow))
+	}
+	if o.WriteBufferSize < 0 {
+		return gdlerrors.NewValidationError("write_buffer_size",
+			fmt.Sprintf("must not be negative, got %d", o.WriteBufferSize))
+	}
+	if err := diskstorage.ValidateIOEngine(o.IOEngine); err != nil {
+		return err
+	}
+	if o.MinSpeed < 0 {
+		return gdlerrors.NewValidationError("min_speed",
+			fmt.Sprintf("must not be negative, got %d", o.MinSpeed))
+	}
+	if o.StallTimeout < 0 {
+		return gdlerrors.NewValidationError("stall_timeout",
+			fmt.Sprintf("must not be negative, got %s", o.StallTimeout))
+	}
+	if o.MinFreeSpace < 0 {
+		return gdlerrors.NewValidationError("min_free_space",
+			fmt.Sprintf("must not be negative, got %d", o.MinFreeSpace))
+	}
+	if o.MaxInMemorySize < 0 {
+		return gdlerrors.NewValidationError("max_in_memory_size",
+			fmt.Sprintf("must not be negative, got %d", o.MaxInMemorySize))
+	}
+	if o.IPVersion != 0 && o.IPVersion != 4 && o.IPVersion != 6 {
+		return gdlerrors.NewValidationError("ip_version",
+			fmt.Sprintf("must be 0, 4 or 6, got %d", o.IPVersion))
+	}
+	if err := validateProxy(o.Proxy); err != nil {
+		return err
+	}
+	if err := validateTLS(o.TLS); err != nil {
+		return err
+	}
+	if err := validateByteRange(o); err != nil {
+		return err
+	}
+	if err := validateRequest(o); err != nil {
+		return err
+	}
+	if err := validateCollisionPolicy(o); err != nil {
+		return err
+	}
+	if err := core.ValidateResumeValidation(o.ResumeValidation); err != nil {
+		return err
+	}
+	if err := core.ValidateMirrorStrategy(o.MirrorStrategy); err != nil {
+		return err
+	}
+	if o.MaxMirrors < 0 {
+		return gdlerrors.NewValidationError("max_mirrors",
+			fmt.Sprintf("must not be negative, got %d", o.MaxMirrors))
+	}
+	if o.Checksum != "" {
+		if _, err := checksum.NormalizeDigest(o.ChecksumAlgorithm, o.Checksum); err != nil {
+			return err
+		}
+	} else if _, err := checksum.Normalize(o.ChecksumAlgorithm); err != nil {
+		return err
+	}
+	if o.ContentStore != nil && o.ContentStore.SHA256 != "" {
+		if _, err := cas.NormalizeHash(o.ContentStore.SHA256); err != nil {
+			return err
+		}
+	}
+	if o.Delta != nil {
+		switch {
+		case o.Delta.Control == "":
+			return gdlerrors.NewValidationError("delta_control", "cannot be empty")
+		case o.EnableResume:
+			return gdlerrors.NewValidationError("delta", "cannot be combined with resume")
+		case o.OnlyIfNewer:
+			return gdlerrors.NewValidationError("delta", "cannot be combined with timestamping")
+		}
+	}
+	if o.Quota != nil {
+		if o.Quota.MaxSize <= 0 {
+			return gdlerrors.NewValidationError("quota_max_size",
+				fmt.Sprintf("must be positive, got %d", o.Quota.MaxSize))
+		}
+		if err := diskstorage.ValidateQuotaPolicy(o.Quota.Policy); err != nil {
+			return err
+		}
+	}
+	if o.Signature != nil {
+		if o.Signature.Signature == "" {
+			return gdlerrors.NewValidationError("signature", "cannot be empty")
+		}
+		if o.Signature.Keyring == "" {
+			return gdlerrors.NewValidationError("keyring", "required to verify a signature")
+		}
+	}
+	if o.Scan != nil {
+		if err := validateScanOptions(o.Scan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Override marks the named fields, such as "MaxRate" or "Headers", as set
+// even when they hold their zero value, so that they replace the defaults of
+// a Downloader instead of keeping them. OptionsBuilder marks the fields its
+// methods set. It returns o.
+func (o *Options) Override(fields ...string) *Options {
+	if o.overridden == nil {
+		o.overridden = make(map[string]bool, len(fields))
+	}
+
+	for _, field := range fields {
+		o.overridden[field] = true
+	}
+
+	return o
+}
+
+// OptionsBuilder builds Options step by step. Build validates the result, so
+// conflicting settings are reported where the options are made.
+//
+// Example:
+//
+//	opts, err := gdl.NewOptions().
+//	    WithConcurrency(8).
+//	    WithTimeout(5 * time.Minute).
+//	    WithCollisionPolicy(types.CollisionSkip).
+//	    Build()
+type OptionsBuilder struct {
+	opts Options
+}
+
+// NewOptions creates a builder for Options, starting from the zero value
+// (the defaults of every setting).
+func NewOptions() *OptionsBuilder {
+	return &OptionsBuilder{}
+}
+
+// WithConcurrency sets the number of concurrent connections.
+func (b *OptionsBuilder) WithConcurrency(connections int) *OptionsBuilder {
+	b.opts.MaxConcurrency = connections
+	return b.set("MaxConcurrency")
+}
+
+// WithChunkSize sets the size of each chunk in bytes (at least 1KB).
+func (b *OptionsBuilder) WithChunkSize(size int64) *OptionsBuilder {
+	b.opts.ChunkSize = size
+	return b.set("ChunkSize")
+}
+
+// WithTimeout sets the download timeout.
+func (b *OptionsBuilder) WithTimeout(timeout time.Duration) *OptionsBuilder {
+	b.opts.Timeout = timeout
+	return b.set("Timeout")
+}
+
+// WithRetries sets the number of retry attempts.
+func (b *OptionsBuilder) WithRetries(attempts int) *OptionsBuilder {
+	b.opts.RetryAttempts = attempts
+	return b.set("RetryAttempts")
+}
+
+// WithResume enables or disables resuming partial downloads.
+func (b *OptionsBuilder) WithResume(enabled bool) *OptionsBuilder {
+	b.opts.EnableResume = enabled
+	return b.set("EnableResume")
+}
+
+// WithOverwrite enables or disables overwriting existing files.
+func (b *OptionsBuilder) WithOverwrite(enabled bool) *OptionsBuilder {
+	b.opts.OverwriteExisting = enabled
+	return b.set("OverwriteExisting")
+}
+
+// WithCollisionPolicy sets what happens when the destination exists, one of
+// the types.Collision* policies.
+func (b *OptionsBuilder) WithCollisionPolicy(policy string) *OptionsBuilder {
+	b.opts.CollisionPolicy = policy
+	return b.set("CollisionPolicy")
+}
+
+// WithCreateDirs enables or disables creating missing parent directories.
+func (b *OptionsBuilder) WithCreateDirs(enabled bool) *OptionsBuilder {
+	b.opts.CreateDirs = enabled
+	return b.set("CreateDirs")
+}
+
+// WithAtomicWrite downloads to a part file, in tempDir if it is not empty,
+// and renames it into place on success.
+func (b *OptionsBuilder) WithAtomicWrite(tempDir string) *OptionsBuilder {
+	b.opts.AtomicWrite = true
+	b.opts.TempDir = tempDir
+	return b.set("AtomicWrite", "TempDir")
+}
+
+// WithUserAgent sets the User-Agent header.
+func (b *OptionsBuilder) WithUserAgent(userAgent string) *OptionsBuilder {
+	b.opts.UserAgent = userAgent
+	return b.set("UserAgent")
+}
+
+// WithHeader adds a request header.
+func (b *OptionsBuilder) WithHeader(key, value string) *OptionsBuilder {
+	if b.opts.Headers == nil {
+		b.opts.Headers = make(map[string]string)
+	}
+	b.opts.Headers[key] = value
+	return b
+}
+
+// WithHeaders sets the request headers, replacing those of the Downloader's
+// defaults rather than adding to them; nil sends none of them.
+func (b *OptionsBuilder) WithHeaders(headers map[string]string) *OptionsBuilder {
+	b.opts.Headers = maps.Clone(headers)
+	return b.set("Headers")
+}
+
+// WithMaxRate limits the download rate in bytes per second (0 = unlimited).
+func (b *OptionsBuilder) WithMaxRate(bytesPerSecond int64) *OptionsBuilder {
+	b.opts.MaxRate = bytesPerSecond
+	return b.set("MaxRate")
+}
+
+// WithMinSpeed retries a transfer that stays below bytesPerSecond for window
+// (30 seconds if 0).
+func (b *OptionsBuilder) WithMinSpeed(bytesPerSecond int64, window time.Duration) *OptionsBuilder {
+	b.opts.MinSpeed = bytesPerSecond
+	b.opts.StallTimeout = window
+	return b.set("MinSpeed", "StallTimeout")
+}
+
+// WithProgress sets the progress callback.
+func (b *OptionsBuilder) WithProgress(callback ProgressCallback) *OptionsBuilder {
+	b.opts.ProgressCallback = callback
+	return b.set("ProgressCallback")
+}
+
+// WithProgressInterval sets the minimum time between progress callbacks.
+func (b *OptionsBuilder) WithProgressInterval(interval time.Duration) *OptionsBuilder {
+	b.opts.ProgressInterval = interval
+	return b.set("ProgressInterval")
+}
+
+// WithProxy sets the proxy configuration.
+func (b *OptionsBuilder) WithProxy(proxy *types.ProxyConfig) *OptionsBuilder {
+	b.opts.Proxy = proxy
+	return b.set("Proxy")
+}
+
+// WithTLS sets the CA bundles, client certificate and pinned keys.
+func (b *OptionsBuilder) WithTLS(tls *types.TLSOptions) *OptionsBuilder {
+	b.opts.TLS = tls
+	return b.set("TLS")
+}
+
+// WithQuiet enables or disables quiet mode.
+func (b *OptionsBuilder) WithQuiet(enabled bool) *OptionsBuilder {
+	b.opts.Quiet = enabled
+	return b.set("Quiet")
+}
+
+// set records that the builder set fields, so that they override the
+// defaults of a Downloader even with zero values.
+func (b *OptionsBuilder) set(fields ...string) *OptionsBuilder {
+	b.opts.Override(fields...)
+	return b
+}
+
+// Build validates the options and returns a copy of them, so that the
+// builder can be changed and built again.
+func (b *OptionsBuilder) Build() (*Options, error) {
+	opts := b.opts
+	opts.Headers = maps.Clone(b.opts.Headers)
+	opts.overridden = maps.Clone(b.opts.overridden)
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &opts, nil
+}
+
+// DownloaderOption sets a default of a Downloader, applied to every download
+// it makes. See NewDownloader.
+type DownloaderOption func(*Downloader)
+
+// WithDefaultOptions sets the options every download starts from. The options
+// passed to a download override the fields they set: a zero field (0, "",
+// false or nil) keeps the default, unless it was set through OptionsBuilder or
+// marked with Options.Override.
+// Headers and Resolve entries are merged, with the download's entries taking
+// precedence.
+func WithDefaultOptions(opts *Options) DownloaderOption {
+	return func(d *Downloader) {
+		if opts == nil {
+			return
+		}
+		d.defaults = mergeOptions(d.defaults, opts)
+	}
+}
+
+// WithDefaultHeader adds a header sent with every download.
+func WithDefaultHeader(key, value string) DownloaderOption {
+	return WithDefaultOptions(&Options{Headers: map[string]string{key: value}})
+}
+
+// WithDefaultUserAgent sets the User-Agent of every download.
+func WithDefaultUserAgent(userAgent string) DownloaderOption {
+	return WithDefaultOptions(&NewOptions().WithUserAgent(userAgent).opts)
+}
+
+// WithDefaultProxy sets the proxy of every download.
+func WithDefaultProxy(proxy *types.ProxyConfig) DownloaderOption {
+	return WithDefaultOptions(&NewOptions().WithProxy(proxy).opts)
+}
+
+// WithDefaultMaxRate limits the rate of every download, in bytes per second.
+func WithDefaultMaxRate(bytesPerSecond int64) DownloaderOption {
+	return WithDefaultOptions(&NewOptions().WithMaxRate(bytesPerSecond).opts)
+}
+
+// WithDefaultConcurrency sets the number of connections of every download.
+func WithDefaultConcurrency(connections int) DownloaderOption {
+	return WithDefaultOptions(&NewOptions().WithConcurrency(connections).opts)
+}
+
+// WithDefaultTimeout sets the timeout of every download.
+func WithDefaultTimeout(timeout time.Duration) DownloaderOption {
+	return WithDefaultOptions(&NewOptions().WithTimeout(timeout).opts)
+}
+
+// WithDefaultHostLimits caps the requests in flight to each host and spaces
+// out their starts, across all downloads made through the Downloader.
+func WithDefaultHostLimits(maxConnections int, delay time.Duration) DownloaderOption {
+	return WithDefaultOptions(&Options{MaxConnectionsPerHost: maxConnections, HostDelay: delay})
+}
+
+// mergeOptions returns a copy of defaults with the non-zero fields of opts,
+// and the current values of those it overrides, laid over it. Either may be nil; the result
+// is nil only if both are.
+func mergeOptions(defaults, opts *Options) *Options {
+	if defaults == nil {
+		return opts
+	}
+	if opts == nil {
+		merged := *defaults
+		merged.Headers = maps.Clone(defaults.Headers)
+		merged.Resolve = maps.Clone(defaults.Resolve)
+		return &merged
+	}
+
+	merged := *defaults
+	src := reflect.ValueOf(opts).Elem()
+	dst := reflect.ValueOf(&merged).Elem()
+	for i := range src.NumField() {
+		name := src.Type().Field(i).Name
+		if field := src.Field(i); src.Type().Field(i).IsExported() && (!field.IsZero() || opts.overridden[name]) {
+			dst.Field(i).Set(field)
+		}
+	}
+
+	merged.Headers = mergeMaps(defaults.Headers, opts.Headers)
+	if opts.overridden["Headers"] {
+		merged.Headers = maps.Clone(opts.Headers)
+	}
+
+	merged.Resolve = mergeMaps(defaults.Resolve, opts.Resolve)
+	if opts.overridden["Resolve"] {
+		merged.Resolve = maps.Clone(opts.Resolve)
+	}
+
+	merged.overridden = nil
+
+	return &merged
+}
+
+// mergeMaps returns the entries of both maps, those of over taking
+// precedence, or nil if both are empty.
+func mergeMaps(base, over map[string]string) map[string]string {
+	if len(base) == 0 && len(over) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string, len(base)+len(over))
+	maps.Copy(merged, base)
+	maps.Copy(merged, over)
+
+	return merged
+}
@@ -0,0 +1,276 @@
+package gdl
+
+import (
+	"context"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		field string
+	}{
+		{"zero value", Options{}, ""},
+		{"typical", Options{MaxConcurrency: 8, ChunkSize: 1 << 20, Timeout: time.Minute, EnableResume: true}, ""},
+		{"resume with overwrite", Options{EnableResume: true, OverwriteExisting: true}, "overwrite_existing"},
+		{"resume with a collision policy", Options{EnableResume: true, CollisionPolicy: types.CollisionOverwrite}, ""},
+		{"tiny chunks", Options{ChunkSize: 512}, "chunk_size"},
+		{"negative chunks", Options{ChunkSize: -1}, "chunk_size"},
+		{"negative concurrency", Options{MaxConcurrency: -2}, "max_concurrency"},
+		{"negative retries", Options{RetryAttempts: -1}, "retry_attempts"},
+		{"negative timeout", Options{Timeout: -time.Second}, "timeout"},
+		{"negative rate", Options{MaxRate: -1}, "max_rate"},
+		{"negative speed window", Options{SpeedWindow: -time.Second}, "speed_window"},
+		{"bad IP version", Options{IPVersion: 5}, "ip_version"},
+		{"range with resume", Options{ByteRange: &types.ByteRange{Start: 0, End: 9}, EnableResume: true}, "byte_range"},
+		{"unknown collision policy", Options{CollisionPolicy: "clobber"}, "collision_policy"},
+		{"strict resume", Options{EnableResume: true, ResumeValidation: types.ResumeStrict}, ""},
+		{"unknown resume validation", Options{ResumeValidation: "lenient"}, "resume_validation"},
+		{"fastest mirrors", Options{MirrorStrategy: types.MirrorFastest, MaxMirrors: 2}, ""},
+		{"unknown mirror strategy", Options{MirrorStrategy: "nearest"}, "mirror_strategy"},
+		{"negative mirror limit", Options{MaxMirrors: -1}, "max_mirrors"},
+		{"empty quota", Options{Quota: &types.QuotaOptions{}}, "quota_max_size"},
+		{"negative memory cap", Options{MaxInMemorySize: -1}, "max_in_memory_size"},
+		{"delta", Options{Delta: &types.DeltaOptions{Control: "image.iso.zsync"}}, ""},
+		{"delta without control file", Options{Delta: &types.DeltaOptions{}}, "delta_control"},
+		{"delta with resume", Options{Delta: &types.DeltaOptions{Control: "image.iso.zsync"}, EnableResume: true}, "delta"},
+		{"xxh3 checksum", Options{Checksum: "0123456789ABCDEF", ChecksumAlgorithm: "xxh3"}, ""},
+		{"short checksum", Options{Checksum: "0123456789abcdef"}, "checksum"},
+		{"unknown checksum algorithm", Options{ChecksumAlgorithm: "crc32"}, "checksum_algorithm"},
+		{"range with checksum", Options{ByteRange: &types.ByteRange{Start: 0, End: 9}, Checksum: strings.Repeat("0", 64)}, "byte_range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+
+				return
+			}
+
+			var downloadErr *gdlerrors.DownloadError
+			if !stdErrors.As(err, &downloadErr) || downloadErr.Code != gdlerrors.CodeValidationError {
+				t.Fatalf("Validate() error = %v, want a validation error", err)
+			}
+
+			if !strings.Contains(downloadErr.Details, "field="+tt.field) {
+				t.Errorf("Validate() error details = %q, want field %s", downloadErr.Details, tt.field)
+			}
+		})
+	}
+}
+
+func TestOptionsBuilder(t *testing.T) {
+	builder := NewOptions().
+		WithConcurrency(8).
+		WithChunkSize(64*1024).
+		WithTimeout(5*time.Minute).
+		WithRetries(2).
+		WithHeader("Authorization", "Bearer token").
+		WithCollisionPolicy(types.CollisionSkip).
+		WithAtomicWrite("/tmp/parts")
+
+	opts, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	if opts.MaxConcurrency != 8 || opts.ChunkSize != 64*1024 || opts.Timeout != 5*time.Minute ||
+		opts.RetryAttempts != 2 || opts.CollisionPolicy != types.CollisionSkip ||
+		!opts.AtomicWrite || opts.TempDir != "/tmp/parts" {
+		t.Errorf("Build() = %+v", opts)
+	}
+
+	// Later changes to the builder don't reach options already built
+	builder.WithHeader("X-Trace", "1")
+	if len(opts.Headers) != 1 || opts.Headers["Authorization"] != "Bearer token" {
+		t.Errorf("Headers = %v, want only Authorization", opts.Headers)
+	}
+
+	_, err = NewOptions().WithResume(true).WithOverwrite(true).Build()
+	if gdlerrors.GetErrorCode(err) != gdlerrors.CodeValidationError {
+		t.Errorf("Build() with resume and overwrite error = %v, want a validation error", err)
+	}
+
+	if _, err := NewOptions().WithChunkSize(100).Build(); err == nil {
+		t.Error("Build() with a 100-byte chunk size should fail")
+	}
+}
+
+func TestMergeOptions(t *testing.T) {
+	defaults := &Options{
+		UserAgent:      "app/1.0",
+		MaxConcurrency: 4,
+		Timeout:        time.Minute,
+		CreateDirs:     true,
+		Headers:        map[string]string{"Authorization": "Bearer token", "Accept": "*/*"},
+	}
+
+	merged := mergeOptions(defaults, &Options{
+		MaxConcurrency: 8,
+		Headers:        map[string]string{"Accept": "application/json"},
+	})
+
+	if merged.MaxConcurrency != 8 || merged.UserAgent != "app/1.0" || merged.Timeout != time.Minute || !merged.CreateDirs {
+		t.Errorf("mergeOptions() = %+v", merged)
+	}
+
+	if merged.Headers["Authorization"] != "Bearer token" || merged.Headers["Accept"] != "application/json" {
+		t.Errorf("Headers = %v, want the defaults with Accept overridden", merged.Headers)
+	}
+
+	if defaults.Headers["Accept"] != "*/*" || defaults.MaxConcurrency != 4 {
+		t.Error("mergeOptions() changed the defaults")
+	}
+
+	if got := mergeOptions(nil, nil); got != nil {
+		t.Errorf("mergeOptions(nil, nil) = %+v, want nil", got)
+	}
+
+	if got := mergeOptions(defaults, nil); got.UserAgent != "app/1.0" || len(got.Headers) != 2 {
+		t.Errorf("mergeOptions(defaults, nil) = %+v", got)
+	}
+}
+
+func TestMergeOptionsBuilderFields(t *testing.T) {
+	defaults := &Options{
+		EnableResume: true,
+		MaxRate:      1024 * 1024,
+		UserAgent:    "app/1.0",
+		Headers:      map[string]string{"Authorization": "Bearer token"},
+	}
+
+	// A zero field keeps the default
+	if merged := mergeOptions(defaults, &Options{}); !merged.EnableResume || merged.MaxRate != 1024*1024 {
+		t.Errorf("mergeOptions() = %+v, want the defaults", merged)
+	}
+
+	// The builder's fields override the defaults even when zero
+	opts, err := NewOptions().WithResume(false).WithMaxRate(0).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := mergeOptions(defaults, opts)
+	if merged.EnableResume || merged.MaxRate != 0 || merged.UserAgent != "app/1.0" {
+		t.Errorf("mergeOptions() = %+v, want resume off and no rate limit", merged)
+	}
+
+	// WithHeaders replaces the default headers
+	opts, err = NewOptions().WithHeaders(map[string]string{"Accept": "*/*"}).WithHeader("X-Trace", "1").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged = mergeOptions(defaults, opts)
+	if len(merged.Headers) != 2 || merged.Headers["Accept"] != "*/*" || merged.Headers["X-Trace"] != "1" {
+		t.Errorf("Headers = %v, want only those of the download", merged.Headers)
+	}
+	if len(defaults.Headers) != 1 || len(opts.Headers) != 2 {
+		t.Errorf("merging changed the defaults %v or the options %v", defaults.Headers, opts.Headers)
+	}
+}
+
+func TestMergeOptionsEditedAfterBuild(t *testing.T) {
+	defaults := &Options{MaxRate: 1024 * 1024, RetryAttempts: 3}
+
+	opts, err := NewOptions().WithMaxRate(100).WithRetries(1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The current values of the builder's fields are merged, not those it set
+	opts.MaxRate = 500
+	opts.RetryAttempts = 0
+
+	merged := mergeOptions(defaults, opts)
+	if merged.MaxRate != 500 || merged.RetryAttempts != 0 {
+		t.Errorf("merged MaxRate = %d, RetryAttempts = %d, want 500 and 0", merged.MaxRate, merged.RetryAttempts)
+	}
+}
+
+func TestMergeOptionsOverride(t *testing.T) {
+	defaults := &Options{
+		MaxRate: 1024 * 1024,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}
+
+	opts := (&Options{Headers: map[string]string{"Accept": "*/*"}}).Override("MaxRate", "Headers")
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	merged := mergeOptions(defaults, opts)
+	if merged.MaxRate != 0 {
+		t.Errorf("MaxRate = %d, want the default turned off", merged.MaxRate)
+	}
+	if len(merged.Headers) != 1 || merged.Headers["Accept"] != "*/*" {
+		t.Errorf("Headers = %v, want only those of the download", merged.Headers)
+	}
+
+	if err := (&Options{}).Override("MaxRat").Validate(); err == nil {
+		t.Error("Validate() should reject an unknown overridden field")
+	}
+}
+
+func TestDownloaderDefaults(t *testing.T) {
+	var userAgent, auth, trace string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, auth, trace = r.UserAgent(), r.Header.Get("Authorization"), r.Header.Get("X-Trace")
+		_, _ = w.Write([]byte("defaults"))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader(
+		WithDefaultUserAgent("app/1.0"),
+		WithDefaultHeader("Authorization", "Bearer token"),
+		WithDefaultOptions(&Options{CreateDirs: true}),
+	)
+
+	dest := filepath.Join(t.TempDir(), "sub", "file.txt")
+	if _, err := downloader.Download(context.Background(), server.URL, dest, &Options{
+		Headers: map[string]string{"X-Trace": "1"},
+	}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if userAgent != "app/1.0" || auth != "Bearer token" || trace != "1" {
+		t.Errorf("request User-Agent = %q, Authorization = %q, X-Trace = %q", userAgent, auth, trace)
+	}
+
+	if _, err := downloader.DownloadToWriter(context.Background(), server.URL, &strings.Builder{},
+		&Options{UserAgent: "other/2.0"}); err != nil {
+		t.Fatalf("DownloadToWriter() error = %v", err)
+	}
+
+	if userAgent != "other/2.0" || auth != "Bearer token" {
+		t.Errorf("request User-Agent = %q, Authorization = %q", userAgent, auth)
+	}
+
+	// A download can turn a default off
+	opts, err := NewOptions().WithUserAgent("").WithHeaders(nil).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := downloader.DownloadToWriter(context.Background(), server.URL, &strings.Builder{}, opts); err != nil {
+		t.Fatalf("DownloadToWriter() error = %v", err)
+	}
+
+	if userAgent == "app/1.0" || auth != "" {
+		t.Errorf("request User-Agent = %q, Authorization = %q, want neither default", userAgent, auth)
+	}
+}
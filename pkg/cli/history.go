@@ -0,0 +1,345 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// HistoryEntry is a completed download.
+type HistoryEntry struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Destination string    `json:"destination"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// DefaultHistoryMaxSize is the size past which the history file is rotated.
+const DefaultHistoryMaxSize = 8 << 20
+
+// historyLockTimeout is how long Add waits for another process appending to
+// the history, and how old a lock file is before it is taken to be left by a
+// process that died.
+const historyLockTimeout = 5 * time.Second
+
+// historyTailSize is how much of the end of the history file Add reads to
+// find the last ID.
+const historyTailSize = 64 * 1024
+
+// historyRedactedParams are the query parameters of presigned and
+// token-authenticated URLs that grant access, lower-cased. Their values are
+// not recorded.
+var historyRedactedParams = map[string]bool{
+	"x-amz-signature":      true,
+	"x-amz-credential":     true,
+	"x-amz-security-token": true,
+	"x-goog-signature":     true,
+	"x-goog-credential":    true,
+	"signature":            true,
+	"sig":                  true,
+	"token":                true,
+	"access_token":         true,
+	"api_key":              true,
+	"apikey":               true,
+}
+
+// HistoryStore records completed downloads in a JSON Lines file, one entry
+// per line, oldest first. Entries are only ever appended, under a lock file
+// so that processes appending at once get distinct IDs. A file grown past its
+// maximum size is renamed with a ".1" suffix, replacing the previous one, and
+// a new file is started; List reads both.
+type HistoryStore struct {
+	file    string
+	maxSize int64
+}
+
+// NewHistoryStore creates a history store backed by file, rotated at
+// DefaultHistoryMaxSize.
+func NewHistoryStore(file string) *HistoryStore {
+	return &HistoryStore{file: file, maxSize: DefaultHistoryMaxSize}
+}
+
+// WithMaxSize sets the size past which the history file is rotated.
+func (hs *HistoryStore) WithMaxSize(size int64) *HistoryStore {
+	hs.maxSize = size
+	return hs
+}
+
+// Add appends entry to the history with the next free ID and returns it. The
+// user info and the signature and token query parameters of its URL are
+// redacted.
+func (hs *HistoryStore) Add(ctx context.Context, entry HistoryEntry) (*HistoryEntry, error) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	if dest, err := filepath.Abs(entry.Destination); err == nil {
+		entry.Destination = dest
+	}
+
+	entry.URL = redactHistoryURL(entry.URL)
+
+	dir := filepath.Dir(hs.file)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, gdlerrors.NewInvalidPathError(dir, err)
+	}
+
+	unlock, err := hs.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	lastID, size, err := hs.tail(hs.file)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		// Just rotated: the IDs continue from the previous file
+		if lastID, _, err = hs.tail(hs.rotatedFile()); err != nil {
+			return nil, err
+		}
+	} else if hs.maxSize > 0 && size >= hs.maxSize {
+		if err := os.Rename(hs.file, hs.rotatedFile()); err != nil {
+			return nil, gdlerrors.NewStorageError("rotate history file", err, hs.file)
+		}
+	}
+	entry.ID = lastID + 1
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, gdlerrors.NewConfigError("failed to marshal history entry", err, hs.file)
+	}
+
+	// #nosec G304 -- the history file is chosen by the user
+	file, err := os.OpenFile(hs.file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("write history file", err, hs.file)
+	}
+
+	// Start a new line after a last line cut short, such as by a full disk
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("write history file", err, hs.file)
+	}
+
+	return &entry, nil
+}
+
+// lock takes the history's lock file, waiting for another process holding it
+// until ctx is done or historyLockTimeout passes, and returns the function
+// releasing it. A lock file older than historyLockTimeout is removed.
+func (hs *HistoryStore) lock(ctx context.Context) (func(), error) {
+	path := hs.file + ".lock"
+	deadline := time.Now().Add(historyLockTimeout)
+
+	for {
+		// #nosec G304 -- next to the history file chosen by the user
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, gdlerrors.NewStorageError("lock history file", err, path)
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > historyLockTimeout {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, gdlerrors.NewStorageError("lock history file", err, path)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// tail returns the ID of the last whole entry of the history file path and
+// the file's size, reading only its end. A missing file has neither.
+func (hs *HistoryStore) tail(path string) (int, int64, error) {
+	// #nosec G304 -- the history file is chosen by the user
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, gdlerrors.NewStorageError("read history file", err, path)
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, gdlerrors.NewStorageError("read history file", err, path)
+	}
+
+	offset := max(info.Size()-historyTailSize, 0)
+	data := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(data, offset); err != nil && err != io.EOF {
+		return 0, 0, gdlerrors.NewStorageError("read history file", err, path)
+	}
+
+	lines := bytes.Split(data, []byte{'\n'})
+	for i := len(lines) - 1; i >= 0; i-- {
+		var entry HistoryEntry
+		if json.Unmarshal(lines[i], &entry) == nil && entry.ID > 0 {
+			return entry.ID, info.Size(), nil
+		}
+	}
+
+	return 0, info.Size(), nil
+}
+
+// rotatedFile returns the file the history is renamed to when rotated.
+func (hs *HistoryStore) rotatedFile() string {
+	return hs.file + ".1"
+}
+
+// List returns the recorded downloads, oldest first, including those of the
+// rotated file. Lines that cannot be parsed, such as one cut short by a full
+// disk, are skipped.
+func (hs *HistoryStore) List(ctx context.Context) ([]*HistoryEntry, error) {
+	rotated, err := readHistoryFile(hs.rotatedFile())
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := readHistoryFile(hs.file)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rotated, entries...), nil
+}
+
+// readHistoryFile returns the entries of the history file path, or none if it
+// does not exist.
+func readHistoryFile(path string) ([]*HistoryEntry, error) {
+	// #nosec G304 -- the history file is chosen by the user
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("read history file", err, path)
+	}
+	defer func() { _ = file.Close() }()
+
+	var entries []*HistoryEntry
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := &HistoryEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil || entry.ID == 0 {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, gdlerrors.NewStorageError("read history file", err, path)
+	}
+
+	return entries, nil
+}
+
+// Search returns the recorded downloads whose URL or destination contains
+// query, ignoring case, oldest first.
+func (hs *HistoryStore) Search(ctx context.Context, query string) ([]*HistoryEntry, error) {
+	entries, err := hs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+
+	var matches []*HistoryEntry
+	for _, entry := range entries {
+		if strings.Contains(strings.ToLower(entry.URL), query) ||
+			strings.Contains(strings.ToLower(entry.Destination), query) {
+			matches = append(matches, entry)
+		}
+	}
+
+	return matches, nil
+}
+
+// Get returns the recorded download with the given ID.
+func (hs *HistoryStore) Get(ctx context.Context, id int) (*HistoryEntry, error) {
+	entries, err := hs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+
+	return nil, gdlerrors.NewValidationError("id", "no download "+strconv.Itoa(id)+" in the history")
+}
+
+// redactHistoryURL returns rawURL without its user info, which may hold a
+// password or a token, and with the values of its signature and token query
+// parameters replaced as url.URL.Redacted replaces a password, so the history
+// holds no credentials.
+func redactHistoryURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	u.User = nil
+
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			key, _, _ := strings.Cut(param, "=")
+			if name, err := url.QueryUnescape(key); err == nil && historyRedactedParams[strings.ToLower(name)] {
+				params[i] = key + "=xxxxx"
+			}
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+
+	return u.String()
+}
+
+// GetDefaultHistoryFile returns the default history file
+func GetDefaultHistoryFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "./history.jsonl"
+	}
+	return filepath.Join(homeDir, ".gdl", "history.jsonl")
+}
@@ -0,0 +1,428 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/forest6511/gdl/internal/checksum"
+	"github.com/forest6511/gdl/internal/core"
+	"github.com/forest6511/gdl/internal/signature"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/plugin"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// maxIndexSize caps the size of a plugin index document.
+const maxIndexSize = 10 * 1024 * 1024 // 10MB
+
+// PluginIndex is a catalogue of installable plugins, published as JSON at a
+// URL or kept as a local file.
+type PluginIndex struct {
+	Plugins []*IndexPlugin `json:"plugins"`
+}
+
+// IndexPlugin describes a plugin and its published releases.
+type IndexPlugin struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Type        string          `json:"type,omitempty"`
+	Releases    []*IndexRelease `json:"releases"`
+}
+
+// IndexRelease is a plugin binary for one version and, optionally, one
+// platform.
+type IndexRelease struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+
+	// Signature is the URL of a detached OpenPGP signature of the binary.
+	Signature string `json:"signature,omitempty"`
+
+	// OS and Arch restrict the release to a platform (empty = any).
+	OS   string `json:"os,omitempty"`
+	Arch string `json:"arch,omitempty"`
+
+	// Capabilities the release needs; they are installed as its manifest.
+	Capabilities plugin.Capabilities `json:"capabilities,omitempty"`
+}
+
+// WithIndex sets the URL or local path of the plugin index used by
+// InstallFromIndex, Update and Search.
+func (pr *PluginRegistry) WithIndex(index string) *PluginRegistry {
+	pr.indexURL = index
+	return pr
+}
+
+// WithKeyRing sets a file of OpenPGP public keys. When set, plugins installed
+// from the index must carry a detached signature made by one of the keys.
+func (pr *PluginRegistry) WithKeyRing(path string) *PluginRegistry {
+	pr.keyRing = path
+	return pr
+}
+
+// FetchIndex reads the plugin index.
+func (pr *PluginRegistry) FetchIndex(ctx context.Context) (*PluginIndex, error) {
+	if pr.indexURL == "" {
+		return nil, gdlerrors.NewConfigError("no plugin index configured", nil, "")
+	}
+
+	data, err := pr.readSource(ctx, pr.indexURL, maxIndexSize)
+	if err != nil {
+		return nil, gdlerrors.NewConfigError("failed to fetch plugin index", err, pr.indexURL)
+	}
+
+	index := &PluginIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, gdlerrors.NewConfigError("failed to parse plugin index", err, pr.indexURL)
+	}
+
+	return index, nil
+}
+
+// Search returns the index plugins whose name or description contains query,
+// ignoring case, sorted by name. An empty query matches every plugin.
+func (pr *PluginRegistry) Search(ctx context.Context, query string) ([]*IndexPlugin, error) {
+	index, err := pr.FetchIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+
+	var matches []*IndexPlugin
+	for _, entry := range index.Plugins {
+		if strings.Contains(strings.ToLower(entry.Name), query) ||
+			strings.Contains(strings.ToLower(entry.Description), query) {
+			matches = append(matches, entry)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+
+	return matches, nil
+}
+
+// Resolve finds the newest release of a plugin that satisfies constraint
+// ("^1.2.0", "~1.2.0", ">=1.0.0", "1.2.3", ...) and runs on this platform. An
+// empty constraint selects the newest release. Pre-releases are skipped unless
+// the constraint names one.
+func (pr *PluginRegistry) Resolve(ctx context.Context, name, constraint string) (*IndexPlugin, *IndexRelease, error) {
+	index, err := pr.FetchIndex(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, entry := range index.Plugins {
+		if entry.Name != name {
+			continue
+		}
+
+		release, err := resolveRelease(entry, constraint)
+		if err != nil {
+			return nil, nil, gdlerrors.NewPluginError(name, err, "failed to resolve version")
+		}
+
+		return entry, release, nil
+	}
+
+	return nil, nil, gdlerrors.NewPluginError(name, nil, "plugin not found in index")
+}
+
+// resolveRelease picks the newest release of entry matching constraint and
+// the running platform.
+func resolveRelease(entry *IndexPlugin, constraint string) (*IndexRelease, error) {
+	var (
+		best        *IndexRelease
+		bestVersion *plugin.Version
+	)
+
+	for _, release := range entry.Releases {
+		if !release.supportsPlatform(runtime.GOOS, runtime.GOARCH) {
+			continue
+		}
+
+		version, err := plugin.ParseVersion(release.Version)
+		if err != nil {
+			continue
+		}
+
+		// Pre-releases are only picked by a constraint naming one
+		if version.PreRelease != "" && !strings.Contains(constraint, "-") {
+			continue
+		}
+
+		if constraint != "" {
+			ok, err := version.IsCompatible(constraint)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if bestVersion == nil || version.Compare(bestVersion) > 0 {
+			best, bestVersion = release, version
+		}
+	}
+
+	if best == nil {
+		if constraint == "" {
+			return nil, fmt.Errorf("no release for %s/%s", runtime.GOOS, runtime.GOARCH)
+		}
+		return nil, fmt.Errorf("no release matching %q for %s/%s", constraint, runtime.GOOS, runtime.GOARCH)
+	}
+
+	return best, nil
+}
+
+// supportsPlatform reports whether the release runs on goos/goarch.
+func (r *IndexRelease) supportsPlatform(goos, goarch string) bool {
+	return (r.OS == "" || r.OS == goos) && (r.Arch == "" || r.Arch == goarch)
+}
+
+// ParsePluginSpec splits "name@constraint" into its parts. The constraint is
+// empty when the spec has none.
+func ParsePluginSpec(spec string) (name, constraint string) {
+	name, constraint, _ = strings.Cut(spec, "@")
+	return name, constraint
+}
+
+// InstallFromIndex installs the newest release of a plugin from the index that
+// satisfies constraint. The binary must match the SHA-256 published in the
+// index and, with a keyring configured, its detached signature.
+func (pr *PluginRegistry) InstallFromIndex(ctx context.Context, name, constraint string) error {
+	config, err := pr.loadConfig()
+	if err != nil {
+		return gdlerrors.NewConfigError("failed to load plugin config", err, pr.configFile)
+	}
+
+	if _, exists := config.Plugins[name]; exists {
+		return gdlerrors.NewPluginError(name, nil, "plugin already exists")
+	}
+
+	_, release, err := pr.Resolve(ctx, name, constraint)
+	if err != nil {
+		return err
+	}
+
+	pluginInfo, err := pr.installRelease(ctx, name, release)
+	if err != nil {
+		return err
+	}
+
+	pluginInfo.Constraint = constraint
+	config.Plugins[name] = pluginInfo
+
+	if err := pr.saveConfig(config); err != nil {
+		return gdlerrors.NewConfigError("failed to save plugin config", err, pr.configFile)
+	}
+
+	return nil
+}
+
+// Update installs the newest index release of a plugin that satisfies the
+// constraint it was installed with, keeping its configuration and enabled
+// state. It returns the new version, or "" when the plugin is up to date.
+func (pr *PluginRegistry) Update(ctx context.Context, name string) (string, error) {
+	config, err := pr.loadConfig()
+	if err != nil {
+		return "", gdlerrors.NewConfigError("failed to load plugin config", err, pr.configFile)
+	}
+
+	current, exists := config.Plugins[name]
+	if !exists {
+		return "", gdlerrors.NewPluginError(name, nil, "plugin not found")
+	}
+
+	if !current.FromIndex() {
+		return "", gdlerrors.NewPluginError(name, nil, "plugin was not installed from the index")
+	}
+
+	_, release, err := pr.Resolve(ctx, name, current.Constraint)
+	if err != nil {
+		return "", err
+	}
+
+	if !isNewer(release.Version, current.Version) {
+		return "", nil
+	}
+
+	pluginInfo, err := pr.installRelease(ctx, name, release)
+	if err != nil {
+		return "", err
+	}
+
+	pluginInfo.Constraint = current.Constraint
+	pluginInfo.Enabled = current.Enabled
+	pluginInfo.Config = current.Config
+	config.Plugins[name] = pluginInfo
+
+	if err := pr.saveConfig(config); err != nil {
+		return "", gdlerrors.NewConfigError("failed to save plugin config", err, pr.configFile)
+	}
+
+	if current.Path != pluginInfo.Path {
+		pr.removePluginFile(current.Path)
+	}
+
+	return pluginInfo.Version, nil
+}
+
+// FromIndex reports whether the plugin was installed from a plugin index.
+func (pi *PluginInfo) FromIndex() bool {
+	return strings.HasPrefix(pi.Source, indexSourcePrefix)
+}
+
+// indexSourcePrefix marks the Source of plugins installed from the index.
+const indexSourcePrefix = "index:"
+
+// isNewer reports whether version a is newer than b. A b that is not a
+// semantic version is treated as older.
+func isNewer(a, b string) bool {
+	va, err := plugin.ParseVersion(a)
+	if err != nil {
+		return false
+	}
+
+	vb, err := plugin.ParseVersion(b)
+	if err != nil {
+		return true
+	}
+
+	return va.Compare(vb) > 0
+}
+
+// installRelease downloads and verifies a release into the plugin directory
+// and loads it. The file is named after the version so an update never
+// overwrites a binary that may still be loaded.
+func (pr *PluginRegistry) installRelease(ctx context.Context, name string, release *IndexRelease) (*PluginInfo, error) {
+	if err := os.MkdirAll(pr.pluginDir, 0750); err != nil {
+		return nil, gdlerrors.NewInvalidPathError(pr.pluginDir, err)
+	}
+
+	fileName := pluginFileName(release.URL, name+"-"+release.Version)
+	pluginPath := filepath.Join(pr.pluginDir, fileName)
+
+	if err := pr.downloadFromURL(ctx, release.URL, pluginPath); err != nil {
+		return nil, gdlerrors.NewPluginError(name, err, "failed to download plugin")
+	}
+
+	if err := pr.verifyRelease(ctx, release, pluginPath); err != nil {
+		pr.removePluginFile(pluginPath)
+		return nil, gdlerrors.NewPluginError(name, err, "failed to verify plugin")
+	}
+
+	if err := makeExecutable(pluginPath); err != nil {
+		pr.removePluginFile(pluginPath)
+		return nil, gdlerrors.NewPluginError(name, err, "failed to make plugin executable")
+	}
+
+	manifest := &plugin.Manifest{Name: name, Version: release.Version, Capabilities: release.Capabilities}
+	if err := writeManifest(pluginPath, manifest); err != nil {
+		pr.removePluginFile(pluginPath)
+		return nil, gdlerrors.NewPluginError(name, err, "failed to install plugin manifest")
+	}
+
+	pluginInfo, err := pr.loadInstalled(name, pluginPath, indexSourcePrefix+release.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	pluginInfo.Checksum = strings.ToLower(release.SHA256)
+
+	return pluginInfo, nil
+}
+
+// verifyRelease checks the downloaded binary at path against the release's
+// SHA-256 and, with a keyring configured, its detached signature.
+func (pr *PluginRegistry) verifyRelease(ctx context.Context, release *IndexRelease, path string) error {
+	if release.SHA256 == "" {
+		return gdlerrors.NewValidationError("sha256", "index release has no checksum")
+	}
+
+	actual, err := checksum.File(path, checksum.SHA256)
+	if err != nil {
+		return gdlerrors.NewStorageError("hash plugin file", err, path)
+	}
+
+	if !strings.EqualFold(actual, release.SHA256) {
+		return gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeCorruptedData,
+			"Plugin checksum mismatch", fmt.Sprintf("expected %s, got %s", release.SHA256, actual))
+	}
+
+	if pr.keyRing == "" {
+		return nil
+	}
+
+	if release.Signature == "" {
+		return gdlerrors.WrapError(gdlerrors.ErrSignatureMismatch, gdlerrors.CodeCorruptedData,
+			"Signature verification failed: the index release is not signed")
+	}
+
+	keyring, err := signature.ReadKeyRing(pr.keyRing)
+	if err != nil {
+		return err
+	}
+
+	sig, err := pr.readSource(ctx, release.Signature, maxIndexSize)
+	if err != nil {
+		return err
+	}
+
+	_, err = signature.VerifyFile(keyring, path, bytes.NewReader(sig))
+
+	return err
+}
+
+// readSource reads up to limit bytes from an http(s) URL or a local file.
+func (pr *PluginRegistry) readSource(ctx context.Context, source string, limit int64) ([]byte, error) {
+	if !isRemoteSource(source) {
+		file, err := os.Open(filepath.Clean(source)) // #nosec G304 - path is chosen by the user
+		if err != nil {
+			return nil, gdlerrors.NewStorageError("open file", err, source)
+		}
+		defer func() { _ = file.Close() }()
+
+		return io.ReadAll(io.LimitReader(file, limit))
+	}
+
+	var buf bytes.Buffer
+	if _, err := core.NewDownloader().DownloadToWriter(ctx, source, &limitedWriter{w: &buf, n: limit},
+		&types.DownloadOptions{Timeout: 30 * time.Second}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// isRemoteSource reports whether source is an http(s) URL.
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// limitedWriter fails writes past n bytes.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, gdlerrors.NewValidationError("size", "response too large")
+	}
+
+	l.n -= int64(len(p))
+
+	return l.w.Write(p)
+}
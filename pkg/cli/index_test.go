@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// writeIndex writes index as JSON to a temporary file and returns its path.
+func writeIndex(t *testing.T, index *PluginIndex) string {
+	t.Helper()
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPluginRegistry_Search(t *testing.T) {
+	index := writeIndex(t, &PluginIndex{Plugins: []*IndexPlugin{
+		{Name: "s3", Description: "Amazon S3 storage"},
+		{Name: "oauth2", Description: "OAuth2 authentication"},
+		{Name: "gcs", Description: "Google Cloud Storage"},
+	}})
+
+	registry := NewPluginRegistry(t.TempDir(), filepath.Join(t.TempDir(), "plugins.json")).WithIndex(index)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"gcs", "oauth2", "s3"}},
+		{"storage", []string{"gcs", "s3"}},
+		{"OAUTH", []string{"oauth2"}},
+		{"ftp", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := registry.Search(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			var names []string
+			for _, result := range results {
+				names = append(names, result.Name)
+			}
+
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluginRegistry_SearchWithoutIndex(t *testing.T) {
+	registry := NewPluginRegistry(t.TempDir(), filepath.Join(t.TempDir(), "plugins.json"))
+
+	if _, err := registry.Search(context.Background(), ""); err == nil {
+		t.Error("Search() without an index should fail")
+	}
+}
+
+func TestPluginRegistry_Resolve(t *testing.T) {
+	index := writeIndex(t, &PluginIndex{Plugins: []*IndexPlugin{{
+		Name: "s3",
+		Releases: []*IndexRelease{
+			{Version: "1.0.0"},
+			{Version: "1.2.0"},
+			{Version: "1.3.0", OS: "plan9"},
+			{Version: "1.4.0-beta.1"},
+			{Version: "2.0.0"},
+			{Version: "not-a-version"},
+		},
+	}}})
+
+	registry := NewPluginRegistry(t.TempDir(), filepath.Join(t.TempDir(), "plugins.json")).WithIndex(index)
+
+	tests := []struct {
+		constraint string
+		want       string
+		wantErr    bool
+	}{
+		{"", "2.0.0", false},
+		{"^1.0.0", "1.2.0", false},
+		{"~1.0.0", "1.0.0", false},
+		{"1.2.0", "1.2.0", false},
+		{"<1.2.0", "1.0.0", false},
+		{"^3.0.0", "", true},
+		{"^bogus", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			_, release, err := registry.Resolve(context.Background(), "s3", tt.constraint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && release.Version != tt.want {
+				t.Errorf("Resolve(%q) = %s, want %s", tt.constraint, release.Version, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := registry.Resolve(context.Background(), "missing", ""); err == nil {
+		t.Error("Resolve() of a plugin not in the index should fail")
+	}
+}
+
+func TestParsePluginSpec(t *testing.T) {
+	tests := []struct {
+		spec, name, constraint string
+	}{
+		{"s3", "s3", ""},
+		{"s3@^1.2.0", "s3", "^1.2.0"},
+		{"s3@1.0.0", "s3", "1.0.0"},
+	}
+
+	for _, tt := range tests {
+		name, constraint := ParsePluginSpec(tt.spec)
+		if name != tt.name || constraint != tt.constraint {
+			t.Errorf("ParsePluginSpec(%q) = %q, %q, want %q, %q", tt.spec, name, constraint, tt.name, tt.constraint)
+		}
+	}
+}
+
+func TestPluginRegistry_InstallFromIndexVerifies(t *testing.T) {
+	binary := []byte("plugin binary")
+
+	signer, err := openpgp.NewEntity("Plugin Signing", "", "plugins@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sig, otherSig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, signer, bytes.NewReader(binary), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.DetachSign(&otherSig, signer, strings.NewReader("something else"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var keyring bytes.Buffer
+	if err := signer.Serialize(&keyring); err != nil {
+		t.Fatal(err)
+	}
+	keyringPath := filepath.Join(t.TempDir(), "keyring.gpg")
+	if err := os.WriteFile(keyringPath, keyring.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plugin.so":
+			_, _ = w.Write(binary)
+		case "/plugin.so.sig":
+			_, _ = w.Write(sig.Bytes())
+		case "/other.sig":
+			_, _ = w.Write(otherSig.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		checksum  string
+		signature string
+		keyring   string
+		wantLoad  bool // Verification passed and the install failed loading the fake binary
+		wantSig   bool
+	}{
+		{"checksum match", sha256Hex(binary), "", "", true, false},
+		{"checksum mismatch", sha256Hex([]byte("tampered")), "", "", false, false},
+		{"missing checksum", "", "", "", false, false},
+		{"valid signature", sha256Hex(binary), server.URL + "/plugin.so.sig", keyringPath, true, false},
+		{"wrong signature", sha256Hex(binary), server.URL + "/other.sig", keyringPath, false, true},
+		{"unsigned with keyring", sha256Hex(binary), "", keyringPath, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := writeIndex(t, &PluginIndex{Plugins: []*IndexPlugin{{
+				Name: "fake",
+				Releases: []*IndexRelease{{
+					Version:   "1.0.0",
+					URL:       server.URL + "/plugin.so",
+					SHA256:    tt.checksum,
+					Signature: tt.signature,
+					OS:        runtime.GOOS,
+				}},
+			}}})
+
+			pluginDir := t.TempDir()
+			registry := NewPluginRegistry(pluginDir, filepath.Join(t.TempDir(), "plugins.json")).
+				WithIndex(index).
+				WithKeyRing(tt.keyring)
+
+			err := registry.InstallFromIndex(context.Background(), "fake", "^1.0.0")
+			if err == nil {
+				t.Fatal("InstallFromIndex() of a fake binary should fail")
+			}
+
+			var downloadErr *gdlerrors.DownloadError
+			if !stdErrors.As(err, &downloadErr) {
+				t.Fatalf("InstallFromIndex() error = %T, want *DownloadError", err)
+			}
+
+			if loaded := downloadErr.Details == "failed to load plugin"; loaded != tt.wantLoad {
+				t.Errorf("InstallFromIndex() error = %v, want load failure %v", err, tt.wantLoad)
+			}
+
+			if sigErr := stdErrors.Is(err, gdlerrors.ErrSignatureMismatch); sigErr != tt.wantSig {
+				t.Errorf("InstallFromIndex() error = %v, want ErrSignatureMismatch %v", err, tt.wantSig)
+			}
+
+			entries, _ := os.ReadDir(pluginDir)
+			if len(entries) != 0 {
+				t.Errorf("plugin directory has %d files after a failed install, want 0", len(entries))
+			}
+		})
+	}
+}
+
+func TestPluginRegistry_Update(t *testing.T) {
+	index := writeIndex(t, &PluginIndex{Plugins: []*IndexPlugin{{
+		Name:     "s3",
+		Releases: []*IndexRelease{{Version: "1.2.0"}, {Version: "2.0.0"}},
+	}}})
+
+	configFile := filepath.Join(t.TempDir(), "plugins.json")
+	registry := NewPluginRegistry(t.TempDir(), configFile).WithIndex(index)
+
+	config := &PluginConfig{Plugins: map[string]*PluginInfo{
+		"s3":    {Name: "s3", Version: "1.2.0", Source: indexSourcePrefix + "https://example.com/s3.so", Constraint: "^1.0.0"},
+		"local": {Name: "local", Version: "1.0.0", Source: "/tmp/local.so"},
+	}}
+	if err := registry.saveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := registry.Update(context.Background(), "s3")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if version != "" {
+		t.Errorf("Update() = %q, want up to date within ^1.0.0", version)
+	}
+
+	if _, err := registry.Update(context.Background(), "local"); err == nil {
+		t.Error("Update() of a plugin not installed from the index should fail")
+	}
+
+	if _, err := registry.Update(context.Background(), "missing"); err == nil {
+		t.Error("Update() of a missing plugin should fail")
+	}
+}
+
+func TestIsNewer(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.2.0", "1.1.0", true},
+		{"1.1.0", "1.1.0", false},
+		{"1.0.0", "1.1.0", false},
+		{"1.0.0", "unknown", true},
+		{"bogus", "1.0.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := isNewer(tt.a, tt.b); got != tt.want {
+			t.Errorf("isNewer(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -3,14 +3,18 @@ package cli
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/forest6511/gdl/internal/core"
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
 	"github.com/forest6511/gdl/pkg/plugin"
+	"github.com/forest6511/gdl/pkg/secrets"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 // PluginRegistry manages CLI plugin operations
@@ -18,6 +22,9 @@ type PluginRegistry struct {
 	pluginDir    string
 	configFile   string
 	pluginLoader *plugin.PluginLoader
+	indexURL     string // Plugin index URL or path
+	keyRing      string // OpenPGP public keys plugin releases must be signed with
+	keychain     secrets.Keychain
 }
 
 // PluginInfo represents installed plugin information
@@ -30,6 +37,8 @@ type PluginInfo struct {
 	Config      map[string]string `json:"config,omitempty"`
 	InstallTime time.Time         `json:"install_time"`
 	Source      string            `json:"source,omitempty"`
+	Constraint  string            `json:"constraint,omitempty"` // Version constraint of an index install
+	Checksum    string            `json:"checksum,omitempty"`   // SHA-256 published in the index
 }
 
 // PluginConfig represents the plugin configuration file
@@ -49,9 +58,17 @@ func NewPluginRegistry(pluginDir, configFile string) *PluginRegistry {
 		pluginDir:    pluginDir,
 		configFile:   configFile,
 		pluginLoader: plugin.NewPluginLoader(loaderConfig),
+		keychain:     secrets.System(),
 	}
 }
 
+// WithKeychain sets the keychain plugin secrets are stored in, the one of
+// the platform by default.
+func (pr *PluginRegistry) WithKeychain(keychain secrets.Keychain) *PluginRegistry {
+	pr.keychain = keychain
+	return pr
+}
+
 // List returns all installed plugins
 func (pr *PluginRegistry) List(ctx context.Context) ([]*PluginInfo, error) {
 	config, err := pr.loadConfig()
@@ -84,26 +101,48 @@ func (pr *PluginRegistry) Install(ctx context.Context, source, name string) erro
 		return gdlerrors.NewInvalidPathError(pr.pluginDir, err)
 	}
 
-	pluginPath := filepath.Join(pr.pluginDir, name+".so")
+	pluginPath := filepath.Join(pr.pluginDir, pluginFileName(source, name))
 
 	// Download/copy plugin based on source type
 	if err := pr.downloadPlugin(ctx, source, pluginPath); err != nil {
 		return gdlerrors.NewPluginError(name, err, "failed to download plugin")
 	}
 
-	// Load plugin to verify it's valid
+	if err := makeExecutable(pluginPath); err != nil {
+		pr.removePluginFile(pluginPath)
+		return gdlerrors.NewPluginError(name, err, "failed to make plugin executable")
+	}
+
+	if err := pr.copyManifest(source, pluginPath); err != nil {
+		pr.removePluginFile(pluginPath)
+		return gdlerrors.NewPluginError(name, err, "failed to install plugin manifest")
+	}
+
+	pluginInfo, err := pr.loadInstalled(name, pluginPath, source)
+	if err != nil {
+		return err
+	}
+
+	// Update configuration
+	config.Plugins[name] = pluginInfo
+
+	if err := pr.saveConfig(config); err != nil {
+		return gdlerrors.NewConfigError("failed to save plugin config", err, pr.configFile)
+	}
+
+	return nil
+}
+
+// loadInstalled loads a freshly installed plugin file to verify it's valid and
+// describes it, removing the file if it does not load.
+func (pr *PluginRegistry) loadInstalled(name, pluginPath, source string) (*PluginInfo, error) {
 	pluginInstance, err := pr.pluginLoader.Load(pluginPath)
 	if err != nil {
-		// Clean up on failure
-		if removeErr := os.Remove(pluginPath); removeErr != nil {
-			// Log the cleanup error but don't override the main error
-			fmt.Printf("Warning: failed to cleanup plugin file %s: %v\n", pluginPath, removeErr)
-		}
-		return gdlerrors.NewPluginError(name, err, "failed to load plugin")
+		pr.removePluginFile(pluginPath)
+		return nil, gdlerrors.NewPluginError(name, err, "failed to load plugin")
 	}
 
-	// Create plugin info
-	pluginInfo := &PluginInfo{
+	return &PluginInfo{
 		Name:        pluginInstance.Name(),
 		Version:     pluginInstance.Version(),
 		Type:        pr.pluginLoader.GetLoadedPlugins()[pluginPath].Type,
@@ -112,16 +151,64 @@ func (pr *PluginRegistry) Install(ctx context.Context, source, name string) erro
 		InstallTime: time.Now(),
 		Source:      source,
 		Config:      make(map[string]string),
+	}, nil
+}
+
+// pluginFileName names the installed file of a plugin: name.so for a native
+// plugin, or gdl-plugin-name with the source's extension (e.g. ".exe") for an
+// out-of-process plugin executable.
+func pluginFileName(source, name string) string {
+	if plugin.IsExternalPlugin(source) {
+		return plugin.ExternalPluginPrefix + name + filepath.Ext(source)
 	}
 
-	// Update configuration
-	config.Plugins[name] = pluginInfo
+	return name + ".so"
+}
 
-	if err := pr.saveConfig(config); err != nil {
-		return gdlerrors.NewConfigError("failed to save plugin config", err, pr.configFile)
+// makeExecutable marks an out-of-process plugin executable as such.
+func makeExecutable(pluginPath string) error {
+	if !plugin.IsExternalPlugin(pluginPath) {
+		return nil
 	}
 
-	return nil
+	return os.Chmod(pluginPath, 0750) // #nosec G302 - plugin executables must be executable
+}
+
+// copyManifest installs the manifest found next to a local plugin source, if
+// any, next to the installed plugin. Without a manifest the plugin is granted
+// no capabilities.
+func (pr *PluginRegistry) copyManifest(source, pluginPath string) error {
+	if isRemoteSource(source) {
+		return nil
+	}
+
+	manifestPath := plugin.ManifestPath(source)
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	return pr.copyLocalFile(manifestPath, plugin.ManifestPath(pluginPath))
+}
+
+// writeManifest installs manifest next to the plugin at pluginPath.
+func writeManifest(pluginPath string, manifest *plugin.Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(plugin.ManifestPath(pluginPath), data, 0600)
+}
+
+// removePluginFile cleans up a plugin file and its manifest after a failed
+// install or when the plugin is removed.
+func (pr *PluginRegistry) removePluginFile(pluginPath string) {
+	for _, path := range []string{pluginPath, plugin.ManifestPath(pluginPath)} {
+		if removeErr := os.Remove(path); removeErr != nil && !os.IsNotExist(removeErr) {
+			// Log the cleanup error but don't override the main error
+			fmt.Printf("Warning: failed to cleanup plugin file %s: %v\n", path, removeErr)
+		}
+	}
 }
 
 // Remove uninstalls a plugin
@@ -140,6 +227,21 @@ func (pr *PluginRegistry) Remove(ctx context.Context, name string) error {
 	if err := os.Remove(pluginInfo.Path); err != nil && !os.IsNotExist(err) {
 		return gdlerrors.NewStorageError("remove plugin file", err, pluginInfo.Path)
 	}
+	if err := os.Remove(plugin.ManifestPath(pluginInfo.Path)); err != nil && !os.IsNotExist(err) {
+		return gdlerrors.NewStorageError("remove plugin manifest", err, pluginInfo.Path)
+	}
+
+	// Remove the secrets stored for it
+	for _, value := range pluginInfo.Config {
+		secretName, ok := strings.CutPrefix(value, secrets.RefPrefix)
+		if !ok || !strings.HasPrefix(secretName, pluginSecretName(name, "")) {
+			continue
+		}
+
+		if err := pr.keychain.Delete(secretName); err != nil && !errors.Is(err, secrets.ErrNotFound) {
+			fmt.Printf("Warning: failed to delete secret %s: %v\n", secretName, err)
+		}
+	}
 
 	// Remove from configuration
 	delete(config.Plugins, name)
@@ -151,6 +253,32 @@ func (pr *PluginRegistry) Remove(ctx context.Context, name string) error {
 	return nil
 }
 
+// Get returns an installed plugin
+func (pr *PluginRegistry) Get(ctx context.Context, name string) (*PluginInfo, error) {
+	config, err := pr.loadConfig()
+	if err != nil {
+		return nil, gdlerrors.NewConfigError("failed to load plugin config", err, pr.configFile)
+	}
+
+	pluginInfo, exists := config.Plugins[name]
+	if !exists {
+		return nil, gdlerrors.NewPluginError(name, nil, "plugin not found")
+	}
+
+	return pluginInfo, nil
+}
+
+// Manifest returns the manifest installed with a plugin; it is empty if the
+// plugin came without one.
+func (pr *PluginRegistry) Manifest(ctx context.Context, name string) (*plugin.Manifest, error) {
+	pluginInfo, err := pr.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return plugin.LoadManifest(pluginInfo.Path)
+}
+
 // Enable enables a plugin
 func (pr *PluginRegistry) Enable(ctx context.Context, name string) error {
 	return pr.setPluginEnabled(name, true)
@@ -207,6 +335,28 @@ func (pr *PluginRegistry) Configure(ctx context.Context, name, key, value string
 	return nil
 }
 
+// ConfigureSecret stores a configuration value of a plugin, such as an API
+// token, in the keychain and sets the key to refer to it, so that the plugin
+// config file never holds the value. The plugin gets the value when loaded.
+func (pr *PluginRegistry) ConfigureSecret(ctx context.Context, name, key, value string) error {
+	if _, err := pr.Get(ctx, name); err != nil {
+		return err
+	}
+
+	secretName := pluginSecretName(name, key)
+	if err := pr.keychain.Set(secretName, value); err != nil {
+		return gdlerrors.NewConfigError("failed to store plugin secret", err, secretName)
+	}
+
+	return pr.Configure(ctx, name, key, secrets.Ref(secretName))
+}
+
+// pluginSecretName names the keychain secret holding a configuration value
+// of a plugin.
+func pluginSecretName(name, key string) string {
+	return "plugin/" + name + "/" + key
+}
+
 // GetEnabledPlugins returns all enabled plugins
 func (pr *PluginRegistry) GetEnabledPlugins(ctx context.Context) ([]*PluginInfo, error) {
 	allPlugins, err := pr.List(ctx)
@@ -241,9 +391,10 @@ func (pr *PluginRegistry) LoadPlugins(ctx context.Context, pluginManager *plugin
 
 		// Initialize plugin with configuration
 		if len(pluginInfo.Config) > 0 {
-			config := make(map[string]interface{})
-			for k, v := range pluginInfo.Config {
-				config[k] = v
+			config, err := pr.resolveConfig(pluginInfo.Config)
+			if err != nil {
+				fmt.Printf("Warning: failed to configure plugin %s: %v\n", pluginInfo.Name, err)
+				continue
 			}
 			if err := pluginInstance.Init(config); err != nil {
 				fmt.Printf("Warning: failed to initialize plugin %s: %v\n", pluginInfo.Name, err)
@@ -251,7 +402,13 @@ func (pr *PluginRegistry) LoadPlugins(ctx context.Context, pluginManager *plugin
 			}
 		}
 
-		if err := pluginManager.Register(pluginInstance); err != nil {
+		manifest, err := plugin.LoadManifest(pluginInfo.Path)
+		if err != nil {
+			fmt.Printf("Warning: failed to read manifest of plugin %s: %v\n", pluginInfo.Name, err)
+			continue
+		}
+
+		if err := pluginManager.RegisterWithCapabilities(pluginInstance, &manifest.Capabilities); err != nil {
 			fmt.Printf("Warning: failed to register plugin %s: %v\n", pluginInfo.Name, err)
 			continue
 		}
@@ -260,6 +417,22 @@ func (pr *PluginRegistry) LoadPlugins(ctx context.Context, pluginManager *plugin
 	return nil
 }
 
+// resolveConfig returns the configuration a plugin is initialized with,
+// with the values stored in the keychain read from it.
+func (pr *PluginRegistry) resolveConfig(values map[string]string) (map[string]interface{}, error) {
+	config := make(map[string]interface{}, len(values))
+
+	for k, v := range values {
+		value, err := secrets.Resolve(pr.keychain, v)
+		if err != nil {
+			return nil, err
+		}
+		config[k] = value
+	}
+
+	return config, nil
+}
+
 // downloadPlugin downloads a plugin from various sources
 func (pr *PluginRegistry) downloadPlugin(ctx context.Context, source, destination string) error {
 	// Determine source type and handle accordingly
@@ -277,12 +450,12 @@ func (pr *PluginRegistry) downloadPlugin(ctx context.Context, source, destinatio
 
 // downloadFromURL downloads a plugin from a URL
 func (pr *PluginRegistry) downloadFromURL(ctx context.Context, url, destination string) error {
-	// This would use the core downloader to fetch the plugin
-	// For now, we'll return a placeholder error
-	return gdlerrors.NewDownloadError(
-		gdlerrors.CodeUnknown,
-		fmt.Sprintf("URL download not implemented yet - would download from %s to %s", url, destination),
-	)
+	_, err := core.NewDownloader().Download(ctx, url, destination, &types.DownloadOptions{
+		OverwriteExisting: true,
+		Timeout:           5 * time.Minute,
+	})
+
+	return err
 }
 
 // downloadFromGitHub downloads a plugin from GitHub
@@ -2,11 +2,14 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/forest6511/gdl/pkg/secrets"
 )
 
 // TestPluginRegistryErrorHandling tests error handling paths
@@ -567,3 +570,70 @@ func TestConfigurePlugin(t *testing.T) {
 		}
 	})
 }
+
+// TestConfigurePluginSecret tests plugin settings kept in the keychain
+func TestConfigurePluginSecret(t *testing.T) {
+	pluginDir := t.TempDir()
+	configFile := filepath.Join(t.TempDir(), "secret_test.json")
+	keychain := secrets.NewMemory()
+	registry := NewPluginRegistry(pluginDir, configFile).WithKeychain(keychain)
+	ctx := context.Background()
+
+	config := &PluginConfig{
+		Plugins: map[string]*PluginInfo{
+			"uploader": {
+				Name:    "uploader",
+				Version: "1.0.0",
+				Path:    filepath.Join(pluginDir, "uploader.so"),
+				Enabled: true,
+				Config:  map[string]string{"region": "eu"},
+			},
+		},
+	}
+	if err := registry.saveConfig(config); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	if err := registry.ConfigureSecret(ctx, "uploader", "token", "s3cr3t"); err != nil {
+		t.Fatalf("ConfigureSecret failed: %v", err)
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if strings.Contains(string(data), "s3cr3t") {
+		t.Error("Config file should not hold the secret")
+	}
+
+	info, err := registry.Get(ctx, "uploader")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if info.Config["token"] != "keychain:plugin/uploader/token" {
+		t.Errorf("Expected a keychain reference, got: %s", info.Config["token"])
+	}
+
+	resolved, err := registry.resolveConfig(info.Config)
+	if err != nil {
+		t.Fatalf("resolveConfig failed: %v", err)
+	}
+	if resolved["token"] != "s3cr3t" || resolved["region"] != "eu" {
+		t.Errorf("Unexpected resolved config: %v", resolved)
+	}
+
+	if err := registry.ConfigureSecret(ctx, "nonexistent", "token", "value"); err == nil {
+		t.Error("Expected error configuring non-existent plugin")
+	}
+
+	if err := registry.Remove(ctx, "uploader"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := keychain.Get("plugin/uploader/token"); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("Remove should delete the secret, got: %v", err)
+	}
+
+	if _, err := registry.resolveConfig(info.Config); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing secret, got: %v", err)
+	}
+}
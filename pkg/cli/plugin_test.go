@@ -1114,3 +1114,55 @@ func TestLoadPlugins_ErrorPaths(t *testing.T) {
 		}
 	})
 }
+
+func TestPluginRegistry_Manifest(t *testing.T) {
+	pluginDir := t.TempDir()
+	registry := NewPluginRegistry(pluginDir, filepath.Join(t.TempDir(), "plugins.json"))
+
+	pluginPath := filepath.Join(pluginDir, "s3.so")
+	config := &PluginConfig{Plugins: map[string]*PluginInfo{
+		"s3": {Name: "s3", Version: "1.0.0", Path: pluginPath},
+	}}
+	if err := registry.saveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	manifest, err := registry.Manifest(ctx, "s3")
+	if err != nil {
+		t.Fatalf("Manifest() without a manifest file error = %v", err)
+	}
+	if len(manifest.Capabilities.Network) != 0 {
+		t.Errorf("Capabilities without a manifest = %+v, want none", manifest.Capabilities)
+	}
+
+	// Install a manifest next to the plugin as Install does for local sources
+	source := filepath.Join(t.TempDir(), "s3.so")
+	want := &plugin.Manifest{Name: "s3", Capabilities: plugin.Capabilities{Network: []string{"*.amazonaws.com"}}}
+	if err := writeManifest(source, want); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.copyManifest(source, pluginPath); err != nil {
+		t.Fatalf("copyManifest() error = %v", err)
+	}
+
+	manifest, err = registry.Manifest(ctx, "s3")
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	if !manifest.Capabilities.AllowsNetwork("s3.amazonaws.com") {
+		t.Errorf("Manifest() = %+v, want the installed manifest", manifest)
+	}
+
+	if _, err := registry.Manifest(ctx, "missing"); err == nil {
+		t.Error("Manifest() of a missing plugin should fail")
+	}
+
+	if err := registry.Remove(ctx, "s3"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(plugin.ManifestPath(pluginPath)); !os.IsNotExist(err) {
+		t.Error("Remove() should delete the plugin manifest")
+	}
+}
@@ -0,0 +1,539 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/cron"
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+// Outcomes of a scheduled download's last run.
+const (
+	ScheduleStatusDownloaded  = "downloaded"
+	ScheduleStatusNotModified = "not_modified"
+	ScheduleStatusFailed      = "failed"
+)
+
+// DefaultSchedulePollInterval is how often the schedule runner rereads the
+// schedule file, so that added and removed schedules take effect.
+const DefaultSchedulePollInterval = time.Minute
+
+// MaxScheduleRecoveries is how many times in a row a run cut short by a crash
+// or power loss is made again before it is recorded as failed.
+const MaxScheduleRecoveries = 3
+
+// ScheduledDownload is a recurring download of URL to Output.
+type ScheduledDownload struct {
+	ID         string    `json:"id"`
+	Cron       string    `json:"cron"`
+	URL        string    `json:"url"`
+	Output     string    `json:"output"`
+	Created    time.Time `json:"created"`
+	LastRun    time.Time `json:"last_run"`
+	LastStatus string    `json:"last_status,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+
+	// RunStarted is when the run in progress started. A runner that finds it
+	// set at startup takes the run as cut short by a crash or power loss,
+	// which Interrupted counts.
+	RunStarted  time.Time `json:"run_started,omitzero"`
+	Interrupted int       `json:"interrupted,omitempty"`
+
+	// A paused schedule does not run. RunRequested makes it run as soon as a
+	// runner sees it, whatever its schedule.
+	Paused       bool `json:"paused,omitempty"`
+	RunRequested bool `json:"run_requested,omitempty"`
+
+	// Owner is the daemon user the download belongs to, if any.
+	Owner string `json:"owner,omitempty"`
+}
+
+// NextRun returns the first activation of the schedule after its last run, or
+// after its creation if it has not run yet. An activation missed while no
+// runner was active is therefore due immediately, once.
+func (sd *ScheduledDownload) NextRun() (time.Time, error) {
+	schedule, err := cron.Parse(sd.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	from := sd.Created
+	if sd.LastRun.After(from) {
+		from = sd.LastRun
+	}
+
+	return schedule.Next(from.Local()), nil
+}
+
+// ScheduleConfig represents the schedule file.
+type ScheduleConfig struct {
+	Schedules []*ScheduledDownload `json:"schedules"`
+}
+
+// ScheduleFetchFunc downloads a scheduled file and returns the status of the
+// run: ScheduleStatusDownloaded or ScheduleStatusNotModified.
+type ScheduleFetchFunc func(ctx context.Context, sd *ScheduledDownload) (string, error)
+
+// Events of a scheduled run, passed to a ScheduleEventFunc.
+const (
+	ScheduleEventQueued    = "queued"
+	ScheduleEventStarted   = "started"
+	ScheduleEventCompleted = "completed"
+	ScheduleEventFailed    = "failed"
+)
+
+// ScheduleEventFunc is told about the runs of scheduled downloads. status and
+// err are the outcome of a completed or failed run.
+type ScheduleEventFunc func(event string, sd *ScheduledDownload, status string, err error)
+
+// ScheduleStore manages recurring downloads in a JSON file.
+type ScheduleStore struct {
+	file   string
+	events ScheduleEventFunc
+
+	// mu keeps the changes made through the store from overwriting each
+	// other; wake tells a waiting Run that they may make a run due.
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+// NewScheduleStore creates a schedule store backed by file.
+func NewScheduleStore(file string) *ScheduleStore {
+	return &ScheduleStore{file: file, wake: make(chan struct{}, 1)}
+}
+
+// WithEvents makes the store tell events about the runs it makes and
+// recovers: a run is queued when it becomes due, started, and then completed
+// or failed. A run stopped by cancelling the runner's context has no outcome.
+func (ss *ScheduleStore) WithEvents(events ScheduleEventFunc) *ScheduleStore {
+	ss.events = events
+	return ss
+}
+
+// Add schedules a recurring download of url to output on the cron expression
+// expr. A relative output path is made absolute, since the runner may work in
+// another directory.
+func (ss *ScheduleStore) Add(ctx context.Context, expr, url, output string) (*ScheduledDownload, error) {
+	return ss.AddFor(ctx, "", expr, url, output)
+}
+
+// AddFor is like Add for a download belonging to the daemon user owner.
+func (ss *ScheduleStore) AddFor(ctx context.Context, owner, expr, url, output string) (*ScheduledDownload, error) {
+	if _, err := cron.Parse(expr); err != nil {
+		return nil, gdlerrors.NewValidationError("cron", err.Error())
+	}
+
+	if err := validation.ValidateURL(url); err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid URL", url)
+	}
+
+	if output == "" {
+		return nil, gdlerrors.NewValidationError("output", "required for scheduled downloads")
+	}
+
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return nil, gdlerrors.NewInvalidPathError(output, err)
+	}
+
+	config, err := ss.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	sd := &ScheduledDownload{
+		ID:      nextScheduleID(config.Schedules),
+		Cron:    expr,
+		URL:     url,
+		Output:  absOutput,
+		Created: time.Now(),
+		Owner:   owner,
+	}
+	config.Schedules = append(config.Schedules, sd)
+
+	if err := ss.saveConfig(config); err != nil {
+		return nil, err
+	}
+
+	return sd, nil
+}
+
+// List returns the scheduled downloads in the order they were added.
+func (ss *ScheduleStore) List(ctx context.Context) ([]*ScheduledDownload, error) {
+	config, err := ss.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Schedules, nil
+}
+
+// Remove deletes the scheduled download with the given ID.
+func (ss *ScheduleStore) Remove(ctx context.Context, id string) error {
+	config, err := ss.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	for i, sd := range config.Schedules {
+		if sd.ID == id {
+			config.Schedules = append(config.Schedules[:i], config.Schedules[i+1:]...)
+			return ss.saveConfig(config)
+		}
+	}
+
+	return gdlerrors.NewValidationError("id", "no scheduled download "+strconv.Quote(id))
+}
+
+// Due returns the scheduled downloads whose next run is at or before now,
+// earliest first.
+func (ss *ScheduleStore) Due(ctx context.Context, now time.Time) ([]*ScheduledDownload, error) {
+	schedules, err := ss.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []*ScheduledDownload
+	nextRuns := make(map[string]time.Time)
+
+	for _, sd := range schedules {
+		if sd.Paused {
+			continue
+		}
+
+		next, err := sd.NextRun()
+		if sd.RunRequested {
+			next, err = now, nil
+		}
+		if err != nil || next.IsZero() || next.After(now) {
+			continue
+		}
+
+		due = append(due, sd)
+		nextRuns[sd.ID] = next
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return nextRuns[due[i].ID].Before(nextRuns[due[j].ID])
+	})
+
+	return due, nil
+}
+
+// RecordRun stores the outcome of a run that started at. Schedules removed
+// meanwhile are left removed.
+func (ss *ScheduleStore) RecordRun(ctx context.Context, id string, at time.Time, status string, runErr error) error {
+	return ss.update(id, func(sd *ScheduledDownload) {
+		sd.LastRun = at
+		sd.LastStatus = status
+		sd.LastError = ""
+		if runErr != nil {
+			sd.LastStatus = ScheduleStatusFailed
+			sd.LastError = runErr.Error()
+		}
+
+		sd.RunStarted = time.Time{}
+		sd.Interrupted = 0
+		sd.RunRequested = false
+	})
+}
+
+// SetPaused pauses or unpauses the scheduled download with the given ID. A
+// run in progress is not stopped.
+func (ss *ScheduleStore) SetPaused(ctx context.Context, id string, paused bool) error {
+	return ss.change(id, func(sd *ScheduledDownload) { sd.Paused = paused })
+}
+
+// RequestRun makes the scheduled download with the given ID run at once, or
+// as soon as it is unpaused, and wakes a Run waiting for the next one.
+func (ss *ScheduleStore) RequestRun(ctx context.Context, id string) error {
+	return ss.change(id, func(sd *ScheduledDownload) { sd.RunRequested = true })
+}
+
+// Recover deals with the runs a runner left in progress when it crashed or
+// the host went down, and returns their schedules. A run is made again the
+// next time due schedules are run, resuming its part file, unless it has
+// been cut short more than MaxScheduleRecoveries times in a row or its
+// schedule is no longer valid: it is then recorded as failed, with the reason
+// as its error. Call it when a runner starts, while no other one is running.
+func (ss *ScheduleStore) Recover(ctx context.Context) ([]*ScheduledDownload, error) {
+	config, err := ss.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var recovered []*ScheduledDownload
+
+	for _, sd := range config.Schedules {
+		if sd.RunStarted.IsZero() {
+			continue
+		}
+
+		sd.Interrupted++
+
+		var reason string
+		if _, err := cron.Parse(sd.Cron); err != nil {
+			reason = fmt.Sprintf("invalid schedule %q: %v", sd.Cron, err)
+		} else if sd.Interrupted > MaxScheduleRecoveries {
+			reason = fmt.Sprintf("run cut short %d times in a row by a crash or restart", sd.Interrupted)
+		}
+
+		if reason != "" {
+			sd.LastRun = sd.RunStarted
+			sd.LastStatus = ScheduleStatusFailed
+			sd.LastError = reason
+			sd.Interrupted = 0
+
+			ss.emit(ScheduleEventFailed, sd, "", stdErrors.New(reason))
+		}
+
+		sd.RunStarted = time.Time{}
+		recovered = append(recovered, sd)
+	}
+
+	if len(recovered) == 0 {
+		return nil, nil
+	}
+
+	return recovered, ss.saveConfig(config)
+}
+
+// RunDue runs the scheduled downloads due at now with fetch, one at a time,
+// and records their outcome. A run is recorded as in progress while it runs,
+// so that Recover can make it again after a crash. A run stopped by
+// cancelling ctx is not recorded: it is made again when a runner next runs
+// due schedules.
+func (ss *ScheduleStore) RunDue(ctx context.Context, now time.Time, fetch ScheduleFetchFunc) error {
+	due, err := ss.Due(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, sd := range due {
+		ss.emit(ScheduleEventQueued, sd, "", nil)
+	}
+
+	for _, sd := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		started := time.Now()
+		if err := ss.update(sd.ID, func(sd *ScheduledDownload) { sd.RunStarted = started }); err != nil {
+			return err
+		}
+
+		ss.emit(ScheduleEventStarted, sd, "", nil)
+		status, runErr := fetch(ctx, sd)
+
+		if runErr != nil && ctx.Err() != nil {
+			if err := ss.update(sd.ID, func(sd *ScheduledDownload) { sd.RunStarted = time.Time{} }); err != nil {
+				return err
+			}
+
+			return ctx.Err()
+		}
+
+		if err := ss.RecordRun(ctx, sd.ID, started, status, runErr); err != nil {
+			return err
+		}
+
+		if runErr != nil {
+			ss.emit(ScheduleEventFailed, sd, "", runErr)
+		} else {
+			ss.emit(ScheduleEventCompleted, sd, status, nil)
+		}
+	}
+
+	return nil
+}
+
+// emit tells the store's events about a run, if it has any.
+func (ss *ScheduleStore) emit(event string, sd *ScheduledDownload, status string, err error) {
+	if ss.events != nil {
+		ss.events(event, sd, status, err)
+	}
+}
+
+// change applies fn to the scheduled download with the given ID, which must
+// exist, and wakes a waiting Run.
+func (ss *ScheduleStore) change(id string, fn func(sd *ScheduledDownload)) error {
+	found := false
+	if err := ss.update(id, func(sd *ScheduledDownload) { fn(sd); found = true }); err != nil {
+		return err
+	}
+
+	if !found {
+		return gdlerrors.NewValidationError("id", "no scheduled download "+strconv.Quote(id))
+	}
+
+	select {
+	case ss.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// update applies change to the scheduled download with the given ID and
+// saves the schedule file. Schedules removed meanwhile are left removed.
+func (ss *ScheduleStore) update(id string, change func(sd *ScheduledDownload)) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	config, err := ss.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, sd := range config.Schedules {
+		if sd.ID == id {
+			change(sd)
+			return ss.saveConfig(config)
+		}
+	}
+
+	return nil
+}
+
+// Run runs scheduled downloads as they become due until ctx is cancelled,
+// rereading the schedule file at least every poll interval
+// (DefaultSchedulePollInterval if poll <= 0), and at once after SetPaused or
+// RequestRun.
+func (ss *ScheduleStore) Run(ctx context.Context, poll time.Duration, fetch ScheduleFetchFunc) error {
+	if poll <= 0 {
+		poll = DefaultSchedulePollInterval
+	}
+
+	for {
+		if err := ss.RunDue(ctx, time.Now(), fetch); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		timer := time.NewTimer(ss.untilNextRun(ctx, poll))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-ss.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// untilNextRun returns how long to wait for the next scheduled run, at most
+// poll.
+func (ss *ScheduleStore) untilNextRun(ctx context.Context, poll time.Duration) time.Duration {
+	wait := poll
+
+	schedules, err := ss.List(ctx)
+	if err != nil {
+		return wait
+	}
+
+	now := time.Now()
+	for _, sd := range schedules {
+		if sd.Paused {
+			continue
+		}
+		if sd.RunRequested {
+			return 0
+		}
+
+		next, err := sd.NextRun()
+		if err != nil || next.IsZero() {
+			continue
+		}
+
+		if until := next.Sub(now); until < wait {
+			wait = max(until, 0)
+		}
+	}
+
+	return wait
+}
+
+// nextScheduleID returns an ID one higher than the highest numeric ID in use.
+func nextScheduleID(schedules []*ScheduledDownload) string {
+	highest := 0
+	for _, sd := range schedules {
+		if n, err := strconv.Atoi(sd.ID); err == nil && n > highest {
+			highest = n
+		}
+	}
+
+	return strconv.Itoa(highest + 1)
+}
+
+// loadConfig loads the schedule file.
+func (ss *ScheduleStore) loadConfig() (*ScheduleConfig, error) {
+	config := &ScheduleConfig{}
+
+	data, err := os.ReadFile(ss.file)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("read schedule file", err, ss.file)
+	}
+
+	if len(data) == 0 {
+		return config, nil
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, gdlerrors.NewConfigError("failed to parse schedule file", err, ss.file)
+	}
+
+	return config, nil
+}
+
+// saveConfig writes the schedule file through a temporary file, so that a
+// running scheduler never reads a partial file.
+func (ss *ScheduleStore) saveConfig(config *ScheduleConfig) error {
+	dir := filepath.Dir(ss.file)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return gdlerrors.NewInvalidPathError(dir, err)
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return gdlerrors.NewConfigError("failed to marshal schedules", err, ss.file)
+	}
+
+	temp := ss.file + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return gdlerrors.NewStorageError("write schedule file", err, temp)
+	}
+
+	if err := os.Rename(temp, ss.file); err != nil {
+		_ = os.Remove(temp)
+		return gdlerrors.NewStorageError("write schedule file", err, ss.file)
+	}
+
+	return nil
+}
+
+// GetDefaultScheduleFile returns the default schedule file
+func GetDefaultScheduleFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "./schedules.json"
+	}
+	return filepath.Join(homeDir, ".gdl", "schedules.json")
+}
@@ -0,0 +1,363 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduleStore_AddListRemove(t *testing.T) {
+	ctx := context.Background()
+	store := NewScheduleStore(filepath.Join(t.TempDir(), "gdl", "schedules.json"))
+
+	first, err := store.Add(ctx, "0 3 * * *", "https://example.com/a.zip", "a.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != "1" || !filepath.IsAbs(first.Output) || first.Created.IsZero() {
+		t.Errorf("Add() = %+v, want ID 1 and an absolute output path", first)
+	}
+
+	second, err := store.Add(ctx, "@hourly", "https://example.com/b.zip", "/data/b.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != "2" {
+		t.Errorf("second ID = %q, want 2", second.ID)
+	}
+
+	if err := store.Remove(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Remove(ctx, "1"); err == nil {
+		t.Error("Remove() of an unknown ID should fail")
+	}
+
+	// IDs are not reused while higher ones exist
+	third, err := store.Add(ctx, "*/5 * * * *", "https://example.com/c.zip", "/data/c.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID != "3" {
+		t.Errorf("third ID = %q, want 3", third.ID)
+	}
+
+	schedules, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedules) != 2 || schedules[0].ID != "2" || schedules[1].ID != "3" {
+		t.Errorf("List() = %+v, want schedules 2 and 3", schedules)
+	}
+}
+
+func TestScheduleStore_AddInvalid(t *testing.T) {
+	ctx := context.Background()
+	store := NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json"))
+
+	tests := []struct {
+		name, expr, url, output string
+	}{
+		{"bad cron", "0 25 * * *", "https://example.com/a", "a"},
+		{"bad URL", "@daily", "ftp//nope", "a"},
+		{"no output", "@daily", "https://example.com/a", ""},
+	}
+
+	for _, tt := range tests {
+		if _, err := store.Add(ctx, tt.expr, tt.url, tt.output); err == nil {
+			t.Errorf("%s: Add() should fail", tt.name)
+		}
+	}
+
+	if schedules, _ := store.List(ctx); len(schedules) != 0 {
+		t.Errorf("List() = %v after invalid adds, want none", schedules)
+	}
+}
+
+func TestScheduleStore_RunDue(t *testing.T) {
+	ctx := context.Background()
+
+	var events []string
+	store := NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json")).WithEvents(
+		func(event string, sd *ScheduledDownload, status string, err error) {
+			events = append(events, fmt.Sprintf("%s %s %s %v", sd.ID, event, status, err))
+		})
+
+	for _, expr := range []string{"* * * * *", "0 0 1 1 *", "*/2 * * * *"} {
+		if _, err := store.Add(ctx, expr, "https://example.com/"+expr[:1], "/data/file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	var fetched []string
+	fetch := func(ctx context.Context, sd *ScheduledDownload) (string, error) {
+		mu.Lock()
+		fetched = append(fetched, sd.ID)
+		mu.Unlock()
+
+		if sd.ID == "3" {
+			return "", errors.New("server unavailable")
+		}
+		return ScheduleStatusNotModified, nil
+	}
+
+	// Nothing is due right after scheduling
+	if err := store.RunDue(ctx, time.Now(), fetch); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 0 {
+		t.Fatalf("fetched %v right after adding, want nothing", fetched)
+	}
+
+	// Within the next few minutes both minute schedules fire; January 1st does not
+	later := time.Now().Add(3 * time.Minute)
+	if err := store.RunDue(ctx, later, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 2 {
+		t.Fatalf("fetched %v, want schedules 1 and 3", fetched)
+	}
+
+	// Both runs are queued before the first starts
+	wantEvents := []string{
+		"1 queued  <nil>",
+		"3 queued  <nil>",
+		"1 started  <nil>",
+		"1 completed not_modified <nil>",
+		"3 started  <nil>",
+		"3 failed  server unavailable",
+	}
+	if !slices.Equal(events, wantEvents) {
+		t.Errorf("events = %q, want %q", events, wantEvents)
+	}
+
+	schedules, _ := store.List(ctx)
+	for _, sd := range schedules {
+		switch sd.ID {
+		case "1":
+			if sd.LastStatus != ScheduleStatusNotModified || sd.LastError != "" || sd.LastRun.IsZero() {
+				t.Errorf("schedule 1 = %+v, want a not modified run", sd)
+			}
+		case "3":
+			if sd.LastStatus != ScheduleStatusFailed || sd.LastError != "server unavailable" {
+				t.Errorf("schedule 3 = %+v, want a failed run", sd)
+			}
+		case "2":
+			if !sd.LastRun.IsZero() {
+				t.Errorf("schedule 2 ran: %+v", sd)
+			}
+		}
+	}
+
+	// A run is not repeated until the schedule fires again
+	if err := store.RunDue(ctx, time.Now(), fetch); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 2 {
+		t.Errorf("fetched %v, want no repeated runs", fetched)
+	}
+}
+
+func TestScheduledDownload_NextRun(t *testing.T) {
+	created := time.Date(2025, 1, 15, 10, 30, 0, 0, time.Local)
+	sd := &ScheduledDownload{Cron: "0 3 * * *", Created: created}
+
+	next, err := sd.NextRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 1, 16, 3, 0, 0, 0, time.Local); !next.Equal(want) {
+		t.Errorf("NextRun() = %v, want %v", next, want)
+	}
+
+	// Missed runs are made up once, after the last run
+	sd.LastRun = time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	next, _ = sd.NextRun()
+	if want := time.Date(2025, 3, 2, 3, 0, 0, 0, time.Local); !next.Equal(want) {
+		t.Errorf("NextRun() after a run = %v, want %v", next, want)
+	}
+
+	sd.Cron = "bogus"
+	if _, err := sd.NextRun(); err == nil {
+		t.Error("NextRun() with an invalid expression should fail")
+	}
+}
+
+func TestScheduleStore_RunStopsOnCancel(t *testing.T) {
+	store := NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := store.Run(ctx, 10*time.Millisecond, func(context.Context, *ScheduledDownload) (string, error) {
+		return ScheduleStatusDownloaded, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want the context error", err)
+	}
+}
+
+func TestScheduleStore_MalformedFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schedules.json")
+	if err := os.WriteFile(file, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewScheduleStore(file).List(context.Background()); err == nil {
+		t.Error("List() of a malformed schedule file should fail")
+	}
+}
+
+func TestScheduleStore_Recover(t *testing.T) {
+	ctx := context.Background()
+	store := NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json"))
+
+	for _, expr := range []string{"* * * * *", "0 0 1 1 *", "* * * * *"} {
+		if _, err := store.Add(ctx, expr, "https://example.com/file", "/data/file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Schedule 1 was running when the runner crashed; schedule 2 keeps crashing it
+	started := time.Now().Add(-time.Hour).Round(0)
+	_ = store.update("1", func(sd *ScheduledDownload) {
+		sd.Created, sd.RunStarted = started.Add(-time.Hour), started
+	})
+	_ = store.update("2", func(sd *ScheduledDownload) {
+		sd.Created, sd.RunStarted, sd.Interrupted = started.Add(-time.Hour), started, MaxScheduleRecoveries
+	})
+
+	recovered, err := store.Recover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered) != 2 {
+		t.Fatalf("Recover() = %+v, want schedules 1 and 2", recovered)
+	}
+
+	schedules, _ := store.List(ctx)
+	if sd := schedules[0]; sd.Interrupted != 1 || !sd.RunStarted.IsZero() || sd.LastStatus == ScheduleStatusFailed {
+		t.Errorf("schedule 1 = %+v, want it run again", sd)
+	}
+	if sd := schedules[1]; sd.LastStatus != ScheduleStatusFailed || !strings.Contains(sd.LastError, "cut short") ||
+		!sd.LastRun.Equal(started) || !sd.RunStarted.IsZero() {
+		t.Errorf("schedule 2 = %+v, want a failed run", sd)
+	}
+
+	// Only the recovered run is due again, and it is recorded as in progress
+	// while it runs
+	var fetched []string
+	err = store.RunDue(ctx, time.Now(), func(ctx context.Context, sd *ScheduledDownload) (string, error) {
+		fetched = append(fetched, sd.ID)
+
+		if schedules, _ := store.List(ctx); schedules[0].RunStarted.IsZero() {
+			t.Error("run not recorded as in progress")
+		}
+
+		return ScheduleStatusDownloaded, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 1 || fetched[0] != "1" {
+		t.Errorf("fetched %v after recovering, want schedule 1", fetched)
+	}
+	if schedules, _ := store.List(ctx); schedules[0].Interrupted != 0 || !schedules[0].RunStarted.IsZero() {
+		t.Errorf("schedule 1 = %+v, want its run recorded", schedules[0])
+	}
+
+	if recovered, err := store.Recover(ctx); err != nil || len(recovered) != 0 {
+		t.Errorf("Recover() = %v, %v with nothing in progress", recovered, err)
+	}
+}
+
+func TestScheduleStore_RunDueCancelled(t *testing.T) {
+	store := NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json"))
+	if _, err := store.Add(context.Background(), "* * * * *", "https://example.com/file", "/data/file"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := store.RunDue(ctx, time.Now().Add(3*time.Minute), func(ctx context.Context, sd *ScheduledDownload) (string, error) {
+		cancel()
+		return "", ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunDue() error = %v, want the context error", err)
+	}
+
+	// A stopped run is neither recorded nor taken for a crash: it runs again
+	schedules, _ := store.List(context.Background())
+	if sd := schedules[0]; !sd.LastRun.IsZero() || sd.LastStatus != "" || !sd.RunStarted.IsZero() {
+		t.Errorf("schedule = %+v, want the run left to do", sd)
+	}
+}
+
+func TestScheduleStore_PauseAndRequestRun(t *testing.T) {
+	ctx := context.Background()
+	store := NewScheduleStore(filepath.Join(t.TempDir(), "schedules.json"))
+
+	if _, err := store.Add(ctx, "@yearly", "https://example.com/file", "/data/file"); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(400 * 24 * time.Hour)
+
+	if err := store.SetPaused(ctx, "1", true); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := store.Due(ctx, later); len(due) != 0 {
+		t.Errorf("paused schedule due: %+v", due)
+	}
+
+	if err := store.SetPaused(ctx, "1", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RequestRun(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RequestRun(ctx, "2"); err == nil {
+		t.Error("RequestRun() of a missing schedule succeeded")
+	}
+
+	// The requested run happens at once, waking a waiting runner, and only once
+	runCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	runs := make(chan string, 2)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = store.Run(runCtx, time.Hour, func(ctx context.Context, sd *ScheduledDownload) (string, error) {
+			runs <- sd.ID
+			return ScheduleStatusDownloaded, nil
+		})
+	}()
+
+	if id := <-runs; id != "1" {
+		t.Fatalf("ran schedule %s, want 1", id)
+	}
+
+	if err := store.RequestRun(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-runs:
+	case <-runCtx.Done():
+		t.Fatal("the runner was not woken by RequestRun")
+	}
+
+	cancel()
+	<-stopped
+	if schedules, _ := store.List(ctx); schedules[0].RunRequested {
+		t.Error("run request kept after the run")
+	}
+}
@@ -0,0 +1,255 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// usageDayLayout is the format of UsageRecord.Day.
+const usageDayLayout = "2006-01-02"
+
+// UsageRecord is the traffic from one host on one day.
+type UsageRecord struct {
+	Day       string        `json:"day"`
+	Host      string        `json:"host"`
+	Bytes     int64         `json:"bytes"`
+	Downloads int           `json:"downloads"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// UsageConfig represents the usage file.
+type UsageConfig struct {
+	Records []*UsageRecord `json:"records"`
+}
+
+// UsageTotal sums the traffic of a day, a host or a whole period.
+type UsageTotal struct {
+	Name      string        `json:"name,omitempty"`
+	Bytes     int64         `json:"bytes"`
+	Downloads int           `json:"downloads"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// AverageSpeed returns the bytes per second downloaded while downloads were
+// running, or 0 if none took measurable time.
+func (ut *UsageTotal) AverageSpeed() int64 {
+	if ut.Duration <= 0 {
+		return 0
+	}
+
+	return int64(float64(ut.Bytes) / ut.Duration.Seconds())
+}
+
+func (ut *UsageTotal) add(record *UsageRecord) {
+	ut.Bytes += record.Bytes
+	ut.Downloads += record.Downloads
+	ut.Duration += record.Duration
+}
+
+// UsageSummary is the traffic recorded since a day.
+type UsageSummary struct {
+	Since time.Time  `json:"since"`
+	Total UsageTotal `json:"total"`
+
+	// Days holds one total per day with traffic, oldest first.
+	Days []UsageTotal `json:"days"`
+
+	// Hosts holds one total per host, the most bytes first.
+	Hosts []UsageTotal `json:"hosts"`
+}
+
+// UsageStore records bytes downloaded per day and host in a JSON file.
+type UsageStore struct {
+	file string
+}
+
+// NewUsageStore creates a usage store backed by file.
+func NewUsageStore(file string) *UsageStore {
+	return &UsageStore{file: file}
+}
+
+// Record adds a download of bytes from rawURL that took duration and
+// finished at to the day's total for the URL's host.
+func (us *UsageStore) Record(ctx context.Context, rawURL string, bytes int64, duration time.Duration, at time.Time) error {
+	if bytes <= 0 {
+		return nil
+	}
+
+	host := usageHost(rawURL)
+	if host == "" {
+		return gdlerrors.NewValidationError("url", "no host in "+rawURL)
+	}
+
+	config, err := us.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	day := at.Local().Format(usageDayLayout)
+
+	var record *UsageRecord
+	for _, r := range config.Records {
+		if r.Day == day && r.Host == host {
+			record = r
+			break
+		}
+	}
+
+	if record == nil {
+		record = &UsageRecord{Day: day, Host: host}
+		config.Records = append(config.Records, record)
+	}
+
+	record.Bytes += bytes
+	record.Downloads++
+	record.Duration += duration
+
+	return us.saveConfig(config)
+}
+
+// Summary totals the traffic recorded on the day of since and later.
+func (us *UsageStore) Summary(ctx context.Context, since time.Time) (*UsageSummary, error) {
+	config, err := us.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &UsageSummary{Since: since}
+	first := since.Local().Format(usageDayLayout)
+	if since.IsZero() {
+		first = ""
+	}
+
+	days := make(map[string]*UsageTotal)
+	hosts := make(map[string]*UsageTotal)
+
+	for _, record := range config.Records {
+		// Days sort as strings
+		if record.Day < first {
+			continue
+		}
+
+		summary.Total.add(record)
+
+		if days[record.Day] == nil {
+			days[record.Day] = &UsageTotal{Name: record.Day}
+		}
+		days[record.Day].add(record)
+
+		if hosts[record.Host] == nil {
+			hosts[record.Host] = &UsageTotal{Name: record.Host}
+		}
+		hosts[record.Host].add(record)
+	}
+
+	for _, total := range days {
+		summary.Days = append(summary.Days, *total)
+	}
+	sort.Slice(summary.Days, func(i, j int) bool {
+		return summary.Days[i].Name < summary.Days[j].Name
+	})
+
+	for _, total := range hosts {
+		summary.Hosts = append(summary.Hosts, *total)
+	}
+	sort.Slice(summary.Hosts, func(i, j int) bool {
+		if summary.Hosts[i].Bytes != summary.Hosts[j].Bytes {
+			return summary.Hosts[i].Bytes > summary.Hosts[j].Bytes
+		}
+		return summary.Hosts[i].Name < summary.Hosts[j].Name
+	})
+
+	return summary, nil
+}
+
+// Reset deletes all recorded usage.
+func (us *UsageStore) Reset(ctx context.Context) error {
+	if err := os.Remove(us.file); err != nil && !os.IsNotExist(err) {
+		return gdlerrors.NewStorageError("remove usage file", err, us.file)
+	}
+
+	return nil
+}
+
+// usageHost returns the lowercase host of rawURL, without its port.
+func usageHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(parsed.Hostname())
+}
+
+// loadConfig loads the usage file.
+func (us *UsageStore) loadConfig() (*UsageConfig, error) {
+	config := &UsageConfig{}
+
+	data, err := os.ReadFile(us.file)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("read usage file", err, us.file)
+	}
+
+	if len(data) == 0 {
+		return config, nil
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, gdlerrors.NewConfigError("failed to parse usage file", err, us.file)
+	}
+
+	return config, nil
+}
+
+// saveConfig writes the usage file through a temporary file of its own, so
+// that gdl processes running side by side never read a partial file.
+func (us *UsageStore) saveConfig(config *UsageConfig) error {
+	dir := filepath.Dir(us.file)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return gdlerrors.NewInvalidPathError(dir, err)
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return gdlerrors.NewConfigError("failed to marshal usage", err, us.file)
+	}
+
+	temp, err := os.CreateTemp(dir, filepath.Base(us.file)+".*.tmp")
+	if err != nil {
+		return gdlerrors.NewStorageError("write usage file", err, dir)
+	}
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), us.file)
+	}
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		return gdlerrors.NewStorageError("write usage file", err, us.file)
+	}
+
+	return nil
+}
+
+// GetDefaultUsageFile returns the default usage file
+func GetDefaultUsageFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "./usage.json"
+	}
+	return filepath.Join(homeDir, ".gdl", "usage.json")
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageStore_RecordSummary(t *testing.T) {
+	ctx := context.Background()
+	store := NewUsageStore(filepath.Join(t.TempDir(), "gdl", "usage.json"))
+
+	day1 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+
+	records := []struct {
+		url      string
+		bytes    int64
+		duration time.Duration
+		at       time.Time
+	}{
+		{"https://example.com/a.zip", 1000, time.Second, day1},
+		{"https://EXAMPLE.com:8443/b.zip", 3000, time.Second, day2},
+		{"https://cdn.example.org/c.iso", 2000, 4 * time.Second, day2},
+		{"https://cdn.example.org/empty", 0, time.Second, day2},
+	}
+
+	for _, r := range records {
+		if err := store.Record(ctx, r.url, r.bytes, r.duration, r.at); err != nil {
+			t.Fatalf("Record(%s) error = %v", r.url, err)
+		}
+	}
+
+	summary, err := store.Summary(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Total.Bytes != 6000 || summary.Total.Downloads != 3 || summary.Total.AverageSpeed() != 1000 {
+		t.Errorf("Total = %+v, want 6000 bytes in 3 downloads at 1000 B/s", summary.Total)
+	}
+
+	if len(summary.Days) != 2 || summary.Days[0].Name != "2026-03-01" || summary.Days[1].Bytes != 5000 {
+		t.Errorf("Days = %+v, want 2026-03-01 then 5000 bytes on 2026-03-02", summary.Days)
+	}
+
+	if len(summary.Hosts) != 2 || summary.Hosts[0].Name != "example.com" || summary.Hosts[0].Bytes != 4000 ||
+		summary.Hosts[0].AverageSpeed() != 2000 {
+		t.Errorf("Hosts = %+v, want example.com first with 4000 bytes at 2000 B/s", summary.Hosts)
+	}
+
+	// Only the days from since on are counted
+	summary, err = store.Summary(ctx, day2.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total.Bytes != 5000 || len(summary.Days) != 1 {
+		t.Errorf("Summary(day 2) = %+v, want 5000 bytes on one day", summary)
+	}
+}
+
+func TestUsageStore_RecordInvalid(t *testing.T) {
+	store := NewUsageStore(filepath.Join(t.TempDir(), "usage.json"))
+
+	if err := store.Record(context.Background(), "not a url", 10, time.Second, time.Now()); err == nil {
+		t.Error("Record() of a URL without a host should fail")
+	}
+}
+
+func TestUsageStore_Reset(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "usage.json")
+	store := NewUsageStore(file)
+
+	if err := store.Reset(ctx); err != nil {
+		t.Errorf("Reset() of a missing file error = %v", err)
+	}
+
+	if err := store.Record(ctx, "https://example.com/a", 10, time.Second, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("usage file still exists after Reset(): %v", err)
+	}
+
+	summary, err := store.Summary(ctx, time.Time{})
+	if err != nil || summary.Total.Bytes != 0 {
+		t.Errorf("Summary() after Reset() = %+v, %v", summary, err)
+	}
+}
+
+func TestUsageStore_CorruptFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "usage.json")
+	if err := os.WriteFile(file, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewUsageStore(file).Summary(context.Background(), time.Time{}); err == nil {
+		t.Error("Summary() of a corrupt file should fail")
+	}
+}
@@ -0,0 +1,324 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// userNamePattern is what a daemon user name may contain.
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// DaemonUser is a user of a shared daemon. Its token signs in to the
+// dashboard, which then shows and controls only the user's scheduled
+// downloads; those write below Dir and run under the user's quotas.
+type DaemonUser struct {
+	Name string `json:"name"`
+
+	// TokenSHA256 is the hex SHA-256 of the user's token; the token itself
+	// is only shown when the user is added.
+	TokenSHA256 string `json:"token_sha256"`
+
+	// Dir is the directory the user's scheduled downloads are written below.
+	Dir string `json:"dir"`
+
+	// MaxRate limits the user's downloads in bytes per second, and
+	// MaxDailyBytes the bytes they may download a day (0 = unlimited).
+	MaxRate       int64 `json:"max_rate,omitempty"`
+	MaxDailyBytes int64 `json:"max_daily_bytes,omitempty"`
+
+	// UsedBytes counts the bytes downloaded on UsedDay, in local time.
+	UsedDay   string `json:"used_day,omitempty"`
+	UsedBytes int64  `json:"used_bytes,omitempty"`
+
+	Created time.Time `json:"created"`
+}
+
+// Used returns the bytes the user has downloaded on the day of now.
+func (u *DaemonUser) Used(now time.Time) int64 {
+	if u.UsedDay != now.Format(usageDayLayout) {
+		return 0
+	}
+
+	return u.UsedBytes
+}
+
+// Remaining returns the bytes the user may still download on the day of now,
+// and false if the user has no daily quota.
+func (u *DaemonUser) Remaining(now time.Time) (int64, bool) {
+	if u.MaxDailyBytes <= 0 {
+		return 0, false
+	}
+
+	return max(u.MaxDailyBytes-u.Used(now), 0), true
+}
+
+// Owns reports whether path is Dir or below it.
+func (u *DaemonUser) Owns(path string) bool {
+	rel, err := filepath.Rel(u.Dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel))
+}
+
+// Output returns the path below Dir a download the user asked to write to
+// output goes to. output must be relative and stay below Dir.
+func (u *DaemonUser) Output(output string) (string, error) {
+	if output == "" || filepath.IsAbs(output) {
+		return "", gdlerrors.NewValidationError("output", "must be a path relative to the directory of user "+u.Name)
+	}
+
+	path := filepath.Join(u.Dir, output)
+	if path == u.Dir || !u.Owns(path) {
+		return "", gdlerrors.NewValidationError("output", "must stay below the directory of user "+u.Name)
+	}
+
+	return path, nil
+}
+
+// UsersConfig represents the users file.
+type UsersConfig struct {
+	Users []*DaemonUser `json:"users"`
+}
+
+// UserStore manages the users of a shared daemon in a JSON file.
+type UserStore struct {
+	file string
+
+	// mu keeps the usage recorded by concurrent runs from overwriting each
+	// other.
+	mu sync.Mutex
+}
+
+// NewUserStore creates a user store backed by file.
+func NewUserStore(file string) *UserStore {
+	return &UserStore{file: file}
+}
+
+// Add adds a user whose downloads go below dir, with the given quotas, and
+// returns it with its token.
+func (us *UserStore) Add(ctx context.Context, name, dir string, maxRate, maxDailyBytes int64) (*DaemonUser, string, error) {
+	if !userNamePattern.MatchString(name) {
+		return nil, "", gdlerrors.NewValidationError("name", "must be letters, digits, '.', '_' or '-': "+strconv.Quote(name))
+	}
+
+	if dir == "" {
+		return nil, "", gdlerrors.NewValidationError("dir", "required for daemon users")
+	}
+
+	if maxRate < 0 || maxDailyBytes < 0 {
+		return nil, "", gdlerrors.NewValidationError("quota", "must not be negative")
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", gdlerrors.NewInvalidPathError(dir, err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", gdlerrors.WrapError(err, gdlerrors.CodeUnknown, "generate user token")
+	}
+	token := hex.EncodeToString(secret)
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	config, err := us.loadConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, u := range config.Users {
+		if u.Name == name {
+			return nil, "", gdlerrors.NewValidationError("name", "user "+strconv.Quote(name)+" already exists")
+		}
+	}
+
+	user := &DaemonUser{
+		Name:          name,
+		TokenSHA256:   hashUserToken(token),
+		Dir:           absDir,
+		MaxRate:       maxRate,
+		MaxDailyBytes: maxDailyBytes,
+		Created:       time.Now(),
+	}
+	config.Users = append(config.Users, user)
+
+	if err := us.saveConfig(config); err != nil {
+		return nil, "", err
+	}
+
+	return user, token, nil
+}
+
+// List returns the users in the order they were added.
+func (us *UserStore) List(ctx context.Context) ([]*DaemonUser, error) {
+	config, err := us.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Users, nil
+}
+
+// Get returns the user with the given name.
+func (us *UserStore) Get(ctx context.Context, name string) (*DaemonUser, error) {
+	users, err := us.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+
+	return nil, gdlerrors.NewValidationError("user", "no daemon user "+strconv.Quote(name))
+}
+
+// Remove deletes the user with the given name. Its scheduled downloads stay,
+// but no longer run.
+func (us *UserStore) Remove(ctx context.Context, name string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	config, err := us.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	for i, u := range config.Users {
+		if u.Name == name {
+			config.Users = append(config.Users[:i], config.Users[i+1:]...)
+			return us.saveConfig(config)
+		}
+	}
+
+	return gdlerrors.NewValidationError("user", "no daemon user "+strconv.Quote(name))
+}
+
+// Authenticate returns the user whose token is token, or nil if there is
+// none.
+func (us *UserStore) Authenticate(ctx context.Context, token string) (*DaemonUser, error) {
+	users, err := us.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := []byte(hashUserToken(token))
+
+	var found *DaemonUser
+	for _, u := range users {
+		if subtle.ConstantTimeCompare(hash, []byte(u.TokenSHA256)) == 1 {
+			found = u
+		}
+	}
+
+	return found, nil
+}
+
+// AddUsage counts bytes downloaded by the named user at now toward the
+// user's daily quota. Users removed meanwhile are left removed.
+func (us *UserStore) AddUsage(ctx context.Context, name string, bytes int64, now time.Time) error {
+	if bytes <= 0 {
+		return nil
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	config, err := us.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, u := range config.Users {
+		if u.Name == name {
+			u.UsedBytes = u.Used(now) + bytes
+			u.UsedDay = now.Format(usageDayLayout)
+			return us.saveConfig(config)
+		}
+	}
+
+	return nil
+}
+
+// hashUserToken returns the hex SHA-256 of token.
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadConfig loads the users file.
+func (us *UserStore) loadConfig() (*UsersConfig, error) {
+	config := &UsersConfig{}
+
+	data, err := os.ReadFile(us.file)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("read users file", err, us.file)
+	}
+
+	if len(data) == 0 {
+		return config, nil
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, gdlerrors.NewConfigError("failed to parse users file", err, us.file)
+	}
+
+	return config, nil
+}
+
+// saveConfig writes the users file through a temporary file, so that a
+// running daemon never reads a partial file.
+func (us *UserStore) saveConfig(config *UsersConfig) error {
+	dir := filepath.Dir(us.file)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return gdlerrors.NewInvalidPathError(dir, err)
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return gdlerrors.NewConfigError("failed to marshal users", err, us.file)
+	}
+
+	temp := us.file + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return gdlerrors.NewStorageError("write users file", err, temp)
+	}
+
+	if err := os.Rename(temp, us.file); err != nil {
+		_ = os.Remove(temp)
+		return gdlerrors.NewStorageError("write users file", err, us.file)
+	}
+
+	return nil
+}
+
+// GetDefaultUsersFile returns the default users file of the daemon.
+func GetDefaultUsersFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "./users.json"
+	}
+	return filepath.Join(homeDir, ".gdl", "users.json")
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserStore_AddAuthenticateRemove(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "gdl", "users.json")
+	store := NewUserStore(file)
+
+	alice, token, err := store.Add(ctx, "alice", filepath.Join(dir, "alice"), 1024, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 64 || alice.TokenSHA256 == token || alice.MaxRate != 1024 || alice.MaxDailyBytes != 1<<20 {
+		t.Errorf("Add() = %+v, %q", alice, token)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), token) {
+		t.Error("the users file holds the token itself")
+	}
+
+	for _, tt := range []struct{ name, dir string }{
+		{"alice", dir},
+		{"", dir},
+		{"../bob", dir},
+		{"bob", ""},
+	} {
+		if _, _, err := store.Add(ctx, tt.name, tt.dir, 0, 0); err == nil {
+			t.Errorf("Add(%q, %q) should fail", tt.name, tt.dir)
+		}
+	}
+
+	if _, bobToken, err := store.Add(ctx, "bob", filepath.Join(dir, "bob"), 0, 0); err != nil || bobToken == token {
+		t.Fatalf("Add(bob) token %q, error %v", bobToken, err)
+	}
+
+	if user, err := store.Authenticate(ctx, token); err != nil || user == nil || user.Name != "alice" {
+		t.Errorf("Authenticate() = %+v, %v, want alice", user, err)
+	}
+	if user, err := store.Authenticate(ctx, "wrong"); err != nil || user != nil {
+		t.Errorf("Authenticate(wrong) = %+v, %v, want nobody", user, err)
+	}
+
+	if err := store.Remove(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := store.Authenticate(ctx, token); user != nil {
+		t.Error("a removed user's token still authenticates")
+	}
+	if _, err := store.Get(ctx, "alice"); err == nil {
+		t.Error("Get() of a removed user should fail")
+	}
+}
+
+func TestUserStore_Usage(t *testing.T) {
+	ctx := context.Background()
+	store := NewUserStore(filepath.Join(t.TempDir(), "users.json"))
+
+	if _, _, err := store.Add(ctx, "alice", t.TempDir(), 0, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	for _, n := range []int64{300, 400} {
+		if err := store.AddUsage(ctx, "alice", n, today); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alice, err := store.Get(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining, limited := alice.Remaining(today); !limited || remaining != 300 {
+		t.Errorf("Remaining() = %d, %v, want 300 of the quota", remaining, limited)
+	}
+
+	// The quota starts over the next day
+	tomorrow := today.AddDate(0, 0, 1)
+	if remaining, _ := alice.Remaining(tomorrow); remaining != 1000 {
+		t.Errorf("Remaining() tomorrow = %d, want 1000", remaining)
+	}
+	if err := store.AddUsage(ctx, "alice", 2000, tomorrow); err != nil {
+		t.Fatal(err)
+	}
+	if alice, _ = store.Get(ctx, "alice"); alice.Used(tomorrow) != 2000 {
+		t.Errorf("Used() = %d, want only the day's 2000 bytes", alice.Used(tomorrow))
+	}
+	if remaining, _ := alice.Remaining(tomorrow); remaining != 0 {
+		t.Errorf("Remaining() past the quota = %d, want 0", remaining)
+	}
+
+	if err := store.AddUsage(ctx, "nobody", 10, today); err != nil {
+		t.Errorf("AddUsage() of an unknown user error = %v", err)
+	}
+}
+
+func TestDaemonUser_Output(t *testing.T) {
+	user := &DaemonUser{Name: "alice", Dir: filepath.Join(string(filepath.Separator), "srv", "alice")}
+
+	if path, err := user.Output(filepath.Join("data", "a.csv")); err != nil || path != filepath.Join(user.Dir, "data", "a.csv") {
+		t.Errorf("Output() = %q, %v", path, err)
+	}
+
+	for _, output := range []string{"", ".", filepath.Join("..", "bob", "a.csv"), filepath.Join(user.Dir, "a.csv")} {
+		if _, err := user.Output(output); err == nil {
+			t.Errorf("Output(%q) should fail", output)
+		}
+	}
+
+	if !user.Owns(filepath.Join(user.Dir, "..alice", "x")) {
+		t.Error("Owns() of a file below the directory should be true")
+	}
+	if user.Owns(filepath.Join(user.Dir+"-other", "x")) {
+		t.Error("Owns() of a sibling directory's file should be false")
+	}
+}
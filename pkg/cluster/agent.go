@@ -0,0 +1,285 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+// DefaultAgentJobs is how many jobs an agent runs at once by default.
+const DefaultAgentJobs = 4
+
+// finishedTTL is how long an agent keeps the status of an ended job for the
+// coordinator to collect.
+const finishedTTL = time.Hour
+
+// cancelWait is how long an agent waits for a cancelled job to stop before
+// answering the cancellation.
+const cancelWait = 3 * time.Second
+
+// FetchFunc makes the download of job to dest, the job's path in the agent's
+// directory, telling progress how many of the total bytes (0 when unknown)
+// it has downloaded.
+type FetchFunc func(ctx context.Context, job *Job, dest string, progress func(bytes, total int64)) error
+
+// Agent is the http.Handler of an agent: it downloads the jobs it is sent
+// into its directory with fetch, running a few at a time.
+type Agent struct {
+	root  string
+	token string
+	fetch FetchFunc
+	ctx   context.Context
+	slots chan struct{}
+	mux   *http.ServeMux
+
+	mu   sync.Mutex
+	jobs map[string]*agentJob
+}
+
+// errLeaseExpired is the error of a job cancelled because its lease ran out.
+var errLeaseExpired = errors.New("lease expired: the coordinator stopped following the job")
+
+// agentJob is a job an agent was sent.
+type agentJob struct {
+	status   Status
+	finished time.Time
+	cancel   context.CancelFunc
+
+	// done is closed once fetch has returned and the job no longer writes.
+	done chan struct{}
+
+	// lease cancels the job unless its status is asked for within leaseFor,
+	// the job's Lease; expired tells the job was cancelled so.
+	lease    *time.Timer
+	leaseFor time.Duration
+	expired  bool
+}
+
+// NewAgent returns an agent downloading into root with fetch, at most
+// parallel jobs at once (DefaultAgentJobs if parallel <= 0), and accepting
+// requests that carry token. Cancelling ctx stops its jobs.
+func NewAgent(ctx context.Context, root, token string, parallel int, fetch FetchFunc) *Agent {
+	if parallel <= 0 {
+		parallel = DefaultAgentJobs
+	}
+
+	a := &Agent{
+		root:  root,
+		token: token,
+		fetch: fetch,
+		ctx:   ctx,
+		slots: make(chan struct{}, parallel),
+		mux:   http.NewServeMux(),
+		jobs:  make(map[string]*agentJob),
+	}
+
+	a.mux.HandleFunc("POST /v1/jobs", a.handleSubmit)
+	a.mux.HandleFunc("GET /v1/jobs/{id}", a.handleStatus)
+	a.mux.HandleFunc("DELETE /v1/jobs/{id}", a.handleCancel)
+
+	return a
+}
+
+// ServeHTTP serves the agent's API.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !validToken(r, a.token) {
+		writeError(w, http.StatusUnauthorized, errors.New("missing or wrong token"))
+		return
+	}
+
+	a.mux.ServeHTTP(w, r)
+}
+
+// handleSubmit queues a job.
+func (a *Agent) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	job := &Job{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(job); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateJob(job); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	a.mu.Lock()
+	a.forgetFinished()
+
+	if _, ok := a.jobs[job.ID]; ok {
+		a.mu.Unlock()
+		writeError(w, http.StatusConflict, errors.New("job "+job.ID+" already exists"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	aj := &agentJob{status: Status{ID: job.ID, State: StateQueued}, cancel: cancel, done: make(chan struct{}), leaseFor: job.Lease}
+	if job.Lease > 0 {
+		aj.lease = time.AfterFunc(job.Lease, func() { a.expire(aj) })
+	}
+	a.jobs[job.ID] = aj
+	a.mu.Unlock()
+
+	go a.run(ctx, job, aj)
+
+	writeJSON(w, http.StatusAccepted, a.snapshot(aj))
+}
+
+// handleStatus answers the status of a job and renews its lease.
+func (a *Agent) handleStatus(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	aj := a.jobs[r.PathValue("id")]
+	if aj != nil && aj.lease != nil && aj.finished.IsZero() && !aj.expired {
+		aj.lease.Reset(aj.leaseFor)
+	}
+	a.mu.Unlock()
+
+	if aj == nil {
+		writeError(w, http.StatusNotFound, errors.New("no job "+r.PathValue("id")))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.snapshot(aj))
+}
+
+// handleCancel stops a job and answers its status, once the job has stopped
+// writing or after cancelWait. Only a finished status tells the coordinator
+// that the job's file may be given to another agent.
+func (a *Agent) handleCancel(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	aj := a.jobs[r.PathValue("id")]
+	a.mu.Unlock()
+
+	if aj == nil {
+		writeError(w, http.StatusNotFound, errors.New("no job "+r.PathValue("id")))
+		return
+	}
+
+	aj.cancel()
+
+	select {
+	case <-aj.done:
+	case <-time.After(cancelWait):
+	case <-r.Context().Done():
+	}
+
+	writeJSON(w, http.StatusOK, a.snapshot(aj))
+}
+
+// run makes job once a slot is free, until ctx is cancelled.
+func (a *Agent) run(ctx context.Context, job *Job, aj *agentJob) {
+	defer aj.cancel()
+
+	select {
+	case a.slots <- struct{}{}:
+		defer func() { <-a.slots }()
+	case <-ctx.Done():
+		a.finish(aj, ctx.Err())
+		return
+	}
+
+	a.mu.Lock()
+	aj.status.State = StateRunning
+	a.mu.Unlock()
+
+	err := a.fetch(ctx, job, filepath.Join(a.root, filepath.FromSlash(job.Path)), func(bytes, total int64) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		aj.status.Bytes, aj.status.Total = bytes, total
+	})
+
+	a.finish(aj, err)
+}
+
+// finish records the outcome of a job.
+func (a *Agent) finish(aj *agentJob, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if aj.lease != nil {
+		aj.lease.Stop()
+	}
+
+	if err != nil && aj.expired {
+		err = errLeaseExpired
+	}
+
+	aj.status.State = StateSucceeded
+	if err != nil {
+		aj.status.State = StateFailed
+		aj.status.Error = err.Error()
+	}
+	aj.finished = time.Now()
+	close(aj.done)
+}
+
+// expire cancels a job whose lease ran out, so that it does not keep writing
+// after its coordinator lost track of it and gave it to another agent.
+func (a *Agent) expire(aj *agentJob) {
+	a.mu.Lock()
+	if !aj.finished.IsZero() {
+		a.mu.Unlock()
+		return
+	}
+	aj.expired = true
+	a.mu.Unlock()
+
+	aj.cancel()
+}
+
+// forgetFinished drops the jobs that ended more than finishedTTL ago. a.mu
+// must be held.
+func (a *Agent) forgetFinished() {
+	for id, aj := range a.jobs {
+		if !aj.finished.IsZero() && time.Since(aj.finished) > finishedTTL {
+			delete(a.jobs, id)
+		}
+	}
+}
+
+// snapshot returns a copy of a job's status.
+func (a *Agent) snapshot(aj *agentJob) Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return aj.status
+}
+
+// validateJob checks a job before it is queued. Its path must stay inside
+// the agent's directory.
+func validateJob(job *Job) error {
+	if job.ID == "" {
+		return errors.New("job without an id")
+	}
+
+	if err := validation.ValidateURL(job.URL); err != nil {
+		return err
+	}
+
+	if !filepath.IsLocal(filepath.FromSlash(job.Path)) {
+		return errors.New("job path " + job.Path + " is not inside the shared directory")
+	}
+
+	if job.Offset < 0 || job.Length < 0 {
+		return errors.New("job range cannot be negative")
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
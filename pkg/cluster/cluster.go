@@ -0,0 +1,191 @@
+// Package cluster spreads downloads across machines: agents download the jobs
+// a coordinator sends them into a directory they share with it, such as an
+// NFS mount or a bucket mounted with a FUSE driver, and the coordinator
+// follows their progress and collects the results.
+//
+// Agents serve a small JSON API over HTTP, authenticated with a token shared
+// by the cluster:
+//
+//	POST   /v1/jobs        submit a Job, answered with its Status
+//	GET    /v1/jobs/{id}   the Status of a job
+//	DELETE /v1/jobs/{id}   cancel a job
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// TokenEnv is the environment variable agents and coordinators read the
+// cluster token from.
+const TokenEnv = "GDL_AGENT_TOKEN"
+
+// States of a job.
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// Job is a download made by an agent: URL to Path, relative to the shared
+// directory. With Length > 0, only the Length bytes from Offset are
+// downloaded, as a piece of a larger file. With Lease > 0, the agent cancels
+// the job when nobody has asked for its status for that long, in nanoseconds
+// on the wire.
+type Job struct {
+	ID       string        `json:"id"`
+	URL      string        `json:"url"`
+	Path     string        `json:"path"`
+	Offset   int64         `json:"offset,omitempty"`
+	Length   int64         `json:"length,omitempty"`
+	IfExists string        `json:"if_exists,omitempty"`
+	Lease    time.Duration `json:"lease,omitempty"`
+}
+
+// Status is the state of a job on an agent.
+type Status struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	Bytes int64  `json:"bytes"`
+	Total int64  `json:"total,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	// Agent is the URL of the agent running the job, set by the coordinator.
+	Agent string `json:"agent,omitempty"`
+}
+
+// Done reports whether the job has ended.
+func (s *Status) Done() bool {
+	return s.State == StateSucceeded || s.State == StateFailed
+}
+
+// ErrUnknownJob is returned for a job the agent does not know.
+var ErrUnknownJob = errors.New("job unknown to the agent")
+
+// ErrJobExists is returned when a job is submitted to an agent that already
+// has a job with its ID.
+var ErrJobExists = errors.New("job already known to the agent")
+
+// Client talks to one agent.
+type Client struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewClient returns a client of the agent at agentURL, such as
+// http://host:7070, authenticating with token.
+func NewClient(agentURL, token string) *Client {
+	return &Client{
+		url:    strings.TrimRight(agentURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// URL returns the agent's URL.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Submit sends job to the agent, which starts it when it has room. It
+// returns ErrJobExists if the agent already has the job, as when the answer
+// to an earlier submission was lost.
+func (c *Client) Submit(ctx context.Context, job *Job) (*Status, error) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeUnknown, "encoding cluster job")
+	}
+
+	return c.do(ctx, http.MethodPost, "/v1/jobs", body)
+}
+
+// Status returns the state of the job with the given ID, or ErrUnknownJob
+// when the agent does not know it, such as after a restart.
+func (c *Client) Status(ctx context.Context, id string) (*Status, error) {
+	return c.do(ctx, http.MethodGet, "/v1/jobs/"+url.PathEscape(id), nil)
+}
+
+// Cancel stops the job with the given ID and returns its status, which is
+// finished once the job has stopped writing its file.
+func (c *Client) Cancel(ctx context.Context, id string) (*Status, error) {
+	return c.do(ctx, http.MethodDelete, "/v1/jobs/"+url.PathEscape(id), nil)
+}
+
+// do makes a request of the agent's API and decodes the status it answers.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*Status, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid agent URL", c.url)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "agent unreachable", c.url)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError, "reading agent response", c.url)
+	}
+
+	if resp.StatusCode == http.StatusNotFound && method != http.MethodPost {
+		return nil, ErrUnknownJob
+	}
+
+	if resp.StatusCode == http.StatusConflict && method == http.MethodPost {
+		return nil, ErrJobExists
+	}
+
+	if resp.StatusCode >= 300 {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(data, &answer)
+
+		code := gdlerrors.CodeClientError
+		if resp.StatusCode >= 500 {
+			code = gdlerrors.CodeServerError
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			code = gdlerrors.CodeAuthenticationFailed
+		}
+
+		refused := gdlerrors.NewDownloadErrorWithDetails(code, "agent refused the request",
+			fmt.Sprintf("%s answered %s: %s", c.url, resp.Status, answer.Error))
+		refused.HTTPStatusCode = resp.StatusCode
+
+		return nil, refused
+	}
+
+	status := &Status{}
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeServerError, "invalid agent response", c.url)
+	}
+
+	return status, nil
+}
+
+// validToken reports whether the Authorization header of r carries token.
+func validToken(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
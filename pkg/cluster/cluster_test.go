@@ -0,0 +1,334 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pieceSource is the file the test agents download pieces of.
+const pieceSource = "0123456789"
+
+// newTestAgent starts an agent writing the URL of each job to its file, or
+// its piece of pieceSource, after waiting on release if it is not nil.
+func newTestAgent(t *testing.T, root string, release <-chan struct{}) *httptest.Server {
+	t.Helper()
+
+	fetch := func(ctx context.Context, job *Job, dest string, progress func(bytes, total int64)) error {
+		if release != nil {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0o750); err != nil {
+			return err
+		}
+
+		data := []byte(job.URL)
+		if job.Length > 0 {
+			data = []byte(pieceSource[job.Offset : job.Offset+job.Length])
+		}
+		progress(int64(len(data)), int64(len(data)))
+
+		return os.WriteFile(dest, data, 0o600)
+	}
+
+	server := httptest.NewServer(NewAgent(t.Context(), root, "secret", 2, fetch))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestAgent(t *testing.T) {
+	root := t.TempDir()
+	release := make(chan struct{})
+	server := newTestAgent(t, root, release)
+
+	client := NewClient(server.URL, "secret")
+	ctx := t.Context()
+
+	if _, err := NewClient(server.URL, "wrong").Submit(ctx, &Job{ID: "1", URL: "https://example.com/a", Path: "a"}); err == nil {
+		t.Error("Submit() with a wrong token succeeded")
+	}
+
+	for _, job := range []*Job{
+		{ID: "", URL: "https://example.com/a", Path: "a"},
+		{ID: "1", URL: "not a url", Path: "a"},
+		{ID: "1", URL: "https://example.com/a", Path: "../escape"},
+		{ID: "1", URL: "https://example.com/a", Path: "/etc/passwd"},
+		{ID: "1", URL: "https://example.com/a", Path: "a", Offset: -1},
+	} {
+		if _, err := client.Submit(ctx, job); err == nil {
+			t.Errorf("Submit(%+v) succeeded", job)
+		}
+	}
+
+	status, err := client.Submit(ctx, &Job{ID: "1", URL: "https://example.com/a", Path: "sub/a"})
+	if err != nil || status.State != StateQueued && status.State != StateRunning {
+		t.Fatalf("Submit() = %+v, %v, want a queued job", status, err)
+	}
+
+	if _, err := client.Submit(ctx, &Job{ID: "1", URL: "https://example.com/a", Path: "a"}); !errors.Is(err, ErrJobExists) {
+		t.Errorf("Submit() of a duplicate ID error = %v, want ErrJobExists", err)
+	}
+
+	if _, err := client.Submit(ctx, &Job{ID: "2", URL: "https://example.com/b", Path: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	// A cancelled job has stopped by the time Cancel answers
+	if status, err := client.Cancel(ctx, "2"); err != nil || !status.Done() {
+		t.Fatalf("Cancel() = %+v, %v, want a finished job", status, err)
+	}
+
+	close(release)
+
+	for _, want := range []struct{ id, state string }{{"1", StateSucceeded}, {"2", StateFailed}} {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			status, err = client.Status(ctx, want.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Done() || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if status.State != want.state {
+			t.Errorf("job %s = %+v, want %s", want.id, status, want.state)
+		}
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(root, "sub", "a")); string(content) != "https://example.com/a" {
+		t.Errorf("job 1 wrote %q", content)
+	}
+
+	if _, err := client.Status(ctx, "42"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Status() of an unknown job error = %v, want ErrUnknownJob", err)
+	}
+}
+
+func TestAgentLease(t *testing.T) {
+	server := newTestAgent(t, t.TempDir(), make(chan struct{}))
+	client := NewClient(server.URL, "secret")
+	ctx := t.Context()
+
+	for _, id := range []string{"followed", "forgotten"} {
+		if _, err := client.Submit(ctx, &Job{ID: id, URL: "https://example.com/a", Path: id, Lease: 100 * time.Millisecond}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Asking for the status renews the lease of "followed" only
+	for range 10 {
+		time.Sleep(30 * time.Millisecond)
+		if status, err := client.Status(ctx, "followed"); err != nil || status.Done() {
+			t.Fatalf("followed job = %+v, %v, want it still running", status, err)
+		}
+	}
+
+	status, err := client.Status(ctx, "forgotten")
+	if err != nil || status.State != StateFailed || status.Error != errLeaseExpired.Error() {
+		t.Errorf("forgotten job = %+v, %v, want it failed with an expired lease", status, err)
+	}
+}
+
+func TestCoordinator(t *testing.T) {
+	root := t.TempDir()
+
+	// One agent is down, one refuses every request
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	var refusals atomic.Int32
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refusals.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer refusing.Close()
+
+	agents := []*Client{
+		NewClient(down.URL, "secret"),
+		NewClient(refusing.URL, "secret"),
+		NewClient(newTestAgent(t, root, nil).URL, "secret"),
+		NewClient(newTestAgent(t, root, nil).URL, "secret"),
+	}
+
+	var jobs []*Job
+	for i := range 10 {
+		jobs = append(jobs, &Job{URL: fmt.Sprintf("https://example.com/%d", i), Path: fmt.Sprintf("files/%d", i)})
+	}
+	jobs = append(jobs, &Job{URL: "ftp://example.com/bad", Path: "bad"})
+
+	co := NewCoordinator(agents)
+	co.Poll = 10 * time.Millisecond
+
+	progressed := false
+	co.Progress = func([]Status) { progressed = true }
+
+	statuses := co.Run(t.Context(), jobs)
+
+	for i, status := range statuses[:10] {
+		if status.State != StateSucceeded || status.Agent == down.URL || status.Agent == refusing.URL {
+			t.Errorf("job %d = %+v, want it succeeded on a working agent", i, status)
+		}
+		if content, _ := os.ReadFile(filepath.Join(root, "files", fmt.Sprint(i))); string(content) != jobs[i].URL {
+			t.Errorf("file %d = %q", i, content)
+		}
+	}
+
+	if bad := statuses[10]; bad.State != StateFailed || bad.Error == "" {
+		t.Errorf("invalid job = %+v, want it failed", bad)
+	}
+	if refusals.Load() != maxAgentErrors {
+		t.Errorf("refusing agent asked %d times, want %d", refusals.Load(), maxAgentErrors)
+	}
+	if !progressed {
+		t.Error("Progress was never called")
+	}
+
+	// Without a working agent, the jobs fail
+	statuses = NewCoordinator(agents[:2]).Run(t.Context(), []*Job{{URL: "https://example.com/x", Path: "x"}})
+	if statuses[0].State != StateFailed || statuses[0].Error != ErrNoAgents.Error() {
+		t.Errorf("job without agents = %+v, want ErrNoAgents", statuses[0])
+	}
+}
+
+func TestCoordinatorRetriedSubmit(t *testing.T) {
+	root := t.TempDir()
+	agent := newTestAgent(t, root, nil)
+
+	// The agent takes the first submission but its answer is lost
+	var submissions atomic.Int32
+	lossy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && submissions.Add(1) == 1 {
+			agent.Config.Handler.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		agent.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer lossy.Close()
+
+	co := NewCoordinator([]*Client{NewClient(lossy.URL, "secret")})
+	co.Poll = 10 * time.Millisecond
+
+	statuses := co.Run(t.Context(), []*Job{{URL: "https://example.com/a", Path: "a"}})
+	if statuses[0].State != StateSucceeded || submissions.Load() != 2 {
+		t.Errorf("job = %+v after %d submissions, want it succeeded on the second", statuses[0], submissions.Load())
+	}
+}
+
+func TestCoordinatorDroppedAgent(t *testing.T) {
+	for _, cancellable := range []bool{true, false} {
+		t.Run(fmt.Sprintf("cancellable=%v", cancellable), func(t *testing.T) {
+			root := t.TempDir()
+
+			// The first agent never finishes its job and stops answering
+			// once it has it; the job ends when cancelled or its lease runs
+			// out, a while after, as it still flushes its file
+			var stopped atomic.Int64
+			stuck := httptest.NewServer(NewAgent(t.Context(), root, "secret", 1,
+				func(ctx context.Context, job *Job, dest string, progress func(bytes, total int64)) error {
+					<-ctx.Done()
+					time.Sleep(100 * time.Millisecond)
+					stopped.Store(time.Now().UnixNano())
+					return ctx.Err()
+				}))
+			defer stuck.Close()
+
+			partitioned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost || r.Method == http.MethodDelete && cancellable {
+					stuck.Config.Handler.ServeHTTP(w, r)
+					return
+				}
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer partitioned.Close()
+
+			var started atomic.Int64
+			working := httptest.NewServer(NewAgent(t.Context(), root, "secret", 1,
+				func(ctx context.Context, job *Job, dest string, progress func(bytes, total int64)) error {
+					started.Store(time.Now().UnixNano())
+					return os.WriteFile(dest, []byte(job.URL), 0o600)
+				}))
+			defer working.Close()
+
+			co := NewCoordinator([]*Client{NewClient(partitioned.URL, "secret"), NewClient(working.URL, "secret")})
+			co.JobsPerAgent = 1
+			co.Poll = 10 * time.Millisecond
+			co.Lease = 300 * time.Millisecond
+
+			begin := time.Now()
+			statuses := co.Run(t.Context(), []*Job{{URL: "https://example.com/a", Path: "a"}})
+
+			if statuses[0].State != StateSucceeded || statuses[0].Agent != working.URL {
+				t.Fatalf("job = %+v, want it succeeded on the working agent", statuses[0])
+			}
+			if stopped.Load() == 0 || stopped.Load() > started.Load() {
+				t.Error("the job was moved before the dropped agent stopped it")
+			}
+			if waited := time.Unix(0, started.Load()).Sub(begin); cancellable && waited >= co.Lease {
+				t.Errorf("job moved after %v, want it moved at once once cancelled", waited)
+			}
+		})
+	}
+}
+
+func TestSplitAndJoin(t *testing.T) {
+	root := t.TempDir()
+	agents := []*Client{
+		NewClient(newTestAgent(t, root, nil).URL, "secret"),
+		NewClient(newTestAgent(t, root, nil).URL, "secret"),
+	}
+
+	pieces := SplitJobs("https://example.com/big.iso", "big.iso", 10, 4)
+	if len(pieces) != 3 || pieces[2].Offset != 8 || pieces[2].Length != 2 {
+		t.Fatalf("SplitJobs() = %+v, want pieces of 4, 4 and 2 bytes", pieces)
+	}
+
+	co := NewCoordinator(agents)
+	co.Poll = 10 * time.Millisecond
+
+	for _, status := range co.Run(t.Context(), pieces) {
+		if status.State != StateSucceeded {
+			t.Fatalf("piece %+v did not succeed", status)
+		}
+	}
+
+	if err := JoinPieces(root, "big.iso", pieces); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(root, "big.iso")); string(content) != pieceSource {
+		t.Errorf("joined file = %q, want the pieces in order", content)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(root, "big.iso.*"))
+	if len(matches) != 0 {
+		t.Errorf("pieces left behind: %v", matches)
+	}
+
+	// A short piece is not joined
+	short := SplitJobs("https://example.com/big.iso", "short.iso", 4, 4)
+	if err := os.WriteFile(filepath.Join(root, short[0].Path), []byte("abc"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := JoinPieces(root, "short.iso", short); err == nil {
+		t.Error("JoinPieces() of a short piece succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(root, "short.iso")); !os.IsNotExist(err) {
+		t.Error("a file was joined from a short piece")
+	}
+}
@@ -0,0 +1,397 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// Defaults of a Coordinator.
+const (
+	DefaultJobsPerAgent = 2
+	DefaultPollInterval = 500 * time.Millisecond
+	DefaultLease        = 2 * time.Minute
+)
+
+// maxAgentErrors is how many requests in a row an agent can fail before the
+// coordinator stops using it and moves its jobs to the other agents.
+const maxAgentErrors = 3
+
+// ErrNoAgents is the error of the jobs left when every agent has failed.
+var ErrNoAgents = errors.New("no agent left to run the job")
+
+// Coordinator runs jobs on a set of agents.
+type Coordinator struct {
+	agents []*Client
+
+	// JobsPerAgent is how many jobs each agent is given at once, and Poll
+	// how often their status is asked for.
+	JobsPerAgent int
+	Poll         time.Duration
+
+	// Lease is how long an agent keeps a job without being asked for its
+	// status before cancelling it, for the jobs that do not set their own.
+	// The jobs of a dropped agent that cannot be cancelled there are only
+	// given to another agent once their lease has run out, so that two
+	// agents never write the same file.
+	Lease time.Duration
+
+	// Progress, if not nil, is called with the status of every job after
+	// each poll.
+	Progress func(statuses []Status)
+}
+
+// NewCoordinator returns a coordinator of agents.
+func NewCoordinator(agents []*Client) *Coordinator {
+	return &Coordinator{agents: agents, JobsPerAgent: DefaultJobsPerAgent, Poll: DefaultPollInterval, Lease: DefaultLease}
+}
+
+// coordinatedAgent is an agent and the jobs it runs for the coordinator.
+type coordinatedAgent struct {
+	client  *Client
+	running []int
+	errors  int
+}
+
+// fence keeps a job from other agents while the agent it was last sent to
+// may still run it: until its lease, counted from the last request about the
+// job, has run out there, and the agent has had cancelWait to stop it.
+type fence struct {
+	agent *coordinatedAgent
+	lease time.Duration
+	until time.Time
+}
+
+// renew extends the fence after a request about the job to its agent, which
+// renews the job's lease there if it arrived.
+func (f *fence) renew() {
+	f.until = time.Now().Add(f.lease + cancelWait)
+}
+
+// holds reports whether the job may not be given to agent yet.
+func (f *fence) holds(agent *coordinatedAgent) bool {
+	return f.agent != nil && f.agent != agent && time.Now().Before(f.until)
+}
+
+// Run runs jobs on the agents, giving each the next job as one of its own
+// ends, and returns the final status of each job, in the order of jobs. Jobs
+// without an ID are given one, and those without a lease co.Lease. An agent
+// that cannot be reached maxAgentErrors times in a row is dropped and its
+// jobs are cancelled there and moved to the others, once their lease has run
+// out if the agent cannot confirm the cancellation; an agent that lost a job,
+// as by a restart, is given it again. Cancelling ctx cancels the jobs still
+// running.
+func (co *Coordinator) Run(ctx context.Context, jobs []*Job) []Status {
+	prefix := runID()
+	statuses := make([]Status, len(jobs))
+	fences := make([]fence, len(jobs))
+	pending := make([]int, 0, len(jobs))
+
+	lease := co.Lease
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+
+	for i, job := range jobs {
+		if job.ID == "" {
+			job.ID = prefix + "-" + strconv.Itoa(i+1)
+		}
+		if job.Lease == 0 {
+			job.Lease = lease
+		}
+		statuses[i] = Status{ID: job.ID, State: StateQueued}
+		pending = append(pending, i)
+	}
+
+	agents := make([]*coordinatedAgent, len(co.agents))
+	for i, client := range co.agents {
+		agents[i] = &coordinatedAgent{client: client}
+	}
+
+	slots := max(co.JobsPerAgent, 1)
+	poll := co.Poll
+	if poll <= 0 {
+		poll = DefaultPollInterval
+	}
+
+	for {
+		pending = co.dispatch(ctx, agents, jobs, statuses, fences, pending, slots)
+
+		alive, running := 0, 0
+		for _, agent := range agents {
+			if agent.errors < maxAgentErrors {
+				alive++
+			}
+			running += len(agent.running)
+		}
+
+		if alive == 0 {
+			for _, i := range pending {
+				statuses[i].State, statuses[i].Error = StateFailed, ErrNoAgents.Error()
+			}
+			return statuses
+		}
+
+		if len(pending) == 0 && running == 0 {
+			return statuses
+		}
+
+		select {
+		case <-ctx.Done():
+			co.cancel(agents, statuses, ctx.Err())
+			for _, i := range pending {
+				statuses[i].State, statuses[i].Error = StateFailed, ctx.Err().Error()
+			}
+			return statuses
+		case <-time.After(poll):
+		}
+
+		for _, agent := range agents {
+			pending = co.poll(ctx, agent, statuses, fences, pending)
+		}
+
+		if co.Progress != nil {
+			co.Progress(statuses)
+		}
+	}
+}
+
+// dispatch gives pending jobs to the agents with room for them and returns
+// the jobs still pending.
+func (co *Coordinator) dispatch(ctx context.Context, agents []*coordinatedAgent, jobs []*Job, statuses []Status, fences []fence, pending []int, slots int) []int {
+	for _, agent := range agents {
+		for agent.errors < maxAgentErrors && len(agent.running) < slots && ctx.Err() == nil {
+			next := slices.IndexFunc(pending, func(i int) bool { return !fences[i].holds(agent) })
+			if next < 0 {
+				break
+			}
+			i := pending[next]
+
+			// The agent may have the job even if its answer is lost
+			status, err := agent.client.Submit(ctx, jobs[i])
+			if reached(err) {
+				fences[i] = fence{agent: agent, lease: jobs[i].Lease}
+				fences[i].renew()
+			}
+
+			if errors.Is(err, ErrJobExists) {
+				// A submission retried after its answer was lost
+				status, err = &Status{ID: jobs[i].ID, State: StateQueued}, nil
+			}
+
+			var refused *gdlerrors.DownloadError
+			if errors.As(err, &refused) && refused.Code == gdlerrors.CodeClientError {
+				// The job itself is at fault, such as with an invalid URL
+				statuses[i].State, statuses[i].Error = StateFailed, err.Error()
+				pending = slices.Delete(pending, next, next+1)
+				continue
+			}
+
+			if err != nil {
+				agent.errors++
+				break
+			}
+
+			agent.errors = 0
+			agent.running = append(agent.running, i)
+			pending = slices.Delete(pending, next, next+1)
+
+			statuses[i] = *status
+			statuses[i].Agent = agent.client.URL()
+		}
+	}
+
+	return pending
+}
+
+// poll updates the status of the jobs an agent runs and returns the jobs
+// pending, with those the agent lost or had when it was dropped.
+func (co *Coordinator) poll(ctx context.Context, agent *coordinatedAgent, statuses []Status, fences []fence, pending []int) []int {
+	running := agent.running[:0]
+
+	for _, i := range agent.running {
+		status, err := agent.client.Status(ctx, statuses[i].ID)
+		if reached(err) {
+			fences[i].renew()
+		}
+
+		switch {
+		case errors.Is(err, ErrUnknownJob):
+			fences[i] = fence{}
+			statuses[i] = Status{ID: statuses[i].ID, State: StateQueued}
+			pending = append(pending, i)
+			continue
+		case err != nil:
+			agent.errors++
+			running = append(running, i)
+			continue
+		}
+
+		agent.errors = 0
+		statuses[i] = *status
+		statuses[i].Agent = agent.client.URL()
+
+		if !status.Done() {
+			running = append(running, i)
+		}
+	}
+
+	agent.running = running
+
+	if agent.errors >= maxAgentErrors {
+		co.release(agent, statuses, fences)
+		pending = append(pending, agent.running...)
+		agent.running = nil
+	}
+
+	return pending
+}
+
+// release cancels the jobs of a dropped agent there, if it can still be
+// reached, and queues them again. A job is unfenced only once the agent
+// reports it finished or no longer knows it, since a cancelled job may still
+// be writing its file; the others stay fenced until their lease runs out, when
+// the agent cancels them itself.
+func (co *Coordinator) release(agent *coordinatedAgent, statuses []Status, fences []fence) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, i := range agent.running {
+		id := statuses[i].ID
+		statuses[i] = Status{ID: id, State: StateQueued}
+
+		status, err := agent.client.Cancel(ctx, id)
+		switch {
+		case errors.Is(err, ErrUnknownJob), err == nil && status.Done():
+			fences[i] = fence{}
+		case reached(err):
+			fences[i].renew()
+		}
+	}
+}
+
+// cancel asks the agents to stop the jobs they run for the coordinator, and
+// marks the jobs failed with err.
+func (co *Coordinator) cancel(agents []*coordinatedAgent, statuses []Status, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, agent := range agents {
+		for _, i := range agent.running {
+			_, _ = agent.client.Cancel(ctx, statuses[i].ID)
+			statuses[i].State, statuses[i].Error = StateFailed, err.Error()
+		}
+	}
+}
+
+// reached reports whether a request may have reached the agent: it did
+// unless it could not connect or the agent answered it with an error.
+func reached(err error) bool {
+	var dial *net.OpError
+	if errors.As(err, &dial) && dial.Op == "dial" {
+		return false
+	}
+
+	var refused *gdlerrors.DownloadError
+
+	return !errors.As(err, &refused) || refused.HTTPStatusCode == 0
+}
+
+// runID returns a random prefix for the IDs of a run's jobs, so that the runs
+// of several coordinators do not clash on an agent.
+func runID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// SplitJobs splits the download of size bytes of url to path into pieces of
+// at most pieceSize bytes, to be run on several agents and joined with
+// JoinPieces. Each piece is downloaded to a file of its own next to path.
+func SplitJobs(url, path string, size, pieceSize int64) []*Job {
+	var jobs []*Job
+
+	for offset, n := int64(0), 1; offset < size; offset, n = offset+pieceSize, n+1 {
+		jobs = append(jobs, &Job{
+			URL:      url,
+			Path:     fmt.Sprintf("%s.gdl-piece%03d", path, n),
+			Offset:   offset,
+			Length:   min(pieceSize, size-offset),
+			IfExists: types.CollisionOverwrite,
+		})
+	}
+
+	return jobs
+}
+
+// JoinPieces joins the pieces of a file downloaded by the jobs of SplitJobs
+// in dir, the shared directory, into path, relative to dir, and removes
+// them. The file is written next to path and renamed over it once complete.
+func JoinPieces(dir, path string, pieces []*Job) error {
+	dest := filepath.Join(dir, filepath.FromSlash(path))
+	tmp := dest + ".gdl-part"
+
+	out, err := os.Create(tmp) // #nosec G304 -- path inside the output directory
+	if err != nil {
+		return gdlerrors.NewStorageError("create joined file", err, tmp)
+	}
+
+	for _, piece := range pieces {
+		if err := appendPiece(out, filepath.Join(dir, filepath.FromSlash(piece.Path)), piece.Length); err != nil {
+			_ = out.Close()
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return gdlerrors.NewStorageError("write joined file", err, tmp)
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return gdlerrors.NewStorageError("rename joined file", err, dest)
+	}
+
+	for _, piece := range pieces {
+		_ = os.Remove(filepath.Join(dir, filepath.FromSlash(piece.Path)))
+	}
+
+	return nil
+}
+
+// appendPiece copies the piece file at path, which must hold length bytes, to
+// out.
+func appendPiece(out io.Writer, path string, length int64) error {
+	in, err := os.Open(path) // #nosec G304 -- path inside the output directory
+	if err != nil {
+		return gdlerrors.NewStorageError("open piece", err, path)
+	}
+	defer func() { _ = in.Close() }()
+
+	n, err := io.Copy(out, in)
+	if err != nil {
+		return gdlerrors.NewStorageError("copy piece", err, path)
+	}
+
+	if n != length {
+		return gdlerrors.NewStorageError("copy piece",
+			fmt.Errorf("piece holds %d bytes, want %d", n, length), path)
+	}
+
+	return nil
+}
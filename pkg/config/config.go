@@ -10,6 +10,7 @@ import (
 	"time"
 
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/rules"
 )
 
 // RetryPolicyConfig defines the retry policy configuration.
@@ -136,6 +137,58 @@ type NetworkConfig struct {
 
 	// InsecureTLS disables TLS certificate verification
 	InsecureTLS bool `json:"insecure_tls" yaml:"insecure_tls"`
+
+	// CircuitBreaker configures the per-host circuit breaker
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker" yaml:"circuit_breaker"`
+}
+
+// CircuitBreakerConfig defines when requests to a repeatedly failing host are rejected.
+type CircuitBreakerConfig struct {
+	// Enabled turns the per-host circuit breaker on
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// FailureThreshold is the number of consecutive failures that opens a host's circuit
+	FailureThreshold int `json:"failure_threshold" yaml:"failure_threshold"`
+
+	// Cooldown is how long a circuit stays open before a probe request is
+	// allowed, written as a duration string such as "30s"
+	Cooldown Duration `json:"cooldown" yaml:"cooldown"`
+}
+
+// Duration is a time.Duration written in the config file as a duration
+// string such as "30s" or "1m30s". A number is read as nanoseconds.
+type Duration time.Duration
+
+// String returns the duration in the form of time.Duration.String.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON writes the duration as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads a duration string or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		var nanoseconds int64
+		if err := json.Unmarshal(data, &nanoseconds); err != nil {
+			return fmt.Errorf("invalid duration %s: expected a string such as \"30s\"", data)
+		}
+
+		*d = Duration(nanoseconds)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", text, err)
+	}
+
+	*d = Duration(parsed)
+	return nil
 }
 
 // StorageConfig defines storage-related configuration.
@@ -208,6 +261,9 @@ type Config struct {
 
 	// Hooks defines event hook configurations
 	Hooks map[string][]string `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+
+	// Rules apply headers and settings to downloads by URL pattern
+	Rules []rules.Rule `json:"rules,omitempty" yaml:"rules,omitempty"`
 }
 
 // DefaultConfig returns a configuration with sensible default values.
@@ -271,6 +327,11 @@ func DefaultConfig() *Config {
 			FollowRedirects:        true,
 			MaxRedirects:           10,
 			InsecureTLS:            false,
+			CircuitBreaker: CircuitBreakerConfig{
+				Enabled:          false,
+				FailureThreshold: 5,
+				Cooldown:         Duration(30 * time.Second),
+			},
 		},
 		Storage: StorageConfig{
 			DefaultDownloadDir: defaultDownloadDir,
@@ -453,6 +514,12 @@ func (cl *ConfigLoader) applyNetworkDefaults(config, defaults *Config) {
 	if config.Network.MaxRedirects == 0 {
 		config.Network.MaxRedirects = defaults.Network.MaxRedirects
 	}
+	if config.Network.CircuitBreaker.FailureThreshold == 0 {
+		config.Network.CircuitBreaker.FailureThreshold = defaults.Network.CircuitBreaker.FailureThreshold
+	}
+	if config.Network.CircuitBreaker.Cooldown == 0 {
+		config.Network.CircuitBreaker.Cooldown = defaults.Network.CircuitBreaker.Cooldown
+	}
 }
 
 func (cl *ConfigLoader) applyStorageDefaults(config, defaults *Config) {
@@ -630,6 +697,18 @@ func (c *Config) validateNetwork() error {
 			fmt.Sprintf("must be non-negative, got %d", c.Network.MaxRedirects),
 		)
 	}
+	if c.Network.CircuitBreaker.FailureThreshold <= 0 {
+		return gdlerrors.NewValidationError(
+			"network.circuit_breaker.failure_threshold",
+			fmt.Sprintf("must be positive, got %d", c.Network.CircuitBreaker.FailureThreshold),
+		)
+	}
+	if c.Network.CircuitBreaker.Cooldown <= 0 {
+		return gdlerrors.NewValidationError(
+			"network.circuit_breaker.cooldown",
+			fmt.Sprintf("must be positive, got %v", c.Network.CircuitBreaker.Cooldown),
+		)
+	}
 	return nil
 }
 
@@ -643,6 +722,15 @@ func (c *Config) validateStorage() error {
 	return nil
 }
 
+func (c *Config) validateRules() error {
+	for i := range c.Rules {
+		if err := c.Rules[i].Validate(); err != nil {
+			return gdlerrors.NewValidationError(fmt.Sprintf("rules[%d]", i), err.Error())
+		}
+	}
+	return nil
+}
+
 func (c *Config) Validate() error {
 	if err := c.validateRetryPolicy(); err != nil {
 		return err
@@ -662,6 +750,9 @@ func (c *Config) Validate() error {
 	if err := c.validateStorage(); err != nil {
 		return err
 	}
+	if err := c.validateRules(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -777,6 +868,13 @@ func (c *Config) mergeNetwork(other *NetworkConfig) {
 	if other.MaxRedirects != 0 {
 		c.Network.MaxRedirects = other.MaxRedirects
 	}
+	if other.CircuitBreaker.FailureThreshold != 0 {
+		c.Network.CircuitBreaker.FailureThreshold = other.CircuitBreaker.FailureThreshold
+	}
+	if other.CircuitBreaker.Cooldown != 0 {
+		c.Network.CircuitBreaker.Cooldown = other.CircuitBreaker.Cooldown
+	}
+	c.Network.CircuitBreaker.Enabled = other.CircuitBreaker.Enabled
 	c.Network.FollowRedirects = other.FollowRedirects
 	c.Network.InsecureTLS = other.InsecureTLS
 }
@@ -808,6 +906,9 @@ func (c *Config) Merge(other *Config) {
 	c.mergeNetwork(&other.Network)
 	c.mergeStorage(&other.Storage)
 
+	// Rules of the other config are applied after these, refining them
+	c.Rules = append(c.Rules, other.Rules...)
+
 	// Update version
 	if other.Version != "" {
 		c.Version = other.Version
@@ -4,8 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/forest6511/gdl/pkg/rules"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -236,6 +239,39 @@ func TestConfig_Validate(t *testing.T) {
 	if err == nil {
 		t.Error("Should fail validation with negative MaxConcurrentDownloads")
 	}
+
+	// Test invalid circuit breaker settings
+	config = DefaultConfig()
+	config.Network.CircuitBreaker.FailureThreshold = -1
+
+	err = config.Validate()
+	if err == nil {
+		t.Error("Should fail validation with negative circuit breaker FailureThreshold")
+	}
+
+	config = DefaultConfig()
+	config.Network.CircuitBreaker.Cooldown = Duration(-time.Second)
+
+	err = config.Validate()
+	if err == nil {
+		t.Error("Should fail validation with negative circuit breaker Cooldown")
+	}
+
+	// Test rules
+	config = DefaultConfig()
+	config.Rules = []rules.Rule{{Match: "*.internal.corp", Headers: map[string]string{"X-Team": "infra"}}}
+
+	err = config.Validate()
+	if err != nil {
+		t.Errorf("Valid rules should pass validation: %v", err)
+	}
+
+	config.Rules = append(config.Rules, rules.Rule{Match: "example-cdn.com", Concurrency: 100})
+
+	err = config.Validate()
+	if err == nil {
+		t.Error("Should fail validation with a rule concurrency over the limit")
+	}
 }
 
 func TestConfig_Clone(t *testing.T) {
@@ -608,6 +644,51 @@ func TestConfigLoader_LoadInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestConfigLoader_CircuitBreakerCooldown(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+
+	tests := []struct {
+		cooldown string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{`"1m30s"`, 90 * time.Second, false},
+		{`5000000000`, 5 * time.Second, false},
+		{`"soon"`, 0, true},
+	}
+
+	for _, tt := range tests {
+		data := `{"network": {"circuit_breaker": {"enabled": true, "failure_threshold": 3, "cooldown": ` + tt.cooldown + `}}}`
+		if err := os.WriteFile(configPath, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := NewConfigLoader(configPath).Load()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Load() with cooldown %s should fail", tt.cooldown)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Load() with cooldown %s error = %v", tt.cooldown, err)
+		}
+		if got := time.Duration(config.Network.CircuitBreaker.Cooldown); got != tt.want {
+			t.Errorf("cooldown %s = %v, want %v", tt.cooldown, got, tt.want)
+		}
+	}
+
+	// Saved configs write the cooldown as a duration string
+	config := DefaultConfig()
+	if err := NewConfigLoader(configPath).Save(config); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(saved), `"cooldown": "30s"`) {
+		t.Errorf("saved config does not hold the cooldown as \"30s\":\n%s", saved)
+	}
+}
+
 func TestConfigLoader_SaveDirectoryPermissionError(t *testing.T) {
 	// Skip on Windows as permission model is different
 	if runtime.GOOS == "windows" {
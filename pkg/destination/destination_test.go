@@ -0,0 +1,533 @@
+package destination
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "file.bin")
+
+	var dest types.ResumableDestination = NewFile(path)
+
+	w, err := dest.CreateWriterAt(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dest.Suspend(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if written, _ := dest.Written(ctx); written != 5 {
+		t.Errorf("Written() = %d, want 5", written)
+	}
+	if exists, _ := dest.Exists(ctx); exists {
+		t.Error("Exists() before Commit")
+	}
+
+	// The next attempt goes on from the kept bytes
+	if w, err = dest.CreateWriterAt(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteAt([]byte("world"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := os.ReadFile(path); string(got) != "helloworld" { // #nosec G304 -- test file
+		t.Errorf("content = %q", got)
+	}
+	if exists, _ := dest.Exists(ctx); !exists {
+		t.Error("Exists() after Commit = false")
+	}
+
+	// An aborted attempt leaves the committed file alone
+	if w, err = dest.CreateWriterAt(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.WriteAt([]byte("new"), 0)
+	if err := dest.Abort(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := os.ReadFile(path); string(got) != "helloworld" { // #nosec G304 -- test file
+		t.Errorf("content after Abort = %q", got)
+	}
+	if _, err := os.Stat(path + PartSuffix); !os.IsNotExist(err) {
+		t.Error("part file left behind")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	dest := NewMemory()
+
+	w, err := dest.CreateWriterAt(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pieces arrive out of order
+	_, _ = w.WriteAt([]byte("world"), 5)
+	_, _ = w.WriteAt([]byte("hello"), 0)
+
+	if dest.Bytes() != nil {
+		t.Error("Bytes() before Commit")
+	}
+	if err := dest.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(dest.Bytes()); got != "helloworld" {
+		t.Errorf("Bytes() = %q", got)
+	}
+
+	w, _ = dest.CreateWriterAt(ctx, 3)
+	_, _ = w.WriteAt([]byte("new"), 0)
+	_ = dest.Abort(ctx)
+
+	if got := string(dest.Bytes()); got != "helloworld" {
+		t.Errorf("Bytes() after Abort = %q", got)
+	}
+}
+
+// fakeS3 keeps objects, and the parts of multipart uploads, in maps.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int32][]byte
+}
+
+func (f *fakeS3) HeadObject(_ context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.objects[*in.Bucket+"/"+*in.Key]; !ok {
+		return nil, &s3types.NotFound{}
+	}
+
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (f *fakeS3) PutObject(_ context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.objects[*in.Bucket+"/"+*in.Key] = data
+	f.mu.Unlock()
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(_ context.Context, _ *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := fmt.Sprint(len(f.uploads) + 1)
+	f.uploads[id] = map[int32][]byte{}
+
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3) UploadPart(_ context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.uploads[*in.UploadId][*in.PartNumber] = data
+
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprint("etag-", *in.PartNumber))}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(_ context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var object []byte
+	for i, part := range in.MultipartUpload.Parts {
+		if *part.PartNumber != int32(i+1) || *part.ETag != fmt.Sprint("etag-", i+1) {
+			return nil, fmt.Errorf("part %d out of order", *part.PartNumber)
+		}
+		data := f.uploads[*in.UploadId][*part.PartNumber]
+		if i < len(in.MultipartUpload.Parts)-1 && len(data) < minS3PartSize {
+			return nil, fmt.Errorf("part %d is too small", *part.PartNumber)
+		}
+		object = append(object, data...)
+	}
+
+	f.objects[*in.Bucket+"/"+*in.Key] = object
+	delete(f.uploads, *in.UploadId)
+
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(_ context.Context, in *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.uploads, *in.UploadId)
+
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int32][]byte{}}
+	dest := NewS3(client, "bucket", "dir/file.bin", t.TempDir())
+
+	if exists, err := dest.Exists(ctx); err != nil || exists {
+		t.Fatalf("Exists() = %v, %v before the upload", exists, err)
+	}
+
+	w, err := dest.CreateWriterAt(ctx, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.WriteAt([]byte("abc"), 3)
+	_, _ = w.WriteAt([]byte("xyz"), 0)
+
+	if len(client.objects) != 0 {
+		t.Error("object uploaded before Commit")
+	}
+
+	if err := dest.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := client.objects["bucket/dir/file.bin"]; !bytes.Equal(got, []byte("xyzabc")) {
+		t.Errorf("object = %q", got)
+	}
+	if exists, _ := dest.Exists(ctx); !exists {
+		t.Error("Exists() after Commit = false")
+	}
+	if written, _ := dest.Written(ctx); written != 0 {
+		t.Errorf("staged file of %d bytes left behind", written)
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int32][]byte{}}
+	dest := NewS3Multipart(client, "bucket", "big.bin", &MultipartOptions{PartSize: 1})
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*minS3PartSize+1000)/16)
+
+	w, err := dest.CreateWriterAt(ctx, int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest.PartSize() != minS3PartSize {
+		t.Errorf("PartSize() = %d, want the S3 minimum", dest.PartSize())
+	}
+
+	// Pieces of whole parts arrive over several connections
+	var wg sync.WaitGroup
+	for start := 0; start < len(content); start += minS3PartSize {
+		piece := content[start:min(start+minS3PartSize, len(content))]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for off := 0; off < len(piece); off += 32 * 1024 {
+				if _, err := w.WriteAt(piece[off:min(off+32*1024, len(piece))], int64(start+off)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(client.objects) != 0 {
+		t.Error("object completed before Commit")
+	}
+
+	if err := dest.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := client.objects["bucket/big.bin"]; !bytes.Equal(got, content) {
+		t.Errorf("object of %d bytes differs from the %d written", len(got), len(content))
+	}
+	if exists, _ := dest.Exists(ctx); !exists {
+		t.Error("Exists() after Commit = false")
+	}
+
+	// An aborted attempt drops its upload and leaves the object alone
+	w, _ = dest.CreateWriterAt(ctx, 3)
+	_, _ = w.WriteAt([]byte("new"), 0)
+	if err := dest.Abort(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.uploads) != 0 {
+		t.Errorf("%d uploads left behind", len(client.uploads))
+	}
+	if got := client.objects["bucket/big.bin"]; !bytes.Equal(got, content) {
+		t.Error("object changed by an aborted attempt")
+	}
+}
+
+// fakeUpload keeps the parts of an upload in memory. Uploads wait for gate
+// when it is not nil, and part fail fails.
+type fakeUpload struct {
+	gate chan struct{}
+	fail int
+
+	mu      sync.Mutex
+	parts   map[int][]byte
+	content []byte
+	aborted bool
+}
+
+func (u *fakeUpload) uploadPart(_ context.Context, n int, data []byte) error {
+	if u.gate != nil {
+		<-u.gate
+	}
+	if n == u.fail {
+		return errors.New("upload failed")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.parts[n] = bytes.Clone(data)
+
+	return nil
+}
+
+func (u *fakeUpload) complete(_ context.Context, parts int) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for n := 1; n <= parts; n++ {
+		u.content = append(u.content, u.parts[n]...)
+	}
+
+	return nil
+}
+
+func (u *fakeUpload) abort(context.Context) error {
+	u.aborted = true
+
+	return nil
+}
+
+func TestStreamed(t *testing.T) {
+	ctx := context.Background()
+
+	newTestStreamed := func(upload *fakeUpload) *streamed {
+		upload.parts = map[int][]byte{}
+		s := newStreamed("test://object", 100, 0, &MultipartOptions{PartSize: 4, BufferedParts: 2},
+			func(context.Context) (partUpload, error) { return upload, nil })
+
+		return &s
+	}
+
+	t.Run("bounded", func(t *testing.T) {
+		upload := &fakeUpload{gate: make(chan struct{})}
+		s := newTestStreamed(upload)
+
+		w, err := s.CreateWriterAt(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Two full parts are held while they upload
+		_, _ = w.WriteAt([]byte("abcd"), 0)
+		_, _ = w.WriteAt([]byte("efgh"), 4)
+
+		written := make(chan struct{})
+		go func() {
+			_, _ = w.WriteAt([]byte("ij"), 8)
+			close(written)
+		}()
+
+		select {
+		case <-written:
+			t.Fatal("a third part was buffered while two were held")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(upload.gate)
+		<-written
+
+		if err := s.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if string(upload.content) != "abcdefghij" {
+			t.Errorf("content = %q", upload.content)
+		}
+	})
+
+	t.Run("unknown size", func(t *testing.T) {
+		upload := &fakeUpload{}
+		s := newTestStreamed(upload)
+
+		w, _ := s.CreateWriterAt(ctx, -1)
+		_, _ = w.WriteAt([]byte("hello, "), 0)
+		_, _ = w.WriteAt([]byte("world!"), 7)
+
+		if err := s.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if string(upload.content) != "hello, world!" || len(upload.parts) != 4 {
+			t.Errorf("content = %q in %d parts", upload.content, len(upload.parts))
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		upload := &fakeUpload{}
+		s := newTestStreamed(upload)
+
+		_, _ = s.CreateWriterAt(ctx, 0)
+		if err := s.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if len(upload.parts) != 1 || len(upload.content) != 0 {
+			t.Errorf("parts = %q, want one empty part", upload.parts)
+		}
+	})
+
+	t.Run("incomplete", func(t *testing.T) {
+		upload := &fakeUpload{}
+		s := newTestStreamed(upload)
+
+		w, _ := s.CreateWriterAt(ctx, 10)
+		_, _ = w.WriteAt([]byte("abcd"), 0)
+		_, _ = w.WriteAt([]byte("ij"), 8)
+
+		if err := s.Commit(ctx); err == nil {
+			t.Fatal("Commit() with a missing part succeeded")
+		}
+		if err := s.Abort(ctx); err != nil || !upload.aborted {
+			t.Errorf("Abort() = %v, aborted %v", err, upload.aborted)
+		}
+	})
+
+	t.Run("failed upload", func(t *testing.T) {
+		upload := &fakeUpload{fail: 1}
+		s := newTestStreamed(upload)
+
+		w, _ := s.CreateWriterAt(ctx, 10)
+		_, _ = w.WriteAt([]byte("abcd"), 0)
+		_, _ = w.WriteAt([]byte("efgh"), 4)
+		_, _ = w.WriteAt([]byte("ij"), 8)
+
+		if err := s.Commit(ctx); err == nil {
+			t.Error("Commit() after a failed upload succeeded")
+		}
+	})
+
+	t.Run("part limit", func(t *testing.T) {
+		s := newTestStreamed(&fakeUpload{})
+
+		w, _ := s.CreateWriterAt(ctx, 1000)
+		if s.PartSize() != 10 {
+			t.Errorf("PartSize() = %d, want 10 to fit 1000 bytes in 100 parts", s.PartSize())
+		}
+		if _, err := w.WriteAt([]byte("x"), 1000); err == nil {
+			t.Error("WriteAt() past the end succeeded")
+		}
+	})
+}
+
+// brokenWriter is a destination whose writes fail after limit bytes.
+type brokenWriter struct {
+	*Memory
+	limit int64
+}
+
+func (b brokenWriter) CreateWriterAt(context.Context, int64) (io.WriterAt, error) {
+	return b, nil
+}
+
+func (b brokenWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > b.limit {
+		return 0, errors.New("disk full")
+	}
+
+	return len(p), nil
+}
+
+func TestTee(t *testing.T) {
+	ctx := context.Background()
+
+	first, second := NewMemory(), NewMemory()
+	broken := brokenWriter{Memory: NewMemory(), limit: 5}
+	tee := NewTee(first, broken, second)
+
+	w, err := tee.CreateWriterAt(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, write := range []struct {
+		data string
+		off  int64
+	}{{"hello", 0}, {"world", 5}} {
+		if _, err := w.WriteAt([]byte(write.data), write.off); err != nil {
+			t.Fatalf("WriteAt() with a destination left = %v", err)
+		}
+	}
+
+	if err := tee.Commit(ctx); err != nil {
+		t.Fatalf("Commit() with destinations left = %v", err)
+	}
+
+	for _, dest := range []*Memory{first, second} {
+		if got := string(dest.Bytes()); got != "helloworld" {
+			t.Errorf("destination holds %q", got)
+		}
+	}
+
+	results := tee.Results()
+	if results[0] != nil || results[1] == nil || results[2] != nil {
+		t.Errorf("Results() = %v, want only the broken destination failed", results)
+	}
+	if exists, _ := tee.Exists(ctx); !exists {
+		t.Error("Exists() = false with committed destinations")
+	}
+
+	// Writes fail once every destination has failed
+	w, _ = NewTee(broken, brokenWriter{Memory: NewMemory(), limit: 0}).CreateWriterAt(ctx, 10)
+	if _, err := w.WriteAt([]byte("hello, world"), 0); err == nil {
+		t.Error("WriteAt() without a destination left succeeded")
+	}
+
+	multipart := func(partSize int64) *streamed {
+		s := newStreamed("test://object", 100, 0, &MultipartOptions{PartSize: partSize}, nil)
+		return &s
+	}
+	parted := NewTee(NewMemory(), &S3Multipart{streamed: *multipart(4)}, &GCSMultipart{streamed: *multipart(6)})
+	if got := parted.PartSize(); got != 12 {
+		t.Errorf("PartSize() = %d, want 12 for parts of 4 and 6", got)
+	}
+}
@@ -0,0 +1,151 @@
+// Package destination provides the types.Destination implementations
+// downloads can be stored in: local files, memory, Amazon S3 and Google
+// Cloud Storage objects. Each keeps the content of a download apart until it
+// is committed, so that a failed download never replaces a previous version.
+// S3 and GCS stage the content in a local file; S3Multipart and GCSMultipart
+// stream it into the bucket in parts instead, for objects too large for the
+// local disk.
+//
+// Example:
+//
+//	dest := destination.NewFile("/srv/images/latest.iso")
+//	stats, err := downloader.DownloadToDestination(ctx, url, dest, nil)
+package destination
+
+import (
+	"context"
+	"io"
+	"os"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// PartSuffix is appended to the name of the local file a download is written
+// to before it is committed, as for the part files of regular downloads.
+const PartSuffix = ".gdl-part"
+
+// partFile is the local file content is written to until it is committed.
+type partFile struct {
+	path string
+	file *os.File
+}
+
+// open opens the part file for writing, keeping its content.
+func (p *partFile) open() (io.WriterAt, error) {
+	if err := p.close(); err != nil {
+		return nil, err
+	}
+
+	// #nosec G304 -- the part file of a destination chosen by the caller
+	file, err := os.OpenFile(p.path, os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("open part file", err, p.path)
+	}
+
+	p.file = file
+
+	return file, nil
+}
+
+// close closes the part file if it is open.
+func (p *partFile) close() error {
+	if p.file == nil {
+		return nil
+	}
+
+	err := p.file.Close()
+	p.file = nil
+
+	if err != nil {
+		return gdlerrors.NewStorageError("close part file", err, p.path)
+	}
+
+	return nil
+}
+
+// remove closes and deletes the part file.
+func (p *partFile) remove() error {
+	_ = p.close()
+
+	if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		return gdlerrors.NewStorageError("remove part file", err, p.path)
+	}
+
+	return nil
+}
+
+// size returns the size of the part file, 0 when there is none.
+func (p *partFile) size() (int64, error) {
+	info, err := os.Stat(p.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, gdlerrors.NewStorageError("stat part file", err, p.path)
+	}
+
+	return info.Size(), nil
+}
+
+// File stores a download in a local file. The content is written to
+// "<path>.gdl-part" and renamed to path on Commit.
+type File struct {
+	path string
+	part partFile
+}
+
+// NewFile returns the destination for the local file at path.
+func NewFile(path string) *File {
+	return &File{path: path, part: partFile{path: path + PartSuffix}}
+}
+
+// Path returns the path of the file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Exists reports whether the file exists.
+func (f *File) Exists(context.Context) (bool, error) {
+	_, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, gdlerrors.NewStorageError("stat file", err, f.path)
+	}
+
+	return true, nil
+}
+
+// CreateWriterAt opens the part file.
+func (f *File) CreateWriterAt(context.Context, int64) (io.WriterAt, error) {
+	return f.part.open()
+}
+
+// Commit renames the part file to the file's path.
+func (f *File) Commit(context.Context) error {
+	if err := f.part.close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.part.path, f.path); err != nil {
+		return gdlerrors.NewStorageError("rename part file", err, f.path)
+	}
+
+	return nil
+}
+
+// Abort deletes the part file.
+func (f *File) Abort(context.Context) error {
+	return f.part.remove()
+}
+
+// Written returns the size of the part file.
+func (f *File) Written(context.Context) (int64, error) {
+	return f.part.size()
+}
+
+// Suspend closes the part file and keeps it.
+func (f *File) Suspend(context.Context) error {
+	return f.part.close()
+}
@@ -0,0 +1,66 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// GCS stores a download in a Google Cloud Storage object. The content is
+// staged in a local file and uploaded on Commit; the object only changes
+// once the upload is complete.
+type GCS struct {
+	staged
+
+	object *storage.ObjectHandle
+}
+
+// NewGCS returns the destination for object. The content is staged in
+// stagingDir, the system's temporary directory when empty.
+func NewGCS(object *storage.ObjectHandle, stagingDir string) *GCS {
+	d := &GCS{object: object}
+	d.staged = newStaged("gs://"+object.BucketName()+"/"+object.ObjectName(), stagingDir, d.write)
+
+	return d
+}
+
+// Exists reports whether the object exists.
+func (d *GCS) Exists(ctx context.Context) (bool, error) {
+	return gcsExists(ctx, d.object, d.location)
+}
+
+// gcsExists reports whether object, stored at location, exists.
+func gcsExists(ctx context.Context, object *storage.ObjectHandle, location string) (bool, error) {
+	_, err := object.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, gdlerrors.NewStorageError("exists", err, location)
+	}
+
+	return true, nil
+}
+
+// write uploads content as the object. A failed upload leaves the object as
+// it was.
+func (d *GCS) write(ctx context.Context, content *os.File, _ int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := d.object.NewWriter(ctx)
+
+	if _, err := io.Copy(w, content); err != nil {
+		cancel()
+		_ = w.Close()
+
+		return err
+	}
+
+	return w.Close()
+}
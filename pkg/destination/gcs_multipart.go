@@ -0,0 +1,168 @@
+package destination
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+// Limits of GCS composition: an object is composed of at most 1024
+// components, and at most 32 are composed at once.
+const (
+	maxGCSParts      = 1024
+	maxComposeSource = 32
+)
+
+// GCSMultipart streams a download into a Google Cloud Storage object with a
+// parallel composite upload: each part is uploaded as a temporary object
+// next to it as soon as it is filled, with only a few held in memory at
+// once, so large objects are stored without local disk. Commit composes the
+// parts into the object, which only changes then, and deletes them. Unlike
+// GCS it cannot resume: a failed download deletes the parts.
+type GCSMultipart struct {
+	streamed
+
+	bucket *storage.BucketHandle
+	name   string
+}
+
+// NewGCSMultipart returns the destination for the object name in bucket,
+// uploaded in parts as opts sets, defaults when nil.
+func NewGCSMultipart(bucket *storage.BucketHandle, name string, opts *MultipartOptions) *GCSMultipart {
+	d := &GCSMultipart{bucket: bucket, name: name}
+	d.streamed = newStreamed("gs://"+bucket.Object(name).BucketName()+"/"+name, maxGCSParts, 0, opts, d.begin)
+
+	return d
+}
+
+// Exists reports whether the object exists.
+func (d *GCSMultipart) Exists(ctx context.Context) (bool, error) {
+	return gcsExists(ctx, d.bucket.Object(d.name), d.location)
+}
+
+// begin starts an upload whose parts are named after the object and a
+// random ID.
+func (d *GCSMultipart) begin(context.Context) (partUpload, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &gcsUpload{
+		bucket:   d.bucket,
+		object:   d.bucket.Object(d.name),
+		prefix:   d.name + ".gdl-upload-" + hex.EncodeToString(id) + "/",
+		uploaded: make(map[int]bool),
+	}, nil
+}
+
+// gcsUpload is a parallel composite upload in progress.
+type gcsUpload struct {
+	bucket *storage.BucketHandle
+	object *storage.ObjectHandle
+	prefix string
+
+	mu       sync.Mutex
+	uploaded map[int]bool
+}
+
+// partObject returns the temporary object of part n.
+func (u *gcsUpload) partObject(n int) *storage.ObjectHandle {
+	return u.bucket.Object(fmt.Sprintf("%s%05d", u.prefix, n))
+}
+
+// composed returns the temporary object the parts are composed into when
+// there are more than maxComposeSource.
+func (u *gcsUpload) composed() *storage.ObjectHandle {
+	return u.bucket.Object(u.prefix + "composed")
+}
+
+func (u *gcsUpload) uploadPart(ctx context.Context, n int, data []byte) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The part is already in memory: it is sent in one request
+	w := u.partObject(n).NewWriter(ctx)
+	w.ChunkSize = 0
+
+	if _, err := w.Write(data); err != nil {
+		cancel()
+		_ = w.Close()
+
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	u.uploaded[n] = true
+	u.mu.Unlock()
+
+	return nil
+}
+
+// complete composes the parts into the object, maxComposeSource at a time
+// into a temporary object that is composed with the next ones, and deletes
+// the temporary objects.
+func (u *gcsUpload) complete(ctx context.Context, parts int) error {
+	sources := make([]*storage.ObjectHandle, 0, parts)
+	for n := 1; n <= parts; n++ {
+		sources = append(sources, u.partObject(n))
+	}
+
+	var composed *storage.ObjectHandle
+
+	for len(sources) > 0 {
+		batch := make([]*storage.ObjectHandle, 0, maxComposeSource)
+		if composed != nil {
+			batch = append(batch, composed)
+		}
+
+		take := min(maxComposeSource-len(batch), len(sources))
+		batch = append(batch, sources[:take]...)
+		sources = sources[take:]
+
+		target := u.object
+		if len(sources) > 0 {
+			target = u.composed()
+		}
+
+		if _, err := target.ComposerFrom(batch...).Run(ctx); err != nil {
+			return err
+		}
+
+		composed = target
+	}
+
+	// The object is complete; parts left behind only cost storage
+	_ = u.abort(ctx)
+
+	return nil
+}
+
+// abort deletes the uploaded parts and the temporary composed object.
+func (u *gcsUpload) abort(ctx context.Context) error {
+	u.mu.Lock()
+	objects := []*storage.ObjectHandle{u.composed()}
+	for n := range u.uploaded {
+		objects = append(objects, u.partObject(n))
+	}
+	u.uploaded = make(map[int]bool)
+	u.mu.Unlock()
+
+	var errs []error
+	for _, object := range objects {
+		if err := object.Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+package destination
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// Memory stores a download in memory. Bytes returns the committed content.
+type Memory struct {
+	mu        sync.Mutex
+	data      []byte
+	pending   []byte
+	committed bool
+}
+
+// NewMemory returns an empty in-memory destination.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Bytes returns the committed content, nil before the first Commit.
+func (m *Memory) Bytes() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.data
+}
+
+// Exists reports whether content has been committed.
+func (m *Memory) Exists(context.Context) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.committed, nil
+}
+
+// CreateWriterAt starts a new buffer, sized for size bytes when known.
+func (m *Memory) CreateWriterAt(_ context.Context, size int64) (io.WriterAt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = make([]byte, 0, max(size, 0))
+
+	return memoryWriter{m}, nil
+}
+
+// Commit replaces the content with the buffer.
+func (m *Memory) Commit(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data, m.pending = m.pending, nil
+	m.committed = true
+
+	return nil
+}
+
+// Abort drops the buffer.
+func (m *Memory) Abort(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = nil
+
+	return nil
+}
+
+// memoryWriter writes into the buffer of a Memory destination.
+type memoryWriter struct {
+	m *Memory
+}
+
+// WriteAt copies p into the buffer at off, growing it as needed.
+func (w memoryWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, gdlerrors.NewValidationError("offset", "must not be negative")
+	}
+
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+
+	end := off + int64(len(p))
+	if end > int64(len(w.m.pending)) {
+		if end > int64(cap(w.m.pending)) {
+			grown := make([]byte, end, max(end, 2*int64(cap(w.m.pending))))
+			copy(grown, w.m.pending)
+			w.m.pending = grown
+		} else {
+			w.m.pending = w.m.pending[:end]
+		}
+	}
+
+	return copy(w.m.pending[off:], p), nil
+}
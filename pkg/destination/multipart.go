@@ -0,0 +1,362 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// Defaults of the multipart destinations.
+const (
+	DefaultPartSize      = 16 * 1024 * 1024
+	DefaultBufferedParts = 8
+)
+
+// MultipartOptions configures a multipart destination.
+type MultipartOptions struct {
+	// PartSize is the size of the parts the content is uploaded in,
+	// DefaultPartSize when 0. It is raised to the store's minimum, and for
+	// content of known size to what keeps it within the store's part limit.
+	PartSize int64
+
+	// BufferedParts is how many parts are held in memory at once, being
+	// filled or uploaded, DefaultBufferedParts when 0. A write to another
+	// part waits until one of them is uploaded.
+	BufferedParts int
+}
+
+// partUpload is the upload of content in numbered parts, sent in any order.
+type partUpload interface {
+	// uploadPart uploads data as part n, counted from 1.
+	uploadPart(ctx context.Context, n int, data []byte) error
+
+	// complete makes parts 1 to parts, in order, the content.
+	complete(ctx context.Context, parts int) error
+
+	// abort drops the parts uploaded so far.
+	abort(ctx context.Context) error
+}
+
+// streamed holds the content of a multipart destination in memory a few
+// parts at a time: each part is uploaded as soon as it is filled, so the
+// content never touches the local disk, and Commit assembles the parts.
+type streamed struct {
+	location string
+	maxParts int
+	partSize int64
+	buffered int
+	begin    func(ctx context.Context) (partUpload, error)
+	attempt  *partWriter
+}
+
+// newStreamed returns the streaming of location, started with begin, in at
+// most maxParts parts of at least minPartSize bytes.
+func newStreamed(location string, maxParts int, minPartSize int64, opts *MultipartOptions,
+	begin func(context.Context) (partUpload, error),
+) streamed {
+	s := streamed{
+		location: location,
+		maxParts: maxParts,
+		partSize: DefaultPartSize,
+		buffered: DefaultBufferedParts,
+		begin:    begin,
+	}
+
+	if opts != nil && opts.PartSize > 0 {
+		s.partSize = opts.PartSize
+	}
+	if opts != nil && opts.BufferedParts > 0 {
+		s.buffered = opts.BufferedParts
+	}
+	s.partSize = max(s.partSize, minPartSize)
+
+	return s
+}
+
+// CreateWriterAt drops an earlier attempt and starts an upload, in parts
+// large enough for size bytes to fit in the store's part limit.
+func (s *streamed) CreateWriterAt(ctx context.Context, size int64) (io.WriterAt, error) {
+	if err := s.Abort(ctx); err != nil {
+		return nil, err
+	}
+
+	upload, err := s.begin(ctx)
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("start upload", err, s.location)
+	}
+
+	partSize := s.partSize
+	if size > 0 {
+		partSize = max(partSize, (size+int64(s.maxParts)-1)/int64(s.maxParts))
+	}
+
+	s.attempt = &partWriter{
+		ctx:      ctx,
+		location: s.location,
+		upload:   upload,
+		size:     size,
+		partSize: partSize,
+		maxParts: s.maxParts,
+		slots:    make(chan struct{}, s.buffered),
+		parts:    make(map[int]*bufferedPart),
+		uploaded: make(map[int]bool),
+	}
+
+	return s.attempt, nil
+}
+
+// PartSize returns the size of the parts of the current attempt.
+func (s *streamed) PartSize() int64 {
+	if s.attempt != nil {
+		return s.attempt.partSize
+	}
+
+	return s.partSize
+}
+
+// Commit uploads the last part and assembles the parts into the content. A
+// failed Commit leaves the attempt for Abort to drop.
+func (s *streamed) Commit(ctx context.Context) error {
+	if s.attempt == nil {
+		return gdlerrors.NewStorageError("commit", errors.New("no upload in progress"), s.location)
+	}
+
+	if err := s.attempt.finish(ctx); err != nil {
+		return err
+	}
+
+	s.attempt = nil
+
+	return nil
+}
+
+// Abort drops the parts of the current attempt.
+func (s *streamed) Abort(ctx context.Context) error {
+	if s.attempt == nil {
+		return nil
+	}
+
+	attempt := s.attempt
+	s.attempt = nil
+
+	if err := attempt.abort(ctx); err != nil {
+		return gdlerrors.NewStorageError("abort upload", err, s.location)
+	}
+
+	return nil
+}
+
+// bufferedPart is a part being filled.
+type bufferedPart struct {
+	data   []byte
+	filled int64 // Bytes written
+	end    int64 // End of the furthest write
+}
+
+// partWriter is the io.WriterAt of an attempt: it collects writes into
+// parts and uploads each part once it is full. At most cap(slots) parts are
+// held at once.
+type partWriter struct {
+	ctx      context.Context
+	location string
+	upload   partUpload
+	size     int64
+	partSize int64
+	maxParts int
+	slots    chan struct{}
+	uploads  sync.WaitGroup
+
+	mu       sync.Mutex
+	parts    map[int]*bufferedPart
+	uploaded map[int]bool
+	err      error // First failed upload
+}
+
+// WriteAt copies p into the parts it covers, uploading those it fills.
+func (w *partWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, gdlerrors.NewValidationError("offset", "must not be negative")
+	}
+
+	if w.size >= 0 && off+int64(len(p)) > w.size {
+		return 0, gdlerrors.NewValidationError("offset", "write past the end of the content")
+	}
+
+	written := 0
+
+	for written < len(p) {
+		pos := off + int64(written)
+		n := int(pos/w.partSize) + 1
+
+		part, err := w.part(n)
+		if err != nil {
+			return written, err
+		}
+
+		w.mu.Lock()
+		within := pos - int64(n-1)*w.partSize
+		c := copy(part.data[within:], p[written:])
+		part.filled += int64(c)
+		part.end = max(part.end, within+int64(c))
+
+		full := part.filled == int64(len(part.data))
+		if full {
+			delete(w.parts, n)
+			w.uploaded[n] = true
+		}
+		w.mu.Unlock()
+
+		written += c
+
+		if full {
+			w.send(n, part.data)
+		}
+	}
+
+	return written, nil
+}
+
+// part returns the buffer of part n, waiting for room to hold it when it is
+// not buffered yet.
+func (w *partWriter) part(n int) (*bufferedPart, error) {
+	if n > w.maxParts {
+		return nil, gdlerrors.NewStorageError("write",
+			fmt.Errorf("content exceeds %d parts of %d bytes", w.maxParts, w.partSize), w.location)
+	}
+
+	w.mu.Lock()
+	part, err := w.buffered(n)
+	w.mu.Unlock()
+
+	if part != nil || err != nil {
+		return part, err
+	}
+
+	select {
+	case w.slots <- struct{}{}:
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Another write may have started the part while this one waited
+	if part, err = w.buffered(n); part != nil || err != nil {
+		<-w.slots
+		return part, err
+	}
+
+	length := w.partSize
+	if w.size >= 0 {
+		length = min(length, w.size-int64(n-1)*w.partSize)
+	}
+
+	part = &bufferedPart{data: make([]byte, length)}
+	w.parts[n] = part
+
+	return part, nil
+}
+
+// buffered returns the buffer of part n, nil if it has none yet, or why it
+// cannot be written. w.mu must be held.
+func (w *partWriter) buffered(n int) (*bufferedPart, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	if w.uploaded[n] {
+		return nil, gdlerrors.NewStorageError("write",
+			fmt.Errorf("part %d was already uploaded", n), w.location)
+	}
+
+	return w.parts[n], nil
+}
+
+// send uploads part n in the background and frees its room once done.
+func (w *partWriter) send(n int, data []byte) {
+	w.uploads.Add(1)
+
+	go func() {
+		defer w.uploads.Done()
+		defer func() { <-w.slots }()
+
+		if err := w.upload.uploadPart(w.ctx, n, data); err != nil {
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = gdlerrors.NewStorageError("upload part", err, w.location)
+			}
+			w.mu.Unlock()
+		}
+	}()
+}
+
+// finish waits for the uploads, sends the last part and completes the
+// upload. When the size is unknown, the last part is sent as far as it was
+// written; every other part must be full.
+func (w *partWriter) finish(ctx context.Context) error {
+	w.uploads.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	total := 1
+	if w.size >= 0 {
+		total = max(int((w.size+w.partSize-1)/w.partSize), 1)
+	} else {
+		for n := range w.uploaded {
+			total = max(total, n)
+		}
+		for n := range w.parts {
+			total = max(total, n)
+		}
+	}
+
+	var last []byte
+
+	for n := 1; n <= total; n++ {
+		if w.uploaded[n] {
+			continue
+		}
+
+		part := w.parts[n]
+
+		switch {
+		case n == total && part == nil && w.size <= 0:
+			// Empty content is a single empty part
+			last = []byte{}
+		case n == total && part != nil && w.size < 0 && part.filled == part.end:
+			last = part.data[:part.end]
+		default:
+			return gdlerrors.NewStorageError("commit",
+				fmt.Errorf("part %d of %d is incomplete", n, total), w.location)
+		}
+	}
+
+	if last != nil {
+		if err := w.upload.uploadPart(ctx, total, last); err != nil {
+			return gdlerrors.NewStorageError("upload part", err, w.location)
+		}
+	}
+
+	if err := w.upload.complete(ctx, total); err != nil {
+		return gdlerrors.NewStorageError("complete upload", err, w.location)
+	}
+
+	return nil
+}
+
+// abort waits for the uploads in progress and drops the parts.
+func (w *partWriter) abort(ctx context.Context) error {
+	w.uploads.Wait()
+
+	return w.upload.abort(ctx)
+}
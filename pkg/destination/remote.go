@@ -0,0 +1,79 @@
+package destination
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// staged holds the content of a remote destination in a local part file
+// until Commit uploads it. The part file is named after the remote location,
+// so an interrupted download resumes from it.
+type staged struct {
+	location string
+	part     partFile
+	upload   func(ctx context.Context, content *os.File, size int64) error
+}
+
+// newStaged returns the staging of location in dir, the system's temporary
+// directory when empty.
+func newStaged(location, dir string, upload func(context.Context, *os.File, int64) error) staged {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	sum := sha256.Sum256([]byte(location))
+	name := "gdl-" + hex.EncodeToString(sum[:8]) + PartSuffix
+
+	return staged{location: location, part: partFile{path: filepath.Join(dir, name)}, upload: upload}
+}
+
+// CreateWriterAt opens the local part file.
+func (s *staged) CreateWriterAt(context.Context, int64) (io.WriterAt, error) {
+	return s.part.open()
+}
+
+// Commit uploads the part file and deletes it.
+func (s *staged) Commit(ctx context.Context) error {
+	if err := s.part.close(); err != nil {
+		return err
+	}
+
+	// #nosec G304 -- the part file of this destination
+	content, err := os.Open(s.part.path)
+	if err != nil {
+		return gdlerrors.NewStorageError("open part file", err, s.part.path)
+	}
+	defer func() { _ = content.Close() }()
+
+	info, err := content.Stat()
+	if err != nil {
+		return gdlerrors.NewStorageError("stat part file", err, s.part.path)
+	}
+
+	if err := s.upload(ctx, content, info.Size()); err != nil {
+		return gdlerrors.NewStorageError("upload", err, s.location)
+	}
+
+	return s.part.remove()
+}
+
+// Abort deletes the local part file.
+func (s *staged) Abort(context.Context) error {
+	return s.part.remove()
+}
+
+// Written returns the size of the local part file.
+func (s *staged) Written(context.Context) (int64, error) {
+	return s.part.size()
+}
+
+// Suspend closes the local part file and keeps it.
+func (s *staged) Suspend(context.Context) error {
+	return s.part.close()
+}
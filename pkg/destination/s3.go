@@ -0,0 +1,78 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// S3Client is the part of *s3.Client an S3 destination uses.
+type S3Client interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3 stores a download in an Amazon S3 (or S3-compatible) object. The
+// content is staged in a local file and uploaded with a single PutObject on
+// Commit, so the object is replaced as a whole; that limits it to 5 GB.
+type S3 struct {
+	staged
+
+	client S3Client
+	bucket string
+	key    string
+}
+
+// NewS3 returns the destination for the object key in bucket. The content is
+// staged in stagingDir, the system's temporary directory when empty.
+func NewS3(client S3Client, bucket, key, stagingDir string) *S3 {
+	d := &S3{client: client, bucket: bucket, key: key}
+	d.staged = newStaged("s3://"+bucket+"/"+key, stagingDir, d.put)
+
+	return d
+}
+
+// Exists reports whether the object exists.
+func (d *S3) Exists(ctx context.Context) (bool, error) {
+	return s3Exists(ctx, d.client.HeadObject, d.bucket, d.key, d.location)
+}
+
+// s3Exists reports whether the object key in bucket exists, asking with head.
+func s3Exists(
+	ctx context.Context,
+	head func(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error),
+	bucket, key, location string,
+) (bool, error) {
+	_, err := head(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, gdlerrors.NewStorageError("exists", err, location)
+	}
+
+	return true, nil
+}
+
+// put uploads content as the object.
+func (d *S3) put(ctx context.Context, content *os.File, size int64) error {
+	_, err := d.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(d.bucket),
+		Key:           aws.String(d.key),
+		Body:          content,
+		ContentLength: aws.Int64(size),
+	})
+
+	return err
+}
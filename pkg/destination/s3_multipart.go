@@ -0,0 +1,139 @@
+package destination
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Part limits of S3 multipart uploads.
+const (
+	maxS3Parts    = 10000
+	minS3PartSize = 5 * 1024 * 1024
+)
+
+// S3MultipartClient is the part of *s3.Client an S3Multipart destination
+// uses.
+type S3MultipartClient interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// S3Multipart streams a download into an Amazon S3 (or S3-compatible)
+// object with a multipart upload. Parts are uploaded as they are filled and
+// only a few are held in memory at once, so objects of any size up to the
+// 5 TB limit are stored without local disk; the object only changes when
+// the upload is completed on Commit. Unlike S3 it cannot resume: a failed
+// download aborts the upload. Uploads cut short by a crash are not aborted
+// and are best cleaned up by a bucket lifecycle rule.
+type S3Multipart struct {
+	streamed
+
+	client S3MultipartClient
+	bucket string
+	key    string
+}
+
+// NewS3Multipart returns the destination for the object key in bucket,
+// uploaded in parts as opts sets, defaults when nil.
+func NewS3Multipart(client S3MultipartClient, bucket, key string, opts *MultipartOptions) *S3Multipart {
+	d := &S3Multipart{client: client, bucket: bucket, key: key}
+	d.streamed = newStreamed("s3://"+bucket+"/"+key, maxS3Parts, minS3PartSize, opts, d.begin)
+
+	return d
+}
+
+// Exists reports whether the object exists.
+func (d *S3Multipart) Exists(ctx context.Context) (bool, error) {
+	return s3Exists(ctx, d.client.HeadObject, d.bucket, d.key, d.location)
+}
+
+// begin creates a multipart upload of the object.
+func (d *S3Multipart) begin(ctx context.Context) (partUpload, error) {
+	out, err := d.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(d.key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Upload{client: d.client, bucket: d.bucket, key: d.key, id: out.UploadId}, nil
+}
+
+// s3Upload is a multipart upload in progress.
+type s3Upload struct {
+	client S3MultipartClient
+	bucket string
+	key    string
+	id     *string
+
+	mu    sync.Mutex
+	parts []s3types.CompletedPart
+}
+
+func (u *s3Upload) uploadPart(ctx context.Context, n int, data []byte) error {
+	// #nosec G115 -- n is at most maxS3Parts
+	number := aws.Int32(int32(n))
+
+	out, err := u.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(u.bucket),
+		Key:           aws.String(u.key),
+		UploadId:      u.id,
+		PartNumber:    number,
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	u.parts = append(u.parts, s3types.CompletedPart{ETag: out.ETag, PartNumber: number})
+	u.mu.Unlock()
+
+	return nil
+}
+
+func (u *s3Upload) complete(ctx context.Context, parts int) error {
+	u.mu.Lock()
+	completed := slices.Clone(u.parts)
+	u.mu.Unlock()
+
+	if len(completed) != parts {
+		return fmt.Errorf("%d of %d parts uploaded", len(completed), parts)
+	}
+
+	slices.SortFunc(completed, func(a, b s3types.CompletedPart) int {
+		return cmp.Compare(aws.ToInt32(a.PartNumber), aws.ToInt32(b.PartNumber))
+	})
+
+	_, err := u.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(u.key),
+		UploadId:        u.id,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+
+	return err
+}
+
+func (u *s3Upload) abort(ctx context.Context) error {
+	_, err := u.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(u.bucket),
+		Key:      aws.String(u.key),
+		UploadId: u.id,
+	})
+
+	return err
+}
@@ -0,0 +1,211 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// maxTeePartSize caps the part size of a Tee whose destinations have part
+// sizes without a small common multiple; downloads to it are not split.
+const maxTeePartSize = 1 << 50
+
+// Tee stores a download in several destinations in one pass, as
+// io.MultiWriter does for writers. Each destination fails on its own: one
+// that fails to open, write or commit is dropped and aborted while the
+// others go on. The download fails only when every destination has failed,
+// so Results tells which of them hold it.
+//
+// Example:
+//
+//	tee := destination.NewTee(destination.NewFile("disk.img"), destination.NewS3Multipart(client, "backups", "disk.img", nil))
+//	_, err := downloader.DownloadToDestination(ctx, url, tee, nil)
+//	results := tee.Results() // nil for each destination committed
+type Tee struct {
+	branches []*teeBranch
+
+	mu sync.Mutex // Guards the errors of the branches
+}
+
+// teeBranch is a destination of a Tee.
+type teeBranch struct {
+	dest types.Destination
+	w    io.WriterAt
+	err  error
+}
+
+// NewTee returns the destination writing to each of dests.
+func NewTee(dests ...types.Destination) *Tee {
+	t := &Tee{}
+	for _, dest := range dests {
+		t.branches = append(t.branches, &teeBranch{dest: dest})
+	}
+
+	return t
+}
+
+// Exists reports whether any of the destinations already holds content.
+func (t *Tee) Exists(ctx context.Context) (bool, error) {
+	for _, branch := range t.branches {
+		exists, err := branch.dest.Exists(ctx)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+
+	return false, nil
+}
+
+// CreateWriterAt starts an attempt in each destination. It fails only when
+// none of them could start one.
+func (t *Tee) CreateWriterAt(ctx context.Context, size int64) (io.WriterAt, error) {
+	var errs []error
+
+	for _, branch := range t.branches {
+		branch.w, branch.err = branch.dest.CreateWriterAt(ctx, size)
+		if branch.err != nil {
+			errs = append(errs, branch.err)
+		}
+	}
+
+	if len(errs) == len(t.branches) {
+		return nil, errors.Join(errs...)
+	}
+
+	return teeWriter{t}, nil
+}
+
+// PartSize returns the least common multiple of the part sizes of the
+// destinations stored in parts, so that pieces hold whole parts of each.
+func (t *Tee) PartSize() int64 {
+	size := int64(1)
+
+	for _, branch := range t.branches {
+		parted, ok := branch.dest.(types.PartedDestination)
+		if !ok || parted.PartSize() <= 0 {
+			continue
+		}
+
+		part := parted.PartSize()
+		a, b := size, part
+		for b != 0 {
+			a, b = b, a%b
+		}
+
+		if size/a > maxTeePartSize/part {
+			return maxTeePartSize
+		}
+		size = size / a * part
+	}
+
+	return size
+}
+
+// Commit commits the content to each destination still going and aborts
+// the others. It fails only when no destination holds the content; Results
+// tells which of them do.
+func (t *Tee) Commit(ctx context.Context) error {
+	var errs []error
+
+	for _, branch := range t.branches {
+		if err := t.failed(branch); err != nil {
+			_ = branch.dest.Abort(ctx)
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := branch.dest.Commit(ctx); err != nil {
+			t.fail(branch, err)
+			_ = branch.dest.Abort(ctx)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == len(t.branches) {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// Abort discards the attempt in each destination.
+func (t *Tee) Abort(ctx context.Context) error {
+	var errs []error
+
+	for _, branch := range t.branches {
+		if err := branch.dest.Abort(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Results returns, in the order the destinations were given, why each of
+// them failed in the last attempt, nil for those that took every write.
+func (t *Tee) Results() []error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	results := make([]error, len(t.branches))
+	for i, branch := range t.branches {
+		results[i] = branch.err
+	}
+
+	return results
+}
+
+// failed returns why branch failed, nil if it has not.
+func (t *Tee) failed(branch *teeBranch) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return branch.err
+}
+
+// fail drops branch for err, unless it already failed.
+func (t *Tee) fail(branch *teeBranch, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if branch.err == nil {
+		branch.err = err
+	}
+}
+
+// teeWriter writes to the destinations of a Tee.
+type teeWriter struct {
+	t *Tee
+}
+
+// WriteAt writes p at off to each destination still going. It fails only
+// when every destination has failed.
+func (w teeWriter) WriteAt(p []byte, off int64) (int, error) {
+	var errs []error
+
+	for _, branch := range w.t.branches {
+		if err := w.t.failed(branch); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		n, err := branch.w.WriteAt(p, off)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+
+		if err != nil {
+			w.t.fail(branch, err)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == len(w.t.branches) {
+		return 0, errors.Join(errs...)
+	}
+
+	return len(p), nil
+}
@@ -2,12 +2,28 @@
 package errors
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxResponseBodySize is how much of an HTTP error response body is kept
+	// in DownloadError.ResponseBody.
+	MaxResponseBodySize = 4 << 10
+
+	// maxServerMessageLength bounds the server message put in Details.
+	maxServerMessageLength = 300
 )
 
 // Sentinel errors for common download scenarios.
@@ -26,6 +42,49 @@ var (
 
 	// ErrNetworkError is returned for general network-related errors during download.
 	ErrNetworkError = errors.New("network error occurred")
+
+	// ErrTimeout is returned when a connection, request or transfer times out.
+	ErrTimeout = errors.New("operation timed out")
+
+	// ErrAuthenticationFailed is returned when the server rejects the request's
+	// credentials or denies access (HTTP 401 or 403).
+	ErrAuthenticationFailed = errors.New("authentication failed")
+
+	// ErrChecksumMismatch is returned when downloaded data does not match its
+	// expected size, digest or signature.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrCircuitOpen is returned when requests to a host are rejected because its
+	// circuit breaker is open after repeated failures.
+	ErrCircuitOpen = errors.New("circuit breaker open")
+
+	// ErrTooSlow is returned when a transfer is aborted because its speed stayed
+	// below the configured minimum, or no data arrived, for too long.
+	ErrTooSlow = errors.New("transfer too slow")
+
+	// ErrRangeIgnored is returned when a server answers a range request with the
+	// whole file or with a different range than the one requested.
+	ErrRangeIgnored = errors.New("server ignored range request")
+
+	// ErrQuotaExceeded is returned when a download would take a directory over
+	// its size quota and the quota policy does not allow making room.
+	ErrQuotaExceeded = errors.New("directory quota exceeded")
+
+	// ErrSignatureMismatch is returned when a downloaded file does not match
+	// its detached signature or is not signed by a key in the keyring.
+	ErrSignatureMismatch = errors.New("signature verification failed")
+
+	// ErrResponseTooLarge is returned when a response body is larger than the
+	// size limit set for it, such as Options.MaxInMemorySize.
+	ErrResponseTooLarge = errors.New("response exceeds size limit")
+
+	// ErrScanFailed is returned when a downloaded file is flagged by a virus or
+	// malware scanner, or cannot be scanned.
+	ErrScanFailed = errors.New("malware scan failed")
+
+	// ErrRemoteChanged is returned when a partial download cannot be resumed
+	// because the file on the server changed since it was started.
+	ErrRemoteChanged = errors.New("remote file changed")
 )
 
 // ErrorCode represents different types of errors that can occur during downloads.
@@ -89,6 +148,12 @@ const (
 
 	// CodeStorageError represents errors related to storage operations.
 	CodeStorageError
+
+	// CodeCircuitOpen represents requests rejected by an open circuit breaker.
+	CodeCircuitOpen
+
+	// CodeScanFailed represents downloads flagged or not cleared by a malware scan.
+	CodeScanFailed
 )
 
 // String returns a string representation of the error code.
@@ -130,6 +195,10 @@ func (c ErrorCode) String() string {
 		return "validation_error"
 	case CodeStorageError:
 		return "storage_error"
+	case CodeCircuitOpen:
+		return "circuit_open"
+	case CodeScanFailed:
+		return "scan_failed"
 	default:
 		return unknownValue
 	}
@@ -166,6 +235,14 @@ type DownloadError struct {
 	// BytesTransferred indicates how many bytes were successfully transferred
 	// before the error occurred.
 	BytesTransferred int64
+
+	// RetryAfter is the delay requested by the server through a Retry-After
+	// header, if any. Retry logic waits at least this long before the next attempt.
+	RetryAfter time.Duration
+
+	// ResponseBody holds the start of the body of an HTTP error response
+	// (at most MaxResponseBodySize bytes), which often explains the error.
+	ResponseBody string
 }
 
 // Error implements the error interface for DownloadError.
@@ -204,6 +281,16 @@ func (e *DownloadError) Is(target error) bool {
 		return errors.Is(target, ErrInsufficientSpace)
 	case CodeNetworkError:
 		return errors.Is(target, ErrNetworkError)
+	case CodeTimeout:
+		return errors.Is(target, ErrTimeout)
+	case CodeAuthenticationFailed:
+		return errors.Is(target, ErrAuthenticationFailed)
+	case CodeCorruptedData:
+		return errors.Is(target, ErrChecksumMismatch)
+	case CodeCircuitOpen:
+		return errors.Is(target, ErrCircuitOpen)
+	case CodeScanFailed:
+		return errors.Is(target, ErrScanFailed)
 	}
 
 	return false
@@ -266,6 +353,10 @@ func FromHTTPStatus(statusCode int, url string) *DownloadError {
 		code = CodeFileNotFound
 		message = "File not found on server"
 		retryable = false
+	case statusCode == 429:
+		code = CodeClientError
+		message = "Too many requests (HTTP 429)"
+		retryable = true
 	case statusCode == 401 || statusCode == 403:
 		code = CodeAuthenticationFailed
 		message = "Authentication or authorization failed"
@@ -289,6 +380,97 @@ func FromHTTPStatus(statusCode int, url string) *DownloadError {
 	}
 }
 
+// FromHTTPResponse creates a DownloadError for an unexpected HTTP response,
+// as FromHTTPStatus does, and keeps the start of its body in ResponseBody. A
+// message found in the body, such as the "message" or "error" field of a JSON
+// error document, is put in Details. The body is read but not closed.
+func FromHTTPResponse(resp *http.Response, url string) *DownloadError {
+	downloadErr := FromHTTPStatus(resp.StatusCode, url)
+
+	if resp.Body == nil || (resp.Request != nil && resp.Request.Method == http.MethodHead) {
+		return downloadErr
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseBodySize+1))
+	if err != nil && len(body) == 0 {
+		return downloadErr
+	}
+
+	truncated := len(body) > MaxResponseBodySize
+	if truncated {
+		body = body[:MaxResponseBodySize]
+	}
+
+	text := strings.TrimSpace(strings.ToValidUTF8(string(body), "\uFFFD"))
+	if text == "" {
+		return downloadErr
+	}
+
+	if truncated {
+		text += "…"
+	}
+
+	downloadErr.ResponseBody = text
+	if message := serverMessage(resp.Header.Get("Content-Type"), body); message != "" {
+		downloadErr.Details = "Server message: " + message
+	}
+
+	return downloadErr
+}
+
+// serverMessage picks the explanation out of an error response body: a
+// message field of a JSON document, the <Message> of an S3-style XML error,
+// or the first line of plain text. HTML pages yield nothing.
+func serverMessage(contentType string, body []byte) string {
+	contentType = strings.ToLower(contentType)
+	trimmed := bytes.TrimSpace(body)
+
+	var message string
+	switch {
+	case strings.Contains(contentType, "json") || bytes.HasPrefix(trimmed, []byte("{")):
+		var document map[string]any
+		if json.Unmarshal(trimmed, &document) == nil {
+			message = jsonMessage(document)
+		}
+	case strings.Contains(contentType, "xml") || bytes.HasPrefix(trimmed, []byte("<?xml")):
+		if _, rest, found := bytes.Cut(trimmed, []byte("<Message>")); found {
+			if text, _, found := bytes.Cut(rest, []byte("</Message>")); found {
+				message = string(text)
+			}
+		}
+	case strings.Contains(contentType, "html") || bytes.HasPrefix(trimmed, []byte("<")):
+	default:
+		line, _, _ := bytes.Cut(trimmed, []byte("\n"))
+		message = string(line)
+	}
+
+	message = strings.Join(strings.Fields(strings.ToValidUTF8(message, "\uFFFD")), " ")
+	if runes := []rune(message); len(runes) > maxServerMessageLength {
+		message = string(runes[:maxServerMessageLength]) + "…"
+	}
+
+	return message
+}
+
+// jsonMessage returns the first message field of a JSON error document,
+// looking into a nested "error" object as Google and GitHub APIs use.
+func jsonMessage(document map[string]any) string {
+	for _, key := range []string{"message", "error_description", "error", "detail", "title", "msg"} {
+		switch value := document[key].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case map[string]any:
+			if message := jsonMessage(value); message != "" {
+				return message
+			}
+		}
+	}
+
+	return ""
+}
+
 // isRetryableByCode determines if an error code represents a retryable condition.
 func isRetryableByCode(code ErrorCode) bool {
 	switch code {
@@ -298,7 +480,7 @@ func isRetryableByCode(code ErrorCode) bool {
 		CodeFileNotFound, CodeAuthenticationFailed, CodeClientError,
 		CodeCancelled, CodeCorruptedData, CodeInvalidPath,
 		CodePluginError, CodeConfigError, CodeValidationError,
-		CodeStorageError:
+		CodeStorageError, CodeCircuitOpen, CodeScanFailed:
 		return false
 	case CodeInsufficientSpace:
 		return false // Usually not retryable without user intervention
@@ -391,6 +573,77 @@ func GetErrorCode(err error) ErrorCode {
 	return CodeUnknown
 }
 
+// StatusCode returns the HTTP status code of the response that caused err, or
+// 0 if err did not come from an HTTP response.
+func StatusCode(err error) int {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.HTTPStatusCode
+	}
+
+	return 0
+}
+
+// IsNetworkError reports whether err is a connection, DNS, TLS or timeout
+// failure rather than an answer from the server.
+func IsNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrNetworkError) || errors.Is(err, ErrTimeout) {
+		return true
+	}
+
+	// A dial aborted by cancellation is not a network fault
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var (
+		opErr   *net.OpError
+		dnsErr  *net.DNSError
+		certErr *tls.CertificateVerificationError
+		netErr  net.Error
+	)
+
+	switch {
+	case errors.As(err, &opErr), errors.As(err, &dnsErr), errors.As(err, &certErr):
+		return true
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+
+	return false
+}
+
+// IsAuthError reports whether the server rejected the request's credentials
+// or denied access to the resource.
+func IsAuthError(err error) bool {
+	if errors.Is(err, ErrAuthenticationFailed) {
+		return true
+	}
+
+	switch StatusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusProxyAuthRequired:
+		return true
+	}
+
+	return false
+}
+
+// IsDiskFull reports whether err was caused by the destination running out
+// of space.
+func IsDiskFull(err error) bool {
+	return errors.Is(err, ErrInsufficientSpace) || errors.Is(err, syscall.ENOSPC)
+}
+
+// IsChecksumMismatch reports whether err means the downloaded data failed
+// verification against its expected size, digest or signature.
+func IsChecksumMismatch(err error) bool {
+	return errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrSignatureMismatch)
+}
+
 // NewInvalidPathError creates a DownloadError for invalid file path errors.
 // This is a convenience function for path-related errors in configuration,
 // storage, and file operations.
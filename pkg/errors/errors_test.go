@@ -3,8 +3,14 @@ package errors
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -28,6 +34,7 @@ func TestErrorCode_String(t *testing.T) {
 		{"CodeClientError", CodeClientError, "client_error"},
 		{"CodeCancelled", CodeCancelled, "cancelled"},
 		{"CodeCorruptedData", CodeCorruptedData, "corrupted_data"},
+		{"CodeScanFailed", CodeScanFailed, "scan_failed"},
 		{"Invalid code", ErrorCode(999), "unknown"},
 	}
 
@@ -178,6 +185,30 @@ func TestDownloadError_Is(t *testing.T) {
 			target:   ErrNetworkError,
 			expected: true,
 		},
+		{
+			name: "matches timeout error",
+			err: &DownloadError{
+				Code: CodeTimeout,
+			},
+			target:   ErrTimeout,
+			expected: true,
+		},
+		{
+			name: "matches authentication error",
+			err: &DownloadError{
+				Code: CodeAuthenticationFailed,
+			},
+			target:   ErrAuthenticationFailed,
+			expected: true,
+		},
+		{
+			name: "matches checksum mismatch",
+			err: &DownloadError{
+				Code: CodeCorruptedData,
+			},
+			target:   ErrChecksumMismatch,
+			expected: true,
+		},
 		{
 			name: "unknown code doesn't match",
 			err: &DownloadError{
@@ -347,6 +378,12 @@ func TestFromHTTPStatus(t *testing.T) {
 			expectedCode: CodeFileNotFound,
 			retryable:    false,
 		},
+		{
+			name:         "429 too many requests",
+			statusCode:   429,
+			expectedCode: CodeClientError,
+			retryable:    true,
+		},
 		{
 			name:         "401 unauthorized",
 			statusCode:   401,
@@ -404,6 +441,58 @@ func TestFromHTTPStatus(t *testing.T) {
 	}
 }
 
+func TestFromHTTPResponse(t *testing.T) {
+	long := strings.Repeat("x", MaxResponseBodySize+100)
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantDetails string
+		wantBody    string
+	}{
+		{"json message", http.MethodGet, "application/json", `{"message": "Bad credentials", "documentation_url": "https://example.com"}`,
+			"Server message: Bad credentials", `{"message": "Bad credentials", "documentation_url": "https://example.com"}`},
+		{"nested json error", http.MethodGet, "application/json; charset=utf-8", `{"error": {"code": 403, "message": "Quota   exceeded\nfor project"}}`,
+			"Server message: Quota exceeded for project", `{"error": {"code": 403, "message": "Quota   exceeded\nfor project"}}`},
+		{"oauth error", http.MethodGet, "", `{"error": "invalid_token", "error_description": "The token expired"}`,
+			"Server message: The token expired", `{"error": "invalid_token", "error_description": "The token expired"}`},
+		{"s3 xml", http.MethodGet, "application/xml", `<?xml version="1.0"?><Error><Code>AccessDenied</Code><Message>Request has expired</Message></Error>`,
+			"Server message: Request has expired", `<?xml version="1.0"?><Error><Code>AccessDenied</Code><Message>Request has expired</Message></Error>`},
+		{"plain text", http.MethodGet, "text/plain", "  rate limited, slow down\nsecond line\n", "Server message: rate limited, slow down", "rate limited, slow down\nsecond line"},
+		{"html page", http.MethodGet, "text/html", "<html><body>Forbidden</body></html>", "", "<html><body>Forbidden</body></html>"},
+		{"empty", http.MethodGet, "text/plain", "", "", ""},
+		{"head request", http.MethodHead, "text/plain", "ignored", "", ""},
+		{"truncated", http.MethodGet, "application/octet-stream", long, "Server message: " + strings.Repeat("x", maxServerMessageLength) + "…",
+			long[:MaxResponseBodySize] + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusForbidden,
+				Header:     http.Header{"Content-Type": []string{tt.contentType}},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+				Request:    &http.Request{Method: tt.method},
+			}
+
+			err := FromHTTPResponse(resp, "https://example.com/file")
+			if err.Code != CodeAuthenticationFailed || err.HTTPStatusCode != http.StatusForbidden {
+				t.Errorf("FromHTTPResponse() = %+v, want the FromHTTPStatus classification", err)
+			}
+
+			if err.Details != tt.wantDetails {
+				t.Errorf("Details = %q, want %q", err.Details, tt.wantDetails)
+			}
+
+			if err.ResponseBody != tt.wantBody {
+				t.Errorf("ResponseBody = %q, want %q", err.ResponseBody, tt.wantBody)
+			}
+		})
+	}
+}
+
 func TestIsRetryableByCode(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -573,6 +662,68 @@ func TestGetErrorCode(t *testing.T) {
 	}
 }
 
+func TestStatusCode(t *testing.T) {
+	if got := StatusCode(fmt.Errorf("batch: %w", FromHTTPStatus(503, "https://example.com"))); got != 503 {
+		t.Errorf("StatusCode() = %d, want 503", got)
+	}
+
+	if got := StatusCode(NewDownloadError(CodeNetworkError, "dial failed")); got != 0 {
+		t.Errorf("StatusCode() without a response = %d, want 0", got)
+	}
+
+	if got := StatusCode(errors.New("plain")); got != 0 {
+		t.Errorf("StatusCode() of a plain error = %d, want 0", got)
+	}
+}
+
+func TestErrorPredicates(t *testing.T) {
+	dnsErr := &url.Error{Op: "Get", URL: "https://nx.invalid", Err: &net.DNSError{Err: "no such host", Name: "nx.invalid"}}
+	noSpace := &os.PathError{Op: "write", Path: "/tmp/file", Err: syscall.ENOSPC}
+
+	tests := []struct {
+		name     string
+		err      error
+		network  bool
+		auth     bool
+		diskFull bool
+		checksum bool
+	}{
+		{name: "nil", err: nil},
+		{name: "plain", err: errors.New("something failed")},
+		{name: "dns", err: dnsErr, network: true},
+		{name: "wrapped dns", err: WrapError(dnsErr, CodeUnknown, "request failed"), network: true},
+		{name: "network code", err: NewDownloadError(CodeNetworkError, "connection reset"), network: true},
+		{name: "timeout code", err: NewDownloadError(CodeTimeout, "timed out"), network: true},
+		{name: "cancelled", err: context.Canceled},
+		{name: "cancelled dial", err: &net.OpError{Op: "dial", Net: "tcp", Err: context.Canceled}},
+		{name: "server error", err: FromHTTPStatus(500, "https://example.com")},
+		{name: "unauthorized", err: FromHTTPStatus(401, "https://example.com"), auth: true},
+		{name: "forbidden", err: fmt.Errorf("job 3: %w", FromHTTPStatus(403, "https://example.com")), auth: true},
+		{name: "proxy auth", err: FromHTTPStatus(407, "https://example.com"), auth: true},
+		{name: "insufficient space", err: NewDownloadError(CodeInsufficientSpace, "not enough space"), diskFull: true},
+		{name: "enospc", err: WrapError(noSpace, CodeStorageError, "write failed"), diskFull: true},
+		{name: "corrupted", err: NewDownloadError(CodeCorruptedData, "size mismatch"), checksum: true},
+		{name: "signature", err: WrapError(ErrSignatureMismatch, CodeCorruptedData, "bad signature"), checksum: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNetworkError(tt.err); got != tt.network {
+				t.Errorf("IsNetworkError() = %v, want %v", got, tt.network)
+			}
+			if got := IsAuthError(tt.err); got != tt.auth {
+				t.Errorf("IsAuthError() = %v, want %v", got, tt.auth)
+			}
+			if got := IsDiskFull(tt.err); got != tt.diskFull {
+				t.Errorf("IsDiskFull() = %v, want %v", got, tt.diskFull)
+			}
+			if got := IsChecksumMismatch(tt.err); got != tt.checksum {
+				t.Errorf("IsChecksumMismatch() = %v, want %v", got, tt.checksum)
+			}
+		})
+	}
+}
+
 func TestSentinelErrors(t *testing.T) {
 	// Test that sentinel errors are not nil and have meaningful messages
 	sentinelErrors := []struct {
@@ -583,6 +734,9 @@ func TestSentinelErrors(t *testing.T) {
 		{"ErrFileExists", ErrFileExists},
 		{"ErrInsufficientSpace", ErrInsufficientSpace},
 		{"ErrNetworkError", ErrNetworkError},
+		{"ErrTimeout", ErrTimeout},
+		{"ErrAuthenticationFailed", ErrAuthenticationFailed},
+		{"ErrChecksumMismatch", ErrChecksumMismatch},
 	}
 
 	for _, tt := range sentinelErrors {
@@ -106,6 +106,11 @@ func FormatWithDetails(err error) string {
 		builder.WriteString(fmt.Sprintf("HTTP Status: %d\n", downloadErr.HTTPStatusCode))
 	}
 
+	// Response body of an HTTP error
+	if downloadErr.ResponseBody != "" {
+		builder.WriteString(fmt.Sprintf("Response Body: %s\n", downloadErr.ResponseBody))
+	}
+
 	// Bytes Transferred
 	if downloadErr.BytesTransferred > 0 {
 		builder.WriteString(fmt.Sprintf("Bytes Transferred: %d\n", downloadErr.BytesTransferred))
@@ -182,6 +187,10 @@ func SuggestAction(err error) string {
 		return "Check your input values and try again."
 	case CodeStorageError:
 		return "Check storage configuration and availability."
+	case CodeCircuitOpen:
+		return "The host failed repeatedly. Wait for the cool-down to pass and try again."
+	case CodeScanFailed:
+		return "The file was flagged by a malware scan or could not be scanned. Do not use it unless you trust the source."
 	default:
 		return "Please try again or contact support."
 	}
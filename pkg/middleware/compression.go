@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// AcceptEncoding is the Accept-Encoding header RequestCompressionMiddleware
+// sends: the content codings it decodes.
+const AcceptEncoding = "gzip, deflate, zstd"
+
+// RequestCompressionMiddleware asks servers for a compressed response, as
+// curl --compressed does, and decodes gzip, deflate and zstd bodies as they
+// are read, so the download holds the uncompressed content. Decoded
+// responses lose their Content-Encoding and Content-Length headers, since
+// the decoded size is not known in advance; this includes HEAD responses,
+// so the download is not split into ranges of the compressed bytes.
+//
+// Requests that set their own Accept-Encoding, and range requests, are sent
+// as they are and their responses left alone.
+//
+// Example:
+//
+//	downloader.Use(middleware.RequestCompressionMiddleware())
+func RequestCompressionMiddleware() RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+				return next.RoundTrip(req)
+			}
+
+			req = req.Clone(req.Context())
+			req.Header.Set("Accept-Encoding", AcceptEncoding)
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return resp, err
+			}
+
+			encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+			if !decodable(encoding) {
+				return resp, nil
+			}
+
+			resp.Header.Del("Content-Encoding")
+			resp.Header.Del("Content-Length")
+			resp.ContentLength = -1
+			resp.Uncompressed = true
+
+			if req.Method != http.MethodHead && resp.Body != nil && resp.Body != http.NoBody {
+				resp.Body = &decodedBody{encoding: encoding, body: resp.Body}
+			}
+
+			return resp, nil
+		})
+	}
+}
+
+// decodable reports whether the middleware decodes a Content-Encoding.
+func decodable(encoding string) bool {
+	switch encoding {
+	case "gzip", "x-gzip", "deflate", "zstd":
+		return true
+	default:
+		return false
+	}
+}
+
+// decodedBody decodes a response body on its first read, so that a body
+// that is closed unread does not cost a decoder.
+type decodedBody struct {
+	encoding string
+	body     io.ReadCloser
+	reader   io.Reader
+	close    func()
+	err      error
+}
+
+// Read reads decoded content.
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.close, b.err = newDecoder(b.encoding, b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	return b.reader.Read(p)
+}
+
+// Close releases the decoder and closes the body.
+func (b *decodedBody) Close() error {
+	if b.close != nil {
+		b.close()
+	}
+
+	return b.body.Close()
+}
+
+// newDecoder returns a reader decoding r and a function releasing it.
+func newDecoder(encoding string, r io.Reader) (io.Reader, func(), error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		decoder, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decoder, func() { _ = decoder.Close() }, nil
+	case "deflate":
+		// "deflate" means zlib-wrapped data, but some servers send raw
+		// deflate; a zlib stream starts with a CMF byte of method 8
+		buffered := bufio.NewReader(r)
+		if header, err := buffered.Peek(2); err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			decoder, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, nil, err
+			}
+			return decoder, func() { _ = decoder.Close() }, nil
+		}
+		decoder := flate.NewReader(buffered)
+		return decoder, func() { _ = decoder.Close() }, nil
+	default:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decoder, decoder.Close, nil
+	}
+}
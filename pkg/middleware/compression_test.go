@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestRequestCompressionMiddleware(t *testing.T) {
+	content := strings.Repeat("compressible content ", 100)
+
+	encode := func(encoding string) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		case "zstd":
+			w, _ = zstd.NewWriter(&buf)
+		}
+		_, _ = w.Write([]byte(content))
+		_ = w.Close()
+		return buf.Bytes()
+	}
+
+	var accepted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header.Get("Accept-Encoding")
+
+		encoding := strings.TrimPrefix(r.URL.Path, "/")
+		if encoding == "identity" || accepted == "" || r.Header.Get("Range") != "" {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+
+		body := encode(encoding)
+		w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	transport := &http.Transport{DisableCompression: true}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{Transport: ChainRequestMiddleware(transport, RequestCompressionMiddleware())}
+
+	get := func(method, path string, header http.Header) (*http.Response, string) {
+		t.Helper()
+
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("reading %s failed: %v", path, err)
+		}
+
+		return resp, string(body)
+	}
+
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate", "zstd", "identity"} {
+		t.Run(encoding, func(t *testing.T) {
+			resp, body := get(http.MethodGet, "/"+encoding, nil)
+			if accepted != AcceptEncoding {
+				t.Errorf("Accept-Encoding = %q, want %q", accepted, AcceptEncoding)
+			}
+			if body != content {
+				t.Errorf("body = %q..., want the decoded content", body[:min(len(body), 20)])
+			}
+			if encoding != "identity" && (resp.Header.Get("Content-Encoding") != "" || resp.ContentLength != -1) {
+				t.Errorf("decoded response keeps Content-Encoding %q, length %d",
+					resp.Header.Get("Content-Encoding"), resp.ContentLength)
+			}
+		})
+	}
+
+	t.Run("head", func(t *testing.T) {
+		resp, _ := get(http.MethodHead, "/gzip", nil)
+		if resp.ContentLength != -1 || resp.Header.Get("Content-Length") != "" {
+			t.Errorf("HEAD keeps the compressed length %d", resp.ContentLength)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		_, body := get(http.MethodGet, "/gzip", http.Header{"Range": {"bytes=0-"}})
+		if accepted != "" || body != content {
+			t.Errorf("range request sent Accept-Encoding %q", accepted)
+		}
+	})
+
+	t.Run("own accept-encoding", func(t *testing.T) {
+		resp, _ := get(http.MethodGet, "/gzip", http.Header{"Accept-Encoding": {"gzip"}})
+		if accepted != "gzip" || resp.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("Accept-Encoding = %q, Content-Encoding = %q", accepted, resp.Header.Get("Content-Encoding"))
+		}
+	})
+}
@@ -0,0 +1,372 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// DefaultDiskCacheMaxSize is the size limit of a DiskCache created without one (1 GiB).
+const DefaultDiskCacheMaxSize int64 = 1 << 30
+
+const (
+	diskCacheMetaExt = ".meta"
+	diskCacheBodyExt = ".body"
+)
+
+// BodyStore is implemented by cache backends that keep a copy of downloaded
+// files, so cache hits can be served without downloading the file again.
+type BodyStore interface {
+	// StoreBody copies the file at path into the cache under key and returns
+	// the path of the stored copy.
+	StoreBody(key, path string) (string, error)
+
+	// BodyPath returns the path of the body stored under key.
+	BodyPath(key string) (string, bool)
+}
+
+// DiskCache is a CacheBackend that persists cached responses and downloaded
+// files in a directory. When the cache grows beyond its size limit the least
+// recently used entries are evicted. A TTL of zero or less never expires.
+type DiskCache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*diskCacheEntry
+	size    int64
+	now     func() time.Time
+}
+
+// diskCacheEntry tracks the on-disk footprint and last use of an entry.
+type diskCacheEntry struct {
+	metaSize   int64
+	bodySize   int64
+	lastAccess time.Time
+}
+
+// diskCacheRecord is the envelope stored in an entry's metadata file.
+type diskCacheRecord struct {
+	Expiry time.Time `json:"expiry,omitempty"`
+	Value  []byte    `json:"value"`
+}
+
+// NewDiskCache opens (creating if needed) a disk cache in dir. A maxSize of
+// zero or less uses DefaultDiskCacheMaxSize.
+func NewDiskCache(dir string, maxSize int64) (*DiskCache, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultDiskCacheMaxSize
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, gdlerrors.NewStorageError("create cache directory", err, dir)
+	}
+
+	dc := &DiskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: make(map[string]*diskCacheEntry),
+		now:     time.Now,
+	}
+
+	if err := dc.load(); err != nil {
+		return nil, err
+	}
+
+	return dc, nil
+}
+
+// load rebuilds the index from the files in the cache directory.
+func (dc *DiskCache) load() error {
+	files, err := os.ReadDir(dc.dir)
+	if err != nil {
+		return gdlerrors.NewStorageError("read cache directory", err, dc.dir)
+	}
+
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		name := file.Name()
+
+		switch {
+		case strings.HasSuffix(name, diskCacheMetaExt):
+			entry := dc.entry(strings.TrimSuffix(name, diskCacheMetaExt))
+			entry.metaSize = info.Size()
+
+			if info.ModTime().After(entry.lastAccess) {
+				entry.lastAccess = info.ModTime()
+			}
+		case strings.HasSuffix(name, diskCacheBodyExt):
+			dc.entry(strings.TrimSuffix(name, diskCacheBodyExt)).bodySize = info.Size()
+		default:
+			continue
+		}
+
+		dc.size += info.Size()
+	}
+
+	return nil
+}
+
+// entry returns the index entry for a file name, creating it if needed (lock held).
+func (dc *DiskCache) entry(name string) *diskCacheEntry {
+	entry, exists := dc.entries[name]
+	if !exists {
+		entry = &diskCacheEntry{}
+		dc.entries[name] = entry
+	}
+
+	return entry
+}
+
+// fileName maps a cache key to the base name of its files.
+func (dc *DiskCache) fileName(key string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
+
+func (dc *DiskCache) metaPath(name string) string {
+	return filepath.Join(dc.dir, name+diskCacheMetaExt)
+}
+
+func (dc *DiskCache) bodyPath(name string) string {
+	return filepath.Join(dc.dir, name+diskCacheBodyExt)
+}
+
+// Get returns the value stored under key and marks the entry as recently used.
+func (dc *DiskCache) Get(key string) ([]byte, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	name := dc.fileName(key)
+
+	entry, exists := dc.entries[name]
+	if !exists || entry.metaSize == 0 {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(dc.metaPath(name))
+	if err != nil {
+		dc.removeLocked(name)
+		return nil, false
+	}
+
+	var record diskCacheRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		dc.removeLocked(name)
+		return nil, false
+	}
+
+	now := dc.now()
+	if !record.Expiry.IsZero() && now.After(record.Expiry) {
+		dc.removeLocked(name)
+		return nil, false
+	}
+
+	entry.lastAccess = now
+	_ = os.Chtimes(dc.metaPath(name), now, now)
+
+	return record.Value, true
+}
+
+// Set stores value under key.
+func (dc *DiskCache) Set(key string, value []byte, ttl time.Duration) error {
+	record := diskCacheRecord{Value: value}
+	if ttl > 0 {
+		record.Expiry = dc.now().Add(ttl)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return gdlerrors.WrapError(err, gdlerrors.CodeStorageError, "marshal cache record")
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	name := dc.fileName(key)
+	if err := writeFileAtomic(dc.dir, dc.metaPath(name), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	entry := dc.entry(name)
+	dc.size += int64(len(data)) - entry.metaSize
+	entry.metaSize = int64(len(data))
+	entry.lastAccess = dc.now()
+
+	dc.evictLocked(name)
+
+	return nil
+}
+
+// StoreBody copies the file at path into the cache under key.
+func (dc *DiskCache) StoreBody(key, path string) (string, error) {
+	// #nosec G304 -- path is the destination of a completed download
+	src, err := os.Open(path)
+	if err != nil {
+		return "", gdlerrors.NewStorageError("open downloaded file", err, path)
+	}
+	defer func() { _ = src.Close() }()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", gdlerrors.NewStorageError("stat downloaded file", err, path)
+	}
+
+	if info.Size() > dc.maxSize {
+		return "", gdlerrors.NewValidationError("cache",
+			fmt.Sprintf("file of %d bytes exceeds the cache size limit of %d bytes", info.Size(), dc.maxSize))
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	name := dc.fileName(key)
+	bodyPath := dc.bodyPath(name)
+
+	if err := writeFileAtomic(dc.dir, bodyPath, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	}); err != nil {
+		return "", err
+	}
+
+	entry := dc.entry(name)
+	dc.size += info.Size() - entry.bodySize
+	entry.bodySize = info.Size()
+	entry.lastAccess = dc.now()
+
+	dc.evictLocked(name)
+
+	return bodyPath, nil
+}
+
+// BodyPath returns the path of the body stored under key.
+func (dc *DiskCache) BodyPath(key string) (string, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	name := dc.fileName(key)
+	if entry, exists := dc.entries[name]; !exists || entry.bodySize == 0 {
+		if _, err := os.Stat(dc.bodyPath(name)); err != nil {
+			return "", false
+		}
+	}
+
+	return dc.bodyPath(name), true
+}
+
+// Delete removes the entry stored under key.
+func (dc *DiskCache) Delete(key string) error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	dc.removeLocked(dc.fileName(key))
+
+	return nil
+}
+
+// Clear removes all entries.
+func (dc *DiskCache) Clear() error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	for name := range dc.entries {
+		dc.removeLocked(name)
+	}
+
+	return nil
+}
+
+// Size returns the total size of the cached files in bytes.
+func (dc *DiskCache) Size() int64 {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	return dc.size
+}
+
+// removeLocked deletes the files of an entry (lock held).
+func (dc *DiskCache) removeLocked(name string) {
+	entry, exists := dc.entries[name]
+	if !exists {
+		return
+	}
+
+	_ = os.Remove(dc.metaPath(name))
+	_ = os.Remove(dc.bodyPath(name))
+
+	dc.size -= entry.metaSize + entry.bodySize
+	delete(dc.entries, name)
+}
+
+// evictLocked removes least recently used entries until the cache fits its
+// size limit. The entry named keep is evicted last (lock held).
+func (dc *DiskCache) evictLocked(keep string) {
+	for dc.size > dc.maxSize {
+		oldest := ""
+
+		for name, entry := range dc.entries {
+			if name == keep {
+				continue
+			}
+
+			if oldest == "" || entry.lastAccess.Before(dc.entries[oldest].lastAccess) {
+				oldest = name
+			}
+		}
+
+		if oldest == "" {
+			oldest = keep
+		}
+
+		if _, exists := dc.entries[oldest]; !exists {
+			return
+		}
+
+		dc.removeLocked(oldest)
+	}
+}
+
+// writeFileAtomic writes a file through a temporary file in dir, so readers
+// never observe a partially written cache entry.
+func writeFileAtomic(dir, path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return gdlerrors.NewStorageError("create cache file", err, dir)
+	}
+
+	tmpPath := tmp.Name()
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+
+		return gdlerrors.NewStorageError("write cache file", err, path)
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return gdlerrors.NewStorageError("write cache file", err, path)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return gdlerrors.NewStorageError("store cache file", err, path)
+	}
+
+	return nil
+}
@@ -0,0 +1,451 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestDiskCache_SetGet(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	if _, found := cache.Get("missing"); found {
+		t.Error("Get() found a key that was never set")
+	}
+
+	if err := cache.Set("key", []byte("value"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	value, found := cache.Get("key")
+	if !found || string(value) != "value" {
+		t.Errorf("Get() = %q, %v, want %q, true", value, found, "value")
+	}
+
+	if err := cache.Delete("key"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if _, found := cache.Get("key"); found {
+		t.Error("Get() found a deleted key")
+	}
+
+	if cache.Size() != 0 {
+		t.Errorf("Size() = %d after delete, want 0", cache.Size())
+	}
+}
+
+func TestDiskCache_Expiry(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	if err := cache.Set("key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if _, found := cache.Get("key"); !found {
+		t.Fatal("Get() should find an entry before its TTL elapses")
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if _, found := cache.Get("key"); found {
+		t.Error("Get() should not return an expired entry")
+	}
+}
+
+func TestDiskCache_PersistsAcrossInstances(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	if err := cache.Set("key", []byte("value"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	reopened, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatalf("NewDiskCache() reopen error = %v", err)
+	}
+
+	if value, found := reopened.Get("key"); !found || string(value) != "value" {
+		t.Errorf("Get() after reopen = %q, %v, want %q, true", value, found, "value")
+	}
+
+	if reopened.Size() != cache.Size() {
+		t.Errorf("Size() after reopen = %d, want %d", reopened.Size(), cache.Size())
+	}
+}
+
+func TestDiskCache_StoreBody(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	src := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(src, []byte("payload"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := cache.StoreBody("key", src)
+	if err != nil {
+		t.Fatalf("StoreBody() error = %v", err)
+	}
+
+	if path, found := cache.BodyPath("key"); !found || path != stored {
+		t.Errorf("BodyPath() = %q, %v, want %q, true", path, found, stored)
+	}
+
+	data, err := os.ReadFile(stored)
+	if err != nil || string(data) != "payload" {
+		t.Errorf("stored body = %q, %v, want %q", data, err, "payload")
+	}
+
+	if _, found := cache.BodyPath("other"); found {
+		t.Error("BodyPath() found a body that was never stored")
+	}
+}
+
+func TestDiskCache_StoreBodyTooLarge(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 4)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	src := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(src, []byte("payload"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.StoreBody("key", src); err == nil {
+		t.Error("StoreBody() should reject a file larger than the cache")
+	}
+}
+
+func TestDiskCache_LRUEviction(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 64)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	now := time.Now()
+	cache.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	src := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(src, make([]byte, 30), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := cache.StoreBody(key, src); err != nil {
+			t.Fatalf("StoreBody(%q) error = %v", key, err)
+		}
+	}
+
+	// Touch "a" so "b" becomes the least recently used entry
+	cache.mu.Lock()
+	cache.entries[cache.fileName("a")].lastAccess = cache.now()
+	cache.mu.Unlock()
+
+	if _, err := cache.StoreBody("c", src); err != nil {
+		t.Fatalf("StoreBody(c) error = %v", err)
+	}
+
+	if _, found := cache.BodyPath("b"); found {
+		t.Error("least recently used entry should have been evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, found := cache.BodyPath(key); !found {
+			t.Errorf("entry %q should still be cached", key)
+		}
+	}
+
+	if cache.Size() > 64 {
+		t.Errorf("Size() = %d, want at most 64", cache.Size())
+	}
+}
+
+func TestCacheMiddleware_DiskRevalidation(t *testing.T) {
+	var etag atomic.Value
+	etag.Store(`"v1"`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := etag.Load().(string)
+		w.Header().Set("ETag", current)
+
+		if r.Header.Get("If-None-Match") == current {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}))
+	defer server.Close()
+
+	cache, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	var calls int32
+
+	handler := CacheMiddleware(cache, 0)(func(ctx context.Context, req *DownloadRequest) (*DownloadResponse, error) {
+		atomic.AddInt32(&calls, 1)
+
+		if err := os.WriteFile(req.Destination, []byte("content "+etag.Load().(string)), 0o600); err != nil {
+			return nil, err
+		}
+
+		return &DownloadResponse{Stats: &types.DownloadStats{
+			URL:       req.URL,
+			StartTime: time.Now(),
+			EndTime:   time.Now(),
+			Success:   true,
+		}}, nil
+	})
+
+	dir := t.TempDir()
+	download := func(name string) *DownloadResponse {
+		t.Helper()
+
+		resp, err := handler(context.Background(), &DownloadRequest{
+			URL:         server.URL + "/file",
+			Destination: filepath.Join(dir, name),
+		})
+		if err != nil {
+			t.Fatalf("download %s error = %v", name, err)
+		}
+
+		return resp
+	}
+
+	if resp := download("first"); resp.Cached {
+		t.Error("first download should not be served from cache")
+	}
+
+	resp := download("second")
+	if !resp.Cached {
+		t.Error("unchanged file should be served from cache")
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "second")); string(data) != `content "v1"` {
+		t.Errorf("cached copy = %q, want %q", data, `content "v1"`)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("handler called %d times, want 1", got)
+	}
+
+	etag.Store(`"v2"`)
+
+	if resp := download("third"); resp.Cached {
+		t.Error("changed file should be downloaded again")
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("handler called %d times, want 2", got)
+	}
+
+	// An existing destination is not overwritten from the cache without permission
+	if _, err := handler(context.Background(), &DownloadRequest{
+		URL:         server.URL + "/file",
+		Destination: filepath.Join(dir, "third"),
+	}); err == nil {
+		t.Error("restoring over an existing file without overwrite should fail")
+	}
+}
+
+// cachingHandler returns a disk-cached handler that writes body to the
+// destination, and a counter of the downloads it made.
+func cachingHandler(t *testing.T, body string) (Handler, *DiskCache, *int32) {
+	t.Helper()
+
+	cache, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	var calls int32
+	handler := CacheMiddleware(cache, 0)(func(ctx context.Context, req *DownloadRequest) (*DownloadResponse, error) {
+		atomic.AddInt32(&calls, 1)
+
+		if err := os.WriteFile(req.Destination, []byte(body), 0o600); err != nil {
+			return nil, err
+		}
+
+		return &DownloadResponse{Stats: &types.DownloadStats{
+			URL:       req.URL,
+			StartTime: time.Now(),
+			EndTime:   time.Now(),
+			Success:   true,
+		}}, nil
+	})
+
+	return handler, cache, &calls
+}
+
+// unchangedServer answers every request with a fixed ETag and every
+// revalidation with 304 Not Modified.
+func unchangedServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+}
+
+func TestCacheMiddleware_MissingBody(t *testing.T) {
+	server := unchangedServer()
+	defer server.Close()
+
+	handler, cache, calls := cachingHandler(t, "content")
+	dir := t.TempDir()
+	url := server.URL + "/file"
+
+	if _, err := handler(context.Background(), &DownloadRequest{URL: url, Destination: filepath.Join(dir, "first")}); err != nil {
+		t.Fatalf("first download error = %v", err)
+	}
+
+	bodyPath, ok := cache.BodyPath(generateCacheKey(&DownloadRequest{URL: url}))
+	if !ok {
+		t.Fatal("downloaded file was not cached")
+	}
+	if err := os.Remove(bodyPath); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	resp, err := handler(context.Background(), &DownloadRequest{URL: url, Destination: filepath.Join(dir, "second")})
+	if err != nil {
+		t.Fatalf("download with a missing cached file error = %v", err)
+	}
+	if resp.Cached {
+		t.Error("a missing cached file should be downloaded again")
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("handler called %d times, want 2", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "second")); string(data) != "content" {
+		t.Errorf("downloaded file = %q, want %q", data, "content")
+	}
+}
+
+func TestCacheMiddleware_CollisionPolicy(t *testing.T) {
+	server := unchangedServer()
+	defer server.Close()
+
+	handler, _, calls := cachingHandler(t, "content")
+	dir := t.TempDir()
+	url := server.URL + "/file"
+
+	if _, err := handler(context.Background(), &DownloadRequest{URL: url, Destination: filepath.Join(dir, "first")}); err != nil {
+		t.Fatalf("first download error = %v", err)
+	}
+
+	tests := []struct {
+		policy   string
+		wantErr  bool
+		want     string
+		cached   bool
+		skipped  bool
+		download bool
+	}{
+		{policy: types.CollisionFail, wantErr: true, want: "old"},
+		{policy: types.CollisionSkip, want: "old", cached: true, skipped: true},
+		{policy: types.CollisionOverwrite, want: "content", cached: true},
+		{policy: types.CollisionResume, want: "content", download: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			dest := filepath.Join(dir, tt.policy)
+			if err := os.WriteFile(dest, []byte("old"), 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			before := atomic.LoadInt32(calls)
+
+			resp, err := handler(context.Background(), &DownloadRequest{
+				URL:         url,
+				Destination: dest,
+				Options:     &types.DownloadOptions{CollisionPolicy: tt.policy},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if resp.Cached != tt.cached {
+					t.Errorf("Cached = %v, want %v", resp.Cached, tt.cached)
+				}
+				if resp.Stats.Skipped != tt.skipped {
+					t.Errorf("Skipped = %v, want %v", resp.Stats.Skipped, tt.skipped)
+				}
+			}
+			if downloaded := atomic.LoadInt32(calls) > before; downloaded != tt.download {
+				t.Errorf("downloaded = %v, want %v", downloaded, tt.download)
+			}
+			if data, _ := os.ReadFile(dest); string(data) != tt.want {
+				t.Errorf("destination = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheMiddleware_UsesRequestClient(t *testing.T) {
+	server := unchangedServer()
+	defer server.Close()
+
+	handler, _, _ := cachingHandler(t, "content")
+	dir := t.TempDir()
+
+	var viaClient int32
+	client := &http.Client{Transport: RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&viaClient, 1)
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	for _, name := range []string{"first", "second"} {
+		if _, err := handler(context.Background(), &DownloadRequest{
+			URL:         server.URL + "/file",
+			Destination: filepath.Join(dir, name),
+			Client:      client,
+		}); err != nil {
+			t.Fatalf("download %s error = %v", name, err)
+		}
+	}
+
+	if atomic.LoadInt32(&viaClient) == 0 {
+		t.Error("revalidation did not use the request's client")
+	}
+}
+
+func TestGenerateCacheKeyHeaderOrder(t *testing.T) {
+	headers := map[string]string{"A": "1", "B": "2", "C": "3", "D": "4"}
+	want := generateCacheKey(&DownloadRequest{URL: "http://example.com", Headers: headers})
+
+	for i := 0; i < 20; i++ {
+		if got := generateCacheKey(&DownloadRequest{URL: "http://example.com", Headers: headers}); got != want {
+			t.Fatalf("generateCacheKey() = %s, want %s", got, want)
+		}
+	}
+}
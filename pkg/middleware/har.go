@@ -0,0 +1,464 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+)
+
+// harTimeFormat is the ISO 8601 format of HAR timestamps.
+const harTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// HAROptions configures a HARRecorder.
+type HAROptions struct {
+	// Version is the version of gdl recorded as the creator of the log.
+	Version string
+
+	// ShowSecrets records the values of the Authorization,
+	// Proxy-Authorization, Cookie and Set-Cookie headers, and of cookies,
+	// instead of redacting them.
+	ShowSecrets bool
+}
+
+// HARRecorder records the HTTP transactions of a session in the HTTP Archive
+// (HAR 1.2) format read by browser devtools and HAR viewers: the request and
+// response headers, status, redirect targets, body sizes and timings of
+// every request, redirects included, in the order they started. Bodies are
+// not recorded.
+//
+// Example:
+//
+//	recorder := middleware.NewHARRecorder(nil)
+//	downloader.UseRequestMiddleware(recorder.Middleware())
+//	// ... download ...
+//	err := recorder.Save("session.har")
+type HARRecorder struct {
+	version     string
+	showSecrets bool
+
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+// NewHARRecorder returns an empty recorder.
+func NewHARRecorder(opts *HAROptions) *HARRecorder {
+	r := &HARRecorder{}
+	if opts != nil {
+		r.version = opts.Version
+		r.showSecrets = opts.ShowSecrets
+	}
+
+	return r
+}
+
+// Len returns the number of transactions recorded.
+func (r *HARRecorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.entries)
+}
+
+// harEntry is a transaction being recorded.
+type harEntry struct {
+	start    time.Time
+	request  *http.Request
+	wire     http.Header // The request headers as written, with those the transport adds
+	response *http.Response
+	err      error
+
+	// Times of the steps of the transaction, zero for those not taken
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	gotConn, wroteRequest     time.Time
+	firstByte, end            time.Time
+
+	serverIP   string
+	connection string
+	bodySize   int64
+}
+
+// Middleware returns request middleware recording every request it sends.
+func (r *HARRecorder) Middleware() RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return r.roundTrip(next, req)
+		})
+	}
+}
+
+// roundTrip sends req through next, recording it.
+func (r *HARRecorder) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	entry := &harEntry{start: time.Now(), request: req, wire: make(http.Header)}
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+
+	// at records the time of a step under the lock, keeping the first one
+	at := func(t *time.Time) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if t.IsZero() {
+			*t = time.Now()
+		}
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { at(&entry.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { at(&entry.dnsDone) },
+		ConnectStart: func(string, string) {
+			at(&entry.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			entry.connectDone = time.Now()
+		},
+		TLSHandshakeStart: func() { at(&entry.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { at(&entry.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			entry.gotConn = time.Now()
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				entry.serverIP = host
+			}
+			entry.connection = info.Conn.LocalAddr().String()
+		},
+		WroteHeaderField: func(key string, value []string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			entry.wire[key] = append(entry.wire[key], value...)
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { at(&entry.wroteRequest) },
+		GotFirstResponseByte: func() { at(&entry.firstByte) },
+	}
+
+	resp, err := next.RoundTrip(req.Clone(httptrace.WithClientTrace(req.Context(), trace)))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		entry.err = err
+		entry.end = time.Now()
+		return resp, err
+	}
+
+	entry.response = resp
+	resp.Body = &harBody{ReadCloser: resp.Body, recorder: r, entry: entry}
+
+	return resp, nil
+}
+
+// harBody counts the bytes of a response body and records the end of the
+// transaction when the body is closed.
+type harBody struct {
+	io.ReadCloser
+	recorder *HARRecorder
+	entry    *harEntry
+	n        int64
+}
+
+// Read reads from the body, counting the bytes.
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+
+	return n, err
+}
+
+// Close closes the body and records its size.
+func (b *harBody) Close() error {
+	err := b.ReadCloser.Close()
+
+	b.recorder.mu.Lock()
+	defer b.recorder.mu.Unlock()
+
+	if b.entry.end.IsZero() {
+		b.entry.end = time.Now()
+		b.entry.bodySize = b.n
+	}
+
+	return err
+}
+
+// Save writes the log to the file at path, replacing it.
+func (r *HARRecorder) Save(path string) error {
+	// #nosec G304 -- path is provided by the caller
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.WriteTo(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteTo writes the log as HAR JSON to w. Transactions whose response body
+// is still open are written with the part of their timings known so far.
+func (r *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	entries := make([]harJSONEntry, len(r.entries))
+	for i, entry := range r.entries {
+		entries[i] = r.entryJSON(entry)
+	}
+	r.mu.Unlock()
+
+	doc := harJSON{Log: harJSONLog{
+		Version: "1.2",
+		Creator: harJSONCreator{Name: "gdl", Version: r.version},
+		Entries: entries,
+	}}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(append(data, '\n'))
+
+	return int64(n), err
+}
+
+// HAR 1.2 documents, as far as gdl fills them in.
+type (
+	harJSON struct {
+		Log harJSONLog `json:"log"`
+	}
+
+	harJSONLog struct {
+		Version string         `json:"version"`
+		Creator harJSONCreator `json:"creator"`
+		Entries []harJSONEntry `json:"entries"`
+	}
+
+	harJSONCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	harJSONEntry struct {
+		StartedDateTime string          `json:"startedDateTime"`
+		Time            float64         `json:"time"`
+		Request         harJSONRequest  `json:"request"`
+		Response        harJSONResponse `json:"response"`
+		Cache           struct{}        `json:"cache"`
+		Timings         harJSONTimings  `json:"timings"`
+		ServerIPAddress string          `json:"serverIPAddress,omitempty"`
+		Connection      string          `json:"connection,omitempty"`
+		Error           string          `json:"_error,omitempty"`
+	}
+
+	harJSONRequest struct {
+		Method      string          `json:"method"`
+		URL         string          `json:"url"`
+		HTTPVersion string          `json:"httpVersion"`
+		Cookies     []harJSONCookie `json:"cookies"`
+		Headers     []harJSONPair   `json:"headers"`
+		QueryString []harJSONPair   `json:"queryString"`
+		HeadersSize int64           `json:"headersSize"`
+		BodySize    int64           `json:"bodySize"`
+	}
+
+	harJSONResponse struct {
+		Status      int             `json:"status"`
+		StatusText  string          `json:"statusText"`
+		HTTPVersion string          `json:"httpVersion"`
+		Cookies     []harJSONCookie `json:"cookies"`
+		Headers     []harJSONPair   `json:"headers"`
+		Content     harJSONContent  `json:"content"`
+		RedirectURL string          `json:"redirectURL"`
+		HeadersSize int64           `json:"headersSize"`
+		BodySize    int64           `json:"bodySize"`
+	}
+
+	harJSONContent struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimeType"`
+	}
+
+	harJSONPair struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	harJSONCookie struct {
+		Name     string `json:"name"`
+		Value    string `json:"value"`
+		Path     string `json:"path,omitempty"`
+		Domain   string `json:"domain,omitempty"`
+		HTTPOnly bool   `json:"httpOnly,omitempty"`
+		Secure   bool   `json:"secure,omitempty"`
+	}
+
+	harJSONTimings struct {
+		Blocked float64 `json:"blocked"`
+		DNS     float64 `json:"dns"`
+		Connect float64 `json:"connect"`
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+		SSL     float64 `json:"ssl"`
+	}
+)
+
+// entryJSON returns the HAR form of entry (must be called with the lock
+// held).
+func (r *HARRecorder) entryJSON(entry *harEntry) harJSONEntry {
+	req := entry.request
+
+	headers := entry.wire
+	if len(headers) == 0 {
+		headers = req.Header
+	}
+
+	bodySize := req.ContentLength
+	if bodySize < 0 {
+		bodySize = -1
+	}
+
+	url := req.URL.Redacted()
+	if r.showSecrets {
+		url = req.URL.String()
+	}
+
+	out := harJSONEntry{
+		StartedDateTime: entry.start.Format(harTimeFormat),
+		Request: harJSONRequest{
+			Method:      req.Method,
+			URL:         url,
+			HTTPVersion: req.Proto,
+			Cookies:     r.cookies(req.Cookies()),
+			Headers:     r.headers(headers),
+			QueryString: []harJSONPair{},
+			HeadersSize: -1,
+			BodySize:    bodySize,
+		},
+		Response: harJSONResponse{
+			Cookies:     []harJSONCookie{},
+			Headers:     []harJSONPair{},
+			Content:     harJSONContent{MimeType: "x-unknown"},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		ServerIPAddress: entry.serverIP,
+		Connection:      entry.connection,
+	}
+
+	for _, key := range sortedKeys(http.Header(req.URL.Query())) {
+		for _, value := range req.URL.Query()[key] {
+			out.Request.QueryString = append(out.Request.QueryString, harJSONPair{Name: key, Value: value})
+		}
+	}
+
+	if entry.err != nil {
+		out.Error = entry.err.Error()
+	}
+
+	if resp := entry.response; resp != nil {
+		out.Request.HTTPVersion = resp.Proto
+		out.Response.Status = resp.StatusCode
+		out.Response.StatusText = http.StatusText(resp.StatusCode)
+		out.Response.HTTPVersion = resp.Proto
+		out.Response.Cookies = r.cookies(resp.Cookies())
+		out.Response.Headers = r.headers(resp.Header)
+		out.Response.RedirectURL = resp.Header.Get("Location")
+		out.Response.Content.Size = entry.bodySize
+		if mimeType := resp.Header.Get("Content-Type"); mimeType != "" {
+			out.Response.Content.MimeType = mimeType
+		}
+		if !resp.Uncompressed {
+			out.Response.BodySize = entry.bodySize
+		}
+	}
+
+	out.Timings = harJSONTimings{
+		DNS:     millis(entry.dnsStart, entry.dnsDone),
+		Connect: millis(entry.connectStart, entry.connectDone),
+		SSL:     millis(entry.tlsStart, entry.tlsDone),
+		Send:    millis(entry.gotConn, entry.wroteRequest),
+		Wait:    millis(entry.wroteRequest, entry.firstByte),
+		Receive: millis(entry.firstByte, entry.end),
+	}
+
+	// Blocked is the time to get a connection less resolving and dialing
+	out.Timings.Blocked = millis(entry.start, entry.gotConn)
+	for _, step := range []float64{out.Timings.DNS, out.Timings.Connect} {
+		if out.Timings.Blocked >= 0 && step > 0 {
+			out.Timings.Blocked = max(math.Round((out.Timings.Blocked-step)*1000)/1000, 0)
+		}
+	}
+
+	// Time is the sum of the timings, of which connect already holds ssl
+	for _, step := range []float64{out.Timings.Blocked, out.Timings.DNS, out.Timings.Connect,
+		out.Timings.Send, out.Timings.Wait, out.Timings.Receive} {
+		if step > 0 {
+			out.Time += step
+		}
+	}
+	out.Time = math.Round(out.Time*1000) / 1000
+
+	return out
+}
+
+// headers returns header as HAR pairs in order, redacted unless
+// ShowSecrets is set.
+func (r *HARRecorder) headers(header http.Header) []harJSONPair {
+	pairs := []harJSONPair{}
+	for _, key := range sortedKeys(header) {
+		for _, value := range header[key] {
+			if !r.showSecrets {
+				value = redactHeader(key, value)
+			}
+			pairs = append(pairs, harJSONPair{Name: key, Value: value})
+		}
+	}
+
+	return pairs
+}
+
+// cookies returns cookies in HAR form, their values redacted unless
+// ShowSecrets is set.
+func (r *HARRecorder) cookies(cookies []*http.Cookie) []harJSONCookie {
+	out := []harJSONCookie{}
+	for _, cookie := range cookies {
+		value := cookie.Value
+		if !r.showSecrets {
+			value = "[redacted]"
+		}
+		out = append(out, harJSONCookie{
+			Name:     cookie.Name,
+			Value:    value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		})
+	}
+
+	return out
+}
+
+// millis returns the milliseconds from start to end, -1 when either did not
+// happen.
+func millis(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return -1
+	}
+
+	return float64(end.Sub(start).Microseconds()) / 1000
+}
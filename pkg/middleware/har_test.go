@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHARRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new?v=2", http.StatusFound)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+
+	recorder := NewHARRecorder(&HAROptions{Version: "1.2.3"})
+
+	client := server.Client()
+	client.Transport = ChainRequestMiddleware(client.Transport, recorder.Middleware())
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/old", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	// A request that fails is recorded with its error
+	_, _ = client.Get("http://127.0.0.1:1/unreachable")
+
+	if recorder.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", recorder.Len())
+	}
+
+	var out bytes.Buffer
+	if _, err := recorder.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if strings.Contains(out.String(), "s3cret") || strings.Contains(out.String(), "abc") {
+		t.Errorf("HAR shows secrets:\n%s", out.String())
+	}
+
+	var har struct {
+		Log struct {
+			Version string `json:"version"`
+			Creator struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"creator"`
+			Entries []struct {
+				Time    float64 `json:"time"`
+				Request struct {
+					Method      string              `json:"method"`
+					URL         string              `json:"url"`
+					Headers     []map[string]string `json:"headers"`
+					QueryString []map[string]string `json:"queryString"`
+				} `json:"request"`
+				Response struct {
+					Status      int    `json:"status"`
+					RedirectURL string `json:"redirectURL"`
+					Content     struct {
+						Size     int64  `json:"size"`
+						MimeType string `json:"mimeType"`
+					} `json:"content"`
+					Cookies []map[string]interface{} `json:"cookies"`
+				} `json:"response"`
+				Timings struct {
+					Connect float64 `json:"connect"`
+					Wait    float64 `json:"wait"`
+				} `json:"timings"`
+				ServerIPAddress string `json:"serverIPAddress"`
+				Error           string `json:"_error"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &har); err != nil {
+		t.Fatalf("HAR is not JSON: %v", err)
+	}
+
+	if har.Log.Version != "1.2" || har.Log.Creator.Name != "gdl" || har.Log.Creator.Version != "1.2.3" {
+		t.Errorf("log = %q by %q %q", har.Log.Version, har.Log.Creator.Name, har.Log.Creator.Version)
+	}
+
+	redirect, final, failed := har.Log.Entries[0], har.Log.Entries[1], har.Log.Entries[2]
+
+	if redirect.Response.Status != http.StatusFound || redirect.Response.RedirectURL != "/new?v=2" {
+		t.Errorf("redirect = %d to %q", redirect.Response.Status, redirect.Response.RedirectURL)
+	}
+	if redirect.Timings.Connect < 0 || redirect.Timings.Wait < 0 || redirect.ServerIPAddress != "127.0.0.1" {
+		t.Errorf("redirect timings = %+v, server %q", redirect.Timings, redirect.ServerIPAddress)
+	}
+
+	var authorization string
+	for _, header := range redirect.Request.Headers {
+		if header["name"] == "Authorization" {
+			authorization = header["value"]
+		}
+	}
+	if authorization != "Bearer [redacted]" {
+		t.Errorf("Authorization = %q", authorization)
+	}
+
+	if final.Request.URL != server.URL+"/new?v=2" || len(final.Request.QueryString) != 1 {
+		t.Errorf("final request = %q, query %v", final.Request.URL, final.Request.QueryString)
+	}
+	if final.Response.Status != http.StatusOK || final.Response.Content.Size != 11 ||
+		final.Response.Content.MimeType != "text/plain" || len(final.Response.Cookies) != 1 {
+		t.Errorf("final response = %+v", final.Response)
+	}
+	if final.Time <= 0 {
+		t.Errorf("final time = %v", final.Time)
+	}
+
+	if failed.Error == "" || failed.Response.Status != 0 {
+		t.Errorf("failed entry = %q, status %d", failed.Error, failed.Response.Status)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.har")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, out.Bytes()) {
+		t.Error("Save() wrote a different log than WriteTo()")
+	}
+}
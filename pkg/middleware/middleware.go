@@ -10,6 +10,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +35,11 @@ type DownloadRequest struct {
 	Headers     map[string]string
 	UserAgent   string
 	Metadata    map[string]interface{}
+
+	// Client is the HTTP client the download sends its requests with, carrying
+	// its proxy, TLS and DNS settings. Middleware that sends requests of its
+	// own, such as cache revalidation, uses it when set.
+	Client *http.Client
 }
 
 // DownloadResponse contains the download response information
@@ -127,6 +135,13 @@ type CachedResponse struct {
 	Headers  map[string][]string    `json:"headers"`
 	Metadata map[string]interface{} `json:"metadata"`
 	Cached   bool                   `json:"cached"`
+
+	// Validators recorded for revalidation with If-None-Match/If-Modified-Since
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// BodyPath references the cached copy of the downloaded file, if stored
+	BodyPath string `json:"body_path,omitempty"`
 }
 
 // RateLimiter interface for rate limiting
@@ -260,23 +275,67 @@ func MetricsMiddleware(collector MetricsCollector) Middleware {
 	}
 }
 
-// CacheMiddleware creates a cache middleware
+// revalidationTimeout bounds each revalidation or validator request of the
+// cache middleware.
+const revalidationTimeout = 30 * time.Second
+
+// errCachedBodyMissing reports that the cached copy of a download is gone,
+// e.g. evicted to meet a quota or deleted by the user.
+var errCachedBodyMissing = errors.New("cached body is missing")
+
+// CacheMiddleware creates a cache middleware. Revalidation requests go
+// through the download's own client (see DownloadRequest.Client), or a
+// default client when the request carries none.
 func CacheMiddleware(cache CacheBackend, ttl time.Duration) Middleware {
+	return CacheMiddlewareWithClient(cache, ttl, &http.Client{Timeout: revalidationTimeout})
+}
+
+// CacheMiddlewareWithClient creates a cache middleware that uses client for
+// revalidation requests of downloads that carry no client of their own. When
+// the backend also implements BodyStore, the downloaded file is kept in the
+// cache and a hit is served by copying it to the destination once the server
+// confirms it is unchanged via If-None-Match/If-Modified-Since. A cached file
+// that has gone missing is treated as a miss.
+func CacheMiddlewareWithClient(cache CacheBackend, ttl time.Duration, client *http.Client) Middleware {
+	bodyStore, storesBodies := cache.(BodyStore)
+
 	return func(next Handler) Handler {
 		return func(ctx context.Context, req *DownloadRequest) (*DownloadResponse, error) {
+			// Only plain GET downloads are cached
+			if !cacheable(req) {
+				return next(ctx, req)
+			}
+
 			// Generate cache key
 			cacheKey := generateCacheKey(req)
+			httpClient := revalidationClient(req, client)
 
 			// Try to get from cache first
 			if cachedData, found := cache.Get(cacheKey); found {
-				// Deserialize cached response
-				resp, err := deserializeResponse(cachedData)
-				if err == nil {
+				cached, err := decodeCachedResponse(cachedData)
+				if err != nil {
+					// If deserialization fails, log and continue with download
+					log.Printf("Warning: failed to deserialize cached response: %v", err)
+				} else if cached.BodyPath == "" {
 					// Successfully retrieved from cache
-					return resp, nil
+					return cached.toResponse()
+				} else if restoreAllowed(req) && revalidateCachedResponse(ctx, httpClient, req, cached) {
+					kept, err := restoreCachedBody(cached.BodyPath, req)
+					switch {
+					case errors.Is(err, errCachedBodyMissing):
+						log.Printf("Warning: cached file for %s is missing, downloading again", req.URL)
+						_ = cache.Delete(cacheKey)
+					case err != nil:
+						return nil, err
+					default:
+						resp, err := cached.toResponse()
+						if err == nil && kept {
+							resp.Stats.Skipped = true
+						}
+
+						return resp, err
+					}
 				}
-				// If deserialization fails, log and continue with download
-				log.Printf("Warning: failed to deserialize cached response: %v", err)
 			}
 
 			// Execute the download
@@ -287,8 +346,20 @@ func CacheMiddleware(cache CacheBackend, ttl time.Duration) Middleware {
 
 			// Cache the successful response
 			if resp != nil && resp.Stats != nil && resp.Stats.Success {
+				cached := newCachedResponse(resp)
+
+				if storesBodies && req.Destination != "" {
+					cached.ETag, cached.LastModified = responseValidators(ctx, httpClient, req, resp.Headers)
+
+					if bodyPath, err := bodyStore.StoreBody(cacheKey, req.Destination); err == nil {
+						cached.BodyPath = bodyPath
+					} else {
+						log.Printf("Warning: failed to cache downloaded file: %v", err)
+					}
+				}
+
 				// Serialize response for caching
-				if cachedData, err := serializeResponse(resp); err == nil {
+				if cachedData, err := json.Marshal(cached); err == nil {
 					if err := cache.Set(cacheKey, cachedData, ttl); err != nil {
 						log.Printf("Warning: failed to cache response: %v", err)
 					}
@@ -400,24 +471,218 @@ func TimeoutMiddleware(timeout time.Duration) Middleware {
 
 // Helper functions
 
+// cacheable reports whether the response to req may be cached: requests with
+// another method or a body are not.
+func cacheable(req *DownloadRequest) bool {
+	options := req.Options
+	if options == nil {
+		return true
+	}
+
+	return (options.Method == "" || strings.EqualFold(options.Method, http.MethodGet)) &&
+		options.Body == nil && options.BodyFile == ""
+}
+
 func generateCacheKey(req *DownloadRequest) string {
 	h := sha256.New()
 	h.Write([]byte(req.URL))
 	if req.UserAgent != "" {
 		h.Write([]byte(req.UserAgent))
 	}
-	for key, value := range req.Headers {
-		h.Write([]byte(key + ":" + value))
+	// Sort header names so equal requests always produce the same key
+	keys := make([]string, 0, len(req.Headers))
+	for key := range req.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h.Write([]byte(key + ":" + req.Headers[key]))
 	}
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
+// revalidationClient returns the client for the revalidation requests of req:
+// the download's own client, so that they use its proxy and TLS settings, or
+// fallback.
+func revalidationClient(req *DownloadRequest, fallback *http.Client) *http.Client {
+	if req.Client == nil {
+		return fallback
+	}
+
+	client := *req.Client
+	client.Timeout = revalidationTimeout
+
+	return &client
+}
+
+// revalidationRequest builds a HEAD request carrying the download's headers.
+func revalidationRequest(ctx context.Context, req *DownloadRequest) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodHead, req.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	if req.UserAgent != "" {
+		httpReq.Header.Set("User-Agent", req.UserAgent)
+	}
+
+	return httpReq, nil
+}
+
+// revalidateCachedResponse reports whether the server confirms that the
+// cached body is still current. Entries without validators are never fresh.
+func revalidateCachedResponse(ctx context.Context, client *http.Client, req *DownloadRequest, cached *CachedResponse) bool {
+	if cached.ETag == "" && cached.LastModified == "" {
+		return false
+	}
+
+	httpReq, err := revalidationRequest(ctx, req)
+	if err != nil {
+		return false
+	}
+	if cached.ETag != "" {
+		httpReq.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		httpReq.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return true
+	case resp.StatusCode != http.StatusOK:
+		return false
+	case cached.ETag != "":
+		// Servers ignoring conditional headers still expose the validator
+		return resp.Header.Get("ETag") == cached.ETag
+	default:
+		return resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == cached.LastModified
+	}
+}
+
+// responseValidators returns the ETag and Last-Modified of a download, taken
+// from the response headers or, when the handler did not report them, from a
+// HEAD request.
+func responseValidators(ctx context.Context, client *http.Client, req *DownloadRequest, headers map[string][]string) (string, string) {
+	header := http.Header(headers)
+	if etag, lastModified := header.Get("ETag"), header.Get("Last-Modified"); etag != "" || lastModified != "" {
+		return etag, lastModified
+	}
+
+	httpReq, err := revalidationRequest(ctx, req)
+	if err != nil {
+		return "", ""
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", ""
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", ""
+	}
+
+	return resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+}
+
+// restoreAllowed reports whether a cached body may be restored under the
+// request's collision policy. CollisionRename and CollisionResume over an
+// existing destination are left to the download, which picks the new name or
+// continues the file.
+func restoreAllowed(req *DownloadRequest) bool {
+	if req.Destination == "" || req.Options == nil {
+		return true
+	}
+
+	switch req.Options.CollisionPolicy {
+	case types.CollisionRename, types.CollisionResume:
+		_, err := os.Stat(req.Destination)
+		return os.IsNotExist(err)
+	default:
+		return true
+	}
+}
+
+// restoreCachedBody copies a cached body to the request's destination,
+// honouring its CollisionPolicy or, without one, OverwriteExisting. It reports
+// whether the existing destination was kept under CollisionSkip, and returns
+// errCachedBodyMissing when the cached file is gone.
+func restoreCachedBody(bodyPath string, req *DownloadRequest) (bool, error) {
+	if req.Destination == "" {
+		return false, nil
+	}
+
+	// #nosec G304 -- bodyPath is a file inside the cache directory
+	src, err := os.Open(bodyPath)
+	if os.IsNotExist(err) {
+		return false, errCachedBodyMissing
+	}
+	if err != nil {
+		return false, gdlerrors.NewStorageError("open cached file", err, bodyPath)
+	}
+	defer func() { _ = src.Close() }()
+
+	if _, err := os.Stat(req.Destination); err == nil {
+		options := req.Options
+		if options == nil {
+			options = &types.DownloadOptions{}
+		}
+
+		switch options.CollisionPolicy {
+		case types.CollisionSkip:
+			return true, nil
+		case types.CollisionOverwrite:
+		case "":
+			if !options.OverwriteExisting {
+				return false, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeFileExists,
+					"File already exists", fmt.Sprintf("File exists at: %s", req.Destination))
+			}
+		default:
+			return false, gdlerrors.NewDownloadErrorWithDetails(gdlerrors.CodeFileExists,
+				"File already exists", fmt.Sprintf("File exists at: %s", req.Destination))
+		}
+	}
+
+	// #nosec G304 -- destination is provided by the caller of the download
+	dst, err := os.OpenFile(req.Destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return false, gdlerrors.NewStorageError("create destination file", err, req.Destination)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return false, gdlerrors.NewStorageError("copy cached file", err, req.Destination)
+	}
+
+	if err := dst.Close(); err != nil {
+		return false, gdlerrors.NewStorageError("copy cached file", err, req.Destination)
+	}
+
+	return false, nil
+}
+
 // serializeResponse converts a DownloadResponse to JSON for caching
 func serializeResponse(resp *DownloadResponse) ([]byte, error) {
 	if resp == nil || resp.Stats == nil {
 		return nil, gdlerrors.NewValidationError("response", "response and stats must not be nil")
 	}
 
+	return json.Marshal(newCachedResponse(resp))
+}
+
+// newCachedResponse converts a DownloadResponse to its cached representation
+func newCachedResponse(resp *DownloadResponse) *CachedResponse {
 	cached := &CachedResponse{
 		Headers:  resp.Headers,
 		Metadata: resp.Metadata,
@@ -437,16 +702,31 @@ func serializeResponse(resp *DownloadResponse) ([]byte, error) {
 		cached.Stats.Error = resp.Stats.Error.Error()
 	}
 
-	return json.Marshal(cached)
+	return cached
 }
 
 // deserializeResponse converts cached JSON data back to a DownloadResponse
 func deserializeResponse(data []byte) (*DownloadResponse, error) {
+	cached, err := decodeCachedResponse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return cached.toResponse()
+}
+
+// decodeCachedResponse unmarshals cached JSON data
+func decodeCachedResponse(data []byte) (*CachedResponse, error) {
 	var cached CachedResponse
 	if err := json.Unmarshal(data, &cached); err != nil {
 		return nil, gdlerrors.NewStorageError("cache deserialization", err, "failed to unmarshal cached response")
 	}
 
+	return &cached, nil
+}
+
+// toResponse converts the cached representation back to a DownloadResponse
+func (cached *CachedResponse) toResponse() (*DownloadResponse, error) {
 	// Parse times
 	startTime, err := time.Parse(time.RFC3339, cached.Stats.StartTime)
 	if err != nil {
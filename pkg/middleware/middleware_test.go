@@ -643,6 +643,33 @@ func TestCacheMiddleware(t *testing.T) {
 			t.Error("Expected second response to be marked as cached")
 		}
 	})
+
+	t.Run("PostNotCached", func(t *testing.T) {
+		cache := NewMemoryCache()
+		middleware := CacheMiddleware(cache, 5*time.Minute)
+
+		callCount := 0
+		handler := func(ctx context.Context, req *DownloadRequest) (*DownloadResponse, error) {
+			callCount++
+			return &DownloadResponse{Stats: &types.DownloadStats{URL: req.URL, Success: true}}, nil
+		}
+
+		wrappedHandler := middleware(handler)
+		req := &DownloadRequest{
+			URL:     "http://example.com/export",
+			Options: &types.DownloadOptions{Method: "POST", Body: []byte(`{"q":1}`)},
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err := wrappedHandler(context.Background(), req); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		if callCount != 2 {
+			t.Errorf("Expected both POST requests to reach the handler, got %d", callCount)
+		}
+	})
 }
 
 // TestAuthenticationMiddleware is skipped as it requires AuthPlugin interface
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RequestMiddleware wraps the transport of every HTTP request a download makes:
+// metadata probes, each chunk's range request, retries and redirects. Unlike
+// Middleware, which wraps a whole download, it sees the outgoing *http.Request
+// and the *http.Response, so it can sign requests, inject headers, log traffic
+// or answer from a cache.
+//
+// As with any http.RoundTripper, the request passed to the returned transport
+// must not be modified; clone it first.
+type RequestMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to the http.RoundTripper interface.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// ChainRequestMiddleware wraps transport with the middleware so the first one
+// sees each request first. A nil transport means http.DefaultTransport.
+func ChainRequestMiddleware(transport http.RoundTripper, middlewares ...RequestMiddleware) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+
+	return transport
+}
+
+// RequestHeaderMiddleware sets the given headers on every request, replacing
+// values set by the download options.
+func RequestHeaderMiddleware(headers map[string]string) RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// RequestLoggingMiddleware logs every request with its status and duration.
+func RequestLoggingMiddleware(logger Logger) RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				logger.Error("Request failed",
+					"method", req.Method,
+					"url", req.URL.Redacted(),
+					"duration", time.Since(start),
+					"error", err,
+				)
+
+				return resp, err
+			}
+
+			logger.Debug("Request completed",
+				"method", req.Method,
+				"url", req.URL.Redacted(),
+				"range", req.Header.Get("Range"),
+				"status", resp.StatusCode,
+				"duration", time.Since(start),
+			)
+
+			return resp, nil
+		})
+	}
+}
+
+// RequestRedirectLimitMiddleware fails a request reached after more than
+// limit redirects in a row; a limit of 0 refuses every redirect. An
+// http.Client gives up after 10 redirects on its own, so larger limits have
+// no effect.
+func RequestRedirectLimitMiddleware(limit int) RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// The client links each redirected request to the response that
+			// sent it there
+			redirects := 0
+			for resp := req.Response; resp != nil && resp.Request != nil; resp = resp.Request.Response {
+				redirects++
+			}
+
+			if redirects > limit {
+				return nil, fmt.Errorf("stopped after %d redirects", limit)
+			}
+
+			return next.RoundTrip(req)
+		})
+	}
+}
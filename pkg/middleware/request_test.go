@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// recordingLogger records the messages logged through it.
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Info(msg string, args ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingLogger) Error(msg string, args ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+
+func TestChainRequestMiddleware(t *testing.T) {
+	var order []string
+
+	tag := func(name string) RequestMiddleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	var seen http.Header
+
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		seen = req.Header
+
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	logger := &recordingLogger{}
+	chained := ChainRequestMiddleware(transport,
+		tag("first"),
+		RequestHeaderMiddleware(map[string]string{"X-Signature": "signed"}),
+		tag("second"),
+		RequestLoggingMiddleware(logger),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/file", nil)
+	if _, err := chained.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+
+	if want := []string{"first", "second"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("middleware order = %v, want %v", order, want)
+	}
+
+	if seen.Get("X-Signature") != "signed" {
+		t.Errorf("X-Signature = %q, want the header injected", seen.Get("X-Signature"))
+	}
+
+	if req.Header.Get("X-Signature") != "" {
+		t.Error("RequestHeaderMiddleware modified the caller's request")
+	}
+
+	if want := []string{"Request completed"}; !reflect.DeepEqual(logger.messages, want) {
+		t.Errorf("logged %v, want %v", logger.messages, want)
+	}
+}
+
+func TestChainRequestMiddleware_NilTransport(t *testing.T) {
+	if got := ChainRequestMiddleware(nil); got != http.DefaultTransport {
+		t.Errorf("ChainRequestMiddleware(nil) = %v, want http.DefaultTransport", got)
+	}
+}
+
+func TestRequestRedirectLimitMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /3 redirects to /2, /1 and then /0
+		if n := r.URL.Path[1:]; n != "0" {
+			http.Redirect(w, r, "/"+string(n[0]-1), http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		limit   int
+		wantErr bool
+	}{
+		{0, true},
+		{2, true},
+		{3, false},
+		{10, false},
+	}
+
+	for _, tt := range tests {
+		client := &http.Client{Transport: ChainRequestMiddleware(nil, RequestRedirectLimitMiddleware(tt.limit))}
+
+		resp, err := client.Get(server.URL + "/3")
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("limit %d: error = %v, want error %v", tt.limit, err, tt.wantErr)
+		}
+	}
+}
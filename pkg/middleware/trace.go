@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTraceBodyLimit is how much of each body a trace shows when bodies
+// are not elided.
+const DefaultTraceBodyLimit = 4096
+
+// TraceOptions configures RequestTraceMiddleware.
+type TraceOptions struct {
+	// Bodies shows the start of request and response bodies, up to
+	// BodyLimit bytes each, instead of only their size.
+	Bodies bool
+
+	// BodyLimit is how many bytes of each body are shown,
+	// DefaultTraceBodyLimit when 0.
+	BodyLimit int
+
+	// ShowSecrets shows the values of the Authorization, Proxy-Authorization
+	// and Cookie headers instead of redacting them.
+	ShowSecrets bool
+}
+
+// sensitiveHeaders are redacted from traces and HAR logs unless ShowSecrets
+// is set.
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// RequestTraceMiddleware writes a trace of every request to w, as curl -v
+// does: name resolution, connections, TLS handshakes with the server
+// certificate, the request line and headers as written on the wire, and the
+// response status line and headers. Redirects show up as requests of their
+// own. Each line starts with the number of its request, since chunk
+// requests run at the same time.
+//
+// Example:
+//
+//	downloader.Use(middleware.RequestTraceMiddleware(os.Stderr, nil))
+func RequestTraceMiddleware(w io.Writer, opts *TraceOptions) RequestMiddleware {
+	t := &tracer{w: w, bodyLimit: DefaultTraceBodyLimit}
+	if opts != nil {
+		t.bodies = opts.Bodies
+		t.showSecrets = opts.ShowSecrets
+		if opts.BodyLimit > 0 {
+			t.bodyLimit = opts.BodyLimit
+		}
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return t.roundTrip(next, req)
+		})
+	}
+}
+
+// tracer writes the traces of the requests.
+type tracer struct {
+	w           io.Writer
+	bodies      bool
+	bodyLimit   int
+	showSecrets bool
+
+	requests atomic.Int64
+	mu       sync.Mutex // Serializes lines
+}
+
+// line writes one line of the trace of request id.
+func (t *tracer) line(id int64, prefix, format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	text := strings.TrimRight(fmt.Sprintf("[%d] %s %s", id, prefix, fmt.Sprintf(format, args...)), " ")
+	_, _ = fmt.Fprintln(t.w, text)
+}
+
+// roundTrip sends req through next, tracing it.
+func (t *tracer) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	id := t.requests.Add(1)
+	start := time.Now()
+
+	t.line(id, "*", "%s %s", req.Method, req.URL.Redacted())
+
+	// The request line, then the headers as the transport writes them
+	wrote := false
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			t.line(id, "*", "Resolving %s", info.Host)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				t.line(id, "*", "Resolution failed: %v", info.Err)
+				return
+			}
+			addrs := make([]string, len(info.Addrs))
+			for i, addr := range info.Addrs {
+				addrs[i] = addr.String()
+			}
+			t.line(id, "*", "Resolved to %s", strings.Join(addrs, ", "))
+		},
+		ConnectStart: func(network, addr string) {
+			t.line(id, "*", "Connecting to %s (%s)", addr, network)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				t.line(id, "*", "Connection to %s failed: %v", addr, err)
+				return
+			}
+			t.line(id, "*", "Connected to %s", addr)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.traceTLS(id, state, err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.line(id, "*", "Reusing connection to %s (idle %s)", info.Conn.RemoteAddr(), info.IdleTime.Round(time.Millisecond))
+			}
+		},
+		WroteHeaderField: func(key string, value []string) {
+			if !wrote {
+				wrote = true
+				t.line(id, ">", "%s %s", req.Method, req.URL.RequestURI())
+			}
+			for _, v := range value {
+				t.line(id, ">", "%s: %s", key, t.headerValue(key, v))
+			}
+		},
+		WroteHeaders: func() {
+			t.line(id, ">", "")
+		},
+	}
+
+	req = req.Clone(httptrace.WithClientTrace(req.Context(), trace))
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &tracedBody{ReadCloser: req.Body, t: t, id: id, prefix: ">"}
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		t.line(id, "*", "Request failed after %s: %v", time.Since(start).Round(time.Millisecond), err)
+		return resp, err
+	}
+
+	t.line(id, "<", "%s %s", resp.Proto, resp.Status)
+	for _, key := range sortedKeys(resp.Header) {
+		for _, v := range resp.Header[key] {
+			t.line(id, "<", "%s: %s", key, t.headerValue(key, v))
+		}
+	}
+	t.line(id, "<", "")
+
+	if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+		t.line(id, "*", "Redirected to %s", location)
+	}
+
+	resp.Body = &tracedBody{ReadCloser: resp.Body, t: t, id: id, prefix: "<", start: start}
+
+	return resp, nil
+}
+
+// traceTLS traces a TLS handshake and the certificate the server sent.
+func (t *tracer) traceTLS(id int64, state tls.ConnectionState, err error) {
+	if err != nil {
+		t.line(id, "*", "TLS handshake failed: %v", err)
+		return
+	}
+
+	protocol := state.NegotiatedProtocol
+	if protocol == "" {
+		protocol = "none"
+	}
+	t.line(id, "*", "TLS handshake done: %s, %s, ALPN %s", tls.VersionName(state.Version),
+		tls.CipherSuiteName(state.CipherSuite), protocol)
+
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		t.line(id, "*", "Server certificate: subject %q, issuer %q", cert.Subject.String(), cert.Issuer.String())
+		t.line(id, "*", "  valid %s to %s", cert.NotBefore.UTC().Format(time.RFC3339), cert.NotAfter.UTC().Format(time.RFC3339))
+		if len(cert.DNSNames) > 0 {
+			t.line(id, "*", "  names %s", strings.Join(cert.DNSNames, ", "))
+		}
+	}
+}
+
+// headerValue returns value as the trace shows it.
+func (t *tracer) headerValue(key, value string) string {
+	if t.showSecrets {
+		return value
+	}
+
+	return redactHeader(key, value)
+}
+
+// redactHeader returns value with the credentials of a sensitive header
+// redacted, keeping the scheme of an Authorization header.
+func redactHeader(key, value string) string {
+	if !sensitiveHeaders[strings.ToLower(key)] {
+		return value
+	}
+
+	if lower := strings.ToLower(key); lower == "authorization" || lower == "proxy-authorization" {
+		if scheme, _, ok := strings.Cut(value, " "); ok {
+			return scheme + " [redacted]"
+		}
+	}
+
+	return "[redacted]"
+}
+
+// sortedKeys returns the keys of header in order.
+func sortedKeys(header http.Header) []string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// tracedBody counts, and shows the start of, a body as it is read, and
+// traces its size once it is closed.
+type tracedBody struct {
+	io.ReadCloser
+	t      *tracer
+	id     int64
+	prefix string
+	start  time.Time
+
+	n      int64
+	shown  []byte
+	closed bool
+}
+
+// Read reads from the body, keeping the start of it to show.
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+
+	if b.t.bodies && len(b.shown) < b.t.bodyLimit {
+		b.shown = append(b.shown, p[:min(n, b.t.bodyLimit-len(b.shown))]...)
+	}
+
+	return n, err
+}
+
+// Close closes the body and traces it.
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.closed {
+		return err
+	}
+	b.closed = true
+
+	if len(b.shown) > 0 {
+		for _, line := range strings.Split(strings.TrimRight(printable(b.shown), "\n"), "\n") {
+			b.t.line(b.id, b.prefix, "%s", line)
+		}
+		if b.n > int64(len(b.shown)) {
+			b.t.line(b.id, b.prefix, "[%d more bytes]", b.n-int64(len(b.shown)))
+		}
+	} else {
+		b.t.line(b.id, b.prefix, "[%d bytes of body]", b.n)
+	}
+
+	if !b.start.IsZero() {
+		b.t.line(b.id, "*", "Done in %s", time.Since(b.start).Round(time.Millisecond))
+	}
+
+	return err
+}
+
+// printable returns data with the bytes that are not printable ASCII, other
+// than newlines and tabs, replaced with dots, as curl --trace-ascii shows
+// them.
+func printable(data []byte) string {
+	out := make([]byte, len(data))
+	for i, c := range data {
+		switch {
+		case c == '\n' || c == '\t':
+			out[i] = c
+		case c < 0x20 || c > 0x7e:
+			out[i] = '.'
+		default:
+			out[i] = c
+		}
+	}
+
+	return string(out)
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer safe for the transport's goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRequestTraceMiddleware(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Header().Set("Set-Cookie", "session=abc")
+		_, _ = w.Write([]byte("hello\x00world"))
+	}))
+	defer server.Close()
+
+	run := func(opts *TraceOptions) string {
+		var out syncBuffer
+
+		client := server.Client()
+		client.Transport = ChainRequestMiddleware(client.Transport, RequestTraceMiddleware(&out, opts))
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/old", strings.NewReader("query"))
+		req.Header.Set("Authorization", "Bearer s3cret")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		return out.String()
+	}
+
+	trace := run(nil)
+	for _, want := range []string{
+		"[1] * POST " + server.URL + "/old",
+		"[1] * Connecting to ",
+		"[1] * TLS handshake done: TLS 1.3",
+		"[1] * Server certificate: subject ",
+		"[1] > POST /old",
+		"[1] > Authorization: Bearer [redacted]",
+		"[1] > [5 bytes of body]",
+		"[1] < HTTP/1.1 302 Found",
+		"[1] * Redirected to /new",
+		"[2] * GET " + server.URL + "/new",
+		"[2] * Reusing connection to ",
+		"[2] < Set-Cookie: [redacted]",
+		"[2] < [11 bytes of body]",
+		"[2] * Done in ",
+	} {
+		if !strings.Contains(trace, want) {
+			t.Errorf("trace lacks %q:\n%s", want, trace)
+		}
+	}
+	if strings.Contains(trace, "s3cret") || strings.Contains(trace, "session=abc") {
+		t.Errorf("trace shows secrets:\n%s", trace)
+	}
+
+	trace = run(&TraceOptions{Bodies: true, BodyLimit: 8, ShowSecrets: true})
+	for _, want := range []string{
+		"[1] > Authorization: Bearer s3cret",
+		"[1] > query",
+		"[2] < hello.wo",
+		"[2] < [3 more bytes]",
+		"[2] < Set-Cookie: session=abc",
+	} {
+		if !strings.Contains(trace, want) {
+			t.Errorf("trace lacks %q:\n%s", want, trace)
+		}
+	}
+}
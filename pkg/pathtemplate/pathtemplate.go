@@ -0,0 +1,369 @@
+// Package pathtemplate builds output paths from templates such as
+// "{host}/{path}/{filename}", so that downloads from many URLs can be
+// organised into directories without renaming them afterwards.
+//
+// The variables are:
+//
+//	{host}      the URL's host name, without the port
+//	{path}      the directories of the URL path ("pub/releases" for /pub/releases/a.zip)
+//	{path:N}    the Nth of those directories, counting from 1; -1 is the last
+//	{filename}  the file name of the URL, with an extension from the
+//	            Content-Type if it has none
+//	{name}      the file name without its extension
+//	{ext}       the extension, without the dot, from the file name or the
+//	            Content-Type ("bin" if neither tells)
+//	{date}      the date of the download (2006-01-02)
+//	{time}      the time of the download (150405)
+//	{index}     the position of the file in a batch, counting from 1
+//	{index:W}   the same, zero-padded to W digits
+//
+// "{{" and "}}" stand for literal braces.
+package pathtemplate
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forest6511/gdl/pkg/validation"
+)
+
+// defaultFilename names a file whose URL ends in a slash.
+const defaultFilename = "download"
+
+// defaultExt is the extension of a file whose type is unknown.
+const defaultExt = "bin"
+
+// variables holds the variable names and whether they take an argument.
+var variables = map[string]bool{
+	"host":     false,
+	"path":     true,
+	"filename": false,
+	"name":     false,
+	"ext":      false,
+	"date":     false,
+	"time":     false,
+	"index":    true,
+}
+
+// preferredExt maps common MIME types to their usual extension, where
+// mime.ExtensionsByType would return a rarer one first.
+var preferredExt = map[string]string{
+	"application/gzip":         "gz",
+	"application/json":         "json",
+	"application/octet-stream": defaultExt,
+	"application/pdf":          "pdf",
+	"application/xml":          "xml",
+	"application/zip":          "zip",
+	"image/jpeg":               "jpg",
+	"image/png":                "png",
+	"text/csv":                 "csv",
+	"text/html":                "html",
+	"text/plain":               "txt",
+	"text/xml":                 "xml",
+}
+
+// Vars are the values a template is executed with.
+type Vars struct {
+	// URL is the URL of the file.
+	URL string
+
+	// Index is the position of the file in a batch, counting from 1. A zero
+	// Index renders as 1.
+	Index int
+
+	// ContentType is the Content-Type of the file, if known, for its
+	// extension when the URL has none.
+	ContentType string
+
+	// Time is the time of the download for {date} and {time}; the zero
+	// value means now.
+	Time time.Time
+}
+
+// part is a literal part of a template (name is empty) or a variable.
+type part struct {
+	literal string
+	name    string
+	arg     int
+}
+
+// Template is a parsed output template.
+type Template struct {
+	parts []part
+}
+
+// Has reports whether s uses any template variable, so that an output name
+// with stray braces is still taken literally.
+func Has(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '{' {
+			continue
+		}
+
+		if i+1 < len(s) && s[i+1] == '{' {
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return false
+		}
+
+		name, _, _ := strings.Cut(s[i+1:i+end], ":")
+		if _, ok := variables[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parse parses a template, rejecting unknown variables.
+func Parse(s string) (*Template, error) {
+	t := &Template{}
+
+	var literal strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case (c == '{' || c == '}') && i+1 < len(s) && s[i+1] == c:
+			literal.WriteByte(c)
+			i++
+		case c == '}':
+			return nil, fmt.Errorf("template %q: unmatched }", s)
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("template %q: unclosed {", s)
+			}
+
+			p, err := parseVariable(s[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("template %q: %w", s, err)
+			}
+
+			if literal.Len() > 0 {
+				t.parts = append(t.parts, part{literal: literal.String()})
+				literal.Reset()
+			}
+			t.parts = append(t.parts, p)
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+
+	if literal.Len() > 0 {
+		t.parts = append(t.parts, part{literal: literal.String()})
+	}
+
+	return t, nil
+}
+
+// parseVariable parses the inside of "{...}".
+func parseVariable(s string) (part, error) {
+	name, arg, hasArg := strings.Cut(s, ":")
+
+	takesArg, ok := variables[name]
+	if !ok {
+		return part{}, fmt.Errorf("unknown variable {%s}", s)
+	}
+
+	p := part{name: name}
+	if !hasArg {
+		return p, nil
+	}
+
+	if !takesArg {
+		return part{}, fmt.Errorf("{%s} takes no argument", name)
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n == 0 || (name == "index" && n < 0) {
+		return part{}, fmt.Errorf("invalid argument in {%s}", s)
+	}
+	p.arg = n
+
+	return p, nil
+}
+
+// NeedsContentType reports whether executing the template for rawURL
+// depends on the file's Content-Type, because it uses the extension and the
+// URL's file name has none.
+func (t *Template) NeedsContentType(rawURL string) bool {
+	uses := false
+	for _, p := range t.parts {
+		if p.name == "filename" || p.name == "ext" {
+			uses = true
+			break
+		}
+	}
+
+	if !uses {
+		return false
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	return path.Ext(fileName(u)) == ""
+}
+
+// Execute renders the template for v. The result uses forward slashes and
+// is cleaned; values are stripped of characters that are not allowed in file
+// names, and "{path}" never climbs above the directory it starts in.
+func (t *Template) Execute(v Vars) (string, error) {
+	u, err := url.Parse(v.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", v.URL, err)
+	}
+
+	when := v.Time
+	if when.IsZero() {
+		when = time.Now()
+	}
+
+	index := max(v.Index, 1)
+
+	var b strings.Builder
+
+	for _, p := range t.parts {
+		switch p.name {
+		case "":
+			b.WriteString(p.literal)
+		case "host":
+			b.WriteString(sanitize(u.Hostname()))
+		case "path":
+			dirs := directories(u)
+			if p.arg == 0 {
+				b.WriteString(strings.Join(dirs, "/"))
+				break
+			}
+
+			n := p.arg
+			if n < 0 {
+				n += len(dirs) + 1
+			}
+			if n >= 1 && n <= len(dirs) {
+				b.WriteString(dirs[n-1])
+			}
+		case "filename":
+			name := fileName(u)
+			if path.Ext(name) == "" && v.ContentType != "" {
+				name += "." + extension(name, v.ContentType)
+			}
+			b.WriteString(name)
+		case "name":
+			name := fileName(u)
+			b.WriteString(strings.TrimSuffix(name, path.Ext(name)))
+		case "ext":
+			b.WriteString(extension(fileName(u), v.ContentType))
+		case "date":
+			b.WriteString(when.Format("2006-01-02"))
+		case "time":
+			b.WriteString(when.Format("150405"))
+		case "index":
+			b.WriteString(fmt.Sprintf("%0*d", p.arg, index))
+		}
+	}
+
+	// An empty variable at the start must not make the path absolute
+	result := path.Clean(b.String())
+	if len(t.parts) == 0 || !strings.HasPrefix(t.parts[0].literal, "/") {
+		result = strings.TrimLeft(result, "/")
+	}
+
+	if result == "" || result == "." || result == "/" {
+		return "", fmt.Errorf("template renders an empty path for %s", v.URL)
+	}
+
+	return result, nil
+}
+
+// Expand parses template and executes it for v.
+func Expand(template string, v Vars) (string, error) {
+	t, err := Parse(template)
+	if err != nil {
+		return "", err
+	}
+
+	return t.Execute(v)
+}
+
+// directories returns the sanitized directories of u's path.
+func directories(u *url.URL) []string {
+	dir, _ := path.Split(u.Path)
+
+	var dirs []string
+	for _, segment := range strings.Split(dir, "/") {
+		if segment == "" {
+			continue
+		}
+		dirs = append(dirs, sanitize(segment))
+	}
+
+	return dirs
+}
+
+// fileName returns the sanitized file name of u's path.
+func fileName(u *url.URL) string {
+	_, name := path.Split(u.Path)
+	if name == "" {
+		return defaultFilename
+	}
+
+	return sanitize(name)
+}
+
+// extension returns the extension of name, or else the usual extension of
+// contentType.
+func extension(name, contentType string) string {
+	if ext := path.Ext(name); ext != "" {
+		return ext[1:]
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return defaultExt
+	}
+
+	if ext, ok := preferredExt[mediaType]; ok {
+		return ext
+	}
+
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0][1:]
+	}
+
+	return defaultExt
+}
+
+// sanitize makes s usable as a single file name component.
+func sanitize(s string) string {
+	if s == "." || s == ".." {
+		return "_"
+	}
+
+	// Windows would open a device for names such as "nul" or "con.txt"
+	if validation.IsReservedFilename(s) {
+		s = "_" + s
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+
+		return r
+	}, s)
+}
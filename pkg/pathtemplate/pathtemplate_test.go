@@ -0,0 +1,96 @@
+package pathtemplate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHas(t *testing.T) {
+	tests := map[string]bool{
+		"{host}/{filename}":  true,
+		"file-{index:3}.jpg": true,
+		"img_#1.jpg":         false,
+		"{notes}.txt":        false,
+		"{{host}}":           false,
+		"plain.txt":          false,
+	}
+
+	for s, want := range tests {
+		if got := Has(s); got != want {
+			t.Errorf("Has(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	when := time.Date(2025, 3, 9, 14, 5, 7, 0, time.UTC)
+	rawURL := "https://cdn.example.com:8443/pub/releases/v1.2/app.tar.gz?sig=abc"
+
+	tests := []struct {
+		template    string
+		url         string
+		index       int
+		contentType string
+		want        string
+	}{
+		{"{host}/{path}/{filename}", rawURL, 1, "", "cdn.example.com/pub/releases/v1.2/app.tar.gz"},
+		{"{path:1}/{path:-1}/{name}.{ext}", rawURL, 1, "", "pub/v1.2/app.tar.gz"},
+		{"{date}/{time}-{index:4}-{filename}", rawURL, 12, "", "2025-03-09/140507-0012-app.tar.gz"},
+		{"{index}", rawURL, 0, "", "1"},
+		{"out/{path}/{filename}", "https://example.com/report.csv", 1, "", "out/report.csv"},
+		{"{path:5}/{filename}", rawURL, 1, "", "app.tar.gz"},
+		{"{filename}", "https://api.example.com/v1/export", 1, "text/csv; charset=utf-8", "export.csv"},
+		{"{name}.{ext}", "https://api.example.com/v1/export", 1, "", "export.bin"},
+		{"{filename}", "https://example.com/dir/", 1, "text/html", "download.html"},
+		{"{path}/{filename}", "https://example.com/a/../../etc/passwd", 1, "", "a/_/_/etc/passwd"},
+		{"{path}/{filename}", "https://example.com/%2E%2E/x:y", 1, "", "_/x_y"},
+		{"{path}/{filename}", "https://example.com/aux/con.txt", 1, "", "_aux/_con.txt"},
+		{"{{literal}}/{filename}", rawURL, 1, "", "{literal}/app.tar.gz"},
+		{"/srv/{host}/{filename}", rawURL, 1, "", "/srv/cdn.example.com/app.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := Expand(tt.template, Vars{URL: tt.url, Index: tt.index, ContentType: tt.contentType, Time: when})
+			if err != nil {
+				t.Fatalf("Expand() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Expand(%q, %s) = %q, want %q", tt.template, tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{"{unknown}", "{host", "host}", "{host:1}", "{index:-2}", "{path:x}"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+
+	if _, err := Expand("{path}", Vars{URL: "https://example.com/file"}); err == nil {
+		t.Error("Expand() should fail when the path renders empty")
+	}
+}
+
+func TestNeedsContentType(t *testing.T) {
+	tmpl, err := Parse("{host}/{filename}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tmpl.NeedsContentType("https://example.com/file.zip") {
+		t.Error("a URL with an extension needs no Content-Type")
+	}
+
+	if !tmpl.NeedsContentType("https://example.com/export") {
+		t.Error("a URL without an extension needs the Content-Type for {filename}")
+	}
+
+	tmpl, _ = Parse("{host}/{name}")
+	if tmpl.NeedsContentType("https://example.com/export") {
+		t.Error("{name} does not need the Content-Type")
+	}
+}
@@ -0,0 +1,337 @@
+package plugin
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// Environment variables through which an out-of-process plugin reaches the
+// broker of its host. ConnectHost reads them.
+const (
+	HostAddrEnv  = "GDL_PLUGIN_HOST_ADDR"
+	HostTokenEnv = "GDL_PLUGIN_HOST_TOKEN"
+)
+
+const (
+	// hostServiceName is the net/rpc service the broker serves to plugins.
+	hostServiceName = "Host"
+
+	// brokerAuthTimeout bounds how long a connection to the broker may take
+	// to present its token.
+	brokerAuthTimeout = 10 * time.Second
+
+	// brokerDialTimeout bounds the connections the proxy opens for a plugin.
+	brokerDialTimeout = 30 * time.Second
+
+	// proxyUser is the user name of the proxy URL given to plugins; only the
+	// token, sent as its password, is checked.
+	proxyUser = "gdl"
+)
+
+// hopHeaders are the hop-by-hop headers a proxy must not forward.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// broker gives an out-of-process plugin the network and file access its
+// capabilities allow, and nothing else. The plugin is started with an HTTP
+// proxy on a loopback port in its environment, which only connects to the
+// declared hosts, and the address of an RPC service (see Host) that only
+// reads and writes the declared paths. Both require a token handed to the
+// plugin alone.
+type broker struct {
+	caps      *Capabilities
+	token     string
+	rpc       net.Listener
+	proxy     *http.Server
+	transport *http.Transport
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// startBroker listens on two loopback ports for the plugin granted caps.
+func startBroker(caps *Capabilities) (*broker, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeUnknown, "generate plugin broker token")
+	}
+
+	rpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeNetworkError, "start plugin broker")
+	}
+
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = rpcListener.Close()
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodeNetworkError, "start plugin proxy")
+	}
+
+	b := &broker{
+		caps:  caps,
+		token: hex.EncodeToString(secret),
+		rpc:   rpcListener,
+		transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: brokerDialTimeout}).DialContext,
+			TLSHandshakeTimeout: brokerDialTimeout,
+		},
+	}
+	b.proxy = &http.Server{Handler: b, ReadHeaderTimeout: brokerAuthTimeout}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName(hostServiceName, &hostService{caps: caps}); err != nil {
+		_ = rpcListener.Close()
+		_ = proxyListener.Close()
+		return nil, gdlerrors.WrapError(err, gdlerrors.CodePluginError, "register plugin host service")
+	}
+
+	b.wg.Add(2)
+	go func() {
+		defer b.wg.Done()
+		b.serveRPC(server)
+	}()
+	go func() {
+		defer b.wg.Done()
+		_ = b.proxy.Serve(proxyListener)
+	}()
+
+	b.proxy.Addr = proxyListener.Addr().String()
+
+	return b, nil
+}
+
+// environ returns the variables that route the plugin's HTTP traffic through
+// the proxy and tell it where the RPC service is.
+func (b *broker) environ() []string {
+	proxyURL := (&url.URL{
+		Scheme: "http",
+		User:   url.UserPassword(proxyUser, b.token),
+		Host:   b.proxy.Addr,
+	}).String()
+
+	return []string{
+		"HTTP_PROXY=" + proxyURL,
+		"HTTPS_PROXY=" + proxyURL,
+		"http_proxy=" + proxyURL,
+		"https_proxy=" + proxyURL,
+		"NO_PROXY=",
+		"no_proxy=",
+		HostAddrEnv + "=" + b.rpc.Addr().String(),
+		HostTokenEnv + "=" + b.token,
+	}
+}
+
+// Close stops the broker and waits for its connections to end.
+func (b *broker) Close() error {
+	b.closeOnce.Do(func() {
+		_ = b.rpc.Close()
+		_ = b.proxy.Close()
+		b.transport.CloseIdleConnections()
+		b.wg.Wait()
+	})
+
+	return nil
+}
+
+// serveRPC serves the host service on each connection that presents the
+// token as its first line.
+func (b *broker) serveRPC(server *rpc.Server) {
+	for {
+		conn, err := b.rpc.Accept()
+		if err != nil {
+			return
+		}
+
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			defer func() { _ = conn.Close() }()
+
+			reader := bufio.NewReader(conn)
+
+			_ = conn.SetReadDeadline(time.Now().Add(brokerAuthTimeout))
+			line, err := reader.ReadString('\n')
+			if err != nil || !b.authorized(strings.TrimSpace(line)) {
+				return
+			}
+			_ = conn.SetReadDeadline(time.Time{})
+
+			server.ServeConn(struct {
+				io.Reader
+				io.WriteCloser
+			}{reader, conn})
+		}()
+	}
+}
+
+// authorized reports whether token is the broker's token.
+func (b *broker) authorized(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(b.token)) == 1
+}
+
+// proxyAuthorized reports whether r carries the token as the password of its
+// Proxy-Authorization.
+func (b *broker) proxyAuthorized(r *http.Request) bool {
+	encoded, ok := strings.CutPrefix(r.Header.Get("Proxy-Authorization"), "Basic ")
+	if !ok {
+		return false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+
+	_, password, _ := strings.Cut(string(decoded), ":")
+
+	return b.authorized(password)
+}
+
+// ServeHTTP proxies a request of the plugin, or tunnels its CONNECT, to hosts
+// its capabilities list.
+func (b *broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !b.proxyAuthorized(r) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="gdl plugin"`)
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	host := r.Host
+	if r.Method != http.MethodConnect {
+		host = r.URL.Host
+	}
+
+	if err := b.caps.Check("network", host); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		b.tunnel(w, r)
+		return
+	}
+
+	if r.URL.Scheme != "http" || r.URL.Host == "" {
+		http.Error(w, "only absolute http URLs are proxied", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, name := range hopHeaders {
+		out.Header.Del(name)
+	}
+
+	resp, err := b.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	for _, name := range hopHeaders {
+		resp.Header.Del(name)
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// tunnel connects the plugin to the host of a CONNECT request.
+func (b *broker) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, brokerDialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer func() { _ = client.Close() }()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = buffered.WriteTo(upstream)
+		_, _ = io.Copy(upstream, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// HostWriteArgs are the arguments of Host.WriteFile.
+type HostWriteArgs struct {
+	Path string
+	Data []byte
+}
+
+// hostService is the RPC service through which a plugin reads and writes
+// the paths its capabilities list.
+type hostService struct {
+	caps *Capabilities
+}
+
+// ReadFile returns the contents of a readable file.
+func (s *hostService) ReadFile(path string, data *[]byte) error {
+	if err := s.caps.Check("read", path); err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(path) // #nosec G304 -- checked against the plugin's capabilities
+	if err != nil {
+		return err
+	}
+	*data = content
+
+	return nil
+}
+
+// WriteFile creates or replaces a writable file.
+func (s *hostService) WriteFile(args *HostWriteArgs, _ *struct{}) error {
+	if err := s.caps.Check("write", args.Path); err != nil {
+		return err
+	}
+
+	return os.WriteFile(args.Path, args.Data, 0o600)
+}
+
+// Remove deletes a writable file or empty directory.
+func (s *hostService) Remove(path string, _ *struct{}) error {
+	if err := s.caps.Check("delete", path); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
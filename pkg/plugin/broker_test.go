@@ -0,0 +1,241 @@
+package plugin
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startTestBroker starts a broker granted caps and closes it with the test.
+func startTestBroker(t *testing.T, caps *Capabilities) *broker {
+	t.Helper()
+
+	b, err := startBroker(caps)
+	if err != nil {
+		t.Fatalf("startBroker() error = %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	return b
+}
+
+// proxyClient returns a client whose requests go through the broker's proxy
+// with the given password.
+func proxyClient(b *broker, password string, base *http.Transport) *http.Client {
+	transport := base.Clone()
+	transport.Proxy = http.ProxyURL(&url.URL{
+		Scheme: "http",
+		User:   url.UserPassword(proxyUser, password),
+		Host:   b.proxy.Addr,
+	})
+
+	return &http.Client{Transport: transport}
+}
+
+func TestBroker_Proxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Error("the proxy forwarded Proxy-Authorization")
+		}
+		_, _ = io.WriteString(w, "proxied")
+	}))
+	defer upstream.Close()
+
+	b := startTestBroker(t, &Capabilities{Network: []string{"127.0.0.1"}})
+	client := proxyClient(b, b.token, &http.Transport{})
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "proxied" {
+		t.Errorf("Get() = %d %q, want 200 proxied", resp.StatusCode, body)
+	}
+
+	resp, err = client.Get("http://denied.invalid/")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Get() of an undeclared host = %d, want 403", resp.StatusCode)
+	}
+
+	resp, err = proxyClient(b, "wrong", &http.Transport{}).Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("Get() with a wrong token = %d, want 407", resp.StatusCode)
+	}
+}
+
+func TestBroker_ProxyConnect(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "tunneled")
+	}))
+	defer upstream.Close()
+
+	base := &http.Transport{TLSClientConfig: upstream.Client().Transport.(*http.Transport).TLSClientConfig.Clone()}
+
+	allowed := startTestBroker(t, &Capabilities{Network: []string{"127.0.0.1"}})
+	resp, err := proxyClient(allowed, allowed.token, base).Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "tunneled" {
+		t.Errorf("Get() = %q, want tunneled", body)
+	}
+
+	denied := startTestBroker(t, &Capabilities{Network: []string{"api.example.com"}})
+	base.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if _, err := proxyClient(denied, denied.token, base).Get(upstream.URL); err == nil {
+		t.Error("Get() through a proxy without the host should fail")
+	}
+}
+
+func TestBroker_Host(t *testing.T) {
+	root := t.TempDir()
+	allowed := filepath.Join(root, "allowed")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{allowed, outside} {
+		if err := os.Mkdir(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := startTestBroker(t, &Capabilities{Write: []string{allowed}})
+	for _, entry := range b.environ() {
+		if name, value, _ := strings.Cut(entry, "="); name == HostAddrEnv || name == HostTokenEnv {
+			t.Setenv(name, value)
+		}
+	}
+
+	host, err := ConnectHost()
+	if err != nil {
+		t.Fatalf("ConnectHost() error = %v", err)
+	}
+	defer func() { _ = host.Close() }()
+
+	file := filepath.Join(allowed, "file")
+	if err := host.WriteFile(file, []byte("data")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if data, err := host.ReadFile(file); err != nil || string(data) != "data" {
+		t.Errorf("ReadFile() = %q, %v, want data", data, err)
+	}
+	if err := host.Remove(file); err != nil {
+		t.Errorf("Remove() error = %v", err)
+	}
+
+	if _, err := host.ReadFile(filepath.Join(outside, "secret")); err == nil {
+		t.Error("ReadFile() outside the declared paths should fail")
+	}
+
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	if err := host.WriteFile(filepath.Join(allowed, "escape", "secret"), []byte("x")); err == nil {
+		t.Error("WriteFile() through a symlink out of the declared paths should fail")
+	}
+	if data, _ := os.ReadFile(filepath.Join(outside, "secret")); string(data) != "secret" {
+		t.Errorf("file outside the declared paths = %q, want it unchanged", data)
+	}
+}
+
+func TestBroker_HostRejectsWrongToken(t *testing.T) {
+	b := startTestBroker(t, &Capabilities{Read: []string{t.TempDir()}})
+
+	t.Setenv(HostAddrEnv, b.rpc.Addr().String())
+	t.Setenv(HostTokenEnv, "wrong")
+
+	host, err := ConnectHost()
+	if err != nil {
+		t.Fatalf("ConnectHost() error = %v", err)
+	}
+	defer func() { _ = host.Close() }()
+
+	if _, err := host.ReadFile(os.Args[0]); err == nil {
+		t.Error("ReadFile() with a wrong token should fail")
+	}
+
+	t.Setenv(HostTokenEnv, "")
+	if _, err := ConnectHost(); err == nil {
+		t.Error("ConnectHost() without a token should fail")
+	}
+}
+
+// helperHostPlugin reads the file named by its config through the host.
+type helperHostPlugin struct{ helperPlugin }
+
+func (p *helperHostPlugin) Init(config map[string]interface{}) error {
+	host, err := ConnectHost()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = host.Close() }()
+
+	path, _ := config["path"].(string)
+	data, err := host.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, []byte("config")) {
+		return errors.New("unexpected contents")
+	}
+
+	return nil
+}
+
+func TestStartSandboxed(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config")
+	if err := os.WriteFile(file, []byte("config"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperPluginProcess$")
+	t.Setenv(helperPluginEnv, "host")
+
+	p, err := startSandboxed(cmd, &Capabilities{Read: []string{dir}, Env: []string{helperPluginEnv}})
+	if err != nil {
+		t.Fatalf("startSandboxed() error = %v", err)
+	}
+
+	ep, ok := p.(*ExternalPlugin)
+	if !ok || ep.broker == nil {
+		t.Fatal("startSandboxed() started the plugin without a broker")
+	}
+
+	if err := p.Init(map[string]interface{}{"path": file}); err != nil {
+		t.Errorf("Init() reading a declared path error = %v", err)
+	}
+	if err := p.Init(map[string]interface{}{"path": os.Args[0]}); err == nil {
+		t.Error("Init() reading an undeclared path should fail")
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := net.Dial("tcp", ep.broker.rpc.Addr().String()); err == nil {
+		t.Error("the broker should stop with the plugin")
+	}
+}
@@ -0,0 +1,224 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// ManifestSuffix ends the name of the manifest file installed next to a plugin:
+// the manifest of "s3.so" or "gdl-plugin-s3.exe" is "s3.manifest.json" or
+// "gdl-plugin-s3.manifest.json".
+const ManifestSuffix = ".manifest.json"
+
+// Manifest describes a plugin and the capabilities it needs.
+type Manifest struct {
+	Name         string       `json:"name"`
+	Version      string       `json:"version,omitempty"`
+	Description  string       `json:"description,omitempty"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// Capabilities lists what a plugin may access. Anything not listed is denied.
+//
+// Network entries are host names, "*.example.com" for any subdomain, or "*"
+// for any host. Read and Write entries are paths; a path grants access to
+// everything below it, and write access implies read access. Env entries are
+// variable names, or "PREFIX_*" for every variable starting with PREFIX_.
+type Capabilities struct {
+	Network []string `json:"network,omitempty"`
+	Read    []string `json:"read,omitempty"`
+	Write   []string `json:"write,omitempty"`
+	Env     []string `json:"env,omitempty"`
+}
+
+// ManifestPath returns the manifest file of the plugin at pluginPath.
+func ManifestPath(pluginPath string) string {
+	switch ext := filepath.Ext(pluginPath); ext {
+	case ".so", ".exe":
+		pluginPath = strings.TrimSuffix(pluginPath, ext)
+	}
+
+	return pluginPath + ManifestSuffix
+}
+
+// LoadManifest reads the manifest of the plugin at pluginPath. A plugin
+// without a manifest gets an empty one, which declares no capabilities.
+func LoadManifest(pluginPath string) (*Manifest, error) {
+	path := ManifestPath(pluginPath)
+
+	data, err := os.ReadFile(path) // #nosec G304 -- the manifest sits next to the plugin
+	if os.IsNotExist(err) {
+		return &Manifest{}, nil
+	}
+	if err != nil {
+		return nil, gdlerrors.NewStorageError("read plugin manifest", err, path)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, gdlerrors.NewConfigError("invalid plugin manifest", err, path)
+	}
+
+	return &manifest, nil
+}
+
+// Check reports whether the capabilities allow operation on resource. File
+// operations ("read", "write", "create", "delete") take a path, "network" a
+// host or URL and "env" a variable name; other operations are not governed by
+// capabilities and are allowed.
+func (c *Capabilities) Check(operation, resource string) error {
+	var allowed bool
+
+	switch operation {
+	case "read":
+		allowed = c.AllowsRead(resource)
+	case "write", "create", "delete":
+		allowed = c.AllowsWrite(resource)
+	case "network":
+		allowed = c.AllowsNetwork(resource)
+	case "env":
+		allowed = c.AllowsEnv(resource)
+	default:
+		return nil
+	}
+
+	if !allowed {
+		return gdlerrors.WrapError(nil, gdlerrors.CodePermissionDenied,
+			fmt.Sprintf("%s access to %s is not declared in the plugin manifest", operation, resource))
+	}
+
+	return nil
+}
+
+// AllowsNetwork reports whether the plugin may connect to host, which may
+// also be given as a URL or host:port.
+func (c *Capabilities) AllowsNetwork(host string) bool {
+	host = hostOf(host)
+
+	for _, pattern := range c.Network {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case pattern == "*" || pattern == host:
+			return true
+		case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]):
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsRead reports whether the plugin may read path.
+func (c *Capabilities) AllowsRead(path string) bool {
+	return underAny(path, c.Read) || underAny(path, c.Write)
+}
+
+// AllowsWrite reports whether the plugin may write path.
+func (c *Capabilities) AllowsWrite(path string) bool {
+	return underAny(path, c.Write)
+}
+
+// AllowsEnv reports whether the plugin may see the environment variable name.
+func (c *Capabilities) AllowsEnv(name string) bool {
+	for _, pattern := range c.Env {
+		if pattern == name {
+			return true
+		}
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Environ returns the entries of environ, in "KEY=value" form, the plugin may
+// see.
+func (c *Capabilities) Environ(environ []string) []string {
+	filtered := []string{}
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		if c.AllowsEnv(name) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered
+}
+
+// hostOf extracts the lower-cased host name from a host, host:port or URL.
+func hostOf(resource string) string {
+	if _, rest, ok := strings.Cut(resource, "://"); ok {
+		resource = rest
+	}
+	if i := strings.IndexAny(resource, "/?#"); i >= 0 {
+		resource = resource[:i]
+	}
+	if i := strings.LastIndex(resource, "@"); i >= 0 {
+		resource = resource[i+1:]
+	}
+	if i := strings.LastIndex(resource, ":"); i >= 0 && !strings.HasSuffix(resource, "]") {
+		resource = resource[:i]
+	}
+
+	return strings.ToLower(strings.Trim(resource, "[]"))
+}
+
+// underAny reports whether path is one of roots or below one of them. Both
+// are compared with their symbolic links resolved, so a link inside a root
+// does not grant access to what it points to outside it.
+func underAny(path string, roots []string) bool {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return false
+	}
+
+	for _, root := range roots {
+		rootResolved, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(rootResolved, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolvePath returns the absolute form of path with its symbolic links
+// resolved. The part of a path that does not exist yet, such as a file about
+// to be created, is appended to its resolved parent as it is.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		return abs, nil
+	}
+
+	resolvedParent, err := resolvePath(parent)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(resolvedParent, filepath.Base(abs)), nil
+}
@@ -0,0 +1,292 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCapabilities_Check(t *testing.T) {
+	caps := &Capabilities{
+		Network: []string{"api.example.com", "*.s3.amazonaws.com"},
+		Read:    []string{"/etc/gdl"},
+		Write:   []string{"/var/cache/gdl"},
+		Env:     []string{"HOME", "AWS_*"},
+	}
+
+	tests := []struct {
+		operation string
+		resource  string
+		allowed   bool
+	}{
+		{"network", "api.example.com", true},
+		{"network", "https://API.example.com:443/upload", true},
+		{"network", "bucket.s3.amazonaws.com", true},
+		{"network", "s3.amazonaws.com.evil.example", false},
+		{"network", "example.com", false},
+		{"read", "/etc/gdl/config.yaml", true},
+		{"read", "/etc/gdl", true},
+		{"read", "/etc/gdl-other/file", false},
+		{"read", "/etc/gdl/../passwd", false},
+		{"read", "/var/cache/gdl/file", true}, // write implies read
+		{"write", "/var/cache/gdl/file", true},
+		{"create", "/var/cache/gdl/new", true},
+		{"delete", "/etc/gdl/config.yaml", false},
+		{"env", "HOME", true},
+		{"env", "AWS_SECRET_ACCESS_KEY", true},
+		{"env", "GITHUB_TOKEN", false},
+		{"init", "config", true},
+	}
+
+	for _, tt := range tests {
+		err := caps.Check(tt.operation, tt.resource)
+		if (err == nil) != tt.allowed {
+			t.Errorf("Check(%q, %q) error = %v, want allowed %v", tt.operation, tt.resource, err, tt.allowed)
+		}
+	}
+}
+
+func TestCapabilities_DenyByDefault(t *testing.T) {
+	caps := &Capabilities{}
+
+	for _, op := range []string{"network", "read", "write", "env"} {
+		if err := caps.Check(op, "anything"); err == nil {
+			t.Errorf("Check(%q) with no capabilities should be denied", op)
+		}
+	}
+
+	if !(&Capabilities{Network: []string{"*"}}).AllowsNetwork("any.example") {
+		t.Error(`AllowsNetwork() with "*" should allow any host`)
+	}
+}
+
+func TestCapabilities_Symlinks(t *testing.T) {
+	root := t.TempDir()
+	allowed := filepath.Join(root, "allowed")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{allowed, outside} {
+		if err := os.Mkdir(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	if err := os.Symlink(allowed, filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	caps := &Capabilities{Write: []string{allowed}}
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{filepath.Join(allowed, "file"), true},
+		{filepath.Join(allowed, "escape", "secret"), false},
+		{filepath.Join(allowed, "escape", "new"), false},
+		{filepath.Join(root, "alias", "file"), true},
+	}
+
+	for _, tt := range tests {
+		if got := caps.AllowsWrite(tt.path); got != tt.allowed {
+			t.Errorf("AllowsWrite(%q) = %v, want %v", tt.path, got, tt.allowed)
+		}
+	}
+}
+
+func TestCapabilities_Environ(t *testing.T) {
+	caps := &Capabilities{Env: []string{"HOME", "AWS_*"}}
+	environ := []string{"HOME=/root", "PATH=/bin", "AWS_REGION=eu-west-1", "HOMEDIR=/x"}
+
+	got := caps.Environ(environ)
+	want := []string{"HOME=/root", "AWS_REGION=eu-west-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Environ() = %v, want %v", got, want)
+	}
+
+	if got := (&Capabilities{}).Environ(environ); got == nil || len(got) != 0 {
+		t.Errorf("Environ() with no capabilities = %#v, want an empty, non-nil slice", got)
+	}
+}
+
+func TestManifestPath(t *testing.T) {
+	tests := map[string]string{
+		"/plugins/s3.so":                   "/plugins/s3.manifest.json",
+		"/plugins/gdl-plugin-s3":           "/plugins/gdl-plugin-s3.manifest.json",
+		"/plugins/gdl-plugin-s3.exe":       "/plugins/gdl-plugin-s3.manifest.json",
+		"/plugins/gdl-plugin-s3-1.2.0":     "/plugins/gdl-plugin-s3-1.2.0.manifest.json",
+		"/plugins/s3-1.2.0.so":             "/plugins/s3-1.2.0.manifest.json",
+		"/plugins/gdl-plugin-s3-1.2.0.exe": "/plugins/gdl-plugin-s3-1.2.0.manifest.json",
+	}
+
+	for path, want := range tests {
+		if got := ManifestPath(path); got != want {
+			t.Errorf("ManifestPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	pluginPath := filepath.Join(dir, "s3.so")
+
+	manifest, err := LoadManifest(pluginPath)
+	if err != nil {
+		t.Fatalf("LoadManifest() without a manifest error = %v", err)
+	}
+	if !reflect.DeepEqual(manifest.Capabilities, Capabilities{}) {
+		t.Errorf("Capabilities without a manifest = %+v, want none", manifest.Capabilities)
+	}
+
+	data := `{"name":"s3","version":"1.0.0","capabilities":{"network":["*.amazonaws.com"],"env":["AWS_*"]}}`
+	if err := os.WriteFile(ManifestPath(pluginPath), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err = LoadManifest(pluginPath)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	if manifest.Name != "s3" || !manifest.Capabilities.AllowsNetwork("s3.amazonaws.com") || !manifest.Capabilities.AllowsEnv("AWS_REGION") {
+		t.Errorf("LoadManifest() = %+v", manifest)
+	}
+
+	if err := os.WriteFile(ManifestPath(pluginPath), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadManifest(pluginPath); err == nil {
+		t.Error("LoadManifest() of an invalid manifest should fail")
+	}
+}
+
+func TestSecurePlugin_WithCapabilities(t *testing.T) {
+	security := &PluginSecurity{
+		AllowedPaths:     []string{"/tmp"},
+		BlockedHosts:     []string{"blocked.example.com"},
+		NetworkAccess:    true,
+		FileSystemAccess: true,
+		ReadOnlyMode:     true,
+	}
+	caps := &Capabilities{
+		Network: []string{"*.example.com"},
+		Write:   []string{"/tmp/gdl"},
+	}
+	sp := NewSecurePlugin(NewMockPlugin("caps", "1.0.0"), security, "/tmp").WithCapabilities(caps)
+
+	if sp.Capabilities() != caps {
+		t.Error("Capabilities() should return the capabilities set")
+	}
+
+	tests := []struct {
+		operation string
+		resource  string
+		allowed   bool
+	}{
+		{"network", "api.example.com", true},
+		{"network", "other.test", false},          // not declared
+		{"network", "blocked.example.com", false}, // declared but blocked by the policy
+		{"read", "/tmp/gdl/file", true},
+		{"read", "/tmp/other", false},     // not declared
+		{"write", "/tmp/gdl/file", false}, // declared but the policy is read-only
+		{"env", "HOME", false},            // not declared
+		{"unknown", "resource", true},
+	}
+
+	for _, tt := range tests {
+		err := sp.ValidateAccess(tt.operation, tt.resource)
+		if (err == nil) != tt.allowed {
+			t.Errorf("ValidateAccess(%q, %q) error = %v, want allowed %v", tt.operation, tt.resource, err, tt.allowed)
+		}
+	}
+}
+
+func TestPluginManager_RegisterWithCapabilities(t *testing.T) {
+	pm := NewPluginManager()
+	pm.SetSecurity(&PluginSecurity{NetworkAccess: true})
+
+	if err := pm.Register(NewMockPlugin("undeclared", "1.0.0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.RegisterWithCapabilities(NewMockPlugin("declared", "1.0.0"), &Capabilities{Network: []string{"example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	undeclared, _ := pm.Get("undeclared")
+	if err := undeclared.ValidateAccess("network", "example.com"); err == nil {
+		t.Error("a plugin registered without capabilities should be denied network access")
+	}
+
+	declared, _ := pm.Get("declared")
+	if err := declared.ValidateAccess("network", "example.com"); err != nil {
+		t.Errorf("ValidateAccess() of a declared host error = %v", err)
+	}
+	if err := declared.ValidateAccess("network", "other.example"); err == nil {
+		t.Error("ValidateAccess() of an undeclared host should be denied")
+	}
+}
+
+func TestPluginManager_EnforcesCapabilitiesOnOperations(t *testing.T) {
+	dir := t.TempDir()
+	pm := NewPluginManager()
+	pm.SetSecurity(&PluginSecurity{NetworkAccess: true, FileSystemAccess: true})
+
+	storage := &helperStoragePlugin{helperPlugin{store: make(map[string][]byte)}}
+	if err := pm.RegisterWithCapabilities(storage, &Capabilities{Write: []string{filepath.Join(dir, "out")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.RegisterWithCapabilities(NewMockLoaderAuthPlugin("auth", "1.0.0"), &Capabilities{Network: []string{"api.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	p, _ := pm.Get("helper")
+	sp, ok := p.(StoragePlugin)
+	if !ok {
+		t.Fatalf("Get() of a storage plugin returned %T, which is not a StoragePlugin", p)
+	}
+	if err := sp.Store(ctx, []byte("data"), filepath.Join(dir, "out", "file")); err != nil {
+		t.Errorf("Store() below a declared path error = %v", err)
+	}
+	if err := sp.Store(ctx, []byte("data"), filepath.Join(dir, "other")); err == nil {
+		t.Error("Store() outside the declared paths should be refused")
+	}
+	if _, err := sp.Retrieve(ctx, filepath.Join(dir, "other")); err == nil {
+		t.Error("Retrieve() outside the declared paths should be refused")
+	}
+	if len(storage.store) != 1 {
+		t.Errorf("the plugin stored %d keys, want only the declared one", len(storage.store))
+	}
+
+	p, _ = pm.Get("auth")
+	ap, ok := p.(AuthPlugin)
+	if !ok {
+		t.Fatalf("Get() of an auth plugin returned %T, which is not an AuthPlugin", p)
+	}
+	declared, _ := http.NewRequest(http.MethodGet, "https://api.example.com/file", nil)
+	if err := ap.Authenticate(ctx, declared); err != nil {
+		t.Errorf("Authenticate() of a declared host error = %v", err)
+	}
+	undeclared, _ := http.NewRequest(http.MethodGet, "https://other.example.com/file", nil)
+	if err := ap.Authenticate(ctx, undeclared); err == nil {
+		t.Error("Authenticate() of an undeclared host should be refused")
+	}
+
+	// Registering a plugin that is already wrapped keeps its capabilities
+	other := NewPluginManager()
+	if err := other.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = other.Get("auth")
+	if err := p.(AuthPlugin).Authenticate(ctx, undeclared); err == nil {
+		t.Error("Authenticate() through a second manager should still be refused")
+	}
+}
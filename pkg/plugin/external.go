@@ -0,0 +1,415 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/http"
+	"net/rpc"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// Out-of-process plugins are separate executables that gdl starts and talks
+// to over their stdin and stdout with net/rpc. Unlike native .so plugins they
+// need not be built with the same Go toolchain as gdl, work on Windows, and
+// are versioned independently. A plugin binary calls Serve from its main
+// function.
+const (
+	// ExternalPluginPrefix starts the file name of out-of-process plugin
+	// executables, e.g. "gdl-plugin-s3" or "gdl-plugin-s3.exe".
+	ExternalPluginPrefix = "gdl-plugin-"
+
+	// ExternalProtocolVersion is the version of the host/plugin protocol. A
+	// plugin announcing another version is refused.
+	ExternalProtocolVersion = 1
+
+	// MagicCookieKey and MagicCookieValue are set in the environment of
+	// plugin processes so a plugin binary run by hand can tell it was not
+	// started by gdl.
+	MagicCookieKey   = "GDL_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "b4e3f1c2-gdl-out-of-process-plugin"
+
+	// handshakePrefix starts the line a plugin writes to stdout before it
+	// starts serving RPC.
+	handshakePrefix = "gdl-plugin|"
+
+	// maxHandshakeLines bounds the output skipped while waiting for the
+	// handshake line.
+	maxHandshakeLines = 100
+
+	// externalStartTimeout bounds how long a plugin may take to start.
+	externalStartTimeout = 10 * time.Second
+
+	// externalCloseTimeout bounds how long a plugin may take to exit after
+	// Close before it is killed.
+	externalCloseTimeout = 5 * time.Second
+)
+
+func init() {
+	// Config values decoded from JSON or YAML
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// IsExternalPlugin reports whether path names an out-of-process plugin
+// executable rather than a native .so plugin.
+func IsExternalPlugin(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasPrefix(base, ExternalPluginPrefix) && filepath.Ext(base) != ".so"
+}
+
+// ExternalPlugin is the host side of an out-of-process plugin. It implements
+// Plugin; LoadExternal returns it wrapped so that it also implements the
+// AuthPlugin, StoragePlugin or TransformPlugin interface the plugin process
+// serves.
+type ExternalPlugin struct {
+	path    string
+	name    string
+	version string
+	types   []string
+	cmd     *exec.Cmd
+	client  *rpc.Client
+	stdin   io.WriteCloser
+	exited  chan struct{}
+	broker  *broker
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// LoadExternal starts the plugin executable at path with args and connects to
+// it.
+func LoadExternal(path string, args ...string) (Plugin, error) {
+	// #nosec G204 -- the plugin path is chosen by the user
+	return NewExternalPlugin(exec.Command(path, args...))
+}
+
+// loadExternalSandboxed starts the plugin executable at path with only the
+// environment variables its manifest declares, and with its HTTP traffic and
+// host file access brokered by gdl (see startSandboxed).
+func loadExternalSandboxed(path string) (Plugin, error) {
+	manifest, err := LoadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// #nosec G204 -- the plugin path is chosen by the user
+	return startSandboxed(exec.Command(path), &manifest.Capabilities)
+}
+
+// startSandboxed starts cmd as an out-of-process plugin granted caps. Its
+// environment is filtered to the declared variables, and a broker that only
+// reaches the declared hosts and paths serves its HTTP proxy and Host. The
+// broker can't stop the process from opening sockets or files itself; that
+// takes an OS sandbox. Native plugins are not confined at all, as they run in
+// the gdl process.
+func startSandboxed(cmd *exec.Cmd, caps *Capabilities) (Plugin, error) {
+	b, err := startBroker(caps)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Env = append(caps.Environ(os.Environ()), b.environ()...)
+
+	plugin, err := newExternalPlugin(cmd, b)
+	if err != nil {
+		_ = b.Close()
+		return nil, err
+	}
+
+	return plugin, nil
+}
+
+// NewExternalPlugin starts cmd as an out-of-process plugin and connects to it.
+// The command's Stdin and Stdout are used for the connection and must not be
+// set; Stderr defaults to the host's stderr so plugin logs stay visible.
+func NewExternalPlugin(cmd *exec.Cmd) (Plugin, error) {
+	return newExternalPlugin(cmd, nil)
+}
+
+// newExternalPlugin starts cmd and connects to it. The plugin owns b, if any,
+// once it has started.
+func newExternalPlugin(cmd *exec.Cmd, b *broker) (Plugin, error) {
+	path := cmd.Path
+
+	if cmd.Stdin != nil || cmd.Stdout != nil {
+		return nil, gdlerrors.NewPluginError(path, nil, "plugin command must not set Stdin or Stdout")
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, MagicCookieKey+"="+MagicCookieValue)
+
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, gdlerrors.NewPluginError(path, err, "failed to create plugin stdin")
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, gdlerrors.NewPluginError(path, err, "failed to create plugin stdout")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, gdlerrors.NewPluginError(path, err, "failed to start plugin")
+	}
+
+	ep := &ExternalPlugin{
+		path:   path,
+		cmd:    cmd,
+		stdin:  stdin,
+		exited: make(chan struct{}),
+		broker: b,
+	}
+
+	go func() {
+		_ = cmd.Wait()
+		close(ep.exited)
+	}()
+
+	reader := bufio.NewReader(stdout)
+	if err := ep.awaitHandshake(reader); err != nil {
+		ep.kill()
+		return nil, err
+	}
+
+	ep.client = rpc.NewClient(&pluginConn{Reader: reader, WriteCloser: stdin})
+
+	var reply HandshakeReply
+	if err := ep.call(context.Background(), "Handshake", struct{}{}, &reply); err != nil {
+		ep.kill()
+		return nil, gdlerrors.NewPluginError(path, err, "plugin handshake failed")
+	}
+
+	ep.name = reply.Name
+	ep.version = reply.Version
+	ep.types = reply.Types
+
+	return ep.typed(), nil
+}
+
+// awaitHandshake skips output up to the plugin's handshake line and checks
+// its protocol version.
+func (ep *ExternalPlugin) awaitHandshake(reader *bufio.Reader) error {
+	lines := make(chan string, 1)
+	errs := make(chan error, 1)
+
+	go func() {
+		for i := 0; i < maxHandshakeLines; i++ {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if strings.HasPrefix(line, handshakePrefix) {
+				lines <- strings.TrimSpace(strings.TrimPrefix(line, handshakePrefix))
+				return
+			}
+		}
+
+		errs <- fmt.Errorf("no handshake in the first %d lines of output", maxHandshakeLines)
+	}()
+
+	select {
+	case version := <-lines:
+		if version != fmt.Sprint(ExternalProtocolVersion) {
+			return gdlerrors.NewPluginError(ep.path, nil,
+				fmt.Sprintf("unsupported plugin protocol version %s (want %d)", version, ExternalProtocolVersion))
+		}
+		return nil
+	case err := <-errs:
+		return gdlerrors.NewPluginError(ep.path, err, "plugin did not start")
+	case <-time.After(externalStartTimeout):
+		return gdlerrors.NewPluginError(ep.path, nil, "timed out waiting for plugin to start")
+	}
+}
+
+// typed wraps ep so it implements the interface of the plugin type it serves.
+// The order matches PluginLoader.determinePluginType.
+func (ep *ExternalPlugin) typed() Plugin {
+	switch {
+	case ep.serves("auth"):
+		return &externalAuthPlugin{ep}
+	case ep.serves("transform"):
+		return &externalTransformPlugin{ep}
+	case ep.serves("storage"):
+		return &externalStoragePlugin{ep}
+	default:
+		return ep
+	}
+}
+
+// serves reports whether the plugin process implements pluginType.
+func (ep *ExternalPlugin) serves(pluginType string) bool {
+	for _, t := range ep.types {
+		if t == pluginType {
+			return true
+		}
+	}
+	return false
+}
+
+// call invokes method on the plugin process, giving up when ctx is done.
+func (ep *ExternalPlugin) call(ctx context.Context, method string, args, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	call := ep.client.Go(rpcServiceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return gdlerrors.NewPluginError(ep.name, call.Error, method)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Name returns the name reported by the plugin process.
+func (ep *ExternalPlugin) Name() string {
+	return ep.name
+}
+
+// Version returns the version reported by the plugin process.
+func (ep *ExternalPlugin) Version() string {
+	return ep.version
+}
+
+// Path returns the plugin executable.
+func (ep *ExternalPlugin) Path() string {
+	return ep.path
+}
+
+// Init passes config to the plugin process.
+func (ep *ExternalPlugin) Init(config map[string]interface{}) error {
+	return ep.call(context.Background(), "Init", config, &struct{}{})
+}
+
+// ValidateAccess asks the plugin process whether it allows the access.
+func (ep *ExternalPlugin) ValidateAccess(operation string, resource string) error {
+	return ep.call(context.Background(), "ValidateAccess", &AccessArgs{Operation: operation, Resource: resource}, &struct{}{})
+}
+
+// Close closes the plugin and waits for its process to exit, killing it if it
+// does not exit in time.
+func (ep *ExternalPlugin) Close() error {
+	ep.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), externalCloseTimeout)
+		defer cancel()
+
+		ep.closeErr = ep.call(ctx, "Close", struct{}{}, &struct{}{})
+		_ = ep.client.Close()
+
+		select {
+		case <-ep.exited:
+		case <-time.After(externalCloseTimeout):
+			ep.kill()
+		}
+
+		ep.closeBroker()
+	})
+
+	return ep.closeErr
+}
+
+// kill stops the plugin process.
+func (ep *ExternalPlugin) kill() {
+	_ = ep.stdin.Close()
+	if ep.cmd.Process != nil {
+		_ = ep.cmd.Process.Kill()
+	}
+	<-ep.exited
+	ep.closeBroker()
+}
+
+// closeBroker stops the broker of a sandboxed plugin.
+func (ep *ExternalPlugin) closeBroker() {
+	if ep.broker != nil {
+		_ = ep.broker.Close()
+	}
+}
+
+// externalAuthPlugin is an out-of-process AuthPlugin.
+type externalAuthPlugin struct{ *ExternalPlugin }
+
+// Authenticate sends the request's method, URL and headers to the plugin
+// process and applies the URL and headers it returns.
+func (p *externalAuthPlugin) Authenticate(ctx context.Context, req *http.Request) error {
+	var reply AuthReply
+	args := &AuthArgs{Method: req.Method, URL: req.URL.String(), Header: req.Header}
+	if err := p.call(ctx, "Authenticate", args, &reply); err != nil {
+		return err
+	}
+
+	if reply.URL != args.URL {
+		u, err := url.Parse(reply.URL)
+		if err != nil {
+			return gdlerrors.NewPluginError(p.name, err, "plugin returned an invalid URL")
+		}
+		req.URL = u
+		req.Host = u.Host
+	}
+
+	for key := range req.Header {
+		delete(req.Header, key)
+	}
+	for key, values := range reply.Header {
+		req.Header[key] = values
+	}
+
+	return nil
+}
+
+// externalStoragePlugin is an out-of-process StoragePlugin.
+type externalStoragePlugin struct{ *ExternalPlugin }
+
+// Store sends data to the plugin process.
+func (p *externalStoragePlugin) Store(ctx context.Context, data []byte, key string) error {
+	return p.call(ctx, "Store", &StoreArgs{Key: key, Data: data}, &struct{}{})
+}
+
+// Retrieve reads data from the plugin process.
+func (p *externalStoragePlugin) Retrieve(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	if err := p.call(ctx, "Retrieve", key, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// externalTransformPlugin is an out-of-process TransformPlugin.
+type externalTransformPlugin struct{ *ExternalPlugin }
+
+// Transform sends data through the plugin process.
+func (p *externalTransformPlugin) Transform(data []byte) ([]byte, error) {
+	var out []byte
+	if err := p.call(context.Background(), "Transform", data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pluginConn joins the plugin's stdout and stdin into one connection.
+type pluginConn struct {
+	io.Reader
+	io.WriteCloser
+}
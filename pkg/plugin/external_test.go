@@ -0,0 +1,290 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// helperPluginEnv selects the plugin the test binary serves when it is started
+// as an out-of-process plugin by startHelperPlugin.
+const helperPluginEnv = "GDL_TEST_HELPER_PLUGIN"
+
+// helperPlugin is served by the helper process.
+type helperPlugin struct {
+	prefix string
+	store  map[string][]byte
+}
+
+func (p *helperPlugin) Name() string    { return "helper" }
+func (p *helperPlugin) Version() string { return "1.2.3" }
+func (p *helperPlugin) Close() error    { return nil }
+
+func (p *helperPlugin) Init(config map[string]interface{}) error {
+	prefix, ok := config["prefix"].(string)
+	if !ok {
+		return errors.New("prefix must be a string")
+	}
+	p.prefix = prefix
+	return nil
+}
+
+func (p *helperPlugin) ValidateAccess(operation, resource string) error {
+	if operation == "network" && resource != "example.com" {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+type helperAuthPlugin struct{ helperPlugin }
+
+func (p *helperAuthPlugin) Authenticate(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", p.prefix+"token")
+	req.Header.Del("X-Remove")
+	q := req.URL.Query()
+	q.Set("signed", "1")
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+type helperTransformPlugin struct{ helperPlugin }
+
+func (p *helperTransformPlugin) Transform(data []byte) ([]byte, error) {
+	return bytes.ToUpper(data), nil
+}
+
+type helperStoragePlugin struct{ helperPlugin }
+
+func (p *helperStoragePlugin) Store(ctx context.Context, data []byte, key string) error {
+	p.store[key] = data
+	return nil
+}
+
+func (p *helperStoragePlugin) Retrieve(ctx context.Context, key string) ([]byte, error) {
+	data, ok := p.store[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+// TestHelperPluginProcess is not a real test: startHelperPlugin runs the test
+// binary with it to serve a plugin over stdin and stdout.
+func TestHelperPluginProcess(t *testing.T) {
+	var p Plugin
+	switch os.Getenv(helperPluginEnv) {
+	case "":
+		return
+	case "auth":
+		p = &helperAuthPlugin{}
+	case "transform":
+		p = &helperTransformPlugin{}
+	case "storage":
+		p = &helperStoragePlugin{helperPlugin{store: map[string][]byte{}}}
+	case "host":
+		p = &helperHostPlugin{}
+	default:
+		p = &helperPlugin{}
+	}
+
+	if err := Serve(p); err != nil {
+		_, _ = os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// startHelperPlugin starts the test binary as an out-of-process plugin.
+func startHelperPlugin(t *testing.T, kind string) Plugin {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperPluginProcess$")
+	cmd.Env = append(os.Environ(), helperPluginEnv+"="+kind)
+
+	p, err := NewExternalPlugin(cmd)
+	if err != nil {
+		t.Fatalf("NewExternalPlugin() error = %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+
+	return p
+}
+
+func TestExternalPlugin_Base(t *testing.T) {
+	p := startHelperPlugin(t, "base")
+
+	if p.Name() != "helper" || p.Version() != "1.2.3" {
+		t.Errorf("Name(), Version() = %q, %q, want helper, 1.2.3", p.Name(), p.Version())
+	}
+
+	for _, iface := range []struct {
+		name string
+		ok   bool
+	}{
+		{"AuthPlugin", func() bool { _, ok := p.(AuthPlugin); return ok }()},
+		{"TransformPlugin", func() bool { _, ok := p.(TransformPlugin); return ok }()},
+		{"StoragePlugin", func() bool { _, ok := p.(StoragePlugin); return ok }()},
+	} {
+		if iface.ok {
+			t.Errorf("base plugin implements %s", iface.name)
+		}
+	}
+
+	if err := p.Init(map[string]interface{}{"prefix": "Bearer "}); err != nil {
+		t.Errorf("Init() error = %v", err)
+	}
+	if err := p.Init(map[string]interface{}{"prefix": 42}); err == nil {
+		t.Error("Init() with an invalid config should return the plugin's error")
+	}
+
+	if err := p.ValidateAccess("network", "example.com"); err != nil {
+		t.Errorf("ValidateAccess() error = %v", err)
+	}
+	if err := p.ValidateAccess("network", "evil.example"); err == nil || !strings.Contains(err.Error(), "plugin error") {
+		t.Errorf("ValidateAccess() error = %v, want a plugin error", err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestExternalPlugin_Auth(t *testing.T) {
+	p := startHelperPlugin(t, "auth")
+
+	auth, ok := p.(AuthPlugin)
+	if !ok {
+		t.Fatalf("plugin of type %T does not implement AuthPlugin", p)
+	}
+
+	if err := p.Init(map[string]interface{}{"prefix": "Bearer "}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/file.zip", nil)
+	req.Header.Set("X-Remove", "1")
+	req.Header.Set("X-Keep", "1")
+
+	if err := auth.Authenticate(context.Background(), req); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+
+	if got := req.Header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q, want %q", got, "Bearer token")
+	}
+	if req.Header.Get("X-Remove") != "" || req.Header.Get("X-Keep") != "1" {
+		t.Errorf("headers = %v, want X-Remove removed and X-Keep kept", req.Header)
+	}
+	if req.URL.Query().Get("signed") != "1" {
+		t.Errorf("URL = %s, want the signed URL", req.URL)
+	}
+}
+
+func TestExternalPlugin_TransformAndStorage(t *testing.T) {
+	transform, ok := startHelperPlugin(t, "transform").(TransformPlugin)
+	if !ok {
+		t.Fatal("transform plugin does not implement TransformPlugin")
+	}
+
+	out, err := transform.Transform([]byte("hello"))
+	if err != nil || string(out) != "HELLO" {
+		t.Errorf("Transform() = %q, %v, want HELLO", out, err)
+	}
+
+	storage, ok := startHelperPlugin(t, "storage").(StoragePlugin)
+	if !ok {
+		t.Fatal("storage plugin does not implement StoragePlugin")
+	}
+
+	ctx := context.Background()
+	if err := storage.Store(ctx, []byte("data"), "key"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	data, err := storage.Retrieve(ctx, "key")
+	if err != nil || string(data) != "data" {
+		t.Errorf("Retrieve() = %q, %v, want data", data, err)
+	}
+
+	if _, err := storage.Retrieve(ctx, "missing"); err == nil {
+		t.Error("Retrieve() of a missing key should fail")
+	}
+}
+
+func TestExternalPlugin_ContextCancel(t *testing.T) {
+	storage := startHelperPlugin(t, "storage").(StoragePlugin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := storage.Store(ctx, []byte("data"), "key"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Store() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestNewExternalPlugin_Errors(t *testing.T) {
+	t.Run("not a plugin", func(t *testing.T) {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Stderr = io.Discard
+		start := time.Now()
+
+		if _, err := NewExternalPlugin(cmd); err == nil {
+			t.Error("NewExternalPlugin() of a binary without a handshake should fail")
+		}
+		if time.Since(start) > externalStartTimeout {
+			t.Error("NewExternalPlugin() waited for the start timeout after the process exited")
+		}
+	})
+
+	t.Run("missing binary", func(t *testing.T) {
+		if _, err := LoadExternal("/nonexistent/gdl-plugin-missing"); err == nil {
+			t.Error("LoadExternal() of a missing binary should fail")
+		}
+	})
+
+	t.Run("stdout set", func(t *testing.T) {
+		cmd := exec.Command(os.Args[0])
+		cmd.Stdout = &bytes.Buffer{}
+
+		if _, err := NewExternalPlugin(cmd); err == nil {
+			t.Error("NewExternalPlugin() with Stdout set should fail")
+		}
+	})
+}
+
+func TestServe_WithoutHost(t *testing.T) {
+	t.Setenv(MagicCookieKey, "")
+
+	if err := Serve(&helperPlugin{}); err == nil {
+		t.Error("Serve() outside a gdl host should fail")
+	}
+}
+
+func TestIsExternalPlugin(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/plugins/gdl-plugin-s3", true},
+		{"/plugins/gdl-plugin-s3.exe", true},
+		{"/plugins/gdl-plugin-s3.so", false},
+		{"/plugins/s3.so", false},
+		{"/plugins/s3", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsExternalPlugin(tt.path); got != tt.want {
+			t.Errorf("IsExternalPlugin(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// Host is the plugin side of the broker gdl starts for an out-of-process
+// plugin. Files are read and written through it, and only those below the
+// paths the plugin's manifest declares are; the plugin's HTTP requests reach
+// only the declared hosts when they go through the proxy gdl sets in its
+// environment, as net/http's default transport does.
+type Host struct {
+	client *rpc.Client
+}
+
+// ConnectHost connects to the broker of the gdl process that started the
+// plugin.
+func ConnectHost() (*Host, error) {
+	addr, token := os.Getenv(HostAddrEnv), os.Getenv(HostTokenEnv)
+	if addr == "" || token == "" {
+		return nil, gdlerrors.NewPluginError("host", nil, "not started by gdl with a host broker")
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, gdlerrors.NewPluginError("host", err, "failed to connect to the host broker")
+	}
+
+	if _, err := fmt.Fprintln(conn, token); err != nil {
+		_ = conn.Close()
+		return nil, gdlerrors.NewPluginError("host", err, "failed to authenticate to the host broker")
+	}
+
+	return &Host{client: rpc.NewClient(conn)}, nil
+}
+
+// ReadFile returns the contents of the file at path.
+func (h *Host) ReadFile(path string) ([]byte, error) {
+	var data []byte
+	if err := h.client.Call(hostServiceName+".ReadFile", path, &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// WriteFile creates or replaces the file at path with data.
+func (h *Host) WriteFile(path string, data []byte) error {
+	return h.client.Call(hostServiceName+".WriteFile", &HostWriteArgs{Path: path, Data: data}, &struct{}{})
+}
+
+// Remove deletes the file or empty directory at path.
+func (h *Host) Remove(path string) error {
+	return h.client.Call(hostServiceName+".Remove", path, &struct{}{})
+}
+
+// Close disconnects from the broker.
+func (h *Host) Close() error {
+	return h.client.Close()
+}
@@ -59,12 +59,26 @@ type TransformPlugin interface {
 	Transform(data []byte) ([]byte, error)
 }
 
-// SecurePlugin wraps a plugin with security constraints
+// StreamTransformPlugin transforms data as it streams through, so large
+// downloads can be recompressed or filtered without holding them in memory.
+// TransformStream reads input until EOF and writes the result to output; it
+// should return promptly with ctx's error once ctx is done.
+type StreamTransformPlugin interface {
+	Plugin
+	TransformStream(ctx context.Context, input io.Reader, output io.Writer) error
+}
+
+// SecurePlugin wraps a plugin with security constraints. The constraints are
+// checked against the arguments gdl passes to the plugin's methods; they do
+// not confine the plugin's own code. A native plugin runs in the gdl process
+// with its full access, so only an out-of-process plugin, run under an OS
+// sandbox, is actually confined.
 type SecurePlugin struct {
 	Plugin
-	security  *PluginSecurity
-	validator *SecurityValidator
-	monitor   *ResourceMonitor
+	security     *PluginSecurity
+	validator    *SecurityValidator
+	monitor      *ResourceMonitor
+	capabilities *Capabilities
 }
 
 // NewSecurePlugin creates a new secure plugin wrapper
@@ -77,8 +91,31 @@ func NewSecurePlugin(plugin Plugin, security *PluginSecurity, basePath string) *
 	}
 }
 
+// WithCapabilities restricts the plugin to the capabilities it declared, on
+// top of the security policy. A nil caps denies every capability.
+func (sp *SecurePlugin) WithCapabilities(caps *Capabilities) *SecurePlugin {
+	if caps == nil {
+		caps = &Capabilities{}
+	}
+	sp.capabilities = caps
+	return sp
+}
+
+// Capabilities returns the capabilities the plugin is restricted to, or nil if
+// only the security policy applies.
+func (sp *SecurePlugin) Capabilities() *Capabilities {
+	return sp.capabilities
+}
+
 // ValidateAccess implements security validation for the wrapped plugin
 func (sp *SecurePlugin) ValidateAccess(operation string, resource string) error {
+	// Deny anything the plugin did not declare
+	if sp.capabilities != nil {
+		if err := sp.capabilities.Check(operation, resource); err != nil {
+			return err
+		}
+	}
+
 	// Check if operation requires file system access
 	if operation == "read" || operation == "write" || operation == "create" || operation == "delete" {
 		return sp.validator.ValidateFileOperation(operation, resource)
@@ -119,3 +156,136 @@ func (sp *SecurePlugin) Close() error {
 
 	return sp.Plugin.Close()
 }
+
+// secure returns sp; the typed wrappers inherit it, so the manager can tell a
+// plugin that is already wrapped.
+func (sp *SecurePlugin) secure() *SecurePlugin {
+	return sp
+}
+
+// typed wraps sp so it implements the interface of the plugin type the
+// wrapped plugin serves, and checks the plugin's capabilities before each of
+// its operations. The order matches PluginLoader.determinePluginType.
+func (sp *SecurePlugin) typed() Plugin {
+	if _, ok := sp.Plugin.(AuthPlugin); ok {
+		return &secureAuthPlugin{sp}
+	}
+	if _, ok := sp.Plugin.(TransformPlugin); ok {
+		if _, ok := sp.Plugin.(StreamTransformPlugin); ok {
+			return &secureDualTransformPlugin{&secureTransformPlugin{sp}}
+		}
+		return &secureTransformPlugin{sp}
+	}
+	if _, ok := sp.Plugin.(StreamTransformPlugin); ok {
+		return &secureStreamTransformPlugin{sp}
+	}
+	if _, ok := sp.Plugin.(StoragePlugin); ok {
+		return &secureStoragePlugin{sp}
+	}
+	if _, ok := sp.Plugin.(ProtocolPlugin); ok {
+		return &secureProtocolPlugin{sp}
+	}
+	if _, ok := sp.Plugin.(DownloadPlugin); ok {
+		return &secureDownloadPlugin{sp}
+	}
+
+	return sp
+}
+
+// secureAuthPlugin is an AuthPlugin that may only authenticate requests to
+// the hosts it declared.
+type secureAuthPlugin struct{ *SecurePlugin }
+
+// Authenticate checks the request's host, then authenticates it.
+func (p *secureAuthPlugin) Authenticate(ctx context.Context, req *http.Request) error {
+	if err := p.ValidateAccess("network", req.URL.Host); err != nil {
+		return err
+	}
+
+	return p.Plugin.(AuthPlugin).Authenticate(ctx, req)
+}
+
+// secureStoragePlugin is a StoragePlugin that may only store below the paths
+// it declared writable and retrieve below the paths it declared readable.
+type secureStoragePlugin struct{ *SecurePlugin }
+
+// Store checks that key may be written, then stores data under it.
+func (p *secureStoragePlugin) Store(ctx context.Context, data []byte, key string) error {
+	if err := p.ValidateAccess("write", key); err != nil {
+		return err
+	}
+
+	return p.Plugin.(StoragePlugin).Store(ctx, data, key)
+}
+
+// Retrieve checks that key may be read, then retrieves it.
+func (p *secureStoragePlugin) Retrieve(ctx context.Context, key string) ([]byte, error) {
+	if err := p.ValidateAccess("read", key); err != nil {
+		return nil, err
+	}
+
+	return p.Plugin.(StoragePlugin).Retrieve(ctx, key)
+}
+
+// secureProtocolPlugin is a ProtocolPlugin that may only download from the
+// hosts it declared.
+type secureProtocolPlugin struct{ *SecurePlugin }
+
+// SupportedSchemes returns the schemes of the wrapped plugin.
+func (p *secureProtocolPlugin) SupportedSchemes() []string {
+	return p.Plugin.(ProtocolPlugin).SupportedSchemes()
+}
+
+// Download checks the host of url, then downloads it.
+func (p *secureProtocolPlugin) Download(ctx context.Context, url string, writer io.Writer) error {
+	if err := p.ValidateAccess("network", url); err != nil {
+		return err
+	}
+
+	return p.Plugin.(ProtocolPlugin).Download(ctx, url, writer)
+}
+
+// secureDownloadPlugin is a DownloadPlugin that only sees downloads from the
+// hosts it declared.
+type secureDownloadPlugin struct{ *SecurePlugin }
+
+// PreDownload checks the host of the request's URL, then runs the hook.
+func (p *secureDownloadPlugin) PreDownload(ctx context.Context, req *DownloadRequest) error {
+	if err := p.ValidateAccess("network", req.URL); err != nil {
+		return err
+	}
+
+	return p.Plugin.(DownloadPlugin).PreDownload(ctx, req)
+}
+
+// PostDownload runs the hook of the wrapped plugin.
+func (p *secureDownloadPlugin) PostDownload(ctx context.Context, resp *DownloadResponse) error {
+	return p.Plugin.(DownloadPlugin).PostDownload(ctx, resp)
+}
+
+// secureTransformPlugin is a TransformPlugin. Transforms only see the data
+// passed to them, which needs no capability.
+type secureTransformPlugin struct{ *SecurePlugin }
+
+// Transform transforms data with the wrapped plugin.
+func (p *secureTransformPlugin) Transform(data []byte) ([]byte, error) {
+	return p.Plugin.(TransformPlugin).Transform(data)
+}
+
+// secureStreamTransformPlugin is a StreamTransformPlugin. Like
+// secureTransformPlugin it needs no capability.
+type secureStreamTransformPlugin struct{ *SecurePlugin }
+
+// TransformStream transforms input with the wrapped plugin.
+func (p *secureStreamTransformPlugin) TransformStream(ctx context.Context, input io.Reader, output io.Writer) error {
+	return p.Plugin.(StreamTransformPlugin).TransformStream(ctx, input, output)
+}
+
+// secureDualTransformPlugin is a plugin that is both a TransformPlugin and a
+// StreamTransformPlugin.
+type secureDualTransformPlugin struct{ *secureTransformPlugin }
+
+// TransformStream transforms input with the wrapped plugin.
+func (p *secureDualTransformPlugin) TransformStream(ctx context.Context, input io.Reader, output io.Writer) error {
+	return p.Plugin.(StreamTransformPlugin).TransformStream(ctx, input, output)
+}
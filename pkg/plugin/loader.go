@@ -27,7 +27,8 @@ type PluginInfo struct {
 	NativePlugin *plugin.Plugin `json:"-"`
 }
 
-// PluginLoader handles dynamic loading of Go plugins
+// PluginLoader handles dynamic loading of Go plugins and out-of-process plugin
+// executables
 type PluginLoader struct {
 	searchPaths    []string
 	loadedPlugins  map[string]*PluginInfo
@@ -102,22 +103,21 @@ func (pl *PluginLoader) Load(path string) (Plugin, error) {
 		}
 	}
 
-	// Load the plugin
-	nativePlugin, err := plugin.Open(path)
-	if err != nil {
-		return nil, gdlerrors.NewPluginError(path, err, "failed to open plugin")
-	}
-
-	// Look for the Plugin symbol
-	symbol, err := nativePlugin.Lookup("Plugin")
-	if err != nil {
-		return nil, gdlerrors.NewPluginError(path, err, "does not export 'Plugin' symbol")
-	}
-
-	// Validate that the symbol implements the Plugin interface
-	pluginInstance, ok := symbol.(Plugin)
-	if !ok {
-		return nil, gdlerrors.NewPluginError(path, nil, "does not implement Plugin interface")
+	// Load the plugin: start an out-of-process plugin, or open a native one
+	var (
+		pluginInstance Plugin
+		nativePlugin   *plugin.Plugin
+	)
+	if IsExternalPlugin(path) {
+		pluginInstance, err = loadExternalSandboxed(path)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		pluginInstance, nativePlugin, err = openNative(path)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Create plugin info
@@ -141,6 +141,28 @@ func (pl *PluginLoader) Load(path string) (Plugin, error) {
 	return pluginInstance, nil
 }
 
+// openNative opens a native Go plugin and looks up its Plugin symbol
+func openNative(path string) (Plugin, *plugin.Plugin, error) {
+	nativePlugin, err := plugin.Open(path)
+	if err != nil {
+		return nil, nil, gdlerrors.NewPluginError(path, err, "failed to open plugin")
+	}
+
+	// Look for the Plugin symbol
+	symbol, err := nativePlugin.Lookup("Plugin")
+	if err != nil {
+		return nil, nil, gdlerrors.NewPluginError(path, err, "does not export 'Plugin' symbol")
+	}
+
+	// Validate that the symbol implements the Plugin interface
+	pluginInstance, ok := symbol.(Plugin)
+	if !ok {
+		return nil, nil, gdlerrors.NewPluginError(path, nil, "does not implement Plugin interface")
+	}
+
+	return pluginInstance, nativePlugin, nil
+}
+
 // LoadFromSearchPath loads a plugin by searching through configured search paths
 func (pl *PluginLoader) LoadFromSearchPath(filename string) (Plugin, error) {
 	for _, searchPath := range pl.searchPaths {
@@ -186,8 +208,8 @@ func (pl *PluginLoader) DiscoverPlugins() ([]string, error) {
 				return nil
 			}
 
-			// Check if it's a .so file (Go plugin)
-			if strings.HasSuffix(path, ".so") {
+			// Check if it's a .so file (Go plugin) or a plugin executable
+			if strings.HasSuffix(path, ".so") || IsExternalPlugin(path) {
 				discovered = append(discovered, path)
 			}
 
@@ -386,6 +408,9 @@ func (pl *PluginLoader) determinePluginType(pluginInstance Plugin) string {
 	if _, ok := pluginInstance.(TransformPlugin); ok {
 		return "transform"
 	}
+	if _, ok := pluginInstance.(StreamTransformPlugin); ok {
+		return "transform"
+	}
 	if _, ok := pluginInstance.(StoragePlugin); ok {
 		return "storage"
 	}
@@ -45,8 +45,16 @@ func NewPluginManager() *PluginManager {
 	}
 }
 
-// Register adds a plugin to the manager
+// Register adds a plugin to the manager. The plugin is granted no
+// capabilities; use RegisterWithCapabilities for plugins that declare some.
 func (pm *PluginManager) Register(plugin Plugin) error {
+	return pm.RegisterWithCapabilities(plugin, nil)
+}
+
+// RegisterWithCapabilities adds a plugin to the manager, restricted to caps,
+// usually the capabilities declared in its manifest. Accesses outside caps are
+// denied even when the security policy would allow them.
+func (pm *PluginManager) RegisterWithCapabilities(plugin Plugin, caps *Capabilities) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -57,13 +65,16 @@ func (pm *PluginManager) Register(plugin Plugin) error {
 		return err
 	}
 
-	// Wrap plugin with security if not already wrapped
-	securePlugin := plugin
-	if _, isSecure := plugin.(*SecurePlugin); !isSecure {
-		securePlugin = NewSecurePlugin(plugin, pm.security, ".")
+	// Wrap plugin with security if not already wrapped, and keep its plugin
+	// type so the capabilities are checked before each of its operations
+	var securePlugin *SecurePlugin
+	if wrapped, isSecure := plugin.(interface{ secure() *SecurePlugin }); isSecure {
+		securePlugin = wrapped.secure()
+	} else {
+		securePlugin = NewSecurePlugin(plugin, pm.security, ".").WithCapabilities(caps)
 	}
 
-	pm.plugins[name] = securePlugin
+	pm.plugins[name] = securePlugin.typed()
 	return nil
 }
 
@@ -0,0 +1,201 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs a Recompressor can store downloads in.
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+// codecExtensions maps the codecs, including bzip2 which is only read, to
+// their file extensions.
+var codecExtensions = map[string]string{
+	CodecGzip: ".gz",
+	CodecZstd: ".zst",
+	"bzip2":   ".bz2",
+}
+
+// Recompressor is a built-in streaming transform that stores a download in
+// another compression format: it recognizes gzip, zstd and bzip2 input by its
+// magic bytes, decompresses it and compresses the result with its codec.
+// Input that is not compressed is compressed as it is, and input already in
+// the target codec is passed through untouched.
+type Recompressor struct {
+	codec string
+}
+
+// NewRecompressor creates a Recompressor storing downloads with codec:
+// CodecGzip, CodecZstd or CodecNone to store them decompressed.
+func NewRecompressor(codec string) (*Recompressor, error) {
+	r := &Recompressor{}
+	if err := r.Init(map[string]interface{}{"codec": codec}); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// ValidateCodec checks that codec is one a Recompressor can write.
+func ValidateCodec(codec string) error {
+	switch codec {
+	case CodecNone, CodecGzip, CodecZstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression codec %q (want none, gzip or zstd)", codec)
+	}
+}
+
+// RecompressedName returns name with its compression extension replaced by
+// that of codec, so "data.json.gz" stored as zstd becomes "data.json.zst".
+func RecompressedName(name, codec string) string {
+	for _, ext := range codecExtensions {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+
+	return name + codecExtensions[codec]
+}
+
+func (r *Recompressor) Name() string    { return "recompress" }
+func (r *Recompressor) Version() string { return "1.0.0" }
+func (r *Recompressor) Close() error    { return nil }
+
+// Init sets the codec from config["codec"].
+func (r *Recompressor) Init(config map[string]interface{}) error {
+	codec, _ := config["codec"].(string)
+	if err := ValidateCodec(codec); err != nil {
+		return err
+	}
+
+	r.codec = codec
+
+	return nil
+}
+
+// ValidateAccess allows everything: the transform only touches the stream.
+func (r *Recompressor) ValidateAccess(operation string, resource string) error {
+	return nil
+}
+
+// Transform recompresses data held in memory.
+func (r *Recompressor) Transform(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	if err := r.TransformStream(context.Background(), bytes.NewReader(data), &out); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// TransformStream decompresses input and writes it to output compressed with
+// the Recompressor's codec.
+func (r *Recompressor) TransformStream(ctx context.Context, input io.Reader, output io.Writer) error {
+	buffered := bufio.NewReader(&contextReader{ctx: ctx, r: input})
+
+	source, err := sniffCodec(buffered)
+	if err != nil {
+		return err
+	}
+
+	if source == r.codec {
+		_, err := io.Copy(output, buffered)
+		return err
+	}
+
+	decompressed, err := decompressor(source, buffered)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = decompressed.Close() }()
+
+	compressed, err := compressor(r.codec, output)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(compressed, decompressed); err != nil {
+		_ = compressed.Close()
+		return err
+	}
+
+	return compressed.Close()
+}
+
+// sniffCodec returns the codec the input starts with, or CodecNone.
+func sniffCodec(r *bufio.Reader) (string, error) {
+	magic, err := r.Peek(4)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return CodecGzip, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return CodecZstd, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return "bzip2", nil
+	default:
+		return CodecNone, nil
+	}
+}
+
+// decompressor returns a reader of the decompressed input.
+func decompressor(codec string, r io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case "bzip2":
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// compressor returns a writer compressing into w; closing it flushes the
+// compressed stream but leaves w open.
+func compressor(codec string, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case CodecGzip:
+		return gzip.NewWriter(w), nil
+	case CodecZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// contextReader fails reads once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// decompress reads data compressed with codec.
+func decompress(t *testing.T, codec string, data []byte) []byte {
+	t.Helper()
+
+	r, err := decompressor(codec, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decompressor(%s) error = %v", codec, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading %s data: %v", codec, err)
+	}
+
+	return out
+}
+
+func TestRecompressor(t *testing.T) {
+	plain := []byte(strings.Repeat("gdl recompresses downloads on the fly\n", 100))
+	gzipped := gzipData(t, plain)
+
+	zstdEncoder, _ := zstd.NewWriter(nil)
+	zstded := zstdEncoder.EncodeAll(plain, nil)
+
+	tests := []struct {
+		name  string
+		codec string
+		input []byte
+		want  string
+	}{
+		{"gzip to zstd", CodecZstd, gzipped, CodecZstd},
+		{"zstd to gzip", CodecGzip, zstded, CodecGzip},
+		{"gzip decompressed", CodecNone, gzipped, CodecNone},
+		{"plain compressed", CodecZstd, plain, CodecZstd},
+		{"plain kept", CodecNone, plain, CodecNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRecompressor(tt.codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			if err := r.TransformStream(context.Background(), bytes.NewReader(tt.input), &out); err != nil {
+				t.Fatalf("TransformStream() error = %v", err)
+			}
+
+			codec, _ := sniffCodec(bufio.NewReader(bytes.NewReader(out.Bytes())))
+			if codec != tt.want {
+				t.Fatalf("output codec = %s, want %s", codec, tt.want)
+			}
+			if got := decompress(t, codec, out.Bytes()); !bytes.Equal(got, plain) {
+				t.Errorf("output decompresses to %d bytes, want the original %d", len(got), len(plain))
+			}
+		})
+	}
+
+	// Input already in the target codec is not recompressed
+	r, _ := NewRecompressor(CodecGzip)
+	out, err := r.Transform(gzipped)
+	if err != nil || !bytes.Equal(out, gzipped) {
+		t.Errorf("Transform() of gzip to gzip changed the data (err = %v)", err)
+	}
+
+	r, _ = NewRecompressor(CodecZstd)
+	if _, err := r.Transform([]byte{0x1f, 0x8b, 0, 0}); err == nil {
+		t.Error("Transform() of corrupt gzip data succeeded")
+	}
+
+	if _, err := NewRecompressor("brotli"); err == nil {
+		t.Error("NewRecompressor(brotli) should fail")
+	}
+}
+
+func TestRecompressorPipeline(t *testing.T) {
+	plain := []byte("streamed through the pipeline\n")
+
+	r, _ := NewRecompressor(CodecNone)
+
+	var out bytes.Buffer
+	w := NewTransformPipeline(r).Writer(context.Background(), &out)
+	if _, err := w.Write(gzipData(t, plain)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Errorf("pipeline output = %q, want %q", out.String(), plain)
+	}
+}
+
+func TestRecompressedName(t *testing.T) {
+	tests := []struct {
+		name, codec, want string
+	}{
+		{"data.json.gz", CodecZstd, "data.json.zst"},
+		{"data.json.zst", CodecNone, "data.json"},
+		{"dump.sql.bz2", CodecGzip, "dump.sql.gz"},
+		{"data.json", CodecGzip, "data.json.gz"},
+		{"data.json", CodecNone, "data.json"},
+	}
+
+	for _, tt := range tests {
+		if got := RecompressedName(tt.name, tt.codec); got != tt.want {
+			t.Errorf("RecompressedName(%q, %s) = %q, want %q", tt.name, tt.codec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/rpc"
+	"os"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// rpcServiceName is the net/rpc service out-of-process plugins serve.
+const rpcServiceName = "Plugin"
+
+// HandshakeReply describes an out-of-process plugin to the host.
+type HandshakeReply struct {
+	Name    string
+	Version string
+	Types   []string // "auth", "transform", "storage"
+}
+
+// AccessArgs are the arguments of ValidateAccess.
+type AccessArgs struct {
+	Operation string
+	Resource  string
+}
+
+// AuthArgs carry the parts of a request an AuthPlugin may change.
+type AuthArgs struct {
+	Method string
+	URL    string
+	Header http.Header
+}
+
+// AuthReply is the request as changed by an AuthPlugin.
+type AuthReply struct {
+	URL    string
+	Header http.Header
+}
+
+// StoreArgs are the arguments of StoragePlugin.Store.
+type StoreArgs struct {
+	Key  string
+	Data []byte
+}
+
+// Serve runs p as an out-of-process plugin, answering the gdl host over stdin
+// and stdout until the host disconnects. It is called from the plugin
+// binary's main function; the plugin must not write to stdout itself and
+// should log to stderr instead.
+//
+//	func main() {
+//		if err := plugin.Serve(&MyAuthPlugin{}); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//	}
+func Serve(p Plugin) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return gdlerrors.NewPluginError(p.Name(), nil,
+			"this binary is a gdl plugin; install it with 'gdl plugin install' instead of running it directly")
+	}
+
+	return ServeConn(p, struct {
+		io.Reader
+		io.WriteCloser
+	}{os.Stdin, os.Stdout})
+}
+
+// ServeConn serves p to a host over conn until the host disconnects.
+func ServeConn(p Plugin, conn io.ReadWriteCloser) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(rpcServiceName, &rpcServer{impl: p}); err != nil {
+		return gdlerrors.NewPluginError(p.Name(), err, "failed to register plugin server")
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s%d\n", handshakePrefix, ExternalProtocolVersion); err != nil {
+		return gdlerrors.NewPluginError(p.Name(), err, "failed to write handshake")
+	}
+
+	server.ServeConn(conn)
+
+	return nil
+}
+
+// rpcServer exposes a Plugin over net/rpc.
+type rpcServer struct {
+	impl Plugin
+}
+
+// Handshake reports the plugin's name, version and types.
+func (s *rpcServer) Handshake(_ struct{}, reply *HandshakeReply) error {
+	reply.Name = s.impl.Name()
+	reply.Version = s.impl.Version()
+
+	if _, ok := s.impl.(AuthPlugin); ok {
+		reply.Types = append(reply.Types, "auth")
+	}
+	if _, ok := s.impl.(TransformPlugin); ok {
+		reply.Types = append(reply.Types, "transform")
+	}
+	if _, ok := s.impl.(StoragePlugin); ok {
+		reply.Types = append(reply.Types, "storage")
+	}
+
+	return nil
+}
+
+// Init calls Plugin.Init.
+func (s *rpcServer) Init(config map[string]interface{}, _ *struct{}) error {
+	return s.impl.Init(config)
+}
+
+// Close calls Plugin.Close.
+func (s *rpcServer) Close(_ struct{}, _ *struct{}) error {
+	return s.impl.Close()
+}
+
+// ValidateAccess calls Plugin.ValidateAccess.
+func (s *rpcServer) ValidateAccess(args *AccessArgs, _ *struct{}) error {
+	return s.impl.ValidateAccess(args.Operation, args.Resource)
+}
+
+// Authenticate calls AuthPlugin.Authenticate on a request rebuilt from args.
+func (s *rpcServer) Authenticate(args *AuthArgs, reply *AuthReply) error {
+	auth, ok := s.impl.(AuthPlugin)
+	if !ok {
+		return fmt.Errorf("plugin %s is not an auth plugin", s.impl.Name())
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), args.Method, args.URL, nil)
+	if err != nil {
+		return err
+	}
+	if args.Header != nil {
+		req.Header = args.Header
+	}
+
+	if err := auth.Authenticate(req.Context(), req); err != nil {
+		return err
+	}
+
+	reply.URL = req.URL.String()
+	reply.Header = req.Header
+
+	return nil
+}
+
+// Store calls StoragePlugin.Store.
+func (s *rpcServer) Store(args *StoreArgs, _ *struct{}) error {
+	storage, ok := s.impl.(StoragePlugin)
+	if !ok {
+		return fmt.Errorf("plugin %s is not a storage plugin", s.impl.Name())
+	}
+
+	return storage.Store(context.Background(), args.Data, args.Key)
+}
+
+// Retrieve calls StoragePlugin.Retrieve.
+func (s *rpcServer) Retrieve(key string, data *[]byte) error {
+	storage, ok := s.impl.(StoragePlugin)
+	if !ok {
+		return fmt.Errorf("plugin %s is not a storage plugin", s.impl.Name())
+	}
+
+	out, err := storage.Retrieve(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	*data = out
+
+	return nil
+}
+
+// Transform calls TransformPlugin.Transform.
+func (s *rpcServer) Transform(data []byte, out *[]byte) error {
+	transform, ok := s.impl.(TransformPlugin)
+	if !ok {
+		return fmt.Errorf("plugin %s is not a transform plugin", s.impl.Name())
+	}
+
+	result, err := transform.Transform(data)
+	if err != nil {
+		return err
+	}
+	*out = result
+
+	return nil
+}
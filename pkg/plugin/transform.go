@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// BufferedTransform adapts a TransformPlugin to StreamTransformPlugin. The
+// adapted plugin still reads the whole input into memory before transforming
+// it; implement StreamTransformPlugin directly to avoid that.
+func BufferedTransform(p TransformPlugin) StreamTransformPlugin {
+	return &bufferedTransform{p}
+}
+
+// bufferedTransform runs a TransformPlugin on the whole input at once.
+type bufferedTransform struct {
+	TransformPlugin
+}
+
+// TransformStream reads input, transforms it and writes the result to output.
+func (b *bufferedTransform) TransformStream(ctx context.Context, input io.Reader, output io.Writer) error {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	transformed, err := b.Transform(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = output.Write(transformed)
+
+	return err
+}
+
+// TransformPipeline chains streaming transforms so a download passes through
+// each of them in turn while it is written, holding only the pipe buffers
+// between stages in memory.
+type TransformPipeline struct {
+	stages []StreamTransformPlugin
+	mu     sync.RWMutex
+}
+
+// NewTransformPipeline creates a pipeline running stages in order.
+func NewTransformPipeline(stages ...StreamTransformPlugin) *TransformPipeline {
+	return &TransformPipeline{stages: stages}
+}
+
+// Add appends stages to the pipeline.
+func (tp *TransformPipeline) Add(stages ...StreamTransformPlugin) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.stages = append(tp.stages, stages...)
+}
+
+// Len returns the number of stages.
+func (tp *TransformPipeline) Len() int {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	return len(tp.stages)
+}
+
+// Writer returns a writer whose data is passed through every stage and
+// written to dst. Closing it flushes the stages and returns the first error
+// any of them failed with; the caller must close it. Cancelling ctx aborts
+// the stages. With no stages, writes go straight to dst.
+func (tp *TransformPipeline) Writer(ctx context.Context, dst io.Writer) io.WriteCloser {
+	tp.mu.RLock()
+	stages := append([]StreamTransformPlugin(nil), tp.stages...)
+	tp.mu.RUnlock()
+
+	pw := &pipelineWriter{done: make(chan struct{}), errs: make(chan error, len(stages))}
+
+	if len(stages) == 0 {
+		pw.WriteCloser = nopWriteCloser{dst}
+		close(pw.done)
+		return pw
+	}
+
+	ctx, pw.cancel = context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	// Build the chain back to front: each stage reads from its own pipe and
+	// writes into the next stage's pipe, the last one into dst.
+	next := dst
+	for i := len(stages) - 1; i >= 0; i-- {
+		pr, pwr := io.Pipe()
+		stage, output := stages[i], next
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := stage.TransformStream(ctx, pr, output)
+			if err != nil {
+				err = gdlerrors.NewPluginError(stage.Name(), err, "transform failed")
+				pw.errs <- err
+			}
+
+			// Unblock the previous stage, whether it is done or not
+			_ = pr.CloseWithError(errOrClosed(err))
+
+			// Signal end of input to the next stage
+			if closer, ok := output.(*io.PipeWriter); ok {
+				_ = closer.CloseWithError(err)
+			}
+		}()
+
+		next = pwr
+	}
+
+	pw.WriteCloser = next.(*io.PipeWriter)
+
+	go func() {
+		wg.Wait()
+		close(pw.done)
+	}()
+
+	return pw
+}
+
+// errOrClosed returns err, or io.ErrClosedPipe so writes to a stage that
+// stopped reading early fail instead of blocking.
+func errOrClosed(err error) error {
+	if err != nil {
+		return err
+	}
+	return io.ErrClosedPipe
+}
+
+// pipelineWriter is the input end of a running pipeline.
+type pipelineWriter struct {
+	io.WriteCloser
+	cancel context.CancelFunc
+	done   chan struct{}
+	errs   chan error
+	once   sync.Once
+	err    error
+}
+
+// Close ends the input and waits for every stage to finish.
+func (pw *pipelineWriter) Close() error {
+	pw.once.Do(func() {
+		pw.err = pw.WriteCloser.Close()
+		<-pw.done
+
+		if pw.cancel != nil {
+			pw.cancel()
+		}
+
+		select {
+		case err := <-pw.errs:
+			pw.err = err
+		default:
+		}
+	})
+
+	return pw.err
+}
+
+// nopWriteCloser adds a no-op Close to a writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
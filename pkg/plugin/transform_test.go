@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// streamStage is a streaming transform built from a line mapping function.
+type streamStage struct {
+	name string
+	fn   func(line string) (string, error)
+}
+
+func (s *streamStage) Name() string                                           { return s.name }
+func (s *streamStage) Version() string                                        { return "1.0.0" }
+func (s *streamStage) Init(config map[string]interface{}) error               { return nil }
+func (s *streamStage) Close() error                                           { return nil }
+func (s *streamStage) ValidateAccess(operation string, resource string) error { return nil }
+
+func (s *streamStage) TransformStream(ctx context.Context, input io.Reader, output io.Writer) error {
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := s.fn(scanner.Text())
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(output, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// upperTransform is a buffered TransformPlugin.
+type upperTransform struct{ streamStage }
+
+func (u *upperTransform) Transform(data []byte) ([]byte, error) {
+	return bytes.ToUpper(data), nil
+}
+
+func TestTransformPipeline(t *testing.T) {
+	prefix := &streamStage{name: "prefix", fn: func(line string) (string, error) { return "> " + line, nil }}
+	reverse := &streamStage{name: "reverse", fn: func(line string) (string, error) {
+		runes := []rune(line)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	}}
+
+	tests := []struct {
+		name   string
+		stages []StreamTransformPlugin
+		want   string
+	}{
+		{"no stages", nil, "ab\ncd\n"},
+		{"one stage", []StreamTransformPlugin{prefix}, "> ab\n> cd\n"},
+		{"in order", []StreamTransformPlugin{prefix, reverse}, "ba >\ndc >\n"},
+		{"buffered", []StreamTransformPlugin{BufferedTransform(&upperTransform{}), prefix}, "> AB\n> CD\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline := NewTransformPipeline(tt.stages...)
+			if pipeline.Len() != len(tt.stages) {
+				t.Errorf("Len() = %d, want %d", pipeline.Len(), len(tt.stages))
+			}
+
+			var out bytes.Buffer
+			w := pipeline.Writer(context.Background(), &out)
+
+			if _, err := io.Copy(w, strings.NewReader("ab\ncd\n")); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformPipeline_StageError(t *testing.T) {
+	errBad := errors.New("bad line")
+	failing := &streamStage{name: "failing", fn: func(line string) (string, error) {
+		if line == "bad" {
+			return "", errBad
+		}
+		return line, nil
+	}}
+	passthrough := &streamStage{name: "passthrough", fn: func(line string) (string, error) { return line, nil }}
+
+	pipeline := NewTransformPipeline(passthrough, failing)
+
+	var out bytes.Buffer
+	w := pipeline.Writer(context.Background(), &out)
+
+	// Enough input that the writes cannot all be buffered by the pipes
+	input := "good\nbad\n" + strings.Repeat("more\n", 100000)
+	_, _ = io.Copy(w, strings.NewReader(input))
+
+	if err := w.Close(); !errors.Is(err, errBad) {
+		t.Errorf("Close() error = %v, want %v", err, errBad)
+	}
+}
+
+func TestTransformPipeline_Cancel(t *testing.T) {
+	stage := &streamStage{name: "stage", fn: func(line string) (string, error) { return line, nil }}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := NewTransformPipeline(stage).Writer(ctx, io.Discard)
+
+	cancel()
+	_, _ = io.WriteString(w, "line\n")
+
+	if err := w.Close(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Close() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestTransformPipeline_Add(t *testing.T) {
+	pipeline := NewTransformPipeline()
+	pipeline.Add(BufferedTransform(&upperTransform{}))
+
+	var out bytes.Buffer
+	w := pipeline.Writer(context.Background(), &out)
+	_, _ = io.WriteString(w, "abc")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if out.String() != "ABC" {
+		t.Errorf("output = %q, want ABC", out.String())
+	}
+}
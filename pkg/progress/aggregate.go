@@ -0,0 +1,202 @@
+package progress
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// AggregateCallback is called whenever the batch-level progress changes.
+type AggregateCallback func(snapshot types.AggregateSnapshot)
+
+// jobState describes where a single job is in its lifecycle.
+type jobState int
+
+const (
+	jobPending jobState = iota
+	jobActive
+	jobCompleted
+	jobFailed
+)
+
+// Aggregator merges the progress of several downloads into batch-level totals.
+// It implements the types.AggregateProgress interface.
+type Aggregator struct {
+	notify   sync.Mutex // Serializes updates and their callbacks
+	mu       sync.RWMutex
+	jobs     map[string]*jobProgress
+	order    []string
+	callback AggregateCallback
+}
+
+// jobProgress tracks a single job and implements types.Progress.
+type jobProgress struct {
+	aggregator *Aggregator
+	id         string
+	filename   string
+	state      jobState
+	total      int64
+	downloaded int64
+	speed      int64
+}
+
+// NewAggregator creates a new Aggregator. The callback is optional and is
+// invoked with a fresh snapshot after every job update, one call at a time and
+// in the order of the updates. It may call Snapshot, but not report progress
+// of a job.
+func NewAggregator(callback AggregateCallback) *Aggregator {
+	return &Aggregator{
+		jobs:     make(map[string]*jobProgress),
+		callback: callback,
+	}
+}
+
+// Job returns the progress tracker for the job with the given ID, registering
+// it with the aggregate on first use.
+func (a *Aggregator) Job(id string) types.Progress {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if job, exists := a.jobs[id]; exists {
+		return job
+	}
+
+	job := &jobProgress{aggregator: a, id: id}
+	a.jobs[id] = job
+	a.order = append(a.order, id)
+
+	return job
+}
+
+// Snapshot returns the current batch-level totals.
+func (a *Aggregator) Snapshot() types.AggregateSnapshot {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.snapshot()
+}
+
+// snapshot computes the totals (must be called with lock held).
+func (a *Aggregator) snapshot() types.AggregateSnapshot {
+	snapshot := types.AggregateSnapshot{
+		TotalJobs:  len(a.jobs),
+		Percentage: -1,
+	}
+
+	for _, id := range a.order {
+		job := a.jobs[id]
+
+		switch job.state {
+		case jobActive:
+			snapshot.ActiveJobs++
+			snapshot.Speed += job.speed
+		case jobCompleted:
+			snapshot.CompletedJobs++
+		case jobFailed:
+			snapshot.FailedJobs++
+		}
+
+		if job.total > 0 {
+			snapshot.TotalBytes += job.total
+		}
+
+		snapshot.DownloadedBytes += job.downloaded
+	}
+
+	if snapshot.TotalBytes > 0 {
+		snapshot.Percentage = float64(snapshot.DownloadedBytes) / float64(snapshot.TotalBytes) * 100
+		if snapshot.Percentage > 100 {
+			snapshot.Percentage = 100
+		}
+	}
+
+	return snapshot
+}
+
+// update applies a change to a job and notifies the callback. Concurrent
+// updates wait for the callback of the previous one, so snapshots are
+// delivered in order.
+func (a *Aggregator) update(apply func()) {
+	a.notify.Lock()
+	defer a.notify.Unlock()
+
+	a.mu.Lock()
+	apply()
+	snapshot := a.snapshot()
+	a.mu.Unlock()
+
+	if a.callback != nil {
+		a.callback(snapshot)
+	}
+}
+
+// Start is called when the job begins.
+func (j *jobProgress) Start(filename string, totalSize int64) {
+	j.aggregator.update(func() {
+		j.filename = filename
+		j.total = totalSize
+		j.state = jobActive
+	})
+}
+
+// Update is called periodically while the job is downloading.
+func (j *jobProgress) Update(bytesDownloaded, totalSize int64, speed int64) {
+	j.aggregator.update(func() {
+		j.downloaded = bytesDownloaded
+		if totalSize > 0 {
+			j.total = totalSize
+		}
+
+		j.speed = speed
+		if j.state == jobPending {
+			j.state = jobActive
+		}
+	})
+}
+
+// Finish is called when the job completes successfully.
+func (j *jobProgress) Finish(filename string, stats *types.DownloadStats) {
+	j.aggregator.update(func() {
+		if stats != nil {
+			j.downloaded = stats.BytesDownloaded
+			if j.total <= 0 {
+				j.total = stats.BytesDownloaded
+			}
+		}
+
+		j.speed = 0
+		j.state = jobCompleted
+	})
+}
+
+// Error is called when the job fails.
+func (j *jobProgress) Error(filename string, err error) {
+	j.aggregator.update(func() {
+		j.speed = 0
+		j.state = jobFailed
+	})
+}
+
+// FormatAggregate returns a human-readable single-line summary of a batch snapshot.
+func FormatAggregate(snapshot types.AggregateSnapshot) string {
+	done := snapshot.CompletedJobs + snapshot.FailedJobs
+
+	line := fmt.Sprintf("[%d/%d jobs", done, snapshot.TotalJobs)
+	if snapshot.FailedJobs > 0 {
+		line += fmt.Sprintf(", %d failed", snapshot.FailedJobs)
+	}
+
+	line += "] "
+
+	if snapshot.Percentage >= 0 {
+		line += fmt.Sprintf("%.1f%% (%s/%s)",
+			snapshot.Percentage,
+			formatBytes(snapshot.DownloadedBytes),
+			formatBytes(snapshot.TotalBytes))
+	} else {
+		line += formatBytes(snapshot.DownloadedBytes) + " downloaded"
+	}
+
+	return line + fmt.Sprintf(" at %s/s", formatBytes(snapshot.Speed))
+}
@@ -0,0 +1,188 @@
+package progress
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+func TestAggregatorImplementsInterface(t *testing.T) {
+	var _ types.AggregateProgress = NewAggregator(nil)
+}
+
+func TestAggregatorJobReturnsSameTracker(t *testing.T) {
+	agg := NewAggregator(nil)
+
+	first := agg.Job("a")
+	second := agg.Job("a")
+
+	if first != second {
+		t.Error("Job() should return the same tracker for the same ID")
+	}
+
+	if got := agg.Snapshot().TotalJobs; got != 1 {
+		t.Errorf("TotalJobs = %d, want 1", got)
+	}
+}
+
+func TestAggregatorSnapshot(t *testing.T) {
+	agg := NewAggregator(nil)
+
+	a := agg.Job("a")
+	b := agg.Job("b")
+	c := agg.Job("c")
+
+	a.Start("a.bin", 1000)
+	a.Update(500, 1000, 100)
+	b.Start("b.bin", 3000)
+	b.Update(1500, 3000, 300)
+	c.Start("c.bin", 0)
+
+	snapshot := agg.Snapshot()
+	if snapshot.TotalJobs != 3 {
+		t.Errorf("TotalJobs = %d, want 3", snapshot.TotalJobs)
+	}
+
+	if snapshot.ActiveJobs != 3 {
+		t.Errorf("ActiveJobs = %d, want 3", snapshot.ActiveJobs)
+	}
+
+	if snapshot.TotalBytes != 4000 {
+		t.Errorf("TotalBytes = %d, want 4000", snapshot.TotalBytes)
+	}
+
+	if snapshot.DownloadedBytes != 2000 {
+		t.Errorf("DownloadedBytes = %d, want 2000", snapshot.DownloadedBytes)
+	}
+
+	if snapshot.Speed != 400 {
+		t.Errorf("Speed = %d, want 400", snapshot.Speed)
+	}
+
+	if snapshot.Percentage != 50 {
+		t.Errorf("Percentage = %f, want 50", snapshot.Percentage)
+	}
+
+	a.Finish("a.bin", &types.DownloadStats{BytesDownloaded: 1000})
+	b.Error("b.bin", errors.New("boom"))
+
+	snapshot = agg.Snapshot()
+	if snapshot.CompletedJobs != 1 || snapshot.FailedJobs != 1 || snapshot.ActiveJobs != 1 {
+		t.Errorf("job counts = %d/%d/%d, want 1/1/1",
+			snapshot.CompletedJobs, snapshot.FailedJobs, snapshot.ActiveJobs)
+	}
+
+	if snapshot.Speed != 0 {
+		t.Errorf("Speed = %d, want 0 once active jobs stop reporting", snapshot.Speed)
+	}
+}
+
+func TestAggregatorUnknownSize(t *testing.T) {
+	agg := NewAggregator(nil)
+
+	job := agg.Job("a")
+	job.Start("a.bin", -1)
+	job.Update(100, -1, 10)
+
+	snapshot := agg.Snapshot()
+	if snapshot.Percentage != -1 {
+		t.Errorf("Percentage = %f, want -1 for unknown size", snapshot.Percentage)
+	}
+
+	if !strings.Contains(FormatAggregate(snapshot), "downloaded") {
+		t.Errorf("FormatAggregate() = %q, want unknown-size format", FormatAggregate(snapshot))
+	}
+}
+
+func TestAggregatorCallback(t *testing.T) {
+	var calls int
+
+	var last types.AggregateSnapshot
+
+	agg := NewAggregator(func(snapshot types.AggregateSnapshot) {
+		calls++
+		last = snapshot
+	})
+
+	job := agg.Job("a")
+	job.Start("a.bin", 100)
+	job.Update(100, 100, 50)
+	job.Finish("a.bin", &types.DownloadStats{BytesDownloaded: 100})
+
+	if calls != 3 {
+		t.Errorf("callback called %d times, want 3", calls)
+	}
+
+	if last.CompletedJobs != 1 || last.Percentage != 100 {
+		t.Errorf("last snapshot = %+v, want one completed job at 100%%", last)
+	}
+}
+
+func TestAggregatorCallbackOrder(t *testing.T) {
+	const jobs, updates = 8, 100
+
+	var (
+		active  atomic.Int32
+		overlap atomic.Bool
+		last    int64
+	)
+
+	agg := NewAggregator(func(snapshot types.AggregateSnapshot) {
+		if active.Add(1) > 1 {
+			overlap.Store(true)
+		}
+		defer active.Add(-1)
+
+		// Every update adds a byte, so snapshots in order never go back
+		if snapshot.DownloadedBytes < last {
+			t.Errorf("snapshot of %d bytes after one of %d", snapshot.DownloadedBytes, last)
+		}
+		last = snapshot.DownloadedBytes
+	})
+
+	var wg sync.WaitGroup
+	for i := range jobs {
+		job := agg.Job(strconv.Itoa(i))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for n := range updates {
+				job.Update(int64(n+1), updates, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if overlap.Load() {
+		t.Error("callback was called concurrently")
+	}
+	if last != jobs*updates {
+		t.Errorf("last snapshot has %d bytes, want %d", last, jobs*updates)
+	}
+}
+
+func TestFormatAggregate(t *testing.T) {
+	snapshot := types.AggregateSnapshot{
+		TotalJobs:       4,
+		CompletedJobs:   2,
+		FailedJobs:      1,
+		TotalBytes:      2048,
+		DownloadedBytes: 1024,
+		Speed:           512,
+		Percentage:      50,
+	}
+
+	got := FormatAggregate(snapshot)
+	want := "[3/4 jobs, 1 failed] 50.0% (1.0 KB/2.0 KB) at 512 B/s"
+
+	if got != want {
+		t.Errorf("FormatAggregate() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package progress
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultSpeedWindow is the smoothing window of a SpeedEstimator created
+// with a zero window.
+const DefaultSpeedWindow = 5 * time.Second
+
+// minSpeedSample is the shortest interval a speed is measured over; updates
+// closer together than this are folded into the next sample, since a few
+// bytes over a few microseconds say little about the transfer rate.
+const minSpeedSample = 100 * time.Millisecond
+
+// SpeedEstimator turns a stream of byte counts into an instantaneous speed
+// and an exponential moving average (EMA) of it. Each sample is weighted by
+// the time it covers, so the average responds to changes over about one
+// window regardless of how often it is updated. It is safe for concurrent use.
+type SpeedEstimator struct {
+	mu       sync.Mutex
+	window   time.Duration
+	started  bool
+	sampled  bool
+	lastSize int64
+	lastTime time.Time
+	instant  float64
+	smoothed float64
+}
+
+// NewSpeedEstimator creates a SpeedEstimator averaging over window
+// (DefaultSpeedWindow if 0). A longer window gives a steadier speed that is
+// slower to follow real changes.
+func NewSpeedEstimator(window time.Duration) *SpeedEstimator {
+	if window <= 0 {
+		window = DefaultSpeedWindow
+	}
+
+	return &SpeedEstimator{window: window}
+}
+
+// Update records that downloaded bytes have been transferred in total and
+// returns the instantaneous and smoothed speeds in bytes per second. Both are
+// 0 until a first sample has been measured.
+func (e *SpeedEstimator) Update(downloaded int64) (instant, smoothed int64) {
+	return e.update(downloaded, time.Now())
+}
+
+func (e *SpeedEstimator) update(downloaded int64, now time.Time) (int64, int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// A smaller count means the transfer restarted, e.g. after a retry
+	if !e.started || downloaded < e.lastSize {
+		e.started = true
+		e.lastSize = downloaded
+		e.lastTime = now
+
+		return int64(e.instant), int64(e.smoothed)
+	}
+
+	elapsed := now.Sub(e.lastTime)
+	if elapsed < minSpeedSample {
+		return int64(e.instant), int64(e.smoothed)
+	}
+
+	e.instant = float64(downloaded-e.lastSize) / elapsed.Seconds()
+	if e.sampled {
+		alpha := 1 - math.Exp(-elapsed.Seconds()/e.window.Seconds())
+		e.smoothed += alpha * (e.instant - e.smoothed)
+	} else {
+		e.smoothed = e.instant
+		e.sampled = true
+	}
+
+	e.lastSize = downloaded
+	e.lastTime = now
+
+	return int64(e.instant), int64(e.smoothed)
+}
+
+// ETA estimates the time needed for the remaining bytes at the smoothed
+// speed, or 0 if no speed has been measured yet.
+func (e *SpeedEstimator) ETA(remaining int64) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if remaining <= 0 || e.smoothed < 1 {
+		return 0
+	}
+
+	return time.Duration(float64(remaining) / e.smoothed * float64(time.Second))
+}
@@ -0,0 +1,71 @@
+package progress
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpeedEstimator(t *testing.T) {
+	e := NewSpeedEstimator(time.Second)
+	start := time.Now()
+
+	if instant, smoothed := e.update(0, start); instant != 0 || smoothed != 0 {
+		t.Errorf("first update = %d, %d, want 0, 0", instant, smoothed)
+	}
+
+	// The first sample sets both speeds
+	instant, smoothed := e.update(1000, start.Add(time.Second))
+	if instant != 1000 || smoothed != 1000 {
+		t.Errorf("update = %d, %d, want 1000, 1000", instant, smoothed)
+	}
+
+	// Updates closer together than a sample keep the last speeds
+	if instant, _ := e.update(1500, start.Add(time.Second+10*time.Millisecond)); instant != 1000 {
+		t.Errorf("update within a sample: instant = %d, want 1000", instant)
+	}
+
+	// A burst moves the smoothed speed only part of the way
+	instant, smoothed = e.update(11000, start.Add(2*time.Second))
+	if instant != 10000 {
+		t.Errorf("instant = %d, want 10000", instant)
+	}
+	if smoothed <= 1000 || smoothed >= 10000 {
+		t.Errorf("smoothed = %d, want between 1000 and 10000", smoothed)
+	}
+
+	if eta := e.ETA(int64(smoothed) * 3); eta < 2900*time.Millisecond || eta > 3100*time.Millisecond {
+		t.Errorf("ETA = %s, want about 3s", eta)
+	}
+
+	// A restarted transfer keeps the speeds until the next sample
+	if _, got := e.update(0, start.Add(3*time.Second)); got != smoothed {
+		t.Errorf("smoothed after restart = %d, want %d", got, smoothed)
+	}
+}
+
+func TestSpeedEstimatorWindow(t *testing.T) {
+	steady := func(window time.Duration) int64 {
+		e := NewSpeedEstimator(window)
+		start := time.Now()
+
+		e.update(0, start)
+		e.update(1000, start.Add(time.Second))
+
+		_, smoothed := e.update(2000, start.Add(1100*time.Millisecond))
+
+		return smoothed
+	}
+
+	// 10000 B/s for 100ms pulls a short window further than a long one
+	if short, long := steady(time.Second), steady(time.Minute); short <= long {
+		t.Errorf("smoothed with 1s window = %d, with 1m window = %d", short, long)
+	}
+
+	if e := NewSpeedEstimator(0); e.window != DefaultSpeedWindow {
+		t.Errorf("window = %s, want %s", e.window, DefaultSpeedWindow)
+	}
+
+	if eta := NewSpeedEstimator(0).ETA(100); eta != 0 {
+		t.Errorf("ETA without a sample = %s, want 0", eta)
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"context"
 	"sync"
 	"time"
-
-	"golang.org/x/time/rate"
 )
 
 // Limiter interface defines the contract for bandwidth limiting.
@@ -25,78 +23,214 @@ type Limiter interface {
 	SetRate(bytesPerSec int64)
 }
 
-// BandwidthLimiter implements thread-safe bandwidth limiting using a token bucket algorithm.
+// DefaultBurstDuration is how much data, expressed as time at the configured
+// rate, a BandwidthLimiter lets through at once by default. Keeping it short
+// makes the delivered rate steady within a fraction of a second.
+const DefaultBurstDuration = 50 * time.Millisecond
+
+// MinBurst is the smallest default burst in bytes for rates above it, so
+// slow rates are not enforced with tiny reads.
+const MinBurst = 4 * 1024
+
+// DefaultBurst returns the default burst in bytes for a rate in bytes per
+// second: DefaultBurstDuration worth of data, at least MinBurst or one second
+// of data, whichever is smaller.
+func DefaultBurst(bytesPerSec int64) int64 {
+	if bytesPerSec <= 0 {
+		return 0
+	}
+
+	burst := bytesPerSec * int64(DefaultBurstDuration) / int64(time.Second)
+
+	return max(burst, min(bytesPerSec, MinBurst))
+}
+
+// BandwidthLimiter implements thread-safe bandwidth limiting using a token
+// bucket. The bucket holds up to the burst size and is refilled continuously
+// at the configured rate. Wait may take more tokens than the bucket holds; the
+// caller then waits until the debt is repaid, so reads larger than the burst
+// are throttled instead of rejected.
 type BandwidthLimiter struct {
-	mu      sync.RWMutex
-	limiter *rate.Limiter
-	maxRate int64 // bytes per second, 0 means unlimited
+	mu       sync.Mutex
+	maxRate  int64 // bytes per second, 0 means unlimited
+	burst    int64 // configured burst, 0 means DefaultBurst(maxRate)
+	capacity float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
 }
 
-// NewBandwidthLimiter creates a new bandwidth limiter.
+// NewBandwidthLimiter creates a new bandwidth limiter with the default burst.
 // maxRate is in bytes per second. A value of 0 means unlimited.
 func NewBandwidthLimiter(maxRate int64) *BandwidthLimiter {
+	return NewBandwidthLimiterWithBurst(maxRate, 0)
+}
+
+// NewBandwidthLimiterWithBurst creates a bandwidth limiter that lets up to
+// burst bytes through at once. A burst of 0 selects DefaultBurst(maxRate).
+func NewBandwidthLimiterWithBurst(maxRate, burst int64) *BandwidthLimiter {
 	bl := &BandwidthLimiter{
-		maxRate: maxRate,
+		burst: max(burst, 0),
+		now:   time.Now,
 	}
 
-	if maxRate > 0 {
-		// Create rate limiter with the specified rate and a burst of 1 second worth of data
-		// This allows for some burstiness while maintaining the overall rate
-		bl.limiter = rate.NewLimiter(rate.Limit(maxRate), int(maxRate))
-	}
+	bl.setRateLocked(maxRate)
+	bl.tokens = bl.capacity
 
 	return bl
 }
 
-// Wait blocks until the limiter allows n bytes to be processed.
+// Wait blocks until the limiter allows n bytes to be processed. It returns
+// the context's error if the context is done, or context.DeadlineExceeded
+// without waiting if the deadline would pass first.
 func (bl *BandwidthLimiter) Wait(ctx context.Context, n int) error {
-	bl.mu.RLock()
-	limiter := bl.limiter
-	bl.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	// If no rate limit is set, allow immediately
-	if limiter == nil {
+	bl.mu.Lock()
+
+	if bl.maxRate <= 0 {
+		bl.mu.Unlock()
 		return nil
 	}
 
-	// Wait for the required tokens
-	return limiter.WaitN(ctx, n)
+	now := bl.now()
+	delay := bl.delayLocked(now, n)
+
+	if deadline, ok := ctx.Deadline(); ok && delay > 0 && now.Add(delay).After(deadline) {
+		bl.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+
+	// Taking the tokens up front keeps concurrent waiters in order
+	bl.tokens -= float64(n)
+	bl.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the tokens back so an abandoned wait does not slow other readers
+		bl.mu.Lock()
+		bl.tokens = min(bl.tokens+float64(n), bl.capacity)
+		bl.mu.Unlock()
+
+		return ctx.Err()
+	}
 }
 
-// Allow reports whether n bytes can be processed immediately.
+// Allow reports whether n bytes can be processed immediately, taking the
+// tokens if so.
 func (bl *BandwidthLimiter) Allow(n int) bool {
-	bl.mu.RLock()
-	limiter := bl.limiter
-	bl.mu.RUnlock()
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
 
 	// If no rate limit is set, allow immediately
-	if limiter == nil {
+	if bl.maxRate <= 0 {
 		return true
 	}
 
-	return limiter.AllowN(time.Now(), n)
+	if bl.delayLocked(bl.now(), n) > 0 {
+		return false
+	}
+
+	bl.tokens -= float64(n)
+
+	return true
 }
 
 // Rate returns the current rate limit in bytes per second.
 func (bl *BandwidthLimiter) Rate() int64 {
-	bl.mu.RLock()
-	defer bl.mu.RUnlock()
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
 	return bl.maxRate
 }
 
-// SetRate updates the rate limit. A value of 0 means unlimited.
+// Burst returns the bucket size in bytes, or 0 when unlimited.
+func (bl *BandwidthLimiter) Burst() int64 {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	return int64(bl.capacity)
+}
+
+// SetRate updates the rate limit. A value of 0 means unlimited. Tokens
+// accumulated so far are kept up to the new burst size.
 func (bl *BandwidthLimiter) SetRate(bytesPerSec int64) {
 	bl.mu.Lock()
 	defer bl.mu.Unlock()
 
-	bl.maxRate = bytesPerSec
+	bl.setRateLocked(bytesPerSec)
+}
 
-	if bytesPerSec <= 0 {
-		bl.limiter = nil
-	} else {
-		// Update the existing limiter or create a new one
-		bl.limiter = rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec))
+func (bl *BandwidthLimiter) setRateLocked(bytesPerSec int64) {
+	if bl.maxRate > 0 {
+		bl.refillLocked(bl.now())
+	}
+
+	bl.maxRate = max(bytesPerSec, 0)
+	bl.last = bl.now()
+
+	if bl.maxRate == 0 {
+		bl.capacity = 0
+		bl.tokens = 0
+
+		return
+	}
+
+	burst := bl.burst
+	if burst == 0 {
+		burst = DefaultBurst(bl.maxRate)
+	}
+
+	bl.capacity = float64(burst)
+	bl.tokens = min(bl.tokens, bl.capacity)
+}
+
+// refillLocked adds the tokens accumulated since the last refill.
+func (bl *BandwidthLimiter) refillLocked(now time.Time) {
+	if elapsed := now.Sub(bl.last); elapsed > 0 {
+		bl.tokens = min(bl.capacity, bl.tokens+elapsed.Seconds()*float64(bl.maxRate))
+		bl.last = now
+	}
+}
+
+// delayLocked refills the bucket and returns how long taking n tokens has to
+// wait for.
+func (bl *BandwidthLimiter) delayLocked(now time.Time, n int) time.Duration {
+	bl.refillLocked(now)
+
+	deficit := float64(n) - bl.tokens
+	if deficit <= 0 {
+		return 0
+	}
+
+	return time.Duration(deficit / float64(bl.maxRate) * float64(time.Second))
+}
+
+// MaxRead returns how many of size bytes to read before calling Wait, so
+// throttled reads stay within the limiter's burst and the delivered rate
+// stays steady. Limiters without a burst leave size unchanged.
+func MaxRead(l Limiter, size int) int {
+	b, ok := l.(interface{ Burst() int64 })
+	if !ok {
+		return size
+	}
+
+	if burst := b.Burst(); burst > 0 && int64(size) > burst {
+		return int(burst)
 	}
+
+	return size
 }
 
 // NullLimiter is a no-op limiter that allows unlimited bandwidth.
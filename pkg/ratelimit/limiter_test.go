@@ -2,6 +2,7 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -403,3 +404,218 @@ func TestBandwidthLimiter_RateLimitingAccuracy(t *testing.T) {
 		t.Errorf("Rate limiting too slow: %v", duration)
 	}
 }
+
+// fakeClock is a manually advanced clock for deterministic limiter tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// simulate reads total bytes through bl in reads of at most readSize bytes,
+// advancing the fake clock by each delay Wait would sleep for, and returns
+// the bytes delivered in each whole second.
+func simulate(bl *BandwidthLimiter, clock *fakeClock, total int64, readSize int) []int64 {
+	start := clock.t
+	var perSecond []int64
+
+	for total > 0 {
+		n := int(min(int64(MaxRead(bl, readSize)), total))
+
+		bl.mu.Lock()
+		delay := bl.delayLocked(clock.t, n)
+		bl.tokens -= float64(n)
+		bl.mu.Unlock()
+
+		clock.t = clock.t.Add(delay)
+		total -= int64(n)
+
+		second := int(clock.t.Sub(start) / time.Second)
+		for len(perSecond) <= second {
+			perSecond = append(perSecond, 0)
+		}
+
+		perSecond[second] += int64(n)
+	}
+
+	return perSecond
+}
+
+func TestBandwidthLimiter_SteadyRate(t *testing.T) {
+	const rate = 100 * 1024
+
+	tests := []struct {
+		name     string
+		burst    int64
+		readSize int
+	}{
+		{"default burst, small reads", 0, 4 * 1024},
+		{"default burst, large reads", 0, 1024 * 1024},
+		{"custom burst", 4 * 1024, 32 * 1024},
+		{"burst larger than reads", 64 * 1024, 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Unix(0, 0)}
+			bl := NewBandwidthLimiterWithBurst(rate, tt.burst)
+			bl.now = clock.now
+			bl.last = clock.t
+
+			perSecond := simulate(bl, clock, 10*rate, tt.readSize)
+
+			// Every full one-second window after the first, which includes the
+			// initial burst, must stay within 5% of the rate
+			for i, got := range perSecond[1 : len(perSecond)-1] {
+				if got < rate*95/100 || got > rate*105/100 {
+					t.Errorf("second %d delivered %d bytes, want %d ±5%%", i+1, got, rate)
+				}
+			}
+		})
+	}
+}
+
+func TestBandwidthLimiter_WaitLargerThanBurst(t *testing.T) {
+	limiter := NewBandwidthLimiterWithBurst(10*1024, 1024)
+	ctx := context.Background()
+
+	// Drain the initial burst
+	if err := limiter.Wait(ctx, 1024); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	start := time.Now()
+	if err := limiter.Wait(ctx, 2048); err != nil {
+		t.Fatalf("Wait() larger than the burst should throttle, got error %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Wait(2048) at 10KB/s returned after %v, want about 200ms", elapsed)
+	}
+}
+
+func TestBandwidthLimiter_CancelledWaitRefunds(t *testing.T) {
+	limiter := NewBandwidthLimiterWithBurst(10*1024, 1024)
+
+	// Drain the initial burst
+	if err := limiter.Wait(context.Background(), 1024); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- limiter.Wait(ctx, 10*1024) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Wait() error = %v, want context.Canceled", err)
+	}
+
+	start := time.Now()
+	if err := limiter.Wait(context.Background(), 100); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Wait(100) after a cancelled wait took %v, want no delay from the abandoned tokens", elapsed)
+	}
+}
+
+func TestBandwidthLimiter_Burst(t *testing.T) {
+	if got := NewBandwidthLimiter(0).Burst(); got != 0 {
+		t.Errorf("unlimited Burst() = %d, want 0", got)
+	}
+
+	if got := NewBandwidthLimiterWithBurst(1024*1024, 8192).Burst(); got != 8192 {
+		t.Errorf("Burst() = %d, want 8192", got)
+	}
+
+	limiter := NewBandwidthLimiter(1024 * 1024)
+	if got, want := limiter.Burst(), DefaultBurst(1024*1024); got != want {
+		t.Errorf("default Burst() = %d, want %d", got, want)
+	}
+
+	limiter.SetRate(10 * 1024 * 1024)
+	if got, want := limiter.Burst(), DefaultBurst(10*1024*1024); got != want {
+		t.Errorf("Burst() after SetRate = %d, want %d", got, want)
+	}
+}
+
+func TestDefaultBurst(t *testing.T) {
+	tests := []struct {
+		rate int64
+		want int64
+	}{
+		{0, 0},
+		{-1, 0},
+		{100, 100},
+		{10 * 1024, MinBurst},
+		{100 * 1024, 5120},
+		{10 * 1024 * 1024, 524288},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultBurst(tt.rate); got != tt.want {
+			t.Errorf("DefaultBurst(%d) = %d, want %d", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestMaxRead(t *testing.T) {
+	limiter := NewBandwidthLimiterWithBurst(1024*1024, 4096)
+
+	tests := []struct {
+		name    string
+		limiter Limiter
+		size    int
+		want    int
+	}{
+		{"nil limiter", nil, 32768, 32768},
+		{"null limiter", NewNullLimiter(), 32768, 32768},
+		{"capped at burst", limiter, 32768, 4096},
+		{"below burst", limiter, 1000, 1000},
+		{"unlimited", NewBandwidthLimiter(0), 32768, 32768},
+	}
+
+	for _, tt := range tests {
+		if got := MaxRead(tt.limiter, tt.size); got != tt.want {
+			t.Errorf("%s: MaxRead() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestBandwidthLimiter_RealTimeAccuracy measures the delivered rate against
+// the wall clock with reads capped at the burst, as downloads do.
+func TestBandwidthLimiter_RealTimeAccuracy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping real-time rate limiting accuracy test in short mode")
+	}
+
+	const rate = 100 * 1024
+
+	limiter := NewBandwidthLimiter(rate)
+	ctx := context.Background()
+
+	// Drain the initial burst so only the steady state is measured
+	if err := limiter.Wait(ctx, int(limiter.Burst())); err != nil {
+		t.Fatal(err)
+	}
+
+	var transferred int64
+
+	start := time.Now()
+	for transferred < rate*3/2 {
+		n := MaxRead(limiter, 32*1024)
+		if err := limiter.Wait(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+
+		transferred += int64(n)
+	}
+
+	got := float64(transferred) / time.Since(start).Seconds()
+	if got < rate*0.95 || got > rate*1.05 {
+		t.Errorf("delivered %.0f B/s, want %d B/s ±5%%", got, rate)
+	}
+}
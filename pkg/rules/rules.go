@@ -0,0 +1,280 @@
+// Package rules applies settings to downloads by URL pattern: default
+// headers for every host of an internal domain, a User-Agent for an API, a
+// single connection for a CDN that throttles parallel requests. Rules are
+// read from the "rules" section of the configuration file.
+//
+// Example:
+//
+//	engine, err := rules.New([]rules.Rule{
+//		{Match: "*.internal.corp", Headers: map[string]string{"Authorization": "keychain:corp"}},
+//		{Match: "example-cdn.com", Concurrency: 1},
+//	})
+//	settings := engine.Match(u)
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/middleware"
+	"github.com/forest6511/gdl/pkg/ratelimit"
+)
+
+// maxConcurrency matches the limit of --concurrent.
+const maxConcurrency = 32
+
+// Rule applies settings to the URLs matching a pattern.
+type Rule struct {
+	// Match is the pattern of the URLs the rule applies to:
+	// [scheme://]host[:port][/path]. The host may hold shell wildcards, so
+	// "*.internal.corp" matches every host under internal.corp (but not
+	// internal.corp itself), and "*" every host. Without a port the rule
+	// applies to any port; a path matches the URLs whose path starts with
+	// it.
+	Match string `json:"match" yaml:"match"`
+
+	// Headers are sent with each matching request that does not set them.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+
+	// UserAgent replaces the default User-Agent.
+	UserAgent string `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+
+	// Concurrency is the number of connections downloads use; 1 downloads
+	// over a single connection, as --no-concurrent does.
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+
+	// MaxRate limits the download rate, e.g. "1MB/s".
+	MaxRate string `json:"max_rate,omitempty" yaml:"max_rate,omitempty"`
+}
+
+// Validate checks the pattern and settings of the rule.
+func (r *Rule) Validate() error {
+	if _, err := compile(r.Match); err != nil {
+		return err
+	}
+
+	for key := range r.Headers {
+		if key == "" || strings.ContainsAny(key, ":\r\n ") {
+			return fmt.Errorf("rule %q: invalid header name %q", r.Match, key)
+		}
+	}
+
+	if r.Concurrency < 0 || r.Concurrency > maxConcurrency {
+		return fmt.Errorf("rule %q: concurrency must be between 1 and %d", r.Match, maxConcurrency)
+	}
+
+	if _, err := ratelimit.ParseRate(r.MaxRate); err != nil {
+		return fmt.Errorf("rule %q: invalid max_rate: %w", r.Match, err)
+	}
+
+	return nil
+}
+
+// pattern is a compiled Match.
+type pattern struct {
+	scheme string
+	host   string
+	port   string
+	path   string
+}
+
+// compile parses a Match pattern.
+func compile(match string) (pattern, error) {
+	var p pattern
+
+	rest := strings.ToLower(strings.TrimSpace(match))
+	if rest == "" {
+		return p, errors.New("rule has no match pattern")
+	}
+
+	if scheme, after, ok := strings.Cut(rest, "://"); ok {
+		p.scheme, rest = scheme, after
+	}
+
+	host, urlPath, hasPath := strings.Cut(rest, "/")
+	if hasPath {
+		p.path = "/" + urlPath
+	}
+
+	p.host = host
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.Contains(host[i:], "]") {
+		p.host, p.port = host[:i], host[i+1:]
+	}
+
+	// An IPv6 address, matched without its brackets as URL.Hostname has it
+	if strings.HasPrefix(p.host, "[") && strings.HasSuffix(p.host, "]") {
+		p.host = p.host[1 : len(p.host)-1]
+	}
+
+	if p.host == "" {
+		return p, fmt.Errorf("rule %q has no host", match)
+	}
+
+	if _, err := path.Match(p.host, ""); err != nil {
+		return p, fmt.Errorf("rule %q: %w", match, err)
+	}
+
+	return p, nil
+}
+
+// matches reports whether u matches the pattern.
+func (p pattern) matches(u *url.URL) bool {
+	if p.scheme != "" && !strings.EqualFold(p.scheme, u.Scheme) {
+		return false
+	}
+
+	if ok, _ := path.Match(p.host, strings.ToLower(u.Hostname())); !ok {
+		return false
+	}
+
+	if p.port != "" && p.port != effectivePort(u) {
+		return false
+	}
+
+	return strings.HasPrefix(u.EscapedPath(), p.path) || (p.path == "/" && u.Path == "")
+}
+
+// effectivePort returns the port of u, the scheme's default if it has none.
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	default:
+		return ""
+	}
+}
+
+// Engine finds the rules matching a URL and merges their settings.
+type Engine struct {
+	rules    []Rule
+	patterns []pattern
+	resolve  func(value string) (string, error)
+}
+
+// New returns the engine applying rules, checking each of them.
+func New(rules []Rule) (*Engine, error) {
+	e := &Engine{}
+
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+
+		p, _ := compile(rules[i].Match)
+		e.rules = append(e.rules, rules[i])
+		e.patterns = append(e.patterns, p)
+	}
+
+	return e, nil
+}
+
+// WithResolver sets a function the middleware passes header values
+// through before sending them, such as one reading "keychain:NAME"
+// references from the keychain, so that only the requests using a secret
+// read it.
+func (e *Engine) WithResolver(resolve func(value string) (string, error)) *Engine {
+	e.resolve = resolve
+	return e
+}
+
+// Len returns the number of rules.
+func (e *Engine) Len() int {
+	return len(e.rules)
+}
+
+// Match returns the settings of the rules matching u merged in order: each
+// matching rule adds its headers and overrides the settings it sets, so a
+// specific rule placed after a general one refines it. The Match field of
+// the result lists the patterns that matched, comma-separated.
+func (e *Engine) Match(u *url.URL) Rule {
+	var merged Rule
+	var matched []string
+
+	for i, p := range e.patterns {
+		if !p.matches(u) {
+			continue
+		}
+
+		rule := e.rules[i]
+		matched = append(matched, rule.Match)
+
+		for key, value := range rule.Headers {
+			if merged.Headers == nil {
+				merged.Headers = make(map[string]string)
+			}
+			merged.Headers[http.CanonicalHeaderKey(key)] = value
+		}
+
+		if rule.UserAgent != "" {
+			merged.UserAgent = rule.UserAgent
+		}
+		if rule.Concurrency > 0 {
+			merged.Concurrency = rule.Concurrency
+		}
+		if rule.MaxRate != "" {
+			merged.MaxRate = rule.MaxRate
+		}
+	}
+
+	merged.Match = strings.Join(matched, ",")
+
+	return merged
+}
+
+// MatchString is Match for a raw URL; a URL that does not parse matches no
+// rule.
+func (e *Engine) MatchString(rawURL string) Rule {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Rule{}
+	}
+
+	return e.Match(u)
+}
+
+// Middleware returns request middleware merging the rules before each
+// request, redirects included, and adding the headers of those matching
+// it. Headers the request already sets are left alone. The request fails
+// if the resolver fails for a header value.
+func (e *Engine) Middleware() middleware.RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return middleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			headers := e.Match(req.URL).Headers
+
+			var cloned bool
+			for key, value := range headers {
+				if req.Header.Get(key) != "" {
+					continue
+				}
+
+				if e.resolve != nil {
+					resolved, err := e.resolve(value)
+					if err != nil {
+						return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeConfigError,
+							fmt.Sprintf("failed to resolve the %s header of a rule", key), req.URL.Redacted())
+					}
+					value = resolved
+				}
+
+				if !cloned {
+					req = req.Clone(req.Context())
+					cloned = true
+				}
+				req.Header.Set(key, value)
+			}
+
+			return next.RoundTrip(req)
+		})
+	}
+}
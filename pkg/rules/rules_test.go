@@ -0,0 +1,141 @@
+package rules
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/forest6511/gdl/pkg/middleware"
+)
+
+func TestMatch(t *testing.T) {
+	engine, err := New([]Rule{
+		{Match: "*", UserAgent: "gdl-corp/1.0"},
+		{Match: "*.internal.corp", Headers: map[string]string{"authorization": "Bearer corp", "X-Team": "infra"}},
+		{Match: "api.github.com", UserAgent: "my-tool/2.0", Headers: map[string]string{"Accept": "application/vnd.github+json"}},
+		{Match: "example-cdn.com", Concurrency: 1, MaxRate: "1MB/s"},
+		{Match: "https://files.internal.corp:8443/restricted", Headers: map[string]string{"X-Team": "security"}},
+		{Match: "[::1]:8080", Concurrency: 2},
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		want Rule
+	}{
+		{
+			url: "https://a.b.internal.corp/file",
+			want: Rule{Match: "*,*.internal.corp", UserAgent: "gdl-corp/1.0",
+				Headers: map[string]string{"Authorization": "Bearer corp", "X-Team": "infra"}},
+		},
+		{
+			url:  "https://internal.corp/file",
+			want: Rule{Match: "*", UserAgent: "gdl-corp/1.0"},
+		},
+		{
+			url: "https://API.GitHub.com/repos",
+			want: Rule{Match: "*,api.github.com", UserAgent: "my-tool/2.0",
+				Headers: map[string]string{"Accept": "application/vnd.github+json"}},
+		},
+		{
+			url:  "http://example-cdn.com/big.iso",
+			want: Rule{Match: "*,example-cdn.com", UserAgent: "gdl-corp/1.0", Concurrency: 1, MaxRate: "1MB/s"},
+		},
+		{
+			url: "https://files.internal.corp:8443/restricted/plan.pdf",
+			want: Rule{Match: "*,*.internal.corp,https://files.internal.corp:8443/restricted", UserAgent: "gdl-corp/1.0",
+				Headers: map[string]string{"Authorization": "Bearer corp", "X-Team": "security"}},
+		},
+		{
+			url: "https://files.internal.corp/restricted/plan.pdf",
+			want: Rule{Match: "*,*.internal.corp", UserAgent: "gdl-corp/1.0",
+				Headers: map[string]string{"Authorization": "Bearer corp", "X-Team": "infra"}},
+		},
+		{
+			url:  "http://[::1]:8080/file",
+			want: Rule{Match: "*,[::1]:8080", UserAgent: "gdl-corp/1.0", Concurrency: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := engine.MatchString(tt.url); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Match(%s) = %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+
+	if got := engine.MatchString("://bad"); !reflect.DeepEqual(got, Rule{}) {
+		t.Errorf("Match of an invalid URL = %+v, want no rule", got)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, rule := range []Rule{
+		{},
+		{Match: "https://"},
+		{Match: "[a-"},
+		{Match: "example.com", Concurrency: 33},
+		{Match: "example.com", Concurrency: -1},
+		{Match: "example.com", MaxRate: "fast"},
+		{Match: "example.com", Headers: map[string]string{"Bad Header": "x"}},
+	} {
+		if _, err := New([]Rule{rule}); err == nil {
+			t.Errorf("New(%+v) should fail", rule)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var got http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+
+	engine, err := New([]Rule{
+		{Match: u.Host, Headers: map[string]string{"Authorization": "keychain:corp", "X-Team": "infra"}},
+		{Match: "other.example", Headers: map[string]string{"X-Other": "1"}},
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	resolved := map[string]string{"keychain:corp": "Bearer corp"}
+	engine.WithResolver(func(value string) (string, error) {
+		if secret, ok := resolved[value]; ok {
+			return secret, nil
+		}
+		if value == "keychain:missing" {
+			return "", errors.New("secret not found")
+		}
+		return value, nil
+	})
+
+	client := &http.Client{Transport: middleware.ChainRequestMiddleware(nil, engine.Middleware())}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("X-Team", "cli")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if got.Get("Authorization") != "Bearer corp" || got.Get("X-Team") != "cli" || got.Get("X-Other") != "" {
+		t.Errorf("unexpected headers %v", got)
+	}
+
+	resolved = nil
+	engine.rules[0].Headers["Authorization"] = "keychain:missing"
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("a request should fail when a header cannot be resolved")
+	}
+}
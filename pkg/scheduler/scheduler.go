@@ -0,0 +1,503 @@
+// Package scheduler runs batches of download jobs in priority order, bounded by
+// a limit on parallel jobs and on connections per host, and starts a job only
+// after the jobs it depends on have succeeded.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxParallel is the number of jobs run at once when
+// Config.MaxParallel is not set.
+const DefaultMaxParallel = 4
+
+// ErrDependencyFailed is the error of a job skipped because a job it depends on
+// did not succeed.
+var ErrDependencyFailed = errors.New("dependency did not succeed")
+
+// State is the state of a job.
+type State int
+
+const (
+	// StatePending jobs wait for their dependencies or a free slot.
+	StatePending State = iota
+
+	// StateRunning jobs are being run.
+	StateRunning
+
+	// StateSucceeded jobs ran without error.
+	StateSucceeded
+
+	// StateFailed jobs returned an error.
+	StateFailed
+
+	// StateSkipped jobs were not run because a dependency did not succeed.
+	StateSkipped
+
+	// StateCancelled jobs were not run, or were interrupted, because the
+	// context was cancelled.
+	StateCancelled
+)
+
+// String returns a string representation of the state.
+func (s State) String() string {
+	switch s {
+	case StatePending:
+		return "pending"
+	case StateRunning:
+		return "running"
+	case StateSucceeded:
+		return "succeeded"
+	case StateFailed:
+		return "failed"
+	case StateSkipped:
+		return "skipped"
+	case StateCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// done reports whether the state is final.
+func (s State) done() bool {
+	return s >= StateSucceeded
+}
+
+// Job is a unit of work for the scheduler.
+type Job struct {
+	// ID identifies the job in DependsOn lists and results.
+	ID string
+
+	// URL is the job's download URL; its host is subject to
+	// Config.MaxPerHost.
+	URL string
+
+	// Priority orders jobs that are ready to run: higher runs first, and
+	// jobs of equal priority run in the order they were added.
+	Priority int
+
+	// DependsOn lists the IDs of jobs that must succeed before this one
+	// starts. If one of them fails, the job is skipped.
+	DependsOn []string
+
+	// Connections is how many connections the job opens to its host,
+	// counted against Config.MaxPerHost (0 = 1).
+	Connections int
+}
+
+// Result is the outcome of a job.
+type Result struct {
+	Job      *Job
+	State    State
+	Err      error
+	Started  time.Time
+	Finished time.Time
+}
+
+// Config limits how many jobs run at once.
+type Config struct {
+	// MaxParallel is the maximum number of jobs running at once
+	// (0 = DefaultMaxParallel).
+	MaxParallel int
+
+	// MaxPerHost is the maximum number of connections open to one host
+	// (0 = unlimited). A job needing more connections than this still runs,
+	// but only while no other job uses the host.
+	MaxPerHost int
+
+	// Lookahead is how many of the pending jobs, in the order they are
+	// expected to start, are handed to Prepare ahead of time (0 = none).
+	Lookahead int
+
+	// Prepare readies an upcoming job, for example by resolving its host
+	// name, while earlier jobs run. It is called in its own goroutine, at
+	// most once per job, and may still be running when the job starts.
+	Prepare func(ctx context.Context, job *Job)
+}
+
+// RunFunc runs a job. It should return promptly once ctx is done.
+type RunFunc func(ctx context.Context, job *Job) error
+
+// Scheduler runs jobs with RunFunc as their dependencies, priorities and the
+// limits in its Config allow. Jobs may be added while the scheduler runs.
+type Scheduler struct {
+	config Config
+	run    RunFunc
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	order    []*entry
+	running  int
+	hostLoad map[string]int
+	wake     chan struct{}
+}
+
+// entry tracks a job inside the scheduler.
+type entry struct {
+	job      *Job
+	host     string
+	result   Result
+	prepared bool
+}
+
+// New creates a scheduler running jobs with run.
+func New(config Config, run RunFunc) *Scheduler {
+	if config.MaxParallel <= 0 {
+		config.MaxParallel = DefaultMaxParallel
+	}
+
+	return &Scheduler{
+		config:   config,
+		run:      run,
+		entries:  make(map[string]*entry),
+		hostLoad: make(map[string]int),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Add queues jobs. Every ID must be new and every dependency must name a job
+// added before or in the same call; cyclic dependencies are rejected. On error
+// no job is added.
+func (s *Scheduler) Add(jobs ...*Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := make(map[string]*Job, len(jobs))
+	for _, job := range jobs {
+		if job.ID == "" {
+			return fmt.Errorf("job for %s has no ID", job.URL)
+		}
+		if _, exists := s.entries[job.ID]; exists {
+			return fmt.Errorf("duplicate job ID %q", job.ID)
+		}
+		if _, exists := added[job.ID]; exists {
+			return fmt.Errorf("duplicate job ID %q", job.ID)
+		}
+		added[job.ID] = job
+	}
+
+	for _, job := range jobs {
+		for _, dep := range job.DependsOn {
+			if _, known := s.entries[dep]; !known && added[dep] == nil {
+				return fmt.Errorf("job %q depends on unknown job %q", job.ID, dep)
+			}
+		}
+	}
+
+	if cycle := findCycle(jobs, added); cycle != nil {
+		return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	for _, job := range jobs {
+		e := &entry{job: job, host: hostOf(job.URL)}
+		e.result.Job = job
+		s.entries[job.ID] = e
+		s.order = append(s.order, e)
+	}
+
+	s.notify()
+
+	return nil
+}
+
+// Run runs the queued jobs, and any added meanwhile, until all of them are
+// done, and returns their results in the order the jobs were added. When ctx
+// is cancelled, pending jobs are cancelled and Run returns once the running
+// jobs have stopped.
+func (s *Scheduler) Run(ctx context.Context) []*Result {
+	for {
+		s.mu.Lock()
+		if ctx.Err() != nil {
+			s.cancelPending(ctx.Err())
+		} else {
+			s.skipBlocked()
+			s.dispatch(ctx)
+			s.prepareUpcoming(ctx)
+		}
+
+		if s.running == 0 && s.allDone() {
+			s.mu.Unlock()
+			return s.Results()
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.wake:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Results returns a snapshot of the jobs' results in the order the jobs were
+// added.
+func (s *Scheduler) Results() []*Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]*Result, len(s.order))
+	for i, e := range s.order {
+		result := e.result
+		results[i] = &result
+	}
+
+	return results
+}
+
+// dispatch starts the ready jobs, highest priority first, as far as the limits
+// allow. The caller holds s.mu.
+func (s *Scheduler) dispatch(ctx context.Context) {
+	if s.running >= s.config.MaxParallel {
+		return
+	}
+
+	var ready []*entry
+	for _, e := range s.order {
+		if e.result.State == StatePending && s.depsSucceeded(e) {
+			ready = append(ready, e)
+		}
+	}
+
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].job.Priority > ready[j].job.Priority
+	})
+
+	for _, e := range ready {
+		if s.running >= s.config.MaxParallel {
+			return
+		}
+
+		// A busy host does not hold up jobs for other hosts
+		if !s.hostHasRoom(e) {
+			continue
+		}
+
+		s.start(ctx, e)
+	}
+}
+
+// prepareUpcoming hands the next Config.Lookahead pending jobs to
+// Config.Prepare: the ready ones highest priority first, then those still
+// waiting for their dependencies. The caller holds s.mu.
+func (s *Scheduler) prepareUpcoming(ctx context.Context) {
+	if s.config.Prepare == nil || s.config.Lookahead <= 0 {
+		return
+	}
+
+	var ready, waiting []*entry
+	for _, e := range s.order {
+		switch {
+		case e.result.State != StatePending:
+		case s.depsSucceeded(e):
+			ready = append(ready, e)
+		default:
+			waiting = append(waiting, e)
+		}
+	}
+
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].job.Priority > ready[j].job.Priority
+	})
+
+	upcoming := append(ready, waiting...)
+	for _, e := range upcoming[:min(len(upcoming), s.config.Lookahead)] {
+		if e.prepared {
+			continue
+		}
+
+		e.prepared = true
+		go s.config.Prepare(ctx, e.job)
+	}
+}
+
+// hostHasRoom reports whether e's connections fit under the per-host limit.
+// The caller holds s.mu.
+func (s *Scheduler) hostHasRoom(e *entry) bool {
+	if s.config.MaxPerHost <= 0 || e.host == "" {
+		return true
+	}
+
+	load := s.hostLoad[e.host]
+
+	return load == 0 || load+connections(e.job) <= s.config.MaxPerHost
+}
+
+// start runs e in a new goroutine. The caller holds s.mu.
+func (s *Scheduler) start(ctx context.Context, e *entry) {
+	e.result.State = StateRunning
+	e.result.Started = time.Now()
+	s.running++
+	s.hostLoad[e.host] += connections(e.job)
+
+	go func() {
+		err := s.run(ctx, e.job)
+
+		s.mu.Lock()
+		e.result.Finished = time.Now()
+		e.result.Err = err
+
+		switch {
+		case err == nil:
+			e.result.State = StateSucceeded
+		case ctx.Err() != nil:
+			e.result.State = StateCancelled
+		default:
+			e.result.State = StateFailed
+		}
+
+		s.running--
+		s.hostLoad[e.host] -= connections(e.job)
+		if s.hostLoad[e.host] <= 0 {
+			delete(s.hostLoad, e.host)
+		}
+		s.mu.Unlock()
+
+		s.notify()
+	}()
+}
+
+// depsSucceeded reports whether all of e's dependencies succeeded. The caller
+// holds s.mu.
+func (s *Scheduler) depsSucceeded(e *entry) bool {
+	for _, dep := range e.job.DependsOn {
+		if s.entries[dep].result.State != StateSucceeded {
+			return false
+		}
+	}
+
+	return true
+}
+
+// skipBlocked skips pending jobs with a dependency that is done without
+// having succeeded, repeating until skips no longer cascade. The caller holds
+// s.mu.
+func (s *Scheduler) skipBlocked() {
+	for changed := true; changed; {
+		changed = false
+
+		for _, e := range s.order {
+			if e.result.State != StatePending {
+				continue
+			}
+
+			for _, dep := range e.job.DependsOn {
+				depState := s.entries[dep].result.State
+				if depState.done() && depState != StateSucceeded {
+					e.result.State = StateSkipped
+					e.result.Err = fmt.Errorf("%w: %s %s", ErrDependencyFailed, dep, depState)
+					changed = true
+
+					break
+				}
+			}
+		}
+	}
+}
+
+// cancelPending cancels the jobs that have not started. The caller holds s.mu.
+func (s *Scheduler) cancelPending(err error) {
+	for _, e := range s.order {
+		if e.result.State == StatePending {
+			e.result.State = StateCancelled
+			e.result.Err = err
+		}
+	}
+}
+
+// allDone reports whether every job is done. The caller holds s.mu.
+func (s *Scheduler) allDone() bool {
+	for _, e := range s.order {
+		if !e.result.State.done() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// notify wakes Run without blocking.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// connections returns the number of connections job counts against its host.
+func connections(job *Job) int {
+	if job.Connections <= 0 {
+		return 1
+	}
+
+	return job.Connections
+}
+
+// hostOf returns the lower-cased host and port of rawURL, or "" if it has none.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Host)
+}
+
+// findCycle returns a dependency cycle among jobs, which are indexed by ID in
+// added, or nil. Jobs added earlier cannot depend on new ones, so any cycle
+// runs through the new jobs only.
+func findCycle(jobs []*Job, added map[string]*Job) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	marks := make(map[string]int, len(jobs))
+
+	var path []string
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		switch marks[id] {
+		case visiting:
+			for i, p := range path {
+				if p == id {
+					return append(append([]string(nil), path[i:]...), id)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		marks[id] = visiting
+		path = append(path, id)
+
+		for _, dep := range added[id].DependsOn {
+			if added[dep] == nil {
+				continue
+			}
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+
+		path = path[:len(path)-1]
+		marks[id] = visited
+
+		return nil
+	}
+
+	for _, job := range jobs {
+		if cycle := visit(job.ID); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,404 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recorder is a RunFunc that logs the order jobs start in and fails jobs whose
+// ID starts with "fail".
+type recorder struct {
+	mu      sync.Mutex
+	started []string
+}
+
+func (r *recorder) run(ctx context.Context, job *Job) error {
+	r.mu.Lock()
+	r.started = append(r.started, job.ID)
+	r.mu.Unlock()
+
+	if strings.HasPrefix(job.ID, "fail") {
+		return errors.New("job failed")
+	}
+
+	return nil
+}
+
+func (r *recorder) order() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.started...)
+}
+
+func states(results []*Result) map[string]State {
+	m := make(map[string]State, len(results))
+	for _, result := range results {
+		m[result.Job.ID] = result.State
+	}
+
+	return m
+}
+
+func TestState_String(t *testing.T) {
+	tests := []struct {
+		state State
+		want  string
+	}{
+		{StatePending, "pending"},
+		{StateRunning, "running"},
+		{StateSucceeded, "succeeded"},
+		{StateFailed, "failed"},
+		{StateSkipped, "skipped"},
+		{StateCancelled, "cancelled"},
+		{State(99), "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.state.String(); got != tt.want {
+			t.Errorf("State(%d).String() = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestScheduler_Priority(t *testing.T) {
+	r := &recorder{}
+	s := New(Config{MaxParallel: 1}, r.run)
+
+	if err := s.Add(
+		&Job{ID: "low", Priority: -1},
+		&Job{ID: "a"},
+		&Job{ID: "high", Priority: 10},
+		&Job{ID: "b"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	results := s.Run(context.Background())
+
+	want := []string{"high", "a", "b", "low"}
+	if got := r.order(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("start order = %v, want %v", got, want)
+	}
+
+	// Results keep the order jobs were added in
+	if results[0].Job.ID != "low" || results[3].Job.ID != "b" {
+		t.Errorf("results are not in add order")
+	}
+
+	for _, result := range results {
+		if result.State != StateSucceeded || result.Started.IsZero() || result.Finished.IsZero() {
+			t.Errorf("%s: result = %+v, want succeeded with timestamps", result.Job.ID, result)
+		}
+	}
+}
+
+// gauge tracks the peak of a concurrent count.
+type gauge struct {
+	mu        sync.Mutex
+	current   map[string]int
+	peak      map[string]int
+	peakTotal int
+	total     int
+}
+
+func newGauge() *gauge {
+	return &gauge{current: make(map[string]int), peak: make(map[string]int)}
+}
+
+func (g *gauge) run(ctx context.Context, job *Job) error {
+	host := hostOf(job.URL)
+
+	g.mu.Lock()
+	g.current[host] += connections(job)
+	g.total++
+	g.peak[host] = max(g.peak[host], g.current[host])
+	g.peakTotal = max(g.peakTotal, g.total)
+	g.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	g.mu.Lock()
+	g.current[host] -= connections(job)
+	g.total--
+	g.mu.Unlock()
+
+	return nil
+}
+
+func TestScheduler_MaxParallel(t *testing.T) {
+	g := newGauge()
+	s := New(Config{MaxParallel: 3}, g.run)
+
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7", "8"} {
+		if err := s.Add(&Job{ID: id, URL: "https://host" + id + ".example.com/file"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.Run(context.Background())
+
+	if g.peakTotal != 3 {
+		t.Errorf("peak parallel jobs = %d, want 3", g.peakTotal)
+	}
+}
+
+func TestScheduler_MaxPerHost(t *testing.T) {
+	g := newGauge()
+	s := New(Config{MaxParallel: 10, MaxPerHost: 4}, g.run)
+
+	jobs := []*Job{
+		{ID: "a1", URL: "https://a.example.com/1", Connections: 2},
+		{ID: "a2", URL: "https://A.example.com/2", Connections: 2},
+		{ID: "a3", URL: "https://a.example.com/3", Connections: 2},
+		{ID: "a4", URL: "https://a.example.com/4", Connections: 3},
+		{ID: "big", URL: "https://b.example.com/big", Connections: 8},
+		{ID: "b1", URL: "https://b.example.com/1"},
+		{ID: "c1", URL: "https://c.example.com/1"},
+	}
+	if err := s.Add(jobs...); err != nil {
+		t.Fatal(err)
+	}
+
+	results := s.Run(context.Background())
+
+	if g.peak["a.example.com"] > 4 {
+		t.Errorf("peak connections to a.example.com = %d, want at most 4", g.peak["a.example.com"])
+	}
+
+	// A job over the cap runs, but alone on its host
+	if g.peak["b.example.com"] != 8 {
+		t.Errorf("peak connections to b.example.com = %d, want 8", g.peak["b.example.com"])
+	}
+
+	for id, state := range states(results) {
+		if state != StateSucceeded {
+			t.Errorf("%s: state = %s, want succeeded", id, state)
+		}
+	}
+}
+
+func TestScheduler_Dependencies(t *testing.T) {
+	r := &recorder{}
+	s := New(Config{MaxParallel: 4}, r.run)
+
+	if err := s.Add(
+		&Job{ID: "c", DependsOn: []string{"b"}, Priority: 100},
+		&Job{ID: "b", DependsOn: []string{"a"}, Priority: 100},
+		&Job{ID: "a"},
+		&Job{ID: "fail"},
+		&Job{ID: "after-fail", DependsOn: []string{"fail"}},
+		&Job{ID: "after-skip", DependsOn: []string{"after-fail", "a"}},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	results := s.Run(context.Background())
+
+	position := make(map[string]int)
+	for i, id := range r.order() {
+		position[id] = i
+	}
+	if !(position["a"] < position["b"] && position["b"] < position["c"]) {
+		t.Errorf("start order = %v, want a before b before c", r.order())
+	}
+
+	want := map[string]State{
+		"a":          StateSucceeded,
+		"b":          StateSucceeded,
+		"c":          StateSucceeded,
+		"fail":       StateFailed,
+		"after-fail": StateSkipped,
+		"after-skip": StateSkipped,
+	}
+	got := states(results)
+	for id, state := range want {
+		if got[id] != state {
+			t.Errorf("%s: state = %s, want %s", id, got[id], state)
+		}
+	}
+
+	for _, result := range results {
+		if result.State == StateSkipped && !errors.Is(result.Err, ErrDependencyFailed) {
+			t.Errorf("%s: error = %v, want ErrDependencyFailed", result.Job.ID, result.Err)
+		}
+		if result.State == StateSkipped && !result.Started.IsZero() {
+			t.Errorf("%s: skipped job was started", result.Job.ID)
+		}
+	}
+}
+
+func TestScheduler_AddErrors(t *testing.T) {
+	s := New(Config{}, func(context.Context, *Job) error { return nil })
+
+	if err := s.Add(&Job{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		jobs []*Job
+		want string
+	}{
+		{"missing ID", []*Job{{URL: "https://example.com"}}, "no ID"},
+		{"duplicate of queued job", []*Job{{ID: "a"}}, "duplicate"},
+		{"duplicate in call", []*Job{{ID: "x"}, {ID: "x"}}, "duplicate"},
+		{"unknown dependency", []*Job{{ID: "x", DependsOn: []string{"nope"}}}, "unknown job"},
+		{"self dependency", []*Job{{ID: "x", DependsOn: []string{"x"}}}, "cycle"},
+		{"cycle", []*Job{
+			{ID: "x", DependsOn: []string{"z", "a"}},
+			{ID: "y", DependsOn: []string{"x"}},
+			{ID: "z", DependsOn: []string{"y"}},
+		}, "cycle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Add(tt.jobs...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Add() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// Failed calls add nothing
+	if results := s.Results(); len(results) != 1 {
+		t.Errorf("queued jobs = %d, want 1", len(results))
+	}
+}
+
+func TestScheduler_AddWhileRunning(t *testing.T) {
+	var s *Scheduler
+	var ran atomic.Int32
+
+	s = New(Config{MaxParallel: 2}, func(ctx context.Context, job *Job) error {
+		ran.Add(1)
+		if job.ID == "first" {
+			return s.Add(&Job{ID: "second", DependsOn: []string{"first"}})
+		}
+		return nil
+	})
+
+	if err := s.Add(&Job{ID: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	results := s.Run(context.Background())
+
+	if len(results) != 2 || ran.Load() != 2 {
+		t.Fatalf("results = %d, jobs run = %d, want 2 and 2", len(results), ran.Load())
+	}
+	if results[1].State != StateSucceeded {
+		t.Errorf("job added while running: state = %s, want succeeded", results[1].State)
+	}
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	s := New(Config{MaxParallel: 1}, func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := s.Add(&Job{ID: "running"}, &Job{ID: "pending"}); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	done := make(chan []*Result)
+	go func() { done <- s.Run(ctx) }()
+
+	select {
+	case results := <-done:
+		for _, result := range results {
+			if result.State != StateCancelled || !errors.Is(result.Err, context.Canceled) {
+				t.Errorf("%s: state = %s, err = %v, want cancelled", result.Job.ID, result.State, result.Err)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after cancellation")
+	}
+}
+
+func TestScheduler_Empty(t *testing.T) {
+	s := New(Config{}, func(context.Context, *Job) error { return nil })
+
+	if results := s.Run(context.Background()); len(results) != 0 {
+		t.Errorf("Run() of no jobs = %v, want none", results)
+	}
+}
+
+func TestScheduler_Prepare(t *testing.T) {
+	var mu sync.Mutex
+	var prepared []string
+
+	gate := make(chan struct{})
+	s := New(Config{
+		MaxParallel: 1,
+		Lookahead:   2,
+		Prepare: func(ctx context.Context, job *Job) {
+			mu.Lock()
+			defer mu.Unlock()
+			prepared = append(prepared, job.ID)
+		},
+	}, func(ctx context.Context, job *Job) error {
+		if job.ID == "a" {
+			<-gate
+		}
+		return nil
+	})
+
+	if err := s.Add(
+		&Job{ID: "a", Priority: 9},
+		&Job{ID: "b"},
+		&Job{ID: "c", DependsOn: []string{"b"}},
+		&Job{ID: "d", Priority: 5},
+		&Job{ID: "e"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []*Result)
+	go func() { done <- s.Run(context.Background()) }()
+
+	// While "a" runs, only the two jobs expected next are prepared
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	early := append([]string(nil), prepared...)
+	mu.Unlock()
+	sort.Strings(early)
+	if strings.Join(early, ",") != "b,d" {
+		t.Errorf("prepared while the first job ran = %v, want [b d]", early)
+	}
+
+	close(gate)
+	<-done
+
+	// Prepare runs in the background, so the last calls may trail Run
+	deadline := time.Now().Add(time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	for len(prepared) < 4 && time.Now().Before(deadline) {
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+	}
+	sort.Strings(prepared)
+	if strings.Join(prepared, ",") != "b,c,d,e" {
+		t.Errorf("prepared = %v, want every job but the first, once each", prepared)
+	}
+}
@@ -0,0 +1,331 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/middleware"
+)
+
+// Credential is what a credential helper returns for a host.
+type Credential struct {
+	Username string
+	Password string
+
+	// AuthType and Token, the helper's "authtype" and "credential", form
+	// the Authorization header of schemes other than Basic, such as a
+	// "Bearer" token. They take precedence over Username and Password.
+	AuthType string
+	Token    string
+}
+
+// Authorization returns the value of the Authorization header sending c,
+// "" when it holds nothing.
+func (c *Credential) Authorization() string {
+	switch {
+	case c.AuthType != "" && c.Token != "":
+		return c.AuthType + " " + c.Token
+	case c.Username != "" || c.Password != "":
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+	default:
+		return ""
+	}
+}
+
+// Helper runs an external credential helper speaking the protocol of git
+// credential helpers, so that credentials can come from any secret source.
+// For each host, gdl runs the helper with the argument "get" and writes the
+// request on its stdin as key=value lines:
+//
+//	protocol=https
+//	host=downloads.example.com
+//	capability[]=authtype
+//
+// The helper answers on stdout with username= and password=, or authtype=
+// and credential= for a token scheme, and prints nothing for a host it has
+// no credentials for. Answers are cached for the life of the Helper. Once
+// the server accepts a credential the helper is run with "store", and with
+// "erase" when it rejects one, so caching helpers can keep or drop it.
+//
+// Example:
+//
+//	helper := secrets.NewHelper("vault-credentials --role ci")
+//	downloader.Use(helper.Middleware())
+type Helper struct {
+	command []string
+
+	mu    sync.Mutex
+	hosts map[string]*helperEntry
+}
+
+// helperEntry is the answer of the helper for a host.
+type helperEntry struct {
+	done     chan struct{} // Closed once the helper answered
+	cred     *Credential
+	err      error
+	approved bool
+}
+
+// NewHelper returns the helper run by command, a program and its arguments
+// separated by spaces. A program given by a bare name is looked up in PATH
+// as gdl-credential-NAME, then git-credential-NAME, so the helpers written
+// for git work as they are, and last as NAME itself.
+func NewHelper(command string) *Helper {
+	return &Helper{
+		command: strings.Fields(command),
+		hosts:   make(map[string]*helperEntry),
+	}
+}
+
+// Get returns the credential for the host of u, running the helper the
+// first time the host is asked for. It returns nil when the helper has no
+// credential for the host.
+func (h *Helper) Get(ctx context.Context, u *url.URL) (*Credential, error) {
+	key := hostKey(u)
+
+	h.mu.Lock()
+	entry, ok := h.hosts[key]
+	if !ok {
+		entry = &helperEntry{done: make(chan struct{})}
+		h.hosts[key] = entry
+	}
+	h.mu.Unlock()
+
+	if ok {
+		select {
+		case <-entry.done:
+			return entry.cred, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	values, err := h.run(ctx, "get", requestAttributes(u, nil))
+	if err == nil {
+		entry.cred = &Credential{
+			Username: values["username"],
+			Password: values["password"],
+			AuthType: values["authtype"],
+			Token:    values["credential"],
+		}
+		if entry.cred.Authorization() == "" {
+			entry.cred = nil
+		}
+	}
+	entry.err = err
+
+	// A failed helper is asked again by the next request
+	if err != nil {
+		h.forget(key, entry)
+	}
+	close(entry.done)
+
+	return entry.cred, entry.err
+}
+
+// Approve tells the helper the server accepted cred for the host of u, once
+// per host.
+func (h *Helper) Approve(ctx context.Context, u *url.URL, cred *Credential) error {
+	h.mu.Lock()
+	entry := h.hosts[hostKey(u)]
+	if !entry.answered() || entry.cred != cred || entry.approved {
+		h.mu.Unlock()
+		return nil
+	}
+	entry.approved = true
+	h.mu.Unlock()
+
+	_, err := h.run(ctx, "store", requestAttributes(u, cred))
+
+	return err
+}
+
+// Reject tells the helper the server refused cred for the host of u and
+// drops it from the cache, so the next request asks the helper again.
+func (h *Helper) Reject(ctx context.Context, u *url.URL, cred *Credential) error {
+	key := hostKey(u)
+
+	h.mu.Lock()
+	entry := h.hosts[key]
+	if !entry.answered() || entry.cred != cred {
+		h.mu.Unlock()
+		return nil
+	}
+	delete(h.hosts, key)
+	h.mu.Unlock()
+
+	_, err := h.run(ctx, "erase", requestAttributes(u, cred))
+
+	return err
+}
+
+// Middleware returns request middleware sending the helper's credential
+// with each request that has no Authorization header of its own.
+func (h *Helper) Middleware() middleware.RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return middleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "" {
+				return next.RoundTrip(req)
+			}
+
+			cred, err := h.Get(req.Context(), req.URL)
+			if err != nil {
+				return nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeAuthenticationFailed,
+					"credential helper failed", req.URL.Redacted())
+			}
+			if cred == nil {
+				return next.RoundTrip(req)
+			}
+
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", cred.Authorization())
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return resp, err
+			}
+
+			// The helper's answer is not worth failing a download over
+			switch {
+			case resp.StatusCode == http.StatusUnauthorized:
+				_ = h.Reject(req.Context(), req.URL, cred)
+			case resp.StatusCode < http.StatusBadRequest:
+				_ = h.Approve(req.Context(), req.URL, cred)
+			}
+
+			return resp, nil
+		})
+	}
+}
+
+// answered reports whether the helper answered for entry, which may be nil.
+func (e *helperEntry) answered() bool {
+	if e == nil {
+		return false
+	}
+
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// forget drops entry, the answer for key, from the cache.
+func (h *Helper) forget(key string, entry *helperEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.hosts[key] == entry {
+		delete(h.hosts, key)
+	}
+}
+
+// hostKey returns the key the credential for the host of u is cached under.
+func hostKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// requestAttributes returns the attributes describing the host of u, and
+// cred if given, to the helper.
+func requestAttributes(u *url.URL, cred *Credential) []string {
+	attrs := []string{"protocol=" + u.Scheme, "host=" + u.Host}
+
+	if cred == nil {
+		return append(attrs, "capability[]=authtype")
+	}
+
+	if cred.Username != "" {
+		attrs = append(attrs, "username="+cred.Username)
+	}
+	if cred.Password != "" {
+		attrs = append(attrs, "password="+cred.Password)
+	}
+	if cred.AuthType != "" {
+		attrs = append(attrs, "capability[]=authtype", "authtype="+cred.AuthType, "credential="+cred.Token)
+	}
+
+	return attrs
+}
+
+// program returns the path of the helper program.
+func (h *Helper) program() (string, error) {
+	if len(h.command) == 0 {
+		return "", errors.New("no credential helper configured")
+	}
+
+	name := h.command[0]
+	if filepath.Base(name) != name {
+		return name, nil
+	}
+
+	for _, candidate := range []string{"gdl-credential-" + name, "git-credential-" + name, name} {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("credential helper %q not found", name)
+}
+
+// run runs the helper for action with attrs on its stdin and returns the
+// attributes it printed.
+func (h *Helper) run(ctx context.Context, action string, attrs []string) (map[string]string, error) {
+	path, err := h.program()
+	if err != nil {
+		return nil, err
+	}
+
+	var stdin bytes.Buffer
+	for _, attr := range attrs {
+		if strings.ContainsAny(attr, "\n\x00") {
+			return nil, fmt.Errorf("credential attribute %q holds a newline", strings.SplitN(attr, "=", 2)[0])
+		}
+		stdin.WriteString(attr + "\n")
+	}
+	stdin.WriteString("\n")
+
+	var stdout, stderr bytes.Buffer
+
+	args := append(append([]string{}, h.command[1:]...), action)
+	cmd := exec.CommandContext(ctx, path, args...) // #nosec G204 -- the helper is configured by the user
+	cmd.Stdin = &stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("credential helper %s: %s", action, message)
+		}
+
+		return nil, fmt.Errorf("credential helper %s: %w", action, err)
+	}
+
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = value
+		}
+	}
+
+	return values, scanner.Err()
+}
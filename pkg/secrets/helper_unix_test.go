@@ -0,0 +1,157 @@
+//go:build !windows
+
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeHelper logs each action with its input to $HELPER_LOG and answers
+// "get" by host.
+const fakeHelper = `#!/bin/sh
+input=$(cat)
+echo "$1 $(echo "$input" | tr '\n' ' ')" >> "$HELPER_LOG"
+[ "$1" = get ] || exit 0
+case "$input" in
+*host=token.example*) printf 'authtype=Bearer\ncredential=tok\n' ;;
+*host=broken.example*) echo "vault unreachable" >&2; exit 1 ;;
+*host=127.0.0.1*) printf 'username=alice\npassword=s3cret\n\nignored=1\n' ;;
+esac
+`
+
+// writeFakeHelper installs fakeHelper as gdl-credential-fake on PATH and
+// returns the file it logs to.
+func writeFakeHelper(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "gdl-credential-fake"), []byte(fakeHelper), 0o700); err != nil { // #nosec G306 -- test script
+		t.Fatal(err)
+	}
+
+	log := filepath.Join(dir, "helper.log")
+	t.Setenv("HELPER_LOG", log)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return log
+}
+
+// helperCalls returns the actions logged by the fake helper.
+func helperCalls(t *testing.T, log string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(log) // #nosec G304 -- test file
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestHelperGet(t *testing.T) {
+	log := writeFakeHelper(t)
+	helper := NewHelper("fake")
+	ctx := context.Background()
+
+	token, err := helper.Get(ctx, &url.URL{Scheme: "https", Host: "token.example"})
+	if err != nil || token == nil || token.Authorization() != "Bearer tok" {
+		t.Fatalf("Get(token.example) = %+v, %v", token, err)
+	}
+
+	none, err := helper.Get(ctx, &url.URL{Scheme: "https", Host: "other.example"})
+	if err != nil || none != nil {
+		t.Errorf("Get(other.example) = %+v, %v, want no credential", none, err)
+	}
+
+	// Answers are cached, failures are not
+	_, _ = helper.Get(ctx, &url.URL{Scheme: "https", Host: "token.example"})
+	for range 2 {
+		if _, err := helper.Get(ctx, &url.URL{Scheme: "https", Host: "broken.example"}); err == nil ||
+			!strings.Contains(err.Error(), "vault unreachable") {
+			t.Errorf("Get(broken.example) error = %v", err)
+		}
+	}
+
+	calls := helperCalls(t, log)
+	if len(calls) != 4 {
+		t.Errorf("helper ran %d times, want 4: %q", len(calls), calls)
+	}
+	if !strings.Contains(calls[0], "protocol=https host=token.example capability[]=authtype") {
+		t.Errorf("unexpected helper input %q", calls[0])
+	}
+
+	if _, err := NewHelper("missing-helper-xyz").Get(ctx, &url.URL{Scheme: "https", Host: "a"}); err == nil {
+		t.Error("Get with a missing helper should fail")
+	}
+}
+
+func TestHelperMiddleware(t *testing.T) {
+	log := writeFakeHelper(t)
+
+	var accept atomic.Bool
+	accept.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !accept.Load() || !ok || user != "alice" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewHelper("fake").Middleware()(http.DefaultTransport)}
+
+	get := func(header string) int {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if status := get(""); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if status := get(""); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+
+	// A header of the request's own is left alone
+	if status := get("Bearer other"); status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", status)
+	}
+
+	accept.Store(false)
+	if status := get(""); status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", status)
+	}
+	accept.Store(true)
+	if status := get(""); status != http.StatusOK {
+		t.Errorf("status = %d, want 200", status)
+	}
+
+	var actions []string
+	for _, call := range helperCalls(t, log) {
+		actions = append(actions, strings.Fields(call)[0])
+	}
+	if got := strings.Join(actions, " "); got != "get store erase get store" {
+		t.Errorf("helper actions = %q, want get store erase get store", got)
+	}
+}
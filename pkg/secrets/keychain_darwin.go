@@ -0,0 +1,138 @@
+//go:build darwin
+
+package secrets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// securityItemNotFound is the exit status of security for a missing item.
+const securityItemNotFound = 44
+
+// systemKeychain stores secrets as generic passwords of the login keychain,
+// under the service Service and the account name.
+type systemKeychain struct{}
+
+// Get finds the password. It is read from the "password:" line -g prints on
+// stderr rather than with -w, which prints passwords that are not plain ASCII
+// as hex indistinguishable from a password of hex digits.
+func (systemKeychain) Get(name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+
+	_, attributes, err := runSecurity(nil, "find-generic-password", "-s", Service, "-a", name, "-g")
+	if err != nil {
+		return "", err
+	}
+
+	return parsePassword(attributes)
+}
+
+// parsePassword extracts the password from the output of
+// find-generic-password -g: `password: "secret"` for printable ASCII,
+// `password: 0x<hex>  "<escaped>"` otherwise, and `password: ` when empty.
+func parsePassword(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		value, ok := strings.CutPrefix(line, "password:")
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimPrefix(value, " ")
+
+		switch {
+		case value == "":
+			return "", nil
+		case strings.HasPrefix(value, "0x"):
+			encoded, _, _ := strings.Cut(value[2:], " ")
+
+			secret, err := hex.DecodeString(encoded)
+			if err != nil {
+				return "", fmt.Errorf("security: invalid hex password: %w", err)
+			}
+
+			return string(secret), nil
+		case len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`):
+			return value[1 : len(value)-1], nil
+		default:
+			return "", errors.New("security: unrecognized password line")
+		}
+	}
+
+	return "", errors.New("security: no password in output")
+}
+
+// Set adds or updates the password. The command is passed to an interactive
+// security on stdin, hex-encoded, so that the secret never appears on a
+// command line.
+func (systemKeychain) Set(name, secret string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -l %s -X %s\n",
+		quote(Service), quote(name), quote(Service+": "+name), hex.EncodeToString([]byte(secret)))
+
+	_, _, err := runSecurity(strings.NewReader(command), "-i")
+
+	return err
+}
+
+// Delete deletes the password.
+func (systemKeychain) Delete(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	_, _, err := runSecurity(nil, "delete-generic-password", "-s", Service, "-a", name)
+
+	return err
+}
+
+// quote quotes s for the command parser of an interactive security.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runSecurity runs the security tool with stdin and returns its output and
+// error output.
+func runSecurity(stdin io.Reader, args ...string) (string, string, error) {
+	path, err := exec.LookPath("security")
+	if err != nil {
+		return "", "", fmt.Errorf("%w: security not found", ErrUnavailable)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(path, args...) // #nosec G204 -- fixed tool, arguments passed as is
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == securityItemNotFound {
+			return "", "", ErrNotFound
+		}
+
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", "", fmt.Errorf("security %s: %s", args[0], message)
+		}
+
+		return "", "", fmt.Errorf("security %s: %w", args[0], err)
+	}
+
+	// An interactive security reports failures on stderr only
+	if args[0] == "-i" && stderr.Len() > 0 {
+		return "", "", fmt.Errorf("security: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), stderr.String(), nil
+}
@@ -0,0 +1,35 @@
+//go:build darwin
+
+package secrets
+
+import "testing"
+
+func TestParsePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{"ascii", "password: \"Bearer abc\"\n", "Bearer abc", false},
+		{"ascii of hex digits", "password: \"0xdeadbeef\"\n", "0xdeadbeef", false},
+		{"non-ascii", "password: 0x70C3A4737377C3B67264  \"p\\303\\244ssw\\303\\266rd\"\n", "pässwörd", false},
+		{"empty", "password: \n", "", false},
+		{"after attributes", "keychain: \"login.keychain-db\"\nclass: \"genp\"\npassword: \"x\"\n", "x", false},
+		{"invalid hex", "password: 0xZZ  \"?\"\n", "", true},
+		{"missing", "keychain: \"login.keychain-db\"\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePassword(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("parsePassword() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
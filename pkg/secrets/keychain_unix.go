@@ -0,0 +1,94 @@
+//go:build !darwin && !windows
+
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// secretTool is libsecret's command-line client of the Secret Service.
+var secretTool = "secret-tool"
+
+// systemKeychain stores secrets in the Secret Service, under the attributes
+// service=Service and account=name.
+type systemKeychain struct{}
+
+// Get looks the secret up.
+func (systemKeychain) Get(name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+
+	secret, err := runSecretTool(nil, "lookup", "service", Service, "account", name)
+	if err != nil {
+		return "", err
+	}
+
+	// secret-tool prints nothing and fails for a missing secret
+	if secret == "" {
+		return "", ErrNotFound
+	}
+
+	return secret, nil
+}
+
+// Set stores the secret, passing it on stdin rather than the command line.
+func (systemKeychain) Set(name, secret string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	_, err := runSecretTool(strings.NewReader(secret),
+		"store", "--label", Service+": "+name, "service", Service, "account", name)
+
+	return err
+}
+
+// Delete clears the secret.
+func (k systemKeychain) Delete(name string) error {
+	if _, err := k.Get(name); err != nil {
+		return err
+	}
+
+	_, err := runSecretTool(nil, "clear", "service", Service, "account", name)
+
+	return err
+}
+
+// runSecretTool runs secret-tool with stdin and returns its output. A
+// lookup that finds nothing exits with status 1 and no message, which is
+// not an error here.
+func runSecretTool(stdin io.Reader, args ...string) (string, error) {
+	path, err := exec.LookPath(secretTool)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s not found", ErrUnavailable, secretTool)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(path, args...) // #nosec G204 -- fixed tool, arguments passed as is
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && args[0] == "lookup" &&
+			stdout.Len() == 0 && stderr.Len() == 0 {
+			return "", nil
+		}
+
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%s %s: %s", secretTool, args[0], message)
+		}
+
+		return "", fmt.Errorf("%s %s: %w", secretTool, args[0], err)
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,65 @@
+//go:build !darwin && !windows
+
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeSecretTool stands in for secret-tool, keeping each secret in a file
+// named after its account.
+const fakeSecretTool = `#!/bin/sh
+case "$1" in
+lookup) [ -f "$SECRETS_DIR/$5" ] || exit 1; cat "$SECRETS_DIR/$5" ;;
+store) cat > "$SECRETS_DIR/$7" ;;
+clear) rm -f "$SECRETS_DIR/$5" ;;
+*) echo "unknown command $1" >&2; exit 2 ;;
+esac
+`
+
+func TestSystemKeychain(t *testing.T) {
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "secret-tool")
+	if err := os.WriteFile(tool, []byte(fakeSecretTool), 0o700); err != nil { // #nosec G306 -- test script
+		t.Fatal(err)
+	}
+
+	store := filepath.Join(dir, "store")
+	if err := os.Mkdir(store, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETS_DIR", store)
+
+	saved := secretTool
+	secretTool = tool
+	t.Cleanup(func() { secretTool = saved })
+
+	keychain := System()
+
+	if _, err := keychain.Get("github"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing secret = %v, want ErrNotFound", err)
+	}
+
+	if err := keychain.Set("github", "Bearer abc"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if secret, err := keychain.Get("github"); err != nil || secret != "Bearer abc" {
+		t.Errorf("Get = %q, %v, want Bearer abc", secret, err)
+	}
+
+	if err := keychain.Delete("github"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := keychain.Delete("github"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a missing secret = %v, want ErrNotFound", err)
+	}
+
+	secretTool = filepath.Join(dir, "missing")
+	if _, err := keychain.Get("github"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Get without secret-tool = %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build windows
+
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Credential Manager API.
+var (
+	advapi32        = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW   = advapi32.NewProc("CredReadW")
+	procCredWriteW  = advapi32.NewProc("CredWriteW")
+	procCredDeleteW = advapi32.NewProc("CredDeleteW")
+	procCredFree    = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+
+	// maxCredentialBlob is the largest secret a generic credential holds.
+	maxCredentialBlob = 5 * 512
+)
+
+// credential is the CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// systemKeychain stores secrets as generic credentials of the Credential
+// Manager, with the target "gdl:name".
+type systemKeychain struct{}
+
+// target returns the target name of the secret name.
+func target(name string) (*uint16, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	return windows.UTF16PtrFromString(Service + ":" + name)
+}
+
+// Get reads the credential.
+func (systemKeychain) Get(name string) (string, error) {
+	targetName, err := target(name)
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(targetName)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		return "", credentialError("read", err)
+	}
+	defer func() { _, _, _ = procCredFree.Call(uintptr(unsafe.Pointer(cred))) }()
+
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+// Set writes the credential, replacing the one there was.
+func (systemKeychain) Set(name, secret string) error {
+	targetName, err := target(name)
+	if err != nil {
+		return err
+	}
+
+	if len(secret) > maxCredentialBlob {
+		return fmt.Errorf("secret of %d bytes exceeds the %d the Credential Manager holds", len(secret), maxCredentialBlob)
+	}
+
+	userName, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	blob := []byte(secret)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         targetName,
+		CredentialBlobSize: uint32(len(blob)), // #nosec G115 -- at most maxCredentialBlob
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+
+	r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if r == 0 {
+		return credentialError("write", err)
+	}
+
+	return nil
+}
+
+// Delete deletes the credential.
+func (systemKeychain) Delete(name string) error {
+	targetName, err := target(name)
+	if err != nil {
+		return err
+	}
+
+	r, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(targetName)), credTypeGeneric, 0)
+	if r == 0 {
+		return credentialError("delete", err)
+	}
+
+	return nil
+}
+
+// credentialError returns the error of a failed Credential Manager call.
+func credentialError(op string, err error) error {
+	if errors.Is(err, windows.ERROR_NOT_FOUND) {
+		return ErrNotFound
+	}
+
+	if err := advapi32.Load(); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	return fmt.Errorf("credential %s: %w", op, err)
+}
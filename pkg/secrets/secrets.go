@@ -0,0 +1,147 @@
+// Package secrets keeps credentials such as tokens, passwords and plugin
+// settings in the platform keychain (the macOS Keychain, the Windows
+// Credential Manager, or a Secret Service such as GNOME Keyring through
+// libsecret's secret-tool) instead of plaintext configuration files.
+// Configuration values refer to a stored secret as "keychain:NAME" and are
+// resolved with Resolve when they are used. Helper gets credentials from an
+// external credential helper instead, as git does.
+//
+// Example:
+//
+//	keychain := secrets.System()
+//	_ = keychain.Set("github", "Bearer ghp_...")
+//	header, err := secrets.Resolve(keychain, "keychain:github")
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Service is the service, or target prefix, secrets are stored under.
+const Service = "gdl"
+
+// RefPrefix starts a configuration value referring to a stored secret.
+const RefPrefix = "keychain:"
+
+var (
+	// ErrNotFound is returned for a secret the keychain does not hold.
+	ErrNotFound = errors.New("secret not found in the keychain")
+
+	// ErrUnavailable is returned when the platform has no keychain gdl can
+	// use, such as Linux without secret-tool.
+	ErrUnavailable = errors.New("no keychain available")
+)
+
+// Keychain stores secrets by name.
+type Keychain interface {
+	// Get returns the secret called name, or ErrNotFound.
+	Get(name string) (string, error)
+
+	// Set stores secret as name, replacing the secret it held.
+	Set(name, secret string) error
+
+	// Delete removes the secret called name, or returns ErrNotFound.
+	Delete(name string) error
+}
+
+// System returns the keychain of the platform. Its methods fail with
+// ErrUnavailable where there is none.
+func System() Keychain {
+	return systemKeychain{}
+}
+
+// Ref returns the configuration value referring to the secret name.
+func Ref(name string) string {
+	return RefPrefix + name
+}
+
+// IsRef reports whether a configuration value refers to a stored secret.
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// Resolve returns the secret value refers to, or value itself when it is
+// not a reference.
+func Resolve(keychain Keychain, value string) (string, error) {
+	name, ok := strings.CutPrefix(value, RefPrefix)
+	if !ok {
+		return value, nil
+	}
+
+	secret, err := keychain.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %w", name, err)
+	}
+
+	return secret, nil
+}
+
+// ValidateName checks the name of a secret: it must not be empty or hold
+// control characters.
+func ValidateName(name string) error {
+	if name == "" {
+		return errors.New("secret name cannot be empty")
+	}
+
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("secret name %q holds control characters", name)
+	}
+
+	return nil
+}
+
+// Memory is a Keychain held in memory, for tests.
+type Memory struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+// NewMemory returns an empty in-memory keychain.
+func NewMemory() *Memory {
+	return &Memory{secrets: make(map[string]string)}
+}
+
+// Get returns the secret called name.
+func (m *Memory) Get(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return secret, nil
+}
+
+// Set stores secret as name.
+func (m *Memory) Set(name, secret string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.secrets[name] = secret
+
+	return nil
+}
+
+// Delete removes the secret called name.
+func (m *Memory) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.secrets[name]; !ok {
+		return ErrNotFound
+	}
+
+	delete(m.secrets, name)
+
+	return nil
+}
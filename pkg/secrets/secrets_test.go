@@ -0,0 +1,83 @@
+package secrets
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	keychain := NewMemory()
+
+	if _, err := keychain.Get("token"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing secret = %v, want ErrNotFound", err)
+	}
+
+	if err := keychain.Set("token", "one"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := keychain.Set("token", "two"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if secret, err := keychain.Get("token"); err != nil || secret != "two" {
+		t.Errorf("Get = %q, %v, want two", secret, err)
+	}
+
+	if err := keychain.Delete("token"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := keychain.Delete("token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a missing secret = %v, want ErrNotFound", err)
+	}
+
+	if err := keychain.Set("", "secret"); err == nil {
+		t.Error("Set should reject an empty name")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	keychain := NewMemory()
+	if err := keychain.Set("github", "Bearer abc"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr error
+	}{
+		{value: "plain", want: "plain"},
+		{value: "", want: ""},
+		{value: Ref("github"), want: "Bearer abc"},
+		{value: "keychain:missing", wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		got, err := Resolve(keychain, tt.value)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Resolve(%q) error = %v, want %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	if !IsRef("keychain:x") || IsRef("Bearer x") {
+		t.Error("IsRef does not match the keychain: prefix")
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"github", "plugin/s3/token", "proxy user"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q) = %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "bad\nname", "tab\tname"} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("ValidateName(%q) should fail", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteRange selects a slice of a remote resource, as an HTTP Range header
+// does.
+type ByteRange struct {
+	// Start is the offset of the first byte. A negative Start selects the
+	// last -Start bytes of the resource (a suffix range) and End is ignored.
+	Start int64
+
+	// End is the offset of the last byte, inclusive, or -1 for the end of the
+	// resource.
+	End int64
+}
+
+// ParseByteRange parses a single range in the syntax of an HTTP Range header,
+// with or without the "bytes=" prefix: "0-1048575" (the first MiB), "500-"
+// (from offset 500 to the end) or "-500" (the last 500 bytes).
+func ParseByteRange(s string) (*ByteRange, error) {
+	spec := strings.TrimSpace(s)
+	spec = strings.TrimPrefix(spec, "bytes=")
+
+	if strings.Contains(spec, ",") {
+		return nil, fmt.Errorf("range %q: multiple ranges are not supported", s)
+	}
+
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok || (first == "" && last == "") {
+		return nil, fmt.Errorf("range %q: expected START-END, START- or -LENGTH", s)
+	}
+
+	r := &ByteRange{End: -1}
+
+	if first == "" {
+		length, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || length <= 0 {
+			return nil, fmt.Errorf("range %q: invalid suffix length %q", s, last)
+		}
+		r.Start = -length
+
+		return r, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("range %q: invalid start %q", s, first)
+	}
+	r.Start = start
+
+	if last != "" {
+		end, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || end < 0 {
+			return nil, fmt.Errorf("range %q: invalid end %q", s, last)
+		}
+		r.End = end
+	}
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Validate reports whether the range selects at least one byte.
+func (r ByteRange) Validate() error {
+	if r.Start < 0 {
+		return nil
+	}
+
+	if r.End < -1 {
+		return fmt.Errorf("range %s: invalid end %d", r, r.End)
+	}
+
+	if r.End >= 0 && r.End < r.Start {
+		return fmt.Errorf("range %s: end before start", r)
+	}
+
+	return nil
+}
+
+// Length returns the number of bytes the range selects, or -1 if it extends
+// to the end of a resource of unknown size.
+func (r ByteRange) Length() int64 {
+	switch {
+	case r.Start < 0:
+		return -r.Start
+	case r.End < 0:
+		return -1
+	default:
+		return r.End - r.Start + 1
+	}
+}
+
+// String returns the range as the value of a Range header, such as
+// "bytes=0-1023", "bytes=500-" or "bytes=-500".
+func (r ByteRange) String() string {
+	switch {
+	case r.Start < 0:
+		return fmt.Sprintf("bytes=%d", r.Start)
+	case r.End < 0:
+		return fmt.Sprintf("bytes=%d-", r.Start)
+	default:
+		return fmt.Sprintf("bytes=%d-%d", r.Start, r.End)
+	}
+}
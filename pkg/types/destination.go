@@ -0,0 +1,57 @@
+package types
+
+import (
+	"context"
+	"io"
+)
+
+// Destination is where a download is stored: a local file, an object in a
+// bucket, memory, or anything else that can take writes at offsets.
+// core.Downloader.DownloadToDestination writes into it, in pieces over
+// several connections when the server allows, and commits the result only
+// once the download is complete, so a failed download never replaces what
+// the destination held.
+type Destination interface {
+	// Exists reports whether the destination already holds committed
+	// content.
+	Exists(ctx context.Context) (bool, error)
+
+	// CreateWriterAt starts an attempt at storing content of size bytes, -1
+	// when the size is unknown, and returns where to write it. Writes may
+	// come from several goroutines, each to its own part of the content.
+	CreateWriterAt(ctx context.Context, size int64) (io.WriterAt, error)
+
+	// Commit makes the content written in the attempt the destination's
+	// content, replacing the previous one as a whole.
+	Commit(ctx context.Context) error
+
+	// Abort discards the content written in the attempt, or left behind by
+	// an earlier one.
+	Abort(ctx context.Context) error
+}
+
+// ResumableDestination is a Destination that can keep the content of a failed
+// attempt, so the next attempt only downloads the rest.
+type ResumableDestination interface {
+	Destination
+
+	// Written returns how many bytes from the start of the content an earlier
+	// attempt left behind, 0 when there is none. CreateWriterAt keeps them.
+	Written(ctx context.Context) (int64, error)
+
+	// Suspend ends a failed attempt, keeping what was written for Written to
+	// report to the next one.
+	Suspend(ctx context.Context) error
+}
+
+// PartedDestination is a Destination that stores content in parts of a fixed
+// size, such as the parts of a multipart upload. The pieces a download to it
+// is split into start on part boundaries, so that each connection fills whole
+// parts.
+type PartedDestination interface {
+	Destination
+
+	// PartSize returns the size of the parts of the attempt started by the
+	// last CreateWriterAt.
+	PartSize() int64
+}
@@ -4,6 +4,7 @@ package types
 import (
 	"context"
 	"io"
+	"os"
 	"time"
 )
 
@@ -68,6 +69,116 @@ type Progress interface {
 	Error(filename string, err error)
 }
 
+// SegmentState is the state of one segment of a chunked download.
+type SegmentState int
+
+const (
+	// SegmentPending is a segment that has not received any data yet.
+	SegmentPending SegmentState = iota
+
+	// SegmentActive is a segment that is being downloaded.
+	SegmentActive
+
+	// SegmentComplete is a segment that has been downloaded completely.
+	SegmentComplete
+
+	// SegmentFailed is a segment whose connection failed.
+	SegmentFailed
+)
+
+// String returns a string representation of the segment state.
+func (s SegmentState) String() string {
+	switch s {
+	case SegmentPending:
+		return "pending"
+	case SegmentActive:
+		return "active"
+	case SegmentComplete:
+		return "complete"
+	case SegmentFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Segment describes the byte range of a chunked download fetched by one
+// connection and how much of it has arrived.
+type Segment struct {
+	// Index is the position of the segment in the file.
+	Index int `json:"index"`
+
+	// Start and End are the first and last byte offsets of the segment.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+
+	// Downloaded is the number of bytes received from Start onwards.
+	Downloaded int64 `json:"downloaded"`
+
+	// State is the current state of the segment.
+	State SegmentState `json:"state"`
+}
+
+// SegmentProgress is implemented by Progress trackers that show the state of
+// each segment of a chunked download, such as a map of completed ranges. The
+// downloader calls UpdateSegments alongside Update with a snapshot of all
+// segments that the tracker may keep.
+type SegmentProgress interface {
+	Progress
+
+	// UpdateSegments reports the current state of every segment.
+	UpdateSegments(segments []Segment)
+}
+
+// AggregateProgress defines the interface for tracking the combined progress of
+// several downloads that run as a single batch. Each job reports through its own
+// Progress, and the aggregate merges those updates into batch-level totals.
+type AggregateProgress interface {
+	// Job returns a Progress that feeds updates for the job with the given ID
+	// into the aggregate. Calling Job twice with the same ID returns the same tracker.
+	Job(id string) Progress
+
+	// Snapshot returns the current batch-level totals.
+	Snapshot() AggregateSnapshot
+}
+
+// AggregateSnapshot is a point-in-time view of the progress of a batch of downloads.
+type AggregateSnapshot struct {
+	// TotalJobs is the number of jobs registered with the aggregate.
+	TotalJobs int `json:"total_jobs"`
+
+	// CompletedJobs is the number of jobs that finished successfully.
+	CompletedJobs int `json:"completed_jobs"`
+
+	// FailedJobs is the number of jobs that reported an error.
+	FailedJobs int `json:"failed_jobs"`
+
+	// ActiveJobs is the number of jobs that have started but not yet finished.
+	ActiveJobs int `json:"active_jobs"`
+
+	// TotalBytes is the sum of the known sizes of all jobs.
+	// Jobs with an unknown size do not contribute.
+	TotalBytes int64 `json:"total_bytes"`
+
+	// DownloadedBytes is the number of bytes downloaded across all jobs.
+	DownloadedBytes int64 `json:"bytes_downloaded"`
+
+	// Speed is the combined speed of all active jobs in bytes per second.
+	Speed int64 `json:"speed"`
+
+	// Percentage is the overall completion percentage (0-100).
+	// It is -1 when no job has reported a known size.
+	Percentage float64 `json:"percentage"`
+}
+
+// I/O engines for DownloadOptions.IOEngine.
+const (
+	IOEngineAuto     = "auto"
+	IOEngineStandard = "standard"
+	IOEngineURing    = "uring"
+	IOEngineMmap     = "mmap"
+)
+
 // DownloadOptions contains configuration options for downloads.
 type DownloadOptions struct {
 	// Destination specifies the destination file path for the download.
@@ -99,16 +210,143 @@ type DownloadOptions struct {
 	// Resume indicates whether to resume partial downloads if supported.
 	Resume bool
 
+	// ResumeValidation decides what happens when the ETag, Last-Modified
+	// time or size the server reports no longer match those recorded when
+	// the partial file was started: ResumeRestart (or empty) downloads the
+	// file again from the start, ResumeStrict fails with CodeCorruptedData
+	// and ResumeIgnore continues the partial file anyway.
+	ResumeValidation string
+
 	// OverwriteExisting indicates whether to overwrite existing files.
 	OverwriteExisting bool
 
+	// CollisionPolicy decides what happens when the destination already
+	// exists: CollisionFail, CollisionOverwrite, CollisionSkip,
+	// CollisionRename or CollisionResume. Empty leaves it to
+	// OverwriteExisting and Resume.
+	CollisionPolicy string
+
 	// CreateDirs indicates whether to create parent directories if they don't exist.
 	CreateDirs bool
 
+	// OnlyIfNewer enables timestamping: the request is made conditional on the
+	// existing local file (If-Modified-Since, and If-None-Match with the ETag
+	// recorded by the previous download) and the download is skipped when the
+	// server copy is not newer. Otherwise the file is replaced and its
+	// modification time set to the server's Last-Modified time.
+	OnlyIfNewer bool
+
+	// ByteRange downloads only a slice of the resource with an HTTP Range
+	// request, to the destination or writer. It takes precedence over Resume,
+	// OnlyIfNewer, chunked downloads and the content store. When the server
+	// ignores the Range header, the slice is cut out of the full response.
+	// nil downloads the whole resource.
+	ByteRange *ByteRange
+
+	// Method is the HTTP method of the download request, such as POST for an
+	// API that returns a file in response to a query. Empty means GET.
+	Method string
+
+	// Body is sent as the request body, and sent again on every retry. A
+	// request with a body or a method other than GET is downloaded as a single
+	// stream, without the HEAD request that chooses the download strategy.
+	Body []byte
+
+	// BodyFile names a file sent as the request body, reopened for every
+	// retry. It cannot be combined with Body.
+	BodyFile string
+
+	// AtomicWrite writes the download to "<destination>.gdl-part" (or a file in
+	// TempDir) and renames it into place on success, so consumers never observe
+	// a truncated file. An existing part file is resumed automatically.
+	AtomicWrite bool
+
+	// TempDir holds the part files of atomic downloads instead of the
+	// destination's directory. Renames across file systems fall back to a copy.
+	TempDir string
+
+	// KeepDownloadTime leaves the modification time of the completed file at
+	// the time of the download. By default it is set to the server's
+	// Last-Modified time when the server sends one. OnlyIfNewer always sets it.
+	KeepDownloadTime bool
+
+	// FileMode sets the permission bits of the completed file, such as 0755
+	// for an executable or 0644 to share it. 0 keeps the mode the file was
+	// created with.
+	FileMode os.FileMode
+
+	// Xattrs records the source URL (user.xdg.origin.url) and the SHA-256 of
+	// the content (user.checksum.sha256) in extended attributes of the
+	// completed file, on Linux and macOS file systems that support them.
+	Xattrs bool
+
+	// DirectIO writes large downloads with direct I/O (O_DIRECT on Linux,
+	// F_NOCACHE on macOS) through an aligned buffer, bypassing the page cache.
+	// File systems without support fall back to regular writes.
+	DirectIO bool
+
+	// WriteBufferSize sets the write buffer of large downloads in bytes
+	// (0 = default). With DirectIO it is rounded up to the 4 KiB alignment.
+	WriteBufferSize int
+
+	// IOEngine selects how chunked downloads write to disk. IOEngineURing
+	// writes chunks in place through io_uring on Linux, falling back at runtime
+	// when the kernel or build (tag gdl_nouring) does not support it.
+	// IOEngineMmap copies chunks into a shared mapping of the destination on
+	// Unix systems, falling back where the file cannot be mapped.
+	// IOEngineStandard and IOEngineAuto (or empty) write chunk files that are
+	// merged; auto will prefer io_uring once it is no longer experimental.
+	IOEngine string
+
+	// SparseFile writes the chunks of a chunked download in place into a
+	// sparse destination, sized with truncate and written with positional
+	// writes, instead of preallocating it or merging chunk files, so disk
+	// usage grows with the data received. With Resume, the downloaded ranges
+	// are recorded in a chunk map and an interrupted download fetches only
+	// the holes.
+	SparseFile bool
+
+	// StreamOrder fetches chunked and multi-source downloads from the
+	// beginning of the file to its end, in pieces of about 1 MiB with a short
+	// lookahead, writing them in place, so that a media player can start
+	// reading the destination before the download completes. Single-stream
+	// downloads are always written in order.
+	StreamOrder bool
+
+	// MaxBodySize fails a download to a writer whose response body is larger
+	// than this many bytes with a CodeValidationError wrapping
+	// errors.ErrResponseTooLarge, before any of it is read when Content-Length
+	// announces it, and otherwise once the limit is passed (0 = unlimited).
+	MaxBodySize int64
+
 	// MaxConcurrency specifies the maximum number of concurrent download chunks.
 	// Only applicable for downloads that support parallel downloading.
 	MaxConcurrency int
 
+	// SmallFileThreshold skips the HEAD request for files smaller than this
+	// many bytes: the download starts with its GET request and a response
+	// whose Content-Length is below the threshold is written straight to the
+	// destination. Larger responses continue on the regular path, described
+	// by the GET's headers. Resumed and multi-source downloads always send
+	// HEAD first. 0 disables it.
+	SmallFileThreshold int64
+
+	// Mirrors are other URLs serving the same file. When the download's URL
+	// and at least one mirror serve it in ranges with the same size, the file
+	// is split into pieces fetched from all of them at once; a source that
+	// falls behind hands the rest of its piece to a faster one.
+	Mirrors []string
+
+	// MirrorStrategy decides which mirrors join the download and in which
+	// order: MirrorOrdered (or empty) keeps the listed order, MirrorFastest
+	// orders them by how fast they answered their probe and MirrorRandom
+	// shuffles them. The download's URL always comes first.
+	MirrorStrategy string
+
+	// MaxMirrors is how many mirrors, taken in MirrorStrategy order, join the
+	// download. 0 uses all that serve the file.
+	MaxMirrors int
+
 	// ProgressCallback is called periodically during download to report progress.
 	// If set, this takes precedence over the Progress interface.
 	ProgressCallback func(bytesDownloaded, totalBytes int64, speed int64)
@@ -117,14 +355,424 @@ type DownloadOptions struct {
 	MaxRedirects int
 
 	// InsecureSkipVerify skips TLS certificate verification when true.
+	// Public keys pinned in TLS are still checked.
 	InsecureSkipVerify bool
 
-	// ProxyURL specifies the HTTP proxy URL to use for requests.
+	// TLS configures custom CA bundles, a client certificate for mutual TLS and
+	// pinned server public keys. If nil, the system trust store is used.
+	TLS *TLSOptions
+
+	// ProxyURL specifies the proxy URL to use for requests.
+	//
+	// Deprecated: Use Proxy. ProxyURL is used as Proxy.URL when Proxy is nil.
 	ProxyURL string
 
+	// Proxy configures HTTP(S) and SOCKS5 proxies per scheme, proxy
+	// authentication and hosts that bypass the proxy. If nil, the proxy
+	// environment variables (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) are used.
+	Proxy *ProxyConfig
+
 	// MaxRate specifies the maximum download rate in bytes per second.
 	// A value of 0 means unlimited bandwidth.
 	MaxRate int64
+
+	// MaxRateBurst is how many bytes the rate limiter lets through at once
+	// (0 = ratelimit.DefaultBurst, about 50ms of data). Smaller bursts keep
+	// the rate steadier at the cost of more, smaller reads.
+	MaxRateBurst int64
+
+	// MinSpeed aborts a transfer whose speed, in bytes per second, stays below
+	// this value for StallTimeout (30 seconds if unset). The attempt
+	// fails with a retryable error wrapping errors.ErrTooSlow. 0 disables it.
+	MinSpeed int64
+
+	// StallTimeout is the window MinSpeed is measured over. Set on its own, it
+	// aborts a transfer that receives no data for this long. 0 disables it.
+	StallTimeout time.Duration
+
+	// MinFreeSpace is the free space, in bytes, to keep on the destination's
+	// filesystem. While the download runs, free space is checked periodically
+	// and the download stops with a CodeInsufficientSpace error once it falls
+	// below this value, keeping the partial file for a later resume. 0
+	// disables the check.
+	MinFreeSpace int64
+
+	// Backoff configures the delay between retry attempts and the overall retry budget.
+	// If nil, the downloader's retry strategy is used unchanged.
+	Backoff *BackoffPolicy
+
+	// RetryCallback is called before each retry attempt with the number of the
+	// attempt that failed, the error it failed with, and the delay before the next one.
+	RetryCallback func(attempt int, err error, delay time.Duration)
+
+	// RetryClassifier decides whether a failed attempt is retried, how long to
+	// wait first and whether the next attempt goes to the next of Mirrors. It
+	// is called with the error and the number of the attempt that failed;
+	// MaxRetries still caps the attempts. nil retries the errors
+	// errors.IsRetryable accepts.
+	RetryClassifier func(err error, attempt int) RetryDecision
+
+	// URLRefresher returns a fresh URL for the same file when the server
+	// rejects the current one with 400, 401 or 403, as presigned S3 or GCS
+	// links do once they expire. The download continues from the new URL,
+	// resuming when Resume is set, without using up a retry. It is not called
+	// again if the refreshed URL is rejected straight away. nil disables it.
+	URLRefresher func(ctx context.Context, oldURL string) (string, error)
+
+	// CircuitBreaker enables the per-host circuit breaker. The breaker state is
+	// shared by all downloads made through the same downloader. If nil, the
+	// downloader's own breaker (if any) is used.
+	CircuitBreaker *CircuitBreakerPolicy
+
+	// HostLimits caps the connections to each host and spaces out requests to
+	// it. The limits are shared by all downloads made through the same
+	// downloader, chunk workers included. If nil, the downloader's own limits
+	// (if any) apply.
+	HostLimits *HostLimitPolicy
+
+	// HostCache is the path of a JSON file remembering what was learned about
+	// each host: whether it rejects HEAD requests, supports ranges, its HTTP
+	// version, round-trip time and throughput. Downloads skip HEAD requests
+	// to hosts known to reject them and size their pieces from the known
+	// throughput. Empty disables the cache.
+	HostCache string
+
+	// Transport overrides the connection pooling settings. Downloads with equal
+	// settings share one transport, so connections and TLS sessions are reused
+	// across jobs. If nil, the downloader's shared transport is used.
+	Transport *TransportOptions
+
+	// DNS controls name resolution and the IP version used for connections.
+	// If nil, the system resolver is used.
+	DNS *DNSOptions
+
+	// ContentStore deduplicates downloads through a content-addressable store.
+	// If nil, every download fetches its content from the server.
+	ContentStore *ContentStoreOptions
+
+	// Delta updates an existing local copy of the file from a zsync control
+	// file: blocks the local copy already holds are reused and only the rest
+	// is downloaded. If nil, the whole file is downloaded.
+	Delta *DeltaOptions
+
+	// Quota limits the total size of the files in a directory. A download
+	// that would exceed it is refused or makes room by deleting files,
+	// depending on the policy. nil disables quotas.
+	Quota *QuotaOptions
+
+	// Checksum is the expected hex encoded digest of the downloaded file. A
+	// file that does not match it is deleted and the download fails.
+	Checksum string
+
+	// ChecksumAlgorithm is the algorithm Checksum is computed with: "md5",
+	// "sha1", "sha256" (default), "sha512", "blake3" or "xxh3". BLAKE3 and
+	// xxh3 hash large files several times faster than SHA-256. Set without
+	// Checksum, the digest is only reported in DownloadStats.Checksum.
+	// Chunked downloads hash the file while its pieces are written.
+	ChecksumAlgorithm string
+
+	// Signature verifies the downloaded file against a detached OpenPGP
+	// signature. A file that fails verification is deleted and the download
+	// fails. nil disables verification.
+	Signature *SignatureOptions
+
+	// Scan checks the completed download for viruses and malware. A flagged
+	// file is deleted or quarantined and the download fails. nil disables
+	// scanning.
+	Scan *ScanOptions
+}
+
+// ContentStoreOptions configures download deduplication. Completed downloads
+// are indexed by SHA-256; content requested again, either for the same URL
+// and ETag or by a known digest, is placed from the store instead of being
+// downloaded.
+type ContentStoreOptions struct {
+	// Dir is the directory holding the store.
+	Dir string
+
+	// SHA256 is the expected hex encoded digest of the content, e.g. from a
+	// checksum manifest. When the store holds it no request is made.
+	SHA256 string
+
+	// HardLink hard-links files from the store instead of copying them when
+	// the destination is on the same file system. Linked files share their
+	// data with the store; objects are verified before reuse.
+	HardLink bool
+}
+
+// DeltaOptions configures delta updates from a zsync control file, as
+// published next to nightly images (for example image.iso.zsync).
+type DeltaOptions struct {
+	// Control is the path or http(s) URL of the zsync control file.
+	Control string
+
+	// Seed is the local file blocks are reused from. It defaults to the
+	// destination, the outdated copy being updated.
+	Seed string
+}
+
+// Policies for DownloadOptions.CollisionPolicy.
+const (
+	// CollisionFail fails the download with CodeFileExists.
+	CollisionFail = "fail"
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite = "overwrite"
+	// CollisionSkip keeps the existing file and reports the download as
+	// skipped.
+	CollisionSkip = "skip"
+	// CollisionRename downloads to the first free name with a numeric
+	// suffix, such as "report-1.pdf".
+	CollisionRename = "rename"
+	// CollisionResume continues a partial file and keeps a complete one.
+	CollisionResume = "resume"
+)
+
+// Policies for DownloadOptions.ResumeValidation.
+const (
+	// ResumeStrict fails the download, keeping the partial file.
+	ResumeStrict = "strict"
+	// ResumeRestart discards the partial file and downloads the file again.
+	ResumeRestart = "restart"
+	// ResumeIgnore continues the partial file without checking it.
+	ResumeIgnore = "ignore"
+)
+
+// Strategies for DownloadOptions.MirrorStrategy.
+const (
+	// MirrorOrdered uses the mirrors in the order they are listed.
+	MirrorOrdered = "ordered"
+	// MirrorFastest uses the mirrors that answered their probe first.
+	MirrorFastest = "fastest"
+	// MirrorRandom uses the mirrors in a random order, spreading the load of
+	// many clients across a mirror list.
+	MirrorRandom = "random"
+)
+
+// Policies for QuotaOptions.Policy.
+const (
+	QuotaPolicyRefuse = "refuse"
+	QuotaPolicyOldest = "oldest"
+	QuotaPolicyLRU    = "lru"
+)
+
+// QuotaOptions configures a size quota for a directory, for example the
+// target directory of a batch of downloads or the gdl cache.
+type QuotaOptions struct {
+	// Dir is the directory the quota applies to, including its
+	// subdirectories. Empty means the destination's directory.
+	Dir string
+
+	// MaxSize is the maximum total size of the files in Dir in bytes.
+	MaxSize int64
+
+	// Policy decides what happens when a download would exceed MaxSize:
+	// QuotaPolicyRefuse (or empty) fails the download, QuotaPolicyOldest
+	// deletes the least recently modified files and QuotaPolicyLRU the least
+	// recently accessed files until it fits. Partial downloads and gdl's own
+	// state (the configuration in ~/.config/gdl, and the history, schedules,
+	// usage, host cache, plugins and resume data in ~/.gdl) are never deleted.
+	Policy string
+}
+
+// SignatureOptions configures verification of a downloaded file against a
+// detached OpenPGP signature, as published next to release tarballs and ISO
+// images.
+type SignatureOptions struct {
+	// Signature is the path or http(s) URL of the detached signature, either
+	// ASCII armored (.asc) or binary (.sig).
+	Signature string
+
+	// Keyring is the path of the public keys trusted to sign the file, either
+	// ASCII armored or binary (as exported by gpg --export).
+	Keyring string
+}
+
+// Actions for ScanOptions.Action.
+const (
+	ScanActionDelete     = "delete"
+	ScanActionQuarantine = "quarantine"
+)
+
+// ScanOptions configures scanning of completed downloads. Every configured
+// scanner must clear the file; a file that is flagged is deleted or
+// quarantined, and a file that cannot be scanned is kept but the download
+// still fails.
+type ScanOptions struct {
+	// Clamd is the address of a ClamAV daemon the file is streamed to:
+	// "host:port", "tcp://host:port", "unix:///path" or a socket path.
+	Clamd string
+
+	// Command is a scanner command line, e.g. "clamscan --no-summary". The
+	// file's path replaces "{}" or is appended. Exit status 0 means clean, 1
+	// means infected and anything else that the scan failed.
+	Command string
+
+	// Scanner is a custom scanner, run after Clamd and Command.
+	Scanner FileScanner
+
+	// Action decides what happens to a flagged file: ScanActionDelete (or
+	// empty) deletes it, ScanActionQuarantine moves it to QuarantineDir.
+	Action string
+
+	// QuarantineDir receives flagged files when Action is ScanActionQuarantine.
+	QuarantineDir string
+
+	// Timeout bounds each scanner (0 = 5 minutes).
+	Timeout time.Duration
+}
+
+// FileScanner scans a file for viruses and malware. ScanFile returns an error
+// only when the file could not be scanned.
+type FileScanner interface {
+	ScanFile(ctx context.Context, path string) (*ScanResult, error)
+}
+
+// ScanResult is the verdict of a FileScanner.
+type ScanResult struct {
+	// Clean reports whether the file passed the scan.
+	Clean bool
+
+	// Threat names what the scanner found in a file that is not clean.
+	Threat string
+}
+
+// TLSOptions configures certificate verification and client authentication.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of CA certificates trusted in addition to the
+	// system roots, e.g. for internal services with a private CA.
+	CAFile string
+
+	// CertFile and KeyFile are the PEM client certificate and private key
+	// presented to servers that require mutual TLS.
+	CertFile string
+	KeyFile  string
+
+	// PinnedPublicKeys are SHA-256 hashes of the accepted server public keys
+	// (SubjectPublicKeyInfo), either "sha256//<base64>" as in curl or hex encoded.
+	// The connection fails unless the server's key matches one of them.
+	PinnedPublicKeys []string
+}
+
+// ProxyConfig configures the proxies used for downloads. Proxy URLs may use the
+// http, https, socks5 and socks5h schemes; with socks5h host names are resolved
+// by the proxy.
+type ProxyConfig struct {
+	// URL is the proxy for all schemes without a more specific proxy below.
+	URL string
+
+	// HTTPURL is the proxy for http:// requests.
+	HTTPURL string
+
+	// HTTPSURL is the proxy for https:// requests.
+	HTTPSURL string
+
+	// NoProxy lists hosts, domains (".example.com"), IP addresses and CIDR ranges
+	// that are connected to directly, like the NO_PROXY environment variable.
+	NoProxy []string
+
+	// Username and Password authenticate with the proxy. Credentials embedded
+	// in a proxy URL take precedence.
+	Username string
+	Password string
+}
+
+// DNSOptions configures name resolution for downloads.
+type DNSOptions struct {
+	// Servers are DNS servers (host or host:port) used instead of the system resolver.
+	Servers []string
+
+	// DoHURL is a DNS-over-HTTPS endpoint (RFC 8484). It takes precedence over Servers.
+	DoHURL string
+
+	// IPVersion restricts connections to IPv4 (4) or IPv6 (6). Zero uses both.
+	IPVersion int
+
+	// Resolve maps "host:port" to a fixed IP address, like curl's --resolve.
+	Resolve map[string]string
+}
+
+// TransportOptions tunes the pooled HTTP transport. Zero values keep the defaults.
+type TransportOptions struct {
+	// MaxIdleConns limits idle connections across all hosts.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost limits idle connections kept open per host.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits the total number of connections per host.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept for reuse.
+	IdleConnTimeout time.Duration
+
+	// KeepAlive is the TCP keep-alive probe interval.
+	KeepAlive time.Duration
+
+	// DisableKeepAlives closes each connection after a single request.
+	DisableKeepAlives bool
+
+	// TLSSessionCacheSize is the number of TLS sessions cached for resumption.
+	TLSSessionCacheSize int
+}
+
+// CircuitBreakerPolicy configures when requests to a failing host are rejected.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures after which the
+	// host's circuit opens. Zero uses the default of 5.
+	FailureThreshold int
+
+	// Cooldown is how long the circuit stays open before a single probe request
+	// is allowed through. Zero uses the default of 30 seconds.
+	Cooldown time.Duration
+}
+
+// HostLimitPolicy configures how politely each host is treated.
+type HostLimitPolicy struct {
+	// MaxConnections caps the requests in flight to one host. Zero means no cap.
+	MaxConnections int
+
+	// Delay is the minimum time between the starts of two requests to the
+	// same host. Zero means no delay.
+	Delay time.Duration
+}
+
+// BackoffPolicy configures how long to wait between retry attempts.
+type BackoffPolicy struct {
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+
+	// MaxDelay caps the delay between two attempts.
+	MaxDelay time.Duration
+
+	// Multiplier is the exponential growth factor applied after each attempt.
+	// A value of 1 keeps the delay constant.
+	Multiplier float64
+
+	// Jitter randomizes each delay between zero and its computed value so that
+	// many clients retrying at once do not hit the server in lockstep.
+	Jitter bool
+
+	// MaxElapsedTime is the retry budget. No retry is started once it would begin
+	// later than this long after the first attempt. Zero means no budget.
+	MaxElapsedTime time.Duration
+
+	// IgnoreRetryAfter disables honoring Retry-After headers on 429 and 503
+	// responses. An honored Retry-After is capped at MaxDelay.
+	IgnoreRetryAfter bool
+}
+
+// RetryDecision is a RetryClassifier's verdict on a failed attempt.
+type RetryDecision struct {
+	// Retry makes another attempt; false fails the download with the error.
+	Retry bool
+
+	// Delay replaces the wait before the next attempt. Zero keeps the
+	// backoff delay, or the server's Retry-After hint.
+	Delay time.Duration
+
+	// SwitchMirror makes the next attempt fetch the file from the next URL in
+	// Mirrors, going back to the first URL after the last mirror.
+	SwitchMirror bool
 }
 
 // DownloadStats contains statistics about a completed or failed download.
@@ -165,8 +813,106 @@ type DownloadStats struct {
 	// Resumed indicates whether this download was resumed from a partial file.
 	Resumed bool
 
+	// NotModified indicates that the download was skipped because the local
+	// file is up to date (see DownloadOptions.OnlyIfNewer).
+	NotModified bool
+
+	// Deduplicated indicates that the content was placed from the content
+	// store instead of being downloaded (see DownloadOptions.ContentStore).
+	Deduplicated bool
+
+	// DeltaReused is the number of bytes of a delta update taken from the
+	// local copy instead of downloaded (see DownloadOptions.Delta).
+	DeltaReused int64
+
+	// Skipped indicates that the destination already existed and was kept
+	// (see DownloadOptions.CollisionPolicy).
+	Skipped bool
+
+	// LastModified is the server's Last-Modified time of the file, or zero
+	// if it did not send one.
+	LastModified time.Time
+
 	// ChunksUsed indicates the number of concurrent chunks used for download.
 	ChunksUsed int
+
+	// Connections breaks the transfer of the final attempt down by connection:
+	// one entry per chunk for concurrent downloads, or a single entry.
+	Connections []ConnectionStats
+
+	// RangeViolations counts responses to range requests that ignored the
+	// range (200 with the whole file) or sent other bytes than requested. The
+	// connection of each was closed and the range requested again.
+	RangeViolations int
+
+	// RangeFallback indicates that range requests kept being violated and the
+	// file was downloaded as a single stream instead.
+	RangeFallback bool
+
+	// Checksum is the hex encoded digest of the file with
+	// DownloadOptions.ChecksumAlgorithm, when a checksum was asked for.
+	Checksum string
+
+	// Plan describes how a download split into pieces was fetched, or is nil
+	// for a download made in one request.
+	Plan *TransferPlan
+}
+
+// TransferPlan describes how a download split into pieces was fetched: how
+// small pieces were coalesced into fewer, larger range requests.
+type TransferPlan struct {
+	// Sources is the number of URLs the pieces were fetched from.
+	Sources int
+
+	// Pieces is the number of pieces the file was split into, and PieceSize
+	// the size of each but the last.
+	Pieces    int
+	PieceSize int64
+
+	// Requests is the number of range requests made, adjacent pieces fetched
+	// together in one request counting once.
+	Requests int
+}
+
+// ConnectionStats describes the transfer over one connection of a download,
+// for diagnosing mirrors or CDN nodes that serve some ranges slower than others.
+type ConnectionStats struct {
+	// Index is the chunk the connection fetched (0 for single-connection downloads).
+	Index int
+
+	// RangeStart and RangeEnd are the byte range requested. RangeEnd is -1
+	// when the request was open-ended.
+	RangeStart int64
+	RangeEnd   int64
+
+	// BytesDownloaded is the number of bytes received over the connection.
+	BytesDownloaded int64
+
+	// Duration is how long the transfer took, including retries.
+	Duration time.Duration
+
+	// Requests is the number of range requests made for a multi-source entry,
+	// adjacent pieces fetched together counting once. It is 0 for a single
+	// request.
+	Requests int
+
+	// Retries is the number of times the range was requested again after a failure.
+	Retries int
+
+	// Speed is the average transfer speed in bytes per second.
+	Speed int64
+
+	// ServerIP is the IP address the connection was made to (the proxy's when
+	// a proxy is used). Empty if no connection was established.
+	ServerIP string
+
+	// URL is the source of a multi-source download the entry stands for. Its
+	// range then spans the pieces fetched from the source. Empty otherwise.
+	URL string
+
+	// RangeViolations counts the responses for the range that ignored it or
+	// sent other bytes, each answered by closing the connection.
+	RangeViolations int
 }
 
 // DownloadError represents errors that can occur during downloads.
@@ -210,6 +956,9 @@ type FileInfo struct {
 	// URL is the source URL of the file.
 	URL string
 
+	// FinalURL is the URL the request ended at after following redirects.
+	FinalURL string
+
 	// Size is the size of the file in bytes.
 	Size int64
 
@@ -228,3 +977,16 @@ type FileInfo struct {
 	// Headers contains the response headers from the server.
 	Headers map[string][]string
 }
+
+// FileInfoResult is the outcome of retrieving information about one URL in a
+// batch.
+type FileInfoResult struct {
+	// URL is the URL that was queried.
+	URL string
+
+	// Info is the file information, nil when Error is set.
+	Info *FileInfo
+
+	// Error is the error that occurred while querying the URL, if any.
+	Error error
+}
@@ -413,3 +413,48 @@ func TestDownloadStats_TimeCalculations(t *testing.T) {
 		}
 	}
 }
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ByteRange
+		header  string
+		length  int64
+		wantErr bool
+	}{
+		{input: "bytes=0-1048575", want: ByteRange{0, 1048575}, header: "bytes=0-1048575", length: 1048576},
+		{input: "500-", want: ByteRange{500, -1}, header: "bytes=500-", length: -1},
+		{input: "-500", want: ByteRange{-500, -1}, header: "bytes=-500", length: 500},
+		{input: " bytes=7-7 ", want: ByteRange{7, 7}, header: "bytes=7-7", length: 1},
+		{input: "10-5", wantErr: true},
+		{input: "0-1,5-9", wantErr: true},
+		{input: "-", wantErr: true},
+		{input: "-0", wantErr: true},
+		{input: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseByteRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseByteRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if *got != tt.want {
+				t.Errorf("ParseByteRange(%q) = %+v, want %+v", tt.input, *got, tt.want)
+			}
+
+			if got.String() != tt.header {
+				t.Errorf("String() = %q, want %q", got.String(), tt.header)
+			}
+
+			if got.Length() != tt.length {
+				t.Errorf("Length() = %d, want %d", got.Length(), tt.length)
+			}
+		})
+	}
+}
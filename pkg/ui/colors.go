@@ -53,20 +53,10 @@ type ColorConfig struct {
 }
 
 var defaultColorConfig = &ColorConfig{
-	Enabled: isTerminal() && supportsColor(),
+	Enabled: IsTerminal(os.Stdout) && supportsColor(),
 	Force:   false,
 }
 
-// isTerminal checks if output is a terminal.
-func isTerminal() bool {
-	fileInfo, err := os.Stdout.Stat()
-	if err != nil {
-		return false
-	}
-
-	return (fileInfo.Mode() & os.ModeCharDevice) != 0
-}
-
 // supportsColor checks if the terminal supports colors.
 func supportsColor() bool {
 	// Check for NO_COLOR environment variable
@@ -86,10 +76,9 @@ func supportsColor() bool {
 		return true
 	}
 
-	// Windows specific check
+	// Windows 10+ consoles support ANSI colors once enabled
 	if runtime.GOOS == "windows" {
-		// Windows 10+ supports ANSI colors
-		return true
+		return EnableVirtualTerminal(os.Stdout)
 	}
 
 	return term != "dumb" && term != ""
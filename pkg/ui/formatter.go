@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 // Color constants for terminal output.
@@ -48,11 +50,14 @@ const (
 type Formatter struct {
 	colorEnabled bool
 	writer       io.Writer
+	reader       *bufio.Reader
 	language     Language
 	interactive  bool
 }
 
-// Language represents supported languages.
+// Language is a lowercase language tag such as "ja" or "pt-br". The
+// constants below have built-in messages; others are available once their
+// locale file is loaded into the DefaultCatalog.
 type Language string
 
 const (
@@ -101,6 +106,10 @@ type ProgressBarOptions struct {
 	ShowSize        bool          // Show downloaded/total size
 	RefreshInterval time.Duration // How often to refresh
 	Template        string        // Custom template for progress display
+
+	// Segments, when set, replaces the bar with a map of the segments of a
+	// chunked download (see FormatSegmentMap).
+	Segments []types.Segment
 }
 
 // ErrorFormatOptions configures error message formatting.
@@ -110,6 +119,7 @@ type ErrorFormatOptions struct {
 	ShowTimestamp   bool // Show timestamp
 	Compact         bool // Use compact format
 	MultiLine       bool // Use multi-line format for complex errors
+	ShowResponse    bool // Show the body of HTTP error responses
 }
 
 // StatusIndicator represents different status states.
@@ -135,11 +145,19 @@ const (
 	StatusCancelled
 )
 
-// IsColorSupported checks if the terminal supports color output.
+// IsColorSupported checks if the terminal supports color output. Output
+// redirected to a file or a pipe is never colored, and Windows consoles are
+// switched to ANSI escape processing.
 func IsColorSupported() bool {
+	// Check for NO_COLOR environment variable (https://no-color.org/)
+	if os.Getenv("NO_COLOR") != "" || !IsTerminal(os.Stdout) {
+		return false
+	}
+
 	term := os.Getenv("TERM")
 	if term == "" {
-		return false
+		// Windows consoles don't set TERM
+		return runtime.GOOS == "windows" && EnableVirtualTerminal(os.Stdout)
 	}
 
 	// Check for common terminals that support color
@@ -150,18 +168,13 @@ func IsColorSupported() bool {
 		}
 	}
 
-	// Check for NO_COLOR environment variable (https://no-color.org/)
-	if os.Getenv("NO_COLOR") != "" {
-		return false
-	}
-
 	return term != "dumb"
 }
 
-// IsTerminalInteractive checks if the current session is interactive.
+// IsTerminalInteractive checks if the current session is interactive: stdin
+// and stdout are terminals and it is not running under CI.
 func IsTerminalInteractive() bool {
-	// Check if stdin, stdout, and stderr are terminals
-	return os.Getenv("TERM") != "" && os.Getenv("CI") == ""
+	return IsTerminal(os.Stdin) && IsTerminal(os.Stdout) && os.Getenv("CI") == ""
 }
 
 // colorize applies color formatting to text if colors are enabled.
@@ -195,12 +208,29 @@ func (f *Formatter) WithWriter(w io.Writer) *Formatter {
 	return f
 }
 
+// WithReader sets the input prompts read from instead of standard input.
+func (f *Formatter) WithReader(r io.Reader) *Formatter {
+	f.reader = bufio.NewReader(r)
+	return f
+}
+
 // WithLanguage sets the language for localized messages.
 func (f *Formatter) WithLanguage(lang Language) *Formatter {
 	f.language = lang
 	return f
 }
 
+// Language returns the language of localized messages.
+func (f *Formatter) Language() Language {
+	return f.language
+}
+
+// Translate returns the message for key in the formatter's language from the
+// default catalog, or key itself if there is no translation.
+func (f *Formatter) Translate(key string) string {
+	return Translate(f.language, key)
+}
+
 // WithInteractive enables or disables interactive mode.
 func (f *Formatter) WithInteractive(interactive bool) *Formatter {
 	f.interactive = interactive
@@ -331,6 +361,12 @@ func (f *Formatter) formatDownloadError(
 		parts = append(parts, f.colorize(ColorMagenta, statusMsg))
 	}
 
+	// Add the server's response body if requested
+	if options.ShowResponse && err.ResponseBody != "" {
+		bodyMsg := fmt.Sprintf("%s: %s", f.localize("response_body"), err.ResponseBody)
+		parts = append(parts, f.colorize(ColorMagenta, bodyMsg))
+	}
+
 	if options.MultiLine {
 		return strings.Join(parts, "\n")
 	}
@@ -380,6 +416,10 @@ func (f *Formatter) formatDefaultProgressBar(
 		bar = filledBar + emptyBar
 	}
 
+	if len(options.Segments) > 0 {
+		bar = f.formatSegmentBar(options.Segments, options.Width)
+	}
+
 	parts = append(parts, "["+bar+"]")
 
 	// Add percentage
@@ -472,10 +512,14 @@ func (f *Formatter) Prompt(message string) (string, error) {
 	promptMsg := f.FormatMessage(MessagePrompt, "%s", message)
 	_, _ = fmt.Fprint(f.writer, promptMsg+" ")
 
-	reader := bufio.NewReader(os.Stdin)
+	reader := f.reader
+	if reader == nil {
+		reader = bufio.NewReader(os.Stdin)
+	}
 
+	// A last answer without a newline still counts
 	response, err := reader.ReadString('\n')
-	if err != nil {
+	if err != nil && (err != io.EOF || response == "") {
 		return "", err
 	}
 
@@ -570,81 +614,10 @@ func (f *Formatter) addPrefix(msgType MessageType, message string) string {
 
 // localize returns localized text based on the current language.
 func (f *Formatter) localize(key string) string {
-	translations := map[Language]map[string]string{
-		LanguageEnglish: {
-			"info":        "INFO",
-			"success":     "SUCCESS",
-			"warning":     "WARNING",
-			"error":       "ERROR",
-			"debug":       "DEBUG",
-			"prompt":      "PROMPT",
-			"timestamp":   "Timestamp",
-			"error_code":  "Error Code",
-			"details":     "Details",
-			"context":     "Context",
-			"suggestions": "Suggested Actions",
-			"url":         "URL",
-			"filename":    "Filename",
-			"http_status": "HTTP Status",
-		},
-		LanguageJapanese: {
-			"info":        "情報",
-			"success":     "成功",
-			"warning":     "警告",
-			"error":       "エラー",
-			"debug":       "デバッグ",
-			"prompt":      "プロンプト",
-			"timestamp":   "タイムスタンプ",
-			"error_code":  "エラーコード",
-			"details":     "詳細",
-			"context":     "コンテキスト",
-			"suggestions": "推奨アクション",
-			"url":         "URL",
-			"filename":    "ファイル名",
-			"http_status": "HTTPステータス",
-		},
-		LanguageSpanish: {
-			"info":        "INFO",
-			"success":     "ÉXITO",
-			"warning":     "ADVERTENCIA",
-			"error":       "ERROR",
-			"debug":       "DEBUG",
-			"prompt":      "PROMPT",
-			"timestamp":   "Marca de tiempo",
-			"error_code":  "Código de error",
-			"details":     "Detalles",
-			"context":     "Contexto",
-			"suggestions": "Acciones sugeridas",
-		},
-		LanguageFrench: {
-			"info":        "INFO",
-			"success":     "SUCCÈS",
-			"warning":     "AVERTISSEMENT",
-			"error":       "ERREUR",
-			"debug":       "DEBUG",
-			"prompt":      "PROMPT",
-			"timestamp":   "Horodatage",
-			"error_code":  "Code d'erreur",
-			"details":     "Détails",
-			"context":     "Contexte",
-			"suggestions": "Actions suggérées",
-		},
-	}
-
-	if lang, exists := translations[f.language]; exists {
-		if text, exists := lang[key]; exists {
-			return text
-		}
-	}
-
-	// Fallback to English
-	if lang, exists := translations[LanguageEnglish]; exists {
-		if text, exists := lang[key]; exists {
-			return text
-		}
+	if text, ok := DefaultCatalog().Lookup(f.language, key); ok {
+		return text
 	}
 
-	// Final fallback
 	return strings.ToUpper(key)
 }
 
@@ -0,0 +1,275 @@
+package ui
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/forest6511/gdl/pkg/errors"
+)
+
+// localeFS holds the built-in message catalogs, one <language>.json file of
+// flat key/message pairs per language.
+//
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// Catalog maps languages to their translated messages. Lookups fall back
+// from a regional language ("pt-br") to its base language ("pt") and then to
+// English. It is safe for concurrent use.
+type Catalog struct {
+	mu       sync.RWMutex
+	messages map[Language]map[string]string
+}
+
+// NewCatalog creates an empty catalog.
+func NewCatalog() *Catalog {
+	return &Catalog{messages: make(map[Language]map[string]string)}
+}
+
+var (
+	defaultCatalog     *Catalog
+	defaultCatalogOnce sync.Once
+)
+
+// DefaultCatalog returns the catalog used by formatters, preloaded with the
+// built-in locales. Locale files loaded into it with LoadDir or LoadFile
+// extend or override the built-in messages.
+func DefaultCatalog() *Catalog {
+	defaultCatalogOnce.Do(func() {
+		defaultCatalog = NewCatalog()
+		if err := defaultCatalog.loadFS(localeFS, "locales"); err != nil {
+			panic("ui: invalid built-in locale: " + err.Error())
+		}
+	})
+
+	return defaultCatalog
+}
+
+// DefaultLocaleDir returns the directory gdl loads user locale files from,
+// ~/.gdl/locales.
+func DefaultLocaleDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(homeDir, ".gdl", "locales")
+}
+
+// Add merges messages into the catalog for lang, replacing existing
+// translations of the same keys.
+func (c *Catalog) Add(lang Language, messages map[string]string) {
+	lang = ParseLanguage(string(lang))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.messages[lang] == nil {
+		c.messages[lang] = make(map[string]string, len(messages))
+	}
+
+	for key, text := range messages {
+		c.messages[lang][key] = text
+	}
+}
+
+// LoadFile adds the messages of a locale file. The language is taken from
+// the file name, so "de.json" holds German and "pt_BR.json" Brazilian
+// Portuguese messages.
+func (c *Catalog) LoadFile(filename string) error {
+	data, err := os.ReadFile(filename) // #nosec G304 -- locale files are chosen by the user
+	if err != nil {
+		return errors.NewConfigError("failed to read locale file", err, filename)
+	}
+
+	return c.load(filename, data)
+}
+
+// LoadDir adds every *.json locale file in dir. A missing directory is not
+// an error, since user locales are optional.
+func (c *Catalog) LoadDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return errors.NewConfigError("failed to list locale files", err, dir)
+	}
+
+	for _, filename := range files {
+		if err := c.LoadFile(filename); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the message for key in lang, falling back to the base
+// language and then English. ok is false if no catalog has the key.
+func (c *Catalog) Lookup(lang Language, key string) (text string, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, candidate := range languageFallbacks(ParseLanguage(string(lang))) {
+		if text, ok := c.messages[candidate][key]; ok {
+			return text, true
+		}
+	}
+
+	return "", false
+}
+
+// Translate returns the message for key in lang, or key itself if there is
+// no translation.
+func (c *Catalog) Translate(lang Language, key string) string {
+	if text, ok := c.Lookup(lang, key); ok {
+		return text
+	}
+
+	return key
+}
+
+// Languages returns the languages in the catalog, sorted.
+func (c *Catalog) Languages() []Language {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	languages := make([]Language, 0, len(c.messages))
+	for lang := range c.messages {
+		languages = append(languages, lang)
+	}
+
+	sort.Slice(languages, func(i, j int) bool { return languages[i] < languages[j] })
+
+	return languages
+}
+
+// Supports reports whether the catalog has messages for lang or its base
+// language.
+func (c *Catalog) Supports(lang Language) bool {
+	lang = ParseLanguage(string(lang))
+	base, _, _ := strings.Cut(string(lang), "-")
+
+	return c.has(lang) || c.has(Language(base))
+}
+
+// Detect picks the language for messages from the environment, checking
+// LC_ALL, LC_MESSAGES and LANG in that order as POSIX does. A regional
+// locale such as "pt_BR.UTF-8" selects "pt-br" when the catalog has it and
+// "pt" otherwise; unknown or "C"/"POSIX" locales select English.
+func (c *Catalog) Detect() Language {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		for _, candidate := range languageFallbacks(ParseLanguage(value)) {
+			if c.has(candidate) {
+				return candidate
+			}
+		}
+	}
+
+	return LanguageEnglish
+}
+
+// ParseLanguage normalizes a language tag or POSIX locale name, so
+// "ja_JP.UTF-8" becomes "ja-jp" and "fr_FR@euro" becomes "fr-fr". "C",
+// "POSIX" and empty names are English.
+func ParseLanguage(name string) Language {
+	if i := strings.IndexAny(name, ".@"); i >= 0 {
+		name = name[:i]
+	}
+
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", "-"))
+	if name == "" || name == "c" || name == "posix" {
+		return LanguageEnglish
+	}
+
+	return Language(name)
+}
+
+// DetectLanguage picks the language for messages from the environment using
+// the default catalog; see Catalog.Detect.
+func DetectLanguage() Language {
+	return DefaultCatalog().Detect()
+}
+
+// Translate returns the message for key in lang from the default catalog,
+// or key itself if there is no translation.
+func Translate(lang Language, key string) string {
+	return DefaultCatalog().Translate(lang, key)
+}
+
+// languageFallbacks lists the languages to try for lang, most specific
+// first and ending with English.
+func languageFallbacks(lang Language) []Language {
+	fallbacks := []Language{lang}
+
+	if base, _, found := strings.Cut(string(lang), "-"); found {
+		fallbacks = append(fallbacks, Language(base))
+	}
+
+	if lang != LanguageEnglish {
+		fallbacks = append(fallbacks, LanguageEnglish)
+	}
+
+	return fallbacks
+}
+
+// has reports whether the catalog has any messages for lang.
+func (c *Catalog) has(lang Language) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.messages[lang]) > 0
+}
+
+// loadFS adds every *.json file in dir of fsys.
+func (c *Catalog) loadFS(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return errors.NewConfigError("failed to list locale files", err, dir)
+	}
+
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return errors.NewConfigError("failed to read locale file", err, name)
+		}
+
+		if err := c.load(name, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load parses a locale file and adds it under the language named by the
+// file.
+func (c *Catalog) load(filename string, data []byte) error {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return errors.NewConfigError("invalid locale file", err, filename)
+	}
+
+	lang := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	c.Add(ParseLanguage(lang), messages)
+
+	return nil
+}
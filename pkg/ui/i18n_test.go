@@ -0,0 +1,151 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultCatalog(t *testing.T) {
+	catalog := DefaultCatalog()
+
+	for _, lang := range []Language{LanguageEnglish, LanguageJapanese, LanguageSpanish, LanguageFrench} {
+		if !catalog.Supports(lang) {
+			t.Errorf("built-in catalog does not support %q", lang)
+		}
+
+		// Every built-in locale translates every English key
+		for key := range catalog.messages[LanguageEnglish] {
+			if _, ok := catalog.messages[lang][key]; !ok {
+				t.Errorf("locale %q is missing %q", lang, key)
+			}
+		}
+	}
+
+	if got := Translate(LanguageJapanese, "error"); got != "エラー" {
+		t.Errorf("Translate(ja, error) = %q, want エラー", got)
+	}
+
+	if got := Translate(LanguageFrench, "no_such_key"); got != "no_such_key" {
+		t.Errorf("Translate() of an unknown key = %q, want the key", got)
+	}
+}
+
+func TestCatalogFallback(t *testing.T) {
+	catalog := NewCatalog()
+	catalog.Add(LanguageEnglish, map[string]string{"error": "ERROR", "details": "Details"})
+	catalog.Add("pt", map[string]string{"error": "ERRO"})
+	catalog.Add("pt_BR", map[string]string{"details": "Detalhes"})
+
+	tests := []struct {
+		lang Language
+		key  string
+		want string
+	}{
+		{"pt-br", "details", "Detalhes"},
+		{"pt-br", "error", "ERRO"},
+		{"pt", "details", "Details"},
+		{"de", "error", "ERROR"},
+	}
+
+	for _, tt := range tests {
+		if got := catalog.Translate(tt.lang, tt.key); got != tt.want {
+			t.Errorf("Translate(%q, %q) = %q, want %q", tt.lang, tt.key, got, tt.want)
+		}
+	}
+
+	if !catalog.Supports("pt-PT") || catalog.Supports("de") {
+		t.Error("Supports() should accept a base language and reject an unknown one")
+	}
+}
+
+func TestParseLanguage(t *testing.T) {
+	tests := map[string]Language{
+		"ja_JP.UTF-8": "ja-jp",
+		"fr_FR@euro":  "fr-fr",
+		"es":          LanguageSpanish,
+		"C":           LanguageEnglish,
+		"POSIX":       LanguageEnglish,
+		"":            LanguageEnglish,
+	}
+
+	for name, want := range tests {
+		if got := ParseLanguage(name); got != want {
+			t.Errorf("ParseLanguage(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCatalogDetect(t *testing.T) {
+	catalog := NewCatalog()
+	catalog.Add(LanguageEnglish, map[string]string{"error": "ERROR"})
+	catalog.Add(LanguageJapanese, map[string]string{"error": "エラー"})
+
+	tests := []struct {
+		name                   string
+		lcAll, lcMessages, env string
+		want                   Language
+	}{
+		{"LANG", "", "", "ja_JP.UTF-8", LanguageJapanese},
+		{"LC_ALL wins", "C", "", "ja_JP.UTF-8", LanguageEnglish},
+		{"LC_MESSAGES wins over LANG", "", "ja_JP.UTF-8", "en_US.UTF-8", LanguageJapanese},
+		{"unsupported", "", "", "de_DE.UTF-8", LanguageEnglish},
+		{"unset", "", "", "", LanguageEnglish},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", tt.lcAll)
+			t.Setenv("LC_MESSAGES", tt.lcMessages)
+			t.Setenv("LANG", tt.env)
+
+			if got := catalog.Detect(); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalogLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"error": "FEHLER"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := NewCatalog()
+	if err := catalog.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+
+	if got := catalog.Translate("de", "error"); got != "FEHLER" {
+		t.Errorf("Translate(de, error) = %q, want FEHLER", got)
+	}
+
+	if err := catalog.LoadDir(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("LoadDir() of a missing directory error = %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "fr.json"), []byte(`{"error": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := catalog.LoadDir(dir); err == nil {
+		t.Error("LoadDir() with an invalid locale file should fail")
+	}
+}
+
+func TestFormatterTranslate(t *testing.T) {
+	formatter := NewFormatter().WithColor(false).WithLanguage(LanguageSpanish)
+
+	if formatter.Language() != LanguageSpanish {
+		t.Errorf("Language() = %q, want es", formatter.Language())
+	}
+
+	if got := formatter.Translate("filename"); got != "Nombre de archivo" {
+		t.Errorf("Translate(filename) = %q", got)
+	}
+
+	if got := formatter.FormatMessage(MessageWarning, "disk"); got != "ADVERTENCIA: disk" {
+		t.Errorf("FormatMessage() = %q", got)
+	}
+}
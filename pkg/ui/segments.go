@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/forest6511/gdl/pkg/types"
+)
+
+// segmentCell is what one character of a segment map shows.
+type segmentCell int
+
+const (
+	cellEmpty segmentCell = iota
+	cellPartial
+	cellDone
+	cellFailed
+)
+
+// segmentCellRunes are the characters drawn for each cell kind.
+var segmentCellRunes = map[segmentCell]string{
+	cellEmpty:   "░",
+	cellPartial: "▓",
+	cellDone:    "█",
+	cellFailed:  "x",
+}
+
+// segmentCellColors are the colors of each cell kind when color is enabled.
+var segmentCellColors = map[segmentCell]string{
+	cellEmpty:   ColorWhite,
+	cellPartial: ColorYellow,
+	cellDone:    ColorGreen,
+	cellFailed:  ColorRed,
+}
+
+// FormatSegmentMap renders the byte ranges of a chunked download as a bar of
+// width characters, like aria2's segment display: "█" for received ranges,
+// "▓" for partly received ones, "░" for ranges not started and "x" for the
+// missing part of a failed segment. A segment that stops advancing shows up
+// as a gap while the rest of the bar fills.
+func FormatSegmentMap(segments []types.Segment, width int) string {
+	var b strings.Builder
+	for _, cell := range segmentCells(segments, width) {
+		b.WriteString(segmentCellRunes[cell])
+	}
+
+	return b.String()
+}
+
+// formatSegmentBar renders the segment map, colored when color is enabled.
+func (f *Formatter) formatSegmentBar(segments []types.Segment, width int) string {
+	if !f.colorEnabled {
+		return FormatSegmentMap(segments, width)
+	}
+
+	var b strings.Builder
+
+	cells := segmentCells(segments, width)
+	for i := 0; i < len(cells); {
+		// Color runs of equal cells at once
+		j := i
+		for j < len(cells) && cells[j] == cells[i] {
+			j++
+		}
+
+		b.WriteString(f.colorize(segmentCellColors[cells[i]], strings.Repeat(segmentCellRunes[cells[i]], j-i)))
+		i = j
+	}
+
+	return b.String()
+}
+
+// segmentCells maps each of width cells to the part of the file it covers and
+// returns what the cell shows.
+func segmentCells(segments []types.Segment, width int) []segmentCell {
+	if width <= 0 || len(segments) == 0 {
+		return nil
+	}
+
+	first, last := segments[0].Start, segments[0].End
+	for _, segment := range segments[1:] {
+		first = min(first, segment.Start)
+		last = max(last, segment.End)
+	}
+
+	span := last - first + 1
+	cells := make([]segmentCell, width)
+
+	for i := range cells {
+		lo := first + span*int64(i)/int64(width)
+		hi := max(first+span*int64(i+1)/int64(width), lo+1)
+
+		var received, size int64
+
+		failed := false
+
+		for _, segment := range segments {
+			overlapStart, overlapEnd := max(lo, segment.Start), min(hi, segment.End+1)
+			if overlapStart >= overlapEnd {
+				continue
+			}
+
+			size += overlapEnd - overlapStart
+
+			doneEnd := min(overlapEnd, segment.Start+segment.Downloaded)
+			if doneEnd > overlapStart {
+				received += doneEnd - overlapStart
+			}
+
+			if segment.State == types.SegmentFailed && doneEnd < overlapEnd {
+				failed = true
+			}
+		}
+
+		switch {
+		case failed:
+			cells[i] = cellFailed
+		case size > 0 && received >= size:
+			cells[i] = cellDone
+		case received > 0:
+			cells[i] = cellPartial
+		default:
+			cells[i] = cellEmpty
+		}
+	}
+
+	return cells
+}
@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/term"
+)
+
+// DefaultTerminalWidth is the width assumed when a terminal's width cannot be
+// determined.
+const DefaultTerminalWidth = 80
+
+// IsTerminal reports whether f is connected to a terminal (a TTY, or a
+// console on Windows) rather than a file or a pipe.
+func IsTerminal(f *os.File) bool {
+	return f != nil && term.IsTerminal(int(f.Fd())) // #nosec G115 -- file descriptors fit in an int
+}
+
+// TerminalWidth returns the number of columns of the terminal f is connected
+// to, falling back to $COLUMNS and then DefaultTerminalWidth.
+func TerminalWidth(f *os.File) int {
+	if f != nil {
+		// #nosec G115 -- file descriptors fit in an int
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+
+	return DefaultTerminalWidth
+}
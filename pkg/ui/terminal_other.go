@@ -0,0 +1,12 @@
+//go:build !windows
+
+package ui
+
+import "os"
+
+// EnableVirtualTerminal reports whether f accepts ANSI escapes. Terminals
+// outside Windows always do; on Windows it turns on escape processing for
+// the console.
+func EnableVirtualTerminal(f *os.File) bool {
+	return IsTerminal(f)
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package ui
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// EnableVirtualTerminal turns on ANSI escape processing for the console f
+// is connected to, which Windows 10 and later support but don't enable by
+// default, and reports whether colors and cursor movement can be used.
+func EnableVirtualTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+
+	handle := windows.Handle(f.Fd())
+
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return false
+	}
+
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
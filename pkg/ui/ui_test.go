@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	downloadErrors "github.com/forest6511/gdl/pkg/errors"
+	"github.com/forest6511/gdl/pkg/types"
 )
 
 func TestNewFormatter(t *testing.T) {
@@ -67,6 +68,22 @@ func TestFormatter_FormatDownloadError(t *testing.T) {
 	}
 }
 
+func TestFormatter_FormatResponseBody(t *testing.T) {
+	formatter := NewFormatter()
+
+	downloadErr := downloadErrors.FromHTTPStatus(403, "https://example.com/file")
+	downloadErr.ResponseBody = `{"message": "Bad credentials"}`
+
+	if msg := formatter.FormatError(downloadErr, &ErrorFormatOptions{MultiLine: true}); strings.Contains(msg, "Bad credentials") {
+		t.Errorf("FormatError() = %q, want the response body only when requested", msg)
+	}
+
+	msg := formatter.FormatError(downloadErr, &ErrorFormatOptions{MultiLine: true, ShowResponse: true})
+	if !strings.Contains(msg, `Response Body: {"message": "Bad credentials"}`) {
+		t.Errorf("FormatError() = %q, want the response body", msg)
+	}
+}
+
 func TestFormatter_FormatMessage(t *testing.T) {
 	formatter := NewFormatter()
 
@@ -453,6 +470,22 @@ func TestIsTerminalInteractive(t *testing.T) {
 	_ = result
 }
 
+func TestTerminalWidth(t *testing.T) {
+	if IsTerminal(nil) {
+		t.Error("IsTerminal(nil) = true")
+	}
+
+	t.Setenv("COLUMNS", "132")
+	if got := TerminalWidth(nil); got != 132 {
+		t.Errorf("TerminalWidth() with COLUMNS=132 = %d", got)
+	}
+
+	t.Setenv("COLUMNS", "")
+	if got := TerminalWidth(nil); got != DefaultTerminalWidth {
+		t.Errorf("TerminalWidth() = %d, want %d", got, DefaultTerminalWidth)
+	}
+}
+
 func TestSupportsColor(t *testing.T) {
 	// Test the supportsColor function
 	result := supportsColor()
@@ -662,3 +695,50 @@ func TestFormatter_SelectPromptNonInteractive(t *testing.T) {
 		t.Errorf("Expected default index 1, got %d", result)
 	}
 }
+
+func TestFormatSegmentMap(t *testing.T) {
+	segments := []types.Segment{
+		{Index: 0, Start: 0, End: 399, Downloaded: 400, State: types.SegmentComplete},
+		{Index: 1, Start: 400, End: 799, Downloaded: 200, State: types.SegmentActive},
+		{Index: 2, Start: 800, End: 1199, Downloaded: 100, State: types.SegmentFailed},
+		{Index: 3, Start: 1200, End: 1599, State: types.SegmentPending},
+	}
+
+	tests := []struct {
+		name     string
+		segments []types.Segment
+		width    int
+		want     string
+	}{
+		{"one cell per 100 bytes", segments, 16, "████" + "██░░" + "█xxx" + "░░░░"},
+		{"cells spanning segments", segments, 4, "█▓x░"},
+		{"partial cells", segments, 32, "████████" + "████░░░░" + "██xxxxxx" + "░░░░░░░░"},
+		{"no segments", nil, 10, ""},
+		{"no width", segments, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatSegmentMap(tt.segments, tt.width); got != tt.want {
+				t.Errorf("FormatSegmentMap() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatter_FormatProgressBarSegments(t *testing.T) {
+	segments := []types.Segment{
+		{Start: 0, End: 99, Downloaded: 100, State: types.SegmentComplete},
+		{Start: 100, End: 199, State: types.SegmentPending},
+	}
+
+	bar := NewFormatter().WithColor(false).FormatProgressBar(100, 200, &ProgressBarOptions{
+		Width:          10,
+		ShowPercentage: true,
+		Segments:       segments,
+	})
+
+	if !strings.Contains(bar, "[█████░░░░░]") || !strings.Contains(bar, "50.0%") {
+		t.Errorf("FormatProgressBar() = %q, want the segment map and percentage", bar)
+	}
+}
@@ -0,0 +1,362 @@
+// Package urlglob expands curl-style URL patterns: sets such as
+// "{one,two,three}" and numeric or alphabetic ranges such as "[1-100]",
+// "[001-100]", "[0-100:10]" and "[a-z]".
+package urlglob
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxURLs bounds the number of URLs Expand generates when no limit is
+// given.
+const DefaultMaxURLs = 10000
+
+// maxRangeValues bounds the values of a single range, before any limit on the
+// whole pattern applies.
+const maxRangeValues = 1 << 20
+
+// ErrTooManyURLs is returned when a pattern expands to more URLs than allowed.
+var ErrTooManyURLs = errors.New("pattern expands to too many URLs")
+
+// Match is one URL generated from a pattern.
+type Match struct {
+	// URL is the expanded URL.
+	URL string
+
+	// Values holds the value each glob took for this URL, in the order the
+	// globs appear in the pattern. Values[0] replaces "#1" in an output
+	// template.
+	Values []string
+}
+
+// segment is a literal part of a pattern (values has one element) or a glob.
+type segment struct {
+	values []string
+	glob   bool
+}
+
+// Pattern is a parsed URL pattern.
+type Pattern struct {
+	segments []segment
+	globs    int
+}
+
+// HasGlob reports whether s contains a set or range to expand. A bracketed
+// IPv6 host such as "http://[::1]/" is not a range. A malformed pattern
+// counts as a glob, so that Parse reports the error.
+func HasGlob(s string) bool {
+	p, err := Parse(s)
+	if err != nil {
+		return strings.ContainsAny(s, "[{")
+	}
+
+	return p.globs > 0
+}
+
+// Parse parses a URL pattern. A backslash escapes the special characters
+// "[", "]", "{", "}", "," and "\".
+func Parse(s string) (*Pattern, error) {
+	p := &Pattern{}
+	var literal strings.Builder
+
+	flush := func() {
+		if literal.Len() > 0 {
+			p.segments = append(p.segments, segment{values: []string{literal.String()}})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte(`[]{},\`, s[i+1]) >= 0 {
+				i++
+				literal.WriteByte(s[i])
+			} else {
+				literal.WriteByte(c)
+			}
+
+		case '{':
+			values, end, err := parseSet(s, i)
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			p.segments = append(p.segments, segment{values: values, glob: true})
+			p.globs++
+			i = end
+
+		case '[':
+			if end, ok := ipv6Literal(s, i); ok {
+				literal.WriteString(s[i : end+1])
+				i = end
+				continue
+			}
+
+			values, end, err := parseRange(s, i)
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			p.segments = append(p.segments, segment{values: values, glob: true})
+			p.globs++
+			i = end
+
+		case ']', '}':
+			return nil, fmt.Errorf("unmatched %q at position %d", c, i)
+
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+
+	return p, nil
+}
+
+// parseSet parses the set starting with the "{" at s[start] and returns its
+// elements and the index of the closing "}".
+func parseSet(s string, start int) ([]string, int, error) {
+	var values []string
+	var current strings.Builder
+
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				current.WriteByte(s[i])
+			} else {
+				current.WriteByte(c)
+			}
+		case ',':
+			values = append(values, current.String())
+			current.Reset()
+		case '}':
+			return append(values, current.String()), i, nil
+		case '{', '[', ']':
+			return nil, 0, fmt.Errorf("nested %q in set at position %d", c, i)
+		default:
+			current.WriteByte(c)
+		}
+	}
+
+	return nil, 0, fmt.Errorf("unmatched '{' at position %d", start)
+}
+
+// parseRange parses the range starting with the "[" at s[start] and returns
+// its values and the index of the closing "]".
+func parseRange(s string, start int) ([]string, int, error) {
+	end := strings.IndexByte(s[start:], ']')
+	if end < 0 {
+		return nil, 0, fmt.Errorf("unmatched '[' at position %d", start)
+	}
+	end += start
+	spec := s[start+1 : end]
+
+	rangeText, stepText, hasStep := strings.Cut(spec, ":")
+	step := 1
+	if hasStep {
+		n, err := strconv.Atoi(stepText)
+		if err != nil || n < 1 {
+			return nil, 0, fmt.Errorf("invalid step %q in range [%s]", stepText, spec)
+		}
+		step = n
+	}
+
+	from, to, ok := strings.Cut(rangeText, "-")
+	if !ok || from == "" || to == "" {
+		return nil, 0, fmt.Errorf("invalid range [%s]: expected [first-last] or {a,b,...}", spec)
+	}
+
+	var values []string
+	var err error
+	if isLetter(from) && isLetter(to) {
+		values, err = letterRange(from[0], to[0], step)
+	} else {
+		values, err = numberRange(from, to, step)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid range [%s]: %w", spec, err)
+	}
+
+	return values, end, nil
+}
+
+// letterRange returns the letters from first to last, which must be of the
+// same case.
+func letterRange(first, last byte, step int) ([]string, error) {
+	if isLower(first) != isLower(last) {
+		return nil, errors.New("letters of different case")
+	}
+	if first > last {
+		return nil, errors.New("first letter after last")
+	}
+
+	var values []string
+	for c := int(first); c <= int(last); c += step {
+		values = append(values, string(rune(c)))
+	}
+
+	return values, nil
+}
+
+// numberRange returns the numbers from first to last. A first number with
+// leading zeros pads every value to its width, as in "[001-100]".
+func numberRange(first, last string, step int) ([]string, error) {
+	lo, err := strconv.ParseUint(first, 10, 63)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", first)
+	}
+	hi, err := strconv.ParseUint(last, 10, 63)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", last)
+	}
+	if lo > hi {
+		return nil, errors.New("first number greater than last")
+	}
+	if (hi-lo)/uint64(step) >= maxRangeValues {
+		return nil, ErrTooManyURLs
+	}
+
+	width := 0
+	if len(first) > 1 && first[0] == '0' {
+		width = len(first)
+	}
+
+	var values []string
+	for n := lo; n <= hi; n += uint64(step) {
+		values = append(values, fmt.Sprintf("%0*d", width, n))
+	}
+
+	return values, nil
+}
+
+// ipv6Literal reports whether the "[" at s[start] opens a bracketed IPv6
+// host, such as "[::1]" or "[fe80::1%25eth0]", and returns the index of its
+// closing "]".
+func ipv6Literal(s string, start int) (int, bool) {
+	if !strings.HasSuffix(s[:start], "://") {
+		return 0, false
+	}
+
+	end := strings.IndexByte(s[start:], ']')
+	if end < 0 {
+		return 0, false
+	}
+	end += start
+
+	host, _, _ := strings.Cut(s[start+1:end], "%")
+
+	return end, strings.Contains(host, ":") && net.ParseIP(host) != nil
+}
+
+func isLetter(s string) bool {
+	return len(s) == 1 && (isLower(s[0]) || (s[0] >= 'A' && s[0] <= 'Z'))
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+// Count returns the number of URLs the pattern expands to, or -1 if it
+// exceeds limit.
+func (p *Pattern) Count(limit int) int {
+	count := 1
+	for _, seg := range p.segments {
+		count *= len(seg.values)
+		if count > limit {
+			return -1
+		}
+	}
+
+	return count
+}
+
+// Globs returns the number of sets and ranges in the pattern.
+func (p *Pattern) Globs() int {
+	return p.globs
+}
+
+// Expand returns the URLs the pattern generates, varying the last glob
+// fastest. It fails with ErrTooManyURLs if there would be more than limit
+// (DefaultMaxURLs if limit <= 0).
+func (p *Pattern) Expand(limit int) ([]Match, error) {
+	if limit <= 0 {
+		limit = DefaultMaxURLs
+	}
+
+	count := p.Count(limit)
+	if count < 0 {
+		return nil, fmt.Errorf("%w (limit %d)", ErrTooManyURLs, limit)
+	}
+
+	matches := make([]Match, 0, count)
+	indexes := make([]int, len(p.segments))
+
+	for {
+		var url strings.Builder
+		values := make([]string, 0, p.globs)
+		for i, seg := range p.segments {
+			value := seg.values[indexes[i]]
+			url.WriteString(value)
+			if seg.glob {
+				values = append(values, value)
+			}
+		}
+		matches = append(matches, Match{URL: url.String(), Values: values})
+
+		// Advance the rightmost segment, carrying to the left
+		i := len(p.segments) - 1
+		for ; i >= 0; i-- {
+			indexes[i]++
+			if indexes[i] < len(p.segments[i].values) {
+				break
+			}
+			indexes[i] = 0
+		}
+		if i < 0 {
+			return matches, nil
+		}
+	}
+}
+
+// Expand parses pattern and returns the URLs it generates, at most limit
+// (DefaultMaxURLs if limit <= 0).
+func Expand(pattern string, limit int) ([]Match, error) {
+	p, err := Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Expand(limit)
+}
+
+// FormatOutput replaces "#1" to "#9" in template with the values of the
+// corresponding globs, as curl does for -o. References to globs the pattern
+// does not have are left as they are.
+func FormatOutput(template string, values []string) string {
+	if !strings.Contains(template, "#") {
+		return template
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] == '#' && i+1 < len(template) && template[i+1] >= '1' && template[i+1] <= '9' {
+			if n := int(template[i+1] - '1'); n < len(values) {
+				out.WriteString(values[n])
+				i++
+				continue
+			}
+		}
+		out.WriteByte(template[i])
+	}
+
+	return out.String()
+}
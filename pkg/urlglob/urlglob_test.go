@@ -0,0 +1,150 @@
+package urlglob
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func urls(matches []Match) []string {
+	out := make([]string, len(matches))
+	for i, m := range matches {
+		out[i] = m.URL
+	}
+	return out
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"https://example.com/file.zip", []string{"https://example.com/file.zip"}},
+		{"https://example.com/file[1-3].jpg", []string{
+			"https://example.com/file1.jpg", "https://example.com/file2.jpg", "https://example.com/file3.jpg",
+		}},
+		{"https://example.com/file[08-10].jpg", []string{
+			"https://example.com/file08.jpg", "https://example.com/file09.jpg", "https://example.com/file10.jpg",
+		}},
+		{"https://example.com/[0-20:10]", []string{
+			"https://example.com/0", "https://example.com/10", "https://example.com/20",
+		}},
+		{"https://example.com/[x-z]", []string{
+			"https://example.com/x", "https://example.com/y", "https://example.com/z",
+		}},
+		{"https://example.com/{a,b,c}.zip", []string{
+			"https://example.com/a.zip", "https://example.com/b.zip", "https://example.com/c.zip",
+		}},
+		{"https://example.com/file{,.sig}", []string{
+			"https://example.com/file", "https://example.com/file.sig",
+		}},
+		// The first glob varies slowest
+		{"https://{one,two}.example.com/[1-2]", []string{
+			"https://one.example.com/1", "https://one.example.com/2",
+			"https://two.example.com/1", "https://two.example.com/2",
+		}},
+		{`https://example.com/\[1-2\]{a\,b,c}`, []string{
+			"https://example.com/[1-2]a,b", "https://example.com/[1-2]c",
+		}},
+		{"http://[::1]:8080/file[1-2]", []string{
+			"http://[::1]:8080/file1", "http://[::1]:8080/file2",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			matches, err := Expand(tt.pattern, 0)
+			if err != nil {
+				t.Fatalf("Expand() error = %v", err)
+			}
+			if got := urls(matches); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpand_Values(t *testing.T) {
+	matches, err := Expand("https://{www,cdn}.example.com/img[01-02].png", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"www", "01"}, {"www", "02"}, {"cdn", "01"}, {"cdn", "02"}}
+	for i, m := range matches {
+		if !reflect.DeepEqual(m.Values, want[i]) {
+			t.Errorf("matches[%d].Values = %q, want %q", i, m.Values, want[i])
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []string{
+		"https://example.com/[1-",
+		"https://example.com/{a,b",
+		"https://example.com/a]",
+		"https://example.com/a}",
+		"https://example.com/[5-1]",
+		"https://example.com/[1]",
+		"https://example.com/[1-x]",
+		"https://example.com/[a-Z]",
+		"https://example.com/[1-5:0]",
+		"https://example.com/{a,{b}}",
+		"https://example.com/[0-99999999]",
+	}
+
+	for _, pattern := range tests {
+		if _, err := Parse(pattern); err == nil {
+			t.Errorf("Parse(%q) should fail", pattern)
+		}
+	}
+}
+
+func TestExpand_Limit(t *testing.T) {
+	_, err := Expand("https://example.com/[1-10]/[1-10]", 99)
+	if !errors.Is(err, ErrTooManyURLs) {
+		t.Errorf("Expand() error = %v, want ErrTooManyURLs", err)
+	}
+
+	if matches, err := Expand("https://example.com/[1-10]/[1-10]", 100); err != nil || len(matches) != 100 {
+		t.Errorf("Expand() = %d URLs, %v, want 100", len(matches), err)
+	}
+}
+
+func TestHasGlob(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/file.zip":     false,
+		"https://example.com/file[1-2]":    true,
+		"https://example.com/{a,b}":        true,
+		"http://[::1]/file.zip":            false,
+		`https://example.com/\{a\}`:        false,
+		"https://example.com/broken[1-":    true,
+		"http://[fe80::1%25eth0]:80/a.zip": false,
+	}
+
+	for pattern, want := range tests {
+		if got := HasGlob(pattern); got != want {
+			t.Errorf("HasGlob(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+}
+
+func TestFormatOutput(t *testing.T) {
+	tests := []struct {
+		template string
+		values   []string
+		want     string
+	}{
+		{"file_#1.jpg", []string{"007"}, "file_007.jpg"},
+		{"#2/#1.zip", []string{"a", "cdn"}, "cdn/a.zip"},
+		{"file_#3.jpg", []string{"1"}, "file_#3.jpg"},
+		{"#0 #", []string{"1"}, "#0 #"},
+		{"plain.txt", []string{"1"}, "plain.txt"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatOutput(tt.template, tt.values); got != tt.want {
+			t.Errorf("FormatOutput(%q, %q) = %q, want %q", tt.template, tt.values, got, tt.want)
+		}
+	}
+}
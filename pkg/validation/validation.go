@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	gdlerrors "github.com/forest6511/gdl/pkg/errors"
@@ -107,6 +108,13 @@ func ValidateDestination(dest string) error {
 		}
 	}
 
+	// Windows opens a device for names like NUL or COM1.txt, except in
+	// \\?\ paths, which bypass name parsing
+	if runtime.GOOS == "windows" && !HasLongPathPrefix(dest) && IsReservedFilename(filepath.Base(absPath)) {
+		return gdlerrors.NewValidationError("destination",
+			"destination "+dest+` uses a name reserved by Windows; add the \\?\ prefix to use it anyway`)
+	}
+
 	// Check if destination already exists and is a directory
 	if info, err := os.Stat(absPath); err == nil {
 		if info.IsDir() {
@@ -223,13 +231,15 @@ func SanitizeFilename(filename string) string {
 		return "download"
 	}
 
-	// Remove or replace dangerous characters
-	dangerous := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
-	sanitized := filename
+	// Remove or replace dangerous characters, including control characters,
+	// which Windows doesn't allow in names
+	sanitized := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
 
-	for _, char := range dangerous {
-		sanitized = strings.ReplaceAll(sanitized, char, "_")
-	}
+		return r
+	}, filename)
 
 	// Trim whitespace and dots to prevent hidden files or path issues
 	sanitized = strings.Trim(sanitized, " .")
@@ -239,6 +249,11 @@ func SanitizeFilename(filename string) string {
 		return "download"
 	}
 
+	// Keep Windows from opening a device instead of a file
+	if IsReservedFilename(sanitized) {
+		sanitized = "_" + sanitized
+	}
+
 	// Limit filename length to prevent filesystem issues
 	const maxFilenameLength = 255
 	if len(sanitized) > maxFilenameLength {
@@ -251,6 +266,35 @@ func SanitizeFilename(filename string) string {
 	return sanitized
 }
 
+// reservedFilenames are the device names Windows reserves, alone or with any
+// extension, in any case.
+var reservedFilenames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"COM¹": true, "COM²": true, "COM³": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	"LPT¹": true, "LPT²": true, "LPT³": true,
+}
+
+// IsReservedFilename reports whether Windows treats name as a device, such as
+// "NUL", "con.txt" or "COM1.tar.gz". Trailing spaces and dots are ignored, as
+// Windows ignores them.
+func IsReservedFilename(name string) bool {
+	stem, _, _ := strings.Cut(name, ".")
+	stem = strings.TrimRight(stem, " ")
+
+	return reservedFilenames[strings.ToUpper(stem)]
+}
+
+// HasLongPathPrefix reports whether path starts with the Windows
+// extended-length prefix \\?\, which lifts the 260-character MAX_PATH limit
+// and turns off name parsing, so reserved names can be used.
+func HasLongPathPrefix(path string) bool {
+	return strings.HasPrefix(path, `\\?\`)
+}
+
 // SetConfig sets the global validation configuration.
 // This should only be used for testing purposes.
 func SetConfig(config *Config) {
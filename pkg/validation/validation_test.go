@@ -349,6 +349,21 @@ func TestSanitizeFilename(t *testing.T) {
 			filename: "///\\\\\\",
 			expected: "download",
 		},
+		{
+			name:     "control characters",
+			filename: "report\x00\n2025.csv",
+			expected: "report__2025.csv",
+		},
+		{
+			name:     "reserved Windows name",
+			filename: "con.txt",
+			expected: "_con.txt",
+		},
+		{
+			name:     "reserved Windows name without extension",
+			filename: "LPT1",
+			expected: "_LPT1",
+		},
 	}
 
 	for _, tt := range tests {
@@ -361,6 +376,24 @@ func TestSanitizeFilename(t *testing.T) {
 	}
 }
 
+func TestIsReservedFilename(t *testing.T) {
+	for _, name := range []string{"CON", "nul", "Aux.txt", "com1.tar.gz", "LPT9", "prn ", "COM¹"} {
+		if !IsReservedFilename(name) {
+			t.Errorf("IsReservedFilename(%q) = false, want true", name)
+		}
+	}
+
+	for _, name := range []string{"console", "nul_file", "COM10", "lpt", "my.con", ""} {
+		if IsReservedFilename(name) {
+			t.Errorf("IsReservedFilename(%q) = true, want false", name)
+		}
+	}
+
+	if !HasLongPathPrefix(`\\?\C:\downloads\nul`) || HasLongPathPrefix(`C:\downloads`) {
+		t.Error("HasLongPathPrefix() misdetects the \\\\?\\ prefix")
+	}
+}
+
 func TestValidateDestination_DirectoryCreation(t *testing.T) {
 	// Test that the function can create parent directories
 	tempDir := t.TempDir()
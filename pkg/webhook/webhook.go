@@ -0,0 +1,207 @@
+// Package webhook posts JSON notifications about jobs to an HTTP endpoint,
+// signed with HMAC-SHA256 and retried when delivery fails.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	gdlerrors "github.com/forest6511/gdl/pkg/errors"
+)
+
+// Events a job goes through.
+const (
+	EventQueued    = "queued"
+	EventStarted   = "started"
+	EventProgress  = "progress"
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+)
+
+// Headers of a delivery. SignatureHeader holds "sha256=" and the hex HMAC-SHA256
+// of the body keyed with the secret, when there is one.
+const (
+	EventHeader     = "X-Gdl-Event"
+	SignatureHeader = "X-Gdl-Signature-256"
+)
+
+// Defaults of a Sender.
+const (
+	DefaultRetries    = 3
+	DefaultRetryDelay = time.Second
+	DefaultTimeout    = 10 * time.Second
+)
+
+// queueSize is how many payloads a Queue holds before progress payloads are
+// dropped and other ones wait.
+const queueSize = 64
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Job       string    `json:"job"`
+	URL       string    `json:"url"`
+	Output    string    `json:"output,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Percent   int       `json:"percent,omitempty"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	TotalSize int64     `json:"total_size,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Sender posts payloads to one endpoint.
+type Sender struct {
+	url    string
+	secret []byte
+	client *http.Client
+
+	// Retries is how many times a failed delivery is tried again, waiting
+	// RetryDelay, then twice as long each time.
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// NewSender returns a sender posting to url and signing with secret, or not
+// signing when secret is empty.
+func NewSender(url, secret string) *Sender {
+	return &Sender{
+		url:        url,
+		secret:     []byte(secret),
+		client:     &http.Client{Timeout: DefaultTimeout},
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// Sign returns the SignatureHeader value of body for secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts p, trying again after network errors, 429 and 5xx responses.
+// Other responses outside 2xx are not retried.
+func (s *Sender) Send(ctx context.Context, p *Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return gdlerrors.WrapError(err, gdlerrors.CodeUnknown, "encoding webhook payload")
+	}
+
+	delay := s.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(ctx, p.Event, body)
+		if err == nil || !retry || attempt >= s.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// post makes one delivery of body and reports whether a failure is worth
+// retrying.
+func (s *Sender) post(ctx context.Context, event string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeInvalidURL, "invalid webhook URL", s.url)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if len(s.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, gdlerrors.WrapErrorWithURL(err, gdlerrors.CodeNetworkError,
+			"webhook delivery failed", s.url)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	code := gdlerrors.CodeClientError
+	if resp.StatusCode >= 500 {
+		code = gdlerrors.CodeServerError
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+
+	return retry, gdlerrors.NewDownloadErrorWithDetails(code, "webhook delivery failed",
+		fmt.Sprintf("%s answered %s", s.url, resp.Status))
+}
+
+// Queue delivers payloads in order in the background, so that a slow or
+// unreachable endpoint does not hold up the jobs it reports on.
+type Queue struct {
+	sender  *Sender
+	payload chan *Payload
+	onError func(p *Payload, err error)
+	done    sync.WaitGroup
+}
+
+// NewQueue starts delivering payloads with sender. onError, if not nil, is
+// called with the payloads that could not be delivered.
+func NewQueue(sender *Sender, onError func(p *Payload, err error)) *Queue {
+	q := &Queue{sender: sender, payload: make(chan *Payload, queueSize), onError: onError}
+
+	q.done.Add(1)
+
+	go func() {
+		defer q.done.Done()
+
+		for p := range q.payload {
+			if err := sender.Send(context.Background(), p); err != nil && q.onError != nil {
+				q.onError(p, err)
+			}
+		}
+	}()
+
+	return q
+}
+
+// Notify queues p for delivery, stamping it with the current time. Progress
+// payloads are dropped while the queue is full; other ones wait for room.
+func (q *Queue) Notify(p *Payload) {
+	p.Time = time.Now()
+
+	if p.Event != EventProgress {
+		q.payload <- p
+		return
+	}
+
+	select {
+	case q.payload <- p:
+	default:
+	}
+}
+
+// Close delivers the queued payloads and stops the queue.
+func (q *Queue) Close() {
+	close(q.payload)
+	q.done.Wait()
+}
@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSender_Send(t *testing.T) {
+	var received Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if got := r.Header.Get(SignatureHeader); got != Sign([]byte("secret"), body) {
+			t.Errorf("signature = %q, want the HMAC of the body", got)
+		}
+		if got := r.Header.Get(EventHeader); got != EventCompleted {
+			t.Errorf("event header = %q, want %q", got, EventCompleted)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("content type = %q", got)
+		}
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("body is not a payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	p := &Payload{Event: EventCompleted, Job: "1", URL: "https://example.com/file", Status: "downloaded"}
+	if err := NewSender(server.URL, "secret").Send(context.Background(), p); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if received.Job != "1" || received.Status != "downloaded" {
+		t.Errorf("received %+v, want %+v", received, p)
+	}
+}
+
+func TestSender_Unsigned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(SignatureHeader); got != "" {
+			t.Errorf("signature = %q without a secret", got)
+		}
+	}))
+	defer server.Close()
+
+	if err := NewSender(server.URL, "").Send(context.Background(), &Payload{Event: EventQueued}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+}
+
+func TestSender_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		wantErr  bool
+		attempts int32
+	}{
+		{"server error then success", []int{500, 503, 200}, false, 3},
+		{"too many requests", []int{429, 204}, false, 2},
+		{"client error", []int{400, 200}, true, 1},
+		{"retries exhausted", []int{500, 500, 500}, true, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := attempts.Add(1)
+				w.WriteHeader(tt.statuses[min(int(n), len(tt.statuses))-1])
+			}))
+			defer server.Close()
+
+			sender := NewSender(server.URL, "")
+			sender.Retries = 2
+			sender.RetryDelay = time.Millisecond
+
+			err := sender.Send(context.Background(), &Payload{Event: EventFailed})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts.Load() != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts.Load(), tt.attempts)
+			}
+		})
+	}
+}
+
+func TestQueue(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		events = append(events, r.Header.Get(EventHeader))
+		if r.Header.Get(EventHeader) == EventFailed {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	var failed []string
+	q := NewQueue(NewSender(server.URL, ""), func(p *Payload, err error) {
+		failed = append(failed, p.Event)
+	})
+
+	for _, event := range []string{EventQueued, EventStarted, EventProgress, EventFailed} {
+		q.Notify(&Payload{Event: event})
+	}
+	q.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if want := []string{EventQueued, EventStarted, EventProgress, EventFailed}; !slices.Equal(events, want) {
+		t.Errorf("delivered %v, want %v in order", events, want)
+	}
+	if !slices.Equal(failed, []string{EventFailed}) {
+		t.Errorf("undelivered %v, want the rejected failed event", failed)
+	}
+}